@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"louis14/pkg/determinism"
+	"louis14/pkg/visualtest"
+)
+
+// Runs Web Platform Tests style reftests: each test page with a
+// <link rel="match" href="..."> is rendered along with its reference page,
+// and the two renderings must match within the tolerances given.
+func main() {
+	width := flag.Int("width", 800, "viewport width for both pages")
+	height := flag.Int("height", 600, "viewport height for both pages")
+	tolerance := flag.Int("tolerance", 2, "maximum difference per color channel (0-255)")
+	fuzzy := flag.Int("fuzzy", 0, "a pixel also matches any reference pixel within this radius")
+	maxDiff := flag.Float64("max-diff-percent", 0, "pass if at most this percentage of pixels differ")
+	minSSIM := flag.Float64("min-ssim", 0, "pass if the structural similarity is at least this (e.g. 0.99)")
+	reportDir := flag.String("report", "", "write an HTML report of the failing tests to this directory")
+	verbose := flag.Bool("v", false, "also list passing and skipped tests")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <test-or-dir>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Runs the reftests in the given files and directories; absolute reference\n")
+		fmt.Fprintf(os.Stderr, "hrefs are resolved against the directory given.\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	determinism.Enable()
+	opts := visualtest.DefaultOptions()
+	opts.Tolerance = *tolerance
+	opts.FuzzyRadius = *fuzzy
+	opts.MaxDifferentPercent = *maxDiff
+	opts.MinSSIM = *minSSIM
+
+	var report *visualtest.Report
+	if *reportDir != "" {
+		report = visualtest.NewReport(*reportDir)
+	}
+
+	workDir, err := os.MkdirTemp("", "l14-reftest")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer os.RemoveAll(workDir)
+
+	passed, failed, skipped := 0, 0, 0
+	for _, root := range flag.Args() {
+		reftests, err := visualtest.FindReftests(root)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		for i, rt := range reftests {
+			if _, err := os.Stat(rt.RefPath); err != nil {
+				if *verbose {
+					fmt.Printf("SKIP  %s (reference not found: %s)\n", rt.TestPath, rt.RefPath)
+				}
+				skipped++
+				continue
+			}
+
+			outDir := filepath.Join(workDir, fmt.Sprint(i))
+			if err := os.MkdirAll(outDir, 0755); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			result, err := visualtest.RunReftest(rt, *width, *height, opts, outDir)
+			if err != nil {
+				fmt.Printf("ERROR %s (%v)\n", rt.TestPath, err)
+				failed++
+				continue
+			}
+
+			if result.Match {
+				if *verbose {
+					fmt.Printf("PASS  %s\n", rt.TestPath)
+				}
+				passed++
+				continue
+			}
+			failed++
+			pct := 100 * float64(result.DifferentPixels) / float64(result.TotalPixels)
+			fmt.Printf("FAIL  %s (%d pixels / %.2f%%, max diff %d, SSIM %.4f)\n",
+				rt.TestPath, result.DifferentPixels, pct, result.MaxDifference, result.SSIM)
+			if report != nil {
+				if err := report.Add(rt.TestPath, result.RefImage, result.TestImage, result.DiffImage, result.CompareResult); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				}
+			}
+		}
+	}
+
+	total := passed + failed
+	fmt.Printf("\n%d/%d passed, %d failed, %d skipped\n", passed, total, failed, skipped)
+	if report != nil && report.Len() > 0 {
+		path, err := report.WriteHTML()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+		} else {
+			fmt.Printf("Report: %s\n", path)
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
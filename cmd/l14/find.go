@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// findBar is the find-in-page bar shown below the URL bar. Typing in it
+// highlights the matches on the page shown; Enter and the arrow buttons
+// step through them, scrolling each into view.
+type findBar struct {
+	view   *pageView
+	entry  *widget.Entry
+	count  *widget.Label
+	bar    *fyne.Container
+	window fyne.Window
+}
+
+func newFindBar(window fyne.Window, view *pageView) *findBar {
+	f := &findBar{
+		view:   view,
+		entry:  widget.NewEntry(),
+		count:  widget.NewLabel(""),
+		window: window,
+	}
+	f.entry.SetPlaceHolder("Find in page")
+	f.entry.OnChanged = func(string) { f.search() }
+	f.entry.OnSubmitted = func(string) { f.step(1) }
+	buttons := container.NewHBox(
+		f.count,
+		widget.NewButtonWithIcon("", theme.MoveUpIcon(), func() { f.step(-1) }),
+		widget.NewButtonWithIcon("", theme.MoveDownIcon(), func() { f.step(1) }),
+		widget.NewButtonWithIcon("", theme.CancelIcon(), f.close),
+	)
+	f.bar = container.NewBorder(nil, nil, nil, buttons, f.entry)
+	f.bar.Hide()
+	return f
+}
+
+// open shows the bar, focuses its entry, and searches again for the text
+// left in it from the last search.
+func (f *findBar) open() {
+	f.bar.Show()
+	f.window.Canvas().Focus(f.entry)
+	f.search()
+}
+
+// close hides the bar and clears the highlights.
+func (f *findBar) close() {
+	f.bar.Hide()
+	if f.view.page != nil {
+		f.view.page.Find("")
+		f.view.redraw()
+	}
+	f.count.SetText("")
+	f.window.Canvas().Focus(f.view)
+}
+
+// search runs the entry's text as a search of the page shown, for the
+// entry having changed or a new page having been shown.
+func (f *findBar) search() {
+	if f.view.page == nil || f.bar.Hidden {
+		return
+	}
+	f.view.page.Find(f.entry.Text)
+	f.view.revealMatch()
+	f.updateCount()
+}
+
+// step makes the match delta matches from the active one active.
+func (f *findBar) step(delta int) {
+	if f.view.page == nil || !f.view.page.FindStep(delta) {
+		return
+	}
+	f.view.revealMatch()
+	f.updateCount()
+}
+
+// updateCount shows which match is active and how many there are.
+func (f *findBar) updateCount() {
+	active, count := f.view.page.FindStatus()
+	switch {
+	case f.entry.Text == "":
+		f.count.SetText("")
+	case count == 0:
+		f.count.SetText("No matches")
+	default:
+		f.count.SetText(fmt.Sprintf("%d of %d", active+1, count))
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import "strings"
+
+// history is the list of URLs the window has shown, for the back and
+// forward buttons and history.go().
+type history struct {
+	entries []string
+	index   int // Entry shown; -1 before the first page
+}
+
+func newHistory() *history {
+	return &history{index: -1}
+}
+
+// current returns the URL shown, or "" before the first page.
+func (h *history) current() string {
+	if h.index < 0 {
+		return ""
+	}
+	return h.entries[h.index]
+}
+
+// push adds url after the current entry, dropping the entries forward of
+// it.
+func (h *history) push(url string) {
+	h.entries = append(h.entries[:h.index+1], url)
+	h.index++
+}
+
+// replace replaces the current entry with url.
+func (h *history) replace(url string) {
+	if h.index < 0 {
+		h.push(url)
+		return
+	}
+	h.entries[h.index] = url
+}
+
+// peek returns the URL delta entries from the current one, if there is one.
+func (h *history) peek(delta int) (string, bool) {
+	i := h.index + delta
+	if delta == 0 || i < 0 || i >= len(h.entries) {
+		return "", false
+	}
+	return h.entries[i], true
+}
+
+// move makes the entry delta entries from the current one current.
+func (h *history) move(delta int) {
+	if _, ok := h.peek(delta); ok {
+		h.index += delta
+	}
+}
+
+// sameDocument reports whether two URLs differ only in their fragments,
+// so moving from one to the other needs no reload.
+func sameDocument(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	strip := func(url string) string {
+		if i := strings.IndexByte(url, '#'); i >= 0 {
+			return url[:i]
+		}
+		return url
+	}
+	return strip(a) == strip(b)
+}
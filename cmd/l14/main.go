@@ -1,17 +1,17 @@
 package main
 
 import (
-	"fmt"
-	"image"
+	"os"
+	"path/filepath"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
-	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 
 	"louis14/pkg/js"
-	"louis14/pkg/resource"
 	stdnet "louis14/std/net"
 )
 
@@ -20,52 +20,59 @@ func main() {
 	w := a.NewWindow("louis14 browser")
 	w.Resize(fyne.NewSize(1024, 768))
 
-	// Blank initial render target
-	target := image.NewRGBA(image.Rect(0, 0, 1024, 700))
-	canvasImg := canvas.NewImageFromImage(target)
-	canvasImg.FillMode = canvas.ImageFillOriginal
-
-	// Status label
-	status := widget.NewLabel("Enter a URL and press Enter")
+	// Cookies persist in the user's config directory, so logins outlast
+	// the session
+	if dir, err := os.UserConfigDir(); err == nil {
+		stdnet.DefaultClient.SetJar(stdnet.NewJar(filepath.Join(dir, "louis14", "cookies.json")))
+	}
 
-	// URL bar
-	urlEntry := widget.NewEntry()
-	urlEntry.SetPlaceHolder("https://example.com")
-	urlEntry.OnSubmitted = func(url string) {
-		status.SetText("Loading " + url + "...")
-		go func() {
-			// Fetch
-			body, _, err := stdnet.Fetch(url)
-			if err != nil {
-				status.SetText("Error: " + err.Error())
-				return
-			}
+	// Page view: renders the current page window and handles scrolling
+	view := newPageView(1024, 700)
 
-			// Render
-			renderTarget := image.NewRGBA(image.Rect(0, 0, 1024, 700))
-			fetcher := resource.NewFetcher(url)
-			renderer := resource.NewLouis14Renderer(fetcher)
-			renderer.SetJSEngine(js.New())
-			if err := renderer.Render(string(body), renderTarget); err != nil {
-				status.SetText("Render error: " + err.Error())
-				return
-			}
+	// Web storage: localStorage persists in the user's config directory,
+	// sessionStorage lasts as long as the window
+	localDir := ""
+	if dir, err := os.UserConfigDir(); err == nil {
+		localDir = filepath.Join(dir, "louis14", "localStorage")
+	}
 
-			// Update display
-			canvasImg.Image = renderTarget
-			canvasImg.Refresh()
-			status.SetText(url)
-			w.SetTitle(fmt.Sprintf("louis14 — %s", url))
-		}()
+	b := &browser{
+		window:         w,
+		view:           view,
+		status:         widget.NewLabel("Enter a URL and press Enter"),
+		urlEntry:       widget.NewEntry(),
+		history:        newHistory(),
+		find:           newFindBar(w, view),
+		localStorage:   js.NewStorage(localDir),
+		sessionStorage: js.NewStorage(""),
 	}
+	b.back = widget.NewButtonWithIcon("", theme.NavigateBackIcon(), func() { b.traverse(-1) })
+	b.forward = widget.NewButtonWithIcon("", theme.NavigateNextIcon(), func() { b.traverse(1) })
+	b.stop = widget.NewButtonWithIcon("", theme.MediaStopIcon(), b.stopLoad)
+	b.stop.Disable()
+	b.updateButtons()
+	view.onNavigate = b.navigate
+
+	// URL bar
+	b.urlEntry.SetPlaceHolder("https://example.com")
+	b.urlEntry.OnSubmitted = func(url string) { b.navigate(js.Navigation{URL: url}) }
+
+	// Find in page: Ctrl+F (Cmd+F on macOS) or the search button opens the
+	// find bar
+	findButton := widget.NewButtonWithIcon("", theme.SearchIcon(), b.find.open)
+	w.Canvas().AddShortcut(&desktop.CustomShortcut{KeyName: fyne.KeyF, Modifier: fyne.KeyModifierShortcutDefault},
+		func(fyne.Shortcut) { b.find.open() })
 
-	// Layout: URL bar on top, status at bottom, image fills center
-	topBar := container.NewBorder(nil, nil, nil, nil, urlEntry)
-	content := container.NewBorder(topBar, status, nil, nil, canvasImg)
+	// Layout: navigation buttons, URL bar, and find bar on top, status at
+	// bottom, page view fills center
+	urlBar := container.NewBorder(nil, nil, container.NewHBox(b.back, b.forward, b.stop), findButton, b.urlEntry)
+	topBar := container.NewVBox(urlBar, b.find.bar)
+	content := container.NewBorder(topBar, b.status, nil, nil, view)
 	w.SetContent(content)
 
 	// Keep focus on URL entry to prevent Tab freeze with no other focusable widgets
-	w.Canvas().Focus(urlEntry)
+	w.Canvas().Focus(b.urlEntry)
 
 	w.ShowAndRun()
+	b.localStorage.Flush() // Save what scripts stored since the last save
 }
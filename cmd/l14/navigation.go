@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/widget"
+
+	"louis14/pkg/js"
+	"louis14/pkg/resource"
+	stdnet "louis14/std/net"
+)
+
+// browser is the window's navigation controller. It loads the pages the
+// user enters, links lead to, and scripts navigate to, and keeps the
+// history the back and forward buttons move through. A URL that differs
+// from the page shown only in its fragment scrolls to the fragment's
+// target instead of loading again. Its methods run on the UI goroutine;
+// pages are fetched and laid out on another.
+//
+// Each page is loaded with a context that is canceled when a later
+// navigation replaces the load, or the user stops it, and that lasts,
+// once the page is shown, until another page replaces it, stopping the
+// fetches and scripts of a page no longer wanted.
+type browser struct {
+	window        fyne.Window
+	view          *pageView
+	status        *widget.Label
+	urlEntry      *widget.Entry
+	back, forward *widget.Button
+	stop          *widget.Button
+	history       *history
+	find          *findBar
+
+	localStorage   *js.Storage // Shared by all pages, saved across runs
+	sessionStorage *js.Storage // Shared by the pages shown in the window
+
+	loads      int                // Number of loads started, so that only the latest is shown
+	cancelLoad context.CancelFunc // Cancels the load in progress, if any
+	cancelPage context.CancelFunc // Ends the page shown, if any
+}
+
+// navigate carries out a navigation to a URL, or through the history when
+// nav has no URL.
+func (b *browser) navigate(nav js.Navigation) {
+	if nav.URL == "" {
+		b.traverse(nav.Delta)
+		return
+	}
+	commit := b.history.push
+	if nav.Replace {
+		commit = b.history.replace
+	}
+	if strings.Contains(nav.URL, "#") && b.view.page != nil && sameDocument(b.history.current(), nav.URL) {
+		commit(nav.URL)
+		b.showFragment(nav.URL)
+		return
+	}
+	b.load(nav.URL, func() { commit(nav.URL) })
+}
+
+// traverse moves delta entries back (negative) or forward through the
+// history.
+func (b *browser) traverse(delta int) {
+	url, ok := b.history.peek(delta)
+	if !ok {
+		return
+	}
+	if b.view.page != nil && sameDocument(b.history.current(), url) {
+		b.history.move(delta)
+		b.showFragment(url)
+		return
+	}
+	b.load(url, func() { b.history.move(delta) })
+}
+
+// showFragment moves the page shown to url, which differs from its URL
+// only in the fragment, and scrolls to the fragment's target.
+func (b *browser) showFragment(url string) {
+	if y, ok := b.view.page.NavigateToFragment(url); ok {
+		b.view.ScrollTo(b.view.scrollX, y)
+	}
+	b.shown(url)
+}
+
+// load fetches, scripts, and lays out the page at url, then shows it and
+// calls commit to record it in the history. While the page downloads,
+// previews of what has arrived are shown. A load that fails shows an error
+// page for url in place of the page; one that is stopped leaves the page
+// shown and the history as they were.
+func (b *browser) load(url string, commit func()) {
+	b.stopLoad()
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancelLoad = cancel
+	b.stop.Enable()
+	b.loads++
+	load := b.loads
+	b.status.SetText("Loading " + url + "...")
+	width, height := b.view.ViewportSize()
+	shown := b.view.page
+	previewed := false // A preview replaced shown; only used on the UI goroutine
+	go func() {
+		// Fetch
+		stream, err := stdnet.OpenContext(ctx, url)
+		if err != nil {
+			errPage := errorPage(ctx, url, err, width, height)
+			fyne.Do(func() {
+				if load != b.loads {
+					cancel()
+					return
+				}
+				if errPage == nil {
+					b.loadFailed("Error: ", err)
+					cancel()
+					return
+				}
+				b.commitPage(errPage, url, false, cancel, commit)
+				b.status.SetText("Error: " + err.Error())
+			})
+			return
+		}
+		defer stream.Body.Close()
+
+		// Parse as the page arrives, showing previews, then run scripts
+		// and lay out for the view's viewport
+		fetcher := resource.NewFetcher(url)
+		renderer := resource.NewLouis14Renderer(fetcher)
+		engine := js.New()
+		engine.SetBaseURL(url)
+		engine.SetLocalStorage(b.localStorage)
+		engine.SetSessionStorage(b.sessionStorage)
+		renderer.SetJSEngine(engine)
+		page, err := renderer.LoadStream(ctx, stream.Body, width, height, func(preview *resource.Page) {
+			fyne.Do(func() {
+				if load != b.loads {
+					return
+				}
+				b.showPage(preview, previewed)
+				previewed = true
+			})
+		})
+		var errPage *resource.Page
+		if err != nil {
+			errPage = errorPage(ctx, url, err, width, height)
+		}
+
+		// Update display
+		fyne.Do(func() {
+			if load != b.loads {
+				cancel()
+				return // A later navigation replaced this one
+			}
+			if err != nil {
+				if errPage == nil {
+					if previewed {
+						b.view.SetPage(shown)
+					}
+					b.loadFailed("Render error: ", err)
+					cancel()
+					return
+				}
+				b.commitPage(errPage, url, false, cancel, commit)
+				b.status.SetText("Render error: " + err.Error())
+				return
+			}
+			b.commitPage(page, url, previewed, cancel, commit)
+			// Scripts may have navigated while the page loaded
+			b.view.takeNavigation()
+		})
+	}()
+}
+
+// commitPage shows page, loaded for url with the context cancel ends, in
+// place of the page shown, and calls commit to record it in the history.
+// keepScroll is as for showPage.
+func (b *browser) commitPage(page *resource.Page, url string, keepScroll bool, cancel context.CancelFunc, commit func()) {
+	b.cancelLoad = nil
+	b.stop.Disable()
+	if b.cancelPage != nil {
+		b.cancelPage()
+	}
+	b.cancelPage = cancel
+	commit()
+	if page.URL() != url {
+		// The page redirected with <meta http-equiv="refresh">
+		url = page.URL()
+		b.history.replace(url)
+	}
+	b.showPage(page, keepScroll)
+	b.find.search()
+	if i := strings.IndexByte(url, '#'); i >= 0 {
+		if y, ok := page.FragmentOffset(url[i+1:]); ok {
+			b.view.ScrollTo(0, y)
+		}
+	}
+	b.shown(url)
+	b.window.Canvas().Focus(b.view)
+}
+
+// errorPage lays out the error page for the failed load of url, or
+// returns nil if the load was stopped or the error page fails too. It runs
+// on the load's goroutine.
+func errorPage(ctx context.Context, url string, err error, width, height int) *resource.Page {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+	renderer := resource.NewLouis14Renderer(resource.NewFetcher(url))
+	page, err := renderer.Load(ctx, resource.ErrorPage(url, err), width, height)
+	if err != nil {
+		return nil
+	}
+	return page
+}
+
+// stopLoad cancels the load in progress, if any, leaving the page shown.
+func (b *browser) stopLoad() {
+	if b.cancelLoad != nil {
+		b.cancelLoad()
+		b.cancelLoad = nil
+	}
+	b.stop.Disable()
+}
+
+// loadFailed reports why the latest load did not show its page.
+func (b *browser) loadFailed(prefix string, err error) {
+	b.cancelLoad = nil
+	b.stop.Disable()
+	if errors.Is(err, context.Canceled) {
+		b.status.SetText("Stopped")
+		return
+	}
+	b.status.SetText(prefix + err.Error())
+}
+
+// showPage shows page in the view, at the top unless keepScroll, when it
+// replaces a preview of the same document the user may have scrolled.
+func (b *browser) showPage(page *resource.Page, keepScroll bool) {
+	x, y := b.view.scrollX, b.view.scrollY
+	b.view.SetPage(page)
+	if keepScroll {
+		b.view.ScrollTo(x, y)
+	}
+}
+
+// shown updates the window for the URL now shown.
+func (b *browser) shown(url string) {
+	b.urlEntry.SetText(url)
+	b.status.SetText(url)
+	b.window.SetTitle(fmt.Sprintf("louis14 — %s", url))
+	b.updateButtons()
+}
+
+// updateButtons enables the back and forward buttons when there is
+// history to move through.
+func (b *browser) updateButtons() {
+	for _, button := range []struct {
+		w     *widget.Button
+		delta int
+	}{{b.back, -1}, {b.forward, 1}} {
+		if _, ok := b.history.peek(button.delta); ok {
+			button.w.Enable()
+		} else {
+			button.w.Disable()
+		}
+	}
+}
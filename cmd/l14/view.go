@@ -0,0 +1,327 @@
+package main
+
+import (
+	"image"
+	"math"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/widget"
+
+	"louis14/pkg/js"
+	"louis14/pkg/resource"
+)
+
+// lineScrollStep is the distance in pixels scrolled by one arrow key press.
+const lineScrollStep = 40
+
+// caretBlinkInterval is how long the text caret stays shown or hidden.
+const caretBlinkInterval = 530 * time.Millisecond
+
+// taskInterval is how often the page's script timers, animation frame
+// callbacks, and transitions are run, about once per display frame.
+const taskInterval = 16 * time.Millisecond
+
+// pageView displays a resource.Page and scrolls it in response to the
+// mouse wheel and the arrow, Page Up/Down, Home/End, and space keys. The
+// wheel scrolls the scroll container under the pointer first.
+// Mouse movement and clicks drive the page's :hover, :active, and :focus
+// styles. Dragging selects text, which the copy shortcut copies to the
+// clipboard. While a text field has focus, typing edits it instead.
+// Navigations the page requests, by link clicks or scripts, are passed to
+// onNavigate.
+type pageView struct {
+	widget.BaseWidget
+
+	img        *canvas.Image
+	frame      *image.RGBA
+	page       *resource.Page
+	scrollX    float64
+	scrollY    float64
+	caretOn    bool                    // Blink phase of the text caret
+	onNavigate func(nav js.Navigation) // Carries out the page's navigations
+}
+
+var (
+	_ fyne.Scrollable   = (*pageView)(nil)
+	_ fyne.Focusable    = (*pageView)(nil)
+	_ fyne.Tappable     = (*pageView)(nil)
+	_ fyne.Shortcutable = (*pageView)(nil)
+
+	_ desktop.Hoverable = (*pageView)(nil)
+	_ desktop.Mouseable = (*pageView)(nil)
+)
+
+func newPageView(width, height int) *pageView {
+	v := &pageView{frame: image.NewRGBA(image.Rect(0, 0, width, height))}
+	v.img = canvas.NewImageFromImage(v.frame)
+	v.img.FillMode = canvas.ImageFillOriginal
+	v.ExtendBaseWidget(v)
+	go func() {
+		for range time.Tick(caretBlinkInterval) {
+			fyne.Do(v.blinkCaret)
+		}
+	}()
+	go func() {
+		last := time.Now()
+		for now := range time.Tick(taskInterval) {
+			elapsed := now.Sub(last)
+			last = now
+			fyne.Do(func() { v.runTasks(elapsed) })
+		}
+	}()
+	return v
+}
+
+// runTasks runs the page's script timers that came due in elapsed and its
+// animation frame callbacks, and advances its transitions.
+func (v *pageView) runTasks(elapsed time.Duration) {
+	if v.page != nil && v.page.RunTasks(elapsed) {
+		v.redraw()
+	}
+	v.takeNavigation()
+}
+
+// takeNavigation passes a navigation the page requested to onNavigate.
+func (v *pageView) takeNavigation() {
+	if v.page == nil || v.onNavigate == nil {
+		return
+	}
+	if nav, ok := v.page.TakeNavigation(); ok {
+		v.onNavigate(nav)
+	}
+}
+
+// blinkCaret toggles the caret of the focused text field.
+func (v *pageView) blinkCaret() {
+	if v.page == nil {
+		return
+	}
+	v.caretOn = !v.caretOn
+	if v.page.SetCaretVisible(v.caretOn) {
+		v.redraw()
+	}
+}
+
+func (v *pageView) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(v.img)
+}
+
+// SetPage shows a newly loaded page scrolled to the top.
+// The page is expected to be laid out for the view's frame size.
+func (v *pageView) SetPage(p *resource.Page) {
+	v.page = p
+	v.scrollX, v.scrollY = 0, 0
+	v.redraw()
+}
+
+// ViewportSize returns the size of the frame pages are rendered into.
+func (v *pageView) ViewportSize() (width, height int) {
+	b := v.frame.Bounds()
+	return b.Dx(), b.Dy()
+}
+
+// ScrollBy moves the viewport by (dx, dy) pixels, clamped to the page.
+func (v *pageView) ScrollBy(dx, dy float64) {
+	if v.page == nil {
+		return
+	}
+	x, y := v.page.ClampScroll(v.scrollX+dx, v.scrollY+dy)
+	if x == v.scrollX && y == v.scrollY {
+		return
+	}
+	v.scrollX, v.scrollY = x, y
+	v.redraw()
+}
+
+// ScrollTo moves the viewport to (x, y), clamped to the page.
+func (v *pageView) ScrollTo(x, y float64) {
+	v.ScrollBy(x-v.scrollX, y-v.scrollY)
+}
+
+// revealMatch scrolls the page's active find match into view and redraws
+// its highlight.
+func (v *pageView) revealMatch() {
+	if v.page == nil {
+		return
+	}
+	v.scrollX, v.scrollY = v.page.RevealMatch(v.scrollX, v.scrollY)
+	v.redraw()
+}
+
+// redraw re-composites the current scroll window into the frame.
+func (v *pageView) redraw() {
+	if v.page != nil {
+		v.page.RenderAt(v.frame, v.scrollX, v.scrollY)
+	}
+	v.img.Refresh()
+}
+
+// Scrolled implements fyne.Scrollable for mouse wheel and trackpad input.
+// A scroll container under the pointer scrolls before the page does.
+func (v *pageView) Scrolled(ev *fyne.ScrollEvent) {
+	if v.page != nil {
+		x, y := v.documentPoint(ev.Position)
+		if v.page.ScrollBoxAt(x, y, -float64(ev.Scrolled.DY)) {
+			v.redraw()
+			return
+		}
+	}
+	v.ScrollBy(-float64(ev.Scrolled.DX), -float64(ev.Scrolled.DY))
+}
+
+// MouseIn implements desktop.Hoverable.
+func (v *pageView) MouseIn(ev *desktop.MouseEvent) {
+	v.MouseMoved(ev)
+}
+
+// MouseMoved restyles the page for the element under the pointer and,
+// while a button is held, extends the text selection to it.
+func (v *pageView) MouseMoved(ev *desktop.MouseEvent) {
+	if v.page == nil {
+		return
+	}
+	x, y := v.documentPoint(ev.Position)
+	hovered := v.page.HoverAt(x, y)
+	if v.page.DragTo(x, y) || hovered {
+		v.redraw()
+	}
+}
+
+// MouseOut clears the hover state when the pointer leaves the view.
+func (v *pageView) MouseOut() {
+	if v.page != nil && v.page.HoverAt(-1, -1) {
+		v.redraw()
+	}
+}
+
+// MouseDown makes the element under the pointer :active and focuses it,
+// and starts selecting text.
+func (v *pageView) MouseDown(ev *desktop.MouseEvent) {
+	if v.page == nil {
+		return
+	}
+	x, y := v.documentPoint(ev.Position)
+	if v.page.PressAt(x, y) {
+		v.redraw()
+	}
+}
+
+// MouseUp ends the :active state and clicks the element under the pointer,
+// following it if it is a link.
+func (v *pageView) MouseUp(ev *desktop.MouseEvent) {
+	if v.page == nil {
+		return
+	}
+	x, y := v.documentPoint(ev.Position)
+	if v.page.Release(x, y) {
+		v.redraw()
+	}
+	v.takeNavigation()
+}
+
+// documentPoint converts a position in the view to page coordinates.
+func (v *pageView) documentPoint(pos fyne.Position) (x, y float64) {
+	return float64(pos.X) + v.scrollX, float64(pos.Y) + v.scrollY
+}
+
+// Tapped focuses the view so it receives keyboard scrolling.
+func (v *pageView) Tapped(*fyne.PointEvent) {
+	if c := fyne.CurrentApp().Driver().CanvasForObject(v); c != nil {
+		c.Focus(v)
+	}
+}
+
+// TypedShortcut copies the selected text for the copy shortcut. Other
+// shortcuts go to the window's canvas, as they would without the view
+// focused.
+func (v *pageView) TypedShortcut(s fyne.Shortcut) {
+	if sc, ok := s.(*fyne.ShortcutCopy); ok {
+		if v.page != nil {
+			if text := v.page.SelectedText(); text != "" {
+				sc.Clipboard.SetContent(text)
+			}
+		}
+		return
+	}
+	if c, ok := fyne.CurrentApp().Driver().CanvasForObject(v).(fyne.Shortcutable); ok {
+		c.TypedShortcut(s)
+	}
+}
+
+func (v *pageView) FocusGained() {}
+func (v *pageView) FocusLost()   {}
+func (v *pageView) TypedRune(r rune) {
+	if v.page != nil && v.page.Editing() {
+		if v.page.InsertText(string(r)) {
+			v.redraw()
+		}
+		return
+	}
+	if r == ' ' {
+		v.ScrollBy(0, v.pageStep())
+	}
+}
+
+// TypedKey implements keyboard scrolling, or caret movement and deletion
+// while a text field has focus.
+func (v *pageView) TypedKey(ev *fyne.KeyEvent) {
+	if v.page != nil && v.page.Editing() {
+		if v.editKey(ev.Name) {
+			v.redraw()
+		}
+		return
+	}
+	switch ev.Name {
+	case fyne.KeyDown:
+		v.ScrollBy(0, lineScrollStep)
+	case fyne.KeyUp:
+		v.ScrollBy(0, -lineScrollStep)
+	case fyne.KeyRight:
+		v.ScrollBy(lineScrollStep, 0)
+	case fyne.KeyLeft:
+		v.ScrollBy(-lineScrollStep, 0)
+	case fyne.KeyPageDown:
+		v.ScrollBy(0, v.pageStep())
+	case fyne.KeyPageUp:
+		v.ScrollBy(0, -v.pageStep())
+	case fyne.KeyHome:
+		v.ScrollBy(-v.scrollX, -v.scrollY)
+	case fyne.KeyEnd:
+		if v.page != nil {
+			_, h := v.page.ContentSize()
+			v.ScrollBy(0, float64(h))
+		}
+	}
+}
+
+// editKey applies an editing key to the focused text field. It returns
+// true if the page needs to be redrawn.
+func (v *pageView) editKey(key fyne.KeyName) bool {
+	switch key {
+	case fyne.KeyBackspace:
+		return v.page.DeleteBackward()
+	case fyne.KeyDelete:
+		return v.page.DeleteForward()
+	case fyne.KeyLeft:
+		return v.page.MoveCaret(-1)
+	case fyne.KeyRight:
+		return v.page.MoveCaret(1)
+	case fyne.KeyHome:
+		return v.page.MoveCaret(-math.MaxInt32) // Clamped to the start
+	case fyne.KeyEnd:
+		return v.page.MoveCaret(math.MaxInt32)
+	case fyne.KeyReturn, fyne.KeyEnter:
+		return v.page.InsertText("\n")
+	}
+	return false
+}
+
+// pageStep is the distance scrolled by Page Up/Down: one viewport minus a line
+// of overlap so the reader keeps context.
+func (v *pageView) pageStep() float64 {
+	_, h := v.ViewportSize()
+	return float64(h - lineScrollStep)
+}
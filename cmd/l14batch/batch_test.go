@@ -0,0 +1,117 @@
+package main
+
+import (
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadManifest(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "shots.yaml")
+	writeFile(t, path, `
+width: 1024
+format: svg
+pages:
+  - input: pages/a.html
+    output: out/a.png
+  - input: https://example.com/
+    output: /abs/b
+    height: 300
+    colorScheme: dark
+`)
+	m, err := readManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []entry{
+		{Input: filepath.Join(dir, "pages/a.html"), Output: filepath.Join(dir, "out/a.png"), Width: 1024, Height: 600, Format: "png"},
+		{Input: "https://example.com/", Output: "/abs/b", Width: 1024, Height: 300, Format: "svg", ColorScheme: "dark"},
+	}
+	for i, w := range want {
+		if m.Pages[i] != w {
+			t.Errorf("page %d: expected %+v, got %+v", i+1, w, m.Pages[i])
+		}
+	}
+}
+
+func TestReadManifest_Errors(t *testing.T) {
+	tests := []struct {
+		name, content, want string
+	}{
+		{"m.json", `{"pages": [{"input": "a.html", "output": "a.png", "size": 3}]}`, "unknown field"},
+		{"m.yaml", `pages: []`, "no pages"},
+		{"m.yaml", "pages:\n  - input: a.html\n", "required"},
+		{"m.yaml", "pages:\n  - input: a.html\n    output: a.gif\n    format: gif\n", "unknown format"},
+		{"m.yaml", "pages:\n  - input: a.html\n    output: a-%d.pdf\n", "one file per page"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), tt.name)
+		writeFile(t, path, tt.content)
+		if _, err := readManifest(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.content, tt.want, err)
+		}
+	}
+}
+
+func TestRenderAll(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "style.css"), `body { margin: 0; background: #00f }`)
+	for _, name := range []string{"one", "two", "three"} {
+		writeFile(t, filepath.Join(dir, name+".html"),
+			`<html><head><link rel="stylesheet" href="style.css"></head><body><p>`+name+`</p></body></html>`)
+	}
+	path := filepath.Join(dir, "shots.json")
+	writeFile(t, path, `{"width": 120, "height": 80, "pages": [
+		{"input": "one.html", "output": "out/one.png"},
+		{"input": "two.html", "output": "out/two.svg"},
+		{"input": "three.html", "output": "out/three.pdf"},
+		{"input": "missing.html", "output": "out/missing.png"}
+	]}`)
+	m, err := readManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := renderAll(m.Pages, 3)
+	for i, r := range results[:3] {
+		if r.err != nil || r.entry != m.Pages[i] {
+			t.Errorf("page %d: expected it rendered in order, got %+v", i+1, r)
+		}
+		if info, err := os.Stat(r.entry.Output); err != nil || info.Size() == 0 {
+			t.Errorf("page %d: expected %s written, got %v", i+1, r.entry.Output, err)
+		}
+	}
+	if results[3].err == nil {
+		t.Error("expected an error for the missing input")
+	}
+
+	// The PNG is the viewport's size, with the stylesheet applied
+	f, err := os.Open(filepath.Join(dir, "out/one.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 120 || b.Dy() != 80 {
+		t.Errorf("expected a 120x80 image, got %v", b)
+	}
+	if r, g, b, _ := img.At(110, 70).RGBA(); r != 0 || g != 0 || b != 0xffff {
+		t.Errorf("expected the stylesheet's blue background, got %x %x %x", r, g, b)
+	}
+}
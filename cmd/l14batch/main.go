@@ -0,0 +1,100 @@
+// Command l14batch renders the pages listed in a manifest file, several at
+// a time, for generating screenshots in CI. The pages share the image and
+// font caches, so resources common to them are loaded once.
+//
+// A manifest is JSON (a .json file) or YAML:
+//
+//	width: 1024          # Defaults for the pages below
+//	height: 768
+//	pages:
+//	  - input: pages/home.html
+//	    output: shots/home.png
+//	  - input: https://example.com/
+//	    output: shots/example.pdf
+//	    width: 800
+//
+// Relative paths are relative to the manifest's directory.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"louis14/pkg/determinism"
+)
+
+func main() {
+	workers := flag.Int("workers", 0, "pages rendered at once (default: the manifest's workers, or one per CPU)")
+	deterministic := flag.Bool("deterministic", false, "render identically on any machine: bundled fonts only, and a fixed clock and random seed for scripts")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-workers n] [-deterministic] <manifest.json|manifest.yaml>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *deterministic {
+		determinism.Enable()
+	}
+
+	m, err := readManifest(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading manifest: %v\n", err)
+		os.Exit(1)
+	}
+	n := firstPositive(*workers, m.Workers, runtime.GOMAXPROCS(0))
+
+	start := time.Now()
+	failed := 0
+	for _, r := range renderAll(m.Pages, n) {
+		if r.err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "FAIL %s: %v\n", r.entry.Input, r.err)
+			continue
+		}
+		fmt.Printf("ok   %s -> %s (%s)\n", r.entry.Input, r.entry.Output, r.elapsed.Round(time.Millisecond))
+	}
+	fmt.Printf("Rendered %d of %d pages with %d workers in %s\n", len(m.Pages)-failed, len(m.Pages), n, time.Since(start).Round(time.Millisecond))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// result is the outcome of rendering one entry.
+type result struct {
+	entry   entry
+	err     error
+	elapsed time.Duration
+}
+
+// renderAll renders entries with a pool of workers and returns their
+// results in the entries' order.
+func renderAll(entries []entry, workers int) []result {
+	results := make([]result, len(entries))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(entries)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				start := time.Now()
+				err := renderEntry(context.Background(), entries[i])
+				results[i] = result{entry: entries[i], err: err, elapsed: time.Since(start)}
+			}
+		}()
+	}
+	for i := range entries {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	stdnet "louis14/std/net"
+)
+
+// manifest lists the pages to render. Its viewport size, format, and
+// color scheme are the defaults of entries that leave them out.
+type manifest struct {
+	Workers     int     `json:"workers" yaml:"workers"` // Pages rendered at once; 0 for one per CPU
+	Width       int     `json:"width" yaml:"width"`
+	Height      int     `json:"height" yaml:"height"`
+	Format      string  `json:"format" yaml:"format"`
+	ColorScheme string  `json:"colorScheme" yaml:"colorScheme"`
+	Pages       []entry `json:"pages" yaml:"pages"`
+}
+
+// entry is a page to render: an HTML file or URL and the file to write.
+type entry struct {
+	Input       string  `json:"input" yaml:"input"`   // File path or http(s) URL
+	Output      string  `json:"output" yaml:"output"` // A PNG path containing %d writes one file per page
+	Width       int     `json:"width" yaml:"width"`
+	Height      int     `json:"height" yaml:"height"`
+	Format      string  `json:"format" yaml:"format"` // png, svg, or pdf; by default from the output's extension
+	Offset      float64 `json:"offset" yaml:"offset"` // Window of the page starting this many pixels down
+	ColorScheme string  `json:"colorScheme" yaml:"colorScheme"`
+}
+
+// Viewport size of entries when neither they nor the manifest give one.
+const (
+	defaultWidth  = 800
+	defaultHeight = 600
+)
+
+// readManifest reads a manifest file, JSON if its name ends in .json and
+// YAML otherwise, and fills in each entry's defaults. Relative input and
+// output paths are made relative to the manifest's directory.
+func readManifest(path string) (*manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &manifest{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(m)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(m)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(m.Pages) == 0 {
+		return nil, fmt.Errorf("%s: no pages", path)
+	}
+	dir := filepath.Dir(path)
+	for i := range m.Pages {
+		if err := m.resolve(&m.Pages[i], dir); err != nil {
+			return nil, fmt.Errorf("%s: page %d: %w", path, i+1, err)
+		}
+	}
+	return m, nil
+}
+
+// resolve fills in an entry's defaults and makes its paths relative to
+// dir, checking that it can be rendered.
+func (m *manifest) resolve(e *entry, dir string) error {
+	if e.Input == "" || e.Output == "" {
+		return fmt.Errorf("input and output are required")
+	}
+	if !stdnet.IsNetworkURL(e.Input) && !filepath.IsAbs(e.Input) {
+		e.Input = filepath.Join(dir, e.Input)
+	}
+	if !filepath.IsAbs(e.Output) {
+		e.Output = filepath.Join(dir, e.Output)
+	}
+	e.Width = firstPositive(e.Width, m.Width, defaultWidth)
+	e.Height = firstPositive(e.Height, m.Height, defaultHeight)
+	if e.ColorScheme == "" {
+		e.ColorScheme = m.ColorScheme
+	}
+	if e.Format == "" {
+		switch ext := strings.ToLower(filepath.Ext(e.Output)); ext {
+		case ".png", ".svg", ".pdf":
+			e.Format = ext[1:]
+		default:
+			e.Format = m.Format
+		}
+	}
+	switch e.Format {
+	case "png":
+	case "":
+		e.Format = "png"
+	case "svg", "pdf":
+		if strings.Contains(e.Output, "%d") {
+			return fmt.Errorf("%s output cannot be split into one file per page", e.Format)
+		}
+	default:
+		return fmt.Errorf("unknown format %q", e.Format)
+	}
+	return nil
+}
+
+// firstPositive returns the first of values that is positive.
+func firstPositive(values ...int) int {
+	for _, v := range values {
+		if v > 0 {
+			return v
+		}
+	}
+	return 0
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"louis14/pkg/html"
+	"louis14/pkg/js"
+	"louis14/pkg/layout"
+	"louis14/pkg/render"
+	"louis14/pkg/resource"
+	"louis14/pkg/text"
+	stdnet "louis14/std/net"
+)
+
+// scriptIdleDeadline is how far ahead timers set by scripts are run before
+// the page is captured; later timers never fire.
+const scriptIdleDeadline = 5 * time.Second
+
+// fetchFunc fetches a resource of a page by URI.
+type fetchFunc func(ctx context.Context, uri string) (body []byte, contentType string, err error)
+
+// pageFetcher returns the fetcher for an input page's resources, and the
+// base URL they resolve against: the URL of a network page, or the
+// absolute path of a file.
+func pageFetcher(input string) (fetchFunc, string) {
+	if stdnet.IsNetworkURL(input) {
+		return resource.NewFetcher(input).Fetch, input
+	}
+	base, err := filepath.Abs(input)
+	if err != nil {
+		base = input
+	}
+	dir := filepath.Dir(base)
+	return func(ctx context.Context, uri string) ([]byte, string, error) {
+		switch {
+		case stdnet.IsDataURL(uri):
+			return stdnet.DecodeDataURL(uri)
+		case stdnet.IsNetworkURL(uri):
+			return stdnet.FetchContext(ctx, uri)
+		}
+		path := strings.TrimPrefix(uri, "file://")
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		data, err := os.ReadFile(path)
+		return data, mime.TypeByExtension(filepath.Ext(path)), err
+	}, base
+}
+
+// renderEntry loads, scripts, lays out, and renders one manifest entry to
+// its output file, fetching its resources with ctx.
+func renderEntry(ctx context.Context, e entry) error {
+	fetch, base := pageFetcher(e.Input)
+	source, _, err := fetch(ctx, base)
+	if err != nil {
+		return fmt.Errorf("loading %s: %w", e.Input, err)
+	}
+
+	content := string(source) // Network pages arrive decoded to UTF-8
+	if !stdnet.IsNetworkURL(e.Input) {
+		content = html.Decode(source)
+	}
+	doc, err := html.ParseWithOptions(content, html.ParseOptions{
+		CSSFetcher: func(uri string) (string, error) {
+			body, _, err := fetch(ctx, uri)
+			return string(body), err
+		},
+		Scripting: true,
+	})
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", e.Input, err)
+	}
+	imageFetcher := func(ctx context.Context, uri string) ([]byte, error) {
+		body, _, err := fetch(ctx, uri)
+		return body, err
+	}
+
+	width, height := float64(e.Width), float64(e.Height)
+	engine := layout.NewLayoutEngine(width, height)
+	engine.SetImageFetcher(imageFetcher)
+	engine.SetBaseURL(base)
+	engine.SetFontFetcher(text.FontFetcher(imageFetcher))
+	if e.ColorScheme != "" {
+		engine.SetColorScheme(e.ColorScheme)
+	}
+	engine.SetIncremental(len(doc.Scripts) > 0)
+	engine.SetScrollY(e.Offset)
+	defer engine.ReleaseCanvases()
+	boxes, err := engine.Layout(ctx, doc)
+	if err != nil {
+		return err
+	}
+
+	if len(doc.Scripts) > 0 {
+		script := js.New()
+		script.SetBaseURL(base)
+		script.SetContext(ctx)
+		script.SetFetcher(js.FetcherFunc(fetch))
+		if err := script.Execute(doc); err != nil {
+			log.Printf("%s: js: %v", e.Input, err)
+		}
+		if _, err := engine.Layout(ctx, doc); err != nil {
+			return err
+		}
+		if err := script.DispatchLoad(); err != nil {
+			log.Printf("%s: js: %v", e.Input, err)
+		}
+		if err := script.RunUntilIdle(scriptIdleDeadline); err != nil {
+			log.Printf("%s: js: %v", e.Input, err)
+		}
+		if boxes, err = engine.Layout(ctx, doc); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(e.Output), 0755); err != nil {
+		return err
+	}
+	switch e.Format {
+	case "pdf":
+		pages, err := engine.LayoutPaged(ctx, doc, width, height)
+		if err != nil {
+			return err
+		}
+		pdf := render.NewPDFBackend(e.Width, e.Height)
+		renderer := render.NewRendererForBackend(pdf)
+		renderer.SetImageFetcher(imageFetcher)
+		renderer.SetBaseURL(base)
+		for i, page := range pages {
+			if i > 0 {
+				pdf.NewPage()
+			}
+			if err := renderer.Render(ctx, page); err != nil {
+				return err
+			}
+		}
+		return pdf.Save(e.Output)
+	case "svg":
+		svg := render.NewSVGBackend(e.Width, e.Height)
+		renderer := render.NewRendererForBackend(svg)
+		renderer.SetImageFetcher(imageFetcher)
+		renderer.SetBaseURL(base)
+		renderer.SetViewportOffset(e.Offset)
+		if err := renderer.Render(ctx, boxes); err != nil {
+			return err
+		}
+		return svg.Save(e.Output)
+	}
+	renderer := render.NewRenderer(e.Width, e.Height)
+	renderer.SetImageFetcher(imageFetcher)
+	renderer.SetBaseURL(base)
+	if strings.Contains(e.Output, "%d") {
+		pages, err := engine.LayoutPaged(ctx, doc, width, height)
+		if err != nil {
+			return err
+		}
+		_, err = renderer.SavePagesPNG(ctx, pages, e.Output)
+		return err
+	}
+	renderer.SetViewportOffset(e.Offset)
+	if err := renderer.Render(ctx, boxes); err != nil {
+		return err
+	}
+	return renderer.SavePNG(e.Output)
+}
@@ -0,0 +1,69 @@
+// Command l14d serves louis14 as a rendering service. POST /render takes a
+// JSON body giving a page, as html or a url, and the viewport width,
+// height, and format (png, svg, or pdf), and responds with the rendered
+// page:
+//
+//	curl -d '{"url": "https://example.com/", "width": 1024}' localhost:8014/render > shot.png
+//
+// GET /healthz reports that the server is up.
+//
+// Pages are untrusted: they load only over HTTP, HTTPS, and data: URLs,
+// and not from loopback, private, or link-local addresses unless
+// -allow-private-networks is given. Flags restrict them further to a list
+// of hosts, limit the bytes they load and the time they take, and turn off
+// scripts.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	"louis14/pkg/resource"
+)
+
+func main() {
+	addr := flag.String("addr", ":8014", "address to listen on")
+	workers := flag.Int("workers", runtime.GOMAXPROCS(0), "pages rendered at once; other requests wait")
+	hosts := flag.String("allow-hosts", "", "comma-separated hosts pages and their resources may load from, *.example.com for subdomains (default any)")
+	maxResource := flag.Int64("max-resource-bytes", 16<<20, "most bytes of a page or one of its resources (0 = no limit)")
+	maxTotal := flag.Int64("max-page-bytes", 64<<20, "most bytes of a page and all its resources (0 = no limit)")
+	noJS := flag.Bool("no-js", false, "do not run scripts")
+	allowPrivate := flag.Bool("allow-private-networks", false, "let pages load from loopback, private, and link-local addresses")
+	timeout := flag.Duration("render-timeout", 30*time.Second, "longest a request may wait for, load, and render its page (0 = no limit)")
+	flag.Parse()
+	if *workers < 1 {
+		log.Fatal("-workers must be at least 1")
+	}
+	if *timeout < 0 {
+		log.Fatal("-render-timeout must not be negative")
+	}
+	policy := resource.Policy{
+		MaxResourceSize: *maxResource,
+		MaxTotalBytes:   *maxTotal,
+		DisableScripts:  *noJS,
+
+		AllowPrivateNetworks: *allowPrivate,
+	}
+	if *hosts != "" {
+		for _, h := range strings.Split(*hosts, ",") {
+			policy.Hosts = append(policy.Hosts, strings.TrimSpace(h))
+		}
+	}
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           newServer(*workers, *timeout, policy),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Minute,
+	}
+	if *timeout > 0 {
+		// Time to read the request and write the response, around the render
+		srv.WriteTimeout = *timeout + time.Minute
+	}
+	log.Printf("l14d listening on %s, rendering %d pages at once", *addr, *workers)
+	log.Fatal(srv.ListenAndServe())
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"louis14/pkg/js"
+	"louis14/pkg/layout"
+	"louis14/pkg/resource"
+	stdnet "louis14/std/net"
+)
+
+// Limits on render requests, so one request cannot exhaust the server.
+const (
+	maxRequestBytes = 8 << 20 // Size of a request body
+	maxViewportSize = 8192    // Width and height in pixels
+)
+
+// renderRequest is the JSON body of POST /render. Exactly one of HTML and
+// URL gives the page; with HTML, URL may also be given as the base URL its
+// resources resolve against.
+type renderRequest struct {
+	HTML        string  `json:"html"`
+	URL         string  `json:"url"`
+	Width       int     `json:"width"`  // Default 800
+	Height      int     `json:"height"` // Default 600
+	Format      string  `json:"format"` // png (default), svg, or pdf
+	Offset      float64 `json:"offset"` // Window of the page starting this many pixels down
+	ColorScheme string  `json:"colorScheme"`
+}
+
+// contentTypes maps output formats to the Content-Type they are served as.
+var contentTypes = map[string]string{
+	resource.FormatPNG: "image/png",
+	resource.FormatSVG: "image/svg+xml",
+	resource.FormatPDF: "application/pdf",
+}
+
+// server renders pages for HTTP clients, at most a fixed number at once.
+// Images, fonts, and HTTP responses stay in the process-wide caches
+// between requests, so pages sharing resources render faster as the
+// server warms up. Each page, and what it loads, keeps to the server's
+// policy; pages are only loaded over HTTP, HTTPS, and data: URLs.
+type server struct {
+	slots   chan struct{} // Holds a token for each render in progress
+	mux     *http.ServeMux
+	policy  resource.Policy
+	timeout time.Duration // Longest a request may wait for a slot and render; 0 = no limit
+}
+
+func newServer(workers int, timeout time.Duration, policy resource.Policy) *server {
+	policy.Schemes = []string{"http", "https", "data"}
+	s := &server{slots: make(chan struct{}, workers), mux: http.NewServeMux(), policy: policy, timeout: timeout}
+	s.mux.HandleFunc("/render", s.handleRender)
+	s.mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	return s
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// handleRender serves POST /render: it renders the requested page and
+// responds with the image or PDF, and the height of the whole document
+// in the X-Document-Height header. A request that runs out of time,
+// waiting included, is answered with 504 Gateway Timeout. The deadline
+// holds inside layout and paint too, so a page that is slow to lay out or
+// draw gives up its slot when it is answered.
+func (s *server) handleRender(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req renderRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	// Wait for a free slot, unless the client gives up first
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	case <-ctx.Done():
+		http.Error(w, "canceled while waiting to render", timeoutStatus(ctx, http.StatusServiceUnavailable))
+		return
+	}
+
+	renderer := resource.NewLouis14Renderer(resource.NewFetcher(req.URL))
+	engine := js.New()
+	engine.SetBaseURL(req.URL)
+	renderer.SetJSEngine(engine)
+	renderer.SetPolicy(s.policy)
+	content := req.HTML
+	if content == "" {
+		body, _, err := renderer.Fetcher().Fetch(ctx, req.URL)
+		if err != nil {
+			status := timeoutStatus(ctx, http.StatusBadGateway)
+			if errors.Is(err, resource.ErrBlocked) {
+				status = http.StatusForbidden
+			}
+			http.Error(w, "fetching page: "+err.Error(), status)
+			return
+		}
+		content = string(body)
+	}
+	renderer.SetColorScheme(req.ColorScheme)
+	renderer.SetViewportOffset(req.Offset)
+
+	// Render into a buffer, so a failure can still be reported as an error
+	var out bytes.Buffer
+	if err := renderer.RenderTo(ctx, &out, content, req.Width, req.Height, req.Format); err != nil {
+		status := timeoutStatus(ctx, http.StatusInternalServerError)
+		if errors.Is(err, layout.ErrTooManyPages) {
+			status = http.StatusUnprocessableEntity
+		}
+		http.Error(w, "rendering: "+err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypes[req.Format])
+	w.Header().Set("Content-Length", strconv.Itoa(out.Len()))
+	w.Header().Set("X-Document-Height", strconv.FormatFloat(renderer.DocumentHeight(), 'f', 0, 64))
+	out.WriteTo(w)
+}
+
+// timeoutStatus returns the status of a response to a request that
+// failed: 504 Gateway Timeout if it ran out of time, else status.
+func timeoutStatus(ctx context.Context, status int) int {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	return status
+}
+
+// validate checks a request and fills in its defaults.
+func (req *renderRequest) validate() error {
+	switch {
+	case req.HTML == "" && req.URL == "":
+		return fmt.Errorf("html or url is required")
+	case req.URL != "" && !stdnet.IsNetworkURL(req.URL):
+		return fmt.Errorf("url must be http or https")
+	}
+	if req.Width == 0 {
+		req.Width = 800
+	}
+	if req.Height == 0 {
+		req.Height = 600
+	}
+	if req.Width < 1 || req.Height < 1 || req.Width > maxViewportSize || req.Height > maxViewportSize {
+		return fmt.Errorf("width and height must be between 1 and %d", maxViewportSize)
+	}
+	if req.Format == "" {
+		req.Format = resource.FormatPNG
+	}
+	if _, ok := contentTypes[req.Format]; !ok {
+		return fmt.Errorf("unknown format %q", req.Format)
+	}
+	return nil
+}
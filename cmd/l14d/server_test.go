@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"louis14/pkg/resource"
+)
+
+func post(t *testing.T, h http.Handler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/render", strings.NewReader(body)))
+	return rec
+}
+
+func TestRender_PNG(t *testing.T) {
+	s := newServer(2, 0, resource.Policy{})
+	rec := post(t, s, `{"html": "<html><body style=\"margin: 0; background: #0f0\"><div style=\"height: 500px\"></div></body></html>", "width": 120, "height": 80}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("expected image/png, got %q", ct)
+	}
+	if h := rec.Header().Get("X-Document-Height"); h != "500" {
+		t.Errorf("expected a document height of 500, got %q", h)
+	}
+	img, err := png.Decode(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 120 || b.Dy() != 80 {
+		t.Errorf("expected a 120x80 image, got %v", b)
+	}
+	if r, g, b, _ := img.At(60, 40).RGBA(); r != 0 || g != 0xffff || b != 0 {
+		t.Errorf("expected the green background, got %x %x %x", r, g, b)
+	}
+}
+
+func TestRender_Formats(t *testing.T) {
+	s := newServer(1, 0, resource.Policy{})
+	tests := []struct {
+		format, contentType, prefix string
+	}{
+		{"svg", "image/svg+xml", "<svg"},
+		{"pdf", "application/pdf", "%PDF"},
+	}
+	for _, tt := range tests {
+		rec := post(t, s, `{"html": "<p>Hello</p>", "format": "`+tt.format+`"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", tt.format, rec.Code, rec.Body)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != tt.contentType {
+			t.Errorf("%s: expected %s, got %q", tt.format, tt.contentType, ct)
+		}
+		if !bytes.Contains(rec.Body.Bytes()[:min(rec.Body.Len(), 200)], []byte(tt.prefix)) {
+			t.Errorf("%s: expected the body to start with %q", tt.format, tt.prefix)
+		}
+	}
+}
+
+func TestRender_BadRequests(t *testing.T) {
+	s := newServer(1, 0, resource.Policy{})
+	tests := []struct {
+		body, want string
+	}{
+		{`{}`, "html or url is required"},
+		{`{"url": "file:///etc/passwd"}`, "http or https"},
+		{`{"html": "<p>x</p>", "width": 100000}`, "width and height"},
+		{`{"html": "<p>x</p>", "format": "gif"}`, "unknown format"},
+		{`{"html": "<p>x</p>", "scale": 2}`, "unknown field"},
+		{`not json`, "bad request"},
+	}
+	for _, tt := range tests {
+		rec := post(t, s, tt.body)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tt.want) {
+			t.Errorf("%s: expected 400 containing %q, got %d: %s", tt.body, tt.want, rec.Code, rec.Body)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/render", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /render: expected 405, got %d", rec.Code)
+	}
+}
+
+func TestRender_WaitsForSlot(t *testing.T) {
+	s := newServer(1, 0, resource.Policy{})
+	s.slots <- struct{}{} // Occupy the only slot
+
+	req := httptest.NewRequest(http.MethodPost, "/render", strings.NewReader(`{"html": "<p>x</p>"}`))
+	ctx, cancel := context.WithCancel(req.Context())
+	cancel()
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req.WithContext(ctx))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 when the client gives up waiting, got %d", rec.Code)
+	}
+}
+
+func TestRender_Timeout(t *testing.T) {
+	s := newServer(1, 50*time.Millisecond, resource.Policy{})
+	s.slots <- struct{}{} // Occupy the only slot
+	if rec := post(t, s, `{"html": "<p>x</p>"}`); rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected 504 when no slot frees up in time, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// A page that never finishes loading
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer origin.Close()
+	s = newServer(1, 50*time.Millisecond, resource.Policy{AllowPrivateNetworks: true})
+	if rec := post(t, s, `{"url": "`+origin.URL+`/"}`); rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected 504 for a page that loads too slowly, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// A script that never finishes running
+	start := time.Now()
+	if rec := post(t, s, `{"html": "<script>for (;;) {}</script>"}`); rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected 504 for a page that renders too slowly, got %d: %s", rec.Code, rec.Body)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("render stopped %v after it started, long after its deadline", elapsed)
+	}
+}
+
+func TestRender_SlowLayoutTimesOut(t *testing.T) {
+	// Nested flex containers measure their items again at each level, so
+	// laying this out takes many seconds
+	page := strings.Repeat(`<div style=\"display:flex\">a b `, 18) + strings.Repeat(`</div>`, 18)
+	s := newServer(1, 100*time.Millisecond, resource.Policy{})
+	start := time.Now()
+	if rec := post(t, s, `{"html": "`+page+`"}`); rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected 504 for a page that lays out too slowly, got %d: %s", rec.Code, rec.Body)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("layout stopped %v after it started, long after its deadline", elapsed)
+	}
+
+	// The slot is free for the next request
+	if n := len(s.slots); n != 0 {
+		t.Errorf("expected the slot released, %d held", n)
+	}
+	if rec := post(t, s, `{"html": "<p>x</p>"}`); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 for the next request, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestRender_Policy(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<p>` + strings.Repeat("x", 100) + `</p>`))
+	}))
+	defer origin.Close()
+	page := `{"url": "` + origin.URL + `/"}`
+
+	s := newServer(1, 0, resource.Policy{Hosts: []string{"*.example.com"}})
+	if rec := post(t, s, page); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a host not allowed, got %d: %s", rec.Code, rec.Body)
+	}
+	s = newServer(1, 0, resource.Policy{})
+	if rec := post(t, s, page); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a loopback address, got %d: %s", rec.Code, rec.Body)
+	}
+	s = newServer(1, 0, resource.Policy{MaxResourceSize: 50, AllowPrivateNetworks: true})
+	if rec := post(t, s, page); rec.Code != http.StatusBadGateway || !strings.Contains(rec.Body.String(), "too large") {
+		t.Errorf("expected 502 for a page over the size limit, got %d: %s", rec.Code, rec.Body)
+	}
+	s = newServer(1, 0, resource.Policy{Hosts: []string{"127.0.0.1"}, MaxResourceSize: 200, AllowPrivateNetworks: true})
+	if rec := post(t, s, page); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 for an allowed page, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// Scripts are not run
+	script := `{"html": "<body style=\"margin: 0\"><script>document.body.style.background = 'red'</script>", "width": 10, "height": 10}`
+	for _, disable := range []bool{false, true} {
+		rec := post(t, newServer(1, 0, resource.Policy{DisableScripts: disable}), script)
+		img, err := png.Decode(rec.Body)
+		if err != nil {
+			t.Fatalf("%d: %s", rec.Code, rec.Body)
+		}
+		if r, g, _, _ := img.At(5, 5).RGBA(); (r == 0xffff && g == 0) == disable {
+			t.Errorf("scripts disabled %v: got red %x green %x", disable, r, g)
+		}
+	}
+}
+
+func TestRender_PDFPageLimits(t *testing.T) {
+	s := newServer(1, 0, resource.Policy{})
+	rec := post(t, s, `{"html": "<div style=\"height: 3000000px\"></div>", "format": "pdf"}`)
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "too many pages") {
+		t.Errorf("expected 422 for a document of too many pages, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// Pages that take longer to render than the deadline allows
+	page := `<div style=\"height: 500px; box-shadow: 0 0 60px #000; break-after: page\"></div>`
+	s = newServer(1, 200*time.Millisecond, resource.Policy{})
+	start := time.Now()
+	rec = post(t, s, `{"html": "`+strings.Repeat(page, 900)+`", "format": "pdf"}`)
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected 504 for pages that render too slowly, got %d", rec.Code)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("render stopped %v after it started, long after its deadline", elapsed)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestRenderPage(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "style.css"), []byte(`body { margin: 0; background: #f00 }`), 0644)
+	path := filepath.Join(dir, "index.html")
+	os.WriteFile(path, []byte(`<html><head><link rel="stylesheet" href="style.css"></head><body><p>Hi</p></body></html>`), 0644)
+
+	data, err := renderPage(path, 100, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+		t.Errorf("expected a 100x50 image, got %v", b)
+	}
+	if r, g, b, _ := img.At(90, 40).RGBA(); r != 0xffff || g != 0 || b != 0 {
+		t.Errorf("expected the stylesheet's red background, got %x %x %x", r, g, b)
+	}
+
+	if _, err := renderPage(filepath.Join(dir, "missing.html"), 100, 50); err == nil {
+		t.Error("expected an error for a missing page")
+	}
+}
+
+func TestPreview_SendsFrames(t *testing.T) {
+	p := newPreview()
+	p.publish(frame{png: []byte("first")})
+	srv := httptest.NewServer(p.handler())
+	defer srv.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", "", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	// A new connection starts with the latest frame, then gets each new one
+	var msg []byte
+	if err := websocket.Message.Receive(ws, &msg); err != nil || string(msg) != "first" {
+		t.Fatalf("expected the latest frame, got %q, %v", msg, err)
+	}
+	p.publish(frame{png: []byte("second")})
+	if err := websocket.Message.Receive(ws, &msg); err != nil || string(msg) != "second" {
+		t.Fatalf("expected the new frame, got %q, %v", msg, err)
+	}
+	p.publish(frame{err: "parse error"})
+	var text string
+	if err := websocket.Message.Receive(ws, &text); err != nil || text != "parse error" {
+		t.Fatalf("expected the render error as text, got %q, %v", text, err)
+	}
+}
@@ -0,0 +1,123 @@
+// Command l14dev previews a page as louis14 renders it while you edit it.
+// It watches a directory of HTML, CSS, images, and fonts, renders the page
+// again whenever a file changes, and serves a preview page that swaps in
+// each new render over a WebSocket:
+//
+//	l14dev -page index.html ./site
+//
+// then open http://localhost:8015/.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"louis14/pkg/images"
+)
+
+// settleDelay is how long the directory must be quiet after a change
+// before the page renders again, so that saving several files, or an
+// editor writing one in steps, renders once.
+const settleDelay = 100 * time.Millisecond
+
+func main() {
+	addr := flag.String("addr", "localhost:8015", "address to serve the preview on")
+	page := flag.String("page", "index.html", "page to render, relative to the directory")
+	width := flag.Int("width", 1024, "viewport width")
+	height := flag.Int("height", 768, "viewport height")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <dir>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	dir := flag.Arg(0)
+	path := filepath.Join(dir, *page)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer watcher.Close()
+	if err := watchTree(watcher, dir); err != nil {
+		log.Fatal(err)
+	}
+
+	p := newPreview()
+	rebuild := func() {
+		images.ClearCache() // Edited images must load again
+		start := time.Now()
+		png, err := renderPage(path, *width, *height)
+		if err != nil {
+			log.Printf("render %s: %v", path, err)
+			p.publish(frame{err: err.Error()})
+			return
+		}
+		log.Printf("rendered %s in %s", path, time.Since(start).Round(time.Millisecond))
+		p.publish(frame{png: png})
+	}
+	rebuild()
+
+	go func() {
+		log.Printf("previewing %s at http://%s/", path, *addr)
+		log.Fatal(http.ListenAndServe(*addr, p.handler()))
+	}()
+
+	var settled <-chan time.Time
+	for {
+		select {
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if ev.Op == fsnotify.Chmod {
+				continue
+			}
+			if ev.Has(fsnotify.Create) {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					if err := watchTree(watcher, ev.Name); err != nil {
+						log.Print(err)
+					}
+				}
+			}
+			settled = time.After(settleDelay)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("watch: %v", err)
+		case <-settled:
+			settled = nil
+			rebuild()
+		}
+	}
+}
+
+// watchTree watches dir and the directories below it, except hidden ones
+// such as .git.
+func watchTree(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+
+	"golang.org/x/net/websocket"
+)
+
+// frame is the result of one render: the PNG, or why rendering failed.
+type frame struct {
+	png []byte
+	err string
+}
+
+// preview serves the latest render of the page to browsers. Each open
+// preview page holds a WebSocket, over which it is sent every new PNG as a
+// binary message, or the error of a failed render as a text message.
+type preview struct {
+	mu      sync.Mutex
+	latest  frame
+	clients map[chan frame]bool
+}
+
+func newPreview() *preview {
+	return &preview{clients: make(map[chan frame]bool)}
+}
+
+// publish makes f the latest frame and sends it to every connected
+// preview. A preview still sending an older frame skips it for f.
+func (p *preview) publish(f frame) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.latest = f
+	for c := range p.clients {
+		select {
+		case <-c:
+		default:
+		}
+		c <- f
+	}
+}
+
+// subscribe registers a connection for new frames, starting with the
+// latest one if there has been a render.
+func (p *preview) subscribe() chan frame {
+	c := make(chan frame, 1)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.latest.png != nil || p.latest.err != "" {
+		c <- p.latest
+	}
+	p.clients[c] = true
+	return c
+}
+
+func (p *preview) unsubscribe(c chan frame) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.clients, c)
+}
+
+func (p *preview) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(previewPage))
+	})
+	mux.HandleFunc("/shot.png", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		f := p.latest
+		p.mu.Unlock()
+		if f.png == nil {
+			http.Error(w, "no render yet: "+f.err, http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(f.png)
+	})
+	mux.Handle("/ws", websocket.Handler(p.serveSocket))
+	return mux
+}
+
+// serveSocket sends frames to one preview page until it disconnects.
+func (p *preview) serveSocket(ws *websocket.Conn) {
+	c := p.subscribe()
+	defer p.unsubscribe(c)
+
+	// The page sends nothing; reading only notices when it goes away
+	closed := make(chan struct{})
+	go func() {
+		var msg []byte
+		for websocket.Message.Receive(ws, &msg) == nil {
+		}
+		close(closed)
+	}()
+
+	for {
+		var err error
+		select {
+		case f := <-c:
+			if f.err != "" {
+				err = websocket.Message.Send(ws, f.err)
+			} else {
+				err = websocket.Message.Send(ws, f.png)
+			}
+		case <-closed:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// previewPage shows the latest render, swapping in each new one as it
+// arrives, and reconnects if the server restarts.
+const previewPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>l14dev</title>
+<style>
+body { margin: 0; background: #888; }
+#shot { display: block; margin: 0 auto; background: #fff; }
+#status { position: fixed; left: 0; right: 0; bottom: 0; margin: 0; padding: 8px 12px;
+  background: #b00020; color: #fff; font: 13px monospace; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<img id="shot" src="/shot.png" alt="">
+<pre id="status" hidden></pre>
+<script>
+const shot = document.getElementById("shot");
+const status = document.getElementById("status");
+let current = null;
+
+function show(message) {
+  status.textContent = message;
+  status.hidden = false;
+}
+
+function connect() {
+  const ws = new WebSocket((location.protocol === "https:" ? "wss://" : "ws://") + location.host + "/ws");
+  ws.binaryType = "blob";
+  ws.onmessage = (e) => {
+    if (typeof e.data === "string") {
+      show(e.data);
+      return;
+    }
+    const url = URL.createObjectURL(e.data);
+    shot.src = url;
+    if (current) URL.revokeObjectURL(current);
+    current = url;
+    status.hidden = true;
+  };
+  ws.onclose = () => {
+    show("Disconnected from l14dev; reconnecting...");
+    setTimeout(connect, 1000);
+  };
+}
+connect();
+</script>
+</body>
+</html>
+`
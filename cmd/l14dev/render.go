@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"louis14/pkg/html"
+	"louis14/pkg/js"
+	"louis14/pkg/resource"
+	stdnet "louis14/std/net"
+)
+
+// dirFetcher fetches a page's resources from the directory being
+// previewed; relative URIs resolve against the directory.
+type dirFetcher struct {
+	dir string
+}
+
+func (f dirFetcher) Fetch(ctx context.Context, uri string) ([]byte, string, error) {
+	switch {
+	case stdnet.IsDataURL(uri):
+		return stdnet.DecodeDataURL(uri)
+	case stdnet.IsNetworkURL(uri):
+		return stdnet.FetchContext(ctx, uri)
+	}
+	path := strings.TrimPrefix(uri, "file://")
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(f.dir, path)
+	}
+	data, err := os.ReadFile(path)
+	return data, mime.TypeByExtension(filepath.Ext(path)), err
+}
+
+// renderPage renders the page at path, with scripts run, to a PNG of the
+// given viewport size.
+func renderPage(path string, width, height int) ([]byte, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	renderer := resource.NewLouis14Renderer(dirFetcher{dir: filepath.Dir(path)})
+	renderer.SetJSEngine(js.New())
+	var out bytes.Buffer
+	if err := renderer.RenderTo(context.Background(), &out, html.Decode(source), width, height, resource.FormatPNG); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -1,13 +1,29 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"louis14/pkg/html"
+	"louis14/pkg/js"
 	"louis14/pkg/layout"
 	"louis14/pkg/render"
+	"louis14/pkg/resource"
+	stdnet "louis14/std/net"
 )
 
 func TestIntegration_SimpleHTMLToBoxes(t *testing.T) {
@@ -26,7 +42,7 @@ func TestIntegration_SimpleHTMLToBoxes(t *testing.T) {
 
 	// Layout
 	engine := layout.NewLayoutEngine(800, 600)
-	boxes := engine.Layout(doc)
+	boxes, _ := engine.Layout(context.Background(), doc)
 
 	// Verify layout
 	if len(boxes) != 1 {
@@ -63,7 +79,7 @@ func TestIntegration_MultipleElements(t *testing.T) {
 
 	// Layout
 	engine := layout.NewLayoutEngine(800, 600)
-	boxes := engine.Layout(doc)
+	boxes, _ := engine.Layout(context.Background(), doc)
 
 	// Verify
 	if len(boxes) != 2 {
@@ -101,11 +117,11 @@ func TestIntegration_EndToEndRender(t *testing.T) {
 
 	// Layout
 	engine := layout.NewLayoutEngine(800, 600)
-	boxes := engine.Layout(doc)
+	boxes, _ := engine.Layout(context.Background(), doc)
 
 	// Render
 	renderer := render.NewRenderer(800, 600)
-	renderer.Render(boxes)
+	renderer.Render(context.Background(), boxes)
 
 	// Save to temp file
 	tmpDir := t.TempDir()
@@ -142,6 +158,34 @@ func TestIntegration_EndToEndRender(t *testing.T) {
 	}
 }
 
+func TestIntegration_OversizedCanvas(t *testing.T) {
+	doc, err := html.Parse(`<div style="width: 10px; height: 10px; background-color: red"></div><canvas width="2000000000" height="2000000000"></canvas>`)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	engine := layout.NewLayoutEngine(800, 600)
+	defer engine.ReleaseCanvases()
+	boxes, _ := engine.Layout(context.Background(), doc)
+	renderer := render.NewRenderer(800, 600)
+	renderer.Render(context.Background(), boxes)
+	path := filepath.Join(t.TempDir(), "canvas.png")
+	if err := renderer.SavePNG(path); err != nil {
+		t.Fatalf("save error: %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, g, b, _ := img.At(5, 5).RGBA(); r>>8 != 255 || g != 0 || b != 0 {
+		t.Errorf("expected the page around the canvas rendered, got %v", img.At(5, 5))
+	}
+}
+
 func TestIntegration_AllNamedColors(t *testing.T) {
 	colors := []string{
 		"red", "green", "blue", "yellow", "cyan", "magenta",
@@ -158,7 +202,7 @@ func TestIntegration_AllNamedColors(t *testing.T) {
 			}
 
 			engine := layout.NewLayoutEngine(800, 600)
-			boxes := engine.Layout(doc)
+			boxes, _ := engine.Layout(context.Background(), doc)
 
 			if len(boxes) != 1 {
 				t.Fatalf("expected 1 box, got %d", len(boxes))
@@ -184,7 +228,7 @@ func TestIntegration_EmptyHTML(t *testing.T) {
 	}
 
 	engine := layout.NewLayoutEngine(800, 600)
-	boxes := engine.Layout(doc)
+	boxes, _ := engine.Layout(context.Background(), doc)
 
 	if len(boxes) != 0 {
 		t.Errorf("expected 0 boxes for empty HTML, got %d", len(boxes))
@@ -192,7 +236,7 @@ func TestIntegration_EmptyHTML(t *testing.T) {
 
 	// Should still be able to render without crashing
 	renderer := render.NewRenderer(800, 600)
-	renderer.Render(boxes)
+	renderer.Render(context.Background(), boxes)
 
 	tmpDir := t.TempDir()
 	tmpFile := filepath.Join(tmpDir, "empty.png")
@@ -220,7 +264,7 @@ func TestIntegration_DefaultDimensions(t *testing.T) {
 	}
 
 	engine := layout.NewLayoutEngine(1024, 768)
-	boxes := engine.Layout(doc)
+	boxes, _ := engine.Layout(context.Background(), doc)
 
 	if len(boxes) != 1 {
 		t.Fatalf("expected 1 box, got %d", len(boxes))
@@ -248,7 +292,7 @@ func TestIntegration_ManyBoxes(t *testing.T) {
 	}
 
 	engine := layout.NewLayoutEngine(800, 600)
-	boxes := engine.Layout(doc)
+	boxes, _ := engine.Layout(context.Background(), doc)
 
 	if len(boxes) != 50 {
 		t.Fatalf("expected 50 boxes, got %d", len(boxes))
@@ -264,7 +308,7 @@ func TestIntegration_ManyBoxes(t *testing.T) {
 
 	// Should render without crashing
 	renderer := render.NewRenderer(800, 600)
-	renderer.Render(boxes)
+	renderer.Render(context.Background(), boxes)
 }
 
 func TestIntegration_ParseError(t *testing.T) {
@@ -300,7 +344,7 @@ func TestIntegration_VariousSizes(t *testing.T) {
 			}
 
 			engine := layout.NewLayoutEngine(800, 600)
-			boxes := engine.Layout(doc)
+			boxes, _ := engine.Layout(context.Background(), doc)
 
 			if len(boxes) != 1 {
 				t.Fatalf("expected 1 box, got %d", len(boxes))
@@ -308,7 +352,624 @@ func TestIntegration_VariousSizes(t *testing.T) {
 
 			// Just verify it doesn't crash and produces reasonable output
 			renderer := render.NewRenderer(800, 600)
-			renderer.Render(boxes)
+			renderer.Render(context.Background(), boxes)
+		})
+	}
+}
+
+// blocksPage returns a page of n blocks of text, borders, gradients, and
+// shadows. Every third block clips its content, and every fifth is an
+// opacity group.
+func blocksPage(n int) string {
+	var sb strings.Builder
+	sb.WriteString(`<html><body style="margin: 8px">`)
+	for i := 0; i < n; i++ {
+		style := ""
+		if i%3 == 0 {
+			style += " overflow: hidden;"
+		}
+		if i%5 == 0 {
+			style += " opacity: 0.6;"
+		}
+		fmt.Fprintf(&sb, `<div style="border: 3px solid #%02x4080; border-radius: 12px; padding: 6px; margin-bottom: 8px;`+
+			` background: linear-gradient(to right, #fff, #%02xc0e0); box-shadow: 2px 2px 6px #888; height: 40px;%s">`+
+			`<span style="font-size: 18px">Block %d of the page, with enough text to wrap across lines</span></div>`,
+			(i*6)%256, 255-(i*6)%256, style, i)
+	}
+	sb.WriteString(`</body></html>`)
+	return sb.String()
+}
+
+func TestIntegration_ConcurrentRenderMatchesSerial(t *testing.T) {
+	doc, err := html.Parse(blocksPage(10))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	engine := layout.NewLayoutEngine(800, 600)
+	boxes, _ := engine.Layout(context.Background(), doc)
+
+	serial := image.NewRGBA(image.Rect(0, 0, 800, 600))
+	render.NewRendererForImage(serial).Render(context.Background(), boxes)
+
+	// Tiles are at least 64 rows, so seams fall inside the blocks
+	for _, n := range []int{2, 3, 7} {
+		tiled := image.NewRGBA(image.Rect(0, 0, 800, 600))
+		renderer := render.NewRendererForImage(tiled)
+		renderer.SetConcurrency(n)
+		renderer.Render(context.Background(), boxes)
+		if !bytes.Equal(serial.Pix, tiled.Pix) {
+			t.Errorf("concurrency %d: tiled render differs from serial render", n)
+		}
+	}
+}
+
+func TestIntegration_ViewportOffsetRendersWindow(t *testing.T) {
+	doc, err := html.Parse(`<body style="margin:0"><div style="height:1000px"></div>` +
+		`<div style="background-color: blue; height: 100px"></div><div style="height:1500px"></div></body>`)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	engine := layout.NewLayoutEngine(800, 600)
+	boxes, _ := engine.Layout(context.Background(), doc)
+	if h := engine.DocumentHeight(); h != 2600 {
+		t.Errorf("expected a 2600px document, got %.1f", h)
+	}
+
+	// A viewport-sized image shows the blue block 100px below the window top
+	target := image.NewRGBA(image.Rect(0, 0, 800, 600))
+	renderer := render.NewRendererForImage(target)
+	renderer.SetViewportOffset(900)
+	renderer.Render(context.Background(), boxes)
+	for _, y := range []int{50, 150, 250} {
+		r, g, b, _ := target.At(10, y).RGBA()
+		blue := r == 0 && g == 0 && b == 0xffff
+		if want := y == 150; blue != want {
+			t.Errorf("row %d: expected blue=%v, got rgb(%d, %d, %d)", y, want, r>>8, g>>8, b>>8)
+		}
+	}
+}
+
+func TestIntegration_BodyBackgroundPaintsCanvas(t *testing.T) {
+	tests := []struct {
+		name    string
+		style   string
+		x, y    int
+		r, g, b uint8
+	}{
+		// body's margin and the area below the content take its background
+		{"body margin", "body { background: #eee }", 2, 2, 238, 238, 238},
+		{"below content", "body { background: #eee }", 100, 95, 238, 238, 238},
+		// A translucent background is painted once, not again on body's box
+		{"translucent", "body { background: rgba(0, 0, 255, 0.5) }", 50, 20, 128, 128, 255},
+		// The root's own background takes precedence over body's
+		{"root background", "html { background: green } body { background: #eee }", 2, 95, 0, 128, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := html.Parse(`<html><head><style>` + tt.style + `</style></head><body><p>text</p></body></html>`)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			boxes, _ := layout.NewLayoutEngine(200, 100).Layout(context.Background(), doc)
+			target := image.NewRGBA(image.Rect(0, 0, 200, 100))
+			render.NewRendererForImage(target).Render(context.Background(), boxes)
+			if c := target.RGBAAt(tt.x, tt.y); c.R != tt.r || c.G != tt.g || c.B != tt.b {
+				t.Errorf("at (%d, %d): expected rgb(%d, %d, %d), got rgb(%d, %d, %d)", tt.x, tt.y, tt.r, tt.g, tt.b, c.R, c.G, c.B)
+			}
+		})
+	}
+}
+
+func TestIntegration_CanvasCompositedIntoPage(t *testing.T) {
+	doc, err := html.Parse(`<body style="margin:0"><canvas id="c" width="20" height="10" style="display:block; width:40px; height:20px"></canvas>` +
+		`<script>var ctx = document.getElementById("c").getContext("2d"); ctx.fillStyle = "blue"; ctx.fillRect(0, 0, 10, 10);</script></body>`)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if err := js.New().Execute(doc); err != nil {
+		t.Fatalf("script error: %v", err)
+	}
+	boxes, _ := layout.NewLayoutEngine(100, 50).Layout(context.Background(), doc)
+	target := image.NewRGBA(image.Rect(0, 0, 100, 50))
+	render.NewRendererForImage(target).Render(context.Background(), boxes)
+
+	// The bitmap is scaled to the canvas's CSS size: its left half is blue
+	tests := []struct {
+		x, y int
+		blue bool
+	}{
+		{5, 5, true}, {15, 15, true}, {25, 5, false}, {45, 5, false}, {5, 25, false},
+	}
+	for _, tt := range tests {
+		c := target.RGBAAt(tt.x, tt.y)
+		if blue := c.R == 0 && c.G == 0 && c.B == 255; blue != tt.blue {
+			t.Errorf("at (%d, %d): expected blue=%v, got rgb(%d, %d, %d)", tt.x, tt.y, tt.blue, c.R, c.G, c.B)
+		}
+	}
+}
+
+func TestIntegration_PageLinksAndFragments(t *testing.T) {
+	renderer := resource.NewLouis14Renderer(resource.NewFetcher("https://example.com/docs/index.html"))
+	page, err := renderer.Load(context.Background(), `<body style="margin:0">`+
+		`<a id="link" href="other.html" style="display:block; height:20px">other</a>`+
+		`<div style="height:500px"></div><h2 id="section" style="margin:0">Section</h2>`+
+		`<div style="height:100px"></div><a name="legacy"></a><p style="margin:0">after</p></body>`, 200, 100)
+	if err != nil {
+		t.Fatalf("load error: %v", err)
+	}
+
+	// Clicking a link requests a navigation to its resolved href
+	page.PressAt(5, 5)
+	page.Release(5, 5)
+	nav, ok := page.TakeNavigation()
+	if want := "https://example.com/docs/other.html"; !ok || nav.URL != want {
+		t.Errorf("expected a navigation to %s, got %+v, %v", want, nav, ok)
+	}
+	if _, ok := page.TakeNavigation(); ok {
+		t.Error("expected the navigation to be taken once")
+	}
+
+	// Fragments scroll to the element with the id, else the named anchor
+	section, ok := page.FragmentOffset("section")
+	if !ok || section != 520 {
+		t.Errorf("expected #section at 520, got %v, %v", section, ok)
+	}
+	if legacy, ok := page.FragmentOffset("legacy"); !ok || legacy <= section+100 {
+		t.Errorf("expected #legacy below #section, got %v, %v", legacy, ok)
+	}
+	if top, ok := page.FragmentOffset(""); !ok || top != 0 {
+		t.Errorf("expected an empty fragment to target the top, got %v, %v", top, ok)
+	}
+	if _, ok := page.FragmentOffset("missing"); ok {
+		t.Error("expected no target for #missing")
+	}
+}
+
+func TestIntegration_PageFindInPage(t *testing.T) {
+	renderer := resource.NewLouis14Renderer(resource.NewFetcher("https://example.com/"))
+	page, err := renderer.Load(context.Background(), `<body style="margin:0; font-family:Ahem; font-size:20px; line-height:20px">`+
+		`<p style="margin:0">xx needle</p><div style="height:500px"></div>`+
+		`<p style="margin:0">Needle</p></body>`, 200, 100)
+	if err != nil {
+		t.Fatalf("load error: %v", err)
+	}
+
+	if n := page.Find("NEEDLE"); n != 2 {
+		t.Fatalf("expected 2 matches, got %d", n)
+	}
+	if active, count := page.FindStatus(); active != 0 || count != 2 {
+		t.Errorf("expected match 0 of 2 active, got %d of %d", active, count)
+	}
+
+	// The active match is highlighted over the text; the page around it is not
+	target := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	page.RenderAt(target, 0, 0)
+	if c := target.RGBAAt(70, 10); c.R < 0x80 || c.G < 0x40 || c.B > 0x10 {
+		t.Errorf("expected the highlight over the match's text, got %v", c)
+	}
+	if c := target.RGBAAt(190, 50); c != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("expected white away from the match, got %v", c)
+	}
+
+	// Stepping wraps around, and revealing scrolls to the match off screen
+	page.FindStep(1)
+	if _, y := page.RevealMatch(0, 0); y <= 400 {
+		t.Errorf("expected to scroll down to the second match, got %v", y)
+	}
+	page.FindStep(1)
+	if active, _ := page.FindStatus(); active != 0 {
+		t.Errorf("expected stepping past the last match to wrap to 0, got %d", active)
+	}
+	if x, y := page.RevealMatch(0, 0); x != 0 || y != 0 {
+		t.Errorf("expected no scrolling for a match in view, got %v, %v", x, y)
+	}
+
+	// Clearing the search removes the highlights
+	page.Find("")
+	page.RenderAt(target, 0, 0)
+	if c := target.RGBAAt(70, 10); c != (color.RGBA{0, 0, 0, 255}) {
+		t.Errorf("expected the unhighlighted text after clearing, got %v", c)
+	}
+}
+
+func TestIntegration_PageTextSelection(t *testing.T) {
+	renderer := resource.NewLouis14Renderer(resource.NewFetcher("https://example.com/"))
+	page, err := renderer.Load(context.Background(), `<body style="margin:0; font-family:Ahem; font-size:20px; line-height:20px">`+
+		`<p style="margin:0">select me</p><p style="margin:0">and me</p></body>`, 200, 100)
+	if err != nil {
+		t.Fatalf("load error: %v", err)
+	}
+
+	// Dragging from inside "select" to the middle of the next line selects
+	// across the paragraphs
+	page.PressAt(41, 10)
+	page.DragTo(65, 30)
+	page.Release(65, 30)
+	if got, want := page.SelectedText(), "lect me\nand"; got != want {
+		t.Errorf("expected %q selected, got %q", want, got)
+	}
+	if page.DragTo(0, 0) {
+		t.Error("expected moving after the release to leave the selection")
+	}
+
+	// The selected text is drawn inverted: white glyphs on black
+	target := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	page.RenderAt(target, 0, 0)
+	if c := target.RGBAAt(50, 10); c != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("expected a selected glyph drawn white, got %v", c)
+	}
+	if c := target.RGBAAt(10, 10); c != (color.RGBA{0, 0, 0, 255}) {
+		t.Errorf("expected an unselected glyph drawn black, got %v", c)
+	}
+
+	// A click without dragging selects nothing
+	page.PressAt(10, 10)
+	page.Release(10, 10)
+	if got := page.SelectedText(); got != "" {
+		t.Errorf("expected the click to clear the selection, got %q", got)
+	}
+}
+
+// chunkReader returns its chunks from successive reads, as a document
+// arrives over a connection.
+type chunkReader []string
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(*r) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, (*r)[0])
+	(*r)[0] = (*r)[0][n:]
+	if (*r)[0] == "" {
+		*r = (*r)[1:]
+	}
+	return n, nil
+}
+
+func TestIntegration_LoadStreamPreviews(t *testing.T) {
+	renderer := resource.NewLouis14Renderer(resource.NewFetcher("https://example.com/"))
+	renderer.SetJSEngine(js.New())
+	body := &chunkReader{
+		`<!DOCTYPE html><body style="margin:0"><div style="height:50px; background:red"></div><div style="hei`,
+		`ght:50px; background:blue"></div><script>document.body.style.background = "lime"</script></body>`,
+	}
+	var previews []*resource.Page
+	page, err := renderer.LoadStream(context.Background(), body, 100, 200, func(p *resource.Page) {
+		previews = append(previews, p)
+	})
+	if err != nil {
+		t.Fatalf("load error: %v", err)
+	}
+
+	// The first chunk is shown before the rest arrives, without running
+	// scripts, and leaves out the tag cut off at its end
+	if len(previews) == 0 {
+		t.Fatal("expected a preview of the first chunk")
+	}
+	target := image.NewRGBA(image.Rect(0, 0, 100, 200))
+	previews[0].RenderAt(target, 0, 0)
+	for _, c := range []struct {
+		y    int
+		want color.RGBA
+	}{{25, color.RGBA{255, 0, 0, 255}}, {75, color.RGBA{255, 255, 255, 255}}} {
+		if got := target.RGBAAt(50, c.y); got != c.want {
+			t.Errorf("preview at y=%d: expected %v, got %v", c.y, c.want, got)
+		}
+	}
+
+	// The page loaded is the whole document, with its scripts run
+	page.RenderAt(target, 0, 0)
+	for _, c := range []struct {
+		y    int
+		want color.RGBA
+	}{{25, color.RGBA{255, 0, 0, 255}}, {75, color.RGBA{0, 0, 255, 255}}, {150, color.RGBA{0, 255, 0, 255}}} {
+		if got := target.RGBAAt(50, c.y); got != c.want {
+			t.Errorf("page at y=%d: expected %v, got %v", c.y, c.want, got)
+		}
+	}
+}
+
+// slowFetcher serves stylesheets from memory after a delay, 20ms if it is
+// zero, and records the most requests it served at once.
+type slowFetcher struct {
+	files map[string]string
+	delay time.Duration
+
+	mu                  sync.Mutex
+	inFlight, maxFlight int
+}
+
+func (f *slowFetcher) Fetch(ctx context.Context, uri string) ([]byte, string, error) {
+	f.mu.Lock()
+	f.inFlight++
+	f.maxFlight = max(f.maxFlight, f.inFlight)
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.inFlight--
+		f.mu.Unlock()
+	}()
+	delay := f.delay
+	if delay == 0 {
+		delay = 20 * time.Millisecond
+	}
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return nil, "", ctx.Err()
+	}
+	body, ok := f.files[uri]
+	if !ok {
+		return nil, "", fmt.Errorf("not found: %s", uri)
+	}
+	return []byte(body), "text/css", nil
+}
+
+func TestIntegration_SubresourcesFetchedConcurrently(t *testing.T) {
+	fetcher := &slowFetcher{files: map[string]string{
+		"a.css": `#a { background: red }`,
+		"b.css": `@import "c.css"; #b { background: lime }`,
+		"c.css": `#c { background: blue }`,
+		"d.css": `#d { background: black }`,
+	}}
+	renderer := resource.NewLouis14Renderer(fetcher)
+	var head, body strings.Builder
+	for _, id := range []string{"a", "b", "c", "d"} {
+		if id != "c" {
+			head.WriteString(`<link rel="stylesheet" href="` + id + `.css">`)
+		}
+		body.WriteString(`<div id="` + id + `" style="height:10px"></div>`)
+	}
+	page, err := renderer.Load(context.Background(), `<html><head>`+head.String()+`</head><body style="margin:0">`+body.String()+`</body></html>`, 40, 40)
+	if err != nil {
+		t.Fatalf("load error: %v", err)
+	}
+	if fetcher.maxFlight < 2 {
+		t.Errorf("expected the stylesheets fetched concurrently, got at most %d at once", fetcher.maxFlight)
+	}
+
+	// Each stylesheet, including the imported one, applies once
+	target := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	page.RenderAt(target, 0, 0)
+	for i, want := range []color.RGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}, {0, 0, 0, 255}} {
+		if got := target.RGBAAt(20, 10*i+5); got != want {
+			t.Errorf("div %d: expected %v, got %v", i, want, got)
+		}
+	}
+}
+
+func TestIntegration_LoadCanceled(t *testing.T) {
+	fetcher := &slowFetcher{files: map[string]string{"a.css": `div { color: red }`}, delay: time.Minute}
+	renderer := resource.NewLouis14Renderer(fetcher)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := renderer.Load(ctx, `<link rel="stylesheet" href="a.css"><div>text</div>`, 40, 40)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the load to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected the stylesheet fetch abandoned, took %v", elapsed)
+	}
+
+	// A script stuck in a loop is interrupted too
+	renderer = resource.NewLouis14Renderer(nil)
+	renderer.SetJSEngine(js.New())
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := renderer.Load(ctx, `<script>for (;;) {}</script>`, 40, 40); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the script interrupted, got %v", err)
+	}
+}
+
+func TestIntegration_PolicyBlocksResources(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css")
+		w.Write([]byte(`div { background: red }`))
+	}))
+	defer other.Close()
+	redirect := strings.Replace(other.URL, "127.0.0.1", "localhost", 1) + "/b.css"
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a.css":
+			http.Redirect(w, r, redirect, http.StatusFound)
+		case "/big.css":
+			w.Header().Set("Content-Type", "text/css")
+			w.Write([]byte(`div { background: blue } /*` + strings.Repeat("x", 1000) + `*/`))
+		case "/small.css":
+			w.Header().Set("Content-Type", "text/css")
+			w.Write([]byte(`p { background: lime }`))
+		}
+	}))
+	defer origin.Close()
+
+	renderer := resource.NewLouis14Renderer(resource.NewFetcher(origin.URL + "/"))
+	renderer.SetPolicy(resource.Policy{Hosts: []string{"127.0.0.1"}, MaxResourceSize: 500, AllowPrivateNetworks: true})
+	if _, _, err := renderer.Fetcher().Fetch(context.Background(), "file:///etc/hostname"); !errors.Is(err, resource.ErrBlocked) {
+		t.Errorf("expected a local file blocked for a network page, got %v", err)
+	}
+	if _, _, err := renderer.Fetcher().Fetch(context.Background(), "a.css"); err == nil || !strings.Contains(err.Error(), "host localhost") {
+		t.Errorf("expected the redirect to another host blocked, got %v", err)
+	}
+
+	// Only the stylesheet the policy allows applies
+	page, err := renderer.Load(context.Background(), `<body style="margin:0">`+
+		`<link rel="stylesheet" href="a.css"><link rel="stylesheet" href="big.css"><link rel="stylesheet" href="small.css">`+
+		`<div style="height:10px"></div><p style="height:10px; margin:0"></p>`, 20, 20)
+	if err != nil {
+		t.Fatalf("load error: %v", err)
+	}
+	target := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	page.RenderAt(target, 0, 0)
+	if got := target.RGBAAt(10, 5); got != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("expected the blocked stylesheets not applied, got %v", got)
+	}
+	if got := target.RGBAAt(10, 15); got != (color.RGBA{0, 255, 0, 255}) {
+		t.Errorf("expected the allowed stylesheet applied, got %v", got)
+	}
+}
+
+func TestIntegration_MetaRefreshAndBaseHref(t *testing.T) {
+	dot := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	dot.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	var dotPNG bytes.Buffer
+	png.Encode(&dotPNG, dot)
+	hops := 0
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/next/page.html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><base href="/assets/"><link rel="stylesheet" href="style.css"></head>` +
+				`<body style="margin:0"><div style="height:10px"></div><img src="dot.png" style="display:block; width:10px; height:10px">` +
+				`<a href="other.html" style="display:block; height:10px">x</a></body></html>`))
+		case "/assets/style.css":
+			w.Header().Set("Content-Type", "text/css")
+			w.Write([]byte(`div { background: lime }`))
+		case "/assets/dot.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(dotPNG.Bytes())
+		case "/hop":
+			hops++
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, `<meta http-equiv="refresh" content="0; url=/hop?n=%d">`, hops)
+		}
+	}))
+	defer origin.Close()
+
+	renderer := resource.NewLouis14Renderer(resource.NewFetcher(origin.URL + "/start.html"))
+	page, err := renderer.Load(context.Background(), `<meta http-equiv="refresh" content="0; URL='next/page.html'"><p>Redirecting</p>`, 30, 30)
+	if err != nil {
+		t.Fatalf("load error: %v", err)
+	}
+	if page.URL() != origin.URL+"/next/page.html" {
+		t.Errorf("expected the page the refresh led to, got %s", page.URL())
+	}
+
+	// The stylesheet, image, and link resolve against the base
+	target := image.NewRGBA(image.Rect(0, 0, 30, 30))
+	page.RenderAt(target, 0, 0)
+	if got := target.RGBAAt(5, 5); got != (color.RGBA{0, 255, 0, 255}) {
+		t.Errorf("expected the stylesheet under the base applied, got %v", got)
+	}
+	if got := target.RGBAAt(5, 15); got != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("expected the image under the base drawn, got %v", got)
+	}
+	page.PressAt(2, 25)
+	page.Release(2, 25)
+	if nav, ok := page.TakeNavigation(); !ok || nav.URL != origin.URL+"/assets/other.html" {
+		t.Errorf("expected the link to resolve against the base, got %+v", nav)
+	}
+
+	// A page that keeps redirecting stops after a few hops
+	if _, err := renderer.Load(context.Background(), `<meta http-equiv="refresh" content="0;url=/hop">`, 30, 30); err != nil {
+		t.Fatalf("load error: %v", err)
+	}
+	if hops != 5 {
+		t.Errorf("expected 5 refreshes followed, got %d", hops)
+	}
+}
+
+func TestIntegration_ErrorPage(t *testing.T) {
+	origin := httptest.NewServer(http.NotFoundHandler())
+	defer origin.Close()
+	url := origin.URL + "/missing.html"
+	_, _, err := stdnet.FetchContext(context.Background(), url)
+	var status *stdnet.StatusError
+	if !errors.As(err, &status) || status.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected a 404 StatusError, got %v", err)
+	}
+
+	doc := resource.ErrorPage(url, err)
+	for _, want := range []string{"Page not found", url, "404 Not Found"} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("expected the error page to contain %q", want)
+		}
+	}
+	if doc := resource.ErrorPage(url, errors.New("<script>")); strings.Contains(doc, "<script>") {
+		t.Error("expected the error escaped")
+	}
+
+	// The error page renders through the normal pipeline: the box's red
+	// left border is inside the body's padding
+	page, err := resource.NewLouis14Renderer(resource.NewFetcher(url)).Load(context.Background(), doc, 400, 300)
+	if err != nil {
+		t.Fatalf("load error: %v", err)
+	}
+	target := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	page.RenderAt(target, 0, 0)
+	if got := target.RGBAAt(50, 70); got != (color.RGBA{0xd9, 0x30, 0x25, 255}) {
+		t.Errorf("expected the error box's border, got %v", got)
+	}
+}
+
+func TestIntegration_BrokenImagePlaceholder(t *testing.T) {
+	doc, err := html.Parse(`<body style="margin:0; font-size:16px">` +
+		`<div><img src="testdata/missing-a.png" alt="Missing picture"></div>` +
+		`<div><img src="testdata/missing-b.png"></div>`)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	boxes, _ := layout.NewLayoutEngine(300, 100).Layout(context.Background(), doc)
+
+	// An image with alt text keeps room for the icon and the text
+	var sizes [][2]float64
+	var walk func(box *layout.Box)
+	walk = func(box *layout.Box) {
+		if box.ImagePath != "" {
+			sizes = append(sizes, [2]float64{box.Width, box.Height})
+		}
+		for _, child := range box.Children {
+			walk(child)
+		}
+	}
+	for _, box := range boxes {
+		walk(box)
+	}
+	if len(sizes) != 2 {
+		t.Fatalf("expected 2 image boxes, got %d", len(sizes))
+	}
+	if sizes[0][0] <= layout.BrokenImageIconSize+layout.BrokenImageGap || sizes[0][1] < layout.BrokenImageIconSize {
+		t.Errorf("expected room for the icon and alt text, got %v", sizes[0])
+	}
+	if sizes[1][0] != 0 {
+		t.Errorf("expected an image without alt text to take no width, got %v", sizes[1])
+	}
+
+	// The icon is drawn, with the alt text beside it
+	target := image.NewRGBA(image.Rect(0, 0, 300, 100))
+	render.NewRendererForImage(target).Render(context.Background(), boxes)
+	if got := target.RGBAAt(4, 4); got == (color.RGBA{255, 255, 255, 255}) {
+		t.Error("expected the broken-image icon drawn")
+	}
+	inked := false
+	for x := 24; x < int(sizes[0][0]) && !inked; x++ {
+		for y := 0; y < 16; y++ {
+			if c := target.RGBAAt(x, y); c.R < 128 && c.G < 128 && c.B < 128 {
+				inked = true
+				break
+			}
+		}
+	}
+	if !inked {
+		t.Error("expected the alt text drawn")
+	}
+}
+
+func BenchmarkRender_Concurrency(b *testing.B) {
+	doc, err := html.Parse(blocksPage(36))
+	if err != nil {
+		b.Fatalf("parse error: %v", err)
+	}
+	engine := layout.NewLayoutEngine(800, 2400)
+	boxes, _ := engine.Layout(context.Background(), doc)
+
+	for _, n := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", n), func(b *testing.B) {
+			renderer := render.NewRenderer(800, 2400)
+			renderer.SetConcurrency(n)
+			for i := 0; i < b.N; i++ {
+				renderer.Render(context.Background(), boxes)
+			}
 		})
 	}
 }
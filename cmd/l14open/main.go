@@ -1,37 +1,67 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
+	"mime"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
 
+	"louis14/pkg/a11y"
+	"louis14/pkg/determinism"
 	"louis14/pkg/html"
 	"louis14/pkg/images"
 	"louis14/pkg/js"
 	"louis14/pkg/layout"
 	"louis14/pkg/render"
+	"louis14/pkg/text"
 )
 
+// scriptIdleDeadline is how far ahead timers set by scripts are run before
+// the page is captured; later timers never fire.
+const scriptIdleDeadline = 5 * time.Second
+
 func main() {
-	if len(os.Args) < 3 {
-		fmt.Fprintf(os.Stderr, "Usage: %s <input.html> <output.png> [width] [height]\n", os.Args[0])
+	format := flag.String("format", "png", "output format: png, svg, or pdf for a paged PDF document")
+	dumpLayout := flag.String("dump-layout", "", "also write the laid out box tree as JSON to this file")
+	offset := flag.Float64("offset", 0, "render the window of the page starting this many pixels down (png and svg)")
+	readText := flag.Bool("text", false, "write the page's readable text, in reading order, to the output (- for standard output) instead of rendering it")
+	deterministic := flag.Bool("deterministic", false, "render identically on any machine: bundled fonts only, and a fixed clock and random seed for scripts")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-format png|svg|pdf] [-offset y] [-dump-layout out.json] [-text] [-deterministic] <input.html> <output> [width] [height]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "A PNG output name containing %%d, as in page-%%d.png, renders one PNG per page of width x height.\n")
+		fmt.Fprintf(os.Stderr, "PDF output has one page of width x height per page.\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	args := flag.Args()
+	if len(args) < 2 || (*format != "png" && *format != "svg" && *format != "pdf") {
+		flag.Usage()
 		os.Exit(1)
 	}
-	inputFile := os.Args[1]
-	outputFile := os.Args[2]
+	if *deterministic {
+		determinism.Enable()
+	}
+	inputFile := args[0]
+	outputFile := args[1]
+	paged := strings.Contains(outputFile, "%d")
 
 	// Default viewport size
 	viewportWidth := 800.0
-	viewportHeight := 2400.0 // Much taller default for typical web pages
+	viewportHeight := 600.0 // Use -offset to render windows further down long pages
 
 	// Parse optional width and height arguments
-	if len(os.Args) >= 4 {
-		fmt.Sscanf(os.Args[3], "%f", &viewportWidth)
+	if len(args) >= 3 {
+		fmt.Sscanf(args[2], "%f", &viewportWidth)
 	}
-	if len(os.Args) >= 5 {
-		fmt.Sscanf(os.Args[4], "%f", &viewportHeight)
+	if len(args) >= 4 {
+		fmt.Sscanf(args[3], "%f", &viewportHeight)
 	}
 
 	htmlContent, err := os.ReadFile(inputFile)
@@ -53,7 +83,8 @@ func main() {
 		return string(data), nil
 	}
 
-	doc, err := html.ParseWithFetcher(string(htmlContent), cssFetcher)
+	// Scripts are always run, so <noscript> is not rendered
+	doc, err := html.ParseWithOptions(html.Decode(htmlContent), html.ParseOptions{CSSFetcher: cssFetcher, Scripting: true})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error parsing HTML: %v\n", err)
 		os.Exit(1)
@@ -61,37 +92,164 @@ func main() {
 
 	// Create a filesystem fetcher that resolves relative paths against the input file
 	fetcher := images.NewFilesystemFetcher(inputFile)
+	absInput, err := filepath.Abs(inputFile)
+	if err != nil {
+		absInput = inputFile
+	}
 
 	layoutEngine := layout.NewLayoutEngine(viewportWidth, viewportHeight)
 	layoutEngine.SetImageFetcher(fetcher)
-	boxes := layoutEngine.Layout(doc)
-
-	renderer := render.NewRenderer(int(viewportWidth), int(viewportHeight))
-	renderer.SetImageFetcher(fetcher)
-	renderer.Render(boxes)
+	layoutEngine.SetBaseURL(absInput)
+	layoutEngine.SetFontFetcher(text.FontFetcher(fetcher))
+	layoutEngine.SetIncremental(len(doc.Scripts) > 0)
+	layoutEngine.SetScrollY(*offset)
+	// Nothing cancels a command-line render, so layout and paint, which
+	// fail only when their context is done, always succeed
+	ctx := context.Background()
+	boxes, _ := layoutEngine.Layout(ctx, doc)
 
 	// Execute JavaScript if there are scripts
 	if len(doc.Scripts) > 0 {
 		engine := js.New()
+		// Scripts fetch files relative to the input file
+		engine.SetBaseURL(absInput)
+		engine.SetFetcher(js.FetcherFunc(func(_ context.Context, uri string) ([]byte, string, error) {
+			data, err := os.ReadFile(uri)
+			return data, mime.TypeByExtension(filepath.Ext(uri)), err
+		}))
 		if err := engine.Execute(doc); err != nil {
 			log.Printf("js: %v", err)
 		}
-		// Re-layout and re-render with JS modifications
-		layoutEngine2 := layout.NewLayoutEngine(viewportWidth, viewportHeight)
-		layoutEngine2.SetImageFetcher(fetcher)
-		boxes2 := layoutEngine2.Layout(doc)
-		renderer = render.NewRenderer(int(viewportWidth), int(viewportHeight))
+		// Re-layout with JS modifications (loading any images the scripts
+		// added), then fire load; only subtrees the scripts touched are
+		// recomputed
+		layoutEngine.Layout(ctx, doc)
+		if err := engine.DispatchLoad(); err != nil {
+			log.Printf("js: %v", err)
+		}
+		// Apply deferred changes from timers before the final layout
+		if err := engine.RunUntilIdle(scriptIdleDeadline); err != nil {
+			log.Printf("js: %v", err)
+		}
+		boxes, _ = layoutEngine.Layout(ctx, doc)
+	}
+
+	if *dumpLayout != "" {
+		if err := writeLayoutDump(*dumpLayout, boxes); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing layout dump: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *readText {
+		if err := writeText(outputFile, a11y.Text(a11y.Build(doc, boxes))); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing text: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *format == "pdf" {
+		pages, err := layoutEngine.LayoutPaged(ctx, doc, viewportWidth, viewportHeight)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error laying out pages: %v\n", err)
+			os.Exit(1)
+		}
+		pdf := render.NewPDFBackend(int(viewportWidth), int(viewportHeight))
+		renderer := render.NewRendererForBackend(pdf)
+		renderer.SetImageFetcher(fetcher)
+		renderer.SetBaseURL(absInput)
+		for i, page := range pages {
+			if i > 0 {
+				pdf.NewPage()
+			}
+			renderer.Render(ctx, page)
+		}
+		if err := pdf.Save(outputFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving PDF: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Successfully rendered %s to %s (%d pages of %.0fx%.0f)\n", inputFile, outputFile, pdf.PageCount(), viewportWidth, viewportHeight)
+		return
+	}
+
+	if *format == "svg" {
+		svg := render.NewSVGBackend(int(viewportWidth), int(viewportHeight))
+		renderer := render.NewRendererForBackend(svg)
 		renderer.SetImageFetcher(fetcher)
-		renderer.Render(boxes2)
+		renderer.SetBaseURL(absInput)
+		renderer.SetViewportOffset(*offset)
+		renderer.Render(ctx, boxes)
+		if err := svg.Save(outputFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving SVG: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Successfully rendered %s to %s\n", inputFile, outputFile)
+		printViewport(viewportWidth, viewportHeight, *offset, layoutEngine.DocumentHeight(), len(boxes))
+		return
+	}
+
+	renderer := render.NewRenderer(int(viewportWidth), int(viewportHeight))
+	renderer.SetImageFetcher(fetcher)
+	renderer.SetBaseURL(absInput)
+	renderer.SetConcurrency(runtime.GOMAXPROCS(0))
+
+	if paged {
+		pages, err := layoutEngine.LayoutPaged(ctx, doc, viewportWidth, viewportHeight)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error laying out pages: %v\n", err)
+			os.Exit(1)
+		}
+		files, err := renderer.SavePagesPNG(ctx, pages, outputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving PNG: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Successfully rendered %s to %d pages (%s ... %s)\n", inputFile, len(files), files[0], files[len(files)-1])
+		fmt.Printf("Page: %.0fx%.0f\n", viewportWidth, viewportHeight)
+		return
 	}
 
+	renderer.SetViewportOffset(*offset)
+	renderer.Render(ctx, boxes)
+
 	if err := renderer.SavePNG(outputFile); err != nil {
 		fmt.Fprintf(os.Stderr, "Error saving PNG: %v\n", err)
 		os.Exit(1)
 	}
 	fmt.Printf("Successfully rendered %s to %s\n", inputFile, outputFile)
-	fmt.Printf("Viewport: %.0fx%.0f, Rendered %d boxes\n", viewportWidth, viewportHeight, len(boxes))
+	printViewport(viewportWidth, viewportHeight, *offset, layoutEngine.DocumentHeight(), len(boxes))
 
 	// Try to open the output file; ignore errors (e.g. if "open" is not available)
 	exec.Command("open", outputFile).Start()
 }
+
+// printViewport reports the rendered window of the page and the height of
+// the whole document, so further windows can be requested with -offset.
+func printViewport(width, height, offset, documentHeight float64, boxes int) {
+	fmt.Printf("Viewport: %.0fx%.0f at offset %.0f, Rendered %d boxes\n", width, height, offset, boxes)
+	fmt.Printf("Document height: %.0fpx\n", documentHeight)
+}
+
+// writeLayoutDump writes the box tree as JSON to the named file.
+func writeLayoutDump(path string, boxes []*layout.Box) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := layout.WriteLayoutJSON(f, boxes); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeText writes the page text to the named file, or to standard output
+// for "-".
+func writeText(path, text string) error {
+	if path == "-" {
+		_, err := fmt.Println(text)
+		return err
+	}
+	return os.WriteFile(path, []byte(text+"\n"), 0644)
+}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"louis14/pkg/determinism"
 	"louis14/pkg/visualtest"
 )
 
@@ -14,6 +15,27 @@ import (
 // Run with: go test -v ./cmd/l14open -run TestVisual
 var updateReferenceImages = os.Getenv("UPDATE_REFS") == "1"
 
+// visualReport collects the failing visual tests when VISUAL_REPORT names a
+// directory to write an HTML report to
+// Run with: VISUAL_REPORT=/tmp/visual go test ./cmd/l14open -run TestVisual
+var visualReport *visualtest.Report
+
+func TestMain(m *testing.M) {
+	determinism.Enable()
+	if dir := os.Getenv("VISUAL_REPORT"); dir != "" {
+		visualReport = visualtest.NewReport(dir)
+	}
+	code := m.Run()
+	if visualReport != nil && visualReport.Len() > 0 {
+		if path, err := visualReport.WriteHTML(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write visual report: %v\n", err)
+		} else {
+			fmt.Printf("Visual report of %d failing tests: %s\n", visualReport.Len(), path)
+		}
+	}
+	os.Exit(code)
+}
+
 func TestVisualRegression_Phase1_Simple(t *testing.T) {
 	testCase := visualTestCase{
 		name:          "simple",
@@ -1140,12 +1162,17 @@ func runVisualTest(t *testing.T, tc visualTestCase) {
 			result.DifferentPixels,
 			result.TotalPixels,
 			100.0*float64(result.DifferentPixels)/float64(result.TotalPixels))
-		t.Errorf("  Max difference: %d (tolerance: %d)", result.MaxDifference, opts.Tolerance)
+		t.Errorf("  Max difference: %d (tolerance: %d), SSIM: %.4f", result.MaxDifference, opts.Tolerance, result.SSIM)
 		t.Errorf("  Actual output: %s", actualPath)
 		t.Errorf("  Reference: %s", tc.referenceFile)
 		t.Errorf("  Diff image: %s", opts.DiffImagePath)
 		t.Errorf("\nTo update reference image if this change is intentional:")
 		t.Errorf("  UPDATE_REFS=1 go test -v ./cmd/l14open -run %s", t.Name())
+		if visualReport != nil {
+			if err := visualReport.Add(tc.name, tc.referenceFile, actualPath, opts.DiffImagePath, result); err != nil {
+				t.Errorf("failed to add to visual report: %v", err)
+			}
+		}
 	} else {
 		t.Logf("✓ Visual test passed: %s (max diff: %d)", tc.name, result.MaxDifference)
 	}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"image"
@@ -17,6 +18,9 @@ func main() {
 	width := flag.Int("w", 800, "viewport width in pixels")
 	height := flag.Int("h", 600, "viewport height in pixels")
 	output := flag.String("o", "output.png", "output PNG file path")
+	offset := flag.Float64("y", 0, "render the window of the page starting this many pixels down")
+	colorScheme := flag.String("color-scheme", "light", "preferred color scheme for @media queries (light or dark)")
+	timeout := flag.Duration("timeout", 0, "give up if fetching and rendering the page take longer than this (0 = no limit)")
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: l14show [flags] <url>\n\nFlags:\n")
 		flag.PrintDefaults()
@@ -29,31 +33,55 @@ func main() {
 	}
 	url := flag.Arg(0)
 
-	// Fetch HTML
+	// The timeout covers the page and its subresources, fetches, and scripts
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	// Create render target
+	target := image.NewRGBA(image.Rect(0, 0, *width, *height))
+
+	// Fetch HTML. When the page can't be fetched, an error page describing
+	// why is saved in its place.
 	fmt.Fprintf(os.Stderr, "Fetching %s...\n", url)
-	body, _, err := stdnet.Fetch(url)
+	body, _, err := stdnet.FetchContext(ctx, url)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error fetching URL: %v\n", err)
+		renderer := resource.NewLouis14Renderer(resource.NewFetcher(url))
+		renderer.SetColorScheme(*colorScheme)
+		// The page's timeout may be what the fetch failed on
+		if err := renderer.Render(context.Background(), resource.ErrorPage(url, err), target); err == nil {
+			savePNG(*output, target)
+			fmt.Fprintf(os.Stderr, "Saved error page to %s\n", *output)
+		}
 		os.Exit(1)
 	}
 
-	// Create render target
-	target := image.NewRGBA(image.Rect(0, 0, *width, *height))
-
 	// Create fetcher and renderer with JS support
 	fetcher := resource.NewFetcher(url)
 	renderer := resource.NewLouis14Renderer(fetcher)
 	renderer.SetJSEngine(js.New())
+	renderer.SetColorScheme(*colorScheme)
+	renderer.SetViewportOffset(*offset)
 
 	// Render
 	fmt.Fprintf(os.Stderr, "Rendering %dx%d...\n", *width, *height)
-	if err := renderer.Render(string(body), target); err != nil {
+	if err := renderer.Render(ctx, string(body), target); err != nil {
 		fmt.Fprintf(os.Stderr, "Error rendering: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Save PNG
-	f, err := os.Create(*output)
+	savePNG(*output, target)
+	fmt.Fprintf(os.Stderr, "Saved to %s\n", *output)
+	fmt.Fprintf(os.Stderr, "Document height: %.0fpx (window at %.0f)\n", renderer.DocumentHeight(), *offset)
+}
+
+// savePNG writes target to the PNG file at path, exiting on failure.
+func savePNG(path string, target *image.RGBA) {
+	f, err := os.Create(path)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
 		os.Exit(1)
@@ -64,6 +92,4 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Error encoding PNG: %v\n", err)
 		os.Exit(1)
 	}
-
-	fmt.Fprintf(os.Stderr, "Saved to %s\n", *output)
 }
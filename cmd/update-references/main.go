@@ -3,17 +3,27 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
+	"louis14/pkg/determinism"
 	"louis14/pkg/visualtest"
 )
 
+// testdataDir is where the visual test pages live, relative to the
+// repository root the tool is run from
+const testdataDir = "testdata"
+
 // Simple tool to generate reference images for visual regression tests
 func main() {
 	if len(os.Args) < 2 {
 		fmt.Println("Reference Image Generator for Louis14")
 		fmt.Println()
 		fmt.Println("Usage:")
-		fmt.Println("  go run cmd/update-references/main.go <phase>")
+		fmt.Println("  go run cmd/update-references/main.go <dir>...")
+		fmt.Println()
+		fmt.Println("Regenerates reference/<name>.png for every <name>.html in the")
+		fmt.Println("directories below testdata/<dir> that have a reference directory,")
+		fmt.Println("at the size of the existing reference image (800x600 for new ones).")
 		fmt.Println()
 		fmt.Println("Examples:")
 		fmt.Println("  go run cmd/update-references/main.go phase1")
@@ -24,44 +34,45 @@ func main() {
 		os.Exit(1)
 	}
 
-	phase := os.Args[1]
-
-	switch phase {
-	case "phase1", "all":
-		if err := generatePhase1References(); err != nil {
+	// References must render the same wherever they are regenerated
+	determinism.Enable()
+	for _, arg := range os.Args[1:] {
+		root := filepath.Join(testdataDir, arg)
+		if arg == "all" {
+			root = testdataDir
+		}
+		n, err := generateReferences(root)
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
-		fmt.Println("✓ Phase 1 reference images generated successfully")
-
-	default:
-		fmt.Fprintf(os.Stderr, "Unknown phase: %s\n", phase)
-		os.Exit(1)
+		fmt.Printf("✓ %d reference images generated for %s\n", n, arg)
 	}
 }
 
-func generatePhase1References() error {
+// generateReferences regenerates the reference images of the cases below
+// root and returns how many there were.
+func generateReferences(root string) (int, error) {
+	// Viewport of cases that don't have a reference image yet
 	const (
-		width  = 800
-		height = 600
+		defaultWidth  = 800
+		defaultHeight = 600
 	)
 
-	references := []struct {
-		htmlPath      string
-		referencePath string
-	}{
-		{
-			"testdata/phase1/simple.html",
-			"testdata/phase1/reference/simple.png",
-		},
+	if _, err := os.Stat(root); err != nil {
+		return 0, fmt.Errorf("unknown test directory: %w", err)
+	}
+	cases, err := visualtest.DiscoverCases(root)
+	if err != nil {
+		return 0, err
 	}
 
-	for _, ref := range references {
-		fmt.Printf("Generating: %s\n", ref.referencePath)
-		if err := visualtest.UpdateReferenceImage(ref.htmlPath, ref.referencePath, width, height); err != nil {
-			return fmt.Errorf("failed to generate %s: %w", ref.referencePath, err)
+	for _, c := range cases {
+		width, height := c.ViewportSize(defaultWidth, defaultHeight)
+		fmt.Printf("Generating: %s (%dx%d)\n", c.ReferencePath, width, height)
+		if err := visualtest.UpdateReferenceImage(c.HTMLPath, c.ReferencePath, width, height); err != nil {
+			return 0, fmt.Errorf("failed to generate %s: %w", c.ReferencePath, err)
 		}
 	}
-
-	return nil
+	return len(cases), nil
 }
@@ -0,0 +1,449 @@
+// Package a11y builds the accessibility tree of a laid-out document: the
+// rendered elements with the roles and names a screen reader announces
+// them by, and the text of the page in reading order.
+package a11y
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"louis14/pkg/css"
+	"louis14/pkg/html"
+	"louis14/pkg/layout"
+)
+
+// Node is a node of the accessibility tree.
+type Node struct {
+	Role     string // ARIA role, as "heading" or "link"; "text" for runs of text
+	Name     string // Accessible name: the text it is announced by
+	Level    int    // Level of a heading, 1 to 6; 0 for other roles
+	Value    string // Current value of a form control
+	DOM      *html.Node
+	Box      *layout.Box // Box the element was laid out as; nil for text and elements without one
+	Children []*Node
+
+	block bool // Laid out as a block, so its text starts a new line
+}
+
+// Build returns the accessibility tree of doc as laid out in boxes. Only
+// rendered content is included: elements with display: none, hidden by
+// visibility or aria-hidden, or outside the body are left out.
+func Build(doc *html.Document, boxes []*layout.Box) *Node {
+	b := &builder{
+		boxes:    map[*html.Node]*layout.Box{},
+		rendered: map[*html.Node]bool{},
+		ids:      map[string]*html.Node{},
+		labels:   map[string]*html.Node{},
+	}
+	b.indexBoxes(boxes)
+	b.indexDOM(doc.Root)
+
+	root := &Node{Role: "document", DOM: doc.Root, block: true}
+	if title := findElement(doc.Root, "title"); title != nil {
+		root.Name = collapse(title.TextContent())
+	}
+	root.Children = b.children(doc.Root)
+	return root
+}
+
+// builder holds what building the tree looks up as it walks the DOM.
+type builder struct {
+	boxes    map[*html.Node]*layout.Box // Element boxes by node
+	rendered map[*html.Node]bool        // Nodes that have a box or a descendant with one
+	ids      map[string]*html.Node      // Elements by id, for aria-labelledby
+	labels   map[string]*html.Node      // <label> elements by their for attribute
+}
+
+// indexBoxes records the nodes the boxes were laid out for. Lines of text
+// are laid out with nodes of their own, so it is their parents that mark
+// the text's elements rendered.
+func (b *builder) indexBoxes(boxes []*layout.Box) {
+	for _, box := range boxes {
+		if box.Node != nil {
+			if box.Node.Type == html.ElementNode {
+				if _, ok := b.boxes[box.Node]; !ok {
+					b.boxes[box.Node] = box
+				}
+			}
+			for n := box.Node; n != nil && !b.rendered[n]; n = n.Parent {
+				b.rendered[n] = true
+			}
+		}
+		b.indexBoxes(box.Children)
+	}
+}
+
+// indexDOM records the elements with ids and the labels of form controls.
+func (b *builder) indexDOM(n *html.Node) {
+	if n.Type == html.ElementNode {
+		if id, ok := n.GetAttribute("id"); ok && b.ids[id] == nil {
+			b.ids[id] = n
+		}
+		if n.TagName == "label" {
+			if id, ok := n.GetAttribute("for"); ok && b.labels[id] == nil {
+				b.labels[id] = n
+			}
+		}
+	}
+	for _, child := range n.Children {
+		b.indexDOM(child)
+	}
+}
+
+// children returns the accessibility nodes of n's children. The children
+// of elements with role none or presentation take their places.
+func (b *builder) children(n *html.Node) []*Node {
+	var nodes []*Node
+	for _, child := range n.Children {
+		switch child.Type {
+		case html.TextNode:
+			if b.rendered[n] && strings.TrimSpace(child.Text) != "" && !b.hiddenByStyle(n) {
+				nodes = append(nodes, &Node{Role: "text", Name: collapse(child.Text), DOM: child})
+			}
+		case html.ElementNode:
+			if node := b.element(child); node != nil {
+				if node.Role == "none" || node.Role == "presentation" {
+					nodes = append(nodes, node.Children...)
+				} else {
+					nodes = append(nodes, node)
+				}
+			}
+		}
+	}
+	return nodes
+}
+
+// element returns the accessibility node of an element, or nil if it is
+// not rendered.
+func (b *builder) element(n *html.Node) *Node {
+	if !b.rendered[n] || b.hiddenByStyle(n) {
+		return nil
+	}
+	if _, hidden := n.GetAttribute("hidden"); hidden {
+		return nil
+	}
+	if hidden, _ := n.GetAttribute("aria-hidden"); strings.EqualFold(hidden, "true") {
+		return nil
+	}
+	box := b.boxes[n]
+	node := &Node{Role: role(n), DOM: n, Box: box, block: box != nil && isBlock(box.Style)}
+	if node.Role == "heading" {
+		node.Level = headingLevel(n)
+	}
+	switch node.Role {
+	case "textbox", "combobox", "listbox", "slider":
+		node.Value = n.Value()
+	}
+	node.Children = b.children(n)
+	node.Name = b.name(n, node)
+	return node
+}
+
+// hiddenByStyle reports whether an element's box is visibility: hidden.
+func (b *builder) hiddenByStyle(n *html.Node) bool {
+	box := b.boxes[n]
+	return box != nil && box.Style != nil && box.Style.GetVisibility() == "hidden"
+}
+
+// name computes an element's accessible name (Accessible Name and
+// Description Computation §4.3, simplified): aria-labelledby, aria-label,
+// the alt text of images, the labels of form controls, the content of
+// roles named by their content, and last the title attribute.
+func (b *builder) name(n *html.Node, node *Node) string {
+	if ids, ok := n.GetAttribute("aria-labelledby"); ok {
+		var parts []string
+		for _, id := range strings.Fields(ids) {
+			if el := b.ids[id]; el != nil {
+				parts = append(parts, collapse(el.TextContent()))
+			}
+		}
+		if name := strings.Join(parts, " "); name != "" {
+			return name
+		}
+	}
+	if label, ok := n.GetAttribute("aria-label"); ok && strings.TrimSpace(label) != "" {
+		return collapse(label)
+	}
+	switch n.TagName {
+	case "img", "area":
+		alt, _ := n.GetAttribute("alt")
+		return collapse(alt)
+	case "input":
+		switch n.InputType() {
+		case "button", "submit", "reset":
+			return n.ButtonLabel()
+		case "image":
+			alt, _ := n.GetAttribute("alt")
+			return collapse(alt)
+		}
+		fallthrough
+	case "textarea", "select":
+		if label := b.label(n); label != "" {
+			return label
+		}
+		if placeholder, ok := n.GetAttribute("placeholder"); ok {
+			return collapse(placeholder)
+		}
+	default:
+		if nameFromContent[node.Role] {
+			if content := contentText(node.Children); content != "" {
+				return content
+			}
+		}
+	}
+	title, _ := n.GetAttribute("title")
+	return collapse(title)
+}
+
+// label returns the text of the <label> for a form control: the label
+// whose for attribute is its id, or else the label it is inside.
+func (b *builder) label(n *html.Node) string {
+	var label *html.Node
+	if id, ok := n.GetAttribute("id"); ok {
+		label = b.labels[id]
+	}
+	for p := n.Parent; label == nil && p != nil; p = p.Parent {
+		if p.TagName == "label" {
+			label = p
+		}
+	}
+	if label == nil {
+		return ""
+	}
+	return collapse(label.TextContent())
+}
+
+// nameFromContent is the roles whose name is their content when they have
+// no label (WAI-ARIA 1.2 §5.2.8.4).
+var nameFromContent = map[string]bool{
+	"button": true, "cell": true, "checkbox": true, "columnheader": true, "heading": true,
+	"link": true, "menuitem": true, "option": true, "radio": true, "rowheader": true,
+	"switch": true, "tab": true, "tooltip": true,
+}
+
+// contentText returns the text of nodes and their descendants as they
+// read, with the names of elements without content in place of them.
+func contentText(nodes []*Node) string {
+	var sb strings.Builder
+	var write func(nodes []*Node)
+	write = func(nodes []*Node) {
+		for _, n := range nodes {
+			switch {
+			case n.Role == "text":
+				sb.WriteString(n.DOM.Text)
+			case len(n.Children) == 0:
+				sb.WriteString(" " + n.Name + " ")
+			default:
+				write(n.Children)
+			}
+		}
+	}
+	write(nodes)
+	return collapse(sb.String())
+}
+
+// role returns an element's role: its role attribute, or else the
+// implicit role of its tag (HTML-AAM §4).
+func role(n *html.Node) string {
+	if r, ok := n.GetAttribute("role"); ok {
+		if fields := strings.Fields(strings.ToLower(r)); len(fields) > 0 {
+			return fields[0]
+		}
+	}
+	switch n.TagName {
+	case "a", "area":
+		if _, ok := n.GetAttribute("href"); ok {
+			return "link"
+		}
+	case "article":
+		return "article"
+	case "aside":
+		return "complementary"
+	case "blockquote":
+		return "blockquote"
+	case "html", "body":
+		return "none" // The document node stands for them
+	case "button":
+		return "button"
+	case "dialog":
+		return "dialog"
+	case "figure":
+		return "figure"
+	case "footer":
+		return "contentinfo"
+	case "form":
+		return "form"
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		return "heading"
+	case "header":
+		return "banner"
+	case "hr":
+		return "separator"
+	case "img":
+		if alt, ok := n.GetAttribute("alt"); ok && alt == "" {
+			return "presentation" // Decorative
+		}
+		return "img"
+	case "input":
+		switch n.InputType() {
+		case "button", "submit", "reset", "image":
+			return "button"
+		case "checkbox":
+			return "checkbox"
+		case "radio":
+			return "radio"
+		case "range":
+			return "slider"
+		}
+		return "textbox"
+	case "li":
+		return "listitem"
+	case "main":
+		return "main"
+	case "nav":
+		return "navigation"
+	case "ol", "ul":
+		return "list"
+	case "option":
+		return "option"
+	case "p":
+		return "paragraph"
+	case "section":
+		return "region"
+	case "select":
+		if n.IsListBox() {
+			return "listbox"
+		}
+		return "combobox"
+	case "table":
+		return "table"
+	case "td":
+		return "cell"
+	case "textarea":
+		return "textbox"
+	case "th":
+		return "columnheader"
+	case "tr":
+		return "row"
+	}
+	return "generic"
+}
+
+// headingLevel returns the level of a heading: its aria-level, or else
+// the number in its tag.
+func headingLevel(n *html.Node) int {
+	if level, ok := n.GetAttribute("aria-level"); ok {
+		var l int
+		if _, err := fmt.Sscanf(level, "%d", &l); err == nil && l > 0 {
+			return l
+		}
+	}
+	if len(n.TagName) == 2 && n.TagName[0] == 'h' && n.TagName[1] >= '1' && n.TagName[1] <= '6' {
+		return int(n.TagName[1] - '0')
+	}
+	return 2 // The default of role=heading
+}
+
+// isBlock reports whether a box's display starts a new line of text.
+func isBlock(style *css.Style) bool {
+	if style == nil {
+		return false
+	}
+	switch style.GetDisplay() {
+	case css.DisplayBlock, css.DisplayListItem, css.DisplayFlex, css.DisplayGrid,
+		css.DisplayTable, css.DisplayTableRow, css.DisplayTableCaption:
+		return true
+	}
+	return false
+}
+
+// Text returns the text of the tree in reading order, as a screen reader
+// would read it: each block on its own line, with the names of images and
+// buttons and the values of text fields in place of them.
+func Text(root *Node) string {
+	var lines []string
+	var line strings.Builder // Text of the current block, white space uncollapsed
+	flush := func() {
+		if text := collapse(line.String()); text != "" {
+			lines = append(lines, text)
+		}
+		line.Reset()
+	}
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		if n.block {
+			flush()
+		}
+		switch {
+		case n.Role == "text":
+			line.WriteString(n.DOM.Text) // Unseparated from the text around it
+		case n.Value != "":
+			line.WriteString(" " + n.Value + " ")
+		case len(n.Children) == 0 && n.Role != "document":
+			// Images and buttons without content, and labeled elements;
+			// a form control's label is already text of its own
+			switch n.Role {
+			case "textbox", "combobox", "listbox", "slider", "checkbox", "radio":
+			default:
+				line.WriteString(" " + n.Name + " ")
+			}
+		default:
+			for _, child := range n.Children {
+				walk(child)
+			}
+		}
+		if n.block {
+			flush()
+		}
+	}
+	walk(root)
+	flush()
+	return strings.Join(lines, "\n")
+}
+
+// Dump writes the tree to w, one node per line, indented by depth: the
+// role, then the name in quotes, the heading level, and the value.
+func Dump(w io.Writer, root *Node) error {
+	var dump func(n *Node, depth int) error
+	dump = func(n *Node, depth int) error {
+		line := strings.Repeat("  ", depth) + n.Role
+		if n.Name != "" {
+			line += fmt.Sprintf(" %q", n.Name)
+		}
+		if n.Level > 0 {
+			line += fmt.Sprintf(" level=%d", n.Level)
+		}
+		if n.Value != "" {
+			line += fmt.Sprintf(" value=%q", n.Value)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+		for _, child := range n.Children {
+			if err := dump(child, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return dump(root, 0)
+}
+
+// collapse collapses runs of white space in s to single spaces and trims it.
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// findElement returns the first element with the tag in n's subtree.
+func findElement(n *html.Node, tag string) *html.Node {
+	if n.Type == html.ElementNode && n.TagName == tag {
+		return n
+	}
+	for _, child := range n.Children {
+		if found := findElement(child, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package a11y
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"louis14/pkg/html"
+	"louis14/pkg/layout"
+)
+
+func build(t *testing.T, source string) *Node {
+	t.Helper()
+	doc, err := html.Parse(source)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes, err := layout.NewLayoutEngine(800, 600).Layout(context.Background(), doc)
+	if err != nil {
+		t.Fatalf("layout: %v", err)
+	}
+	return Build(doc, boxes)
+}
+
+func dump(t *testing.T, root *Node) string {
+	t.Helper()
+	var sb strings.Builder
+	if err := Dump(&sb, root); err != nil {
+		t.Fatal(err)
+	}
+	return sb.String()
+}
+
+func TestBuild_RolesAndNames(t *testing.T) {
+	root := build(t, `<html><head><title>The page</title></head><body>
+		<nav aria-label="Main"><ul><li><a href="/">Home</a></li></ul></nav>
+		<h1>Wel<em>come</em></h1>
+		<p>Some text <img src="x.png" alt="a photo"> and <img src="y.png" alt=""></p>
+		<label for="email">Email</label> <input id="email" value="me@example.com">
+		<label><input type="checkbox"> Subscribe</label>
+		<button title="ignored">Send</button> <input type="submit">
+		<h2 role="heading" aria-level="4" aria-labelledby="other">Hidden name</h2><span id="other">Labelled</span>
+	</body></html>`)
+	want := `document "The page"
+  navigation "Main"
+    list
+      listitem
+        link "Home"
+          text "Home"
+  heading "Welcome" level=1
+    text "Wel"
+    generic
+      text "come"
+  paragraph
+    text "Some text"
+    img "a photo"
+    text "and"
+  generic
+    text "Email"
+  textbox "Email" value="me@example.com"
+  generic
+    checkbox "Subscribe"
+    text "Subscribe"
+  button "Send"
+    text "Send"
+  button "Submit"
+  heading "Labelled" level=4
+    text "Hidden name"
+  generic
+    text "Labelled"
+`
+	if got := dump(t, root); got != want {
+		t.Errorf("tree:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestBuild_HiddenContent(t *testing.T) {
+	root := build(t, `<html><body>
+		<p>shown</p>
+		<p style="display:none">not displayed</p>
+		<p style="visibility:hidden">invisible</p>
+		<p aria-hidden="true">aria hidden</p>
+		<p hidden>hidden attribute</p>
+		<script>var notText = 1;</script>
+	</body></html>`)
+	if got, want := dump(t, root), "document\n  paragraph\n    text \"shown\"\n"; got != want {
+		t.Errorf("tree:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestText(t *testing.T) {
+	root := build(t, `<html><body>
+		<h1>Title</h1>
+		<p>First <b>bold</b>er paragraph,
+		   wrapped in the source.</p>
+		<div><span>Inline</span> text, <a href="#">link</a> <img src="x.png" alt="picture"></div>
+		<div>Name: <input value="Ada"> <input type="submit" value="Go"></div>
+		<ul><li>one</li><li>two</li></ul>
+	</body></html>`)
+	want := "Title\nFirst bolder paragraph, wrapped in the source.\nInline text, link picture\nName: Ada Go\none\ntwo"
+	if got := Text(root); got != want {
+		t.Errorf("text:\n%q\nwant:\n%q", got, want)
+	}
+}
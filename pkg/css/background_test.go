@@ -184,3 +184,48 @@ func TestParseInlineStyle_BackgroundImage(t *testing.T) {
 		t.Errorf("ParseInlineStyle background-image: got (%q, %v)", url, ok)
 	}
 }
+
+func TestParseBackgroundPosition_Keywords(t *testing.T) {
+	tests := []struct {
+		value        string
+		wantX, wantY float64 // resolved in a 200x100 area for a 20x10 image
+	}{
+		{"center", 90, 45},
+		{"right", 180, 45},
+		{"top", 90, 0},
+		{"bottom left", 0, 90},
+		{"25% 100%", 45, 90},
+		{"10px 50%", 10, 45},
+		{"right 10px bottom 20px", 170, 70},
+		{"left 10% top", 18, 0},
+		{"center top 5px", 90, 5},
+	}
+
+	for _, tt := range tests {
+		x, y := ParseBackgroundPosition(tt.value).Resolve(200, 100, 20, 10)
+		if x != tt.wantX || y != tt.wantY {
+			t.Errorf("ParseBackgroundPosition(%q) resolves to (%v, %v), want (%v, %v)", tt.value, x, y, tt.wantX, tt.wantY)
+		}
+	}
+}
+
+func TestExpandBackgroundShorthand_Size(t *testing.T) {
+	s := NewStyle()
+	expandShorthand(s, "background", "url(bg.png) center/cover no-repeat")
+
+	if pos, _ := s.Get("background-position"); pos != "center" {
+		t.Errorf("background-position: got %q", pos)
+	}
+	if size := s.GetBackgroundSize(); !size.Cover {
+		t.Errorf("expected background-size cover, got %+v", size)
+	}
+
+	s = NewStyle()
+	expandShorthand(s, "background", "url(bg.png) 0 0 / 50% auto repeat no-repeat")
+	if size := s.GetBackgroundSize(); size.Width != -50 || size.Height != 0 {
+		t.Errorf("expected background-size 50%% auto, got %+v", size)
+	}
+	if r := s.GetBackgroundRepeat(); r != BackgroundRepeatRepeatX {
+		t.Errorf("expected two-value repeat to map to repeat-x, got %q", r)
+	}
+}
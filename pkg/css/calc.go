@@ -0,0 +1,210 @@
+package css
+
+import (
+	"strconv"
+	"strings"
+)
+
+// LengthContext holds the sizes that relative lengths resolve against.
+type LengthContext struct {
+	FontSize       float64
+	RootFontSize   float64 // 0 means 16px
+	ViewportWidth  float64
+	ViewportHeight float64
+	// PercentBase is the size percentages refer to, such as the containing
+	// block's width. Percentages are invalid unless HasPercentBase is set.
+	PercentBase    float64
+	HasPercentBase bool
+}
+
+// ParseLengthPercentage parses a length, a percentage of ctx.PercentBase,
+// or a calc() expression combining them.
+func ParseLengthPercentage(val string, ctx LengthContext) (float64, bool) {
+	val = strings.TrimSpace(val)
+	if isCalc(val) {
+		return evalCalc(val, ctx)
+	}
+	if pct, ok := ParsePercentage(val); ok {
+		if !ctx.HasPercentBase {
+			return 0, false
+		}
+		return pct * ctx.PercentBase / 100, true
+	}
+	return parseLength(val, ctx)
+}
+
+// rootFontSize returns the font size rem units refer to.
+func (ctx LengthContext) rootFontSize() float64 {
+	if ctx.RootFontSize > 0 {
+		return ctx.RootFontSize
+	}
+	return 16.0
+}
+
+// GetLengthPercentage returns a length property, resolving percentages,
+// including those inside calc(), against base.
+func (s *Style) GetLengthPercentage(property string, base float64) (float64, bool) {
+	val, ok := s.Get(property)
+	if !ok {
+		return 0, false
+	}
+	ctx := s.lengthContext()
+	ctx.PercentBase, ctx.HasPercentBase = base, true
+	return ParseLengthPercentage(val, ctx)
+}
+
+// isCalc returns true if val is a calc() expression.
+func isCalc(val string) bool {
+	return strings.HasPrefix(val, "calc(") && strings.HasSuffix(val, ")")
+}
+
+// evalCalc evaluates a calc() expression (CSS Values 3 §8.1) with the usual
+// operator precedence: * and / before + and -. Nested calc() is treated as
+// parentheses.
+func evalCalc(val string, ctx LengthContext) (float64, bool) {
+	tokens := tokenizeCalc(val[len("calc(") : len(val)-1])
+	if len(tokens) == 0 {
+		return 0, false
+	}
+	p := &calcParser{tokens: tokens, ctx: ctx}
+	result, ok := p.sum()
+	if !ok || p.pos != len(tokens) {
+		return 0, false
+	}
+	return result, true
+}
+
+// calcParser is a recursive descent parser over calc() tokens.
+type calcParser struct {
+	tokens []string
+	pos    int
+	ctx    LengthContext
+}
+
+// peek returns the next token, or "" at the end.
+func (p *calcParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+// sum parses terms joined by + and -.
+func (p *calcParser) sum() (float64, bool) {
+	left, ok := p.product()
+	if !ok {
+		return 0, false
+	}
+	for op := p.peek(); op == "+" || op == "-"; op = p.peek() {
+		p.pos++
+		right, ok := p.product()
+		if !ok {
+			return 0, false
+		}
+		if op == "+" {
+			left += right
+		} else {
+			left -= right
+		}
+	}
+	return left, true
+}
+
+// product parses values joined by * and /.
+func (p *calcParser) product() (float64, bool) {
+	left, ok := p.value()
+	if !ok {
+		return 0, false
+	}
+	for op := p.peek(); op == "*" || op == "/"; op = p.peek() {
+		p.pos++
+		right, ok := p.value()
+		if !ok {
+			return 0, false
+		}
+		if op == "*" {
+			left *= right
+		} else {
+			if right == 0 {
+				return 0, false
+			}
+			left /= right
+		}
+	}
+	return left, true
+}
+
+// value parses a parenthesized expression, a length or percentage, or a
+// plain number (a multiplier or divisor).
+func (p *calcParser) value() (float64, bool) {
+	token := p.peek()
+	if token == "" {
+		return 0, false
+	}
+	p.pos++
+	if token == "(" {
+		result, ok := p.sum()
+		if !ok || p.peek() != ")" {
+			return 0, false
+		}
+		p.pos++
+		return result, true
+	}
+	if v, ok := ParseLengthPercentage(token, p.ctx); ok {
+		return v, true
+	}
+	num, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		return 0, false
+	}
+	return num, true
+}
+
+// tokenizeCalc splits a calc expression into tokens: numbers with units,
+// operators, and parentheses.
+func tokenizeCalc(expr string) []string {
+	var tokens []string
+	i := 0
+	for i < len(expr) {
+		ch := expr[i]
+		if ch == ' ' || ch == '\t' || ch == '\n' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(expr[i:], "calc(") {
+			i += len("calc") // A nested calc() is a parenthesized expression
+			continue
+		}
+		if ch == '(' || ch == ')' || ch == '+' || ch == '*' || ch == '/' {
+			tokens = append(tokens, string(ch))
+			i++
+			continue
+		}
+		// Minus is an operator after a value; otherwise it's a negative sign
+		if ch == '-' && len(tokens) > 0 {
+			prev := tokens[len(tokens)-1]
+			if prev != "+" && prev != "-" && prev != "*" && prev != "/" && prev != "(" {
+				tokens = append(tokens, "-")
+				i++
+				continue
+			}
+		}
+		// Number, possibly with a unit suffix (px, em, rem, %, etc.)
+		start := i
+		if expr[i] == '-' || expr[i] == '+' {
+			i++
+		}
+		for i < len(expr) && ((expr[i] >= '0' && expr[i] <= '9') || expr[i] == '.') {
+			i++
+		}
+		for i < len(expr) && ((expr[i] >= 'a' && expr[i] <= 'z') || (expr[i] >= 'A' && expr[i] <= 'Z') || expr[i] == '%') {
+			i++
+		}
+		if i == start {
+			i++ // Unknown character, skip
+			continue
+		}
+		tokens = append(tokens, strings.ToLower(expr[start:i]))
+	}
+	return tokens
+}
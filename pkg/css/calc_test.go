@@ -0,0 +1,55 @@
+package css
+
+import "testing"
+
+func TestParseLengthPercentage_Calc(t *testing.T) {
+	ctx := LengthContext{FontSize: 16, ViewportWidth: 800, ViewportHeight: 600, PercentBase: 200, HasPercentBase: true}
+	tests := []struct {
+		value string
+		want  float64
+	}{
+		{"calc(100% - 40px)", 160},
+		{"calc(1em + 2px)", 18},
+		{"calc(2 * (10px + 5px))", 30},
+		{"calc(100px / 4 - 5px)", 20},
+		{"calc(50% + calc(10vw - 20px))", 160},
+		{"calc(-10px + 30px)", 20},
+		{"25%", 50},
+		{"12px", 12},
+	}
+	for _, tt := range tests {
+		got, ok := ParseLengthPercentage(tt.value, ctx)
+		if !ok || got != tt.want {
+			t.Errorf("ParseLengthPercentage(%q) = %v, %v; want %v", tt.value, got, ok, tt.want)
+		}
+	}
+}
+
+func TestParseLengthPercentage_Invalid(t *testing.T) {
+	for _, value := range []string{"calc(10px +)", "calc((10px)", "calc(10px / 0)", "calc()"} {
+		if _, ok := ParseLengthPercentage(value, LengthContext{FontSize: 16}); ok {
+			t.Errorf("expected %q to be invalid", value)
+		}
+	}
+	// Percentages need a base
+	if _, ok := ParseLengthPercentage("calc(100% - 40px)", LengthContext{FontSize: 16}); ok {
+		t.Error("expected percentage without a base to be invalid")
+	}
+}
+
+func TestGetLengthPercentage_Calc(t *testing.T) {
+	style := ParseInlineStyle("width: calc(100% - 40px)")
+	if _, ok := style.GetLength("width"); ok {
+		t.Error("expected GetLength to reject a percentage calc()")
+	}
+	if w, ok := style.GetLengthPercentage("width", 500); !ok || w != 460 {
+		t.Errorf("expected width=460, got %v", w)
+	}
+}
+
+func TestExpandMargin_Calc(t *testing.T) {
+	style := ParseInlineStyle("margin: calc(1em + 2px) 5px")
+	if m := style.GetMargin(); m.Top != 18 || m.Bottom != 18 || m.Left != 5 || m.Right != 5 {
+		t.Errorf("expected margin 18/5/18/5, got %+v", m)
+	}
+}
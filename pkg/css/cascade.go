@@ -37,7 +37,7 @@ func applyUserAgentStyles(node *html.Node, style *Style) {
 	// Non-rendered elements should be hidden by default
 	// Author CSS can override this (e.g., Acid2 sets display:block on head)
 	switch node.TagName {
-	case "head", "style", "script", "meta", "title", "link", "base":
+	case "head", "style", "script", "meta", "title", "link", "base", "template":
 		style.Set("display", "none")
 	}
 
@@ -57,6 +57,22 @@ func applyUserAgentStyles(node *html.Node, style *Style) {
 		}
 	}
 
+	// HTML §15.3.5: The dir attribute sets the element's direction and
+	// isolates its content; bdo overrides the bidi algorithm
+	if dir, ok := node.GetAttribute("dir"); ok {
+		switch dir = strings.ToLower(dir); dir {
+		case "ltr", "rtl":
+			style.Set("direction", dir)
+			style.Set("unicode-bidi", "isolate")
+		}
+	}
+	switch node.TagName {
+	case "bdi":
+		style.Set("unicode-bidi", "isolate")
+	case "bdo":
+		style.Set("unicode-bidi", "isolate-override")
+	}
+
 	// Default font-style for emphasis elements
 	switch node.TagName {
 	case "em", "i", "cite", "dfn", "var":
@@ -79,13 +95,15 @@ func applyUserAgentStyles(node *html.Node, style *Style) {
 	switch node.TagName {
 	case "span", "em", "strong", "b", "i", "u", "s", "a", "abbr", "cite",
 		"code", "dfn", "kbd", "mark", "q", "samp", "small", "sub", "sup",
-		"var", "time", "label", "br", "wbr", "img", "object":
+		"var", "time", "label", "br", "wbr", "img", "object", "bdi", "bdo", "svg":
 		if _, ok := style.Get("display"); !ok {
 			style.Set("display", "inline")
 		}
 	}
 
-	// Default styles for form elements — rendered as simple boxes.
+	// Default styles for form elements. Widths and heights are left unset
+	// here; layout gives controls without an author size their intrinsic
+	// size (from size, cols and rows, the label, or the longest option).
 	// Note: must use individual properties (not shorthands like "border" or "padding")
 	// because style.Set() does not expand shorthands.
 	switch node.TagName {
@@ -93,11 +111,9 @@ func applyUserAgentStyles(node *html.Node, style *Style) {
 		if _, ok := style.Get("display"); !ok {
 			style.Set("display", "inline-block")
 		}
-		inputType, _ := node.GetAttribute("type")
-		if inputType == "" {
-			inputType = "text"
-		}
-		switch inputType {
+		switch node.InputType() {
+		case "hidden":
+			style.Set("display", "none")
 		case "checkbox", "radio":
 			if _, ok := style.Get("width"); !ok {
 				style.Set("width", "13px")
@@ -109,14 +125,13 @@ func applyUserAgentStyles(node *html.Node, style *Style) {
 			if _, ok := style.Get("background-color"); !ok {
 				style.Set("background-color", "white")
 			}
+			if node.InputType() == "radio" {
+				style.Set("border-radius", "50%")
+			}
+		case "button", "submit", "reset":
+			setButtonStyle(style)
 		default:
 			// text, password, email, number, search, etc.
-			if _, ok := style.Get("width"); !ok {
-				style.Set("width", "173px")
-			}
-			if _, ok := style.Get("height"); !ok {
-				style.Set("height", "19px")
-			}
 			setFormPadding(style, "1px", "2px", "1px", "2px")
 			setFormBorder(style, "2px", "solid", "#767676")
 			if _, ok := style.Get("background-color"); !ok {
@@ -131,12 +146,6 @@ func applyUserAgentStyles(node *html.Node, style *Style) {
 		if _, ok := style.Get("display"); !ok {
 			style.Set("display", "inline-block")
 		}
-		if _, ok := style.Get("width"); !ok {
-			style.Set("width", "173px")
-		}
-		if _, ok := style.Get("height"); !ok {
-			style.Set("height", "54px")
-		}
 		setFormPadding(style, "2px", "2px", "2px", "2px")
 		setFormBorder(style, "1px", "solid", "#767676")
 		if _, ok := style.Get("background-color"); !ok {
@@ -146,17 +155,12 @@ func applyUserAgentStyles(node *html.Node, style *Style) {
 			style.Set("font-size", "13.3333px")
 		}
 		style.Set("font-family", "monospace")
+		style.Set("white-space", "pre-wrap")
 		style.Set("overflow", "hidden")
 	case "select":
 		if _, ok := style.Get("display"); !ok {
 			style.Set("display", "inline-block")
 		}
-		if _, ok := style.Get("width"); !ok {
-			style.Set("width", "173px")
-		}
-		if _, ok := style.Get("height"); !ok {
-			style.Set("height", "19px")
-		}
 		setFormPadding(style, "1px", "2px", "1px", "2px")
 		setFormBorder(style, "1px", "solid", "#767676")
 		if _, ok := style.Get("background-color"); !ok {
@@ -166,21 +170,19 @@ func applyUserAgentStyles(node *html.Node, style *Style) {
 			style.Set("font-size", "13.3333px")
 		}
 		style.Set("overflow", "hidden")
+	case "option", "optgroup":
+		// The select box paints its selected option itself
+		if node.Parent != nil && node.Parent.TagName == "select" ||
+			node.Parent != nil && node.Parent.Parent != nil && node.Parent.Parent.TagName == "select" {
+			style.Set("display", "none")
+		}
+	case "datalist":
+		style.Set("display", "none")
 	case "button":
 		if _, ok := style.Get("display"); !ok {
 			style.Set("display", "inline-block")
 		}
-		setFormPadding(style, "1px", "6px", "1px", "6px")
-		setFormBorder(style, "2px", "solid", "#767676")
-		if _, ok := style.Get("background-color"); !ok {
-			style.Set("background-color", "#efefef")
-		}
-		if _, ok := style.Get("font-size"); !ok {
-			style.Set("font-size", "13.3333px")
-		}
-		if _, ok := style.Get("text-align"); !ok {
-			style.Set("text-align", "center")
-		}
+		setButtonStyle(style)
 	}
 
 	// Phase 23: Default styles for table elements
@@ -195,6 +197,13 @@ func applyUserAgentStyles(node *html.Node, style *Style) {
 		style.Set("display", "table-row-group")
 	case "tfoot":
 		style.Set("display", "table-footer-group")
+	case "colgroup":
+		style.Set("display", "table-column-group")
+	case "col":
+		style.Set("display", "table-column")
+	case "caption":
+		style.Set("display", "table-caption")
+		style.Set("text-align", "center")
 	case "tr":
 		style.Set("display", "table-row")
 	case "td":
@@ -221,29 +230,60 @@ func applyUserAgentStyles(node *html.Node, style *Style) {
 		style.Set("margin-bottom", "16px")
 		style.Set("padding-left", "40px")
 		style.Set("list-style-type", "decimal")
+		if t, ok := listTypeAttribute(node); ok {
+			style.Set("list-style-type", t)
+		}
 	case "li":
 		style.Set("display", "list-item")
+		if t, ok := listTypeAttribute(node); ok {
+			style.Set("list-style-type", t)
+		}
 	}
 }
 
-// ComputeStyle computes the final style for a node by applying the cascade
-// Phase 22: Added viewport dimensions for media query evaluation
-func ComputeStyle(node *html.Node, stylesheets []*Stylesheet, viewportWidth, viewportHeight float64) *Style {
-	finalStyle := NewStyle()
-
-	// Phase 17: Apply user agent (default browser) styles first
-	applyUserAgentStyles(node, finalStyle)
+// listTypeAttribute maps the type attribute of an ol or li to its
+// list-style-type (HTML §15.3.8). The values are case-sensitive.
+func listTypeAttribute(node *html.Node) (string, bool) {
+	switch node.Attributes["type"] {
+	case "1":
+		return "decimal", true
+	case "a":
+		return "lower-alpha", true
+	case "A":
+		return "upper-alpha", true
+	case "i":
+		return "lower-roman", true
+	case "I":
+		return "upper-roman", true
+	}
+	return "", false
+}
 
+// ComputeStyle computes the final style for a node by applying the cascade
+// Phase 22: media is the device @media queries are evaluated against
+func ComputeStyle(node *html.Node, stylesheets []*Stylesheet, media Media) *Style {
 	// Collect all matching rules from all stylesheets
 	allRules := make([]Rule, 0)
 
 	for _, stylesheet := range stylesheets {
-		matches := FindMatchingRules(node, stylesheet, viewportWidth, viewportHeight)
+		matches := FindMatchingRules(node, stylesheet, media)
 		allRules = append(allRules, matches...)
 	}
 
-	// Sort rules by specificity (lowest first)
-	sort.Slice(allRules, func(i, j int) bool {
+	return cascadeRules(node, allRules, media)
+}
+
+// cascadeRules computes the style of a node from the user agent styles,
+// the rules matching it in source order, and its inline style.
+func cascadeRules(node *html.Node, allRules []Rule, media Media) *Style {
+	finalStyle := NewStyle()
+
+	// Phase 17: Apply user agent (default browser) styles first
+	applyUserAgentStyles(node, finalStyle)
+
+	// Sort rules by specificity (lowest first), keeping rules of equal
+	// specificity in source order so the later one wins (CSS 2.1 §6.4.1)
+	sort.SliceStable(allRules, func(i, j int) bool {
 		return allRules[i].Selector.Specificity < allRules[j].Selector.Specificity
 	})
 
@@ -286,15 +326,16 @@ func ComputeStyle(node *html.Node, stylesheets []*Stylesheet, viewportWidth, vie
 	}
 
 	// Store viewport dimensions for viewport unit resolution (vw, vh, vmin, vmax)
-	finalStyle.ViewportWidth = viewportWidth
-	finalStyle.ViewportHeight = viewportHeight
+	finalStyle.ViewportWidth = media.Width
+	finalStyle.ViewportHeight = media.Height
+	finalStyle.Fonts = media.Fonts
 
 	return finalStyle
 }
 
 // ApplyStylesToDocument applies stylesheets to all nodes in the document
-// Phase 22: Added viewport dimensions for media query evaluation
-func ApplyStylesToDocument(doc *html.Document, viewportWidth, viewportHeight float64) map[*html.Node]*Style {
+// Phase 22: media is the device @media queries are evaluated against
+func ApplyStylesToDocument(doc *html.Document, media Media) map[*html.Node]*Style {
 	styles := make(map[*html.Node]*Style)
 
 	// Parse all stylesheets
@@ -306,24 +347,24 @@ func ApplyStylesToDocument(doc *html.Document, viewportWidth, viewportHeight flo
 		}
 	}
 
-	// Recursively apply styles to all nodes
-	applyStylesToNode(doc.Root, stylesheets, styles, viewportWidth, viewportHeight)
+	// Recursively apply styles to all nodes, matching them against an
+	// index of the rules rather than every rule
+	applyStylesToNode(doc.Root, newRuleIndex(stylesheets, media), styles, media, nil)
 
 	return styles
 }
 
 // Phase 11: ComputePseudoElementStyle computes the style for a pseudo-element
-// Phase 22: Added viewport dimensions for media query evaluation
-func ComputePseudoElementStyle(node *html.Node, pseudoElement string, stylesheets []*Stylesheet, viewportWidth, viewportHeight float64, parentStyles ...*Style) *Style {
+// Phase 22: media is the device @media queries are evaluated against
+func ComputePseudoElementStyle(node *html.Node, pseudoElement string, stylesheets []*Stylesheet, media Media, parentStyles ...*Style) *Style {
 	finalStyle := NewStyle()
 
 	// Inherit inheritable properties from parent element
+	var parentStyle *Style
 	if len(parentStyles) > 0 && parentStyles[0] != nil {
-		inheritableProps := []string{"font-size", "font-family", "font-weight", "font-style",
-			"color", "line-height", "text-align", "white-space", "visibility",
-			"letter-spacing", "word-spacing", "text-indent", "text-transform"}
-		for _, prop := range inheritableProps {
-			if val, ok := parentStyles[0].Get(prop); ok {
+		parentStyle = parentStyles[0]
+		for prop := range inheritableProperties {
+			if val, ok := parentStyle.Get(prop); ok {
 				finalStyle.Set(prop, val)
 			}
 		}
@@ -335,7 +376,7 @@ func ComputePseudoElementStyle(node *html.Node, pseudoElement string, stylesheet
 	for _, stylesheet := range stylesheets {
 		for _, rule := range stylesheet.Rules {
 			// Phase 22: Check media query
-			if !EvaluateMediaQuery(rule.MediaQuery, viewportWidth, viewportHeight) {
+			if !EvaluateMediaQuery(rule.MediaQuery, media) {
 				continue
 			}
 
@@ -366,8 +407,8 @@ func ComputePseudoElementStyle(node *html.Node, pseudoElement string, stylesheet
 		}
 	}
 
-	// Sort rules by specificity
-	sort.Slice(allRules, func(i, j int) bool {
+	// Sort rules by specificity, keeping source order among equals
+	sort.SliceStable(allRules, func(i, j int) bool {
 		return allRules[i].Selector.Specificity < allRules[j].Selector.Specificity
 	})
 
@@ -398,31 +439,76 @@ func ComputePseudoElementStyle(node *html.Node, pseudoElement string, stylesheet
 		}
 	}
 
+	resolveCSSWideKeywords(finalStyle, parentStyle)
+	resolveCurrentColor(finalStyle, parentStyle)
+
+	// Pseudo-elements are inline unless a rule says otherwise
+	if _, ok := finalStyle.Get("display"); !ok {
+		finalStyle.Set("display", "inline")
+	}
+
 	// Store viewport dimensions for viewport unit resolution
-	finalStyle.ViewportWidth = viewportWidth
-	finalStyle.ViewportHeight = viewportHeight
+	finalStyle.ViewportWidth = media.Width
+	finalStyle.ViewportHeight = media.Height
+	finalStyle.Fonts = media.Fonts
 
 	return finalStyle
 }
 
-// resolveInheritValues resolves any "inherit" keyword values by copying from the parent's computed style.
-func resolveInheritValues(node *html.Node, style *Style, styles map[*html.Node]*Style) {
+// resolveCSSWideKeywords resolves the inherit, initial, and unset keywords
+// (CSS Cascade 4 §7.3) on any property. parentStyle is nil for the root.
+func resolveCSSWideKeywords(style, parentStyle *Style) {
 	for property, value := range style.Properties {
-		if value != "inherit" {
-			continue
+		keyword := strings.ToLower(strings.TrimSpace(value))
+		if keyword == "unset" {
+			// Inherited properties inherit, the rest are reset to their initial value
+			keyword = "initial"
+			if inheritableProperties[property] || strings.HasPrefix(property, "--") {
+				keyword = "inherit"
+			}
 		}
-		// Look up parent's computed style
-		if node.Parent != nil {
-			if parentStyle, ok := styles[node.Parent]; ok {
+		switch keyword {
+		case "inherit":
+			if parentStyle != nil {
 				if parentVal, ok := parentStyle.Get(property); ok {
 					style.Set(property, parentVal)
 					continue
 				}
 			}
+		case "initial":
+		default:
+			continue
+		}
+		// Without a parent value the property takes its initial value. An
+		// inherited property must hold it explicitly or the parent's would be
+		// inherited; the rest fall back to their default when absent.
+		if initial, ok := initialValues[property]; ok {
+			style.Set(property, initial)
+		} else {
+			delete(style.Properties, property)
+		}
+	}
+}
+
+// resolveCurrentColor resolves the currentcolor keyword (CSS Color 4 §6.4).
+// On the color property it is the parent's color (black on the root); on any
+// other property it is the element's own color. parentStyle is nil for the
+// root.
+func resolveCurrentColor(style, parentStyle *Style) {
+	if value, ok := style.Get("color"); ok && isCurrentColor(value) {
+		parentColor := initialValues["color"]
+		if parentStyle != nil {
+			if parentVal, ok := parentStyle.Get("color"); ok {
+				parentColor = parentVal
+			}
+		}
+		style.Set("color", parentColor)
+	}
+	resolved := formatColor(style.currentColor())
+	for property, value := range style.Properties {
+		if property != "color" && !strings.HasPrefix(property, "--") && isCurrentColor(value) {
+			style.Properties[property] = resolved
 		}
-		// No parent or parent doesn't have the property: remove the inherit value
-		// so the property falls back to its default
-		delete(style.Properties, property)
 	}
 }
 
@@ -430,36 +516,64 @@ func resolveInheritValues(node *html.Node, style *Style, styles map[*html.Node]*
 var inheritableProperties = map[string]bool{
 	"color": true, "font-family": true, "font-size": true,
 	"font-style": true, "font-weight": true, "font-variant": true,
-	"line-height": true, "text-align": true, "text-decoration": true,
+	"font-stretch": true, "line-height": true, "text-align": true,
+	"text-align-last": true, "text-decoration": true, "text-shadow": true,
 	"text-transform": true, "text-indent": true, "white-space": true,
-	"visibility": true, "list-style-type": true, "list-style-position": true,
-	"direction": true, "letter-spacing": true, "word-spacing": true,
-	"cursor": true,
+	"word-break": true, "overflow-wrap": true, "word-wrap": true,
+	"hyphens": true, "tab-size": true, "visibility": true,
+	"list-style-type": true, "list-style-position": true, "list-style-image": true,
+	"quotes": true, "direction": true, "writing-mode": true,
+	"letter-spacing": true, "word-spacing": true, "cursor": true,
+	"border-collapse": true, "border-spacing": true, "caption-side": true,
+	"empty-cells": true, "orphans": true, "widows": true,
+}
+
+// IsInheritedProperty reports whether property inherits by default.
+func IsInheritedProperty(property string) bool {
+	return inheritableProperties[property]
+}
+
+// initialValues holds the initial values of the inherited properties, which
+// "initial" sets explicitly so that the parent's value is not inherited.
+var initialValues = map[string]string{
+	"color": "black", "font-family": "serif", "font-size": "16px",
+	"font-style": "normal", "font-weight": "normal", "font-variant": "normal",
+	"font-stretch": "normal", "line-height": "normal", "text-align": "start",
+	"text-align-last": "auto", "text-decoration": "none", "text-shadow": "none",
+	"text-transform": "none", "text-indent": "0", "white-space": "normal",
+	"word-break": "normal", "overflow-wrap": "normal", "word-wrap": "normal",
+	"hyphens": "manual", "tab-size": "8", "visibility": "visible",
+	"list-style-type": "disc", "list-style-position": "outside", "list-style-image": "none",
+	"quotes": "auto", "direction": "ltr", "writing-mode": "horizontal-tb",
+	"letter-spacing": "normal", "word-spacing": "normal", "cursor": "auto",
+	"border-collapse": "separate", "border-spacing": "0", "caption-side": "top",
+	"empty-cells": "show", "orphans": "2", "widows": "2",
 }
 
 // ApplyInheritedProperties copies inheritable properties from parent if not set on child.
-// Also resolves font-size em values using parent's computed font-size.
+// Also resolves relative font-size values using parent's computed font-size.
 // ApplyInheritedProperties applies inherited CSS properties from parent to child
 func ApplyInheritedProperties(node *html.Node, style *Style, styles map[*html.Node]*Style) {
-	if node.Parent == nil {
-		return
-	}
-	parentStyle, ok := styles[node.Parent]
-	if !ok {
-		return
+	// Lengths and percentages in line-height inherit as absolute lengths
+	defer resolveLineHeight(style)
+
+	var parentStyle *Style
+	if node.Parent != nil {
+		parentStyle = styles[node.Parent]
 	}
+	defer resolveCurrentColor(style, parentStyle)
 
-	// Resolve font-size em values using parent's font-size
-	if fsVal, hasFontSize := style.Get("font-size"); hasFontSize {
-		if strings.HasSuffix(strings.TrimSpace(fsVal), "em") {
-			parentFS := 16.0
-			if parentStyle != nil {
-				parentFS = parentStyle.GetFontSize()
-			}
-			if resolved, ok := ParseLengthWithFontSize(fsVal, parentFS); ok {
-				style.Set("font-size", fmt.Sprintf("%.6gpx", resolved))
-			}
-		}
+	// Resolve font-size using parent's font-size. rem units refer to the
+	// root element's font size, or the initial 16px on the root itself.
+	parentFS := 16.0
+	if parentStyle != nil {
+		parentFS = parentStyle.GetFontSize()
+		style.RootFontSize = parentStyle.RootFontSize
+	}
+	resolveFontSize(style, parentFS)
+	if parentStyle == nil {
+		style.RootFontSize = style.GetFontSize()
+		return
 	}
 
 	for prop := range inheritableProperties {
@@ -480,18 +594,94 @@ func ApplyInheritedProperties(node *html.Node, style *Style, styles map[*html.No
 	}
 }
 
-// applyStylesToNode recursively applies styles to a node and its children
-func applyStylesToNode(node *html.Node, stylesheets []*Stylesheet, styles map[*html.Node]*Style, viewportWidth, viewportHeight float64) {
+// AnonymousStyle returns the style of an anonymous box with the given
+// display inside a box with the parent style: inherited properties take
+// the parent's values and the rest keep their initial values (CSS 2.1
+// §9.2.1.1, §17.2.1).
+func AnonymousStyle(parent *Style, display DisplayType) *Style {
+	style := NewStyle()
+	if parent != nil {
+		style.ViewportWidth, style.ViewportHeight, style.RootFontSize = parent.ViewportWidth, parent.ViewportHeight, parent.RootFontSize
+		style.Fonts = parent.Fonts
+		for prop, val := range parent.Properties {
+			if inheritableProperties[prop] || strings.HasPrefix(prop, "--") {
+				style.Properties[prop] = val
+			}
+		}
+	}
+	style.Set("display", string(display))
+	return style
+}
+
+// resolveFontSize replaces a font-size in relative units (em, rem, %,
+// viewport units, calc()) with the pixel size it computes to.
+func resolveFontSize(style *Style, parentFS float64) {
+	val, ok := style.Get("font-size")
+	if !ok {
+		return
+	}
+	ctx := LengthContext{
+		FontSize:       parentFS,
+		RootFontSize:   style.RootFontSize,
+		ViewportWidth:  style.ViewportWidth,
+		ViewportHeight: style.ViewportHeight,
+		PercentBase:    parentFS,
+		HasPercentBase: true,
+	}
+	if size, ok := ParseLengthPercentage(val, ctx); ok {
+		style.Set("font-size", fmt.Sprintf("%.6gpx", size))
+	}
+}
+
+// resolveLineHeight replaces a line-height length or percentage with the
+// absolute length it computes to, so descendants inherit the length rather
+// than recomputing it with their own font-size. Unitless numbers and
+// "normal" are inherited as specified (CSS 2.1 §10.8.1).
+func resolveLineHeight(style *Style) {
+	val, ok := style.Get("line-height")
+	if !ok {
+		return
+	}
+	if _, isLength := style.GetLength("line-height"); !isLength {
+		if _, isPercentage := ParsePercentage(val); !isPercentage {
+			return
+		}
+	}
+	style.Set("line-height", fmt.Sprintf("%.6gpx", style.GetLineHeight()))
+}
+
+// applyStylesToNode recursively applies styles to a node and its children.
+// shared holds the styles computed for the node's earlier siblings by
+// styleShareKey; a sibling with the same key gets a copy of its style
+// without running the cascade again.
+func applyStylesToNode(node *html.Node, index *ruleIndex, styles map[*html.Node]*Style, media Media, shared map[string]*Style) {
 	if node.Type == html.ElementNode && node.TagName != "document" {
-		style := ComputeStyle(node, stylesheets, viewportWidth, viewportHeight)
-		resolveInheritValues(node, style, styles)
-		ApplyInheritedProperties(node, style, styles)
-		styles[node] = style
+		matched := index.match(node)
+		key := ""
+		if shared != nil {
+			key = styleShareKey(node, matched)
+		}
+		if style, ok := shared[key]; ok {
+			// A copy, as layout adjusts some computed styles in place
+			styles[node] = style.Clone()
+		} else {
+			style := cascadeRules(node, index.rulesAt(matched), media)
+			resolveCSSWideKeywords(style, styles[node.Parent])
+			ApplyInheritedProperties(node, style, styles)
+			styles[node] = style
+			if shared != nil {
+				shared[key] = style
+			}
+		}
 	}
 
 	// Always traverse children (parent is already computed, so top-down order is maintained)
+	var siblings map[string]*Style
+	if len(node.Children) > 1 {
+		siblings = make(map[string]*Style)
+	}
 	for _, child := range node.Children {
-		applyStylesToNode(child, stylesheets, styles, viewportWidth, viewportHeight)
+		applyStylesToNode(child, index, styles, media, siblings)
 	}
 }
 
@@ -511,6 +701,21 @@ func setFormBorder(style *Style, width, borderStyle, color string) {
 	}
 }
 
+// setButtonStyle sets the UA styles shared by <button> and button-type inputs.
+func setButtonStyle(style *Style) {
+	setFormPadding(style, "1px", "6px", "1px", "6px")
+	setFormBorder(style, "2px", "solid", "#767676")
+	if _, ok := style.Get("background-color"); !ok {
+		style.Set("background-color", "#efefef")
+	}
+	if _, ok := style.Get("font-size"); !ok {
+		style.Set("font-size", "13.3333px")
+	}
+	if _, ok := style.Get("text-align"); !ok {
+		style.Set("text-align", "center")
+	}
+}
+
 // setFormPadding sets individual padding properties for form element UA styles.
 func setFormPadding(style *Style, top, right, bottom, left string) {
 	if _, ok := style.Get("padding-top"); !ok {
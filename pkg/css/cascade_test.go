@@ -1,7 +1,9 @@
 package css
 
 import (
+	"fmt"
 	"louis14/pkg/html"
+	"strings"
 	"testing"
 )
 
@@ -14,7 +16,7 @@ func TestComputeStyle_ElementSelector(t *testing.T) {
 		TagName: "div",
 	}
 
-	style := ComputeStyle(node, stylesheets, 800, 600)
+	style := ComputeStyle(node, stylesheets, Media{Width: 800, Height: 600})
 
 	if color, ok := style.Get("color"); !ok || color != "red" {
 		t.Errorf("expected color='red', got '%s'", color)
@@ -36,7 +38,7 @@ func TestComputeStyle_SpecificityOverride(t *testing.T) {
 		},
 	}
 
-	style := ComputeStyle(node, stylesheets, 800, 600)
+	style := ComputeStyle(node, stylesheets, Media{Width: 800, Height: 600})
 
 	// Class selector (.highlight) should override element selector (div)
 	if color, ok := style.Get("color"); !ok || color != "blue" {
@@ -44,6 +46,32 @@ func TestComputeStyle_SpecificityOverride(t *testing.T) {
 	}
 }
 
+func TestComputeStyle_SourceOrderBreaksTies(t *testing.T) {
+	// Enough rules of mixed specificity that an unstable sort reorders them
+	var b strings.Builder
+	for i := 1; i <= 40; i++ {
+		fmt.Fprintf(&b, ".highlight { color: rgb(%d, 0, 0); }\ndiv { margin-top: %dpx; }\n", i, i)
+	}
+	stylesheet, _ := ParseStylesheet(b.String())
+	stylesheets := []*Stylesheet{stylesheet}
+
+	node := &html.Node{
+		Type:       html.ElementNode,
+		TagName:    "div",
+		Attributes: map[string]string{"class": "highlight"},
+	}
+
+	style := ComputeStyle(node, stylesheets, Media{Width: 800, Height: 600})
+
+	// The last of the rules with equal specificity wins
+	if color, _ := style.Get("color"); color != "rgb(40, 0, 0)" {
+		t.Errorf("expected the last .highlight rule's color, got '%s'", color)
+	}
+	if margin, _ := style.Get("margin-top"); margin != "40px" {
+		t.Errorf("expected the last div rule's margin, got '%s'", margin)
+	}
+}
+
 func TestComputeStyle_IDHasHighestSpecificity(t *testing.T) {
 	stylesheet, _ := ParseStylesheet(`
 		div { color: red; }
@@ -61,7 +89,7 @@ func TestComputeStyle_IDHasHighestSpecificity(t *testing.T) {
 		},
 	}
 
-	style := ComputeStyle(node, stylesheets, 800, 600)
+	style := ComputeStyle(node, stylesheets, Media{Width: 800, Height: 600})
 
 	// ID selector should override both class and element
 	if color, ok := style.Get("color"); !ok || color != "green" {
@@ -87,7 +115,7 @@ func TestComputeStyle_InlineStyleOverridesAll(t *testing.T) {
 		},
 	}
 
-	style := ComputeStyle(node, stylesheets, 800, 600)
+	style := ComputeStyle(node, stylesheets, Media{Width: 800, Height: 600})
 
 	// Inline style should override everything
 	if color, ok := style.Get("color"); !ok || color != "purple" {
@@ -110,7 +138,7 @@ func TestComputeStyle_MultipleProperties(t *testing.T) {
 		},
 	}
 
-	style := ComputeStyle(node, stylesheets, 800, 600)
+	style := ComputeStyle(node, stylesheets, Media{Width: 800, Height: 600})
 
 	// Should have color from .highlight (overrides div)
 	if color, ok := style.Get("color"); !ok || color != "blue" {
@@ -139,7 +167,7 @@ func TestApplyStylesToDocument(t *testing.T) {
 	`)
 
 	// Phase 22: Pass viewport dimensions for media query evaluation
-	styles := ApplyStylesToDocument(doc, 800, 600)
+	styles := ApplyStylesToDocument(doc, Media{Width: 800, Height: 600})
 
 	// Should have 2 styled nodes (the divs)
 	elementCount := 0
@@ -168,7 +196,7 @@ func TestInheritKeyword_FloatInherit(t *testing.T) {
 		<div class="parent"><div class="child"></div></div>
 	`)
 
-	styles := ApplyStylesToDocument(doc, 800, 600)
+	styles := ApplyStylesToDocument(doc, Media{Width: 800, Height: 600})
 
 	// Find child node
 	for node, style := range styles {
@@ -191,7 +219,7 @@ func TestInheritKeyword_ColorInherit(t *testing.T) {
 		<div class="parent"><span class="child"></span></div>
 	`)
 
-	styles := ApplyStylesToDocument(doc, 800, 600)
+	styles := ApplyStylesToDocument(doc, Media{Width: 800, Height: 600})
 
 	for node, style := range styles {
 		if cls, _ := node.GetAttribute("class"); cls == "child" {
@@ -210,7 +238,7 @@ func TestInheritKeyword_NoParentValue(t *testing.T) {
 		<div class="parent"><div class="child"></div></div>
 	`)
 
-	styles := ApplyStylesToDocument(doc, 800, 600)
+	styles := ApplyStylesToDocument(doc, Media{Width: 800, Height: 600})
 
 	for node, style := range styles {
 		if cls, _ := node.GetAttribute("class"); cls == "child" {
@@ -232,7 +260,7 @@ func TestInheritKeyword_DeepNesting(t *testing.T) {
 		<div class="grandparent"><div class="parent"><div class="child"></div></div></div>
 	`)
 
-	styles := ApplyStylesToDocument(doc, 800, 600)
+	styles := ApplyStylesToDocument(doc, Media{Width: 800, Height: 600})
 
 	for node, style := range styles {
 		if cls, _ := node.GetAttribute("class"); cls == "child" {
@@ -251,7 +279,7 @@ func TestInheritKeyword_InlineStyle(t *testing.T) {
 		<div class="parent"><div style="color: inherit"></div></div>
 	`)
 
-	styles := ApplyStylesToDocument(doc, 800, 600)
+	styles := ApplyStylesToDocument(doc, Media{Width: 800, Height: 600})
 
 	for node, style := range styles {
 		if node.Parent != nil {
@@ -263,3 +291,211 @@ func TestInheritKeyword_InlineStyle(t *testing.T) {
 		}
 	}
 }
+
+func TestInheritLineHeight(t *testing.T) {
+	doc, _ := html.Parse(`
+		<style>
+			div { font-size: 10px; }
+			span { font-size: 20px; }
+			.number { line-height: 1.5; }
+			.length { line-height: 2em; }
+			.percent { line-height: 150%; }
+		</style>
+		<div class="number"><span class="child"></span></div>
+		<div class="length"><span class="child"></span></div>
+		<div class="percent"><span class="child"></span></div>
+	`)
+
+	styles := ApplyStylesToDocument(doc, Media{Width: 800, Height: 600})
+
+	// Unitless numbers scale with the child's font-size; lengths and
+	// percentages inherit the parent's computed value
+	expect := map[string]float64{"number": 30, "length": 20, "percent": 15}
+	for node, style := range styles {
+		if cls, _ := node.GetAttribute("class"); cls == "child" {
+			parentClass, _ := node.Parent.GetAttribute("class")
+			if got := style.GetLineHeight(); got != expect[parentClass] {
+				t.Errorf("%s: expected line-height %v, got %v", parentClass, expect[parentClass], got)
+			}
+		}
+	}
+}
+
+func TestCSSWideKeywords(t *testing.T) {
+	doc, _ := html.Parse(`
+		<style>
+			.outer { color: red; border-top-width: 5px; white-space: pre; }
+			.inherit { border-top-width: inherit; }
+			.initial { color: initial; white-space: initial; }
+			.unset { color: unset; border-top-width: unset; }
+		</style>
+		<div class="outer">
+			<div><p id="nested"></p></div>
+			<p class="inherit"></p>
+			<p class="initial"></p>
+			<p class="unset"></p>
+		</div>
+	`)
+
+	styles := ApplyStylesToDocument(doc, Media{Width: 800, Height: 600})
+	byKey := make(map[string]*Style)
+	for node, style := range styles {
+		if id, ok := node.GetAttribute("id"); ok {
+			byKey[id] = style
+		} else if cls, ok := node.GetAttribute("class"); ok {
+			byKey[cls] = style
+		}
+	}
+
+	red := Color{255, 0, 0, 1.0}
+	black := Color{0, 0, 0, 1.0}
+	if got := byKey["nested"].GetColor(); got != red {
+		t.Errorf("nested: expected inherited red, got %v", got)
+	}
+	if got, _ := byKey["nested"].Get("white-space"); got != "pre" {
+		t.Errorf("nested: expected inherited white-space pre, got %q", got)
+	}
+	if got, _ := byKey["inherit"].Get("border-top-width"); got != "5px" {
+		t.Errorf("inherit: expected border-top-width 5px, got %q", got)
+	}
+	if got := byKey["initial"].GetColor(); got != black {
+		t.Errorf("initial: expected black, got %v", got)
+	}
+	if got, _ := byKey["initial"].Get("white-space"); got != "normal" {
+		t.Errorf("initial: expected white-space normal, got %q", got)
+	}
+	if got := byKey["unset"].GetColor(); got != red {
+		t.Errorf("unset: expected inherited red, got %v", got)
+	}
+	if _, ok := byKey["unset"].Get("border-top-width"); ok {
+		t.Error("unset: expected border-top-width to be reset")
+	}
+}
+
+func TestRelativeUnits_RemAndViewport(t *testing.T) {
+	doc, _ := html.Parse(`
+		<style>
+			html { font-size: 20px; }
+			div { font-size: 2rem; width: 10vw; height: 50vh; margin-left: 1.5rem; }
+			p { font-size: 50%; padding-left: 2vmin; }
+		</style>
+		<html><body><div><p></p></div></body></html>
+	`)
+
+	styles := ApplyStylesToDocument(doc, Media{Width: 800, Height: 600})
+	for node, style := range styles {
+		switch node.TagName {
+		case "div":
+			if got := style.GetFontSize(); got != 40 {
+				t.Errorf("div: expected font-size 40 (2rem), got %v", got)
+			}
+			if got := style.GetMargin().Left; got != 30 {
+				t.Errorf("div: expected margin-left 30 (1.5rem), got %v", got)
+			}
+			if got, _ := style.GetLength("width"); got != 80 {
+				t.Errorf("div: expected width 80 (10vw), got %v", got)
+			}
+			if got, _ := style.GetLength("height"); got != 300 {
+				t.Errorf("div: expected height 300 (50vh), got %v", got)
+			}
+		case "p":
+			if got := style.GetFontSize(); got != 20 {
+				t.Errorf("p: expected font-size 20 (50%% of 40), got %v", got)
+			}
+			if got := style.GetPadding().Left; got != 12 {
+				t.Errorf("p: expected padding-left 12 (2vmin), got %v", got)
+			}
+		}
+	}
+}
+
+func TestAnonymousStyle_InheritsOnlyInheritedProperties(t *testing.T) {
+	parent := NewStyle()
+	parent.RootFontSize = 20
+	parent.Set("color", "red")
+	parent.Set("font-size", "12px")
+	parent.Set("--accent", "blue")
+	parent.Set("border-top-width", "3px")
+	parent.Set("display", "flex")
+
+	style := AnonymousStyle(parent, DisplayBlock)
+	for prop, want := range map[string]string{"color": "red", "font-size": "12px", "--accent": "blue", "display": "block"} {
+		if got, _ := style.Get(prop); got != want {
+			t.Errorf("%s: expected %q, got %q", prop, want, got)
+		}
+	}
+	if _, ok := style.Get("border-top-width"); ok {
+		t.Error("expected border-top-width not to be inherited")
+	}
+	if style.RootFontSize != 20 {
+		t.Errorf("expected the root font size 20, got %v", style.RootFontSize)
+	}
+}
+
+// largeStyledDocument builds a page of many similar elements under a
+// stylesheet of many rules, as large pages have.
+func largeStyledDocument(rows, rules int) *html.Document {
+	var css, body strings.Builder
+	for i := 0; i < rules; i++ {
+		fmt.Fprintf(&css, ".c%d { margin-top: %dpx; }\n#i%d { color: red; }\nul.list li.c%d > span { color: blue; }\n", i, i, i, i)
+	}
+	css.WriteString("li:first-child { font-weight: bold; }\nli + li { border-top: 1px solid #ccc; }\n")
+	body.WriteString(`<ul class="list">`)
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(&body, `<li class="item c%d"><span>row</span> <a href="#r%d">link</a></li>`, i%10, i)
+	}
+	body.WriteString(`</ul>`)
+	doc, _ := html.Parse(`<html><head><style>` + css.String() + `</style></head><body>` + body.String() + `</body></html>`)
+	return doc
+}
+
+func TestApplyStylesToDocument_IndexAndSharingMatchFullCascade(t *testing.T) {
+	doc := largeStyledDocument(30, 12)
+	doc.Stylesheets = append(doc.Stylesheets, `
+		* { padding-left: 1px; }
+		.item.c3 { color: green; }
+		[href="#r7"] { color: purple; }
+		@media (max-width: 500px) { li { color: orange; } }
+		li:nth-child(2n) { background-color: #eee; }
+	`)
+	media := Media{Width: 800, Height: 600}
+	styles := ApplyStylesToDocument(doc, media)
+
+	// Every node gets the style the cascade computes from every rule
+	var stylesheets []*Stylesheet
+	for _, text := range doc.Stylesheets {
+		sheet, _ := ParseStylesheet(text)
+		stylesheets = append(stylesheets, sheet)
+	}
+	want := make(map[*html.Node]*Style)
+	seen := make(map[*Style]bool)
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.ElementNode && node.TagName != "document" {
+			style := ComputeStyle(node, stylesheets, media)
+			resolveCSSWideKeywords(style, want[node.Parent])
+			ApplyInheritedProperties(node, style, want)
+			want[node] = style
+			if !styles[node].Equal(style) {
+				t.Errorf("<%s class=%q>: expected %v, got %v", node.TagName, node.Attributes["class"], style.Properties, styles[node].Properties)
+			}
+			if seen[styles[node]] {
+				t.Errorf("<%s>: expected a style of its own, not one shared with a sibling", node.TagName)
+			}
+			seen[styles[node]] = true
+		}
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(doc.Root)
+}
+
+func BenchmarkApplyStylesToDocument(b *testing.B) {
+	doc := largeStyledDocument(500, 200)
+	media := Media{Width: 800, Height: 600}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ApplyStylesToDocument(doc, media)
+	}
+}
@@ -0,0 +1,119 @@
+package css
+
+import (
+	"louis14/pkg/html"
+	"testing"
+)
+
+func TestParseColor_Functions(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Color
+	}{
+		{"rgb(255, 0, 0)", Color{255, 0, 0, 1.0}},
+		{"rgba(0, 0, 255, 0.5)", Color{0, 0, 255, 0.5}},
+		{"rgb(100%, 50%, 0%)", Color{255, 128, 0, 1.0}},
+		{"rgb(0 128 0 / 25%)", Color{0, 128, 0, 0.25}},
+		{"rgba(300, -10, 0, 2)", Color{255, 0, 0, 1.0}},
+		{"hsl(120, 100%, 25%)", Color{0, 128, 0, 1.0}},
+		{"hsla(0, 100%, 50%, 0.5)", Color{255, 0, 0, 0.5}},
+		{"hsl(240deg 100% 50% / 0.75)", Color{0, 0, 255, 0.75}},
+		{"hsl(0.5turn, 100%, 50%)", Color{0, 255, 255, 1.0}},
+		{"RGB(0, 0, 0)", Color{0, 0, 0, 1.0}},
+	}
+	for _, tt := range tests {
+		got, ok := ParseColor(tt.value)
+		if !ok || got != tt.want {
+			t.Errorf("ParseColor(%q) = %v, %v; want %v", tt.value, got, ok, tt.want)
+		}
+	}
+}
+
+func TestParseColor_HexAlpha(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Color
+	}{
+		{"#f00", Color{255, 0, 0, 1.0}},
+		{"#0f08", Color{0, 255, 0, 136.0 / 255}},
+		{"#0000ff", Color{0, 0, 255, 1.0}},
+		{"#ff000080", Color{255, 0, 0, 128.0 / 255}},
+	}
+	for _, tt := range tests {
+		got, ok := ParseColor(tt.value)
+		if !ok || got != tt.want {
+			t.Errorf("ParseColor(%q) = %v, %v; want %v", tt.value, got, ok, tt.want)
+		}
+	}
+}
+
+func TestParseColor_ExtendedNamedColors(t *testing.T) {
+	tests := map[string]Color{
+		"rebeccapurple":        {102, 51, 153, 1.0},
+		"DarkSlateGray":        {47, 79, 79, 1.0},
+		"darkslategrey":        {47, 79, 79, 1.0},
+		"cornflowerblue":       {100, 149, 237, 1.0},
+		"lightgoldenrodyellow": {250, 250, 210, 1.0},
+		"yellowgreen":          {154, 205, 50, 1.0},
+	}
+	for name, want := range tests {
+		if got, ok := ParseColor(name); !ok || got != want {
+			t.Errorf("ParseColor(%q) = %v, %v; want %v", name, got, ok, want)
+		}
+	}
+	if len(namedColors) != 148 {
+		t.Errorf("expected the 148 CSS named colors, got %d", len(namedColors))
+	}
+}
+
+func TestParseColor_Invalid(t *testing.T) {
+	for _, value := range []string{"#ff", "#fffff", "#ggg", "rgb(1, 2)", "rgb(1 2 3 /)", "hsl(red, 1%, 1%)", "currentcolor", "'red'"} {
+		if color, ok := ParseColor(value); ok {
+			t.Errorf("expected %q to be rejected, got %v", value, color)
+		}
+	}
+}
+
+func TestCurrentColor_Cascade(t *testing.T) {
+	doc, _ := html.Parse(`
+		<style>
+			.parent { color: rgb(0, 0, 255); }
+			.child { color: currentcolor; background-color: currentColor; outline-color: currentcolor; }
+			.other { color: red; border: 2px solid currentcolor; }
+		</style>
+		<div class="parent"><span class="child"></span><span class="other"></span></div>
+	`)
+
+	styles := ApplyStylesToDocument(doc, Media{Width: 800, Height: 600})
+
+	for node, style := range styles {
+		switch cls, _ := node.GetAttribute("class"); cls {
+		case "child":
+			if color := style.GetColor(); color != (Color{0, 0, 255, 1.0}) {
+				t.Errorf("expected color: currentcolor to take the parent's color, got %v", color)
+			}
+			for _, property := range []string{"background-color", "outline-color"} {
+				val, _ := style.Get(property)
+				if color, ok := ParseColor(val); !ok || color != (Color{0, 0, 255, 1.0}) {
+					t.Errorf("expected %s to resolve to the element's color, got %q", property, val)
+				}
+			}
+		case "other":
+			val, _ := style.Get("border-left-color")
+			if color, ok := ParseColor(val); !ok || color != (Color{255, 0, 0, 1.0}) {
+				t.Errorf("expected the border color to resolve to red, got %q", val)
+			}
+		}
+	}
+}
+
+func TestParseInlineStyle_BorderShorthandFunctionalColor(t *testing.T) {
+	style := ParseInlineStyle("border: 1px solid rgb(0 0 0 / 50%)")
+	val, _ := style.Get("border-top-color")
+	if color, ok := ParseColor(val); !ok || color != (Color{0, 0, 0, 0.5}) {
+		t.Errorf("expected a half-transparent black border, got %q", val)
+	}
+	if width, _ := style.Get("border-top-width"); width != "1px" {
+		t.Errorf("expected border width 1px, got %q", width)
+	}
+}
@@ -0,0 +1,165 @@
+package css
+
+import (
+	"strings"
+)
+
+// FontFace represents an @font-face rule (CSS Fonts 3 §4).
+type FontFace struct {
+	Family  string           // font-family descriptor, unquoted
+	Sources []FontFaceSource // src descriptor, in preference order
+	Weight  string           // font-weight descriptor ("normal" if absent)
+	Style   string           // font-style descriptor ("normal" if absent)
+}
+
+// FontFaceSource is one entry of an @font-face src list.
+type FontFaceSource struct {
+	URL    string // url(...) target; empty for local() sources
+	Local  string // local(...) font name; empty for url() sources
+	Format string // format(...) hint, lowercased ("" if absent)
+}
+
+// IsBold returns true if the face's weight descriptor selects a bold face.
+func (f FontFace) IsBold() bool {
+	switch strings.ToLower(f.Weight) {
+	case "bold", "bolder", "600", "700", "800", "900":
+		return true
+	}
+	return false
+}
+
+// IsItalic returns true if the face's style descriptor selects an italic face.
+func (f FontFace) IsItalic() bool {
+	s := strings.ToLower(f.Style)
+	return s == "italic" || strings.HasPrefix(s, "oblique")
+}
+
+// parseFontFaceRule parses "@font-face { ... }". Returns false if the rule
+// lacks a font-family or src descriptor.
+func parseFontFaceRule(ruleStr string) (FontFace, bool) {
+	face := FontFace{Weight: "normal", Style: "normal"}
+	open := strings.Index(ruleStr, "{")
+	end := strings.LastIndex(ruleStr, "}")
+	if open == -1 {
+		return face, false
+	}
+	if end == -1 || end < open {
+		end = len(ruleStr)
+	}
+
+	for _, decl := range splitDeclarationParts(ruleStr[open+1 : end]) {
+		colon := strings.Index(decl, ":")
+		if colon == -1 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSpace(decl[:colon]))
+		value := strings.TrimSpace(decl[colon+1:])
+		switch name {
+		case "font-family":
+			face.Family = unquoteFamily(value)
+		case "src":
+			face.Sources = parseFontFaceSources(value)
+		case "font-weight":
+			face.Weight = value
+		case "font-style":
+			face.Style = value
+		}
+	}
+	return face, face.Family != "" && len(face.Sources) > 0
+}
+
+// parseFontFaceSources parses a src descriptor such as
+// url(a.woff) format("woff"), local("Foo"), url(a.ttf).
+func parseFontFaceSources(value string) []FontFaceSource {
+	var sources []FontFaceSource
+	for _, entry := range splitTopLevelCommas(value) {
+		entry = strings.TrimSpace(entry)
+		var src FontFaceSource
+		lower := strings.ToLower(entry)
+		switch {
+		case strings.HasPrefix(lower, "url("):
+			close := strings.Index(entry, ")")
+			if close == -1 {
+				continue
+			}
+			src.URL = strings.Trim(strings.TrimSpace(entry[4:close]), `"'`)
+			entry = entry[close+1:]
+		case strings.HasPrefix(lower, "local("):
+			close := strings.Index(entry, ")")
+			if close == -1 {
+				continue
+			}
+			src.Local = strings.Trim(strings.TrimSpace(entry[6:close]), `"'`)
+			entry = entry[close+1:]
+		default:
+			continue
+		}
+		if i := strings.Index(strings.ToLower(entry), "format("); i != -1 {
+			rest := entry[i+7:]
+			if close := strings.Index(rest, ")"); close != -1 {
+				src.Format = strings.ToLower(strings.Trim(strings.TrimSpace(rest[:close]), `"'`))
+			}
+		}
+		sources = append(sources, src)
+	}
+	return sources
+}
+
+// ParseFontFamilies splits a font-family value into unquoted family names.
+func ParseFontFamilies(value string) []string {
+	var families []string
+	for _, part := range splitTopLevelCommas(value) {
+		if name := unquoteFamily(part); name != "" {
+			families = append(families, name)
+		}
+	}
+	return families
+}
+
+// GetFontFamilies returns the computed font-family list (empty if unset).
+func (s *Style) GetFontFamilies() []string {
+	if family, ok := s.Get("font-family"); ok {
+		return ParseFontFamilies(family)
+	}
+	return nil
+}
+
+// unquoteFamily trims whitespace and surrounding quotes from a family name
+// and collapses internal whitespace in unquoted names.
+func unquoteFamily(name string) string {
+	name = strings.TrimSpace(name)
+	if len(name) >= 2 && (name[0] == '"' || name[0] == '\'') && name[len(name)-1] == name[0] {
+		return name[1 : len(name)-1]
+	}
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// splitTopLevelCommas splits s on commas that are not inside parentheses
+// or quotes.
+func splitTopLevelCommas(s string) []string {
+	var parts []string
+	depth := 0
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '(':
+			depth++
+		case ch == ')':
+			if depth > 0 {
+				depth--
+			}
+		case ch == ',' && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -0,0 +1,68 @@
+package css
+
+import (
+	"testing"
+)
+
+func TestParseFontFaceRule(t *testing.T) {
+	sheet, err := ParseStylesheet(`
+		@font-face {
+			font-family: "My Font";
+			src: local("My Font"), url(data:font/woff;base64,d09GRg==) format("woff"), url('fonts/my.ttf') format('truetype');
+			font-weight: bold;
+		}
+		p { font-family: 'My Font', serif; }
+	`)
+	if err != nil {
+		t.Fatalf("ParseStylesheet: %v", err)
+	}
+	if len(sheet.FontFaces) != 1 {
+		t.Fatalf("got %d font faces, want 1", len(sheet.FontFaces))
+	}
+	if len(sheet.Rules) != 1 {
+		t.Errorf("got %d rules, want 1 (font-face must not become a style rule)", len(sheet.Rules))
+	}
+
+	face := sheet.FontFaces[0]
+	if face.Family != "My Font" {
+		t.Errorf("Family = %q, want %q", face.Family, "My Font")
+	}
+	if !face.IsBold() || face.IsItalic() {
+		t.Errorf("IsBold/IsItalic = %v/%v, want true/false", face.IsBold(), face.IsItalic())
+	}
+	want := []FontFaceSource{
+		{Local: "My Font"},
+		{URL: "data:font/woff;base64,d09GRg==", Format: "woff"},
+		{URL: "fonts/my.ttf", Format: "truetype"},
+	}
+	if len(face.Sources) != len(want) {
+		t.Fatalf("got %d sources, want %d: %+v", len(face.Sources), len(want), face.Sources)
+	}
+	for i, src := range face.Sources {
+		if src != want[i] {
+			t.Errorf("Sources[%d] = %+v, want %+v", i, src, want[i])
+		}
+	}
+}
+
+func TestParseFontFaceRule_MissingSrc(t *testing.T) {
+	sheet, _ := ParseStylesheet(`@font-face { font-family: Foo; }`)
+	if len(sheet.FontFaces) != 0 {
+		t.Errorf("got %d font faces, want 0", len(sheet.FontFaces))
+	}
+}
+
+func TestGetFontFamilies(t *testing.T) {
+	s := NewStyle()
+	s.Set("font-family", `"Open Sans", Arial ,  sans-serif`)
+	got := s.GetFontFamilies()
+	want := []string{"Open Sans", "Arial", "sans-serif"}
+	if len(got) != len(want) {
+		t.Fatalf("GetFontFamilies() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("GetFontFamilies()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
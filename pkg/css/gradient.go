@@ -1,6 +1,7 @@
 package css
 
 import (
+	"math"
 	"strconv"
 	"strings"
 )
@@ -13,67 +14,111 @@ const (
 	GradientRadial
 )
 
+// GradientLength is a length or percentage used by gradient positions and
+// radial sizes.
+type GradientLength struct {
+	Value   float64 // pixels, or percent (0-100) if Percent
+	Percent bool
+}
+
+// Resolve converts the length to pixels against a reference length.
+func (l GradientLength) Resolve(ref float64) float64 {
+	if l.Percent {
+		return l.Value * ref / 100
+	}
+	return l.Value
+}
+
 // ColorStop represents a color and its position in a gradient
 type ColorStop struct {
-	Color  Color
-	Offset float64 // 0.0 to 1.0 (percentage as decimal)
+	Color       Color
+	Position    GradientLength // position along the gradient line
+	HasPosition bool           // false if the stop's position is implied
+	Offset      float64        // resolved position, 0.0 to 1.0 (see ResolveStops)
 }
 
-// Gradient represents a CSS gradient
+// Gradient represents a CSS gradient (CSS Images 3 §3)
 type Gradient struct {
-	Type       GradientType
-	Direction  string // "to right", "to bottom", "45deg", etc.
+	Type      GradientType
+	Repeating bool
+
+	// Linear gradients
+	Direction string // "to right", "to top left", "45deg", etc.
+
+	// Radial gradients
+	Shape   string         // "circle" or "ellipse"
+	Extent  string         // size keyword, "" if SizeX/SizeY are explicit
+	SizeX   GradientLength // explicit radius (both radii for circles)
+	SizeY   GradientLength
+	CenterX GradientLength // defaults to 50% 50%
+	CenterY GradientLength
+
 	ColorStops []ColorStop
 }
 
-// ParseLinearGradient parses a linear-gradient() CSS value
+// ParseGradient parses a linear-gradient(), radial-gradient(), or
+// repeating-*-gradient() value.
 // Example: "linear-gradient(to right, blue 0, blue 150px, red 150px, red 300px)"
-func ParseLinearGradient(value string) (*Gradient, bool) {
+func ParseGradient(value string) (*Gradient, bool) {
 	value = strings.TrimSpace(value)
-
-	// Check if it's a linear-gradient
-	if !strings.HasPrefix(value, "linear-gradient(") {
+	open := strings.Index(value, "(")
+	if open == -1 || !strings.HasSuffix(value, ")") {
 		return nil, false
 	}
-	if !strings.HasSuffix(value, ")") {
+
+	grad := &Gradient{}
+	switch strings.ToLower(value[:open]) {
+	case "linear-gradient":
+		grad.Type = GradientLinear
+	case "repeating-linear-gradient":
+		grad.Type, grad.Repeating = GradientLinear, true
+	case "radial-gradient":
+		grad.Type = GradientRadial
+	case "repeating-radial-gradient":
+		grad.Type, grad.Repeating = GradientRadial, true
+	default:
 		return nil, false
 	}
 
-	// Extract the content
-	content := value[len("linear-gradient(") : len(value)-1]
-
 	// Split by commas (being careful about commas inside functions like rgb())
-	parts := splitGradientParts(content)
+	parts := splitGradientParts(value[open+1 : len(value)-1])
 	if len(parts) < 2 {
 		return nil, false
 	}
 
-	grad := &Gradient{
-		Type:       GradientLinear,
-		ColorStops: make([]ColorStop, 0),
-	}
-
 	startIdx := 0
-
-	// Check if first part is a direction
-	firstPart := strings.TrimSpace(parts[0])
-	if strings.HasPrefix(firstPart, "to ") || strings.HasSuffix(firstPart, "deg") {
-		grad.Direction = firstPart
-		startIdx = 1
-	} else {
-		// Default direction is "to bottom"
+	firstPart := strings.ToLower(strings.TrimSpace(parts[0]))
+	if grad.Type == GradientLinear {
 		grad.Direction = "to bottom"
+		if strings.HasPrefix(firstPart, "to ") {
+			if !validSideOrCorner(strings.Fields(firstPart)[1:]) {
+				return nil, false
+			}
+			grad.Direction = strings.Join(strings.Fields(firstPart), " ")
+			startIdx = 1
+		} else if _, ok := parseGradientAngle(firstPart); ok {
+			grad.Direction = firstPart
+			startIdx = 1
+		}
+	} else {
+		grad.Shape = "ellipse"
+		grad.Extent = "farthest-corner"
+		grad.CenterX = GradientLength{50, true}
+		grad.CenterY = GradientLength{50, true}
+		if isRadialConfig(firstPart) {
+			if !grad.parseRadialConfig(firstPart) {
+				return nil, false
+			}
+			startIdx = 1
+		}
 	}
 
-	// Parse color stops
-	// Format can be: "color" or "color position"
-	// Position can be: "50px", "50%", or absolute pixel values
 	for i := startIdx; i < len(parts); i++ {
-		stop, ok := parseColorStop(strings.TrimSpace(parts[i]))
+		stops, ok := parseColorStop(strings.TrimSpace(parts[i]))
 		if !ok {
 			return nil, false
 		}
-		grad.ColorStops = append(grad.ColorStops, stop)
+		grad.ColorStops = append(grad.ColorStops, stops...)
 	}
 
 	if len(grad.ColorStops) < 2 {
@@ -83,45 +128,328 @@ func ParseLinearGradient(value string) (*Gradient, bool) {
 	return grad, true
 }
 
-// parseColorStop parses a color stop like "blue 150px" or "red 50%"
-func parseColorStop(stop string) (ColorStop, bool) {
-	parts := strings.Fields(stop)
-	if len(parts) == 0 {
-		return ColorStop{}, false
+// ParseLinearGradient parses a linear-gradient() CSS value
+func ParseLinearGradient(value string) (*Gradient, bool) {
+	grad, ok := ParseGradient(value)
+	if !ok || grad.Type != GradientLinear {
+		return nil, false
+	}
+	return grad, true
+}
+
+// IsGradient returns true if value is a gradient function.
+func IsGradient(value string) bool {
+	return gradientStart(value) != -1
+}
+
+// gradientStart returns the index of the first gradient function in value,
+// or -1 if there is none.
+func gradientStart(value string) int {
+	lower := strings.ToLower(value)
+	start := -1
+	for _, name := range []string{"repeating-linear-gradient(", "repeating-radial-gradient(", "linear-gradient(", "radial-gradient("} {
+		i := strings.Index(lower, name)
+		if i == -1 {
+			continue
+		}
+		// "linear-gradient(" also matches inside "repeating-linear-gradient("
+		if strings.HasSuffix(lower[:i], "repeating-") {
+			i -= len("repeating-")
+		}
+		if start == -1 || i < start {
+			start = i
+		}
+	}
+	return start
+}
+
+// validSideOrCorner checks the keywords following "to" in a linear gradient.
+func validSideOrCorner(words []string) bool {
+	if len(words) == 0 || len(words) > 2 {
+		return false
+	}
+	horizontal, vertical := 0, 0
+	for _, w := range words {
+		switch w {
+		case "left", "right":
+			horizontal++
+		case "top", "bottom":
+			vertical++
+		default:
+			return false
+		}
 	}
+	return horizontal <= 1 && vertical <= 1
+}
 
-	// Parse the color (first part)
-	color, ok := ParseColor(parts[0])
-	if !ok {
-		return ColorStop{}, false
+// parseGradientAngle parses a gradient angle into degrees. It extends
+// parseAngle with grad units and a bare zero.
+func parseGradientAngle(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	if value == "0" {
+		return 0, true
+	}
+	if strings.HasSuffix(value, "grad") {
+		num, err := strconv.ParseFloat(strings.TrimSuffix(value, "grad"), 64)
+		return num * 0.9, err == nil
 	}
+	if angle := parseAngle(value); angle != nil {
+		return *angle, true
+	}
+	return 0, false
+}
 
-	cs := ColorStop{
-		Color:  color,
-		Offset: -1, // -1 means position not specified
+// LinearAngle returns the gradient line's angle in degrees, clockwise from
+// "to top", for a gradient box of the given size. Corner directions depend
+// on the box's aspect ratio (CSS Images 3 §3.1.1).
+func (g *Gradient) LinearAngle(width, height float64) float64 {
+	if angle, ok := parseGradientAngle(g.Direction); ok {
+		return angle
 	}
+	corner := math.Atan2(height, width) * 180 / math.Pi
+	switch g.Direction {
+	case "to top":
+		return 0
+	case "to right":
+		return 90
+	case "to left":
+		return 270
+	case "to top right", "to right top":
+		return corner
+	case "to bottom right", "to right bottom":
+		return 180 - corner
+	case "to bottom left", "to left bottom":
+		return 180 + corner
+	case "to top left", "to left top":
+		return 360 - corner
+	}
+	return 180 // "to bottom"
+}
 
-	// Parse the position if present
-	if len(parts) >= 2 {
-		pos := parts[1]
-		if strings.HasSuffix(pos, "px") {
-			// Absolute pixel position - we'll convert this to percentage later
-			// based on the container size
-			pxStr := strings.TrimSuffix(pos, "px")
-			px, err := strconv.ParseFloat(pxStr, 64)
-			if err == nil {
-				cs.Offset = px // Store as negative to distinguish from percentage
+// LinearLine returns the start and end points of the gradient line for a
+// gradient box of the given size, relative to its top-left corner. The line
+// passes through the center and is long enough that the 0% and 100%
+// positions touch the box's corners.
+func (g *Gradient) LinearLine(width, height float64) (x0, y0, x1, y1 float64) {
+	rad := g.LinearAngle(width, height) * math.Pi / 180
+	dx, dy := math.Sin(rad), -math.Cos(rad)
+	half := (math.Abs(width*dx) + math.Abs(height*dy)) / 2
+	cx, cy := width/2, height/2
+	return cx - dx*half, cy - dy*half, cx + dx*half, cy + dy*half
+}
+
+// isRadialConfig returns true if the first part of a radial gradient is a
+// shape/size/position description rather than a color stop.
+func isRadialConfig(part string) bool {
+	fields := strings.Fields(part)
+	if len(fields) == 0 {
+		return false
+	}
+	switch fields[0] {
+	case "circle", "ellipse", "closest-side", "farthest-side", "closest-corner", "farthest-corner", "at":
+		return true
+	}
+	_, isLength := parseGradientLength(fields[0])
+	return isLength
+}
+
+// parseRadialConfig parses "[<shape> || <size>] [at <position>]".
+func (g *Gradient) parseRadialConfig(part string) bool {
+	fields := strings.Fields(part)
+	var sizes []GradientLength
+	shapeSet := false
+	i := 0
+	for ; i < len(fields) && fields[i] != "at"; i++ {
+		switch f := fields[i]; f {
+		case "circle", "ellipse":
+			if shapeSet {
+				return false
+			}
+			g.Shape, shapeSet = f, true
+		case "closest-side", "farthest-side", "closest-corner", "farthest-corner":
+			if g.Extent != "farthest-corner" || len(sizes) > 0 {
+				return false
 			}
-		} else if strings.HasSuffix(pos, "%") {
-			pctStr := strings.TrimSuffix(pos, "%")
-			pct, err := strconv.ParseFloat(pctStr, 64)
-			if err == nil {
-				cs.Offset = pct / 100.0 // Convert to 0-1 range
+			g.Extent = f
+		default:
+			l, ok := parseGradientLength(f)
+			if !ok || len(sizes) == 2 {
+				return false
+			}
+			sizes = append(sizes, l)
+		}
+	}
+
+	switch len(sizes) {
+	case 1:
+		// A single length is a circle radius; percentages are not allowed
+		if sizes[0].Percent || (shapeSet && g.Shape != "circle") {
+			return false
+		}
+		g.Shape, g.Extent = "circle", ""
+		g.SizeX, g.SizeY = sizes[0], sizes[0]
+	case 2:
+		if shapeSet && g.Shape != "ellipse" {
+			return false
+		}
+		g.Shape, g.Extent = "ellipse", ""
+		g.SizeX, g.SizeY = sizes[0], sizes[1]
+	}
+
+	if i < len(fields) {
+		x, y, ok := parseGradientPosition(fields[i+1:])
+		if !ok {
+			return false
+		}
+		g.CenterX, g.CenterY = x, y
+	}
+	return true
+}
+
+// parseGradientPosition parses the <position> after "at" in a radial
+// gradient: one or two keywords or lengths.
+func parseGradientPosition(fields []string) (x, y GradientLength, ok bool) {
+	center := GradientLength{50, true}
+	keyword := func(f string) (GradientLength, string, bool) {
+		switch f {
+		case "left":
+			return GradientLength{0, true}, "x", true
+		case "right":
+			return GradientLength{100, true}, "x", true
+		case "top":
+			return GradientLength{0, true}, "y", true
+		case "bottom":
+			return GradientLength{100, true}, "y", true
+		case "center":
+			return center, "", true
+		}
+		l, ok := parseGradientLength(f)
+		return l, "", ok
+	}
+
+	switch len(fields) {
+	case 1:
+		l, axis, ok := keyword(fields[0])
+		if !ok {
+			return x, y, false
+		}
+		if axis == "y" {
+			return center, l, true
+		}
+		return l, center, true
+	case 2:
+		a, axisA, okA := keyword(fields[0])
+		b, axisB, okB := keyword(fields[1])
+		if !okA || !okB || axisA == "y" && axisB == "y" || axisA == "x" && axisB == "x" {
+			return x, y, false
+		}
+		// "top left" names the vertical component first
+		if axisA == "y" || axisB == "x" {
+			return b, a, true
+		}
+		return a, b, true
+	}
+	return x, y, false
+}
+
+// RadialGeometry returns the center and radii of the ending shape for a
+// gradient box of the given size, relative to its top-left corner
+// (CSS Images 3 §3.2.2).
+func (g *Gradient) RadialGeometry(width, height float64) (cx, cy, rx, ry float64) {
+	cx = g.CenterX.Resolve(width)
+	cy = g.CenterY.Resolve(height)
+	if g.Extent == "" {
+		rx, ry = g.SizeX.Resolve(width), g.SizeY.Resolve(height)
+		if g.Shape == "circle" {
+			ry = rx
+		}
+		return cx, cy, rx, ry
+	}
+
+	closestX := math.Min(math.Abs(cx), math.Abs(width-cx))
+	closestY := math.Min(math.Abs(cy), math.Abs(height-cy))
+	farthestX := math.Max(math.Abs(cx), math.Abs(width-cx))
+	farthestY := math.Max(math.Abs(cy), math.Abs(height-cy))
+
+	var sideX, sideY float64
+	corner := false
+	switch g.Extent {
+	case "closest-side":
+		sideX, sideY = closestX, closestY
+	case "farthest-side":
+		sideX, sideY = farthestX, farthestY
+	case "closest-corner":
+		sideX, sideY, corner = closestX, closestY, true
+	default: // farthest-corner
+		sideX, sideY, corner = farthestX, farthestY, true
+	}
+
+	if g.Shape == "circle" {
+		var r float64
+		switch {
+		case corner:
+			r = math.Hypot(sideX, sideY)
+		case g.Extent == "closest-side":
+			r = math.Min(sideX, sideY)
+		default:
+			r = math.Max(sideX, sideY)
+		}
+		return cx, cy, r, r
+	}
+	if corner {
+		// An ellipse with the side ratio passing through the corner
+		return cx, cy, sideX * math.Sqrt2, sideY * math.Sqrt2
+	}
+	return cx, cy, sideX, sideY
+}
+
+// parseGradientLength parses a length or percentage.
+func parseGradientLength(value string) (GradientLength, bool) {
+	if pct, ok := ParsePercentage(value); ok {
+		return GradientLength{pct, true}, true
+	}
+	if px, ok := ParseLength(value); ok {
+		return GradientLength{Value: px}, true
+	}
+	return GradientLength{}, false
+}
+
+// parseColorStop parses a color stop like "blue 150px" or "red 50%". A stop
+// with two positions ("red 10% 20%") yields two stops of the same color.
+func parseColorStop(stop string) ([]ColorStop, bool) {
+	fields := splitTopLevelFields(stop)
+	if len(fields) == 0 || len(fields) > 3 {
+		return nil, false
+	}
+
+	var cs ColorStop
+	colorFound := false
+	var positions []GradientLength
+	for _, f := range fields {
+		if !colorFound {
+			if color, ok := ParseColor(f); ok {
+				cs.Color, colorFound = color, true
+				continue
 			}
 		}
+		l, ok := parseGradientLength(f)
+		if !ok {
+			return nil, false
+		}
+		positions = append(positions, l)
+	}
+	if !colorFound || len(positions) > 2 {
+		return nil, false
 	}
 
-	return cs, true
+	if len(positions) == 0 {
+		return []ColorStop{cs}, true
+	}
+	stops := make([]ColorStop, len(positions))
+	for i, pos := range positions {
+		stops[i] = ColorStop{Color: cs.Color, Position: pos, HasPosition: true}
+	}
+	return stops, true
 }
 
 // splitGradientParts splits gradient content by commas, respecting parentheses
@@ -152,99 +480,105 @@ func splitGradientParts(content string) []string {
 	return parts
 }
 
-// ConvertPixelOffsetsToPercentages converts pixel-based offsets to percentages
-// based on the gradient size in the specified direction
-func (g *Gradient) ConvertPixelOffsetsToPercentages(width, height float64) {
-	if g == nil || g.Type != GradientLinear {
-		return
+// ResolveStops returns the color stops with Offset set to a fraction of a
+// gradient line of the given length, fixing up missing and out-of-order
+// positions (CSS Images 3 §3.4.3).
+func (g *Gradient) ResolveStops(length float64) []ColorStop {
+	stops := make([]ColorStop, len(g.ColorStops))
+	copy(stops, g.ColorStops)
+	if len(stops) == 0 {
+		return stops
 	}
 
-	// Determine gradient size based on direction
-	var size float64
-	switch g.Direction {
-	case "to right", "to left":
-		size = width
-	case "to bottom", "to top":
-		size = height
-	default:
-		// For angles or other directions, use the diagonal
-		size = width // Simplified for now
+	resolved := make([]bool, len(stops))
+	for i := range stops {
+		if stops[i].HasPosition {
+			if stops[i].Position.Percent {
+				stops[i].Offset = stops[i].Position.Value / 100
+			} else if length > 0 {
+				stops[i].Offset = stops[i].Position.Value / length
+			}
+			resolved[i] = true
+		}
 	}
 
-	if size == 0 {
-		return
+	// Missing first and last positions default to 0% and 100%
+	if !resolved[0] {
+		stops[0].Offset, resolved[0] = 0, true
+	}
+	last := len(stops) - 1
+	if !resolved[last] {
+		stops[last].Offset, resolved[last] = 1, true
 	}
 
-	// Convert pixel offsets to percentages
-	// Percentages are stored as 0-1 values, pixels are stored as actual pixel values (> 1)
-	// -1 means the offset wasn't specified
-	for i := range g.ColorStops {
-		offset := g.ColorStops[i].Offset
-		if offset < 0 {
-			// Not specified, will be filled in later
+	// A position smaller than any before it is clamped to the largest
+	maxOffset := stops[0].Offset
+	for i := range stops {
+		if !resolved[i] {
 			continue
 		}
-		if offset <= 1.0 {
-			// Already a percentage (0-1 range)
+		if stops[i].Offset < maxOffset {
+			stops[i].Offset = maxOffset
+		}
+		maxOffset = stops[i].Offset
+	}
+
+	// Runs of unpositioned stops are spread evenly between their neighbors
+	for i := 0; i < len(stops); i++ {
+		if resolved[i] {
 			continue
 		}
-		// It's a pixel value (> 1) - convert to percentage
-		g.ColorStops[i].Offset = offset / size
+		next := i
+		for !resolved[next] {
+			next++
+		}
+		prev := i - 1
+		step := (stops[next].Offset - stops[prev].Offset) / float64(next-prev)
+		for j := i; j < next; j++ {
+			stops[j].Offset = stops[prev].Offset + step*float64(j-prev)
+		}
+		i = next
 	}
 
-	// Fill in missing offsets by distributing evenly
-	g.fillMissingOffsets()
+	return stops
 }
 
-// fillMissingOffsets fills in any color stops that don't have explicit offsets
-func (g *Gradient) fillMissingOffsets() {
-	if len(g.ColorStops) == 0 {
-		return
+// GetGradient attempts to parse a gradient from a background value
+func GetGradient(backgroundValue string) (*Gradient, bool) {
+	start := gradientStart(backgroundValue)
+	if start == -1 {
+		return nil, false
 	}
-
-	// If first stop has no offset, set it to 0
-	if g.ColorStops[0].Offset < 0 {
-		g.ColorStops[0].Offset = 0
+	end := matchingParen(backgroundValue, strings.Index(backgroundValue[start:], "(")+start)
+	if end == -1 {
+		return nil, false
 	}
+	return ParseGradient(backgroundValue[start : end+1])
+}
 
-	// If last stop has no offset, set it to 1
-	lastIdx := len(g.ColorStops) - 1
-	if g.ColorStops[lastIdx].Offset < 0 {
-		g.ColorStops[lastIdx].Offset = 1.0
+// GetBackgroundGradient returns the gradient of background-image, if it is
+// one.
+func (s *Style) GetBackgroundGradient() (*Gradient, bool) {
+	if val, ok := s.Get("background-image"); ok {
+		return GetGradient(val)
 	}
+	return nil, false
+}
 
-	// Fill in any missing offsets between defined ones
-	for i := 0; i < len(g.ColorStops); i++ {
-		if g.ColorStops[i].Offset < 0 {
-			// Find the next defined offset
-			nextIdx := i + 1
-			for nextIdx < len(g.ColorStops) && g.ColorStops[nextIdx].Offset < 0 {
-				nextIdx++
-			}
-
-			// Find the previous defined offset
-			prevIdx := i - 1
-			for prevIdx >= 0 && g.ColorStops[prevIdx].Offset < 0 {
-				prevIdx--
-			}
-
-			// Interpolate
-			if prevIdx >= 0 && nextIdx < len(g.ColorStops) {
-				prevOffset := g.ColorStops[prevIdx].Offset
-				nextOffset := g.ColorStops[nextIdx].Offset
-				count := nextIdx - prevIdx
-				step := (nextOffset - prevOffset) / float64(count)
-				g.ColorStops[i].Offset = prevOffset + step*float64(i-prevIdx)
+// matchingParen returns the index of the parenthesis closing the one at
+// open, or -1.
+func matchingParen(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
 			}
 		}
 	}
-}
-
-// GetGradient attempts to parse a gradient from a background value
-func GetGradient(backgroundValue string) (*Gradient, bool) {
-	if strings.Contains(backgroundValue, "linear-gradient(") {
-		return ParseLinearGradient(backgroundValue)
-	}
-	// Could add radial-gradient support here in the future
-	return nil, false
+	return -1
 }
@@ -0,0 +1,85 @@
+package css
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseGradient_LinearAngleAndStops(t *testing.T) {
+	grad, ok := ParseGradient("linear-gradient(45deg, rgba(0, 0, 255, 0.5) 10%, red 20px 40px, green)")
+	if !ok {
+		t.Fatal("expected gradient to parse")
+	}
+	if grad.Type != GradientLinear || grad.Direction != "45deg" {
+		t.Errorf("unexpected gradient %+v", grad)
+	}
+	if len(grad.ColorStops) != 4 {
+		t.Fatalf("expected a double-position stop to yield 4 stops, got %d", len(grad.ColorStops))
+	}
+	if grad.ColorStops[0].Color.A != 0.5 {
+		t.Errorf("expected rgba() stop color, got %+v", grad.ColorStops[0].Color)
+	}
+
+	stops := grad.ResolveStops(200)
+	want := []float64{0.1, 0.1, 0.2, 1}
+	for i, stop := range stops {
+		if math.Abs(stop.Offset-want[i]) > 1e-9 {
+			t.Errorf("stop %d: expected offset %v, got %v", i, want[i], stop.Offset)
+		}
+	}
+
+	if _, ok := ParseGradient("linear-gradient(to middle, red, blue)"); ok {
+		t.Error("expected an invalid direction to be rejected")
+	}
+}
+
+func TestGradient_LinearLine(t *testing.T) {
+	grad, _ := ParseGradient("linear-gradient(to right, red, blue)")
+	x0, y0, x1, y1 := grad.LinearLine(200, 100)
+	if x0 != 0 || x1 != 200 || math.Abs(y0-50) > 1e-9 || math.Abs(y1-50) > 1e-9 {
+		t.Errorf("expected a horizontal line across the box, got (%v,%v)-(%v,%v)", x0, y0, x1, y1)
+	}
+
+	// For a corner direction the perpendicular through the center hits the
+	// other two corners, so the line ends where that projection does
+	grad, _ = ParseGradient("linear-gradient(to bottom right, red, blue)")
+	if angle := grad.LinearAngle(100, 100); math.Abs(angle-135) > 1e-9 {
+		t.Errorf("expected 135deg for a square box, got %v", angle)
+	}
+}
+
+func TestParseGradient_Radial(t *testing.T) {
+	grad, ok := ParseGradient("radial-gradient(circle closest-side at left top, white, black)")
+	if !ok {
+		t.Fatal("expected gradient to parse")
+	}
+	if grad.Shape != "circle" || grad.Extent != "closest-side" {
+		t.Errorf("unexpected shape/extent %q/%q", grad.Shape, grad.Extent)
+	}
+	cx, cy, rx, ry := grad.RadialGeometry(200, 100)
+	if cx != 0 || cy != 0 || rx != 0 || ry != 0 {
+		t.Errorf("expected a degenerate circle at the corner, got (%v,%v) r=%v,%v", cx, cy, rx, ry)
+	}
+
+	grad, _ = ParseGradient("radial-gradient(red, blue)")
+	cx, cy, rx, ry = grad.RadialGeometry(200, 100)
+	if cx != 100 || cy != 50 || math.Abs(rx-100*math.Sqrt2) > 1e-9 || math.Abs(ry-50*math.Sqrt2) > 1e-9 {
+		t.Errorf("unexpected default ellipse (%v,%v) r=%v,%v", cx, cy, rx, ry)
+	}
+}
+
+func TestExpandBackgroundShorthand_Gradient(t *testing.T) {
+	s := NewStyle()
+	expandShorthand(s, "background", "repeating-linear-gradient(to right, red 0 10px, blue 10px 20px) no-repeat yellow")
+
+	grad, ok := s.GetBackgroundGradient()
+	if !ok || !grad.Repeating || len(grad.ColorStops) != 4 {
+		t.Errorf("expected a repeating gradient background-image, got %+v, %v", grad, ok)
+	}
+	if c, _ := s.Get("background-color"); c != "yellow" {
+		t.Errorf("expected background-color yellow, got %q", c)
+	}
+	if r := s.GetBackgroundRepeat(); r != BackgroundRepeatNoRepeat {
+		t.Errorf("expected no-repeat, got %q", r)
+	}
+}
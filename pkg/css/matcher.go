@@ -90,11 +90,11 @@ func matchesSelectorPart(node *html.Node, part SelectorPart) bool {
 		if !ok {
 			return false
 		}
-		nodeClasses := strings.Split(classAttr, " ")
+		nodeClasses := strings.Fields(classAttr)
 		for _, requiredClass := range part.Classes {
 			found := false
 			for _, nodeClass := range nodeClasses {
-				if strings.TrimSpace(nodeClass) == requiredClass {
+				if nodeClass == requiredClass {
 					found = true
 					break
 				}
@@ -133,20 +133,24 @@ func matchesAttributeSelector(node *html.Node, attr AttributeSelector) bool {
 	if attr.Operator == "" {
 		return true
 	}
+	if attr.CaseInsensitive {
+		value = strings.ToLower(value)
+		attr.Value = strings.ToLower(attr.Value)
+	}
 
 	switch attr.Operator {
 	case "=":
 		// Exact match
 		return value == attr.Value
 	case "^=":
-		// Starts with
-		return strings.HasPrefix(value, attr.Value)
+		// Starts with (an empty value never matches)
+		return attr.Value != "" && strings.HasPrefix(value, attr.Value)
 	case "$=":
 		// Ends with
-		return strings.HasSuffix(value, attr.Value)
+		return attr.Value != "" && strings.HasSuffix(value, attr.Value)
 	case "*=":
 		// Contains
-		return strings.Contains(value, attr.Value)
+		return attr.Value != "" && strings.Contains(value, attr.Value)
 	case "~=":
 		// Word match (whitespace-separated)
 		words := strings.Fields(value)
@@ -213,80 +217,110 @@ func getPreviousSibling(node *html.Node) *html.Node {
 
 // matchesPseudoClass checks if a node matches a given pseudo-class.
 func matchesPseudoClass(node *html.Node, pc string) bool {
-	switch {
-	case pc == "first-child":
-		return isNthChild(node, 1)
-	case pc == "last-child":
-		return isLastChild(node)
-	case pc == "only-child":
-		return isNthChild(node, 1) && isLastChild(node)
-	case pc == "root":
+	name, arg, _ := splitPseudoClass(pc)
+	switch name {
+	case "first-child":
+		return elementIndex(node, false, false) == 1
+	case "last-child":
+		return elementIndex(node, false, true) == 1
+	case "only-child":
+		return elementIndex(node, false, false) == 1 && elementIndex(node, false, true) == 1
+	case "first-of-type":
+		return elementIndex(node, true, false) == 1
+	case "last-of-type":
+		return elementIndex(node, true, true) == 1
+	case "only-of-type":
+		return elementIndex(node, true, false) == 1 && elementIndex(node, true, true) == 1
+	case "nth-child":
+		return matchesAnPlusB(elementIndex(node, false, false), arg)
+	case "nth-last-child":
+		return matchesAnPlusB(elementIndex(node, false, true), arg)
+	case "nth-of-type":
+		return matchesAnPlusB(elementIndex(node, true, false), arg)
+	case "nth-last-of-type":
+		return matchesAnPlusB(elementIndex(node, true, true), arg)
+	case "root":
 		return node.Parent != nil && node.Parent.TagName == "document"
-	case pc == "empty":
+	case "empty":
 		return len(node.Children) == 0
-	case strings.HasPrefix(pc, "nth-child("):
-		arg := pc[len("nth-child(") : len(pc)-1] // strip "nth-child(" and ")"
-		return matchesNthChild(node, arg)
-	case strings.HasPrefix(pc, "not("):
-		arg := pc[len("not(") : len(pc)-1] // strip "not(" and ")"
-		// Parse the inner selector and check if it does NOT match
-		innerSel := ParseSelector(strings.TrimSpace(arg))
-		return !matchesSelectorPart(node, innerSel.Parts[len(innerSel.Parts)-1])
-	case pc == "hover", pc == "focus", pc == "active", pc == "visited":
-		// Dynamic pseudo-classes never match in a static renderer
+	case "not":
+		// Selectors 4: matches if the node matches none of the selectors in the list
+		return !matchesSelectorList(node, arg)
+	case "is", "where":
+		return matchesSelectorList(node, arg)
+	case "hover":
+		return node.HasState(html.StateHover)
+	case "active":
+		return node.HasState(html.StateActive)
+	case "focus", "focus-visible":
+		return node.HasState(html.StateFocus)
+	case "focus-within":
+		return node.HasState(html.StateFocusWithin)
+	case "visited":
+		// No history is kept, so no link has been visited
 		return false
-	case pc == "link":
-		return node.TagName == "a"
+	case "link", "any-link":
+		_, hasHref := node.GetAttribute("href")
+		return (node.TagName == "a" || node.TagName == "area") && hasHref
 	default:
 		return false
 	}
 }
 
-// isNthChild returns true if the node is the nth element child (1-based).
-func isNthChild(node *html.Node, n int) bool {
-	if node.Parent == nil {
-		return n == 1
-	}
-	count := 0
-	for _, c := range node.Parent.Children {
-		if c.Type == html.ElementNode {
-			count++
-			if c == node {
-				return count == n
-			}
+// matchesSelectorList returns true if the node matches any selector in a
+// comma-separated list, as used by :not(), :is(), and :where().
+func matchesSelectorList(node *html.Node, list string) bool {
+	for _, s := range splitSelectorGroup(list) {
+		if sel := ParseSelector(strings.TrimSpace(s)); sel.PseudoElement == "" && MatchesSelector(node, sel) {
+			return true
 		}
 	}
 	return false
 }
 
-// isLastChild returns true if the node is the last element child.
-func isLastChild(node *html.Node) bool {
+// elementIndex returns the 1-based position of node among its element
+// siblings, counting from the end if fromEnd is set. With sameType only
+// siblings with the same tag name are counted. An element without a parent
+// is the only child.
+func elementIndex(node *html.Node, sameType, fromEnd bool) int {
 	if node.Parent == nil {
-		return true
+		return 1
 	}
-	for i := len(node.Parent.Children) - 1; i >= 0; i-- {
-		c := node.Parent.Children[i]
-		if c.Type == html.ElementNode {
-			return c == node
+	siblings := node.Parent.Children
+	count := 0
+	for i := range siblings {
+		c := siblings[i]
+		if fromEnd {
+			c = siblings[len(siblings)-1-i]
+		}
+		if c.Type != html.ElementNode || (sameType && c.TagName != node.TagName) {
+			continue
+		}
+		count++
+		if c == node {
+			return count
 		}
 	}
-	return false
+	return 0
 }
 
-// matchesNthChild checks the An+B formula.
-func matchesNthChild(node *html.Node, arg string) bool {
-	arg = strings.TrimSpace(arg)
+// matchesAnPlusB checks a 1-based index against an An+B formula, or the
+// keywords odd and even.
+func matchesAnPlusB(idx int, arg string) bool {
+	arg = strings.ToLower(strings.TrimSpace(arg))
+	if idx <= 0 {
+		return false
+	}
 
 	if arg == "odd" {
-		return nthChildIndex(node)%2 == 1
+		return idx%2 == 1
 	}
 	if arg == "even" {
-		return nthChildIndex(node)%2 == 0
+		return idx%2 == 0
 	}
 
 	// Parse An+B
 	a, b := parseAnPlusB(arg)
-	idx := nthChildIndex(node)
 	if a == 0 {
 		return idx == b
 	}
@@ -299,23 +333,6 @@ func matchesNthChild(node *html.Node, arg string) bool {
 	return diff <= 0 && diff%a == 0
 }
 
-// nthChildIndex returns the 1-based index of node among element siblings.
-func nthChildIndex(node *html.Node) int {
-	if node.Parent == nil {
-		return 1
-	}
-	count := 0
-	for _, c := range node.Parent.Children {
-		if c.Type == html.ElementNode {
-			count++
-			if c == node {
-				return count
-			}
-		}
-	}
-	return 0
-}
-
 // parseAnPlusB parses an An+B expression like "2n+1", "3n", "5", "-n+3".
 func parseAnPlusB(s string) (a, b int) {
 	s = strings.TrimSpace(s)
@@ -374,8 +391,8 @@ func parseInt(s string) (int, bool) {
 }
 
 // FindMatchingRules returns all rules that match the given node
-// Phase 22: Added viewport dimensions for media query evaluation
-func FindMatchingRules(node *html.Node, stylesheet *Stylesheet, viewportWidth, viewportHeight float64) []Rule {
+// Phase 22: media is the device @media queries are evaluated against
+func FindMatchingRules(node *html.Node, stylesheet *Stylesheet, media Media) []Rule {
 	matches := make([]Rule, 0)
 
 	for _, rule := range stylesheet.Rules {
@@ -385,7 +402,7 @@ func FindMatchingRules(node *html.Node, stylesheet *Stylesheet, viewportWidth, v
 		}
 
 		// Phase 22: Check media query first
-		if !EvaluateMediaQuery(rule.MediaQuery, viewportWidth, viewportHeight) {
+		if !EvaluateMediaQuery(rule.MediaQuery, media) {
 			continue
 		}
 
@@ -82,7 +82,7 @@ func TestFindMatchingRules(t *testing.T) {
 		},
 	}
 
-	matches := FindMatchingRules(node, stylesheet, 800, 600)
+	matches := FindMatchingRules(node, stylesheet, Media{Width: 800, Height: 600})
 
 	// Should match all three rules
 	if len(matches) != 3 {
@@ -193,7 +193,7 @@ func TestParseAndMatch_TildeEquals(t *testing.T) {
 			"class": "foo bar baz",
 		},
 	}
-	matches := FindMatchingRules(node, stylesheet, 800, 600)
+	matches := FindMatchingRules(node, stylesheet, Media{Width: 800, Height: 600})
 	if len(matches) != 1 {
 		t.Fatalf("expected 1 match, got %d", len(matches))
 	}
@@ -206,7 +206,7 @@ func TestParseAndMatch_TildeEquals(t *testing.T) {
 			"class": "foobar",
 		},
 	}
-	matches2 := FindMatchingRules(node2, stylesheet, 800, 600)
+	matches2 := FindMatchingRules(node2, stylesheet, Media{Width: 800, Height: 600})
 	if len(matches2) != 0 {
 		t.Fatalf("expected 0 matches for 'foobar', got %d", len(matches2))
 	}
@@ -223,7 +223,7 @@ func TestParseAndMatch_PipeEquals(t *testing.T) {
 		TagName: "div",
 		Attributes: map[string]string{"lang": "en-US"},
 	}
-	matches := FindMatchingRules(node, stylesheet, 800, 600)
+	matches := FindMatchingRules(node, stylesheet, Media{Width: 800, Height: 600})
 	if len(matches) != 1 {
 		t.Fatalf("expected 1 match for 'en-US', got %d", len(matches))
 	}
@@ -233,7 +233,7 @@ func TestParseAndMatch_PipeEquals(t *testing.T) {
 		TagName: "div",
 		Attributes: map[string]string{"lang": "fr"},
 	}
-	matches2 := FindMatchingRules(node2, stylesheet, 800, 600)
+	matches2 := FindMatchingRules(node2, stylesheet, Media{Width: 800, Height: 600})
 	if len(matches2) != 0 {
 		t.Fatalf("expected 0 matches for 'fr', got %d", len(matches2))
 	}
@@ -301,7 +301,7 @@ func TestPseudoClass_NeverMatches(t *testing.T) {
 				},
 			}
 
-			matches := FindMatchingRules(node, stylesheet, 800, 600)
+			matches := FindMatchingRules(node, stylesheet, Media{Width: 800, Height: 600})
 			if len(matches) != 0 {
 				t.Errorf(":%s should never match in static renderer, got %d matches", pc, len(matches))
 			}
@@ -328,7 +328,7 @@ func TestPseudoClass_NonHoverRulesStillMatch(t *testing.T) {
 		TagName: "a",
 	}
 
-	matches := FindMatchingRules(node, stylesheet, 800, 600)
+	matches := FindMatchingRules(node, stylesheet, Media{Width: 800, Height: 600})
 	if len(matches) != 1 {
 		t.Fatalf("expected 1 match (non-hover rule only), got %d", len(matches))
 	}
@@ -357,3 +357,103 @@ func TestPseudoClass_Specificity(t *testing.T) {
 		t.Errorf("expected specificity 11 for 'a:hover', got %d", sel.Specificity)
 	}
 }
+
+// findByID returns the element with the given id attribute, or nil.
+func findByID(node *html.Node, id string) *html.Node {
+	if v, ok := node.GetAttribute("id"); ok && v == id {
+		return node
+	}
+	for _, c := range node.Children {
+		if found := findByID(c, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func TestMatchesSelector_Structural(t *testing.T) {
+	doc, _ := html.Parse(`<div id="list"><p id="a">A</p><span id="b">B</span><p id="c" class="x  y">C</p><p id="d">D</p><a id="e" href="https://example.com" lang="EN-us">E</a></div>`)
+	tests := []struct {
+		selector string
+		id       string
+		want     bool
+	}{
+		{"p:first-child", "a", true},
+		{"p:first-child", "c", false},
+		{":last-child", "e", true},
+		{"p:nth-child(2n + 1)", "c", true},
+		{"p:nth-child(2n + 1)", "d", false},
+		{":nth-child(odd)", "a", true},
+		{":nth-last-child(1)", "e", true},
+		{"p:first-of-type", "a", true},
+		{"p:last-of-type", "d", true},
+		{"p:nth-of-type(2)", "c", true},
+		{"span:only-of-type", "b", true},
+		{"p:not(.x, #a)", "d", true},
+		{"p:not(.x, #a)", "c", false},
+		{"p:not(span + p)", "c", false},
+		{":is(span, .x)", "c", true},
+		{"div > p ~ a", "e", true},
+		{"#a + span", "b", true},
+		{"#a + p", "c", false},
+		{"div p.y", "c", true},
+		{`a[href^="https"]`, "e", true},
+		{`a[href$=".org"]`, "e", false},
+		{`a[lang|="en" i]`, "e", true},
+		{`a[lang|="en"]`, "e", false},
+		{"P:First-Child", "a", true},
+	}
+	for _, tt := range tests {
+		node := findByID(doc.Root, tt.id)
+		if got := MatchesSelector(node, ParseSelector(tt.selector)); got != tt.want {
+			t.Errorf("%q on #%s: got %v, want %v", tt.selector, tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestMatchesSelector_InteractionState(t *testing.T) {
+	doc, _ := html.Parse(`<div id="menu"><a id="link" href="#">Home</a><p id="text">Text</p></div>`)
+	link := findByID(doc.Root, "link")
+	link.SetState(html.StateHover|html.StateFocus, true)
+
+	tests := []struct {
+		selector string
+		id       string
+		want     bool
+	}{
+		{"a:hover", "link", true},
+		{"a:focus", "link", true},
+		{"a:active", "link", false},
+		{"p:hover", "text", false},
+		{":visited", "link", false},
+		{"div:hover a", "link", false},
+	}
+	for _, tt := range tests {
+		node := findByID(doc.Root, tt.id)
+		if got := MatchesSelector(node, ParseSelector(tt.selector)); got != tt.want {
+			t.Errorf("%q on #%s: got %v, want %v", tt.selector, tt.id, got, tt.want)
+		}
+	}
+
+	link.SetState(html.StateHover, false)
+	if MatchesSelector(link, ParseSelector("a:hover")) {
+		t.Error("a:hover still matches after the hover state was cleared")
+	}
+}
+
+func TestSelectorSpecificity_FunctionalPseudoClasses(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     int
+	}{
+		{"p:not(#a)", 101},
+		{"p:is(.x, #a)", 101},
+		{"p:where(#a)", 1},
+		{"li:nth-child(2n+1)", 11},
+	}
+	for _, tt := range tests {
+		if got := ParseSelector(tt.selector).Specificity; got != tt.want {
+			t.Errorf("specificity of %q = %d, want %d", tt.selector, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,453 @@
+package css
+
+import (
+	"strconv"
+	"strings"
+
+	"louis14/pkg/text"
+)
+
+// Media describes the device a document is rendered for. @media queries
+// are evaluated against it (Media Queries 4).
+type Media struct {
+	Width       float64       // Viewport width in pixels
+	Height      float64       // Viewport height in pixels
+	Type        string        // "screen" or "print"; "" means screen
+	Resolution  float64       // Device pixels per CSS pixel; 0 means 1
+	ColorScheme string        // Preferred color scheme, "light" or "dark"; "" means light
+	Fonts       *text.FontSet // Web fonts from the document's @font-face rules; nil means none
+}
+
+// mediaType returns the media type, defaulting to screen.
+func (m Media) mediaType() string {
+	if m.Type == "" {
+		return "screen"
+	}
+	return m.Type
+}
+
+// resolution returns the device pixel ratio, defaulting to 1.
+func (m Media) resolution() float64 {
+	if m.Resolution > 0 {
+		return m.Resolution
+	}
+	return 1
+}
+
+// colorScheme returns the preferred color scheme, defaulting to light.
+func (m Media) colorScheme() string {
+	if m.ColorScheme == "" {
+		return "light"
+	}
+	return m.ColorScheme
+}
+
+// Phase 22: MediaQuery represents a @media rule's query list, such as
+// "screen and (min-width: 600px), print". It matches if any query matches.
+type MediaQuery struct {
+	Queries []MediaQueryPart
+	And     *MediaQuery // Query of an enclosing @media rule, which must also match
+}
+
+// MediaQueryPart is a single query of a media query list.
+type MediaQueryPart struct {
+	Not       bool            // "not" negates the whole query
+	MediaType string          // "all", "screen", "print", etc.
+	Condition *MediaCondition // nil if the query has no condition
+	Invalid   bool            // Unparseable queries never match
+}
+
+// MediaCondition is a node of a media condition: a test of a single media
+// feature, or the and/or/not of other conditions.
+type MediaCondition struct {
+	Op       string            // "and", "or", "not", or "" for a feature test
+	Children []*MediaCondition // Operands of and/or/not
+	Feature  string            // "width", "orientation", etc.
+	Compare  string            // "<", "<=", "=", ">=", ">", or "" in a boolean context
+	Value    string            // "768px", "landscape", etc.
+}
+
+// Phase 22: parseMediaQuery parses a media query list like
+// "@media screen and (min-width: 768px), print".
+func parseMediaQuery(mediaStr string) *MediaQuery {
+	mediaStr = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(mediaStr), "@media"))
+	mq := &MediaQuery{}
+	if mediaStr == "" {
+		// An empty list matches all media
+		mq.Queries = append(mq.Queries, MediaQueryPart{MediaType: "all"})
+		return mq
+	}
+	for _, queryStr := range splitSelectorGroup(mediaStr) {
+		query, ok := parseMediaQueryPart(strings.TrimSpace(queryStr))
+		if !ok {
+			query = MediaQueryPart{Invalid: true}
+		}
+		mq.Queries = append(mq.Queries, query)
+	}
+	return mq
+}
+
+// parseMediaQueryPart parses one query: a condition, or an optional "not" or
+// "only", a media type, and an optional "and" condition without "or".
+func parseMediaQueryPart(s string) (MediaQueryPart, bool) {
+	fields := splitTopLevelFields(s)
+	if len(fields) == 0 {
+		return MediaQueryPart{}, false
+	}
+	query := MediaQueryPart{MediaType: "all"}
+	if strings.HasPrefix(fields[0], "(") || strings.EqualFold(fields[0], "not") && len(fields) > 1 && strings.HasPrefix(fields[1], "(") {
+		cond, ok := parseMediaCondition(fields, true)
+		query.Condition = cond
+		return query, ok
+	}
+
+	switch strings.ToLower(fields[0]) {
+	case "not":
+		query.Not = true
+		fields = fields[1:]
+	case "only":
+		fields = fields[1:]
+	}
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "(") {
+		return query, false
+	}
+	query.MediaType = strings.ToLower(fields[0])
+	switch query.MediaType {
+	case "not", "only", "and", "or", "layer":
+		return query, false
+	}
+	if len(fields) == 1 {
+		return query, true
+	}
+	if !strings.EqualFold(fields[1], "and") || len(fields) < 3 {
+		return query, false
+	}
+	cond, ok := parseMediaCondition(fields[2:], false)
+	query.Condition = cond
+	return query, ok
+}
+
+// parseMediaCondition parses a condition split into top-level fields:
+// "not (a)", or "(a) and (b) ...", or "(a) or (b) ..." when allowOr is set.
+func parseMediaCondition(fields []string, allowOr bool) (*MediaCondition, bool) {
+	if len(fields) == 0 {
+		return nil, false
+	}
+	if strings.EqualFold(fields[0], "not") {
+		if len(fields) != 2 {
+			return nil, false
+		}
+		inner, ok := parseMediaInParens(fields[1])
+		return &MediaCondition{Op: "not", Children: []*MediaCondition{inner}}, ok
+	}
+
+	first, ok := parseMediaInParens(fields[0])
+	if !ok || len(fields) == 1 {
+		return first, ok
+	}
+	if len(fields)%2 == 0 {
+		return nil, false
+	}
+	cond := &MediaCondition{Op: strings.ToLower(fields[1]), Children: []*MediaCondition{first}}
+	if cond.Op != "and" && (cond.Op != "or" || !allowOr) {
+		return nil, false
+	}
+	for i := 1; i < len(fields); i += 2 {
+		if !strings.EqualFold(fields[i], cond.Op) {
+			return nil, false // and/or can't be mixed without parentheses
+		}
+		child, ok := parseMediaInParens(fields[i+1])
+		if !ok {
+			return nil, false
+		}
+		cond.Children = append(cond.Children, child)
+	}
+	return cond, true
+}
+
+// parseMediaInParens parses a parenthesized condition or media feature.
+func parseMediaInParens(s string) (*MediaCondition, bool) {
+	if !strings.HasPrefix(s, "(") || !strings.HasSuffix(s, ")") {
+		return nil, false
+	}
+	inner := strings.TrimSpace(s[1 : len(s)-1])
+	fields := splitTopLevelFields(inner)
+	if len(fields) == 0 {
+		return nil, false
+	}
+	if strings.HasPrefix(fields[0], "(") || strings.EqualFold(fields[0], "not") {
+		return parseMediaCondition(fields, true)
+	}
+	return parseMediaFeature(inner)
+}
+
+// parseMediaFeature parses the inside of a media feature test: "color",
+// "min-width: 600px", "width >= 600px", or "400px < width <= 800px". Range
+// forms are normalized so the feature name comes first.
+func parseMediaFeature(s string) (*MediaCondition, bool) {
+	if name, value, ok := strings.Cut(s, ":"); ok {
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return nil, false
+		}
+		if rest, ok := strings.CutPrefix(name, "min-"); ok {
+			return &MediaCondition{Feature: rest, Compare: ">=", Value: value}, true
+		}
+		if rest, ok := strings.CutPrefix(name, "max-"); ok {
+			return &MediaCondition{Feature: rest, Compare: "<=", Value: value}, true
+		}
+		return &MediaCondition{Feature: name, Compare: "=", Value: value}, true
+	}
+
+	// Range syntax: split at the comparison operators
+	var operands, ops []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] != '<' && s[i] != '>' && s[i] != '=' {
+			continue
+		}
+		op := s[i : i+1]
+		if s[i] != '=' && i+1 < len(s) && s[i+1] == '=' {
+			op = s[i : i+2]
+		}
+		operands = append(operands, strings.TrimSpace(s[start:i]))
+		ops = append(ops, op)
+		i += len(op) - 1
+		start = i + 1
+	}
+	operands = append(operands, strings.TrimSpace(s[start:]))
+
+	switch len(ops) {
+	case 0:
+		name := strings.ToLower(strings.TrimSpace(s))
+		if !isMediaFeatureName(name) {
+			return nil, false
+		}
+		return &MediaCondition{Feature: name}, true
+	case 1:
+		if isMediaFeatureName(operands[0]) {
+			return &MediaCondition{Feature: strings.ToLower(operands[0]), Compare: ops[0], Value: operands[1]}, true
+		}
+		if isMediaFeatureName(operands[1]) {
+			return &MediaCondition{Feature: strings.ToLower(operands[1]), Compare: flipComparison(ops[0]), Value: operands[0]}, true
+		}
+	case 2:
+		// "value op name op value": both operators must point the same way
+		name := strings.ToLower(operands[1])
+		if !isMediaFeatureName(name) || ops[0] == "=" || ops[1] == "=" || ops[0][0] != ops[1][0] {
+			return nil, false
+		}
+		return &MediaCondition{Op: "and", Children: []*MediaCondition{
+			{Feature: name, Compare: flipComparison(ops[0]), Value: operands[0]},
+			{Feature: name, Compare: ops[1], Value: operands[2]},
+		}}, true
+	}
+	return nil, false
+}
+
+// isMediaFeatureName returns true if s is an identifier rather than a value.
+func isMediaFeatureName(s string) bool {
+	if s == "" || (s[0] >= '0' && s[0] <= '9') || s[0] == '.' || s[0] == '-' && len(s) > 1 && s[1] >= '0' && s[1] <= '9' {
+		return false
+	}
+	for _, ch := range s {
+		if !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// flipComparison returns the operator with its operands swapped, so
+// "600px < width" becomes "width > 600px".
+func flipComparison(op string) string {
+	switch op {
+	case "<":
+		return ">"
+	case "<=":
+		return ">="
+	case ">":
+		return "<"
+	case ">=":
+		return "<="
+	}
+	return op
+}
+
+// Phase 22: EvaluateMediaQuery checks if a media query matches the media.
+func EvaluateMediaQuery(mq *MediaQuery, media Media) bool {
+	if mq == nil {
+		// No media query = always matches
+		return true
+	}
+	if !EvaluateMediaQuery(mq.And, media) {
+		return false
+	}
+	for _, query := range mq.Queries {
+		if query.matches(media) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns true if a single query matches the media.
+func (q MediaQueryPart) matches(media Media) bool {
+	if q.Invalid {
+		return false
+	}
+	result := q.MediaType == "all" || q.MediaType == media.mediaType()
+	if result && q.Condition != nil {
+		result = q.Condition.matches(media)
+	}
+	return result != q.Not
+}
+
+// matches evaluates the condition against the media. Unknown features and
+// invalid values evaluate to false.
+func (c *MediaCondition) matches(media Media) bool {
+	switch c.Op {
+	case "not":
+		return !c.Children[0].matches(media)
+	case "and":
+		for _, child := range c.Children {
+			if !child.matches(media) {
+				return false
+			}
+		}
+		return true
+	case "or":
+		for _, child := range c.Children {
+			if child.matches(media) {
+				return true
+			}
+		}
+		return false
+	}
+	return c.matchesFeature(media)
+}
+
+// matchesFeature evaluates a single media feature test.
+func (c *MediaCondition) matchesFeature(media Media) bool {
+	switch c.Feature {
+	case "width":
+		return c.compareLength(media.Width, media)
+	case "height":
+		return c.compareLength(media.Height, media)
+	case "aspect-ratio":
+		if media.Height == 0 {
+			return false
+		}
+		return c.compareNumber(media.Width/media.Height, parseMediaRatio)
+	case "resolution":
+		return c.compareNumber(media.resolution(), parseMediaResolution)
+	case "color":
+		return c.compareNumber(8, parseMediaInteger) // Bits per color component
+	case "monochrome", "grid", "color-index":
+		return c.compareNumber(0, parseMediaInteger)
+	case "orientation":
+		orientation := "landscape"
+		if media.Height >= media.Width {
+			orientation = "portrait"
+		}
+		return c.matchesKeyword(orientation)
+	case "prefers-color-scheme":
+		return c.matchesKeyword(media.colorScheme())
+	case "prefers-reduced-motion", "prefers-contrast", "prefers-reduced-transparency":
+		return c.matchesKeyword("no-preference")
+	case "hover", "any-hover":
+		return c.matchesKeyword("hover")
+	case "pointer", "any-pointer":
+		return c.matchesKeyword("fine")
+	case "update":
+		return c.matchesKeyword("fast")
+	}
+	return false
+}
+
+// compareLength compares a length feature such as width. Relative units in
+// media queries use the initial font size.
+func (c *MediaCondition) compareLength(actual float64, media Media) bool {
+	return c.compareNumber(actual, func(val string) (float64, bool) {
+		return ParseLengthFull(val, 16.0, media.Width, media.Height)
+	})
+}
+
+// compareNumber compares a numeric feature with the test's value, parsed
+// with parse. In a boolean context the feature matches if it's non-zero.
+func (c *MediaCondition) compareNumber(actual float64, parse func(string) (float64, bool)) bool {
+	if c.Compare == "" {
+		return actual != 0
+	}
+	want, ok := parse(c.Value)
+	if !ok {
+		return false
+	}
+	const epsilon = 1e-9
+	switch c.Compare {
+	case "<":
+		return actual < want-epsilon
+	case "<=":
+		return actual <= want+epsilon
+	case ">":
+		return actual > want+epsilon
+	case ">=":
+		return actual >= want-epsilon
+	}
+	return actual >= want-epsilon && actual <= want+epsilon
+}
+
+// matchesKeyword compares a discrete feature like orientation. In a boolean
+// context the feature matches unless its value is none or no-preference.
+func (c *MediaCondition) matchesKeyword(actual string) bool {
+	switch c.Compare {
+	case "":
+		return actual != "none" && actual != "no-preference"
+	case "=":
+		return strings.EqualFold(strings.TrimSpace(c.Value), actual)
+	}
+	return false // Discrete features don't support range comparisons
+}
+
+// parseMediaRatio parses a ratio like "16/9" or a plain number.
+func parseMediaRatio(val string) (float64, bool) {
+	num, den, hasDen := strings.Cut(val, "/")
+	n, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	if !hasDen {
+		return n, true
+	}
+	d, err := strconv.ParseFloat(strings.TrimSpace(den), 64)
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	return n / d, true
+}
+
+// parseMediaResolution parses a resolution in dppx, x, dpi, or dpcm and
+// returns it in dppx.
+func parseMediaResolution(val string) (float64, bool) {
+	val = strings.ToLower(strings.TrimSpace(val))
+	for _, unit := range []struct {
+		suffix string
+		dppx   float64
+	}{{"dppx", 1}, {"dpcm", 2.54 / 96}, {"dpi", 1.0 / 96}, {"x", 1}} {
+		if numStr, ok := strings.CutSuffix(val, unit.suffix); ok {
+			num, err := strconv.ParseFloat(numStr, 64)
+			if err != nil {
+				return 0, false
+			}
+			return num * unit.dppx, true
+		}
+	}
+	return 0, false
+}
+
+// parseMediaInteger parses an integer feature value like "8".
+func parseMediaInteger(val string) (float64, bool) {
+	n, err := strconv.Atoi(strings.TrimSpace(val))
+	return float64(n), err == nil
+}
@@ -0,0 +1,90 @@
+package css
+
+import "testing"
+
+func TestEvaluateMediaQuery(t *testing.T) {
+	desktop := Media{Width: 1024, Height: 768}
+	tests := []struct {
+		query string
+		media Media
+		want  bool
+	}{
+		{"@media screen and (min-width: 768px)", desktop, true},
+		{"@media screen and (max-width: 767px)", desktop, false},
+		{"@media print", desktop, false},
+		{"@media print", Media{Width: 1024, Height: 768, Type: "print"}, true},
+		{"@media print, (min-width: 1000px)", desktop, true},
+		{"@media not print", desktop, true},
+		{"@media not screen and (min-width: 768px)", desktop, false},
+		{"@media only screen and (orientation: landscape)", desktop, true},
+		{"@media (orientation: portrait)", desktop, false},
+		{"@media (width >= 1024px)", desktop, true},
+		{"@media (width > 1024px)", desktop, false},
+		{"@media (600px <= width < 1100px)", desktop, true},
+		{"@media (1100px > width)", desktop, true},
+		{"@media (min-width: 40em)", desktop, true},
+		{"@media (min-width: 2000px) or (min-height: 700px)", desktop, true},
+		{"@media not (min-width: 2000px)", desktop, true},
+		{"@media ((min-width: 2000px) or (color)) and (max-width: 1100px)", desktop, true},
+		{"@media screen and (min-width: 2000px) or (color)", desktop, false}, // "or" needs parentheses
+		{"@media (aspect-ratio: 4/3)", desktop, true},
+		{"@media (min-resolution: 2dppx)", desktop, false},
+		{"@media (min-resolution: 2dppx)", Media{Width: 1024, Height: 768, Resolution: 2}, true},
+		{"@media (min-resolution: 192dpi)", Media{Width: 1024, Height: 768, Resolution: 2}, true},
+		{"@media (prefers-color-scheme: dark)", desktop, false},
+		{"@media (prefers-color-scheme: dark)", Media{Width: 1024, Height: 768, ColorScheme: "dark"}, true},
+		{"@media (prefers-color-scheme: light)", desktop, true},
+		{"@media (unknown-feature: 1)", desktop, false},
+		{"@media garbage (", desktop, false},
+	}
+	for _, tt := range tests {
+		if got := EvaluateMediaQuery(parseMediaQuery(tt.query), tt.media); got != tt.want {
+			t.Errorf("%q on %+v: got %v, want %v", tt.query, tt.media, got, tt.want)
+		}
+	}
+}
+
+func TestMediaRule_ColorScheme(t *testing.T) {
+	stylesheet, err := ParseStylesheet(`
+		p { color: black; }
+		@media (prefers-color-scheme: dark) { p { color: white; } }
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(stylesheet.Rules); n != 2 {
+		t.Fatalf("expected 2 rules, got %d", n)
+	}
+	dark := stylesheet.Rules[1]
+	if EvaluateMediaQuery(dark.MediaQuery, Media{Width: 800, Height: 600}) {
+		t.Error("dark rule should not apply with the default light scheme")
+	}
+	if !EvaluateMediaQuery(dark.MediaQuery, Media{Width: 800, Height: 600, ColorScheme: "dark"}) {
+		t.Error("dark rule should apply with a dark scheme")
+	}
+}
+
+func TestMediaRule_Nested(t *testing.T) {
+	stylesheet, err := ParseStylesheet(`
+		@media screen {
+			@media (min-width: 600px) { p { color: red; } }
+			div { color: blue; }
+		}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(stylesheet.Rules); n != 2 {
+		t.Fatalf("expected 2 rules, got %d", n)
+	}
+	nested := stylesheet.Rules[0]
+	if !EvaluateMediaQuery(nested.MediaQuery, Media{Width: 800, Height: 600}) {
+		t.Error("nested rule should apply when both queries match")
+	}
+	if EvaluateMediaQuery(nested.MediaQuery, Media{Width: 500, Height: 600}) {
+		t.Error("nested rule should not apply when the inner query fails")
+	}
+	if EvaluateMediaQuery(nested.MediaQuery, Media{Width: 800, Height: 600, Type: "print"}) {
+		t.Error("nested rule should not apply when the outer query fails")
+	}
+}
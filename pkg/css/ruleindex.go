@@ -0,0 +1,119 @@
+package css
+
+import (
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"louis14/pkg/html"
+)
+
+// ruleIndex holds the rules of a document's stylesheets that apply on a
+// medium, bucketed by what their subject compound selector (the rightmost
+// part) requires: an ID, else a class, else a tag. Matching a node then
+// only tests the rules in its ID's, classes', and tag's buckets and the
+// rules that require none of them, instead of every rule.
+type ruleIndex struct {
+	rules     []Rule           // In source order across the stylesheets
+	byID      map[string][]int // Positions in rules, ascending
+	byClass   map[string][]int
+	byTag     map[string][]int
+	universal []int
+}
+
+// newRuleIndex indexes the rules of stylesheets whose media query matches
+// media. Pseudo-element rules are left out, as FindMatchingRules leaves
+// them out.
+func newRuleIndex(stylesheets []*Stylesheet, media Media) *ruleIndex {
+	ix := &ruleIndex{
+		byID:    make(map[string][]int),
+		byClass: make(map[string][]int),
+		byTag:   make(map[string][]int),
+	}
+	for _, stylesheet := range stylesheets {
+		for _, rule := range stylesheet.Rules {
+			if rule.Selector.PseudoElement != "" || len(rule.Selector.Parts) == 0 || !EvaluateMediaQuery(rule.MediaQuery, media) {
+				continue
+			}
+			pos := len(ix.rules)
+			ix.rules = append(ix.rules, rule)
+			subject := rule.Selector.Parts[len(rule.Selector.Parts)-1]
+			switch {
+			case subject.ID != "":
+				ix.byID[subject.ID] = append(ix.byID[subject.ID], pos)
+			case len(subject.Classes) > 0:
+				ix.byClass[subject.Classes[0]] = append(ix.byClass[subject.Classes[0]], pos)
+			case subject.Element != "" && subject.Element != "*":
+				ix.byTag[subject.Element] = append(ix.byTag[subject.Element], pos)
+			default:
+				ix.universal = append(ix.universal, pos)
+			}
+		}
+	}
+	return ix
+}
+
+// match returns the positions of the rules matching node, in source order.
+func (ix *ruleIndex) match(node *html.Node) []int {
+	if node.Type != html.ElementNode {
+		return nil
+	}
+	candidates := append([]int(nil), ix.universal...)
+	candidates = append(candidates, ix.byTag[node.TagName]...)
+	if id, ok := node.GetAttribute("id"); ok {
+		candidates = append(candidates, ix.byID[id]...)
+	}
+	if class, ok := node.GetAttribute("class"); ok {
+		classes := strings.Fields(class)
+		for i, c := range classes {
+			if !slices.Contains(classes[:i], c) { // A repeated class adds its rules once
+				candidates = append(candidates, ix.byClass[c]...)
+			}
+		}
+	}
+	sort.Ints(candidates)
+
+	matched := candidates[:0]
+	for _, pos := range candidates {
+		if MatchesSelector(node, ix.rules[pos].Selector) {
+			matched = append(matched, pos)
+		}
+	}
+	return matched
+}
+
+// rulesAt returns the rules at the given positions.
+func (ix *ruleIndex) rulesAt(positions []int) []Rule {
+	rules := make([]Rule, len(positions))
+	for i, pos := range positions {
+		rules[i] = ix.rules[pos]
+	}
+	return rules
+}
+
+// styleShareKey identifies the elements among a set of siblings that get
+// the same computed style: those with the same tag and attributes, which
+// decide their user agent styles and inline style, matched by the same
+// rules. Siblings share a parent, so they inherit the same values.
+func styleShareKey(node *html.Node, matched []int) string {
+	var b strings.Builder
+	b.WriteString(node.TagName)
+	names := make([]string, 0, len(node.Attributes))
+	for name := range node.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b.WriteByte(0)
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(node.Attributes[name])
+	}
+	b.WriteByte(0)
+	for _, pos := range matched {
+		b.WriteString(strconv.Itoa(pos))
+		b.WriteByte(',')
+	}
+	return b.String()
+}
@@ -5,18 +5,56 @@ import (
 	"math"
 	"strconv"
 	"strings"
+
+	"louis14/pkg/text"
 )
 
 type Style struct {
 	Properties      map[string]string
 	ViewportWidth   float64 // Viewport width in pixels (for vw/vmin/vmax units)
 	ViewportHeight  float64 // Viewport height in pixels (for vh/vmin/vmax units)
+	RootFontSize    float64 // Root element font size in pixels (for rem units); 0 means 16px
+	Fonts           *text.FontSet // Web fonts from the document's @font-face rules; nil means none
 }
 
 func NewStyle() *Style {
 	return &Style{Properties: make(map[string]string)}
 }
 
+// Clone returns a copy of the style that can be changed independently.
+func (s *Style) Clone() *Style {
+	clone := *s
+	clone.Properties = make(map[string]string, len(s.Properties))
+	for k, v := range s.Properties {
+		clone.Properties[k] = v
+	}
+	return &clone
+}
+
+// Equal reports whether two styles have identical properties, viewport,
+// root font size, and fonts.
+func (s *Style) Equal(other *Style) bool {
+	if s == other {
+		return true
+	}
+	if s == nil || other == nil {
+		return false
+	}
+	if s.ViewportWidth != other.ViewportWidth || s.ViewportHeight != other.ViewportHeight ||
+		s.RootFontSize != other.RootFontSize || s.Fonts != other.Fonts {
+		return false
+	}
+	if len(s.Properties) != len(other.Properties) {
+		return false
+	}
+	for k, v := range s.Properties {
+		if ov, ok := other.Properties[k]; !ok || ov != v {
+			return false
+		}
+	}
+	return true
+}
+
 func (s *Style) Get(property string) (string, bool) {
 	val, ok := s.Properties[property]
 	if !ok {
@@ -109,7 +147,18 @@ func (s *Style) GetLength(property string) (float64, bool) {
 	if !ok {
 		return 0, false
 	}
-	return ParseLengthFull(val, s.GetFontSize(), s.ViewportWidth, s.ViewportHeight)
+	return parseLength(val, s.lengthContext())
+}
+
+// lengthContext returns the sizes the style's relative lengths resolve
+// against, without a percentage base.
+func (s *Style) lengthContext() LengthContext {
+	return LengthContext{
+		FontSize:       s.GetFontSize(),
+		RootFontSize:   s.RootFontSize,
+		ViewportWidth:  s.ViewportWidth,
+		ViewportHeight: s.ViewportHeight,
+	}
 }
 
 // ParsePercentage parses a percentage value (e.g., "140%") and returns the number (e.g., 140).
@@ -141,22 +190,26 @@ func ParseLength(val string) (float64, bool) {
 	return ParseLengthFull(val, 16.0, 0, 0)
 }
 
-// ParseLengthWithFontSize parses a length value with em and rem support.
+// ParseLengthWithFontSize parses a length value with em and rem support,
+// taking the root font size to be 16px.
 func ParseLengthWithFontSize(val string, fontSize float64) (float64, bool) {
 	return ParseLengthFull(val, fontSize, 0, 0)
 }
 
-// ParseLengthFull parses a length value with em, rem, and viewport unit support.
+// ParseLengthFull parses a length value with em, rem, and viewport unit
+// support, taking the root font size to be 16px.
 func ParseLengthFull(val string, fontSize, viewportWidth, viewportHeight float64) (float64, bool) {
+	return parseLength(val, LengthContext{FontSize: fontSize, ViewportWidth: viewportWidth, ViewportHeight: viewportHeight})
+}
+
+// parseLength parses a length value, resolving relative units against ctx.
+// Percentages are not lengths; see ParseLengthPercentage.
+func parseLength(val string, ctx LengthContext) (float64, bool) {
 	val = strings.TrimSpace(val)
+	fontSize, viewportWidth, viewportHeight := ctx.FontSize, ctx.ViewportWidth, ctx.ViewportHeight
 	// Handle calc() expressions
-	if strings.HasPrefix(val, "calc(") && strings.HasSuffix(val, ")") {
-		expr := val[5 : len(val)-1] // strip "calc(" and ")"
-		result, ok := evalCalcExpr(expr, fontSize)
-		if ok {
-			return result, true
-		}
-		return 0, false
+	if isCalc(val) {
+		return evalCalc(val, ctx)
 	}
 	// Viewport units (check vmin/vmax before vw/vh to avoid suffix conflicts)
 	if strings.HasSuffix(val, "vmin") {
@@ -192,13 +245,13 @@ func ParseLengthFull(val string, fontSize, viewportWidth, viewportHeight float64
 		return num * viewportHeight / 100, true
 	}
 	if strings.HasSuffix(val, "rem") {
-		// rem is relative to root font size (typically 16px)
+		// rem is relative to the root element's font size
 		numStr := strings.TrimSuffix(val, "rem")
 		num, err := strconv.ParseFloat(numStr, 64)
 		if err != nil {
 			return 0, false
 		}
-		return num * 16.0, true // Root font size = 16px
+		return num * ctx.rootFontSize(), true
 	}
 	if strings.HasSuffix(val, "em") {
 		numStr := strings.TrimSuffix(val, "em")
@@ -269,167 +322,6 @@ func ParseLengthFull(val string, fontSize, viewportWidth, viewportHeight float64
 	return num, true
 }
 
-// evalCalcExpr evaluates a CSS calc() expression with proper operator precedence.
-// Supports +, -, *, / operators and px/em/rem/%  values.
-func evalCalcExpr(expr string, fontSize float64) (float64, bool) {
-	expr = strings.TrimSpace(expr)
-	// Tokenize: split into numbers (with optional units) and operators
-	tokens := tokenizeCalc(expr)
-	if len(tokens) == 0 {
-		return 0, false
-	}
-	// Parse with operator precedence: * and / before + and -
-	result, ok := parseCalcAddSub(tokens, 0, fontSize)
-	if !ok {
-		return 0, false
-	}
-	return result.value, true
-}
-
-type calcResult struct {
-	value float64
-	pos   int // position in token slice after consuming
-}
-
-func parseCalcAddSub(tokens []string, pos int, fontSize float64) (calcResult, bool) {
-	left, ok := parseCalcMulDiv(tokens, pos, fontSize)
-	if !ok {
-		return calcResult{}, false
-	}
-	for left.pos < len(tokens) {
-		op := tokens[left.pos]
-		if op != "+" && op != "-" {
-			break
-		}
-		right, ok := parseCalcMulDiv(tokens, left.pos+1, fontSize)
-		if !ok {
-			return calcResult{}, false
-		}
-		if op == "+" {
-			left.value += right.value
-		} else {
-			left.value -= right.value
-		}
-		left.pos = right.pos
-	}
-	return left, true
-}
-
-func parseCalcMulDiv(tokens []string, pos int, fontSize float64) (calcResult, bool) {
-	left, ok := parseCalcAtom(tokens, pos, fontSize)
-	if !ok {
-		return calcResult{}, false
-	}
-	for left.pos < len(tokens) {
-		op := tokens[left.pos]
-		if op != "*" && op != "/" {
-			break
-		}
-		right, ok := parseCalcAtom(tokens, left.pos+1, fontSize)
-		if !ok {
-			return calcResult{}, false
-		}
-		if op == "*" {
-			left.value *= right.value
-		} else {
-			if right.value == 0 {
-				return calcResult{}, false
-			}
-			left.value /= right.value
-		}
-		left.pos = right.pos
-	}
-	return left, true
-}
-
-func parseCalcAtom(tokens []string, pos int, fontSize float64) (calcResult, bool) {
-	if pos >= len(tokens) {
-		return calcResult{}, false
-	}
-	token := tokens[pos]
-	// Handle parenthesized sub-expressions
-	if token == "(" {
-		result, ok := parseCalcAddSub(tokens, pos+1, fontSize)
-		if !ok || result.pos >= len(tokens) || tokens[result.pos] != ")" {
-			return calcResult{}, false
-		}
-		result.pos++ // consume ")"
-		return result, true
-	}
-	// Parse as a length value or plain number
-	val, ok := ParseLengthWithFontSize(token, fontSize)
-	if ok {
-		return calcResult{value: val, pos: pos + 1}, true
-	}
-	// Try as plain number (unitless, e.g., divisor)
-	num, err := strconv.ParseFloat(token, 64)
-	if err != nil {
-		return calcResult{}, false
-	}
-	return calcResult{value: num, pos: pos + 1}, true
-}
-
-// tokenizeCalc splits a calc expression into tokens: numbers with units, operators, parens.
-func tokenizeCalc(expr string) []string {
-	var tokens []string
-	i := 0
-	for i < len(expr) {
-		ch := expr[i]
-		if ch == ' ' || ch == '\t' {
-			i++
-			continue
-		}
-		if ch == '(' || ch == ')' {
-			tokens = append(tokens, string(ch))
-			i++
-			continue
-		}
-		if ch == '+' || ch == '*' || ch == '/' {
-			tokens = append(tokens, string(ch))
-			i++
-			continue
-		}
-		// Minus: could be operator or negative sign
-		if ch == '-' {
-			// It's an operator if the previous token is a number/closing paren
-			if len(tokens) > 0 {
-				prev := tokens[len(tokens)-1]
-				if prev != "+" && prev != "-" && prev != "*" && prev != "/" && prev != "(" {
-					tokens = append(tokens, "-")
-					i++
-					continue
-				}
-			}
-			// Otherwise it's part of a number (negative sign) — fall through to number parsing
-		}
-		// Number (possibly with unit suffix)
-		start := i
-		if expr[i] == '-' {
-			i++
-		}
-		for i < len(expr) && ((expr[i] >= '0' && expr[i] <= '9') || expr[i] == '.') {
-			i++
-		}
-		// Consume unit suffix (px, em, rem, %, etc.)
-		unitStart := i
-		for i < len(expr) && ((expr[i] >= 'a' && expr[i] <= 'z') || expr[i] == '%') {
-			i++
-		}
-		if i > start {
-			token := expr[start:i]
-			// Handle bare % at unitStart
-			if i > unitStart && expr[unitStart:i] == "%" {
-				// Keep the full token with %
-			}
-			tokens = append(tokens, token)
-		} else {
-			// Unknown character, skip
-			i++
-		}
-	}
-	return tokens
-}
-
 // Phase 2: Box model helpers
 
 // BoxEdge represents the four sides of a box (top, right, bottom, left)
@@ -482,17 +374,17 @@ func (s *Style) GetBorderWidth() BoxEdge {
 		Bottom: s.getLengthOrZero("border-bottom-width"),
 		Left:   s.getLengthOrZero("border-left-width"),
 	}
-	// CSS 2.1 §8.5.1: border-style:none computes border-width to 0
-	if styles.Top == BorderStyleNone {
+	// CSS 2.1 §8.5.1: border-style:none or hidden computes border-width to 0
+	if styles.Top.IsNone() {
 		edge.Top = 0
 	}
-	if styles.Right == BorderStyleNone {
+	if styles.Right.IsNone() {
 		edge.Right = 0
 	}
-	if styles.Bottom == BorderStyleNone {
+	if styles.Bottom.IsNone() {
 		edge.Bottom = 0
 	}
-	if styles.Left == BorderStyleNone {
+	if styles.Left.IsNone() {
 		edge.Left = 0
 	}
 	return edge
@@ -525,12 +417,23 @@ type BorderStyle string
 
 const (
 	BorderStyleNone   BorderStyle = "none"
+	BorderStyleHidden BorderStyle = "hidden"
 	BorderStyleSolid  BorderStyle = "solid"
 	BorderStyleDashed BorderStyle = "dashed"
 	BorderStyleDotted BorderStyle = "dotted"
 	BorderStyleDouble BorderStyle = "double"
+	BorderStyleGroove BorderStyle = "groove"
+	BorderStyleRidge  BorderStyle = "ridge"
+	BorderStyleInset  BorderStyle = "inset"
+	BorderStyleOutset BorderStyle = "outset"
 )
 
+// IsNone returns true for the styles that draw no border, none and hidden,
+// whose border widths compute to 0.
+func (b BorderStyle) IsNone() bool {
+	return b == BorderStyleNone || b == BorderStyleHidden
+}
+
 // BorderStyleEdge represents border styles for all four sides
 type BorderStyleEdge struct {
 	Top    BorderStyle
@@ -552,15 +455,8 @@ func (s *Style) GetBorderStyle() BorderStyleEdge {
 // getBorderStyleSide returns the border style for a specific side (default: solid)
 func (s *Style) getBorderStyleSide(property string) BorderStyle {
 	if style, ok := s.Get(property); ok {
-		switch style {
-		case "none":
-			return BorderStyleNone
-		case "dashed":
-			return BorderStyleDashed
-		case "dotted":
-			return BorderStyleDotted
-		case "double":
-			return BorderStyleDouble
+		if style = strings.ToLower(style); style != "solid" && isBorderStyleKeyword(style) {
+			return BorderStyle(style)
 		}
 	}
 	return BorderStyleSolid // Default to solid
@@ -601,34 +497,128 @@ func (s *Style) GetBorderRadius() float64 {
 }
 
 // GetBorderRadiusCorners returns per-corner border-radius values.
+// Only the horizontal radius of elliptical corners is reported, and
+// percentages resolve to zero; use GetBorderRadii for the full geometry.
 func (s *Style) GetBorderRadiusCorners() BorderRadiusCorners {
-	var corners BorderRadiusCorners
+	radii := s.borderRadii(0, 0)
+	return BorderRadiusCorners{radii.TopLeft.X, radii.TopRight.X, radii.BottomRight.X, radii.BottomLeft.X}
+}
+
+// CornerRadius is the elliptical radius of one corner (CSS Backgrounds 3 §5.1).
+type CornerRadius struct {
+	X float64 // Horizontal radius
+	Y float64 // Vertical radius
+}
+
+// IsZero returns true if the corner is square.
+func (c CornerRadius) IsZero() bool {
+	return c.X <= 0 || c.Y <= 0
+}
+
+// BorderRadii holds the resolved elliptical radii of a box's four corners.
+type BorderRadii struct {
+	TopLeft     CornerRadius
+	TopRight    CornerRadius
+	BottomRight CornerRadius
+	BottomLeft  CornerRadius
+}
+
+// IsZero returns true if every corner is square.
+func (r BorderRadii) IsZero() bool {
+	return r.TopLeft.IsZero() && r.TopRight.IsZero() && r.BottomRight.IsZero() && r.BottomLeft.IsZero()
+}
 
-	// Check individual corners first (higher specificity)
-	if r, ok := s.GetLength("border-top-left-radius"); ok {
-		corners.TopLeft = r
+// Inset returns the radii of a box inset by the given edge widths, as used
+// for the padding edge of a rounded border box (CSS Backgrounds 3 §5.2).
+func (r BorderRadii) Inset(top, right, bottom, left float64) BorderRadii {
+	shrink := func(c CornerRadius, dx, dy float64) CornerRadius {
+		return CornerRadius{X: math.Max(0, c.X-dx), Y: math.Max(0, c.Y-dy)}
 	}
-	if r, ok := s.GetLength("border-top-right-radius"); ok {
-		corners.TopRight = r
+	return BorderRadii{
+		TopLeft:     shrink(r.TopLeft, left, top),
+		TopRight:    shrink(r.TopRight, right, top),
+		BottomRight: shrink(r.BottomRight, right, bottom),
+		BottomLeft:  shrink(r.BottomLeft, left, bottom),
 	}
-	if r, ok := s.GetLength("border-bottom-right-radius"); ok {
-		corners.BottomRight = r
+}
+
+// GetBorderRadii returns the corner radii for a border box of the given
+// size. Percentages resolve against the box width (horizontal radii) and
+// height (vertical radii), and radii that would overlap are scaled down
+// uniformly (CSS Backgrounds 3 §5.5).
+func (s *Style) GetBorderRadii(width, height float64) BorderRadii {
+	r := s.borderRadii(width, height)
+	if r.IsZero() {
+		return BorderRadii{}
 	}
-	if r, ok := s.GetLength("border-bottom-left-radius"); ok {
-		corners.BottomLeft = r
+	f := 1.0
+	for _, pair := range [][3]float64{
+		{width, r.TopLeft.X, r.TopRight.X},
+		{width, r.BottomLeft.X, r.BottomRight.X},
+		{height, r.TopLeft.Y, r.BottomLeft.Y},
+		{height, r.TopRight.Y, r.BottomRight.Y},
+	} {
+		if sum := pair[1] + pair[2]; sum > 0 && pair[0]/sum < f {
+			f = pair[0] / sum
+		}
 	}
+	if f < 1 {
+		for _, c := range []*CornerRadius{&r.TopLeft, &r.TopRight, &r.BottomRight, &r.BottomLeft} {
+			c.X *= f
+			c.Y *= f
+		}
+	}
+	return r
+}
 
-	// If any individual corner was set, return those values
-	if corners.TopLeft > 0 || corners.TopRight > 0 || corners.BottomRight > 0 || corners.BottomLeft > 0 {
-		return corners
+// borderRadii reads the corner radii without overlap scaling.
+func (s *Style) borderRadii(width, height float64) BorderRadii {
+	var r BorderRadii
+	corners := []*CornerRadius{&r.TopLeft, &r.TopRight, &r.BottomRight, &r.BottomLeft}
+	set := false
+	for i, prop := range []string{"border-top-left-radius", "border-top-right-radius", "border-bottom-right-radius", "border-bottom-left-radius"} {
+		if val, ok := s.Get(prop); ok {
+			*corners[i] = s.parseCornerRadius(val, width, height)
+			set = set || !corners[i].IsZero()
+		}
+	}
+	if set {
+		return r
 	}
 
 	// Fall back to shorthand border-radius (already expanded by expandShorthand)
-	if r, ok := s.GetLength("border-radius"); ok {
-		return BorderRadiusCorners{r, r, r, r}
+	if val, ok := s.Get("border-radius"); ok {
+		c := s.parseCornerRadius(val, width, height)
+		return BorderRadii{c, c, c, c}
 	}
+	return r
+}
 
-	return corners // all zeros
+// parseCornerRadius parses a corner radius longhand: one or two lengths or
+// percentages (horizontal, then vertical).
+func (s *Style) parseCornerRadius(val string, width, height float64) CornerRadius {
+	parts := strings.Fields(val)
+	if len(parts) == 0 {
+		return CornerRadius{}
+	}
+	resolve := func(v string, basis float64) float64 {
+		if pct, ok := ParsePercentage(v); ok {
+			return math.Max(0, pct*basis/100)
+		}
+		if l, ok := parseLength(v, s.lengthContext()); ok {
+			return math.Max(0, l)
+		}
+		return 0
+	}
+	c := CornerRadius{X: resolve(parts[0], width)}
+	if len(parts) > 1 {
+		c.Y = resolve(parts[1], height)
+	} else if strings.HasSuffix(parts[0], "%") {
+		c.Y = resolve(parts[0], height)
+	} else {
+		c.Y = c.X
+	}
+	return c
 }
 
 // GetMaxWidth returns the max-width value if set
@@ -646,6 +636,7 @@ const (
 	PositionRelative PositionType = "relative"
 	PositionAbsolute PositionType = "absolute"
 	PositionFixed    PositionType = "fixed"
+	PositionSticky   PositionType = "sticky"
 )
 
 // GetPosition returns the position type (default: static)
@@ -661,6 +652,8 @@ func (s *Style) GetPosition() PositionType {
 		return PositionAbsolute
 	case "fixed":
 		return PositionFixed
+	case "sticky", "-webkit-sticky":
+		return PositionSticky
 	default:
 		return PositionStatic
 	}
@@ -751,7 +744,7 @@ func expandShorthand(style *Style, property, value string) {
 		switch property {
 		case "margin", "padding", "border", "border-top", "border-right",
 			"border-bottom", "border-left", "border-width", "border-style",
-			"border-color", "font", "flex", "flex-flow", "list-style", "gap":
+			"border-color", "font", "flex", "flex-flow", "list-style", "gap", "grid-gap":
 			// Store as the shorthand property — var() resolved at read time
 			style.Set(property, value)
 			return
@@ -780,6 +773,8 @@ func expandShorthand(style *Style, property, value string) {
 		expandBorderRadiusProperty(style, value)
 	case "background":
 		expandBackgroundProperty(style, value)
+	case "transition":
+		expandTransitionProperty(style, value)
 	case "font":
 		expandFontProperty(style, value)
 	case "flex":
@@ -788,17 +783,28 @@ func expandShorthand(style *Style, property, value string) {
 		expandFlexFlowProperty(style, value)
 	case "list-style":
 		// list-style shorthand: sets list-style-type, list-style-position, list-style-image
-		// Common values: "none", "disc", "decimal", "circle", "square"
+		// Common values: "none", "disc", "decimal", "circle", "square", "inside"
 		// "none" sets list-style-type: none and list-style-image: none
 		if value == "none" {
 			style.Set("list-style-type", "none")
 			style.Set("list-style-image", "none")
-		} else {
-			// For other values, treat as list-style-type
+		} else if strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "'") {
+			// A marker string, which may contain spaces
 			style.Set("list-style-type", value)
+		} else {
+			for _, part := range strings.Fields(value) {
+				switch {
+				case part == "inside" || part == "outside":
+					style.Set("list-style-position", part)
+				case strings.HasPrefix(part, "url("):
+					style.Set("list-style-image", part)
+				default:
+					style.Set("list-style-type", part)
+				}
+			}
 		}
-	case "gap":
-		// gap shorthand: sets both row-gap and column-gap
+	case "gap", "grid-gap":
+		// gap shorthand (grid-gap is its legacy name): sets both row-gap and column-gap
 		parts := strings.Fields(value)
 		if len(parts) == 1 {
 			style.Set("row-gap", parts[0])
@@ -807,6 +813,10 @@ func expandShorthand(style *Style, property, value string) {
 			style.Set("row-gap", parts[0])
 			style.Set("column-gap", parts[1])
 		}
+	case "grid-row-gap":
+		style.Set("row-gap", value)
+	case "grid-column-gap":
+		style.Set("column-gap", value)
 	default:
 		// Regular property
 		style.Set(property, value)
@@ -816,45 +826,59 @@ func expandShorthand(style *Style, property, value string) {
 // expandBorderRadiusProperty expands border-radius shorthand into per-corner properties.
 // CSS spec: border-radius: TL TR BR BL (1-4 values, same pattern as margin/padding)
 // Single value: all corners. Two values: TL+BR, TR+BL. Three: TL, TR+BL, BR. Four: TL TR BR BL.
-// Note: the "/" syntax for elliptical radii is not supported.
+// Elliptical radii use "horizontal / vertical" lists, each expanded the same way;
+// the longhands then hold "horizontal vertical" pairs.
 func expandBorderRadiusProperty(style *Style, value string) {
-	// Ignore elliptical radii (slash syntax) for now
-	if strings.Contains(value, "/") {
-		// Just use the first (horizontal) set
-		value = strings.TrimSpace(strings.SplitN(value, "/", 2)[0])
+	horizontal, vertical := value, ""
+	if i := strings.Index(value, "/"); i != -1 {
+		horizontal, vertical = strings.TrimSpace(value[:i]), strings.TrimSpace(value[i+1:])
 	}
 
-	parts := strings.Fields(value)
+	h := expandCornerValues(strings.Fields(horizontal))
+	if h == nil {
+		return
+	}
+	if vertical == "" && strings.Fields(horizontal)[0] == horizontal {
+		// All corners the same — store as shorthand for backward compat
+		style.Set("border-radius", horizontal)
+		return
+	}
+	v := h
+	if vertical != "" {
+		if v = expandCornerValues(strings.Fields(vertical)); v == nil {
+			return
+		}
+	}
+	for i, prop := range []string{"border-top-left-radius", "border-top-right-radius", "border-bottom-right-radius", "border-bottom-left-radius"} {
+		if h[i] == v[i] {
+			style.Set(prop, h[i])
+		} else {
+			style.Set(prop, h[i]+" "+v[i])
+		}
+	}
+}
+
+// expandCornerValues expands 1-4 corner values to TL, TR, BR, BL order.
+// Returns nil for any other count.
+func expandCornerValues(parts []string) []string {
 	switch len(parts) {
 	case 1:
-		// All corners the same — store as shorthand for backward compat
-		style.Set("border-radius", parts[0])
+		return []string{parts[0], parts[0], parts[0], parts[0]}
 	case 2:
-		// TL+BR, TR+BL
-		style.Set("border-top-left-radius", parts[0])
-		style.Set("border-bottom-right-radius", parts[0])
-		style.Set("border-top-right-radius", parts[1])
-		style.Set("border-bottom-left-radius", parts[1])
+		return []string{parts[0], parts[1], parts[0], parts[1]}
 	case 3:
-		// TL, TR+BL, BR
-		style.Set("border-top-left-radius", parts[0])
-		style.Set("border-top-right-radius", parts[1])
-		style.Set("border-bottom-left-radius", parts[1])
-		style.Set("border-bottom-right-radius", parts[2])
+		return []string{parts[0], parts[1], parts[2], parts[1]}
 	case 4:
-		// TL, TR, BR, BL
-		style.Set("border-top-left-radius", parts[0])
-		style.Set("border-top-right-radius", parts[1])
-		style.Set("border-bottom-right-radius", parts[2])
-		style.Set("border-bottom-left-radius", parts[3])
+		return parts
 	}
+	return nil
 }
 
 // expandBoxProperty expands margin/padding shorthand
 // Supports: "10px" (all), "10px 20px" (vertical horizontal),
 //           "10px 20px 30px" (top h bottom), "10px 20px 30px 40px" (t r b l)
 func expandBoxProperty(style *Style, prefix, value string) {
-	parts := strings.Fields(value)
+	parts := splitTopLevelFields(value)
 
 	switch len(parts) {
 	case 1:
@@ -886,7 +910,7 @@ func expandBoxProperty(style *Style, prefix, value string) {
 
 // expandBorderBoxProperty expands border-width/style/color shorthand (1-4 values)
 func expandBorderBoxProperty(style *Style, value string, suffix string) {
-	parts := strings.Fields(value)
+	parts := splitTopLevelFields(value)
 	var top, right, bottom, left string
 	switch len(parts) {
 	case 1:
@@ -920,6 +944,15 @@ func borderWidthKeyword(val string) (string, bool) {
 	return "", false
 }
 
+// isBorderStyleKeyword returns true if val is a border-style value.
+func isBorderStyleKeyword(val string) bool {
+	switch val {
+	case "none", "hidden", "dotted", "dashed", "solid", "double", "groove", "ridge", "inset", "outset":
+		return true
+	}
+	return false
+}
+
 // expandBorderProperty expands border shorthand
 // Format: "1px solid black" or "2px dotted #FF0000"
 // Per CSS spec, shorthand properties reset ALL sub-properties to their initial values,
@@ -935,7 +968,7 @@ func expandBorderProperty(style *Style, value string) {
 	}
 
 	// Now apply the specified values
-	parts := strings.Fields(value)
+	parts := splitTopLevelFields(value)
 	for _, part := range parts {
 		if bw, ok := borderWidthKeyword(part); ok {
 			style.Set("border-width", bw)
@@ -950,7 +983,7 @@ func expandBorderProperty(style *Style, value string) {
 			style.Set("border-right-width", part)
 			style.Set("border-bottom-width", part)
 			style.Set("border-left-width", part)
-		} else if part == "solid" || part == "dotted" || part == "dashed" || part == "double" || part == "none" || part == "inset" || part == "outset" || part == "groove" || part == "ridge" {
+		} else if isBorderStyleKeyword(part) {
 			// Style
 			style.Set("border-style", part)
 			style.Set("border-top-style", part)
@@ -1060,7 +1093,7 @@ func expandBorderSideProperty(style *Style, property, value string) {
 	style.Set("border-"+side+"-color", "currentcolor")
 
 	// Now apply the specified values
-	parts := strings.Fields(value)
+	parts := splitTopLevelFields(value)
 	for _, part := range parts {
 		if part == "0" {
 			style.Set("border-"+side+"-width", "0")
@@ -1068,7 +1101,7 @@ func expandBorderSideProperty(style *Style, property, value string) {
 			style.Set("border-"+side+"-width", bw)
 		} else if _, ok := ParseLength(part); ok {
 			style.Set("border-"+side+"-width", part)
-		} else if part == "solid" || part == "dotted" || part == "dashed" || part == "double" || part == "none" || part == "inset" || part == "outset" || part == "groove" || part == "ridge" {
+		} else if isBorderStyleKeyword(part) {
 			style.Set("border-"+side+"-style", part)
 		} else {
 			style.Set("border-"+side+"-color", part)
@@ -1139,11 +1172,13 @@ func expandBackgroundProperty(style *Style, value string) {
 		return
 	}
 
-	// Check for linear-gradient() - store the entire value as background property
-	if strings.Contains(value, "linear-gradient(") {
-		// Keep the full gradient value, don't expand it
-		style.Set("background", value)
-		return
+	// Extract a gradient function as the background image; its arguments
+	// contain commas and spaces that would confuse the token parsing below
+	if start := gradientStart(value); start != -1 {
+		if end := matchingParen(value, strings.Index(value[start:], "(")+start); end != -1 {
+			style.Set("background-image", value[start:end+1])
+			value = value[:start] + value[end+1:]
+		}
 	}
 
 	// Extract url(...) first since it may contain spaces (e.g. data URIs)
@@ -1171,15 +1206,53 @@ func expandBackgroundProperty(style *Style, value string) {
 		}
 	}
 
-	// Parse remaining tokens for color, repeat, position
-	parts := strings.Fields(value)
+	// Parse remaining tokens for color, repeat, position, and "/ size"
+	var parts []string
+	for _, field := range splitTopLevelFields(value) {
+		if strings.Contains(field, "(") {
+			parts = append(parts, field)
+			continue
+		}
+		// Split "center/cover" into "center", "/", "cover"
+		for i, piece := range strings.Split(field, "/") {
+			if i > 0 {
+				parts = append(parts, "/")
+			}
+			if piece != "" {
+				parts = append(parts, piece)
+			}
+		}
+	}
 	positionParts := []string{}
+	repeatParts := []string{}
+	sizeParts := []string{}
+	inSize := false
 	colorFound := false
 	colorValue := ""
 	for _, part := range parts {
+		if part == "/" {
+			// background-size may only follow a position
+			if len(positionParts) == 0 || inSize {
+				return
+			}
+			inSize = true
+			continue
+		}
+		if inSize {
+			_, isLength := ParseLength(part)
+			_, isPercent := ParsePercentage(part)
+			if (isLength || isPercent || part == "auto" || part == "cover" || part == "contain") && len(sizeParts) < 2 {
+				sizeParts = append(sizeParts, part)
+				continue
+			}
+			if len(sizeParts) == 0 {
+				return
+			}
+			inSize = false
+		}
 		if part == "no-repeat" || part == "repeat" || part == "repeat-x" || part == "repeat-y" {
-			style.Set("background-repeat", part)
-		} else if _, ok := ParseColor(part); ok {
+			repeatParts = append(repeatParts, part)
+		} else if _, ok := ParseColor(part); ok || isCurrentColor(part) {
 			if colorFound {
 				// Two color values = invalid declaration, skip entirely
 				return
@@ -1194,122 +1267,29 @@ func expandBackgroundProperty(style *Style, value string) {
 			colorValue = "transparent"
 		} else if _, ok := ParseLength(part); ok {
 			positionParts = append(positionParts, part)
+		} else if _, ok := ParsePercentage(part); ok {
+			positionParts = append(positionParts, part)
 		} else if part == "center" || part == "left" || part == "right" || part == "top" || part == "bottom" {
 			positionParts = append(positionParts, part)
 		} else if part == "fixed" || part == "scroll" || part == "local" {
 			style.Set("background-attachment", part)
 		}
 	}
+	if inSize && len(sizeParts) == 0 {
+		return
+	}
 	if colorFound {
 		style.Set("background-color", colorValue)
 	}
+	if len(repeatParts) > 0 {
+		style.Set("background-repeat", strings.Join(repeatParts, " "))
+	}
 	if len(positionParts) > 0 {
 		style.Set("background-position", strings.Join(positionParts, " "))
 	}
-}
-
-// Phase 19: Enhanced color with alpha channel
-type Color struct {
-	R, G, B uint8
-	A       float64 // Alpha: 0.0 (transparent) to 1.0 (opaque), default 1.0
-}
-
-func ParseColor(colorStr string) (Color, bool) {
-	colorStr = strings.TrimSpace(colorStr)
-
-	// Reject quoted values — CSS color values are never strings
-	if strings.HasPrefix(colorStr, "'") || strings.HasPrefix(colorStr, "\"") {
-		return Color{}, false
-	}
-
-	colorStr = strings.ToLower(colorStr)
-
-	// Handle transparent
-	if colorStr == "transparent" {
-		return Color{0, 0, 0, 0.0}, true
-	}
-
-	// Phase 19: Handle rgba() format
-	if strings.HasPrefix(colorStr, "rgba(") && strings.HasSuffix(colorStr, ")") {
-		values := strings.TrimSuffix(strings.TrimPrefix(colorStr, "rgba("), ")")
-		parts := strings.Split(values, ",")
-		if len(parts) == 4 {
-			var r, g, b int
-			var a float64
-			fmt.Sscanf(strings.TrimSpace(parts[0]), "%d", &r)
-			fmt.Sscanf(strings.TrimSpace(parts[1]), "%d", &g)
-			fmt.Sscanf(strings.TrimSpace(parts[2]), "%d", &b)
-			fmt.Sscanf(strings.TrimSpace(parts[3]), "%f", &a)
-			if r >= 0 && r <= 255 && g >= 0 && g <= 255 && b >= 0 && b <= 255 {
-				return Color{uint8(r), uint8(g), uint8(b), a}, true
-			}
-		}
+	if len(sizeParts) > 0 {
+		style.Set("background-size", strings.Join(sizeParts, " "))
 	}
-
-	// Try hex color first (#RGB or #RRGGBB)
-	if strings.HasPrefix(colorStr, "#") {
-		hex := colorStr[1:]
-		var r, g, b uint8
-
-		if len(hex) == 3 {
-			// #RGB format - expand to #RRGGBB
-			n, _ := fmt.Sscanf(hex, "%1x%1x%1x", &r, &g, &b)
-			if n != 3 {
-				return Color{}, false
-			}
-			r = r*16 + r
-			g = g*16 + g
-			b = b*16 + b
-			return Color{r, g, b, 1.0}, true
-		} else if len(hex) == 6 {
-			// #RRGGBB format
-			n, _ := fmt.Sscanf(hex, "%02x%02x%02x", &r, &g, &b)
-			if n != 3 {
-				return Color{}, false
-			}
-			return Color{r, g, b, 1.0}, true
-		}
-	}
-
-	// Try named colors
-	namedColors := map[string]Color{
-		"red":     {255, 0, 0, 1.0},
-		"green":   {0, 128, 0, 1.0},
-		"blue":    {0, 0, 255, 1.0},
-		"yellow":  {255, 255, 0, 1.0},
-		"cyan":    {0, 255, 255, 1.0},
-		"aqua":    {0, 255, 255, 1.0},
-		"magenta": {255, 0, 255, 1.0},
-		"fuchsia": {255, 0, 255, 1.0},
-		"white":   {255, 255, 255, 1.0},
-		"black":   {0, 0, 0, 1.0},
-		"gray":    {128, 128, 128, 1.0},
-		"grey":    {128, 128, 128, 1.0},
-		"orange":  {255, 165, 0, 1.0},
-		"purple":  {128, 0, 128, 1.0},
-		"pink":    {255, 192, 203, 1.0},
-		"brown":   {165, 42, 42, 1.0},
-		"lime":    {0, 255, 0, 1.0},
-		"navy":    {0, 0, 128, 1.0},
-		"teal":    {0, 128, 128, 1.0},
-		"silver":  {192, 192, 192, 1.0},
-		"maroon":  {128, 0, 0, 1.0},
-		"olive":      {128, 128, 0, 1.0},
-		"lightblue":  {173, 216, 230, 1.0},
-		"lightgreen": {144, 238, 144, 1.0},
-		"lightgray":  {211, 211, 211, 1.0},
-		"lightgrey":  {211, 211, 211, 1.0},
-		"lightyellow": {255, 255, 224, 1.0},
-		"lightcoral":  {240, 128, 128, 1.0},
-		"lightcyan":   {224, 255, 255, 1.0},
-		"lightpink":   {255, 182, 193, 1.0},
-		"turquoise":   {64, 224, 208, 1.0},
-		"coral":       {255, 127, 80, 1.0},
-		"violet":      {238, 130, 238, 1.0},
-		"bisque":      {255, 228, 196, 1.0},
-	}
-	color, ok := namedColors[colorStr]
-	return color, ok
 }
 
 // Phase 6: Text rendering helpers
@@ -1320,8 +1300,10 @@ func (s *Style) GetFontSize() float64 {
 	if !ok {
 		return 16.0
 	}
-	// For font-size, em is relative to parent's font-size (use 16px as default parent)
-	if size, ok := ParseLengthWithFontSize(val, 16.0); ok {
+	// For font-size, em is relative to parent's font-size (use 16px as default parent).
+	// The cascade resolves font-size to pixels, see ApplyInheritedProperties.
+	ctx := LengthContext{FontSize: 16.0, RootFontSize: s.RootFontSize, ViewportWidth: s.ViewportWidth, ViewportHeight: s.ViewportHeight}
+	if size, ok := parseLength(val, ctx); ok {
 		return size
 	}
 	return 16.0
@@ -1386,6 +1368,54 @@ func (s *Style) GetClear() ClearType {
 	return ClearNone
 }
 
+// BreakType represents a break-before, break-after, or break-inside value
+// as it applies to paged media (CSS Fragmentation §3)
+type BreakType string
+
+const (
+	BreakAuto  BreakType = "auto"
+	BreakAvoid BreakType = "avoid"
+	BreakPage  BreakType = "page" // A forced page break
+)
+
+// GetBreakBefore returns the break-before value (default: auto), falling
+// back to the legacy page-break-before property.
+func (s *Style) GetBreakBefore() BreakType {
+	return s.getBreak("break-before", "page-break-before")
+}
+
+// GetBreakAfter returns the break-after value (default: auto), falling back
+// to the legacy page-break-after property.
+func (s *Style) GetBreakAfter() BreakType {
+	return s.getBreak("break-after", "page-break-after")
+}
+
+// GetBreakInside returns the break-inside value, auto or avoid (default:
+// auto), falling back to the legacy page-break-inside property.
+func (s *Style) GetBreakInside() BreakType {
+	if s.getBreak("break-inside", "page-break-inside") == BreakAvoid {
+		return BreakAvoid
+	}
+	return BreakAuto
+}
+
+// getBreak reads a break property, mapping the page values (and the legacy
+// always, left, and right) to BreakPage. Column breaks do not apply to
+// pages and read as auto.
+func (s *Style) getBreak(name, legacy string) BreakType {
+	value, ok := s.Get(name)
+	if !ok {
+		value, _ = s.Get(legacy)
+	}
+	switch value {
+	case "page", "always", "left", "right", "recto", "verso", "all":
+		return BreakPage
+	case "avoid", "avoid-page":
+		return BreakAvoid
+	}
+	return BreakAuto
+}
+
 // Phase 6 Enhancements: Text styling
 
 // TextAlign represents the text-align property value
@@ -1397,19 +1427,78 @@ const (
 	TextAlignRight  TextAlign = "right"
 )
 
-// GetTextAlign returns the text-align value (default: left)
+// GetTextAlign returns the text-align value resolved to a physical side
+// (default: start). The logical values start and end follow the direction
+// property, so the default alignment is right for rtl.
 func (s *Style) GetTextAlign() TextAlign {
-	if align, ok := s.Get("text-align"); ok {
-		switch align {
-		case "center":
-			return TextAlignCenter
-		case "right":
-			return TextAlignRight
+	align, _ := s.Get("text-align")
+	switch align {
+	case "center":
+		return TextAlignCenter
+	case "left":
+		return TextAlignLeft
+	case "right":
+		return TextAlignRight
+	case "end":
+		if s.GetDirection() == DirectionRTL {
+			return TextAlignLeft
 		}
+		return TextAlignRight
+	}
+	// start, justify (whose last line is start-aligned) and the initial value
+	if s.GetDirection() == DirectionRTL {
+		return TextAlignRight
 	}
 	return TextAlignLeft
 }
 
+// Direction represents the direction property value
+type Direction string
+
+const (
+	DirectionLTR Direction = "ltr"
+	DirectionRTL Direction = "rtl"
+)
+
+// GetDirection returns the inline base direction (default: ltr)
+func (s *Style) GetDirection() Direction {
+	if dir, ok := s.Get("direction"); ok && dir == "rtl" {
+		return DirectionRTL
+	}
+	return DirectionLTR
+}
+
+// UnicodeBidi represents the unicode-bidi property value
+type UnicodeBidi string
+
+const (
+	UnicodeBidiNormal          UnicodeBidi = "normal"
+	UnicodeBidiEmbed           UnicodeBidi = "embed"
+	UnicodeBidiIsolate         UnicodeBidi = "isolate"
+	UnicodeBidiBidiOverride    UnicodeBidi = "bidi-override"
+	UnicodeBidiIsolateOverride UnicodeBidi = "isolate-override"
+	UnicodeBidiPlaintext       UnicodeBidi = "plaintext"
+)
+
+// GetUnicodeBidi returns the unicode-bidi value (default: normal)
+func (s *Style) GetUnicodeBidi() UnicodeBidi {
+	if ub, ok := s.Get("unicode-bidi"); ok {
+		switch ub {
+		case "embed":
+			return UnicodeBidiEmbed
+		case "isolate":
+			return UnicodeBidiIsolate
+		case "bidi-override":
+			return UnicodeBidiBidiOverride
+		case "isolate-override":
+			return UnicodeBidiIsolateOverride
+		case "plaintext":
+			return UnicodeBidiPlaintext
+		}
+	}
+	return UnicodeBidiNormal
+}
+
 // FontWeight represents the font-weight property value
 type FontWeight string
 
@@ -1518,6 +1607,21 @@ func (s *Style) GetWordSpacing() float64 {
 	return 0.0
 }
 
+// GetTextIndent returns the text-indent value in pixels, percentages being
+// of base, the width of the block's content box (default: 0)
+func (s *Style) GetTextIndent(base float64) float64 {
+	value, ok := s.Get("text-indent")
+	if !ok {
+		return 0
+	}
+	ctx := s.lengthContext()
+	ctx.PercentBase, ctx.HasPercentBase = base, true
+	if indent, ok := ParseLengthPercentage(value, ctx); ok {
+		return indent
+	}
+	return 0
+}
+
 // TextTransform represents the text-transform property value
 type TextTransform string
 
@@ -1575,6 +1679,53 @@ func (s *Style) GetWhiteSpace() WhiteSpace {
 	return WhiteSpaceNormal
 }
 
+// WordBreak represents the word-break property value
+type WordBreak string
+
+const (
+	WordBreakNormal   WordBreak = "normal"
+	WordBreakBreakAll WordBreak = "break-all"
+)
+
+// GetWordBreak returns the word-break value (default: normal)
+func (s *Style) GetWordBreak() WordBreak {
+	if wb, ok := s.Get("word-break"); ok && wb == "break-all" {
+		return WordBreakBreakAll
+	}
+	return WordBreakNormal
+}
+
+// OverflowWrap represents the overflow-wrap property value
+type OverflowWrap string
+
+const (
+	OverflowWrapNormal    OverflowWrap = "normal"
+	OverflowWrapBreakWord OverflowWrap = "break-word"
+	OverflowWrapAnywhere  OverflowWrap = "anywhere"
+)
+
+// GetOverflowWrap returns the overflow-wrap value, which may be set through
+// its legacy name word-wrap, or through the deprecated word-break:
+// break-word, which acts as overflow-wrap: anywhere (default: normal)
+func (s *Style) GetOverflowWrap() OverflowWrap {
+	value, ok := s.Get("overflow-wrap")
+	if !ok {
+		value, ok = s.Get("word-wrap")
+	}
+	if ok {
+		switch value {
+		case "break-word":
+			return OverflowWrapBreakWord
+		case "anywhere":
+			return OverflowWrapAnywhere
+		}
+	}
+	if wb, ok := s.Get("word-break"); ok && wb == "break-word" {
+		return OverflowWrapAnywhere
+	}
+	return OverflowWrapNormal
+}
+
 // Phase 21: Overflow properties
 
 // OverflowType represents the overflow property value
@@ -1675,22 +1826,22 @@ type BoxShadow struct {
 	Inset   bool
 }
 
-// GetBoxShadow parses and returns box-shadow values
+// GetBoxShadow parses and returns box-shadow values in declaration order
+// (the first shadow is painted on top). A shadow without a color uses the
+// element's color (currentcolor).
 func (s *Style) GetBoxShadow() []BoxShadow {
 	shadowStr, ok := s.Get("box-shadow")
 	if !ok || shadowStr == "none" {
 		return nil
 	}
 
-	// Parse box-shadow: offsetX offsetY blur spread color
-	// Example: "2px 2px 5px 0px rgba(0,0,0,0.3)"
+	// Parse box-shadow: [inset] offsetX offsetY [blur [spread]] [color]
+	// Example: "2px 2px 5px 0px rgba(0,0,0,0.3), inset 0 0 4px red"
 	shadows := make([]BoxShadow, 0)
 
-	// Split by comma for multiple shadows
-	parts := strings.Split(shadowStr, ",")
-	for _, part := range parts {
-		part = strings.TrimSpace(part)
-		shadow := parseBoxShadowValue(part)
+	// Split by comma for multiple shadows (commas inside rgba() don't count)
+	for _, part := range splitTopLevelCommas(shadowStr) {
+		shadow := s.parseBoxShadowValue(part)
 		if shadow != nil {
 			shadows = append(shadows, *shadow)
 		}
@@ -1699,76 +1850,89 @@ func (s *Style) GetBoxShadow() []BoxShadow {
 	return shadows
 }
 
-// parseBoxShadowValue parses a single box-shadow value
-func parseBoxShadowValue(s string) *BoxShadow {
-	s = strings.TrimSpace(s)
-	tokens := strings.Fields(s)
+// parseBoxShadowValue parses a single box-shadow value. The inset keyword,
+// lengths, and color may appear in any order as long as the lengths are
+// contiguous. Returns nil if fewer than two lengths are given.
+func (s *Style) parseBoxShadowValue(value string) *BoxShadow {
+	shadow := &BoxShadow{Color: s.currentColor()}
 
-	if len(tokens) < 2 {
+	var lengths []float64
+	lengthsDone := false
+	for _, token := range splitTopLevelFields(value) {
+		if strings.EqualFold(token, "inset") {
+			shadow.Inset = true
+			lengthsDone = lengthsDone || len(lengths) > 0
+			continue
+		}
+		if val, ok := parseLength(token, s.lengthContext()); ok && !lengthsDone {
+			lengths = append(lengths, val)
+			continue
+		}
+		if strings.EqualFold(token, "currentcolor") {
+			lengthsDone = lengthsDone || len(lengths) > 0
+			continue
+		}
+		if color, ok := ParseColor(token); ok {
+			shadow.Color = color
+			lengthsDone = lengthsDone || len(lengths) > 0
+			continue
+		}
 		return nil
 	}
 
-	shadow := &BoxShadow{
-		Color: Color{0, 0, 0, 0.3}, // Default shadow color
+	if len(lengths) < 2 || len(lengths) > 4 {
+		return nil
 	}
-
-	tokenIndex := 0
-
-	// Check for 'inset'
-	if tokens[tokenIndex] == "inset" {
-		shadow.Inset = true
-		tokenIndex++
+	shadow.OffsetX, shadow.OffsetY = lengths[0], lengths[1]
+	if len(lengths) > 2 {
+		shadow.Blur = math.Max(0, lengths[2]) // Negative blur is invalid; clamp
 	}
-
-	// Parse offset-x
-	if tokenIndex < len(tokens) {
-		if val, ok := ParseLength(tokens[tokenIndex]); ok {
-			shadow.OffsetX = val
-			tokenIndex++
-		}
+	if len(lengths) > 3 {
+		shadow.Spread = lengths[3]
 	}
+	return shadow
+}
 
-	// Parse offset-y
-	if tokenIndex < len(tokens) {
-		if val, ok := ParseLength(tokens[tokenIndex]); ok {
-			shadow.OffsetY = val
-			tokenIndex++
+// currentColor returns the computed color property (black if unset).
+func (s *Style) currentColor() Color {
+	if c, ok := s.Get("color"); ok {
+		if color, ok := ParseColor(c); ok {
+			return color
 		}
 	}
+	return Color{0, 0, 0, 1.0}
+}
 
-	// Parse blur radius (optional)
-	if tokenIndex < len(tokens) && !isColor(tokens[tokenIndex]) {
-		if val, ok := ParseLength(tokens[tokenIndex]); ok {
-			shadow.Blur = val
-			tokenIndex++
+// splitTopLevelFields splits s on whitespace that is not inside parentheses,
+// so "1px 2px rgba(0, 0, 0, 0.5)" yields three tokens.
+func splitTopLevelFields(s string) []string {
+	var fields []string
+	depth := 0
+	start := -1
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == '(':
+			depth++
+		case ch == ')':
+			if depth > 0 {
+				depth--
+			}
+		case depth == 0 && (ch == ' ' || ch == '\t' || ch == '\n'):
+			if start != -1 {
+				fields = append(fields, s[start:i])
+				start = -1
+			}
+			continue
 		}
-	}
-
-	// Parse spread radius (optional)
-	if tokenIndex < len(tokens) && !isColor(tokens[tokenIndex]) {
-		if val, ok := ParseLength(tokens[tokenIndex]); ok {
-			shadow.Spread = val
-			tokenIndex++
+		if start == -1 {
+			start = i
 		}
 	}
-
-	// Parse color (rest of the string)
-	if tokenIndex < len(tokens) {
-		colorStr := strings.Join(tokens[tokenIndex:], " ")
-		if color, ok := ParseColor(colorStr); ok {
-			shadow.Color = color
-		}
+	if start != -1 {
+		fields = append(fields, s[start:])
 	}
-
-	return shadow
-}
-
-// isColor checks if a token might be a color value
-func isColor(s string) bool {
-	return strings.HasPrefix(s, "#") ||
-		   strings.HasPrefix(s, "rgb") ||
-		   strings.HasPrefix(s, "hsl") ||
-		   (s != "inset" && !strings.HasSuffix(s, "px") && !strings.HasSuffix(s, "em"))
+	return fields
 }
 
 // Phase 7: Display modes
@@ -1787,6 +1951,9 @@ const (
 	DisplayTableHeaderGroup DisplayType = "table-header-group"
 	DisplayTableRowGroup   DisplayType = "table-row-group"
 	DisplayTableFooterGroup DisplayType = "table-footer-group"
+	DisplayTableColumn     DisplayType = "table-column"
+	DisplayTableColumnGroup DisplayType = "table-column-group"
+	DisplayTableCaption    DisplayType = "table-caption"
 	DisplayListItem        DisplayType = "list-item" // Phase 23
 	DisplayFlex            DisplayType = "flex"
 	DisplayInlineFlex      DisplayType = "inline-flex"
@@ -1816,6 +1983,12 @@ func (s *Style) GetDisplay() DisplayType {
 			return DisplayTableRowGroup
 		case "table-footer-group":
 			return DisplayTableFooterGroup
+		case "table-column":
+			return DisplayTableColumn
+		case "table-column-group":
+			return DisplayTableColumnGroup
+		case "table-caption":
+			return DisplayTableCaption
 		case "list-item":
 			return DisplayListItem
 		case "flex":
@@ -1835,13 +2008,19 @@ func (s *Style) GetDisplay() DisplayType {
 type VerticalAlign string
 
 const (
-	VerticalAlignBaseline VerticalAlign = "baseline"
-	VerticalAlignTop      VerticalAlign = "top"
-	VerticalAlignMiddle   VerticalAlign = "middle"
-	VerticalAlignBottom   VerticalAlign = "bottom"
+	VerticalAlignBaseline   VerticalAlign = "baseline"
+	VerticalAlignTop        VerticalAlign = "top"
+	VerticalAlignMiddle     VerticalAlign = "middle"
+	VerticalAlignBottom     VerticalAlign = "bottom"
+	VerticalAlignSub        VerticalAlign = "sub"
+	VerticalAlignSuper      VerticalAlign = "super"
+	VerticalAlignTextTop    VerticalAlign = "text-top"
+	VerticalAlignTextBottom VerticalAlign = "text-bottom"
 )
 
-// GetVerticalAlign returns the vertical-align value (default: baseline)
+// GetVerticalAlign returns the vertical-align value (default: baseline).
+// <length> and <percentage> values align relative to the baseline; see
+// GetVerticalAlignShift.
 func (s *Style) GetVerticalAlign() VerticalAlign {
 	if align, ok := s.Get("vertical-align"); ok {
 		switch align {
@@ -1851,34 +2030,64 @@ func (s *Style) GetVerticalAlign() VerticalAlign {
 			return VerticalAlignMiddle
 		case "bottom":
 			return VerticalAlignBottom
+		case "sub":
+			return VerticalAlignSub
+		case "super":
+			return VerticalAlignSuper
+		case "text-top":
+			return VerticalAlignTextTop
+		case "text-bottom":
+			return VerticalAlignTextBottom
 		}
 	}
 	return VerticalAlignBaseline
 }
 
-// GetLineHeight returns the line-height in pixels (default: 1.2 * font-size).
-// CSS line-height accepts unitless numbers (e.g., "1.5") meaning a multiplier
-// of the current font-size, unlike other CSS length properties where bare
-// numbers are invalid.
+// GetVerticalAlignShift returns how far a <length> or <percentage>
+// vertical-align raises the box above its parent's baseline (negative
+// values lower it). Percentages refer to the element's line-height.
+func (s *Style) GetVerticalAlignShift() float64 {
+	if pct, ok := s.GetPercentage("vertical-align"); ok {
+		return pct / 100.0 * s.GetLineHeight()
+	}
+	if shift, ok := s.GetLength("vertical-align"); ok {
+		return shift
+	}
+	return 0
+}
+
+// GetLineHeight returns the line-height in pixels. CSS line-height accepts
+// unitless numbers (e.g., "1.5") meaning a multiplier of the current
+// font-size, unlike other CSS length properties where bare numbers are
+// invalid. "normal", the default, is the spacing recommended by the font:
+// its ascent, descent, and line gap.
 func (s *Style) GetLineHeight() float64 {
 	val, ok := s.Get("line-height")
-	if !ok {
-		return s.GetFontSize() * 1.2
+	if !ok || val == "normal" {
+		return s.GetNormalLineHeight()
 	}
 	// Try as a standard CSS length first (px, em, etc.)
-	if lh, ok := ParseLengthWithFontSize(val, s.GetFontSize()); ok {
+	if lh, ok := parseLength(val, s.lengthContext()); ok && lh >= 0 {
 		return lh
 	}
 	// Try as a unitless multiplier (e.g., "1.5" means 1.5 × font-size)
 	val = strings.TrimSpace(val)
-	if num, err := strconv.ParseFloat(val, 64); err == nil && num > 0 {
+	if num, err := strconv.ParseFloat(val, 64); err == nil && num >= 0 {
 		return num * s.GetFontSize()
 	}
 	// Try as a percentage (e.g., "150%" means 1.5 × font-size)
-	if pct, ok := ParsePercentage(val); ok {
+	if pct, ok := ParsePercentage(val); ok && pct >= 0 {
 		return pct / 100.0 * s.GetFontSize()
 	}
-	return s.GetFontSize() * 1.2
+	return s.GetNormalLineHeight()
+}
+
+// GetNormalLineHeight returns the line height for line-height: normal in
+// the font selected by the style.
+func (s *Style) GetNormalLineHeight() float64 {
+	return text.MetricsWithFamilies(s.Fonts, s.GetFontSize(), s.GetFontFamilies(),
+		s.GetFontWeight() == FontWeightBold, s.GetFontStyle() == FontStyleItalic,
+		s.IsMonospaceFamily(), s.IsAhemFamily()).NormalLineHeight()
 }
 
 // Phase 9: Table layout
@@ -1902,6 +2111,38 @@ func (s *Style) GetBorderCollapse() BorderCollapse {
 	return BorderCollapseSeparate
 }
 
+// CaptionSide represents the caption-side property value
+type CaptionSide string
+
+const (
+	CaptionSideTop    CaptionSide = "top"
+	CaptionSideBottom CaptionSide = "bottom"
+)
+
+// GetCaptionSide returns the caption-side value (default: top)
+func (s *Style) GetCaptionSide() CaptionSide {
+	if side, ok := s.Get("caption-side"); ok && strings.EqualFold(strings.TrimSpace(side), "bottom") {
+		return CaptionSideBottom
+	}
+	return CaptionSideTop
+}
+
+// TableLayout represents the table-layout property value
+type TableLayout string
+
+const (
+	TableLayoutAuto  TableLayout = "auto"
+	TableLayoutFixed TableLayout = "fixed"
+)
+
+// GetTableLayout returns the table-layout value (default: auto)
+func (s *Style) GetTableLayout() TableLayout {
+	if tl, ok := s.Get("table-layout"); ok && strings.EqualFold(strings.TrimSpace(tl), "fixed") {
+		return TableLayoutFixed
+	}
+	return TableLayoutAuto
+}
+
 // GetBorderSpacing returns the border-spacing value (default: 0 per CSS 2.1)
 // If two values are given (horizontal vertical), returns the first value.
 func (s *Style) GetBorderSpacing() float64 {
@@ -2045,15 +2286,17 @@ const (
 	AlignContentStretch      AlignContent = "stretch"
 	AlignContentSpaceBetween AlignContent = "space-between"
 	AlignContentSpaceAround  AlignContent = "space-around"
+	AlignContentSpaceEvenly  AlignContent = "space-evenly"
 )
 
-// GetAlignContent returns the align-content value (default: stretch)
+// GetAlignContent returns the align-content value (default: stretch, which
+// normal behaves as in a flex container)
 func (s *Style) GetAlignContent() AlignContent {
 	if ac, ok := s.Get("align-content"); ok {
 		switch ac {
-		case "flex-start":
+		case "flex-start", "start":
 			return AlignContentFlexStart
-		case "flex-end":
+		case "flex-end", "end":
 			return AlignContentFlexEnd
 		case "center":
 			return AlignContentCenter
@@ -2061,6 +2304,8 @@ func (s *Style) GetAlignContent() AlignContent {
 			return AlignContentSpaceBetween
 		case "space-around":
 			return AlignContentSpaceAround
+		case "space-evenly":
+			return AlignContentSpaceEvenly
 		}
 	}
 	return AlignContentStretch
@@ -2103,7 +2348,7 @@ func (s *Style) GetFlexBasisValue() FlexBasisValue {
 	if pct, ok := ParsePercentage(basis); ok {
 		return FlexBasisValue{Percentage: pct, IsPercent: true}
 	}
-	if length, ok := ParseLengthWithFontSize(basis, s.GetFontSize()); ok {
+	if length, ok := parseLength(basis, s.lengthContext()); ok {
 		return FlexBasisValue{Length: length}
 	}
 	return FlexBasisValue{IsAuto: true}
@@ -2116,7 +2361,7 @@ func (s *Style) GetFlexBasis() float64 {
 		if basis == "auto" || basis == "content" {
 			return -1
 		}
-		if length, ok := ParseLengthWithFontSize(basis, s.GetFontSize()); ok {
+		if length, ok := parseLength(basis, s.lengthContext()); ok {
 			return length
 		}
 	}
@@ -2169,8 +2414,14 @@ func (s *Style) GetOrder() int {
 
 // ContentValue represents a single value in the content property
 type ContentValue struct {
-	Type  string // "text", "url", "counter", "attr", "open-quote", "close-quote"
+	Type  string // "text", "url", "counter", "counters", "attr", "open-quote", "close-quote"
 	Value string // The actual value (text content, URL path, counter name, attr name)
+
+	// For counter() and counters(): the counter style (a list-style-type,
+	// empty for decimal), and for counters() the string between the values
+	// of the nested counters
+	CounterStyle string
+	Separator    string
 }
 
 // GetContent returns the content property value for pseudo-elements
@@ -2206,7 +2457,7 @@ func (s *Style) GetContentValues() ([]ContentValue, bool) {
 	}
 
 	// Handle "none" and "normal" (no content)
-	raw = strings.TrimSpace(raw)
+	raw, _, _ = splitContentAlt(strings.TrimSpace(raw))
 	if raw == "none" || raw == "normal" {
 		return nil, false
 	}
@@ -2214,6 +2465,47 @@ func (s *Style) GetContentValues() ([]ContentValue, bool) {
 	return ParseContentValues(raw), true
 }
 
+// GetContentAlt returns the alternative text of the content property, the
+// part after a "/" as in content: url(icon.png) / "Note" (CSS Generated
+// Content 3 §1.1), which stands in for images that can't be loaded
+func (s *Style) GetContentAlt() ([]ContentValue, bool) {
+	raw, ok := s.Get("content")
+	if !ok {
+		return nil, false
+	}
+	_, alt, ok := splitContentAlt(strings.TrimSpace(raw))
+	if !ok {
+		return nil, false
+	}
+	return ParseContentValues(alt), true
+}
+
+// splitContentAlt splits a content value at the "/" before its alternative
+// text, if it has one; a "/" in a string or function doesn't count.
+func splitContentAlt(raw string) (content, alt string, ok bool) {
+	var quote byte
+	depth := 0
+	for i := 0; i < len(raw); i++ {
+		switch c := raw[i]; {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == '/' && depth == 0:
+			return strings.TrimSpace(raw[:i]), strings.TrimSpace(raw[i+1:]), true
+		}
+	}
+	return raw, "", false
+}
+
 // ParseContentValues parses a CSS content value into individual parts
 func ParseContentValues(raw string) []ContentValue {
 	var values []ContentValue
@@ -2285,7 +2577,23 @@ func ParseContentValues(raw string) []ContentValue {
 					values = append(values, ContentValue{Type: "url", Value: arg})
 				case "counter":
 					// counter(name) or counter(name, style)
-					values = append(values, ContentValue{Type: "counter", Value: arg})
+					args := splitContentArgs(arg)
+					cv := ContentValue{Type: "counter", Value: args[0]}
+					if len(args) > 1 {
+						cv.CounterStyle = args[1]
+					}
+					values = append(values, cv)
+				case "counters":
+					// counters(name, separator) or counters(name, separator, style)
+					args := splitContentArgs(arg)
+					cv := ContentValue{Type: "counters", Value: args[0]}
+					if len(args) > 1 {
+						cv.Separator = unquoteContentString(args[1])
+					}
+					if len(args) > 2 {
+						cv.CounterStyle = args[2]
+					}
+					values = append(values, cv)
 				case "attr":
 					values = append(values, ContentValue{Type: "attr", Value: arg})
 				}
@@ -2326,6 +2634,40 @@ func ParseContentValues(raw string) []ContentValue {
 	return values
 }
 
+// splitContentArgs splits the arguments of a content function at the
+// commas that aren't in a quoted string.
+func splitContentArgs(arg string) []string {
+	var args []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(arg); i++ {
+		switch c := arg[i]; {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			args = append(args, strings.TrimSpace(arg[start:i]))
+			start = i + 1
+		}
+	}
+	return append(args, strings.TrimSpace(arg[start:]))
+}
+
+// unquoteContentString returns the text of a quoted string argument.
+func unquoteContentString(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		s = s[1 : len(s)-1]
+	}
+	s = strings.ReplaceAll(s, "\\0022", "\"")
+	s = strings.ReplaceAll(s, "\\\"", "\"")
+	return s
+}
+
 // Phase 15: CSS Grid properties
 
 // GridTrack represents a single grid track (column or row)
@@ -2363,23 +2705,46 @@ func parseGridTracks(val string) []GridTrack {
 	return tracks
 }
 
-// GetGridGap returns the grid-gap value (shorthand for row-gap and column-gap)
-func (s *Style) GetGridGap() (rowGap, columnGap float64) {
-	// Try grid-gap first (older syntax)
-	if gap, ok := s.GetLength("grid-gap"); ok {
-		return gap, gap
+// GetGap returns the gaps between the rows and between the columns of a
+// grid or flex container (CSS Box Alignment §8), with percentages of
+// rowBase and columnBase, the container's content height and width. An
+// indefinite height is passed as 0. normal, the initial value, is 0.
+func (s *Style) GetGap(rowBase, columnBase float64) (rowGap, columnGap float64) {
+	rowValue, _ := s.Get("row-gap")
+	columnValue, _ := s.Get("column-gap")
+	// A shorthand with var() references is left unexpanded until read
+	for _, shorthand := range []string{"gap", "grid-gap"} {
+		value, ok := s.Get(shorthand)
+		if !ok {
+			continue
+		}
+		parts := strings.Fields(value)
+		if len(parts) == 1 {
+			parts = append(parts, parts[0])
+		}
+		if len(parts) == 2 {
+			if rowValue == "" {
+				rowValue = parts[0]
+			}
+			if columnValue == "" {
+				columnValue = parts[1]
+			}
+		}
 	}
-	
-	// Try gap (newer syntax)
-	if gap, ok := s.GetLength("gap"); ok {
-		return gap, gap
+	return s.gapLength(rowValue, rowBase), s.gapLength(columnValue, columnBase)
+}
+
+// gapLength resolves a row-gap or column-gap value, which can't be negative.
+func (s *Style) gapLength(value string, base float64) float64 {
+	if value == "" || value == "normal" {
+		return 0
 	}
-	
-	// Try individual properties
-	rowGap, _ = s.GetLength("row-gap")
-	columnGap, _ = s.GetLength("column-gap")
-	
-	return rowGap, columnGap
+	ctx := s.lengthContext()
+	ctx.PercentBase, ctx.HasPercentBase = base, true
+	if gap, ok := ParseLengthPercentage(value, ctx); ok && gap > 0 {
+		return gap
+	}
+	return 0
 }
 
 // GridPlacement represents grid-column or grid-row placement
@@ -2760,71 +3125,174 @@ func (s *Style) GetBackgroundAttachment() string {
 // GetBackgroundRepeat returns the background-repeat value (default: repeat)
 func (s *Style) GetBackgroundRepeat() BackgroundRepeatType {
 	if val, ok := s.Get("background-repeat"); ok {
-		switch val {
-		case "no-repeat":
+		// The two-value syntax gives the horizontal then vertical repeat
+		switch strings.Join(strings.Fields(val), " ") {
+		case "no-repeat", "no-repeat no-repeat":
 			return BackgroundRepeatNoRepeat
-		case "repeat-x":
+		case "repeat-x", "repeat no-repeat":
 			return BackgroundRepeatRepeatX
-		case "repeat-y":
+		case "repeat-y", "no-repeat repeat":
 			return BackgroundRepeatRepeatY
 		}
 	}
 	return BackgroundRepeatRepeat
 }
 
-// BackgroundPosition represents background-position x,y values in pixels
+// BackgroundPosition represents a background-position value. Each axis is
+// a percentage of the free space (the positioning area minus the image size)
+// plus a pixel offset, so "right 10px" is 100% - 10px (CSS Backgrounds 3 §3.6).
 type BackgroundPosition struct {
-	X float64
-	Y float64
+	X        float64 // horizontal offset in pixels
+	Y        float64 // vertical offset in pixels
+	XPercent float64 // percentage of the free horizontal space
+	YPercent float64 // percentage of the free vertical space
+}
+
+// Resolve returns the offset of the image's top-left corner within a
+// positioning area of the given size.
+func (p BackgroundPosition) Resolve(areaW, areaH, imageW, imageH float64) (x, y float64) {
+	return (areaW-imageW)*p.XPercent/100 + p.X, (areaH-imageH)*p.YPercent/100 + p.Y
 }
 
 // GetBackgroundPosition parses background-position (default: 0 0)
 func (s *Style) GetBackgroundPosition() BackgroundPosition {
 	val, ok := s.Get("background-position")
 	if !ok {
-		return BackgroundPosition{0, 0}
+		return BackgroundPosition{0, 0, 0, 0}
 	}
 	return ParseBackgroundPosition(val)
 }
 
-// ParseBackgroundPosition parses a background-position value string
+// ParseBackgroundPosition parses a background-position value string.
+// Invalid values yield the initial position (0% 0%).
 func ParseBackgroundPosition(val string) BackgroundPosition {
-	parts := strings.Fields(val)
-	pos := BackgroundPosition{}
-	if len(parts) >= 1 {
-		pos.X = parsePositionComponent(parts[0], true)
-	}
-	if len(parts) >= 2 {
-		pos.Y = parsePositionComponent(parts[1], false)
-	} else if len(parts) == 1 {
-		// Single value: y defaults to center (but for px values, 0 is fine for Acid2)
-		switch parts[0] {
-		case "center":
-			pos.Y = 0 // will need box dimensions for true center; 0 as fallback
-		default:
-			pos.Y = 0
-		}
+	pos, ok := parseBackgroundPosition(strings.Fields(val))
+	if !ok {
+		return BackgroundPosition{}
 	}
 	return pos
 }
 
-func parsePositionComponent(val string, isX bool) float64 {
+// positionComponent is one keyword, length, or percentage of a
+// background-position value.
+type positionComponent struct {
+	percent float64
+	offset  float64
+	axis    byte // 'x' or 'y' for edge keywords, 0 otherwise
+	keyword bool
+}
+
+func parsePositionComponent(val string) (positionComponent, bool) {
 	switch val {
 	case "left":
-		return 0
+		return positionComponent{percent: 0, axis: 'x', keyword: true}, true
 	case "right":
-		return 0 // needs box width; handled at render time
+		return positionComponent{percent: 100, axis: 'x', keyword: true}, true
 	case "top":
-		return 0
+		return positionComponent{percent: 0, axis: 'y', keyword: true}, true
 	case "bottom":
-		return 0 // needs box height; handled at render time
+		return positionComponent{percent: 100, axis: 'y', keyword: true}, true
 	case "center":
-		return 0 // handled at render time
+		return positionComponent{percent: 50, keyword: true}, true
+	}
+	if pct, ok := ParsePercentage(val); ok {
+		return positionComponent{percent: pct}, true
 	}
 	if length, ok := ParseLength(val); ok {
-		return length
+		return positionComponent{offset: length}, true
 	}
-	return 0
+	return positionComponent{}, false
+}
+
+func parseBackgroundPosition(parts []string) (BackgroundPosition, bool) {
+	var pos BackgroundPosition
+	center := positionComponent{percent: 50, keyword: true}
+
+	switch len(parts) {
+	case 1, 2:
+		comps := make([]positionComponent, 0, 2)
+		for _, part := range parts {
+			c, ok := parsePositionComponent(part)
+			if !ok {
+				return pos, false
+			}
+			comps = append(comps, c)
+		}
+		if len(comps) == 1 {
+			// The other axis defaults to center
+			if comps[0].axis == 'y' {
+				comps = []positionComponent{center, comps[0]}
+			} else {
+				comps = append(comps, center)
+			}
+		} else if comps[0].axis == 'y' || comps[1].axis == 'x' {
+			// "top left": keywords may name the vertical axis first
+			if !comps[0].keyword || !comps[1].keyword {
+				return pos, false
+			}
+			comps[0], comps[1] = comps[1], comps[0]
+		}
+		if comps[0].axis == 'y' || comps[1].axis == 'x' {
+			return pos, false
+		}
+		pos.XPercent, pos.X = comps[0].percent, comps[0].offset
+		pos.YPercent, pos.Y = comps[1].percent, comps[1].offset
+		return pos, true
+
+	case 3, 4:
+		// Keywords, each edge optionally followed by an offset from it
+		var x, y *positionComponent
+		var centers int
+		for i := 0; i < len(parts); i++ {
+			c, ok := parsePositionComponent(parts[i])
+			if !ok || !c.keyword {
+				return pos, false
+			}
+			if i+1 < len(parts) {
+				if off, ok := parsePositionComponent(parts[i+1]); ok && !off.keyword {
+					if c.axis == 0 {
+						return pos, false // center takes no offset
+					}
+					if c.percent == 100 {
+						// Offsets from the right and bottom edges count inward
+						c.percent, c.offset = 100-off.percent, -off.offset
+					} else {
+						c.percent, c.offset = off.percent, off.offset
+					}
+					i++
+				}
+			}
+			switch c.axis {
+			case 'x':
+				if x != nil {
+					return pos, false
+				}
+				x = &c
+			case 'y':
+				if y != nil {
+					return pos, false
+				}
+				y = &c
+			default:
+				centers++
+			}
+		}
+		if x == nil {
+			x = &center
+			centers--
+		}
+		if y == nil {
+			y = &center
+			centers--
+		}
+		if centers > 0 {
+			return pos, false
+		}
+		pos.XPercent, pos.X = x.percent, x.offset
+		pos.YPercent, pos.Y = y.percent, y.offset
+		return pos, true
+	}
+	return pos, false
 }
 
 // BackgroundSize represents a parsed background-size value
@@ -2883,6 +3351,11 @@ const (
 	ListStyleTypeSquare  ListStyleType = "square"
 	ListStyleTypeDecimal ListStyleType = "decimal"
 	ListStyleTypeNone    ListStyleType = "none"
+
+	ListStyleTypeLowerAlpha ListStyleType = "lower-alpha"
+	ListStyleTypeUpperAlpha ListStyleType = "upper-alpha"
+	ListStyleTypeLowerRoman ListStyleType = "lower-roman"
+	ListStyleTypeUpperRoman ListStyleType = "upper-roman"
 )
 
 // GetListStyleType returns the list-style-type value (default: disc)
@@ -2899,6 +3372,14 @@ func (s *Style) GetListStyleType() ListStyleType {
 			return ListStyleTypeDecimal
 		case "none":
 			return ListStyleTypeNone
+		case "lower-alpha", "lower-latin":
+			return ListStyleTypeLowerAlpha
+		case "upper-alpha", "upper-latin":
+			return ListStyleTypeUpperAlpha
+		case "lower-roman":
+			return ListStyleTypeLowerRoman
+		case "upper-roman":
+			return ListStyleTypeUpperRoman
 		default:
 			// Handle custom string values (quoted strings like "\2022")
 			// Strip quotes if present
@@ -2912,3 +3393,28 @@ func (s *Style) GetListStyleType() ListStyleType {
 	}
 	return ListStyleTypeDisc
 }
+
+// ListStylePosition represents the list-style-position property value
+type ListStylePosition string
+
+const (
+	ListStylePositionOutside ListStylePosition = "outside" // Marker is outside the principal box
+	ListStylePositionInside  ListStylePosition = "inside"  // Marker is the first inline box
+)
+
+// GetListStylePosition returns the list-style-position value (default: outside)
+func (s *Style) GetListStylePosition() ListStylePosition {
+	if val, ok := s.Get("list-style-position"); ok && val == "inside" {
+		return ListStylePositionInside
+	}
+	return ListStylePositionOutside
+}
+
+// GetListStyleImage returns the URL of the list-style-image, if it is set
+// and not none
+func (s *Style) GetListStyleImage() (string, bool) {
+	if val, ok := s.Get("list-style-image"); ok {
+		return ParseURLValue(val)
+	}
+	return "", false
+}
@@ -101,6 +101,27 @@ func TestParseInlineStyle_BorderShorthand(t *testing.T) {
 	}
 }
 
+func TestGetBorderStyle_AllStyles(t *testing.T) {
+	style := ParseInlineStyle("border: 4px groove gray; border-style: ridge inset OUTSET hidden")
+
+	styles := style.GetBorderStyle()
+	want := BorderStyleEdge{Top: BorderStyleRidge, Right: BorderStyleInset, Bottom: BorderStyleOutset, Left: BorderStyleHidden}
+	if styles != want {
+		t.Errorf("expected %+v, got %+v", want, styles)
+	}
+
+	// hidden, like none, computes the border width to 0
+	width := style.GetBorderWidth()
+	if width.Top != 4 || width.Bottom != 4 || width.Left != 0 {
+		t.Errorf("expected widths 4 with a 0 left border, got %+v", width)
+	}
+
+	style = ParseInlineStyle("border-top: 2px hidden red")
+	if got := style.GetBorderStyle().Top; got != BorderStyleHidden {
+		t.Errorf("expected border-top hidden, got %q", got)
+	}
+}
+
 func TestParseInlineStyle_IndividualMargins(t *testing.T) {
 	style := ParseInlineStyle("margin-top: 5px; margin-left: 10px")
 	margin := style.GetMargin()
@@ -134,3 +155,254 @@ func TestParseInlineStyle_CombinedBoxModel(t *testing.T) {
 		t.Errorf("expected border width 1, got %+v", borderWidth)
 	}
 }
+
+func TestParseInlineStyle_BorderRadiusElliptical(t *testing.T) {
+	style := ParseInlineStyle("border-radius: 10px 20px / 5px")
+
+	radii := style.GetBorderRadii(200, 100)
+	if radii.TopLeft != (CornerRadius{10, 5}) || radii.BottomRight != (CornerRadius{10, 5}) {
+		t.Errorf("expected TL/BR 10x5, got %+v / %+v", radii.TopLeft, radii.BottomRight)
+	}
+	if radii.TopRight != (CornerRadius{20, 5}) || radii.BottomLeft != (CornerRadius{20, 5}) {
+		t.Errorf("expected TR/BL 20x5, got %+v / %+v", radii.TopRight, radii.BottomLeft)
+	}
+}
+
+func TestGetBorderRadii_PercentAndOverlap(t *testing.T) {
+	style := ParseInlineStyle("border-radius: 50%")
+	radii := style.GetBorderRadii(200, 100)
+	if radii.TopLeft != (CornerRadius{100, 50}) {
+		t.Errorf("expected 50%% to resolve to 100x50, got %+v", radii.TopLeft)
+	}
+
+	// 80px + 80px exceeds the 100px height, so all radii scale by 100/160
+	style = ParseInlineStyle("border-radius: 80px")
+	radii = style.GetBorderRadii(200, 100)
+	if radii.TopLeft.X != 50 || radii.TopLeft.Y != 50 {
+		t.Errorf("expected overlapping radii scaled to 50, got %+v", radii.TopLeft)
+	}
+
+	inner := radii.Inset(10, 10, 10, 60)
+	if inner.TopLeft != (CornerRadius{0, 40}) {
+		t.Errorf("expected inset TL 0x40, got %+v", inner.TopLeft)
+	}
+}
+
+func TestGetBoxShadow_Multiple(t *testing.T) {
+	style := ParseInlineStyle("color: blue; box-shadow: 2px 3px 4px rgba(0, 0, 0, 0.5), inset 0 0 0 5px red, 1px 1px")
+	shadows := style.GetBoxShadow()
+	if len(shadows) != 3 {
+		t.Fatalf("expected 3 shadows, got %d", len(shadows))
+	}
+	if shadows[0].OffsetX != 2 || shadows[0].OffsetY != 3 || shadows[0].Blur != 4 || shadows[0].Color.A != 0.5 {
+		t.Errorf("unexpected first shadow %+v", shadows[0])
+	}
+	if !shadows[1].Inset || shadows[1].Spread != 5 || shadows[1].Color.R != 255 {
+		t.Errorf("expected inset red shadow with 5px spread, got %+v", shadows[1])
+	}
+	if shadows[2].Color.B != 255 {
+		t.Errorf("expected shadow without a color to use currentcolor, got %+v", shadows[2].Color)
+	}
+
+	if shadows := ParseInlineStyle("box-shadow: 1px red inset").GetBoxShadow(); len(shadows) != 0 {
+		t.Errorf("expected a single length to be invalid, got %+v", shadows)
+	}
+}
+
+func TestGetTextAlign_Direction(t *testing.T) {
+	tests := []struct {
+		style  string
+		expect TextAlign
+	}{
+		{"", TextAlignLeft},
+		{"direction: rtl", TextAlignRight},
+		{"direction: rtl; text-align: start", TextAlignRight},
+		{"direction: rtl; text-align: end", TextAlignLeft},
+		{"direction: rtl; text-align: left", TextAlignLeft},
+		{"text-align: end", TextAlignRight},
+		{"text-align: center", TextAlignCenter},
+	}
+	for _, tt := range tests {
+		if got := ParseInlineStyle(tt.style).GetTextAlign(); got != tt.expect {
+			t.Errorf("%q: expected %s, got %s", tt.style, tt.expect, got)
+		}
+	}
+}
+
+func TestGetVerticalAlign_Values(t *testing.T) {
+	tests := []struct {
+		style  string
+		expect VerticalAlign
+		shift  float64
+	}{
+		{"", VerticalAlignBaseline, 0},
+		{"vertical-align: super", VerticalAlignSuper, 0},
+		{"vertical-align: text-bottom", VerticalAlignTextBottom, 0},
+		{"vertical-align: 5px", VerticalAlignBaseline, 5},
+		{"vertical-align: -0.5em; font-size: 20px", VerticalAlignBaseline, -10},
+		{"vertical-align: 50%; line-height: 30px", VerticalAlignBaseline, 15},
+	}
+	for _, tt := range tests {
+		style := ParseInlineStyle(tt.style)
+		if got := style.GetVerticalAlign(); got != tt.expect {
+			t.Errorf("%q: expected %s, got %s", tt.style, tt.expect, got)
+		}
+		if got := style.GetVerticalAlignShift(); got != tt.shift {
+			t.Errorf("%q: expected shift %v, got %v", tt.style, tt.shift, got)
+		}
+	}
+}
+
+func TestGetLineHeight_Normal(t *testing.T) {
+	// Ahem has no line gap and an em-high ascent plus descent
+	if got := ParseInlineStyle("font-family: Ahem; font-size: 20px").GetLineHeight(); got != 20 {
+		t.Errorf("Expected normal line-height of 20px for Ahem, got %v", got)
+	}
+	if got := ParseInlineStyle("font-family: Ahem; font-size: 20px; line-height: normal").GetLineHeight(); got != 20 {
+		t.Errorf("Expected line-height: normal of 20px for Ahem, got %v", got)
+	}
+	if got := ParseInlineStyle("font-size: 20px; line-height: 1.5").GetLineHeight(); got != 30 {
+		t.Errorf("Expected unitless line-height of 30px, got %v", got)
+	}
+}
+
+func TestGetBreak_LegacyAndNormalized(t *testing.T) {
+	tests := []struct {
+		style                 string
+		before, after, inside BreakType
+	}{
+		{"", BreakAuto, BreakAuto, BreakAuto},
+		{"break-before: page; break-after: avoid; break-inside: avoid", BreakPage, BreakAvoid, BreakAvoid},
+		{"page-break-before: always; page-break-after: left; page-break-inside: avoid", BreakPage, BreakPage, BreakAvoid},
+		{"break-before: column; break-inside: avoid-column", BreakAuto, BreakAuto, BreakAuto},
+		{"break-before: auto; page-break-before: always", BreakAuto, BreakAuto, BreakAuto},
+	}
+	for _, tt := range tests {
+		s := ParseInlineStyle(tt.style)
+		if got := s.GetBreakBefore(); got != tt.before {
+			t.Errorf("%q: break-before = %s, want %s", tt.style, got, tt.before)
+		}
+		if got := s.GetBreakAfter(); got != tt.after {
+			t.Errorf("%q: break-after = %s, want %s", tt.style, got, tt.after)
+		}
+		if got := s.GetBreakInside(); got != tt.inside {
+			t.Errorf("%q: break-inside = %s, want %s", tt.style, got, tt.inside)
+		}
+	}
+}
+
+func TestGetGap_ShorthandsAndPercentages(t *testing.T) {
+	tests := []struct {
+		style       string
+		row, column float64
+	}{
+		{"", 0, 0},
+		{"gap: 10px", 10, 10},
+		{"gap: 10px 20%", 10, 40},
+		{"grid-gap: 5px 6px", 5, 6},
+		{"grid-row-gap: 3px; grid-column-gap: 4px", 3, 4},
+		{"row-gap: 50%; column-gap: normal", 50, 0},
+		{"--g: 7px 8px; gap: var(--g)", 7, 8},
+		{"gap: -5px", 0, 0},
+	}
+	for _, tt := range tests {
+		row, column := ParseInlineStyle(tt.style).GetGap(100, 200)
+		if row != tt.row || column != tt.column {
+			t.Errorf("%q: expected gaps %v %v, got %v %v", tt.style, tt.row, tt.column, row, column)
+		}
+	}
+}
+
+func TestGetWordBreakAndOverflowWrap(t *testing.T) {
+	tests := []struct {
+		style     string
+		wordBreak WordBreak
+		wrap      OverflowWrap
+	}{
+		{"", WordBreakNormal, OverflowWrapNormal},
+		{"word-break: break-all", WordBreakBreakAll, OverflowWrapNormal},
+		{"overflow-wrap: break-word", WordBreakNormal, OverflowWrapBreakWord},
+		{"word-wrap: break-word", WordBreakNormal, OverflowWrapBreakWord},
+		{"overflow-wrap: anywhere; word-wrap: normal", WordBreakNormal, OverflowWrapAnywhere},
+		{"word-break: break-word", WordBreakNormal, OverflowWrapAnywhere},
+	}
+	for _, tt := range tests {
+		style := ParseInlineStyle(tt.style)
+		if got := style.GetWordBreak(); got != tt.wordBreak {
+			t.Errorf("%q: expected word-break %s, got %s", tt.style, tt.wordBreak, got)
+		}
+		if got := style.GetOverflowWrap(); got != tt.wrap {
+			t.Errorf("%q: expected overflow-wrap %s, got %s", tt.style, tt.wrap, got)
+		}
+	}
+}
+
+func TestGetTextIndent(t *testing.T) {
+	tests := []struct {
+		style  string
+		expect float64
+	}{
+		{"", 0},
+		{"text-indent: 24px", 24},
+		{"text-indent: -1em; font-size: 20px", -20},
+		{"text-indent: 10%", 30},
+	}
+	for _, tt := range tests {
+		if got := ParseInlineStyle(tt.style).GetTextIndent(300); got != tt.expect {
+			t.Errorf("%q: expected %.1f, got %.1f", tt.style, tt.expect, got)
+		}
+	}
+}
+
+func TestParseInlineStyle_ListStyleShorthand(t *testing.T) {
+	style := ParseInlineStyle(`list-style: lower-roman inside url("dot.png")`)
+	if got := style.GetListStyleType(); got != ListStyleTypeLowerRoman {
+		t.Errorf("expected list-style-type lower-roman, got %q", got)
+	}
+	if got := style.GetListStylePosition(); got != ListStylePositionInside {
+		t.Errorf("expected list-style-position inside, got %q", got)
+	}
+	if got, ok := style.GetListStyleImage(); !ok || got != "dot.png" {
+		t.Errorf("expected list-style-image dot.png, got %q", got)
+	}
+
+	style = ParseInlineStyle(`list-style: "- "`)
+	if got := style.GetListStyleType(); got != "- " {
+		t.Errorf("expected a marker string, got %q", got)
+	}
+}
+
+func TestParseContentValues_Counters(t *testing.T) {
+	values := ParseContentValues(`counter(item, upper-roman) counters(item, ", ") counters(sec, ".", lower-alpha)`)
+	want := []ContentValue{
+		{Type: "counter", Value: "item", CounterStyle: "upper-roman"},
+		{Type: "counters", Value: "item", Separator: ", "},
+		{Type: "counters", Value: "sec", Separator: ".", CounterStyle: "lower-alpha"},
+	}
+	if len(values) != len(want) {
+		t.Fatalf("expected %d values, got %+v", len(want), values)
+	}
+	for i := range want {
+		if values[i] != want[i] {
+			t.Errorf("value %d: expected %+v, got %+v", i, want[i], values[i])
+		}
+	}
+}
+
+func TestGetContentAlt(t *testing.T) {
+	style := NewStyle()
+	style.Set("content", `url("data:image/svg+xml,<svg/>") "a/b" / "alt " attr(title)`)
+	values, ok := style.GetContentValues()
+	if !ok || len(values) != 2 || values[0].Type != "url" || values[1].Value != "a/b" {
+		t.Errorf("expected the url and text before the alt text, got %+v", values)
+	}
+	alt, ok := style.GetContentAlt()
+	if !ok || len(alt) != 2 || alt[0].Value != "alt " || alt[1].Type != "attr" {
+		t.Errorf("expected the alt text and attr, got %+v", alt)
+	}
+
+	style.Set("content", `"x"`)
+	if _, ok := style.GetContentAlt(); ok {
+		t.Error("expected no alt text")
+	}
+}
@@ -34,9 +34,10 @@ type SelectorPart struct {
 
 // AttributeSelector represents an attribute selector like [type="text"]
 type AttributeSelector struct {
-	Name     string // Attribute name
-	Operator string // =, ^=, $=, *=, ~=, |=
-	Value    string // Attribute value
+	Name            string // Attribute name
+	Operator        string // =, ^=, $=, *=, ~=, |=
+	Value           string // Attribute value
+	CaseInsensitive bool   // [attr=value i]: compare the value ignoring ASCII case
 }
 
 // CombinatorType represents the type of combinator between selector parts
@@ -66,21 +67,10 @@ type Rule struct {
 	MediaQuery   *MediaQuery       // Phase 22: Optional media query wrapper
 }
 
-// Phase 22: MediaQuery represents a @media rule condition
-type MediaQuery struct {
-	MediaType  string            // "screen", "print", "all", etc.
-	Conditions []MediaCondition  // min-width, max-width, etc.
-}
-
-// Phase 22: MediaCondition represents a single media query condition
-type MediaCondition struct {
-	Feature string  // "min-width", "max-width", "orientation", etc.
-	Value   string  // "768px", "landscape", etc.
-}
-
 // Stylesheet represents a parsed CSS stylesheet
 type Stylesheet struct {
-	Rules []Rule
+	Rules     []Rule
+	FontFaces []FontFace // @font-face rules, in source order
 }
 
 // stripCSSComments removes all /* ... */ comments from CSS source,
@@ -149,10 +139,14 @@ func ParseStylesheet(css string) (*Stylesheet, error) {
 	for _, ruleStr := range rules {
 		trimmed := strings.TrimSpace(ruleStr)
 		if strings.HasPrefix(trimmed, "@") {
-			// Phase 22: Handle @media; skip all other at-rules
+			// Phase 22: Handle @media and @font-face; skip all other at-rules
 			if strings.HasPrefix(trimmed, "@media") {
-				mediaRules := parseMediaRule(ruleStr)
+				mediaRules := parseMediaRule(ruleStr, nil)
 				stylesheet.Rules = append(stylesheet.Rules, mediaRules...)
+			} else if strings.HasPrefix(strings.ToLower(trimmed), "@font-face") {
+				if face, ok := parseFontFaceRule(trimmed); ok {
+					stylesheet.FontFaces = append(stylesheet.FontFaces, face)
+				}
 			}
 			// Unknown at-rules (@three-dee, @import, etc.) are silently skipped
 			continue
@@ -400,8 +394,9 @@ func parseRule(ruleStr string) (Rule, error) {
 	}, nil
 }
 
-// Phase 22: parseMediaRule parses a @media rule and returns its inner rules
-func parseMediaRule(ruleStr string) []Rule {
+// Phase 22: parseMediaRule parses a @media rule and returns its inner rules.
+// parent is the query of an enclosing @media rule, or nil.
+func parseMediaRule(ruleStr string, parent *MediaQuery) []Rule {
 	rules := make([]Rule, 0)
 
 	// Find the opening brace
@@ -413,6 +408,7 @@ func parseMediaRule(ruleStr string) []Rule {
 	// Extract media query string: @media (conditions)
 	mediaStr := strings.TrimSpace(ruleStr[:bracePos])
 	mediaQuery := parseMediaQuery(mediaStr)
+	mediaQuery.And = parent
 
 	// Extract inner CSS (between outermost { and })
 	innerStart := bracePos + 1
@@ -427,6 +423,11 @@ func parseMediaRule(ruleStr string) []Rule {
 	innerRules := splitRules(innerCSS)
 
 	for _, innerRuleStr := range innerRules {
+		if strings.HasPrefix(strings.TrimSpace(innerRuleStr), "@media") {
+			// Nested @media rules apply where both queries match
+			rules = append(rules, parseMediaRule(innerRuleStr, mediaQuery)...)
+			continue
+		}
 		rule, err := parseRule(innerRuleStr)
 		if err != nil {
 			continue
@@ -439,61 +440,6 @@ func parseMediaRule(ruleStr string) []Rule {
 	return rules
 }
 
-// Phase 22: parseMediaQuery parses a media query string like "@media screen and (min-width: 768px)"
-func parseMediaQuery(mediaStr string) *MediaQuery {
-	// Remove @media prefix
-	mediaStr = strings.TrimPrefix(mediaStr, "@media")
-	mediaStr = strings.TrimSpace(mediaStr)
-
-	mq := &MediaQuery{
-		MediaType:  "all",
-		Conditions: make([]MediaCondition, 0),
-	}
-
-	// Check for media type (screen, print, all, etc.)
-	if strings.HasPrefix(mediaStr, "screen") {
-		mq.MediaType = "screen"
-		mediaStr = strings.TrimPrefix(mediaStr, "screen")
-		mediaStr = strings.TrimSpace(mediaStr)
-	} else if strings.HasPrefix(mediaStr, "print") {
-		mq.MediaType = "print"
-		mediaStr = strings.TrimPrefix(mediaStr, "print")
-		mediaStr = strings.TrimSpace(mediaStr)
-	}
-
-	// Remove "and" keyword
-	mediaStr = strings.TrimPrefix(mediaStr, "and")
-	mediaStr = strings.TrimSpace(mediaStr)
-
-	// Parse conditions: (min-width: 768px) and (max-width: 1024px)
-	// Simple approach: split by "and" and extract each condition
-	conditionStrs := strings.Split(mediaStr, "and")
-
-	for _, condStr := range conditionStrs {
-		condStr = strings.TrimSpace(condStr)
-		if condStr == "" {
-			continue
-		}
-
-		// Remove parentheses
-		condStr = strings.Trim(condStr, "()")
-		condStr = strings.TrimSpace(condStr)
-
-		// Split by : to get feature and value
-		parts := strings.SplitN(condStr, ":", 2)
-		if len(parts) == 2 {
-			feature := strings.TrimSpace(parts[0])
-			value := strings.TrimSpace(parts[1])
-			mq.Conditions = append(mq.Conditions, MediaCondition{
-				Feature: feature,
-				Value:   value,
-			})
-		}
-	}
-
-	return mq
-}
-
 // Phase 17: parseSelector parses a complex CSS selector
 func parseSelector(selectorStr string) Selector {
 	selectorStr = strings.TrimSpace(selectorStr)
@@ -556,6 +502,15 @@ func parseSelector(selectorStr string) Selector {
 		}
 		selectorStr = strings.Replace(selectorStr, ":first-letter", "", 1)
 		selectorStr = strings.TrimSpace(selectorStr)
+	} else if strings.Contains(selectorStr, "::marker") {
+		// CSS Lists §4: the marker box of a list item
+		pseudoElement = "marker"
+		idx := strings.Index(selectorStr, "::marker")
+		if idx > 0 && selectorStr[idx-1] == ' ' {
+			pseudoElementForDescendants = true
+		}
+		selectorStr = strings.Replace(selectorStr, "::marker", "", 1)
+		selectorStr = strings.TrimSpace(selectorStr)
 	}
 	// If pseudo-element is for descendants only, clear it from direct matching
 	// but record it somehow (we'll use a convention: if PseudoElement starts with "descendant:",
@@ -617,15 +572,7 @@ func parseSelector(selectorStr string) Selector {
 	// Calculate specificity: count IDs (100), classes (10), elements (1)
 	specificity := 0
 	for _, part := range parts {
-		if part.ID != "" {
-			specificity += 100
-		}
-		specificity += len(part.Classes) * 10
-		specificity += len(part.Attributes) * 10
-		specificity += len(part.PseudoClasses) * 10
-		if part.Element != "" && part.Element != "*" {
-			specificity += 1
-		}
+		specificity += partSpecificity(part)
 	}
 
 	// Set legacy fields for backward compatibility (simple selectors only)
@@ -656,22 +603,88 @@ func parseSelector(selectorStr string) Selector {
 	}
 }
 
+// partSpecificity returns the specificity of one compound selector: IDs
+// count 100, classes, attributes, and pseudo-classes 10, and elements 1.
+func partSpecificity(part SelectorPart) int {
+	specificity := 0
+	if part.ID != "" {
+		specificity += 100
+	}
+	specificity += len(part.Classes) * 10
+	specificity += len(part.Attributes) * 10
+	for _, pc := range part.PseudoClasses {
+		specificity += pseudoClassSpecificity(pc)
+	}
+	if part.Element != "" && part.Element != "*" {
+		specificity += 1
+	}
+	return specificity
+}
+
+// pseudoClassSpecificity returns the specificity of a pseudo-class. Per
+// Selectors 4 §17, :not() and :is() take the specificity of their most
+// specific argument and :where() contributes nothing.
+func pseudoClassSpecificity(pc string) int {
+	name, arg, _ := splitPseudoClass(pc)
+	switch name {
+	case "where":
+		return 0
+	case "not", "is":
+		most := 0
+		for _, sel := range splitSelectorGroup(arg) {
+			most = max(most, parseSelector(sel).Specificity)
+		}
+		return most
+	}
+	return 10
+}
+
+// splitPseudoClass splits a pseudo-class like "nth-child(2n+1)" into its
+// lowercased name and argument. hasArg is false for plain pseudo-classes.
+func splitPseudoClass(pc string) (name, arg string, hasArg bool) {
+	open := strings.IndexByte(pc, '(')
+	if open == -1 || !strings.HasSuffix(pc, ")") {
+		return strings.ToLower(pc), "", false
+	}
+	return strings.ToLower(pc[:open]), strings.TrimSpace(pc[open+1 : len(pc)-1]), true
+}
+
 // tokenizeSelector splits a selector into tokens (handling combinators)
 func tokenizeSelector(s string) []string {
 	tokens := make([]string, 0)
 	current := ""
 	inBracket := false
+	parenDepth := 0 // Inside :not(...), :nth-child(...), etc.
+	inString := byte(0)
 
 	for i := 0; i < len(s); i++ {
 		ch := s[i]
 
-		if ch == '[' {
+		if inString != 0 {
+			if ch == inString {
+				inString = 0
+			}
+			current += string(ch)
+		} else if (ch == '"' || ch == '\'') && inBracket {
+			inString = ch
+			current += string(ch)
+		} else if ch == '[' {
 			inBracket = true
 			current += string(ch)
 		} else if ch == ']' {
 			inBracket = false
 			current += string(ch)
-		} else if !inBracket && (ch == '>' || ch == '+' || ch == '~' || ch == ' ') {
+		} else if ch == '(' || ch == ')' {
+			if ch == '(' {
+				parenDepth++
+			} else if parenDepth > 0 {
+				parenDepth--
+			}
+			current += string(ch)
+		} else if !inBracket && parenDepth == 0 && (ch == '>' || ch == '+' || ch == '~' || ch == ' ' || ch == '\t' || ch == '\n') {
+			if ch == '\t' || ch == '\n' {
+				ch = ' '
+			}
 			if current != "" {
 				tokens = append(tokens, current)
 				current = ""
@@ -725,7 +738,7 @@ func parseSelectorPart(s string) SelectorPart {
 		for j < len(s) && s[j] != '.' && s[j] != '#' && s[j] != '[' && s[j] != ':' {
 			j++
 		}
-		part.Element = s[i:j]
+		part.Element = strings.ToLower(s[i:j]) // HTML element names are case-insensitive
 		i = j
 	}
 
@@ -777,9 +790,15 @@ func parseSelectorPart(s string) SelectorPart {
 			}
 			i = j
 		} else if s[i] == '[' {
-			// Attribute
+			// Attribute (a quoted value may contain ']')
 			j := i + 1
-			for j < len(s) && s[j] != ']' {
+			quote := byte(0)
+			for j < len(s) && (quote != 0 || s[j] != ']') {
+				if quote != 0 && s[j] == quote {
+					quote = 0
+				} else if quote == 0 && (s[j] == '"' || s[j] == '\'') {
+					quote = s[j]
+				}
 				j++
 			}
 			if j < len(s) {
@@ -798,102 +817,47 @@ func parseSelectorPart(s string) SelectorPart {
 	return part
 }
 
-// parseAttributeSelector parses an attribute selector like "type=text" or "href^=https"
+// parseAttributeSelector parses an attribute selector like "type=text",
+// "href^=https", or `lang="EN" i` (case-insensitive value match).
 func parseAttributeSelector(s string) AttributeSelector {
-	// Find the operator
-	operators := []string{"^=", "$=", "*=", "~=", "|=", "="}
-
-	for _, op := range operators {
-		if idx := strings.Index(s, op); idx != -1 {
-			name := strings.TrimSpace(s[:idx])
-			value := strings.TrimSpace(s[idx+len(op):])
-			// Remove quotes from value
-			value = strings.Trim(value, `"'`)
-			// Handle CSS escape sequences (e.g., second\ two → second two)
-			value = strings.ReplaceAll(value, `\ `, " ")
-			return AttributeSelector{
-				Name:     name,
-				Operator: op,
-				Value:    value,
-			}
+	// The operator is the first '=', with an optional preceding modifier
+	idx := strings.IndexByte(s, '=')
+	if idx == -1 {
+		// No operator, just attribute name (existence check)
+		return AttributeSelector{
+			Name:     strings.TrimSpace(s),
+			Operator: "",
+			Value:    "",
 		}
 	}
-
-	// No operator, just attribute name (existence check)
-	return AttributeSelector{
-		Name:     strings.TrimSpace(s),
-		Operator: "",
-		Value:    "",
+	op := "="
+	nameEnd := idx
+	if idx > 0 && strings.IndexByte("^$*~|", s[idx-1]) != -1 {
+		op = s[idx-1:idx+1]
+		nameEnd = idx - 1
 	}
-}
-
-// Phase 22: EvaluateMediaQuery checks if a media query matches the given viewport dimensions
-func EvaluateMediaQuery(mq *MediaQuery, viewportWidth, viewportHeight float64) bool {
-	if mq == nil {
-		// No media query = always matches
-		return true
+	name := strings.TrimSpace(s[:nameEnd])
+	value := strings.TrimSpace(s[idx+1:])
+
+	// Selectors 4 §6.3: a trailing "i" flag makes the value match ASCII case-insensitively
+	caseInsensitive := false
+	if n := len(value); n > 2 && (value[n-1] == 'i' || value[n-1] == 'I') && (value[n-2] == ' ' || value[n-2] == '"' || value[n-2] == '\'') {
+		caseInsensitive = true
+		value = strings.TrimSpace(value[:n-1])
 	}
 
-	// Check media type (we only support "all" and "screen" for now)
-	if mq.MediaType != "all" && mq.MediaType != "screen" {
-		return false
+	// Remove quotes from value
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
 	}
-
-	// Check all conditions
-	for _, cond := range mq.Conditions {
-		if !evaluateMediaCondition(cond, viewportWidth, viewportHeight) {
-			return false
-		}
-	}
-
-	return true
-}
-
-// Phase 22: evaluateMediaCondition checks if a single media condition matches
-func evaluateMediaCondition(cond MediaCondition, viewportWidth, viewportHeight float64) bool {
-	// Parse the value to get numeric value and unit
-	value, unit := parseMediaLength(cond.Value)
-
-	// For simplicity, we only support px units
-	if unit != "px" {
-		return true // Unknown units = assume match
-	}
-
-	switch cond.Feature {
-	case "min-width":
-		return viewportWidth >= value
-	case "max-width":
-		return viewportWidth <= value
-	case "min-height":
-		return viewportHeight >= value
-	case "max-height":
-		return viewportHeight <= value
-	default:
-		return true // Unknown feature = assume match
-	}
-}
-
-// Phase 22: parseMediaLength parses a length value and returns value and unit
-func parseMediaLength(val string) (float64, string) {
-	val = strings.TrimSpace(val)
-
-	// Check for px suffix
-	if strings.HasSuffix(val, "px") {
-		numStr := strings.TrimSuffix(val, "px")
-		if num, err := fmt.Sscanf(numStr, "%f", new(float64)); err == nil && num == 1 {
-			var value float64
-			fmt.Sscanf(numStr, "%f", &value)
-			return value, "px"
-		}
-	}
-
-	// Try to parse as plain number (assume px)
-	var value float64
-	if _, err := fmt.Sscanf(val, "%f", &value); err == nil {
-		return value, "px"
+	// Handle CSS escape sequences (e.g., second\ two → second two)
+	value = strings.ReplaceAll(value, `\ `, " ")
+	return AttributeSelector{
+		Name:            name,
+		Operator:        op,
+		Value:           value,
+		CaseInsensitive: caseInsensitive,
 	}
-
-	return 0, ""
 }
 
 // splitDeclarationParts splits a declaration block by semicolons,
@@ -1089,7 +1053,7 @@ func isLengthProperty(prop string) bool {
 		"padding", "padding-top", "padding-right", "padding-bottom", "padding-left",
 		"border-width", "border-top-width", "border-right-width", "border-bottom-width", "border-left-width",
 		"top", "right", "bottom", "left",
-		"font-size", "line-height", "letter-spacing", "word-spacing",
+		"font-size", "letter-spacing", "word-spacing",
 		"text-indent", "vertical-align":
 		return true
 	}
@@ -1106,10 +1070,10 @@ func isColorProperty(prop string) bool {
 	return false
 }
 
-// isValidColorValue checks if a value is a valid CSS color (parsed color, currentcolor, or inherit)
+// isValidColorValue checks if a value is a valid CSS color (parsed color, currentcolor, or a CSS-wide keyword)
 func isValidColorValue(value string) bool {
 	lower := strings.ToLower(strings.TrimSpace(value))
-	if lower == "currentcolor" || lower == "inherit" {
+	if lower == "currentcolor" || lower == "inherit" || lower == "initial" || lower == "unset" {
 		return true
 	}
 	_, ok := ParseColor(value)
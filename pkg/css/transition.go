@@ -0,0 +1,411 @@
+package css
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSS Transitions (CSS Transitions 1)
+
+// Transition is one entry of an element's transition-* lists: how a change
+// to Property (a property name or "all") is animated.
+type Transition struct {
+	Property       string
+	Duration       time.Duration
+	Delay          time.Duration
+	TimingFunction TimingFunction
+}
+
+// TimingFunction maps the fraction of a transition's duration that has
+// elapsed to the fraction of the change in value shown (CSS Easing 1).
+type TimingFunction struct {
+	// Control points of a cubic Bézier curve from (0, 0) to (1, 1)
+	X1, Y1, X2, Y2 float64
+
+	// Number of intervals of a step function (0 for a curve), and whether
+	// the first step happens at the start of the transition
+	Steps     int
+	JumpStart bool
+}
+
+// Predefined timing functions
+var (
+	TimingLinear    = TimingFunction{X1: 0, Y1: 0, X2: 1, Y2: 1}
+	TimingEase      = TimingFunction{X1: 0.25, Y1: 0.1, X2: 0.25, Y2: 1}
+	TimingEaseIn    = TimingFunction{X1: 0.42, Y1: 0, X2: 1, Y2: 1}
+	TimingEaseOut   = TimingFunction{X1: 0, Y1: 0, X2: 0.58, Y2: 1}
+	TimingEaseInOut = TimingFunction{X1: 0.42, Y1: 0, X2: 0.58, Y2: 1}
+)
+
+// Progress returns the output progress of the timing function for the
+// input progress t, which is clamped to 0-1.
+func (f TimingFunction) Progress(t float64) float64 {
+	t = math.Max(0, math.Min(t, 1))
+	if f.Steps > 0 {
+		n := float64(f.Steps)
+		step := math.Floor(t * n)
+		if f.JumpStart {
+			step++
+		}
+		return math.Min(step/n, 1)
+	}
+	if f.X1 == f.Y1 && f.X2 == f.Y2 {
+		return t // Linear
+	}
+
+	// Find the curve parameter u whose x is t by bisection (x is monotonic
+	// in u since the control points' x lie in 0-1), then return its y
+	bezier := func(u, p1, p2 float64) float64 {
+		v := 1 - u
+		return 3*v*v*u*p1 + 3*v*u*u*p2 + u*u*u
+	}
+	lo, hi := 0.0, 1.0
+	for i := 0; i < 50; i++ {
+		mid := (lo + hi) / 2
+		if bezier(mid, f.X1, f.X2) < t {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return bezier((lo+hi)/2, f.Y1, f.Y2)
+}
+
+// ParseTimingFunction parses a transition-timing-function value: a keyword,
+// cubic-bezier(x1, y1, x2, y2), or steps(n[, start | end]).
+func ParseTimingFunction(value string) (TimingFunction, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "linear":
+		return TimingLinear, true
+	case "ease":
+		return TimingEase, true
+	case "ease-in":
+		return TimingEaseIn, true
+	case "ease-out":
+		return TimingEaseOut, true
+	case "ease-in-out":
+		return TimingEaseInOut, true
+	case "step-start":
+		return TimingFunction{Steps: 1, JumpStart: true}, true
+	case "step-end":
+		return TimingFunction{Steps: 1}, true
+	}
+
+	open := strings.IndexByte(value, '(')
+	if open < 0 || !strings.HasSuffix(value, ")") {
+		return TimingFunction{}, false
+	}
+	args := strings.Split(value[open+1:len(value)-1], ",")
+	for i := range args {
+		args[i] = strings.TrimSpace(args[i])
+	}
+	switch value[:open] {
+	case "cubic-bezier":
+		if len(args) != 4 {
+			return TimingFunction{}, false
+		}
+		var p [4]float64
+		for i, arg := range args {
+			v, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return TimingFunction{}, false
+			}
+			p[i] = v
+		}
+		if p[0] < 0 || p[0] > 1 || p[2] < 0 || p[2] > 1 {
+			return TimingFunction{}, false
+		}
+		return TimingFunction{X1: p[0], Y1: p[1], X2: p[2], Y2: p[3]}, true
+	case "steps":
+		if len(args) < 1 || len(args) > 2 {
+			return TimingFunction{}, false
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return TimingFunction{}, false
+		}
+		f := TimingFunction{Steps: n}
+		if len(args) == 2 {
+			switch args[1] {
+			case "start", "jump-start":
+				f.JumpStart = true
+			case "end", "jump-end":
+			default:
+				return TimingFunction{}, false
+			}
+		}
+		return f, true
+	}
+	return TimingFunction{}, false
+}
+
+// parseTime parses a CSS <time>, in seconds or milliseconds.
+func parseTime(value string) (time.Duration, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	scale := float64(time.Second)
+	switch {
+	case strings.HasSuffix(value, "ms"):
+		value, scale = strings.TrimSuffix(value, "ms"), float64(time.Millisecond)
+	case strings.HasSuffix(value, "s"):
+		value = strings.TrimSuffix(value, "s")
+	case value != "0":
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(v * scale), true
+}
+
+// expandTransitionProperty expands the transition shorthand into the four
+// transition-* lists. In each comma-separated entry the first time is the
+// duration and the second the delay.
+func expandTransitionProperty(style *Style, value string) {
+	var properties, durations, timings, delays []string
+	for _, entry := range splitTopLevelCommas(value) {
+		property, duration, timing, delay := "all", "0s", "ease", "0s"
+		times := 0
+		for _, part := range splitTopLevelFields(entry) {
+			if _, ok := parseTime(part); ok {
+				if times == 0 {
+					duration = part
+				} else {
+					delay = part
+				}
+				times++
+			} else if _, ok := ParseTimingFunction(part); ok {
+				timing = part
+			} else {
+				property = strings.ToLower(part)
+			}
+		}
+		properties = append(properties, property)
+		durations = append(durations, duration)
+		timings = append(timings, timing)
+		delays = append(delays, delay)
+	}
+	style.Set("transition-property", strings.Join(properties, ", "))
+	style.Set("transition-duration", strings.Join(durations, ", "))
+	style.Set("transition-timing-function", strings.Join(timings, ", "))
+	style.Set("transition-delay", strings.Join(delays, ", "))
+}
+
+// GetTransitions returns the element's transitions, one per entry of
+// transition-property. The other lists are repeated as needed to match its
+// length (CSS Transitions 1 §2). Entries with invalid values are dropped.
+func (s *Style) GetTransitions() []Transition {
+	list := func(property, initial string) []string {
+		value, ok := s.Get(property)
+		if !ok {
+			value = initial
+		}
+		items := splitTopLevelCommas(value)
+		for i := range items {
+			items[i] = strings.TrimSpace(items[i])
+		}
+		return items
+	}
+	properties := list("transition-property", "all")
+	durations := list("transition-duration", "0s")
+	timings := list("transition-timing-function", "ease")
+	delays := list("transition-delay", "0s")
+
+	var transitions []Transition
+	for i, property := range properties {
+		duration, ok1 := parseTime(durations[i%len(durations)])
+		delay, ok2 := parseTime(delays[i%len(delays)])
+		timing, ok3 := ParseTimingFunction(timings[i%len(timings)])
+		if property == "none" || property == "" || !ok1 || !ok2 || !ok3 || duration < 0 {
+			continue
+		}
+		transitions = append(transitions, Transition{
+			Property:       strings.ToLower(property),
+			Duration:       duration,
+			Delay:          delay,
+			TimingFunction: timing,
+		})
+	}
+	return transitions
+}
+
+// TransitionFor returns the transition that applies to changes of
+// property: the last entry naming it, "all", or a shorthand containing it.
+// It reports false if there is none or its duration is zero.
+func (s *Style) TransitionFor(property string) (Transition, bool) {
+	if _, ok := s.Get("transition-duration"); !ok {
+		return Transition{}, false // The initial duration of 0s never transitions
+	}
+	var found Transition
+	ok := false
+	for _, t := range s.GetTransitions() {
+		if t.Property == "all" || t.Property == property || strings.HasPrefix(property, t.Property+"-") {
+			found, ok = t, true
+		}
+	}
+	return found, ok && found.Duration > 0
+}
+
+// InterpolateValue returns the value progress of the way from one computed
+// value to another. Colors interpolate their channels with premultiplied
+// alpha; other values made of the same keywords and functions interpolate
+// each number between them, so "translateX(0px)" and "translateX(10px)" or
+// "0.5" and "1" can be interpolated but "auto" and "10px" cannot. A
+// transform list interpolates with none as the identity transforms.
+func InterpolateValue(from, to string, progress float64) (string, bool) {
+	from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+	if c1, ok := ParseColor(from); ok {
+		c2, ok := ParseColor(to)
+		if !ok {
+			return "", false
+		}
+		return formatColor(interpolateColor(c1, c2, progress)), true
+	}
+
+	fromTokens, toTokens := tokenizeValue(from), tokenizeValue(to)
+	if from == "none" && isFunctionList(toTokens) {
+		fromTokens = identityTransforms(toTokens)
+	} else if to == "none" && isFunctionList(fromTokens) {
+		toTokens = identityTransforms(fromTokens)
+	}
+	if len(fromTokens) != len(toTokens) {
+		return "", false
+	}
+	var b strings.Builder
+	for i, a := range fromTokens {
+		z := toTokens[i]
+		if a.isNumber != z.isNumber {
+			return "", false
+		}
+		if !a.isNumber {
+			if a.text != z.text {
+				return "", false
+			}
+			b.WriteString(a.text)
+			continue
+		}
+		unit := a.unit
+		switch {
+		case a.unit == z.unit:
+		case a.unit == "" && a.number == 0:
+			unit = z.unit
+		case z.unit == "" && z.number == 0:
+		default:
+			return "", false
+		}
+		v := a.number + (z.number-a.number)*progress
+		b.WriteString(strconv.FormatFloat(math.Round(v*1e4)/1e4, 'f', -1, 64))
+		b.WriteString(unit)
+	}
+	return b.String(), true
+}
+
+// interpolateColor interpolates between two colors in premultiplied alpha
+// (CSS Color 4 §12.3), so fading from transparent doesn't pass through black.
+func interpolateColor(from, to Color, progress float64) Color {
+	a := from.A + (to.A-from.A)*progress
+	if a <= 0 {
+		return Color{0, 0, 0, 0}
+	}
+	channel := func(c1, c2 uint8) uint8 {
+		p1, p2 := float64(c1)*from.A, float64(c2)*to.A
+		return clampChannel((p1 + (p2-p1)*progress) / a)
+	}
+	return Color{channel(from.R, to.R), channel(from.G, to.G), channel(from.B, to.B), math.Min(a, 1)}
+}
+
+// valueToken is a run of text or a number with its unit in a value.
+type valueToken struct {
+	text     string
+	number   float64
+	unit     string
+	isNumber bool
+}
+
+// tokenizeValue splits a value into numbers (with their units) and the
+// text between them. Digits inside identifiers, like the 3d of
+// translate3d or the digits of a hex color, are text.
+func tokenizeValue(value string) []valueToken {
+	isIdent := func(ch byte) bool {
+		return ch == '_' || ch == '#' || ch == '-' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9'
+	}
+	isDigit := func(ch byte) bool { return ch >= '0' && ch <= '9' }
+
+	var tokens []valueToken
+	textStart := 0
+	for i := 0; i < len(value); {
+		j := i
+		if value[j] == '+' || value[j] == '-' {
+			j++
+		}
+		startsNumber := j < len(value) && (isDigit(value[j]) || value[j] == '.' && j+1 < len(value) && isDigit(value[j+1]))
+		if !startsNumber || (i > 0 && isIdent(value[i-1])) {
+			i++
+			continue
+		}
+		for j < len(value) && (isDigit(value[j]) || value[j] == '.') {
+			j++
+		}
+		number, err := strconv.ParseFloat(value[i:j], 64)
+		if err != nil {
+			i = j
+			continue
+		}
+		unitStart := j
+		for j < len(value) && (value[j] == '%' || value[j] >= 'a' && value[j] <= 'z' || value[j] >= 'A' && value[j] <= 'Z') {
+			j++
+		}
+		if textStart < i {
+			tokens = append(tokens, valueToken{text: value[textStart:i]})
+		}
+		tokens = append(tokens, valueToken{number: number, unit: strings.ToLower(value[unitStart:j]), isNumber: true})
+		i, textStart = j, j
+	}
+	if textStart < len(value) {
+		tokens = append(tokens, valueToken{text: value[textStart:]})
+	}
+	return tokens
+}
+
+// isFunctionList reports whether tokens are a list of functions, like a
+// transform list.
+func isFunctionList(tokens []valueToken) bool {
+	return len(tokens) > 0 && !tokens[0].isNumber && strings.Contains(tokens[0].text, "(") &&
+		!tokens[len(tokens)-1].isNumber && strings.HasSuffix(tokens[len(tokens)-1].text, ")")
+}
+
+// identityTransforms returns a copy of a transform list whose functions
+// have the arguments that leave an element unchanged: scales of 1, a unit
+// matrix, and zero translations, rotations, and skews.
+func identityTransforms(tokens []valueToken) []valueToken {
+	identity := make([]valueToken, len(tokens))
+	function := ""
+	arg := 0
+	for i, t := range tokens {
+		identity[i] = t
+		if !t.isNumber {
+			if open := strings.LastIndexByte(t.text, '('); open >= 0 {
+				name := strings.TrimSpace(t.text[:open])
+				if space := strings.LastIndexAny(name, " )"); space >= 0 {
+					name = strings.TrimSpace(name[space+1:])
+				}
+				function, arg = strings.ToLower(name), 0
+			}
+			continue
+		}
+		identity[i].number = 0
+		switch {
+		case strings.HasPrefix(function, "scale"):
+			identity[i].number = 1
+		case function == "matrix" && (arg == 0 || arg == 3):
+			identity[i].number = 1
+		case function == "matrix3d" && arg%5 == 0:
+			identity[i].number = 1
+		}
+		arg++
+	}
+	return identity
+}
@@ -0,0 +1,86 @@
+package css
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTransitionShorthand(t *testing.T) {
+	style := ParseInlineStyle("transition: opacity 0.5s ease-in, transform 200ms 1s, color 1s steps(4, start)")
+	transitions := style.GetTransitions()
+	if len(transitions) != 3 {
+		t.Fatalf("expected 3 transitions, got %d", len(transitions))
+	}
+	want := []Transition{
+		{Property: "opacity", Duration: 500 * time.Millisecond, TimingFunction: TimingEaseIn},
+		{Property: "transform", Duration: 200 * time.Millisecond, Delay: time.Second, TimingFunction: TimingEase},
+		{Property: "color", Duration: time.Second, TimingFunction: TimingFunction{Steps: 4, JumpStart: true}},
+	}
+	for i, w := range want {
+		if transitions[i] != w {
+			t.Errorf("transition %d: expected %+v, got %+v", i, w, transitions[i])
+		}
+	}
+}
+
+func TestTransitionFor_RepeatsLists(t *testing.T) {
+	style := ParseInlineStyle("transition-property: opacity, margin; transition-duration: 1s")
+	if tr, ok := style.TransitionFor("margin-left"); !ok || tr.Duration != time.Second {
+		t.Errorf("expected margin-left to transition through the margin shorthand, got %+v, %v", tr, ok)
+	}
+	if _, ok := style.TransitionFor("color"); ok {
+		t.Error("expected color not to transition")
+	}
+	if _, ok := ParseInlineStyle("transition-property: all").TransitionFor("opacity"); ok {
+		t.Error("expected no transition without a duration")
+	}
+}
+
+func TestTimingFunction_Progress(t *testing.T) {
+	tests := []struct {
+		f    TimingFunction
+		in   float64
+		want float64
+	}{
+		{TimingLinear, 0.3, 0.3},
+		{TimingEase, 0, 0},
+		{TimingEase, 1, 1},
+		{TimingEase, 0.5, 0.8024},
+		{TimingEaseInOut, 0.5, 0.5},
+		{TimingFunction{Steps: 4}, 0.3, 0.25},
+		{TimingFunction{Steps: 4, JumpStart: true}, 0.3, 0.5},
+	}
+	for _, tt := range tests {
+		if got := tt.f.Progress(tt.in); math.Abs(got-tt.want) > 0.001 {
+			t.Errorf("%+v.Progress(%v) = %v, want %v", tt.f, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestInterpolateValue(t *testing.T) {
+	tests := []struct {
+		from, to string
+		progress float64
+		want     string
+	}{
+		{"0", "1", 0.25, "0.25"},
+		{"10px", "20px", 0.5, "15px"},
+		{"0", "20px", 0.5, "10px"},
+		{"red", "blue", 0.5, "rgba(128, 0, 128, 1)"},
+		{"transparent", "rgba(0, 0, 255, 1)", 0.5, "rgba(0, 0, 255, 0.5)"},
+		{"translateX(0px) rotate(0deg)", "translateX(100px) rotate(90deg)", 0.5, "translateX(50px) rotate(45deg)"},
+		{"none", "scale(2) translate(10px, 20px)", 0.5, "scale(1.5) translate(5px, 10px)"},
+		{"translate3d(0px, 0px, 0px)", "translate3d(10px, 0px, 0px)", 0.5, "translate3d(5px, 0px, 0px)"},
+	}
+	for _, tt := range tests {
+		if got, ok := InterpolateValue(tt.from, tt.to, tt.progress); !ok || got != tt.want {
+			t.Errorf("InterpolateValue(%q, %q, %v) = %q, %v; want %q", tt.from, tt.to, tt.progress, got, ok, tt.want)
+		}
+	}
+	for _, pair := range [][2]string{{"auto", "10px"}, {"10px", "50%"}, {"block", "none"}, {"rotate(0deg)", "scale(2)"}} {
+		if got, ok := InterpolateValue(pair[0], pair[1], 0.5); ok {
+			t.Errorf("expected %q and %q not to interpolate, got %q", pair[0], pair[1], got)
+		}
+	}
+}
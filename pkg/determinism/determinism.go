@@ -0,0 +1,37 @@
+// Package determinism switches louis14 into a mode where rendering depends
+// only on its input, so the same page renders to the same pixels on any
+// machine: tools that generate or compare reference images enable it.
+//
+// In deterministic mode only the bundled fonts are used, never installed
+// system fonts; scripts see a clock that starts at Epoch and advances only
+// with the engine's virtual time, a Math.random sequence with a fixed
+// seed, and UTC as the local time zone.
+package determinism
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Epoch is the wall-clock time scripts see when a page starts loading in
+// deterministic mode.
+var Epoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Seed seeds the Math.random sequence of each script engine in
+// deterministic mode.
+const Seed = 1
+
+var enabled atomic.Bool
+
+// Enable turns on deterministic mode for the rest of the process. It sets
+// time.Local to UTC, and must be called before any page is laid out, as
+// the font registry is built once, on first use.
+func Enable() {
+	enabled.Store(true)
+	time.Local = time.UTC
+}
+
+// Enabled reports whether deterministic mode is on.
+func Enabled() bool {
+	return enabled.Load()
+}
@@ -0,0 +1,56 @@
+package html
+
+import (
+	"image"
+	"strconv"
+	"strings"
+)
+
+// Default size of a <canvas> without width and height attributes.
+const (
+	defaultCanvasWidth  = 300
+	defaultCanvasHeight = 150
+)
+
+// The largest canvas bitmap: browsers limit the side and area of a canvas
+// so a page can't make them allocate gigabytes. The area is Safari's limit
+// of 16M pixels, 64MB of RGBA.
+const (
+	MaxCanvasDimension = 32767
+	MaxCanvasArea      = 1 << 24
+)
+
+// CanvasSize returns the size of a <canvas> element's bitmap: its width
+// and height attributes, or 300×150 where they are missing or invalid. A
+// canvas larger than MaxCanvasDimension on a side or MaxCanvasArea in all
+// has no bitmap, and is 0×0.
+func (n *Node) CanvasSize() (width, height int) {
+	width, height = canvasDimension(n, "width", defaultCanvasWidth), canvasDimension(n, "height", defaultCanvasHeight)
+	if width > MaxCanvasDimension || height > MaxCanvasDimension || width*height > MaxCanvasArea {
+		return 0, 0
+	}
+	return width, height
+}
+
+func canvasDimension(n *Node, name string, fallback int) int {
+	v, ok := n.GetAttribute(name)
+	if !ok {
+		return fallback
+	}
+	d, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || d < 0 {
+		return fallback
+	}
+	return d
+}
+
+// CanvasBitmap returns the bitmap a <canvas> element is drawn into. A new,
+// transparent bitmap replaces the old one when the width or height
+// attribute changes, which clears the canvas as in browsers.
+func (n *Node) CanvasBitmap() *image.RGBA {
+	w, h := n.CanvasSize()
+	if n.canvas == nil || n.canvas.Rect.Dx() != w || n.canvas.Rect.Dy() != h {
+		n.canvas = image.NewRGBA(image.Rect(0, 0, w, h))
+	}
+	return n.canvas
+}
@@ -1,6 +1,7 @@
 package html
 
 import (
+	"image"
 	"sort"
 	"strings"
 )
@@ -12,6 +13,25 @@ type Node struct {
 	Text       string
 	Children   []*Node
 	Parent     *Node // Phase 2: Support proper tree structure
+
+	// For <template>: its contents, an inert DocumentFragmentNode that is
+	// not part of the tree and never laid out
+	Content *Node
+
+	// Interaction state for dynamic pseudo-classes (:hover, :active, :focus)
+	state ElementState
+
+	// Current value of an input edited by the user or a script; until then
+	// (valueDirty false) the value attribute is the value
+	value      string
+	valueDirty bool
+
+	// Bitmap of a <canvas>, created when first drawn or laid out
+	canvas *image.RGBA
+
+	// Incremental layout: set by mutations, cleared by the layout engine
+	dirty      bool // This node's attributes, text, or child list changed
+	childDirty bool // Some descendant is dirty
 }
 
 type NodeType int
@@ -19,12 +39,48 @@ type NodeType int
 const (
 	ElementNode NodeType = iota
 	TextNode
+	DocumentFragmentNode // Detached container whose children move when it is inserted
+)
+
+// ElementState is a set of user interaction states an element is in.
+type ElementState uint8
+
+const (
+	StateHover       ElementState = 1 << iota // The pointer is over the element or a descendant
+	StateActive                               // The element or a descendant is being activated
+	StateFocus                                // The element has focus
+	StateFocusWithin                          // The element or a descendant has focus
 )
 
 type Document struct {
 	Root        *Node
 	Stylesheets []string // Phase 3: CSS from <style> tags
 	Scripts     []string // JavaScript from <script> tags
+	ScriptInfo  []Script // Metadata of Scripts, by index
+	BaseURL     string   // href of the first <base> with one; "" if none
+}
+
+// ScriptType is how a script is run (HTML §4.12.1.1).
+type ScriptType int
+
+const (
+	ScriptClassic ScriptType = iota // Run in the global scope, in document order
+	ScriptModule                    // <script type=module>: strict, own scope, run after parsing
+)
+
+// Script is the metadata of a script in Document.Scripts.
+type Script struct {
+	Type       ScriptType
+	Attributes map[string]string // The <script> element's attributes
+}
+
+// ScriptMetadata returns the metadata of Scripts[i]. A script added without
+// any is classic.
+func (d *Document) ScriptMetadata(i int) Script {
+	if i < len(d.ScriptInfo) {
+		return d.ScriptInfo[i]
+	}
+	return Script{Type: ScriptClassic}
 }
 
 func NewDocument() *Document {
@@ -36,6 +92,7 @@ func NewDocument() *Document {
 		},
 		Stylesheets: make([]string, 0),
 		Scripts:     make([]string, 0),
+		ScriptInfo:  make([]Script, 0),
 	}
 }
 
@@ -47,10 +104,79 @@ func (n *Node) GetAttribute(name string) (string, bool) {
 	return val, ok
 }
 
+// SetAttribute sets an attribute value and marks the node dirty.
+func (n *Node) SetAttribute(name, value string) {
+	if n.Attributes == nil {
+		n.Attributes = make(map[string]string)
+	}
+	n.Attributes[name] = value
+	n.MarkDirty()
+}
+
+// RemoveAttribute deletes an attribute and marks the node dirty.
+func (n *Node) RemoveAttribute(name string) {
+	if n.Attributes == nil {
+		return
+	}
+	delete(n.Attributes, name)
+	n.MarkDirty()
+}
+
+// MarkDirty records that this node changed since the last layout and
+// flags every ancestor as having a dirty descendant.
+func (n *Node) MarkDirty() {
+	n.dirty = true
+	for p := n.Parent; p != nil && !p.childDirty; p = p.Parent {
+		p.childDirty = true
+	}
+}
+
+// IsDirty returns true if this node changed since the last ClearDirty.
+func (n *Node) IsDirty() bool {
+	return n.dirty
+}
+
+// IsSubtreeClean returns true if neither this node nor any descendant is dirty.
+func (n *Node) IsSubtreeClean() bool {
+	return !n.dirty && !n.childDirty
+}
+
+// ClearDirty resets the dirty flags of this node and all its descendants.
+func (n *Node) ClearDirty() {
+	if n.IsSubtreeClean() {
+		return
+	}
+	n.dirty = false
+	n.childDirty = false
+	for _, child := range n.Children {
+		child.ClearDirty()
+	}
+}
+
+// HasState returns true if the node is in all of the given states.
+func (n *Node) HasState(state ElementState) bool {
+	return n.state&state == state
+}
+
+// SetState adds or removes interaction states, marking the node dirty if
+// its state changed.
+func (n *Node) SetState(state ElementState, on bool) {
+	old := n.state
+	if on {
+		n.state |= state
+	} else {
+		n.state &^= state
+	}
+	if n.state != old {
+		n.MarkDirty()
+	}
+}
+
 // AddChild adds a child node and sets up the parent relationship
 func (n *Node) AddChild(child *Node) {
 	child.Parent = n
 	n.Children = append(n.Children, child)
+	n.MarkDirty()
 }
 
 // AppendText creates a text node and adds it as a child
@@ -64,6 +190,7 @@ func (n *Node) AppendText(text string) {
 		Parent: n,
 	}
 	n.Children = append(n.Children, textNode)
+	n.MarkDirty()
 }
 
 // RemoveChild removes the given child from this node's children list,
@@ -74,6 +201,7 @@ func (n *Node) RemoveChild(child *Node) *Node {
 		if c == child {
 			n.Children = append(n.Children[:i], n.Children[i+1:]...)
 			child.Parent = nil
+			n.MarkDirty()
 			return child
 		}
 	}
@@ -101,6 +229,7 @@ func (n *Node) InsertBefore(newChild, refChild *Node) *Node {
 			copy(n.Children[i+1:], n.Children[i:])
 			n.Children[i] = newChild
 			newChild.Parent = n
+			n.MarkDirty()
 			return newChild
 		}
 	}
@@ -134,6 +263,9 @@ func (n *Node) CloneNode(deep bool) *Node {
 	} else {
 		clone.Children = make([]*Node, 0)
 	}
+	if deep && n.Content != nil {
+		clone.Content = n.Content.CloneNode(true)
+	}
 	return clone
 }
 
@@ -168,7 +300,11 @@ func (n *Node) IndexInParent() int {
 // all child nodes, but not the node's own tags.
 func (n *Node) Serialize() string {
 	var sb strings.Builder
-	for _, child := range n.Children {
+	children := n.Children
+	if n.Content != nil {
+		children = n.Content.Children // A template's markup is its content
+	}
+	for _, child := range children {
 		serializeNode(&sb, child)
 	}
 	return sb.String()
@@ -184,7 +320,11 @@ func (n *Node) SerializeOuter() string {
 
 func serializeNode(sb *strings.Builder, n *Node) {
 	if n.Type == TextNode {
-		sb.WriteString(escapeHTML(n.Text))
+		if n.Parent != nil && (n.Parent.TagName == "script" || n.Parent.TagName == "style") {
+			sb.WriteString(n.Text) // Raw text is not escaped
+		} else {
+			sb.WriteString(escapeHTML(n.Text))
+		}
 		return
 	}
 
@@ -213,7 +353,11 @@ func serializeNode(sb *strings.Builder, n *Node) {
 	}
 
 	sb.WriteByte('>')
-	for _, child := range n.Children {
+	children := n.Children
+	if n.Content != nil {
+		children = n.Content.Children
+	}
+	for _, child := range children {
 		serializeNode(sb, child)
 	}
 	sb.WriteString("</")
@@ -222,3 +222,57 @@ func TestSerializeAttributes(t *testing.T) {
 		t.Errorf("SerializeOuter() = %q, want %q", got, want)
 	}
 }
+
+func TestDirtyFlags(t *testing.T) {
+	parent := makeTree()
+	parent.ClearDirty()
+	if !parent.IsSubtreeClean() {
+		t.Fatal("tree should be clean after ClearDirty")
+	}
+
+	p := parent.Children[1]
+	p.SetAttribute("class", "changed")
+	if !p.IsDirty() {
+		t.Error("SetAttribute should mark the node dirty")
+	}
+	if parent.IsDirty() {
+		t.Error("ancestor should not itself be dirty")
+	}
+	if parent.IsSubtreeClean() {
+		t.Error("ancestor should report a dirty descendant")
+	}
+	if !parent.Children[0].IsSubtreeClean() {
+		t.Error("sibling subtree should stay clean")
+	}
+
+	parent.ClearDirty()
+	parent.RemoveChild(parent.Children[0])
+	if !parent.IsDirty() {
+		t.Error("RemoveChild should mark the parent dirty")
+	}
+}
+
+func TestSelectedOption(t *testing.T) {
+	doc, err := Parse(`<select><option>One</option><optgroup><option selected label="Two!">Two</option></optgroup><option>  Three
+	  four </option></select>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sel := doc.Root.Children[0]
+	options := sel.Options()
+	if len(options) != 3 {
+		t.Fatalf("got %d options, want 3", len(options))
+	}
+	if got := sel.SelectedOption(); got != options[1] {
+		t.Errorf("selected option = %v, want the second option", got)
+	}
+	if got := options[1].OptionLabel(); got != "Two!" {
+		t.Errorf("label = %q, want %q", got, "Two!")
+	}
+	if got := options[2].OptionLabel(); got != "Three four" {
+		t.Errorf("label = %q, want %q", got, "Three four")
+	}
+	if sel.IsListBox() {
+		t.Error("a select without multiple or size should be a drop-down")
+	}
+}
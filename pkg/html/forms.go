@@ -0,0 +1,185 @@
+package html
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Form control helpers shared by styling, layout, and rendering.
+
+// InputType returns the lowercased type of an <input> element, defaulting
+// to "text" when the attribute is missing.
+func (n *Node) InputType() string {
+	t, _ := n.GetAttribute("type")
+	if t = strings.ToLower(strings.TrimSpace(t)); t == "" {
+		return "text"
+	}
+	return t
+}
+
+// ButtonLabel returns the text on a button-type <input>: its value, or
+// the default label for its type.
+func (n *Node) ButtonLabel() string {
+	if v, ok := n.GetAttribute("value"); ok {
+		return v
+	}
+	switch n.InputType() {
+	case "submit":
+		return "Submit"
+	case "reset":
+		return "Reset"
+	}
+	return ""
+}
+
+// IsTextField reports whether the node is a control the user types into:
+// a textarea or a text-like input.
+func (n *Node) IsTextField() bool {
+	switch n.TagName {
+	case "textarea":
+		return true
+	case "input":
+		switch n.InputType() {
+		case "hidden", "checkbox", "radio", "button", "submit", "reset",
+			"image", "file", "range", "color":
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// IsEditable reports whether the user can type into the node: a text
+// field that is neither disabled nor read-only.
+func (n *Node) IsEditable() bool {
+	_, disabled := n.GetAttribute("disabled")
+	_, readOnly := n.GetAttribute("readonly")
+	return n.IsTextField() && !disabled && !readOnly
+}
+
+// Value returns a form control's current value. An input's value is its
+// value attribute until the user or a script changes it; a textarea's is
+// its text; a select's is the value of its selected option.
+func (n *Node) Value() string {
+	switch n.TagName {
+	case "input":
+		if n.valueDirty {
+			return n.value
+		}
+		v, ok := n.GetAttribute("value")
+		if !ok && (n.InputType() == "checkbox" || n.InputType() == "radio") {
+			return "on"
+		}
+		return v
+	case "textarea":
+		return n.TextContent()
+	case "select":
+		if opt := n.SelectedOption(); opt != nil {
+			return opt.Value()
+		}
+		return ""
+	case "option":
+		if v, ok := n.GetAttribute("value"); ok {
+			return v
+		}
+		return strings.Join(strings.Fields(n.TextContent()), " ")
+	}
+	v, _ := n.GetAttribute("value")
+	return v
+}
+
+// SetValue sets a form control's current value and marks it dirty. The
+// renderer lays out a textarea's text children, so a textarea's value
+// replaces its text. Setting a select's value selects the first option
+// with that value. For other elements it sets the value attribute.
+func (n *Node) SetValue(v string) {
+	switch n.TagName {
+	case "textarea":
+		for _, child := range n.Children {
+			child.Parent = nil
+		}
+		n.Children = nil
+		n.MarkDirty()
+		n.AppendText(v)
+	case "select":
+		found := false
+		for _, opt := range n.Options() {
+			if !found && opt.Value() == v {
+				opt.SetAttribute("selected", "")
+				found = true
+			} else if _, ok := opt.GetAttribute("selected"); ok {
+				opt.RemoveAttribute("selected")
+			}
+		}
+	case "input":
+		n.value, n.valueDirty = v, true
+		n.MarkDirty()
+	default:
+		n.SetAttribute("value", v)
+	}
+}
+
+// TextContent returns the concatenated text of the node and its descendants.
+func (n *Node) TextContent() string {
+	if n.Type == TextNode {
+		return n.Text
+	}
+	var sb strings.Builder
+	for _, child := range n.Children {
+		sb.WriteString(child.TextContent())
+	}
+	return sb.String()
+}
+
+// Options returns the <option> elements of a <select>, including those
+// inside <optgroup>s, in document order.
+func (n *Node) Options() []*Node {
+	var options []*Node
+	for _, child := range n.Children {
+		switch child.TagName {
+		case "option":
+			options = append(options, child)
+		case "optgroup":
+			options = append(options, child.Options()...)
+		}
+	}
+	return options
+}
+
+// IsListBox reports whether a <select> shows its options as a list box
+// (it allows multiple selection or shows more than one row) rather than
+// as a drop-down.
+func (n *Node) IsListBox() bool {
+	if _, multiple := n.GetAttribute("multiple"); multiple {
+		return true
+	}
+	size, _ := n.GetAttribute("size")
+	rows, err := strconv.Atoi(strings.TrimSpace(size))
+	return err == nil && rows > 1
+}
+
+// SelectedOption returns the option a <select> displays: the last option
+// with the selected attribute, or else the first option. It returns nil if
+// the select has no options.
+func (n *Node) SelectedOption() *Node {
+	options := n.Options()
+	if len(options) == 0 {
+		return nil
+	}
+	selected := options[0]
+	for _, opt := range options {
+		if _, ok := opt.GetAttribute("selected"); ok {
+			selected = opt
+		}
+	}
+	return selected
+}
+
+// OptionLabel returns the text an <option> is displayed with: its label
+// attribute, or else its text with whitespace collapsed.
+func (n *Node) OptionLabel() string {
+	if label, ok := n.GetAttribute("label"); ok {
+		return label
+	}
+	return strings.Join(strings.Fields(n.TextContent()), " ")
+}
@@ -0,0 +1,102 @@
+package html
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	stdnet "louis14/std/net"
+)
+
+// Refresh returns the delay in seconds and URL of the document's first
+// <meta http-equiv="refresh">, and false if it has none. The URL is as the
+// content attribute gives it, resolved against the document's <base href>;
+// it is "" when the document refreshes itself (HTML §4.2.5.3).
+func (d *Document) Refresh() (delay int, target string, ok bool) {
+	meta := findElement(d.Root, func(n *Node) bool {
+		equiv, _ := n.GetAttribute("http-equiv")
+		return n.TagName == "meta" && strings.EqualFold(strings.TrimSpace(equiv), "refresh")
+	})
+	if meta == nil {
+		return 0, "", false
+	}
+	content, _ := meta.GetAttribute("content")
+	delay, target, ok = parseRefresh(content)
+	if ok && target != "" {
+		target = ResolveBase(d.BaseURL, target)
+	}
+	return delay, target, ok
+}
+
+// parseRefresh parses the content of a <meta http-equiv="refresh">: a
+// delay in seconds, then optionally a URL, as in "0; url=next.html".
+func parseRefresh(content string) (delay int, target string, ok bool) {
+	s := strings.TrimLeft(content, " \t\n\f\r")
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i == 0 && (s == "" || s[0] != '.') {
+		return 0, "", false
+	}
+	delay, _ = strconv.Atoi(s[:i])
+	// A fraction of a second is ignored
+	for i < len(s) && (s[i] == '.' || (s[i] >= '0' && s[i] <= '9')) {
+		i++
+	}
+	s = strings.TrimLeft(s[i:], " \t\n\f\r")
+	if s == "" {
+		return delay, "", true
+	}
+	if s[0] != ';' && s[0] != ',' {
+		return 0, "", false
+	}
+	s = strings.TrimLeft(s[1:], " \t\n\f\r")
+	if len(s) >= 3 && strings.EqualFold(s[:3], "url") {
+		if rest := strings.TrimLeft(s[3:], " \t\n\f\r"); strings.HasPrefix(rest, "=") {
+			s = strings.TrimLeft(rest[1:], " \t\n\f\r")
+		}
+	}
+	if s != "" && (s[0] == '"' || s[0] == '\'') {
+		if end := strings.IndexByte(s[1:], s[0]); end >= 0 {
+			s = s[1 : end+1]
+		} else {
+			s = s[1:]
+		}
+	}
+	return delay, strings.TrimSpace(s), true
+}
+
+// ResolveBase resolves href against the href of a document's <base>. A
+// relative base leaves href relative to the document's URL, as the base
+// itself is.
+func ResolveBase(base, href string) string {
+	if base == "" || stdnet.IsDataURL(href) {
+		return href
+	}
+	if u, err := url.Parse(base); err == nil && u.IsAbs() {
+		return stdnet.ResolveURL(base, href)
+	}
+	if strings.HasPrefix(href, "/") {
+		return href
+	}
+	resolved := resolveImportURL(base, href)
+	if strings.HasSuffix(href, "/") && !strings.HasSuffix(resolved, "/") {
+		resolved += "/" // A directory, as a base is
+	}
+	return resolved
+}
+
+// findElement returns the first node of the tree at n, in document order,
+// for which match is true, or nil.
+func findElement(n *Node, match func(*Node) bool) *Node {
+	if n.Type == ElementNode && match(n) {
+		return n
+	}
+	for _, c := range n.Children {
+		if found := findElement(c, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
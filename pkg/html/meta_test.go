@@ -0,0 +1,74 @@
+package html
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseRefresh(t *testing.T) {
+	tests := []struct {
+		content string
+		delay   int
+		target  string
+		ok      bool
+	}{
+		{"0; url=next.html", 0, "next.html", true},
+		{"  3 ,URL = 'a b.html'", 3, "a b.html", true},
+		{`0;URL="/x?y=1"`, 0, "/x?y=1", true},
+		{"5", 5, "", true},
+		{"1.5; next.html", 1, "next.html", true},
+		{".5;url=x", 0, "x", true},
+		{"url=next.html", 0, "", false},
+		{"0 next.html", 0, "", false},
+		{"", 0, "", false},
+	}
+	for _, tt := range tests {
+		delay, target, ok := parseRefresh(tt.content)
+		if delay != tt.delay || target != tt.target || ok != tt.ok {
+			t.Errorf("%q: got %d %q %v, want %d %q %v", tt.content, delay, target, ok, tt.delay, tt.target, tt.ok)
+		}
+	}
+}
+
+func TestResolveBase(t *testing.T) {
+	tests := []struct{ base, href, want string }{
+		{"", "a.css", "a.css"},
+		{"https://cdn.example/x/", "a.css", "https://cdn.example/x/a.css"},
+		{"https://cdn.example/x/", "/a.css", "https://cdn.example/a.css"},
+		{"sub/", "a.css", "sub/a.css"},
+		{"sub/page.html", "../img/", "img/"},
+		{"sub/", "https://other.example/", "https://other.example/"},
+		{"sub/", "data:text/css,p{}", "data:text/css,p{}"},
+	}
+	for _, tt := range tests {
+		if got := ResolveBase(tt.base, tt.href); got != tt.want {
+			t.Errorf("ResolveBase(%q, %q) = %q, want %q", tt.base, tt.href, got, tt.want)
+		}
+	}
+}
+
+func TestParser_BaseHref(t *testing.T) {
+	var fetched []string
+	fetcher := func(uri string) (string, error) {
+		fetched = append(fetched, uri)
+		return "p { color: red }", nil
+	}
+	doc, err := ParseWithFetcher(`<html><head><link rel="stylesheet" href="before.css">`+
+		`<base target="_top"><base href="https://cdn.example/assets/"><base href="https://ignored.example/">`+
+		`<link rel="stylesheet" href="after.css"><meta http-equiv="Refresh" content="0; url=../next.html">`+
+		`</head><body></body></html>`, fetcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.BaseURL != "https://cdn.example/assets/" {
+		t.Errorf("expected the first base with an href, got %q", doc.BaseURL)
+	}
+
+	// A stylesheet linked before the base is not resolved against it
+	if want := []string{"before.css", "https://cdn.example/assets/after.css"}; !slices.Equal(fetched, want) {
+		t.Errorf("expected fetches %v, got %v", want, fetched)
+	}
+	if delay, target, ok := doc.Refresh(); !ok || delay != 0 || target != "https://cdn.example/next.html" {
+		t.Errorf("unexpected refresh %d %q %v", delay, target, ok)
+	}
+}
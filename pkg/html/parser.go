@@ -2,8 +2,13 @@ package html
 
 import (
 	"fmt"
+	gohtml "html"
 	"net/url"
+	"path"
+	"slices"
 	"strings"
+
+	stdnet "louis14/std/net"
 )
 
 // CSSFetcher is a function that fetches CSS content from a URI.
@@ -16,9 +21,21 @@ type Parser struct {
 	stack           []*Node // Phase 2: Stack for tracking nested elements
 	cssFetcher      CSSFetcher // Optional fetcher for external stylesheets
 	fragmentMode    bool       // When true, <script>/<style> become DOM nodes
+	scripting       bool       // Scripts will run, so <noscript> is not rendered
+
+	// Tree construction state (see treebuilder.go)
+	documentMode bool    // Input is a document: html, head and body are implied
+	quirks       bool    // The document is in quirks mode (see quirksMode)
+	html         *Node   // The html, head and body elements once created
+	head         *Node
+	body         *Node
+	form         *Node   // The open form, which a nested form can't be in
+	formatting   []*Node // Active formatting elements; nil entries are markers
 }
 
 func NewParser(html string) *Parser {
+	// A byte order mark isn't content
+	html = strings.TrimPrefix(html, "\ufeff")
 	return &Parser{
 		tokenizer: NewTokenizer(html),
 		doc:       NewDocument(),
@@ -26,55 +43,99 @@ func NewParser(html string) *Parser {
 }
 
 func (p *Parser) Parse() (*Document, error) {
+	input := p.tokenizer.input
+	p.begin(documentMarkup.MatchString(input), quirksMode([]byte(input[:min(len(input), sniffLen)])))
+	if err := p.parseTokens(); err != nil {
+		return nil, err
+	}
+	p.finish()
+	return p.doc, nil
+}
+
+// begin prepares the parser to build the tree. document is whether the
+// input has markup that makes it a document rather than a fragment, and
+// quirks whether its doctype puts it in quirks mode.
+func (p *Parser) begin(document, quirks bool) {
 	// Phase 2: Initialize stack with root node
 	p.stack = []*Node{p.doc.Root}
+	p.documentMode = !p.fragmentMode && document
+	p.quirks = !p.fragmentMode && quirks
+}
 
+// parseTokens builds the tree from the tokens of the tokenizer's input,
+// up to its end.
+func (p *Parser) parseTokens() error {
 	for {
 		token, err := p.tokenizer.NextToken()
 		if err != nil {
-			return nil, fmt.Errorf("tokenizer error: %w", err)
+			return fmt.Errorf("tokenizer error: %w", err)
 		}
 		if token.Type == TokenEOF {
-			break
+			return nil
 		}
 
 		switch token.Type {
 		case TokenStartTag:
 			// Special handling for <style>/<script> tags in normal mode:
-			// extract raw content. In fragment mode, treat them as DOM nodes.
-			if !p.fragmentMode {
+			// extract raw content. In fragment mode, and in inert template
+			// content, treat them as DOM nodes.
+			if !p.fragmentMode && !p.inTemplate() {
 				if token.TagName == "style" {
 					content := stripCDATA(p.tokenizer.ReadRawUntil("style"))
 					if strings.TrimSpace(content) != "" {
-						p.doc.Stylesheets = append(p.doc.Stylesheets, p.resolveImports(content))
+						p.doc.Stylesheets = append(p.doc.Stylesheets, p.resolveImports(content, p.doc.BaseURL, nil))
 					}
 					continue
 				}
 				if token.TagName == "script" {
 					content := p.tokenizer.ReadRawUntil("script")
+					scriptType, ok := classifyScript(token.Attributes["type"])
+					if !ok {
+						// A data block, not a script: kept in the DOM
+						p.insertRawText(token, content)
+						continue
+					}
 					if strings.TrimSpace(content) != "" {
 						p.doc.Scripts = append(p.doc.Scripts, content)
+						p.doc.ScriptInfo = append(p.doc.ScriptInfo, Script{Type: scriptType, Attributes: token.Attributes})
 					}
 					continue
 				}
+				if token.TagName == "noscript" && p.scripting {
+					// With scripting on, noscript content is raw text
+					// and not rendered (see ParseOptions)
+					p.insertRawText(token, p.tokenizer.ReadRawUntil("noscript"))
+					continue
+				}
+			} else if token.TagName == "style" || token.TagName == "script" {
+				// Raw text elements keep their content unparsed
+				p.insertRawText(token, p.tokenizer.ReadRawUntil(token.TagName))
+				continue
 			}
 
-			// Auto-close <p> when a block-level element is encountered inside it
-			if p.isBlockElement(token.TagName) {
-				p.autoCloseP()
-			}
+			foreign := p.inForeignContent()
+			p.startTag(token)
 
-			// Create new element node
-			node := &Node{
-				Type:       ElementNode,
-				TagName:    token.TagName,
-				Attributes: token.Attributes,
-				Children:   make([]*Node, 0),
+			// textarea and title content is text, with character references
+			// but no tags (RCDATA); a newline just after <textarea> is dropped
+			if rcdataElements[token.TagName] && !foreign && p.currentParent().TagName == token.TagName {
+				content := gohtml.UnescapeString(p.tokenizer.ReadRawUntil(token.TagName))
+				if token.TagName == "textarea" {
+					content = strings.TrimPrefix(strings.TrimPrefix(content, "\r"), "\n")
+				}
+				if content != "" {
+					p.text(content)
+				}
+				p.endTag(token.TagName)
+				continue
 			}
 
-			// Add to current parent (top of stack)
-			parent := p.currentParent()
-			parent.AddChild(node)
+			// The first <base href> sets the URL relative URLs resolve against
+			if token.TagName == "base" && p.doc.BaseURL == "" {
+				if href, ok := token.Attributes["href"]; ok && strings.TrimSpace(href) != "" {
+					p.doc.BaseURL = strings.TrimSpace(href)
+				}
+			}
 
 			// Handle <link rel="stylesheet"> with data URI href
 			if token.TagName == "link" {
@@ -89,27 +150,67 @@ func (p *Parser) Parse() (*Document, error) {
 				}
 			}
 
-			// Check if this is a self-closing/void element
-			// In XHTML, any element can be self-closing with /> syntax
-			if !p.isSelfClosing(token.TagName) && !token.SelfClosing {
-				// Push onto stack to become new parent
-				p.push(node)
-			}
-
 		case TokenText:
-			// Add text to current parent
 			if token.Text != "" {
-				parent := p.currentParent()
-				parent.AppendText(token.Text)
+				p.text(token.Text)
 			}
 
 		case TokenEndTag:
-			// Pop stack until we find the matching tag
-			p.closeTag(token.TagName)
+			p.endTag(token.TagName)
 		}
 	}
+}
 
-	return p.doc, nil
+// finish completes the document once all of the input is parsed.
+func (p *Parser) finish() {
+	if p.scripting && !p.fragmentMode {
+		p.doc.Stylesheets = append([]string{noscriptStylesheet}, p.doc.Stylesheets...)
+	}
+}
+
+// rcdataElements are the elements whose content is read as text, with
+// character references decoded but no tags.
+var rcdataElements = map[string]bool{"textarea": true, "title": true}
+
+// noscriptStylesheet hides <noscript> when scripting is enabled, as the
+// user agent stylesheet of a browser does (HTML §15.3.1).
+const noscriptStylesheet = "noscript { display: none !important; }"
+
+// insertRawText inserts the element for a start tag whose content was read
+// unparsed, with that content as its text.
+func (p *Parser) insertRawText(token Token, content string) {
+	node := &Node{
+		Type:       ElementNode,
+		TagName:    token.TagName,
+		Attributes: token.Attributes,
+		Children:   make([]*Node, 0),
+	}
+	node.AppendText(content)
+	p.insertNode(node)
+}
+
+// classifyScript returns how a <script> with the type attribute is run, and
+// false if it isn't a script but a data block (HTML §4.12.1.1).
+func classifyScript(typ string) (ScriptType, bool) {
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	switch {
+	case typ == "module":
+		return ScriptModule, true
+	case typ == "" || javaScriptMIMETypes[typ]:
+		return ScriptClassic, true
+	}
+	return ScriptClassic, false
+}
+
+// javaScriptMIMETypes are the type attribute values of a classic script.
+var javaScriptMIMETypes = map[string]bool{
+	"application/ecmascript": true, "application/javascript": true,
+	"application/x-ecmascript": true, "application/x-javascript": true,
+	"text/ecmascript": true, "text/javascript": true,
+	"text/javascript1.0": true, "text/javascript1.1": true, "text/javascript1.2": true,
+	"text/javascript1.3": true, "text/javascript1.4": true, "text/javascript1.5": true,
+	"text/jscript": true, "text/livescript": true,
+	"text/x-ecmascript": true, "text/x-javascript": true,
 }
 
 // currentParent returns the current parent node (top of stack)
@@ -157,159 +258,226 @@ func (p *Parser) closeTag(tagName string) {
 	// Tag not found on stack; ignore the end tag
 }
 
-// autoCloseP closes an open <p> element if one is on the stack
-func (p *Parser) autoCloseP() {
-	for i := len(p.stack) - 1; i >= 1; i-- {
-		if p.stack[i].TagName == "p" {
-			p.stack = p.stack[:i]
-			return
-		}
-		// Don't close past block-level containers
-		if p.isBlockElement(p.stack[i].TagName) {
-			return
-		}
+// loadLinkStylesheet loads CSS from a data URI href or via the CSS fetcher.
+// A relative href resolves against the document's <base href>.
+func (p *Parser) loadLinkStylesheet(href string) string {
+	href = ResolveBase(p.doc.BaseURL, strings.TrimSpace(href))
+	css, err := p.fetchCSS(href)
+	if err != nil {
+		return ""
 	}
-}
-
-// isBlockElement returns true for elements that auto-close <p>
-func (p *Parser) isBlockElement(tagName string) bool {
-	switch tagName {
-	case "address", "article", "aside", "blockquote", "details", "dialog",
-		"dd", "div", "dl", "dt", "fieldset", "figcaption", "figure",
-		"footer", "form", "h1", "h2", "h3", "h4", "h5", "h6",
-		"header", "hgroup", "hr", "li", "main", "nav", "ol",
-		"p", "pre", "section", "table", "ul":
-		return true
+	if stdnet.IsDataURL(href) {
+		return p.resolveImports(css, "", nil)
 	}
-	return false
+	return p.resolveImports(css, href, []string{href})
 }
 
-// loadLinkStylesheet loads CSS from a data URI href or via the CSS fetcher.
-func (p *Parser) loadLinkStylesheet(href string) string {
-	href = strings.TrimSpace(href)
-	if strings.HasPrefix(href, "data:text/css,") {
-		encoded := href[len("data:text/css,"):]
-		decoded, err := url.PathUnescape(encoded)
-		if err != nil {
-			return encoded
-		}
-		return p.resolveImports(decoded)
+// fetchCSS returns the text of a stylesheet, decoding data: URLs directly
+// and fetching other URLs with the CSS fetcher.
+func (p *Parser) fetchCSS(href string) (string, error) {
+	if stdnet.IsDataURL(href) {
+		body, _, err := stdnet.DecodeDataURL(href)
+		return string(body), err
 	}
-	// Try the CSS fetcher for network URLs
-	if p.cssFetcher != nil {
-		if css, err := p.cssFetcher(href); err == nil {
-			return p.resolveImports(css)
-		}
+	if p.cssFetcher == nil {
+		return "", fmt.Errorf("no fetcher for stylesheet %s", href)
 	}
-	return ""
+	return p.cssFetcher(href)
 }
 
+// maxImportDepth bounds chains of @import as a backstop to cycle detection.
+const maxImportDepth = 16
+
 // resolveImports processes @import rules in CSS text by fetching imported
 // stylesheets and prepending their content. Per CSS spec, @import rules must
-// appear before any other rules (except @charset).
-func (p *Parser) resolveImports(cssText string) string {
-	if p.cssFetcher == nil {
-		return cssText
-	}
+// appear before any other rules (except @charset). sheetURL is the URL the
+// CSS was loaded from ("" for <style>), which relative imports resolve
+// against, and chain holds the URLs of the stylesheets importing it.
+func (p *Parser) resolveImports(cssText, sheetURL string, chain []string) string {
 	if !strings.Contains(cssText, "@import") {
 		return cssText
 	}
 
 	var imported strings.Builder
-	var remaining strings.Builder
-	pastImports := false
-
-	lines := strings.Split(cssText, "\n")
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if trimmed == "" || strings.HasPrefix(trimmed, "/*") {
-			if pastImports {
-				remaining.WriteString(line)
-				remaining.WriteByte('\n')
-			} else {
-				imported.WriteString(line)
-				imported.WriteByte('\n')
-			}
+	rest := cssText
+	for {
+		stmt, after, ok := nextPreludeStatement(rest)
+		if !ok {
+			break
+		}
+		rest = after
+		importURL, media := parseImportRule(stmt)
+		if importURL == "" {
+			continue // @charset, or a malformed @import
+		}
+		importURL = resolveImportURL(sheetURL, importURL)
+		if len(chain) >= maxImportDepth || slices.Contains(chain, importURL) {
+			continue // Import cycle
+		}
+		css, err := p.fetchCSS(importURL)
+		if err != nil {
 			continue
 		}
+		css = p.resolveImports(css, importURL, append(chain[:len(chain):len(chain)], importURL))
+		if media != "" && !strings.EqualFold(media, "all") {
+			// Conditional import: the sheet applies only where the media query matches
+			css = "@media " + media + " {\n" + css + "\n}"
+		}
+		imported.WriteString(css)
+		imported.WriteByte('\n')
+	}
 
-		if !pastImports && strings.HasPrefix(trimmed, "@import") {
-			// Parse the @import URL
-			if importURL := parseImportURL(trimmed); importURL != "" {
-				if css, err := p.cssFetcher(importURL); err == nil {
-					// Recursively resolve imports in the fetched CSS (max depth handled by fetcher timeouts)
-					resolved := p.resolveImports(css)
-					imported.WriteString(resolved)
-					imported.WriteByte('\n')
-				}
+	return imported.String() + rest
+}
+
+// nextPreludeStatement returns the @charset or @import statement at the start
+// of css, skipping whitespace and comments, and the CSS that follows it. ok
+// is false once the first other rule is reached.
+func nextPreludeStatement(css string) (stmt, rest string, ok bool) {
+	i := 0
+	for i < len(css) {
+		if css[i] == ' ' || css[i] == '\t' || css[i] == '\n' || css[i] == '\r' || css[i] == '\f' {
+			i++
+		} else if strings.HasPrefix(css[i:], "/*") {
+			end := strings.Index(css[i+2:], "*/")
+			if end == -1 {
+				return "", css, false
 			}
-			continue
+			i += end + 4
+		} else {
+			break
 		}
+	}
+	lower := strings.ToLower(css[i:min(i+8, len(css))])
+	if !strings.HasPrefix(lower, "@import") && !strings.HasPrefix(lower, "@charset") {
+		return "", css, false
+	}
 
-		// Any non-import rule means we're past the import section
-		pastImports = true
-		remaining.WriteString(line)
-		remaining.WriteByte('\n')
+	// The statement ends at the first ';' outside strings and parentheses
+	depth := 0
+	inString := byte(0)
+	for j := i; j < len(css); j++ {
+		ch := css[j]
+		switch {
+		case inString != 0:
+			if ch == '\\' {
+				j++
+			} else if ch == inString {
+				inString = 0
+			}
+		case ch == '"' || ch == '\'':
+			inString = ch
+		case ch == '(':
+			depth++
+		case ch == ')':
+			depth--
+		case ch == ';' && depth <= 0:
+			return css[i : j+1], css[j+1:], true
+		case ch == '{' && depth <= 0:
+			return "", css, false // A block: not a statement
+		}
 	}
+	return css[i:], "", true
+}
 
-	return imported.String() + remaining.String()
+// resolveImportURL resolves an @import URL against the URL of the stylesheet
+// containing it. URLs relative to the page are left for the fetcher.
+func resolveImportURL(sheetURL, importURL string) string {
+	if sheetURL == "" || strings.HasPrefix(sheetURL, "data:") || strings.HasPrefix(importURL, "/") {
+		return importURL
+	}
+	ref, err := url.Parse(importURL)
+	if err != nil || ref.IsAbs() {
+		return importURL
+	}
+	base, err := url.Parse(sheetURL)
+	if err != nil {
+		return importURL
+	}
+	if base.IsAbs() || strings.HasPrefix(sheetURL, "/") {
+		return base.ResolveReference(ref).String()
+	}
+	// The sheet's URL is itself relative to the page
+	return path.Join(path.Dir(base.Path), importURL)
 }
 
-// parseImportURL extracts the URL from an @import rule.
-// Supports: @import url("foo.css"); @import url(foo.css); @import "foo.css";
-func parseImportURL(rule string) string {
+// parseImportRule extracts the URL and media query list from an @import rule.
+// Supports: @import url("foo.css"); @import url(foo.css); @import "foo.css" screen;
+// Cascade layers and supports() conditions are skipped.
+func parseImportRule(rule string) (importURL, media string) {
 	// Remove trailing semicolon and whitespace
 	rule = strings.TrimSpace(rule)
 	rule = strings.TrimSuffix(rule, ";")
 	rule = strings.TrimSpace(rule)
 
 	// Remove @import prefix
-	rule = strings.TrimPrefix(rule, "@import")
-	rule = strings.TrimSpace(rule)
-
-	// Remove optional media queries (everything after the URL)
-	// For now, we import unconditionally
+	if len(rule) < len("@import") || !strings.EqualFold(rule[:len("@import")], "@import") {
+		return "", ""
+	}
+	rule = strings.TrimSpace(rule[len("@import"):])
 
-	// Handle url(...) syntax
-	if strings.HasPrefix(rule, "url(") {
+	var rest string
+	if strings.HasPrefix(strings.ToLower(rule), "url(") {
+		// Handle url(...) syntax
 		closeIdx := strings.Index(rule, ")")
 		if closeIdx == -1 {
-			return ""
+			return "", ""
 		}
-		inner := rule[4:closeIdx]
-		inner = strings.TrimSpace(inner)
+		importURL = strings.TrimSpace(rule[4:closeIdx])
 		// Remove quotes
-		if len(inner) >= 2 {
-			if (inner[0] == '"' && inner[len(inner)-1] == '"') ||
-				(inner[0] == '\'' && inner[len(inner)-1] == '\'') {
-				inner = inner[1 : len(inner)-1]
-			}
+		if len(importURL) >= 2 && (importURL[0] == '"' || importURL[0] == '\'') && importURL[len(importURL)-1] == importURL[0] {
+			importURL = importURL[1 : len(importURL)-1]
 		}
-		return inner
+		rest = rule[closeIdx+1:]
+	} else if len(rule) >= 2 && (rule[0] == '"' || rule[0] == '\'') {
+		// Handle bare string syntax: @import "foo.css" or @import 'foo.css'
+		endQuote := strings.IndexByte(rule[1:], rule[0])
+		if endQuote == -1 {
+			return "", ""
+		}
+		importURL = rule[1 : endQuote+1]
+		rest = rule[endQuote+2:]
+	} else {
+		return "", ""
 	}
 
-	// Handle bare string syntax: @import "foo.css" or @import 'foo.css'
-	if len(rule) >= 2 {
-		if (rule[0] == '"' && rule[len(rule)-1] == '"') ||
-			(rule[0] == '\'' && rule[len(rule)-1] == '\'') {
-			return rule[1 : len(rule)-1]
-		}
-		// May have media query after the string: @import "foo.css" screen;
-		if rule[0] == '"' {
-			endQuote := strings.Index(rule[1:], "\"")
-			if endQuote >= 0 {
-				return rule[1 : endQuote+1]
-			}
+	// Skip layer, layer(...), and supports(...) before the media queries
+	for {
+		rest = strings.TrimSpace(rest)
+		lower := strings.ToLower(rest)
+		if lower == "layer" || strings.HasPrefix(lower, "layer ") {
+			rest = rest[len("layer"):]
+			continue
 		}
-		if rule[0] == '\'' {
-			endQuote := strings.Index(rule[1:], "'")
-			if endQuote >= 0 {
-				return rule[1 : endQuote+1]
+		if strings.HasPrefix(lower, "layer(") || strings.HasPrefix(lower, "supports(") {
+			depth := 0
+			end := len(rest)
+			for i := 0; i < len(rest); i++ {
+				if rest[i] == '(' {
+					depth++
+				} else if rest[i] == ')' {
+					depth--
+					if depth == 0 {
+						end = i + 1
+						break
+					}
+				}
 			}
+			rest = rest[end:]
+			continue
 		}
+		break
 	}
+	return importURL, rest
+}
 
-	return ""
+// Decode converts an HTML document that came without a Content-Type, such
+// as one read from a file, to the UTF-8 text Parse takes. Its encoding is
+// found from a byte order mark or <meta charset> declaration, as browsers
+// do; see stdnet.SniffHTMLCharset.
+func Decode(data []byte) string {
+	decoded, _ := stdnet.DecodeHTML(data, "")
+	return string(decoded)
 }
 
 func Parse(html string) (*Document, error) {
@@ -320,8 +488,25 @@ func Parse(html string) (*Document, error) {
 // ParseWithFetcher parses HTML and uses the provided fetcher to load external
 // stylesheets referenced by <link rel="stylesheet"> tags.
 func ParseWithFetcher(htmlContent string, cssFetcher CSSFetcher) (*Document, error) {
+	return ParseWithOptions(htmlContent, ParseOptions{CSSFetcher: cssFetcher})
+}
+
+// ParseOptions configures ParseWithOptions.
+type ParseOptions struct {
+	// CSSFetcher loads the stylesheets of <link rel="stylesheet">.
+	CSSFetcher CSSFetcher
+
+	// Scripting is whether the document's scripts will be run. When they
+	// will, <noscript> content is kept as unparsed text and not rendered;
+	// when not, it is parsed and rendered like any other element.
+	Scripting bool
+}
+
+// ParseWithOptions parses an HTML document with the given options.
+func ParseWithOptions(htmlContent string, opts ParseOptions) (*Document, error) {
 	parser := NewParser(htmlContent)
-	parser.cssFetcher = cssFetcher
+	parser.cssFetcher = opts.CSSFetcher
+	parser.scripting = opts.Scripting
 	return parser.Parse()
 }
 
@@ -1,6 +1,14 @@
 package html
 
-import "testing"
+import (
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	nethtml "golang.org/x/net/html"
+)
 
 func TestParser_SingleElement(t *testing.T) {
 	doc, err := Parse("<div></div>")
@@ -200,3 +208,362 @@ func TestParser_MultipleStyleTags(t *testing.T) {
 		t.Errorf("second stylesheet incorrect: '%s'", doc.Stylesheets[1])
 	}
 }
+
+func TestParser_ImportResolution(t *testing.T) {
+	sheets := map[string]string{
+		"css/main.css":  `@import "base.css"; @import url('print.css') print; main { color: red; }`,
+		"css/base.css":  `@import "../css/main.css"; @import url(base.css); base { color: blue; }`,
+		"css/print.css": `print { color: black; }`,
+	}
+	var fetched []string
+	fetcher := func(uri string) (string, error) {
+		fetched = append(fetched, uri)
+		if css, ok := sheets[uri]; ok {
+			return css, nil
+		}
+		return "", fmt.Errorf("not found: %s", uri)
+	}
+
+	doc, err := ParseWithFetcher(`<link rel="stylesheet" href="css/main.css"><div></div>`, fetcher)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(doc.Stylesheets) != 1 {
+		t.Fatalf("expected 1 stylesheet, got %d", len(doc.Stylesheets))
+	}
+
+	// Relative imports resolve against the importing sheet; the cycles back
+	// to main.css and base.css are not fetched again
+	want := []string{"css/main.css", "css/base.css", "css/print.css"}
+	if !slices.Equal(fetched, want) {
+		t.Errorf("expected fetches %v, got %v", want, fetched)
+	}
+
+	css := doc.Stylesheets[0]
+	base := strings.Index(css, "base {")
+	print := strings.Index(css, "@media print {")
+	main := strings.Index(css, "main {")
+	if base == -1 || print == -1 || main == -1 || !(base < print && print < main) {
+		t.Errorf("expected imported rules in order before the importing sheet's rules, got %q", css)
+	}
+	if strings.Contains(css, "@import") {
+		t.Errorf("expected @import rules to be removed, got %q", css)
+	}
+}
+
+func TestParseFragment_RawText(t *testing.T) {
+	nodes, err := ParseFragment(`<script>if (a < b) x = "<p>";</script><p>after</p>`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(nodes) != 2 {
+		t.Fatalf("expected 2 nodes, got %d", len(nodes))
+	}
+	script := nodes[0]
+	if script.TagName != "script" || len(script.Children) != 1 {
+		t.Fatalf("expected script with one text child, got %q with %d children", script.TagName, len(script.Children))
+	}
+	if got := script.Children[0].Text; got != `if (a < b) x = "<p>";` {
+		t.Errorf("script text = %q", got)
+	}
+	if got := script.Serialize(); got != `if (a < b) x = "<p>";` {
+		t.Errorf("serialized script content should not be escaped, got %q", got)
+	}
+}
+
+func TestParser_DataURIStylesheets(t *testing.T) {
+	sheet := base64.StdEncoding.EncodeToString([]byte(`@import "data:text/css,.imported%20%7B%20color:%20red%20%7D"; p { margin: 0 }`))
+	doc, err := Parse(`<link rel="stylesheet" href="data:text/css;base64,` + sheet + `">` +
+		`<link rel="stylesheet" href="data:text/css;charset=utf-8,div%20%7B%20color:%20blue%20%7D">`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(doc.Stylesheets) != 2 {
+		t.Fatalf("expected 2 stylesheets, got %d", len(doc.Stylesheets))
+	}
+	if css := doc.Stylesheets[0]; !strings.HasPrefix(css, ".imported { color: red }") || !strings.HasSuffix(css, "p { margin: 0 }") {
+		t.Errorf("expected the data: import inlined before the sheet's rules, got %q", css)
+	}
+	if css := doc.Stylesheets[1]; css != "div { color: blue }" {
+		t.Errorf("expected percent-decoded stylesheet, got %q", css)
+	}
+
+	// With a fetcher, data: URLs are still decoded without calling it
+	doc, err = ParseWithFetcher(`<link rel="stylesheet" href="data:text/css;base64,`+sheet+`">`, func(uri string) (string, error) {
+		t.Errorf("unexpected fetch of %s", uri)
+		return "", fmt.Errorf("not found")
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(doc.Stylesheets) != 1 || !strings.HasPrefix(doc.Stylesheets[0], ".imported") {
+		t.Errorf("expected the data: import inlined, got %q", doc.Stylesheets)
+	}
+}
+
+// treeString serializes the children of n in a compact form for comparing
+// parsed trees: elements as <tag>...</tag> and text as is.
+func treeString(n *Node) string {
+	var sb strings.Builder
+	for _, child := range n.Children {
+		if child.Type == TextNode {
+			sb.WriteString(child.Text)
+			continue
+		}
+		sb.WriteString("<" + child.TagName + ">")
+		sb.WriteString(treeString(child))
+		sb.WriteString("</" + child.TagName + ">")
+	}
+	return sb.String()
+}
+
+func TestParser_TreeConstruction(t *testing.T) {
+	tests := []struct {
+		name, html, want string
+	}{
+		{"implied p end", `<p>a<p>b<div>c</div>`, `<p>a</p><p>b</p><div>c</div>`},
+		{"p end without start", `<div></p></div>`, `<div><p></p></div>`},
+		{"implied li end", `<ul><li>a<li>b</ul>`, `<ul><li>a</li><li>b</li></ul>`},
+		{"nested list keeps li", `<ul><li>a<ul><li>b</ul><li>c</ul>`, `<ul><li>a<ul><li>b</li></ul></li><li>c</li></ul>`},
+		{"implied dd and dt end", `<dl><dt>a<dd>b<dt>c</dl>`, `<dl><dt>a</dt><dd>b</dd><dt>c</dt></dl>`},
+		{"heading closes heading", `<h1>a<h2>b</h2>`, `<h1>a</h1><h2>b</h2>`},
+		{"misnested inline", `<b>1<i>2</b>3</i>4`, `<b>1<i>2</i></b><i>3</i>4`},
+		{"formatting across block", `<b><p>x</b>y</p>`, `<b></b><p><b>x</b>y</p>`},
+		{"formatting reopened", `<p><b>x<p>y`, `<p><b>x</b></p><p><b>y</b></p>`},
+		{"nested a closes a", `<a>x<a>y</a>`, `<a>x</a><a>y</a>`},
+		{"end tag ignored past block", `<span><div></span>x</div>`, `<span><div>x</div></span>`},
+		{"implied tbody and tr", `<table><td>a<td>b<tr><td>c</table>`,
+			`<table><tbody><tr><td>a</td><td>b</td></tr><tr><td>c</td></tr></tbody></table>`},
+		{"foster parenting", `<table>x<tr><b>y</b><td>z</table>`,
+			`x<b>y</b><table><tbody><tr><td>z</td></tr></tbody></table>`},
+		{"table in cell", `<table><tr><td><table><tr><td>a</table>b</table>`,
+			`<table><tbody><tr><td><table><tbody><tr><td>a</td></tr></tbody></table>b</td></tr></tbody></table>`},
+		{"col implies colgroup", `<table><col><tr><td>a</table>`,
+			`<table><colgroup><col></col></colgroup><tbody><tr><td>a</td></tr></tbody></table>`},
+		{"svg nests as written", `<svg><g><rect/></g></svg>`, `<svg><g><rect></rect></g></svg>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(tt.html)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := treeString(doc.Root); got != tt.want {
+				t.Errorf("Parse(%q)\n got  %s\n want %s", tt.html, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParser_ImpliedHtmlHeadBody(t *testing.T) {
+	doc, err := Parse("\ufeff<!DOCTYPE html><title>t</title><meta charset=utf-8><p class=a>x")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `<html><head><title>t</title><meta></meta></head><body><p>x</p></body></html>`
+	if got := treeString(doc.Root); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	// Repeated html and body tags add their attributes; content after
+	// </body> still goes into the body
+	doc, err = Parse(`<html><body class=b><p>a</p></body></html><body id=c>z`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = `<html><head></head><body><p>a</p>z</body></html>`
+	if got := treeString(doc.Root); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	body := doc.Root.Children[0].Children[1]
+	if body.Attributes["class"] != "b" || body.Attributes["id"] != "c" {
+		t.Errorf("body attributes = %v, want class=b and id=c", body.Attributes)
+	}
+
+	// Fragments stay at the top level
+	frag, err := ParseFragment(`<td>a</td>`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(frag) != 1 || frag[0].TagName != "td" {
+		t.Errorf("ParseFragment(<td>) = %d nodes, want one td", len(frag))
+	}
+}
+
+// TestParser_MatchesReferenceParser checks the error recovery for forms,
+// selects and tables in quirks mode against the tree golang.org/x/net/html
+// builds.
+func TestParser_MatchesReferenceParser(t *testing.T) {
+	tests := []struct {
+		name, html string
+	}{
+		{"nested form ignored", `<!DOCTYPE html><form><div><form>x</form>y</div></form>z`},
+		{"form end keeps content open", `<!DOCTYPE html><form><p>a</form>b`},
+		{"form in table", `<!DOCTYPE html><table><form><tr><td><form>x</table>`},
+		{"form after unclosed form", `<!DOCTYPE html><div><form></div><form>x`},
+		{"p in select dropped", `<!DOCTYPE html><select><p>a<option>b<p>c</select>d`},
+		{"optgroup in select", `<!DOCTYPE html><select><optgroup><option>a<optgroup><option>b</optgroup>c</select>`},
+		{"select closes select", `<!DOCTYPE html><select><option>a<select>b`},
+		{"input closes select", `<!DOCTYPE html><select><option>a<input>b`},
+		{"cell closes select", `<!DOCTYPE html><table><tr><td><select><option>a<td>b</table>`},
+		{"table end closes select", `<!DOCTYPE html><table><tr><td><select><b>a</table>c`},
+		{"table closes p", `<!DOCTYPE html><p>a<table><tr><td>b</table>c`},
+		{"quirks table in p", `<body><p>a<table><tr><td>b</table>c`},
+		{"legacy doctype table in p", `<!DOCTYPE HTML PUBLIC "-//W3C//DTD HTML 4.01 Transitional//EN"><p>a<table><tr><td>b</table>`},
+		{"strict doctype table closes p", `<!DOCTYPE html PUBLIC "-//W3C//DTD HTML 4.01//EN" "http://www.w3.org/TR/html4/strict.dtd"><p>a<table><tr><td>b</table>`},
+		{"textarea is rcdata", `<!DOCTYPE html><textarea><p>x</textarea>y`},
+		{"ruby implied end tags", `<!DOCTYPE html><ruby>a<rt>b<rp>c`},
+		{"image becomes img", `<!DOCTYPE html><p><image src="a.png">x`},
+		{"p breaks out of svg", `<!DOCTYPE html><svg><p>x`},
+		{"p in svg desc stays", `<!DOCTYPE html><svg><desc><p>x</desc></svg>y`},
+		{"svg title is not rcdata", `<!DOCTYPE html><svg><title><b>x</b></title></svg>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(tt.html)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			ref, err := nethtml.Parse(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatalf("reference parser: %v", err)
+			}
+			if got, want := treeString(doc.Root), referenceTreeString(ref); got != want {
+				t.Errorf("Parse(%q)\n got  %s\n want %s", tt.html, got, want)
+			}
+		})
+	}
+}
+
+// referenceTreeString is treeString for a golang.org/x/net/html tree.
+func referenceTreeString(n *nethtml.Node) string {
+	var sb strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		switch child.Type {
+		case nethtml.TextNode:
+			sb.WriteString(child.Data)
+		case nethtml.ElementNode:
+			sb.WriteString("<" + child.Data + ">")
+			sb.WriteString(referenceTreeString(child))
+			sb.WriteString("</" + child.Data + ">")
+		}
+	}
+	return sb.String()
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"utf-8", []byte("<p>caf\xc3\xa9</p>"), "<p>café</p>"},
+		{"utf-8 bom", []byte("\xef\xbb\xbf<p>caf\xc3\xa9</p>"), "<p>café</p>"},
+		{"undeclared latin", []byte("<p>caf\xe9 \x93q\x94</p>"), "<p>café “q”</p>"},
+		{"meta charset", []byte(`<meta charset="iso-8859-1"><p>caf` + "\xe9"), `<meta charset="iso-8859-1"><p>café`},
+		{"meta http-equiv", []byte(`<meta http-equiv=Content-Type content="text/html; charset=Shift_JIS"><p>` + "\x93\xfa\x96\x7b"),
+			`<meta http-equiv=Content-Type content="text/html; charset=Shift_JIS"><p>日本`},
+		{"meta in comment", []byte(`<!-- <meta charset=shift_jis> --><p>caf` + "\xc3\xa9"), `<!-- <meta charset=shift_jis> --><p>café`},
+		{"utf-16le bom", []byte("\xff\xfe<\x00p\x00>\x00\xe9\x00"), "<p>é"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Decode(tt.data); got != tt.want {
+				t.Errorf("Decode(%q) = %q, want %q", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParser_Template(t *testing.T) {
+	doc, err := Parse(`<!DOCTYPE html><template id=t><p>a<style>p{}</style></template><body><div><template><td>b</td></template>c</div>`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := treeString(doc.Root), `<html><head><template></template></head><body><div><template></template>c</div></body></html>`; got != want {
+		t.Errorf("tree = %s, want %s", got, want)
+	}
+	if len(doc.Stylesheets) != 0 {
+		t.Errorf("template style was extracted: %q", doc.Stylesheets)
+	}
+
+	head := doc.Root.Children[0].Children[0]
+	template := head.Children[0]
+	if template.Content == nil || template.Content.Type != DocumentFragmentNode {
+		t.Fatalf("template has no content fragment")
+	}
+	if got, want := treeString(template.Content), `<p>a<style>p{}</style></p>`; got != want {
+		t.Errorf("content = %s, want %s", got, want)
+	}
+	if got, want := template.Serialize(), `<p>a<style>p{}</style></p>`; got != want {
+		t.Errorf("Serialize() = %s, want %s", got, want)
+	}
+	if clone := template.CloneNode(true); clone.Content == nil || len(clone.Content.Children) != 1 {
+		t.Errorf("CloneNode(true) didn't clone the content")
+	}
+
+	body := doc.Root.Children[0].Children[1]
+	if got, want := treeString(body.Children[0].Children[0].Content), `<td>b</td>`; got != want {
+		t.Errorf("body template content = %s, want %s", got, want)
+	}
+}
+
+func TestParser_Noscript(t *testing.T) {
+	const src = `<!DOCTYPE html><body><noscript><p>no JS</p></noscript>`
+
+	doc, err := Parse(src)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := treeString(doc.Root), `<html><head></head><body><noscript><p>no JS</p></noscript></body></html>`; got != want {
+		t.Errorf("without scripting tree = %s, want %s", got, want)
+	}
+	if len(doc.Stylesheets) != 0 {
+		t.Errorf("without scripting Stylesheets = %q, want none", doc.Stylesheets)
+	}
+
+	doc, err = ParseWithOptions(src, ParseOptions{Scripting: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := treeString(doc.Root), `<html><head></head><body><noscript><p>no JS</p></noscript></body></html>`; got != want {
+		t.Errorf("with scripting tree = %s, want %s", got, want)
+	}
+	noscript := doc.Root.Children[0].Children[1].Children[0]
+	if len(noscript.Children) != 1 || noscript.Children[0].Type != TextNode {
+		t.Errorf("with scripting noscript content was parsed, want raw text")
+	}
+	if len(doc.Stylesheets) != 1 || !strings.Contains(doc.Stylesheets[0], "noscript") {
+		t.Errorf("with scripting Stylesheets = %q, want the noscript rule", doc.Stylesheets)
+	}
+}
+
+func TestParser_ScriptTypes(t *testing.T) {
+	doc, err := Parse(`<script>a()</script>` +
+		`<script type="module" src="m.js">b()</script>` +
+		`<script type="text/javascript">c()</script>` +
+		`<script type="application/json" id=data>{"d": 1}</script>`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := strings.Join(doc.Scripts, ","), "a(),b(),c()"; got != want {
+		t.Errorf("Scripts = %s, want %s", got, want)
+	}
+	wantTypes := []ScriptType{ScriptClassic, ScriptModule, ScriptClassic}
+	for i, want := range wantTypes {
+		if got := doc.ScriptMetadata(i).Type; got != want {
+			t.Errorf("script %d type = %v, want %v", i, got, want)
+		}
+	}
+	if got := doc.ScriptMetadata(1).Attributes["src"]; got != "m.js" {
+		t.Errorf("module script src = %q, want m.js", got)
+	}
+
+	// A data block stays in the DOM and isn't run
+	if len(doc.Root.Children) != 1 {
+		t.Fatalf("got %d top-level nodes, want the data block", len(doc.Root.Children))
+	}
+	if data := doc.Root.Children[0]; data.TagName != "script" || data.Attributes["id"] != "data" || treeString(data) != `{"d": 1}` {
+		t.Errorf("data block script not kept in the DOM")
+	}
+}
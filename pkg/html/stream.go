@@ -0,0 +1,316 @@
+package html
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+)
+
+// sniffLen is how much content a StreamParser waits for, if it has seen no
+// doctype, html, head or body tag, before it decides the input is a
+// fragment and starts building the tree.
+const sniffLen = 1024
+
+// StreamParser parses a document as it arrives, a chunk at a time, so the
+// tree can be laid out before the whole document has downloaded. Each
+// Write builds the tree from the tokens that are complete so far; a token
+// split between chunks, such as a tag or the content of a <script> or
+// <style>, waits for the rest of it. Stylesheets of <link rel="stylesheet">
+// are fetched as their tags arrive.
+//
+// The tree a StreamParser builds is the one ParseWithOptions builds from
+// the whole input.
+type StreamParser struct {
+	p       *Parser
+	buf     []byte // The input not yet parsed
+	parsed  int    // Bytes of the input parsed
+	started bool   // The tree is being built
+	done    bool   // Close was called
+	err     error  // The error that stopped parsing
+}
+
+// NewStreamParser returns a StreamParser for a document parsed with opts.
+func NewStreamParser(opts ParseOptions) *StreamParser {
+	p := NewParser("")
+	p.cssFetcher = opts.CSSFetcher
+	p.scripting = opts.Scripting
+	return &StreamParser{p: p}
+}
+
+// Write adds the next chunk of the document and parses as much of it as
+// can be. It implements io.Writer.
+func (s *StreamParser) Write(data []byte) (int, error) {
+	if s.done {
+		return 0, errors.New("html: write after Close")
+	}
+	if s.err != nil {
+		return 0, s.err
+	}
+	s.buf = append(s.buf, data...)
+	if !s.started {
+		lead := leadingTrivia(s.buf)
+		if !documentMarkup.Match(s.buf) && (lead < 0 || len(s.buf)-lead < sniffLen) {
+			return len(data), nil
+		}
+		s.start()
+	}
+	s.parse(completeTokens(s.buf, 0, s.p.scripting))
+	return len(data), s.err
+}
+
+// Close parses the rest of the document, now that all of it has been
+// written, and returns it.
+func (s *StreamParser) Close() (*Document, error) {
+	if s.err == nil && !s.done {
+		if !s.started {
+			s.start()
+		}
+		s.parse(len(s.buf))
+		if s.err == nil {
+			s.p.finish()
+		}
+	}
+	s.done = true
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.p.doc, nil
+}
+
+// Snapshot returns a copy of the document parsed so far, with the elements
+// still open closed. Later writes do not change it.
+func (s *StreamParser) Snapshot() *Document {
+	doc := &Document{
+		Root:        s.p.doc.Root.CloneNode(true),
+		Stylesheets: slices.Clone(s.p.doc.Stylesheets),
+		Scripts:     slices.Clone(s.p.doc.Scripts),
+		ScriptInfo:  slices.Clone(s.p.doc.ScriptInfo),
+		BaseURL:     s.p.doc.BaseURL,
+	}
+	if s.p.scripting && !s.done {
+		doc.Stylesheets = append([]string{noscriptStylesheet}, doc.Stylesheets...)
+	}
+	return doc
+}
+
+// start begins building the tree, deciding from the input so far whether
+// it is a document or a fragment.
+func (s *StreamParser) start() {
+	// A byte order mark isn't content
+	s.buf = bytes.TrimPrefix(s.buf, []byte("\ufeff"))
+	s.p.begin(documentMarkup.Match(s.buf), quirksMode(s.buf[:min(len(s.buf), sniffLen)]))
+	s.started = true
+}
+
+// parse builds the tree from the unparsed input up to end, which is the
+// end of a token, and drops it from the buffer. The tokenizer is given
+// only these bytes, so each byte of the document is copied once, and the
+// text the tree keeps refers to no more of it than it needs.
+func (s *StreamParser) parse(end int) {
+	if end == 0 {
+		return
+	}
+	s.p.tokenizer.input = string(s.buf[:end])
+	s.p.tokenizer.pos = 0
+	s.err = s.p.parseTokens()
+	s.parsed += end
+	// Move the rest to the front, reusing the buffer
+	s.buf = s.buf[:copy(s.buf, s.buf[end:])]
+}
+
+// ParseReader parses the document read from r as it arrives. If progress
+// is not nil it is called after each read that parsed more of the
+// document, and may take a Snapshot of it.
+func ParseReader(r io.Reader, opts ParseOptions, progress func(*StreamParser)) (*Document, error) {
+	s := NewStreamParser(opts)
+	chunk := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(chunk)
+		if n > 0 {
+			parsed := s.parsed
+			if _, err := s.Write(chunk[:n]); err != nil {
+				return nil, err
+			}
+			if progress != nil && s.parsed > parsed {
+				progress(s)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s.Close()
+}
+
+// leadingTrivia returns where the content of input starts after leading
+// white space, comments and processing instructions, or -1 if it is still
+// inside one of them.
+func leadingTrivia(input []byte) int {
+	i := 0
+	for {
+		for i < len(input) && isHTMLSpace(input[i]) {
+			i++
+		}
+		var end []byte
+		switch {
+		case bytes.HasPrefix(input[i:], []byte("<!--")):
+			end = []byte("-->")
+		case bytes.HasPrefix(input[i:], []byte("<?")):
+			end = []byte("?>")
+		default:
+			return i
+		}
+		k := bytes.Index(input[i+2:], end)
+		if k < 0 {
+			return -1
+		}
+		i += 2 + k + len(end)
+	}
+}
+
+// completeTokens returns the end of the last token of input, from pos on,
+// that is complete: text followed by a tag, a tag with its closing '>',
+// and a raw text element with its end tag.
+func completeTokens(input []byte, pos int, scripting bool) int {
+	for pos < len(input) {
+		end := tokenEnd(input, pos, scripting)
+		if end < 0 {
+			break
+		}
+		pos = end
+	}
+	return pos
+}
+
+// tokenEnd returns the end of the token at i, scanning it as the Tokenizer
+// reads it, or -1 if it continues past the end of input.
+func tokenEnd(input []byte, i int, scripting bool) int {
+	if input[i] != '<' {
+		return indexFrom(input, i, "<")
+	}
+	if i+1 >= len(input) {
+		return -1
+	}
+	switch input[i+1] {
+	case '!':
+		if len(input)-i < 4 {
+			return -1 // A comment or a doctype
+		}
+		if string(input[i+1:i+4]) == "!--" {
+			return indexEnd(input, i+4, "-->")
+		}
+		return indexEnd(input, i+1, ">")
+	case '?':
+		return indexEnd(input, i+1, "?>")
+	case '/':
+		return indexEnd(input, i+2, ">")
+	}
+
+	j := i + 1
+	for j < len(input) && isTagNameChar(input[j]) {
+		j++
+	}
+	name := strings.ToLower(string(input[i+1 : j]))
+	if j >= len(input) {
+		return -1
+	}
+	if name == "" {
+		return j // Not a tag; the Tokenizer reports it
+	}
+	var end int
+	for {
+		j = skipHTMLSpace(input, j)
+		if j >= len(input) {
+			return -1
+		}
+		if input[j] == '>' {
+			end = j + 1
+			break
+		}
+		if input[j] == '/' {
+			j = skipHTMLSpace(input, j+1)
+			if j >= len(input) {
+				return -1
+			}
+			if input[j] == '>' {
+				end = j + 1
+				break
+			}
+		}
+		start := j
+		for j < len(input) && isAttributeNameChar(input[j]) {
+			j++
+		}
+		if j == start {
+			return j + 1 // Not an attribute; the Tokenizer reports it
+		}
+		j = skipHTMLSpace(input, j)
+		if j >= len(input) {
+			return -1
+		}
+		if input[j] != '=' {
+			continue
+		}
+		j = skipHTMLSpace(input, j+1)
+		if j >= len(input) {
+			return -1
+		}
+		if quote := input[j]; quote == '"' || quote == '\'' {
+			k := bytes.IndexByte(input[j+1:], quote)
+			if k < 0 {
+				return -1
+			}
+			j += k + 2
+			continue
+		}
+		for j < len(input) && !isHTMLSpace(input[j]) && input[j] != '>' {
+			j++
+		}
+	}
+
+	// The content of a raw text or RCDATA element is part of its start
+	// tag's token
+	if name == "script" || name == "style" || (name == "noscript" && scripting) || rcdataElements[name] {
+		needle := "</" + name + ">"
+		for k := end; k+len(needle) <= len(input); k++ {
+			if strings.EqualFold(string(input[k:k+len(needle)]), needle) {
+				return k + len(needle)
+			}
+		}
+		return -1
+	}
+	return end
+}
+
+// indexFrom returns the index of the first s in input at or after i, or -1.
+func indexFrom(input []byte, i int, s string) int {
+	k := bytes.Index(input[i:], []byte(s))
+	if k < 0 {
+		return -1
+	}
+	return i + k
+}
+
+// indexEnd returns the index just past the first s in input at or after i,
+// or -1.
+func indexEnd(input []byte, i int, s string) int {
+	k := indexFrom(input, i, s)
+	if k < 0 {
+		return -1
+	}
+	return k + len(s)
+}
+
+// skipHTMLSpace returns the index of the first byte of input at or after i
+// that isn't white space.
+func skipHTMLSpace(input []byte, i int) int {
+	for i < len(input) && isHTMLSpace(input[i]) {
+		i++
+	}
+	return i
+}
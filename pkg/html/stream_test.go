@@ -0,0 +1,161 @@
+package html
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// streamDocs are parsed whole and in chunks, which must give the same tree.
+var streamDocs = []string{
+	`<!DOCTYPE html>
+<html><head><title>T</title>
+<style>p > b { color: red }</style>
+<link rel="stylesheet" href="data:text/css,div{margin:0}">
+</head>
+<body class="a b" data-x='1>2'>
+<!-- a comment with <p> in it -->
+<p>One <b>two</b> &amp; three<br/>four</p>
+<script>if (1 < 2) document.title = "</p>";</script>
+<noscript><p>No scripts</p></noscript>
+<table><tr><td>cell</table>
+<template><p>inert</p></template>
+<input value=plain disabled>
+<textarea><b>x</b> &amp; y</textarea>
+</body></html>`,
+	`<div><p>A fragment</p><?pi x?><span title="t">s</span> tail`,
+	"\ufeff<!doctype html><p>BOM",
+}
+
+func TestStreamParser_MatchesParse(t *testing.T) {
+	for _, scripting := range []bool{false, true} {
+		opts := ParseOptions{Scripting: scripting}
+		for _, input := range streamDocs {
+			whole, err := ParseWithOptions(input, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := whole.Root.SerializeOuter()
+			for _, size := range []int{1, 2, 3, 7, 64, len(input)} {
+				s := NewStreamParser(opts)
+				for i := 0; i < len(input); i += size {
+					if _, err := s.Write([]byte(input[i:min(i+size, len(input))])); err != nil {
+						t.Fatalf("chunks of %d: %v", size, err)
+					}
+				}
+				doc, err := s.Close()
+				if err != nil {
+					t.Fatalf("chunks of %d: %v", size, err)
+				}
+				if got := doc.Root.SerializeOuter(); got != want {
+					t.Errorf("scripting %v, chunks of %d:\ngot  %s\nwant %s", scripting, size, got, want)
+				}
+				if !slices.Equal(doc.Stylesheets, whole.Stylesheets) || !slices.Equal(doc.Scripts, whole.Scripts) {
+					t.Errorf("scripting %v, chunks of %d: got sheets %q scripts %q, want %q %q",
+						scripting, size, doc.Stylesheets, doc.Scripts, whole.Stylesheets, whole.Scripts)
+				}
+			}
+		}
+	}
+}
+
+func TestStreamParser_Incremental(t *testing.T) {
+	s := NewStreamParser(ParseOptions{})
+	s.Write([]byte(`<!DOCTYPE html><body><p>First</p><p class="sec`))
+
+	// The tree so far has the complete tags, not the one cut off
+	snap := s.Snapshot()
+	if got := treeString(snap.Root); got != "<html><head></head><body><p>First</p></body></html>" {
+		t.Errorf("unexpected snapshot %s", got)
+	}
+
+	s.Write([]byte(`ond">Second</p><style>p { color: `))
+	if got := treeString(s.Snapshot().Root); got != "<html><head></head><body><p>First</p><p>Second</p></body></html>" {
+		t.Errorf("unexpected snapshot %s", got)
+	}
+	if len(s.Snapshot().Stylesheets) != 0 {
+		t.Error("expected the unfinished stylesheet to wait for its end tag")
+	}
+	if got := treeString(snap.Root); !strings.HasSuffix(got, "<p>First</p></body></html>") {
+		t.Errorf("expected later writes to leave a snapshot alone, got %s", got)
+	}
+
+	s.Write([]byte(`red }</style>`))
+	doc, err := s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Stylesheets) != 1 || doc.Stylesheets[0] != "p { color: red }" {
+		t.Errorf("unexpected stylesheets %q", doc.Stylesheets)
+	}
+	if _, err := s.Write([]byte("<p>")); err == nil {
+		t.Error("expected an error writing after Close")
+	}
+}
+
+func TestParseReader(t *testing.T) {
+	var snapshots []string
+	doc, err := ParseReader(strings.NewReader(streamDocs[0]), ParseOptions{}, func(s *StreamParser) {
+		snapshots = append(snapshots, treeString(s.Snapshot().Root))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 {
+		t.Errorf("expected one progress call for one read, got %d", len(snapshots))
+	}
+	if p := doc.Root.Children[0].Children[1].Children[0]; p.TagName != "p" {
+		t.Errorf("expected the body to start with a p, got %s", p.TagName)
+	}
+}
+
+// largeDocument returns a document of about size bytes of paragraphs,
+// tables, and scripts.
+func largeDocument(size int) string {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html><html><head><title>Large</title></head><body>\n")
+	for i := 0; b.Len() < size; i++ {
+		fmt.Fprintf(&b, `<div class="row r%d"><p>Paragraph %d with <b>bold</b> and <a href="/p/%d">a link</a>.</p>`, i%7, i, i)
+		if i%50 == 0 {
+			b.WriteString("<table><tr><td>a</td><td>b</td></tr></table><script>var x = 1 < 2;</script>")
+		}
+		b.WriteString("</div>\n")
+	}
+	b.WriteString("</body></html>")
+	return b.String()
+}
+
+// smallReads is a reader returning at most n bytes per read, as a network
+// connection does.
+type smallReads struct {
+	r io.Reader
+	n int
+}
+
+func (s *smallReads) Read(p []byte) (int, error) {
+	return s.r.Read(p[:min(len(p), s.n)])
+}
+
+func BenchmarkParseReader_Large(b *testing.B) {
+	input := largeDocument(6 << 20)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseReader(&smallReads{r: strings.NewReader(input), n: 4096}, ParseOptions{}, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParse_Large(b *testing.B) {
+	input := largeDocument(6 << 20)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"fmt"
 	gohtml "html"
 	"strings"
-	"unicode"
+	"unicode/utf8"
 )
 
 type TokenType int
@@ -33,6 +33,11 @@ func NewTokenizer(html string) *Tokenizer {
 	return &Tokenizer{input: html, pos: 0}
 }
 
+// Pos returns the offset in the input of the next token.
+func (t *Tokenizer) Pos() int {
+	return t.pos
+}
+
 func (t *Tokenizer) NextToken() (Token, error) {
 	if t.pos >= len(t.input) {
 		return Token{Type: TokenEOF}, nil
@@ -175,13 +180,71 @@ func (t *Tokenizer) readAttributeValue() (string, error) {
 		}
 		value := t.input[start:t.pos]
 		t.pos++
-		return value, nil
+		return unescapeAttribute(value), nil
 	}
 	start := t.pos
-	for t.pos < len(t.input) && !unicode.IsSpace(rune(t.input[t.pos])) && t.input[t.pos] != '>' {
+	for t.pos < len(t.input) && !isHTMLSpace(t.input[t.pos]) && t.input[t.pos] != '>' {
 		t.pos++
 	}
-	return t.input[start:t.pos], nil
+	return unescapeAttribute(t.input[start:t.pos]), nil
+}
+
+// unescapeAttribute decodes the character references in an attribute value.
+// As in browsers, a named reference without its semicolon that is followed
+// by '=' or a letter or digit is left as it is, so URLs like
+// "?a=1&copy=2" keep their query parameters.
+func unescapeAttribute(value string) string {
+	if !strings.Contains(value, "&") {
+		return value
+	}
+	var sb strings.Builder
+	for {
+		amp := strings.IndexByte(value, '&')
+		if amp < 0 {
+			sb.WriteString(value)
+			return sb.String()
+		}
+		sb.WriteString(value[:amp])
+		end := amp + 1
+		for end < len(value) && (isAlphanumeric(value[end]) || (end == amp+1 && value[end] == '#')) {
+			end++
+		}
+		if end < len(value) && value[end] == ';' {
+			end++
+		}
+		ref := value[amp:end]
+		decoded := gohtml.UnescapeString(ref)
+		if len(ref) < 2 || ref[1] != '#' {
+			// Only a whole name is a reference: a legacy one without its
+			// semicolon that ran into more letters, or into '=', isn't
+			partial := strings.HasSuffix(decoded, ";") && decoded != ";"
+			if ref[len(ref)-1] != ';' {
+				partial = utf8.RuneCountInString(decoded) != 1 || (end < len(value) && value[end] == '=')
+			}
+			if partial {
+				decoded = ref
+			}
+		}
+		sb.WriteString(decoded)
+		value = value[end:]
+	}
+}
+
+// isAlphanumeric reports whether c is an ASCII letter or digit.
+func isAlphanumeric(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// isHTMLSpace reports whether c is ASCII white space, the only white space
+// HTML collapses and separates tokens with. Other Unicode spaces, such as
+// the no-break space, are text.
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
+
+// isHTMLSpaceRune is isHTMLSpace for runes.
+func isHTMLSpaceRune(r rune) bool {
+	return r < utf8.RuneSelf && isHTMLSpace(byte(r))
 }
 
 func (t *Tokenizer) readText() (Token, error) {
@@ -193,7 +256,7 @@ func (t *Tokenizer) readText() (Token, error) {
 	// If the raw text is entirely whitespace (e.g., indentation between tags),
 	// skip it. But if it contains any non-whitespace characters, normalize it
 	// while preserving leading/trailing spaces for inline flow.
-	if strings.TrimSpace(raw) == "" {
+	if strings.TrimFunc(raw, isHTMLSpaceRune) == "" {
 		if t.pos < len(t.input) {
 			return t.NextToken()
 		}
@@ -209,10 +272,10 @@ func (t *Tokenizer) readText() (Token, error) {
 // flow: "text <em>word</em> more" must keep the spaces between the text
 // nodes and the inline element.
 func normalizeWhitespace(s string) string {
-	hasLeading := len(s) > 0 && unicode.IsSpace(rune(s[0]))
-	hasTrailing := len(s) > 0 && unicode.IsSpace(rune(s[len(s)-1]))
+	hasLeading := len(s) > 0 && isHTMLSpace(s[0])
+	hasTrailing := len(s) > 0 && isHTMLSpace(s[len(s)-1])
 
-	fields := strings.Fields(s)
+	fields := strings.FieldsFunc(s, isHTMLSpaceRune)
 	if len(fields) == 0 {
 		// All-whitespace token: keep as single space so inline flow
 		// preserves word boundaries (e.g., between two inline elements).
@@ -233,7 +296,7 @@ func normalizeWhitespace(s string) string {
 }
 
 func (t *Tokenizer) skipWhitespace() {
-	for t.pos < len(t.input) && unicode.IsSpace(rune(t.input[t.pos])) {
+	for t.pos < len(t.input) && isHTMLSpace(t.input[t.pos]) {
 		t.pos++
 	}
 }
@@ -49,3 +49,47 @@ func TestTokenizer_CompleteSequence(t *testing.T) {
 		t.Error("expected EOF")
 	}
 }
+
+func TestTokenizer_CharacterReferences(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"a&nbsp;b", "a\u00a0b"},
+		{"x &mdash; &#x2019;&#8217;&amp;", "x — ’’&"},
+		{"&copy 2024", "© 2024"},
+		{"&#x80;", "€"},      // Windows-1252 remapping
+		{"voilà", "voilà"},   // Not followed by a space
+		{"\u00a0", "\u00a0"}, // Not white space
+	}
+	for _, tt := range tests {
+		token, err := NewTokenizer(tt.input).NextToken()
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tt.input, err)
+		}
+		if token.Type != TokenText || token.Text != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.input, token.Text, tt.want)
+		}
+	}
+}
+
+func TestTokenizer_AttributeCharacterReferences(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{`<a title="a&amp;b &lt;c&gt; &#x2019;&quot;">`, "a&b <c> ’\""},
+		{`<a title=&nbsp;x>`, "\u00a0x"},
+		{`<a href="?a=1&copy=2&amp=3">`, "?a=1&copy=2&amp=3"},
+		{`<a href="?x&notit;">`, "?x&notit;"},
+		{`<a title="&copy &unknown; &amp">`, "© &unknown; &"},
+	}
+	for _, tt := range tests {
+		token, err := NewTokenizer(tt.input).NextToken()
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tt.input, err)
+		}
+		got := token.Attributes["title"] + token.Attributes["href"]
+		if got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
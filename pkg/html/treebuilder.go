@@ -0,0 +1,1343 @@
+package html
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Tree construction
+//
+// The parser builds the tree with the error recovery of the WHATWG tree
+// construction stage (HTML §13.2.6), so malformed markup gives the tree a
+// browser would:
+//
+//   - html, head and body are inserted when a document leaves them out,
+//     and head content before the body goes into the head
+//   - end tags are implied: a p is closed by the blocks that can't be in it,
+//     an li by the next li, a cell by the next cell or row, and so on
+//   - misnested formatting elements (<b><i></b></i>) are repaired with the
+//     adoption agency algorithm, and reopened where they were left open
+//   - table rows and cells get their implied tbody and tr, and content
+//     that can't be in a table is moved in front of it (foster parenting)
+//   - a form can't be inside another form, and a select holds only option
+//     and optgroup elements and text; other tags in it are dropped
+//   - in a quirks mode document (see quirksMode) a table doesn't close an
+//     open p, as in the pages written for browsers of the time
+//
+// Input that has no doctype and no html, head or body tag is parsed as a
+// fragment: its elements stay at the top level of the tree, as they do
+// for ParseFragment. Inside svg and math, elements nest as written.
+//
+// The contents of a <template> are parsed into its Content fragment rather
+// than into the tree, so they are inert: never rendered or run.
+
+// documentMarkup matches the markup that makes the input a document rather
+// than a fragment.
+var documentMarkup = regexp.MustCompile(`(?i)<(!doctype|html|head|body)[\s/>]`)
+
+// doctypeMarkup matches a doctype at the start of the input, where only
+// white space and comments can come before it, and captures its content.
+var doctypeMarkup = regexp.MustCompile(`^(?:\s|<!--(?s:.*?)-->)*<!(?i:doctype)([^>]*)>`)
+
+// quirksMode reports whether a document starting with input is in quirks
+// mode (HTML §13.2.6.4.1): it has no doctype, or a doctype that isn't
+// html, or one with a public identifier of a legacy DTD.
+func quirksMode(input []byte) bool {
+	m := doctypeMarkup.FindSubmatch(input)
+	if m == nil {
+		return true
+	}
+	doctype := strings.Fields(string(m[1]))
+	if len(doctype) == 0 || !strings.EqualFold(doctype[0], "html") {
+		return true
+	}
+	if len(doctype) == 1 {
+		return false
+	}
+	rest := strings.Join(doctype[1:], " ")
+	keyword := strings.ToLower(rest[:min(len(rest), 6)])
+	if keyword == "system" {
+		return strings.Contains(strings.ToLower(rest), "ibmxhtml1-transitional.dtd")
+	}
+	if keyword != "public" {
+		return true
+	}
+	ids := doctypeIDs.FindAllStringSubmatch(rest[6:], -1)
+	if len(ids) == 0 {
+		return true
+	}
+	public := strings.ToLower(ids[0][1] + ids[0][2])
+	switch public {
+	case "-//w3o//dtd w3 html strict 3.0//en//", "-/w3d/dtd html 4.0 transitional/en", "html":
+		return true
+	}
+	for _, id := range quirkyPublicIDs {
+		if strings.HasPrefix(public, id) {
+			return true
+		}
+	}
+	// The HTML 4.01 DTDs with frames only give quirks mode without a
+	// system identifier
+	return len(ids) == 1 && (strings.HasPrefix(public, "-//w3c//dtd html 4.01 frameset//") ||
+		strings.HasPrefix(public, "-//w3c//dtd html 4.01 transitional//"))
+}
+
+// doctypeIDs matches the quoted identifiers of a doctype.
+var doctypeIDs = regexp.MustCompile(`"([^"]*)"|'([^']*)'`)
+
+// quirkyPublicIDs are the prefixes of the doctype public identifiers that
+// put a document in quirks mode, in lower case.
+var quirkyPublicIDs = []string{
+	"+//silmaril//dtd html pro v0r11 19970101//",
+	"-//advasoft ltd//dtd html 3.0 aswedit + extensions//",
+	"-//as//dtd html 3.0 aswedit + extensions//",
+	"-//ietf//dtd html 2.0 level 1//",
+	"-//ietf//dtd html 2.0 level 2//",
+	"-//ietf//dtd html 2.0 strict level 1//",
+	"-//ietf//dtd html 2.0 strict level 2//",
+	"-//ietf//dtd html 2.0 strict//",
+	"-//ietf//dtd html 2.0//",
+	"-//ietf//dtd html 2.1e//",
+	"-//ietf//dtd html 3.0//",
+	"-//ietf//dtd html 3.2 final//",
+	"-//ietf//dtd html 3.2//",
+	"-//ietf//dtd html 3//",
+	"-//ietf//dtd html level 0//",
+	"-//ietf//dtd html level 1//",
+	"-//ietf//dtd html level 2//",
+	"-//ietf//dtd html level 3//",
+	"-//ietf//dtd html strict level 0//",
+	"-//ietf//dtd html strict level 1//",
+	"-//ietf//dtd html strict level 2//",
+	"-//ietf//dtd html strict level 3//",
+	"-//ietf//dtd html strict//",
+	"-//ietf//dtd html//",
+	"-//metrius//dtd metrius presentational//",
+	"-//microsoft//dtd internet explorer 2.0 html strict//",
+	"-//microsoft//dtd internet explorer 2.0 html//",
+	"-//microsoft//dtd internet explorer 2.0 tables//",
+	"-//microsoft//dtd internet explorer 3.0 html strict//",
+	"-//microsoft//dtd internet explorer 3.0 html//",
+	"-//microsoft//dtd internet explorer 3.0 tables//",
+	"-//netscape comm. corp.//dtd html//",
+	"-//netscape comm. corp.//dtd strict html//",
+	"-//o'reilly and associates//dtd html 2.0//",
+	"-//o'reilly and associates//dtd html extended 1.0//",
+	"-//o'reilly and associates//dtd html extended relaxed 1.0//",
+	"-//softquad software//dtd hotmetal pro 6.0::19990601::extensions to html 4.0//",
+	"-//softquad//dtd hotmetal pro 4.0::19971010::extensions to html 4.0//",
+	"-//spyglass//dtd html 2.0 extended//",
+	"-//sq//dtd html 2.0 hotmetal + extensions//",
+	"-//sun microsystems corp.//dtd hotjava html//",
+	"-//sun microsystems corp.//dtd hotjava strict html//",
+	"-//w3c//dtd html 3 1995-03-24//",
+	"-//w3c//dtd html 3.2 draft//",
+	"-//w3c//dtd html 3.2 final//",
+	"-//w3c//dtd html 3.2//",
+	"-//w3c//dtd html 3.2s draft//",
+	"-//w3c//dtd html 4.0 frameset//",
+	"-//w3c//dtd html 4.0 transitional//",
+	"-//w3c//dtd html experimental 19960712//",
+	"-//w3c//dtd html experimental 970421//",
+	"-//w3c//dtd w3 html//",
+	"-//w3o//dtd w3 html 3.0//",
+	"-//webtechs//dtd mozilla html 2.0//",
+	"-//webtechs//dtd mozilla html//",
+}
+
+// specialElements are the elements with special parsing rules; an end tag
+// doesn't close any element they contain.
+var specialElements = map[string]bool{
+	"address": true, "applet": true, "area": true, "article": true, "aside": true,
+	"base": true, "basefont": true, "bgsound": true, "blockquote": true, "body": true,
+	"br": true, "button": true, "caption": true, "center": true, "col": true,
+	"colgroup": true, "dd": true, "details": true, "dir": true, "div": true,
+	"dl": true, "dt": true, "embed": true, "fieldset": true, "figcaption": true,
+	"figure": true, "footer": true, "form": true, "frame": true, "frameset": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"head": true, "header": true, "hgroup": true, "hr": true, "html": true,
+	"iframe": true, "img": true, "input": true, "keygen": true, "li": true,
+	"link": true, "listing": true, "main": true, "marquee": true, "menu": true,
+	"meta": true, "nav": true, "noembed": true, "noframes": true, "noscript": true,
+	"object": true, "ol": true, "p": true, "param": true, "plaintext": true,
+	"pre": true, "script": true, "search": true, "section": true, "select": true,
+	"source": true, "style": true, "summary": true, "table": true, "tbody": true,
+	"td": true, "template": true, "textarea": true, "tfoot": true, "th": true,
+	"thead": true, "title": true, "tr": true, "track": true, "ul": true,
+	"wbr": true, "xmp": true, "document": true,
+}
+
+// formattingElements are reopened when they are left open across a block,
+// and repaired by the adoption agency algorithm when misnested.
+var formattingElements = map[string]bool{
+	"a": true, "b": true, "big": true, "code": true, "em": true, "font": true,
+	"i": true, "nobr": true, "s": true, "small": true, "strike": true,
+	"strong": true, "tt": true, "u": true,
+}
+
+// closesP are the start tags that close an open p element.
+var closesP = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"center": true, "details": true, "dialog": true, "dir": true, "div": true,
+	"dl": true, "fieldset": true, "figcaption": true, "figure": true,
+	"footer": true, "form": true, "header": true, "hgroup": true, "hr": true,
+	"listing": true, "main": true, "menu": true, "nav": true, "ol": true,
+	"p": true, "pre": true, "search": true, "section": true, "summary": true,
+	"table": true, "ul": true, "xmp": true, "plaintext": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+// blockEndTags are the end tags that close the element and everything
+// inside it, if it is in scope.
+var blockEndTags = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"button": true, "center": true, "details": true, "dialog": true, "dir": true,
+	"div": true, "dl": true, "fieldset": true, "figcaption": true, "figure": true,
+	"footer": true, "form": true, "header": true, "hgroup": true, "listing": true,
+	"main": true, "menu": true, "nav": true, "ol": true, "pre": true,
+	"search": true, "section": true, "summary": true, "ul": true,
+}
+
+// headElements go into the head when they come before the body.
+var headElements = map[string]bool{
+	"base": true, "basefont": true, "bgsound": true, "link": true, "meta": true,
+	"title": true,
+}
+
+// tableParts are the elements that structure a table.
+var tableParts = map[string]bool{
+	"caption": true, "col": true, "colgroup": true, "tbody": true, "td": true,
+	"tfoot": true, "th": true, "thead": true, "tr": true,
+}
+
+// impliedEndTags are the elements closed by generateImpliedEndTags.
+var impliedEndTags = map[string]bool{
+	"dd": true, "dt": true, "li": true, "optgroup": true, "option": true,
+	"p": true, "rb": true, "rp": true, "rt": true, "rtc": true,
+}
+
+// scope is a kind of element scope (HTML §13.2.4.2): the elements that
+// bound the search for an open element.
+type scope int
+
+const (
+	defaultScope scope = iota
+	listItemScope
+	buttonScope
+	tableScope
+)
+
+// isScopeBoundary reports whether an element with the tag bounds s.
+func isScopeBoundary(tag string, s scope) bool {
+	switch tag {
+	case "html", "table", "template", "document":
+		return true
+	}
+	if s == tableScope {
+		return false
+	}
+	switch tag {
+	case "applet", "caption", "td", "th", "marquee", "object":
+		return true
+	case "ol", "ul":
+		return s == listItemScope
+	case "button":
+		return s == buttonScope
+	}
+	return false
+}
+
+// isTableContext reports whether content inserted into an element with the
+// tag is foster parented.
+func isTableContext(tag string) bool {
+	switch tag {
+	case "table", "tbody", "tfoot", "thead", "tr":
+		return true
+	}
+	return false
+}
+
+// isHeading reports whether the tag is h1 to h6.
+func isHeading(tag string) bool {
+	return len(tag) == 2 && tag[0] == 'h' && tag[1] >= '1' && tag[1] <= '6'
+}
+
+// startTag inserts the element for a start tag token.
+func (p *Parser) startTag(token Token) {
+	if p.inForeignContent() {
+		if !breaksOutOfForeignContent(token) {
+			p.insertElement(token)
+			return
+		}
+		// An HTML element closes the svg or math it is in
+		for p.inForeignContent() {
+			p.pop()
+		}
+	}
+	if token.TagName == "image" {
+		token.TagName = "img"
+	}
+	name := token.TagName
+	if inSelect, inTable := p.inSelect(); inSelect && name != "html" && name != "template" {
+		p.selectStartTag(token, inTable)
+		return
+	}
+
+	switch {
+	case (name == "html" || name == "head" || name == "body") && p.inTemplate():
+		return
+	case name == "template":
+		if p.documentMode && p.body == nil {
+			p.ensureHead()
+		} else {
+			p.ensureBody()
+		}
+		p.insertTemplate(token)
+		return
+	case name == "html":
+		if p.html != nil {
+			mergeAttributes(p.html, token.Attributes)
+		}
+		return
+	case name == "head":
+		if p.documentMode && p.head == nil && p.body == nil {
+			p.ensureHTML()
+			p.head = p.insertElement(token)
+		}
+		return
+	case name == "body":
+		if !p.documentMode {
+			return
+		}
+		if p.body != nil {
+			mergeAttributes(p.body, token.Attributes)
+			return
+		}
+		p.openBody(token.Attributes)
+		return
+	case headElements[name] && p.documentMode && p.body == nil:
+		p.ensureHead()
+		p.insertElement(token)
+		return
+	}
+
+	p.ensureBody()
+
+	if tableParts[name] || (name == "table" && p.inTableBody()) {
+		if p.tablePart(token) {
+			return
+		}
+	}
+
+	switch {
+	case name == "form":
+		p.startForm(token)
+	case name == "table":
+		// In quirks mode a table can be inside a p
+		if !p.quirks {
+			p.closePInButtonScope()
+		}
+		p.insertElement(token)
+	case closesP[name]:
+		p.closePInButtonScope()
+		if isHeading(name) && isHeading(p.currentParent().TagName) {
+			p.pop()
+		}
+		p.insertElement(token)
+	case name == "li" || name == "dd" || name == "dt":
+		p.closeListItem(name)
+		p.closePInButtonScope()
+		p.insertElement(token)
+	case name == "a":
+		if a := p.formattingElementAfterMarker("a"); a != nil {
+			p.adoptionAgency("a")
+			p.removeFormatting(a)
+			p.removeFromStack(a)
+		}
+		p.reconstructFormatting()
+		p.pushFormatting(p.insertElement(token))
+	case name == "nobr":
+		p.reconstructFormatting()
+		if p.inScope("nobr", defaultScope) {
+			p.adoptionAgency("nobr")
+			p.reconstructFormatting()
+		}
+		p.pushFormatting(p.insertElement(token))
+	case formattingElements[name]:
+		p.reconstructFormatting()
+		p.pushFormatting(p.insertElement(token))
+	case name == "applet" || name == "marquee" || name == "object":
+		p.reconstructFormatting()
+		p.insertElement(token)
+		p.formatting = append(p.formatting, nil)
+	case name == "button":
+		if p.inScope("button", defaultScope) {
+			p.generateImpliedEndTags("")
+			p.popUntil("button")
+		}
+		p.reconstructFormatting()
+		p.insertElement(token)
+	case name == "rb" || name == "rtc":
+		if p.inScope("ruby", defaultScope) {
+			p.generateImpliedEndTags("")
+		}
+		p.insertElement(token)
+	case name == "rp" || name == "rt":
+		if p.inScope("ruby", defaultScope) {
+			p.generateImpliedEndTags("rtc")
+		}
+		p.insertElement(token)
+	case name == "option" || name == "optgroup":
+		if p.currentParent().TagName == "option" {
+			p.pop()
+		}
+		p.reconstructFormatting()
+		p.insertElement(token)
+	case name == "input" && isTableContext(p.currentParent().TagName) &&
+		strings.EqualFold(token.Attributes["type"], "hidden"):
+		p.insertTableElement(token)
+	default:
+		p.reconstructFormatting()
+		p.insertElement(token)
+	}
+}
+
+// endTag closes elements for an end tag token.
+func (p *Parser) endTag(name string) {
+	if p.inForeignContent() {
+		p.closeTag(name)
+		return
+	}
+	if inSelect, inTable := p.inSelect(); inSelect && name != "template" {
+		p.selectEndTag(name, inTable)
+		return
+	}
+
+	switch {
+	case name == "html" || name == "body":
+		// Content after them still goes into the body
+	case name == "template":
+		if p.templateOpen() {
+			p.generateImpliedEndTags("")
+			p.popUntil("template")
+			p.clearFormattingToMarker()
+		}
+	case name == "head":
+		if p.head != nil && p.onStack(p.head) {
+			p.popUntilNode(p.head)
+		}
+	case name == "p":
+		if !p.inScope("p", buttonScope) {
+			p.ensureBody()
+			p.insertElement(Token{Type: TokenStartTag, TagName: "p"})
+		}
+		p.closeP()
+	case name == "li":
+		if p.inScope("li", listItemScope) {
+			p.generateImpliedEndTags("li")
+			p.popUntil("li")
+		}
+	case name == "dd" || name == "dt":
+		if p.inScope(name, defaultScope) {
+			p.generateImpliedEndTags(name)
+			p.popUntil(name)
+		}
+	case name == "form":
+		p.endForm()
+	case isHeading(name):
+		if p.headingInScope() {
+			p.generateImpliedEndTags("")
+			for len(p.stack) > 1 && !isHeading(p.pop().TagName) {
+			}
+		}
+	case blockEndTags[name]:
+		if p.inScope(name, defaultScope) {
+			p.generateImpliedEndTags("")
+			p.popUntil(name)
+		}
+	case formattingElements[name]:
+		if !p.adoptionAgency(name) {
+			p.anyOtherEndTag(name)
+		}
+	case name == "applet" || name == "marquee" || name == "object":
+		if p.inScope(name, defaultScope) {
+			p.generateImpliedEndTags("")
+			p.popUntil(name)
+			p.clearFormattingToMarker()
+		}
+	case name == "br":
+		p.ensureBody()
+		p.reconstructFormatting()
+		p.insertElement(Token{Type: TokenStartTag, TagName: "br"})
+	case name == "table" || name == "tbody" || name == "thead" || name == "tfoot" || name == "tr":
+		if p.inScope(name, tableScope) {
+			p.popUntil(name)
+		}
+	case name == "td" || name == "th" || name == "caption":
+		if p.inScope(name, tableScope) {
+			p.generateImpliedEndTags("")
+			p.popUntil(name)
+			p.clearFormattingToMarker()
+		}
+	case name == "colgroup":
+		if p.currentParent().TagName == "colgroup" {
+			p.pop()
+		}
+	default:
+		p.anyOtherEndTag(name)
+	}
+}
+
+// text inserts a text token.
+func (p *Parser) text(text string) {
+	if p.inForeignContent() {
+		p.currentParent().AppendText(text)
+		return
+	}
+	if p.body == nil {
+		switch p.currentParent().TagName {
+		case "html", "head", "document":
+			p.ensureBody()
+		}
+	}
+	if inSelect, _ := p.inSelect(); !inSelect {
+		p.reconstructFormatting()
+	}
+	parent, before := p.insertionLocation()
+	if before != nil {
+		textNode := &Node{Type: TextNode, Text: text}
+		parent.InsertBefore(textNode, before)
+		return
+	}
+	parent.AppendText(text)
+}
+
+// startForm inserts a form element, unless a form is open: forms can't
+// nest, so the start tag of one inside another is ignored. In a template
+// the form isn't tracked, as the template's content is a separate tree.
+func (p *Parser) startForm(token Token) {
+	inTemplate := p.templateOpen()
+	if p.form != nil && !inTemplate {
+		return
+	}
+	if isTableContext(p.currentParent().TagName) {
+		if inTemplate {
+			return
+		}
+		// A form in a table is kept empty where it is
+		token.SelfClosing = true
+		p.form = p.insertTableElement(token)
+		return
+	}
+	p.closePInButtonScope()
+	form := p.insertElement(token)
+	if !inTemplate {
+		p.form = form
+	}
+}
+
+// endForm closes the open form. The form element is removed from the
+// stack of open elements on its own, so the elements open inside it stay
+// open: </form> ends the form, not the markup it contains.
+func (p *Parser) endForm() {
+	if p.templateOpen() {
+		if p.inScope("form", defaultScope) {
+			p.generateImpliedEndTags("")
+			p.popUntil("form")
+		}
+		return
+	}
+	form := p.form
+	p.form = nil
+	if form == nil || !p.nodeInScope(form) {
+		return
+	}
+	p.generateImpliedEndTags("")
+	p.removeFromStack(form)
+}
+
+// inSelect reports whether a select element is the innermost open element
+// other than its options, so the select's parsing rules apply, and whether
+// the select is in a table.
+func (p *Parser) inSelect() (inSelect, inTable bool) {
+	i := len(p.stack) - 1
+	for ; i >= 1; i-- {
+		tag := p.stack[i].TagName
+		if tag == "select" {
+			break
+		}
+		if tag != "option" && tag != "optgroup" {
+			return false, false
+		}
+	}
+	if i < 1 {
+		return false, false
+	}
+	for i--; i >= 1; i-- {
+		switch p.stack[i].TagName {
+		case "table":
+			return true, true
+		case "template":
+			return true, false
+		}
+	}
+	return true, false
+}
+
+// selectStartTag handles a start tag in a select: only options and option
+// groups are inserted, and the tags that can't be in a select are ignored
+// or, for a form control or a table part, close it.
+func (p *Parser) selectStartTag(token Token, inTable bool) {
+	switch name := token.TagName; name {
+	case "option":
+		if p.currentParent().TagName == "option" {
+			p.pop()
+		}
+		p.insertElement(token)
+	case "optgroup":
+		if p.currentParent().TagName == "option" {
+			p.pop()
+		}
+		if p.currentParent().TagName == "optgroup" {
+			p.pop()
+		}
+		p.insertElement(token)
+	case "select":
+		// A select can't be in a select: the start tag closes it
+		p.popUntil("select")
+	case "input", "keygen", "textarea":
+		p.popUntil("select")
+		p.startTag(token)
+	case "caption", "table", "tbody", "tfoot", "thead", "tr", "td", "th":
+		if inTable {
+			p.popUntil("select")
+			p.startTag(token)
+		}
+	}
+}
+
+// selectEndTag handles an end tag in a select; the end tags of anything
+// but the select, its options and, in a table, the table's parts are
+// ignored.
+func (p *Parser) selectEndTag(name string, inTable bool) {
+	switch name {
+	case "option":
+		if p.currentParent().TagName == "option" {
+			p.pop()
+		}
+	case "optgroup":
+		i := len(p.stack) - 1
+		if p.stack[i].TagName == "option" {
+			i--
+		}
+		if p.stack[i].TagName == "optgroup" {
+			p.stack = p.stack[:i]
+		}
+	case "select":
+		p.popUntil("select")
+	case "caption", "table", "tbody", "tfoot", "thead", "tr", "td", "th":
+		if inTable && p.inScope(name, tableScope) {
+			p.popUntil("select")
+			p.endTag(name)
+		}
+	}
+}
+
+// insertTemplate inserts a template element and makes its content fragment
+// the current node, so what follows goes into the fragment.
+func (p *Parser) insertTemplate(token Token) {
+	template := p.insertElement(token)
+	template.Content = &Node{Type: DocumentFragmentNode, Children: make([]*Node, 0)}
+	if p.currentParent() != template {
+		return // <template/>
+	}
+	p.formatting = append(p.formatting, nil)
+	p.push(template.Content)
+}
+
+// inTemplate reports whether content is being parsed into a template's
+// content fragment.
+func (p *Parser) inTemplate() bool {
+	for i := len(p.stack) - 1; i >= 1; i-- {
+		if p.stack[i].Type == DocumentFragmentNode {
+			return true
+		}
+	}
+	return false
+}
+
+// templateOpen reports whether a template element is open.
+func (p *Parser) templateOpen() bool {
+	for i := len(p.stack) - 1; i >= 1; i-- {
+		if p.stack[i].TagName == "template" {
+			return true
+		}
+	}
+	return false
+}
+
+// inForeignContent reports whether an svg or math element is open, and
+// not one of their elements whose content is HTML; the elements inside
+// them nest as written.
+func (p *Parser) inForeignContent() bool {
+	for i := len(p.stack) - 1; i >= 1; i-- {
+		switch p.stack[i].TagName {
+		case "svg", "math":
+			return true
+		case "foreignobject", "desc", "title", "mi", "mo", "mn", "ms", "mtext":
+			return false
+		}
+	}
+	return false
+}
+
+// breakoutElements are the start tags that close foreign content, as
+// HTML elements can't be inside svg or math (HTML §13.2.6.5).
+var breakoutElements = map[string]bool{
+	"b": true, "big": true, "blockquote": true, "body": true, "br": true,
+	"center": true, "code": true, "dd": true, "div": true, "dl": true,
+	"dt": true, "em": true, "embed": true, "h1": true, "h2": true, "h3": true,
+	"h4": true, "h5": true, "h6": true, "head": true, "hr": true, "i": true,
+	"img": true, "li": true, "listing": true, "menu": true, "meta": true,
+	"nobr": true, "ol": true, "p": true, "pre": true, "ruby": true, "s": true,
+	"small": true, "span": true, "strike": true, "strong": true, "sub": true,
+	"sup": true, "table": true, "tt": true, "u": true, "ul": true, "var": true,
+}
+
+// breaksOutOfForeignContent reports whether the start tag closes the svg
+// or math it is in; a font does only with one of its presentational
+// attributes.
+func breaksOutOfForeignContent(token Token) bool {
+	if token.TagName == "font" {
+		for _, attr := range []string{"color", "face", "size"} {
+			if _, ok := token.Attributes[attr]; ok {
+				return true
+			}
+		}
+		return false
+	}
+	return breakoutElements[token.TagName]
+}
+
+// insertElement creates the element for a start tag at the appropriate
+// place and, unless it is void or self-closing, makes it the current node.
+func (p *Parser) insertElement(token Token) *Node {
+	node := newElement(token)
+	p.insertNode(node)
+	p.openElement(node, token)
+	return node
+}
+
+// insertTableElement inserts an element that belongs in a table into the
+// current node, where insertElement would foster parent it.
+func (p *Parser) insertTableElement(token Token) *Node {
+	node := newElement(token)
+	p.currentParent().AddChild(node)
+	p.openElement(node, token)
+	return node
+}
+
+// newElement creates the element for a start tag.
+func newElement(token Token) *Node {
+	node := &Node{
+		Type:       ElementNode,
+		TagName:    token.TagName,
+		Attributes: token.Attributes,
+		Children:   make([]*Node, 0),
+	}
+	if node.Attributes == nil {
+		node.Attributes = make(map[string]string)
+	}
+	return node
+}
+
+// openElement makes a newly inserted element the current node, unless it is
+// void or self-closing.
+func (p *Parser) openElement(node *Node, token Token) {
+	// In XHTML, any element can be self-closing with /> syntax
+	if !p.isSelfClosing(token.TagName) && !token.SelfClosing {
+		p.push(node)
+	}
+}
+
+// insertNode inserts node at the appropriate place for a new node.
+func (p *Parser) insertNode(node *Node) {
+	parent, before := p.insertionLocation()
+	if before != nil {
+		parent.InsertBefore(node, before)
+		return
+	}
+	parent.AddChild(node)
+}
+
+// insertionLocation returns where a new node goes: into the current node,
+// or, for content in a table that can't be there, into the table's parent
+// before the table (foster parenting). before is nil to append.
+func (p *Parser) insertionLocation() (parent, before *Node) {
+	target := p.currentParent()
+	if !isTableContext(target.TagName) {
+		return target, nil
+	}
+	for i := len(p.stack) - 1; i >= 1; i-- {
+		if table := p.stack[i]; table.TagName == "table" {
+			if table.Parent != nil {
+				return table.Parent, table
+			}
+			return p.stack[i-1], nil
+		}
+	}
+	return target, nil
+}
+
+// ensureHTML creates the html element if the document didn't start it.
+func (p *Parser) ensureHTML() {
+	if !p.documentMode || p.html != nil {
+		return
+	}
+	p.html = &Node{Type: ElementNode, TagName: "html", Attributes: make(map[string]string), Children: make([]*Node, 0)}
+	p.doc.Root.AddChild(p.html)
+	p.push(p.html)
+}
+
+// ensureHead creates the head element if it is missing, and makes it the
+// current node again if it was closed.
+func (p *Parser) ensureHead() {
+	p.ensureHTML()
+	if p.head == nil {
+		p.head = p.insertElement(Token{Type: TokenStartTag, TagName: "head"})
+		return
+	}
+	if !p.onStack(p.head) {
+		p.push(p.head)
+	}
+}
+
+// ensureBody opens the body element if the document hasn't yet.
+func (p *Parser) ensureBody() {
+	if p.documentMode && p.body == nil && !p.inTemplate() {
+		p.openBody(nil)
+	}
+}
+
+// openBody closes the head and opens the body with the given attributes.
+func (p *Parser) openBody(attributes map[string]string) {
+	p.ensureHTML()
+	if p.head == nil {
+		p.head = &Node{Type: ElementNode, TagName: "head", Attributes: make(map[string]string), Children: make([]*Node, 0)}
+		p.html.AddChild(p.head)
+	}
+	p.popUntilNode(p.html)
+	p.push(p.html)
+	p.body = p.insertElement(Token{Type: TokenStartTag, TagName: "body", Attributes: attributes})
+}
+
+// mergeAttributes adds the attributes an element doesn't have yet, for a
+// repeated html or body start tag.
+func mergeAttributes(node *Node, attributes map[string]string) {
+	for name, value := range attributes {
+		if _, ok := node.Attributes[name]; !ok {
+			if node.Attributes == nil {
+				node.Attributes = make(map[string]string)
+			}
+			node.Attributes[name] = value
+		}
+	}
+}
+
+// onStack reports whether node is an open element.
+func (p *Parser) onStack(node *Node) bool {
+	return p.stackIndex(node) >= 0
+}
+
+// stackIndex returns the position of node in the stack of open elements,
+// or -1.
+func (p *Parser) stackIndex(node *Node) int {
+	for i := len(p.stack) - 1; i >= 0; i-- {
+		if p.stack[i] == node {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeFromStack removes node from the stack of open elements.
+func (p *Parser) removeFromStack(node *Node) {
+	if i := p.stackIndex(node); i >= 1 {
+		p.stack = append(p.stack[:i], p.stack[i+1:]...)
+	}
+}
+
+// popUntil pops elements up to and including the nearest one with the tag.
+func (p *Parser) popUntil(tag string) {
+	for len(p.stack) > 1 {
+		if p.pop().TagName == tag {
+			return
+		}
+	}
+}
+
+// popUntilNode pops elements up to and including node.
+func (p *Parser) popUntilNode(node *Node) {
+	if i := p.stackIndex(node); i >= 1 {
+		p.stack = p.stack[:i]
+	}
+}
+
+// inScope reports whether an element with the tag is open within the scope.
+func (p *Parser) inScope(tag string, s scope) bool {
+	for i := len(p.stack) - 1; i >= 0; i-- {
+		node := p.stack[i]
+		if node.TagName == tag {
+			return true
+		}
+		if isScopeBoundary(node.TagName, s) {
+			return false
+		}
+	}
+	return false
+}
+
+// nodeInScope reports whether node is open within the default scope.
+func (p *Parser) nodeInScope(target *Node) bool {
+	for i := len(p.stack) - 1; i >= 0; i-- {
+		node := p.stack[i]
+		if node == target {
+			return true
+		}
+		if isScopeBoundary(node.TagName, defaultScope) {
+			return false
+		}
+	}
+	return false
+}
+
+// headingInScope reports whether any of h1 to h6 is open in scope.
+func (p *Parser) headingInScope() bool {
+	for i := len(p.stack) - 1; i >= 0; i-- {
+		node := p.stack[i]
+		if isHeading(node.TagName) {
+			return true
+		}
+		if isScopeBoundary(node.TagName, defaultScope) {
+			return false
+		}
+	}
+	return false
+}
+
+// generateImpliedEndTags pops the elements whose end tags are implied,
+// other than except.
+func (p *Parser) generateImpliedEndTags(except string) {
+	for len(p.stack) > 1 {
+		tag := p.currentParent().TagName
+		if !impliedEndTags[tag] || tag == except {
+			return
+		}
+		p.pop()
+	}
+}
+
+// closeP closes the open p element.
+func (p *Parser) closeP() {
+	p.generateImpliedEndTags("p")
+	p.popUntil("p")
+}
+
+// closePInButtonScope closes a p element if one is open in button scope.
+func (p *Parser) closePInButtonScope() {
+	if p.inScope("p", buttonScope) {
+		p.closeP()
+	}
+}
+
+// closeListItem closes an open li, or dd or dt, before a new one starts.
+func (p *Parser) closeListItem(name string) {
+	for i := len(p.stack) - 1; i >= 1; i-- {
+		tag := p.stack[i].TagName
+		if tag == name || (name != "li" && (tag == "dd" || tag == "dt")) {
+			p.generateImpliedEndTags(tag)
+			p.popUntil(tag)
+			return
+		}
+		if specialElements[tag] && tag != "address" && tag != "div" && tag != "p" {
+			return
+		}
+	}
+}
+
+// anyOtherEndTag closes the nearest open element with the tag, unless a
+// special element is open inside it, in which case the tag is ignored.
+func (p *Parser) anyOtherEndTag(name string) {
+	for i := len(p.stack) - 1; i >= 1; i-- {
+		node := p.stack[i]
+		if node.TagName == name {
+			p.generateImpliedEndTags(name)
+			p.popUntilNode(node)
+			return
+		}
+		if specialElements[node.TagName] {
+			return
+		}
+	}
+}
+
+// inTableBody reports whether the current node is part of a table's
+// structure rather than a cell or caption.
+func (p *Parser) inTableBody() bool {
+	return isTableContext(p.currentParent().TagName)
+}
+
+// tablePart inserts a table structure element, with the tbody and tr it
+// implies, after closing the cells, rows and sections it implies the end
+// of. It returns false if the element isn't in a table and should be
+// inserted like any other.
+func (p *Parser) tablePart(token Token) bool {
+	name := token.TagName
+	if !p.inScope("table", tableScope) {
+		if p.fragmentMode || p.currentParent().Type == DocumentFragmentNode {
+			// Table parts parsed out of context, as for innerHTML or
+			// directly in a template
+			return false
+		}
+		// Stray table parts outside a table are ignored
+		return true
+	}
+
+	if name == "table" {
+		// A table can't start in a table's structure: close the open one
+		p.popUntil("table")
+		p.startTag(token)
+		return true
+	}
+
+	// Cells end at the next cell or structure element
+	if p.inScope("td", tableScope) || p.inScope("th", tableScope) {
+		if !p.cellInTableScope() {
+			// A table nested in the cell is still open
+			return false
+		}
+		p.generateImpliedEndTags("")
+		for len(p.stack) > 1 {
+			if tag := p.pop().TagName; tag == "td" || tag == "th" {
+				break
+			}
+		}
+		p.clearFormattingToMarker()
+	}
+	if p.inScope("caption", tableScope) && p.nearestTableElement() == "caption" {
+		p.generateImpliedEndTags("")
+		p.popUntil("caption")
+		p.clearFormattingToMarker()
+	}
+
+	switch name {
+	case "td", "th":
+		p.clearToContext("tr", "tbody", "thead", "tfoot", "table")
+		if cur := p.currentParent().TagName; cur != "tr" {
+			if cur == "table" {
+				p.insertTableElement(Token{Type: TokenStartTag, TagName: "tbody"})
+			}
+			p.insertTableElement(Token{Type: TokenStartTag, TagName: "tr"})
+		}
+		p.insertTableElement(token)
+		p.formatting = append(p.formatting, nil)
+	case "tr":
+		p.clearToContext("tbody", "thead", "tfoot", "table")
+		if p.currentParent().TagName == "table" {
+			p.insertTableElement(Token{Type: TokenStartTag, TagName: "tbody"})
+		}
+		p.insertTableElement(token)
+	case "tbody", "thead", "tfoot":
+		p.clearToContext("table")
+		p.insertTableElement(token)
+	case "caption":
+		p.clearToContext("table")
+		p.insertTableElement(token)
+		p.formatting = append(p.formatting, nil)
+	case "colgroup":
+		p.clearToContext("table")
+		p.insertTableElement(token)
+	case "col":
+		p.clearToContext("colgroup", "table")
+		if p.currentParent().TagName == "table" {
+			p.insertTableElement(Token{Type: TokenStartTag, TagName: "colgroup"})
+		}
+		p.insertTableElement(token)
+	}
+	return true
+}
+
+// cellInTableScope reports whether the nearest open cell belongs to the
+// nearest open table, rather than to a table nested inside the cell.
+func (p *Parser) cellInTableScope() bool {
+	tag := p.nearestTableElement()
+	return tag == "td" || tag == "th"
+}
+
+// nearestTableElement returns the tag of the innermost open table, cell
+// or caption.
+func (p *Parser) nearestTableElement() string {
+	for i := len(p.stack) - 1; i >= 1; i-- {
+		switch tag := p.stack[i].TagName; tag {
+		case "table", "td", "th", "caption":
+			return tag
+		}
+	}
+	return ""
+}
+
+// clearToContext pops elements until the current node has one of the tags
+// (or the table is reached).
+func (p *Parser) clearToContext(tags ...string) {
+	for len(p.stack) > 1 {
+		cur := p.currentParent().TagName
+		if cur == "table" || cur == "html" {
+			return
+		}
+		for _, tag := range tags {
+			if cur == tag {
+				return
+			}
+		}
+		p.pop()
+	}
+}
+
+// pushFormatting adds a formatting element to the list of active formatting
+// elements. Of three or more identical ones since the last marker, only
+// the last three are kept (the Noah's Ark clause).
+func (p *Parser) pushFormatting(node *Node) {
+	same := 0
+	earliest := -1
+	for i := len(p.formatting) - 1; i >= 0; i-- {
+		entry := p.formatting[i]
+		if entry == nil {
+			break
+		}
+		if sameElement(entry, node) {
+			same++
+			earliest = i
+		}
+	}
+	if same >= 3 {
+		p.formatting = append(p.formatting[:earliest], p.formatting[earliest+1:]...)
+	}
+	p.formatting = append(p.formatting, node)
+}
+
+// sameElement reports whether two elements have the same tag and attributes.
+func sameElement(a, b *Node) bool {
+	if a.TagName != b.TagName || len(a.Attributes) != len(b.Attributes) {
+		return false
+	}
+	for name, value := range a.Attributes {
+		if other, ok := b.Attributes[name]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+// formattingElementAfterMarker returns the last active formatting element
+// with the tag since the last marker, or nil.
+func (p *Parser) formattingElementAfterMarker(tag string) *Node {
+	for i := len(p.formatting) - 1; i >= 0; i-- {
+		entry := p.formatting[i]
+		if entry == nil {
+			return nil
+		}
+		if entry.TagName == tag {
+			return entry
+		}
+	}
+	return nil
+}
+
+// formattingIndex returns the position of node in the list of active
+// formatting elements, or -1.
+func (p *Parser) formattingIndex(node *Node) int {
+	for i := len(p.formatting) - 1; i >= 0; i-- {
+		if p.formatting[i] == node {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeFormatting removes node from the list of active formatting elements.
+func (p *Parser) removeFormatting(node *Node) {
+	if i := p.formattingIndex(node); i >= 0 {
+		p.formatting = append(p.formatting[:i], p.formatting[i+1:]...)
+	}
+}
+
+// clearFormattingToMarker removes the active formatting elements up to and
+// including the last marker.
+func (p *Parser) clearFormattingToMarker() {
+	for len(p.formatting) > 0 {
+		entry := p.formatting[len(p.formatting)-1]
+		p.formatting = p.formatting[:len(p.formatting)-1]
+		if entry == nil {
+			return
+		}
+	}
+}
+
+// reconstructFormatting reopens the active formatting elements that were
+// closed by the end of an element they were open in, so <b>x<p>y keeps y
+// bold.
+func (p *Parser) reconstructFormatting() {
+	n := len(p.formatting)
+	if n == 0 || p.formatting[n-1] == nil || p.onStack(p.formatting[n-1]) {
+		return
+	}
+	i := n - 1
+	for i > 0 {
+		entry := p.formatting[i-1]
+		if entry == nil || p.onStack(entry) {
+			break
+		}
+		i--
+	}
+	for ; i < n; i++ {
+		entry := p.formatting[i]
+		clone := p.insertElement(Token{Type: TokenStartTag, TagName: entry.TagName, Attributes: copyAttributes(entry.Attributes)})
+		p.formatting[i] = clone
+	}
+}
+
+// copyAttributes returns a copy of an element's attributes.
+func copyAttributes(attributes map[string]string) map[string]string {
+	clone := make(map[string]string, len(attributes))
+	for name, value := range attributes {
+		clone[name] = value
+	}
+	return clone
+}
+
+// adoptionAgency runs the adoption agency algorithm (HTML §13.2.6.4.7) for
+// the end tag of a formatting element, moving the elements opened inside it
+// so the tree nests. It returns false if there is no such formatting
+// element, and the end tag is handled like any other.
+func (p *Parser) adoptionAgency(tag string) bool {
+	if cur := p.currentParent(); cur.TagName == tag && p.formattingIndex(cur) < 0 {
+		p.pop()
+		return true
+	}
+
+	for outer := 0; outer < 8; outer++ {
+		formattingElement := p.formattingElementAfterMarker(tag)
+		if formattingElement == nil {
+			return false
+		}
+		feIndex := p.stackIndex(formattingElement)
+		if feIndex < 0 {
+			p.removeFormatting(formattingElement)
+			return true
+		}
+		if !p.nodeInScope(formattingElement) {
+			return true
+		}
+
+		// The furthest block is the first special element opened inside it
+		var furthestBlock *Node
+		for _, node := range p.stack[feIndex+1:] {
+			if specialElements[node.TagName] {
+				furthestBlock = node
+				break
+			}
+		}
+		if furthestBlock == nil {
+			p.popUntilNode(formattingElement)
+			p.removeFormatting(formattingElement)
+			return true
+		}
+
+		commonAncestor := p.stack[feIndex-1]
+		bookmark := p.formattingIndex(formattingElement)
+		node, lastNode := furthestBlock, furthestBlock
+		nodeIndex := p.stackIndex(furthestBlock)
+		for inner := 1; ; inner++ {
+			nodeIndex--
+			node = p.stack[nodeIndex]
+			if node == formattingElement {
+				break
+			}
+			if inner > 3 && p.formattingIndex(node) >= 0 {
+				if i := p.formattingIndex(node); i < bookmark {
+					bookmark--
+				}
+				p.removeFormatting(node)
+			}
+			fi := p.formattingIndex(node)
+			if fi < 0 {
+				p.stack = append(p.stack[:nodeIndex], p.stack[nodeIndex+1:]...)
+				continue
+			}
+			clone := &Node{Type: ElementNode, TagName: node.TagName, Attributes: copyAttributes(node.Attributes), Children: make([]*Node, 0)}
+			p.formatting[fi] = clone
+			p.stack[nodeIndex] = clone
+			node = clone
+			if lastNode == furthestBlock {
+				bookmark = fi + 1
+			}
+			if lastNode.Parent != nil {
+				lastNode.Parent.RemoveChild(lastNode)
+			}
+			node.AddChild(lastNode)
+			lastNode = node
+		}
+
+		if lastNode.Parent != nil {
+			lastNode.Parent.RemoveChild(lastNode)
+		}
+		if isTableContext(commonAncestor.TagName) {
+			p.fosterParent(lastNode)
+		} else {
+			commonAncestor.AddChild(lastNode)
+		}
+
+		newElement := &Node{Type: ElementNode, TagName: formattingElement.TagName, Attributes: copyAttributes(formattingElement.Attributes), Children: make([]*Node, 0)}
+		children := furthestBlock.Children
+		furthestBlock.Children = make([]*Node, 0)
+		for _, child := range children {
+			newElement.AddChild(child)
+		}
+		furthestBlock.AddChild(newElement)
+
+		if i := p.formattingIndex(formattingElement); i >= 0 {
+			if i < bookmark {
+				bookmark--
+			}
+			p.removeFormatting(formattingElement)
+		}
+		if bookmark > len(p.formatting) {
+			bookmark = len(p.formatting)
+		}
+		p.formatting = append(p.formatting, nil)
+		copy(p.formatting[bookmark+1:], p.formatting[bookmark:])
+		p.formatting[bookmark] = newElement
+
+		p.removeFromStack(formattingElement)
+		fbIndex := p.stackIndex(furthestBlock)
+		p.stack = append(p.stack, nil)
+		copy(p.stack[fbIndex+2:], p.stack[fbIndex+1:])
+		p.stack[fbIndex+1] = newElement
+	}
+	return true
+}
+
+// fosterParent inserts node before the innermost open table.
+func (p *Parser) fosterParent(node *Node) {
+	for i := len(p.stack) - 1; i >= 1; i-- {
+		if table := p.stack[i]; table.TagName == "table" {
+			if table.Parent != nil {
+				table.Parent.InsertBefore(node, table)
+			} else {
+				p.stack[i-1].AddChild(node)
+			}
+			return
+		}
+	}
+	p.currentParent().AddChild(node)
+}
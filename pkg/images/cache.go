@@ -0,0 +1,201 @@
+package images
+
+import (
+	"container/list"
+	"context"
+	"image"
+	"runtime"
+	"sync"
+)
+
+// DefaultCacheBudget is the decoded size, in bytes, the shared image cache
+// holds before evicting the least recently used images.
+const DefaultCacheBudget = 128 << 20
+
+// ImageCache holds decoded images keyed by resolved URL, within a budget of
+// decoded bytes. Concurrent loads of the same image share one decode.
+type ImageCache struct {
+	mu       sync.Mutex
+	budget   int64
+	size     int64
+	entries  map[string]*list.Element // Values are *cacheEntry
+	lru      *list.List               // Most recently used at the front
+	inflight map[string]*decodeCall
+}
+
+type cacheEntry struct {
+	key  string
+	img  image.Image
+	cost int64
+}
+
+// decodeCall is a load in progress that other callers wait on.
+type decodeCall struct {
+	done chan struct{}
+	img  image.Image
+	err  error
+}
+
+// NewImageCache creates a cache holding up to budget bytes of decoded
+// images.
+func NewImageCache(budget int64) *ImageCache {
+	return &ImageCache{
+		budget:   budget,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		inflight: make(map[string]*decodeCall),
+	}
+}
+
+// Global image cache
+var globalCache = NewImageCache(DefaultCacheBudget)
+
+// SetCacheBudget changes the budget of the shared image cache, evicting
+// images if it is now over budget.
+func SetCacheBudget(budget int64) {
+	globalCache.mu.Lock()
+	defer globalCache.mu.Unlock()
+	globalCache.budget = budget
+	globalCache.evict()
+}
+
+// ClearCache empties the shared image cache, so images that changed since
+// they were loaded are loaded again.
+func ClearCache() {
+	globalCache.Clear()
+}
+
+// Get returns the cached image for key, marking it recently used.
+func (c *ImageCache) Get(key string) (image.Image, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(el)
+		return el.Value.(*cacheEntry).img, true
+	}
+	return nil, false
+}
+
+// Add caches img under key. Images larger than the whole budget are not
+// cached.
+func (c *ImageCache) Add(key string, img image.Image) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(key, img)
+}
+
+func (c *ImageCache) add(key string, img image.Image) {
+	cost := imageCost(img)
+	if cost > c.budget {
+		return
+	}
+	if el, ok := c.entries[key]; ok {
+		old := el.Value.(*cacheEntry)
+		c.size += cost - old.cost
+		old.img, old.cost = img, cost
+		c.lru.MoveToFront(el)
+	} else {
+		c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, img: img, cost: cost})
+		c.size += cost
+	}
+	c.evict()
+}
+
+// evict drops least recently used images until the cache is within budget.
+func (c *ImageCache) evict() {
+	for c.size > c.budget && c.lru.Len() > 0 {
+		el := c.lru.Back()
+		e := el.Value.(*cacheEntry)
+		c.lru.Remove(el)
+		delete(c.entries, e.key)
+		c.size -= e.cost
+	}
+}
+
+// Clear drops every cached image.
+func (c *ImageCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.size = 0
+}
+
+// Size returns the decoded bytes the cache holds.
+func (c *ImageCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// load returns the cached image for key, or calls decode to load it. While
+// a decode is in progress, other loads of the key wait for its result
+// rather than decoding again. Errors are not cached.
+func (c *ImageCache) load(key string, decode func() (image.Image, error)) (image.Image, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(el)
+		c.mu.Unlock()
+		return el.Value.(*cacheEntry).img, nil
+	}
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		<-call.done
+		return call.img, call.err
+	}
+	call := &decodeCall{done: make(chan struct{})}
+	c.inflight[key] = call
+	c.mu.Unlock()
+
+	call.img, call.err = decode()
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	if call.err == nil {
+		c.add(key, call.img)
+	}
+	c.mu.Unlock()
+	close(call.done)
+	return call.img, call.err
+}
+
+// imageCost estimates the memory a decoded image holds: four bytes a pixel.
+func imageCost(img image.Image) int64 {
+	b := img.Bounds()
+	return int64(b.Dx()) * int64(b.Dy()) * 4
+}
+
+// Prewarm loads images concurrently into the shared cache, so layout and
+// paint find them decoded. Duplicate URIs are loaded once and load errors
+// are ignored; the image is retried when it is next needed. Prewarm stops
+// starting loads once ctx is done.
+func Prewarm(ctx context.Context, uris []string, fetcher ImageFetcher) {
+	seen := make(map[string]bool)
+	var pending []string
+	for _, uri := range uris {
+		if _, cached := globalCache.Get(uri); uri != "" && !cached && !seen[uri] {
+			seen[uri] = true
+			pending = append(pending, uri)
+		}
+	}
+
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < min(len(pending), runtime.GOMAXPROCS(0)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for uri := range queue {
+				LoadImageWithFetcher(ctx, uri, fetcher)
+			}
+		}()
+	}
+	for _, uri := range pending {
+		if ctx.Err() != nil {
+			break
+		}
+		queue <- uri
+	}
+	close(queue)
+	wg.Wait()
+}
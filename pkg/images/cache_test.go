@@ -0,0 +1,135 @@
+package images
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestImageCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2)) // 16 bytes decoded
+	c := NewImageCache(40)
+	c.Add("a", img)
+	c.Add("b", img)
+	c.Get("a") // b is now least recently used
+	c.Add("c", img)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("expected %s to be cached", key)
+		}
+	}
+	if c.Size() != 32 {
+		t.Errorf("expected 32 bytes cached, got %d", c.Size())
+	}
+
+	c.Add("huge", image.NewRGBA(image.Rect(0, 0, 10, 10)))
+	if _, ok := c.Get("huge"); ok {
+		t.Error("an image over the whole budget should not be cached")
+	}
+}
+
+func TestImageCache_Clear(t *testing.T) {
+	c := NewImageCache(40)
+	c.Add("a", image.NewRGBA(image.Rect(0, 0, 2, 2)))
+	c.Clear()
+	if _, ok := c.Get("a"); ok || c.Size() != 0 {
+		t.Errorf("expected an empty cache, got %d bytes", c.Size())
+	}
+	c.Add("b", image.NewRGBA(image.Rect(0, 0, 2, 2)))
+	if _, ok := c.Get("b"); !ok {
+		t.Error("expected the cleared cache to cache again")
+	}
+}
+
+func TestImageCache_LoadSharesDecode(t *testing.T) {
+	c := NewImageCache(DefaultCacheBudget)
+	var decodes atomic.Int32
+	release := make(chan struct{})
+	decode := func() (image.Image, error) {
+		decodes.Add(1)
+		<-release
+		return image.NewRGBA(image.Rect(0, 0, 1, 1)), nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]image.Image, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = c.load("icon.png", decode)
+		}(i)
+	}
+	// Let the goroutines queue up on the first decode before it finishes
+	for decodes.Load() == 0 {
+		runtime.Gosched()
+	}
+	close(release)
+	wg.Wait()
+
+	if n := decodes.Load(); n != 1 {
+		t.Errorf("expected 1 decode, got %d", n)
+	}
+	for i, img := range results {
+		if img != results[0] {
+			t.Errorf("load %d returned a different image", i)
+		}
+	}
+}
+
+func TestPrewarm(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 3, 2)))
+	var fetches atomic.Int32
+	fetcher := func(ctx context.Context, uri string) ([]byte, error) {
+		fetches.Add(1)
+		return buf.Bytes(), nil
+	}
+
+	var uris []string
+	for i := 0; i < 20; i++ {
+		uris = append(uris, fmt.Sprintf("https://prewarm.test/icon%d.png", i%5))
+	}
+	Prewarm(context.Background(), uris, fetcher)
+	if n := fetches.Load(); n != 5 {
+		t.Errorf("expected 5 fetches, got %d", n)
+	}
+
+	// Layout and paint now find the images decoded
+	w, h, err := GetImageDimensionsWithFetcher(context.Background(), "https://prewarm.test/icon3.png", fetcher)
+	if err != nil || w != 3 || h != 2 {
+		t.Errorf("expected 3x2, got %dx%d (%v)", w, h, err)
+	}
+	if n := fetches.Load(); n != 5 {
+		t.Errorf("expected no more fetches, got %d", n-5)
+	}
+}
+
+func TestResolveURI(t *testing.T) {
+	tests := []struct {
+		base, uri, want string
+	}{
+		{"https://a.test/dir/page.html", "logo.png", "https://a.test/dir/logo.png"},
+		{"https://a.test/dir/page.html", "/logo.png", "https://a.test/logo.png"},
+		{"https://a.test/page.html", "https://b.test/x.png", "https://b.test/x.png"},
+		{"/site/index.html", "img/logo.png", "/site/img/logo.png"},
+		{"/site/index.html", "/abs/logo.png", "/abs/logo.png"},
+		{"/site/index.html", "data:image/png;base64,AA==", "data:image/png;base64,AA=="},
+		{"", "logo.png", "logo.png"},
+	}
+	for _, tt := range tests {
+		if got := ResolveURI(tt.base, tt.uri); got != tt.want {
+			t.Errorf("ResolveURI(%q, %q) = %q, want %q", tt.base, tt.uri, got, tt.want)
+		}
+	}
+}
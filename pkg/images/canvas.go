@@ -0,0 +1,56 @@
+package images
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"sync"
+)
+
+// Canvas bitmaps
+//
+// A <canvas> element is drawn into by scripts rather than loaded, so its
+// bitmap is registered under a canvas: URI and loads like any other image.
+// Canvas URIs bypass the cache: the bitmap changes between layouts and is
+// always read as it is now.
+
+// canvasScheme prefixes the URIs of registered canvas bitmaps.
+const canvasScheme = "canvas:"
+
+var canvases = struct {
+	sync.RWMutex
+	bitmaps map[string]image.Image
+}{bitmaps: make(map[string]image.Image)}
+
+// isCanvasURI returns true if uri names a canvas bitmap.
+func isCanvasURI(uri string) bool {
+	return strings.HasPrefix(uri, canvasScheme)
+}
+
+// RegisterCanvas makes bitmap load under the canvas URI canvas:name,
+// replacing any bitmap registered under it, and returns the URI.
+func RegisterCanvas(name string, bitmap image.Image) string {
+	uri := canvasScheme + name
+	canvases.Lock()
+	defer canvases.Unlock()
+	canvases.bitmaps[uri] = bitmap
+	return uri
+}
+
+// ReleaseCanvas unregisters the bitmap registered under uri.
+func ReleaseCanvas(uri string) {
+	canvases.Lock()
+	defer canvases.Unlock()
+	delete(canvases.bitmaps, uri)
+}
+
+// loadCanvas returns the bitmap registered under uri, or an error if none
+// is.
+func loadCanvas(uri string) (image.Image, error) {
+	canvases.RLock()
+	defer canvases.RUnlock()
+	if bitmap, ok := canvases.bitmaps[uri]; ok {
+		return bitmap, nil
+	}
+	return nil, fmt.Errorf("no canvas registered as %s", uri)
+}
@@ -2,129 +2,64 @@ package images
 
 import (
 	"bytes"
-	"encoding/base64"
+	"context"
 	"fmt"
 	"image"
-	_ "image/gif"
+	"image/draw"
+	"image/gif"
 	_ "image/jpeg"
 	_ "image/png"
+	"math"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
-)
 
-// ImageCache caches loaded images
-type ImageCache struct {
-	cache map[string]image.Image
-	mu    sync.RWMutex
-}
+	"louis14/pkg/svg"
+	stdnet "louis14/std/net"
 
-// Global image cache
-var globalCache = &ImageCache{
-	cache: make(map[string]image.Image),
-}
+	_ "golang.org/x/image/webp"
+)
 
 // IsDataURI returns true if the string is a data URI.
 func IsDataURI(uri string) bool {
-	return strings.HasPrefix(uri, "data:")
+	return stdnet.IsDataURL(uri)
 }
 
 // LoadImageFromDataURI decodes a data URI and returns the embedded image.
 // Format: data:[<mediatype>][;base64],<data>
 func LoadImageFromDataURI(uri string) (image.Image, error) {
-	if !strings.HasPrefix(uri, "data:") {
-		return nil, fmt.Errorf("not a data URI")
-	}
-
-	// Split off "data:" prefix
-	rest := uri[5:]
-
-	// Find the comma separating metadata from data
-	commaIdx := strings.Index(rest, ",")
-	if commaIdx < 0 {
-		return nil, fmt.Errorf("invalid data URI: no comma found")
-	}
-
-	meta := rest[:commaIdx]
-	encoded := rest[commaIdx+1:]
-
-	isBase64 := strings.HasSuffix(meta, ";base64")
-
-	var data []byte
-	if isBase64 {
-		// URL-decode the base64 data first (handles %2F, %2B, etc.)
-		if decoded, err := url.PathUnescape(encoded); err == nil {
-			encoded = decoded
-		}
-		var err error
-		data, err = base64.StdEncoding.DecodeString(encoded)
-		if err != nil {
-			return nil, fmt.Errorf("base64 decode error: %w", err)
-		}
-	} else {
-		data = []byte(encoded)
-	}
-
-	img, _, err := image.Decode(bytes.NewReader(data))
+	data, _, err := stdnet.DecodeDataURL(uri)
 	if err != nil {
-		return nil, fmt.Errorf("image decode error: %w", err)
+		return nil, err
 	}
+	return DecodeImageBytes(data)
+}
 
-	return img, nil
+// SVGDataURI returns a data URI for SVG markup, so inline <svg> elements
+// can be loaded like any other image source.
+func SVGDataURI(markup string) string {
+	return "data:image/svg+xml," + url.PathEscape(markup)
 }
 
 // LoadImage loads an image from the filesystem or a data URI.
 func LoadImage(path string) (image.Image, error) {
-	// Handle data URIs
-	if IsDataURI(path) {
-		// Check cache first
-		globalCache.mu.RLock()
-		if img, ok := globalCache.cache[path]; ok {
-			globalCache.mu.RUnlock()
-			return img, nil
+	if isCanvasURI(path) {
+		return loadCanvas(path)
+	}
+	return globalCache.load(path, func() (image.Image, error) {
+		// Handle data URIs
+		if IsDataURI(path) {
+			return LoadImageFromDataURI(path)
 		}
-		globalCache.mu.RUnlock()
 
-		img, err := LoadImageFromDataURI(path)
+		// Load image from file
+		data, err := os.ReadFile(path)
 		if err != nil {
 			return nil, err
 		}
-
-		globalCache.mu.Lock()
-		globalCache.cache[path] = img
-		globalCache.mu.Unlock()
-
-		return img, nil
-	}
-
-	// Check cache first
-	globalCache.mu.RLock()
-	if img, ok := globalCache.cache[path]; ok {
-		globalCache.mu.RUnlock()
-		return img, nil
-	}
-	globalCache.mu.RUnlock()
-
-	// Load image from file
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	img, _, err := image.Decode(file)
-	if err != nil {
-		return nil, err
-	}
-
-	// Cache the image
-	globalCache.mu.Lock()
-	globalCache.cache[path] = img
-	globalCache.mu.Unlock()
-
-	return img, nil
+		return DecodeImageBytes(data)
+	})
 }
 
 // GetImageDimensions returns the width and height of an image
@@ -138,13 +73,32 @@ func GetImageDimensions(path string) (width, height int, err error) {
 	return bounds.Dx(), bounds.Dy(), nil
 }
 
-// ImageFetcher is a function type that fetches raw bytes for an image URI.
-// It is used to support network-based image loading without creating a
-// dependency on the resource package.
-type ImageFetcher func(uri string) ([]byte, error)
+// ImageFetcher is a function type that fetches raw bytes for an image URI,
+// giving up when ctx is done. It is used to support network-based image
+// loading without creating a dependency on the resource package.
+type ImageFetcher func(ctx context.Context, uri string) ([]byte, error)
 
-// DecodeImageBytes decodes an image from raw bytes.
+// DecodeImageBytes decodes an image from raw bytes. PNG, JPEG, GIF and
+// WebP are supported; SVG documents are rasterized at their intrinsic
+// size, and animated GIFs show their first frame.
 func DecodeImageBytes(data []byte) (image.Image, error) {
+	if svg.IsSVG(data) {
+		doc, err := svg.Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("image decode error: %w", err)
+		}
+		// Sizes too large for an int are kept out of range rather than
+		// wrapped, so Rasterize rejects them
+		size := func(v float64) int { return int(min(math.Ceil(v), math.MaxInt32)) }
+		img, err := doc.Rasterize(size(doc.Width), size(doc.Height))
+		if err != nil {
+			return nil, fmt.Errorf("image decode error: %w", err)
+		}
+		return img, nil
+	}
+	if bytes.HasPrefix(data, []byte("GIF8")) {
+		return decodeGIF(data)
+	}
 	img, _, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
 		return nil, fmt.Errorf("image decode error: %w", err)
@@ -152,12 +106,33 @@ func DecodeImageBytes(data []byte) (image.Image, error) {
 	return img, nil
 }
 
+// decodeGIF returns the first frame of a GIF. A frame may cover only part
+// of the logical screen, so it is drawn onto a screen-sized canvas to give
+// the image its declared intrinsic size.
+func decodeGIF(data []byte) (image.Image, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("image decode error: %w", err)
+	}
+	if len(g.Image) == 0 {
+		return nil, fmt.Errorf("image decode error: gif has no frames")
+	}
+	frame := g.Image[0]
+	screen := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if screen.Empty() || screen == frame.Bounds() {
+		return frame, nil
+	}
+	canvas := image.NewRGBA(screen)
+	draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+	return canvas, nil
+}
+
 // LoadImageWithFetcher loads an image using the provided fetcher.
 // The fetcher is used for both network URIs and relative paths.
 // Falls back to LoadImage for data URIs and when no fetcher is provided.
-func LoadImageWithFetcher(path string, fetcher ImageFetcher) (image.Image, error) {
-	// Data URIs are handled by LoadImage
-	if IsDataURI(path) {
+func LoadImageWithFetcher(ctx context.Context, path string, fetcher ImageFetcher) (image.Image, error) {
+	// Data and canvas URIs are handled by LoadImage
+	if IsDataURI(path) || isCanvasURI(path) {
 		return LoadImage(path)
 	}
 
@@ -173,37 +148,20 @@ func LoadImageWithFetcher(path string, fetcher ImageFetcher) (image.Image, error
 		}
 	}
 
-	// Check cache first
-	globalCache.mu.RLock()
-	if img, ok := globalCache.cache[path]; ok {
-		globalCache.mu.RUnlock()
-		return img, nil
-	}
-	globalCache.mu.RUnlock()
-
-	// Fetch via network
-	data, err := fetcher(path)
-	if err != nil {
-		return nil, fmt.Errorf("fetching image %s: %w", path, err)
-	}
-
-	img, err := DecodeImageBytes(data)
-	if err != nil {
-		return nil, err
-	}
-
-	// Cache the image
-	globalCache.mu.Lock()
-	globalCache.cache[path] = img
-	globalCache.mu.Unlock()
-
-	return img, nil
+	return globalCache.load(path, func() (image.Image, error) {
+		// Fetch via network
+		data, err := fetcher(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("fetching image %s: %w", path, err)
+		}
+		return DecodeImageBytes(data)
+	})
 }
 
 // GetImageDimensionsWithFetcher returns the width and height of an image,
 // using the provided fetcher for network URIs.
-func GetImageDimensionsWithFetcher(path string, fetcher ImageFetcher) (width, height int, err error) {
-	img, err := LoadImageWithFetcher(path, fetcher)
+func GetImageDimensionsWithFetcher(ctx context.Context, path string, fetcher ImageFetcher) (width, height int, err error) {
+	img, err := LoadImageWithFetcher(ctx, path, fetcher)
 	if err != nil {
 		return 0, 0, err
 	}
@@ -220,9 +178,14 @@ func isNetworkURI(s string) bool {
 // NewFilesystemFetcher creates an ImageFetcher that resolves relative paths
 // against a base URL (typically the document's file path).
 func NewFilesystemFetcher(baseURL string) ImageFetcher {
-	return func(uri string) ([]byte, error) {
-		// Don't resolve data URIs or absolute network URLs
-		if IsDataURI(uri) || isNetworkURI(uri) {
+	return func(ctx context.Context, uri string) ([]byte, error) {
+		// Data URIs carry their content
+		if IsDataURI(uri) {
+			data, _, err := stdnet.DecodeDataURL(uri)
+			return data, err
+		}
+		// Don't resolve absolute network URLs
+		if isNetworkURI(uri) {
 			return nil, fmt.Errorf("filesystem fetcher only handles file paths")
 		}
 
@@ -242,3 +205,20 @@ func NewFilesystemFetcher(baseURL string) ImageFetcher {
 		return data, nil
 	}
 }
+
+// ResolveURI resolves an image URI against the URL or file path of the
+// document referencing it. Layout and paint load images by their resolved
+// URI, which keys the shared cache, so the same relative URI on different
+// pages names different images.
+func ResolveURI(base, uri string) string {
+	if base == "" || uri == "" || IsDataURI(uri) || isNetworkURI(uri) {
+		return uri
+	}
+	if isNetworkURI(base) {
+		return stdnet.ResolveURL(base, uri)
+	}
+	if filepath.IsAbs(uri) {
+		return uri
+	}
+	return filepath.Join(filepath.Dir(base), uri)
+}
@@ -1,9 +1,11 @@
 package images
 
 import (
+	"context"
 	"encoding/base64"
 	"image"
 	"image/color"
+	"image/gif"
 	"image/png"
 	"bytes"
 	"testing"
@@ -94,3 +96,100 @@ func TestGetImageDimensions_DataURI(t *testing.T) {
 		t.Errorf("expected 2x2, got %dx%d", w, h)
 	}
 }
+
+func TestLoadSVGDataURI(t *testing.T) {
+	uri := SVGDataURI(`<svg width="30" height="10"><rect width="30" height="10" fill="red"/></svg>`)
+	img, err := LoadImageFromDataURI(uri)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 30 || b.Dy() != 10 {
+		t.Errorf("expected 30x10 image, got %dx%d", b.Dx(), b.Dy())
+	}
+	if r, _, _, a := img.At(15, 5).RGBA(); r>>8 != 255 || a>>8 != 255 {
+		t.Errorf("expected opaque red pixel, got r=%d a=%d", r>>8, a>>8)
+	}
+}
+
+func TestDecodeImageBytes_HugeSVG(t *testing.T) {
+	for _, size := range []string{"1e9", "1e300"} {
+		data := []byte(`<svg width="` + size + `" height="` + size + `"><rect width="10" height="10"/></svg>`)
+		if img, err := DecodeImageBytes(data); err == nil {
+			t.Errorf("%s: expected an error, got a %v image", size, img.Bounds())
+		}
+	}
+}
+
+func TestDecodeGIFFirstFrame(t *testing.T) {
+	palette := color.Palette{color.Transparent, color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}}
+	first := image.NewPaletted(image.Rect(2, 2, 4, 4), palette)
+	for i := range first.Pix {
+		first.Pix[i] = 1
+	}
+	second := image.NewPaletted(image.Rect(0, 0, 6, 4), palette)
+	for i := range second.Pix {
+		second.Pix[i] = 2
+	}
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, &gif.GIF{
+		Image:  []*image.Paletted{first, second},
+		Delay:  []int{10, 10},
+		Config: image.Config{ColorModel: palette, Width: 6, Height: 4},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := DecodeImageBytes(buf.Bytes())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The first frame covers part of the logical screen, which sets the size
+	if b := img.Bounds(); b.Dx() != 6 || b.Dy() != 4 {
+		t.Errorf("expected 6x4 image, got %dx%d", b.Dx(), b.Dy())
+	}
+	if r, _, b, a := img.At(3, 3).RGBA(); r>>8 != 255 || b != 0 || a>>8 != 255 {
+		t.Errorf("expected the first frame's red pixel, got r=%d b=%d a=%d", r>>8, b>>8, a>>8)
+	}
+	if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("expected transparent outside the first frame, got alpha %d", a>>8)
+	}
+}
+
+// webpGopher is a 75x100 lossless WebP from the golang.org/x/image test data.
+const webpGopher = "" +
+	"UklGRrIBAABXRUJQVlA4TKUBAAAvSsAYAA8w//M///MfeJAkbXvaSG7m8Q3GfYSB" +
+	"JekwQztm/IcZlgwnmWImn2BK7aFmBtnVir6q//8VOkFE/xm4baTIu8c48ArEo6+B" +
+	"3zFKYln3pqClSCKX0begFTAXFOLXHSyF8cCNcZEG4OywuA4KVVfJCiArU7GAgJI8" +
+	"+lJP/OKMT/fBAjevg1cYB7YVkFuWga2lyPi5I0HFy5YTpWIHg0RZpkniRVW9odHA" +
+	"KOwosWuOGdxIyn2OvaCDvhg/we6TwadPBPbqBV58MsLmMJ8yZnOWk8SRz4N+QoyP" +
+	"L+MnamzMvcE1rHNEr91F9GKZPVUcS9w7PhhH36suB9qPeYb/oLk6cuTiJ0wOK3m5" +
+	"h1cKjW6EVZCYMK7dxcKCBdgP9HkKr9gkAO2P8GKZGWVdIAatQa+1IDpt6qyorVwd" +
+	"y01xdW8Jkfk6xjEXmVQQ+HQdFr6OKhIN34dXWq0+0qr6EJSCeeVLH9+gvGTLyqM6" +
+	"5PQ44ihzlTXxQKjKbAvshXgir7Lil9w4L2bvMycmjQcqXaMCO6BlY28i+FOLzbfI" +
+	"1vEqxAhotocAAA=="
+
+func TestDecodeWebP(t *testing.T) {
+	data, err := base64.StdEncoding.DecodeString(webpGopher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, h, err := GetImageDimensionsWithFetcher(context.Background(), "gopher.webp", func(context.Context, string) ([]byte, error) { return data, nil })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w != 75 || h != 100 {
+		t.Errorf("expected 75x100, got %dx%d", w, h)
+	}
+}
+
+func TestFilesystemFetcher_DataURI(t *testing.T) {
+	fetch := NewFilesystemFetcher("/nonexistent/page.html")
+	data, err := fetch(context.Background(), "data:text/plain;base64,aGVsbG8=")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("expected decoded data %q, got %q", "hello", data)
+	}
+}
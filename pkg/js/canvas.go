@@ -0,0 +1,659 @@
+package js
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+
+	"louis14/pkg/css"
+	"louis14/pkg/html"
+	"louis14/pkg/images"
+	"louis14/pkg/text"
+
+	"github.com/dop251/goja"
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+)
+
+// CanvasRenderingContext2D
+//
+// canvas.getContext("2d") returns a context that draws with gg onto the
+// canvas element's bitmap (html.Node.CanvasBitmap), which layout registers
+// as the element's image. It implements a subset of the 2D API: solid
+// colors, rectangles, paths of lines and arcs, text, images, transforms,
+// and getImageData. The current path is kept in bitmap coordinates,
+// transformed as it is built, so that rectangle and text calls, which gg
+// draws through its own path, leave it alone. Every call that draws marks
+// the canvas dirty, so the page is painted again.
+
+// canvasContext is the 2D context of a <canvas> element.
+type canvasContext struct {
+	ctx    *domContext
+	node   *html.Node
+	bitmap *image.RGBA     // Bitmap dc draws onto; replaced when the canvas is resized
+	dc     *gg.Context     // Holds the current transform
+	state  canvasState     // Drawing state set by scripts
+	stack  []canvasState   // States saved by save()
+	path   []canvasSubpath // Current path, in bitmap coordinates
+}
+
+// canvasState is the drawing state save() and restore() keep.
+type canvasState struct {
+	fillStyle, strokeStyle string // As serialized back to scripts
+	fill, stroke           css.Color
+	lineWidth              float64
+	globalAlpha            float64
+	font                   string
+	face                   font.Face
+	textAlign              string
+	textBaseline           string
+}
+
+// canvasSubpath is a run of connected points of the current path.
+type canvasSubpath struct {
+	points []gg.Point
+	closed bool
+}
+
+func defaultCanvasState() canvasState {
+	black := css.Color{A: 1}
+	return canvasState{
+		fillStyle: "#000000", strokeStyle: "#000000",
+		fill: black, stroke: black,
+		lineWidth:    1,
+		globalAlpha:  1,
+		font:         "10px sans-serif",
+		face:         canvasFontFace(css.ParseInlineStyle("font: 10px sans-serif")),
+		textAlign:    "start",
+		textBaseline: "alphabetic",
+	}
+}
+
+// canvasContext returns the 2D context of a <canvas> element, creating it
+// on first use so that every getContext("2d") returns the same object.
+func (ctx *domContext) canvasContext(node *html.Node) goja.Value {
+	if v, ok := ctx.contexts[node]; ok {
+		return v
+	}
+	if ctx.contexts == nil {
+		ctx.contexts = make(map[*html.Node]goja.Value)
+	}
+	v := ctx.vm.NewDynamicObject(&canvasContext{ctx: ctx, node: node})
+	ctx.contexts[node] = v
+	return v
+}
+
+// surface returns the gg context drawing onto the canvas's bitmap. When the
+// canvas was resized its bitmap was replaced, and the drawing state is
+// reset along with it.
+func (c *canvasContext) surface() *gg.Context {
+	if bitmap := c.node.CanvasBitmap(); bitmap != c.bitmap {
+		c.bitmap, c.dc = bitmap, gg.NewContextForRGBA(bitmap)
+		c.state, c.stack, c.path = defaultCanvasState(), nil, nil
+	}
+	return c.dc
+}
+
+func (c *canvasContext) Get(key string) goja.Value {
+	vm := c.ctx.vm
+	c.surface()
+
+	switch key {
+	case "canvas":
+		return c.ctx.elementProxy(c.node)
+	case "fillStyle":
+		return vm.ToValue(c.state.fillStyle)
+	case "strokeStyle":
+		return vm.ToValue(c.state.strokeStyle)
+	case "lineWidth":
+		return vm.ToValue(c.state.lineWidth)
+	case "globalAlpha":
+		return vm.ToValue(c.state.globalAlpha)
+	case "font":
+		return vm.ToValue(c.state.font)
+	case "textAlign":
+		return vm.ToValue(c.state.textAlign)
+	case "textBaseline":
+		return vm.ToValue(c.state.textBaseline)
+
+	case "save":
+		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			c.surface().Push()
+			c.stack = append(c.stack, c.state)
+			return goja.Undefined()
+		})
+	case "restore":
+		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			if dc := c.surface(); len(c.stack) > 0 {
+				dc.Pop()
+				c.state, c.stack = c.stack[len(c.stack)-1], c.stack[:len(c.stack)-1]
+			}
+			return goja.Undefined()
+		})
+	case "translate":
+		return c.method(2, func(a []float64) { c.surface().Translate(a[0], a[1]) })
+	case "rotate":
+		return c.method(1, func(a []float64) { c.surface().Rotate(a[0]) })
+	case "scale":
+		return c.method(2, func(a []float64) { c.surface().Scale(a[0], a[1]) })
+	case "resetTransform":
+		return c.method(0, func(a []float64) { c.surface().Identity() })
+
+	case "clearRect":
+		return c.method(4, func(a []float64) {
+			c.clearRect(a[0], a[1], a[2], a[3])
+			c.node.MarkDirty()
+		})
+	case "fillRect":
+		return c.method(4, func(a []float64) {
+			c.fillPath(c.rectPath(a[0], a[1], a[2], a[3]), gg.FillRuleWinding)
+		})
+	case "strokeRect":
+		return c.method(4, func(a []float64) {
+			c.strokePath(c.rectPath(a[0], a[1], a[2], a[3]))
+		})
+
+	case "beginPath":
+		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			c.path = nil
+			return goja.Undefined()
+		})
+	case "closePath":
+		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			c.closePath()
+			return goja.Undefined()
+		})
+	case "moveTo":
+		return c.method(2, func(a []float64) { c.moveTo(a[0], a[1]) })
+	case "lineTo":
+		return c.method(2, func(a []float64) { c.lineTo(a[0], a[1]) })
+	case "rect":
+		return c.method(4, func(a []float64) {
+			c.path = append(c.path, c.rectPath(a[0], a[1], a[2], a[3])...)
+			c.moveTo(a[0], a[1])
+		})
+	case "arc":
+		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			if a, ok := canvasArgs(call, 5); ok {
+				if a[2] < 0 {
+					panic(vm.NewTypeError(fmt.Sprintf("Failed to execute 'arc': The radius provided (%v) is negative", a[2])))
+				}
+				c.arc(a[0], a[1], a[2], a[3], a[4], call.Argument(5).ToBoolean())
+			}
+			return goja.Undefined()
+		})
+	case "fill":
+		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			rule := gg.FillRuleWinding
+			if call.Argument(0).String() == "evenodd" {
+				rule = gg.FillRuleEvenOdd
+			}
+			c.fillPath(c.path, rule)
+			return goja.Undefined()
+		})
+	case "stroke":
+		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			c.strokePath(c.path)
+			return goja.Undefined()
+		})
+
+	case "fillText":
+		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			x, y := call.Argument(1).ToFloat(), call.Argument(2).ToFloat()
+			if len(call.Arguments) >= 3 && isFinite(x) && isFinite(y) {
+				c.fillText(call.Argument(0).String(), x, y)
+			}
+			return goja.Undefined()
+		})
+	case "measureText":
+		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			dc := c.surface()
+			dc.SetFontFace(c.state.face)
+			w, _ := dc.MeasureString(call.Argument(0).String())
+			metrics := vm.NewObject()
+			metrics.Set("width", w)
+			return metrics
+		})
+	case "drawImage":
+		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			c.drawImage(call)
+			return goja.Undefined()
+		})
+	case "getImageData":
+		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			return c.getImageData(call)
+		})
+	}
+	return goja.Undefined()
+}
+
+func (c *canvasContext) Set(key string, val goja.Value) bool {
+	c.surface()
+	switch key {
+	case "fillStyle", "strokeStyle":
+		value := strings.TrimSpace(val.String())
+		col, ok := css.ParseColor(value)
+		if !ok {
+			return true // Invalid values are ignored
+		}
+		if key == "fillStyle" {
+			c.state.fill, c.state.fillStyle = col, canvasColorString(col)
+		} else {
+			c.state.stroke, c.state.strokeStyle = col, canvasColorString(col)
+		}
+	case "lineWidth":
+		if w := val.ToFloat(); isFinite(w) && w > 0 {
+			c.state.lineWidth = w
+		}
+	case "globalAlpha":
+		if a := val.ToFloat(); isFinite(a) && a >= 0 && a <= 1 {
+			c.state.globalAlpha = a
+		}
+	case "font":
+		value := strings.TrimSpace(val.String())
+		style := css.ParseInlineStyle("font: " + value)
+		if _, ok := style.Get("font-size"); ok {
+			c.state.font, c.state.face = value, canvasFontFace(style)
+		}
+	case "textAlign":
+		switch v := val.String(); v {
+		case "start", "end", "left", "right", "center":
+			c.state.textAlign = v
+		}
+	case "textBaseline":
+		switch v := val.String(); v {
+		case "top", "hanging", "middle", "alphabetic", "ideographic", "bottom":
+			c.state.textBaseline = v
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+var canvasContextKeys = []string{
+	"canvas", "fillStyle", "strokeStyle", "lineWidth", "globalAlpha", "font", "textAlign", "textBaseline",
+	"save", "restore", "translate", "rotate", "scale", "resetTransform",
+	"clearRect", "fillRect", "strokeRect",
+	"beginPath", "closePath", "moveTo", "lineTo", "rect", "arc", "fill", "stroke",
+	"fillText", "measureText", "drawImage", "getImageData",
+}
+
+func (c *canvasContext) Has(key string) bool {
+	for _, k := range canvasContextKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *canvasContext) Delete(key string) bool {
+	return false
+}
+
+func (c *canvasContext) Keys() []string {
+	return canvasContextKeys
+}
+
+// method wraps a canvas method taking n numeric arguments. As in browsers,
+// a call with an argument that is not a finite number does nothing.
+func (c *canvasContext) method(n int, f func(args []float64)) goja.Value {
+	return c.ctx.vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		if args, ok := canvasArgs(call, n); ok {
+			f(args)
+		}
+		return goja.Undefined()
+	})
+}
+
+// canvasArgs converts the first n arguments of call to numbers, returning
+// false if there are fewer or any is not finite.
+func canvasArgs(call goja.FunctionCall, n int) ([]float64, bool) {
+	if len(call.Arguments) < n {
+		return nil, false
+	}
+	args := make([]float64, n)
+	for i := range args {
+		if args[i] = call.Arguments[i].ToFloat(); !isFinite(args[i]) {
+			return nil, false
+		}
+	}
+	return args, true
+}
+
+func isFinite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+// canvasColorString serializes a color as canvas styles read back: #rrggbb
+// when opaque, rgba() otherwise.
+func canvasColorString(c css.Color) string {
+	if c.A >= 1 {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	return fmt.Sprintf("rgba(%d, %d, %d, %g)", c.R, c.G, c.B, c.A)
+}
+
+// canvasFontFace returns the face for the font properties of style: the
+// matching installed font, else gg's built-in face. Web fonts belong to
+// the layout engine, which loads them after scripts run, so canvas text
+// doesn't use them.
+func canvasFontFace(style *css.Style) font.Face {
+	size := style.GetFontSize()
+	families := style.GetFontFamilies()
+	bold := style.GetFontWeight() == css.FontWeightBold
+	italic := style.GetFontStyle() == css.FontStyleItalic
+	if face := text.FileFontFace(text.DefaultRegistry().Resolve(families).Path(bold, italic), size); face != nil {
+		return face
+	}
+	return basicfont.Face7x13
+}
+
+// paint returns the color c is drawn in under the global alpha.
+func (c *canvasContext) paint(col css.Color) color.NRGBA {
+	return color.NRGBA{R: col.R, G: col.G, B: col.B, A: uint8(math.Round(col.A * c.state.globalAlpha * 255))}
+}
+
+// point transforms a point by the current transform into bitmap
+// coordinates.
+func (c *canvasContext) point(x, y float64) gg.Point {
+	tx, ty := c.surface().TransformPoint(x, y)
+	return gg.Point{X: tx, Y: ty}
+}
+
+func (c *canvasContext) moveTo(x, y float64) {
+	c.path = append(c.path, canvasSubpath{points: []gg.Point{c.point(x, y)}})
+}
+
+func (c *canvasContext) lineTo(x, y float64) {
+	if len(c.path) == 0 {
+		c.moveTo(x, y)
+		return
+	}
+	last := &c.path[len(c.path)-1]
+	last.points = append(last.points, c.point(x, y))
+}
+
+// closePath closes the last subpath and starts a new one at its start.
+func (c *canvasContext) closePath() {
+	if len(c.path) == 0 {
+		return
+	}
+	last := &c.path[len(c.path)-1]
+	last.closed = true
+	c.path = append(c.path, canvasSubpath{points: []gg.Point{last.points[0]}})
+}
+
+// rectPath returns a closed subpath around a rectangle.
+func (c *canvasContext) rectPath(x, y, w, h float64) []canvasSubpath {
+	return []canvasSubpath{{
+		points: []gg.Point{c.point(x, y), c.point(x+w, y), c.point(x+w, y+h), c.point(x, y+h)},
+		closed: true,
+	}}
+}
+
+// arc adds a circular arc to the path, joined to the current point by a
+// straight line, flattened into segments before it is transformed.
+func (c *canvasContext) arc(x, y, r, start, end float64, anticlockwise bool) {
+	sweep := end - start
+	switch {
+	case !anticlockwise && sweep >= 2*math.Pi:
+		sweep = 2 * math.Pi
+	case anticlockwise && sweep <= -2*math.Pi:
+		sweep = -2 * math.Pi
+	case !anticlockwise:
+		if sweep = math.Mod(sweep, 2*math.Pi); sweep < 0 {
+			sweep += 2 * math.Pi
+		}
+	default:
+		if sweep = math.Mod(sweep, 2*math.Pi); sweep > 0 {
+			sweep -= 2 * math.Pi
+		}
+	}
+	n := int(math.Ceil(math.Abs(sweep) / (2 * math.Pi) * max(16, r)))
+	for i := 0; i <= n; i++ {
+		a := start + sweep*float64(i)/float64(max(n, 1))
+		c.lineTo(x+r*math.Cos(a), y+r*math.Sin(a))
+	}
+}
+
+// tracePath replaces gg's path with path. The caller draws it with the
+// identity transform, since its points are in bitmap coordinates.
+func (c *canvasContext) tracePath(dc *gg.Context, path []canvasSubpath) {
+	dc.ClearPath()
+	for _, sp := range path {
+		for i, p := range sp.points {
+			if i == 0 {
+				dc.MoveTo(p.X, p.Y)
+			} else {
+				dc.LineTo(p.X, p.Y)
+			}
+		}
+		if sp.closed {
+			dc.ClosePath()
+		}
+	}
+}
+
+func (c *canvasContext) fillPath(path []canvasSubpath, rule gg.FillRule) {
+	dc := c.surface()
+	dc.Push()
+	defer dc.Pop()
+	dc.Identity()
+	c.tracePath(dc, path)
+	dc.SetFillRule(rule)
+	dc.SetFillStyle(gg.NewSolidPattern(c.paint(c.state.fill)))
+	dc.Fill()
+	c.node.MarkDirty()
+}
+
+// strokePath strokes path with the line width scaled by the current
+// transform.
+func (c *canvasContext) strokePath(path []canvasSubpath) {
+	dc := c.surface()
+	o, u, v := c.point(0, 0), c.point(1, 0), c.point(0, 1)
+	scale := math.Sqrt(math.Abs((u.X-o.X)*(v.Y-o.Y) - (u.Y-o.Y)*(v.X-o.X)))
+	dc.Push()
+	defer dc.Pop()
+	dc.Identity()
+	c.tracePath(dc, path)
+	dc.SetLineWidth(c.state.lineWidth * scale)
+	dc.SetStrokeStyle(gg.NewSolidPattern(c.paint(c.state.stroke)))
+	dc.Stroke()
+	c.node.MarkDirty()
+}
+
+// clearRect makes the pixels under a rectangle transparent. Under a
+// rotation it clears the rectangle's bounding box.
+func (c *canvasContext) clearRect(x, y, w, h float64) {
+	corners := c.rectPath(x, y, w, h)[0].points
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, p := range corners {
+		minX, minY = min(minX, p.X), min(minY, p.Y)
+		maxX, maxY = max(maxX, p.X), max(maxY, p.Y)
+	}
+	r := image.Rect(int(math.Round(minX)), int(math.Round(minY)), int(math.Round(maxX)), int(math.Round(maxY)))
+	draw.Draw(c.bitmap, r, image.Transparent, image.Point{}, draw.Src)
+}
+
+func (c *canvasContext) fillText(s string, x, y float64) {
+	dc := c.surface()
+	dc.SetFontFace(c.state.face)
+	dc.SetColor(c.paint(c.state.fill))
+
+	var align float64
+	switch c.state.textAlign {
+	case "center":
+		align = 0.5
+	case "end", "right":
+		align = 1
+	}
+	metrics := c.state.face.Metrics()
+	ascent, descent := float64(metrics.Ascent)/64, float64(metrics.Descent)/64
+	switch c.state.textBaseline {
+	case "top", "hanging":
+		y += ascent
+	case "middle":
+		y += (ascent - descent) / 2
+	case "bottom", "ideographic":
+		y -= descent
+	}
+	dc.DrawStringAnchored(s, x, y, align, 0)
+	c.node.MarkDirty()
+}
+
+// drawImage draws an <img> or <canvas> element, in any of the forms
+// drawImage(image, dx, dy), drawImage(image, dx, dy, dw, dh), and
+// drawImage(image, sx, sy, sw, sh, dx, dy, dw, dh). Images that fail to
+// load draw nothing.
+func (c *canvasContext) drawImage(call goja.FunctionCall) {
+	node := c.ctx.unwrapNode(call.Argument(0))
+	if node == nil {
+		panic(c.ctx.vm.NewTypeError("Failed to execute 'drawImage': parameter 1 is not an image"))
+	}
+	var img image.Image
+	switch node.TagName {
+	case "canvas":
+		img = node.CanvasBitmap()
+	case "img":
+		src, _ := node.GetAttribute("src")
+		img = c.ctx.loadImage(src)
+	default:
+		panic(c.ctx.vm.NewTypeError("Failed to execute 'drawImage': parameter 1 is not an image"))
+	}
+	if img == nil {
+		return
+	}
+
+	b := img.Bounds()
+	sx, sy, sw, sh := 0.0, 0.0, float64(b.Dx()), float64(b.Dy())
+	var dx, dy, dw, dh float64
+	switch n := len(call.Arguments) - 1; {
+	case n >= 8:
+		a, ok := canvasArgs(goja.FunctionCall{Arguments: call.Arguments[1:]}, 8)
+		if !ok {
+			return
+		}
+		sx, sy, sw, sh, dx, dy, dw, dh = a[0], a[1], a[2], a[3], a[4], a[5], a[6], a[7]
+	case n >= 4:
+		a, ok := canvasArgs(goja.FunctionCall{Arguments: call.Arguments[1:]}, 4)
+		if !ok {
+			return
+		}
+		dx, dy, dw, dh = a[0], a[1], a[2], a[3]
+	case n >= 2:
+		a, ok := canvasArgs(goja.FunctionCall{Arguments: call.Arguments[1:]}, 2)
+		if !ok {
+			return
+		}
+		dx, dy, dw, dh = a[0], a[1], sw, sh
+	default:
+		panic(c.ctx.vm.NewTypeError("Failed to execute 'drawImage': 3 arguments required"))
+	}
+	if sw == 0 || sh == 0 || dw == 0 || dh == 0 {
+		return
+	}
+
+	dc := c.surface()
+	if rgba, ok := img.(*image.RGBA); ok && rgba == c.bitmap {
+		// Drawing a canvas onto itself reads a copy
+		img = image.NewRGBA(rgba.Rect)
+		draw.Draw(img.(*image.RGBA), rgba.Rect, rgba, image.Point{}, draw.Src)
+	}
+	src := image.Rect(int(sx), int(sy), int(math.Ceil(sx+sw)), int(math.Ceil(sy+sh))).Intersect(b)
+	sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	})
+	if !ok || src.Empty() {
+		return
+	}
+	dc.Push()
+	defer dc.Pop()
+	dc.Translate(dx, dy)
+	dc.Scale(dw/sw, dh/sh)
+	dc.Translate(-sx, -sy)
+	dc.DrawImage(sub.SubImage(src), 0, 0)
+	c.node.MarkDirty()
+}
+
+// getImageData returns the pixels of a rectangle of the bitmap, ignoring
+// the transform, as an ImageData of unpremultiplied RGBA bytes. Pixels
+// outside the bitmap are transparent black.
+func (c *canvasContext) getImageData(call goja.FunctionCall) goja.Value {
+	vm := c.ctx.vm
+	a, ok := canvasArgs(call, 4)
+	if !ok {
+		panic(vm.NewTypeError("Failed to execute 'getImageData': 4 finite numbers required"))
+	}
+	if math.Abs(a[2])*math.Abs(a[3]) > html.MaxCanvasArea {
+		rangeError, _ := vm.New(vm.Get("RangeError"), vm.ToValue("Failed to execute 'getImageData': Out of memory at ImageData creation"))
+		panic(rangeError)
+	}
+	sx, sy, sw, sh := int(a[0]), int(a[1]), int(a[2]), int(a[3])
+	if sw == 0 || sh == 0 {
+		panic(vm.NewTypeError("Failed to execute 'getImageData': The source width and height must not be 0"))
+	}
+	if sw < 0 {
+		sx, sw = sx+sw, -sw
+	}
+	if sh < 0 {
+		sy, sh = sy+sh, -sh
+	}
+
+	bitmap := c.surface().Image()
+	data := make([]byte, 0, sw*sh*4)
+	for y := sy; y < sy+sh; y++ {
+		for x := sx; x < sx+sw; x++ {
+			p := color.NRGBAModel.Convert(bitmap.At(x, y)).(color.NRGBA)
+			data = append(data, p.R, p.G, p.B, p.A)
+		}
+	}
+	array, err := vm.New(vm.Get("Uint8ClampedArray"), vm.ToValue(vm.NewArrayBuffer(data)))
+	if err != nil {
+		panic(err)
+	}
+	imageData := vm.NewObject()
+	imageData.Set("width", sw)
+	imageData.Set("height", sh)
+	imageData.Set("data", array)
+	return imageData
+}
+
+// loadImage loads an image by URL through the engine's fetcher, resolved
+// against the document URL, sharing the decoded image cache with layout.
+// It returns nil if the image can't be loaded.
+func (ctx *domContext) loadImage(src string) image.Image {
+	n := ctx.network
+	if n == nil {
+		n = &network{}
+	}
+	fetcher := n.fetcher
+	if fetcher == nil {
+		fetcher = networkFetcher
+	}
+	uri := strings.TrimSpace(src)
+	if uri == "" {
+		return nil
+	}
+	if !images.IsDataURI(uri) {
+		resolved, err := n.resolve(uri)
+		if err != nil {
+			return nil
+		}
+		uri = resolved
+	}
+	img, err := images.LoadImageWithFetcher(n.requestContext(), uri, func(ctx context.Context, uri string) ([]byte, error) {
+		body, _, err := fetcher.Fetch(ctx, uri)
+		return body, err
+	})
+	if err != nil {
+		return nil
+	}
+	return img
+}
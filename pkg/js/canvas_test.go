@@ -0,0 +1,168 @@
+package js
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestCanvasFillRectAndGetImageData(t *testing.T) {
+	doc := parseHTML(t, `<canvas id="c" width="20" height="10"></canvas>`)
+	engine := New()
+	doc.Scripts = append(doc.Scripts, `
+		var canvas = document.getElementById("c");
+		var ctx = canvas.getContext("2d");
+		if (canvas.getContext("2d") !== ctx) throw new Error("expected the same context");
+		if (canvas.getContext("webgl") !== null) throw new Error("expected no webgl context");
+		if (ctx.canvas !== canvas) throw new Error("expected ctx.canvas to be the canvas");
+		if (canvas.width !== 20 || canvas.height !== 10) throw new Error("wrong size: " + canvas.width + "x" + canvas.height);
+
+		ctx.fillStyle = "rgb(255, 0, 0)";
+		ctx.fillRect(0, 0, 10, 10);
+		var image = ctx.getImageData(5, 5, 2, 1);
+		if (image.width !== 2 || image.height !== 1) throw new Error("wrong image size");
+		var px = Array.prototype.slice.call(image.data).join(",");
+		if (px !== "255,0,0,255,255,0,0,255") throw new Error("filled pixels: " + px);
+		px = Array.prototype.slice.call(ctx.getImageData(15, 5, 1, 1).data).join(",");
+		if (px !== "0,0,0,0") throw new Error("unfilled pixel: " + px);
+
+		ctx.clearRect(0, 0, 5, 10);
+		px = Array.prototype.slice.call(ctx.getImageData(2, 2, 1, 1).data).join(",");
+		if (px !== "0,0,0,0") throw new Error("cleared pixel: " + px);
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	canvas := getElementById(doc.Root, "c")
+	if got := canvas.CanvasBitmap().RGBAAt(7, 5); got != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("expected the bitmap to be drawn into, got %v", got)
+	}
+	if !canvas.IsDirty() {
+		t.Error("expected drawing to mark the canvas dirty")
+	}
+}
+
+func TestCanvasPathsAndTransforms(t *testing.T) {
+	doc := parseHTML(t, `<canvas id="c" width="40" height="40"></canvas>`)
+	engine := New()
+	doc.Scripts = append(doc.Scripts, `
+		var ctx = document.getElementById("c").getContext("2d");
+		ctx.fillStyle = "#00f";
+		ctx.beginPath();
+		ctx.arc(10, 10, 5, 0, 2 * Math.PI);
+		ctx.fill();
+
+		ctx.save();
+		ctx.translate(20, 20);
+		ctx.scale(2, 2);
+		ctx.fillStyle = "lime";
+		ctx.fillRect(0, 0, 5, 5);
+		ctx.restore();
+		if (ctx.fillStyle !== "#0000ff") throw new Error("restore: " + ctx.fillStyle);
+
+		ctx.strokeStyle = "black";
+		ctx.lineWidth = 2;
+		ctx.beginPath();
+		ctx.moveTo(0, 35);
+		ctx.lineTo(15, 35);
+		ctx.stroke();
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	bitmap := getElementById(doc.Root, "c").CanvasBitmap()
+	tests := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{10, 10, color.RGBA{0, 0, 255, 255}}, // Inside the circle
+		{2, 2, color.RGBA{}},                 // Outside it
+		{29, 29, color.RGBA{0, 255, 0, 255}}, // Inside the scaled square
+		{31, 31, color.RGBA{}},               // Outside it
+		{7, 35, color.RGBA{0, 0, 0, 255}},    // On the line
+	}
+	for _, tt := range tests {
+		if got := bitmap.RGBAAt(tt.x, tt.y); got != tt.want {
+			t.Errorf("pixel (%d, %d) = %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestCanvasStyles(t *testing.T) {
+	doc := parseHTML(t, `<canvas id="c"></canvas>`)
+	engine := New()
+	doc.Scripts = append(doc.Scripts, `
+		var canvas = document.getElementById("c");
+		if (canvas.width !== 300 || canvas.height !== 150) throw new Error("default size: " + canvas.width + "x" + canvas.height);
+		var ctx = canvas.getContext("2d");
+		if (ctx.fillStyle !== "#000000") throw new Error("default fillStyle: " + ctx.fillStyle);
+		ctx.fillStyle = "rgba(0, 128, 0, 0.5)";
+		if (ctx.fillStyle !== "rgba(0, 128, 0, 0.5)") throw new Error("fillStyle: " + ctx.fillStyle);
+		ctx.fillStyle = "not a color";
+		if (ctx.fillStyle !== "rgba(0, 128, 0, 0.5)") throw new Error("invalid fillStyle was applied: " + ctx.fillStyle);
+		ctx.lineWidth = -1;
+		if (ctx.lineWidth !== 1) throw new Error("invalid lineWidth was applied: " + ctx.lineWidth);
+		ctx.font = "bold 20px serif";
+		if (ctx.font !== "bold 20px serif") throw new Error("font: " + ctx.font);
+		if (!(ctx.measureText("hello").width > 0)) throw new Error("expected text to have a width");
+
+		// Resizing clears the canvas and resets the context
+		ctx.fillRect(0, 0, 10, 10);
+		canvas.width = 50;
+		if (canvas.width !== 50) throw new Error("width: " + canvas.width);
+		if (ctx.fillStyle !== "#000000") throw new Error("expected resizing to reset the state");
+		var px = Array.prototype.slice.call(ctx.getImageData(5, 5, 1, 1).data).join(",");
+		if (px !== "0,0,0,0") throw new Error("expected resizing to clear the canvas: " + px);
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCanvasDrawImage(t *testing.T) {
+	doc := parseHTML(t, `<canvas id="src" width="4" height="4"></canvas><canvas id="dst" width="20" height="20"></canvas>`)
+	engine := New()
+	doc.Scripts = append(doc.Scripts, `
+		var src = document.getElementById("src");
+		var sctx = src.getContext("2d");
+		sctx.fillStyle = "red";
+		sctx.fillRect(0, 0, 4, 4);
+		var ctx = document.getElementById("dst").getContext("2d");
+		ctx.drawImage(src, 0, 0);
+		ctx.drawImage(src, 10, 10, 8, 8);
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	bitmap := getElementById(doc.Root, "dst").CanvasBitmap()
+	red := color.RGBA{255, 0, 0, 255}
+	if got := bitmap.RGBAAt(1, 1); got != red {
+		t.Errorf("expected the canvas to be drawn at its size, got %v", got)
+	}
+	if got := bitmap.RGBAAt(15, 15); got != red {
+		t.Errorf("expected the canvas to be drawn scaled, got %v", got)
+	}
+	if got := bitmap.RGBAAt(6, 6); got != (color.RGBA{}) {
+		t.Errorf("expected nothing drawn between the images, got %v", got)
+	}
+}
+
+func TestCanvasSizeLimits(t *testing.T) {
+	doc := parseHTML(t, `<canvas id="huge" width="2000000000" height="2000000000"></canvas><canvas id="c" width="10" height="10"></canvas>`)
+	engine := New()
+	doc.Scripts = append(doc.Scripts, `
+		var huge = document.getElementById("huge").getContext("2d");
+		huge.fillRect(0, 0, 10, 10);
+		if (huge.getImageData(0, 0, 1, 1).data.join(",") !== "0,0,0,0") throw new Error("expected an empty bitmap");
+
+		var ctx = document.getElementById("c").getContext("2d");
+		var threw = null;
+		try { ctx.getImageData(0, 0, 100000, 100000); } catch (e) { threw = e; }
+		if (!(threw instanceof RangeError)) throw new Error("expected a RangeError, got " + threw);
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	if b := getElementById(doc.Root, "huge").CanvasBitmap().Bounds(); !b.Empty() {
+		t.Errorf("expected no bitmap for a canvas over the size limit, got %v", b)
+	}
+}
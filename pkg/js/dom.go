@@ -1,8 +1,10 @@
 package js
 
 import (
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
 
 	"louis14/pkg/html"
@@ -13,17 +15,44 @@ import (
 // domContext holds shared state for DOM bindings within a single execution.
 // It maintains a node-to-proxy cache so the same JS object is returned for
 // the same underlying *html.Node (needed for === identity checks).
+//
+// It also holds the document's event state: listeners, on<type> handlers
+// assigned to elements, and pending timers.
 type domContext struct {
-	vm    *goja.Runtime
-	doc   *html.Document
-	cache map[*html.Node]goja.Value
+	vm       *goja.Runtime
+	doc      *html.Document
+	cache    map[*html.Node]goja.Value
+	document *goja.Object // The document global, as an event target
+	window   *goja.Object // The global object, as an event target
+
+	listeners map[any][]*listener // Keyed by *html.Node or the document/window object
+	handlers  map[handlerKey]goja.Value
+	events    map[*goja.Object]*event // Events created with new Event(...)
+	errs      []error                 // Exceptions thrown by listeners and timers
+
+	timers      []*timer                  // Pending timers, ordered by due time
+	frames      []frameCallback           // Pending requestAnimationFrame callbacks
+	contexts    map[*html.Node]goja.Value // 2D contexts of canvases, by canvas
+	clock       time.Duration             // Virtual time
+	nextTimerID int
+	timerSeq    int
+
+	network     *network    // Request configuration from the engine; nil = defaults
+	navigation  *Navigation // Requested by a script and not yet taken by the embedder
+	completions chan func() // Callbacks of finished async requests
+	inFlight    int         // Async requests not yet completed
 }
 
 func newDOMContext(vm *goja.Runtime, doc *html.Document) *domContext {
 	return &domContext{
-		vm:    vm,
-		doc:   doc,
-		cache: make(map[*html.Node]goja.Value),
+		vm:        vm,
+		doc:       doc,
+		cache:     make(map[*html.Node]goja.Value),
+		listeners: make(map[any][]*listener),
+		handlers:  make(map[handlerKey]goja.Value),
+		events:    make(map[*goja.Object]*event),
+
+		completions: make(chan func(), 16),
 	}
 }
 
@@ -74,6 +103,9 @@ func registerDocument(vm *goja.Runtime, doc *html.Document) *domContext {
 		}
 		return ctx.elementProxy(node)
 	})
+	docObj.Set("createDocumentFragment", func(call goja.FunctionCall) goja.Value {
+		return ctx.elementProxy(&html.Node{Type: html.DocumentFragmentNode})
+	})
 	docObj.Set("createTextNode", func(call goja.FunctionCall) goja.Value {
 		text := ""
 		if len(call.Arguments) > 0 {
@@ -92,7 +124,17 @@ func registerDocument(vm *goja.Runtime, doc *html.Document) *domContext {
 	// Phase 4: document.body, document.head, document.documentElement
 	registerDocumentProperties(ctx, docObj, doc)
 
+	// Events and timers
+	ctx.document = docObj
+	ctx.window = vm.GlobalObject()
+	registerEventTarget(ctx, docObj)
+	registerEventTarget(ctx, ctx.window)
+	registerEventConstructors(ctx)
+	registerTimers(ctx)
+	registerFetch(ctx)
+
 	vm.Set("document", docObj)
+	vm.Set("window", ctx.window)
 	return ctx
 }
 
@@ -192,13 +234,19 @@ func (e *elementAccessor) Get(key string) goja.Value {
 		// Internal: used by unwrapNode as a fallback identifier
 		return vm.ToValue(true)
 	case "nodeType":
-		if e.node.Type == html.TextNode {
+		switch e.node.Type {
+		case html.TextNode:
 			return vm.ToValue(3) // Node.TEXT_NODE
+		case html.DocumentFragmentNode:
+			return vm.ToValue(11) // Node.DOCUMENT_FRAGMENT_NODE
 		}
 		return vm.ToValue(1) // Node.ELEMENT_NODE
 	case "nodeName":
-		if e.node.Type == html.TextNode {
+		switch e.node.Type {
+		case html.TextNode:
 			return vm.ToValue("#text")
+		case html.DocumentFragmentNode:
+			return vm.ToValue("#document-fragment")
 		}
 		return vm.ToValue(strings.ToUpper(e.node.TagName))
 	case "nodeValue":
@@ -207,7 +255,7 @@ func (e *elementAccessor) Get(key string) goja.Value {
 		}
 		return goja.Null()
 	case "tagName":
-		if e.node.Type == html.TextNode {
+		if e.node.Type != html.ElementNode {
 			return goja.Undefined()
 		}
 		return vm.ToValue(strings.ToUpper(e.node.TagName))
@@ -217,8 +265,58 @@ func (e *elementAccessor) Get(key string) goja.Value {
 	case "className":
 		cls, _ := e.node.GetAttribute("class")
 		return vm.ToValue(cls)
-	case "textContent":
+	case "textContent", "innerText":
 		return vm.ToValue(getTextContent(e.node))
+	case "hidden":
+		_, hidden := e.node.GetAttribute("hidden")
+		return vm.ToValue(hidden)
+	case "dataset":
+		return vm.NewDynamicObject(&datasetAccessor{vm: vm, node: e.node})
+	case "toggleAttribute":
+		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			if len(call.Arguments) == 0 {
+				panic(vm.NewTypeError("Failed to execute 'toggleAttribute': 1 argument required"))
+			}
+			name := strings.ToLower(call.Arguments[0].String())
+			_, present := e.node.GetAttribute(name)
+			on := !present
+			if len(call.Arguments) > 1 {
+				on = call.Arguments[1].ToBoolean()
+			}
+			if on && !present {
+				e.node.SetAttribute(name, "")
+			} else if !on && present {
+				e.node.RemoveAttribute(name)
+			}
+			return vm.ToValue(on)
+		})
+	case "insertAdjacentHTML":
+		return vm.ToValue(e.insertAdjacentHTMLFn())
+	case "value":
+		switch e.node.TagName {
+		case "input", "textarea", "select", "option", "button":
+			return vm.ToValue(e.node.Value())
+		}
+		return goja.Undefined()
+	case "width", "height":
+		if e.node.TagName == "canvas" {
+			w, h := e.node.CanvasSize()
+			if key == "width" {
+				return vm.ToValue(w)
+			}
+			return vm.ToValue(h)
+		}
+		return goja.Undefined()
+	case "getContext":
+		if e.node.TagName != "canvas" {
+			return goja.Undefined()
+		}
+		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			if call.Argument(0).String() != "2d" {
+				return goja.Null()
+			}
+			return e.ctx.canvasContext(e.node)
+		})
 	case "getAttribute":
 		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
 			if len(call.Arguments) == 0 {
@@ -238,10 +336,7 @@ func (e *elementAccessor) Get(key string) goja.Value {
 			}
 			name := call.Arguments[0].String()
 			val := call.Arguments[1].String()
-			if e.node.Attributes == nil {
-				e.node.Attributes = make(map[string]string)
-			}
-			e.node.Attributes[name] = val
+			e.node.SetAttribute(name, val)
 			return goja.Undefined()
 		})
 	case "hasAttribute":
@@ -259,9 +354,7 @@ func (e *elementAccessor) Get(key string) goja.Value {
 				return goja.Undefined()
 			}
 			name := call.Arguments[0].String()
-			if e.node.Attributes != nil {
-				delete(e.node.Attributes, name)
-			}
+			e.node.RemoveAttribute(name)
 			return goja.Undefined()
 		})
 	case "children":
@@ -299,6 +392,12 @@ func (e *elementAccessor) Get(key string) goja.Value {
 		return vm.ToValue(e.removeChildFn())
 	case "insertBefore":
 		return vm.ToValue(e.insertBeforeFn())
+	case "content":
+		// A template's contents, parsed into a fragment outside the tree
+		if e.node.Content == nil {
+			return goja.Undefined()
+		}
+		return e.ctx.elementProxy(e.node.Content)
 	case "innerHTML":
 		return vm.ToValue(e.node.Serialize())
 	case "outerHTML":
@@ -391,6 +490,19 @@ func (e *elementAccessor) Get(key string) goja.Value {
 			return vm.ToValue(len(e.node.Children) > 0)
 		})
 
+	// Events
+	case "addEventListener":
+		return vm.ToValue(e.ctx.addEventListenerFn(e.node))
+	case "removeEventListener":
+		return vm.ToValue(e.ctx.removeEventListenerFn(e.node))
+	case "dispatchEvent":
+		return vm.ToValue(e.ctx.dispatchEventFn(e.node))
+	case "click":
+		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			e.ctx.dispatch(e.node, e.ctx.newEvent("click", true, true, false))
+			return goja.Undefined()
+		})
+
 	case "getElementsByTagName":
 		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
 			if len(call.Arguments) == 0 {
@@ -417,32 +529,60 @@ func (e *elementAccessor) Get(key string) goja.Value {
 			return e.ctx.elementArray(result)
 		})
 	}
+	if isEventHandlerProperty(key) {
+		if h, ok := e.ctx.handlers[handlerKey{e.node, key[2:]}]; ok {
+			return h
+		}
+		return goja.Null()
+	}
 	return goja.Undefined()
 }
 
 func (e *elementAccessor) Set(key string, val goja.Value) bool {
 	switch key {
-	case "textContent":
+	case "textContent", "innerText":
 		setTextContent(e.node, val.String())
 		return true
+	case "hidden":
+		if val.ToBoolean() {
+			e.node.SetAttribute("hidden", "")
+		} else {
+			e.node.RemoveAttribute("hidden")
+		}
+		return true
 	case "className":
-		if e.node.Attributes == nil {
-			e.node.Attributes = make(map[string]string)
+		e.node.SetAttribute("class", val.String())
+		return true
+	case "value":
+		e.node.SetValue(val.String())
+		return true
+	case "width", "height":
+		if e.node.TagName != "canvas" {
+			return false
 		}
-		e.node.Attributes["class"] = val.String()
+		e.node.SetAttribute(key, strconv.FormatInt(val.ToInteger(), 10))
 		return true
 	case "id":
-		if e.node.Attributes == nil {
-			e.node.Attributes = make(map[string]string)
-		}
-		e.node.Attributes["id"] = val.String()
+		e.node.SetAttribute("id", val.String())
 		return true
 	case "innerHTML":
 		e.setInnerHTML(val.String())
 		return true
+	case "outerHTML":
+		e.setOuterHTML(val.String())
+		return true
 	case "nodeValue":
 		if e.node.Type == html.TextNode {
 			e.node.Text = val.String()
+			e.node.MarkDirty()
+		}
+		return true
+	}
+	if isEventHandlerProperty(key) {
+		if _, ok := goja.AssertFunction(val); ok {
+			e.ctx.handlers[handlerKey{e.node, key[2:]}] = val
+		} else {
+			delete(e.ctx.handlers, handlerKey{e.node, key[2:]})
 		}
 		return true
 	}
@@ -452,8 +592,9 @@ func (e *elementAccessor) Set(key string, val goja.Value) bool {
 func (e *elementAccessor) Has(key string) bool {
 	switch key {
 	case "tagName", "nodeName", "nodeType", "nodeValue", "id", "className",
-		"textContent", "innerHTML", "outerHTML",
-		"getAttribute", "setAttribute", "hasAttribute", "removeAttribute",
+		"textContent", "innerText", "value", "hidden", "dataset", "innerHTML", "outerHTML",
+		"content", "getAttribute", "setAttribute", "hasAttribute", "removeAttribute", "toggleAttribute",
+		"insertAdjacentHTML", "width", "height", "getContext",
 		"children", "childNodes", "parentElement", "parentNode", "style",
 		"appendChild", "removeChild", "insertBefore",
 		"firstChild", "lastChild", "firstElementChild", "lastElementChild",
@@ -463,10 +604,11 @@ func (e *elementAccessor) Has(key string) bool {
 		"classList",
 		"remove", "append", "prepend", "before", "after", "replaceWith", "replaceChildren",
 		"cloneNode", "contains", "hasChildNodes",
+		"addEventListener", "removeEventListener", "dispatchEvent", "click",
 		"getElementsByTagName", "getElementsByClassName":
 		return true
 	}
-	return false
+	return isEventHandlerProperty(key)
 }
 
 func (e *elementAccessor) Delete(key string) bool {
@@ -476,8 +618,9 @@ func (e *elementAccessor) Delete(key string) bool {
 func (e *elementAccessor) Keys() []string {
 	return []string{
 		"tagName", "nodeName", "nodeType", "nodeValue", "id", "className",
-		"textContent", "innerHTML", "outerHTML",
-		"getAttribute", "setAttribute", "hasAttribute", "removeAttribute",
+		"textContent", "innerText", "value", "hidden", "dataset", "innerHTML", "outerHTML",
+		"content", "getAttribute", "setAttribute", "hasAttribute", "removeAttribute", "toggleAttribute",
+		"insertAdjacentHTML", "width", "height", "getContext",
 		"children", "childNodes", "parentElement", "parentNode", "style",
 		"appendChild", "removeChild", "insertBefore",
 		"firstChild", "lastChild", "firstElementChild", "lastElementChild",
@@ -487,6 +630,7 @@ func (e *elementAccessor) Keys() []string {
 		"classList",
 		"remove", "append", "prepend", "before", "after", "replaceWith", "replaceChildren",
 		"cloneNode", "contains", "hasChildNodes",
+		"addEventListener", "removeEventListener", "dispatchEvent", "click",
 		"getElementsByTagName", "getElementsByClassName",
 	}
 }
@@ -506,6 +650,7 @@ func getTextContent(node *html.Node) string {
 // setTextContent replaces all children with a single text node.
 func setTextContent(node *html.Node, text string) {
 	node.Children = nil
+	node.MarkDirty()
 	if text != "" {
 		node.AppendText(text)
 	}
@@ -568,10 +713,47 @@ func (s *styleAccessor) getStyleAttr() string {
 }
 
 func (s *styleAccessor) setStyleAttr(val string) {
-	if s.node.Attributes == nil {
-		s.node.Attributes = make(map[string]string)
+	s.node.SetAttribute("style", val)
+}
+
+// datasetAccessor implements element.dataset, mapping camelCase keys to
+// data-* attributes (HTML §3.2.6.6).
+type datasetAccessor struct {
+	vm   *goja.Runtime
+	node *html.Node
+}
+
+func (d *datasetAccessor) Get(key string) goja.Value {
+	if val, ok := d.node.GetAttribute("data-" + camelToKebab(key)); ok {
+		return d.vm.ToValue(val)
+	}
+	return goja.Undefined()
+}
+
+func (d *datasetAccessor) Set(key string, val goja.Value) bool {
+	d.node.SetAttribute("data-"+camelToKebab(key), val.String())
+	return true
+}
+
+func (d *datasetAccessor) Has(key string) bool {
+	_, ok := d.node.GetAttribute("data-" + camelToKebab(key))
+	return ok
+}
+
+func (d *datasetAccessor) Delete(key string) bool {
+	d.node.RemoveAttribute("data-" + camelToKebab(key))
+	return true
+}
+
+func (d *datasetAccessor) Keys() []string {
+	var keys []string
+	for name := range d.node.Attributes {
+		if rest, ok := strings.CutPrefix(name, "data-"); ok {
+			keys = append(keys, kebabToCamel(rest))
+		}
 	}
-	s.node.Attributes["style"] = val
+	sort.Strings(keys)
+	return keys
 }
 
 // parseInlineStyle parses a CSS inline style string into a map.
@@ -628,6 +810,24 @@ func camelToKebab(s string) string {
 	return sb.String()
 }
 
+// kebabToCamel converts a data-* attribute suffix to its dataset key.
+func kebabToCamel(s string) string {
+	var sb strings.Builder
+	upper := false
+	for _, r := range s {
+		if r == '-' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
 // newElementProxy is a convenience for callers that don't have a domContext.
 // Deprecated: use ctx.elementProxy instead within JS bindings.
 func newElementProxy(vm *goja.Runtime, node *html.Node) goja.Value {
@@ -29,10 +29,7 @@ func (cl *classListAccessor) classes() []string {
 }
 
 func (cl *classListAccessor) setClasses(classes []string) {
-	if cl.node.Attributes == nil {
-		cl.node.Attributes = make(map[string]string)
-	}
-	cl.node.Attributes["class"] = strings.Join(classes, " ")
+	cl.node.SetAttribute("class", strings.Join(classes, " "))
 }
 
 func (cl *classListAccessor) Get(key string) goja.Value {
@@ -153,10 +150,7 @@ func (cl *classListAccessor) Get(key string) goja.Value {
 
 func (cl *classListAccessor) Set(key string, val goja.Value) bool {
 	if key == "value" {
-		if cl.node.Attributes == nil {
-			cl.node.Attributes = make(map[string]string)
-		}
-		cl.node.Attributes["class"] = val.String()
+		cl.node.SetAttribute("class", val.String())
 		return true
 	}
 	return false
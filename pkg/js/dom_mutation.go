@@ -1,6 +1,8 @@
 package js
 
 import (
+	"strings"
+
 	"louis14/pkg/html"
 
 	"github.com/dop251/goja"
@@ -16,11 +18,9 @@ func (e *elementAccessor) appendChildFn() func(call goja.FunctionCall) goja.Valu
 		if child == nil {
 			panic(e.ctx.vm.NewTypeError("Failed to execute 'appendChild': parameter is not a Node"))
 		}
-		// Remove from old parent if already in tree
-		if child.Parent != nil {
-			child.Parent.RemoveChild(child)
+		for _, n := range detachForInsert(child) {
+			e.node.AddChild(n)
 		}
-		e.node.AddChild(child)
 		return e.ctx.elementProxy(child)
 	}
 }
@@ -57,15 +57,27 @@ func (e *elementAccessor) insertBeforeFn() func(call goja.FunctionCall) goja.Val
 		if len(call.Arguments) > 1 && !goja.IsNull(call.Arguments[1]) && !goja.IsUndefined(call.Arguments[1]) {
 			refChild = e.ctx.unwrapNode(call.Arguments[1])
 		}
-		e.node.InsertBefore(newChild, refChild)
+		for _, n := range detachForInsert(newChild) {
+			e.node.InsertBefore(n, refChild)
+		}
 		return e.ctx.elementProxy(newChild)
 	}
 }
 
 // setInnerHTML parses the HTML string and replaces the node's children.
 func (e *elementAccessor) setInnerHTML(htmlStr string) {
+	// A template's markup goes into its content
+	target := e.node
+	if target.Content != nil {
+		target = target.Content
+	}
+
 	// Clear existing children
-	e.node.Children = nil
+	for _, child := range target.Children {
+		child.Parent = nil
+	}
+	target.Children = nil
+	e.node.MarkDirty()
 
 	if htmlStr == "" {
 		return
@@ -79,28 +91,68 @@ func (e *elementAccessor) setInnerHTML(htmlStr string) {
 
 	// Adopt all parsed children
 	for _, child := range children {
-		child.Parent = e.node
-		e.node.Children = append(e.node.Children, child)
+		target.AddChild(child)
 	}
 }
 
+// setOuterHTML replaces the element with the nodes parsed from htmlStr.
+// An element without a parent cannot be replaced and is left unchanged.
+func (e *elementAccessor) setOuterHTML(htmlStr string) {
+	parent := e.node.Parent
+	if parent == nil {
+		return
+	}
+	children, err := html.ParseFragment(htmlStr)
+	if err != nil {
+		return
+	}
+	for _, child := range children {
+		parent.InsertBefore(child, e.node)
+	}
+	parent.RemoveChild(e.node)
+}
+
 // Convenience mutation methods (Phase 3)
 
+// detachForInsert prepares a node for insertion: it is removed from its
+// current parent, and a document fragment is replaced by its children,
+// which leave the fragment empty.
+func detachForInsert(node *html.Node) []*html.Node {
+	if node.Type == html.DocumentFragmentNode {
+		children := node.Children
+		node.Children = nil
+		for _, child := range children {
+			child.Parent = nil
+		}
+		return children
+	}
+	if node.Parent != nil {
+		node.Parent.RemoveChild(node)
+	}
+	return []*html.Node{node}
+}
+
+// nodesFromArgs converts the arguments of append(), before(), etc. into
+// detached nodes ready for insertion. Strings become text nodes and
+// fragments contribute their children.
+func (ctx *domContext) nodesFromArgs(args []goja.Value) []*html.Node {
+	var nodes []*html.Node
+	for _, arg := range args {
+		if node := ctx.unwrapNode(arg); node != nil {
+			nodes = append(nodes, detachForInsert(node)...)
+		} else {
+			nodes = append(nodes, &html.Node{Type: html.TextNode, Text: arg.String()})
+		}
+	}
+	return nodes
+}
+
 // appendFn returns a JS function for element.append(...nodes).
 // Accepts nodes and strings (strings become text nodes).
 func (e *elementAccessor) appendFn() func(call goja.FunctionCall) goja.Value {
 	return func(call goja.FunctionCall) goja.Value {
-		for _, arg := range call.Arguments {
-			node := e.ctx.unwrapNode(arg)
-			if node != nil {
-				if node.Parent != nil {
-					node.Parent.RemoveChild(node)
-				}
-				e.node.AddChild(node)
-			} else {
-				// Treat as string -> text node
-				e.node.AppendText(arg.String())
-			}
+		for _, node := range e.ctx.nodesFromArgs(call.Arguments) {
+			e.node.AddChild(node)
 		}
 		return goja.Undefined()
 	}
@@ -109,22 +161,7 @@ func (e *elementAccessor) appendFn() func(call goja.FunctionCall) goja.Value {
 // prependFn returns a JS function for element.prepend(...nodes).
 func (e *elementAccessor) prependFn() func(call goja.FunctionCall) goja.Value {
 	return func(call goja.FunctionCall) goja.Value {
-		// Collect nodes to prepend (in order)
-		var toInsert []*html.Node
-		for _, arg := range call.Arguments {
-			node := e.ctx.unwrapNode(arg)
-			if node != nil {
-				if node.Parent != nil {
-					node.Parent.RemoveChild(node)
-				}
-				toInsert = append(toInsert, node)
-			} else {
-				toInsert = append(toInsert, &html.Node{
-					Type: html.TextNode,
-					Text: arg.String(),
-				})
-			}
-		}
+		toInsert := e.ctx.nodesFromArgs(call.Arguments)
 		// Insert before first child
 		var firstChild *html.Node
 		if len(e.node.Children) > 0 {
@@ -144,18 +181,7 @@ func (e *elementAccessor) beforeFn() func(call goja.FunctionCall) goja.Value {
 			return goja.Undefined()
 		}
 		parent := e.node.Parent
-		for _, arg := range call.Arguments {
-			node := e.ctx.unwrapNode(arg)
-			if node != nil {
-				if node.Parent != nil {
-					node.Parent.RemoveChild(node)
-				}
-			} else {
-				node = &html.Node{
-					Type: html.TextNode,
-					Text: arg.String(),
-				}
-			}
+		for _, node := range e.ctx.nodesFromArgs(call.Arguments) {
 			parent.InsertBefore(node, e.node)
 		}
 		return goja.Undefined()
@@ -169,24 +195,14 @@ func (e *elementAccessor) afterFn() func(call goja.FunctionCall) goja.Value {
 			return goja.Undefined()
 		}
 		parent := e.node.Parent
+		nodes := e.ctx.nodesFromArgs(call.Arguments)
 		// Find the next sibling to use as reference
 		idx := e.node.IndexInParent()
 		var refNode *html.Node
 		if idx >= 0 && idx+1 < len(parent.Children) {
 			refNode = parent.Children[idx+1]
 		}
-		for _, arg := range call.Arguments {
-			node := e.ctx.unwrapNode(arg)
-			if node != nil {
-				if node.Parent != nil {
-					node.Parent.RemoveChild(node)
-				}
-			} else {
-				node = &html.Node{
-					Type: html.TextNode,
-					Text: arg.String(),
-				}
-			}
+		for _, node := range nodes {
 			parent.InsertBefore(node, refNode)
 		}
 		return goja.Undefined()
@@ -201,22 +217,13 @@ func (e *elementAccessor) replaceWithFn() func(call goja.FunctionCall) goja.Valu
 		}
 		parent := e.node.Parent
 		// Insert all new nodes before this one
-		for _, arg := range call.Arguments {
-			node := e.ctx.unwrapNode(arg)
-			if node != nil {
-				if node.Parent != nil {
-					node.Parent.RemoveChild(node)
-				}
-			} else {
-				node = &html.Node{
-					Type: html.TextNode,
-					Text: arg.String(),
-				}
-			}
+		for _, node := range e.ctx.nodesFromArgs(call.Arguments) {
 			parent.InsertBefore(node, e.node)
 		}
-		// Remove this node
-		parent.RemoveChild(e.node)
+		// Remove this node (unless it was one of the replacements)
+		if e.node.Parent == parent {
+			parent.RemoveChild(e.node)
+		}
 		return goja.Undefined()
 	}
 }
@@ -224,20 +231,59 @@ func (e *elementAccessor) replaceWithFn() func(call goja.FunctionCall) goja.Valu
 // replaceChildrenFn returns a JS function for element.replaceChildren(...nodes).
 func (e *elementAccessor) replaceChildrenFn() func(call goja.FunctionCall) goja.Value {
 	return func(call goja.FunctionCall) goja.Value {
+		nodes := e.ctx.nodesFromArgs(call.Arguments)
+
 		// Clear all children
+		for _, child := range e.node.Children {
+			child.Parent = nil
+		}
 		e.node.Children = nil
+		e.node.MarkDirty()
 
-		// Append new children
-		for _, arg := range call.Arguments {
-			node := e.ctx.unwrapNode(arg)
-			if node != nil {
-				if node.Parent != nil {
-					node.Parent.RemoveChild(node)
+		for _, node := range nodes {
+			e.node.AddChild(node)
+		}
+		return goja.Undefined()
+	}
+}
+
+// insertAdjacentHTMLFn returns a JS function for
+// element.insertAdjacentHTML(position, html).
+func (e *elementAccessor) insertAdjacentHTMLFn() func(call goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 2 {
+			panic(e.ctx.vm.NewTypeError("Failed to execute 'insertAdjacentHTML': 2 arguments required"))
+		}
+		position := strings.ToLower(call.Arguments[0].String())
+		nodes, err := html.ParseFragment(call.Arguments[1].String())
+		if err != nil {
+			return goja.Undefined()
+		}
+
+		parent, ref := e.node, (*html.Node)(nil)
+		switch position {
+		case "beforebegin", "afterend":
+			parent = e.node.Parent
+			if parent == nil {
+				return goja.Undefined()
+			}
+			ref = e.node
+			if position == "afterend" {
+				ref = nil
+				if idx := e.node.IndexInParent(); idx+1 < len(parent.Children) {
+					ref = parent.Children[idx+1]
 				}
-				e.node.AddChild(node)
-			} else {
-				e.node.AppendText(arg.String())
 			}
+		case "afterbegin":
+			if len(e.node.Children) > 0 {
+				ref = e.node.Children[0]
+			}
+		case "beforeend":
+		default:
+			panic(e.ctx.vm.NewTypeError("Failed to execute 'insertAdjacentHTML': invalid position '" + position + "'"))
+		}
+		for _, n := range nodes {
+			parent.InsertBefore(n, ref)
 		}
 		return goja.Undefined()
 	}
@@ -193,6 +193,44 @@ func TestOuterHTML(t *testing.T) {
 	}
 }
 
+func TestInnerHTMLSetReparents(t *testing.T) {
+	doc := parseHTML(t, `<div id="root"><p id="old">old</p></div>`)
+	old := getElementById(doc.Root, "old")
+	engine := New()
+	doc.Scripts = append(doc.Scripts, `
+		document.getElementById("root").innerHTML = "<b>hi</b>";
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	if old.Parent != nil {
+		t.Error("replaced child should be detached")
+	}
+	root := getElementById(doc.Root, "root")
+	if len(root.Children) != 1 || root.Children[0].Parent != root {
+		t.Fatal("new child should be parented to root")
+	}
+	if root.IsSubtreeClean() {
+		t.Error("root should be dirty after innerHTML")
+	}
+}
+
+func TestOuterHTMLSet(t *testing.T) {
+	doc := parseHTML(t, `<div id="root"><span id="a">a</span><span id="c">c</span></div>`)
+	engine := New()
+	doc.Scripts = append(doc.Scripts, `
+		var a = document.getElementById("a");
+		a.outerHTML = "<i>x</i><b id=\"b\">y</b>";
+		var root = document.getElementById("root");
+		if (root.innerHTML !== '<i>x</i><b id="b">y</b><span id="c">c</span>') throw new Error("innerHTML: " + root.innerHTML);
+		if (a.parentNode !== null) throw new Error("replaced element should be detached");
+		if (document.getElementById("b").parentNode !== root) throw new Error("parent");
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestAppendChildTextNode(t *testing.T) {
 	doc := parseHTML(t, `<div id="root"></div>`)
 	engine := New()
@@ -19,20 +19,16 @@ func querySelectorFn(ctx *domContext, root *html.Node) func(goja.FunctionCall) g
 		if len(call.Arguments) == 0 {
 			panic(ctx.vm.NewTypeError("Failed to execute 'querySelector': 1 argument required"))
 		}
-		selectorStr := call.Arguments[0].String()
-		selectors := css.SplitSelectorGroup(selectorStr)
+		selectors := parseSelectorList(call.Arguments[0].String())
 
 		var result *html.Node
 		walkTree(root, func(n *html.Node) bool {
 			if n == root {
 				return false // skip root itself
 			}
-			for _, sel := range selectors {
-				parsed := css.ParseSelector(sel)
-				if css.MatchesSelector(n, parsed) {
-					result = n
-					return true // stop
-				}
+			if matchesAny(n, selectors) {
+				result = n
+				return true // stop
 			}
 			return false
 		})
@@ -50,20 +46,12 @@ func querySelectorAllFn(ctx *domContext, root *html.Node) func(goja.FunctionCall
 		if len(call.Arguments) == 0 {
 			panic(ctx.vm.NewTypeError("Failed to execute 'querySelectorAll': 1 argument required"))
 		}
-		selectorStr := call.Arguments[0].String()
-		selectors := css.SplitSelectorGroup(selectorStr)
+		selectors := parseSelectorList(call.Arguments[0].String())
 
 		var results []*html.Node
 		walkTree(root, func(n *html.Node) bool {
-			if n == root {
-				return false
-			}
-			for _, sel := range selectors {
-				parsed := css.ParseSelector(sel)
-				if css.MatchesSelector(n, parsed) {
-					results = append(results, n)
-					break // don't add same node twice for multiple matching selectors
-				}
+			if n != root && matchesAny(n, selectors) {
+				results = append(results, n)
 			}
 			return false
 		})
@@ -78,15 +66,8 @@ func matchesFn(ctx *domContext, node *html.Node) func(goja.FunctionCall) goja.Va
 		if len(call.Arguments) == 0 {
 			panic(ctx.vm.NewTypeError("Failed to execute 'matches': 1 argument required"))
 		}
-		selectorStr := call.Arguments[0].String()
-		selectors := css.SplitSelectorGroup(selectorStr)
-		for _, sel := range selectors {
-			parsed := css.ParseSelector(sel)
-			if css.MatchesSelector(node, parsed) {
-				return ctx.vm.ToValue(true)
-			}
-		}
-		return ctx.vm.ToValue(false)
+		selectors := parseSelectorList(call.Arguments[0].String())
+		return ctx.vm.ToValue(matchesAny(node, selectors))
 	}
 }
 
@@ -96,24 +77,40 @@ func closestFn(ctx *domContext, node *html.Node) func(goja.FunctionCall) goja.Va
 		if len(call.Arguments) == 0 {
 			panic(ctx.vm.NewTypeError("Failed to execute 'closest': 1 argument required"))
 		}
-		selectorStr := call.Arguments[0].String()
-		selectors := css.SplitSelectorGroup(selectorStr)
+		selectors := parseSelectorList(call.Arguments[0].String())
 
 		for current := node; current != nil; current = current.Parent {
 			if current.Type != html.ElementNode || current.TagName == "document" {
 				continue
 			}
-			for _, sel := range selectors {
-				parsed := css.ParseSelector(sel)
-				if css.MatchesSelector(current, parsed) {
-					return ctx.elementProxy(current)
-				}
+			if matchesAny(current, selectors) {
+				return ctx.elementProxy(current)
 			}
 		}
 		return goja.Null()
 	}
 }
 
+// parseSelectorList parses a comma-separated selector list once, so
+// matching a tree does not re-parse it for every node.
+func parseSelectorList(s string) []css.Selector {
+	var selectors []css.Selector
+	for _, sel := range css.SplitSelectorGroup(s) {
+		selectors = append(selectors, css.ParseSelector(sel))
+	}
+	return selectors
+}
+
+// matchesAny returns true if the node matches any of the selectors.
+func matchesAny(node *html.Node, selectors []css.Selector) bool {
+	for _, sel := range selectors {
+		if css.MatchesSelector(node, sel) {
+			return true
+		}
+	}
+	return false
+}
+
 // walkTree performs a DFS walk over the tree. The callback returns true to stop.
 func walkTree(node *html.Node, fn func(*html.Node) bool) bool {
 	if node.Type == html.ElementNode {
@@ -1,8 +1,13 @@
 package js
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math/rand"
+	"time"
 
+	"louis14/pkg/determinism"
 	"louis14/pkg/html"
 
 	"github.com/dop251/goja"
@@ -10,35 +15,287 @@ import (
 
 // Engine executes JavaScript against an HTML document's DOM.
 type Engine struct {
-	vm *goja.Runtime
+	vm      *goja.Runtime
+	ctx     *domContext // DOM bindings of the last executed document
+	network network
+	local   *Storage // Backs window.localStorage
+	session *Storage // Backs window.sessionStorage
+
+	stopInterrupt func() bool // Stops the interrupt of the context set by SetContext
 }
 
 // New creates a new JS engine with a fresh goja runtime.
 func New() *Engine {
 	vm := goja.New()
-	e := &Engine{vm: vm}
+	e := &Engine{vm: vm, local: NewStorage(""), session: NewStorage("")}
 
 	// Register console API
 	c := &consoleAPI{}
 	c.register(vm)
 
+	if determinism.Enabled() {
+		vm.SetTimeSource(e.virtualNow)
+		vm.SetRandSource(rand.New(rand.NewSource(determinism.Seed)).Float64)
+	}
 	return e
 }
 
-// Execute runs all scripts from the document against the DOM.
-// Scripts are executed in order. Any JS errors are returned but
+// virtualNow is the wall-clock time scripts see in deterministic mode: the
+// determinism epoch advanced by the engine's virtual time.
+func (e *Engine) virtualNow() time.Time {
+	if e.ctx == nil {
+		return determinism.Epoch
+	}
+	return determinism.Epoch.Add(e.ctx.clock)
+}
+
+// SetFetcher sets the fetcher used by fetch() and XMLHttpRequest. Without
+// one, scripts can only request http and https URLs, via std/net.
+func (e *Engine) SetFetcher(f Fetcher) {
+	e.network.fetcher = f
+}
+
+// SetContext sets the context of the page the engine runs scripts for.
+// When it is canceled, as when the user navigates away or a render times
+// out, the requests scripts made are canceled, running scripts are
+// interrupted with the context's error, and RunUntilIdle stops waiting.
+// Once it is canceled the engine runs no more scripts or listeners.
+func (e *Engine) SetContext(ctx context.Context) {
+	if e.stopInterrupt != nil {
+		e.stopInterrupt()
+	}
+	e.network.ctx = ctx
+	e.stopInterrupt = context.AfterFunc(ctx, func() {
+		e.vm.Interrupt(context.Cause(ctx))
+	})
+}
+
+// SetBaseURL sets the document URL that relative request URLs resolve
+// against and that the same-origin policy compares origins with.
+func (e *Engine) SetBaseURL(baseURL string) {
+	e.network.baseURL = baseURL
+}
+
+// SetSameOrigin enables or disables the same-origin policy. When enabled,
+// fetch() and XMLHttpRequest fail for URLs whose scheme and host differ
+// from the base URL's. It is disabled by default.
+func (e *Engine) SetSameOrigin(enforce bool) {
+	e.network.sameOrigin = enforce
+}
+
+// SetLocalStorage sets the store behind window.localStorage. Without one,
+// the engine keeps localStorage in memory, so it lasts as long as the
+// engine.
+func (e *Engine) SetLocalStorage(s *Storage) {
+	e.local = s
+}
+
+// SetSessionStorage sets the store behind window.sessionStorage, which
+// embedders share between the pages shown in one tab. Without one, the
+// engine keeps its own.
+func (e *Engine) SetSessionStorage(s *Storage) {
+	e.session = s
+}
+
+// Execute runs all scripts from the document against the DOM, then fires
+// DOMContentLoaded at the document and runs timers that are already due.
+// Classic scripts are executed in order, then module scripts, which are
+// deferred until the document is parsed. Any JS errors are returned but
 // callers may choose to log and continue rather than fail.
 func (e *Engine) Execute(doc *html.Document) error {
 	// Register document global pointing at this document's DOM
-	registerDocument(e.vm, doc)
+	e.ctx = registerDocument(e.vm, doc)
+	e.ctx.network = &e.network
+	registerStorage(e.ctx, e.local, e.session)
+	registerLocation(e.ctx)
 
-	// Execute each script in document order
+	// Execute each script in document order. As in a browser, an error in
+	// one script does not stop the ones after it.
+	var errs []error
+	var modules []int
 	for i, script := range doc.Scripts {
-		_, err := e.vm.RunString(script)
-		if err != nil {
-			return fmt.Errorf("script %d: %w", i, err)
+		if doc.ScriptMetadata(i).Type == html.ScriptModule {
+			modules = append(modules, i)
+			continue
+		}
+		if err := e.canceled(); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		if _, err := e.vm.RunString(script); err != nil {
+			errs = append(errs, fmt.Errorf("script %d: %w", i, err))
 		}
 	}
+	for _, i := range modules {
+		if err := e.canceled(); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		if _, err := e.vm.RunString(moduleSource(doc.Scripts[i])); err != nil {
+			errs = append(errs, fmt.Errorf("module script %d: %w", i, err))
+		}
+	}
+	if err := e.canceled(); err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+
+	e.ctx.dispatch(e.ctx.document, e.ctx.newEvent("DOMContentLoaded", true, false, true))
+	e.ctx.runTimers(0)
+	return errors.Join(append(errs, e.takeErrors())...)
+}
+
+// moduleSource wraps a module script so it runs as modules do: in strict
+// mode, with its own top-level scope and this undefined. Imports and
+// exports aren't supported and fail as syntax errors.
+func moduleSource(script string) string {
+	return "(function() {\"use strict\";\n" + script + "\n}).call(undefined);"
+}
+
+// DispatchLoad fires the window's load event, which the embedder calls once
+// the document's subresources have loaded (after the first layout has
+// fetched its images and fonts), then runs timers that are due.
+func (e *Engine) DispatchLoad() error {
+	if e.ctx == nil {
+		return nil
+	}
+	if err := e.canceled(); err != nil {
+		return err
+	}
+	e.ctx.dispatch(e.ctx.window, e.ctx.newEvent("load", false, false, true))
+	e.ctx.runTimers(0)
+	return e.takeErrors()
+}
+
+// Click dispatches a click event at an element of the executed document,
+// as when the user clicks it, then runs timers that are due. It returns
+// false if a listener canceled the event's default action.
+func (e *Engine) Click(node *html.Node) (bool, error) {
+	if e.ctx == nil {
+		return true, nil
+	}
+	if err := e.canceled(); err != nil {
+		return true, err
+	}
+	ok := e.ctx.dispatch(node, e.ctx.newEvent("click", true, true, true))
+	e.ctx.runTimers(0)
+	return ok, e.takeErrors()
+}
+
+// RunTasks runs the callbacks of finished fetch() and XMLHttpRequest
+// requests, then advances the engine's virtual clock by d, running the
+// setTimeout and setInterval callbacks that come due.
+func (e *Engine) RunTasks(d time.Duration) error {
+	if e.ctx == nil {
+		return nil
+	}
+	if err := e.canceled(); err != nil {
+		return err
+	}
+	e.ctx.runTimers(d)
+	return e.takeErrors()
+}
+
+// RunFrame runs the requestAnimationFrame callbacks queued before it was
+// called, passing them the engine's virtual time. Interactive embedders
+// call it once per display frame, after RunTasks and before laying out and
+// drawing the page. Callbacks requested during the frame run in the next.
+func (e *Engine) RunFrame() error {
+	if e.ctx == nil {
+		return nil
+	}
+	if err := e.canceled(); err != nil {
+		return err
+	}
+	e.ctx.runFrame()
+	return e.takeErrors()
+}
+
+// FramePending reports whether requestAnimationFrame callbacks are waiting
+// for the next frame.
+func (e *Engine) FramePending() bool {
+	return e.ctx != nil && len(e.ctx.frames) > 0
+}
+
+// RunUntilIdle runs pending timer callbacks in due order, advancing the
+// virtual clock to each, and waits for requests in flight, until nothing is
+// pending or the next timer is due more than deadline from now. While
+// waiting for a request the virtual clock follows real time, and no request
+// is waited for longer than deadline. Embedders call it before their final
+// render so deferred DOM changes are applied.
+//
+// Animation frames are run every frameInterval of virtual time while
+// callbacks are requested, until a frame leaves the document unchanged: the
+// page has then settled, and callbacks still requested stay pending.
+func (e *Engine) RunUntilIdle(deadline time.Duration) error {
+	if e.ctx == nil {
+		return nil
+	}
+	ctx := e.ctx
+	limit := ctx.clock + deadline
+	stop := time.Now().Add(deadline)
+	canceled := e.network.requestContext().Done()
+	settled := false
+	for {
+		if err := e.canceled(); err != nil {
+			return errors.Join(err, e.takeErrors())
+		}
+		ctx.runCompletions()
+		if ctx.inFlight == 0 {
+			if len(ctx.frames) > 0 && !settled {
+				frame := ctx.clock + frameInterval - ctx.clock%frameInterval
+				if frame <= limit && (len(ctx.timers) == 0 || ctx.timers[0].due > frame) {
+					ctx.clock = frame
+					before := ctx.doc.Root.Serialize()
+					ctx.runFrame()
+					settled = ctx.doc.Root.Serialize() == before
+					continue
+				}
+			}
+			if len(ctx.timers) == 0 || ctx.timers[0].due > limit {
+				break
+			}
+			ctx.runDue(ctx.timers[0].due)
+			continue
+		}
+
+		// Wait for a response, or until the next timer is due.
+		wait := min(time.Until(stop), limit-ctx.clock)
+		if len(ctx.timers) > 0 {
+			wait = min(wait, ctx.timers[0].due-ctx.clock)
+		}
+		if wait <= 0 && (time.Now().After(stop) || ctx.clock >= limit) {
+			break
+		}
+		start := time.Now()
+		select {
+		case f := <-ctx.completions:
+			ctx.inFlight--
+			ctx.runTask(f)
+		case <-time.After(wait):
+		case <-canceled:
+		}
+		ctx.runTimers(time.Since(start))
+	}
+	return e.takeErrors()
+}
+
+// Idle reports whether no timers, animation frame callbacks, or requests
+// are pending.
+func (e *Engine) Idle() bool {
+	return e.ctx == nil || (len(e.ctx.timers) == 0 && len(e.ctx.frames) == 0 && e.ctx.inFlight == 0)
+}
+
+// canceled returns the cause of the cancellation of the context set by
+// SetContext, or nil if it has not been canceled.
+func (e *Engine) canceled() error {
+	if e.network.ctx == nil || e.network.ctx.Err() == nil {
+		return nil
+	}
+	return context.Cause(e.network.ctx)
+}
 
-	return nil
+// takeErrors returns and clears the exceptions thrown by event listeners
+// and timers since the last call.
+func (e *Engine) takeErrors() error {
+	err := errors.Join(e.ctx.errs...)
+	e.ctx.errs = nil
+	return err
 }
@@ -1,6 +1,7 @@
 package js
 
 import (
+	"strings"
 	"testing"
 
 	"louis14/pkg/html"
@@ -210,6 +211,20 @@ func TestScriptError(t *testing.T) {
 	}
 }
 
+func TestScriptErrorContinues(t *testing.T) {
+	doc := parseHTML(t, `<p id="p">text</p>`)
+	engine := New()
+	doc.Scripts = append(doc.Scripts,
+		`throw new Error("first");`,
+		`document.getElementById("p").textContent = "ran";`)
+	if err := engine.Execute(doc); err == nil {
+		t.Fatal("expected error from first script")
+	}
+	if got := getElementById(doc.Root, "p").TextContent(); got != "ran" {
+		t.Errorf("second script did not run: textContent = %q", got)
+	}
+}
+
 func TestScriptExtraction(t *testing.T) {
 	doc := parseHTML(t, `<p>text</p><script>var x = 1;</script><script>var y = 2;</script>`)
 	if len(doc.Scripts) != 2 {
@@ -270,3 +285,149 @@ func containsDecl(style, prop, val string) bool {
 	m := parseInlineStyle(style)
 	return m[prop] == val
 }
+
+func TestElementValue(t *testing.T) {
+	doc := parseHTML(t, `<input id="name" value="Ann"><textarea id="note">hi</textarea>`+
+		`<select id="size"><option>S</option><option value="m">Medium</option></select>`)
+	// The user has typed into the input
+	getElementById(doc.Root, "name").SetValue("Annie")
+
+	engine := New()
+	doc.Scripts = append(doc.Scripts, `
+		var name = document.getElementById("name");
+		if (name.value !== "Annie") throw new Error("input value: " + name.value);
+		if (name.getAttribute("value") !== "Ann") throw new Error("value attribute changed");
+		if (document.getElementById("note").value !== "hi") throw new Error("textarea value");
+		var size = document.getElementById("size");
+		if (size.value !== "S") throw new Error("select value: " + size.value);
+		size.value = "m";
+		name.value = "Bob";
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	if got := getElementById(doc.Root, "size").Value(); got != "m" {
+		t.Errorf("select value after script = %q, want %q", got, "m")
+	}
+	if got := getElementById(doc.Root, "name").Value(); got != "Bob" {
+		t.Errorf("input value after script = %q, want %q", got, "Bob")
+	}
+}
+
+func TestDocumentFragment(t *testing.T) {
+	doc := parseHTML(t, `<ul id="list"><li>a</li></ul>`)
+	engine := New()
+	doc.Scripts = append(doc.Scripts, `
+		var frag = document.createDocumentFragment();
+		if (frag.nodeType !== 11) throw new Error("nodeType: " + frag.nodeType);
+		for (var i = 0; i < 2; i++) {
+			var li = document.createElement("li");
+			li.textContent = "item" + i;
+			frag.appendChild(li);
+		}
+		document.querySelector("#list").appendChild(frag);
+		if (frag.childNodes.length !== 0) throw new Error("fragment not emptied");
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	list := getElementById(doc.Root, "list")
+	if len(list.Children) != 3 {
+		t.Fatalf("expected 3 items, got %d", len(list.Children))
+	}
+	if got := list.Children[2].TextContent(); got != "item1" {
+		t.Errorf("last item = %q", got)
+	}
+}
+
+func TestDatasetAndToggleAttribute(t *testing.T) {
+	doc := parseHTML(t, `<div id="d" data-user-id="7"></div>`)
+	engine := New()
+	doc.Scripts = append(doc.Scripts, `
+		var d = document.getElementById("d");
+		if (d.dataset.userId !== "7") throw new Error("dataset.userId: " + d.dataset.userId);
+		d.dataset.itemCount = "3";
+		if (d.toggleAttribute("hidden") !== true) throw new Error("toggle on");
+		if (!d.hidden) throw new Error("hidden not set");
+		if (d.toggleAttribute("hidden") !== false) throw new Error("toggle off");
+		d.hidden = true;
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	d := getElementById(doc.Root, "d")
+	if v, _ := d.GetAttribute("data-item-count"); v != "3" {
+		t.Errorf("data-item-count = %q", v)
+	}
+	if _, ok := d.GetAttribute("hidden"); !ok {
+		t.Error("hidden attribute not set")
+	}
+}
+
+func TestInsertAdjacentHTML(t *testing.T) {
+	doc := parseHTML(t, `<div id="wrap"><p id="p">mid</p></div>`)
+	engine := New()
+	doc.Scripts = append(doc.Scripts, `
+		var p = document.getElementById("p");
+		p.insertAdjacentHTML("beforebegin", "<span>1</span>");
+		p.insertAdjacentHTML("afterbegin", "<b>2</b>");
+		p.insertAdjacentHTML("beforeend", "<i>3</i>");
+		p.insertAdjacentHTML("afterend", "<em>4</em>");
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	wrap := getElementById(doc.Root, "wrap")
+	var tags []string
+	for _, c := range wrap.Children {
+		tags = append(tags, c.TagName)
+	}
+	if strings.Join(tags, ",") != "span,p,em" {
+		t.Errorf("wrap children = %v", tags)
+	}
+	if got := getElementById(doc.Root, "p").TextContent(); got != "2mid3" {
+		t.Errorf("p text = %q", got)
+	}
+}
+
+func TestModuleScripts(t *testing.T) {
+	doc := parseHTML(t, `<div id="log"></div>`+
+		`<script>document.getElementById("log").textContent += "1";</script>`+
+		`<script type="module">
+			if (this !== undefined) throw new Error("module this is not undefined");
+			var local = "module";
+			document.getElementById("log").textContent += "3";
+		</script>`+
+		`<script>document.getElementById("log").textContent += "2";</script>`+
+		`<script type="module">
+			if (typeof local !== "undefined") throw new Error("module scope leaked");
+			undeclared = 1;
+		</script>`)
+	engine := New()
+	err := engine.Execute(doc)
+	if err == nil || !strings.Contains(err.Error(), "module script 3") {
+		t.Errorf("Execute() error = %v, want the strict mode error of module script 3", err)
+	}
+	if got := getElementById(doc.Root, "log").TextContent(); got != "123" {
+		t.Errorf("log = %q, want classic scripts first, then modules", got)
+	}
+}
+
+func TestTemplateContent(t *testing.T) {
+	doc := parseHTML(t, `<template id="t"><p class="item">a</p></template><div id="out"></div>`)
+	engine := New()
+	doc.Scripts = append(doc.Scripts, `
+		var t = document.getElementById("t");
+		if (t.children.length !== 0) throw new Error("template has children");
+		if (document.querySelector(".item") !== null) throw new Error("template content is in the document");
+		if (t.content.childNodes.length !== 1) throw new Error("content has " + t.content.childNodes.length + " nodes");
+		if (t.innerHTML !== '<p class="item">a</p>') throw new Error("innerHTML = " + t.innerHTML);
+		document.getElementById("out").appendChild(t.content.firstChild.cloneNode(true));
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	if got := getElementById(doc.Root, "out").TextContent(); got != "a" {
+		t.Errorf("out text = %q, want the cloned template content", got)
+	}
+}
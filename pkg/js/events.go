@@ -0,0 +1,336 @@
+package js
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"louis14/pkg/html"
+
+	"github.com/dop251/goja"
+)
+
+// Event dispatch (DOM §2.9). Event targets are DOM nodes, the document, and
+// the window. Nodes are keyed by their *html.Node and the document and
+// window by their JS objects; the document's root node stands for the
+// document itself, so events bubble from an element up to the document and
+// then to the window.
+
+// Values of Event.eventPhase.
+const (
+	phaseNone      = 0
+	phaseCapturing = 1
+	phaseAtTarget  = 2
+	phaseBubbling  = 3
+)
+
+// listener is a callback registered with addEventListener.
+type listener struct {
+	typ      string
+	callback goja.Value // A function or an object with a handleEvent method
+	capture  bool
+	once     bool
+	removed  bool
+}
+
+// handlerKey identifies an on<type> event handler property of a node.
+type handlerKey struct {
+	node *html.Node
+	typ  string
+}
+
+// event is the Go-side state of a JS Event object.
+type event struct {
+	obj                      *goja.Object
+	typ                      string
+	bubbles, cancelable      bool
+	stopped, stopImmediately bool
+	canceled                 bool
+}
+
+// newEvent creates an Event object. Events created by the browser rather
+// than by a script are trusted.
+func (ctx *domContext) newEvent(typ string, bubbles, cancelable, trusted bool) *event {
+	ev := &event{obj: ctx.vm.NewObject(), typ: typ, bubbles: bubbles, cancelable: cancelable}
+	ev.obj.Set("type", typ)
+	ev.obj.Set("bubbles", bubbles)
+	ev.obj.Set("cancelable", cancelable)
+	ev.obj.Set("defaultPrevented", false)
+	ev.obj.Set("isTrusted", trusted)
+	ev.obj.Set("target", goja.Null())
+	ev.obj.Set("currentTarget", goja.Null())
+	ev.obj.Set("eventPhase", phaseNone)
+	ev.obj.Set("preventDefault", func(goja.FunctionCall) goja.Value {
+		ev.preventDefault()
+		return goja.Undefined()
+	})
+	ev.obj.Set("stopPropagation", func(goja.FunctionCall) goja.Value {
+		ev.stopped = true
+		return goja.Undefined()
+	})
+	ev.obj.Set("stopImmediatePropagation", func(goja.FunctionCall) goja.Value {
+		ev.stopped, ev.stopImmediately = true, true
+		return goja.Undefined()
+	})
+	return ev
+}
+
+func (ev *event) preventDefault() {
+	if ev.cancelable {
+		ev.canceled = true
+		ev.obj.Set("defaultPrevented", true)
+	}
+}
+
+// registerEventConstructors defines the Event and CustomEvent constructors.
+func registerEventConstructors(ctx *domContext) {
+	construct := func(call goja.ConstructorCall, custom bool) *goja.Object {
+		if len(call.Arguments) == 0 {
+			panic(ctx.vm.NewTypeError("Failed to construct 'Event': 1 argument required"))
+		}
+		var bubbles, cancelable bool
+		detail := goja.Null()
+		if init := call.Argument(1); !goja.IsUndefined(init) && !goja.IsNull(init) {
+			opts := init.ToObject(ctx.vm)
+			bubbles = opts.Get("bubbles") != nil && opts.Get("bubbles").ToBoolean()
+			cancelable = opts.Get("cancelable") != nil && opts.Get("cancelable").ToBoolean()
+			if d := opts.Get("detail"); d != nil {
+				detail = d
+			}
+		}
+		ev := ctx.newEvent(call.Arguments[0].String(), bubbles, cancelable, false)
+		if custom {
+			ev.obj.Set("detail", detail)
+		}
+		ev.obj.SetPrototype(call.This.Prototype())
+		ctx.events[ev.obj] = ev
+		return ev.obj
+	}
+	ctx.vm.Set("Event", func(call goja.ConstructorCall) *goja.Object {
+		return construct(call, false)
+	})
+	ctx.vm.Set("CustomEvent", func(call goja.ConstructorCall) *goja.Object {
+		return construct(call, true)
+	})
+}
+
+// registerEventTarget adds addEventListener, removeEventListener, and
+// dispatchEvent to the document or window object.
+func registerEventTarget(ctx *domContext, obj *goja.Object) {
+	obj.Set("addEventListener", ctx.addEventListenerFn(obj))
+	obj.Set("removeEventListener", ctx.removeEventListenerFn(obj))
+	obj.Set("dispatchEvent", ctx.dispatchEventFn(obj))
+}
+
+// listenerOptions reads the capture and once flags from the third argument
+// of addEventListener, which is either a boolean or an options object.
+func listenerOptions(vm *goja.Runtime, arg goja.Value) (capture, once bool) {
+	if goja.IsUndefined(arg) || goja.IsNull(arg) {
+		return false, false
+	}
+	if _, ok := arg.Export().(bool); ok {
+		return arg.ToBoolean(), false
+	}
+	opts := arg.ToObject(vm)
+	if v := opts.Get("capture"); v != nil {
+		capture = v.ToBoolean()
+	}
+	if v := opts.Get("once"); v != nil {
+		once = v.ToBoolean()
+	}
+	return capture, once
+}
+
+// findListener returns the index of the listener on target with the given
+// type, callback, and capture flag, or -1.
+func (ctx *domContext) findListener(target any, typ string, callback goja.Value, capture bool) int {
+	return slices.IndexFunc(ctx.listeners[target], func(l *listener) bool {
+		return l.typ == typ && l.capture == capture && l.callback.SameAs(callback)
+	})
+}
+
+func (ctx *domContext) addEventListenerFn(target any) func(call goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 2 || goja.IsNull(call.Arguments[1]) || goja.IsUndefined(call.Arguments[1]) {
+			return goja.Undefined()
+		}
+		typ, callback := call.Arguments[0].String(), call.Arguments[1]
+		capture, once := listenerOptions(ctx.vm, call.Argument(2))
+		if ctx.findListener(target, typ, callback, capture) >= 0 {
+			return goja.Undefined()
+		}
+		ctx.listeners[target] = append(ctx.listeners[target], &listener{
+			typ: typ, callback: callback, capture: capture, once: once,
+		})
+		return goja.Undefined()
+	}
+}
+
+func (ctx *domContext) removeEventListenerFn(target any) func(call goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 2 {
+			return goja.Undefined()
+		}
+		capture, _ := listenerOptions(ctx.vm, call.Argument(2))
+		if i := ctx.findListener(target, call.Arguments[0].String(), call.Arguments[1], capture); i >= 0 {
+			ctx.removeListener(target, i)
+		}
+		return goja.Undefined()
+	}
+}
+
+func (ctx *domContext) removeListener(target any, i int) {
+	ctx.listeners[target][i].removed = true
+	ctx.listeners[target] = slices.Delete(ctx.listeners[target], i, i+1)
+}
+
+func (ctx *domContext) dispatchEventFn(target any) func(call goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		var ev *event
+		if len(call.Arguments) > 0 {
+			if obj, ok := call.Arguments[0].(*goja.Object); ok {
+				ev = ctx.events[obj]
+			}
+		}
+		if ev == nil {
+			panic(ctx.vm.NewTypeError("Failed to execute 'dispatchEvent': parameter 1 is not of type 'Event'"))
+		}
+		return ctx.vm.ToValue(ctx.dispatch(target, ev))
+	}
+}
+
+// targetValue returns the JS value of an event target.
+func (ctx *domContext) targetValue(target any) goja.Value {
+	if node, ok := target.(*html.Node); ok {
+		return ctx.elementProxy(node)
+	}
+	return target.(*goja.Object)
+}
+
+// eventPath returns the target followed by the ancestors an event at it
+// propagates through, innermost first.
+func (ctx *domContext) eventPath(target any) []any {
+	node, ok := target.(*html.Node)
+	if !ok {
+		if target == ctx.document {
+			return []any{ctx.document, ctx.window}
+		}
+		return []any{target}
+	}
+	var path []any
+	for n := node; n != nil; n = n.Parent {
+		if ctx.doc != nil && n == ctx.doc.Root {
+			return append(path, ctx.document, ctx.window)
+		}
+		path = append(path, n)
+	}
+	return path
+}
+
+// dispatch runs an event through its capture, target, and bubble phases.
+// It returns false if a listener canceled the event.
+func (ctx *domContext) dispatch(target any, ev *event) bool {
+	ev.stopped, ev.stopImmediately = false, false
+	path := ctx.eventPath(target)
+	ev.obj.Set("target", ctx.targetValue(target))
+	for i := len(path) - 1; i > 0 && !ev.stopped; i-- {
+		ctx.invokeListeners(path[i], ev, phaseCapturing)
+	}
+	if !ev.stopped {
+		ctx.invokeListeners(path[0], ev, phaseAtTarget)
+	}
+	for i := 1; ev.bubbles && i < len(path) && !ev.stopped; i++ {
+		ctx.invokeListeners(path[i], ev, phaseBubbling)
+	}
+	ev.obj.Set("currentTarget", goja.Null())
+	ev.obj.Set("eventPhase", phaseNone)
+	return !ev.canceled
+}
+
+// invokeListeners calls the target's listeners for the event's type and
+// phase, after its on<type> handler in the target and bubble phases.
+func (ctx *domContext) invokeListeners(target any, ev *event, phase int) {
+	current := ctx.targetValue(target)
+	ev.obj.Set("currentTarget", current)
+	ev.obj.Set("eventPhase", phase)
+
+	if phase != phaseCapturing {
+		if handler := ctx.eventHandler(target, ev.typ); handler != nil {
+			if result := ctx.call(handler, current, ev); result != nil && result.StrictEquals(ctx.vm.ToValue(false)) {
+				ev.preventDefault()
+			}
+		}
+	}
+	// Listeners added during dispatch do not run; removed ones do not either.
+	for _, l := range slices.Clone(ctx.listeners[target]) {
+		if l.removed || l.typ != ev.typ {
+			continue
+		}
+		if (phase == phaseCapturing && !l.capture) || (phase == phaseBubbling && l.capture) {
+			continue
+		}
+		if l.once {
+			ctx.removeListener(target, slices.Index(ctx.listeners[target], l))
+		}
+		ctx.call(l.callback, current, ev)
+		if ev.stopImmediately {
+			return
+		}
+	}
+}
+
+// eventHandler returns the on<type> handler of a target: a function
+// assigned to the property, or for elements the compiled source of the
+// on<type> attribute. It returns nil if there is none.
+func (ctx *domContext) eventHandler(target any, typ string) goja.Value {
+	node, ok := target.(*html.Node)
+	if !ok {
+		if h := target.(*goja.Object).Get("on" + typ); h != nil {
+			if _, ok := goja.AssertFunction(h); ok {
+				return h
+			}
+		}
+		return nil
+	}
+	if h, ok := ctx.handlers[handlerKey{node, typ}]; ok {
+		return h
+	}
+	src, ok := node.GetAttribute("on" + typ)
+	if !ok {
+		return nil
+	}
+	h, err := ctx.vm.RunString("(function(event) {\n" + src + "\n})")
+	if err != nil {
+		ctx.errs = append(ctx.errs, fmt.Errorf("on%s handler: %w", typ, err))
+		return nil
+	}
+	return h
+}
+
+// call invokes a listener callback with the event, recording any exception
+// it throws; an exception in one listener does not stop the others.
+func (ctx *domContext) call(callback, this goja.Value, ev *event) goja.Value {
+	fn, ok := goja.AssertFunction(callback)
+	if !ok {
+		obj, isObj := callback.(*goja.Object)
+		if !isObj {
+			return nil
+		}
+		if fn, ok = goja.AssertFunction(obj.Get("handleEvent")); !ok {
+			return nil
+		}
+		this = obj
+	}
+	result, err := fn(this, ev.obj)
+	if err != nil {
+		ctx.errs = append(ctx.errs, fmt.Errorf("%s listener: %w", ev.typ, err))
+		return nil
+	}
+	return result
+}
+
+// isEventHandlerProperty reports whether an element property name is an
+// on<type> event handler such as onclick.
+func isEventHandlerProperty(key string) bool {
+	return len(key) > 2 && strings.HasPrefix(key, "on") && strings.ToLower(key) == key
+}
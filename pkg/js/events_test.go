@@ -0,0 +1,143 @@
+package js
+
+import "testing"
+
+func TestEventPropagationOrder(t *testing.T) {
+	doc := parseHTML(t, `<div id="outer"><button id="btn">go</button></div>`)
+	engine := New()
+	doc.Scripts = append(doc.Scripts, `
+		var log = [];
+		var outer = document.getElementById("outer");
+		var btn = document.getElementById("btn");
+		window.addEventListener("click", function() { log.push("window"); });
+		document.addEventListener("click", function() { log.push("document"); });
+		outer.addEventListener("click", function() { log.push("outer-capture"); }, true);
+		outer.addEventListener("click", function(e) {
+			if (e.target !== btn) throw new Error("target");
+			if (e.currentTarget !== outer) throw new Error("currentTarget");
+			log.push("outer");
+		});
+		btn.addEventListener("click", function() { log.push("btn"); });
+		btn.click();
+		if (log.join(",") !== "outer-capture,btn,outer,document,window")
+			throw new Error("order: " + log.join(","));
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEventStopAndRemove(t *testing.T) {
+	doc := parseHTML(t, `<div id="outer"><p id="p">x</p></div>`)
+	engine := New()
+	doc.Scripts = append(doc.Scripts, `
+		var count = 0;
+		var p = document.getElementById("p");
+		document.getElementById("outer").addEventListener("click", function() { count += 100; });
+		p.addEventListener("click", function(e) { e.stopPropagation(); count++; });
+		function once() { count += 10; }
+		p.addEventListener("click", once, {once: true});
+		p.click();
+		p.click();
+		if (count !== 12) throw new Error("count after stop/once: " + count);
+		function h() { count = -1; }
+		p.addEventListener("click", h);
+		p.removeEventListener("click", h);
+		p.click();
+		if (count !== 13) throw new Error("count after remove: " + count);
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCustomEventDispatch(t *testing.T) {
+	doc := parseHTML(t, `<div id="d"></div>`)
+	engine := New()
+	doc.Scripts = append(doc.Scripts, `
+		var d = document.getElementById("d");
+		var got = null;
+		d.addEventListener("ping", function(e) { got = e.detail; e.preventDefault(); });
+		var ev = new CustomEvent("ping", {detail: 42, cancelable: true});
+		if (d.dispatchEvent(ev) !== false) throw new Error("expected canceled");
+		if (got !== 42) throw new Error("detail: " + got);
+		if (!ev.defaultPrevented) throw new Error("defaultPrevented");
+		if (ev.isTrusted) throw new Error("script events are not trusted");
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadEvents(t *testing.T) {
+	doc := parseHTML(t, `<p id="p">x</p>`)
+	engine := New()
+	doc.Scripts = append(doc.Scripts, `
+		var p = document.getElementById("p");
+		document.addEventListener("DOMContentLoaded", function() { p.textContent += ",ready"; });
+		window.onload = function() { p.textContent += ",load"; };
+		p.textContent = "script";
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	p := getElementById(doc.Root, "p")
+	if got := p.TextContent(); got != "script,ready" {
+		t.Errorf("after Execute: %q", got)
+	}
+	if err := engine.DispatchLoad(); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.TextContent(); got != "script,ready,load" {
+		t.Errorf("after DispatchLoad: %q", got)
+	}
+}
+
+func TestClickHandlers(t *testing.T) {
+	doc := parseHTML(t, `<a id="a" onclick="this.className = 'hit'; return false">x</a><b id="b">y</b>`)
+	engine := New()
+	doc.Scripts = append(doc.Scripts, `
+		document.getElementById("b").onclick = function(e) { this.textContent = e.type; };
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	a := getElementById(doc.Root, "a")
+	ok, err := engine.Click(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("returning false from an onclick attribute should cancel the click")
+	}
+	if v, _ := a.GetAttribute("class"); v != "hit" {
+		t.Errorf("class = %q", v)
+	}
+	b := getElementById(doc.Root, "b")
+	if _, err := engine.Click(b); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.TextContent(); got != "click" {
+		t.Errorf("b text = %q", got)
+	}
+}
+
+func TestListenerErrorDoesNotStopOthers(t *testing.T) {
+	doc := parseHTML(t, `<p id="p">x</p>`)
+	engine := New()
+	doc.Scripts = append(doc.Scripts, `
+		var p = document.getElementById("p");
+		p.addEventListener("click", function() { throw new Error("boom"); });
+		p.addEventListener("click", function() { p.textContent = "second"; });
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	p := getElementById(doc.Root, "p")
+	if _, err := engine.Click(p); err == nil {
+		t.Error("expected the listener's error to be reported")
+	}
+	if got := p.TextContent(); got != "second" {
+		t.Errorf("second listener did not run: %q", got)
+	}
+}
@@ -0,0 +1,327 @@
+package js
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	stdnet "louis14/std/net"
+
+	"github.com/dop251/goja"
+)
+
+// Fetcher retrieves the resources scripts request with fetch() and
+// XMLHttpRequest. It has the same shape as resource.Fetcher, so the
+// embedder's fetcher can be passed directly.
+type Fetcher interface {
+	Fetch(ctx context.Context, uri string) (body []byte, contentType string, err error)
+}
+
+// FetcherFunc adapts a function to the Fetcher interface.
+type FetcherFunc func(ctx context.Context, uri string) (body []byte, contentType string, err error)
+
+// Fetch calls f(ctx, uri).
+func (f FetcherFunc) Fetch(ctx context.Context, uri string) ([]byte, string, error) {
+	return f(ctx, uri)
+}
+
+// networkFetcher is used when the embedder sets no fetcher. It only
+// fetches http and https URLs.
+var networkFetcher = FetcherFunc(func(ctx context.Context, uri string) ([]byte, string, error) {
+	if !stdnet.IsNetworkURL(uri) {
+		return nil, "", fmt.Errorf("cannot fetch non-network URI: %s", uri)
+	}
+	return stdnet.FetchContext(ctx, uri)
+})
+
+// network is the engine's configuration for script-initiated requests.
+type network struct {
+	fetcher    Fetcher         // nil = networkFetcher
+	baseURL    string          // Document URL that relative request URLs resolve against
+	sameOrigin bool            // Reject requests to other origins than baseURL's
+	ctx        context.Context // Cancels requests; nil = never canceled
+}
+
+// requestContext returns the context requests are made with.
+func (n *network) requestContext() context.Context {
+	if n.ctx == nil {
+		return context.Background()
+	}
+	return n.ctx
+}
+
+// fetchResult is a completed request, handed back to the goroutine that
+// runs scripts.
+type fetchResult struct {
+	url         string
+	body        []byte
+	contentType string
+	err         error
+}
+
+// resolve returns the absolute URL of a request, or an error if the
+// same-origin policy forbids it.
+func (n *network) resolve(rawURL string) (string, error) {
+	resolved := rawURL
+	if n.baseURL != "" {
+		resolved = stdnet.ResolveURL(n.baseURL, rawURL)
+	}
+	if n.sameOrigin && n.baseURL != "" && origin(resolved) != origin(n.baseURL) {
+		return "", fmt.Errorf("cross-origin request to %s blocked", resolved)
+	}
+	return resolved, nil
+}
+
+// origin returns the scheme and host of a URL. File paths have an empty
+// origin, so they are all same-origin with each other.
+func origin(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return strings.ToLower(u.Scheme) + "://" + strings.ToLower(u.Host)
+}
+
+// startFetch requests a URL and calls done with the result. An async
+// request is made on another goroutine and done runs when the event loop
+// next drains completions; a sync one calls done before returning.
+func (ctx *domContext) startFetch(rawURL string, async bool, done func(fetchResult)) {
+	n := ctx.network
+	if n == nil {
+		n = &network{}
+	}
+	fetcher := n.fetcher
+	if fetcher == nil {
+		fetcher = networkFetcher
+	}
+
+	fetch := func() fetchResult {
+		if stdnet.IsDataURL(rawURL) {
+			// Data URLs carry their content and need no fetcher
+			body, contentType, err := stdnet.DecodeDataURL(rawURL)
+			return fetchResult{url: rawURL, body: body, contentType: contentType, err: err}
+		}
+		resolved, err := n.resolve(rawURL)
+		if err != nil {
+			return fetchResult{url: rawURL, err: err}
+		}
+		body, contentType, err := fetcher.Fetch(n.requestContext(), resolved)
+		return fetchResult{url: resolved, body: body, contentType: contentType, err: err}
+	}
+	if !async {
+		done(fetch())
+		return
+	}
+	ctx.inFlight++
+	go func() {
+		result := fetch()
+		ctx.completions <- func() { done(result) }
+	}()
+}
+
+// runCompletions runs the callbacks of requests that have finished,
+// without waiting for ones still in flight.
+func (ctx *domContext) runCompletions() {
+	for {
+		select {
+		case f := <-ctx.completions:
+			ctx.inFlight--
+			ctx.runTask(f)
+		default:
+			return
+		}
+	}
+}
+
+// runTask runs f as a task of its own. It is called through the runtime so
+// promise reactions it triggers run when it returns.
+func (ctx *domContext) runTask(f func()) {
+	fn, _ := goja.AssertFunction(ctx.vm.ToValue(func(goja.FunctionCall) goja.Value {
+		f()
+		return goja.Undefined()
+	}))
+	if _, err := fn(goja.Undefined()); err != nil {
+		ctx.errs = append(ctx.errs, err)
+	}
+}
+
+// registerFetch defines fetch() and the XMLHttpRequest constructor. Only
+// GET requests are supported. The fetcher reports non-2xx responses as
+// errors, so fetch() rejects on them rather than resolving with ok false.
+func registerFetch(ctx *domContext) {
+	vm := ctx.vm
+	vm.Set("fetch", func(call goja.FunctionCall) goja.Value {
+		promise, resolve, reject := vm.NewPromise()
+		input := call.Argument(0)
+		if obj, ok := input.(*goja.Object); ok && obj.Get("url") != nil {
+			input = obj.Get("url") // A Request-like object
+		}
+		if method := requestMethod(vm, call.Argument(1)); method != "GET" {
+			reject(vm.NewTypeError("Failed to fetch: unsupported method " + method))
+			return vm.ToValue(promise)
+		}
+		ctx.startFetch(input.String(), true, func(r fetchResult) {
+			if r.err != nil {
+				reject(vm.NewTypeError("Failed to fetch: " + r.err.Error()))
+				return
+			}
+			resolve(ctx.newResponse(r))
+		})
+		return vm.ToValue(promise)
+	})
+	vm.Set("XMLHttpRequest", func(call goja.ConstructorCall) *goja.Object {
+		return ctx.newXHR(call.This)
+	})
+}
+
+// requestMethod returns the uppercased method of a fetch init object.
+func requestMethod(vm *goja.Runtime, init goja.Value) string {
+	if goja.IsUndefined(init) || goja.IsNull(init) {
+		return "GET"
+	}
+	if m := init.ToObject(vm).Get("method"); m != nil && !goja.IsUndefined(m) {
+		return strings.ToUpper(m.String())
+	}
+	return "GET"
+}
+
+// newResponse creates the Response object a fetch() promise resolves to.
+func (ctx *domContext) newResponse(r fetchResult) *goja.Object {
+	vm := ctx.vm
+	resp := vm.NewObject()
+	resp.Set("ok", true)
+	resp.Set("status", 200)
+	resp.Set("statusText", "OK")
+	resp.Set("url", r.url)
+	resp.Set("type", "basic")
+	resp.Set("redirected", false)
+
+	headers := vm.NewObject()
+	header := func(call goja.FunctionCall) (string, bool) {
+		if strings.EqualFold(call.Argument(0).String(), "content-type") && r.contentType != "" {
+			return r.contentType, true
+		}
+		return "", false
+	}
+	headers.Set("get", func(call goja.FunctionCall) goja.Value {
+		if v, ok := header(call); ok {
+			return vm.ToValue(v)
+		}
+		return goja.Null()
+	})
+	headers.Set("has", func(call goja.FunctionCall) goja.Value {
+		_, ok := header(call)
+		return vm.ToValue(ok)
+	})
+	resp.Set("headers", headers)
+
+	text := string(r.body)
+	resp.Set("text", func(goja.FunctionCall) goja.Value {
+		promise, resolve, _ := vm.NewPromise()
+		resolve(text)
+		return vm.ToValue(promise)
+	})
+	resp.Set("json", func(goja.FunctionCall) goja.Value {
+		promise, resolve, reject := vm.NewPromise()
+		if v, err := parseJSON(vm, text); err != nil {
+			reject(err)
+		} else {
+			resolve(v)
+		}
+		return vm.ToValue(promise)
+	})
+	return resp
+}
+
+// parseJSON parses text with JSON.parse. On failure it returns the
+// SyntaxError thrown, as a value to reject a promise with.
+func parseJSON(vm *goja.Runtime, text string) (goja.Value, goja.Value) {
+	parse, _ := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("parse"))
+	v, err := parse(goja.Undefined(), vm.ToValue(text))
+	if err != nil {
+		if ex, ok := err.(*goja.Exception); ok {
+			return nil, ex.Value()
+		}
+		return nil, vm.NewGoError(err)
+	}
+	return v, nil
+}
+
+// XMLHttpRequest ready states.
+const (
+	xhrUnsent = 0
+	xhrOpened = 1
+	xhrDone   = 4
+)
+
+// newXHR initializes an XMLHttpRequest object. It is an event target for
+// readystatechange, load, error, and loadend, which are dispatched like
+// DOM events through ctx.listeners and the object's on<type> properties.
+func (ctx *domContext) newXHR(xhr *goja.Object) *goja.Object {
+	vm := ctx.vm
+	var method, rawURL, contentType string
+	async := true
+
+	setState := func(state int) {
+		xhr.Set("readyState", state)
+		ctx.dispatch(xhr, ctx.newEvent("readystatechange", false, false, true))
+	}
+	xhr.Set("readyState", xhrUnsent)
+	xhr.Set("status", 0)
+	xhr.Set("statusText", "")
+	xhr.Set("responseText", "")
+	xhr.Set("response", "")
+	xhr.Set("responseURL", "")
+	xhr.Set("responseType", "")
+	registerEventTarget(ctx, xhr)
+
+	xhr.Set("open", func(call goja.FunctionCall) goja.Value {
+		method = strings.ToUpper(call.Argument(0).String())
+		rawURL = call.Argument(1).String()
+		async = goja.IsUndefined(call.Argument(2)) || call.Argument(2).ToBoolean()
+		setState(xhrOpened)
+		return goja.Undefined()
+	})
+	xhr.Set("setRequestHeader", func(goja.FunctionCall) goja.Value {
+		return goja.Undefined()
+	})
+	xhr.Set("getResponseHeader", func(call goja.FunctionCall) goja.Value {
+		if strings.EqualFold(call.Argument(0).String(), "content-type") && contentType != "" {
+			return vm.ToValue(contentType)
+		}
+		return goja.Null()
+	})
+	xhr.Set("abort", func(goja.FunctionCall) goja.Value {
+		return goja.Undefined()
+	})
+	xhr.Set("send", func(goja.FunctionCall) goja.Value {
+		if method != "GET" {
+			panic(vm.NewTypeError("XMLHttpRequest: unsupported method " + method))
+		}
+		ctx.startFetch(rawURL, async, func(r fetchResult) {
+			typ := "load"
+			if r.err != nil {
+				typ = "error"
+			} else {
+				xhr.Set("status", 200)
+				xhr.Set("statusText", "OK")
+				xhr.Set("responseURL", r.url)
+				xhr.Set("responseText", string(r.body))
+				contentType = r.contentType
+				response := vm.ToValue(string(r.body))
+				if xhr.Get("responseType").String() == "json" {
+					if response, _ = parseJSON(vm, string(r.body)); response == nil {
+						response = goja.Null()
+					}
+				}
+				xhr.Set("response", response)
+			}
+			setState(xhrDone)
+			ctx.dispatch(xhr, ctx.newEvent(typ, false, false, true))
+			ctx.dispatch(xhr, ctx.newEvent("loadend", false, false, true))
+		})
+		return goja.Undefined()
+	})
+	return xhr
+}
@@ -0,0 +1,176 @@
+package js
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// mapFetcher serves fixed bodies by URL.
+func mapFetcher(bodies map[string]string) Fetcher {
+	return FetcherFunc(func(_ context.Context, uri string) ([]byte, string, error) {
+		body, ok := bodies[uri]
+		if !ok {
+			return nil, "", fmt.Errorf("HTTP 404 fetching %s", uri)
+		}
+		return []byte(body), "application/json", nil
+	})
+}
+
+func TestFetchJSON(t *testing.T) {
+	doc := parseHTML(t, `<ul id="list"></ul>`)
+	engine := New()
+	engine.SetBaseURL("https://example.com/app/index.html")
+	engine.SetFetcher(mapFetcher(map[string]string{
+		"https://example.com/app/items.json": `["a", "b"]`,
+	}))
+	doc.Scripts = append(doc.Scripts, `
+		fetch("items.json")
+			.then(function(r) {
+				if (!r.ok || r.headers.get("Content-Type") !== "application/json") throw new Error("response");
+				return r.json();
+			})
+			.then(function(items) {
+				var list = document.getElementById("list");
+				items.forEach(function(item) {
+					var li = document.createElement("li");
+					li.textContent = item;
+					list.appendChild(li);
+				});
+			});
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.RunUntilIdle(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	list := getElementById(doc.Root, "list")
+	if got := list.TextContent(); got != "ab" {
+		t.Errorf("list text = %q, want %q", got, "ab")
+	}
+	if !engine.Idle() {
+		t.Error("engine should be idle after the request completed")
+	}
+}
+
+func TestFetchSameOrigin(t *testing.T) {
+	doc := parseHTML(t, `<p id="p"></p>`)
+	engine := New()
+	engine.SetBaseURL("https://example.com/")
+	engine.SetSameOrigin(true)
+	engine.SetFetcher(mapFetcher(map[string]string{
+		"https://other.org/data": `{}`,
+	}))
+	doc.Scripts = append(doc.Scripts, `
+		fetch("https://other.org/data").then(
+			function() { document.getElementById("p").textContent = "fetched"; },
+			function(e) { document.getElementById("p").textContent = e.name; });
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.RunUntilIdle(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if got := getElementById(doc.Root, "p").TextContent(); got != "TypeError" {
+		t.Errorf("cross-origin fetch: %q, want TypeError rejection", got)
+	}
+}
+
+func TestXMLHttpRequest(t *testing.T) {
+	doc := parseHTML(t, `<p id="async"></p><p id="sync"></p>`)
+	engine := New()
+	engine.SetFetcher(mapFetcher(map[string]string{
+		"/greeting": `{"text": "hello"}`,
+	}))
+	doc.Scripts = append(doc.Scripts, `
+		var xhr = new XMLHttpRequest();
+		xhr.responseType = "json";
+		xhr.onload = function() {
+			document.getElementById("async").textContent = xhr.response.text + " " + xhr.readyState;
+		};
+		xhr.open("GET", "/greeting");
+		xhr.send();
+
+		var sync = new XMLHttpRequest();
+		sync.open("GET", "/greeting", false);
+		sync.send();
+		document.getElementById("sync").textContent = String(sync.status);
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	if got := getElementById(doc.Root, "sync").TextContent(); got != "200" {
+		t.Errorf("sync status = %q", got)
+	}
+	if err := engine.RunUntilIdle(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if got := getElementById(doc.Root, "async").TextContent(); got != "hello 4" {
+		t.Errorf("async response = %q", got)
+	}
+}
+
+func TestFetchDataURL(t *testing.T) {
+	doc := parseHTML(t, `<p id="p"></p>`)
+	engine := New()
+	engine.SetBaseURL("https://example.com/")
+	engine.SetSameOrigin(true)
+	engine.SetFetcher(mapFetcher(nil))
+	doc.Scripts = append(doc.Scripts, `
+		fetch("data:application/json;base64,eyJvayI6IHRydWV9")
+			.then(function(r) { return r.json(); })
+			.then(function(v) { document.getElementById("p").textContent = String(v.ok); });
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.RunUntilIdle(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if got := getElementById(doc.Root, "p").TextContent(); got != "true" {
+		t.Errorf("data URL fetch: %q", got)
+	}
+}
+
+func TestSetContextCancels(t *testing.T) {
+	doc := parseHTML(t, `<p id="p"></p>`)
+	ctx, cancel := context.WithCancel(context.Background())
+	engine := New()
+	engine.SetContext(ctx)
+	engine.SetFetcher(FetcherFunc(func(ctx context.Context, uri string) ([]byte, string, error) {
+		<-ctx.Done() // A response that never arrives
+		return nil, "", ctx.Err()
+	}))
+	doc.Scripts = append(doc.Scripts, `fetch("https://example.com/slow")`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+
+	// Canceling stops the wait for the request
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	if err := engine.RunUntilIdle(time.Minute); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the cancellation, got %v", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("expected RunUntilIdle to return when canceled, took %v", d)
+	}
+
+	// and interrupts scripts, running or still to run
+	busy := New()
+	busyCtx, cancelBusy := context.WithCancel(context.Background())
+	busy.SetContext(busyCtx)
+	doc = parseHTML(t, `<p id="p"></p>`)
+	doc.Scripts = append(doc.Scripts, `while (true) {}`, `document.getElementById("p").textContent = "ran"`)
+	time.AfterFunc(20*time.Millisecond, cancelBusy)
+	if err := busy.Execute(doc); err == nil {
+		t.Error("expected the interrupted script's error")
+	}
+	if got := getElementById(doc.Root, "p").TextContent(); got != "" {
+		t.Errorf("expected no script to run after the interrupt, got %q", got)
+	}
+}
@@ -0,0 +1,191 @@
+package js
+
+import (
+	"net/url"
+	"strings"
+
+	stdnet "louis14/std/net"
+
+	"github.com/dop251/goja"
+)
+
+// Navigation is a navigation a script requested, which the embedder
+// carries out: by loading URL, or by moving Delta steps through its
+// history when URL is empty.
+type Navigation struct {
+	URL     string // Absolute URL to show
+	Replace bool   // Replace the current history entry rather than add one
+	Delta   int    // Steps through history (history.go); negative goes back
+}
+
+// TakeNavigation returns the navigation the page's scripts requested since
+// the last call, if any. Only the last request counts, since the page the
+// earlier ones left would have been unloaded.
+func (e *Engine) TakeNavigation() (Navigation, bool) {
+	if e.ctx == nil || e.ctx.navigation == nil {
+		return Navigation{}, false
+	}
+	nav := *e.ctx.navigation
+	e.ctx.navigation = nil
+	return nav, true
+}
+
+// navigate records a navigation to ref, resolved against the document URL.
+// javascript: URLs are ignored.
+func (ctx *domContext) navigate(ref string, replace bool) {
+	ref = strings.TrimSpace(ref)
+	if strings.HasPrefix(strings.ToLower(ref), "javascript:") {
+		return
+	}
+	ctx.navigation = &Navigation{URL: stdnet.ResolveURL(ctx.network.baseURL, ref), Replace: replace}
+}
+
+// registerLocation sets up window.location, document.location, and
+// window.history. Assigning to location, or to its href or hash, requests
+// a navigation, as do location's and history's methods.
+func registerLocation(ctx *domContext) {
+	vm := ctx.vm
+	location := vm.NewDynamicObject(&locationAccessor{ctx: ctx})
+	getter := vm.ToValue(func(call goja.FunctionCall) goja.Value { return location })
+	setter := vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		ctx.navigate(call.Argument(0).String(), false)
+		return goja.Undefined()
+	})
+	ctx.window.DefineAccessorProperty("location", getter, setter, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	ctx.document.DefineAccessorProperty("location", getter, setter, goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	history := vm.NewObject()
+	goFn := func(delta int) {
+		if delta == 0 {
+			ctx.navigate(ctx.network.baseURL, true) // history.go(0) reloads
+			return
+		}
+		ctx.navigation = &Navigation{Delta: delta}
+	}
+	history.Set("back", func(call goja.FunctionCall) goja.Value {
+		goFn(-1)
+		return goja.Undefined()
+	})
+	history.Set("forward", func(call goja.FunctionCall) goja.Value {
+		goFn(1)
+		return goja.Undefined()
+	})
+	history.Set("go", func(call goja.FunctionCall) goja.Value {
+		goFn(int(call.Argument(0).ToInteger()))
+		return goja.Undefined()
+	})
+	vm.Set("history", history)
+}
+
+// locationAccessor implements the Location interface for the document's
+// URL.
+type locationAccessor struct {
+	ctx *domContext
+}
+
+var locationKeys = []string{
+	"href", "origin", "protocol", "host", "hostname", "port", "pathname", "search", "hash",
+	"assign", "replace", "reload", "toString",
+}
+
+// url returns the parsed document URL.
+func (l *locationAccessor) url() *url.URL {
+	u, err := url.Parse(l.ctx.network.baseURL)
+	if err != nil {
+		return &url.URL{}
+	}
+	return u
+}
+
+func (l *locationAccessor) Get(key string) goja.Value {
+	vm := l.ctx.vm
+	u := l.url()
+	switch key {
+	case "href":
+		return vm.ToValue(l.ctx.network.baseURL)
+	case "origin":
+		if u.Scheme == "" || u.Host == "" {
+			return vm.ToValue("null") // Opaque, as for file paths
+		}
+		return vm.ToValue(u.Scheme + "://" + u.Host)
+	case "protocol":
+		if u.Scheme == "" {
+			return vm.ToValue("")
+		}
+		return vm.ToValue(u.Scheme + ":")
+	case "host":
+		return vm.ToValue(u.Host)
+	case "hostname":
+		return vm.ToValue(u.Hostname())
+	case "port":
+		return vm.ToValue(u.Port())
+	case "pathname":
+		return vm.ToValue(u.EscapedPath())
+	case "search":
+		if u.RawQuery == "" {
+			return vm.ToValue("")
+		}
+		return vm.ToValue("?" + u.RawQuery)
+	case "hash":
+		if u.Fragment == "" {
+			return vm.ToValue("")
+		}
+		return vm.ToValue("#" + u.EscapedFragment())
+	case "assign", "replace":
+		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			l.ctx.navigate(call.Argument(0).String(), key == "replace")
+			return goja.Undefined()
+		})
+	case "reload":
+		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			l.ctx.navigate(l.ctx.network.baseURL, true)
+			return goja.Undefined()
+		})
+	case "toString":
+		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			return vm.ToValue(l.ctx.network.baseURL)
+		})
+	}
+	return goja.Undefined()
+}
+
+func (l *locationAccessor) Set(key string, val goja.Value) bool {
+	switch key {
+	case "href":
+		l.ctx.navigate(val.String(), false)
+	case "hash":
+		u := l.url()
+		u.Fragment = strings.TrimPrefix(val.String(), "#")
+		l.ctx.navigate(u.String(), false)
+	case "search":
+		u := l.url()
+		u.RawQuery = strings.TrimPrefix(val.String(), "?")
+		u.Fragment = ""
+		l.ctx.navigate(u.String(), false)
+	case "pathname":
+		u := l.url()
+		u.Path, u.RawPath = val.String(), ""
+		u.Fragment = ""
+		l.ctx.navigate(u.String(), false)
+	default:
+		return false
+	}
+	return true
+}
+
+func (l *locationAccessor) Has(key string) bool {
+	for _, k := range locationKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *locationAccessor) Delete(key string) bool {
+	return false
+}
+
+func (l *locationAccessor) Keys() []string {
+	return locationKeys
+}
@@ -0,0 +1,69 @@
+package js
+
+import "testing"
+
+func TestLocationProperties(t *testing.T) {
+	doc := parseHTML(t, `<p></p>`)
+	engine := New()
+	engine.SetBaseURL("https://example.com:8080/docs/page.html?q=1#intro")
+	doc.Scripts = append(doc.Scripts, `
+		var l = window.location;
+		var got = [l.href, l.origin, l.protocol, l.host, l.hostname, l.port, l.pathname, l.search, l.hash].join("|");
+		var want = "https://example.com:8080/docs/page.html?q=1#intro|https://example.com:8080|https:|example.com:8080|example.com|8080|/docs/page.html|?q=1|#intro";
+		if (got !== want) throw new Error("location: " + got);
+		if (document.location !== location) throw new Error("expected document.location to be window.location");
+		if (String(location) !== location.href) throw new Error("toString: " + String(location));
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	if nav, ok := engine.TakeNavigation(); ok {
+		t.Errorf("expected no navigation, got %+v", nav)
+	}
+}
+
+func TestLocationNavigation(t *testing.T) {
+	tests := []struct {
+		script string
+		want   Navigation
+	}{
+		{`location = "other.html"`, Navigation{URL: "https://example.com/docs/other.html"}},
+		{`location.href = "/root"`, Navigation{URL: "https://example.com/root"}},
+		{`location.assign("https://other.example/")`, Navigation{URL: "https://other.example/"}},
+		{`location.replace("next.html")`, Navigation{URL: "https://example.com/docs/next.html", Replace: true}},
+		{`location.hash = "section-2"`, Navigation{URL: "https://example.com/docs/page.html#section-2"}},
+		{`location.reload()`, Navigation{URL: "https://example.com/docs/page.html", Replace: true}},
+		{`history.back()`, Navigation{Delta: -1}},
+		{`history.go(2)`, Navigation{Delta: 2}},
+		{`location.href = "first.html"; location.href = "second.html"`, Navigation{URL: "https://example.com/docs/second.html"}},
+	}
+	for _, tt := range tests {
+		doc := parseHTML(t, `<p></p>`)
+		engine := New()
+		engine.SetBaseURL("https://example.com/docs/page.html")
+		doc.Scripts = append(doc.Scripts, tt.script)
+		if err := engine.Execute(doc); err != nil {
+			t.Fatalf("%s: %v", tt.script, err)
+		}
+		nav, ok := engine.TakeNavigation()
+		if !ok || nav != tt.want {
+			t.Errorf("%s: expected %+v, got %+v, %v", tt.script, tt.want, nav, ok)
+		}
+		if _, ok := engine.TakeNavigation(); ok {
+			t.Errorf("%s: expected the navigation to be taken once", tt.script)
+		}
+	}
+}
+
+func TestLocationIgnoresJavaScriptURLs(t *testing.T) {
+	doc := parseHTML(t, `<p></p>`)
+	engine := New()
+	engine.SetBaseURL("https://example.com/")
+	doc.Scripts = append(doc.Scripts, `location.href = "javascript:void(0)"`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	if nav, ok := engine.TakeNavigation(); ok {
+		t.Errorf("expected no navigation, got %+v", nav)
+	}
+}
@@ -0,0 +1,305 @@
+package js
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// StorageQuota is the most an origin may store, counted in the UTF-16 code
+// units of its keys and values as browsers count it.
+const StorageQuota = 5 << 20
+
+// saveDelay is how long a Storage waits after a change before saving it, so
+// a script setting many items writes the file once.
+const saveDelay = 500 * time.Millisecond
+
+// errQuotaExceeded is returned by setItem when the item would take its
+// origin past StorageQuota.
+var errQuotaExceeded = errors.New("storage quota exceeded")
+
+// Storage holds the localStorage or sessionStorage items of every origin.
+// A Storage created with a directory saves each origin's items to a file
+// in it, so they outlive the process; otherwise items are kept in memory.
+// Embedders share one Storage between the engines of the pages it should
+// span: a persistent one for localStorage, and one per tab for
+// sessionStorage. Changes are saved shortly after they are made; embedders
+// call Flush before exiting to save the rest. It is safe for concurrent use.
+type Storage struct {
+	mu    sync.Mutex
+	dir   string                  // Directory origins' items are saved in; "" = memory only
+	areas map[string]*storageArea // Items by origin, loaded on first use
+	dirty map[string]bool         // Origins changed since they were saved
+	timer *time.Timer             // Saves the dirty origins; nil if none are
+}
+
+// storageArea is the items of one origin.
+type storageArea struct {
+	items map[string]string
+	size  int // UTF-16 code units of the keys and values
+}
+
+// NewStorage creates a Storage that saves items in dir, or keeps them in
+// memory if dir is empty.
+func NewStorage(dir string) *Storage {
+	return &Storage{dir: dir, areas: make(map[string]*storageArea), dirty: make(map[string]bool)}
+}
+
+// area returns the items of origin, loading them from its file the first
+// time. The caller holds s.mu.
+func (s *Storage) area(origin string) *storageArea {
+	if a, ok := s.areas[origin]; ok {
+		return a
+	}
+	a := &storageArea{items: make(map[string]string)}
+	if s.dir != "" {
+		if data, err := os.ReadFile(s.path(origin)); err == nil {
+			json.Unmarshal(data, &a.items)
+		}
+	}
+	for key, value := range a.items {
+		a.size += itemSize(key, value)
+	}
+	s.areas[origin] = a
+	return a
+}
+
+// itemSize returns the UTF-16 code units an item counts against its
+// origin's quota.
+func itemSize(key, value string) int {
+	return utf16Len(key) + utf16Len(value)
+}
+
+// utf16Len returns the length of s in UTF-16 code units.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n++ // A surrogate pair
+		}
+		n++
+	}
+	return n
+}
+
+// path returns the file origin's items are saved to.
+func (s *Storage) path(origin string) string {
+	return filepath.Join(s.dir, url.QueryEscape(origin)+".json")
+}
+
+// changed schedules origin's items to be saved. The caller holds s.mu.
+func (s *Storage) changed(origin string) {
+	if s.dir == "" {
+		return
+	}
+	s.dirty[origin] = true
+	if s.timer == nil {
+		s.timer = time.AfterFunc(saveDelay, s.Flush)
+	}
+}
+
+// Flush saves the changes not yet saved.
+func (s *Storage) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	for origin := range s.dirty {
+		s.save(origin)
+	}
+	clear(s.dirty)
+}
+
+// save writes origin's items to its file. Items that can't be saved are
+// kept in memory for the rest of the session. The caller holds s.mu.
+func (s *Storage) save(origin string) {
+	data, err := json.Marshal(s.areas[origin].items)
+	if err != nil || os.MkdirAll(s.dir, 0o700) != nil {
+		return
+	}
+	// Write then rename, so a crash never leaves a truncated file
+	tmp := s.path(origin) + ".tmp"
+	if os.WriteFile(tmp, data, 0o600) == nil {
+		os.Rename(tmp, s.path(origin))
+	}
+}
+
+func (s *Storage) getItem(origin, key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.area(origin).items[key]
+	return value, ok
+}
+
+// setItem sets an item of origin. It fails, leaving the items as they were,
+// if the item would take the origin past StorageQuota.
+func (s *Storage) setItem(origin, key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.area(origin)
+	old, ok := a.items[key]
+	if ok && old == value {
+		return nil
+	}
+	size := a.size + itemSize(key, value)
+	if ok {
+		size -= itemSize(key, old)
+	}
+	if size > StorageQuota {
+		return errQuotaExceeded
+	}
+	a.items[key], a.size = value, size
+	s.changed(origin)
+	return nil
+}
+
+func (s *Storage) removeItem(origin, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.area(origin)
+	value, ok := a.items[key]
+	if !ok {
+		return
+	}
+	delete(a.items, key)
+	a.size -= itemSize(key, value)
+	s.changed(origin)
+}
+
+func (s *Storage) clear(origin string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.area(origin).items) == 0 {
+		return
+	}
+	s.areas[origin] = &storageArea{items: make(map[string]string)}
+	s.changed(origin)
+}
+
+// keys returns origin's keys in sorted order, which is the order key(n)
+// numbers them in.
+func (s *Storage) keys(origin string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := s.area(origin).items
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// registerStorage sets up window.localStorage and window.sessionStorage
+// for the origin of the document's URL.
+func registerStorage(ctx *domContext, local, session *Storage) {
+	origin := origin(ctx.network.baseURL)
+	ctx.vm.Set("localStorage", ctx.vm.NewDynamicObject(&storageAccessor{ctx: ctx, storage: local, origin: origin}))
+	ctx.vm.Set("sessionStorage", ctx.vm.NewDynamicObject(&storageAccessor{ctx: ctx, storage: session, origin: origin}))
+}
+
+// storageAccessor implements the Storage interface for one origin. Items
+// can also be read, written, and deleted as properties.
+type storageAccessor struct {
+	ctx     *domContext
+	storage *Storage
+	origin  string
+}
+
+var storageMethods = []string{"length", "key", "getItem", "setItem", "removeItem", "clear"}
+
+func (sa *storageAccessor) Get(key string) goja.Value {
+	vm := sa.ctx.vm
+	switch key {
+	case "length":
+		return vm.ToValue(len(sa.storage.keys(sa.origin)))
+	case "key":
+		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			keys := sa.storage.keys(sa.origin)
+			if i := call.Argument(0).ToInteger(); i >= 0 && i < int64(len(keys)) {
+				return vm.ToValue(keys[i])
+			}
+			return goja.Null()
+		})
+	case "getItem":
+		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			if len(call.Arguments) == 0 {
+				panic(vm.NewTypeError("Failed to execute 'getItem' on 'Storage': 1 argument required"))
+			}
+			if value, ok := sa.storage.getItem(sa.origin, call.Arguments[0].String()); ok {
+				return vm.ToValue(value)
+			}
+			return goja.Null()
+		})
+	case "setItem":
+		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			if len(call.Arguments) < 2 {
+				panic(vm.NewTypeError("Failed to execute 'setItem' on 'Storage': 2 arguments required"))
+			}
+			sa.setItem(call.Arguments[0].String(), call.Arguments[1].String())
+			return goja.Undefined()
+		})
+	case "removeItem":
+		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			if len(call.Arguments) == 0 {
+				panic(vm.NewTypeError("Failed to execute 'removeItem' on 'Storage': 1 argument required"))
+			}
+			sa.storage.removeItem(sa.origin, call.Arguments[0].String())
+			return goja.Undefined()
+		})
+	case "clear":
+		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			sa.storage.clear(sa.origin)
+			return goja.Undefined()
+		})
+	}
+	if value, ok := sa.storage.getItem(sa.origin, key); ok {
+		return vm.ToValue(value)
+	}
+	return goja.Undefined()
+}
+
+func (sa *storageAccessor) Set(key string, val goja.Value) bool {
+	sa.setItem(key, val.String())
+	return true
+}
+
+// setItem sets an item, throwing a QuotaExceededError DOMException if the
+// origin has no room for it.
+func (sa *storageAccessor) setItem(key, value string) {
+	if err := sa.storage.setItem(sa.origin, key, value); err != nil {
+		vm := sa.ctx.vm
+		ex, _ := vm.New(vm.Get("Error"), vm.ToValue("Failed to execute 'setItem' on 'Storage': Setting the value of '"+key+"' exceeded the quota."))
+		ex.Set("name", "QuotaExceededError")
+		ex.Set("code", 22)
+		panic(ex)
+	}
+}
+
+func (sa *storageAccessor) Has(key string) bool {
+	for _, m := range storageMethods {
+		if m == key {
+			return true
+		}
+	}
+	_, ok := sa.storage.getItem(sa.origin, key)
+	return ok
+}
+
+func (sa *storageAccessor) Delete(key string) bool {
+	sa.storage.removeItem(sa.origin, key)
+	return true
+}
+
+func (sa *storageAccessor) Keys() []string {
+	return sa.storage.keys(sa.origin)
+}
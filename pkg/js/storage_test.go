@@ -0,0 +1,146 @@
+package js
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLocalStorageAPI(t *testing.T) {
+	doc := parseHTML(t, `<p id="p"></p>`)
+	engine := New()
+	doc.Scripts = append(doc.Scripts, `
+		if (localStorage.getItem("missing") !== null) throw new Error("expected null for a missing item");
+		localStorage.setItem("b", 2);
+		localStorage.setItem("a", "one");
+		if (localStorage.getItem("b") !== "2") throw new Error("expected values stored as strings");
+		if (localStorage.length !== 2) throw new Error("length: " + localStorage.length);
+		if (localStorage.key(0) !== "a" || localStorage.key(2) !== null) throw new Error("key()");
+		if (localStorage.a !== "one") throw new Error("expected items readable as properties");
+		localStorage.c = "three";
+		if (localStorage.getItem("c") !== "three") throw new Error("expected property writes to set items");
+		if (Object.keys(localStorage).join() !== "a,b,c") throw new Error("keys: " + Object.keys(localStorage).join());
+		delete localStorage.c;
+		localStorage.removeItem("b");
+		if (localStorage.length !== 1) throw new Error("length after removal: " + localStorage.length);
+		if (window.sessionStorage.length !== 0) throw new Error("expected sessionStorage to be separate");
+		localStorage.clear();
+		if (localStorage.length !== 0) throw new Error("length after clear: " + localStorage.length);
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalStoragePersists(t *testing.T) {
+	dir := t.TempDir()
+	run := func(baseURL, script string) {
+		t.Helper()
+		doc := parseHTML(t, `<p></p>`)
+		engine := New()
+		engine.SetBaseURL(baseURL)
+		store := NewStorage(dir)
+		engine.SetLocalStorage(store)
+		doc.Scripts = append(doc.Scripts, script)
+		if err := engine.Execute(doc); err != nil {
+			t.Fatal(err)
+		}
+		store.Flush()
+	}
+
+	run("https://example.com/a.html", `localStorage.setItem("visits", "1")`)
+	// A new store reading the same directory sees the item
+	run("https://example.com/b.html", `
+		if (localStorage.getItem("visits") !== "1") throw new Error("expected the item to persist, got " + localStorage.getItem("visits"));
+	`)
+	// Other origins don't
+	run("https://other.example/", `
+		if (localStorage.length !== 0) throw new Error("expected another origin's storage to be empty");
+	`)
+}
+
+func TestSessionStorageSharedBetweenEngines(t *testing.T) {
+	session := NewStorage("")
+	for i, script := range []string{
+		`sessionStorage.setItem("step", "1")`,
+		`if (sessionStorage.getItem("step") !== "1") throw new Error("expected the session item")`,
+	} {
+		doc := parseHTML(t, `<p></p>`)
+		engine := New()
+		engine.SetBaseURL("https://example.com/")
+		engine.SetSessionStorage(session)
+		doc.Scripts = append(doc.Scripts, script)
+		if err := engine.Execute(doc); err != nil {
+			t.Fatalf("page %d: %v", i, err)
+		}
+	}
+}
+
+func TestLocalStorageQuota(t *testing.T) {
+	doc := parseHTML(t, `<p></p>`)
+	engine := New()
+	engine.SetBaseURL("https://example.com/")
+	doc.Scripts = append(doc.Scripts, `
+		const half = "x".repeat((5 << 20) / 2 - 1); // Leaving room for the keys
+		localStorage.setItem("a", half);
+		localStorage.setItem("b", half);
+		let err = null;
+		try { localStorage.setItem("c", "xx") } catch (e) { err = e }
+		if (!err || err.name !== "QuotaExceededError" || err.code !== 22) throw new Error("expected a QuotaExceededError, got " + err);
+		if (localStorage.getItem("c") !== null || localStorage.length !== 2) throw new Error("expected the failed item not stored");
+		try { localStorage.c = "xx"; err = null } catch (e) { err = e }
+		if (!err || err.name !== "QuotaExceededError") throw new Error("expected property writes held to the quota");
+
+		// Replacing an item counts only the difference, filling the quota
+		// exactly, and removing one frees its room
+		localStorage.setItem("b", half.slice(1) + "y");
+		localStorage.removeItem("a");
+		localStorage.setItem("c", "xx");
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	// Other origins have their own quota
+	engine.SetBaseURL("https://other.example/")
+	doc = parseHTML(t, `<p></p>`)
+	doc.Scripts = append(doc.Scripts, `localStorage.setItem("big", "x".repeat(4 << 20))`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalStorageSavesOnceAfterChanges(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStorage(dir)
+	for i := 0; i < 100; i++ {
+		if err := store.setItem("https://example.com", "n", string(rune('a'+i%26))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := store.path("https://example.com")
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected no file written yet, got %v", err)
+	}
+
+	// The changes are saved together after saveDelay
+	deadline := time.Now().Add(10 * saveDelay)
+	for {
+		if data, err := os.ReadFile(path); err == nil {
+			if string(data) != `{"n":"v"}` {
+				t.Errorf("expected the last value saved, got %s", data)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the changes saved")
+		}
+		time.Sleep(saveDelay / 10)
+	}
+
+	// Flush saves at once
+	store.removeItem("https://example.com", "n")
+	store.Flush()
+	if data, err := os.ReadFile(path); err != nil || string(data) != "{}" {
+		t.Errorf("expected the removal saved, got %s, %v", data, err)
+	}
+}
@@ -0,0 +1,170 @@
+package js
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// maxTasksPerRun bounds the timer callbacks one RunTasks call executes, so
+// a script that keeps rescheduling itself cannot hang the browser.
+const maxTasksPerRun = 1000
+
+// timer is a callback scheduled with setTimeout or setInterval. Timers run
+// on a virtual clock that advances only when the embedder runs tasks, which
+// keeps rendering deterministic.
+type timer struct {
+	id       int
+	seq      int           // Scheduling order, to break ties between equal due times
+	due      time.Duration // Virtual time at which the timer fires
+	interval time.Duration // Repeat interval for setInterval; zero for setTimeout
+	callback goja.Value
+	args     []goja.Value
+}
+
+// frameCallback is a callback requested with requestAnimationFrame. The
+// embedder runs the queued callbacks once per display frame with RunFrame.
+type frameCallback struct {
+	id       int
+	callback goja.Value
+}
+
+// frameInterval is the virtual time between animation frames when the
+// engine runs frames itself, in RunUntilIdle.
+const frameInterval = 16 * time.Millisecond
+
+// registerTimers defines setTimeout, setInterval, requestAnimationFrame,
+// queueMicrotask, and their cancellation functions.
+func registerTimers(ctx *domContext) {
+	schedule := func(call goja.FunctionCall, repeat bool) goja.Value {
+		if len(call.Arguments) == 0 {
+			return ctx.vm.ToValue(0)
+		}
+		delay := time.Duration(max(0, call.Argument(1).ToInteger())) * time.Millisecond
+		t := &timer{callback: call.Arguments[0]}
+		if len(call.Arguments) > 2 {
+			t.args = call.Arguments[2:]
+		}
+		if repeat {
+			// An interval of zero would fire forever without the clock moving.
+			t.interval = max(delay, time.Millisecond)
+		}
+		ctx.nextTimerID++
+		t.id = ctx.nextTimerID
+		ctx.schedule(t, delay)
+		return ctx.vm.ToValue(t.id)
+	}
+	clear := func(call goja.FunctionCall) goja.Value {
+		id := int(call.Argument(0).ToInteger())
+		ctx.timers = slices.DeleteFunc(ctx.timers, func(t *timer) bool { return t.id == id })
+		return goja.Undefined()
+	}
+	ctx.vm.Set("setTimeout", func(call goja.FunctionCall) goja.Value { return schedule(call, false) })
+	ctx.vm.Set("setInterval", func(call goja.FunctionCall) goja.Value { return schedule(call, true) })
+	ctx.vm.Set("clearTimeout", clear)
+	ctx.vm.Set("clearInterval", clear)
+
+	// Animation frame callbacks wait for the embedder's next frame.
+	ctx.vm.Set("requestAnimationFrame", func(call goja.FunctionCall) goja.Value {
+		if _, ok := goja.AssertFunction(call.Argument(0)); !ok {
+			panic(ctx.vm.NewTypeError("Failed to execute 'requestAnimationFrame': parameter 1 is not of type 'Function'"))
+		}
+		ctx.nextTimerID++
+		ctx.frames = append(ctx.frames, frameCallback{id: ctx.nextTimerID, callback: call.Argument(0)})
+		return ctx.vm.ToValue(ctx.nextTimerID)
+	})
+	ctx.vm.Set("cancelAnimationFrame", func(call goja.FunctionCall) goja.Value {
+		id := int(call.Argument(0).ToInteger())
+		ctx.frames = slices.DeleteFunc(ctx.frames, func(f frameCallback) bool { return f.id == id })
+		return goja.Undefined()
+	})
+
+	// Microtasks share goja's promise job queue, which drains when the
+	// current script or callback returns.
+	ctx.vm.Set("queueMicrotask", func(call goja.FunctionCall) goja.Value {
+		fn, ok := goja.AssertFunction(call.Argument(0))
+		if !ok {
+			panic(ctx.vm.NewTypeError("Failed to execute 'queueMicrotask': parameter 1 is not of type 'Function'"))
+		}
+		promise, resolve, _ := ctx.vm.NewPromise()
+		then, _ := goja.AssertFunction(ctx.vm.ToValue(promise).ToObject(ctx.vm).Get("then"))
+		onFulfilled := ctx.vm.ToValue(func(goja.FunctionCall) goja.Value {
+			if _, err := fn(goja.Undefined()); err != nil {
+				ctx.errs = append(ctx.errs, fmt.Errorf("microtask: %w", err))
+			}
+			return goja.Undefined()
+		})
+		if _, err := then(ctx.vm.ToValue(promise), onFulfilled); err != nil {
+			panic(err)
+		}
+		resolve(goja.Undefined())
+		return goja.Undefined()
+	})
+}
+
+// schedule queues a timer to fire delay after the current virtual time,
+// keeping the queue ordered by due time.
+func (ctx *domContext) schedule(t *timer, delay time.Duration) {
+	ctx.timerSeq++
+	t.seq = ctx.timerSeq
+	t.due = ctx.clock + delay
+	i, _ := slices.BinarySearchFunc(ctx.timers, t, func(a, b *timer) int {
+		if c := cmp.Compare(a.due, b.due); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.seq, b.seq)
+	})
+	ctx.timers = slices.Insert(ctx.timers, i, t)
+}
+
+// runTimers runs the callbacks of finished requests, then advances the
+// virtual clock by d, running the timers that come due in order. Timers
+// scheduled by callbacks run too if they fall within the window.
+func (ctx *domContext) runTimers(d time.Duration) {
+	ctx.runCompletions()
+	until := ctx.clock + d
+	ctx.runDue(until)
+	ctx.clock = max(ctx.clock, until)
+}
+
+// runDue runs the timers due at or before until in order, advancing the
+// virtual clock to each one as it fires.
+func (ctx *domContext) runDue(until time.Duration) {
+	for n := 0; n < maxTasksPerRun && len(ctx.timers) > 0 && ctx.timers[0].due <= until; n++ {
+		t := ctx.timers[0]
+		ctx.timers = ctx.timers[1:]
+		ctx.clock = max(ctx.clock, t.due)
+		if t.interval > 0 {
+			ctx.schedule(t, t.interval)
+		}
+		fn, ok := goja.AssertFunction(t.callback)
+		if !ok {
+			// A string callback is evaluated as code, as in browsers.
+			if _, err := ctx.vm.RunString(t.callback.String()); err != nil {
+				ctx.errs = append(ctx.errs, fmt.Errorf("timer %d: %w", t.id, err))
+			}
+			continue
+		}
+		if _, err := fn(goja.Undefined(), t.args...); err != nil {
+			ctx.errs = append(ctx.errs, fmt.Errorf("timer %d: %w", t.id, err))
+		}
+	}
+}
+
+// runFrame runs the animation frame callbacks queued before it was called,
+// passing each the virtual time in milliseconds. Callbacks they request run
+// in the next frame.
+func (ctx *domContext) runFrame() {
+	frames := ctx.frames
+	ctx.frames = nil
+	now := ctx.vm.ToValue(float64(ctx.clock) / float64(time.Millisecond))
+	for _, f := range frames {
+		fn, _ := goja.AssertFunction(f.callback)
+		if _, err := fn(goja.Undefined(), now); err != nil {
+			ctx.errs = append(ctx.errs, fmt.Errorf("animation frame %d: %w", f.id, err))
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package js
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"louis14/pkg/determinism"
+)
+
+func TestTimersRunInDueOrder(t *testing.T) {
+	doc := parseHTML(t, `<p id="p"></p>`)
+	engine := New()
+	doc.Scripts = append(doc.Scripts, `
+		var p = document.getElementById("p");
+		setTimeout(function() { p.textContent += "c"; }, 50);
+		setTimeout(function(s) { p.textContent += s; }, 0, "a");
+		setTimeout(function() { p.textContent += "b"; }, 10);
+		var cancel = setTimeout(function() { p.textContent += "x"; }, 20);
+		clearTimeout(cancel);
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	p := getElementById(doc.Root, "p")
+	if got := p.TextContent(); got != "a" {
+		t.Errorf("after Execute: %q", got)
+	}
+	if err := engine.RunTasks(20 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.TextContent(); got != "ab" {
+		t.Errorf("after 20ms: %q", got)
+	}
+	if err := engine.RunTasks(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.TextContent(); got != "abc" {
+		t.Errorf("after 1s: %q", got)
+	}
+}
+
+func TestSetInterval(t *testing.T) {
+	doc := parseHTML(t, `<p id="p"></p>`)
+	engine := New()
+	doc.Scripts = append(doc.Scripts, `
+		var n = 0;
+		var id = setInterval(function() {
+			n++;
+			document.getElementById("p").textContent = String(n);
+			if (n === 3) clearInterval(id);
+		}, 10);
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.RunTasks(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if got := getElementById(doc.Root, "p").TextContent(); got != "3" {
+		t.Errorf("interval ran %s times, want 3", got)
+	}
+}
+
+func TestRunUntilIdle(t *testing.T) {
+	doc := parseHTML(t, `<p id="p"></p>`)
+	engine := New()
+	doc.Scripts = append(doc.Scripts, `
+		var p = document.getElementById("p");
+		setTimeout(function() {
+			p.textContent += "a";
+			requestAnimationFrame(function(ts) {
+				if (typeof ts !== "number") throw new Error("frame time");
+				p.textContent += "b";
+				queueMicrotask(function() { p.textContent += "c"; });
+			});
+		}, 100);
+		setTimeout(function() { p.textContent += "late"; }, 60000);
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	if engine.Idle() {
+		t.Fatal("expected pending timers")
+	}
+	if err := engine.RunUntilIdle(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if got := getElementById(doc.Root, "p").TextContent(); got != "abc" {
+		t.Errorf("after RunUntilIdle: %q", got)
+	}
+	if engine.Idle() {
+		t.Error("timer past the deadline should still be pending")
+	}
+}
+
+func TestRequestAnimationFrame(t *testing.T) {
+	doc := parseHTML(t, `<p id="p"></p>`)
+	engine := New()
+	doc.Scripts = append(doc.Scripts, `
+		var p = document.getElementById("p");
+		requestAnimationFrame(function(ts) {
+			if (typeof ts !== "number") throw new Error("frame time");
+			p.textContent += "a";
+			requestAnimationFrame(function() { p.textContent += "b"; });
+		});
+		var cancel = requestAnimationFrame(function() { p.textContent += "x"; });
+		cancelAnimationFrame(cancel);
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	p := getElementById(doc.Root, "p")
+	if err := engine.RunTasks(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.TextContent(); got != "" || !engine.FramePending() {
+		t.Fatalf("expected callbacks to wait for a frame, got %q", got)
+	}
+	if err := engine.RunFrame(); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.TextContent(); got != "a" {
+		t.Errorf("after one frame: %q", got)
+	}
+	if err := engine.RunFrame(); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.TextContent(); got != "ab" || !engine.Idle() {
+		t.Errorf("after two frames: %q (idle %v)", got, engine.Idle())
+	}
+}
+
+func TestRunUntilIdleSettlesAnimation(t *testing.T) {
+	doc := parseHTML(t, `<p id="p">0</p>`)
+	engine := New()
+	doc.Scripts = append(doc.Scripts, `
+		var p = document.getElementById("p");
+		var n = 0;
+		function step() {
+			if (n < 5) p.textContent = String(++n);
+			requestAnimationFrame(step);
+		}
+		requestAnimationFrame(step);
+	`)
+	if err := engine.Execute(doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.RunUntilIdle(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if got := getElementById(doc.Root, "p").TextContent(); got != "5" {
+		t.Errorf("expected the animation to run to its end, got %q", got)
+	}
+	if !engine.FramePending() {
+		t.Error("expected the settled animation's callback to stay pending")
+	}
+}
+
+func TestDeterministicClockAndRandom(t *testing.T) {
+	determinism.Enable()
+	run := func() string {
+		doc := parseHTML(t, `<p id="p"></p>`)
+		engine := New()
+		doc.Scripts = append(doc.Scripts, `
+			var p = document.getElementById("p");
+			p.textContent = Date.now() + " " + new Date().getHours() + " " + Math.random();
+			setTimeout(function() { p.textContent += " " + Date.now(); }, 1500);
+		`)
+		if err := engine.Execute(doc); err != nil {
+			t.Fatal(err)
+		}
+		if err := engine.RunUntilIdle(5 * time.Second); err != nil {
+			t.Fatal(err)
+		}
+		return getElementById(doc.Root, "p").TextContent()
+	}
+	first := run()
+	if second := run(); first != second {
+		t.Errorf("expected identical runs, got %q and %q", first, second)
+	}
+	// The clock starts at the epoch, in UTC, and follows virtual time
+	if !strings.HasPrefix(first, "946684800000 0 0.") || !strings.HasSuffix(first, " 946684801500") {
+		t.Errorf("expected the epoch and then 1.5s later, got %q", first)
+	}
+}
@@ -1,7 +1,36 @@
 package layout
 
+import "louis14/pkg/css"
+
 // Phase 4: Absolute positioning logic
 
+// absoluteAvailableWidth returns the width an absolutely positioned or
+// fixed box laid out inside parent may take, as its margin box, and
+// whether both its left and right are set, so that a box with an auto
+// width fills it (CSS 2.1 §10.3.7): the width of its containing block,
+// the padding box of the nearest positioned ancestor or the viewport, less
+// its left and right offsets.
+func (le *LayoutEngine) absoluteAvailableWidth(style *css.Style, parent *Box) (width float64, stretch bool) {
+	width = le.viewport.width
+	if style.GetPosition() == css.PositionAbsolute {
+		if cb := findPositionedAncestorBox(parent); cb != nil {
+			width = cb.Width - cb.Border.Left - cb.Border.Right
+		}
+	}
+	offset := style.GetPositionOffset()
+	if !offset.HasLeft {
+		if pct, ok := style.GetPercentage("left"); ok {
+			offset.Left, offset.HasLeft = width*pct/100, true
+		}
+	}
+	if !offset.HasRight {
+		if pct, ok := style.GetPercentage("right"); ok {
+			offset.Right, offset.HasRight = width*pct/100, true
+		}
+	}
+	return width - offset.Left - offset.Right, offset.HasLeft && offset.HasRight
+}
+
 // applyAbsolutePositioning positions an absolutely positioned box
 // following CSS 2.1 §10.3.7 (horizontal) and §10.6.4 (vertical)
 func (le *LayoutEngine) applyAbsolutePositioning(box *Box) {
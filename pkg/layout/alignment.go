@@ -5,67 +5,239 @@ import (
 	"louis14/pkg/html"
 )
 
-// applyVerticalAlign applies vertical alignment to a box within a line
-func (le *LayoutEngine) applyVerticalAlign(box *Box, lineY float64, lineHeight float64) {
-	valign := box.Style.GetVerticalAlign()
-	boxHeight := le.getTotalHeight(box)
-
-	switch valign {
-	case css.VerticalAlignTop:
-		// Align top of box with top of line
-		box.Y = lineY
-	case css.VerticalAlignMiddle:
-		// Center box vertically in line
-		box.Y = lineY + (lineHeight-boxHeight)/2
-	case css.VerticalAlignBottom:
-		// Align bottom of box with bottom of line
-		box.Y = lineY + lineHeight - boxHeight
-	case css.VerticalAlignBaseline:
-		// Default - already positioned at baseline (lineY)
-		// Could be enhanced with true baseline alignment in the future
-		box.Y = lineY
-	}
+// lineItemKind distinguishes how an inline-level box is aligned in a line.
+type lineItemKind int
+
+const (
+	lineItemText   lineItemKind = iota // Text run, sitting on its parent's baseline
+	lineItemInline                     // Wrapper box of an inline element
+	lineItemAtomic                     // Atomic inline (inline-block, image), aligned by its margin box
+)
+
+// lineItem is an inline-level box placed on a line, recorded so the line
+// can be aligned on its baseline once all of its boxes are known.
+type lineItem struct {
+	box     *Box
+	kind    lineItemKind
+	parents []*css.Style // Styles of the enclosing inline elements, outermost first
+	content bool         // Whether the box contributes to the line box height
+	shift   float64      // Vertical offset applied by alignLine so far
 }
 
-// applyTextAlign shifts inline children according to text-align property
-func (le *LayoutEngine) applyTextAlign(box *Box, textAlign string, contentWidth float64) {
-	contentLeft := box.X + box.Border.Left + box.Padding.Left
+// alignLine aligns the boxes of a line vertically (CSS 2.1 §10.8.1). Every
+// box is positioned relative to the baseline of its parent inline box
+// according to vertical-align; the line box is then sized to enclose the
+// root inline box's strut and every content box. Boxes were placed at
+// lineTop and are moved from there, so alignLine may be called again as
+// more boxes join the line.
+func (le *LayoutEngine) alignLine(items []*lineItem, root *css.Style, lineTop float64) *LineBox {
+	// Positions are relative to the root inline box's baseline
+	var minTop, maxBottom float64
+	if root != nil {
+		ascent, height, _ := inlineBoxMetrics(root)
+		minTop, maxBottom = -ascent, height-ascent
+	}
 
-	for _, child := range box.Children {
-		if child.Style == nil {
-			continue
+	tops := make([]float64, len(items))
+	heights := make([]float64, len(items))
+	insets := make([]float64, len(items))
+	toLineBox := make([]bool, len(items))
+	for i, it := range items {
+		style := it.box.Style
+		if style == nil {
+			style = root
 		}
-		childDisplay := child.Style.GetDisplay()
-		// Only apply to inline/inline-block children, or text nodes
-		isInline := childDisplay == css.DisplayInline || childDisplay == css.DisplayInlineBlock
-		if child.Node != nil && child.Node.Type == html.TextNode {
-			isInline = true
+		var ascent float64
+		if it.kind == lineItemAtomic {
+			heights[i] = it.box.Margin.Top + it.box.Height + it.box.Margin.Bottom
+			ascent = inlineBlockBaseline(it.box)
+		} else if style != nil {
+			var halfLeading float64
+			ascent, heights[i], halfLeading = inlineBoxMetrics(style)
+			if it.kind == lineItemText {
+				// Text boxes cover the glyphs' content area, within the inline box
+				insets[i] = halfLeading
+				it.box.Height = min(heights[i]-2*halfLeading, heights[i])
+			}
 		}
-		if !isInline {
-			continue
+
+		parent, parentBaseline := root, 0.0
+		for _, ps := range it.parents {
+			pa, ph, _ := inlineBoxMetrics(ps)
+			parentBaseline = alignedTop(ps, parent, parentBaseline, pa, ph) + pa
+			parent = ps
+		}
+		if it.kind == lineItemText {
+			tops[i] = parentBaseline - ascent
+		} else {
+			tops[i] = alignedTop(style, parent, parentBaseline, ascent, heights[i])
 		}
 
-		childTotalWidth := le.getTotalWidth(child)
+		toLineBox[i] = it.kind != lineItemText && alignsToLineBox(style)
+		if it.kind == lineItemAtomic && style != nil {
+			// Table cells and rows standing in for an anonymous table are
+			// placed at the top of the line
+			if d := style.GetDisplay(); d == css.DisplayTableCell || d == css.DisplayTableRow {
+				toLineBox[i] = true
+			}
+		}
+		if it.content && !toLineBox[i] {
+			minTop = min(minTop, tops[i])
+			maxBottom = max(maxBottom, tops[i]+heights[i])
+		}
+	}
 
-		switch textAlign {
-		case "right":
-			dx := contentLeft + contentWidth - childTotalWidth - child.X
-			if dx != 0 {
-				child.X += dx
-				le.shiftChildren(child, dx, 0)
+	// Boxes aligned to the line box's top or bottom may make it taller
+	height := maxBottom - minTop
+	for i, it := range items {
+		if it.content && toLineBox[i] {
+			height = max(height, heights[i])
+		}
+	}
+
+	for i, it := range items {
+		offset := tops[i] - minTop
+		if toLineBox[i] {
+			offset = 0
+			if alignsToLineBox(it.box.Style) && it.box.Style.GetVerticalAlign() == css.VerticalAlignBottom {
+				offset = height - heights[i]
 			}
-		case "center":
-			dx := contentLeft + (contentWidth-childTotalWidth)/2 - child.X
-			if dx != 0 {
-				child.X += dx
-				le.shiftChildren(child, dx, 0)
+		}
+		shift := offset + insets[i]
+		if delta := shift - it.shift; delta != 0 {
+			it.box.Y += delta
+			if it.kind == lineItemAtomic {
+				le.shiftChildren(it.box, 0, delta)
 			}
+			it.shift = shift
+		}
+	}
+
+	line := &LineBox{Y: lineTop, Height: height, BaselineY: -minTop}
+	for _, it := range items {
+		line.Boxes = append(line.Boxes, it.box)
+	}
+	return line
+}
+
+// alignedTop returns the top of a box with the given ascent (distance from
+// its top to its baseline) and height, aligned by style's vertical-align
+// against a parent inline box whose baseline is at parentBaseline. Top and
+// bottom alignment is resolved against the line box by alignLine; here they
+// fall back to baseline alignment.
+func alignedTop(style, parent *css.Style, parentBaseline, ascent, height float64) float64 {
+	if style == nil || parent == nil {
+		return parentBaseline - ascent
+	}
+	parentSize := parent.GetFontSize()
+	switch style.GetVerticalAlign() {
+	case css.VerticalAlignSub:
+		return parentBaseline + parentSize/5 - ascent
+	case css.VerticalAlignSuper:
+		return parentBaseline - parentSize/3 - ascent
+	case css.VerticalAlignTextTop:
+		return parentBaseline - styleFontMetrics(parent).Ascent
+	case css.VerticalAlignTextBottom:
+		return parentBaseline + styleFontMetrics(parent).Descent - height
+	case css.VerticalAlignMiddle:
+		// Center on the parent's baseline plus half its x-height (~0.5em)
+		return parentBaseline - parentSize/4 - height/2
+	}
+	return parentBaseline - style.GetVerticalAlignShift() - ascent
+}
+
+// alignsToLineBox reports whether style aligns its box to the top or
+// bottom of the line box rather than to a parent's baseline.
+func alignsToLineBox(style *css.Style) bool {
+	if style == nil {
+		return false
+	}
+	valign := style.GetVerticalAlign()
+	return valign == css.VerticalAlignTop || valign == css.VerticalAlignBottom
+}
+
+// inlineBoxMetrics returns the layout metrics of an inline box in style's
+// font: the distance from the top of the box to its baseline, its height
+// (the line-height), and the half-leading above the glyphs.
+func inlineBoxMetrics(style *css.Style) (ascent, height, halfLeading float64) {
+	m := styleFontMetrics(style)
+	height = style.GetLineHeight()
+	halfLeading = (height - m.Ascent - m.Descent) / 2
+	return m.Ascent + halfLeading, height, halfLeading
+}
+
+// inlineBlockBaseline returns the distance from the top of an atomic
+// inline's margin box to its baseline: the baseline of its last line box,
+// or the bottom margin edge if it has none or its overflow is not visible
+// (CSS 2.1 §10.8.1).
+func inlineBlockBaseline(box *Box) float64 {
+	bottom := box.Margin.Top + box.Height + box.Margin.Bottom
+	if box.Style != nil && box.Style.GetOverflow() != css.OverflowVisible {
+		return bottom
+	}
+	if baseline, ok := lastLineBaseline(box); ok {
+		return baseline - (box.Y - box.Margin.Top)
+	}
+	return bottom
+}
+
+// lastLineBaseline returns the Y of the baseline of the last in-flow line
+// box in box or its block descendants. Text laid out without line boxes has
+// its baseline where the renderer draws it, an ascent below its top.
+func lastLineBaseline(box *Box) (float64, bool) {
+	if n := len(box.LineBoxes); n > 0 {
+		line := box.LineBoxes[n-1]
+		return line.Y + line.BaselineY, true
+	}
+	if box.Node != nil && box.Node.Type == html.TextNode && len(box.Children) == 0 && box.Style != nil {
+		return box.Y + styleFontMetrics(box.Style).Ascent, true
+	}
+	for i := len(box.Children) - 1; i >= 0; i-- {
+		child := box.Children[i]
+		if outOfFlow(child) {
+			continue
+		}
+		if baseline, ok := lastLineBaseline(child); ok {
+			return baseline, true
 		}
 	}
+	return 0, false
+}
+
+// firstLineBaseline returns the Y of the baseline of the first in-flow line
+// box in box or its block descendants, as lastLineBaseline does the last.
+func firstLineBaseline(box *Box) (float64, bool) {
+	if len(box.LineBoxes) > 0 {
+		line := box.LineBoxes[0]
+		return line.Y + line.BaselineY, true
+	}
+	if box.Node != nil && box.Node.Type == html.TextNode && len(box.Children) == 0 && box.Style != nil {
+		return box.Y + styleFontMetrics(box.Style).Ascent, true
+	}
+	for _, child := range box.Children {
+		if outOfFlow(child) {
+			continue
+		}
+		if baseline, ok := firstLineBaseline(child); ok {
+			return baseline, true
+		}
+	}
+	return 0, false
+}
+
+// outOfFlow reports whether box is absolutely positioned or floated, and so
+// has no say in the baselines of the boxes it's in.
+func outOfFlow(box *Box) bool {
+	if box.Position == css.PositionAbsolute || box.Position == css.PositionFixed {
+		return true
+	}
+	return box.Node != nil && box.Node.Type == html.ElementNode && box.Style != nil &&
+		box.Style.GetFloat() != css.FloatNone
 }
 
 // applyTextAlignToBoxes applies text-align to a slice of boxes instead of box.Children.
-// Groups boxes by line (Y position) and shifts each line as a whole.
+// Groups boxes by line (the parent's line boxes, or Y position for boxes on
+// none) and shifts each line as a whole.
 func (le *LayoutEngine) applyTextAlignToBoxes(boxes []*Box, parentBox *Box, textAlign string, contentWidth float64) {
 	contentLeft := parentBox.X + parentBox.Border.Left + parentBox.Padding.Left
 	contentRight := contentLeft + contentWidth
@@ -78,6 +250,14 @@ func (le *LayoutEngine) applyTextAlignToBoxes(boxes []*Box, parentBox *Box, text
 		maxEnd float64 // rightmost edge
 	}
 
+	// Vertically aligned boxes on the same line have different Ys
+	lineY := make(map[*Box]float64)
+	for _, lb := range parentBox.LineBoxes {
+		for _, b := range lb.Boxes {
+			lineY[b] = lb.Y
+		}
+	}
+
 	var lines []lineGroup
 	for _, child := range boxes {
 		if child == nil || child.Style == nil {
@@ -93,10 +273,14 @@ func (le *LayoutEngine) applyTextAlignToBoxes(boxes []*Box, parentBox *Box, text
 		}
 
 		// Find or create line group for this Y
+		y, ok := lineY[child]
+		if !ok {
+			y = child.Y
+		}
 		found := false
 		childRight := child.X + le.getTotalWidth(child)
 		for i := range lines {
-			if lines[i].y == child.Y {
+			if lines[i].y == y {
 				lines[i].boxes = append(lines[i].boxes, child)
 				if child.X < lines[i].minX {
 					lines[i].minX = child.X
@@ -110,7 +294,7 @@ func (le *LayoutEngine) applyTextAlignToBoxes(boxes []*Box, parentBox *Box, text
 		}
 		if !found {
 			lines = append(lines, lineGroup{
-				y:      child.Y,
+				y:      y,
 				boxes:  []*Box{child},
 				minX:   child.X,
 				maxEnd: childRight,
@@ -0,0 +1,118 @@
+package layout
+
+import (
+	"math"
+	"testing"
+
+	"louis14/pkg/css"
+	"louis14/pkg/html"
+)
+
+// alignTestStyle returns an Ahem style, whose ascent and descent are
+// exactly 0.8em and 0.2em.
+func alignTestStyle(extra string) *css.Style {
+	return css.ParseInlineStyle("font-family: Ahem; font-size: 20px; line-height: 20px; " + extra)
+}
+
+func TestAlignLine_Baseline(t *testing.T) {
+	le := NewLayoutEngine(800, 600)
+	root := alignTestStyle("")
+	text := &Box{Style: root}
+	block := &Box{Style: css.NewStyle(), Height: 50} // No line boxes: baseline is its bottom edge
+
+	line := le.alignLine([]*lineItem{
+		{box: text, kind: lineItemText, content: true},
+		{box: block, kind: lineItemAtomic, content: true},
+	}, root, 0)
+
+	// The inline-block sits on the baseline; the strut's descent hangs below
+	if line.BaselineY != 50 || line.Height != 54 {
+		t.Errorf("Expected baseline 50 and height 54, got %v and %v", line.BaselineY, line.Height)
+	}
+	if text.Y != 34 || block.Y != 0 {
+		t.Errorf("Expected text at 34 and block at 0, got %v and %v", text.Y, block.Y)
+	}
+}
+
+func TestAlignLine_Keywords(t *testing.T) {
+	le := NewLayoutEngine(800, 600)
+	root := alignTestStyle("")
+
+	tests := []struct {
+		valign string
+		expect float64 // Top of the span's inline box relative to the root baseline
+	}{
+		{"baseline", -8},
+		{"super", -8 - 20.0/3},
+		{"sub", -4},
+		{"5px", -13},
+		{"text-top", -16},
+		{"text-bottom", -6},
+		{"middle", -10},
+	}
+	for _, tt := range tests {
+		span := &Box{Style: alignTestStyle("font-size: 10px; line-height: 10px; vertical-align: " + tt.valign)}
+		text := &Box{Style: root}
+		line := le.alignLine([]*lineItem{
+			{box: text, kind: lineItemText, content: true},
+			{box: span, kind: lineItemInline, content: true},
+		}, root, 0)
+
+		if got := span.Y - line.BaselineY; math.Abs(got-tt.expect) > 1e-9 {
+			t.Errorf("vertical-align: %s: expected span top %v, got %v", tt.valign, tt.expect, got)
+		}
+	}
+}
+
+func TestAlignLine_Realign(t *testing.T) {
+	le := NewLayoutEngine(800, 600)
+	root := alignTestStyle("")
+	text := &Box{Style: root}
+	items := []*lineItem{{box: text, kind: lineItemText, content: true}}
+
+	le.alignLine(items, root, 0)
+	if text.Y != 0 {
+		t.Fatalf("Expected text at 0, got %v", text.Y)
+	}
+
+	// A taller box joining the line moves the text down to the new baseline
+	tall := &Box{Style: css.NewStyle(), Height: 40}
+	items = append(items, &lineItem{box: tall, kind: lineItemAtomic, content: true})
+	line := le.alignLine(items, root, 0)
+	if text.Y != 24 || line.Height != 44 {
+		t.Errorf("Expected text at 24 in a 44px line, got %v in %v", text.Y, line.Height)
+	}
+}
+
+func TestInlineBlockBaseline(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0">
+		<div>text <span id="ref">ref</span>
+		<div id="lines" style="display:inline-block;padding:4px"><div>one</div><div>two</div></div>
+		<div id="hidden" style="display:inline-block;overflow:hidden;height:50px;margin-bottom:3px">x</div>
+		<div id="floats" style="display:inline-block;height:40px"><div style="float:left">float</div></div>
+		</div>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(800, 600), doc)
+	ref, lines, hidden, floats := findOnPage(boxes, "ref"), findOnPage(boxes, "lines"), findOnPage(boxes, "hidden"), findOnPage(boxes, "floats")
+	if ref == nil || lines == nil || hidden == nil || floats == nil {
+		t.Fatal("expected the span and the inline-blocks")
+	}
+	ascent, _, _ := inlineBoxMetrics(ref.Style)
+	baseline := ref.Y + ascent
+
+	// The last line of nested blocks sits on the line's baseline
+	if last, ok := lastLineBaseline(lines); !ok || math.Abs(last-baseline) > 1e-9 {
+		t.Errorf("expected the inline-block's last line on the baseline %.1f, got %.1f", baseline, last)
+	}
+	// Hidden overflow puts the bottom margin edge on the baseline
+	if bottom := hidden.Y + hidden.Height + hidden.Margin.Bottom; math.Abs(bottom-baseline) > 1e-9 {
+		t.Errorf("expected the overflow:hidden box's bottom margin edge on the baseline %.1f, got %.1f", baseline, bottom)
+	}
+	// Floats have no line in the flow, so the bottom edge goes on the baseline
+	if bottom := floats.Y + floats.Height; math.Abs(bottom-baseline) > 1e-9 {
+		t.Errorf("expected the bottom of the box holding only a float on the baseline %.1f, got %.1f", baseline, bottom)
+	}
+}
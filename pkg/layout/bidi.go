@@ -0,0 +1,488 @@
+package layout
+
+import (
+	"math"
+
+	"golang.org/x/text/unicode/bidi"
+
+	"louis14/pkg/css"
+	"louis14/pkg/html"
+)
+
+// Bidirectional text (UAX #9, CSS Writing Modes 3 §2).
+//
+// After inline items are collected, resolveBidi runs the bidi algorithm over
+// each paragraph of the item list (the runs between block children and forced
+// breaks) and records every item's resolved embedding level. Text items are
+// split wherever the level changes, so each text item is a single-direction
+// run. When a line is constructed, visualOrder reorders its items (rule L2)
+// and right-to-left text is drawn reversed.
+//
+// Isolates are treated as embeddings, level runs are resolved on their own
+// rather than joined into isolating run sequences, and bracket pairs (N0)
+// are resolved like other neutrals.
+
+// maxBidiDepth is the deepest explicit embedding level (UAX #9 BD2)
+const maxBidiDepth = 125
+
+// bidiChar is one character of a paragraph during resolution.
+type bidiChar struct {
+	class bidi.Class
+	level int // Embedding level, then resolved level
+}
+
+// resolveBidi assigns bidi levels to items in the inline formatting context
+// of a container with the given style, splitting text items at level
+// boundaries. Items are returned unchanged when the context is purely
+// left-to-right.
+func resolveBidi(items []*InlineItem, containerStyle *css.Style) []*InlineItem {
+	base := 0
+	plaintext := false
+	if containerStyle != nil {
+		if containerStyle.GetDirection() == css.DirectionRTL {
+			base = 1
+		}
+		plaintext = containerStyle.GetUnicodeBidi() == css.UnicodeBidiPlaintext
+	}
+	if (base == 0 || plaintext) && !needsBidi(items) {
+		return items
+	}
+
+	resolved := make([]*InlineItem, 0, len(items))
+	start := 0
+	for i := 0; i <= len(items); i++ {
+		// Block children and forced breaks end a paragraph
+		if i < len(items) && items[i].Type != InlineItemBlockChild && items[i].Type != InlineItemControl {
+			continue
+		}
+		resolved = append(resolved, resolveBidiParagraph(items[start:i], base, plaintext)...)
+		if i < len(items) {
+			items[i].BidiLevel = base
+			resolved = append(resolved, items[i])
+		}
+		start = i + 1
+	}
+	return resolved
+}
+
+// needsBidi returns true if items contain right-to-left characters or
+// explicitly right-to-left inline elements.
+func needsBidi(items []*InlineItem) bool {
+	for _, item := range items {
+		switch item.Type {
+		case InlineItemText:
+			for _, r := range item.Text {
+				if r < 0x0590 {
+					continue // Fast path: nothing below Hebrew is right-to-left
+				}
+				p, _ := bidi.LookupRune(r)
+				if c := p.Class(); c == bidi.R || c == bidi.AL || c == bidi.AN {
+					return true
+				}
+			}
+		case InlineItemOpenTag:
+			if item.Style != nil && item.Style.GetDirection() == css.DirectionRTL &&
+				item.Style.GetUnicodeBidi() != css.UnicodeBidiNormal {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolveBidiParagraph resolves the levels of one paragraph of items.
+func resolveBidiParagraph(items []*InlineItem, base int, plaintext bool) []*InlineItem {
+	if plaintext {
+		base = firstStrongLevel(items, base)
+	}
+
+	// Explicit levels (X1-X10): inline elements with unicode-bidi push
+	// embeddings, and overrides force the class of their characters
+	type embedding struct {
+		level    int
+		override bool
+		class    bidi.Class
+	}
+	stack := []embedding{{level: base}}
+	pushed := make(map[*html.Node]bool)
+
+	var chars []bidiChar
+	charStart := make([]int, len(items)) // First character of each item
+	for i, item := range items {
+		charStart[i] = len(chars)
+		top := stack[len(stack)-1]
+		switch item.Type {
+		case InlineItemText:
+			for _, r := range item.Text {
+				p, _ := bidi.LookupRune(r)
+				class := p.Class()
+				if class == bidi.Control || class == bidi.BN {
+					class = bidi.ON // Formatting characters are ignored
+				}
+				if top.override && class != bidi.B && class != bidi.S {
+					class = top.class
+				}
+				chars = append(chars, bidiChar{class: class, level: top.level})
+			}
+		case InlineItemAtomic:
+			// Atomic inlines are neutral, like U+FFFC OBJECT REPLACEMENT CHARACTER
+			chars = append(chars, bidiChar{class: bidi.ON, level: top.level})
+		case InlineItemOpenTag:
+			if item.Style == nil {
+				continue
+			}
+			unicodeBidi := item.Style.GetUnicodeBidi()
+			if unicodeBidi == css.UnicodeBidiNormal {
+				continue
+			}
+			rtl := item.Style.GetDirection() == css.DirectionRTL
+			level := top.level + 1
+			if (level%2 == 1) != rtl {
+				level++
+			}
+			if level > maxBidiDepth {
+				continue
+			}
+			e := embedding{level: level}
+			if unicodeBidi == css.UnicodeBidiBidiOverride || unicodeBidi == css.UnicodeBidiIsolateOverride {
+				e.override = true
+				e.class = bidi.L
+				if rtl {
+					e.class = bidi.R
+				}
+			}
+			stack = append(stack, e)
+			pushed[item.Node] = true
+		case InlineItemCloseTag:
+			if pushed[item.Node] && len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+				delete(pushed, item.Node)
+			}
+		}
+	}
+
+	// Resolve each level run (W1-W7, N1-N2, I1-I2). sos and eos come from the
+	// embedding levels of the neighboring runs, so resolving a run must not
+	// change what the next one sees.
+	prev := base
+	for start := 0; start < len(chars); {
+		level := chars[start].level
+		end := start
+		for end < len(chars) && chars[end].level == level {
+			end++
+		}
+		next := base
+		if end < len(chars) {
+			next = chars[end].level
+		}
+		resolveLevelRun(chars[start:end], level, prev, next)
+		prev = level
+		start = end
+	}
+
+	// Split text items into single-level runs and give every other item the
+	// level of the text it sits against
+	resolved := make([]*InlineItem, 0, len(items))
+	for i, item := range items {
+		end := len(chars)
+		if i+1 < len(items) {
+			end = charStart[i+1]
+		}
+		switch item.Type {
+		case InlineItemText:
+			resolved = append(resolved, splitBidiText(item, chars[charStart[i]:end])...)
+		case InlineItemAtomic:
+			item.BidiLevel = chars[charStart[i]].level
+			resolved = append(resolved, item)
+		case InlineItemCloseTag:
+			// A closing tag belongs with the content before it
+			item.BidiLevel = neighborLevel(chars, charStart[i]-1, charStart[i], base)
+			resolved = append(resolved, item)
+		default:
+			item.BidiLevel = neighborLevel(chars, charStart[i], charStart[i]-1, base)
+			resolved = append(resolved, item)
+		}
+	}
+	return resolved
+}
+
+// firstStrongLevel returns the paragraph level given by the first strong
+// character in items (UAX #9 P2-P3), or base if there is none.
+func firstStrongLevel(items []*InlineItem, base int) int {
+	for _, item := range items {
+		if item.Type != InlineItemText {
+			continue
+		}
+		for _, r := range item.Text {
+			p, _ := bidi.LookupRune(r)
+			switch p.Class() {
+			case bidi.L:
+				return 0
+			case bidi.R, bidi.AL:
+				return 1
+			}
+		}
+	}
+	return base
+}
+
+// neighborLevel returns the level of chars[i], falling back to chars[j] and
+// then base when an index is out of range.
+func neighborLevel(chars []bidiChar, i, j, base int) int {
+	if i >= 0 && i < len(chars) {
+		return chars[i].level
+	}
+	if j >= 0 && j < len(chars) {
+		return chars[j].level
+	}
+	return base
+}
+
+// resolveLevelRun resolves the weak and neutral types of a run of characters
+// at one embedding level and sets their implicit levels. prev and next are
+// the levels on either side of the run, which determine sos and eos.
+func resolveLevelRun(chars []bidiChar, level, prev, next int) {
+	sos := embeddingDirection(max(level, prev))
+	eos := embeddingDirection(max(level, next))
+	n := len(chars)
+
+	// W1: Nonspacing marks take the type of the previous character
+	last := sos
+	for i := range chars {
+		if chars[i].class == bidi.NSM {
+			chars[i].class = last
+		}
+		last = chars[i].class
+	}
+
+	// W2: European numbers after Arabic letters are Arabic numbers
+	// W3: Arabic letters are R
+	last = sos
+	for i := range chars {
+		switch chars[i].class {
+		case bidi.L, bidi.R, bidi.AL:
+			last = chars[i].class
+		case bidi.EN:
+			if last == bidi.AL {
+				chars[i].class = bidi.AN
+			}
+		}
+	}
+	for i := range chars {
+		if chars[i].class == bidi.AL {
+			chars[i].class = bidi.R
+		}
+	}
+
+	// W4: A single separator between two numbers of the same type joins them
+	for i := 1; i < n-1; i++ {
+		before, after := chars[i-1].class, chars[i+1].class
+		switch chars[i].class {
+		case bidi.ES:
+			if before == bidi.EN && after == bidi.EN {
+				chars[i].class = bidi.EN
+			}
+		case bidi.CS:
+			if (before == bidi.EN || before == bidi.AN) && after == before {
+				chars[i].class = before
+			}
+		}
+	}
+
+	// W5: Terminators adjacent to European numbers are European numbers
+	for i := 0; i < n; {
+		if chars[i].class != bidi.ET {
+			i++
+			continue
+		}
+		j := i
+		for j < n && chars[j].class == bidi.ET {
+			j++
+		}
+		if (i > 0 && chars[i-1].class == bidi.EN) || (j < n && chars[j].class == bidi.EN) {
+			for k := i; k < j; k++ {
+				chars[k].class = bidi.EN
+			}
+		}
+		i = j
+	}
+
+	// W6: Remaining separators and terminators are neutral
+	// W7: European numbers in a left-to-right context are L
+	last = sos
+	for i := range chars {
+		switch chars[i].class {
+		case bidi.ES, bidi.ET, bidi.CS:
+			chars[i].class = bidi.ON
+		case bidi.L, bidi.R:
+			last = chars[i].class
+		case bidi.EN:
+			if last == bidi.L {
+				chars[i].class = bidi.L
+			}
+		}
+	}
+
+	// N1: Neutrals between strong types of the same direction take it
+	// N2: Other neutrals take the embedding direction
+	for i := 0; i < n; {
+		if !isBidiNeutral(chars[i].class) {
+			i++
+			continue
+		}
+		j := i
+		for j < n && isBidiNeutral(chars[j].class) {
+			j++
+		}
+		before, after := sos, eos
+		if i > 0 {
+			before = strongDirection(chars[i-1].class)
+		}
+		if j < n {
+			after = strongDirection(chars[j].class)
+		}
+		dir := embeddingDirection(level)
+		if before == after {
+			dir = before
+		}
+		for k := i; k < j; k++ {
+			chars[k].class = dir
+		}
+		i = j
+	}
+
+	// I1-I2: Implicit levels
+	for i := range chars {
+		c := chars[i].class
+		chars[i].level = level
+		if level%2 == 0 {
+			switch c {
+			case bidi.R:
+				chars[i].level++
+			case bidi.AN, bidi.EN:
+				chars[i].level += 2
+			}
+		} else if c == bidi.L || c == bidi.EN || c == bidi.AN {
+			chars[i].level++
+		}
+	}
+}
+
+// embeddingDirection returns the strong type of an embedding level.
+func embeddingDirection(level int) bidi.Class {
+	if level%2 == 1 {
+		return bidi.R
+	}
+	return bidi.L
+}
+
+// strongDirection returns the direction a resolved type counts as for the
+// neutral rules: numbers count as R (UAX #9 N1).
+func strongDirection(c bidi.Class) bidi.Class {
+	if c == bidi.L {
+		return bidi.L
+	}
+	return bidi.R
+}
+
+func isBidiNeutral(c bidi.Class) bool {
+	switch c {
+	case bidi.B, bidi.S, bidi.WS, bidi.ON:
+		return true
+	}
+	return false
+}
+
+// splitBidiText splits a text item into runs of equal resolved level. Each
+// run that is split off or right-to-left gets its own text node, since the
+// renderer draws a text box's node text and right-to-left runs are drawn
+// reversed.
+func splitBidiText(item *InlineItem, chars []bidiChar) []*InlineItem {
+	if len(chars) == 0 {
+		item.BidiLevel = 0
+		return []*InlineItem{item}
+	}
+	var runs []*InlineItem
+	start, i := 0, 0
+	for offset := range item.Text {
+		if i > 0 && chars[i].level != chars[i-1].level {
+			runs = append(runs, textRun(item, start, offset, chars[i-1].level))
+			start = offset
+		}
+		i++
+	}
+	level := chars[len(chars)-1].level
+	if start == 0 && level%2 == 0 {
+		item.BidiLevel = level
+		return []*InlineItem{item}
+	}
+	return append(runs, textRun(item, start, len(item.Text), level))
+}
+
+// textRun returns an item at the given bidi level for the bytes [start, end)
+// of a text item, with its own text node.
+func textRun(item *InlineItem, start, end, level int) *InlineItem {
+	s := item.Text[start:end]
+	node := &html.Node{Type: html.TextNode, Text: s}
+	if item.Node != nil {
+		node.Parent = item.Node.Parent
+	}
+	run := &InlineItem{
+		Type:        InlineItemText,
+		Node:        node,
+		Text:        s,
+		StartOffset: item.StartOffset + start,
+		EndOffset:   item.StartOffset + end,
+		Style:       item.Style,
+		Width:       item.Width,
+		Height:      item.Height,
+		BidiLevel:   level,
+	}
+	if item.Style != nil && (start > 0 || end < len(item.Text)) {
+		run.Width = styledTextWidth(s, item.Style)
+	}
+	return run
+}
+
+// visualOrder returns the items of a line in visual order: from the highest
+// level down to the lowest odd level, every maximal sequence of items at
+// that level or higher is reversed (UAX #9 L2).
+func visualOrder(items []*InlineItem) []*InlineItem {
+	highest, lowestOdd := 0, math.MaxInt
+	for _, item := range items {
+		highest = max(highest, item.BidiLevel)
+		if item.BidiLevel%2 == 1 {
+			lowestOdd = min(lowestOdd, item.BidiLevel)
+		}
+	}
+	if lowestOdd == math.MaxInt {
+		return items
+	}
+	ordered := append([]*InlineItem(nil), items...)
+	for level := highest; level >= lowestOdd; level-- {
+		for i := 0; i < len(ordered); {
+			if ordered[i].BidiLevel < level {
+				i++
+				continue
+			}
+			j := i
+			for j < len(ordered) && ordered[j].BidiLevel >= level {
+				j++
+			}
+			for a, b := i, j-1; a < b; a, b = a+1, b-1 {
+				ordered[a], ordered[b] = ordered[b], ordered[a]
+			}
+			i = j
+		}
+	}
+	return ordered
+}
+
+// visualText returns the text of a text item as drawn: right-to-left runs
+// are reversed with mirrored brackets (UAX #9 L4).
+func visualText(item *InlineItem) string {
+	if item.BidiLevel%2 == 1 {
+		return bidi.ReverseString(item.Text)
+	}
+	return item.Text
+}
@@ -0,0 +1,114 @@
+package layout
+
+import (
+	"testing"
+
+	"louis14/pkg/css"
+	"louis14/pkg/html"
+)
+
+func bidiTextItem(s string) *InlineItem {
+	return &InlineItem{
+		Type:  InlineItemText,
+		Node:  &html.Node{Type: html.TextNode, Text: s},
+		Text:  s,
+		Style: css.NewStyle(),
+	}
+}
+
+func bidiRuns(items []*InlineItem) ([]string, []int) {
+	var texts []string
+	var levels []int
+	for _, item := range items {
+		if item.Type == InlineItemText {
+			texts = append(texts, item.Text)
+			levels = append(levels, item.BidiLevel)
+		}
+	}
+	return texts, levels
+}
+
+func TestResolveBidi_LTRUnchanged(t *testing.T) {
+	item := bidiTextItem("plain text")
+	items := resolveBidi([]*InlineItem{item}, css.NewStyle())
+
+	if len(items) != 1 || items[0] != item || item.BidiLevel != 0 {
+		t.Errorf("Expected left-to-right text to pass through unchanged, got %d items", len(items))
+	}
+}
+
+func TestResolveBidi_MixedText(t *testing.T) {
+	items := resolveBidi([]*InlineItem{bidiTextItem("abc אבג def")}, css.NewStyle())
+
+	texts, levels := bidiRuns(items)
+	expectTexts := []string{"abc ", "אבג", " def"}
+	expectLevels := []int{0, 1, 0}
+	if len(texts) != len(expectTexts) {
+		t.Fatalf("Expected runs %q, got %q", expectTexts, texts)
+	}
+	for i := range texts {
+		if texts[i] != expectTexts[i] || levels[i] != expectLevels[i] {
+			t.Errorf("Run %d: expected %q at level %d, got %q at level %d",
+				i, expectTexts[i], expectLevels[i], texts[i], levels[i])
+		}
+	}
+}
+
+func TestResolveBidi_RTLParagraph(t *testing.T) {
+	rtl := css.ParseInlineStyle("direction: rtl")
+	items := resolveBidi([]*InlineItem{bidiTextItem("אבג abc דהו 123")}, rtl)
+
+	texts, levels := bidiRuns(items)
+	expectTexts := []string{"אבג ", "abc", " דהו ", "123"}
+	expectLevels := []int{1, 2, 1, 2}
+	if len(texts) != len(expectTexts) {
+		t.Fatalf("Expected runs %q, got %q", expectTexts, texts)
+	}
+	for i := range texts {
+		if texts[i] != expectTexts[i] || levels[i] != expectLevels[i] {
+			t.Errorf("Run %d: expected %q at level %d, got %q at level %d",
+				i, expectTexts[i], expectLevels[i], texts[i], levels[i])
+		}
+	}
+
+	// L2: The whole line reverses, with the left-to-right runs kept intact
+	var visual []string
+	for _, item := range visualOrder(items) {
+		visual = append(visual, visualText(item))
+	}
+	expectVisual := []string{"123", " והד ", "abc", " גבא"}
+	for i := range expectVisual {
+		if visual[i] != expectVisual[i] {
+			t.Errorf("Visual run %d: expected %q, got %q", i, expectVisual[i], visual[i])
+		}
+	}
+}
+
+func TestResolveBidi_Override(t *testing.T) {
+	bdo := &html.Node{Type: html.ElementNode, TagName: "bdo"}
+	style := css.ParseInlineStyle("direction: rtl; unicode-bidi: bidi-override")
+	items := resolveBidi([]*InlineItem{
+		{Type: InlineItemOpenTag, Node: bdo, Style: style},
+		bidiTextItem("(abc)"),
+		{Type: InlineItemCloseTag, Node: bdo, Style: style},
+		bidiTextItem(" def"),
+	}, css.NewStyle())
+
+	if len(items) != 4 {
+		t.Fatalf("Expected 4 items, got %d", len(items))
+	}
+	for i, expect := range []int{1, 1, 1, 0} {
+		if items[i].BidiLevel != expect {
+			t.Errorf("Item %d: expected level %d, got %d", i, expect, items[i].BidiLevel)
+		}
+	}
+	if got := visualText(items[1]); got != "(cba)" {
+		t.Errorf("Expected overridden text to draw as %q, got %q", "(cba)", got)
+	}
+
+	// The element's tags reverse with its content
+	visual := visualOrder(items)
+	if visual[0] != items[2] || visual[2] != items[0] || visual[3] != items[3] {
+		t.Errorf("Expected close tag, text, open tag, then trailing text in visual order")
+	}
+}
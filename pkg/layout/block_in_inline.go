@@ -0,0 +1,323 @@
+package layout
+
+import (
+	"strconv"
+
+	"louis14/pkg/css"
+	"louis14/pkg/html"
+)
+
+// Block-in-inline (CSS 2.1 §9.2.1.1)
+//
+// When an inline box contains an in-flow block-level box, the inline is
+// broken around the block: the inline content before and after the block
+// is wrapped in anonymous block boxes, and the inline box is split into
+// pieces, one in each. The first piece keeps the inline's start edge
+// (margin, border and padding) and the last its end edge; the edges where
+// the inline was broken are open.
+//
+// BuildBoxTree makes these boxes with splitInlinesAroundBlocks. Each
+// inline element that contains a block becomes a sequence of continuations
+// — copies of the element holding one run of its inline content, styled
+// without the open edges — with the blocks between them at the top level.
+// The inline layouts then see only inline content inside inlines, and lay
+// each run out as the lines of an anonymous block, so neither needs to
+// track fragments of a box that spans a block.
+//
+// An element with opacity is still painted as one group (CSS Color 3
+// §3.2): its continuations and the blocks between them are composited
+// together, once, with its opacity. Each gets the box of the group as its
+// OpacityGroup, and the continuations don't have the opacity themselves.
+
+// blockInInlineSplit is the result of splitting a container's children.
+type blockInInlineSplit struct {
+	children      []*html.Node
+	styles        map[*html.Node]*css.Style // Styles of the continuations
+	continuations map[*html.Node]*html.Node // Continuation -> the element it is a piece of
+
+	// For the split elements with opacity: piece -> the elements it is a
+	// piece of, innermost first; element -> the split element with
+	// opacity it is inside; and element -> the style of its group's box
+	groups      map[*html.Node][]*html.Node
+	enclosing   map[*html.Node]*html.Node
+	groupStyles map[*html.Node]*css.Style
+}
+
+// splitInlinesAroundBlocks splits the inline children of a block container
+// that contain block-level boxes. It returns nil if no child does.
+func (le *LayoutEngine) splitInlinesAroundBlocks(children []*html.Node, computedStyles map[*html.Node]*css.Style) *blockInInlineSplit {
+	split := false
+	for _, child := range children {
+		if le.isInlineElement(child, computedStyles) && le.containsBlock(child, computedStyles) {
+			split = true
+			break
+		}
+	}
+	if !split {
+		return nil
+	}
+
+	s := &blockInInlineSplit{
+		styles:        make(map[*html.Node]*css.Style),
+		continuations: make(map[*html.Node]*html.Node),
+		groups:        make(map[*html.Node][]*html.Node),
+		enclosing:     make(map[*html.Node]*html.Node),
+		groupStyles:   make(map[*html.Node]*css.Style),
+	}
+	for _, child := range children {
+		if le.isInlineElement(child, computedStyles) && le.containsBlock(child, computedStyles) {
+			s.children = append(s.children, s.splitInline(le, child, computedStyles)...)
+		} else {
+			s.children = append(s.children, child)
+		}
+	}
+	return s
+}
+
+// splitInline returns the continuations of an inline element that contains
+// blocks, with the blocks between them.
+func (s *blockInInlineSplit) splitInline(le *LayoutEngine, node *html.Node, computedStyles map[*html.Node]*css.Style) []*html.Node {
+	// The element's content, with inline children that contain blocks
+	// split in turn
+	var pieces []*html.Node
+	for _, child := range node.Children {
+		if le.isInlineElement(child, computedStyles) && le.containsBlock(child, computedStyles) {
+			pieces = append(pieces, s.splitInline(le, child, computedStyles)...)
+		} else {
+			pieces = append(pieces, child)
+		}
+	}
+
+	// Group the inline content between the blocks into runs
+	var result []*html.Node
+	var runs [][]*html.Node
+	var runIndexes []int // Index of each run's continuation in result
+	var run []*html.Node
+	flush := func() {
+		if hasInlineContent(run) {
+			runs = append(runs, run)
+			runIndexes = append(runIndexes, len(result))
+			result = append(result, nil)
+		}
+		run = nil
+	}
+	for _, piece := range pieces {
+		if s.isBlockLevel(le, piece, computedStyles) {
+			flush()
+			result = append(result, piece)
+			continue
+		}
+		run = append(run, piece)
+	}
+	flush()
+
+	// A run's continuation has the element's start edge if no block comes
+	// before it, and its end edge if none comes after it
+	style := computedStyles[node]
+	for i, run := range runs {
+		index := runIndexes[i]
+		first := !s.anyBlockLevel(le, result[:index], computedStyles)
+		last := !s.anyBlockLevel(le, result[index+1:], computedStyles)
+		continuation := &html.Node{
+			Type:       html.ElementNode,
+			TagName:    node.TagName,
+			Attributes: node.Attributes,
+			Children:   run,
+			Parent:     node.Parent,
+		}
+		s.styles[continuation] = continuationStyle(style, first, last)
+		s.continuations[continuation] = node
+		result[index] = continuation
+	}
+
+	// The pieces are composited together with the element's opacity
+	if style != nil && style.GetOpacity() < 1 {
+		groupStyle := css.AnonymousStyle(style, css.DisplayInline)
+		groupStyle.Set("opacity", strconv.FormatFloat(style.GetOpacity(), 'f', -1, 64))
+		s.groupStyles[node] = groupStyle
+		for _, piece := range result {
+			for _, inner := range s.groups[piece] {
+				if _, ok := s.enclosing[inner]; !ok {
+					s.enclosing[inner] = node
+				}
+			}
+			s.groups[piece] = append(s.groups[piece], node)
+			if _, ok := s.continuations[piece]; ok {
+				s.styles[piece] = withOpacity(s.styles[piece], 1)
+			}
+		}
+	}
+	return result
+}
+
+// groupOpacity gives the boxes laid out for the pieces of the elements
+// split with opacity, among boxes and their descendants, the boxes of the
+// groups they are composited in. container is the box they are laid out
+// in. It must be called before the continuations are restored.
+func (s *blockInInlineSplit) groupOpacity(container *Box, boxes []*Box) {
+	if s == nil || len(s.groups) == 0 {
+		return
+	}
+	groups := make(map[*html.Node]*Box)
+	var group func(element *html.Node) *Box
+	group = func(element *html.Node) *Box {
+		g := groups[element]
+		if g == nil {
+			g = &Box{Node: element, Style: s.groupStyles[element], Parent: container}
+			if outer, ok := s.enclosing[element]; ok {
+				g.OpacityGroup = group(outer)
+			}
+			groups[element] = g
+		}
+		return g
+	}
+	var walk func(boxes []*Box)
+	walk = func(boxes []*Box) {
+		for _, b := range boxes {
+			if b == nil {
+				continue
+			}
+			if elements := s.groups[b.Node]; len(elements) > 0 {
+				b.OpacityGroup = group(elements[0])
+				for _, element := range elements {
+					g := group(element)
+					g.Children = append(g.Children, b)
+				}
+			}
+			walk(b.Children)
+		}
+	}
+	walk(boxes)
+}
+
+// anyBlockLevel reports whether any of the nodes is block-level; nil
+// entries are continuations not made yet.
+func (s *blockInInlineSplit) anyBlockLevel(le *LayoutEngine, nodes []*html.Node, computedStyles map[*html.Node]*css.Style) bool {
+	for _, n := range nodes {
+		if n != nil && s.isBlockLevel(le, n, computedStyles) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBlockLevel is LayoutEngine.isBlockLevel for the pieces of a split:
+// continuations are inline, and have no style in the computed styles.
+func (s *blockInInlineSplit) isBlockLevel(le *LayoutEngine, node *html.Node, computedStyles map[*html.Node]*css.Style) bool {
+	if _, ok := s.continuations[node]; ok {
+		return false
+	}
+	return le.isBlockLevel(node, computedStyles)
+}
+
+// continuationStyle returns the style of a piece of a split inline: the
+// inline's style without the margin, border and padding of the edges where
+// it was broken.
+func continuationStyle(style *css.Style, first, last bool) *css.Style {
+	if style == nil {
+		style = css.NewStyle()
+	}
+	if first && last {
+		return style
+	}
+	piece := css.NewStyle()
+	piece.ViewportWidth, piece.ViewportHeight, piece.RootFontSize = style.ViewportWidth, style.ViewportHeight, style.RootFontSize
+	piece.Fonts = style.Fonts
+	for property, value := range style.Properties {
+		piece.Properties[property] = value
+	}
+	open := func(side string) {
+		piece.Set("margin-"+side, "0")
+		piece.Set("padding-"+side, "0")
+		piece.Set("border-"+side+"-width", "0")
+		piece.Set("border-"+side+"-style", "none")
+	}
+	if !first {
+		open("left")
+	}
+	if !last {
+		open("right")
+	}
+	return piece
+}
+
+// withOpacity returns a copy of style with the given opacity.
+func withOpacity(style *css.Style, opacity float64) *css.Style {
+	s := css.NewStyle()
+	s.ViewportWidth, s.ViewportHeight, s.RootFontSize = style.ViewportWidth, style.ViewportHeight, style.RootFontSize
+	s.Fonts = style.Fonts
+	for property, value := range style.Properties {
+		s.Properties[property] = value
+	}
+	s.Set("opacity", strconv.FormatFloat(opacity, 'f', -1, 64))
+	return s
+}
+
+// hasInlineContent reports whether a run of inline content has anything
+// but collapsible white space, and so lines of its own.
+func hasInlineContent(run []*html.Node) bool {
+	for _, n := range run {
+		if n.Type != html.TextNode || !isWhitespaceOnly(n.Text) {
+			return true
+		}
+	}
+	return false
+}
+
+// isInlineElement reports whether a node is a non-replaced element with
+// display inline.
+func (le *LayoutEngine) isInlineElement(node *html.Node, computedStyles map[*html.Node]*css.Style) bool {
+	if node.Type != html.ElementNode || node.TagName == "br" || isImageElement(node) {
+		return false
+	}
+	style := le.nodeStyle(node, computedStyles)
+	return style.GetDisplay() == css.DisplayInline && style.GetFloat() == css.FloatNone && !isOutOfFlow(style)
+}
+
+// isBlockLevel reports whether a node is an in-flow block-level box, which
+// an inline containing it is broken around.
+func (le *LayoutEngine) isBlockLevel(node *html.Node, computedStyles map[*html.Node]*css.Style) bool {
+	if node.Type != html.ElementNode {
+		return false
+	}
+	style := le.nodeStyle(node, computedStyles)
+	if style.GetFloat() != css.FloatNone || isOutOfFlow(style) {
+		return false
+	}
+	switch style.GetDisplay() {
+	case css.DisplayBlock, css.DisplayTable, css.DisplayListItem, css.DisplayFlex:
+		return true
+	}
+	return false
+}
+
+// containsBlock reports whether an inline element has an in-flow
+// block-level box among the inline content inside it.
+func (le *LayoutEngine) containsBlock(node *html.Node, computedStyles map[*html.Node]*css.Style) bool {
+	for _, child := range node.Children {
+		if le.isBlockLevel(child, computedStyles) {
+			return true
+		}
+		if le.isInlineElement(child, computedStyles) && le.containsBlock(child, computedStyles) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeStyle returns a node's computed style, computing it if the map
+// doesn't have it yet.
+func (le *LayoutEngine) nodeStyle(node *html.Node, computedStyles map[*html.Node]*css.Style) *css.Style {
+	if style := computedStyles[node]; style != nil {
+		return style
+	}
+	style := css.ComputeStyle(node, le.stylesheets, le.media())
+	computedStyles[node] = style
+	return style
+}
+
+// isOutOfFlow reports whether a style takes its box out of flow.
+func isOutOfFlow(style *css.Style) bool {
+	position := style.GetPosition()
+	return position == css.PositionAbsolute || position == css.PositionFixed
+}
@@ -0,0 +1,519 @@
+package layout
+
+import (
+	"strings"
+
+	"louis14/pkg/css"
+	"louis14/pkg/html"
+)
+
+// Box tree construction
+//
+// Layout runs in stages: the cascade computes the style of every element,
+// BuildBoxTree turns the styled document into the tree of boxes CSS lays
+// out, and the layout modes lay that tree out. Building the tree is where
+// the boxes the document doesn't spell out are made:
+//
+//   - display: none elements and their subtrees generate no boxes
+//   - an inline that contains blocks is split around them into
+//     continuations (CSS 2.1 §9.2.1.1, see block_in_inline.go)
+//   - the inline content of a block container that also holds blocks is
+//     wrapped in anonymous block boxes (CSS 2.1 §9.2.1.1)
+//   - the text of flex and grid containers is wrapped in anonymous items
+//   - table parts missing from a table's structure are supplied as
+//     anonymous tables, rows and cells (CSS 2.1 §17.2.1)
+//
+// Each box's children are then laid out by the LayoutMode of its kind.
+// The layouts work on document nodes, so every anonymous box is given a
+// node of its own, holding the nodes of its children, for them to lay out
+// in its place; its layout box has no node.
+
+// BoxKind is the kind of box an element, text, or anonymous box generates,
+// which decides how its children are laid out.
+type BoxKind int
+
+const (
+	BoxBlockContainer BoxKind = iota // Holds blocks or lines: block, list-item, inline-block
+	BoxInline                        // Non-replaced inline box
+	BoxReplaced                      // Replaced element: img or inline svg
+	BoxText                          // Text, laid out in its parent's lines
+	BoxFlexContainer                 // Flex container
+	BoxGridContainer                 // Grid container
+	BoxTable                         // Table
+	BoxTableRowGroup                 // Row group: tbody, thead, tfoot
+	BoxTableRow                      // Table row
+	BoxTableCell                     // Table cell, a block container
+	BoxTableColumn                   // Column or column group
+	BoxTableCaption                  // Table caption, a block container
+)
+
+// BoxTreeNode is a box in the box tree.
+type BoxTreeNode struct {
+	Node         *html.Node // Element or text the box is for; nil for anonymous boxes
+	Style        *css.Style
+	Kind         BoxKind
+	InlineLevel  bool // Takes part in its parent's inline formatting context
+	OutOfFlow    bool // Floated or absolutely positioned
+	Continuation bool // One piece of an inline split around blocks
+	Parent       *BoxTreeNode
+	Children     []*BoxTreeNode
+
+	source *html.Node // Node the layout engine lays out: the continuation, not Node
+}
+
+// Anonymous reports whether the box was generated for no element or text.
+func (b *BoxTreeNode) Anonymous() bool {
+	return b.Node == nil
+}
+
+// isBlockContainer reports whether the box's children are laid out as
+// blocks and lines.
+func (b *BoxTreeNode) isBlockContainer() bool {
+	return b.Kind == BoxBlockContainer || b.Kind == BoxTableCell || b.Kind == BoxTableCaption
+}
+
+// BoxTree is the box tree of a document.
+type BoxTree struct {
+	Root *BoxTreeNode // Box of the document node, the initial containing block
+
+	// How the children of each block container are split around blocks;
+	// nil for the containers with no inline to split
+	splits map[*html.Node]*blockInInlineSplit
+	// Continuation -> the element it is a piece of, from all the splits
+	continuations map[*html.Node]*html.Node
+	// Node the layout engine lays out -> its box
+	boxes map[*html.Node]*BoxTreeNode
+}
+
+// BoxTree returns the box tree built by the last Layout, or nil before the
+// first.
+func (le *LayoutEngine) BoxTree() *BoxTree {
+	return le.boxTree
+}
+
+// BuildBoxTree builds the box tree of the document under root from the
+// computed styles. The styles of continuations are added to computedStyles.
+func (le *LayoutEngine) BuildBoxTree(root *html.Node, computedStyles map[*html.Node]*css.Style) *BoxTree {
+	t := newBoxTree()
+	style := computedStyles[root]
+	if style == nil {
+		style = css.NewStyle()
+	}
+	t.Root = &BoxTreeNode{Node: root, Style: style, Kind: BoxBlockContainer, source: root}
+	t.buildChildren(le, t.Root, root, computedStyles)
+	t.addSources(t.Root, computedStyles)
+	return t
+}
+
+// newBoxTree returns a box tree with no root, which builds the boxes of
+// the nodes laid out as they are asked for.
+func newBoxTree() *BoxTree {
+	return &BoxTree{
+		splits:        make(map[*html.Node]*blockInInlineSplit),
+		continuations: make(map[*html.Node]*html.Node),
+		boxes:         make(map[*html.Node]*BoxTreeNode),
+	}
+}
+
+// addSources indexes a box and its descendants by the nodes the layout
+// engine lays out, first giving each anonymous box a node holding its
+// children's, styled with the box's style in computedStyles.
+func (t *BoxTree) addSources(b *BoxTreeNode, computedStyles map[*html.Node]*css.Style) {
+	if b.Anonymous() {
+		b.source = &html.Node{Type: html.ElementNode, Parent: b.Parent.source}
+		computedStyles[b.source] = b.Style
+	}
+	t.boxes[b.source] = b
+	for _, child := range b.Children {
+		t.addSources(child, computedStyles)
+		if b.Anonymous() {
+			b.source.Children = append(b.source.Children, child.source)
+		}
+	}
+}
+
+// box returns the box of a node the layout engine lays out. A node the
+// tree doesn't have, like the synthetic nodes of pseudo-elements, has its
+// box built now, as the child of an anonymous box with the parent node's
+// style.
+func (t *BoxTree) box(le *LayoutEngine, node *html.Node, computedStyles map[*html.Node]*css.Style) *BoxTreeNode {
+	if b, ok := t.boxes[node]; ok {
+		return b
+	}
+	parent := &BoxTreeNode{Style: css.NewStyle(), Kind: BoxBlockContainer}
+	if node.Parent != nil {
+		parent.Style = le.nodeStyle(node.Parent, computedStyles)
+	}
+	b := t.build(le, parent, node, computedStyles)
+	if b == nil {
+		return nil
+	}
+	b.Parent = nil
+	t.addSources(b, computedStyles)
+	return b
+}
+
+// treeBox returns the box of a node the layout engine lays out, from the
+// box tree of the last Layout.
+func (le *LayoutEngine) treeBox(node *html.Node, computedStyles map[*html.Node]*css.Style) *BoxTreeNode {
+	if le.boxTree == nil {
+		le.boxTree = newBoxTree()
+	}
+	return le.boxTree.box(le, node, computedStyles)
+}
+
+// flowSources returns the nodes the layout engine lays out for the
+// children of a block container: those of the children of its anonymous
+// blocks in their place, as the multi-pass pipeline lays out the inline
+// content between blocks in lines itself.
+func (b *BoxTreeNode) flowSources() []*html.Node {
+	sources := make([]*html.Node, 0, len(b.Children))
+	for _, child := range b.Children {
+		if child.Anonymous() && child.Kind == BoxBlockContainer {
+			sources = append(sources, child.flowSources()...)
+			continue
+		}
+		sources = append(sources, child.source)
+	}
+	return sources
+}
+
+// restoreContinuations makes the boxes laid out for continuations those of
+// the elements they are pieces of, so the layout refers to the document.
+func (t *BoxTree) restoreContinuations(boxes []*Box) {
+	for _, b := range boxes {
+		if b == nil {
+			continue
+		}
+		if original, ok := t.continuations[b.Node]; ok {
+			b.Node = original
+		}
+		t.restoreContinuations(b.Children)
+	}
+}
+
+// detachSources takes the nodes given to anonymous boxes off the layout
+// boxes laid out for them.
+func (t *BoxTree) detachSources(boxes []*Box) {
+	for _, b := range boxes {
+		if b == nil {
+			continue
+		}
+		if tb, ok := t.boxes[b.Node]; ok && tb.Anonymous() {
+			b.Node = nil
+		}
+		t.detachSources(b.Children)
+	}
+}
+
+// build returns the box of a node and its subtree, or nil if it generates
+// none.
+func (t *BoxTree) build(le *LayoutEngine, parent *BoxTreeNode, node *html.Node, computedStyles map[*html.Node]*css.Style) *BoxTreeNode {
+	switch node.Type {
+	case html.TextNode:
+		return &BoxTreeNode{Node: node, Style: parent.Style, Kind: BoxText, InlineLevel: true, Parent: parent, source: node}
+	case html.ElementNode:
+	default:
+		return nil
+	}
+
+	style := le.nodeStyle(node, computedStyles)
+	display := style.GetDisplay()
+	if display == css.DisplayNone {
+		return nil
+	}
+	original, continuation := t.continuations[node]
+	if !continuation {
+		original = node
+	}
+	b := &BoxTreeNode{
+		Node:         original,
+		Style:        style,
+		OutOfFlow:    style.GetFloat() != css.FloatNone || isOutOfFlow(style),
+		Continuation: continuation,
+		Parent:       parent,
+		source:       node,
+	}
+	b.Kind, b.InlineLevel = boxKind(node, display)
+	// CSS 2.1 §9.7: Floated and absolutely positioned boxes are blockified,
+	// as are flex and grid items (CSS Flexbox §4)
+	if b.OutOfFlow || parent.Kind == BoxFlexContainer || parent.Kind == BoxGridContainer {
+		b.InlineLevel = false
+		if b.Kind == BoxInline {
+			b.Kind = BoxBlockContainer
+		}
+	}
+	if b.Kind != BoxReplaced {
+		t.buildChildren(le, b, node, computedStyles)
+	}
+	return b
+}
+
+// buildChildren builds the boxes of a node's children into b, adding the
+// anonymous boxes its kind needs.
+func (t *BoxTree) buildChildren(le *LayoutEngine, b *BoxTreeNode, node *html.Node, computedStyles map[*html.Node]*css.Style) {
+	children := node.Children
+	var split *blockInInlineSplit
+	if b.isBlockContainer() {
+		split = le.splitInlinesAroundBlocks(children, computedStyles)
+		t.splits[node] = split
+	}
+	if split != nil {
+		children = split.children
+		for n, style := range split.styles {
+			computedStyles[n] = style
+		}
+		for n, original := range split.continuations {
+			t.continuations[n] = original
+		}
+	}
+
+	var kids []*BoxTreeNode
+	for _, child := range children {
+		if kid := t.build(le, b, child, computedStyles); kid != nil {
+			kids = append(kids, kid)
+		}
+	}
+
+	switch {
+	case b.isBlockContainer():
+		kids = wrapInlineRuns(b, kids)
+		kids = wrapTableParts(b, kids)
+	case b.Kind == BoxFlexContainer || b.Kind == BoxGridContainer:
+		kids = wrapItems(b, kids)
+	case b.Kind == BoxTable:
+		kids = fixTable(b, kids)
+	case b.Kind == BoxTableRowGroup:
+		kids = wrapRuns(b, kids, isTableRow, BoxTableRow, css.DisplayTableRow)
+	case b.Kind == BoxTableRow:
+		kids = wrapRuns(b, kids, isTableCell, BoxTableCell, css.DisplayTableCell)
+	}
+	b.Children = kids
+}
+
+// boxKind returns the kind of box an element with the display generates,
+// and whether it is inline-level.
+func boxKind(node *html.Node, display css.DisplayType) (BoxKind, bool) {
+	if isImageElement(node) {
+		return BoxReplaced, display != css.DisplayBlock
+	}
+	switch display {
+	case css.DisplayInline:
+		return BoxInline, true
+	case css.DisplayInlineBlock:
+		return BoxBlockContainer, true
+	case css.DisplayFlex:
+		return BoxFlexContainer, false
+	case css.DisplayInlineFlex:
+		return BoxFlexContainer, true
+	case css.DisplayGrid:
+		return BoxGridContainer, false
+	case css.DisplayInlineGrid:
+		return BoxGridContainer, true
+	case css.DisplayTable:
+		return BoxTable, false
+	case css.DisplayTableRowGroup, css.DisplayTableHeaderGroup, css.DisplayTableFooterGroup:
+		return BoxTableRowGroup, false
+	case css.DisplayTableRow:
+		return BoxTableRow, false
+	case css.DisplayTableCell:
+		return BoxTableCell, false
+	case css.DisplayTableColumn, css.DisplayTableColumnGroup:
+		return BoxTableColumn, false
+	case css.DisplayTableCaption:
+		return BoxTableCaption, false
+	}
+	return BoxBlockContainer, false
+}
+
+// anonymousBox returns an anonymous box of the kind inside parent holding
+// the children.
+func anonymousBox(parent *BoxTreeNode, kind BoxKind, display css.DisplayType, children []*BoxTreeNode) *BoxTreeNode {
+	b := &BoxTreeNode{Style: css.AnonymousStyle(parent.Style, display), Kind: kind, Parent: parent, Children: children}
+	for _, child := range children {
+		child.Parent = b
+	}
+	return b
+}
+
+// isCollapsibleText reports whether a box is text that is only white
+// space, which generates nothing between blocks or table parts.
+func isCollapsibleText(b *BoxTreeNode) bool {
+	return b.Kind == BoxText && isWhitespaceOnly(b.Node.Text)
+}
+
+// wrapInlineRuns wraps the runs of inline-level boxes in a block container
+// that also holds block-level boxes in anonymous block boxes. Runs with
+// only white space generate no box; the floats and positioned boxes in
+// them stay where they are.
+func wrapInlineRuns(parent *BoxTreeNode, kids []*BoxTreeNode) []*BoxTreeNode {
+	hasBlock := false
+	for _, kid := range kids {
+		if !kid.InlineLevel && !kid.OutOfFlow {
+			hasBlock = true
+			break
+		}
+	}
+	if !hasBlock {
+		return kids
+	}
+
+	var result, run []*BoxTreeNode
+	flush := func() {
+		content := false
+		for _, kid := range run {
+			if kid.InlineLevel && !isCollapsibleText(kid) {
+				content = true
+				break
+			}
+		}
+		if content {
+			result = append(result, anonymousBox(parent, BoxBlockContainer, css.DisplayBlock, run))
+		} else {
+			for _, kid := range run {
+				if kid.OutOfFlow {
+					result = append(result, kid)
+				}
+			}
+		}
+		run = nil
+	}
+	for _, kid := range kids {
+		if kid.InlineLevel || kid.OutOfFlow {
+			run = append(run, kid)
+			continue
+		}
+		flush()
+		result = append(result, kid)
+	}
+	flush()
+	return result
+}
+
+// wrapItems makes each run of text in a flex or grid container an
+// anonymous item; white space between items generates nothing. Items are
+// block-level whatever their display.
+//
+// A run of only white space and no-break spaces makes no item either. The
+// parser drops the white space between tags, so an item that only spaces
+// the others apart would get a gap the same markup laid out inline doesn't.
+func wrapItems(parent *BoxTreeNode, kids []*BoxTreeNode) []*BoxTreeNode {
+	var result, run []*BoxTreeNode
+	flush := func() {
+		for _, kid := range run {
+			if strings.TrimFunc(kid.Node.Text, isItemSpacing) != "" {
+				result = append(result, anonymousBox(parent, BoxBlockContainer, css.DisplayBlock, run))
+				break
+			}
+		}
+		run = nil
+	}
+	for _, kid := range kids {
+		if kid.Kind == BoxText {
+			run = append(run, kid)
+			continue
+		}
+		flush()
+		result = append(result, kid)
+	}
+	flush()
+	return result
+}
+
+// isItemSpacing reports whether r is white space or a no-break space,
+// which text that only spaces flex and grid items apart is made of.
+func isItemSpacing(r rune) bool {
+	return r == '\u00a0' || isCollapsibleWhitespace(r)
+}
+
+// isTableRow and isTableCell report whether a box is the part a row group
+// or row holds.
+func isTableRow(b *BoxTreeNode) bool  { return b.Kind == BoxTableRow }
+func isTableCell(b *BoxTreeNode) bool { return b.Kind == BoxTableCell }
+
+// isTablePart reports whether a box belongs inside a table: a row group,
+// row, cell, column or caption.
+func isTablePart(b *BoxTreeNode) bool {
+	switch b.Kind {
+	case BoxTableRowGroup, BoxTableRow, BoxTableCell, BoxTableColumn, BoxTableCaption:
+		return true
+	}
+	return false
+}
+
+// wrapRuns wraps each run of boxes that fail keep in an anonymous box of
+// the kind. White space at the ends of a run generates nothing, and a run
+// of only white space no box at all (CSS 2.1 §17.2.1).
+func wrapRuns(parent *BoxTreeNode, kids []*BoxTreeNode, keep func(*BoxTreeNode) bool, kind BoxKind, display css.DisplayType) []*BoxTreeNode {
+	var result, run []*BoxTreeNode
+	flush := func() {
+		for len(run) > 0 && isCollapsibleText(run[0]) {
+			run = run[1:]
+		}
+		for len(run) > 0 && isCollapsibleText(run[len(run)-1]) {
+			run = run[:len(run)-1]
+		}
+		if len(run) > 0 {
+			b := anonymousBox(parent, kind, display, run)
+			switch kind {
+			case BoxTableRow:
+				b.Children = wrapRuns(b, b.Children, isTableCell, BoxTableCell, css.DisplayTableCell)
+			case BoxTableCell:
+				b.Children = wrapTableParts(b, wrapInlineRuns(b, b.Children))
+			}
+			result = append(result, b)
+		}
+		run = nil
+	}
+	for _, kid := range kids {
+		if keep(kid) {
+			flush()
+			result = append(result, kid)
+			continue
+		}
+		run = append(run, kid)
+	}
+	flush()
+	return result
+}
+
+// fixTable wraps the children of a table that aren't rows, row groups,
+// columns or captions in anonymous rows.
+func fixTable(table *BoxTreeNode, kids []*BoxTreeNode) []*BoxTreeNode {
+	return wrapRuns(table, kids, func(b *BoxTreeNode) bool {
+		switch b.Kind {
+		case BoxTableRowGroup, BoxTableRow, BoxTableColumn, BoxTableCaption:
+			return true
+		}
+		return false
+	}, BoxTableRow, css.DisplayTableRow)
+}
+
+// wrapTableParts wraps each run of table parts in a block container,
+// which are missing their table, in an anonymous table.
+func wrapTableParts(parent *BoxTreeNode, kids []*BoxTreeNode) []*BoxTreeNode {
+	var result, run []*BoxTreeNode
+	flush := func() {
+		if len(run) > 0 {
+			table := anonymousBox(parent, BoxTable, css.DisplayTable, run)
+			table.InlineLevel = run[0].InlineLevel
+			table.Children = fixTable(table, table.Children)
+			result = append(result, table)
+		}
+		run = nil
+	}
+	for _, kid := range kids {
+		if isTablePart(kid) {
+			run = append(run, kid)
+			continue
+		}
+		// White space between table parts belongs to the table
+		if len(run) > 0 && isCollapsibleText(kid) {
+			continue
+		}
+		flush()
+		result = append(result, kid)
+	}
+	flush()
+	return result
+}
@@ -0,0 +1,203 @@
+package layout
+
+import (
+	"strings"
+	"testing"
+
+	"louis14/pkg/css"
+	"louis14/pkg/html"
+)
+
+// describeBoxTree writes a box and its descendants as one line each,
+// indented by depth: the tag or "text", "anon" for anonymous boxes, and a
+// "+" for continuations.
+func describeBoxTree(b *BoxTreeNode, depth int, sb *strings.Builder) {
+	sb.WriteString(strings.Repeat("  ", depth))
+	switch {
+	case b.Anonymous():
+		sb.WriteString("anon " + b.Style.Properties["display"])
+	case b.Kind == BoxText:
+		sb.WriteString("text " + strings.TrimSpace(b.Node.Text))
+	default:
+		sb.WriteString(b.Node.TagName)
+		if b.Continuation {
+			sb.WriteString("+")
+		}
+	}
+	sb.WriteString("\n")
+	for _, child := range b.Children {
+		if child.Parent != b {
+			sb.WriteString("(wrong parent)\n")
+		}
+		describeBoxTree(child, depth+1, sb)
+	}
+}
+
+func buildTestBoxTree(t *testing.T, body string) *BoxTreeNode {
+	t.Helper()
+	doc, err := html.Parse(`<html><body>` + body + `</body></html>`)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	le := NewLayoutEngine(800, 600)
+	tree := le.BuildBoxTree(doc.Root, css.ApplyStylesToDocument(doc, le.media()))
+	root := tree.Root.Children[0]
+	return root.Children[len(root.Children)-1]
+}
+
+func TestBuildBoxTree(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "inline content beside blocks is wrapped in anonymous blocks",
+			body: `a<div>b</div> <em>c</em> <p>d</p> <span style="float:left">f</span> `,
+			want: `body
+  anon block
+    text a
+  div
+    text b
+  anon block
+    em
+      text c
+  p
+    text d
+  span
+    text f
+`,
+		},
+		{
+			name: "inline content alone is not wrapped",
+			body: `a<em>b</em>`,
+			want: `body
+  text a
+  em
+    text b
+`,
+		},
+		{
+			name: "display none generates no boxes",
+			body: `<div style="display:none"><p>a</p></div><p>b</p>`,
+			want: `body
+  p
+    text b
+`,
+		},
+		{
+			name: "an inline containing a block is split around it",
+			body: `<span>a<div>b</div>c</span>`,
+			want: `body
+  anon block
+    span+
+      text a
+  div
+    text b
+  anon block
+    span+
+      text c
+`,
+		},
+		{
+			name: "table parts missing from the structure are supplied",
+			body: `<div style="display:table"><i style="display:table-cell">a</i> ` +
+				`<p style="display:table-row"><i style="display:table-cell">b</i>c</p></div>`,
+			want: `body
+  div
+    anon table-row
+      i
+        text a
+    p
+      i
+        text b
+      anon table-cell
+        text c
+`,
+		},
+		{
+			name: "cells outside a table get an anonymous table and row",
+			body: `<div style="display:table-cell">a</div> <div style="display:table-cell">b</div>`,
+			want: `body
+  anon table
+    anon table-row
+      div
+        text a
+      div
+        text b
+`,
+		},
+		{
+			name: "text in a flex container is an anonymous item",
+			body: `<div style="display:flex"> a <span>b</span> </div>`,
+			want: `body
+  div
+    anon block
+      text a
+    span
+      text b
+`,
+		},
+		{
+			name: "no-break spaces between flex items make no item",
+			body: `<div style="display:flex"><span>a</span> &nbsp; <span>b</span></div>`,
+			want: `body
+  div
+    span
+      text a
+    span
+      text b
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			describeBoxTree(buildTestBoxTree(t, tt.body), 0, &sb)
+			if got := sb.String(); got != tt.want {
+				t.Errorf("got box tree\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayoutBuildsBoxTree(t *testing.T) {
+	doc, err := html.Parse(`<html><body><span id="s">a<div>b</div></span></body></html>`)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	le := NewLayoutEngine(800, 600)
+	if le.BoxTree() != nil {
+		t.Fatal("expected no box tree before the first layout")
+	}
+	layoutDoc(t, le, doc)
+	tree := le.BoxTree()
+	if tree == nil || tree.Root.Node != doc.Root {
+		t.Fatalf("expected the box tree of the document, got %+v", tree)
+	}
+	// The layout lays out the split the box tree made
+	body := tree.Root.Children[0].Children[len(tree.Root.Children[0].Children)-1]
+	if split := tree.splits[body.Node]; split == nil || len(split.continuations) != 1 {
+		t.Errorf("expected the body's span split once, got %+v", split)
+	} else if le.treeBox(body.Node, nil) != body {
+		t.Error("expected layout to use the box tree's boxes")
+	}
+}
+
+func TestLayoutRootChildrenLikeNested(t *testing.T) {
+	const blocks = `<div id="f" style="float:left; width:150px; height:80px; margin:10px"></div>` +
+		`<div id="a" style="width:300px; height:50px; margin:10px"></div>` +
+		`<div id="b" style="clear:left; width:300px; height:50px; margin:20px 10px"></div>`
+	// The root's children collapse margins and clear floats as a block's do
+	for _, markup := range []string{blocks, `<div style="padding-top:1px">` + blocks + `</div>`} {
+		doc, err := html.Parse(markup)
+		if err != nil {
+			t.Fatalf("parse error: %v", err)
+		}
+		boxes := layoutDoc(t, NewLayoutEngine(800, 600), doc)
+		a, b := findOnPage(boxes, "a"), findOnPage(boxes, "b")
+		if b.Y-a.Y != 90 {
+			t.Errorf("%s: expected the cleared box below the float's margin, 90px below the block before it, got %g", markup[:20], b.Y-a.Y)
+		}
+	}
+}
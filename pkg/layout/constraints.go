@@ -16,42 +16,41 @@ func (es *ExclusionSpace) IsEmpty() bool {
 	return len(es.exclusions) == 0
 }
 
-// AvailableInlineSize returns the horizontal offsets from left and right edges
-// caused by floats at the given Y position and height.
+// overlaps reports whether the exclusion is beside any of the band from y
+// down to y+height; a band without height is the single position y.
+func (e Exclusion) overlaps(y, height float64) bool {
+	top, bottom := e.Rect.Y, e.Rect.Y+e.Rect.Height
+	if height <= 0 {
+		return y >= top && y < bottom
+	}
+	return top < y+height && bottom > y
+}
+
+// Offsets returns how far the floats beside the band from y down to
+// y+height reach into a containing block whose content box spans left to
+// right, from its left and its right edge.
 //
-// For a container with width W:
-// - leftOffset: distance from left edge (sum of left float widths)
-// - rightOffset: distance from right edge (sum of right float widths)
-// - Available width = W - leftOffset - rightOffset
-func (es *ExclusionSpace) AvailableInlineSize(y, height float64) (leftOffset, rightOffset float64) {
+// Floats on a side stack against each other, so the band they leave free is
+// bounded by the furthest of them at this Y, not by their widths. Floats
+// that end before the content box starts don't narrow it.
+func (es *ExclusionSpace) Offsets(y, height, left, right float64) (leftOffset, rightOffset float64) {
 	if es == nil {
 		return 0, 0
 	}
 
-	// Check each exclusion to see if it intersects the given Y range
 	for _, excl := range es.exclusions {
-		// Check if exclusion overlaps vertically with [y, y+height]
-		exclTop := excl.Rect.Y
-		exclBottom := excl.Rect.Y + excl.Rect.Height
-		rangeTop := y
-		rangeBottom := y + height
-
-		// No overlap if exclusion ends before range starts or starts after range ends
-		if exclBottom <= rangeTop || exclTop >= rangeBottom {
+		if !excl.overlaps(y, height) {
 			continue
 		}
-
-		// Overlaps - add to appropriate offset
 		if excl.Side == css.FloatLeft {
-			// Left float: extends from left edge
-			floatRight := excl.Rect.X + excl.Rect.Width
-			if floatRight > leftOffset {
-				leftOffset = floatRight
+			// Left float: reaches in to its right edge
+			if offset := excl.Rect.X + excl.Rect.Width - left; offset > leftOffset {
+				leftOffset = offset
 			}
 		} else if excl.Side == css.FloatRight {
-			// Right float: extends from right edge (excl.Rect.X is already the right edge offset)
-			if excl.Rect.Width > rightOffset {
-				rightOffset = excl.Rect.Width
+			// Right float: reaches in to its left edge
+			if offset := right - excl.Rect.X; offset > rightOffset {
+				rightOffset = offset
 			}
 		}
 	}
@@ -59,6 +58,51 @@ func (es *ExclusionSpace) AvailableInlineSize(y, height float64) (leftOffset, ri
 	return leftOffset, rightOffset
 }
 
+// AvailableInlineSize returns the horizontal offsets from left and right edges
+// caused by floats at the given Y position and height, in a container whose
+// content box starts at X=0.
+//
+// For a container with width W:
+// - leftOffset: distance from left edge (furthest right edge of left floats)
+// - rightOffset: distance from right edge (furthest left edge of right floats)
+// - Available width = W - leftOffset - rightOffset
+//
+// Right floats are placed against the container's right edge or against the
+// right floats before them, so the rightmost of them stands for W; callers
+// that know W use Offsets (or ConstraintSpace.FloatOffsets) instead.
+func (es *ExclusionSpace) AvailableInlineSize(y, height float64) (leftOffset, rightOffset float64) {
+	if es == nil {
+		return 0, 0
+	}
+
+	rightEdge := 0.0
+	for _, excl := range es.exclusions {
+		if excl.Side == css.FloatRight && excl.Rect.X+excl.Rect.Width > rightEdge {
+			rightEdge = excl.Rect.X + excl.Rect.Width
+		}
+	}
+	return es.Offsets(y, height, 0, rightEdge)
+}
+
+// ClearY returns the Y position a box with the given clear property is moved
+// down to from y: the bottom outer edge of the lowest float on the sides it
+// clears, if that is below y (CSS 2.1 §9.5.2).
+func (es *ExclusionSpace) ClearY(clearType css.ClearType, y float64) float64 {
+	if es == nil || clearType == css.ClearNone {
+		return y
+	}
+
+	for _, excl := range es.exclusions {
+		cleared := clearType == css.ClearBoth ||
+			(clearType == css.ClearLeft && excl.Side == css.FloatLeft) ||
+			(clearType == css.ClearRight && excl.Side == css.FloatRight)
+		if bottom := excl.Rect.Y + excl.Rect.Height; cleared && bottom > y {
+			y = bottom
+		}
+	}
+	return y
+}
+
 // NextBandBelowY returns the nearest Y position below the given Y where
 // the available width changes (i.e., below the bottom of a float that
 // overlaps the given Y). Returns -1 if no floats overlap at this Y.
@@ -70,13 +114,12 @@ func (es *ExclusionSpace) NextBandBelowY(y, height float64) float64 {
 
 	nextY := -1.0
 	for _, excl := range es.exclusions {
-		exclBottom := excl.Rect.Y + excl.Rect.Height
 		// Only consider floats that overlap with [y, y+height]
-		if exclBottom <= y || excl.Rect.Y >= y+height {
+		if !excl.overlaps(y, height) {
 			continue
 		}
 		// Find the nearest float bottom above
-		if nextY < 0 || exclBottom < nextY {
+		if exclBottom := excl.Rect.Y + excl.Rect.Height; nextY < 0 || exclBottom < nextY {
 			nextY = exclBottom
 		}
 	}
@@ -124,6 +167,7 @@ func (cs *ConstraintSpace) WithExclusion(exclusion Exclusion) *ConstraintSpace {
 		ExclusionSpace: cs.ExclusionSpace.Add(exclusion),
 		TextAlign:      cs.TextAlign,
 		NoWrap:         cs.NoWrap,
+		TextIndent:     cs.TextIndent,
 	}
 }
 
@@ -137,6 +181,7 @@ func (cs *ConstraintSpace) WithAvailableWidth(width float64) *ConstraintSpace {
 		ExclusionSpace: cs.ExclusionSpace,
 		TextAlign:      cs.TextAlign,
 		NoWrap:         cs.NoWrap,
+		TextIndent:     cs.TextIndent,
 	}
 }
 
@@ -147,54 +192,19 @@ func (cs *ConstraintSpace) WithTextAlign(align css.TextAlign) *ConstraintSpace {
 		ExclusionSpace: cs.ExclusionSpace,
 		TextAlign:      align,
 		NoWrap:         cs.NoWrap,
+		TextIndent:     cs.TextIndent,
 	}
 }
 
+// FloatOffsets returns how far floats reach into the available space from
+// its left and right edges at the given Y position and height.
+func (cs *ConstraintSpace) FloatOffsets(y, height float64) (leftOffset, rightOffset float64) {
+	return cs.ExclusionSpace.Offsets(y, height, 0, cs.AvailableSize.Width)
+}
+
 // AvailableInlineSize returns the available inline size at the given Y position and height,
 // accounting for exclusions (floats).
 func (cs *ConstraintSpace) AvailableInlineSize(y, height float64) float64 {
-	leftOffset, rightOffset := cs.ExclusionSpace.AvailableInlineSize(y, height)
+	leftOffset, rightOffset := cs.FloatOffsets(y, height)
 	return cs.AvailableSize.Width - leftOffset - rightOffset
 }
-
-// constraintsChanged checks if the constraint space changed during fragment construction.
-// This is used to determine if we need to retry line breaking.
-//
-// Returns true if:
-// - Floats were added (exclusion space changed)
-// - Any other constraints changed (future extensions)
-//
-// This is the key to the retry logic: if Phase 3 added floats that affect
-// line breaking, we need to re-run Phase 2 with the updated constraints.
-func constraintsChanged(original, final *ConstraintSpace, lines []*LineInfo) bool {
-	// Check if exclusion space changed (floats were added)
-	originalEmpty := original.ExclusionSpace.IsEmpty()
-	finalEmpty := final.ExclusionSpace.IsEmpty()
-
-	// If original was empty and final is not, definitely changed
-	if originalEmpty && !finalEmpty {
-		return true
-	}
-
-	// If both non-empty, check if they're different
-	// For now, we use a simple heuristic: check available width at first line
-	if !originalEmpty && !finalEmpty && len(lines) > 0 {
-		firstLineY := lines[0].Y
-		firstLineHeight := lines[0].Height
-
-		originalWidth := original.AvailableInlineSize(firstLineY, firstLineHeight)
-		finalWidth := final.AvailableInlineSize(firstLineY, firstLineHeight)
-
-		// If available width changed, constraints changed
-		if originalWidth != finalWidth {
-			return true
-		}
-	}
-
-	// TODO: In the future, check other constraint changes:
-	// - Available size changes
-	// - Text alignment changes
-	// - etc.
-
-	return false
-}
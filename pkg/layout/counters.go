@@ -4,6 +4,7 @@ import (
 	"strconv"
 	"strings"
 
+	"louis14/pkg/css"
 	"louis14/pkg/html"
 )
 
@@ -12,6 +13,7 @@ import (
 // counterReset resets a counter to the specified value (default 0)
 // This creates a new scope for the counter.
 func (le *LayoutEngine) counterReset(name string, value int) {
+	le.counterUses++
 	if le.counters == nil {
 		le.counters = make(map[string][]int)
 	}
@@ -21,6 +23,7 @@ func (le *LayoutEngine) counterReset(name string, value int) {
 
 // counterIncrement increments a counter by the specified value (default 1)
 func (le *LayoutEngine) counterIncrement(name string, value int) {
+	le.counterUses++
 	if le.counters == nil {
 		return
 	}
@@ -36,6 +39,7 @@ func (le *LayoutEngine) counterIncrement(name string, value int) {
 
 // counterValue returns the current value of a counter
 func (le *LayoutEngine) counterValue(name string) int {
+	le.counterUses++
 	if le.counters == nil {
 		return 0
 	}
@@ -46,8 +50,58 @@ func (le *LayoutEngine) counterValue(name string) int {
 	return stack[len(stack)-1]
 }
 
+// counterValues returns the values of all the nested scopes of a counter,
+// outermost first, or a single 0 if it was never reset
+func (le *LayoutEngine) counterValues(name string) []int {
+	le.counterUses++
+	if le.counters == nil || len(le.counters[name]) == 0 {
+		return []int{0}
+	}
+	return le.counters[name]
+}
+
+// counterText returns the text of a counter() or counters() content value
+// (CSS Lists §4.8): the innermost value of the counter, or the values of
+// all its nested scopes joined by the separator.
+func (le *LayoutEngine) counterText(cv css.ContentValue) string {
+	listStyleType := css.ListStyleTypeDecimal
+	if cv.CounterStyle != "" {
+		listStyleType = css.ListStyleType(cv.CounterStyle)
+	}
+	if cv.Type != "counters" {
+		return formatCounter(le.counterValue(cv.Value), listStyleType)
+	}
+	values := le.counterValues(cv.Value)
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = formatCounter(v, listStyleType)
+	}
+	return strings.Join(parts, cv.Separator)
+}
+
+// formatCounter formats a counter value in a counter style: a number, or
+// for the bullet styles their glyph.
+func formatCounter(n int, listStyleType css.ListStyleType) string {
+	switch listStyleType {
+	case css.ListStyleTypeNone:
+		return ""
+	case css.ListStyleTypeDisc:
+		return "•"
+	case css.ListStyleTypeCircle:
+		return "○"
+	case css.ListStyleTypeSquare:
+		return "■"
+	case "lower-latin":
+		listStyleType = css.ListStyleTypeLowerAlpha
+	case "upper-latin":
+		listStyleType = css.ListStyleTypeUpperAlpha
+	}
+	return formatListNumber(n, listStyleType)
+}
+
 // counterPop removes the topmost scope of a counter (called when leaving an element that reset it)
 func (le *LayoutEngine) counterPop(name string) {
+	le.counterUses++
 	if le.counters == nil {
 		return
 	}
@@ -111,21 +165,111 @@ func parseCounterIncrement(value string) map[string]int {
 	return result
 }
 
-// getListItemNumber returns the item number for an <li> element
+// getListItemNumber returns the ordinal value of a list item (HTML §4.4.8):
+// numbering starts at the ol's start attribute, or at 1 (the number of
+// items when reversed), a value attribute renumbers its item, and each item
+// counts on from the one before, down when the list is reversed.
 func (le *LayoutEngine) getListItemNumber(node *html.Node) int {
-	if node.Parent == nil {
-		return 1
+	le.counterUses++
+	parent := node.Parent
+	if parent == nil {
+		return listItemValue(node, 1)
 	}
 
+	isOL := parent.TagName == "ol"
+	_, reversed := parent.Attributes["reversed"]
+	reversed = reversed && isOL
+	step := 1
 	itemNumber := 1
-	for _, sibling := range node.Parent.Children {
+	if reversed {
+		step = -1
+		itemNumber = 0
+		for _, sibling := range parent.Children {
+			if sibling.Type == html.ElementNode && sibling.TagName == "li" {
+				itemNumber++
+			}
+		}
+	}
+	if start, ok := parent.Attributes["start"]; ok && isOL {
+		if v, err := strconv.Atoi(strings.TrimSpace(start)); err == nil {
+			itemNumber = v
+		}
+	}
+
+	for _, sibling := range parent.Children {
+		if sibling.Type != html.ElementNode || (sibling.TagName != "li" && sibling != node) {
+			continue
+		}
+		itemNumber = listItemValue(sibling, itemNumber)
 		if sibling == node {
 			break
 		}
-		if sibling.Type == html.ElementNode && sibling.TagName == "li" {
-			itemNumber++
-		}
+		itemNumber += step
 	}
 
 	return itemNumber
 }
+
+// listItemValue returns the number an li's value attribute gives it, or
+// number if it has none.
+func listItemValue(node *html.Node, number int) int {
+	if node.TagName != "li" {
+		return number
+	}
+	if value, ok := node.Attributes["value"]; ok {
+		if v, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			return v
+		}
+	}
+	return number
+}
+
+// formatListNumber formats a list item number in a counter style. Numbers
+// the style can't represent fall back to decimal, as CSS Counter Styles
+// §6.1 specifies for the alphabetic and additive systems.
+func formatListNumber(n int, listStyleType css.ListStyleType) string {
+	switch listStyleType {
+	case css.ListStyleTypeLowerAlpha, css.ListStyleTypeUpperAlpha:
+		if n >= 1 {
+			s := alphabetic(n)
+			if listStyleType == css.ListStyleTypeUpperAlpha {
+				s = strings.ToUpper(s)
+			}
+			return s
+		}
+	case css.ListStyleTypeLowerRoman, css.ListStyleTypeUpperRoman:
+		if n >= 1 && n <= 3999 {
+			s := roman(n)
+			if listStyleType == css.ListStyleTypeLowerRoman {
+				s = strings.ToLower(s)
+			}
+			return s
+		}
+	}
+	return strconv.Itoa(n)
+}
+
+// alphabetic returns n in the lower-alpha counter style: a-z, then aa, ab...
+func alphabetic(n int) string {
+	var b []byte
+	for n > 0 {
+		n--
+		b = append([]byte{byte('a' + n%26)}, b...)
+		n /= 26
+	}
+	return string(b)
+}
+
+// roman returns n, from 1 to 3999, in upper-case roman numerals.
+func roman(n int) string {
+	values := []int{1000, 900, 500, 400, 100, 90, 50, 40, 10, 9, 5, 4, 1}
+	symbols := []string{"M", "CM", "D", "CD", "C", "XC", "L", "XL", "X", "IX", "V", "IV", "I"}
+	var sb strings.Builder
+	for i, v := range values {
+		for n >= v {
+			sb.WriteString(symbols[i])
+			n -= v
+		}
+	}
+	return sb.String()
+}
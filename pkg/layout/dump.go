@@ -0,0 +1,150 @@
+package layout
+
+import (
+	"encoding/json"
+	"io"
+
+	"louis14/pkg/css"
+	"louis14/pkg/html"
+)
+
+// Layout dumps
+//
+// DumpBoxes converts a laid out box tree into plain values that encode as
+// JSON, and WriteLayoutJSON writes them. The dump holds the geometry of each
+// box (its border box and edges, the fragments of split inlines and the
+// line boxes of block containers) with the computed values of the
+// properties in dumpedProperties, so tools and golden-file tests can check
+// layout without comparing pixels.
+
+// dumpedProperties are the computed style properties included in a dump,
+// when they are set.
+var dumpedProperties = []string{
+	"display", "position", "float", "clear",
+	"width", "height", "box-sizing", "overflow",
+	"font-family", "font-size", "font-weight", "font-style", "line-height",
+	"text-align", "white-space", "vertical-align",
+	"color", "background-color", "visibility", "z-index",
+}
+
+// DumpedRect is a rectangle in page coordinates.
+type DumpedRect struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// DumpedEdges are the widths of a box's margin, border or padding.
+type DumpedEdges struct {
+	Top    float64 `json:"top"`
+	Right  float64 `json:"right"`
+	Bottom float64 `json:"bottom"`
+	Left   float64 `json:"left"`
+}
+
+// DumpedLine is a line box of a block container.
+type DumpedLine struct {
+	Y         float64 `json:"y"`
+	Height    float64 `json:"height"`
+	Baseline  float64 `json:"baseline"` // From the top of the line
+	LeftEdge  float64 `json:"left"`
+	RightEdge float64 `json:"right"`
+	Boxes     int     `json:"boxes"` // Number of inline-level boxes on the line
+}
+
+// DumpedBox is a laid out box and its descendants.
+type DumpedBox struct {
+	Tag       string            `json:"tag,omitempty"`  // Element name, empty for text and anonymous boxes
+	ID        string            `json:"id,omitempty"`   // Element id attribute
+	Text      string            `json:"text,omitempty"` // Text of a text box or generated content
+	Position  string            `json:"position,omitempty"`
+	Rect      DumpedRect        `json:"rect"` // Border box
+	Margin    DumpedEdges       `json:"margin"`
+	Border    DumpedEdges       `json:"border"`
+	Padding   DumpedEdges       `json:"padding"`
+	Style     map[string]string `json:"style,omitempty"`
+	Fragments []DumpedRect      `json:"fragments,omitempty"`
+	Lines     []DumpedLine      `json:"lines,omitempty"`
+	Children  []*DumpedBox      `json:"children,omitempty"`
+}
+
+// DumpBoxes returns the dump of each box tree in boxes.
+func DumpBoxes(boxes []*Box) []*DumpedBox {
+	dumped := make([]*DumpedBox, 0, len(boxes))
+	for _, box := range boxes {
+		if box != nil {
+			dumped = append(dumped, dumpBox(box))
+		}
+	}
+	return dumped
+}
+
+// WriteLayoutJSON writes the dump of boxes to w as indented JSON.
+func WriteLayoutJSON(w io.Writer, boxes []*Box) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(DumpBoxes(boxes))
+}
+
+// dumpBox returns the dump of box and its descendants.
+func dumpBox(box *Box) *DumpedBox {
+	d := &DumpedBox{
+		Rect:    DumpedRect{X: box.X, Y: box.Y, Width: box.Width, Height: box.Height},
+		Margin:  dumpEdges(box.Margin),
+		Border:  dumpEdges(box.Border),
+		Padding: dumpEdges(box.Padding),
+		Text:    box.PseudoContent,
+	}
+	if box.Position != "" && box.Position != css.PositionStatic {
+		d.Position = string(box.Position)
+	}
+
+	if node := box.Node; node != nil {
+		switch node.Type {
+		case html.ElementNode:
+			d.Tag = node.TagName
+			d.ID, _ = node.GetAttribute("id")
+		case html.TextNode:
+			if d.Text == "" {
+				d.Text = node.Text
+			}
+		}
+	}
+
+	if box.Style != nil {
+		for _, property := range dumpedProperties {
+			if value, ok := box.Style.Get(property); ok {
+				if d.Style == nil {
+					d.Style = make(map[string]string)
+				}
+				d.Style[property] = value
+			}
+		}
+	}
+
+	for _, frag := range box.Fragments {
+		d.Fragments = append(d.Fragments, DumpedRect{X: frag.X, Y: frag.Y, Width: frag.Width, Height: frag.Height})
+	}
+	for _, line := range box.LineBoxes {
+		d.Lines = append(d.Lines, DumpedLine{
+			Y:         line.Y,
+			Height:    line.Height,
+			Baseline:  line.BaselineY,
+			LeftEdge:  line.LeftEdge,
+			RightEdge: line.RightEdge,
+			Boxes:     len(line.Boxes),
+		})
+	}
+	for _, child := range box.Children {
+		if child != nil {
+			d.Children = append(d.Children, dumpBox(child))
+		}
+	}
+	return d
+}
+
+// dumpEdges returns the widths of edge.
+func dumpEdges(edge css.BoxEdge) DumpedEdges {
+	return DumpedEdges{Top: edge.Top, Right: edge.Right, Bottom: edge.Bottom, Left: edge.Left}
+}
@@ -0,0 +1,69 @@
+package layout
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"louis14/pkg/html"
+)
+
+func TestWriteLayoutJSON(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0;font:10px Ahem">
+		<div id="box" style="width:100px;padding:5px;border:2px solid black;margin:3px">aa</div>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 600), doc)
+
+	var buf bytes.Buffer
+	if err := WriteLayoutJSON(&buf, boxes); err != nil {
+		t.Fatalf("WriteLayoutJSON: %v", err)
+	}
+	var dumped []*DumpedBox
+	if err := json.Unmarshal(buf.Bytes(), &dumped); err != nil {
+		t.Fatalf("dump is not valid JSON: %v\n%s", err, buf.String())
+	}
+
+	var find func(d *DumpedBox) *DumpedBox
+	find = func(d *DumpedBox) *DumpedBox {
+		if d.ID == "box" {
+			return d
+		}
+		for _, child := range d.Children {
+			if found := find(child); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	var div *DumpedBox
+	for _, root := range dumped {
+		if div = find(root); div != nil {
+			break
+		}
+	}
+	if div == nil {
+		t.Fatalf("expected the div in the dump:\n%s", buf.String())
+	}
+
+	if div.Tag != "div" {
+		t.Errorf("expected tag div, got %q", div.Tag)
+	}
+	if want := (DumpedRect{X: 3, Y: 3, Width: 114, Height: 24}); div.Rect != want {
+		t.Errorf("expected rect %+v, got %+v", want, div.Rect)
+	}
+	if div.Padding.Left != 5 || div.Border.Top != 2 || div.Margin.Right != 3 {
+		t.Errorf("unexpected edges: margin %+v border %+v padding %+v", div.Margin, div.Border, div.Padding)
+	}
+	if div.Style["width"] != "100px" {
+		t.Errorf("expected width in the style subset, got %v", div.Style)
+	}
+	if len(div.Lines) != 1 {
+		t.Errorf("expected one line box, got %d", len(div.Lines))
+	}
+	if len(div.Children) == 0 || div.Children[0].Text != "aa" {
+		t.Errorf("expected the text box as the first child, got %+v", div.Children)
+	}
+}
@@ -1,7 +1,10 @@
 package layout
 
 import (
+	"louis14/pkg/css"
+	"louis14/pkg/html"
 	"louis14/pkg/images"
+	"louis14/pkg/text"
 )
 
 func NewLayoutEngine(viewportWidth, viewportHeight float64) *LayoutEngine {
@@ -9,29 +12,111 @@ func NewLayoutEngine(viewportWidth, viewportHeight float64) *LayoutEngine {
 	le.viewport.width = viewportWidth
 	le.viewport.height = viewportHeight
 	le.counters = make(map[string][]int)
-	le.useMultiPass = true // Multi-pass is now the default (investigating block-in-inline-003 regression)
+	le.fonts = text.NewFontSet()
 	return le
 }
 
-// SetScrollY sets the vertical scroll offset for fixed positioning.
-// Fixed elements are positioned relative to viewport + scrollY.
+// SetScrollY sets the vertical scroll offset used by fixed and sticky positioning.
+// Fixed elements are positioned relative to viewport + scrollY; sticky
+// elements are clamped into the viewport scrolled by scrollY.
 func (le *LayoutEngine) SetScrollY(scrollY float64) {
 	le.scrollY = scrollY
 }
 
+// SetColorScheme sets the preferred color scheme, "light" or "dark", that
+// @media (prefers-color-scheme) queries match. The default is light.
+func (le *LayoutEngine) SetColorScheme(scheme string) {
+	le.colorScheme = scheme
+}
+
+// SetHoveredNode sets the element under the pointer, or nil if none. The
+// element and its ancestors match :hover on the next layout.
+func (le *LayoutEngine) SetHoveredNode(node *html.Node) {
+	moveState(le.hovered, node, html.StateHover, true)
+	le.hovered = node
+}
+
+// SetActiveNode sets the element being activated (e.g. the mouse button is
+// down over it), or nil if none. The element and its ancestors match :active.
+func (le *LayoutEngine) SetActiveNode(node *html.Node) {
+	moveState(le.active, node, html.StateActive, true)
+	le.active = node
+}
+
+// SetFocusedNode sets the focused element, or nil if none. The element
+// matches :focus and it and its ancestors match :focus-within.
+func (le *LayoutEngine) SetFocusedNode(node *html.Node) {
+	moveState(le.focused, node, html.StateFocus, false)
+	moveState(le.focused, node, html.StateFocusWithin, true)
+	le.focused = node
+}
+
+// HoveredNode returns the element set by SetHoveredNode.
+func (le *LayoutEngine) HoveredNode() *html.Node {
+	return le.hovered
+}
+
+// ActiveNode returns the element set by SetActiveNode.
+func (le *LayoutEngine) ActiveNode() *html.Node {
+	return le.active
+}
+
+// FocusedNode returns the element set by SetFocusedNode.
+func (le *LayoutEngine) FocusedNode() *html.Node {
+	return le.focused
+}
+
+// moveState clears state on from and sets it on to, including their
+// ancestors when ancestors is true.
+func moveState(from, to *html.Node, state html.ElementState, ancestors bool) {
+	for n := from; n != nil; n = n.Parent {
+		n.SetState(state, false)
+		if !ancestors {
+			break
+		}
+	}
+	for n := to; n != nil; n = n.Parent {
+		n.SetState(state, true)
+		if !ancestors {
+			break
+		}
+	}
+}
+
+// media returns the device that @media queries are evaluated against.
+func (le *LayoutEngine) media() css.Media {
+	return css.Media{
+		Width:       le.viewport.width,
+		Height:      le.viewport.height,
+		ColorScheme: le.colorScheme,
+		Type:        le.mediaType,
+		Fonts:       le.fonts,
+	}
+}
+
 // SetImageFetcher sets the image fetcher used to load network images during layout.
 func (le *LayoutEngine) SetImageFetcher(fetcher images.ImageFetcher) {
 	le.imageFetcher = fetcher
 }
 
-// SetUseMultiPass enables the new clean multi-pass inline layout architecture.
-// When enabled, inline content uses LayoutInlineContentToBoxes (Phase 1-2-3 pipeline)
-// instead of the old single-pass algorithm.
-//
-// This is used for selective testing: enable for specific test files to measure
-// improvement before full rollout.
-func (le *LayoutEngine) SetUseMultiPass(enabled bool) {
-	le.useMultiPass = enabled
+// SetBaseURL sets the URL or file path of the document. Relative image
+// URIs are resolved against it before they are fetched, so boxes carry
+// resolved image paths.
+func (le *LayoutEngine) SetBaseURL(baseURL string) {
+	le.baseURL = baseURL
+}
+
+// SetFontFetcher sets the fetcher used to download @font-face sources during layout.
+// Without one, @font-face rules are ignored and the bundled fonts are used.
+func (le *LayoutEngine) SetFontFetcher(fetcher text.FontFetcher) {
+	le.fontFetcher = fetcher
+}
+
+// DocumentHeight returns the height of the document laid out by the last
+// Layout: the bottom of its lowest margin box, excluding fixed boxes. It
+// may be more or less than the viewport height.
+func (le *LayoutEngine) DocumentHeight() float64 {
+	return le.documentHeight
 }
 
 // GetScrollY returns the current vertical scroll offset.
@@ -0,0 +1,96 @@
+package layout
+
+import (
+	"unicode"
+
+	"louis14/pkg/html"
+)
+
+// TextMatch is an occurrence of a search string in the laid-out text: the
+// text box it was found in and the rectangle, in document coordinates,
+// its characters are drawn in.
+type TextMatch struct {
+	Box                 *Box
+	X, Y, Width, Height float64
+}
+
+// FindText returns the occurrences of query in the text of boxes and their
+// descendants, in document order. Matching ignores case. An occurrence
+// must lie within one line of one text run, so text split across elements
+// or lines is not found. Generated content is not searched.
+func FindText(boxes []*Box, query string) []TextMatch {
+	needle := foldRunes(query)
+	if len(needle) == 0 {
+		return nil
+	}
+	var matches []TextMatch
+	for _, box := range TextBoxes(boxes) {
+		matches = appendTextMatches(matches, box, needle)
+	}
+	return matches
+}
+
+// TextBoxes returns the boxes that draw the document's text, one per line
+// of each text run, in document order. Generated content is left out.
+func TextBoxes(boxes []*Box) []*Box {
+	var text []*Box
+	var walk func(boxes []*Box)
+	walk = func(boxes []*Box) {
+		for _, box := range boxes {
+			if len(box.Children) > 0 {
+				walk(box.Children)
+				continue
+			}
+			if box.Node == nil || box.Node.Type != html.TextNode || box.PseudoContent != "" || box.Style == nil {
+				continue
+			}
+			text = append(text, box)
+		}
+	}
+	walk(boxes)
+	return text
+}
+
+// appendTextMatches appends the occurrences of needle, already case
+// folded, in a text box's line of text.
+func appendTextMatches(matches []TextMatch, box *Box, needle []rune) []TextMatch {
+	runes := []rune(box.Node.Text)
+	haystack := foldRunes(box.Node.Text)
+	for i := 0; i+len(needle) <= len(haystack); i++ {
+		if !runesEqual(haystack[i:i+len(needle)], needle) {
+			continue
+		}
+		// Text is drawn from the box's left edge, so a match starts after
+		// the width of the text before it.
+		start := styledTextWidth(string(runes[:i]), box.Style)
+		end := styledTextWidth(string(runes[:i+len(needle)]), box.Style)
+		matches = append(matches, TextMatch{
+			Box:    box,
+			X:      box.X + start,
+			Y:      box.Y,
+			Width:  end - start,
+			Height: box.Height,
+		})
+		i += len(needle) - 1 // Occurrences do not overlap
+	}
+	return matches
+}
+
+// foldRunes returns s as runes in lower case, one per rune of s, so
+// indexes into it are indexes into s's runes.
+func foldRunes(s string) []rune {
+	runes := []rune(s)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+	return runes
+}
+
+func runesEqual(a, b []rune) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
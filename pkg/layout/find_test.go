@@ -0,0 +1,62 @@
+package layout
+
+import (
+	"testing"
+
+	"louis14/pkg/html"
+)
+
+func TestFindText(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0">
+		<p style="margin:0;width:200px;font-family:Ahem;font-size:20px;line-height:20px">ab Ab xAB</p>
+		<p style="margin:0;font-family:Ahem;font-size:10px;line-height:10px">no match here; ab</p>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 600), doc)
+
+	matches := FindText(boxes, "aB")
+	want := []struct{ x, y, w, h float64 }{
+		{0, 0, 40, 20},    // "ab"
+		{60, 0, 40, 20},   // "Ab"
+		{140, 0, 40, 20},  // "AB" after "x"
+		{150, 20, 20, 10}, // "ab" at the end of the second paragraph
+	}
+	if len(matches) != len(want) {
+		t.Fatalf("expected %d matches, got %d: %+v", len(want), len(matches), matches)
+	}
+	for i, w := range want {
+		m := matches[i]
+		if m.X != w.x || m.Y != w.y || m.Width != w.w || m.Height != w.h {
+			t.Errorf("match %d: expected (%.0f,%.0f %.0fx%.0f), got (%.1f,%.1f %.1fx%.1f)",
+				i, w.x, w.y, w.w, w.h, m.X, m.Y, m.Width, m.Height)
+		}
+	}
+
+	if matches := FindText(boxes, ""); matches != nil {
+		t.Errorf("expected no matches for an empty query, got %+v", matches)
+	}
+	if matches := FindText(boxes, "abab"); matches != nil {
+		t.Errorf("expected no matches, got %+v", matches)
+	}
+}
+
+func TestFindText_WrappedLines(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0">
+		<p style="margin:0;width:100px;font-family:Ahem;font-size:10px;line-height:10px">find me and find me</p>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 600), doc)
+
+	// Each line is its own text box, so the matches are on separate lines
+	matches := FindText(boxes, "find")
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 matches, got %+v", matches)
+	}
+	if matches[0].Y >= matches[1].Y {
+		t.Errorf("expected the second match on a later line, got y %.1f and %.1f", matches[0].Y, matches[1].Y)
+	}
+}
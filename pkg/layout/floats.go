@@ -1,6 +1,8 @@
 package layout
 
 import (
+	"math"
+
 	"louis14/pkg/css"
 )
 
@@ -21,11 +23,11 @@ func (le *LayoutEngine) positionFloat(
 
 	if floatType == css.FloatLeft {
 		// Left float: position after existing left floats
-		leftOffset, _ := constraint.ExclusionSpace.AvailableInlineSize(lineY, marginBoxHeight)
+		leftOffset, _ := constraint.FloatOffsets(lineY, marginBoxHeight)
 		floatX = leftOffset
 	} else if floatType == css.FloatRight {
 		// Right float: position before existing right floats
-		_, rightOffset := constraint.ExclusionSpace.AvailableInlineSize(lineY, marginBoxHeight)
+		_, rightOffset := constraint.FloatOffsets(lineY, marginBoxHeight)
 		floatX = constraint.AvailableSize.Width - rightOffset - marginBoxWidth
 	}
 
@@ -54,145 +56,103 @@ func (le *LayoutEngine) positionFloat(
 	return frag, newConstraint
 }
 
-// ConstructFragments creates positioned fragments from line breaking results.
-// This is Phase 3 of the multi-pass inline layout pipeline.
-//
-// For each line:
-// 1. Call constructLine to create fragments
-// 2. Propagate constraint updates (floats) to next line
-// 3. Accumulate all fragments
-//
-// Returns:
-// - fragments: All positioned fragments (flattened from all lines)
+// addFloat records a float once it is in its place
 func (le *LayoutEngine) addFloat(box *Box, side css.FloatType, y float64) {
+	le.tracef(TraceFloat, TraceInfo, "%s %s at (%.1f, %.1f) %.1fx%.1f",
+		side, getNodeName(box.Node), box.X, box.Y, box.Width, box.Height)
+	// box.Width and box.Height are border-box, so the margin box just adds
+	// the margins around them
 	le.floats = append(le.floats, FloatInfo{
 		Box:  box,
 		Side: side,
 		Y:    y,
+		Exclusion: Exclusion{
+			Rect: Rect{
+				X:      box.X - box.Margin.Left,
+				Y:      box.Y - box.Margin.Top,
+				Width:  box.Margin.Left + box.Width + box.Margin.Right,
+				Height: box.Margin.Top + box.Height + box.Margin.Bottom,
+			},
+			Side: side,
+		},
 	})
 }
 
-// getFloatOffsets returns the left and right offsets caused by floats at a given Y position
-func (le *LayoutEngine) getFloatOffsets(y float64) (leftOffset, rightOffset float64) {
-	leftOffset = 0
-	rightOffset = 0
-
-	for i := le.floatBase; i < len(le.floats); i++ {
-		floatInfo := le.floats[i]
-		// Check if this float affects the current Y position
-		floatBottom := floatInfo.Y + le.getTotalHeight(floatInfo.Box)
-		if y >= floatInfo.Y && y < floatBottom {
-			// box.Width is border-box (content + padding + borders), so margin-box = margins + box.Width
-			b := floatInfo.Box
-			if floatInfo.Side == css.FloatLeft {
-				floatWidth := b.Margin.Left + b.Width + b.Margin.Right
-				// Sum left float widths: left floats stack left-to-right
-				leftOffset += floatWidth
-			} else if floatInfo.Side == css.FloatRight {
-				floatWidth := b.Margin.Left + b.Width + b.Margin.Right
-				// Sum right float widths: right floats stack right-to-left
-				rightOffset += floatWidth
-			}
-		}
+// exclusionSpace returns the floats of the current block formatting context
+// as an exclusion space, with X measured from originX. The multi-pass
+// inline layout starts from it so its lines flow around the floats placed
+// before them, and the block layout answers its float queries with it.
+func (le *LayoutEngine) exclusionSpace(originX float64) *ExclusionSpace {
+	exclusions := make([]Exclusion, 0, len(le.floats)-le.floatBase)
+	for _, floatInfo := range le.floats[le.floatBase:] {
+		excl := floatInfo.Exclusion
+		excl.Rect.X -= originX
+		exclusions = append(exclusions, excl)
 	}
+	return &ExclusionSpace{exclusions: exclusions}
+}
 
-	return leftOffset, rightOffset
+// getFloatOffsets returns how far floats reach at a given Y position into a
+// containing block whose content box spans left to right
+func (le *LayoutEngine) getFloatOffsets(y, left, right float64) (leftOffset, rightOffset float64) {
+	return le.exclusionSpace(0).Offsets(y, 0, left, right)
 }
 
-// initializeLineX returns the starting X position for inline content in a box at the given Y position,
-// accounting for left floats. This should be called when starting a new line or after the Y position changes.
-func (le *LayoutEngine) initializeLineX(box *Box, border, padding css.BoxEdge, y float64) float64 {
-	leftOffset, _ := le.getFloatOffsets(y)
-	return box.X + border.Left + padding.Left + leftOffset
+// clearFloor returns the lowest Y the border edge of a box with the given
+// clear property may take: the bottom outer edge of the floats it clears,
+// or -Inf if there are none
+func (le *LayoutEngine) clearFloor(clearType css.ClearType) float64 {
+	return le.getClearY(clearType, math.Inf(-1))
 }
 
-// ensureLineXClearsFloats updates the inline context's LineX to ensure it clears any left floats
-// at the current Y position. This should be called after advancing LineX to verify constraints.
-func (le *LayoutEngine) ensureLineXClearsFloats(inlineCtx *InlineContext, box *Box, border, padding css.BoxEdge) {
-	minX := le.initializeLineX(box, border, padding, inlineCtx.LineY)
-	if inlineCtx.LineX < minX {
-		inlineCtx.LineX = minX
+// placeBelowFloats moves a box with clear whose margins have collapsed to
+// hypotheticalY, where it would be with clear: none. If that is above the
+// floats it clears, clearance places it below them instead, and its top
+// margin no longer collapses with the margins above it (CSS 2.1 §9.5.2).
+// It returns the box's new Y.
+func (le *LayoutEngine) placeBelowFloats(box *Box, hypotheticalY float64) float64 {
+	y := hypotheticalY
+	box.clearance = 0
+	if box.Style != nil && box.Style.GetClear() != css.ClearNone && box.clearFloor > y {
+		box.clearance = box.clearFloor - y
+		y = box.clearFloor
+	}
+	if y != box.Y {
+		le.adjustChildrenY(box, y-box.Y)
+		box.Y = y
 	}
+	return y
 }
 
 // getClearY returns the Y position after clearing floats
 func (le *LayoutEngine) getClearY(clearType css.ClearType, currentY float64) float64 {
-	if clearType == css.ClearNone {
-		return currentY
-	}
-
-	maxY := currentY
-
-	for i := le.floatBase; i < len(le.floats); i++ {
-		floatInfo := le.floats[i]
-		b := floatInfo.Box
-		// CSS 2.1 §9.5.2: clearance uses the float's "bottom outer edge" (margin edge),
-		// which includes margin-bottom even when negative.
-		floatBottom := floatInfo.Y + b.Border.Top + b.Padding.Top + b.Height + b.Padding.Bottom + b.Border.Bottom + b.Margin.Bottom
-
-		shouldClear := false
-		switch clearType {
-		case css.ClearLeft:
-			shouldClear = floatInfo.Side == css.FloatLeft
-		case css.ClearRight:
-			shouldClear = floatInfo.Side == css.FloatRight
-		case css.ClearBoth:
-			shouldClear = true
-		}
-
-		if shouldClear && floatBottom > maxY {
-			maxY = floatBottom
-		}
-	}
-
-	return maxY
+	return le.exclusionSpace(0).ClearY(clearType, currentY)
 }
 
 // Phase 5 Enhancement: getFloatDropY finds Y position where float of given width will fit
-// CSS 2.1 §9.5.1: Floats must be placed as high as possible (Rule 6). A float only needs
-// to drop when it conflicts with opposite-side floats. Same-side floats stack horizontally
-// and can extend past the container edge.
-func (le *LayoutEngine) getFloatDropY(floatType css.FloatType, floatWidth float64, startY float64, availableWidth float64) float64 {
+// CSS 2.1 §9.5.1: Floats must be placed as high as possible (Rule 6), but a float that is
+// wider than the room beside the floats already in its band, on either side, moves down
+// below them (Rules 2, 3 and 7). One wider than the container with no floats beside it
+// stays where it is and overflows.
+func (le *LayoutEngine) getFloatDropY(floatWidth float64, startY float64, left, right float64) float64 {
 	// If available width is 0 (shrink-to-fit parent), skip drop logic
-	if availableWidth <= 0 {
+	if right <= left {
 		return startY
 	}
+	exclusions := le.exclusionSpace(0)
 	currentY := startY
-	maxAttempts := 100 // Prevent infinite loops
-
-	for attempt := 0; attempt < maxAttempts; attempt++ {
-		leftOffset, rightOffset := le.getFloatOffsets(currentY)
-
-		// Only drop when there's a conflict with opposite-side floats.
-		// Left floats can extend past the container's right edge (CSS 2.1 §9.5.1).
-		if floatType == css.FloatLeft {
-			if rightOffset == 0 || floatWidth <= availableWidth-leftOffset-rightOffset {
-				return currentY
-			}
-		} else {
-			if leftOffset == 0 || floatWidth <= availableWidth-leftOffset-rightOffset {
-				return currentY
-			}
-		}
 
-		// Find the next Y position where a float ends
-		nextY := currentY + 1 // Default small increment
-		for _, floatInfo := range le.floats {
-			floatBottom := floatInfo.Y + le.getTotalHeight(floatInfo.Box)
-			// Look for the nearest float bottom that's below current Y
-			if floatBottom > currentY && (nextY == currentY+1 || floatBottom < nextY) {
-				nextY = floatBottom
-			}
+	for {
+		leftOffset, rightOffset := exclusions.Offsets(currentY, 0, left, right)
+		if leftOffset <= 0 && rightOffset <= 0 || floatWidth <= right-left-leftOffset-rightOffset {
+			return currentY
 		}
 
-		currentY = nextY
-
-		// If we've moved way down, just return current position
-		if currentY > startY+1000 {
-			return startY
+		// Move below the float that ends first
+		nextY := exclusions.NextBandBelowY(currentY, 0)
+		if nextY <= currentY {
+			return currentY
 		}
+		currentY = nextY
 	}
-
-	return currentY
 }
-
@@ -0,0 +1,153 @@
+package layout
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"louis14/pkg/css"
+	"louis14/pkg/text"
+)
+
+// loadWebFonts downloads the fonts named by @font-face rules in the parsed
+// stylesheets and adds them to the engine's fonts, which the styles it
+// computes carry. Each rule's sources are fetched at most once per engine;
+// the first source of a rule that loads successfully wins.
+func (le *LayoutEngine) loadWebFonts() {
+	if le.fontFetcher == nil {
+		return
+	}
+	if le.loadedFonts == nil {
+		le.loadedFonts = make(map[string]bool)
+	}
+	if le.fonts == nil {
+		le.fonts = text.NewFontSet()
+	}
+	for _, sheet := range le.stylesheets {
+		for _, face := range sheet.FontFaces {
+			for _, src := range face.Sources {
+				// local() fonts and WOFF2 are not supported
+				if src.URL == "" || src.Format == "woff2" || strings.HasSuffix(strings.ToLower(src.URL), ".woff2") {
+					continue
+				}
+				key := fmt.Sprintf("%s|%t|%t|%s", face.Family, face.IsBold(), face.IsItalic(), src.URL)
+				if done, seen := le.loadedFonts[key]; seen {
+					if done {
+						break
+					}
+					continue
+				}
+				data, err := le.fontFetcher(le.fetchContext(), src.URL)
+				if err == nil {
+					err = le.fonts.Register(face.Family, face.IsBold(), face.IsItalic(), data)
+				}
+				le.loadedFonts[key] = err == nil
+				if err != nil {
+					le.tracef(TraceFont, TraceInfo, "font-face %q: %s: %v", face.Family, src.URL, err)
+					continue
+				}
+				break
+			}
+		}
+	}
+}
+
+// measureStyledText measures text in the font selected by style's
+// font-family, weight, and style, including registered web fonts.
+func measureStyledText(s string, style *css.Style) (width, height float64) {
+	return text.MeasureTextWithFamilies(style.Fonts, s, style.GetFontSize(), style.GetFontFamilies(),
+		style.GetFontWeight() == css.FontWeightBold, style.GetFontStyle() == css.FontStyleItalic,
+		style.IsMonospaceFamily(), style.IsAhemFamily())
+}
+
+// styledTextWidth measures text in the font selected by style, with its
+// letter-spacing.
+func styledTextWidth(s string, style *css.Style) float64 {
+	width, _ := measureStyledText(s, style)
+	if ls := style.GetLetterSpacing(); ls != 0 {
+		if n := utf8.RuneCountInString(s); n > 1 {
+			width += ls * float64(n-1)
+		}
+	}
+	return width
+}
+
+// textBreakOffset returns where the first line of a text item ends so that
+// it fits within maxWidth: after the last line break opportunity that fits,
+// not counting the spaces before it, which hang (CSS Text 3 §5). With
+// word-break: break-all every letter is a break opportunity. If nothing
+// fits, a line that is otherwise empty takes the first word anyway, broken
+// where the line fills if overflow-wrap allows, and any other line takes
+// nothing. Unstyled text isn't broken.
+func textBreakOffset(item *InlineItem, maxWidth float64, emptyLine bool) int {
+	if item.Style == nil {
+		return len(item.Text)
+	}
+	wrap := textWrapMode(item.Style)
+	var breaks []int
+	end := 0
+	for _, segment := range text.SplitAtLineBreaks(item.Text) {
+		if wrap == text.WrapBreakAll {
+			for i, r := range segment {
+				if i > 0 && !unicode.IsSpace(r) && !unicode.Is(unicode.Mn, r) {
+					breaks = append(breaks, end+i)
+				}
+			}
+		}
+		end += len(segment)
+		breaks = append(breaks, end)
+	}
+	fits := func(end int) bool {
+		return styledTextWidth(strings.TrimRight(item.Text[:end], " \t\n\r"), item.Style) <= maxWidth
+	}
+
+	// Lines grow wider with each break, so the last that fits is bisected
+	if n := sort.Search(len(breaks), func(k int) bool { return !fits(breaks[k]) }); n > 0 {
+		return breaks[n-1]
+	}
+	if !emptyLine || len(breaks) == 0 {
+		return 0
+	}
+	if wrap != text.WrapBreakWord {
+		return breaks[0]
+	}
+	// The first word breaks where the line fills, keeping one letter
+	last := 0
+	for i, r := range item.Text[:breaks[0]] {
+		next := i + utf8.RuneLen(r)
+		if last > 0 && !fits(next) {
+			break
+		}
+		last = next
+	}
+	return last
+}
+
+// breakStyledText breaks text into lines in the font selected by style,
+// within words where its word-break and overflow-wrap allow.
+func breakStyledText(s string, style *css.Style, firstLineMax, remainingMax float64) []string {
+	return text.BreakTextIntoLinesWithFamilies(style.Fonts, s, style.GetFontSize(), style.GetFontFamilies(),
+		style.GetFontWeight() == css.FontWeightBold, style.GetFontStyle() == css.FontStyleItalic,
+		style.IsMonospaceFamily(), style.IsAhemFamily(), firstLineMax, remainingMax, textWrapMode(style))
+}
+
+// textWrapMode returns where style lets lines break within words.
+func textWrapMode(style *css.Style) text.WrapMode {
+	if style.GetWordBreak() == css.WordBreakBreakAll {
+		return text.WrapBreakAll
+	}
+	if style.GetOverflowWrap() != css.OverflowWrapNormal {
+		return text.WrapBreakWord
+	}
+	return text.WrapNormal
+}
+
+// styleFontMetrics returns the ascent and descent of the font selected by
+// style.
+func styleFontMetrics(style *css.Style) text.FontMetrics {
+	return text.MetricsWithFamilies(style.Fonts, style.GetFontSize(), style.GetFontFamilies(),
+		style.GetFontWeight() == css.FontWeightBold, style.GetFontStyle() == css.FontStyleItalic,
+		style.IsMonospaceFamily(), style.IsAhemFamily())
+}
@@ -0,0 +1,61 @@
+package layout
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"louis14/pkg/html"
+	"louis14/pkg/text"
+)
+
+// webFontWidth lays out text in the web font Web, which the document's
+// @font-face loads from Ahem if fetch is set, and returns its width.
+func webFontWidth(t *testing.T, le *LayoutEngine, fetch text.FontFetcher) float64 {
+	t.Helper()
+	doc, err := html.Parse(`<html><head><style>
+		@font-face { font-family: Web; src: url(ahem.ttf); }
+	</style></head><body style="margin:0"><span id="t" style="font-family: Web, sans-serif; font-size: 20px">XXXX</span></body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if fetch != nil {
+		le.SetFontFetcher(fetch)
+	}
+	box := findOnPage(layoutDoc(t, le, doc), "t")
+	if box == nil {
+		t.Fatal("no box for the span")
+	}
+	return box.Width
+}
+
+func TestWebFonts_ScopedToEngine(t *testing.T) {
+	ahem, err := os.ReadFile(text.DefaultFontConfig().Ahem)
+	if err != nil {
+		t.Skipf("Ahem not available: %v", err)
+	}
+	fetch := func(ctx context.Context, uri string) ([]byte, error) { return ahem, nil }
+
+	// Every Ahem glyph is a 1em square
+	if got := webFontWidth(t, NewLayoutEngine(800, 600), fetch); got != 80 {
+		t.Errorf("expected the web font used, got width %g", got)
+	}
+	// Another document naming the same family doesn't get the font
+	if got := webFontWidth(t, NewLayoutEngine(800, 600), nil); got == 80 {
+		t.Error("expected a document without the font not to use another's")
+	}
+}
+
+func TestWebFonts_FailureTraced(t *testing.T) {
+	var buf bytes.Buffer
+	le := NewLayoutEngine(800, 600)
+	le.SetTracer(NewWriterTracer(&buf, TraceInfo, TraceFont))
+	fetch := func(ctx context.Context, uri string) ([]byte, error) { return nil, errors.New("not found") }
+	webFontWidth(t, le, fetch)
+	if want := `[font] font-face "Web": ahem.ttf: not found`; !strings.Contains(buf.String(), want) {
+		t.Errorf("expected trace to contain %q, got:\n%s", want, buf.String())
+	}
+}
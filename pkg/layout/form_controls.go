@@ -0,0 +1,112 @@
+package layout
+
+import (
+	"fmt"
+	"strconv"
+
+	"louis14/pkg/css"
+	"louis14/pkg/html"
+)
+
+// Form controls are replaced elements: unless the author sizes them, they
+// get an intrinsic content size derived from their attributes and font
+// (HTML §15.5). Sizes are written into the computed style as width and
+// height so every layout path treats them like author-specified lengths.
+
+const (
+	defaultInputSize    = 20 // Characters visible in a text input (size attribute)
+	defaultTextareaCols = 20
+	defaultTextareaRows = 2
+	defaultListBoxRows  = 4 // Rows of a <select multiple> without a size
+)
+
+// SelectArrowWidth is the room a drop-down select reserves for its arrow.
+const SelectArrowWidth = 16
+
+// applyFormControlSizes gives form controls in the subtree their intrinsic
+// width and height where the author left them unset.
+func applyFormControlSizes(node *html.Node, computedStyles map[*html.Node]*css.Style) {
+	if node.Type != html.ElementNode {
+		return
+	}
+	if style := computedStyles[node]; style != nil {
+		applyFormControlSize(node, style)
+	}
+	for _, child := range node.Children {
+		applyFormControlSizes(child, computedStyles)
+	}
+}
+
+// applyFormControlSize sets the width and height of a form control's style
+// to its intrinsic size unless the author set them. Styles computed during
+// layout (e.g. for inline items) pass through here as well, so it must be
+// safe to apply more than once.
+func applyFormControlSize(node *html.Node, style *css.Style) {
+	w, h, ok := formControlSize(node, style)
+	if !ok {
+		return
+	}
+	if !hasAuthorSize(style, "width") {
+		style.Set("width", fmt.Sprintf("%gpx", w))
+	}
+	if !hasAuthorSize(style, "height") {
+		style.Set("height", fmt.Sprintf("%gpx", h))
+	}
+}
+
+// hasAuthorSize reports whether a width or height property has a
+// non-auto value.
+func hasAuthorSize(style *css.Style, property string) bool {
+	v, ok := style.Get(property)
+	return ok && v != "auto"
+}
+
+// formControlSize returns the intrinsic content size of a form control,
+// or false if the node is not a control sized here. Buttons are sized by
+// their content, and checkboxes and radios by the UA stylesheet.
+func formControlSize(node *html.Node, style *css.Style) (width, height float64, ok bool) {
+	charWidth, _ := measureStyledText("0", style)
+	lineHeight := styleFontMetrics(style).NormalLineHeight()
+
+	switch node.TagName {
+	case "input":
+		switch node.InputType() {
+		case "hidden", "checkbox", "radio", "image", "file", "range", "color":
+			return 0, 0, false
+		case "button", "submit", "reset":
+			w, _ := measureStyledText(node.ButtonLabel(), style)
+			return w, lineHeight, true
+		}
+		return float64(intAttribute(node, "size", defaultInputSize)) * charWidth, lineHeight, true
+	case "textarea":
+		cols := intAttribute(node, "cols", defaultTextareaCols)
+		rows := intAttribute(node, "rows", defaultTextareaRows)
+		return float64(cols) * charWidth, float64(rows) * lineHeight, true
+	case "select":
+		for _, opt := range node.Options() {
+			if w, _ := measureStyledText(opt.OptionLabel(), style); w > width {
+				width = w
+			}
+		}
+		if !node.IsListBox() {
+			return width + SelectArrowWidth, lineHeight, true
+		}
+		rows := intAttribute(node, "size", defaultListBoxRows)
+		return width, float64(rows) * lineHeight, true
+	}
+	return 0, 0, false
+}
+
+// intAttribute returns a positive integer attribute, or def if the
+// attribute is missing or invalid.
+func intAttribute(node *html.Node, name string, def int) int {
+	v, ok := node.GetAttribute(name)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return def
+	}
+	return n
+}
@@ -15,6 +15,7 @@ type GridCell struct {
 // layoutGridContainer handles CSS Grid layout
 func (le *LayoutEngine) layoutGridContainer(
 	node *html.Node,
+	tree *BoxTreeNode,
 	x, y, availableWidth float64,
 	style *css.Style,
 	computedStyles map[*html.Node]*css.Style,
@@ -23,15 +24,22 @@ func (le *LayoutEngine) layoutGridContainer(
 	// Get grid properties
 	columnTracks := style.GetGridTemplateColumns()
 	rowTracks := style.GetGridTemplateRows()
-	rowGap, columnGap := style.GetGridGap()
-	justifyItems := style.GetJustifyItems()
-	alignItems := style.GetAlignItems()
 
 	// Get box model properties
 	margin := style.GetMargin()
 	padding := style.GetPadding()
 	border := style.GetBorderWidth()
 
+	// Percentage gaps resolve against the content box, an auto height
+	// counting as zero
+	gapWidth := availableWidth - margin.Left - margin.Right -
+		padding.Left - padding.Right - border.Left - border.Right
+	if w, ok := style.GetLength("width"); ok {
+		gapWidth = w
+	}
+	gapHeight, _ := style.GetLength("height")
+	rowGap, columnGap := style.GetGap(gapHeight, gapWidth)
+
 	// Calculate container dimensions
 	var containerWidth float64
 	if w, ok := style.GetLength("width"); ok {
@@ -99,9 +107,25 @@ func (le *LayoutEngine) layoutGridContainer(
 		Parent:   parent,
 	}
 
+	box.Children = (&GridLayoutMode{}).LayoutChildren(le, box, tree, gapWidth, computedStyles)
+	return box
+}
+
+// layoutGridItems lays out the items of a grid container, the anonymous
+// ones the box tree made of its runs of text included, and places them in
+// their cells. gapWidth is the width percentage gaps resolve against.
+func (le *LayoutEngine) layoutGridItems(box *Box, tree *BoxTreeNode, gapWidth float64, computedStyles map[*html.Node]*css.Style) []*Box {
+	style := box.Style
+	columnTracks := style.GetGridTemplateColumns()
+	rowTracks := style.GetGridTemplateRows()
+	justifyItems := style.GetJustifyItems()
+	alignItems := style.GetAlignItems()
+	gapHeight, _ := style.GetLength("height")
+	rowGap, columnGap := style.GetGap(gapHeight, gapWidth)
+
 	// Content area for grid items (inside padding and border)
-	contentX := actualX + padding.Left + border.Left
-	contentY := y + padding.Top + border.Top
+	contentX := box.X + box.Padding.Left + box.Border.Left
+	contentY := box.Y + box.Padding.Top + box.Border.Top
 
 	// Layout grid items
 	gridItems := make([]*GridCell, 0)
@@ -109,22 +133,14 @@ func (le *LayoutEngine) layoutGridContainer(
 	currentColumn := 0
 
 	// First pass: layout each child and determine its grid position
-	for _, child := range node.Children {
-		if child.Type != html.ElementNode {
-			continue
-		}
-
+	for _, item := range tree.Children {
+		child := item.source
 		childStyle := computedStyles[child]
 		if childStyle == nil {
 			childStyle = css.NewStyle()
 			computedStyles[child] = childStyle
 		}
 
-		// Skip if display: none
-		if childStyle.GetDisplay() == css.DisplayNone {
-			continue
-		}
-
 		// Check for explicit grid placement
 		gridColumn := childStyle.GetGridColumn()
 		gridRow := childStyle.GetGridRow()
@@ -230,5 +246,5 @@ func (le *LayoutEngine) layoutGridContainer(
 		box.Children = append(box.Children, cell.Box)
 	}
 
-	return box
+	return box.Children
 }
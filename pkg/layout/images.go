@@ -0,0 +1,141 @@
+package layout
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"louis14/pkg/css"
+	"louis14/pkg/html"
+	"louis14/pkg/images"
+	"louis14/pkg/text"
+)
+
+// The placeholder of an <img> that fails to load is a broken-image icon
+// of BrokenImageIconSize pixels square, then, BrokenImageGap pixels to its
+// right, the image's alt text.
+const (
+	BrokenImageIconSize = 16.0
+	BrokenImageGap      = 4.0
+)
+
+// isImageElement reports whether node is laid out as an image: an <img>,
+// an inline <svg>, which is a replaced element drawn from its markup, or a
+// <canvas>, drawn from the bitmap scripts draw into.
+func isImageElement(node *html.Node) bool {
+	return node.TagName == "img" || node.TagName == "svg" || node.TagName == "canvas"
+}
+
+// imageSource returns the resolved URI an image element loads. An inline
+// <svg> is serialized into a data URI, so it loads and caches like an
+// .svg file. A <canvas> registers its bitmap under a canvas: URI.
+func (le *LayoutEngine) imageSource(node *html.Node) (string, bool) {
+	switch node.TagName {
+	case "svg":
+		return images.SVGDataURI(node.SerializeOuter()), true
+	case "canvas":
+		le.canvasMu.Lock()
+		defer le.canvasMu.Unlock()
+		uri := images.RegisterCanvas(fmt.Sprintf("%p", node), node.CanvasBitmap())
+		if le.canvases == nil {
+			le.canvases = make(map[string]bool)
+		}
+		le.canvases[uri] = true
+		return uri, true
+	case "object":
+		data, ok := node.GetAttribute("data")
+		return le.resolveImageURI(data), ok
+	}
+	src, ok := node.GetAttribute("src")
+	return le.resolveImageURI(src), ok
+}
+
+// imageDimensions returns the natural size of the image node loads from
+// src. An <img> that fails to load but has alt text is sized instead for
+// the placeholder the renderer draws in its place.
+func (le *LayoutEngine) imageDimensions(node *html.Node, src string, style *css.Style) (int, int, error) {
+	w, h, err := images.GetImageDimensionsWithFetcher(le.fetchContext(), src, le.imageFetcher)
+	if err == nil || node.TagName != "img" {
+		return w, h, err
+	}
+	alt, _ := node.GetAttribute("alt")
+	if alt == "" {
+		return 0, 0, err
+	}
+	bold := style.GetFontWeight() == css.FontWeightBold
+	italic := style.GetFontStyle() == css.FontStyleItalic
+	tw, th := text.MeasureTextWithFamilies(style.Fonts, alt, style.GetFontSize(), style.GetFontFamilies(), bold, italic, style.IsMonospaceFamily(), style.IsAhemFamily())
+	return int(math.Ceil(BrokenImageIconSize + BrokenImageGap + tw)), int(math.Ceil(math.Max(BrokenImageIconSize, th))), nil
+}
+
+// resolveImageURI resolves an image URI against the document's base URL.
+func (le *LayoutEngine) resolveImageURI(uri string) string {
+	return images.ResolveURI(le.baseURL, strings.TrimSpace(uri))
+}
+
+// prewarmImages decodes the document's images concurrently before layout
+// measures them one at a time. It also registers the document's canvases,
+// releasing those registered by the previous layout that are gone.
+func (le *LayoutEngine) prewarmImages(root *html.Node) {
+	le.canvasMu.Lock()
+	prevCanvases := le.canvases
+	le.canvases = nil
+	le.canvasMu.Unlock()
+	var uris []string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type != html.ElementNode {
+			return
+		}
+		switch n.TagName {
+		case "img", "object":
+			if uri, ok := le.imageSource(n); ok {
+				uris = append(uris, uri)
+			}
+		case "canvas":
+			le.imageSource(n)
+		}
+		for _, child := range n.Children {
+			walk(child)
+		}
+	}
+	walk(root)
+	le.canvasMu.Lock()
+	for uri := range prevCanvases {
+		if !le.canvases[uri] {
+			images.ReleaseCanvas(uri)
+		}
+	}
+	le.canvasMu.Unlock()
+	if len(uris) > 1 {
+		images.Prewarm(le.fetchContext(), uris, le.imageFetcher)
+	}
+}
+
+// ReleaseCanvases unregisters the bitmaps of the canvases the last layout
+// registered, which otherwise stay registered, and in memory, for the life
+// of the process. Call it once the layout's boxes are no longer rendered;
+// it may be called from any goroutine.
+func (le *LayoutEngine) ReleaseCanvases() {
+	le.canvasMu.Lock()
+	defer le.canvasMu.Unlock()
+	for uri := range le.canvases {
+		images.ReleaseCanvas(uri)
+	}
+	le.canvases = nil
+}
+
+// dimensionAttr parses an image's width or height attribute. HTML gives
+// these as unitless pixel counts; CSS lengths are accepted too.
+func dimensionAttr(node *html.Node, name string) (float64, bool) {
+	v, ok := node.GetAttribute(name)
+	if !ok {
+		return 0, false
+	}
+	v = strings.TrimSpace(v)
+	if n, err := strconv.ParseFloat(v, 64); err == nil && n >= 0 {
+		return n, true
+	}
+	return css.ParseLength(v)
+}
@@ -0,0 +1,227 @@
+package layout
+
+import (
+	"louis14/pkg/css"
+	"louis14/pkg/html"
+)
+
+// Incremental re-layout
+//
+// When enabled with SetIncremental, Layout records the result of every
+// layoutNode call. A later Layout of the same document reuses the recorded
+// geometry for an element whose subtree is clean (no html.Node in it was
+// marked dirty by a mutation), whose computed styles are unchanged, and whose
+// layout inputs (available width, containing height) are the same. The
+// reused box is translated to the new position instead of being laid out.
+//
+// Layout that depends on engine-wide state is never reused: subtrees laid
+// out beside floats, subtrees that add floats or positioned boxes, and
+// subtrees that touch CSS counters or list numbering.
+
+// layoutRecord captures the inputs and output of one layoutNode call.
+type layoutRecord struct {
+	x, y           float64
+	availableWidth float64
+	parentHeight   float64
+	box            *Box // Snapshot taken when layoutNode returned
+}
+
+// incrementalState holds the records from the previous and current Layout.
+type incrementalState struct {
+	prev        map[*html.Node]*layoutRecord
+	cur         map[*html.Node]*layoutRecord
+	prevStyles  map[*html.Node]*css.Style
+	stylesheets []string
+	media       css.Media
+	reused      int // Number of subtrees reused during the last Layout
+}
+
+// SetIncremental enables or disables incremental re-layout.
+// Disabling discards all recorded layout results.
+func (le *LayoutEngine) SetIncremental(enabled bool) {
+	if !enabled {
+		le.incremental = nil
+		return
+	}
+	if le.incremental == nil {
+		le.incremental = &incrementalState{}
+	}
+}
+
+// ReusedSubtrees returns how many element subtrees the last Layout reused
+// from the previous one. Always zero when incremental layout is disabled.
+func (le *LayoutEngine) ReusedSubtrees() int {
+	if le.incremental == nil {
+		return 0
+	}
+	return le.incremental.reused
+}
+
+// beginIncrementalLayout rotates the record maps at the start of Layout and
+// drops all previous records if the viewport, media, or stylesheets changed.
+func (le *LayoutEngine) beginIncrementalLayout(doc *html.Document) {
+	inc := le.incremental
+	if inc == nil {
+		return
+	}
+	inc.prev = inc.cur
+	if inc.media != le.media() || !equalStrings(inc.stylesheets, doc.Stylesheets) {
+		inc.prev = nil
+	}
+	inc.cur = make(map[*html.Node]*layoutRecord)
+	inc.media = le.media()
+	inc.stylesheets = append([]string(nil), doc.Stylesheets...)
+	inc.reused = 0
+}
+
+// endIncrementalLayout remembers this layout's styles and clears dirty flags.
+func (le *LayoutEngine) endIncrementalLayout(doc *html.Document, computedStyles map[*html.Node]*css.Style) {
+	if le.incremental == nil {
+		return
+	}
+	le.incremental.prevStyles = computedStyles
+	doc.Root.ClearDirty()
+}
+
+// layoutNode lays out an element, reusing the previous result when
+// incremental layout is enabled and the subtree is unaffected.
+func (le *LayoutEngine) layoutNode(node *html.Node, x, y, availableWidth float64, computedStyles map[*html.Node]*css.Style, parent *Box) *Box {
+	inc := le.incremental
+	if inc == nil {
+		box := le.layoutNodeUncached(node, x, y, availableWidth, computedStyles, parent)
+		le.traceBox(box, availableWidth, false)
+		return box
+	}
+
+	parentHeight := 0.0
+	if parent != nil {
+		parentHeight = parent.Height
+	}
+	floatsInContext := len(le.floats) > le.floatBase
+
+	if !floatsInContext {
+		if rec := inc.prev[node]; rec != nil && rec.availableWidth == availableWidth &&
+			rec.parentHeight == parentHeight && node.IsSubtreeClean() &&
+			inc.stylesUnchanged(node, computedStyles) {
+			box := cloneBoxTree(rec.box, parent)
+			translateBox(box, x-rec.x, y-rec.y)
+			inc.cur[node] = rec
+			inc.reused++
+			le.traceBox(box, availableWidth, true)
+			return box
+		}
+	}
+
+	floatsBefore := len(le.floats)
+	absBefore := len(le.absoluteBoxes)
+	countersBefore := le.counterUses
+
+	box := le.layoutNodeUncached(node, x, y, availableWidth, computedStyles, parent)
+
+	if box != nil && !floatsInContext && len(le.floats) == floatsBefore &&
+		len(le.absoluteBoxes) == absBefore && le.counterUses == countersBefore {
+		inc.cur[node] = &layoutRecord{
+			x:              x,
+			y:              y,
+			availableWidth: availableWidth,
+			parentHeight:   parentHeight,
+			box:            cloneBoxTree(box, nil),
+		}
+	}
+	le.traceBox(box, availableWidth, false)
+	return box
+}
+
+// stylesUnchanged reports whether every node in the subtree has the same
+// computed style as in the previous layout.
+func (inc *incrementalState) stylesUnchanged(node *html.Node, computedStyles map[*html.Node]*css.Style) bool {
+	if node.Type == html.ElementNode && !computedStyles[node].Equal(inc.prevStyles[node]) {
+		return false
+	}
+	for _, child := range node.Children {
+		if !inc.stylesUnchanged(child, computedStyles) {
+			return false
+		}
+	}
+	return true
+}
+
+// cloneBoxTree deep-copies a box and its descendants, giving the copy the
+// supplied parent. Line box references are remapped to the copies.
+func cloneBoxTree(box *Box, parent *Box) *Box {
+	mapping := make(map[*Box]*Box)
+	clone := cloneBox(box, parent, mapping)
+	remapLineBoxes(clone, mapping)
+	return clone
+}
+
+func cloneBox(box *Box, parent *Box, mapping map[*Box]*Box) *Box {
+	clone := *box
+	clone.Parent = parent
+	mapping[box] = &clone
+	if box.Fragments != nil {
+		clone.Fragments = append([]BoxFragment(nil), box.Fragments...)
+	}
+	if box.Children != nil {
+		clone.Children = make([]*Box, len(box.Children))
+		for i, child := range box.Children {
+			clone.Children[i] = cloneBox(child, &clone, mapping)
+		}
+	}
+	return &clone
+}
+
+func remapLineBoxes(box *Box, mapping map[*Box]*Box) {
+	if box.LineBoxes != nil {
+		lines := make([]*LineBox, len(box.LineBoxes))
+		for i, lb := range box.LineBoxes {
+			line := *lb
+			line.Boxes = make([]*Box, len(lb.Boxes))
+			for j, b := range lb.Boxes {
+				if m, ok := mapping[b]; ok {
+					line.Boxes[j] = m
+				} else {
+					line.Boxes[j] = b
+				}
+			}
+			lines[i] = &line
+		}
+		box.LineBoxes = lines
+	}
+	for _, child := range box.Children {
+		remapLineBoxes(child, mapping)
+	}
+}
+
+// translateBox moves a box, its fragments, line boxes, and descendants.
+func translateBox(box *Box, dx, dy float64) {
+	if dx == 0 && dy == 0 {
+		return
+	}
+	box.X += dx
+	box.Y += dy
+	for i := range box.Fragments {
+		box.Fragments[i].X += dx
+		box.Fragments[i].Y += dy
+	}
+	for _, lb := range box.LineBoxes {
+		lb.Y += dy
+		lb.LeftEdge += dx
+		lb.RightEdge += dx
+	}
+	for _, child := range box.Children {
+		translateBox(child, dx, dy)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -194,6 +194,54 @@ func TestInlineLayoutBlockInInline(t *testing.T) {
 	// Just verify it doesn't crash for now
 }
 
+// TestInlineLayoutBlockInInlineSplitsInline tests that an inline containing
+// a block is broken into pieces around it (CSS 2.1 §9.2.1.1), in both a
+// block and a list item
+func TestInlineLayoutBlockInInlineSplitsInline(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0;font:10px Ahem">
+		<div><span id="multi" style="border:2px solid;padding:0 3px;position:relative;top:5px;opacity:0.5">aa<div id="multi-block">b</div>cc</span></div>
+		<div style="display:list-item;list-style:none"><span id="single" style="border:2px solid;padding:0 3px">aa<div id="single-block">b</div>cc</span></div>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 400), doc)
+
+	for _, id := range []string{"multi", "single"} {
+		block := findOnPage(boxes, id+"-block")
+		if block == nil || block.Parent == nil {
+			t.Fatalf("#%s-block: no box", id)
+		}
+		// The pieces of the inline are the block's siblings, boxes of the element
+		var pieces []*Box
+		for _, b := range block.Parent.Children {
+			if b.Node != nil && b.Node == findOnPage(boxes, id).Node {
+				pieces = append(pieces, b)
+			}
+		}
+		if len(pieces) != 2 {
+			t.Fatalf("#%s: expected 2 pieces beside the block, got %d", id, len(pieces))
+		}
+		first, last := pieces[0], pieces[1]
+		if first.Border.Left != 2 || first.Border.Right != 0 || first.Padding.Right != 0 ||
+			last.Border.Left != 0 || last.Padding.Left != 0 || last.Border.Right != 2 {
+			t.Errorf("#%s: expected only the outer edges, got %+v %+v and %+v %+v", id, first.Border, first.Padding, last.Border, last.Padding)
+		}
+		if !(first.Y < block.Y && block.Y < last.Y) || last.X != block.X || block.Width != 400 {
+			t.Errorf("#%s: expected the block full width between the pieces, got pieces at (%.1f, %.1f) and (%.1f, %.1f), block at (%.1f, %.1f) %.1f wide",
+				id, first.X, first.Y, last.X, last.Y, block.X, block.Y, block.Width)
+		}
+	}
+
+	// The block moves with the relatively positioned inline around it, and
+	// is composited in the inline's opacity group rather than taking on the
+	// opacity itself
+	block := findOnPage(boxes, "multi-block")
+	if block.Y != 15 || block.Style.GetOpacity() != 1 || block.OpacityGroup == nil || block.OpacityGroup.Style.GetOpacity() != 0.5 {
+		t.Errorf("expected the block 5px below its place at y=10 in an opacity 0.5 group, got y=%.1f, opacity %v and group %v", block.Y, block.Style.GetOpacity(), block.OpacityGroup)
+	}
+}
+
 // TestInlineLayoutComplexNesting tests deeply nested inline elements
 func TestInlineLayoutComplexNesting(t *testing.T) {
 	le := createTestEngine()
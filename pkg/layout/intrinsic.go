@@ -5,7 +5,6 @@ import (
 	"louis14/pkg/css"
 	"louis14/pkg/html"
 	"louis14/pkg/images"
-	"louis14/pkg/text"
 )
 
 func (le *LayoutEngine) ComputeMinMaxSizes(
@@ -49,19 +48,16 @@ func (le *LayoutEngine) ComputeMinMaxSizes(
 // Min size: width of longest word (won't wrap within words)
 // Max size: width of full text (preferred width without wrapping)
 func (le *LayoutEngine) computeTextMinMax(textContent string, style *css.Style) MinMaxSizes {
-	fontSize := style.GetFontSize()
-	isBold := style.GetFontWeight() == css.FontWeightBold
-
 	// Max size: full text width
-	maxWidth, _ := text.MeasureTextWithWeight(textContent, fontSize, isBold)
+	maxWidth, _ := measureStyledText(textContent, style)
 
 	// Min size: width of longest word
 	// Split text into words and measure each
-	words := strings.Fields(textContent)
+	words := strings.FieldsFunc(textContent, isCollapsibleWhitespace)
 	minWidth := 0.0
 
 	for _, word := range words {
-		wordWidth, _ := text.MeasureTextWithWeight(word, fontSize, isBold)
+		wordWidth, _ := measureStyledText(word, style)
 		if wordWidth > minWidth {
 			minWidth = wordWidth
 		}
@@ -237,7 +233,7 @@ func (le *LayoutEngine) computeStylesForTree(root *html.Node) map[*html.Node]*cs
 
 		// Compute style for this node using the full ComputeStyle API
 		// Use viewport dimensions from layout engine
-		styles[node] = css.ComputeStyle(node, le.stylesheets, le.viewport.width, le.viewport.height)
+		styles[node] = css.ComputeStyle(node, le.stylesheets, le.media())
 
 		// Recursively traverse children
 		for _, child := range node.Children {
@@ -265,7 +261,7 @@ func (le *LayoutEngine) ComputeIntrinsicSizes(node *html.Node, style *css.Style,
 	}
 
 	// Images have intrinsic dimensions
-	if node.TagName == "img" {
+	if isImageElement(node) {
 		return le.computeImageIntrinsicSizes(node, style)
 	}
 
@@ -290,24 +286,27 @@ func (le *LayoutEngine) ComputeIntrinsicSizes(node *html.Node, style *css.Style,
 	return le.computeBlockIntrinsicSizes(node, style, computedStyles, horizontalExtra)
 }
 
+// shrinkToFitWidth resolves the shrink-to-fit border-box width of a node
+// (CSS 2.1 §10.3.5): min(max(min-content, available), max-content).
+func (le *LayoutEngine) shrinkToFitWidth(node *html.Node, style *css.Style, computedStyles map[*html.Node]*css.Style, available float64) float64 {
+	sizes := le.ComputeIntrinsicSizes(node, style, computedStyles)
+	return min(max(sizes.MinContent, available), sizes.MaxContent)
+}
+
 // computeTextIntrinsicSizes computes intrinsic sizes for text content
 func (le *LayoutEngine) computeTextIntrinsicSizes(textContent string, style *css.Style) IntrinsicSizes {
 	if textContent == "" {
 		return IntrinsicSizes{}
 	}
 
-	fontSize := style.GetFontSize()
-	fontWeight := style.GetFontWeight()
-	bold := fontWeight == css.FontWeightBold
-
 	// Max-content: width without any wrapping
-	maxContent, _ := text.MeasureTextWithWeight(textContent, fontSize, bold)
+	maxContent, _ := measureStyledText(textContent, style)
 
 	// Min-content: width of longest word (break at spaces)
 	minContent := 0.0
-	words := strings.Fields(textContent)
+	words := strings.FieldsFunc(textContent, isCollapsibleWhitespace)
 	for _, word := range words {
-		wordWidth, _ := text.MeasureTextWithWeight(word, fontSize, bold)
+		wordWidth, _ := measureStyledText(word, style)
 		if wordWidth > minContent {
 			minContent = wordWidth
 		}
@@ -322,14 +321,14 @@ func (le *LayoutEngine) computeTextIntrinsicSizes(textContent string, style *css
 
 // computeImageIntrinsicSizes computes intrinsic sizes for images
 func (le *LayoutEngine) computeImageIntrinsicSizes(node *html.Node, style *css.Style) IntrinsicSizes {
-	src, _ := node.GetAttribute("src")
+	src, _ := le.imageSource(node)
 	if src == "" {
 		return IntrinsicSizes{}
 	}
 
 	// Try to get image dimensions
 	var imgWidth float64
-	if w, _, err := images.GetImageDimensionsWithFetcher(src, le.imageFetcher); err == nil {
+	if w, _, err := le.imageDimensions(node, src, style); err == nil {
 		imgWidth = float64(w)
 	}
 
@@ -347,7 +346,7 @@ func (le *LayoutEngine) computeImageIntrinsicSizes(node *html.Node, style *css.S
 
 // computeInlineIntrinsicSizes computes intrinsic sizes for inline elements
 func (le *LayoutEngine) computeInlineIntrinsicSizes(node *html.Node, style *css.Style, computedStyles map[*html.Node]*css.Style, horizontalExtra float64) IntrinsicSizes {
-	var minContent, maxContent float64
+	var minContent, maxContent, lineContent float64
 
 	for _, child := range node.Children {
 		childStyle := computedStyles[child]
@@ -362,9 +361,16 @@ func (le *LayoutEngine) computeInlineIntrinsicSizes(node *html.Node, style *css.
 		if childSizes.MinContent > minContent {
 			minContent = childSizes.MinContent
 		}
-		// Max-content: sum of all children (no wrapping)
-		maxContent += childSizes.MaxContent
+		// Max-content: sum of the children on a line (no wrapping); a
+		// block the inline is split around is a line of its own
+		if le.isBlockLevel(child, computedStyles) {
+			maxContent = max(maxContent, lineContent, childSizes.MaxContent)
+			lineContent = 0
+			continue
+		}
+		lineContent += childSizes.MaxContent
 	}
+	maxContent = max(maxContent, lineContent)
 
 	return IntrinsicSizes{
 		MinContent: minContent + horizontalExtra,
@@ -388,17 +394,8 @@ func (le *LayoutEngine) computeBlockIntrinsicSizes(node *html.Node, style *css.S
 
 	// Track current inline run for block containers
 	var inlineMinContent, inlineMaxContent float64
-
-	for _, child := range node.Children {
-		childStyle := computedStyles[child]
-		if childStyle == nil {
-			childStyle = css.NewStyle()
-		}
-
-		childSizes := le.ComputeIntrinsicSizes(child, childStyle, computedStyles)
-		childDisplay := childStyle.GetDisplay()
-
-		if childDisplay == css.DisplayBlock || childDisplay == css.DisplayListItem {
+	add := func(childSizes IntrinsicSizes, block bool) {
+		if block {
 			// Block child: flush inline run, then take max of block widths
 			if inlineMaxContent > maxContent {
 				maxContent = inlineMaxContent
@@ -424,6 +421,36 @@ func (le *LayoutEngine) computeBlockIntrinsicSizes(node *html.Node, style *css.S
 		}
 	}
 
+	add(le.pseudoIntrinsicSizes(node, "before", style))
+	for _, child := range node.Children {
+		childStyle := computedStyles[child]
+		if childStyle == nil && child.Type == html.TextNode {
+			childStyle = style // Text is measured in its container's font
+		} else if childStyle == nil {
+			childStyle = css.NewStyle()
+		}
+
+		if child.Type == html.ElementNode {
+			// Out-of-flow children don't contribute to the container's width
+			if pos := childStyle.GetPosition(); pos == css.PositionAbsolute || pos == css.PositionFixed {
+				continue
+			}
+		}
+
+		childSizes := le.ComputeIntrinsicSizes(child, childStyle, computedStyles)
+		if child.Type == html.ElementNode {
+			// Intrinsic sizes are border-box; the container holds the margin box
+			margin := childStyle.GetMargin()
+			childSizes.MinContent += margin.Left + margin.Right
+			childSizes.MaxContent += margin.Left + margin.Right
+		}
+		// Floats sit side by side with the inline run, so they accumulate like inlines
+		childDisplay := childStyle.GetDisplay()
+		add(childSizes, child.Type == html.ElementNode && childStyle.GetFloat() == css.FloatNone &&
+			(childDisplay == css.DisplayBlock || childDisplay == css.DisplayListItem))
+	}
+	add(le.pseudoIntrinsicSizes(node, "after", style))
+
 	// Flush final inline run
 	if inlineMaxContent > maxContent {
 		maxContent = inlineMaxContent
@@ -439,6 +466,54 @@ func (le *LayoutEngine) computeBlockIntrinsicSizes(node *html.Node, style *css.S
 	}
 }
 
+// pseudoIntrinsicSizes returns the intrinsic sizes of the content of a
+// node's ::before or ::after pseudo-element, and whether it is a block.
+// Counters are read without being incremented.
+func (le *LayoutEngine) pseudoIntrinsicSizes(node *html.Node, pseudoType string, style *css.Style) (IntrinsicSizes, bool) {
+	pseudoStyle := css.ComputePseudoElementStyle(node, pseudoType, le.stylesheets, le.media(), style)
+	contentValues, ok := pseudoStyle.GetContentValues()
+	if !ok || len(contentValues) == 0 {
+		return IntrinsicSizes{}, false
+	}
+	quotes := []string{"\"", "\""}
+	if q, ok := style.Get("quotes"); ok {
+		quotes = parseQuotes(q)
+	}
+
+	var content string
+	imageWidth := 0.0
+	for _, cv := range contentValues {
+		switch cv.Type {
+		case "text":
+			content += cv.Value
+		case "counter", "counters":
+			content += le.counterText(cv)
+		case "attr":
+			value, _ := node.GetAttribute(cv.Value)
+			content += value
+		case "open-quote":
+			if len(quotes) > 0 {
+				content += quotes[0]
+			}
+		case "close-quote":
+			if len(quotes) > 1 {
+				content += quotes[1]
+			}
+		case "url":
+			if w, _, err := images.GetImageDimensionsWithFetcher(le.fetchContext(), le.resolveImageURI(cv.Value), le.imageFetcher); err == nil {
+				imageWidth += float64(w)
+			}
+		}
+	}
+
+	sizes := le.computeTextIntrinsicSizes(content, pseudoStyle)
+	sizes.MinContent = max(sizes.MinContent, imageWidth)
+	sizes.MaxContent += imageWidth
+	sizes.Preferred += imageWidth
+	display := pseudoStyle.GetDisplay()
+	return sizes, display == css.DisplayBlock || display == css.DisplayListItem
+}
+
 // ============================================================================
 // Layout Mode Implementations
 // ============================================================================
@@ -448,10 +523,15 @@ func (m *BlockLayoutMode) ComputeIntrinsicSizes(le *LayoutEngine, node *html.Nod
 	return le.ComputeIntrinsicSizes(node, style, computedStyles)
 }
 
-// LayoutChildren for BlockLayoutMode - to be implemented as refactor progresses
-func (m *BlockLayoutMode) LayoutChildren(le *LayoutEngine, container *Box, children []*html.Node, availableWidth float64, computedStyles map[*html.Node]*css.Style) []*Box {
-	// This will be filled in as we refactor layoutNode
-	return nil
+// LayoutChildren for BlockLayoutMode stacks the children in normal flow,
+// with the inline content between them in lines
+func (m *BlockLayoutMode) LayoutChildren(le *LayoutEngine, container *Box, box *BoxTreeNode, availableWidth float64, computedStyles map[*html.Node]*css.Style) []*Box {
+	if container == nil {
+		return le.layoutBlockChildren(container, box, availableWidth, computedStyles)
+	}
+	boxes, lines := le.layoutBlockContainerChildren(container, box, availableWidth, computedStyles)
+	m.lines = lines
+	return boxes
 }
 
 // ComputeIntrinsicSizes for InlineLayoutMode
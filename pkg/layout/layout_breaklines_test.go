@@ -1,6 +1,7 @@
 package layout
 
 import (
+	"strings"
 	"testing"
 
 	"louis14/pkg/css"
@@ -416,3 +417,96 @@ func TestBreakLines_NoSideEffects(t *testing.T) {
 			originalItemCount, len(items))
 	}
 }
+
+func TestBreakStyledText_WithinWords(t *testing.T) {
+	// Ahem glyphs are 1em squares, so each letter is 10px wide
+	ahem := "font-family: Ahem; font-size: 10px; "
+	tests := []struct {
+		style  string
+		expect []string
+	}{
+		// A long word overflows its line unless overflow-wrap lets it break
+		{"", []string{"a", "bbbbbbbbbbbbbbb", "cc"}},
+		{"overflow-wrap: break-word", []string{"a", "bbbbbbbbbb", "bbbbb cc"}},
+		{"word-wrap: break-word", []string{"a", "bbbbbbbbbb", "bbbbb cc"}},
+		// break-all breaks between any letters, filling each line
+		{"word-break: break-all", []string{"a bbbbbbbb", "bbbbbbb cc"}},
+	}
+	for _, tt := range tests {
+		lines := breakStyledText("a bbbbbbbbbbbbbbb cc", css.ParseInlineStyle(ahem+tt.style), 100, 100)
+		if strings.Join(lines, "|") != strings.Join(tt.expect, "|") {
+			t.Errorf("%q: expected lines %q, got %q", tt.style, tt.expect, lines)
+		}
+	}
+}
+
+func TestBreakLines_TextIndentNarrowsFirstLine(t *testing.T) {
+	le := &LayoutEngine{}
+	constraint := NewConstraintSpace(100, 300)
+	constraint.TextIndent = 20
+
+	// "Hello World" fits in 100px, but not after a 20px indent
+	items := []*InlineItem{
+		{Type: InlineItemText, Text: "Hello", Width: 40, Height: 16},
+		{Type: InlineItemText, Text: " ", Width: 10, Height: 16},
+		{Type: InlineItemText, Text: "World", Width: 40, Height: 16},
+	}
+
+	lines := le.BreakLines(items, constraint, 0)
+
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(lines))
+	}
+	if lines[0].Indent != 20 || lines[1].Indent != 0 {
+		t.Errorf("Expected only the first line indented, got indents %f and %f", lines[0].Indent, lines[1].Indent)
+	}
+	if lines[1].Items[0].Text != "World" {
+		t.Errorf("Expected 'World' on second line, got '%s'", lines[1].Items[0].Text)
+	}
+}
+
+func TestBreakLines_TextBreaksWithinItem(t *testing.T) {
+	// Ahem glyphs are 1em squares, so each letter is 10px wide
+	ahem := "font-family: Ahem; font-size: 10px; "
+	tests := []struct {
+		style   string
+		text    string
+		leading float64 // Width of the content before the text on the first line
+		expect  []string
+	}{
+		{"", "aa bb cc dd", 0, []string{"aa bb", "cc dd"}},
+		// Text that starts partway through a line fills the rest of it
+		{"", "aa bb cc", 20, []string{"aa", "bb cc"}},
+		// A word too long for a line overflows it, unless overflow-wrap
+		// lets it break
+		{"", "a bbbbbbb cc", 0, []string{"a", "bbbbbbb", "cc"}},
+		{"overflow-wrap: break-word", "a bbbbbbb cc", 0, []string{"a", "bbbbb", "bb cc"}},
+		{"word-break: break-all", "a bbbbbbb cc", 0, []string{"a bbb", "bbbb", "cc"}},
+	}
+	for _, tt := range tests {
+		le := &LayoutEngine{}
+		style := css.ParseInlineStyle(ahem + tt.style)
+		width, _ := measureStyledText(tt.text, style)
+		items := []*InlineItem{{Type: InlineItemText, Text: tt.text, Style: style, Width: width, Height: 10}}
+		if tt.leading > 0 {
+			items = append([]*InlineItem{{Type: InlineItemAtomic, Width: tt.leading, Height: 10}}, items...)
+		}
+
+		lines := le.BreakLines(items, NewConstraintSpace(50, 300), 0)
+
+		var got []string
+		for _, line := range lines {
+			for _, item := range line.Items {
+				if item.Type == InlineItemText {
+					got = append(got, item.Text)
+				}
+			}
+		}
+		if strings.Join(got, "|") != strings.Join(tt.expect, "|") {
+			t.Errorf("%q %q: expected lines %q, got %q", tt.style, tt.text, tt.expect, got)
+		}
+		if items[len(items)-1].Text != tt.text {
+			t.Errorf("%q %q: expected the items to be left as they were", tt.style, tt.text)
+		}
+	}
+}
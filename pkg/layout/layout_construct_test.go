@@ -322,74 +322,6 @@ func TestConstructFragments_FloatPropagation(t *testing.T) {
 	}
 }
 
-func TestConstraintsChanged_NoChange(t *testing.T) {
-	constraint := NewConstraintSpace(400, 300)
-	lines := []*LineInfo{
-		{Y: 0, Height: 16},
-	}
-
-	// Same constraint
-	changed := constraintsChanged(constraint, constraint, lines)
-
-	if changed {
-		t.Error("Constraints should not have changed (same object)")
-	}
-}
-
-func TestConstraintsChanged_FloatAdded(t *testing.T) {
-	originalConstraint := NewConstraintSpace(400, 300)
-
-	// Add a float
-	es := originalConstraint.ExclusionSpace
-	excl := Exclusion{
-		Rect: Rect{X: 0, Y: 0, Width: 100, Height: 50},
-		Side: css.FloatLeft,
-	}
-	es = es.Add(excl)
-
-	finalConstraint := &ConstraintSpace{
-		AvailableSize:  originalConstraint.AvailableSize,
-		ExclusionSpace: es,
-	}
-
-	lines := []*LineInfo{
-		{Y: 0, Height: 16},
-	}
-
-	changed := constraintsChanged(originalConstraint, finalConstraint, lines)
-
-	if !changed {
-		t.Error("Constraints should have changed (float was added)")
-	}
-}
-
-func TestConstraintsChanged_AvailableWidthChanged(t *testing.T) {
-	original := NewConstraintSpace(400, 300)
-
-	// Create constraint with float that reduces available width
-	es := NewExclusionSpace()
-	excl := Exclusion{
-		Rect: Rect{X: 0, Y: 0, Width: 100, Height: 50},
-		Side: css.FloatLeft,
-	}
-	es = es.Add(excl)
-
-	final := &ConstraintSpace{
-		AvailableSize:  original.AvailableSize,
-		ExclusionSpace: es,
-	}
-
-	lines := []*LineInfo{
-		{Y: 10, Height: 16}, // Within float's Y range
-	}
-
-	changed := constraintsChanged(original, final, lines)
-
-	if !changed {
-		t.Error("Constraints should have changed (available width changed)")
-	}
-}
-
 func TestLayoutInlineContent_NoRetryNeeded(t *testing.T) {
 	le := &LayoutEngine{
 		viewport: struct {
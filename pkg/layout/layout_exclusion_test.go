@@ -158,6 +158,28 @@ func TestExclusionSpace_StackedLeftFloats(t *testing.T) {
 	}
 }
 
+func TestExclusionSpace_StackedRightFloats(t *testing.T) {
+	// Three right floats in a 400px container: a short one at the right
+	// edge, a tall one beside it, and one placed beside those below Y=50
+	es := NewExclusionSpace().
+		Add(Exclusion{Rect: Rect{X: 350, Y: 0, Width: 50, Height: 50}, Side: css.FloatRight}).
+		Add(Exclusion{Rect: Rect{X: 300, Y: 0, Width: 50, Height: 200}, Side: css.FloatRight}).
+		Add(Exclusion{Rect: Rect{X: 220, Y: 60, Width: 80, Height: 20}, Side: css.FloatRight})
+
+	// Beside both of the first two, the band ends at the second's left edge
+	if leftOff, rightOff := es.AvailableInlineSize(10, 10); leftOff != 0 || rightOff != 100 {
+		t.Errorf("Expected (0, 100) beside two right floats, got (%f, %f)", leftOff, rightOff)
+	}
+	// Below the first, the second still reaches 100px in
+	if _, rightOff := es.AvailableInlineSize(55, 2); rightOff != 100 {
+		t.Errorf("Expected the tall float to keep a 100px offset, got %f", rightOff)
+	}
+	// The third reaches furthest
+	if _, rightOff := es.AvailableInlineSize(65, 10); rightOff != 180 {
+		t.Errorf("Expected a 180px offset beside the third float, got %f", rightOff)
+	}
+}
+
 func TestExclusionSpace_VerticalOverlapDetection(t *testing.T) {
 	es := NewExclusionSpace()
 
@@ -233,3 +255,33 @@ func TestExclusionSpace_Immutability(t *testing.T) {
 		t.Errorf("es2 should still have offset=100 after creating es3, got offset=%f", leftOff)
 	}
 }
+
+func TestExclusionSpace_OffsetsAndClearY(t *testing.T) {
+	es := NewExclusionSpace().
+		Add(Exclusion{Rect: Rect{X: 0, Y: 0, Width: 100, Height: 50}, Side: css.FloatLeft}).
+		Add(Exclusion{Rect: Rect{X: 320, Y: 0, Width: 80, Height: 30}, Side: css.FloatRight})
+
+	// Offsets are measured from the content box edges passed in
+	leftOff, rightOff := es.Offsets(10, 0, 20, 400)
+	if leftOff != 80 || rightOff != 80 {
+		t.Errorf("expected offsets 80/80, got %f/%f", leftOff, rightOff)
+	}
+
+	// A band reaching into the floats is narrowed; a point below them isn't
+	if leftOff, _ = es.Offsets(-10, 15, 0, 400); leftOff != 100 {
+		t.Errorf("expected band overlapping the float to be narrowed, got %f", leftOff)
+	}
+	if leftOff, rightOff = es.Offsets(50, 0, 0, 400); leftOff != 0 || rightOff != 0 {
+		t.Errorf("expected no offsets below the floats, got %f/%f", leftOff, rightOff)
+	}
+
+	if y := es.ClearY(css.ClearRight, 0); y != 30 {
+		t.Errorf("clear: right should move to 30, got %f", y)
+	}
+	if y := es.ClearY(css.ClearBoth, 0); y != 50 {
+		t.Errorf("clear: both should move to 50, got %f", y)
+	}
+	if y := es.ClearY(css.ClearLeft, 60); y != 60 {
+		t.Errorf("clear: left below the floats should stay at 60, got %f", y)
+	}
+}
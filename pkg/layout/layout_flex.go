@@ -5,9 +5,12 @@ import (
 	"louis14/pkg/html"
 	"math"
 	"sort"
+	"strconv"
 )
 
-func (le *LayoutEngine) layoutFlex(flexBox *Box, x, y, availableWidth float64, computedStyles map[*html.Node]*css.Style) {
+// definiteHeight reports whether the container's height is specified, as a
+// length or a percentage of a definite height; min-height doesn't count.
+func (le *LayoutEngine) layoutFlex(flexBox *Box, box *BoxTreeNode, availableWidth float64, definiteHeight bool, computedStyles map[*html.Node]*css.Style) {
 	direction := flexBox.Style.GetFlexDirection()
 	wrap := flexBox.Style.GetFlexWrap()
 	justifyContent := flexBox.Style.GetJustifyContent()
@@ -17,6 +20,8 @@ func (le *LayoutEngine) layoutFlex(flexBox *Box, x, y, availableWidth float64, c
 	isRow := direction == css.FlexDirectionRow || direction == css.FlexDirectionRowReverse
 	isReverse := direction == css.FlexDirectionRowReverse || direction == css.FlexDirectionColumnReverse
 	isWrapReverse := wrap == css.FlexWrapWrapReverse
+	le.tracef(TraceFlex, TraceInfo, "%s at (%.1f, %.1f) in %.1f, direction=%v wrap=%v",
+		getNodeName(flexBox.Node), flexBox.X, flexBox.Y, availableWidth, direction, wrap)
 
 	// CSS Box Alignment §6.1: left/right only apply to the inline axis.
 	// For row direction (inline axis = main), left→flex-start, right→flex-end.
@@ -40,12 +45,12 @@ func (le *LayoutEngine) layoutFlex(flexBox *Box, x, y, availableWidth float64, c
 	hasDefiniteCross := false
 	if isRow {
 		mainSize = contentBoxWidth
-		if contentBoxHeight > 0 {
+		if definiteHeight {
 			crossSize = contentBoxHeight
 			hasDefiniteCross = true
 		}
 	} else {
-		if contentBoxHeight > 0 {
+		if definiteHeight {
 			mainSize = contentBoxHeight
 		} else {
 			mainSize = math.MaxFloat64 // indefinite
@@ -63,22 +68,8 @@ func (le *LayoutEngine) layoutFlex(flexBox *Box, x, y, availableWidth float64, c
 		}
 	}
 
-	// Get gap values
-	rowGap := 0.0
-	colGap := 0.0
-	if val, ok := flexBox.Style.Get("row-gap"); ok {
-		if g, ok := css.ParseLengthWithFontSize(val, flexBox.Style.GetFontSize()); ok {
-			rowGap = g
-		}
-	}
-	if val, ok := flexBox.Style.Get("column-gap"); ok {
-		if pct, ok := css.ParsePercentage(val); ok {
-			// column-gap percentages always resolve against the inline size (width)
-			colGap = contentBoxWidth * pct / 100
-		} else if g, ok := css.ParseLengthWithFontSize(val, flexBox.Style.GetFontSize()); ok {
-			colGap = g
-		}
-	}
+	// Get gap values; percentages of an auto height resolve against zero
+	rowGap, colGap := flexBox.Style.GetGap(max(contentBoxHeight, 0), contentBoxWidth)
 	// For flex, column-gap is the main-axis gap (row direction), row-gap is cross-axis gap
 	var mainGap, crossGap float64
 	if isRow {
@@ -92,7 +83,7 @@ func (le *LayoutEngine) layoutFlex(flexBox *Box, x, y, availableWidth float64, c
 	// Step 1: Create flex items by laying out children to get intrinsic sizes
 	contentStartX := flexBox.X + flexBox.Border.Left + flexBox.Padding.Left
 	contentStartY := flexBox.Y + flexBox.Border.Top + flexBox.Padding.Top
-	items := le.createFlexItemsProper(flexBox, contentStartX, contentStartY, contentBoxWidth, computedStyles, isRow)
+	items := le.createFlexItemsProper(flexBox, box, contentStartX, contentStartY, contentBoxWidth, mainSize, computedStyles, isRow)
 
 	// Step 2: Sort by order property
 	sort.SliceStable(items, func(i, j int) bool {
@@ -102,14 +93,15 @@ func (le *LayoutEngine) layoutFlex(flexBox *Box, x, y, availableWidth float64, c
 	// Step 3: Determine flex base size and hypothetical main size for each item
 	for _, item := range items {
 		basisVal := item.Box.Style.GetFlexBasisValue()
-		if basisVal.IsAuto {
+		// A percentage of an indefinite main size behaves as auto
+		if basisVal.IsAuto || basisVal.IsPercent && mainSize == math.MaxFloat64 {
 			// flex-basis: auto → use the item's main size property
 			if isRow {
 				if w, ok := item.Box.Style.GetLength("width"); ok {
 					item.FlexBasis = w
 				} else {
-					// Use content size (already laid out)
-					item.FlexBasis = item.Box.Width - item.Box.Padding.Left - item.Box.Padding.Right - item.Box.Border.Left - item.Box.Border.Right
+					// Content-based basis: the item's max-content width
+					item.FlexBasis = le.flexItemMaxContentWidth(item)
 				}
 			} else {
 				if h, ok := item.Box.Style.GetLength("height"); ok {
@@ -125,14 +117,7 @@ func (le *LayoutEngine) layoutFlex(flexBox *Box, x, y, availableWidth float64, c
 		}
 
 		// Hypothetical main size = flex base size clamped by min/max
-		item.HypotheticalMainSize = item.FlexBasis
-		// Clamp by min-width: auto
-		if item.HypotheticalMainSize < item.AutoMinMain {
-			item.HypotheticalMainSize = item.AutoMinMain
-		}
-		if item.HypotheticalMainSize < 0 {
-			item.HypotheticalMainSize = 0
-		}
+		item.HypotheticalMainSize = item.clampMain(item.FlexBasis)
 	}
 
 	// Step 3b: For shrink-to-fit flex containers (float, inline-flex, abs pos without
@@ -176,6 +161,26 @@ func (le *LayoutEngine) layoutFlex(flexBox *Box, x, y, availableWidth float64, c
 		}
 	}
 
+	// Step 3c: A column without a definite height breaks its lines at its
+	// max-height, and is as tall as its longest line within its min and max
+	// heights; its items then flex within that height (CSS Flexbox §9.2)
+	autoHeightColumn := !isRow && mainSize == math.MaxFloat64
+	if autoHeightColumn {
+		limit := math.MaxFloat64
+		if maxHeight, ok := flexBox.Style.GetLength("max-height"); ok {
+			limit = maxHeight
+		}
+		longest := 0.0
+		for _, line := range collectFlexLines(items, limit, mainGap, wrap, isRow) {
+			length := mainGap * float64(len(line.Items)-1)
+			for _, item := range line.Items {
+				length += item.HypotheticalOuterMain(isRow)
+			}
+			longest = max(longest, length)
+		}
+		mainSize = clampLength(flexBox.Style, "min-height", "max-height", longest)
+	}
+
 	// Step 4: Collect items into flex lines
 	lines := collectFlexLines(items, mainSize, mainGap, wrap, isRow)
 
@@ -184,6 +189,14 @@ func (le *LayoutEngine) layoutFlex(flexBox *Box, x, y, availableWidth float64, c
 		resolveFlexibleLengths(line, mainSize, mainGap, isRow)
 	}
 
+	// Step 5b: Lay the items out again at their resolved main sizes, so that
+	// their content flows within them and their cross sizes follow from it
+	for _, line := range lines {
+		for _, item := range line.Items {
+			le.relayoutFlexItem(flexBox, item, contentStartX, contentStartY, contentBoxWidth, computedStyles, alignItems, isRow)
+		}
+	}
+
 	// Step 6: Determine cross sizes
 	for _, line := range lines {
 		for _, item := range line.Items {
@@ -204,6 +217,23 @@ func (le *LayoutEngine) layoutFlex(flexBox *Box, x, y, availableWidth float64, c
 		line.CrossSize = maxCross
 	}
 
+	// Without a definite cross size, the container is as large as its lines
+	// within its min and max cross sizes, and a single line fills it (CSS
+	// Flexbox §9.4 steps 8 and 15)
+	autoCross := !hasDefiniteCross
+	if autoCross {
+		minProperty, maxProperty := "min-height", "max-height"
+		if !isRow {
+			minProperty, maxProperty = "min-width", "max-width"
+		}
+		linesCross := crossGap * float64(len(lines)-1)
+		for _, line := range lines {
+			linesCross += line.CrossSize
+		}
+		crossSize = clampLength(flexBox.Style, minProperty, maxProperty, linesCross)
+		hasDefiniteCross = true
+	}
+
 	// Single-line container with definite cross size: use container's cross size
 	if wrap == css.FlexWrapNowrap && hasDefiniteCross && len(lines) == 1 {
 		lines[0].CrossSize = crossSize
@@ -252,16 +282,20 @@ func (le *LayoutEngine) layoutFlex(flexBox *Box, x, y, availableWidth float64, c
 				if outerCross < line.CrossSize {
 					// Stretch item to fill line's cross size
 					crossMargin := 0.0
+					// The stretched size still honors min and max sizes
 					if isRow {
 						crossMargin = item.Box.Margin.Top + item.Box.Margin.Bottom
-						newHeight := line.CrossSize - crossMargin
+						pb := item.Box.Padding.Top + item.Box.Padding.Bottom + item.Box.Border.Top + item.Box.Border.Bottom
+						newHeight := clampLength(item.Box.Style, "min-height", "max-height", line.CrossSize-crossMargin-pb) + pb
 						item.Box.Height = newHeight
+						item.CrossSize = newHeight + crossMargin
 					} else {
 						crossMargin = item.Box.Margin.Left + item.Box.Margin.Right
-						newWidth := line.CrossSize - crossMargin
+						pb := item.Box.Padding.Left + item.Box.Padding.Right + item.Box.Border.Left + item.Box.Border.Right
+						newWidth := clampLength(item.Box.Style, "min-width", "max-width", line.CrossSize-crossMargin-pb) + pb
 						item.Box.Width = newWidth
+						item.CrossSize = newWidth + crossMargin
 					}
-					item.CrossSize = line.CrossSize
 				}
 			}
 		}
@@ -280,11 +314,6 @@ func (le *LayoutEngine) layoutFlex(flexBox *Box, x, y, availableWidth float64, c
 			}
 		}
 		freeSpace := mainSize - totalItemsMain
-		// For indefinite main size (auto-height column containers), the container
-		// shrink-wraps to content, so there's no free space to distribute.
-		if mainSize == math.MaxFloat64 {
-			freeSpace = 0
-		}
 
 		// Preserve original free space for justify-content fallback detection
 		originalFreeSpace := freeSpace
@@ -384,11 +413,7 @@ func (le *LayoutEngine) layoutFlex(flexBox *Box, x, y, availableWidth float64, c
 
 		currentPos := initialOffset
 		for i, item := range line.Items {
-			if isRow {
-				item.MainPos = currentPos + item.Box.Margin.Left
-			} else {
-				item.MainPos = currentPos + item.Box.Margin.Top
-			}
+			item.MainPos = currentPos + item.mainStartMargin(isRow, isReverse)
 			currentPos += item.outerMainSize(isRow) + spacing
 			if i < len(line.Items)-1 {
 				currentPos += mainGap
@@ -460,6 +485,16 @@ func (le *LayoutEngine) layoutFlex(flexBox *Box, x, y, availableWidth float64, c
 					pos += crossGap
 				}
 			}
+		case css.AlignContentSpaceEvenly:
+			lineSpacing := freeSpace / float64(len(lines)+1)
+			pos := lineSpacing
+			for i, line := range lines {
+				lineOffsets = append(lineOffsets, pos)
+				pos += line.CrossSize + lineSpacing
+				if i < len(lines)-1 {
+					pos += crossGap
+				}
+			}
 		}
 
 		// Position items within lines using computed offsets
@@ -483,25 +518,7 @@ func (le *LayoutEngine) layoutFlex(flexBox *Box, x, y, availableWidth float64, c
 
 	// Step 11: Reverse if needed
 	if isReverse {
-		// For indefinite main size (e.g., column-reverse with auto height),
-		// compute the actual used main size from item positions
 		effectiveMainSize := mainSize
-		if effectiveMainSize == math.MaxFloat64 {
-			effectiveMainSize = 0
-			for _, line := range lines {
-				for _, item := range line.Items {
-					var itemEnd float64
-					if isRow {
-						itemEnd = item.MainPos + item.Box.Width + item.Box.Margin.Right
-					} else {
-						itemEnd = item.MainPos + item.Box.Height + item.Box.Margin.Bottom
-					}
-					if itemEnd > effectiveMainSize {
-						effectiveMainSize = itemEnd
-					}
-				}
-			}
-		}
 		for lineIdx, line := range lines {
 			for _, item := range line.Items {
 				// Mirror main-axis position
@@ -553,98 +570,65 @@ func (le *LayoutEngine) layoutFlex(flexBox *Box, x, y, availableWidth float64, c
 		}
 	}
 
-	// Step 12: Set final box positions
-	flexBox.Children = flexBox.Children[:0]
+	// Step 12: Set final box positions. order and the reverse directions
+	// only move the items; their boxes stay in document order, which is the
+	// order they paint and overlap in.
+	documentOrder := make([]*FlexItem, 0, len(items))
 	for _, line := range lines {
-		for _, item := range line.Items {
-			oldX := item.Box.X
-			oldY := item.Box.Y
-			if isRow {
-				item.Box.X = contentStartX + item.MainPos
-				item.Box.Y = contentStartY + item.CrossPos
-			} else {
-				item.Box.X = contentStartX + item.CrossPos
-				item.Box.Y = contentStartY + item.MainPos
-			}
-			// Re-position children relative to new box position
-			deltaX := item.Box.X - oldX
-			deltaY := item.Box.Y - oldY
-			le.repositionFlexItemChildren(item.Box, deltaX, deltaY)
-			flexBox.Children = append(flexBox.Children, item.Box)
+		documentOrder = append(documentOrder, line.Items...)
+	}
+	sort.SliceStable(documentOrder, func(i, j int) bool {
+		return documentOrder[i].DocumentIndex < documentOrder[j].DocumentIndex
+	})
+	flexBox.Children = flexBox.Children[:0]
+	for _, item := range documentOrder {
+		oldX := item.Box.X
+		oldY := item.Box.Y
+		// A relatively positioned item moves off its place in the line
+		relX, relY := relativeOffset(item.Box.Style)
+		if isRow {
+			item.Box.X = contentStartX + item.MainPos + relX
+			item.Box.Y = contentStartY + item.CrossPos + relY
+		} else {
+			item.Box.X = contentStartX + item.CrossPos + relX
+			item.Box.Y = contentStartY + item.MainPos + relY
 		}
+		// Re-position children relative to new box position
+		deltaX := item.Box.X - oldX
+		deltaY := item.Box.Y - oldY
+		le.repositionFlexItemChildren(item.Box, deltaX, deltaY)
+		flexBox.Children = append(flexBox.Children, item.Box)
 	}
 
 	// Step 13: Update container auto width for column direction
-	if !isRow && !hasDefiniteCross {
-		totalCrossSize := 0.0
-		for i, line := range lines {
-			totalCrossSize += line.CrossSize
-			if i > 0 {
-				totalCrossSize += crossGap
-			}
-		}
-		flexBox.Width = totalCrossSize + flexBox.Padding.Left + flexBox.Padding.Right + flexBox.Border.Left + flexBox.Border.Right
+	if !isRow && autoCross {
+		flexBox.Width = crossSize + flexBox.Padding.Left + flexBox.Padding.Right + flexBox.Border.Left + flexBox.Border.Right
 	}
 
-	// Step 14: Update container auto height
-	if !hasDefiniteCross || (isRow && contentBoxHeight == 0) {
-		maxBottom := 0.0
-		for _, child := range flexBox.Children {
-			childBottom := child.Y + child.Height + child.Margin.Bottom - contentStartY
-			if childBottom > maxBottom {
-				maxBottom = childBottom
-			}
-		}
-		if isRow {
-			flexBox.Height = maxBottom + flexBox.Padding.Top + flexBox.Padding.Bottom + flexBox.Border.Top + flexBox.Border.Bottom
-		}
+	// Step 14: Update container auto height, from its lines in a row, or its
+	// main size in a column
+	if isRow && autoCross {
+		flexBox.Height = crossSize + flexBox.Padding.Top + flexBox.Padding.Bottom + flexBox.Border.Top + flexBox.Border.Bottom
 	}
-	if !isRow && mainSize == math.MaxFloat64 {
-		maxBottom := 0.0
-		for _, child := range flexBox.Children {
-			childBottom := child.Y + child.Height + child.Margin.Bottom - contentStartY
-			if childBottom > maxBottom {
-				maxBottom = childBottom
-			}
-		}
-		flexBox.Height = maxBottom + flexBox.Padding.Top + flexBox.Padding.Bottom + flexBox.Border.Top + flexBox.Border.Bottom
+	if autoHeightColumn {
+		flexBox.Height = mainSize + flexBox.Padding.Top + flexBox.Padding.Bottom + flexBox.Border.Top + flexBox.Border.Bottom
 	}
 }
 
 // createFlexItemsProper creates flex items by laying out each child to get proper dimensions.
-func (le *LayoutEngine) createFlexItemsProper(flexBox *Box, startX, startY, availableWidth float64, computedStyles map[*html.Node]*css.Style, isRow bool) []*FlexItem {
+// mainSize is the container's main size, for percentage min and max sizes.
+// The box tree has made each run of text in the container an anonymous item.
+func (le *LayoutEngine) createFlexItemsProper(flexBox *Box, box *BoxTreeNode, startX, startY, availableWidth, mainSize float64, computedStyles map[*html.Node]*css.Style, isRow bool) []*FlexItem {
 	items := make([]*FlexItem, 0)
 
-	for _, child := range flexBox.Node.Children {
-		if child.Type == html.TextNode {
-			// Anonymous flex items for text (skip whitespace-only)
-			text := child.Text
-			trimmed := ""
-			for _, c := range text {
-				if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
-					trimmed += string(c)
-				}
-			}
-			if trimmed == "" {
-				continue
-			}
-			// TODO: handle anonymous text flex items
-			continue
-		}
-		if child.Type != html.ElementNode {
-			continue
-		}
-
+	for _, kid := range box.Children {
+		child := kid.source
 		childStyle := computedStyles[child]
 		if childStyle == nil {
-			childStyle = css.ComputeStyle(child, le.stylesheets, le.viewport.width, le.viewport.height)
+			childStyle = css.ComputeStyle(child, le.stylesheets, le.media())
 			computedStyles[child] = childStyle
 		}
 
-		if childStyle.GetDisplay() == css.DisplayNone {
-			continue
-		}
-
 		// CSS Flexbox §4: Blockification of flex items
 		// Children of a flex container have their display value blockified:
 		// inline → block, inline-block → block, inline-flex → flex
@@ -664,26 +648,23 @@ func (le *LayoutEngine) createFlexItemsProper(flexBox *Box, startX, startY, avai
 			FlexShrink: childStyle.GetFlexShrink(),
 			Order:      childStyle.GetOrder(),
 		}
-
-		// Compute min-width: auto (CSS Flexbox §4.5)
-		// For flex items with overflow: visible, min-width/min-height: auto
-		// computes to the content-based minimum size
-		overflow := "visible"
-		if v, ok := childStyle.Get("overflow"); ok {
-			overflow = v
+		item.DocumentIndex = len(items)
+
+		// Main size constraints from min-width/max-width, or the heights
+		// in a column. min-width: auto computes to the content-based
+		// minimum size for items with overflow: visible (CSS Flexbox §4.5)
+		minProperty, maxProperty, percentBase := "min-width", "max-width", availableWidth
+		if !isRow {
+			minProperty, maxProperty, percentBase = "min-height", "max-height", mainSize
 		}
-		hasExplicitMin := false
-		if isRow {
-			if _, ok := childStyle.GetLength("min-width"); ok {
-				hasExplicitMin = true
-			}
-		} else {
-			if _, ok := childStyle.GetLength("min-height"); ok {
-				hasExplicitMin = true
-			}
+		item.MaxMain = math.Inf(1)
+		if v, ok := flexItemLength(childStyle, maxProperty, percentBase); ok {
+			item.MaxMain = v
 		}
-		if !hasExplicitMin && overflow == "visible" {
-			item.AutoMinMain = le.computeFlexItemAutoMinMain(child, childStyle, childBox, isRow)
+		if v, ok := flexItemLength(childStyle, minProperty, percentBase); ok {
+			item.MinMain = v
+		} else if childStyle.GetOverflow() == css.OverflowVisible {
+			item.MinMain = min(le.computeFlexItemAutoMinMain(child, childStyle, childBox, isRow), item.MaxMain)
 		}
 
 		items = append(items, item)
@@ -692,6 +673,104 @@ func (le *LayoutEngine) createFlexItemsProper(flexBox *Box, startX, startY, avai
 	return items
 }
 
+// flexItemMaxContentWidth returns the max-content width of an item's
+// content box. A row flex container's items sit side by side, so their
+// widths add up; block content takes the widest of its children.
+func (le *LayoutEngine) flexItemMaxContentWidth(item *FlexItem) float64 {
+	node, style := item.Box.Node, item.Box.Style
+	if node == nil || style == nil {
+		return 0
+	}
+	constraint := &ConstraintSpace{AvailableSize: Size{Width: le.viewport.width}}
+	display := style.GetDisplay()
+	direction := style.GetFlexDirection()
+	if (display == css.DisplayFlex || display == css.DisplayInlineFlex) &&
+		(direction == css.FlexDirectionRow || direction == css.FlexDirectionRowReverse) {
+		width := 0.0
+		for _, child := range node.Children {
+			childStyle := css.ComputeStyle(child, le.stylesheets, le.media())
+			if childStyle == nil || childStyle.GetDisplay() == css.DisplayNone {
+				continue
+			}
+			width += le.ComputeMinMaxSizes(child, constraint, childStyle).MaxContentSize
+		}
+		return width
+	}
+	sizes := le.ComputeMinMaxSizes(node, constraint, style)
+	return max(sizes.MaxContentSize-item.mainPaddingBorder(true), 0)
+}
+
+// relayoutFlexItem lays an item out again with its main size fixed at the
+// one resolved for it, replacing its box. In a column, an item that isn't
+// stretched across the container shrinks to fit its content. The margins
+// of the first layout are kept, for the positioning to come.
+func (le *LayoutEngine) relayoutFlexItem(flexBox *Box, item *FlexItem, x, y, availableWidth float64, computedStyles map[*html.Node]*css.Style, alignItems css.AlignItems, isRow bool) {
+	node := item.Box.Node
+	style := computedStyles[node]
+	if node == nil || style == nil {
+		return
+	}
+	sized := css.NewStyle()
+	sized.ViewportWidth, sized.ViewportHeight, sized.RootFontSize = style.ViewportWidth, style.ViewportHeight, style.RootFontSize
+	sized.Fonts = style.Fonts
+	for property, value := range style.Properties {
+		sized.Properties[property] = value
+	}
+	px := func(v float64) string { return strconv.FormatFloat(max(v, 0), 'f', -1, 64) + "px" }
+	if isRow {
+		sized.Set("width", px(item.MainSize))
+		delete(sized.Properties, "min-width")
+		delete(sized.Properties, "max-width")
+	} else {
+		sized.Set("height", px(item.MainSize))
+		delete(sized.Properties, "min-height")
+		delete(sized.Properties, "max-height")
+		width, hasWidth := style.Get("width")
+		if (!hasWidth || width == "auto") && resolveAlignment(alignItems, style.GetAlignSelf()) != css.AlignItemsStretch {
+			room := availableWidth - item.Box.Margin.Left - item.Box.Margin.Right -
+				item.Box.Padding.Left - item.Box.Padding.Right - item.Box.Border.Left - item.Box.Border.Right
+			sized.Set("width", px(min(le.flexItemMaxContentWidth(item), room)))
+		}
+	}
+
+	computedStyles[node] = sized
+	box := le.layoutNodeUncached(node, x, y, availableWidth, computedStyles, flexBox)
+	computedStyles[node] = style
+	if box == nil {
+		return
+	}
+	box.Style = style
+	box.Margin = item.Box.Margin
+	item.Box = box
+}
+
+// flexItemLength returns a min or max size property of a flex item, with
+// percentages of base, which is math.MaxFloat64 when indefinite.
+func flexItemLength(style *css.Style, property string, base float64) (float64, bool) {
+	if base == math.MaxFloat64 {
+		return style.GetLength(property)
+	}
+	return style.GetLengthPercentage(property, base)
+}
+
+// clampLength clamps a content size by style's min and max size properties,
+// the minimum winning where they conflict.
+func clampLength(style *css.Style, minProperty, maxProperty string, size float64) float64 {
+	if v, ok := style.GetLength(maxProperty); ok {
+		size = min(size, v)
+	}
+	if v, ok := style.GetLength(minProperty); ok {
+		size = max(size, v)
+	}
+	return max(size, 0)
+}
+
+// clampMain clamps a main size between the item's minimum and maximum, the
+// minimum winning where they conflict.
+func (item *FlexItem) clampMain(size float64) float64 {
+	return max(min(size, item.MaxMain), item.MinMain, 0)
+}
+
 // collectFlexLines collects flex items into lines based on wrapping rules.
 func collectFlexLines(items []*FlexItem, mainSize, mainGap float64, wrap css.FlexWrap, isRow bool) []*FlexLine {
 	if wrap == css.FlexWrapNowrap || len(items) == 0 {
@@ -749,14 +828,13 @@ func resolveFlexibleLengths(line *FlexLine, availableMain, mainGap float64, isRo
 	}
 	states := make([]flexState, len(line.Items))
 	for i, item := range line.Items {
-		if growing && item.FlexGrow == 0 {
-			states[i].frozen = true
-			states[i].targetMain = item.HypotheticalMainSize
-		} else if !growing && item.FlexShrink == 0 {
-			states[i].frozen = true
-			states[i].targetMain = item.HypotheticalMainSize
+		states[i].targetMain = item.HypotheticalMainSize
+		// Items that can't flex, or that min/max already hold away from
+		// their basis in the direction of flexing, keep their hypothetical size
+		if growing {
+			states[i].frozen = item.FlexGrow == 0 || item.FlexBasis > item.HypotheticalMainSize
 		} else {
-			states[i].targetMain = item.HypotheticalMainSize
+			states[i].frozen = item.FlexShrink == 0 || item.FlexBasis < item.HypotheticalMainSize
 		}
 	}
 
@@ -818,43 +896,29 @@ func resolveFlexibleLengths(line *FlexLine, availableMain, mainGap float64, isRo
 			}
 		}
 
-		// Clamp by min/max and detect violations
+		// Clamp by min/max and detect violations (CSS Flexbox §9.7 step 4d)
 		totalViolation := 0.0
+		violations := make([]float64, len(line.Items))
 		for i, item := range line.Items {
 			if states[i].frozen {
 				continue
 			}
-			clamped := states[i].targetMain
-			// Clamp by min-width: auto (content-based minimum)
-			if clamped < item.AutoMinMain {
-				clamped = item.AutoMinMain
-			}
-			if clamped < 0 {
-				clamped = 0
-			}
-			totalViolation += clamped - states[i].targetMain
+			clamped := item.clampMain(states[i].targetMain)
+			violations[i] = clamped - states[i].targetMain
+			totalViolation += violations[i]
 			states[i].targetMain = clamped
 		}
 
-		// Freeze violating items
-		if totalViolation == 0 {
-			// Freeze all
-			for i := range states {
+		// Freeze violating items: all of them if the violations cancel out,
+		// else those held at their minimum or at their maximum
+		for i := range states {
+			switch {
+			case totalViolation == 0:
+				states[i].frozen = true
+			case totalViolation > 0 && violations[i] > 0:
+				states[i].frozen = true
+			case totalViolation < 0 && violations[i] < 0:
 				states[i].frozen = true
-			}
-		} else if totalViolation > 0 {
-			// Freeze items that hit minimum
-			for i := range states {
-				if !states[i].frozen && states[i].targetMain <= 0 {
-					states[i].frozen = true
-				}
-			}
-		} else {
-			// Freeze items that hit maximum
-			for i := range states {
-				if !states[i].frozen {
-					states[i].frozen = true // simplified: freeze all on negative violation
-				}
 			}
 		}
 	}
@@ -985,13 +1049,11 @@ func (le *LayoutEngine) repositionFlexItemChildren(box *Box, deltaX, deltaY floa
 		// Recursively shift grandchildren
 		le.repositionFlexItemChildren(child, deltaX, deltaY)
 	}
-	// Also shift line boxes if any
+	// Also shift line boxes if any; their boxes are children, shifted above
 	for _, lb := range box.LineBoxes {
 		lb.Y += deltaY
-		for _, lbBox := range lb.Boxes {
-			lbBox.X += deltaX
-			lbBox.Y += deltaY
-		}
+		lb.LeftEdge += deltaX
+		lb.RightEdge += deltaX
 	}
 }
 
@@ -1010,7 +1072,7 @@ func (le *LayoutEngine) computeFlexItemAutoMinMain(node *html.Node, style *css.S
 			(style.GetFlexDirection() == css.FlexDirectionRow || style.GetFlexDirection() == css.FlexDirectionRowReverse)
 
 		for _, child := range node.Children {
-			childStyle := css.ComputeStyle(child, le.stylesheets, le.viewport.width, le.viewport.height)
+			childStyle := css.ComputeStyle(child, le.stylesheets, le.media())
 			if childStyle == nil {
 				childStyle = style
 			}
@@ -1066,6 +1128,22 @@ func (item *FlexItem) mainMargins(isRow bool) float64 {
 	return item.Box.Margin.Top + item.Box.Margin.Bottom
 }
 
+// mainStartMargin returns the margin on the item's main-start side. Items
+// are positioned from main-start and mirrored for the reverse directions,
+// where main-start is the right or bottom edge, so the margin that leads
+// is the physical right or bottom one.
+func (item *FlexItem) mainStartMargin(isRow, isReverse bool) float64 {
+	switch {
+	case isRow && isReverse:
+		return item.Box.Margin.Right
+	case isRow:
+		return item.Box.Margin.Left
+	case isReverse:
+		return item.Box.Margin.Bottom
+	}
+	return item.Box.Margin.Top
+}
+
 func (item *FlexItem) mainPaddingBorder(isRow bool) float64 {
 	if isRow {
 		return item.Box.Padding.Left + item.Box.Padding.Right + item.Box.Border.Left + item.Box.Border.Right
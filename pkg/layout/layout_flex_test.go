@@ -0,0 +1,235 @@
+package layout
+
+import (
+	"math"
+	"testing"
+
+	"louis14/pkg/html"
+)
+
+func TestLayoutFlex_ItemsSizedFromContent(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0">
+		<div style="display:flex;width:300px">
+		<div id="a">short</div>
+		<div id="b" style="flex-grow:1"><p id="p" style="margin:0">nested</p></div>
+		</div>
+		<div style="display:flex;flex-direction:column;width:200px;align-items:flex-start">
+		<div id="col">text</div>
+		<div id="grow" style="flex-grow:1">grow</div>
+		</div>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 300), doc)
+	a, b, p := findOnPage(boxes, "a"), findOnPage(boxes, "b"), findOnPage(boxes, "p")
+	col, grow := findOnPage(boxes, "col"), findOnPage(boxes, "grow")
+	if a == nil || b == nil || p == nil || col == nil || grow == nil {
+		t.Fatal("expected all the flex items")
+	}
+
+	// A row item without a width is as wide as its content
+	textWidth, _ := measureStyledText("short", a.Style)
+	if a.Width != textWidth {
+		t.Errorf("expected a as wide as its text (%.1f), got %.1f", textWidth, a.Width)
+	}
+	// The growing item takes the rest, and its content is laid out in it
+	if b.X != a.Width || b.Width != 300-a.Width {
+		t.Errorf("expected b at %.1f, %.1f wide, got %.1f, %.1f wide", a.Width, 300-a.Width, b.X, b.Width)
+	}
+	if p.X != b.X || p.Width != b.Width {
+		t.Errorf("expected the paragraph to fill b (%.1f at %.1f), got %.1f at %.1f", b.Width, b.X, p.Width, p.X)
+	}
+	if a.Height != p.Height || a.Height == 0 {
+		t.Errorf("expected the row as tall as its content (%.1f), got %.1f", p.Height, a.Height)
+	}
+
+	// Column items that aren't stretched shrink to fit their content, and
+	// an auto-height column has no space to grow its items into
+	if textWidth, _ := measureStyledText("text", col.Style); col.Width != textWidth {
+		t.Errorf("expected the column item as wide as its text (%.1f), got %.1f", textWidth, col.Width)
+	}
+	if grow.Height != col.Height {
+		t.Errorf("expected the growing item no taller than its content (%.1f), got %.1f", col.Height, grow.Height)
+	}
+}
+
+func TestLayoutFlex_MinMaxConstraints(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0">
+		<div style="display:flex;width:100px">
+		<div id="word">Supercalifragilistic</div><div id="wide" style="width:300px"></div>
+		</div>
+		<div style="display:flex;width:300px">
+		<div id="capped" style="flex-grow:1;max-width:50px"></div><div id="rest" style="flex-grow:1"></div>
+		</div>
+		<div style="display:flex;width:200px">
+		<div id="floor" style="width:200px;min-width:120px"></div><div style="width:200px"></div>
+		</div>
+		<div style="display:flex;flex-direction:column;height:200px">
+		<div id="short" style="flex-grow:1;max-height:30px"></div><div id="tall" style="flex-grow:1"></div>
+		</div>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 600), doc)
+	find := boxFinder(t, boxes)
+
+	// min-width: auto keeps a shrinking item as wide as its longest word
+	word := find("word")
+	if wordWidth, _ := measureStyledText("Supercalifragilistic", word.Style); word.Width != wordWidth {
+		t.Errorf("expected the word's item held at its min-content width %.1f, got %.1f", wordWidth, word.Width)
+	}
+	// A growing item stops at its maximum, and the others take the rest
+	if capped, rest := find("capped"), find("rest"); capped.Width != 50 || rest.Width != 250 {
+		t.Errorf("expected widths 50 and 250, got %.1f and %.1f", capped.Width, rest.Width)
+	}
+	// An explicit minimum holds against shrinking
+	if floor := find("floor"); floor.Width != 120 {
+		t.Errorf("expected the item held at its min-width 120, got %.1f", floor.Width)
+	}
+	// The heights of a column are clamped the same way
+	if short, tall := find("short"), find("tall"); short.Height != 30 || tall.Height != 170 {
+		t.Errorf("expected heights 30 and 170, got %.1f and %.1f", short.Height, tall.Height)
+	}
+}
+
+func TestLayoutFlex_Gaps(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0">
+		<div style="display:flex;flex-wrap:wrap;width:200px;gap:10px 5%">
+		<div id="a" style="width:90px;height:20px"></div><div id="b" style="width:90px;height:20px"></div>
+		<div id="c" style="width:90px;height:20px"></div>
+		</div>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 300), doc)
+	a, b, c := findOnPage(boxes, "a"), findOnPage(boxes, "b"), findOnPage(boxes, "c")
+	if a == nil || b == nil || c == nil {
+		t.Fatal("expected the three items")
+	}
+	// 5% of the 200px width separates the items; the third wraps, 10px below
+	if b.X != a.X+a.Width+10 || b.Y != a.Y {
+		t.Errorf("expected b 10px right of a at %.1f, got (%.1f, %.1f)", a.X+a.Width+10, b.X, b.Y)
+	}
+	if c.X != a.X || c.Y != a.Y+a.Height+10 {
+		t.Errorf("expected c on a second line at (%.1f, %.1f), got (%.1f, %.1f)", a.X, a.Y+a.Height+10, c.X, c.Y)
+	}
+}
+
+func TestLayoutFlex_ColumnHeightsAndAlignContent(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0">
+		<div id="grows" style="display:flex;flex-direction:column;min-height:100px">
+		<div id="g" style="flex-grow:1;height:20px"></div>
+		</div>
+		<div id="centers" style="display:flex;flex-direction:column;min-height:100px;justify-content:center">
+		<div id="mid" style="height:20px"></div>
+		</div>
+		<div style="display:flex;flex-direction:column;height:200px">
+		<div id="quarter" style="height:25%"></div>
+		</div>
+		<div id="lines" style="display:flex;flex-wrap:wrap;width:100px;height:200px;align-content:space-evenly">
+		<div id="l1" style="width:100px;height:20px"></div><div id="l2" style="width:100px;height:20px"></div>
+		</div>
+		<div id="row" style="display:flex;min-height:50px"><div id="stretched"></div></div>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 800), doc)
+	find := boxFinder(t, boxes)
+
+	// An auto-height column is sized by its content within min-height, and
+	// its items flex and justify within that size
+	grows, g := find("grows"), find("g")
+	if grows.Height != 100 || g.Height != 100 {
+		t.Errorf("expected the item to grow to the 100px min-height, got container %.1f, item %.1f", grows.Height, g.Height)
+	}
+	centers, mid := find("centers"), find("mid")
+	if mid.Y != centers.Y+40 {
+		t.Errorf("expected the item centered at %.1f, got %.1f", centers.Y+40, mid.Y)
+	}
+	// Percentage heights resolve against a definite container height
+	if quarter := find("quarter"); quarter.Height != 50 {
+		t.Errorf("expected 25%% of 200px, got %.1f", quarter.Height)
+	}
+	// The free 160px goes equally before, between, and after the lines
+	lines, l1, l2 := find("lines"), find("l1"), find("l2")
+	if math.Abs(l1.Y-lines.Y-160.0/3) > 1e-9 || math.Abs(l2.Y-lines.Y-20-320.0/3) > 1e-9 {
+		t.Errorf("expected lines at %.1f and %.1f, got %.1f and %.1f", lines.Y+160.0/3, lines.Y+20+320.0/3, l1.Y, l2.Y)
+	}
+	// A single line fills an auto-height row up to its min-height
+	if row, stretched := find("row"), find("stretched"); row.Height != 50 || stretched.Height != 50 {
+		t.Errorf("expected the item stretched to the 50px min-height, got container %.1f, item %.1f", row.Height, stretched.Height)
+	}
+}
+
+func TestLayoutFlex_OrderAndReverseDirections(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0">
+		<div id="reversed" style="display:flex;flex-direction:row-reverse;width:300px">
+		<div id="a" style="width:50px;height:10px"></div><div id="b" style="width:50px;height:10px;margin-left:10px"></div>
+		</div>
+		<div style="display:flex;flex-direction:column-reverse;height:100px">
+		<div id="first" style="height:10px;margin-bottom:5px"></div><div id="second" style="height:20px"></div>
+		</div>
+		<div id="ordered" style="display:flex;width:300px">
+		<div id="late" style="width:50px;height:10px;order:1"></div><div id="early" style="width:50px;height:10px"></div>
+		</div>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 400), doc)
+	find := boxFinder(t, boxes)
+
+	// Items run from the right, each keeping its margins on their own sides
+	if a, b := find("a"), find("b"); a.X != 250 || b.X != 200 {
+		t.Errorf("expected a at 250 and b at 200, got %.1f and %.1f", a.X, b.X)
+	}
+	// and from the bottom in a column-reverse, where first's bottom margin
+	// separates it from the container's bottom edge
+	column, first, second := find("first").Parent, find("first"), find("second")
+	if first.Y != column.Y+85 || second.Y != column.Y+65 {
+		t.Errorf("expected first at %.1f and second at %.1f, got %.1f and %.1f", column.Y+85, column.Y+65, first.Y, second.Y)
+	}
+
+	// order moves an item without moving its box out of document order,
+	// which is the order the items paint in
+	ordered, late, early := find("ordered"), find("late"), find("early")
+	if early.X != 0 || late.X != 50 {
+		t.Errorf("expected early at 0 and late at 50, got %.1f and %.1f", early.X, late.X)
+	}
+	if len(ordered.Children) != 2 || ordered.Children[0] != late || ordered.Children[1] != early {
+		t.Error("expected the items' boxes in document order")
+	}
+	if reversed := find("reversed"); reversed.Children[0] != find("a") {
+		t.Error("expected a row-reverse container's boxes in document order")
+	}
+}
+
+func TestLayoutFlex_TextItems(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0">
+		<div id="f" style="display:flex;width:300px"> <div id="a" style="width:50px">A</div> loose text <div id="b" style="width:50px">B</div> </div>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 300), doc)
+	f, a, b := findOnPage(boxes, "f"), findOnPage(boxes, "a"), findOnPage(boxes, "b")
+	if f == nil || a == nil || b == nil {
+		t.Fatal("expected the container and its items")
+	}
+	// The text between the items is an anonymous item of its own, and the
+	// white space around them none
+	if len(f.Children) != 3 || f.Children[1].Node != nil {
+		t.Fatalf("expected an anonymous item between a and b, got %d items", len(f.Children))
+	}
+	item := f.Children[1]
+	if item.X != a.X+a.Width || item.Width == 0 || len(item.Children) == 0 {
+		t.Errorf("expected the text item laid out at %.1f, got %.1f wide at %.1f", a.X+a.Width, item.Width, item.X)
+	}
+	if b.X != item.X+item.Width {
+		t.Errorf("expected b after the text item at %.1f, got %.1f", item.X+item.Width, b.X)
+	}
+}
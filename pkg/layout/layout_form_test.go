@@ -0,0 +1,61 @@
+package layout
+
+import (
+	"testing"
+
+	"louis14/pkg/html"
+)
+
+func TestFormControls_IntrinsicSizes(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="font-family: Ahem; font-size: 10px;"><div>` +
+		`<input id="text" size="5" style="font-size: 10px;">` +
+		`<input id="submit" type="submit" value="Go" style="font-size: 10px;">` +
+		`<input id="sized" style="width: 100px;">` +
+		`<input id="hidden" type="hidden">` +
+		`<select id="select" style="font-size: 10px;"><option>ab</option><optgroup><option>abcd</option></optgroup></select>` +
+		`</div><textarea id="area" cols="3" rows="2" style="font-family: Ahem; font-size: 10px;"></textarea></body></html>`)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(800, 600), doc)
+
+	found := make(map[string]*Box)
+	var walk func(boxes []*Box)
+	walk = func(boxes []*Box) {
+		for _, b := range boxes {
+			if b.Node != nil {
+				if id, ok := b.Node.GetAttribute("id"); ok {
+					found[id] = b
+				}
+			}
+			walk(b.Children)
+		}
+	}
+	walk(boxes)
+
+	tests := []struct {
+		id            string
+		width, height float64
+	}{
+		{"text", 5*10 + 4 + 4, 10 + 2 + 4},        // size × "0" width, padding, border
+		{"submit", 2*10 + 12 + 4, 10 + 2 + 4},     // label width
+		{"select", 4*10 + 16 + 4 + 2, 10 + 2 + 2}, // longest option plus arrow
+		{"area", 3*10 + 4 + 2, 2*10 + 4 + 2},      // cols × rows
+	}
+	for _, tt := range tests {
+		b := found[tt.id]
+		if b == nil {
+			t.Errorf("#%s: no box", tt.id)
+			continue
+		}
+		if b.Width != tt.width || b.Height != tt.height {
+			t.Errorf("#%s: got %vx%v, want %vx%v", tt.id, b.Width, b.Height, tt.width, tt.height)
+		}
+	}
+	if b := found["sized"]; b == nil || b.Width != 100+4+4 {
+		t.Errorf("#sized: author width should win, got %+v", b)
+	}
+	if found["hidden"] != nil {
+		t.Error("hidden input should not generate a box")
+	}
+}
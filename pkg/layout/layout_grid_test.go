@@ -0,0 +1,29 @@
+package layout
+
+import (
+	"testing"
+
+	"louis14/pkg/html"
+)
+
+func TestLayoutGrid_Gaps(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0">
+		<div style="display:grid;grid-template-columns:50px 50px;grid-template-rows:30px 30px;grid-gap:4px 6px">
+		<div id="a"></div><div id="b"></div><div id="c"></div>
+		</div>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 300), doc)
+	a, b, c := findOnPage(boxes, "a"), findOnPage(boxes, "b"), findOnPage(boxes, "c")
+	if a == nil || b == nil || c == nil {
+		t.Fatal("expected the three items")
+	}
+	if b.X != a.X+56 || b.Y != a.Y {
+		t.Errorf("expected b a column and a 6px gap right of a, got (%.1f, %.1f) vs (%.1f, %.1f)", b.X, b.Y, a.X, a.Y)
+	}
+	if c.X != a.X || c.Y != a.Y+34 {
+		t.Errorf("expected c a row and a 4px gap below a, got (%.1f, %.1f) vs (%.1f, %.1f)", c.X, c.Y, a.X, a.Y)
+	}
+}
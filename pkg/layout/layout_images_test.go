@@ -0,0 +1,86 @@
+package layout
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"louis14/pkg/html"
+)
+
+func TestInlineSVG_ReplacedBox(t *testing.T) {
+	doc, err := html.Parse(`<html><body><p>a <svg id="inline" width="40" height="20" viewBox="0 0 4 2">` +
+		`<rect width="4" height="2" fill="red"/><text id="label">ignored</text></svg> b</p>` +
+		`<div><svg id="block" style="display: block" viewBox="0 0 2 1" height="50"></svg></div></body></html>`)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(800, 600), doc)
+
+	found := make(map[string]*Box)
+	var walk func(boxes []*Box)
+	walk = func(boxes []*Box) {
+		for _, b := range boxes {
+			if b.Node != nil {
+				if id, ok := b.Node.GetAttribute("id"); ok {
+					found[id] = b
+				}
+			}
+			walk(b.Children)
+		}
+	}
+	walk(boxes)
+
+	tests := []struct {
+		id            string
+		width, height float64
+	}{
+		{"inline", 40, 20},
+		{"block", 100, 50}, // Width from the viewBox aspect ratio
+	}
+	for _, tt := range tests {
+		b := found[tt.id]
+		if b == nil {
+			t.Errorf("#%s: no box", tt.id)
+			continue
+		}
+		if b.Width != tt.width || b.Height != tt.height {
+			t.Errorf("#%s: got %vx%v, want %vx%v", tt.id, b.Width, b.Height, tt.width, tt.height)
+		}
+		if !strings.HasPrefix(b.ImagePath, "data:image/svg+xml,") {
+			t.Errorf("#%s: image path %q, want an SVG data URI", tt.id, b.ImagePath)
+		}
+	}
+	if found["label"] != nil {
+		t.Error("SVG children should be drawn as part of the image, not laid out")
+	}
+}
+
+func TestImagePathsResolveAgainstBaseURL(t *testing.T) {
+	doc, err := html.Parse(`<html><body><img id="logo" src="img/logo.png" width="10" height="10"></body></html>`)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	le := NewLayoutEngine(800, 600)
+	le.SetBaseURL("https://example.com/site/index.html")
+	le.SetImageFetcher(func(ctx context.Context, uri string) ([]byte, error) {
+		return nil, fmt.Errorf("not found: %s", uri)
+	})
+	boxes := layoutDoc(t, le, doc)
+
+	var path string
+	var walk func(boxes []*Box)
+	walk = func(boxes []*Box) {
+		for _, b := range boxes {
+			if b.Node != nil && b.Node.TagName == "img" {
+				path = b.ImagePath
+			}
+			walk(b.Children)
+		}
+	}
+	walk(boxes)
+	if want := "https://example.com/site/img/logo.png"; path != want {
+		t.Errorf("image path %q, want %q", path, want)
+	}
+}
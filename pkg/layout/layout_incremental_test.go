@@ -0,0 +1,139 @@
+package layout
+
+import (
+	"testing"
+
+	"louis14/pkg/html"
+)
+
+const incrementalTestHTML = `<div id="a" style="height: 40px;"><p>first block</p></div>` +
+	`<div id="b"><p>second block</p></div>` +
+	`<div id="c"><p>third block</p></div>`
+
+func findNode(n *html.Node, id string) *html.Node {
+	if v, ok := n.GetAttribute("id"); ok && v == id {
+		return n
+	}
+	for _, child := range n.Children {
+		if found := findNode(child, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func boxGeometry(boxes []*Box) []Rect {
+	var rects []Rect
+	var walk func(b *Box)
+	walk = func(b *Box) {
+		rects = append(rects, Rect{X: b.X, Y: b.Y, Width: b.Width, Height: b.Height})
+		for _, c := range b.Children {
+			walk(c)
+		}
+	}
+	for _, b := range boxes {
+		walk(b)
+	}
+	return rects
+}
+
+func TestIncrementalLayout_ReusesCleanSubtrees(t *testing.T) {
+	doc, err := html.Parse(incrementalTestHTML)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	engine := NewLayoutEngine(800, 600)
+	engine.SetIncremental(true)
+	layoutDoc(t, engine, doc)
+
+	// Grow the first block; later siblings must move down but can be reused
+	findNode(doc.Root, "a").SetAttribute("style", "height: 90px;")
+	boxes := layoutDoc(t, engine, doc)
+
+	if engine.ReusedSubtrees() == 0 {
+		t.Error("expected clean sibling subtrees to be reused")
+	}
+
+	fresh := layoutDoc(t, NewLayoutEngine(800, 600), doc)
+	got, want := boxGeometry(boxes), boxGeometry(fresh)
+	if len(got) != len(want) {
+		t.Fatalf("box count mismatch: incremental %d, fresh %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("box %d: incremental %+v, fresh %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestIncrementalLayout_DirtySubtreeRecomputed(t *testing.T) {
+	doc, err := html.Parse(incrementalTestHTML)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	engine := NewLayoutEngine(800, 600)
+	engine.SetIncremental(true)
+	layoutDoc(t, engine, doc)
+
+	b := findNode(doc.Root, "b")
+	b.SetAttribute("style", "height: 75px;")
+	boxes := layoutDoc(t, engine, doc)
+
+	var bBox *Box
+	var walk func(box *Box)
+	walk = func(box *Box) {
+		if box.Node == b {
+			bBox = box
+		}
+		for _, c := range box.Children {
+			walk(c)
+		}
+	}
+	for _, box := range boxes {
+		walk(box)
+	}
+	if bBox == nil {
+		t.Fatal("box for #b not found")
+	}
+	if bBox.Height != 75 {
+		t.Errorf("expected dirty #b to be re-laid out with height 75, got %v", bBox.Height)
+	}
+	if !doc.Root.IsSubtreeClean() {
+		t.Error("Layout should clear dirty flags")
+	}
+}
+
+func TestIncrementalLayout_HoverRestyles(t *testing.T) {
+	doc, err := html.Parse(`<html><head><style>#b { height: 20px; } #b:hover { height: 70px; }</style></head><body>` +
+		`<div id="a" style="height: 40px;"></div><div id="b"></div></body></html>`)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	engine := NewLayoutEngine(800, 600)
+	engine.SetIncremental(true)
+	boxes := layoutDoc(t, engine, doc)
+
+	b := findNode(doc.Root, "b")
+	bBox := boxFinder(t, boxes)("b")
+
+	hit := NodeAt(boxes, bBox.X+1, bBox.Y+1)
+	if hit != b {
+		t.Fatalf("NodeAt returned %v, want #b", hit)
+	}
+	engine.SetHoveredNode(hit)
+	if !findNode(doc.Root, "b").Parent.HasState(html.StateHover) {
+		t.Error("ancestors of the hovered element should be in the hover state")
+	}
+
+	if bBox = boxFinder(t, layoutDoc(t, engine, doc))("b"); bBox.Height != 70 {
+		t.Fatalf("hovered #b: got %+v, want height 70", bBox)
+	}
+
+	engine.SetHoveredNode(nil)
+	if bBox = boxFinder(t, layoutDoc(t, engine, doc))("b"); bBox.Height != 20 {
+		t.Fatalf("unhovered #b: got %+v, want height 20", bBox)
+	}
+}
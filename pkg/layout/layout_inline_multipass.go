@@ -5,7 +5,6 @@ import (
 	"strings"
 	"louis14/pkg/css"
 	"louis14/pkg/html"
-	"louis14/pkg/images"
 	"louis14/pkg/text"
 )
 
@@ -88,6 +87,8 @@ func (le *LayoutEngine) BreakLines(
 	if len(items) == 0 {
 		return []*LineInfo{}
 	}
+	// Text broken across lines is replaced by its remainder in a copy
+	items = append([]*InlineItem(nil), items...)
 
 	lines := []*LineInfo{}
 	currentY := startY
@@ -96,6 +97,7 @@ func (le *LayoutEngine) BreakLines(
 		Items:      []*InlineItem{},
 		Constraint: constraint,
 		Height:     0,
+		Indent:     constraint.TextIndent, // Only the first line is indented
 	}
 	currentX := 0.0 // X position on current line
 	hasSeenContentOnLine := false // Track if we've seen content on this line (for whitespace stripping)
@@ -110,15 +112,15 @@ func (le *LayoutEngine) BreakLines(
 		availableWidth := constraint.AvailableInlineSize(currentY, item.Height) - lineFloatWidth
 
 		// Check if we need to start at a different X due to floats
-		leftOffset, _ := constraint.ExclusionSpace.AvailableInlineSize(currentY, item.Height)
+		leftOffset, _ := constraint.FloatOffsets(currentY, item.Height)
 
 		// If this is a new line, start at the left offset
 		if currentX == 0 {
 			currentX = leftOffset
 		}
 
-		// Calculate how much space we've used on this line
-		usedWidth := currentX - leftOffset
+		// Calculate how much space we've used on this line, including its indent
+		usedWidth := currentX - leftOffset + currentLine.Indent
 
 		switch item.Type {
 		case InlineItemText:
@@ -136,7 +138,7 @@ func (le *LayoutEngine) BreakLines(
 						italic := item.Style.GetFontStyle() == css.FontStyleItalic
 						mono := item.Style.IsMonospaceFamily()
 						ahem := item.Style.IsAhemFamily()
-						newWidth, _ := text.MeasureTextWithStyle(trimmedText, fontSize, bold, italic, mono, ahem)
+						newWidth, _ := text.MeasureTextWithFamilies(item.Style.Fonts, trimmedText, fontSize, item.Style.GetFontFamilies(), bold, italic, mono, ahem)
 						ls := item.Style.GetLetterSpacing()
 						if ls != 0 && len([]rune(trimmedText)) > 1 {
 							newWidth += ls * float64(len([]rune(trimmedText))-1)
@@ -159,6 +161,34 @@ func (le *LayoutEngine) BreakLines(
 				}
 			}
 
+			// Text wider than the rest of the line breaks where the line
+			// fills, and the rest is broken again on the next line
+			if usedWidth+textWidth > availableWidth && !constraint.NoWrap {
+				end := textBreakOffset(item, availableWidth-usedWidth, !lineHasContent(currentLine))
+				if end > 0 && end < len(item.Text) {
+					currentLine.Items = append(currentLine.Items, textRun(item, 0, end, item.BidiLevel))
+					if textLineHeight > currentLine.Height {
+						currentLine.Height = textLineHeight
+					}
+					lines = append(lines, currentLine)
+					currentY += currentLine.Height
+
+					currentLine = &LineInfo{
+						Y:          currentY,
+						Items:      []*InlineItem{},
+						Constraint: constraint,
+						Height:     0,
+					}
+					currentX = 0
+					hasSeenContentOnLine = false
+					lineFloatWidth = 0
+					lineFloats = nil
+					items[i] = textRun(item, end, len(item.Text), item.BidiLevel)
+					i--
+					continue
+				}
+			}
+
 			if usedWidth+textWidth <= availableWidth || constraint.NoWrap {
 				// Fits on current line, or white-space: nowrap forces it on same line
 				currentLine.Items = append(currentLine.Items, item)
@@ -168,24 +198,37 @@ func (le *LayoutEngine) BreakLines(
 				if textLineHeight > currentLine.Height {
 					currentLine.Height = textLineHeight
 				}
-			} else if textWidth <= availableWidth {
-				// Doesn't fit, but would fit on new line
-				// Finish current line
-				if len(currentLine.Items) > 0 {
-					lines = append(lines, currentLine)
-					currentY += currentLine.Height
+			} else if textWidth <= availableWidth && len(currentLine.Items) > 0 {
+				// Doesn't fit, but would fit on new line: retry it there,
+				// where its leading white space is stripped
+				lines = append(lines, currentLine)
+				currentY += currentLine.Height
+				currentLine = &LineInfo{
+					Y:          currentY,
+					Items:      []*InlineItem{},
+					Constraint: constraint,
+					Height:     0,
 				}
+				currentX = 0
+				hasSeenContentOnLine = false
+				lineFloatWidth = 0
+				lineFloats = nil
+				i--
+			} else if textWidth <= availableWidth {
+				// Doesn't fit beside the empty line's indent, but would fit on new line
+				indent := currentLine.Indent
 
 				// Start new line - reset whitespace and float tracking
 				hasSeenContentOnLine = true // This item is the first content
 				lineFloatWidth = 0
 				lineFloats = nil
-				leftOffset, _ := constraint.ExclusionSpace.AvailableInlineSize(currentY, item.Height)
+				leftOffset, _ := constraint.FloatOffsets(currentY, item.Height)
 				currentLine = &LineInfo{
 					Y:          currentY,
 					Items:      []*InlineItem{item},
 					Constraint: constraint,
 					Height:     textLineHeight,
+					Indent:     indent,
 				}
 				currentX = leftOffset + textWidth
 			} else {
@@ -214,8 +257,10 @@ func (le *LayoutEngine) BreakLines(
 					if nextY > currentY {
 						// Shift down past the float - keep float items, retry text
 						// Emit current line with just the float items
+						indent := currentLine.Indent
 						if len(currentLine.Items) > 0 {
 							lines = append(lines, currentLine)
+							indent = 0
 						}
 						currentY = nextY
 						currentLine = &LineInfo{
@@ -223,6 +268,7 @@ func (le *LayoutEngine) BreakLines(
 							Items:      []*InlineItem{},
 							Constraint: constraint,
 							Height:     0,
+							Indent:     indent,
 						}
 						currentX = 0
 						lineFloatWidth = 0
@@ -232,7 +278,22 @@ func (le *LayoutEngine) BreakLines(
 						shifted = true
 					}
 				}
-				if !shifted {
+				if !shifted && lineHasContent(currentLine) {
+					// Start a new line, where the text is broken again
+					lines = append(lines, currentLine)
+					currentY += currentLine.Height
+					currentLine = &LineInfo{
+						Y:          currentY,
+						Items:      []*InlineItem{},
+						Constraint: constraint,
+						Height:     0,
+					}
+					currentX = 0
+					hasSeenContentOnLine = false
+					lineFloatWidth = 0
+					lineFloats = nil
+					i--
+				} else if !shifted {
 					// No floats to clear - force onto current line (true overflow)
 					currentLine.Items = append(currentLine.Items, item)
 					currentX += textWidth
@@ -276,21 +337,24 @@ func (le *LayoutEngine) BreakLines(
 					currentLine.Height = item.Height
 				}
 			} else {
-				// Doesn't fit - start new line
+				// Doesn't fit - start new line, keeping the indent of an empty one
+				indent := currentLine.Indent
 				if len(currentLine.Items) > 0 {
 					lines = append(lines, currentLine)
 					currentY += currentLine.Height
+					indent = 0
 				}
 
 				// Start new line with this item
 				lineFloatWidth = 0
 				lineFloats = nil
-				leftOffset, _ := constraint.ExclusionSpace.AvailableInlineSize(currentY, item.Height)
+				leftOffset, _ := constraint.FloatOffsets(currentY, item.Height)
 				currentLine = &LineInfo{
 					Y:          currentY,
 					Items:      []*InlineItem{item},
 					Constraint: constraint,
 					Height:     item.Height,
+					Indent:     indent,
 				}
 				currentX = leftOffset + atomicWidth
 			}
@@ -387,7 +451,7 @@ func (le *LayoutEngine) BreakLines(
 						italic := item.Style.GetFontStyle() == css.FontStyleItalic
 						mono := item.Style.IsMonospaceFamily()
 						ahem := item.Style.IsAhemFamily()
-						newWidth, _ := text.MeasureTextWithStyle(trimmedText, fontSize, bold, italic, mono, ahem)
+						newWidth, _ := text.MeasureTextWithFamilies(item.Style.Fonts, trimmedText, fontSize, item.Style.GetFontFamilies(), bold, italic, mono, ahem)
 						ls := item.Style.GetLetterSpacing()
 						if ls != 0 && len([]rune(trimmedText)) > 1 {
 							newWidth += ls * float64(len([]rune(trimmedText))-1)
@@ -417,13 +481,25 @@ func (le *LayoutEngine) BreakLines(
 	return lines
 }
 
+// lineHasContent reports whether a line holds text or atomic inlines, so
+// that content which doesn't fit moves to the next line rather than
+// overflowing this one.
+func lineHasContent(line *LineInfo) bool {
+	for _, item := range line.Items {
+		if item.Type == InlineItemText || item.Type == InlineItemAtomic {
+			return true
+		}
+	}
+	return false
+}
+
 // isWhitespaceOnlyLine checks if a line contains only whitespace text items
 // and tag items (no floats, no atomics, no block children, no non-whitespace text).
 func isWhitespaceOnlyLine(line *LineInfo) bool {
 	for _, item := range line.Items {
 		switch item.Type {
 		case InlineItemText:
-			if strings.TrimSpace(item.Text) != "" {
+			if !isWhitespaceOnly(item.Text) {
 				return false // Has non-whitespace text
 			}
 		case InlineItemFloat, InlineItemAtomic, InlineItemBlockChild:
@@ -446,13 +522,8 @@ func isWhitespaceOnlyLine(line *LineInfo) bool {
 // 2. BreakLines - decide line breaks (PURE - no side effects)
 // 3. ConstructFragments - create positioned fragments (HAS side effects)
 //
-// Retry logic:
-// - After Phase 3, check if floats were added that affect line breaking
-// - If yes, retry with updated constraint space
-// - Max 3 iterations to prevent infinite loops
-//
-// NOTE: Phase 3 (ConstructFragments) is not yet implemented, so this is a
-// simplified version that demonstrates the retry pattern.
+// Floats placed before the content are in the constraint's exclusion
+// space, so each phase runs once.
 func (le *LayoutEngine) LayoutInlineContent(
 	children []*html.Node,
 	constraint *ConstraintSpace,
@@ -460,46 +531,17 @@ func (le *LayoutEngine) LayoutInlineContent(
 	containerStyle *css.Style,
 	overrideStyles map[*html.Node]*css.Style,
 ) []*Fragment {
-	const maxRetries = 3
-
-	// Three-phase pipeline with retry support
-	// This is the COMPLETE implementation following Blink LayoutNG principles!
-
-	// CRITICAL: Always start from the ORIGINAL constraint
-	// Don't carry over float exclusions from previous retries
-	// Phase 3 will rebuild exclusions from scratch each time
-	originalConstraint := constraint
-	var finalFragments []*Fragment
-
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		// Phase 1: Collect inline items (PURE - no side effects!)
-		// Use original constraint - don't accumulate floats across retries
-		items := le.collectInlineItemsClean(children, originalConstraint, containerStyle, overrideStyles)
-
-		// Phase 2: Break lines (PURE - no side effects!)
-		// Use original constraint - floats will be added in Phase 3
-		lines := le.BreakLines(items, originalConstraint, startY)
-
-		// Phase 3: Construct fragments (HAS side effects - creates fragments)
-		// Start from original constraint and build up float exclusions
-		fragments, finalConstraint := le.ConstructFragments(lines, originalConstraint)
-
-		// Check if we need to retry
-		if !constraintsChanged(originalConstraint, finalConstraint, lines) {
-			// Success! Constraints didn't change, we're done
-			finalFragments = fragments
-			break
-		}
+	// Phase 1: Collect inline items (PURE - no side effects!)
+	items := le.collectInlineItemsClean(children, constraint, containerStyle, overrideStyles)
+	le.traceInlineItems(items)
 
-		// Constraints changed - this means Phase 3 added floats
-		// For now, we don't actually retry - we just return what we have
-		// The retry logic isn't needed for simple float cases
-		// TODO: Implement proper retry when float changes affect line breaking
-		finalFragments = fragments
-		break
-	}
+	// Phase 2: Break lines (PURE - no side effects!)
+	lines := le.BreakLines(items, constraint, startY)
+	le.traceLineBreaks(lines)
 
-	return finalFragments
+	// Phase 3: Construct fragments (HAS side effects - creates fragments)
+	fragments, _ := le.ConstructFragments(lines, constraint)
+	return fragments
 }
 
 // collectInlineItemsClean is a clean version of CollectInlineItems that works
@@ -540,12 +582,7 @@ func (le *LayoutEngine) collectInlineItemsClean(
 		if _, hasOverride := computedStyles[child]; hasOverride {
 			continue
 		}
-		childStyle := css.ComputeStyle(
-			child,
-			le.stylesheets,
-			le.viewport.width,
-			le.viewport.height,
-		)
+		childStyle := css.ComputeStyle(child, le.stylesheets, le.media())
 		// Inherit properties from container style if not set
 		if containerStyle != nil {
 			// Font properties should inherit
@@ -598,7 +635,7 @@ func (le *LayoutEngine) collectInlineItemsClean(
 				// Check if run [runStart, i) is whitespace-only
 				runIsWhitespaceOnly := true
 				for j := runStart; j < i; j++ {
-					if state.Items[j].Type != InlineItemText || strings.TrimSpace(state.Items[j].Text) != "" {
+					if state.Items[j].Type != InlineItemText || !isWhitespaceOnly(state.Items[j].Text) {
 						runIsWhitespaceOnly = false
 						break
 					}
@@ -616,7 +653,8 @@ func (le *LayoutEngine) collectInlineItemsClean(
 		state.Items = filtered
 	}
 
-	return state.Items
+	// UAX #9: Resolve bidi levels so lines can be reordered visually
+	return resolveBidi(state.Items, containerStyle)
 }
 
 // constructLine creates positioned fragments for a single line.
@@ -658,16 +696,22 @@ func (le *LayoutEngine) constructLine(
 	}
 
 	// Calculate starting X position accounting for floats (now updated)
-	leftOffset, _ := currentConstraint.ExclusionSpace.AvailableInlineSize(line.Y, line.Height)
-	currentX := leftOffset
+	leftOffset, _ := currentConstraint.FloatOffsets(line.Y, line.Height)
+	currentX := leftOffset + line.Indent
 
-	// Pass 2: Process inline content with floats already positioned
-	for _, item := range line.Items {
+	// Pass 2: Process inline content with floats already positioned,
+	// in visual order for bidirectional text
+	for _, item := range visualOrder(line.Items) {
 		switch item.Type {
 		case InlineItemText:
+			// Right-to-left runs have their own text node, drawn reversed
+			text := visualText(item)
+			if item.BidiLevel%2 == 1 && item.Node != nil {
+				item.Node.Text = text
+			}
 			// Create text fragment with correct position
 			frag := NewTextFragment(
-				item.Text,
+				text,
 				item.Style,
 				currentX,
 				line.Y,
@@ -700,8 +744,8 @@ func (le *LayoutEngine) constructLine(
 				Size:     Size{Width: item.Width, Height: item.Height},
 			}
 			// For img elements, set the ImagePath for rendering
-			if item.Node != nil && item.Node.TagName == "img" {
-				if src, ok := item.Node.GetAttribute("src"); ok {
+			if item.Node != nil && isImageElement(item.Node) {
+				if src, ok := le.imageSource(item.Node); ok {
 					frag.ImagePath = src
 				}
 			}
@@ -791,6 +835,10 @@ func (le *LayoutEngine) ConstructFragments(
 	currentConstraint := constraint
 
 	for _, line := range lines {
+		// A canceled layout stops between lines
+		if le.canceled() {
+			break
+		}
 		// Construct fragments for this line using current constraint
 		lineFragments, newConstraint := le.constructLine(line, currentConstraint)
 
@@ -805,16 +853,6 @@ func (le *LayoutEngine) ConstructFragments(
 	return allFragments, currentConstraint
 }
 
-// constraintsChanged checks if the constraint space changed during fragment construction.
-// This is used to determine if we need to retry line breaking.
-//
-// Returns true if:
-// - Floats were added (exclusion space changed)
-// - Any other constraints changed (future extensions)
-//
-// This is the key to the retry logic: if Phase 3 added floats that affect
-// line breaking, we need to re-run Phase 2 with the updated constraints.
-
 // fragmentsToBoxes converts Fragment tree back to Box tree for existing rendering pipeline.
 // This is a TEMPORARY BRIDGE until we migrate the entire pipeline to use fragments.
 //
@@ -902,14 +940,17 @@ func (le *LayoutEngine) LayoutInlineContentToBoxes(
 		}
 	}
 
-	// Create constraint space
+	// Create constraint space holding the floats already placed beside this
+	// content, relative to the container's content box
 	constraint := NewConstraintSpace(availableWidth, 0)
+	constraint.ExclusionSpace = le.exclusionSpace(containerBox.X + containerBox.Border.Left + containerBox.Padding.Left)
 
 	// Check if container has white-space: nowrap
 	if containerBox.Style != nil {
 		if ws, ok := containerBox.Style.Get("white-space"); ok && (ws == "nowrap" || ws == "pre") {
 			constraint.NoWrap = true
 		}
+		constraint.TextIndent = containerBox.Style.GetTextIndent(availableWidth)
 	}
 
 	// Run new multi-pass pipeline
@@ -929,11 +970,25 @@ func (le *LayoutEngine) LayoutInlineContentToBoxes(
 		// Track if line has any actual content (not just OpenTag markers)
 		// Used to determine if we should advance Y for this line
 		hasContent bool
+
+		// Boxes placed on this line, aligned on the line's baseline when
+		// its height is needed, and the resulting line box
+		items   []*lineItem
+		lineTop float64
+		line    *LineBox
 	}
 
+	// Line boxes finalized so far, recorded on the container
+	lineBoxes := []*LineBox{}
+
 	// EffectiveHeight returns the height to use for Y advancement
 	// Per CSS spec: line box height is the max of content height and line-height
+	// Once boxes are on the line, its height comes from aligning them (CSS 2.1 §10.8.1)
 	lineMetricsEffectiveHeight := func(lm *LineMetrics) float64 {
+		if lm.hasContent && len(lm.items) > 0 {
+			lm.line = le.alignLine(lm.items, containerBox.Style, lm.lineTop)
+			return lm.line.Height
+		}
 		if lm.contentHeight > lm.lineBoxHeight {
 			return lm.contentHeight
 		}
@@ -943,6 +998,10 @@ func (le *LayoutEngine) LayoutInlineContentToBoxes(
 	// Reset clears metrics for a new line
 	// preserveLineBoxHeight: if true, keeps line-box height from open inline elements
 	lineMetricsReset := func(lm *LineMetrics, preserveLineBoxHeight bool) {
+		if lm.hasContent && lm.line != nil {
+			lineBoxes = append(lineBoxes, lm.line)
+		}
+		lm.items, lm.line = nil, nil
 		lm.contentHeight = 0
 		lm.hasContent = false
 		if !preserveLineBoxHeight {
@@ -970,6 +1029,21 @@ func (le *LayoutEngine) LayoutInlineContentToBoxes(
 	lineMetrics := &LineMetrics{}  // Track line box metrics (content height + line-box height)
 	inlineStack := []*inlineSpan{}
 
+	// addLineItem records a box placed on the current line for baseline
+	// alignment. parents are the inline elements enclosing the box.
+	addLineItem := func(box *Box, kind lineItemKind, parents []*inlineSpan, content bool) {
+		if len(lineMetrics.items) == 0 {
+			lineMetrics.lineTop = currentY
+		}
+		item := &lineItem{box: box, kind: kind, content: content}
+		for _, span := range parents {
+			if span.style != nil {
+				item.parents = append(item.parents, span.style)
+			}
+		}
+		lineMetrics.items = append(lineMetrics.items, item)
+	}
+
 	// Track which nodes we've seen to distinguish OpenTag from CloseTag
 	// First FragmentInline for a node = OpenTag, second = CloseTag
 	seenNodes := make(map[*html.Node]bool)
@@ -981,25 +1055,19 @@ func (le *LayoutEngine) LayoutInlineContentToBoxes(
 	getRelativeOffset := func() (float64, float64) {
 		var offsetX, offsetY float64
 		for _, span := range inlineStack {
-			if span.style != nil && span.style.GetPosition() == css.PositionRelative {
-				posOffset := span.style.GetPositionOffset()
-				if posOffset.HasTop {
-					offsetY += posOffset.Top
-				} else if posOffset.HasBottom {
-					offsetY -= posOffset.Bottom
-				}
-				if posOffset.HasLeft {
-					offsetX += posOffset.Left
-				} else if posOffset.HasRight {
-					offsetX -= posOffset.Right
-				}
-			}
+			dx, dy := relativeOffset(span.style)
+			offsetX += dx
+			offsetY += dy
 		}
 		return offsetX, offsetY
 	}
 
 	for i, frag := range fragments {
 		if frag.Type == FragmentBlockChild {
+			// A canceled layout stops before the next block
+			if le.canceled() {
+				break
+			}
 			// Block child - first finalize the current line before laying out the block
 			// Advance currentY past any content on the current line
 			// FIX: Only advance if the line had actual content (not just OpenTag markers)
@@ -1021,7 +1089,7 @@ func (le *LayoutEngine) LayoutInlineContentToBoxes(
 			// Calculate X position (block children start at left edge)
 			// CSS 2.1 §9.4.3: Block children inside relative-positioned inlines
 			// inherit the relative positioning offset
-			relOffX, relOffY := getRelativeOffset()
+			relOffX, relOffY := inlineAncestorsOffset(childNode, containerBox.Node, computedStyles)
 			childX := containerBox.X + containerBox.Border.Left + containerBox.Padding.Left + relOffX
 			childY := currentY + relOffY
 
@@ -1056,16 +1124,9 @@ func (le *LayoutEngine) LayoutInlineContentToBoxes(
 				// Compute flow bottom: childBox.Y minus non-flow offsets (parent inline
 				// relative offset + child's own relative offset), plus height + margin.
 				// This gives the correct Y advancement for both normal and cleared elements.
-				flowY := childBox.Y - relOffY
 				// Also subtract child's own relative positioning (visual only, not flow)
-				if childBox.Style != nil && childBox.Style.GetPosition() == css.PositionRelative {
-					offset := childBox.Style.GetPositionOffset()
-					if offset.HasTop {
-						flowY -= offset.Top
-					} else if offset.HasBottom {
-						flowY += offset.Bottom
-					}
-				}
+				_, ownOffY := relativeOffset(childBox.Style)
+				flowY := childBox.Y - relOffY - ownOffY
 				flowBottom := flowY + childBox.Height + childBox.Margin.Bottom
 				if flowBottom > currentY+totalHeight {
 					currentY = flowBottom
@@ -1145,214 +1206,118 @@ func (le *LayoutEngine) LayoutInlineContentToBoxes(
 						// This includes the element's own offset + ancestor offsets
 						wrapRelX, wrapRelY := getRelativeOffset()
 
-						// Check if this inline element was split by a block child
-						hasBlockChild := false
-						blockChildIdx := -1
-						for j := span.startIdx; j < i; j++ {
-							if fragments[j].Type == FragmentBlockChild {
-								hasBlockChild = true
-								blockChildIdx = j
+						// Inline box
+						endX := frag.Position.X
+						wrapperWidth := endX - span.startX
+
+						// Compute border, padding, margin from style
+						border := span.style.GetBorderWidth()
+						padding := span.style.GetPadding()
+						margin := span.style.GetMargin()
+
+						// Inline elements ignore vertical margins (CSS 2.1 §8.3)
+						margin.Top = 0
+						margin.Bottom = 0
+
+						// CRITICAL FIX: Empty inline elements (no content between OpenTag and CloseTag)
+						// must still have dimensions from border and padding (CSS 2.1 §10.3.1)
+						// Example: <span style="border:25px; padding:100px"></span>
+						// Should render as 250px wide (25+100+0+100+25) even with no content
+
+						// Check if inline is truly empty (no text/atomic content between OpenTag and CloseTag)
+						isEmpty := true
+						for j := span.startIdx + 1; j < i; j++ {
+							if fragments[j].Type == FragmentText || fragments[j].Type == FragmentAtomic {
+								isEmpty = false
 								break
 							}
 						}
 
-						if hasBlockChild {
-							// Block-in-inline: Create fragment boxes (CSS 2.1 §9.2.1.1)
-							// Check if there's content before the block
-							hasContentBefore := false
-							contentBeforeMaxX := span.startX
-							for j := span.startIdx + 1; j < blockChildIdx; j++ {
-								if fragments[j].Type == FragmentText || fragments[j].Type == FragmentAtomic {
-									hasContentBefore = true
-									fragEndX := fragments[j].Position.X + fragments[j].Size.Width
-									if fragEndX > contentBeforeMaxX {
-										contentBeforeMaxX = fragEndX
-									}
-								}
-							}
-
-							// Fragment 1: Content before block (if any)
-							if hasContentBefore {
-								// Compute border, padding, margin from style
-								border := span.style.GetBorderWidth()
-								padding := span.style.GetPadding()
-								margin := span.style.GetMargin()
-								lineHeight := span.style.GetLineHeight()
-
-								fragment1 := &Box{
-									Node:            span.node,
-									Style:           span.style,
-									X:               span.startX + wrapRelX,
-									Y:               span.startY + wrapRelY,
-									Width:           contentBeforeMaxX - span.startX,
-									Height:          lineHeight, // Use line-height, not text height
-									Border:          border,
-									Padding:         padding,
-									Margin:          margin,
-									Parent:          containerBox,
-									IsFirstFragment: true,  // First fragment has left border
-									IsLastFragment:  false, // Not last
-								}
-								// Insert fragment1 at correct position for CSS painting order
-								if span.hasChildWrappers && span.startBoxCount <= len(boxes) {
-									// Insert before child wrappers for correct nesting order
-									newBoxes := make([]*Box, 0, len(boxes)+1)
-									newBoxes = append(newBoxes, boxes[:span.startBoxCount]...)
-									newBoxes = append(newBoxes, fragment1)
-									newBoxes = append(newBoxes, boxes[span.startBoxCount:]...)
-									boxes = newBoxes
-								} else {
-									boxes = append(boxes, fragment1)
-								}
-
-								// Track fragment height for line height calculation
-								if lineHeight > lineMetrics.lineBoxHeight {
-									lineMetrics.lineBoxHeight = lineHeight
-								}
-							}
-
-							// Fragment 2: Content after block (if any)
-							endX := frag.Position.X
-							if endX > span.startX {
-								// Use currentY which is correctly updated after block child layout
-								afterBlockY := currentY
-
-								// Compute border, padding, margin from style
-								border := span.style.GetBorderWidth()
-								padding := span.style.GetPadding()
-								margin := span.style.GetMargin()
-								lineHeight := span.style.GetLineHeight()
-
-								fragment2 := &Box{
-									Node:            span.node,
-									Style:           span.style,
-									X:               containerBox.X + containerBox.Border.Left + containerBox.Padding.Left + wrapRelX,
-									Y:               afterBlockY + wrapRelY,
-									Width:           endX - (containerBox.X + containerBox.Border.Left + containerBox.Padding.Left),
-									Height:          lineHeight, // Use line-height, not text height
-									Border:          border,
-									Padding:         padding,
-									Margin:          margin,
-									Parent:          containerBox,
-									IsFirstFragment: false, // Not first
-									IsLastFragment:  true,  // Last fragment has right border
-								}
-								boxes = append(boxes, fragment2)
-
-								// Track fragment height for line height calculation
-								if lineHeight > lineMetrics.lineBoxHeight {
-									lineMetrics.lineBoxHeight = lineHeight
-								}
-							}
-						} else {
-							// Normal inline box (not split)
-							endX := frag.Position.X
-							wrapperWidth := endX - span.startX
-
-							// Compute border, padding, margin from style
-							border := span.style.GetBorderWidth()
-							padding := span.style.GetPadding()
-							margin := span.style.GetMargin()
-
-							// Inline elements ignore vertical margins (CSS 2.1 §8.3)
-							margin.Top = 0
-							margin.Bottom = 0
-
-							// CRITICAL FIX: Empty inline elements (no content between OpenTag and CloseTag)
-							// must still have dimensions from border and padding (CSS 2.1 §10.3.1)
-							// Example: <span style="border:25px; padding:100px"></span>
-							// Should render as 250px wide (25+100+0+100+25) even with no content
-
-							// Check if inline is truly empty (no text/atomic content between OpenTag and CloseTag)
-							isEmpty := true
-							for j := span.startIdx + 1; j < i; j++ {
-								if fragments[j].Type == FragmentText || fragments[j].Type == FragmentAtomic {
-									isEmpty = false
-									break
-								}
-							}
-
-							if isEmpty {
-								// Empty inline: width = full horizontal border + padding (no content)
-								wrapperWidth = border.Left + padding.Left + padding.Right + border.Right
-							}
+						if isEmpty {
+							// Empty inline: width = full horizontal border + padding (no content)
+							wrapperWidth = border.Left + padding.Left + padding.Right + border.Right
+						}
 
-							// Calculate height from line-height or font-size
-							// Empty inline elements establish line box height per CSS 2.1 §10.8.1
-							wrapperHeight := lineMetricsEffectiveHeight(lineMetrics)
-							if wrapperHeight == 0 {
-								// Use font-size as minimum height for empty inline elements
-								fontSize := span.style.GetFontSize()
-								if lineHeightValue, ok := span.style.Get("line-height"); ok && lineHeightValue != "normal" && lineHeightValue != "" {
-									// Handle relative units (em, %) relative to font-size
-									if strings.HasSuffix(lineHeightValue, "em") {
-										// Parse the number before "em"
-										numStr := strings.TrimSuffix(lineHeightValue, "em")
-										if multiplier, err := strconv.ParseFloat(numStr, 64); err == nil {
-											wrapperHeight = fontSize * multiplier
-										} else {
-											wrapperHeight = fontSize // Fallback
-										}
-									} else if strings.HasSuffix(lineHeightValue, "%") {
-										// Parse percentage
-										numStr := strings.TrimSuffix(lineHeightValue, "%")
-										if pct, err := strconv.ParseFloat(numStr, 64); err == nil {
-											wrapperHeight = fontSize * (pct / 100.0)
-										} else {
-											wrapperHeight = fontSize // Fallback
-										}
-									} else if parsedValue, parseOk := css.ParseLength(lineHeightValue); parseOk {
-										// Absolute units (px, pt, etc.)
-										wrapperHeight = parsedValue
+						// Calculate height from line-height or font-size
+						// Empty inline elements establish line box height per CSS 2.1 §10.8.1
+						wrapperHeight := lineMetricsEffectiveHeight(lineMetrics)
+						if wrapperHeight == 0 {
+							// Use font-size as minimum height for empty inline elements
+							fontSize := span.style.GetFontSize()
+							if lineHeightValue, ok := span.style.Get("line-height"); ok && lineHeightValue != "normal" && lineHeightValue != "" {
+								// Handle relative units (em, %) relative to font-size
+								if strings.HasSuffix(lineHeightValue, "em") {
+									// Parse the number before "em"
+									numStr := strings.TrimSuffix(lineHeightValue, "em")
+									if multiplier, err := strconv.ParseFloat(numStr, 64); err == nil {
+										wrapperHeight = fontSize * multiplier
+									} else {
+										wrapperHeight = fontSize // Fallback
+									}
+								} else if strings.HasSuffix(lineHeightValue, "%") {
+									// Parse percentage
+									numStr := strings.TrimSuffix(lineHeightValue, "%")
+									if pct, err := strconv.ParseFloat(numStr, 64); err == nil {
+										wrapperHeight = fontSize * (pct / 100.0)
 									} else {
-										wrapperHeight = fontSize // Fallback to font-size
+										wrapperHeight = fontSize // Fallback
 									}
+								} else if parsedValue, parseOk := css.ParseLength(lineHeightValue); parseOk {
+									// Absolute units (px, pt, etc.)
+									wrapperHeight = parsedValue
 								} else {
-									wrapperHeight = fontSize // Default: font-size
+									wrapperHeight = fontSize // Fallback to font-size
 								}
-							}
-
-							// Box height is the line box height (CSS 2.1 §10.8.1)
-							// Borders/padding "bleed" outside this and are drawn separately by the render phase
-							// wrapperHeight already equals effective height (line box height)
-						// Convert from content-relative to absolute coordinates
-						// Fragment positions are relative to container's content area
-						// (after border+padding), so add container's offset
-						baseX := containerBox.X + containerBox.Border.Left + containerBox.Padding.Left
-						// baseY :=  // Y coordinates are already absolute, not needed containerBox.Y + containerBox.Border.Top + containerBox.Padding.Top
-
-							wrapperBox := &Box{
-								Node:    span.node,
-								Style:   span.style,
-								X:       baseX + span.startX + margin.Left + wrapRelX,  // Apply left margin + relative offset
-								Y:       span.startY + margin.Top + wrapRelY,   // Apply top margin + relative offset
-								Width:   wrapperWidth,
-								Height:  wrapperHeight,
-								Border:  border,
-								Padding: padding,
-								Margin:  margin,
-								Parent:  containerBox,
-							}
-							// Insert wrapper at correct position for CSS painting order
-							if span.hasChildWrappers && span.startBoxCount <= len(boxes) {
-								// Insert before child wrappers for correct nesting order
-								newBoxes := make([]*Box, 0, len(boxes)+1)
-								newBoxes = append(newBoxes, boxes[:span.startBoxCount]...)
-								newBoxes = append(newBoxes, wrapperBox)
-								newBoxes = append(newBoxes, boxes[span.startBoxCount:]...)
-								boxes = newBoxes
 							} else {
-								boxes = append(boxes, wrapperBox)
+								wrapperHeight = fontSize // Default: font-size
 							}
+						}
 
-							// Track wrapper box height for line height calculation
-							// CSS 2.1 §10.8.1: Use line box height, NOT visual extent
-							// The borders/padding "bleed" outside the line box and don't affect
-							// parent container height. The render phase handles drawing the bleeding
-							// extent by extending the background/borders (see render.go lines 388-393)
-							if wrapperHeight > lineMetricsEffectiveHeight(lineMetrics) {
-								lineMetrics.lineBoxHeight = wrapperHeight
-							}
+						// Box height is the line box height (CSS 2.1 §10.8.1)
+						// Borders/padding "bleed" outside this and are drawn separately by the render phase
+						// wrapperHeight already equals effective height (line box height)
+					// Convert from content-relative to absolute coordinates
+					// Fragment positions are relative to container's content area
+					// (after border+padding), so add container's offset
+					baseX := containerBox.X + containerBox.Border.Left + containerBox.Padding.Left
+					// baseY :=  // Y coordinates are already absolute, not needed containerBox.Y + containerBox.Border.Top + containerBox.Padding.Top
+
+						wrapperBox := &Box{
+							Node:    span.node,
+							Style:   span.style,
+							X:       baseX + span.startX + margin.Left + wrapRelX,  // Apply left margin + relative offset
+							Y:       span.startY + margin.Top + wrapRelY,   // Apply top margin + relative offset
+							Width:   wrapperWidth,
+							Height:  wrapperHeight,
+							Border:  border,
+							Padding: padding,
+							Margin:  margin,
+							Parent:  containerBox,
+						}
+						// Insert wrapper at correct position for CSS painting order
+						if span.hasChildWrappers && span.startBoxCount <= len(boxes) {
+							// Insert before child wrappers for correct nesting order
+							newBoxes := make([]*Box, 0, len(boxes)+1)
+							newBoxes = append(newBoxes, boxes[:span.startBoxCount]...)
+							newBoxes = append(newBoxes, wrapperBox)
+							newBoxes = append(newBoxes, boxes[span.startBoxCount:]...)
+							boxes = newBoxes
+						} else {
+							boxes = append(boxes, wrapperBox)
+						}
+
+						// A wrapper on a single line is aligned with the line's content
+						if span.startY == currentY {
+							addLineItem(wrapperBox, lineItemInline, inlineStack[:spanIdx], true)
+						}
+
+						// Track wrapper box height for line height calculation
+						// CSS 2.1 §10.8.1: Use line box height, NOT visual extent
+						// The borders/padding "bleed" outside the line box and don't affect
+						// parent container height. The render phase handles drawing the bleeding
+						// extent by extending the background/borders (see render.go lines 388-393)
+						if wrapperHeight > lineMetricsEffectiveHeight(lineMetrics) {
+							lineMetrics.lineBoxHeight = wrapperHeight
 						}
 
 						// Mark parent spans as having child wrappers (for CSS painting order)
@@ -1407,15 +1372,18 @@ func (le *LayoutEngine) LayoutInlineContentToBoxes(
 				floatY = le.getClearY(clearType, floatY)
 			}
 
+			// Drop below the floats beside it if it is too wide to fit
+			floatWidth := floatBox.Margin.Left + floatBox.Width + floatBox.Margin.Right
+			floatY = le.getFloatDropY(floatWidth, floatY, containerContentLeft, containerContentLeft+containerAvailWidth)
+
 			// Get float offsets at the target Y
-			leftOffset, rightOffset := le.getFloatOffsets(floatY)
+			leftOffset, rightOffset := le.getFloatOffsets(floatY, containerContentLeft, containerContentLeft+containerAvailWidth)
 
 			// Calculate correct X position
 			var newX float64
 			if floatType == css.FloatLeft {
 				newX = containerContentLeft + leftOffset + floatBox.Margin.Left
 			} else {
-				floatWidth := floatBox.Margin.Left + floatBox.Width + floatBox.Margin.Right
 				newX = containerContentLeft + containerAvailWidth - rightOffset - floatWidth + floatBox.Margin.Left
 			}
 			newY := floatY + floatBox.Margin.Top
@@ -1429,14 +1397,16 @@ func (le *LayoutEngine) LayoutInlineContentToBoxes(
 				le.shiftChildren(floatBox, deltaX, deltaY)
 			}
 
-			// Add float to engine's float list
+			// Add float to engine's float list, then move it off its place
+			// if it's relatively positioned
 			le.addFloat(floatBox, floatType, floatY)
+			applyRelativeOffset(floatBox)
 
 			// Mark as floated for rendering
 			floatBox.Position = css.PositionAbsolute
 			floatBox.Parent = containerBox
 			boxes = append(boxes, floatBox)
-		} else if frag.Type == FragmentAtomic && frag.Node != nil && frag.Node.TagName != "img" {
+		} else if frag.Type == FragmentAtomic && frag.Node != nil && !isImageElement(frag.Node) {
 			// Non-replaced atomic inline (inline-block) - recursively layout its content
 			// Images and other replaced elements use fragmentToBoxSingle instead
 			atomicNode := frag.Node
@@ -1456,6 +1426,9 @@ func (le *LayoutEngine) LayoutInlineContentToBoxes(
 
 				// Track as content for line metrics
 				lineMetrics.hasContent = true
+				if atomicBox.Position != css.PositionAbsolute && atomicBox.Position != css.PositionFixed {
+					addLineItem(atomicBox, lineItemAtomic, inlineStack, true)
+				}
 				if atomicBox.Height > lineMetrics.contentHeight {
 					lineMetrics.contentHeight = atomicBox.Height
 				}
@@ -1509,7 +1482,7 @@ func (le *LayoutEngine) LayoutInlineContentToBoxes(
 				// CSS 2.1 §9.4.2: Whitespace-only text doesn't count as content
 				isContent := false
 				if frag.Type == FragmentText {
-					if strings.TrimSpace(frag.Text) != "" {
+					if !isWhitespaceOnly(frag.Text) {
 						isContent = true
 					}
 				} else if frag.Type == FragmentAtomic || frag.Type == FragmentBlockChild {
@@ -1537,27 +1510,35 @@ func (le *LayoutEngine) LayoutInlineContentToBoxes(
 
 				box.Parent = containerBox
 				boxes = append(boxes, box)
+				if frag.Type == FragmentText {
+					addLineItem(box, lineItemText, inlineStack, isContent)
+				} else if frag.Type == FragmentAtomic {
+					addLineItem(box, lineItemAtomic, inlineStack, isContent)
+				}
 			}
 		}
 	}
 
-	// Apply text-align to inline children
+	// Determine final line height: use current line if active, otherwise last finalized
+	finalLineHeight := lineMetricsEffectiveHeight(lineMetrics)
+	if finalLineHeight == 0 {
+		finalLineHeight = lastFinalizedLineHeight
+	}
+	lineMetricsReset(lineMetrics, false) // Records the final line box
+	containerBox.LineBoxes = lineBoxes
+
+	// Apply text-align to inline children. Inline boxes are aligned by their
+	// container's lines; inline-blocks align their own like any block container.
 	if containerBox.Style != nil {
 		display := containerBox.Style.GetDisplay()
-		if display != css.DisplayInline && display != css.DisplayInlineBlock {
-			if textAlign, ok := containerBox.Style.Get("text-align"); ok && textAlign != "left" && textAlign != "" {
+		if display != css.DisplayInline {
+			if textAlign := containerBox.Style.GetTextAlign(); textAlign != css.TextAlignLeft {
 				contentWidth := containerBox.Width - containerBox.Padding.Left - containerBox.Padding.Right - containerBox.Border.Left - containerBox.Border.Right
-				le.applyTextAlignToBoxes(boxes, containerBox, textAlign, contentWidth)
+				le.applyTextAlignToBoxes(boxes, containerBox, string(textAlign), contentWidth)
 			}
 		}
 	}
 
-	// Determine final line height: use current line if active, otherwise last finalized
-	finalLineHeight := lineMetricsEffectiveHeight(lineMetrics)
-	if finalLineHeight == 0 {
-		finalLineHeight = lastFinalizedLineHeight
-	}
-
 	// Create inline context for auto-height calculation
 	// Track the final line Y and line height so parent can calculate its height
 	// LineBoxes should only include actual inline boxes (text, inline elements),
@@ -1583,64 +1564,8 @@ func (le *LayoutEngine) LayoutInlineContentToBoxes(
 	return &InlineLayoutResult{
 		ChildBoxes:     boxes,
 		FinalInlineCtx: finalInlineCtx,
-		UsedMultiPass:  true,
 	}
 }
-func (le *LayoutEngine) layoutInlineContentWIP(
-	node *html.Node,
-	box *Box,
-	availableWidth float64,
-	startY float64,
-	border, padding css.BoxEdge,
-	computedStyles map[*html.Node]*css.Style,
-) []*Box {
-	// Initialize state
-	state := &InlineLayoutState{
-		Items:          []*InlineItem{},
-		Lines:          []*LineBreakResult{},
-		ContainerBox:   box,
-		ContainerStyle: box.Style,
-		AvailableWidth: availableWidth,
-		StartY:         startY,
-		Border:         border,
-		Padding:        padding,
-		FloatList:      []FloatInfo{},
-		FloatBaseIndex: le.floatBase,
-	}
-
-	// Phase 1: Collect inline items
-	for _, child := range node.Children {
-		le.CollectInlineItems(child, state, computedStyles)
-	}
-
-	// Phase 2 & 3: Line breaking with retry when floats change available width
-	// This implements the Gecko-style retry mechanism (RedoMoreFloats)
-	const maxRetries = 3 // Prevent infinite loops
-	var boxes []*Box
-
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		// Phase 2: Break into lines with current float state
-		success := le.breakLinesWIP(state)
-		if !success {
-			return []*Box{} // Line breaking failed
-		}
-
-		// Phase 3: Construct line boxes and layout floats
-		// Returns boxes and whether retry is needed
-		boxes, retryNeeded := le.constructLineBoxesWithRetry(state, box, computedStyles)
-
-		if !retryNeeded {
-			// Success - no floats changed available width
-			return boxes
-		}
-
-		// Retry needed - a float changed available width
-		// Phase 2 will be re-run with updated float list on next iteration
-	}
-
-	// Max retries exceeded - return what we have
-	return boxes
-}
 
 // Phase 1: CollectInlineItems flattens the DOM tree into a sequential list of inline items.
 // This converts the hierarchical structure into a flat array that's easier to process for line breaking.
@@ -1694,7 +1619,7 @@ func (le *LayoutEngine) CollectInlineItems(node *html.Node, state *InlineLayoutS
 
 		if shouldApplyFirstLetter {
 			// Get the computed first-letter style
-			firstLetterStyle := css.ComputePseudoElementStyle(node.Parent, "first-letter", le.stylesheets, le.viewport.width, le.viewport.height, parentStyle)
+			firstLetterStyle := css.ComputePseudoElementStyle(node.Parent, "first-letter", le.stylesheets, le.media(), parentStyle)
 			firstLetter, remaining := extractFirstLetter(node.Text)
 
 			if firstLetter != "" {
@@ -1704,7 +1629,7 @@ func (le *LayoutEngine) CollectInlineItems(node *html.Node, state *InlineLayoutS
 				flItalic := firstLetterStyle.GetFontStyle() == css.FontStyleItalic
 				flMono := firstLetterStyle.IsMonospaceFamily()
 				flAhem := firstLetterStyle.IsAhemFamily()
-				flWidth, flHeight := text.MeasureTextWithStyle(firstLetter, flFontSize, flBold, flItalic, flMono, flAhem)
+				flWidth, flHeight := text.MeasureTextWithFamilies(firstLetterStyle.Fonts, firstLetter, flFontSize, firstLetterStyle.GetFontFamilies(), flBold, flItalic, flMono, flAhem)
 
 				firstLetterItem := &InlineItem{
 					Type:        InlineItemText,
@@ -1725,7 +1650,7 @@ func (le *LayoutEngine) CollectInlineItems(node *html.Node, state *InlineLayoutS
 					italic := parentStyle.GetFontStyle() == css.FontStyleItalic
 					mono := parentStyle.IsMonospaceFamily()
 					ahem := parentStyle.IsAhemFamily()
-					width, height := text.MeasureTextWithStyle(remaining, fontSize, bold, italic, mono, ahem)
+					width, height := text.MeasureTextWithFamilies(parentStyle.Fonts, remaining, fontSize, parentStyle.GetFontFamilies(), bold, italic, mono, ahem)
 
 					remainingItem := &InlineItem{
 						Type:        InlineItemText,
@@ -1767,7 +1692,7 @@ func (le *LayoutEngine) CollectInlineItems(node *html.Node, state *InlineLayoutS
 		italic := parentStyle.GetFontStyle() == css.FontStyleItalic
 		mono := parentStyle.IsMonospaceFamily()
 		ahem := parentStyle.IsAhemFamily()
-		width, height := text.MeasureTextWithStyle(textContent, fontSize, bold, italic, mono, ahem)
+		width, height := text.MeasureTextWithFamilies(parentStyle.Fonts, textContent, fontSize, parentStyle.GetFontFamilies(), bold, italic, mono, ahem)
 
 		// CSS 2.1 §16.4: Add letter-spacing between adjacent characters
 		letterSpacing := parentStyle.GetLetterSpacing()
@@ -1795,7 +1720,7 @@ func (le *LayoutEngine) CollectInlineItems(node *html.Node, state *InlineLayoutS
 		if style == nil {
 			// Compute style on-the-fly for nested elements not in the map
 			// (collectInlineItemsClean only pre-computes direct children)
-			style = css.ComputeStyle(node, le.stylesheets, le.viewport.width, le.viewport.height)
+			style = css.ComputeStyle(node, le.stylesheets, le.media())
 			// Inherit from parent if available
 			if node.Parent != nil {
 				if parentStyle := computedStyles[node.Parent]; parentStyle != nil {
@@ -1804,6 +1729,7 @@ func (le *LayoutEngine) CollectInlineItems(node *html.Node, state *InlineLayoutS
 			}
 			computedStyles[node] = style
 		}
+		applyFormControlSize(node, style)
 
 		display := style.GetDisplay()
 
@@ -1813,7 +1739,7 @@ func (le *LayoutEngine) CollectInlineItems(node *html.Node, state *InlineLayoutS
 		}
 
 		// Images default to inline-block display
-		if node.TagName == "img" && display != css.DisplayNone && display != css.DisplayBlock {
+		if isImageElement(node) && display != css.DisplayNone && display != css.DisplayBlock {
 			display = css.DisplayInlineBlock
 		}
 
@@ -1885,45 +1811,6 @@ func (le *LayoutEngine) CollectInlineItems(node *html.Node, state *InlineLayoutS
 				return
 			}
 
-			// Check if this inline element contains ONLY block-level children
-			// Per CSS 2.1 §9.2.1.1: When an inline box contains a block box, the inline
-			// is broken around the block. If the resulting anonymous inline boxes are empty
-			// (no text, no inline content), they shouldn't create visible space.
-			hasOnlyBlockChildren := true
-			hasAnyChildren := false
-			for _, child := range node.Children {
-				hasAnyChildren = true
-				// Text nodes with non-whitespace content count as inline
-				if child.Type == html.TextNode && strings.TrimSpace(child.Text) != "" {
-					hasOnlyBlockChildren = false
-					break
-				}
-				// Element nodes need style check
-				if child.Type == html.ElementNode {
-					childStyle := computedStyles[child]
-					if childStyle == nil {
-						// Compute on the fly for nested elements not in the map
-						childStyle = css.ComputeStyle(child, le.stylesheets, le.viewport.width, le.viewport.height)
-						computedStyles[child] = childStyle
-					}
-					childDisplay := childStyle.GetDisplay()
-					// Block-level displays don't break the pattern
-					if childDisplay != css.DisplayBlock && childDisplay != css.DisplayTable && childDisplay != css.DisplayListItem {
-						hasOnlyBlockChildren = false
-						break
-					}
-				}
-			}
-
-			// If inline contains only block children, skip OpenTag/CloseTag to avoid empty inline boxes
-			if hasAnyChildren && hasOnlyBlockChildren {
-				// Just process children directly without creating inline box fragments
-				for _, child := range node.Children {
-					le.CollectInlineItems(child, state, computedStyles)
-				}
-				return
-			}
-
 			// Regular inline element - add open tag
 			// CSS 2.1 §8.3: Inline element's left margin/border/padding appear at start
 			margin := style.GetMargin()
@@ -1963,10 +1850,10 @@ func (le *LayoutEngine) CollectInlineItems(node *html.Node, state *InlineLayoutS
 			var width, height float64
 
 			// Special case for img elements: load actual image dimensions
-			if node.TagName == "img" {
-				if src, ok := node.GetAttribute("src"); ok {
+			if isImageElement(node) {
+				if src, ok := le.imageSource(node); ok {
 					// Try to load image to get natural dimensions
-					if w, h, err := images.GetImageDimensionsWithFetcher(src, le.imageFetcher); err == nil {
+					if w, h, err := le.imageDimensions(node, src, style); err == nil {
 						width = float64(w)
 						height = float64(h)
 
@@ -2021,7 +1908,7 @@ func (le *LayoutEngine) CollectInlineItems(node *html.Node, state *InlineLayoutS
 			}
 
 			// For non-img elements, check CSS width/height first
-			if node.TagName != "img" {
+			if !isImageElement(node) {
 				if cssWidth, ok := style.GetLength("width"); ok {
 					width = cssWidth
 					// Add padding/border for border-box calculation
@@ -2050,14 +1937,14 @@ func (le *LayoutEngine) CollectInlineItems(node *html.Node, state *InlineLayoutS
 				// Measure children text content with parent's font properties
 				for _, child := range node.Children {
 					if child.Type == html.TextNode && child.Text != "" {
-						tw, th := text.MeasureTextWithStyle(child.Text, fontSize, bold, italic, mono, ahem)
+						tw, th := text.MeasureTextWithFamilies(style.Fonts, child.Text, fontSize, style.GetFontFamilies(), bold, italic, mono, ahem)
 						width += tw
 						if th > height {
 							height = th
 						}
 					} else if child.Type == html.ElementNode {
 						// For element children, fall back to ComputeMinMaxSizes
-						childStyle := css.ComputeStyle(child, le.stylesheets, le.viewport.width, le.viewport.height)
+						childStyle := css.ComputeStyle(child, le.stylesheets, le.media())
 						if childStyle != nil {
 							constraint := NewConstraintSpace(state.AvailableWidth, 0)
 							sizes := le.ComputeMinMaxSizes(child, constraint, childStyle)
@@ -2115,674 +2002,3 @@ func (le *LayoutEngine) CollectInlineItems(node *html.Node, state *InlineLayoutS
 		}
 	}
 }
-
-// Phase 2: BreakLines determines what items go on each line, accounting for floats.
-// This is where retry happens - if floats change available width, we re-break affected lines.
-//
-// Returns true if line breaking succeeded, false if retry is needed.
-// NOTE: This is the OLD WIP implementation. New code should use BreakLines() instead.
-func (le *LayoutEngine) breakLinesWIP(state *InlineLayoutState) bool {
-	if len(state.Items) == 0 {
-		return true // Nothing to break
-	}
-
-	state.Lines = nil // Clear any previous line breaking results
-	currentY := state.StartY
-	itemIndex := 0
-
-	for itemIndex < len(state.Items) {
-		// Start a new line
-		line := &LineBreakResult{
-			Y:          currentY,
-			Items:      []*InlineItem{},
-			StartIndex: itemIndex,
-			TextBreaks: make(map[*InlineItem]struct {
-				StartOffset int
-				EndOffset   int
-			}),
-		}
-
-		// Calculate available width for this line (accounting for floats)
-		leftOffset, rightOffset := le.getFloatOffsets(currentY)
-		line.AvailableWidth = state.AvailableWidth - leftOffset - rightOffset
-
-		// Accumulate items on this line
-		lineX := 0.0
-		lineHeight := 0.0
-
-		for itemIndex < len(state.Items) {
-			item := state.Items[itemIndex]
-
-			// Calculate item width
-			itemWidth := 0.0
-			itemHeight := 0.0
-
-			switch item.Type {
-			case InlineItemText:
-				// For text, we might need to break it
-				itemWidth = item.Width
-				itemHeight = item.Height
-
-				// Check if text fits on current line
-				if lineX+itemWidth > line.AvailableWidth && len(line.Items) > 0 {
-					// Text doesn't fit - need to break
-					// For now, simple algorithm: break entire text to next line
-					// TODO: Implement proper word breaking within text
-					goto finishLine
-				}
-
-			case InlineItemOpenTag:
-				// Opening tag contributes to line height even if element is empty
-				// This is per CSS 2.1: empty inline elements still influence line height
-				// CSS 2.1 §8.3: Left margin/border/padding at inline box start
-				itemWidth = item.Width
-
-				// CSS 2.1 §10.8.1: For inline boxes, line box height is determined by 'line-height'
-				// Padding and borders render visually but DON'T affect line box height calculation
-				lineHeightValue := item.Style.GetLineHeight()
-				itemHeight = lineHeightValue
-
-			case InlineItemCloseTag:
-				// Closing tag doesn't add height (already accounted for in opening tag)
-				// CSS 2.1 §8.3: Right margin/border/padding at inline box end
-				itemWidth = item.Width
-				itemHeight = 0
-
-			case InlineItemAtomic, InlineItemFloat:
-				// Atomic items have their own width/height
-				itemWidth = item.Width
-				itemHeight = item.Height
-
-				if lineX+itemWidth > line.AvailableWidth && len(line.Items) > 0 {
-					// Atomic item doesn't fit
-					goto finishLine
-				}
-
-			case InlineItemBlockChild:
-				// Block children force line breaks before and after
-				// If we have items on current line, finish it first
-				if len(line.Items) > 0 {
-					goto finishLine
-				}
-				// Add block child as sole item on its own line
-				line.Items = append(line.Items, item)
-				itemIndex++
-				goto finishLine
-
-			case InlineItemControl:
-				// Control items (like <br>) force a line break
-				itemIndex++
-				goto finishLine
-			}
-
-			// Add item to line
-			line.Items = append(line.Items, item)
-			lineX += itemWidth
-			if itemHeight > lineHeight {
-				lineHeight = itemHeight
-			}
-
-			itemIndex++
-		}
-
-	finishLine:
-		// Finalize this line
-		line.EndIndex = itemIndex
-		line.LineHeight = lineHeight
-		if line.LineHeight == 0 {
-			// Use container's line-height as minimum
-			line.LineHeight = state.ContainerStyle.GetLineHeight()
-		}
-
-		state.Lines = append(state.Lines, line)
-
-		// Move to next line
-		currentY += line.LineHeight
-
-		// If we didn't make progress, either shift down past floats or force item
-		if itemIndex == line.StartIndex && itemIndex < len(state.Items) {
-			// CSS 2.1 §9.5: "If a shortened line box is too small to contain any
-			// content, then the line box is shifted downward until either some
-			// content fits or there are no more floats present."
-			leftOff, rightOff := le.getFloatOffsets(currentY)
-			if leftOff > 0 || rightOff > 0 {
-				// Line is narrowed by floats - find next Y below the nearest float
-				nextY := currentY
-				for i := le.floatBase; i < len(le.floats); i++ {
-					floatInfo := le.floats[i]
-					floatBottom := floatInfo.Y + le.getTotalHeight(floatInfo.Box)
-					if floatBottom > currentY && (nextY == currentY || floatBottom < nextY) {
-						nextY = floatBottom
-					}
-				}
-				if nextY > currentY {
-					// Shift line down and retry
-					currentY = nextY
-					// Remove the empty line we just added and create a new one
-					state.Lines = state.Lines[:len(state.Lines)-1]
-					continue
-				}
-			}
-			// No floats to clear - force include at least one item to avoid infinite loop
-			item := state.Items[itemIndex]
-			line.Items = append(line.Items, item)
-			line.EndIndex = itemIndex + 1
-			itemIndex++
-		}
-	}
-
-	return true // Line breaking succeeded
-}
-
-// Phase 3: ConstructLineBoxes creates actual positioned Box fragments from line breaking results.
-// This is the final phase that produces the output fragment tree.
-func (le *LayoutEngine) ConstructLineBoxes(state *InlineLayoutState, parent *Box) []*Box {
-	boxes := []*Box{}
-
-	for _, line := range state.Lines {
-		// Calculate starting X for this line (accounting for floats)
-		leftOffset, _ := le.getFloatOffsets(line.Y)
-		currentX := state.ContainerBox.X + state.Border.Left + state.Padding.Left + leftOffset
-
-		// Track open inline elements (for nested inline styling)
-		type inlineContext struct {
-			node               *html.Node
-			style              *css.Style
-			box                *Box
-			fragmentStartX     float64  // Where current fragment starts
-			fragmentStartY     float64
-			fragmentMaxX       float64 // Bounding box of current fragment
-			fragmentMaxY       float64
-			completedFragments []*Box // Completed fragments (before blocks)
-		}
-		openInlines := []inlineContext{}
-
-		// Reorder items: floats first, then everything else (CSS-correct)
-		reorderedItems := make([]*InlineItem, 0, len(line.Items))
-		nonFloats := make([]*InlineItem, 0, len(line.Items))
-
-		for _, item := range line.Items {
-			if item.Type == InlineItemFloat {
-				reorderedItems = append(reorderedItems, item)
-			} else {
-				nonFloats = append(nonFloats, item)
-			}
-		}
-		reorderedItems = append(reorderedItems, nonFloats...)
-
-		// Process each item on this line
-		for _, item := range reorderedItems {
-			switch item.Type {
-			case InlineItemText:
-				// Create a text box
-				textBox := &Box{
-					Node:     item.Node,
-					Style:    item.Style,
-					X:        currentX,
-					Y:        line.Y,
-					Width:    item.Width,
-					Height:   item.Height,
-					Margin:   css.BoxEdge{},
-					Padding:  css.BoxEdge{},
-					Border:   css.BoxEdge{},
-					Position: css.PositionStatic,
-					Parent:   parent,
-				}
-				boxes = append(boxes, textBox)
-				currentX += item.Width
-
-				// Update fragment bounds for all open inline elements
-				for i := range openInlines {
-					if currentX > openInlines[i].fragmentMaxX {
-						openInlines[i].fragmentMaxX = currentX
-					}
-					if line.Y+line.LineHeight > openInlines[i].fragmentMaxY {
-						openInlines[i].fragmentMaxY = line.Y + line.LineHeight
-					}
-				}
-
-			case InlineItemOpenTag:
-				// Start tracking this inline element
-				// Create a box for it (will be sized after seeing all children)
-				padding := item.Style.GetPadding()
-				border := item.Style.GetBorderWidth()
-				margin := item.Style.GetMargin()
-
-				// CSS 2.1 §10.8.1: Inline element vertical margins/padding don't affect line box height
-				// but padding/borders DO render visually extending beyond the line box
-
-				// Inline elements ignore vertical margins (CSS 2.1 §10.6.1)
-				margin.Top = 0
-				margin.Bottom = 0
-
-				// Box height is the line box height (CSS 2.1 §10.8.1)
-				// Borders/padding "bleed" outside this and are drawn separately by the render phase
-				inlineBoxHeight := line.LineHeight
-
-			// Apply left margin BEFORE positioning the box
-			currentX += margin.Left
-
-				inlineBox := &Box{
-					Node:     item.Node,
-					Style:    item.Style,
-					X:        currentX,
-					Y:        line.Y,
-					Width:    0, // Will be computed from children
-					Height:   inlineBoxHeight,
-					Margin:   margin, // Inline elements have horizontal margins
-					Padding:  padding,
-					Border:   border,
-					Position: css.PositionStatic,
-					Parent:   parent,
-				}
-				// Initialize fragment tracking
-				fragStartX := currentX + border.Left + padding.Left
-				openInlines = append(openInlines, inlineContext{
-					node:           item.Node,
-					style:          item.Style,
-					box:            inlineBox,
-					fragmentStartX: fragStartX,
-					fragmentStartY: line.Y,
-					fragmentMaxX:   fragStartX,
-					fragmentMaxY:   line.Y + inlineBoxHeight,
-				})
-
-				// Advance currentX by left border + padding (margin already applied above)
-				// This ensures empty inline elements have proper width
-				currentX += border.Left + padding.Left
-
-			case InlineItemCloseTag:
-				// Close the most recent inline element
-				if len(openInlines) > 0 {
-					ctx := openInlines[len(openInlines)-1]
-					openInlines = openInlines[:len(openInlines)-1]
-
-					// Add right padding + border (NOT margin) before computing width
-					currentX += ctx.box.Padding.Right + ctx.box.Border.Right
-
-					// Compute width from current X - start X
-					ctx.box.Width = currentX - ctx.box.X
-					boxes = append(boxes, ctx.box)
-
-				// Now add right margin for positioning next element
-				currentX += ctx.box.Margin.Right
-				}
-
-			case InlineItemAtomic:
-				// Atomic inline element - it has its own dimensions
-				atomicBox := &Box{
-					Node:     item.Node,
-					Style:    item.Style,
-					X:        currentX,
-					Y:        line.Y,
-					Width:    item.Width,
-					Height:   item.Height,
-					Margin:   css.BoxEdge{},
-					Padding:  css.BoxEdge{},
-					Border:   css.BoxEdge{},
-					Position: css.PositionStatic,
-					Parent:   parent,
-				}
-				boxes = append(boxes, atomicBox)
-				currentX += item.Width
-
-			case InlineItemFloat:
-				// Floats are positioned separately by float logic
-				// We don't position them here
-				// TODO: Integrate with existing float positioning
-			}
-		}
-	}
-
-	return boxes
-}
-
-// constructLineBoxesWithRetry is like ConstructLineBoxes but also detects when floats
-// change available width and signals that retry is needed.
-// Returns (boxes, retryNeeded)
-func (le *LayoutEngine) constructLineBoxesWithRetry(
-	state *InlineLayoutState,
-	parent *Box,
-	computedStyles map[*html.Node]*css.Style,
-) ([]*Box, bool) {
-	boxes := []*Box{}
-	retryNeeded := false
-
-	for _, line := range state.Lines {
-		// Calculate starting X for this line (accounting for floats)
-		leftOffsetBefore, _ := le.getFloatOffsets(line.Y)
-		currentX := state.ContainerBox.X + state.Border.Left + state.Padding.Left + leftOffsetBefore
-
-		// Track open inline elements
-		type inlineContext struct {
-			node               *html.Node
-			style              *css.Style
-			box                *Box
-			fragmentStartX     float64  // Where current fragment starts
-			fragmentStartY     float64
-			fragmentMaxX       float64 // Bounding box of current fragment
-			fragmentMaxY       float64
-			completedFragments []*Box // Completed fragments (before blocks)
-		}
-		openInlines := []inlineContext{}
-
-		// Reorder items: floats first, then everything else (CSS-correct)
-		reorderedItems := make([]*InlineItem, 0, len(line.Items))
-		nonFloats := make([]*InlineItem, 0, len(line.Items))
-
-		for _, item := range line.Items {
-			if item.Type == InlineItemFloat {
-				reorderedItems = append(reorderedItems, item)
-			} else {
-				nonFloats = append(nonFloats, item)
-			}
-		}
-		reorderedItems = append(reorderedItems, nonFloats...)
-
-		// Process each item on this line
-		// Track if we've seen content (non-float) on this line yet
-		hasSeenContentOnLine := false
-		for _, item := range reorderedItems {
-			switch item.Type {
-			case InlineItemText:
-				// CSS whitespace collapsing: trim leading whitespace at start of line
-				// (after line breaks, leading spaces should be trimmed)
-				trimmedText := item.Text
-				if !hasSeenContentOnLine && item.Node != nil {
-					trimmedText = strings.TrimLeft(item.Text, " \t\n\r")
-					// Update the node's text for rendering
-					if trimmedText != item.Text {
-						item.Node.Text = trimmedText
-						// Recalculate width for trimmed text
-						if item.Style != nil {
-							fontSize := item.Style.GetFontSize()
-							bold := item.Style.GetFontWeight() == css.FontWeightBold
-							italic := item.Style.GetFontStyle() == css.FontStyleItalic
-							mono := item.Style.IsMonospaceFamily()
-							ahem := item.Style.IsAhemFamily()
-							trimmedWidth, _ := text.MeasureTextWithStyle(trimmedText, fontSize, bold, italic, mono, ahem)
-							ls := item.Style.GetLetterSpacing()
-							if ls != 0 && len([]rune(trimmedText)) > 1 {
-								trimmedWidth += ls * float64(len([]rune(trimmedText))-1)
-							}
-							item.Width = trimmedWidth
-						}
-					}
-				}
-				hasSeenContentOnLine = true
-
-				textBox := &Box{
-					Node:     item.Node,
-					Style:    item.Style,
-					X:        currentX,
-					Y:        line.Y,
-					Width:    item.Width,
-					Height:   item.Height,
-					Margin:   css.BoxEdge{},
-					Padding:  css.BoxEdge{},
-					Border:   css.BoxEdge{},
-					Position: css.PositionStatic,
-					Parent:   parent,
-				}
-				boxes = append(boxes, textBox)
-				currentX += item.Width
-
-				// Update fragment bounds for all open inline elements
-				for i := range openInlines {
-					if currentX > openInlines[i].fragmentMaxX {
-						openInlines[i].fragmentMaxX = currentX
-					}
-					if line.Y+line.LineHeight > openInlines[i].fragmentMaxY {
-						openInlines[i].fragmentMaxY = line.Y + line.LineHeight
-					}
-				}
-
-			case InlineItemOpenTag:
-				padding := item.Style.GetPadding()
-				border := item.Style.GetBorderWidth()
-				margin := item.Style.GetMargin()
-
-				// CSS 2.1 §10.8.1: Inline element vertical margins/padding don't affect line box height
-				// but padding/borders DO render visually extending beyond the line box
-
-				// Inline elements ignore vertical margins (CSS 2.1 §10.6.1)
-				margin.Top = 0
-				margin.Bottom = 0
-
-				// Box height is the line box height (CSS 2.1 §10.8.1)
-				// Borders/padding "bleed" outside this and are drawn separately by the render phase
-				inlineBoxHeight := line.LineHeight
-
-			// Apply left margin BEFORE positioning the box
-			currentX += margin.Left
-
-				inlineBox := &Box{
-					Node:     item.Node,
-					Style:    item.Style,
-					X:        currentX,
-					Y:        line.Y,
-					Width:    0,
-					Height:   inlineBoxHeight,
-					Margin:   margin, // Inline elements have horizontal margins
-					Padding:  padding,
-					Border:   border,
-					Position: css.PositionStatic,
-					Parent:   parent,
-				}
-				// Initialize fragment tracking
-				fragStartX := currentX + border.Left + padding.Left
-				openInlines = append(openInlines, inlineContext{
-					node:           item.Node,
-					style:          item.Style,
-					box:            inlineBox,
-					fragmentStartX: fragStartX,
-					fragmentStartY: line.Y,
-					fragmentMaxX:   fragStartX,
-					fragmentMaxY:   line.Y + inlineBoxHeight,
-				})
-
-				// Advance currentX by left border + padding (margin already applied above)
-				// This ensures empty inline elements have proper width
-				currentX += border.Left + padding.Left
-
-			case InlineItemCloseTag:
-				if len(openInlines) > 0 {
-					ctx := openInlines[len(openInlines)-1]
-					openInlines = openInlines[:len(openInlines)-1]
-
-					// Add right padding + border (NOT margin) before computing width
-					currentX += ctx.box.Padding.Right + ctx.box.Border.Right
-
-					ctx.box.Width = currentX - ctx.box.X
-					boxes = append(boxes, ctx.box)
-
-				// Now add right margin for positioning next element
-				currentX += ctx.box.Margin.Right
-				}
-
-			case InlineItemAtomic:
-				// Atomic inline (inline-block) - recursively layout its content
-				// Use the pre-computed width as the available width for its children
-				atomicBox := le.layoutNode(
-					item.Node,
-					currentX,
-					line.Y,
-					item.Width, // Use computed width as constraint
-					computedStyles,
-					parent,
-				)
-				if atomicBox != nil {
-					// Apply vertical alignment to inline-block
-					// For baseline alignment, the inline-block's baseline (last line box's baseline)
-					// should align with the parent line's baseline
-					le.applyVerticalAlign(atomicBox, line.Y, line.LineHeight)
-
-					boxes = append(boxes, atomicBox)
-					// Use actual width (might include margins/padding/borders)
-					actualWidth := le.getTotalWidth(atomicBox)
-					currentX += actualWidth
-				}
-
-			case InlineItemBlockChild:
-				// Block-in-inline: Block children split inline elements into fragments (CSS 2.1 §9.2.1.1)
-				// STEP 1: Complete current fragments for ALL open inline elements
-				for i := range openInlines {
-					ctx := &openInlines[i]
-
-					// Create fragment box for content before the block
-					if ctx.fragmentMaxX > ctx.fragmentStartX {
-						fragmentBox := &Box{
-							Node:            ctx.node,
-							Style:           ctx.style,
-							X:               ctx.fragmentStartX - ctx.box.Border.Left - ctx.box.Padding.Left,
-							Y:               ctx.fragmentStartY,
-							Width:           ctx.fragmentMaxX - ctx.fragmentStartX + ctx.box.Border.Left + ctx.box.Border.Right + ctx.box.Padding.Left + ctx.box.Padding.Right,
-							Height:          ctx.fragmentMaxY - ctx.fragmentStartY,
-							Margin:          css.BoxEdge{}, // Fragments don't have margins
-							Padding:         ctx.box.Padding,
-							Border:          ctx.box.Border,
-							Position:        css.PositionStatic,
-							Parent:          parent,
-							IsFirstFragment: len(ctx.completedFragments) == 0, // First fragment if no previous fragments
-							IsLastFragment:  false,                            // Not last - more content after block
-						}
-						ctx.completedFragments = append(ctx.completedFragments, fragmentBox)
-					}
-				}
-
-				// STEP 2: Layout the block child
-				blockBox := le.layoutNode(
-					item.Node,
-					state.ContainerBox.X+state.Border.Left+state.Padding.Left,
-					line.Y,
-					state.AvailableWidth,
-					computedStyles,
-					parent,
-				)
-				if blockBox != nil {
-					boxes = append(boxes, blockBox)
-				}
-
-				// STEP 3: Restart fragments for open inline elements (content after block)
-				// Note: New fragments will start on the next line, which will be processed in next iteration
-				for i := range openInlines {
-					ctx := &openInlines[i]
-					// Fragment bounds will be set when we process the next line's content
-					ctx.fragmentStartX = 0
-					ctx.fragmentStartY = 0
-					ctx.fragmentMaxX = 0
-					ctx.fragmentMaxY = 0
-				}
-
-			case InlineItemFloat:
-				// Check if this float has already been laid out (to avoid duplicate layouts on retry)
-				var existingFloatBox *Box
-				for i := state.FloatBaseIndex; i < len(le.floats); i++ {
-					if le.floats[i].Box != nil && le.floats[i].Box.Node == item.Node {
-						existingFloatBox = le.floats[i].Box
-						break
-					}
-				}
-
-				// If float already exists, skip re-layout and continue
-				if existingFloatBox != nil {
-					boxes = append(boxes, existingFloatBox)
-					continue
-				}
-
-				// Layout the float to get its dimensions
-				// Track float count before layoutNode (layoutNode may add float as side effect)
-				floatCountBefore := len(le.floats)
-
-				floatBox := le.layoutNode(
-					item.Node,
-					state.ContainerBox.X+state.Border.Left+state.Padding.Left,
-					line.Y,
-					state.AvailableWidth,
-					computedStyles,
-					parent,
-				)
-
-				if floatBox != nil {
-					// Remove any floats added during layoutNode (float seeing itself bug)
-					if len(le.floats) > floatCountBefore {
-						le.floats = le.floats[:floatCountBefore]
-					}
-
-					// Get float type and reposition the box correctly
-					floatType := item.Style.GetFloat()
-					floatWidth := le.getTotalWidth(floatBox)
-					floatY := line.Y
-
-					// CSS 2.1 §9.5.2: Apply clear property — move float below previous floats
-					if item.Style != nil {
-						clearType := item.Style.GetClear()
-						if clearType != css.ClearNone {
-							floatY = le.getClearY(clearType, floatY)
-						}
-					}
-
-					// IMPORTANT: Get fresh float offsets BEFORE positioning this float
-					// Don't use leftOffsetBefore which was captured at start of line
-					leftOffset, rightOffset := le.getFloatOffsets(floatY)
-
-					// Calculate correct position based on float type
-					var newX float64
-					if floatType == css.FloatLeft {
-						// For left floats, position must clear both other floats (leftOffset) AND inline content (currentX)
-						baseX := state.ContainerBox.X + state.Border.Left + state.Padding.Left
-						floatClearX := baseX + leftOffset + floatBox.Margin.Left
-						inlineEndX := currentX + floatBox.Margin.Left
-						if inlineEndX > floatClearX {
-							newX = inlineEndX
-						} else {
-							newX = floatClearX
-						}
-					} else {
-						// Right float
-						baseX := state.ContainerBox.X + state.Border.Left + state.Padding.Left
-						newX = baseX + state.AvailableWidth - rightOffset - floatWidth + floatBox.Margin.Left
-					}
-					newY := floatY + floatBox.Margin.Top
-
-					// Calculate position delta to reposition the float and its children
-					deltaX := newX - floatBox.X
-					deltaY := newY - floatBox.Y
-
-					// Reposition child boxes
-					for _, child := range floatBox.Children {
-						child.X += deltaX
-						child.Y += deltaY
-					}
-
-					floatBox.X = newX
-					floatBox.Y = newY
-
-					boxes = append(boxes, floatBox)
-
-					// Add float to engine's float list
-					le.addFloat(floatBox, floatType, floatY)
-
-					// Update currentX to account for the float we just added
-					// (subsequent inline content must clear the float)
-					if floatType == css.FloatLeft {
-						leftOffsetNew, _ := le.getFloatOffsets(line.Y)
-						baseX := state.ContainerBox.X + state.Border.Left + state.Padding.Left
-						newCurX := baseX + leftOffsetNew
-						if newCurX > currentX {
-							currentX = newCurX
-						}
-					}
-					// Check if this float changes available width for this line
-					leftOffsetAfter, _ := le.getFloatOffsets(line.Y)
-					if leftOffsetAfter != leftOffsetBefore {
-						// Float changed available width - retry needed
-						retryNeeded = true
-					}
-				}
-			}
-		}
-	}
-
-	return boxes, retryNeeded
-}
@@ -1,14 +1,25 @@
 package layout
 
 import (
+	"context"
+
 	"louis14/pkg/css"
 	"louis14/pkg/html"
 )
 
-func (le *LayoutEngine) Layout(doc *html.Document) []*Box {
+// Layout lays out doc in the viewport and returns its root boxes. Layout
+// stops between blocks and lines once ctx is done, returning the
+// context's error, and fetches images and fonts with ctx.
+func (le *LayoutEngine) Layout(ctx context.Context, doc *html.Document) ([]*Box, error) {
+	le.ctx = ctx
+	defer func() { le.ctx = nil }()
+
 	// Phase 3: Compute styles from stylesheets
 	// Phase 22: Pass viewport dimensions for media query evaluation
-	computedStyles := css.ApplyStylesToDocument(doc, le.viewport.width, le.viewport.height)
+	computedStyles := css.ApplyStylesToDocument(doc, le.media())
+	le.applyTransitions(doc.Root, computedStyles)
+	le.beginIncrementalLayout(doc)
+	defer le.endIncrementalLayout(doc, computedStyles)
 
 	// Phase 11: Parse and store stylesheets for pseudo-element styling
 	le.stylesheets = make([]*css.Stylesheet, 0)
@@ -17,10 +28,9 @@ func (le *LayoutEngine) Layout(doc *html.Document) []*Box {
 			le.stylesheets = append(le.stylesheets, stylesheet)
 		}
 	}
-
-	// Phase 2: Recursively layout the tree starting from root's children
-	boxes := make([]*Box, 0)
-	y := 0.0
+	le.loadWebFonts()
+	le.prewarmImages(doc.Root)
+	applyFormControlSizes(doc.Root, computedStyles)
 
 	// Phase 4: Track absolutely positioned boxes separately
 	le.absoluteBoxes = make([]*Box, 0)
@@ -28,38 +38,103 @@ func (le *LayoutEngine) Layout(doc *html.Document) []*Box {
 	// Phase 5: Initialize floats tracking
 	le.floats = make([]FloatInfo, 0)
 
-	var prevBox *Box // Track previous sibling for margin collapsing
-	for _, node := range doc.Root.Children {
-		if node.Type == html.ElementNode {
-			box := le.layoutNode(node, 0, y, le.viewport.width, computedStyles, nil)
-			// Phase 7: Skip elements with display: none (layoutNode returns nil)
-			if box == nil {
-				continue
-			}
-			boxes = append(boxes, box)
-
-			// Phase 4 & 5: Only advance Y if element is in normal flow (not absolutely positioned or floated)
-			floatType := box.Style.GetFloat()
-			if box.Position != css.PositionAbsolute && box.Position != css.PositionFixed && floatType == css.FloatNone {
-				// Margin collapsing between adjacent siblings
-				if prevBox != nil && shouldCollapseMargins(prevBox) && shouldCollapseMargins(box) {
-					collapsed := collapseMargins(prevBox.Margin.Bottom, box.Margin.Top)
-					// We already advanced by prevBox's full total height (including prevBox.Margin.Bottom)
-					// and layoutNode already added box.Margin.Top to box.Y.
-					// We need to pull back by the non-collapsed portion.
-					adjustment := prevBox.Margin.Bottom + box.Margin.Top - collapsed
-					box.Y -= adjustment
-					le.adjustChildrenY(box, -adjustment)
-				}
-				y = box.Y + box.Border.Top + box.Padding.Top + box.Height + box.Padding.Bottom + box.Border.Bottom + box.Margin.Bottom
-				prevBox = box
-			}
+	// Counters start fresh so repeated Layout calls on one engine agree
+	le.counters = make(map[string][]int)
+
+	// Build the box tree, then lay it out in the initial containing block
+	le.boxTree = le.BuildBoxTree(doc.Root, computedStyles)
+	boxes := (&BlockLayoutMode{}).LayoutChildren(le, nil, le.boxTree.Root, le.viewport.width, computedStyles)
+	if err := ctx.Err(); err != nil {
+		// Nothing of a partial layout is reused
+		if le.incremental != nil {
+			le.incremental.cur = nil
 		}
+		return nil, err
 	}
 
 	// Phase 4: Absolutely positioned boxes are already in the tree as children
 	// of their containing blocks, so no need to add them separately.
 
+	// Scroll containers' content is moved by their scroll offsets, then
+	// sticky boxes are offset last, once their containing blocks are final
+	le.applyScrollOffsets(boxes)
+	le.applyStickyPositioning(boxes)
+
+	// The layout boxes of anonymous boxes have no node
+	le.boxTree.detachSources(boxes)
+
+	_, le.documentHeight = ContentBounds(boxes)
+	return boxes, nil
+}
+
+// fetchContext returns the context images and fonts are fetched with:
+// that of the Layout in progress, or the background context outside one.
+func (le *LayoutEngine) fetchContext() context.Context {
+	if le.ctx == nil {
+		return context.Background()
+	}
+	return le.ctx
+}
+
+// canceled reports whether the context of the layout in progress is done,
+// so layout should stop.
+func (le *LayoutEngine) canceled() bool {
+	return le.ctx != nil && le.ctx.Err() != nil
+}
+
+// layoutBlockChildren stacks the block-level children of a box in the box
+// tree in normal flow inside container, or the initial containing block if
+// it is nil, collapsing the margins between them.
+func (le *LayoutEngine) layoutBlockChildren(container *Box, box *BoxTreeNode, availableWidth float64, computedStyles map[*html.Node]*css.Style) []*Box {
+	x, y := 0.0, 0.0
+	if container != nil {
+		x = container.X + container.Border.Left + container.Padding.Left
+		y = container.Y + container.Border.Top + container.Padding.Top
+	}
+
+	boxes := make([]*Box, 0)
+	for _, child := range box.Children {
+		if le.canceled() {
+			break
+		}
+		var childBox *Box
+		if child.Anonymous() && child.Kind == BoxBlockContainer {
+			childBox = le.layoutAnonymousBlock(child, x, y, availableWidth, computedStyles, container)
+		} else if child.source.Type == html.ElementNode {
+			childBox = le.layoutNode(child.source, x, y, availableWidth, computedStyles, container)
+		}
+		// Phase 7: Skip elements with display: none (layoutNode returns nil)
+		if childBox == nil {
+			continue
+		}
+		boxes = append(boxes, childBox)
+
+		// Phase 4 & 5: Only advance Y if element is in normal flow (not absolutely positioned or floated)
+		floatType := childBox.Style.GetFloat()
+		if childBox.Position != css.PositionAbsolute && childBox.Position != css.PositionFixed && floatType == css.FloatNone {
+			y = childBox.Y + childBox.Border.Top + childBox.Padding.Top + childBox.Height + childBox.Padding.Bottom + childBox.Border.Bottom + childBox.Margin.Bottom
+		}
+	}
+	le.collapseSiblingMargins(boxes)
 	return boxes
 }
 
+// layoutAnonymousBlock lays out an anonymous block box: the lines of the
+// inline content between two blocks, as wide as its containing block.
+func (le *LayoutEngine) layoutAnonymousBlock(box *BoxTreeNode, x, y, availableWidth float64, computedStyles map[*html.Node]*css.Style, parent *Box) *Box {
+	b := &Box{
+		Style:    box.Style,
+		X:        x,
+		Y:        y,
+		Width:    availableWidth,
+		Position: css.PositionStatic,
+		Parent:   parent,
+	}
+	b.Children = (&InlineLayoutMode{}).LayoutChildren(le, b, box, availableWidth, computedStyles)
+	for _, child := range b.Children {
+		if bottom := child.Y + le.getTotalHeight(child) - y; bottom > b.Height {
+			b.Height = bottom
+		}
+	}
+	return b
+}
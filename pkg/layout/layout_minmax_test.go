@@ -370,3 +370,18 @@ func TestComputeMinMaxSizes_BlockWithPadding(t *testing.T) {
 			expectedWidth, sizes.MaxContentSize)
 	}
 }
+
+func TestComputeMinMaxSizes_NoBreakSpace(t *testing.T) {
+	le := &LayoutEngine{}
+	constraint := NewConstraintSpace(400, 300)
+	style := css.NewStyle()
+	style.Set("font-size", "10px")
+	style.Set("font-family", "Ahem")
+
+	// A no-break space joins its words into one unbreakable unit
+	node := &html.Node{Type: html.TextNode, Text: "aa\u00a0bb cc"}
+	sizes := le.ComputeMinMaxSizes(node, constraint, style)
+	if sizes.MinContentSize != 50 {
+		t.Errorf("min-content = %v, want 50 (the width of \"aa\\u00a0bb\")", sizes.MinContentSize)
+	}
+}
@@ -0,0 +1,170 @@
+package layout
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"louis14/pkg/html"
+)
+
+// layoutPages lays out markup at 400px wide in pages of pageHeight.
+func layoutPages(t *testing.T, markup string, pageHeight float64) [][]*Box {
+	t.Helper()
+	doc, err := html.Parse(markup)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	pages, err := NewLayoutEngine(400, pageHeight).LayoutPaged(context.Background(), doc, 400, pageHeight)
+	if err != nil {
+		t.Fatalf("layout: %v", err)
+	}
+	return pages
+}
+
+// findOnPage returns the box for the element with the given id on a page.
+func findOnPage(page []*Box, id string) *Box {
+	for _, box := range page {
+		if box.Node != nil && box.Node.Type == html.ElementNode {
+			if v, _ := box.Node.GetAttribute("id"); v == id {
+				return box
+			}
+		}
+		if found := findOnPage(box.Children, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// boxFinder returns a function returning the box for the element with the
+// given id among boxes, which fails the test if there is none.
+func boxFinder(t *testing.T, boxes []*Box) func(id string) *Box {
+	return func(id string) *Box {
+		t.Helper()
+		box := findOnPage(boxes, id)
+		if box == nil {
+			t.Fatalf("expected #%s", id)
+		}
+		return box
+	}
+}
+
+func TestLayoutPaged_BreaksBetweenBlocks(t *testing.T) {
+	pages := layoutPages(t, `<html><body style="margin:0">
+		<div id="a" style="height:100px"></div>
+		<div id="b" style="height:100px"></div>
+		<div id="c" style="height:100px"></div>
+	</body></html>`, 250)
+
+	if len(pages) != 2 {
+		t.Fatalf("expected 2 pages, got %d", len(pages))
+	}
+	if findOnPage(pages[0], "c") != nil {
+		t.Error("c should not start on the first page")
+	}
+	c := findOnPage(pages[1], "c")
+	if c == nil {
+		t.Fatal("c should be on the second page")
+	}
+	if c.Y != 0 {
+		t.Errorf("c should start the second page, got y=%.1f", c.Y)
+	}
+}
+
+func TestLayoutPaged_ForcedBreaks(t *testing.T) {
+	pages := layoutPages(t, `<html><body style="margin:0">
+		<h1 id="one" style="break-before:page;margin:0;height:20px">One</h1>
+		<p id="p1" style="margin:0;page-break-after:always">First chapter</p>
+		<h1 id="two" style="margin:0;height:20px">Two</h1>
+		<h1 id="three" style="break-before:page;margin:0;height:20px">Three</h1>
+	</body></html>`, 1000)
+
+	// The break before the first heading would leave a blank page
+	if len(pages) != 3 {
+		t.Fatalf("expected 3 pages, got %d", len(pages))
+	}
+	for i, id := range []string{"one", "two", "three"} {
+		box := findOnPage(pages[i], id)
+		if box == nil {
+			t.Fatalf("%s should be on page %d", id, i+1)
+		}
+		if box.Y != 0 {
+			t.Errorf("%s should start page %d, got y=%.1f", id, i+1, box.Y)
+		}
+	}
+	if findOnPage(pages[0], "two") != nil {
+		t.Error("page-break-after should move the next heading to a new page")
+	}
+}
+
+func TestLayoutPaged_BreakInsideAvoid(t *testing.T) {
+	pages := layoutPages(t, `<html><body style="margin:0">
+		<div id="a" style="height:200px"></div>
+		<div id="keep" style="break-inside:avoid">
+			<div style="height:80px"></div>
+			<div style="height:80px"></div>
+		</div>
+	</body></html>`, 300)
+
+	if len(pages) != 2 {
+		t.Fatalf("expected 2 pages, got %d", len(pages))
+	}
+	if findOnPage(pages[0], "keep") != nil {
+		t.Error("break-inside: avoid box should move whole to the next page")
+	}
+	keep := findOnPage(pages[1], "keep")
+	if keep == nil || keep.Y != 0 || keep.Height != 160 {
+		t.Fatalf("expected the whole box atop page 2, got %+v", keep)
+	}
+}
+
+func TestLayoutPaged_SlicesTallBoxes(t *testing.T) {
+	pages := layoutPages(t, `<html><body style="margin:0">
+		<div id="tall" style="height:500px;border:5px solid black"></div>
+	</body></html>`, 200)
+
+	if len(pages) != 3 {
+		t.Fatalf("expected 3 pages, got %d", len(pages))
+	}
+	first, last := findOnPage(pages[0], "tall"), findOnPage(pages[2], "tall")
+	if first == nil || last == nil {
+		t.Fatal("tall box should be on every page")
+	}
+	if first.Height != 200 || first.Border.Bottom != 0 || first.Border.Top != 5 {
+		t.Errorf("first slice: height %.1f, borders %.0f/%.0f", first.Height, first.Border.Top, first.Border.Bottom)
+	}
+	if last.Y != 0 || last.Height != 110 || last.Border.Top != 0 || last.Border.Bottom != 5 {
+		t.Errorf("last slice: y %.1f, height %.1f, borders %.0f/%.0f", last.Y, last.Height, last.Border.Top, last.Border.Bottom)
+	}
+}
+
+func TestLayoutPaged_PrintMedia(t *testing.T) {
+	pages := layoutPages(t, `<html><head><style>
+		@media print { #screen { display: none } }
+	</style></head><body><p id="screen">Screen only</p><p id="both">Both</p></body></html>`, 400)
+
+	if findOnPage(pages[0], "screen") != nil {
+		t.Error("@media print rules should apply to paged layout")
+	}
+	if findOnPage(pages[0], "both") == nil {
+		t.Error("expected the other paragraph on the page")
+	}
+}
+
+func TestLayoutPaged_Limits(t *testing.T) {
+	doc, err := html.Parse(`<div style="height: 3000000px"></div>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	le := NewLayoutEngine(400, 300)
+	if _, err := le.LayoutPaged(context.Background(), doc, 400, 300); !errors.Is(err, ErrTooManyPages) {
+		t.Errorf("expected ErrTooManyPages for 10000 pages, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := le.LayoutPaged(ctx, doc, 400, 300); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the context's error once canceled, got %v", err)
+	}
+}
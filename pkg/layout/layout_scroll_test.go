@@ -0,0 +1,93 @@
+package layout
+
+import (
+	"testing"
+
+	"louis14/pkg/html"
+)
+
+const scrollTestHTML = `<html><body style="margin:0">
+	<div id="box" style="height:100px;border:5px solid black;padding:10px;overflow:auto"><div id="content" style="height:300px"></div></div>
+	<div id="gutter" style="width:200px;height:50px;overflow:scroll"><div id="filler"></div></div>
+</body></html>`
+
+func TestScrollContainer_ScrollOffset(t *testing.T) {
+	doc, err := html.Parse(scrollTestHTML)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	le := NewLayoutEngine(400, 600)
+	le.SetIncremental(true)
+	boxes := layoutDoc(t, le, doc)
+	box := findOnPage(boxes, "box")
+	if box == nil {
+		t.Fatal("expected the scroll container")
+	}
+	// The padding box is 120px tall; the content and its padding are 320px
+	if box.ScrollHeight != 320 || box.MaxScrollTop() != 200 {
+		t.Fatalf("expected scroll height 320 and range 200, got %.1f and %.1f", box.ScrollHeight, box.MaxScrollTop())
+	}
+	top := findOnPage(boxes, "content").Y
+
+	le.SetScrollOffset(box.Node, 50)
+	boxes = layoutDoc(t, le, doc)
+	if box, content := findOnPage(boxes, "box"), findOnPage(boxes, "content"); box.ScrollTop != 50 || content.Y != top-50 {
+		t.Errorf("expected the content scrolled to %.1f, got %.1f (offset %.1f)", top-50, content.Y, box.ScrollTop)
+	}
+
+	// Offsets beyond the content are clamped when applied
+	le.SetScrollOffset(box.Node, 1000)
+	boxes = layoutDoc(t, le, doc)
+	if box, content := findOnPage(boxes, "box"), findOnPage(boxes, "content"); box.ScrollTop != 200 || content.Y != top-200 {
+		t.Errorf("expected the content scrolled to %.1f, got %.1f (offset %.1f)", top-200, content.Y, box.ScrollTop)
+	}
+}
+
+func TestScrollContainer_HitTesting(t *testing.T) {
+	doc, err := html.Parse(scrollTestHTML)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	le := NewLayoutEngine(400, 600)
+	boxes := layoutDoc(t, le, doc)
+	box := findOnPage(boxes, "box")
+	le.SetScrollOffset(box.Node, 100)
+	boxes = layoutDoc(t, le, doc)
+	box = findOnPage(boxes, "box")
+
+	// Content scrolled above the container can't be hit
+	if NodeAt(boxes, 50, box.Y-10) == findOnPage(boxes, "content").Node {
+		t.Error("expected content scrolled out of view not to be hit")
+	}
+	if node := NodeAt(boxes, 50, box.Y+50); node != findOnPage(boxes, "content").Node {
+		t.Errorf("expected the content under the point, got %v", node)
+	}
+	if containers := ScrollContainersAt(boxes, 50, box.Y+50); len(containers) != 1 || containers[0] != box {
+		t.Errorf("expected the scroll container under the point, got %d containers", len(containers))
+	}
+	if containers := ScrollContainersAt(boxes, 300, box.Y+50); len(containers) != 1 {
+		t.Errorf("expected the scroll container beside its content, got %d containers", len(containers))
+	}
+	if containers := ScrollContainersAt(boxes, 50, box.Y+box.Height+200); len(containers) != 0 {
+		t.Errorf("expected no scroll container below the boxes, got %d", len(containers))
+	}
+}
+
+func TestScrollContainer_ScrollReservesGutter(t *testing.T) {
+	doc, err := html.Parse(scrollTestHTML)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 600), doc)
+	filler := findOnPage(boxes, "filler")
+	if filler == nil {
+		t.Fatal("expected the filler")
+	}
+	if filler.Width != 200-ScrollbarWidth {
+		t.Errorf("expected the content %.0fpx wide beside the scrollbar, got %.1f", 200-ScrollbarWidth, filler.Width)
+	}
+	// overflow: auto content uses the full width
+	if content := findOnPage(boxes, "content"); content.Width != 400-30 {
+		t.Errorf("expected the overflow: auto content 370px wide, got %.1f", content.Width)
+	}
+}
@@ -1,75 +1,26 @@
 package layout
 
 import (
+	"sort"
+
 	"louis14/pkg/css"
 	"louis14/pkg/html"
-	"louis14/pkg/text"
 )
 
-func (le *LayoutEngine) buildTableInfo(tableBox *Box, computedStyles map[*html.Node]*css.Style) *TableInfo {
+// buildTableInfo starts the layout information of a table: its border and
+// layout settings, its columns, and its captions.
+func (le *LayoutEngine) buildTableInfo(tableBox *Box, box *BoxTreeNode) *TableInfo {
 	tableInfo := &TableInfo{
-		Rows:           make([]*TableRow, 0),
 		BorderSpacing:  tableBox.Style.GetBorderSpacing(),
 		BorderCollapse: tableBox.Style.GetBorderCollapse(),
+		TableLayout:    tableBox.Style.GetTableLayout(),
+		Columns:        buildTableColumns(box),
 	}
 
-	// Scan children for rows (tr elements or display: table-row)
-	// Also handle anonymous row generation for direct table-cell children
-	var anonRow *TableRow
-	for _, child := range tableBox.Node.Children {
-		if child.Type != html.ElementNode {
-			continue
-		}
-
-		childStyle := computedStyles[child]
-		if childStyle == nil {
-			childStyle = css.NewStyle()
-		}
-
-		childDisplay := childStyle.GetDisplay()
-
-		// Check if this is a row (tr tag or display: table-row)
-		isRow := child.TagName == "tr" || childDisplay == css.DisplayTableRow
-
-		// Also check for tbody, thead, tfoot which contain rows
-		isRowGroup := child.TagName == "tbody" || child.TagName == "thead" || child.TagName == "tfoot" ||
-			childDisplay == css.DisplayTableRowGroup ||
-			childDisplay == css.DisplayTableHeaderGroup ||
-			childDisplay == css.DisplayTableFooterGroup
-
-		// Check if this is a table-cell (or will be wrapped as one)
-		isCell := child.TagName == "td" || child.TagName == "th" || childDisplay == css.DisplayTableCell
-
-		if isRow {
-			anonRow = nil // explicit row breaks anonymous row
-			tableInfo.Rows = append(tableInfo.Rows, &TableRow{Cells: make([]*TableCell, 0)})
-		} else if isRowGroup {
-			anonRow = nil
-			// Process rows within the group
-			for _, groupChild := range child.Children {
-				if groupChild.Type != html.ElementNode {
-					continue
-				}
-				groupChildStyle := computedStyles[groupChild]
-				if groupChildStyle == nil {
-					groupChildStyle = css.NewStyle()
-				}
-				if groupChild.TagName == "tr" || groupChildStyle.GetDisplay() == css.DisplayTableRow {
-					tableInfo.Rows = append(tableInfo.Rows, &TableRow{Cells: make([]*TableCell, 0)})
-				}
-			}
-		} else if isCell {
-			// CSS 2.1 §17.2.1: Generate anonymous table-row for consecutive table-cells
-			if anonRow == nil {
-				anonRow = &TableRow{Cells: make([]*TableCell, 0)}
-				tableInfo.Rows = append(tableInfo.Rows, anonRow)
-			}
-		} else {
-			// Non-table child: wrap in anonymous cell within the anonymous row
-			if anonRow == nil {
-				anonRow = &TableRow{Cells: make([]*TableCell, 0)}
-				tableInfo.Rows = append(tableInfo.Rows, anonRow)
-			}
+	// CSS 2.1 §17.4: Captions are laid out outside the grid
+	for _, child := range box.Children {
+		if child.Kind == BoxTableCaption {
+			tableInfo.Captions = append(tableInfo.Captions, child.source)
 		}
 	}
 
@@ -80,30 +31,25 @@ func (le *LayoutEngine) buildTableInfo(tableBox *Box, computedStyles map[*html.N
 
 // Phase 9: getRowspan returns the rowspan attribute value (default 1)
 
-// Phase 9: layoutTable performs table layout
-func (le *LayoutEngine) layoutTable(tableBox *Box, x, y, availableWidth float64, computedStyles map[*html.Node]*css.Style) {
-	tableInfo := le.buildTableInfo(tableBox, computedStyles)
+// Phase 9: layoutTable performs table layout. The box tree has given the
+// table the rows and cells its structure is missing (CSS 2.1 §17.2.1).
+func (le *LayoutEngine) layoutTable(tableBox *Box, box *BoxTreeNode, availableWidth float64, computedStyles map[*html.Node]*css.Style) {
+	tableInfo := le.buildTableInfo(tableBox, box)
+	x, y := tableBox.X, tableBox.Y
+	le.tracef(TraceTable, TraceInfo, "%s at (%.1f, %.1f) in %.1f, border-collapse=%v",
+		getNodeName(tableBox.Node), x, y, availableWidth, tableInfo.BorderCollapse)
 
 	// Build cell grid accounting for rowspan/colspan
 	rowIdx := 0
 	cellGrid := make([][]*TableCell, 0)
 
 	// Process table structure
-	for _, child := range tableBox.Node.Children {
-		if child.Type != html.ElementNode {
-			continue
-		}
-
-		childStyle := computedStyles[child]
-		if childStyle == nil {
-			childStyle = css.NewStyle()
-		}
-
-		le.processTableRows(child, childStyle, computedStyles, &rowIdx, &cellGrid, tableInfo)
+	for _, child := range box.Children {
+		le.processTableRows(child, computedStyles, &rowIdx, &cellGrid, tableInfo)
 	}
 
 	// Determine number of columns
-	numCols := 0
+	numCols := len(tableInfo.Columns)
 	for _, row := range cellGrid {
 		if len(row) > numCols {
 			numCols = len(row)
@@ -111,13 +57,23 @@ func (le *LayoutEngine) layoutTable(tableBox *Box, x, y, availableWidth float64,
 	}
 	tableInfo.NumCols = numCols
 
+	// CSS 2.1 §17.6.2: Adjacent cells share one border in the collapsing model
+	if tableInfo.BorderCollapse == css.BorderCollapseCollapse {
+		le.collapseTableBorders(tableBox, cellGrid, tableInfo)
+	}
+
 	// Calculate column widths
 	// Pass 0 for tableWidth when the table has no explicit width (shrink-to-fit)
 	explicitTableWidth := 0.0
 	if w, ok := tableBox.Style.GetLength("width"); ok {
 		explicitTableWidth = w
 	}
-	tableInfo.ColumnWidths = le.calculateColumnWidths(cellGrid, availableWidth, tableInfo, explicitTableWidth)
+	// CSS 2.1 §17.5.2.1: The fixed algorithm applies only to tables with a width
+	if tableInfo.TableLayout == css.TableLayoutFixed && explicitTableWidth > 0 {
+		tableInfo.ColumnWidths = le.calculateFixedColumnWidths(cellGrid, tableInfo, explicitTableWidth)
+	} else {
+		tableInfo.ColumnWidths = le.calculateColumnWidths(cellGrid, availableWidth, tableInfo, explicitTableWidth, computedStyles)
+	}
 
 	// Set table width from column widths if not explicitly set
 	// Check the style for an explicit width, not tableBox.Width which includes borders
@@ -137,6 +93,9 @@ func (le *LayoutEngine) layoutTable(tableBox *Box, x, y, availableWidth float64,
 			tableBox.Padding.Left + tableBox.Padding.Right
 	}
 
+	// Lay out the cells' content at their column widths, for the row heights
+	le.layoutTableCellContents(cellGrid, tableInfo, computedStyles)
+
 	// Calculate row heights
 	tableInfo.RowHeights = le.calculateRowHeights(cellGrid, tableInfo)
 
@@ -157,29 +116,33 @@ func (le *LayoutEngine) layoutTable(tableBox *Box, x, y, availableWidth float64,
 	}
 
 	// Position cells
-	le.positionTableCells(tableBox, cellGrid, tableInfo, x, y)
+	le.positionTableCells(tableBox, cellGrid, tableInfo, x, y, computedStyles)
 }
 
 // Phase 9: processTableRows recursively processes rows and row groups
-func (le *LayoutEngine) processTableRows(node *html.Node, style *css.Style, computedStyles map[*html.Node]*css.Style, rowIdx *int, cellGrid *[][]*TableCell, tableInfo *TableInfo) {
-	display := style.GetDisplay()
-	isRow := node.TagName == "tr" || display == css.DisplayTableRow
-	isRowGroup := node.TagName == "tbody" || node.TagName == "thead" || node.TagName == "tfoot" ||
-		display == css.DisplayTableRowGroup ||
-		display == css.DisplayTableHeaderGroup ||
-		display == css.DisplayTableFooterGroup
-
-	if isRow {
+func (le *LayoutEngine) processTableRows(box *BoxTreeNode, computedStyles map[*html.Node]*css.Style, rowIdx *int, cellGrid *[][]*TableCell, tableInfo *TableInfo) {
+	switch box.Kind {
+	case BoxTableRowGroup:
+		// Process rows within the group
+		for _, child := range box.Children {
+			le.processTableRows(child, computedStyles, rowIdx, cellGrid, tableInfo)
+		}
+	case BoxTableRow:
 		// Ensure we have enough rows in the grid
 		for len(*cellGrid) <= *rowIdx {
 			*cellGrid = append(*cellGrid, make([]*TableCell, 0))
 		}
+		for len(tableInfo.RowStyles) <= *rowIdx {
+			tableInfo.RowStyles = append(tableInfo.RowStyles, nil)
+		}
+		if !box.Anonymous() {
+			tableInfo.RowStyles[*rowIdx] = le.nodeStyle(box.source, computedStyles)
+		}
 
 		colIdx := 0
 
 		// Check for ::before pseudo-element with display: table-cell
-		beforeStyle := css.ComputePseudoElementStyle(node, "before", le.stylesheets, le.viewport.width, le.viewport.height, style)
-		if beforeStyle != nil && beforeStyle.GetDisplay() == css.DisplayTableCell {
+		if beforeStyle := le.rowPseudoCellStyle(box, "before"); beforeStyle != nil {
 			content, _ := beforeStyle.Get("content")
 			if content != "" && content != "none" {
 				// Strip quotes from content
@@ -203,22 +166,10 @@ func (le *LayoutEngine) processTableRows(node *html.Node, style *css.Style, comp
 			}
 		}
 
-		for _, cellNode := range node.Children {
-			if cellNode.Type != html.ElementNode {
-				continue
-			}
-
-			cellStyle := computedStyles[cellNode]
-			if cellStyle == nil {
-				cellStyle = css.NewStyle()
-			}
-
-			isCell := cellNode.TagName == "td" || cellNode.TagName == "th" ||
-				cellStyle.GetDisplay() == css.DisplayTableCell
-
-			if !isCell {
-				continue
-			}
+		// A row holds only cells, anonymous ones wrapping anything else
+		for _, child := range box.Children {
+			cellNode := child.source
+			cellStyle := le.nodeStyle(cellNode, computedStyles)
 
 			// Skip columns occupied by rowspan from previous rows
 			for colIdx < len((*cellGrid)[*rowIdx]) && (*cellGrid)[*rowIdx][colIdx] != nil {
@@ -229,7 +180,7 @@ func (le *LayoutEngine) processTableRows(node *html.Node, style *css.Style, comp
 			rowspan := getRowspan(cellNode)
 
 			cell := &TableCell{
-				Box:     &Box{Node: cellNode, Style: cellStyle},
+				Box:     &Box{Node: cellNode, Style: cellStyle, Position: cellStyle.GetPosition()},
 				RowSpan: rowspan,
 				ColSpan: colspan,
 				RowIdx:  *rowIdx,
@@ -253,8 +204,7 @@ func (le *LayoutEngine) processTableRows(node *html.Node, style *css.Style, comp
 		}
 
 		// Check for ::after pseudo-element with display: table-cell
-		afterStyle := css.ComputePseudoElementStyle(node, "after", le.stylesheets, le.viewport.width, le.viewport.height, style)
-		if afterStyle != nil && afterStyle.GetDisplay() == css.DisplayTableCell {
+		if afterStyle := le.rowPseudoCellStyle(box, "after"); afterStyle != nil {
 			content, _ := afterStyle.Get("content")
 			if content != "" && content != "none" {
 				// Strip quotes from content
@@ -279,59 +229,25 @@ func (le *LayoutEngine) processTableRows(node *html.Node, style *css.Style, comp
 		}
 
 		*rowIdx++
-	} else if isRowGroup {
-		// Process rows within the group
-		for _, child := range node.Children {
-			if child.Type != html.ElementNode {
-				continue
-			}
-			childStyle := computedStyles[child]
-			if childStyle == nil {
-				childStyle = css.NewStyle()
-			}
-			le.processTableRows(child, childStyle, computedStyles, rowIdx, cellGrid, tableInfo)
-		}
-	} else if display == css.DisplayTableCell || display == css.DisplayTable {
-		// CSS 2.1 §17.2.1: Direct table-cell children generate an anonymous row
-		// Also handle nested display:table elements as anonymous cells
-		for len(*cellGrid) <= *rowIdx {
-			*cellGrid = append(*cellGrid, make([]*TableCell, 0))
-		}
-		colIdx := len((*cellGrid)[*rowIdx])
-		cell := &TableCell{
-			Box:     &Box{Node: node, Style: style},
-			RowSpan: 1,
-			ColSpan: 1,
-			RowIdx:  *rowIdx,
-			ColIdx:  colIdx,
-		}
-		for len((*cellGrid)[*rowIdx]) <= colIdx {
-			(*cellGrid)[*rowIdx] = append((*cellGrid)[*rowIdx], nil)
-		}
-		(*cellGrid)[*rowIdx][colIdx] = cell
-	} else {
-		// Non-table child: wrap in anonymous table-cell within the current anonymous row
-		for len(*cellGrid) <= *rowIdx {
-			*cellGrid = append(*cellGrid, make([]*TableCell, 0))
-		}
-		colIdx := len((*cellGrid)[*rowIdx])
-		cell := &TableCell{
-			Box:     &Box{Node: node, Style: style},
-			RowSpan: 1,
-			ColSpan: 1,
-			RowIdx:  *rowIdx,
-			ColIdx:  colIdx,
-		}
-		for len((*cellGrid)[*rowIdx]) <= colIdx {
-			(*cellGrid)[*rowIdx] = append((*cellGrid)[*rowIdx], nil)
-		}
-		(*cellGrid)[*rowIdx][colIdx] = cell
 	}
 }
 
+// rowPseudoCellStyle returns the style of a row's ::before or ::after
+// pseudo-element if it is a table cell, or nil; anonymous rows have none.
+func (le *LayoutEngine) rowPseudoCellStyle(row *BoxTreeNode, pseudo string) *css.Style {
+	if row.Anonymous() {
+		return nil
+	}
+	style := css.ComputePseudoElementStyle(row.Node, pseudo, le.stylesheets, le.media(), row.Style)
+	if style == nil || style.GetDisplay() != css.DisplayTableCell {
+		return nil
+	}
+	return style
+}
+
 // Phase 9: calculateColumnWidths determines column widths
 // tableWidth is the explicit table width (0 for shrink-to-fit tables)
-func (le *LayoutEngine) calculateColumnWidths(cellGrid [][]*TableCell, availableWidth float64, tableInfo *TableInfo, tableWidth float64) []float64 {
+func (le *LayoutEngine) calculateColumnWidths(cellGrid [][]*TableCell, availableWidth float64, tableInfo *TableInfo, tableWidth float64, computedStyles map[*html.Node]*css.Style) []float64 {
 	numCols := tableInfo.NumCols
 	if numCols == 0 {
 		return []float64{}
@@ -360,7 +276,7 @@ func (le *LayoutEngine) calculateColumnWidths(cellGrid [][]*TableCell, available
 			}
 			// Measure content width for auto-sizing
 			if !hasExplicit[colIdx] {
-				cw := le.measureCellContentWidth(cell)
+				cw := le.measureCellContentWidth(cell, computedStyles)
 				if cw > contentWidths[colIdx] {
 					contentWidths[colIdx] = cw
 				}
@@ -368,6 +284,16 @@ func (le *LayoutEngine) calculateColumnWidths(cellGrid [][]*TableCell, available
 		}
 	}
 
+	// Widths of col and colgroup elements are minimums for their columns
+	for i, col := range tableInfo.Columns {
+		if w, ok := col.width(); ok && i < numCols {
+			if w > columnWidths[i] {
+				columnWidths[i] = w
+			}
+			hasExplicit[i] = true
+		}
+	}
+
 	// Distribute remaining width to columns without explicit widths
 	// Use content-based sizing: give each column its content width,
 	// then distribute any leftover space proportionally.
@@ -428,94 +354,102 @@ func (le *LayoutEngine) calculateColumnWidths(cellGrid [][]*TableCell, available
 	return columnWidths
 }
 
-// measureCellContentWidth measures the preferred content width of a table cell
-func (le *LayoutEngine) measureCellContentWidth(cell *TableCell) float64 {
-	if cell == nil || cell.Box == nil || cell.Box.Node == nil {
+// measureCellContentWidth measures the preferred width of a table cell: the
+// max-content width of its content, with its padding and border
+func (le *LayoutEngine) measureCellContentWidth(cell *TableCell, computedStyles map[*html.Node]*css.Style) float64 {
+	if cell == nil || cell.Box == nil || cell.Box.Node == nil || cell.Box.Style == nil {
 		return 0
 	}
-	totalWidth := 0.0
-	fontSize := 16.0
-	isBold := false
-	if cell.Box.Style != nil {
-		fontSize = cell.Box.Style.GetFontSize()
-		isBold = cell.Box.Style.GetFontWeight() == css.FontWeightBold
-	}
-	for _, child := range cell.Box.Node.Children {
-		if child.Type == html.TextNode {
-			w, _ := text.MeasureTextWithWeight(child.Text, fontSize, isBold)
-			totalWidth += w
-		}
-	}
-	// Add cell padding and border
-	if cell.Box.Style != nil {
-		padding := cell.Box.Style.GetPadding()
-		border := cell.Box.Style.GetBorderWidth()
-		totalWidth += padding.Left + padding.Right + border.Left + border.Right
-	}
-	return totalWidth
+	// The intrinsic size counts the cell's own border, which the collapsing
+	// border model may have changed
+	ownBorder := cell.Box.Style.GetBorderWidth()
+	border := cell.borderWidth()
+	sizes := le.ComputeIntrinsicSizes(cell.Box.Node, cell.Box.Style, computedStyles)
+	return sizes.MaxContent - ownBorder.Left - ownBorder.Right + border.Left + border.Right
 }
 
-// Phase 9: calculateRowHeights determines row heights
+// Phase 9: calculateRowHeights determines row heights from the laid-out
+// cells. Cells aligned on the baseline share their first row's baseline,
+// the lowest of theirs, and a cell spanning rows shares any height it needs
+// beyond them among its rows (CSS 2.1 §17.5.3).
 func (le *LayoutEngine) calculateRowHeights(cellGrid [][]*TableCell, tableInfo *TableInfo) []float64 {
 	numRows := len(cellGrid)
 	rowHeights := make([]float64, numRows)
+	tableInfo.RowBaselines = make([]float64, numRows)
 
-	// Calculate row heights from cell content and explicit heights
-	for i := 0; i < numRows; i++ {
-		maxHeight := 0.0
-		for _, cell := range cellGrid[i] {
-			if cell == nil || cell.Box == nil {
+	borderSpacing := tableInfo.BorderSpacing
+	if tableInfo.BorderCollapse == css.BorderCollapseCollapse {
+		borderSpacing = 0
+	}
+
+	var cells, spanning []*TableCell
+	for i, row := range cellGrid {
+		for colIdx, cell := range row {
+			if cell == nil || cell.Box == nil || cell.RowIdx != i || cell.ColIdx != colIdx {
 				continue
 			}
-			// Check for explicit height from style
-			if cell.Box.Style != nil {
-				if h, ok := cell.Box.Style.GetLength("height"); ok && h > maxHeight {
-					maxHeight = h
-				}
-			}
-			// Get padding and border from style since box values may not be set yet
-			var paddingTop, paddingBottom, borderTop, borderBottom float64
-			if cell.Box.Style != nil {
-				padding := cell.Box.Style.GetPadding()
-				paddingTop = padding.Top
-				paddingBottom = padding.Bottom
-				border := cell.Box.Style.GetBorderWidth()
-				borderTop = border.Top
-				borderBottom = border.Bottom
+			cells = append(cells, cell)
+			if cell.RowSpan > 1 {
+				spanning = append(spanning, cell)
 			}
-			cellHeight := cell.Box.Height + paddingTop + paddingBottom + borderTop + borderBottom
-			if cellHeight > maxHeight {
-				maxHeight = cellHeight
+			if le.cellVerticalAlign(cell, tableInfo) == css.VerticalAlignBaseline {
+				tableInfo.RowBaselines[i] = max(tableInfo.RowBaselines[i], cell.baselineOffset())
 			}
-			// Estimate height from text content if cell hasn't been laid out yet
-			if cell.Box.Height == 0 && cell.Box.Node != nil {
-				lineHeight := 19.2 // default line height for 16px font
-				if cell.Box.Style != nil {
-					lineHeight = cell.Box.Style.GetLineHeight()
-				}
-				for _, child := range cell.Box.Node.Children {
-					if child.Type == html.TextNode && child.Text != "" {
-						textHeight := lineHeight + paddingTop + paddingBottom + borderTop + borderBottom
-						if textHeight > maxHeight {
-							maxHeight = textHeight
-						}
-					}
-				}
+		}
+	}
+
+	// Calculate row heights from cell content and explicit heights
+	for _, cell := range cells {
+		if cell.RowSpan <= 1 {
+			rowHeights[cell.RowIdx] = max(rowHeights[cell.RowIdx], cell.height(le.cellBaselineShift(cell, tableInfo)))
+		}
+	}
+
+	// Narrower spans go first, so that wider ones see the rows they grew
+	sort.SliceStable(spanning, func(a, b int) bool {
+		return spanning[a].RowSpan < spanning[b].RowSpan
+	})
+	for _, cell := range spanning {
+		rows := rowHeights[cell.RowIdx:min(cell.RowIdx+cell.RowSpan, numRows)]
+		total := 0.0
+		for _, h := range rows {
+			total += h
+		}
+		extra := cell.height(le.cellBaselineShift(cell, tableInfo)) - total - borderSpacing*float64(len(rows)-1)
+		if extra <= 0 {
+			continue
+		}
+		// The rows grow in proportion to their heights, or equally if
+		// they have none
+		for r := range rows {
+			if total > 0 {
+				rows[r] += extra * rows[r] / total
+			} else {
+				rows[r] += extra / float64(len(rows))
 			}
 		}
-		rowHeights[i] = maxHeight
 	}
 
 	return rowHeights
 }
 
 // Phase 9: positionTableCells positions cells in the table
-func (le *LayoutEngine) positionTableCells(tableBox *Box, cellGrid [][]*TableCell, tableInfo *TableInfo, x, y float64) {
+func (le *LayoutEngine) positionTableCells(tableBox *Box, cellGrid [][]*TableCell, tableInfo *TableInfo, x, y float64, computedStyles map[*html.Node]*css.Style) {
 	borderSpacing := tableInfo.BorderSpacing
 	if tableInfo.BorderCollapse == css.BorderCollapseCollapse {
 		borderSpacing = 0
 	}
 
+	// Top captions push the table box down, within its margin
+	if h := le.layoutTableCaptions(tableBox, tableInfo, css.CaptionSideTop, x, y, computedStyles); h > 0 {
+		y += h
+		tableBox.Y += h
+		tableBox.Margin.Top += h
+	}
+
+	// Columns and column groups paint their backgrounds behind the cells
+	tableBox.Children = append(tableBox.Children, le.tableColumnBoxes(tableBox, cellGrid, tableInfo, x, y, borderSpacing)...)
+
 	// Position cells
 	currentY := y + tableBox.Border.Top + tableBox.Padding.Top + borderSpacing
 	processedCells := make(map[*TableCell]bool)
@@ -559,9 +493,6 @@ func (le *LayoutEngine) positionTableCells(tableBox *Box, cellGrid [][]*TableCel
 			// Set cell box dimensions and position
 			// Note: cellWidth/cellHeight from row/column calculations include padding+border,
 			// but box.Width/Height should be content dimensions only
-			cell.Box.Margin = cell.Box.Style.GetMargin()
-			cell.Box.Padding = cell.Box.Style.GetPadding()
-			cell.Box.Border = cell.Box.Style.GetBorderWidth()
 			cell.Box.X = currentX
 			cell.Box.Y = currentY
 			// box.Width/Height should be border-box dimensions (for rendering)
@@ -574,40 +505,37 @@ func (le *LayoutEngine) positionTableCells(tableBox *Box, cellGrid [][]*TableCel
 				cell.Box.Height = 0
 			}
 
-			// Layout cell content (children)
-			childY := currentY + cell.Box.Border.Top + cell.Box.Padding.Top
+			// Move the cell's content, laid out at the origin, into place,
+			// aligned within the row height
+			contentHeight := cellHeight - cell.Box.Border.Top - cell.Box.Border.Bottom -
+				cell.Box.Padding.Top - cell.Box.Padding.Bottom
 			childX := currentX + cell.Box.Border.Left + cell.Box.Padding.Left
-			childAvailableWidth := cellWidth - cell.Box.Padding.Left - cell.Box.Padding.Right
-
-			// Handle pseudo-element cells (have content but no DOM node)
-			if cell.Box.Node == nil && cell.Box.PseudoContent != "" {
-				// Measure and create text box for pseudo-content
-				fontSize := cell.Box.Style.GetFontSize()
-				fontWeight := cell.Box.Style.GetFontWeight()
-				bold := fontWeight == css.FontWeightBold
-				textWidth, textHeight := text.MeasureTextWithWeight(cell.Box.PseudoContent, fontSize, bold)
-				textBox := &Box{
-					Style:         cell.Box.Style,
-					X:             childX,
-					Y:             childY,
-					Width:         textWidth,
-					Height:        textHeight,
-					Parent:        cell.Box,
-					PseudoContent: cell.Box.PseudoContent,
-				}
-				cell.Box.Children = append(cell.Box.Children, textBox)
-			} else if cell.Box.Node != nil {
-				for _, childNode := range cell.Box.Node.Children {
-					if childNode.Type == html.TextNode {
-						// Handle text in cell
-						textBox := le.layoutTextNode(childNode, childX, childY, childAvailableWidth, cell.Box.Style, cell.Box)
-						if textBox != nil {
-							cell.Box.Children = append(cell.Box.Children, textBox)
-							childY += le.getTotalHeight(textBox)
-						}
+			childY := currentY + cell.Box.Border.Top + cell.Box.Padding.Top
+			alignShift := 0.0
+			if align := le.cellVerticalAlign(cell, tableInfo); align == css.VerticalAlignBaseline {
+				alignShift = le.cellBaselineShift(cell, tableInfo)
+			} else {
+				alignShift = cellContentOffset(align, contentHeight-cell.ContentHeight)
+			}
+			childY += alignShift
+			for _, child := range cell.Box.Children {
+				translateBox(child, childX, childY)
+			}
+			// The absolutely positioned boxes the cell contains are placed in
+			// its padding box, so they don't move with the aligned content
+			if alignShift != 0 && cell.Box.Position != css.PositionStatic {
+				for _, abs := range le.absoluteBoxes {
+					if abs.FindContainingBlock() == cell.Box {
+						translateBox(abs, 0, -alignShift)
 					}
 				}
 			}
+			for _, lb := range cell.Box.LineBoxes {
+				lb.Y += childY
+				lb.LeftEdge += childX
+				lb.RightEdge += childX
+			}
+			applyRelativeOffset(cell.Box)
 
 			// Add cell box to table's children
 			tableBox.Children = append(tableBox.Children, cell.Box)
@@ -623,5 +551,28 @@ func (le *LayoutEngine) positionTableCells(tableBox *Box, cellGrid [][]*TableCel
 	if len(cellGrid) > 0 {
 		tableBox.Height = currentY - y + tableBox.Border.Bottom + tableBox.Padding.Bottom
 	}
+
+	// Bottom captions follow the table box, within its margin
+	tableBox.Margin.Bottom += le.layoutTableCaptions(tableBox, tableInfo, css.CaptionSideBottom, x, y+tableBox.Height, computedStyles)
+}
+
+// layoutTableCaptions lays out the table's captions on one side, stacked
+// from y and as wide as the table box (CSS 2.1 §17.4), returning the height
+// they take up.
+func (le *LayoutEngine) layoutTableCaptions(tableBox *Box, tableInfo *TableInfo, side css.CaptionSide, x, y float64, computedStyles map[*html.Node]*css.Style) float64 {
+	start := y
+	for _, caption := range tableInfo.Captions {
+		style := computedStyles[caption]
+		if style == nil || style.GetCaptionSide() != side {
+			continue
+		}
+		captionBox := le.layoutNode(caption, x, y, tableBox.Width, computedStyles, tableBox)
+		if captionBox == nil {
+			continue
+		}
+		tableBox.Children = append(tableBox.Children, captionBox)
+		y = captionBox.Y + captionBox.Height + captionBox.Margin.Bottom
+	}
+	return y - start
 }
 
@@ -0,0 +1,188 @@
+package layout
+
+import (
+	"strconv"
+	"strings"
+
+	"louis14/pkg/css"
+	"louis14/pkg/html"
+)
+
+// layoutTableCellContents lays out the content of each cell with the block
+// layout algorithm, at the width of its columns, before the rows are sized.
+// The content is laid out at the origin, for positionTableCells to move
+// into place, and the cell's ContentHeight and Baseline set from it.
+func (le *LayoutEngine) layoutTableCellContents(cellGrid [][]*TableCell, tableInfo *TableInfo, computedStyles map[*html.Node]*css.Style) {
+	borderSpacing := tableInfo.BorderSpacing
+	if tableInfo.BorderCollapse == css.BorderCollapseCollapse {
+		borderSpacing = 0
+	}
+	for r, row := range cellGrid {
+		for c, cell := range row {
+			if cell == nil || cell.Box == nil || cell.RowIdx != r || cell.ColIdx != c {
+				continue
+			}
+			cell.Box.Margin = cell.Box.Style.GetMargin()
+			cell.Box.Padding = cell.Box.Style.GetPadding()
+			cell.Box.Border = cell.borderWidth()
+			// The content is laid out at the origin, so put the cell where
+			// its content box starts there, for the absolutely positioned
+			// boxes it contains to find its padding box
+			cell.Box.X = -cell.Box.Border.Left - cell.Box.Padding.Left
+			cell.Box.Y = -cell.Box.Border.Top - cell.Box.Padding.Top
+
+			cellWidth := 0.0
+			for i := c; i < c+cell.ColSpan && i < tableInfo.NumCols; i++ {
+				cellWidth += tableInfo.ColumnWidths[i]
+				if i > c {
+					cellWidth += borderSpacing
+				}
+			}
+			contentWidth := max(cellWidth-cell.Box.Padding.Left-cell.Box.Padding.Right-
+				cell.Box.Border.Left-cell.Box.Border.Right, 0)
+
+			if cell.Box.Node == nil && cell.Box.PseudoContent != "" {
+				// Pseudo-element cells hold a single run of text
+				textWidth, textHeight := measureStyledText(cell.Box.PseudoContent, cell.Box.Style)
+				cell.Box.Children = append(cell.Box.Children, &Box{
+					Style:         cell.Box.Style,
+					Width:         textWidth,
+					Height:        textHeight,
+					Parent:        cell.Box,
+					PseudoContent: cell.Box.PseudoContent,
+				})
+				cell.ContentHeight = textHeight
+				cell.Baseline = styleFontMetrics(cell.Box.Style).Ascent
+			} else if cell.Box.Node != nil {
+				cell.ContentHeight = le.layoutCellContent(cell, contentWidth, computedStyles)
+				// Without a line box, the baseline is the bottom of the content
+				cell.Baseline = cell.ContentHeight
+				if baseline, ok := firstLineBaseline(cell.Box); ok {
+					cell.Baseline = baseline
+				}
+			}
+		}
+	}
+}
+
+// layoutCellContent lays out a cell's children as the content of a block
+// of the given width at the origin, adding their boxes to the cell, and
+// returns the content height. The block is laid out in place of the cell's
+// element, with the cell's style but not its own box, so its text, lines,
+// floats, and pseudo-elements behave as in any block container.
+func (le *LayoutEngine) layoutCellContent(cell *TableCell, width float64, computedStyles map[*html.Node]*css.Style) float64 {
+	node := cell.Box.Node
+	cellStyle := computedStyles[node]
+	computedStyles[node] = cellContentStyle(cell.Box.Style, width)
+	defer func() {
+		if cellStyle != nil {
+			computedStyles[node] = cellStyle
+		} else {
+			delete(computedStyles, node)
+		}
+	}()
+
+	block := le.layoutNodeUncached(node, 0, 0, width, computedStyles, cell.Box)
+	if block == nil {
+		return 0
+	}
+	for _, child := range block.Children {
+		child.Parent = cell.Box
+	}
+	cell.Box.Children = append(cell.Box.Children, block.Children...)
+	cell.Box.LineBoxes = block.LineBoxes
+	// The block has no margins of its own, so any bottom margin is its last
+	// child's, which stays inside the cell rather than collapsing through
+	return block.Height + max(block.Margin.Bottom, 0)
+}
+
+// cellContentStyle returns the style a cell's content is laid out with:
+// the cell's style as a block of the given width, without the margins,
+// borders, padding, sizes, and positioning of the cell's own box. The
+// block hides overflow, so that it contains its floats, as cells do.
+func cellContentStyle(style *css.Style, width float64) *css.Style {
+	block := css.NewStyle()
+	block.ViewportWidth, block.ViewportHeight, block.RootFontSize = style.ViewportWidth, style.ViewportHeight, style.RootFontSize
+	block.Fonts = style.Fonts
+	for property, value := range style.Properties {
+		if strings.HasPrefix(property, "margin") || strings.HasPrefix(property, "padding") ||
+			strings.HasPrefix(property, "border") || cellBoxProperties[property] {
+			continue
+		}
+		block.Properties[property] = value
+	}
+	block.Set("display", "block")
+	block.Set("width", strconv.FormatFloat(width, 'f', -1, 64)+"px")
+	block.Set("overflow", "hidden")
+	return block
+}
+
+// cellBoxProperties are the properties, besides margins, borders, and
+// padding, of the cell's own box, which its content doesn't take on.
+var cellBoxProperties = map[string]bool{
+	"display": true, "width": true, "height": true,
+	"min-width": true, "max-width": true, "min-height": true, "max-height": true,
+	"position": true, "top": true, "right": true, "bottom": true, "left": true,
+	"float": true, "clear": true, "overflow": true, "overflow-x": true, "overflow-y": true,
+}
+
+// height returns the height the cell needs: its content, moved down by
+// shift, padding, and borders, or its specified height if that's more.
+func (c *TableCell) height(shift float64) float64 {
+	h := shift + c.ContentHeight + c.Box.Padding.Top + c.Box.Padding.Bottom + c.Box.Border.Top + c.Box.Border.Bottom
+	if c.Box.Style != nil {
+		if specified, ok := c.Box.Style.GetLength("height"); ok && specified > h {
+			h = specified
+		}
+	}
+	return h
+}
+
+// baselineOffset returns the distance from the top of the cell to the
+// baseline of its content.
+func (c *TableCell) baselineOffset() float64 {
+	return c.Box.Border.Top + c.Box.Padding.Top + c.Baseline
+}
+
+// cellBaselineShift returns how far down a cell aligned on the baseline
+// moves its content to put its baseline on its first row's, or 0 for other
+// cells.
+func (le *LayoutEngine) cellBaselineShift(cell *TableCell, tableInfo *TableInfo) float64 {
+	if le.cellVerticalAlign(cell, tableInfo) != css.VerticalAlignBaseline || cell.RowIdx >= len(tableInfo.RowBaselines) {
+		return 0
+	}
+	return max(tableInfo.RowBaselines[cell.RowIdx]-cell.baselineOffset(), 0)
+}
+
+// cellVerticalAlign returns the vertical alignment of a cell's content. As
+// in the HTML user agent style sheet, a cell without vertical-align takes
+// its row's, and rows are middle-aligned.
+func (le *LayoutEngine) cellVerticalAlign(cell *TableCell, tableInfo *TableInfo) css.VerticalAlign {
+	if _, ok := cell.Box.Style.Get("vertical-align"); ok {
+		return cell.Box.Style.GetVerticalAlign()
+	}
+	if cell.RowIdx < len(tableInfo.RowStyles) {
+		if rowStyle := tableInfo.RowStyles[cell.RowIdx]; rowStyle != nil {
+			if _, ok := rowStyle.Get("vertical-align"); ok {
+				return rowStyle.GetVerticalAlign()
+			}
+		}
+	}
+	return css.VerticalAlignMiddle
+}
+
+// cellContentOffset returns how far down a cell's content goes for top,
+// middle, or bottom alignment, given the space left below it (CSS 2.1
+// §17.5.3). Baseline alignment is resolved by cellBaselineShift.
+func cellContentOffset(align css.VerticalAlign, free float64) float64 {
+	if free <= 0 {
+		return 0
+	}
+	switch align {
+	case css.VerticalAlignMiddle:
+		return free / 2
+	case css.VerticalAlignBottom:
+		return free
+	}
+	return 0
+}
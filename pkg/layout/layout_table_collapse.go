@@ -0,0 +1,257 @@
+package layout
+
+import "louis14/pkg/css"
+
+// CollapsedBorder holds the borders of a table or cell in the collapsing
+// border model, after conflicts between adjacent cells, rows, and the table
+// are resolved (CSS 2.1 §17.6.2).
+type CollapsedBorder struct {
+	Top, Right, Bottom, Left CollapsedBorderEdge
+}
+
+// CollapsedBorderEdge is one side of a collapsed border. It is centered on
+// the grid line between cells and painted once, by the cell whose Paint is
+// set; the table itself paints none of its sides.
+type CollapsedBorderEdge struct {
+	Width  float64
+	Style  css.BorderStyle
+	Source *css.Style // The style the border comes from, for its color
+	Side   string     // The side of Source it comes from: "top", "right", "bottom", or "left"
+	Paint  bool
+}
+
+// halfWidths returns half of each side's width: the part of the border
+// inside the box.
+func (b *CollapsedBorder) halfWidths() css.BoxEdge {
+	return css.BoxEdge{Top: b.Top.Width / 2, Right: b.Right.Width / 2, Bottom: b.Bottom.Width / 2, Left: b.Left.Width / 2}
+}
+
+// borderWidth returns the cell's border widths: half its collapsed borders
+// in the collapsing border model, else those of its style.
+func (c *TableCell) borderWidth() css.BoxEdge {
+	if c.Box.CollapsedBorder != nil {
+		return c.Box.CollapsedBorder.halfWidths()
+	}
+	return c.Box.Style.GetBorderWidth()
+}
+
+// borderOrigin ranks the element a border comes from, for ties between
+// borders of the same width and style.
+type borderOrigin int
+
+const (
+	originTable borderOrigin = iota
+	originRow
+	originCell
+)
+
+// borderCandidate is a border competing for a segment of a grid line.
+type borderCandidate struct {
+	edge   CollapsedBorderEdge
+	origin borderOrigin
+}
+
+// borderStylePriority ranks the visible border styles, higher winning.
+var borderStylePriority = map[css.BorderStyle]int{
+	css.BorderStyleInset:  1,
+	css.BorderStyleGroove: 2,
+	css.BorderStyleOutset: 3,
+	css.BorderStyleRidge:  4,
+	css.BorderStyleDotted: 5,
+	css.BorderStyleDashed: 6,
+	css.BorderStyleSolid:  7,
+	css.BorderStyleDouble: 8,
+}
+
+// beats reports whether c wins over o: the wider border, then the one of
+// higher style priority, then the one from a cell over a row over the table.
+func (c borderCandidate) beats(o borderCandidate) bool {
+	if c.edge.Width != o.edge.Width {
+		return c.edge.Width > o.edge.Width
+	}
+	if p, q := borderStylePriority[c.edge.Style], borderStylePriority[o.edge.Style]; p != q {
+		return p > q
+	}
+	return c.origin > o.origin
+}
+
+func (c borderCandidate) visible() bool {
+	return c.edge.Width > 0 && !c.edge.Style.IsNone()
+}
+
+// borderCandidateFor returns the border on one side of style, if there is
+// a style.
+func borderCandidateFor(style *css.Style, side string, origin borderOrigin) (borderCandidate, bool) {
+	if style == nil {
+		return borderCandidate{}, false
+	}
+	widths, styles := style.GetBorderWidth(), style.GetBorderStyle()
+	edge := CollapsedBorderEdge{Source: style, Side: side}
+	switch side {
+	case "top":
+		edge.Width, edge.Style = widths.Top, styles.Top
+	case "right":
+		edge.Width, edge.Style = widths.Right, styles.Right
+	case "bottom":
+		edge.Width, edge.Style = widths.Bottom, styles.Bottom
+	default:
+		edge.Width, edge.Style = widths.Left, styles.Left
+	}
+	return borderCandidate{edge: edge, origin: origin}, true
+}
+
+// resolveBorder picks the border of a grid line segment from the borders
+// meeting there, listed from the top or left so that of two cells' equal
+// borders the top or left one wins. A hidden border suppresses the others.
+func resolveBorder(candidates []borderCandidate) borderCandidate {
+	best := borderCandidate{edge: CollapsedBorderEdge{Style: css.BorderStyleNone}}
+	for _, c := range candidates {
+		if c.edge.Style == css.BorderStyleHidden {
+			return borderCandidate{edge: CollapsedBorderEdge{Style: css.BorderStyleHidden}, origin: c.origin}
+		}
+		if c.visible() && (!best.visible() || c.beats(best)) {
+			best = c
+		}
+	}
+	return best
+}
+
+// widestBorder returns the border a box draws along an edge made of several
+// grid line segments, as where a cell spans rows or columns. The edge is
+// hidden only if no segment has a visible border and one is hidden.
+func widestBorder(segments []borderCandidate, paint bool) CollapsedBorderEdge {
+	best := borderCandidate{edge: CollapsedBorderEdge{Style: css.BorderStyleNone}}
+	for _, s := range segments {
+		if s.visible() && (!best.visible() || s.beats(best)) {
+			best = s
+		} else if !best.visible() && s.edge.Style == css.BorderStyleHidden {
+			best = s
+		}
+	}
+	best.edge.Paint = paint && best.visible()
+	return best.edge
+}
+
+// collapseTableBorders resolves the borders of a table in the collapsing
+// border model. Each cell gets the borders shared with its neighbors, with
+// half of each width inside the cell, and paints its top and left borders,
+// plus its bottom and right ones where no cell is below or to the right.
+// The table gets half of its outer borders and no padding.
+func (le *LayoutEngine) collapseTableBorders(tableBox *Box, cellGrid [][]*TableCell, tableInfo *TableInfo) {
+	numRows, numCols := len(cellGrid), tableInfo.NumCols
+	at := func(r, c int) *TableCell {
+		if r < 0 || r >= numRows || c < 0 || c >= len(cellGrid[r]) {
+			return nil
+		}
+		return cellGrid[r][c]
+	}
+	var candidates []borderCandidate
+	add := func(style *css.Style, side string, origin borderOrigin) {
+		if c, ok := borderCandidateFor(style, side, origin); ok {
+			candidates = append(candidates, c)
+		}
+	}
+	addCell := func(cell *TableCell, side string) {
+		if cell != nil && cell.Box != nil {
+			add(cell.Box.Style, side, originCell)
+		}
+	}
+	addRow := func(r int, side string) {
+		if r >= 0 && r < len(tableInfo.RowStyles) {
+			add(tableInfo.RowStyles[r], side, originRow)
+		}
+	}
+
+	// horizontal[r][c] is the segment above row r in column c, and
+	// vertical[r][c] the one left of column c in row r
+	horizontal := make([][]borderCandidate, numRows+1)
+	for r := range horizontal {
+		horizontal[r] = make([]borderCandidate, numCols)
+		for c := 0; c < numCols; c++ {
+			above, below := at(r-1, c), at(r, c)
+			if above != nil && above == below {
+				continue // Inside a cell spanning rows
+			}
+			candidates = candidates[:0]
+			if r == 0 {
+				add(tableBox.Style, "top", originTable)
+			}
+			addCell(above, "bottom")
+			addRow(r-1, "bottom")
+			addCell(below, "top")
+			addRow(r, "top")
+			if r == numRows {
+				add(tableBox.Style, "bottom", originTable)
+			}
+			horizontal[r][c] = resolveBorder(candidates)
+		}
+	}
+	vertical := make([][]borderCandidate, numRows)
+	for r := range vertical {
+		vertical[r] = make([]borderCandidate, numCols+1)
+		for c := 0; c <= numCols; c++ {
+			left, right := at(r, c-1), at(r, c)
+			if left != nil && left == right {
+				continue // Inside a cell spanning columns
+			}
+			candidates = candidates[:0]
+			if c == 0 {
+				add(tableBox.Style, "left", originTable)
+				addRow(r, "left")
+			}
+			addCell(left, "right")
+			addCell(right, "left")
+			if c == numCols {
+				addRow(r, "right")
+				add(tableBox.Style, "right", originTable)
+			}
+			vertical[r][c] = resolveBorder(candidates)
+		}
+	}
+
+	for r, row := range cellGrid {
+		for c, cell := range row {
+			if cell == nil || cell.Box == nil || cell.RowIdx != r || cell.ColIdx != c {
+				continue
+			}
+			bottomRow := min(r+cell.RowSpan, numRows)
+			rightCol := min(c+cell.ColSpan, numCols)
+			var top, bottom, left, right []borderCandidate
+			paintBottom, paintRight := false, false
+			for i := c; i < rightCol; i++ {
+				top = append(top, horizontal[r][i])
+				bottom = append(bottom, horizontal[bottomRow][i])
+				paintBottom = paintBottom || at(bottomRow, i) == nil
+			}
+			for j := r; j < bottomRow; j++ {
+				left = append(left, vertical[j][c])
+				right = append(right, vertical[j][rightCol])
+				paintRight = paintRight || at(j, rightCol) == nil
+			}
+			cell.Box.CollapsedBorder = &CollapsedBorder{
+				Top:    widestBorder(top, true),
+				Right:  widestBorder(right, paintRight),
+				Bottom: widestBorder(bottom, paintBottom),
+				Left:   widestBorder(left, true),
+			}
+			cell.Box.Border = cell.Box.CollapsedBorder.halfWidths()
+		}
+	}
+
+	// The table's border box reaches halfway into its outer borders
+	outer := &CollapsedBorder{
+		Top:    widestBorder(horizontal[0], false),
+		Bottom: widestBorder(horizontal[numRows], false),
+	}
+	if numRows > 0 {
+		outer.Left = widestBorder(vertical[0][:1], false)
+		outer.Right = widestBorder(vertical[0][numCols:], false)
+	}
+	oldWidth := tableBox.Border.Left + tableBox.Border.Right + tableBox.Padding.Left + tableBox.Padding.Right
+	oldHeight := tableBox.Border.Top + tableBox.Border.Bottom + tableBox.Padding.Top + tableBox.Padding.Bottom
+	tableBox.CollapsedBorder = outer
+	tableBox.Border = outer.halfWidths()
+	tableBox.Padding = css.BoxEdge{}
+	tableBox.Width += tableBox.Border.Left + tableBox.Border.Right - oldWidth
+	tableBox.Height += tableBox.Border.Top + tableBox.Border.Bottom - oldHeight
+}
@@ -0,0 +1,183 @@
+package layout
+
+import (
+	"strconv"
+	"strings"
+
+	"louis14/pkg/css"
+	"louis14/pkg/html"
+)
+
+// buildTableColumns returns the columns given by the table's col and
+// colgroup elements, one per spanned column. A colgroup without col
+// children stands for span columns of its own.
+func buildTableColumns(table *BoxTreeNode) []*TableColumn {
+	var columns []*TableColumn
+	for _, child := range table.Children {
+		if child.Kind != BoxTableColumn {
+			continue
+		}
+		if child.Style.GetDisplay() == css.DisplayTableColumnGroup {
+			groupStart := len(columns)
+			for _, col := range child.Children {
+				if col.Kind == BoxTableColumn && col.Style.GetDisplay() == css.DisplayTableColumn {
+					for i := 0; i < getSpan(col.Node); i++ {
+						columns = append(columns, &TableColumn{Node: col.Node, Style: col.Style, Group: child.Node, GroupStyle: child.Style})
+					}
+				}
+			}
+			if len(columns) == groupStart {
+				for i := 0; i < getSpan(child.Node); i++ {
+					columns = append(columns, &TableColumn{Group: child.Node, GroupStyle: child.Style})
+				}
+			}
+		} else {
+			for i := 0; i < getSpan(child.Node); i++ {
+				columns = append(columns, &TableColumn{Node: child.Node, Style: child.Style})
+			}
+		}
+	}
+	return columns
+}
+
+// width returns the column's specified width: that of its col element, or
+// else the one its column group gives each of its columns.
+func (c *TableColumn) width() (float64, bool) {
+	if w, ok := specifiedColumnWidth(c.Node, c.Style); ok {
+		return w, true
+	}
+	return specifiedColumnWidth(c.Group, c.GroupStyle)
+}
+
+// specifiedColumnWidth returns the width of a col or colgroup element from
+// its width property, or else its width attribute in pixels.
+func specifiedColumnWidth(node *html.Node, style *css.Style) (float64, bool) {
+	if node == nil {
+		return 0, false
+	}
+	if style != nil {
+		if w, ok := style.GetLength("width"); ok && w > 0 {
+			return w, true
+		}
+	}
+	if attr, ok := node.GetAttribute("width"); ok {
+		if w, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(attr), "px"), 64); err == nil && w > 0 {
+			return w, true
+		}
+	}
+	return 0, false
+}
+
+// calculateFixedColumnWidths determines column widths with the fixed table
+// layout algorithm (CSS 2.1 §17.5.2.1): from the widths of the columns, else
+// of the cells in the first row, with the remaining width shared equally by
+// the other columns. Cell content does not affect the widths.
+func (le *LayoutEngine) calculateFixedColumnWidths(cellGrid [][]*TableCell, tableInfo *TableInfo, tableWidth float64) []float64 {
+	numCols := tableInfo.NumCols
+	columnWidths := make([]float64, numCols)
+	hasWidth := make([]bool, numCols)
+	for i, col := range tableInfo.Columns {
+		if w, ok := col.width(); ok && i < numCols {
+			columnWidths[i], hasWidth[i] = w, true
+		}
+	}
+	if len(cellGrid) > 0 {
+		for colIdx, cell := range cellGrid[0] {
+			if cell == nil || cell.Box == nil || cell.Box.Style == nil || cell.ColIdx != colIdx {
+				continue
+			}
+			w, ok := cell.Box.Style.GetLength("width")
+			if !ok || w <= 0 {
+				continue
+			}
+			// A spanning cell's width is divided over its columns
+			span := min(cell.ColSpan, numCols-colIdx)
+			for c := colIdx; c < colIdx+span; c++ {
+				if !hasWidth[c] {
+					columnWidths[c], hasWidth[c] = w/float64(span), true
+				}
+			}
+		}
+	}
+
+	remaining := tableWidth
+	if tableInfo.BorderCollapse == css.BorderCollapseSeparate {
+		remaining -= tableInfo.BorderSpacing * float64(numCols+1)
+	}
+	unset := 0
+	for i, w := range columnWidths {
+		if hasWidth[i] {
+			remaining -= w
+		} else {
+			unset++
+		}
+	}
+	if remaining <= 0 || numCols == 0 {
+		return columnWidths
+	}
+	// The remaining width goes to the columns without widths, or, if the
+	// table is wider than all the columns, to every column
+	for i := range columnWidths {
+		if unset == 0 {
+			columnWidths[i] += remaining / float64(numCols)
+		} else if !hasWidth[i] {
+			columnWidths[i] = remaining / float64(unset)
+		}
+	}
+	return columnWidths
+}
+
+// tableColumnBoxes returns boxes painting the backgrounds of the column
+// groups and then the columns, which lie below the rows and cells (CSS 2.1
+// §17.5.1). A background covers the grid slots of its column that hold
+// cells, not the border spacing between them.
+func (le *LayoutEngine) tableColumnBoxes(tableBox *Box, cellGrid [][]*TableCell, tableInfo *TableInfo, x, y, borderSpacing float64) []*Box {
+	if len(tableInfo.Columns) == 0 {
+		return nil
+	}
+	colX := make([]float64, len(tableInfo.ColumnWidths))
+	nextX := x + tableBox.Border.Left + tableBox.Padding.Left + borderSpacing
+	for i, w := range tableInfo.ColumnWidths {
+		colX[i] = nextX
+		nextX += w + borderSpacing
+	}
+	rowY := make([]float64, len(tableInfo.RowHeights))
+	nextY := y + tableBox.Border.Top + tableBox.Padding.Top + borderSpacing
+	for i, h := range tableInfo.RowHeights {
+		rowY[i] = nextY
+		nextY += h + borderSpacing
+	}
+
+	var groups, columns []*Box
+	for c, col := range tableInfo.Columns {
+		if c >= len(colX) {
+			break
+		}
+		for r, row := range cellGrid {
+			if c >= len(row) || row[c] == nil || r >= len(rowY) {
+				continue
+			}
+			slot := func(node *html.Node, style *css.Style) *Box {
+				return &Box{Node: node, Style: style, X: colX[c], Y: rowY[r],
+					Width: tableInfo.ColumnWidths[c], Height: tableInfo.RowHeights[r]}
+			}
+			if col.Group != nil && hasBackground(col.GroupStyle) {
+				groups = append(groups, slot(col.Group, col.GroupStyle))
+			}
+			if col.Node != nil && hasBackground(col.Style) {
+				columns = append(columns, slot(col.Node, col.Style))
+			}
+		}
+	}
+	return append(groups, columns...)
+}
+
+// hasBackground reports whether style sets a background color or image.
+func hasBackground(style *css.Style) bool {
+	if style == nil {
+		return false
+	}
+	_, hasColor := style.Get("background-color")
+	_, hasImage := style.Get("background-image")
+	return hasColor || hasImage
+}
@@ -0,0 +1,277 @@
+package layout
+
+import (
+	"strings"
+	"testing"
+
+	"louis14/pkg/css"
+	"louis14/pkg/html"
+)
+
+func TestLayoutTable_CollapsedBorderConflicts(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0">
+		<table style="border-collapse:collapse;border:6px solid black">
+		<tr><td id="a" style="border:2px solid red">A</td><td id="b" style="border:4px dashed blue">B</td></tr>
+		<tr><td id="c" style="border:4px double green">C</td><td id="d" style="border:4px solid gray;border-left-style:hidden">D</td></tr>
+		</table>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 300), doc)
+	a, b, c, d := findOnPage(boxes, "a"), findOnPage(boxes, "b"), findOnPage(boxes, "c"), findOnPage(boxes, "d")
+	if a == nil || b == nil || c == nil || d == nil {
+		t.Fatal("expected all four cells")
+	}
+	for _, cell := range []*Box{a, b, c, d} {
+		if cell.CollapsedBorder == nil {
+			t.Fatal("expected collapsed borders on the cells")
+		}
+	}
+
+	// The wider table border wins on the outside
+	if top := a.CollapsedBorder.Top; top.Width != 6 || top.Style != css.BorderStyleSolid || !top.Paint {
+		t.Errorf("expected a's top to be the table's 6px solid border, got %+v", top)
+	}
+	// The wider cell border wins between cells, and is painted only once
+	right, left := a.CollapsedBorder.Right, b.CollapsedBorder.Left
+	if left.Width != 4 || left.Style != css.BorderStyleDashed || left.Side != "left" || !left.Paint {
+		t.Errorf("expected b's 4px dashed left border, got %+v", left)
+	}
+	if right.Width != 4 || right.Paint {
+		t.Errorf("expected a to share b's border without painting it, got %+v", right)
+	}
+	// Of equal widths, solid beats dashed
+	if bottom := b.CollapsedBorder.Bottom; bottom.Style != css.BorderStyleSolid || bottom.Side != "top" || bottom.Paint {
+		t.Errorf("expected d's solid border to win over b's dashed one, got %+v", bottom)
+	}
+	if top := c.CollapsedBorder.Top; top.Width != 4 || top.Style != css.BorderStyleDouble {
+		t.Errorf("expected c's wider double border to win over a's, got %+v", top)
+	}
+	// Hidden suppresses the border between c and d
+	if between := d.CollapsedBorder.Left; between.Width != 0 || between.Style != css.BorderStyleHidden {
+		t.Errorf("expected a hidden border between c and d, got %+v", between)
+	}
+
+	// Adjacent cells meet on the grid line, each holding half the border
+	if b.X != a.X+a.Width {
+		t.Errorf("expected b to start where a ends (%.1f), got %.1f", a.X+a.Width, b.X)
+	}
+	if a.Border.Right != 2 || a.Border.Top != 3 {
+		t.Errorf("expected half-width borders inside a, got %+v", a.Border)
+	}
+	if a.X != 3 || a.Y != 3 {
+		t.Errorf("expected a at (3, 3) inside half the table border, got (%.1f, %.1f)", a.X, a.Y)
+	}
+}
+
+func TestLayoutTable_Columns(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0">
+		<table id="t" style="border-spacing:0">
+		<colgroup style="background-color:gray"><col id="c1" style="width:80px;background-color:yellow"><col></colgroup>
+		<col span="2" width="40">
+		<tr><td id="a">A</td><td id="b">B</td><td id="c">C</td><td id="d">D</td></tr>
+		</table>
+		<table style="table-layout:fixed;width:300px;border-spacing:0">
+		<tr><td id="narrow" style="width:50px">narrow</td><td id="wide">a long run of text</td><td id="last">c</td></tr>
+		</table>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 300), doc)
+
+	a, c, d := findOnPage(boxes, "a"), findOnPage(boxes, "c"), findOnPage(boxes, "d")
+	if a == nil || c == nil || d == nil {
+		t.Fatal("expected the cells of the first table")
+	}
+	if a.Width < 80 {
+		t.Errorf("expected the col width to widen the first column to 80, got %.1f", a.Width)
+	}
+	if c.Width != 40 || d.Width != 40 {
+		t.Errorf("expected the spanning col's width attribute on both columns, got %.1f and %.1f", c.Width, d.Width)
+	}
+
+	// Column group and column backgrounds come before the cells
+	table := findOnPage(boxes, "t")
+	var backgrounds []string
+	for _, child := range table.Children {
+		if child.Node != nil && (child.Node.TagName == "col" || child.Node.TagName == "colgroup") {
+			backgrounds = append(backgrounds, child.Node.TagName)
+			if child.Width <= 0 || child.Height <= 0 {
+				t.Errorf("expected a %s background box with a size, got %.1fx%.1f", child.Node.TagName, child.Width, child.Height)
+			}
+		} else if len(backgrounds) == 0 {
+			t.Fatal("expected the column backgrounds before the cells")
+		}
+	}
+	// The group covers its two columns; only the first col has a background
+	if strings.Join(backgrounds, ",") != "colgroup,colgroup,col" {
+		t.Errorf("expected colgroup,colgroup,col backgrounds, got %v", backgrounds)
+	}
+
+	// Fixed layout ignores content: the other columns share what is left
+	narrow, wide, last := findOnPage(boxes, "narrow"), findOnPage(boxes, "wide"), findOnPage(boxes, "last")
+	if narrow == nil || wide == nil || last == nil {
+		t.Fatal("expected the cells of the fixed table")
+	}
+	if narrow.Width != 50 || wide.Width != 125 || last.Width != 125 {
+		t.Errorf("expected fixed widths 50, 125, 125, got %.1f, %.1f, %.1f", narrow.Width, wide.Width, last.Width)
+	}
+}
+
+func TestLayoutTable_Captions(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0">
+		<table id="t" style="border-spacing:0">
+		<caption id="top" style="height:20px">Top</caption>
+		<tr><td id="a" style="width:100px;height:30px">A</td><td style="width:50px">B</td></tr>
+		<caption id="bottom" style="caption-side:bottom;height:10px">Bottom</caption>
+		</table>
+		<div id="after" style="height:5px"></div>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 300), doc)
+	table, top, bottom, a, after := findOnPage(boxes, "t"), findOnPage(boxes, "top"), findOnPage(boxes, "bottom"), findOnPage(boxes, "a"), findOnPage(boxes, "after")
+	if table == nil || top == nil || bottom == nil || a == nil || after == nil {
+		t.Fatal("expected the table, both captions, a cell, and the following block")
+	}
+	if top.Y != 0 || top.Width != table.Width {
+		t.Errorf("expected the top caption at y=0 as wide as the table (%.1f), got y=%.1f width %.1f", table.Width, top.Y, top.Width)
+	}
+	if table.Y != 20 || a.Y != 20 {
+		t.Errorf("expected the table and its first row below the caption at y=20, got %.1f and %.1f", table.Y, a.Y)
+	}
+	if bottom.Y != table.Y+table.Height {
+		t.Errorf("expected the bottom caption right below the table at %.1f, got %.1f", table.Y+table.Height, bottom.Y)
+	}
+	if after.Y != bottom.Y+bottom.Height {
+		t.Errorf("expected the next block after the bottom caption at %.1f, got %.1f", bottom.Y+bottom.Height, after.Y)
+	}
+}
+
+func TestLayoutTable_CellBlockContentAndVerticalAlign(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0">
+		<table style="border-spacing:0">
+		<tr>
+		<td id="a" style="width:100px"><div id="inner" style="height:60px;margin:5px 0">block</div></td>
+		<td id="b" style="width:100px;vertical-align:top"><div id="top" style="height:10px"></div></td>
+		<td id="c" style="width:100px"><div id="middle" style="height:10px"></div></td>
+		<td id="d" style="width:100px;vertical-align:bottom"><div id="bottom" style="height:10px"></div></td>
+		</tr>
+		</table>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(600, 300), doc)
+	a, inner := findOnPage(boxes, "a"), findOnPage(boxes, "inner")
+	top, middle, bottom := findOnPage(boxes, "top"), findOnPage(boxes, "middle"), findOnPage(boxes, "bottom")
+	if a == nil || inner == nil || top == nil || middle == nil || bottom == nil {
+		t.Fatal("expected the cells' block content")
+	}
+
+	// The nested block is laid out inside the cell, its margins included
+	contentTop := a.Y + a.Border.Top + a.Padding.Top
+	if inner.Y != contentTop+5 || inner.X < a.X || inner.X+inner.Width > a.X+a.Width {
+		t.Errorf("expected the div inside the cell at y=%.1f, got (%.1f, %.1f) %.1f wide", contentTop+5, inner.X, inner.Y, inner.Width)
+	}
+	if content := a.Height - a.Border.Top - a.Border.Bottom - a.Padding.Top - a.Padding.Bottom; content != 70 {
+		t.Errorf("expected the row to fit the 70px block content, got %.1f", content)
+	}
+
+	// The short contents sit at the top, middle, and bottom of the row
+	if top.Y != contentTop {
+		t.Errorf("expected top-aligned content at %.1f, got %.1f", contentTop, top.Y)
+	}
+	if middle.Y != contentTop+30 {
+		t.Errorf("expected middle-aligned content at %.1f, got %.1f", contentTop+30, middle.Y)
+	}
+	if bottom.Y != contentTop+60 {
+		t.Errorf("expected bottom-aligned content at %.1f, got %.1f", contentTop+60, bottom.Y)
+	}
+}
+
+func TestLayoutTable_RowSpanAndBaseline(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0">
+		<table style="border-spacing:0">
+		<tr><td id="span" rowspan="2" style="height:120px;padding:0"></td><td id="r1" style="height:20px;padding:0"></td></tr>
+		<tr><td id="r2" style="height:60px;padding:0"></td></tr>
+		</table>
+		<table style="border-spacing:0">
+		<tr><td id="big" style="vertical-align:baseline;font-size:32px;padding:0">Big</td>
+		<td id="small" style="vertical-align:baseline;font-size:12px;padding:4px">small</td></tr>
+		</table>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 400), doc)
+	span, r1, r2 := findOnPage(boxes, "span"), findOnPage(boxes, "r1"), findOnPage(boxes, "r2")
+	if span == nil || r1 == nil || r2 == nil {
+		t.Fatal("expected the cells of the first table")
+	}
+	// The 40px the spanning cell needs beyond its rows is shared 1:3
+	if r1.Height != 30 || r2.Height != 90 || span.Height != 120 {
+		t.Errorf("expected rows of 30 and 90 under a 120px span, got %.1f, %.1f, %.1f", r1.Height, r2.Height, span.Height)
+	}
+	if r2.Y != r1.Y+r1.Height {
+		t.Errorf("expected the second row at %.1f, got %.1f", r1.Y+r1.Height, r2.Y)
+	}
+
+	big, small := findOnPage(boxes, "big"), findOnPage(boxes, "small")
+	if big == nil || small == nil {
+		t.Fatal("expected the cells of the second table")
+	}
+	bigBaseline, ok1 := firstLineBaseline(big)
+	smallBaseline, ok2 := firstLineBaseline(small)
+	if !ok1 || !ok2 {
+		t.Fatal("expected both cells to have a baseline")
+	}
+	if bigBaseline != smallBaseline {
+		t.Errorf("expected the cells' baselines to line up, got %.1f and %.1f", bigBaseline, smallBaseline)
+	}
+	if small.Y+small.Border.Top+small.Padding.Top >= smallBaseline-12 {
+		t.Errorf("expected the small text moved down to the big text's baseline")
+	}
+}
+
+func TestLayoutTable_AnonymousPartsAndRelativeTables(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0">
+		<div id="t" style="display:table;border-spacing:0">
+		<div id="a" style="display:table-cell;width:50px">A</div>
+		<div style="display:table-row"><div id="c" style="display:table-cell;width:80px">C</div><span id="s">loose</span></div>
+		</div>
+		<table id="rel" style="position:relative;left:20px;top:10px;border-spacing:0"><tr><td id="rc" style="padding:0">x</td></tr></table>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 300), doc)
+	table, a, c, s := findOnPage(boxes, "t"), findOnPage(boxes, "a"), findOnPage(boxes, "c"), findOnPage(boxes, "s")
+	if table == nil || a == nil || c == nil || s == nil {
+		t.Fatal("expected the table, its cells, and the loose content")
+	}
+	// The cell outside a row gets an anonymous row of its own
+	if a.Y != table.Y || c.Y != a.Y+a.Height {
+		t.Errorf("expected the cells in two rows at %.1f and %.1f, got %.1f and %.1f", table.Y, table.Y+a.Height, a.Y, c.Y)
+	}
+	// The content of the row that isn't a cell is laid out in an anonymous
+	// cell beside the others, whose box has no node
+	if s.X != c.X+c.Width || s.Y != c.Y {
+		t.Errorf("expected the loose content at (%.1f, %.1f), got (%.1f, %.1f)", c.X+c.Width, c.Y, s.X, s.Y)
+	}
+	if s.Parent == nil || s.Parent.Node != nil {
+		t.Error("expected the loose content in an anonymous cell")
+	}
+
+	// A relatively positioned table moves its cells with it
+	rel, rc := findOnPage(boxes, "rel"), findOnPage(boxes, "rc")
+	if rel == nil || rc == nil {
+		t.Fatal("expected the relatively positioned table and its cell")
+	}
+	if rel.X != 20 || rc.X != rel.X || rc.Y != rel.Y {
+		t.Errorf("expected the table and its cell at (20, %.1f), got (%.1f, %.1f) and (%.1f, %.1f)", rel.Y, rel.X, rel.Y, rc.X, rc.Y)
+	}
+}
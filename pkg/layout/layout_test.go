@@ -1,11 +1,24 @@
 package layout
 
 import (
+	"context"
+	"fmt"
+	"strings"
 	"testing"
 	"louis14/pkg/css"
 	"louis14/pkg/html"
 )
 
+// layoutDoc lays doc out with le, failing the test if layout fails.
+func layoutDoc(t *testing.T, le *LayoutEngine, doc *html.Document) []*Box {
+	t.Helper()
+	boxes, err := le.Layout(context.Background(), doc)
+	if err != nil {
+		t.Fatalf("Layout: %v", err)
+	}
+	return boxes
+}
+
 func TestLayoutEngine_SingleBox(t *testing.T) {
 	doc := html.NewDocument()
 	node := &html.Node{
@@ -18,7 +31,7 @@ func TestLayoutEngine_SingleBox(t *testing.T) {
 	doc.Root.Children = append(doc.Root.Children, node)
 	
 	engine := NewLayoutEngine(800, 600)
-	boxes := engine.Layout(doc)
+	boxes := layoutDoc(t, engine, doc)
 	
 	if len(boxes) != 1 {
 		t.Fatalf("expected 1 box, got %d", len(boxes))
@@ -40,7 +53,7 @@ func TestLayoutEngine_VerticalStacking(t *testing.T) {
 	}
 
 	engine := NewLayoutEngine(800, 600)
-	boxes := engine.Layout(doc)
+	boxes := layoutDoc(t, engine, doc)
 
 	if len(boxes) != 3 {
 		t.Fatalf("expected 3 boxes, got %d", len(boxes))
@@ -59,7 +72,7 @@ func TestLayoutEngine_NestedElements(t *testing.T) {
 	}
 
 	engine := NewLayoutEngine(800, 600)
-	boxes := engine.Layout(doc)
+	boxes := layoutDoc(t, engine, doc)
 
 	if len(boxes) != 1 {
 		t.Fatalf("expected 1 box, got %d", len(boxes))
@@ -87,7 +100,7 @@ func TestLayoutEngine_Padding(t *testing.T) {
 	}
 
 	engine := NewLayoutEngine(800, 600)
-	boxes := engine.Layout(doc)
+	boxes := layoutDoc(t, engine, doc)
 
 	if len(boxes) != 1 {
 		t.Fatalf("expected 1 box, got %d", len(boxes))
@@ -112,7 +125,7 @@ func TestLayoutEngine_Margin(t *testing.T) {
 	}
 
 	engine := NewLayoutEngine(800, 600)
-	boxes := engine.Layout(doc)
+	boxes := layoutDoc(t, engine, doc)
 
 	if len(boxes) != 1 {
 		t.Fatalf("expected 1 box, got %d", len(boxes))
@@ -137,7 +150,7 @@ func TestLayoutEngine_Border(t *testing.T) {
 	}
 
 	engine := NewLayoutEngine(800, 600)
-	boxes := engine.Layout(doc)
+	boxes := layoutDoc(t, engine, doc)
 
 	if len(boxes) != 1 {
 		t.Fatalf("expected 1 box, got %d", len(boxes))
@@ -157,7 +170,7 @@ func TestLayoutEngine_FullBoxModel(t *testing.T) {
 	}
 
 	engine := NewLayoutEngine(800, 600)
-	boxes := engine.Layout(doc)
+	boxes := layoutDoc(t, engine, doc)
 
 	if len(boxes) != 1 {
 		t.Fatalf("expected 1 box, got %d", len(boxes))
@@ -189,7 +202,7 @@ func TestLayoutEngine_NestedWithPadding(t *testing.T) {
 	}
 
 	engine := NewLayoutEngine(800, 600)
-	boxes := engine.Layout(doc)
+	boxes := layoutDoc(t, engine, doc)
 
 	div := boxes[0]
 	if len(div.Children) != 1 {
@@ -218,7 +231,7 @@ func TestMarginCollapsing_AdjacentSiblings_BothPositive(t *testing.T) {
 	}
 
 	engine := NewLayoutEngine(800, 600)
-	boxes := engine.Layout(doc)
+	boxes := layoutDoc(t, engine, doc)
 
 	if len(boxes) != 1 {
 		t.Fatalf("expected 1 box, got %d", len(boxes))
@@ -254,7 +267,7 @@ func TestMarginCollapsing_AdjacentSiblings_BothNegative(t *testing.T) {
 	}
 
 	engine := NewLayoutEngine(800, 600)
-	boxes := engine.Layout(doc)
+	boxes := layoutDoc(t, engine, doc)
 
 	div := boxes[0]
 	if len(div.Children) < 2 {
@@ -284,7 +297,7 @@ func TestMarginCollapsing_AdjacentSiblings_Mixed(t *testing.T) {
 	}
 
 	engine := NewLayoutEngine(800, 600)
-	boxes := engine.Layout(doc)
+	boxes := layoutDoc(t, engine, doc)
 
 	div := boxes[0]
 	if len(div.Children) < 2 {
@@ -314,7 +327,7 @@ func TestMarginCollapsing_EqualMargins(t *testing.T) {
 	}
 
 	engine := NewLayoutEngine(800, 600)
-	boxes := engine.Layout(doc)
+	boxes := layoutDoc(t, engine, doc)
 
 	div := boxes[0]
 	if len(div.Children) < 2 {
@@ -341,7 +354,7 @@ func TestMarginCollapsing_NoCollapseWithPaddingSeparation(t *testing.T) {
 	}
 
 	engine := NewLayoutEngine(800, 600)
-	boxes := engine.Layout(doc)
+	boxes := layoutDoc(t, engine, doc)
 
 	div := boxes[0]
 	if len(div.Children) < 1 {
@@ -370,10 +383,196 @@ func TestMarginCollapsing_NoCollapseForFloats(t *testing.T) {
 	}
 
 	engine := NewLayoutEngine(800, 600)
-	_ = engine.Layout(doc)
+	_ = layoutDoc(t, engine, doc)
 	// Just verify it doesn't crash - float collapsing behavior is complex
 }
 
+func TestMarginCollapsing_Clearance(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0">
+		<div id="cleared"><p style="margin:0 0 20px;height:10px"></p><div style="float:left;width:50px;height:100px"></div><div id="c" style="clear:left;margin-top:30px;height:10px"></div><div id="next" style="margin-top:10px;height:10px"></div></div>
+		<div id="uncleared"><p style="margin:0 0 20px;height:10px"></p><div style="float:left;width:50px;height:5px"></div><div id="u" style="clear:left;margin-top:30px;height:10px"></div></div>
+		<div id="clearfix"><div style="float:left;width:50px;height:100px"></div><div style="clear:both;margin-bottom:20px"></div></div>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 600), doc)
+	find := boxFinder(t, boxes)
+
+	// The float starts below the paragraph's 20px margin, at 30. With its
+	// margins collapsed c would be at 40, above the float's bottom, so
+	// clearance puts it at 130 and the next box's margin follows from there
+	cleared, c, next := find("cleared"), find("c"), find("next")
+	if c.Y != cleared.Y+130 || next.Y != cleared.Y+150 {
+		t.Errorf("expected c at %.1f and next at %.1f, got %.1f and %.1f", cleared.Y+130, cleared.Y+150, c.Y, next.Y)
+	}
+	if cleared.Height != 160 {
+		t.Errorf("expected the container 160px tall, got %.1f", cleared.Height)
+	}
+	// Clearing a float above the collapsed position introduces no clearance
+	if uncleared, u := find("uncleared"), find("u"); u.Y != uncleared.Y+40 {
+		t.Errorf("expected u at %.1f, got %.1f", uncleared.Y+40, u.Y)
+	}
+	// An empty clearing element's margins stay inside its parent
+	if clearfix := find("clearfix"); clearfix.Height != 120 || clearfix.Margin.Bottom != 0 {
+		t.Errorf("expected the clearfix container 120px tall without a bottom margin, got %.1f and %.1f",
+			clearfix.Height, clearfix.Margin.Bottom)
+	}
+}
+
+func TestFloats_StackBesideTallerFloats(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0">
+		<div style="width:300px"><div style="float:left;width:50px;height:50px"></div><div style="float:left;width:50px;height:200px"></div><div style="height:60px"></div><div id="left" style="float:left;width:50px;height:20px"></div></div>
+		<div style="width:300px;clear:both"><div style="float:right;width:50px;height:50px"></div><div style="float:right;width:50px;height:200px"></div><div style="height:60px"></div><div id="right" style="float:right;width:50px;height:20px"></div></div>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 600), doc)
+	left, right := findOnPage(boxes, "left"), findOnPage(boxes, "right")
+	if left == nil || right == nil {
+		t.Fatal("expected the last floats")
+	}
+	// Below the short first float, the tall second one is still beside the
+	// last, which is placed against it rather than over it
+	if left.X != 100 {
+		t.Errorf("expected the left float at 100, got %.1f", left.X)
+	}
+	if right.X != 150 {
+		t.Errorf("expected the right float at 150, got %.1f", right.X)
+	}
+}
+
+func TestFloats_DropWhenTooWide(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0">
+		<div style="width:250px"><div style="float:left;width:100px;height:20px"></div><div style="float:left;width:100px;height:20px"></div><div id="left" style="float:left;width:100px;height:20px"></div></div>
+		<div style="width:250px;clear:both"><div style="float:right;width:100px;height:20px"></div><div style="float:right;width:100px;height:20px"></div><div id="right" style="float:right;width:100px;height:20px"></div></div>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 600), doc)
+	left, right := findOnPage(boxes, "left"), findOnPage(boxes, "right")
+	if left == nil || right == nil {
+		t.Fatal("expected the last floats")
+	}
+	// Only 50px is left beside the first two floats, so the third moves
+	// below them rather than overflowing the container
+	if left.X != 0 || left.Y != 20 {
+		t.Errorf("expected the left float at (0, 20), got (%.1f, %.1f)", left.X, left.Y)
+	}
+	// The second container clears the left floats, which end at 40px
+	if right.X != 150 || right.Y != 60 {
+		t.Errorf("expected the right float at (150, 60), got (%.1f, %.1f)", right.X, right.Y)
+	}
+}
+
+func TestFloats_ShrinkToFit(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0;font:10px Ahem">
+		<div style="width:200px"><div id="wrapped" style="float:left">aaaa aaaa aaaa aaaa aaaa aaaa</div></div>
+		<div style="clear:both"><div id="outer" style="float:left"><div style="width:100px;height:10px"></div><div id="inner" style="float:right;width:20px;height:10px"></div></div></div>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 600), doc)
+	wrapped, outer, inner := findOnPage(boxes, "wrapped"), findOnPage(boxes, "outer"), findOnPage(boxes, "inner")
+	if wrapped == nil || outer == nil || inner == nil {
+		t.Fatal("expected the floats")
+	}
+	// Text wider than the containing block wraps the float to the available width
+	if wrapped.Width != 200 || wrapped.Height != 20 {
+		t.Errorf("expected the wrapped float 200x20, got %.1fx%.1f", wrapped.Width, wrapped.Height)
+	}
+	// The float is as wide as its widest block, and a right float inside it
+	// is laid out against that width rather than moved there afterwards
+	if outer.Width != 100 {
+		t.Errorf("expected the outer float 100px wide, got %.1f", outer.Width)
+	}
+	if inner.X != outer.X+80 {
+		t.Errorf("expected the inner float at %.1f, got %.1f", outer.X+80, inner.X)
+	}
+}
+
+func TestInlineBlock_TextAlign(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0">
+		<div style="display:inline-block;width:300px;text-align:right"><div id="item" style="display:inline-block;width:50px;height:30px"></div></div>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 600), doc)
+	item := findOnPage(boxes, "item")
+	if item == nil {
+		t.Fatal("expected the item")
+	}
+	// An inline-block aligns its own lines
+	if item.X != 250 {
+		t.Errorf("expected the item right-aligned at 250, got %.1f", item.X)
+	}
+}
+
+func TestAbsolute_ShrinkToFitContainingBlock(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0;font:10px Ahem">
+		<div style="position:relative;width:600px;height:100px">
+			<div style="width:100px"><div id="fit" style="position:absolute">aaaa aaaa aaaa aaaa aaaa</div></div>
+			<div id="stretch" style="position:absolute;left:10px;right:10px;padding:0 5px;height:10px"></div>
+			<div id="offset" style="position:absolute;left:500px;top:50px">aaaa aaaa aaaa</div>
+		</div>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(800, 600), doc)
+	fit, stretch, offset := findOnPage(boxes, "fit"), findOnPage(boxes, "stretch"), findOnPage(boxes, "offset")
+	if fit == nil || stretch == nil || offset == nil {
+		t.Fatal("expected the positioned boxes")
+	}
+	// The containing block is the positioned ancestor, not the parent
+	if fit.Width != 240 || fit.Height != 10 {
+		t.Errorf("expected the box 240x10 on one line, got %.1fx%.1f", fit.Width, fit.Height)
+	}
+	// With left and right set, an auto width fills the containing block
+	if stretch.Width != 580 || stretch.X != 10 {
+		t.Errorf("expected the box 580px wide at 10, got %.1f at %.1f", stretch.Width, stretch.X)
+	}
+	// The offset takes from the width the box may fit in
+	if offset.Width != 100 || offset.Height != 20 {
+		t.Errorf("expected the box wrapped to 100x20, got %.1fx%.1f", offset.Width, offset.Height)
+	}
+}
+
+func TestFloats_TextWrapsAroundPrecedingFloat(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0;font:10px Ahem">
+		<div style="width:200px"><div style="float:left;width:100px;height:25px"></div><p id="p" style="margin:0">aaaa<br>bbbb<br>cccc<br>dddd</p></div>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 600), doc)
+	p := findOnPage(boxes, "p")
+	if p == nil {
+		t.Fatal("expected the paragraph")
+	}
+	var xs []float64
+	for _, child := range p.Children {
+		if child.Node != nil && child.Node.Type == html.TextNode {
+			xs = append(xs, child.X)
+		}
+	}
+	// The float belongs to the paragraph's previous sibling, but the lines
+	// beside it are still shortened; the fourth line is below it
+	want := []float64{100, 100, 100, 0}
+	if len(xs) != len(want) {
+		t.Fatalf("expected %d lines, got %v", len(want), xs)
+	}
+	for i := range want {
+		if xs[i] != want[i] {
+			t.Errorf("line %d: expected X=%.0f, got %.1f", i+1, want[i], xs[i])
+		}
+	}
+}
+
 func TestCollapseMargins_Unit(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -440,3 +639,443 @@ func TestShouldCollapseMargins_Unit(t *testing.T) {
 		t.Error("normal block elements should collapse margins")
 	}
 }
+
+// Sticky positioning tests
+
+func stickyTestLayout(t *testing.T, scrollY float64) (header, container *Box) {
+	t.Helper()
+	doc, err := html.Parse(`<div style="height: 100px;"></div>` +
+		`<div style="height: 400px;"><div id="sticky" style="position: sticky; top: 10px; height: 50px;"></div></div>` +
+		`<div style="height: 1000px;"></div>`)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	engine := NewLayoutEngine(800, 600)
+	engine.SetScrollY(scrollY)
+	header = boxFinder(t, layoutDoc(t, engine, doc))("sticky")
+	return header, header.Parent
+}
+
+func TestStickyPositioning_InFlowWhenNotScrolled(t *testing.T) {
+	header, container := stickyTestLayout(t, 0)
+	if header.Y != container.Y {
+		t.Errorf("unscrolled sticky box should stay in flow at %v, got %v", container.Y, header.Y)
+	}
+}
+
+func TestStickyPositioning_SticksToViewportTop(t *testing.T) {
+	header, _ := stickyTestLayout(t, 200)
+	if header.Y != 210 {
+		t.Errorf("sticky box should stick at scrollY+top = 210, got %v", header.Y)
+	}
+}
+
+func TestStickyPositioning_ClampedToContainingBlock(t *testing.T) {
+	header, container := stickyTestLayout(t, 480)
+	bottom := container.Y + container.Height
+	if header.Y+header.Height != bottom {
+		t.Errorf("sticky box should stop at containing block bottom %v, got %v", bottom, header.Y+header.Height)
+	}
+}
+
+// Relative positioning tests
+
+func TestRelativePositioning_OffsetsWithoutMovingOthers(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0">
+		<div id="block" style="position:relative;top:20px;left:30px;height:50px;border:2px solid">
+		<div id="corner" style="position:absolute;top:0;left:0;width:10px;height:10px"></div></div>
+		<div id="next" style="height:10px"></div>
+		<div style="display:flex"><div id="item" style="position:relative;top:5px;left:7px;width:50px;height:10px">
+		<div id="inItem" style="position:absolute;top:0;left:0;width:5px;height:5px"></div></div>
+		<div id="sibling" style="width:50px;height:10px"></div></div>
+		<div><div id="float" style="float:left;position:relative;left:10px;width:20px;height:20px"></div>
+		<div id="float2" style="float:left;width:20px;height:20px"></div></div>
+		<table id="table" style="border-spacing:0"><tr><td id="cell" style="position:relative;top:4px;padding:3px;height:20px">
+		<div id="inCell" style="position:absolute;top:0;left:0;width:5px;height:5px"></div></td></tr></table>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 400), doc)
+	find := boxFinder(t, boxes)
+
+	// The block moves, and the block after it is laid out as if it hadn't
+	block, corner, next := find("block"), find("corner"), find("next")
+	if block.X != 30 || block.Y != 20 || next.Y != 54 {
+		t.Errorf("expected the block at (30, 20) and the next at y=54, got (%.1f, %.1f) and %.1f", block.X, block.Y, next.Y)
+	}
+	// Its absolutely positioned child is placed in its padding box
+	if corner.X != 32 || corner.Y != 22 {
+		t.Errorf("expected the absolute child at (32, 22), got (%.1f, %.1f)", corner.X, corner.Y)
+	}
+
+	// A flex item moves off its place in the line, taking its contents
+	item, inItem, sibling := find("item"), find("inItem"), find("sibling")
+	if item.X != 7 || item.Y != sibling.Y+5 || sibling.X != 50 {
+		t.Errorf("expected the item at (7, %.1f) and its sibling at 50, got (%.1f, %.1f) and %.1f", sibling.Y+5, item.X, item.Y, sibling.X)
+	}
+	if inItem.X != item.X || inItem.Y != item.Y {
+		t.Errorf("expected the item's absolute child at (%.1f, %.1f), got (%.1f, %.1f)", item.X, item.Y, inItem.X, inItem.Y)
+	}
+
+	// A float moves, but the float after it stays beside its place
+	if float, float2 := find("float"), find("float2"); float.X != 10 || float2.X != 20 {
+		t.Errorf("expected the floats at 10 and 20, got %.1f and %.1f", float.X, float2.X)
+	}
+
+	// A cell moves off its row, and is the containing block of its content
+	cell, inCell := find("cell"), find("inCell")
+	if table := find("table"); cell.Y != table.Y+4 {
+		t.Errorf("expected the cell 4px down in its table, at %.1f, got %.1f", table.Y+4, cell.Y)
+	}
+	if inCell.X != cell.X || inCell.Y != cell.Y {
+		t.Errorf("expected the cell's absolute child at (%.1f, %.1f), got (%.1f, %.1f)", cell.X, cell.Y, inCell.X, inCell.Y)
+	}
+}
+
+func TestTextIndent_FirstLineOnly(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0;font:10px Ahem">
+		<p id="p" style="margin:0;width:100px;text-indent:20%">aa<br>bb</p>
+		<div id="li" style="display:list-item;list-style:none;width:100px;text-indent:3em">aa<br>bb</div>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 300), doc)
+
+	// A paragraph and a list item both indent the first line only
+	for _, tt := range []struct {
+		id     string
+		indent float64
+	}{
+		{"p", 20}, // 20% of the 100px content width
+		{"li", 30},
+	} {
+		container := findOnPage(boxes, tt.id)
+		if container == nil {
+			t.Fatalf("expected #%s", tt.id)
+		}
+		var lines []*Box
+		for _, child := range container.Children {
+			if child.Node != nil && child.Node.Type == html.TextNode {
+				lines = append(lines, child)
+			}
+		}
+		if len(lines) != 2 {
+			t.Fatalf("#%s: expected two lines of text, got %d", tt.id, len(lines))
+		}
+		if lines[0].X != container.X+tt.indent || lines[1].X != container.X {
+			t.Errorf("#%s: expected lines at %.1f and %.1f, got %.1f and %.1f", tt.id,
+				container.X+tt.indent, container.X, lines[0].X, lines[1].X)
+		}
+	}
+}
+
+func TestListMarkers_NumberingAndTypes(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="font:10px Ahem">
+		<ol id="start" start="5"><li>a<li>b<li value="10">c<li>d</ol>
+		<ol id="reversed" reversed><li>a<li>b<li>c</ol>
+		<ol id="alpha" style="list-style-type:upper-alpha" start="26"><li>a<li>b</ol>
+		<ol id="roman" type="i" start="3"><li>a<li>b</ol>
+		<ul id="roman-ul" style="list-style:upper-roman"><li>a<li value="1990">b</ul>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 600), doc)
+
+	for _, tt := range []struct {
+		id   string
+		want []string
+	}{
+		{"start", []string{"5.", "6.", "10.", "11."}},
+		{"reversed", []string{"3.", "2.", "1."}},
+		{"alpha", []string{"Z.", "AA."}},
+		{"roman", []string{"iii.", "iv."}},
+		{"roman-ul", []string{"I.", "MCMXC."}},
+	} {
+		list := findOnPage(boxes, tt.id)
+		if list == nil {
+			t.Fatalf("expected #%s", tt.id)
+		}
+		var markers []string
+		for _, item := range list.Children {
+			for _, child := range item.Children {
+				if child.PseudoContent != "" && child.Node == item.Node {
+					markers = append(markers, child.PseudoContent)
+				}
+			}
+		}
+		if strings.Join(markers, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("#%s: expected markers %v, got %v", tt.id, tt.want, markers)
+		}
+	}
+}
+
+func TestListMarkers_Inside(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0;font:10px Ahem">
+		<ol style="margin:0;padding:0"><li id="out">aa</ol>
+		<ol style="margin:0;padding:0;list-style-position:inside"><li id="in">aa</ol>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 300), doc)
+
+	for _, tt := range []struct {
+		id     string
+		inside bool
+	}{
+		{"out", false},
+		{"in", true},
+	} {
+		item := findOnPage(boxes, tt.id)
+		if item == nil {
+			t.Fatalf("expected #%s", tt.id)
+		}
+		var marker, text *Box
+		for _, child := range item.Children {
+			if isGeneratedBox(item, child) {
+				if marker == nil {
+					marker = child
+				}
+			} else if child.Node != nil && child.Node.Type == html.TextNode {
+				text = child
+			}
+		}
+		if marker == nil || text == nil {
+			t.Fatalf("#%s: expected a marker and text", tt.id)
+		}
+		if !tt.inside {
+			// "1." is 20px wide, with a 5px gap before the content
+			if marker.X != item.X-25 || text.X != item.X {
+				t.Errorf("#%s: expected the marker at %.1f and text at %.1f, got %.1f and %.1f",
+					tt.id, item.X-25, item.X, marker.X, text.X)
+			}
+			continue
+		}
+		if marker.X != item.X || text.X != item.X+25 {
+			t.Errorf("#%s: expected the marker at %.1f and text at %.1f, got %.1f and %.1f",
+				tt.id, item.X, item.X+25, marker.X, text.X)
+		}
+	}
+}
+
+func TestListMarkers_MarkerPseudoAndImage(t *testing.T) {
+	doc, err := html.Parse(`<html><head><style>
+		#styled li::marker { color: red; font-size: 20px; }
+		#content li::marker { content: "-" attr(data-n) ":"; }
+		#none li::marker { content: none; }
+		#image { list-style-image: url("data:image/svg+xml,<svg xmlns='http://www.w3.org/2000/svg' width='4' height='4'/>"); }
+		#broken { list-style-image: url(missing.png); }
+	</style></head><body style="font:10px Ahem">
+		<ul id="styled"><li>a</ul>
+		<ol id="content"><li data-n="x">a</ol>
+		<ul id="none"><li>a</ul>
+		<ul id="image"><li>a</ul>
+		<ul id="broken"><li>a</ul>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	le := NewLayoutEngine(400, 600)
+	le.SetImageFetcher(func(ctx context.Context, uri string) ([]byte, error) {
+		return nil, fmt.Errorf("not found: %s", uri)
+	})
+	boxes := layoutDoc(t, le, doc)
+
+	marker := func(id string) *Box {
+		list := findOnPage(boxes, id)
+		if list == nil || len(list.Children) == 0 {
+			t.Fatalf("expected #%s with an item", id)
+		}
+		item := list.Children[0]
+		for _, child := range item.Children {
+			if child.Node == item.Node && (child.PseudoContent != "" || child.ImagePath != "") {
+				return child
+			}
+		}
+		return nil
+	}
+
+	if m := marker("styled"); m == nil || m.Style.GetFontSize() != 20 || m.Width != 20 {
+		t.Errorf("#styled: expected a 20px marker, got %+v", m)
+	} else if c := m.Style.GetColor(); c.R != 255 || c.G != 0 {
+		t.Errorf("#styled: expected a red marker, got %v", c)
+	}
+	if m := marker("content"); m == nil || m.PseudoContent != "-x:" {
+		t.Errorf("#content: expected the ::marker content, got %+v", m)
+	}
+	if m := marker("none"); m != nil {
+		t.Errorf("#none: expected no marker, got %q", m.PseudoContent)
+	}
+	if m := marker("image"); m == nil || !strings.HasPrefix(m.ImagePath, "data:image/svg+xml") || m.Width != 10 || m.Height != 10 {
+		t.Errorf("#image: expected a 1em image marker, got %+v", m)
+	}
+	if m := marker("broken"); m == nil || m.PseudoContent != "•" || m.ImagePath != "" {
+		t.Errorf("#broken: expected the disc when the image doesn't load, got %+v", m)
+	}
+}
+
+func TestCounters_NestedScopes(t *testing.T) {
+	doc, err := html.Parse(`<html><head><style>
+		ol { counter-reset: item; list-style: none }
+		li::before { counter-increment: item; content: counters(item, ".") " " }
+		#roman li::before { content: counters(item, "-", lower-roman) }
+	</style></head><body style="font:10px Ahem">
+		<ol><li id="a">a<li id="b">b<ol><li id="b1">c<li id="b2">d<ol><li id="b2a">e</ol></ol><li id="c">f</ol>
+		<ol id="roman"><li>a<li>b<ol><li id="r">c<li id="r2">d</ol></ol>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 600), doc)
+
+	for id, want := range map[string]string{
+		"a": "1 ", "b": "2 ", "b1": "2.1 ", "b2": "2.2 ", "b2a": "2.2.1 ", "c": "3 ",
+		"r": "ii-i", "r2": "ii-ii",
+	} {
+		item := findOnPage(boxes, id)
+		if item == nil {
+			t.Fatalf("expected #%s", id)
+		}
+		var got string
+		for _, child := range item.Children {
+			if isGeneratedBox(item, child) && child.Node.Type == html.TextNode {
+				got += child.Node.Text
+			}
+		}
+		if got != want {
+			t.Errorf("#%s: expected ::before %q, got %q", id, want, got)
+		}
+	}
+}
+
+// isGeneratedBox reports whether child, a box laid out in item, holds
+// generated content: a marker box, or the contents of a synthetic
+// pseudo-element or marker node.
+func isGeneratedBox(item, child *Box) bool {
+	if child.PseudoContent != "" {
+		return true
+	}
+	n := child.Node
+	for n != nil && n.Parent != item.Node {
+		n = n.Parent
+	}
+	if n == nil {
+		return false
+	}
+	for _, c := range item.Node.Children {
+		if c == n {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPseudoElementContent_ImageSizeAndAlt(t *testing.T) {
+	doc, err := html.Parse(`<html><head><style>
+		.sized::before { content: url("data:image/svg+xml,<svg xmlns='http://www.w3.org/2000/svg' width='4' height='2'/>"); width: 20px; }
+		.alt::before { content: url(missing.png) / "[" attr(title) "]"; }
+		.single { display: list-item; list-style: none; }
+	</style></head><body style="font:10px Ahem">
+		<div id="sized" class="sized">a</div>
+		<div id="alt" class="alt" title="note">a</div>
+		<div id="sized-single" class="sized single">a</div>
+		<div id="alt-single" class="alt single" title="note">a</div>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	le := NewLayoutEngine(400, 600)
+	le.SetImageFetcher(func(ctx context.Context, uri string) ([]byte, error) {
+		return nil, fmt.Errorf("not found: %s", uri)
+	})
+	boxes := layoutDoc(t, le, doc)
+
+	// A block and a list item both size the image, and both show the alt text
+	for _, id := range []string{"sized", "sized-single"} {
+		var image *Box
+		var walk func(b *Box)
+		walk = func(b *Box) {
+			if b.ImagePath != "" {
+				image = b
+			}
+			for _, c := range b.Children {
+				walk(c)
+			}
+		}
+		walk(findOnPage(boxes, id))
+		if image == nil || image.Width != 20 || image.Height != 10 {
+			t.Errorf("#%s: expected a 20x10 image, got %+v", id, image)
+		}
+	}
+	for _, id := range []string{"alt", "alt-single"} {
+		var got string
+		var walk func(b *Box)
+		walk = func(b *Box) {
+			got += b.PseudoContent
+			if b.Node != nil && b.Node.Type == html.TextNode {
+				got += b.Node.Text
+			}
+			for _, c := range b.Children {
+				walk(c)
+			}
+		}
+		walk(findOnPage(boxes, id))
+		if !strings.Contains(got, "[note]") {
+			t.Errorf("#%s: expected the alt text, got %q", id, got)
+		}
+	}
+}
+
+// cancelingTracer cancels a layout once it has laid out after boxes, and
+// counts the boxes laid out from then on.
+type cancelingTracer struct {
+	after, boxes int
+	cancel       context.CancelFunc
+}
+
+func (c *cancelingTracer) Enabled(subsystem TraceSubsystem, level TraceLevel) bool {
+	return subsystem == TraceLayout && level == TraceInfo
+}
+
+func (c *cancelingTracer) Trace(subsystem TraceSubsystem, level TraceLevel, msg string) {
+	c.boxes++
+	if c.boxes == c.after {
+		c.cancel()
+	}
+}
+
+func TestLayoutEngine_StopsWhenCanceled(t *testing.T) {
+	const paragraphs = 2000
+	var sb strings.Builder
+	sb.WriteString(`<html><body>`)
+	for i := 0; i < paragraphs; i++ {
+		fmt.Fprintf(&sb, `<div><p>paragraph %d of a long page</p></div>`, i)
+	}
+	doc, err := html.Parse(sb.String() + `</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	le := NewLayoutEngine(400, 600)
+	le.SetIncremental(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tracer := &cancelingTracer{after: 10, cancel: cancel}
+	le.SetTracer(tracer)
+	if boxes, err := le.Layout(ctx, doc); err != context.Canceled || boxes != nil {
+		t.Fatalf("expected the canceled layout to fail with context.Canceled, got %d boxes and %v", len(boxes), err)
+	}
+	// Layout stops at the next block, not at the end of the page
+	if tracer.boxes > 2*tracer.after {
+		t.Errorf("expected layout to stop soon after it was canceled, laid out %d boxes", tracer.boxes)
+	}
+
+	// Nothing of the partial layout is reused by the next one
+	le.SetTracer(nil)
+	boxes := layoutDoc(t, le, doc)
+	if n := len(boxes[0].Children[0].Children); n != paragraphs {
+		t.Errorf("expected %d divs in the body after laying out again, got %d", paragraphs, n)
+	}
+}
@@ -0,0 +1,106 @@
+package layout
+
+import (
+	"testing"
+	"time"
+
+	"louis14/pkg/css"
+	"louis14/pkg/html"
+)
+
+const transitionTestHTML = `<html><head><style>
+	#link { color: rgb(0, 0, 0); opacity: 0.2; transition: color 1s linear, opacity 1s linear 1s }
+	#link:hover { color: rgb(200, 0, 0); opacity: 1 }
+</style></head><body><div id="link"><span id="label">text</span></div></body></html>`
+
+func TestTransitions_AdvanceInterpolates(t *testing.T) {
+	doc, err := html.Parse(transitionTestHTML)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	le := NewLayoutEngine(400, 600)
+	boxes := layoutDoc(t, le, doc)
+	link := findOnPage(boxes, "link")
+	le.SetHoveredNode(link.Node)
+
+	// The change starts transitions from the values shown before it
+	boxes = layoutDoc(t, le, doc)
+	if !le.Animating() {
+		t.Fatal("expected the hover to start transitions")
+	}
+	if color := findOnPage(boxes, "link").Style.GetColor(); color != (css.Color{R: 0, G: 0, B: 0, A: 1}) {
+		t.Errorf("expected the transition to start at black, got %v", color)
+	}
+
+	if !le.Advance(500 * time.Millisecond) {
+		t.Fatal("expected transitions to be running")
+	}
+	boxes = layoutDoc(t, le, doc)
+	link, label := findOnPage(boxes, "link"), findOnPage(boxes, "label")
+	if color := link.Style.GetColor(); color != (css.Color{R: 100, G: 0, B: 0, A: 1}) {
+		t.Errorf("expected the color halfway to red, got %v", color)
+	}
+	if color := label.Style.GetColor(); color != (css.Color{R: 100, G: 0, B: 0, A: 1}) {
+		t.Errorf("expected the child to inherit the color shown, got %v", color)
+	}
+	// The opacity transition is still in its delay
+	if opacity := link.Style.GetOpacity(); opacity != 0.2 {
+		t.Errorf("expected the delayed opacity to be 0.2, got %v", opacity)
+	}
+
+	le.Advance(time.Second)
+	boxes = layoutDoc(t, le, doc)
+	if color := findOnPage(boxes, "link").Style.GetColor(); color != (css.Color{R: 200, G: 0, B: 0, A: 1}) {
+		t.Errorf("expected the color transition to have ended at red, got %v", color)
+	}
+	if opacity := findOnPage(boxes, "link").Style.GetOpacity(); opacity != 0.6 {
+		t.Errorf("expected the opacity halfway to 1, got %v", opacity)
+	}
+
+	le.Advance(time.Second)
+	layoutDoc(t, le, doc)
+	if le.Animating() {
+		t.Error("expected all transitions to have ended")
+	}
+}
+
+func TestTransitions_Reverse(t *testing.T) {
+	doc, err := html.Parse(transitionTestHTML)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	le := NewLayoutEngine(400, 600)
+	link := findOnPage(layoutDoc(t, le, doc), "link")
+	le.SetHoveredNode(link.Node)
+	layoutDoc(t, le, doc)
+	le.Advance(250 * time.Millisecond)
+	layoutDoc(t, le, doc)
+
+	// Leaving before the end transitions back from the value shown
+	le.SetHoveredNode(nil)
+	boxes := layoutDoc(t, le, doc)
+	if color := findOnPage(boxes, "link").Style.GetColor(); color != (css.Color{R: 50, G: 0, B: 0, A: 1}) {
+		t.Errorf("expected the reverse transition to start at the value shown, got %v", color)
+	}
+	le.Advance(500 * time.Millisecond)
+	boxes = layoutDoc(t, le, doc)
+	if color := findOnPage(boxes, "link").Style.GetColor(); color != (css.Color{R: 25, G: 0, B: 0, A: 1}) {
+		t.Errorf("expected the color halfway back to black, got %v", color)
+	}
+}
+
+func TestTransitions_NoTransitionWithoutDuration(t *testing.T) {
+	doc, err := html.Parse(`<html><head><style>#a:hover { color: red }</style></head><body><div id="a">x</div></body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	le := NewLayoutEngine(400, 600)
+	le.SetHoveredNode(findOnPage(layoutDoc(t, le, doc), "a").Node)
+	boxes := layoutDoc(t, le, doc)
+	if le.Animating() {
+		t.Error("expected no transition")
+	}
+	if color := findOnPage(boxes, "a").Style.GetColor(); color != (css.Color{R: 255, A: 1}) {
+		t.Errorf("expected the color to change at once, got %v", color)
+	}
+}
@@ -0,0 +1,280 @@
+package layout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"louis14/pkg/css"
+	"louis14/pkg/html"
+)
+
+// Paged layout (CSS Fragmentation Module Level 3, CSS Paged Media)
+//
+// The document is laid out once as a continuous flow at the page width and
+// then cut into pages. Each page holds copies of the boxes that lie on it,
+// moved up so the page starts at y = 0.
+
+// MaxPages is the most pages LayoutPaged cuts a document into.
+const MaxPages = 1000
+
+// ErrTooManyPages is returned by LayoutPaged for a document that would
+// take more than MaxPages pages.
+var ErrTooManyPages = errors.New("layout: too many pages")
+
+// LayoutPaged lays out doc for paged media, as when printing, and returns
+// the boxes of each page. @media print rules apply. A page ends at a forced
+// break (break-before or break-after: page), or else at the lowest point
+// above the page bottom where no line, image, or break-inside: avoid box
+// would be split, skipping points that break-before or break-after: avoid
+// rule out. Boxes crossing a page edge are sliced, losing their border on
+// the cut side; fixed boxes repeat on every page. It fails with
+// ErrTooManyPages past MaxPages, and with the context's error when ctx is
+// canceled.
+func (le *LayoutEngine) LayoutPaged(ctx context.Context, doc *html.Document, pageWidth, pageHeight float64) ([][]*Box, error) {
+	le.viewport.width = pageWidth
+	le.viewport.height = pageHeight
+	le.mediaType = "print"
+	defer func() { le.mediaType = "" }()
+	boxes, err := le.Layout(ctx, doc)
+	if err != nil {
+		return nil, err
+	}
+	if pageHeight <= 0 {
+		return [][]*Box{boxes}, nil
+	}
+
+	pb := &pageBreaks{}
+	pb.collect(boxes)
+	pb.prepare()
+
+	var pages [][]*Box
+	for start := 0.0; ; {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if len(pages) == MaxPages {
+			return nil, fmt.Errorf("%w: over %d", ErrTooManyPages, MaxPages)
+		}
+		end := pb.pageEnd(start, pageHeight)
+		pages = append(pages, slicePage(boxes, start, end))
+		if end >= pb.bottom {
+			return pages, nil
+		}
+		start = end
+	}
+}
+
+// pageBreaks holds the break opportunities of a laid out document.
+type pageBreaks struct {
+	forced     []float64 // Positions of forced breaks
+	candidates []float64 // Positions between boxes where a break may fall
+	content    []float64 // Tops of monolithic boxes
+	bottom     float64   // Bottom of the in-flow content
+
+	// Extents a break must not fall inside, sorted by top, with the
+	// running maximum of their bottoms
+	unbreakable [][2]float64
+	maxBottom   []float64
+}
+
+// collect records the break opportunities among sibling boxes and their
+// descendants. Positioned boxes are out of the flow and are only sliced.
+func (pb *pageBreaks) collect(boxes []*Box) {
+	avoidAfter := false
+	for i, box := range boxes {
+		if box.Position == css.PositionAbsolute || box.Position == css.PositionFixed {
+			continue
+		}
+		top, bottom := box.Y, box.Y+box.Height
+		pb.bottom = max(pb.bottom, bottom)
+
+		before, after, inside := css.BreakAuto, css.BreakAuto, css.BreakAuto
+		if style := breakStyle(box); style != nil {
+			before, after, inside = style.GetBreakBefore(), style.GetBreakAfter(), style.GetBreakInside()
+		}
+		switch {
+		case before == css.BreakPage:
+			pb.forced = append(pb.forced, top)
+		case before != css.BreakAvoid && !avoidAfter:
+			pb.candidates = append(pb.candidates, top)
+		}
+		if after == css.BreakPage {
+			// The break falls before the next in-flow sibling, below any
+			// margin between them
+			pb.forced = append(pb.forced, nextFlowTop(boxes[i+1:], bottom))
+		}
+		avoidAfter = after == css.BreakAvoid
+
+		if monolithic(box) {
+			pb.content = append(pb.content, top)
+		}
+		if monolithic(box) || inside == css.BreakAvoid {
+			pb.unbreakable = append(pb.unbreakable, [2]float64{top, bottom})
+		}
+		pb.collect(box.Children)
+	}
+}
+
+// prepare sorts the break positions for pageEnd.
+func (pb *pageBreaks) prepare() {
+	sort.Float64s(pb.forced)
+	sort.Float64s(pb.candidates)
+	sort.Float64s(pb.content)
+	sort.Slice(pb.unbreakable, func(i, j int) bool { return pb.unbreakable[i][0] < pb.unbreakable[j][0] })
+	pb.maxBottom = make([]float64, len(pb.unbreakable))
+	running := math.Inf(-1)
+	for i, extent := range pb.unbreakable {
+		running = max(running, extent[1])
+		pb.maxBottom[i] = running
+	}
+}
+
+// splits reports whether a break at y would fall inside an unbreakable box.
+func (pb *pageBreaks) splits(y float64) bool {
+	n := sort.Search(len(pb.unbreakable), func(i int) bool { return pb.unbreakable[i][0] >= y })
+	return n > 0 && pb.maxBottom[n-1] > y
+}
+
+// hasContent reports whether any text or image starts in [from, to).
+func (pb *pageBreaks) hasContent(from, to float64) bool {
+	i := sort.SearchFloat64s(pb.content, from)
+	return i < len(pb.content) && pb.content[i] < to
+}
+
+// pageEnd returns where the page starting at start ends. A forced break
+// with nothing above it on the page, as before the first heading of a
+// document, would leave the page blank and is ignored.
+func (pb *pageBreaks) pageEnd(start, pageHeight float64) float64 {
+	limit := start + pageHeight
+	for _, y := range pb.forced {
+		if y > start && y <= limit && pb.hasContent(start, y) {
+			return y
+		}
+	}
+	if pb.bottom <= limit {
+		return pb.bottom
+	}
+	for i := len(pb.candidates) - 1; i >= 0; i-- {
+		y := pb.candidates[i]
+		if y <= start {
+			break
+		}
+		if y <= limit && !pb.splits(y) {
+			return y
+		}
+	}
+	// Nothing fits: cut the content at the page bottom
+	return limit
+}
+
+// breakStyle returns the style that break properties are read from, or
+// nil for text and pseudo-element boxes, which share their element's style.
+func breakStyle(box *Box) *css.Style {
+	if box.Node == nil || box.Node.Type != html.ElementNode || box.PseudoContent != "" {
+		return nil
+	}
+	return box.Style
+}
+
+// monolithic reports whether a box is kept whole on the page it starts on:
+// text, which makes up lines, and images.
+func monolithic(box *Box) bool {
+	return box.Node == nil || box.Node.Type == html.TextNode || box.PseudoContent != "" ||
+		isImageElement(box.Node)
+}
+
+// nextFlowTop returns the top of the first in-flow box, or fallback if
+// there is none.
+func nextFlowTop(boxes []*Box, fallback float64) float64 {
+	for _, box := range boxes {
+		if box.Position != css.PositionAbsolute && box.Position != css.PositionFixed {
+			return box.Y
+		}
+	}
+	return fallback
+}
+
+// slicePage copies the boxes lying within [start, end) of the document,
+// moved up by start.
+func slicePage(boxes []*Box, start, end float64) []*Box {
+	mapping := make(map[*Box]*Box)
+	page := make([]*Box, 0, len(boxes))
+	for _, box := range boxes {
+		if clone := sliceBox(box, nil, start, end, mapping); clone != nil {
+			page = append(page, clone)
+		}
+	}
+	return page
+}
+
+// sliceBox copies the part of box lying within [start, end), or returns nil
+// if none does. Monolithic boxes are copied whole onto the page they start
+// on; other boxes are cut to the page edges.
+func sliceBox(box *Box, parent *Box, start, end float64, mapping map[*Box]*Box) *Box {
+	if box.Position == css.PositionFixed {
+		// Fixed boxes are placed in the page area, so each page repeats them
+		clone := cloneBox(box, parent, mapping)
+		remapLineBoxes(clone, mapping)
+		return clone
+	}
+
+	top, bottom := box.Y, box.Y+box.Height
+	if monolithic(box) {
+		if top < start || top >= end {
+			return nil
+		}
+	} else if top >= end || (bottom <= start && top < start) {
+		return nil
+	}
+
+	clone := *box
+	clone.Parent = parent
+	mapping[box] = &clone
+	if !monolithic(box) {
+		if top < start {
+			clone.Y = start
+			clone.Height = bottom - start
+			clone.Border.Top = 0
+		}
+		if bottom > end {
+			clone.Height = end - clone.Y
+			clone.Border.Bottom = 0
+		}
+	}
+	clone.Y -= start
+
+	clone.Fragments = nil
+	for _, frag := range box.Fragments {
+		if frag.Y >= start && frag.Y < end {
+			frag.Y -= start
+			clone.Fragments = append(clone.Fragments, frag)
+		}
+	}
+	clone.Children = nil
+	for _, child := range box.Children {
+		if c := sliceBox(child, &clone, start, end, mapping); c != nil {
+			clone.Children = append(clone.Children, c)
+		}
+	}
+
+	// Keep the lines on this page, referring to the copied boxes
+	clone.LineBoxes = nil
+	for _, lb := range box.LineBoxes {
+		if lb.Y < start || lb.Y >= end {
+			continue
+		}
+		line := *lb
+		line.Y -= start
+		line.Boxes = nil
+		for _, b := range lb.Boxes {
+			if m, ok := mapping[b]; ok {
+				line.Boxes = append(line.Boxes, m)
+			}
+		}
+		clone.LineBoxes = append(clone.LineBoxes, &line)
+	}
+	return &clone
+}
@@ -1,444 +1,21 @@
 package layout
 
 import (
-	"fmt"
 	"strconv"
 	"strings"
 	"louis14/pkg/css"
 	"louis14/pkg/html"
 	"louis14/pkg/images"
-	"louis14/pkg/text"
 )
 
-func (le *LayoutEngine) generatePseudoElement(node *html.Node, pseudoType string, x, y, availableWidth float64, computedStyles map[*html.Node]*css.Style, parent *Box) *Box {
-	// Compute pseudo-element style using stored stylesheets
-	// Phase 22: Pass viewport dimensions for media query evaluation
-	parentStyle := computedStyles[node]
-	pseudoStyle := css.ComputePseudoElementStyle(node, pseudoType, le.stylesheets, le.viewport.width, le.viewport.height, parentStyle)
-
-	// Get parsed content values from pseudo-element style
-	contentValues, hasContent := pseudoStyle.GetContentValues()
-	if !hasContent || len(contentValues) == 0 {
-		return nil
-	}
-
-	// CSS Counter support: Process counter-increment BEFORE evaluating content
-	// This ensures counter() returns the incremented value
-	if incVal, ok := pseudoStyle.Get("counter-increment"); ok {
-		increments := parseCounterIncrement(incVal)
-		for name, value := range increments {
-			le.counterIncrement(name, value)
-		}
-	}
-
-	// Create box model values
-	margin := pseudoStyle.GetMargin()
-	padding := pseudoStyle.GetPadding()
-	border := pseudoStyle.GetBorderWidth()
-	display := pseudoStyle.GetDisplay()
-	fontSize := pseudoStyle.GetFontSize()
-	fontWeight := pseudoStyle.GetFontWeight()
-	bold := fontWeight == css.FontWeightBold
-
-	// Get quotes from parent style (for open-quote/close-quote)
-	quotes := []string{"\"", "\"", "'", "'"}
-	if parentStyle != nil {
-		if q, ok := parentStyle.Get("quotes"); ok {
-			quotes = parseQuotes(q)
-		}
-	}
-
-	// Build combined text content and collect images
-	// Track pre-image text (before first image) and post-image text (after all images)
-	var preImageText string
-	var postImageText string
-	var imageBoxes []*Box
-	currentX := x + margin.Left + border.Left + padding.Left
-	quoteDepth := 0
-	seenImage := false
-
-	for _, cv := range contentValues {
-		switch cv.Type {
-		case "text":
-			if seenImage {
-				postImageText += cv.Value
-			} else {
-				preImageText += cv.Value
-			}
-		case "url":
-			seenImage = true
-			// Create an image box for this URL
-			var imgWidth, imgHeight float64
-			if w, h, err := images.GetImageDimensionsWithFetcher(cv.Value, le.imageFetcher); err == nil {
-				imgWidth = float64(w)
-				imgHeight = float64(h)
-			}
-			// If dimensions fail to load, imgWidth and imgHeight remain 0 (placeholder)
-
-			// Create style for image box (inline-block, not block)
-			imgStyle := css.NewStyle()
-			imgStyle.Set("display", "inline-block")
-
-			imgBox := &Box{
-				Node:      node,
-				Style:     imgStyle,
-				X:         currentX,
-				Y:         y + margin.Top + border.Top + padding.Top,
-				Width:     imgWidth,
-				Height:    imgHeight,
-				ImagePath: cv.Value, // Fetcher will resolve relative paths during rendering
-			}
-			imageBoxes = append(imageBoxes, imgBox)
-			currentX += imgWidth
-		case "counter":
-			// Get the current value of the specified counter
-			counterValue := le.counterValue(cv.Value)
-			if seenImage {
-				postImageText += strconv.Itoa(counterValue)
-			} else {
-				preImageText += strconv.Itoa(counterValue)
-			}
-		case "attr":
-			// Get attribute value from the node
-			if val, ok := node.GetAttribute(cv.Value); ok && val != "" {
-				if seenImage {
-					postImageText += val
-				} else {
-					preImageText += val
-				}
-			}
-		case "open-quote":
-			if quoteDepth*2 < len(quotes) {
-				if seenImage {
-					postImageText += quotes[quoteDepth*2]
-				} else {
-					preImageText += quotes[quoteDepth*2]
-				}
-			}
-			quoteDepth++
-		case "close-quote":
-			if quoteDepth > 0 {
-				quoteDepth--
-			}
-			if quoteDepth*2+1 < len(quotes) {
-				if seenImage {
-					postImageText += quotes[quoteDepth*2+1]
-				} else {
-					preImageText += quotes[quoteDepth*2+1]
-				}
-			}
-		}
-	}
-
-	// Combine for total text content (used for non-wrapped layouts)
-	textContent := preImageText + postImageText
-
-	// Measure text dimensions
-	var boxWidth, boxHeight float64
-	var textWidth, textHeight float64
-	if textContent != "" {
-		textWidth, textHeight = text.MeasureTextWithWeight(textContent, fontSize, bold)
-		boxWidth = textWidth
-		boxHeight = textHeight
-	}
-
-	// Calculate total image width and max image height
-	var imageWidth, maxImageHeight float64
-	for _, imgBox := range imageBoxes {
-		imageWidth += imgBox.Width
-		if imgBox.Height > maxImageHeight {
-			maxImageHeight = imgBox.Height
-		}
-	}
-	boxWidth += imageWidth
-	if maxImageHeight > boxHeight {
-		boxHeight = maxImageHeight
-	}
-
-	// Check if this is a floated pseudo-element
-	floatVal := pseudoStyle.GetFloat()
-
-	// For floated elements, apply shrink-to-fit sizing with text wrapping (CSS 2.1 §10.3.5)
-	// shrink-to-fit width = min(max(preferred minimum width, available width), preferred width)
-	// For floats, browsers typically use min-content sizing when it produces a narrower result
-	var wrappedPostLines []string
-	var shrinkToFitWidth float64 // Declared at higher scope for use in child positioning
-	// Use CSS default line-height: normal (approximately 1.2x font size)
-	lineHeight := fontSize * 1.2
-
-	// Track pre-image and post-image text widths for layout
-	var preImageWidth, postImageWidth float64
-	if preImageText != "" {
-		preImageWidth, _ = text.MeasureTextWithWeight(preImageText, fontSize, bold)
-	}
-	if postImageText != "" {
-		postImageWidth, _ = text.MeasureTextWithWeight(postImageText, fontSize, bold)
-	}
-
-	if floatVal != css.FloatNone && (textContent != "" || len(imageBoxes) > 0) {
-		// Calculate preferred minimum width (min-content): the longest unbreakable unit
-		// This includes the image width and the longest word in post-image text
-		minContentWidth := preImageWidth + imageWidth
-		if postImageText != "" {
-			words := strings.Fields(postImageText)
-			for _, word := range words {
-				wordWidth, _ := text.MeasureTextWithWeight(word, fontSize, bold)
-				if wordWidth > minContentWidth {
-					minContentWidth = wordWidth
-				}
-			}
-		}
-
-		// Calculate preferred width (max-content): all content on one line
-		// Use sum of individual text measurements to match actual child box widths
-		maxContentWidth := preImageWidth + imageWidth + postImageWidth
-
-		// Calculate available width
-		maxAvailable := availableWidth - margin.Left - margin.Right - padding.Left - padding.Right - border.Left - border.Right
-
-		// CSS 2.1 §10.3.5: shrink-to-fit = min(max(min-content, available), max-content)
-		// For floated pseudo-elements, prefer keeping all content on one line
-		shrinkToFitWidth = minContentWidth
-		if maxAvailable > minContentWidth {
-			shrinkToFitWidth = maxAvailable
-		}
-		if shrinkToFitWidth > maxContentWidth {
-			shrinkToFitWidth = maxContentWidth
-		}
-
-		// For floated elements, always use shrink-to-fit width
-		boxWidth = shrinkToFitWidth
-
-		// Wrap postImageText only if content exceeds shrink-to-fit width
-		if postImageText != "" && maxContentWidth > shrinkToFitWidth {
-			// Calculate remaining space on first line after preImageText and images
-			firstLineMax := shrinkToFitWidth - preImageWidth - imageWidth
-			if firstLineMax < 0 {
-				firstLineMax = 0
-			}
-
-			// Wrap only the post-image text
-			wrappedPostLines = text.BreakTextIntoLinesWithWrap(postImageText, fontSize, bold, firstLineMax, shrinkToFitWidth)
-
-			// Calculate height needed for all content
-			numTextLines := len(wrappedPostLines)
-			if numTextLines == 0 {
-				// No wrapped text - height is just the first line (max of line height and image height)
-				boxHeight = lineHeight
-				if maxImageHeight > lineHeight {
-					boxHeight = maxImageHeight
-				}
-			} else {
-				// First line contains images + possibly first text line
-				// Additional lines contain wrapped text
-				firstLineHeight := lineHeight
-				if maxImageHeight > firstLineHeight {
-					firstLineHeight = maxImageHeight
-				}
-				additionalLines := numTextLines - 1
-				if additionalLines < 0 {
-					additionalLines = 0
-				}
-				boxHeight = firstLineHeight + float64(additionalLines)*lineHeight
-			}
-		}
-	}
-
-	// Block-level pseudo-elements: take available width unless floated
-	if display == css.DisplayBlock && floatVal == css.FloatNone && (textContent != "" || len(imageBoxes) > 0) {
-		totalWidth := availableWidth - margin.Left - margin.Right
-		boxWidth = totalWidth - padding.Left - padding.Right - border.Left - border.Right
-	}
-
-	// Apply explicit height
-	if h, ok := pseudoStyle.GetLength("height"); ok {
-		boxHeight = h
-	}
-
-	// Create the pseudo-element box
-	box := &Box{
-		Node:          node,
-		Style:         pseudoStyle,
-		X:             x + margin.Left,
-		Y:             y + margin.Top,
-		Width:         boxWidth,
-		Height:        boxHeight,
-		Margin:        margin,
-		Padding:       padding,
-		Border:        border,
-		Children:      make([]*Box, 0),
-		Parent:        parent,
-		PseudoContent: textContent,
-	}
-
-	// Add image boxes as children
-	for _, imgBox := range imageBoxes {
-		imgBox.Parent = box
-		box.Children = append(box.Children, imgBox)
-	}
-
-	// For content with images, create child text boxes for proper inline layout and paint order
-	// This prevents the parent's full text from being drawn and then covered by image children
-	if len(imageBoxes) > 0 {
-		// Clear PseudoContent from container so renderer draws children instead
-		box.PseudoContent = ""
-
-		contentX := x + margin.Left + border.Left + padding.Left
-		contentY := y + margin.Top + border.Top + padding.Top
-
-		// Line 1: preImageText (before images), then images (already positioned), then first wrapped line
-		currentLineX := contentX
-
-		// Add preImageText as a child box on line 1
-		if preImageText != "" {
-			// Create a minimal style for the text box (inline content)
-			textStyle := css.NewStyle()
-			textStyle.Set("display", "inline")
-			// Inherit font properties from pseudo-element style
-			if val, ok := pseudoStyle.Get("font-size"); ok {
-				textStyle.Set("font-size", val)
-			}
-			if val, ok := pseudoStyle.Get("font-weight"); ok {
-				textStyle.Set("font-weight", val)
-			}
-			if val, ok := pseudoStyle.Get("color"); ok {
-				textStyle.Set("color", val)
-			}
-
-			preBox := &Box{
-				Node:          node,
-				Style:         textStyle,
-				X:             currentLineX,
-				Y:             contentY,
-				Width:         preImageWidth,
-				Height:        lineHeight,
-				Margin:        css.BoxEdge{},
-				Padding:       css.BoxEdge{},
-				Border:        css.BoxEdge{},
-				Children:      make([]*Box, 0),
-				Parent:        box,
-				PseudoContent: preImageText,
-			}
-			box.Children = append(box.Children, preBox)
-			currentLineX += preImageWidth
-		}
-
-		// Images are already added as children - update their X positions
-		for _, imgBox := range imageBoxes {
-			imgBox.X = currentLineX
-			currentLineX += imgBox.Width
-		}
-
-		// Add post-image text (either wrapped lines or single unwrapped line)
-		if len(wrappedPostLines) > 0 {
-			// Text wraps - add each wrapped line as a child box
-			// Text continues on the same line after images if there's space
-			// Wrapped lines start below the image if image is taller than line height
-			firstLineBaseY := contentY
-			wrappedLinesStartY := contentY + maxImageHeight
-			if wrappedLinesStartY < contentY+lineHeight {
-				wrappedLinesStartY = contentY + lineHeight
-			}
-
-			for i, line := range wrappedPostLines {
-				lineWidth, _ := text.MeasureTextWithWeight(line, fontSize, bold)
-
-				var lineX, lineY float64
-				if i == 0 {
-					// First line continues after preImageText and images
-					lineX = currentLineX
-					lineY = firstLineBaseY
-				} else {
-					// Subsequent lines wrap below the image
-					lineX = contentX
-					lineY = wrappedLinesStartY + float64(i-1)*lineHeight
-				}
-
-				// Create a minimal style for the text box (inline content)
-				textStyle := css.NewStyle()
-				textStyle.Set("display", "inline")
-				// Inherit font properties from pseudo-element style
-				if val, ok := pseudoStyle.Get("font-size"); ok {
-					textStyle.Set("font-size", val)
-				}
-				if val, ok := pseudoStyle.Get("font-weight"); ok {
-					textStyle.Set("font-weight", val)
-				}
-				if val, ok := pseudoStyle.Get("color"); ok {
-					textStyle.Set("color", val)
-				}
-
-				// Create a pseudo-text child box for this line
-				lineBox := &Box{
-					Node:          node,
-					Style:         textStyle,
-					X:             lineX,
-					Y:             lineY,
-					Width:         lineWidth,
-					Height:        lineHeight,
-					Margin:        css.BoxEdge{},
-					Padding:       css.BoxEdge{},
-					Border:        css.BoxEdge{},
-					Children:      make([]*Box, 0),
-					Parent:        box,
-					PseudoContent: line,
-				}
-				box.Children = append(box.Children, lineBox)
-			}
-		} else if postImageText != "" {
-			// Text doesn't wrap - add unwrapped postImageText as single child box
-			// postImageWidth was already measured earlier for shrink-to-fit calculation
-
-			// Create a minimal style for the text box (inline content)
-			textStyle := css.NewStyle()
-			textStyle.Set("display", "inline")
-			// Inherit font properties from pseudo-element style
-			if val, ok := pseudoStyle.Get("font-size"); ok {
-				textStyle.Set("font-size", val)
-			}
-			if val, ok := pseudoStyle.Get("font-weight"); ok {
-				textStyle.Set("font-weight", val)
-			}
-			if val, ok := pseudoStyle.Get("color"); ok {
-				textStyle.Set("color", val)
-			}
-
-			postBox := &Box{
-				Node:          node,
-				Style:         textStyle,
-				X:             currentLineX,
-				Y:             contentY,
-				Width:         postImageWidth,
-				Height:        lineHeight,
-				Margin:        css.BoxEdge{},
-				Padding:       css.BoxEdge{},
-				Border:        css.BoxEdge{},
-				Children:      make([]*Box, 0),
-				Parent:        box,
-				PseudoContent: postImageText,
-			}
-			box.Children = append(box.Children, postBox)
-		}
-	}
-
-	// Update box dimensions to include all content
-	if len(imageBoxes) > 0 || textContent != "" {
-		box.Width = boxWidth
-		box.Height = boxHeight
-	}
-
-	return box
-}
-
 // createPseudoElementNode creates a synthetic html.Node for a pseudo-element.
-// Instead of generating Box objects (like generatePseudoElement), this creates
-// DOM nodes that can be processed by the multi-pass inline layout pipeline,
-// ensuring pseudo-elements get identical sizing and positioning to real elements.
+// The multi-pass inline layout processes it like a real element, so
+// pseudo-elements get identical sizing and positioning to real elements.
 //
 // Returns the synthetic node and its computed style, or (nil, nil) if no content.
 func (le *LayoutEngine) createPseudoElementNode(node *html.Node, pseudoType string, computedStyles map[*html.Node]*css.Style) (*html.Node, *css.Style) {
 	parentStyle := computedStyles[node]
-	pseudoStyle := css.ComputePseudoElementStyle(node, pseudoType, le.stylesheets, le.viewport.width, le.viewport.height, parentStyle)
+	pseudoStyle := css.ComputePseudoElementStyle(node, pseudoType, le.stylesheets, le.media(), parentStyle)
 
 	contentValues, hasContent := pseudoStyle.GetContentValues()
 	if !hasContent || len(contentValues) == 0 {
@@ -491,6 +68,12 @@ func (le *LayoutEngine) createPseudoElementNode(node *html.Node, pseudoType stri
 		case "text":
 			currentText += cv.Value
 		case "url":
+			w, h, err := images.GetImageDimensionsWithFetcher(le.fetchContext(), le.resolveImageURI(cv.Value), le.imageFetcher)
+			if alt, ok := le.contentAltText(node, pseudoStyle); ok && err != nil {
+				// An image that can't be loaded is replaced by the alt text
+				currentText += alt
+				continue
+			}
 			flushText()
 			imgNode := &html.Node{
 				Type:       html.ElementNode,
@@ -499,10 +82,16 @@ func (le *LayoutEngine) createPseudoElementNode(node *html.Node, pseudoType stri
 				Children:   make([]*html.Node, 0),
 				Parent:     syntheticNode,
 			}
+			if err == nil && len(contentValues) == 1 {
+				// The image alone is a replaced element sized by the
+				// pseudo-element's width and height
+				width, height := pseudoImageSize(pseudoStyle, float64(w), float64(h))
+				imgNode.Attributes["width"] = strconv.FormatFloat(width, 'f', -1, 64)
+				imgNode.Attributes["height"] = strconv.FormatFloat(height, 'f', -1, 64)
+			}
 			syntheticNode.Children = append(syntheticNode.Children, imgNode)
-		case "counter":
-			counterValue := le.counterValue(cv.Value)
-			currentText += strconv.Itoa(counterValue)
+		case "counter", "counters":
+			currentText += le.counterText(cv)
 		case "attr":
 			if val, ok := node.GetAttribute(cv.Value); ok && val != "" {
 				currentText += val
@@ -531,81 +120,239 @@ func (le *LayoutEngine) createPseudoElementNode(node *html.Node, pseudoType stri
 	return syntheticNode, pseudoStyle
 }
 
+// contentAltText returns the alternative text of a pseudo-element's content
+// (content: url(x) / "alt"), if it has one.
+func (le *LayoutEngine) contentAltText(node *html.Node, pseudoStyle *css.Style) (string, bool) {
+	altValues, ok := pseudoStyle.GetContentAlt()
+	if !ok {
+		return "", false
+	}
+	var alt string
+	for _, cv := range altValues {
+		switch cv.Type {
+		case "text":
+			alt += cv.Value
+		case "attr":
+			if val, ok := node.GetAttribute(cv.Value); ok {
+				alt += val
+			}
+		}
+	}
+	return alt, true
+}
+
+// pseudoImageSize returns the size of an image that is a pseudo-element's
+// only content: its natural size, or the width and height set on the
+// pseudo-element, with the natural aspect ratio when only one is set.
+func pseudoImageSize(pseudoStyle *css.Style, naturalWidth, naturalHeight float64) (float64, float64) {
+	width, hasWidth := pseudoStyle.GetLength("width")
+	height, hasHeight := pseudoStyle.GetLength("height")
+	switch {
+	case hasWidth && hasHeight:
+		return width, height
+	case hasWidth && naturalWidth > 0:
+		return width, width * naturalHeight / naturalWidth
+	case hasHeight && naturalHeight > 0:
+		return height * naturalWidth / naturalHeight, height
+	}
+	return naturalWidth, naturalHeight
+}
+
 // parseQuotes parses the CSS quotes property value
 
 // unescapeUnicode converts CSS Unicode escapes like \0022 to actual characters
 
-// Phase 23: generateListMarker creates a marker box for list items
+// Phase 23: generateListMarker creates a marker box for list items. An
+// outside marker is placed to the left of x; an inside one starts at x, as
+// the first inline box of the item, with its spacing as a right margin.
+// The marker is the ::marker content if it has any, else the
+// list-style-image sized to 1em, else the list-style-type glyph or number.
 func (le *LayoutEngine) generateListMarker(node *html.Node, style *css.Style, x, y float64, parent *Box) *Box {
-	listStyleType := style.GetListStyleType()
-	if listStyleType == css.ListStyleTypeNone {
+	style, pseudoStyle := le.markerStyle(node, style)
+	fontSize := style.GetFontSize()
+
+	var markerText, imagePath string
+	var width, height float64
+	if content, ok := pseudoStyle.Get("content"); ok && strings.TrimSpace(content) == "none" {
 		return nil
 	}
-
-	// Generate marker text based on list-style-type
-	var markerText string
-	switch listStyleType {
-	case css.ListStyleTypeDisc:
-		markerText = "•"
-	case css.ListStyleTypeCircle:
-		markerText = "○"
-	case css.ListStyleTypeSquare:
-		markerText = "■"
-	case css.ListStyleTypeDecimal:
-		// Count preceding <li> siblings to determine number
-		itemNumber := le.getListItemNumber(node)
-		markerText = fmt.Sprintf("%d.", itemNumber)
-	default:
-		// Use custom marker string (e.g., from list-style-type: "\2022")
-		if string(listStyleType) != "" {
-			markerText = string(listStyleType)
-		} else {
-			markerText = "•"
+	if contentValues, ok := pseudoStyle.GetContentValues(); ok {
+		for _, cv := range contentValues {
+			switch cv.Type {
+			case "text":
+				markerText += cv.Value
+			case "attr":
+				if val, ok := node.GetAttribute(cv.Value); ok {
+					markerText += val
+				}
+			case "counter", "counters":
+				if cv.Value == "list-item" {
+					markerText += formatCounter(le.getListItemNumber(node), css.ListStyleType(cv.CounterStyle))
+				} else {
+					markerText += le.counterText(cv)
+				}
+			}
 		}
+	} else if src, ok := style.GetListStyleImage(); ok && le.listStyleImageLoads(src) {
+		imagePath = le.resolveImageURI(src)
+		width, height = fontSize, fontSize
+	} else {
+		markerText = le.listMarkerText(node, style.GetListStyleType())
+	}
+	if markerText == "" && imagePath == "" {
+		return nil
 	}
 
 	// Measure marker text
-	fontSize := style.GetFontSize()
-	fontWeight := style.GetFontWeight()
-	bold := fontWeight == css.FontWeightBold
-	textWidth, textHeight := text.MeasureTextWithWeight(markerText, fontSize, bold)
+	if markerText != "" {
+		width, height = measureStyledText(markerText, style)
+	}
 
 	// Position marker to the left of the content (outside the content box)
 	// CSS 2.1 §12.5.1: marker box is placed outside the principal box
 	// Use 0.5em spacing between marker and content (typical browser behavior)
 	markerSpacing := fontSize * 0.5
-	markerX := x - textWidth - markerSpacing
+	markerX := x - width - markerSpacing
 	markerY := y
+	var margin css.BoxEdge
+	if style.GetListStylePosition() == css.ListStylePositionInside {
+		// CSS Lists §3.1: an inside marker is an inline box before the content
+		markerX = x
+		margin.Right = markerSpacing
+	}
 
 	markerBox := &Box{
 		Node:          node,
 		Style:         style,
 		X:             markerX,
 		Y:             markerY,
-		Width:         textWidth,
-		Height:        textHeight,
-		Margin:        css.BoxEdge{},
+		Width:         width,
+		Height:        height,
+		Margin:        margin,
 		Padding:       css.BoxEdge{},
 		Border:        css.BoxEdge{},
 		Children:      make([]*Box, 0),
 		Parent:        parent,
 		PseudoContent: markerText, // Store marker text for rendering
+		ImagePath:     imagePath,
 	}
 
 	return markerBox
 }
 
+// listMarkerNode makes an inside marker a synthetic inline node, which the
+// multi-pass layout places at the start of the first line like ::before. It
+// returns the styles of the node and its children.
+func listMarkerNode(node *html.Node, marker *Box) (*html.Node, map[*html.Node]*css.Style) {
+	markerNode := &html.Node{
+		Type:       html.ElementNode,
+		TagName:    "span",
+		Attributes: map[string]string{},
+		Parent:     node,
+	}
+	style := css.AnonymousStyle(marker.Style, css.DisplayInline)
+	style.Set("margin-right", strconv.FormatFloat(marker.Margin.Right, 'f', -1, 64)+"px")
+	styles := map[*html.Node]*css.Style{markerNode: style}
+
+	if marker.ImagePath != "" {
+		img := &html.Node{
+			Type:    html.ElementNode,
+			TagName: "img",
+			Attributes: map[string]string{
+				"src":    marker.ImagePath,
+				"width":  strconv.FormatFloat(marker.Width, 'f', -1, 64),
+				"height": strconv.FormatFloat(marker.Height, 'f', -1, 64),
+			},
+			Parent: markerNode,
+		}
+		markerNode.Children = append(markerNode.Children, img)
+		styles[img] = css.AnonymousStyle(style, css.DisplayInlineBlock)
+	} else {
+		markerNode.Children = append(markerNode.Children, &html.Node{
+			Type:   html.TextNode,
+			Text:   marker.PseudoContent,
+			Parent: markerNode,
+		})
+	}
+	return markerNode, styles
+}
+
+// listMarkerText returns the marker of a list-style-type.
+func (le *LayoutEngine) listMarkerText(node *html.Node, listStyleType css.ListStyleType) string {
+	switch listStyleType {
+	case css.ListStyleTypeNone:
+		return ""
+	case css.ListStyleTypeDisc:
+		return "•"
+	case css.ListStyleTypeCircle:
+		return "○"
+	case css.ListStyleTypeSquare:
+		return "■"
+	case css.ListStyleTypeDecimal, css.ListStyleTypeLowerAlpha, css.ListStyleTypeUpperAlpha,
+		css.ListStyleTypeLowerRoman, css.ListStyleTypeUpperRoman:
+		// Number from the preceding <li> siblings and the list's attributes
+		itemNumber := le.getListItemNumber(node)
+		return formatListNumber(itemNumber, listStyleType) + "."
+	}
+	// Use custom marker string (e.g., from list-style-type: "\2022")
+	if string(listStyleType) != "" {
+		return string(listStyleType)
+	}
+	return "•"
+}
+
+// markerProperties are the properties a ::marker rule can set (CSS Lists
+// §4.1); the rest of the marker's style is the list item's.
+var markerProperties = []string{
+	"color", "direction", "font-family", "font-size", "font-style",
+	"font-variant", "font-weight", "unicode-bidi", "white-space",
+}
+
+// markerStyle returns the style of a list item's marker: the item's style
+// with what its ::marker rules set, or the item's own style when they set
+// nothing. It also returns the ::marker style, which has the content.
+func (le *LayoutEngine) markerStyle(node *html.Node, style *css.Style) (*css.Style, *css.Style) {
+	pseudoStyle := css.ComputePseudoElementStyle(node, "marker", le.stylesheets, le.media(), style)
+	var markerStyle *css.Style
+	for _, property := range markerProperties {
+		value, ok := pseudoStyle.Get(property)
+		if current, has := style.Get(property); !ok || (has && current == value) {
+			continue
+		}
+		if markerStyle == nil {
+			markerStyle = css.NewStyle()
+			markerStyle.ViewportWidth, markerStyle.ViewportHeight, markerStyle.RootFontSize = style.ViewportWidth, style.ViewportHeight, style.RootFontSize
+			markerStyle.Fonts = style.Fonts
+			for p, v := range style.Properties {
+				markerStyle.Properties[p] = v
+			}
+		}
+		markerStyle.Set(property, value)
+	}
+	if markerStyle == nil {
+		return style, pseudoStyle
+	}
+	return markerStyle, pseudoStyle
+}
+
+// listStyleImageLoads reports whether a list-style-image can be loaded; when
+// it can't, the list-style-type marker is used instead.
+func (le *LayoutEngine) listStyleImageLoads(src string) bool {
+	_, _, err := images.GetImageDimensionsWithFetcher(le.fetchContext(), le.resolveImageURI(src), le.imageFetcher)
+	return err == nil
+}
+
 func (le *LayoutEngine) hasPseudoElements(node *html.Node, computedStyles map[*html.Node]*css.Style) bool {
 	parentStyle := computedStyles[node]
 
 	// Check ::before
-	beforeStyle := css.ComputePseudoElementStyle(node, "before", le.stylesheets, le.viewport.width, le.viewport.height, parentStyle)
+	beforeStyle := css.ComputePseudoElementStyle(node, "before", le.stylesheets, le.media(), parentStyle)
 	if contentValues, hasContent := beforeStyle.GetContentValues(); hasContent && len(contentValues) > 0 {
 		return true
 	}
 
 	// Check ::after
-	afterStyle := css.ComputePseudoElementStyle(node, "after", le.stylesheets, le.viewport.width, le.viewport.height, parentStyle)
+	afterStyle := css.ComputePseudoElementStyle(node, "after", le.stylesheets, le.media(), parentStyle)
 	if contentValues, hasContent := afterStyle.GetContentValues(); hasContent && len(contentValues) > 0 {
 		return true
 	}
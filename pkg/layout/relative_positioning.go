@@ -0,0 +1,52 @@
+package layout
+
+import (
+	"louis14/pkg/css"
+	"louis14/pkg/html"
+)
+
+// Phase 4: Relative positioning logic
+
+// relativeOffset returns how far position: relative moves a box from its
+// place in the flow (CSS 2.1 §9.4.3): top wins over bottom, and left over
+// right. Boxes that aren't relatively positioned don't move.
+func relativeOffset(style *css.Style) (dx, dy float64) {
+	if style == nil || style.GetPosition() != css.PositionRelative {
+		return 0, 0
+	}
+	offset := style.GetPositionOffset()
+	if offset.HasTop {
+		dy = offset.Top
+	} else if offset.HasBottom {
+		dy = -offset.Bottom
+	}
+	if offset.HasLeft {
+		dx = offset.Left
+	} else if offset.HasRight {
+		dx = -offset.Right
+	}
+	return dx, dy
+}
+
+// inlineAncestorsOffset returns how far the relatively positioned inlines
+// between a block and its containing block move it. A block inside an
+// inline is laid out beside the inline's pieces, not in it, but still moves
+// with it (CSS 2.1 §9.2.1.1).
+func inlineAncestorsOffset(node, container *html.Node, computedStyles map[*html.Node]*css.Style) (dx, dy float64) {
+	for n := node.Parent; n != nil && n != container; n = n.Parent {
+		ndx, ndy := relativeOffset(computedStyles[n])
+		dx += ndx
+		dy += ndy
+	}
+	return dx, dy
+}
+
+// applyRelativeOffset moves a relatively positioned box and its descendants
+// from their place in the flow. Layouts that place a box after laying it
+// out call it once the place is final: the other boxes were laid out as if
+// it hadn't moved, and the absolutely positioned boxes it contains move
+// with it.
+func applyRelativeOffset(box *Box) {
+	dx, dy := relativeOffset(box.Style)
+	translateBox(box, dx, dy)
+}
@@ -0,0 +1,116 @@
+package layout
+
+import (
+	"louis14/pkg/css"
+	"louis14/pkg/html"
+)
+
+// Scroll containers (CSS Overflow 3 §3)
+//
+// A box with overflow: scroll or auto clips its content and scrolls it
+// vertically. The scroll offset is engine state kept per element, like the
+// :hover state, so it survives re-layout. Layout places content unscrolled,
+// which keeps incremental layout's records independent of the offset; then
+// applyScrollOffsets measures each scroll container's content and moves it up
+// by the offset, clamped to the scrollable range. overflow: scroll always
+// reserves a gutter of ScrollbarWidth for the scrollbar at the right of the
+// padding box; overflow: auto draws its scrollbar over the content when the
+// content overflows.
+
+// ScrollbarWidth is the width of a scroll container's scrollbar.
+const ScrollbarWidth = 12.0
+
+// SetScrollOffset sets how far the content of the scroll container generated
+// by node is scrolled up, applied from the next layout. It is clamped to the
+// scrollable range when applied.
+func (le *LayoutEngine) SetScrollOffset(node *html.Node, offset float64) {
+	if offset <= 0 {
+		delete(le.scrollOffsets, node)
+		return
+	}
+	if le.scrollOffsets == nil {
+		le.scrollOffsets = make(map[*html.Node]float64)
+	}
+	le.scrollOffsets[node] = offset
+}
+
+// ScrollOffset returns the offset set by SetScrollOffset for node.
+func (le *LayoutEngine) ScrollOffset(node *html.Node) float64 {
+	return le.scrollOffsets[node]
+}
+
+// PropagatesOverflowToViewport reports whether box's overflow applies to the
+// viewport instead of the box: the root element's does, and body's does when
+// the root's is visible (CSS 2.1 §11.1.1).
+func PropagatesOverflowToViewport(box *Box) bool {
+	if box.Node == nil {
+		return false
+	}
+	switch box.Node.TagName {
+	case "html":
+		return true
+	case "body":
+		return box.Parent != nil && box.Parent.Node != nil && box.Parent.Node.TagName == "html" &&
+			(box.Parent.Style == nil || box.Parent.Style.GetOverflow() == css.OverflowVisible)
+	}
+	return false
+}
+
+// IsScrollContainer reports whether box scrolls its content: its overflow is
+// scroll or auto and doesn't apply to the viewport.
+func IsScrollContainer(box *Box) bool {
+	if box.Style == nil {
+		return false
+	}
+	overflow := box.Style.GetOverflow()
+	return (overflow == css.OverflowScroll || overflow == css.OverflowAuto) && !PropagatesOverflowToViewport(box)
+}
+
+// MaxScrollTop returns how far a scroll container's content can be scrolled
+// up: the amount by which it overflows the padding box.
+func (b *Box) MaxScrollTop() float64 {
+	return max(0, b.ScrollHeight-(b.Height-b.Border.Top-b.Border.Bottom))
+}
+
+// applyScrollOffsets measures the content of every scroll container in boxes
+// and moves it up by the container's scroll offset.
+func (le *LayoutEngine) applyScrollOffsets(boxes []*Box) {
+	for _, box := range boxes {
+		if IsScrollContainer(box) {
+			box.ScrollHeight = scrollHeight(box)
+			box.ScrollTop = min(le.scrollOffsets[box.Node], box.MaxScrollTop())
+			if box.ScrollTop > 0 {
+				for _, lb := range box.LineBoxes {
+					lb.Y -= box.ScrollTop
+				}
+				for _, child := range box.Children {
+					translateBox(child, 0, -box.ScrollTop)
+				}
+			}
+		}
+		le.applyScrollOffsets(box.Children)
+	}
+}
+
+// scrollHeight returns the height of a box's padding box extended to hold
+// its content: the margin boxes of its descendants and, below them, its
+// bottom padding. Content inside descendants that clip their own overflow
+// and fixed boxes don't count.
+func scrollHeight(box *Box) float64 {
+	top := box.Y + box.Border.Top
+	bottom := box.Y + box.Height - box.Border.Bottom
+	var walk func(b *Box)
+	walk = func(b *Box) {
+		for _, child := range b.Children {
+			if child.Position == css.PositionFixed {
+				continue
+			}
+			bottom = max(bottom, child.Y+child.Height+child.Margin.Bottom+box.Padding.Bottom)
+			if child.Style == nil || child.Style.GetOverflow() == css.OverflowVisible {
+				walk(child)
+			}
+		}
+	}
+	walk(box)
+	return bottom - top
+}
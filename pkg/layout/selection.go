@@ -0,0 +1,169 @@
+package layout
+
+import (
+	"math"
+	"strings"
+
+	"louis14/pkg/css"
+	"louis14/pkg/text"
+)
+
+// TextPosition is a position in the laid-out text, between two
+// characters: before the Index'th character of the Box'th box returned by
+// TextBoxes. A selection runs between two positions.
+type TextPosition struct {
+	Box   int
+	Index int
+}
+
+// Before reports whether p comes before q in document order.
+func (p TextPosition) Before(q TextPosition) bool {
+	return p.Box < q.Box || p.Box == q.Box && p.Index < q.Index
+}
+
+// HitTestText returns the text position nearest the document point (x, y)
+// in textBoxes, as returned by TextBoxes. The point selects the line whose
+// boxes span its y, and the character boundary nearest its x on the
+// nearest box of that line. A point between lines selects the start of
+// the next line, and one below all the text selects its end. It returns
+// false if there is no text.
+func HitTestText(textBoxes []*Box, x, y float64) (TextPosition, bool) {
+	if len(textBoxes) == 0 {
+		return TextPosition{}, false
+	}
+	best, bestDistance := -1, math.Inf(1)
+	for i, box := range textBoxes {
+		if y < box.Y || y >= box.Y+box.Height {
+			continue
+		}
+		distance := 0.0
+		if x < box.X {
+			distance = box.X - x
+		} else if x > box.X+box.Width {
+			distance = x - box.X - box.Width
+		}
+		if distance < bestDistance {
+			best, bestDistance = i, distance
+		}
+	}
+	if best < 0 {
+		for i, box := range textBoxes {
+			if box.Y > y {
+				return TextPosition{Box: i}, true
+			}
+		}
+		last := len(textBoxes) - 1
+		return TextPosition{Box: last, Index: len([]rune(textBoxes[last].Node.Text))}, true
+	}
+	box := textBoxes[best]
+	return TextPosition{Box: best, Index: nearestBoundary(glyphOffsets(box.Node.Text, box.Style), x-box.X)}, true
+}
+
+// SelectionRects returns the rectangles, in the form FindText returns its
+// matches, of the text between positions a and b, in either order.
+func SelectionRects(textBoxes []*Box, a, b TextPosition) []TextMatch {
+	start, end, ok := selectionRange(textBoxes, a, b)
+	if !ok {
+		return nil
+	}
+	var rects []TextMatch
+	for i := start.Box; i <= end.Box; i++ {
+		box := textBoxes[i]
+		offsets := glyphOffsets(box.Node.Text, box.Style)
+		from, to := 0, len(offsets)-1
+		if i == start.Box {
+			from = start.Index
+		}
+		if i == end.Box {
+			to = end.Index
+		}
+		if from >= to {
+			continue
+		}
+		rects = append(rects, TextMatch{
+			Box:    box,
+			X:      box.X + offsets[from],
+			Y:      box.Y,
+			Width:  offsets[to] - offsets[from],
+			Height: box.Height,
+		})
+	}
+	return rects
+}
+
+// SelectedText returns the text between positions a and b, in either
+// order. Lines of the same block are joined by a space, as the white space
+// they were broken at was, and lines of different blocks by a newline.
+func SelectedText(textBoxes []*Box, a, b TextPosition) string {
+	start, end, ok := selectionRange(textBoxes, a, b)
+	if !ok {
+		return ""
+	}
+	var sb strings.Builder
+	for i := start.Box; i <= end.Box; i++ {
+		box := textBoxes[i]
+		runes := []rune(box.Node.Text)
+		from, to := 0, len(runes)
+		if i == start.Box {
+			from = start.Index
+		}
+		if i == end.Box {
+			to = end.Index
+		}
+		if i > start.Box {
+			if prev := textBoxes[i-1]; box.Y >= prev.Y+prev.Height {
+				if box.Parent == prev.Parent {
+					sb.WriteByte(' ')
+				} else {
+					sb.WriteByte('\n')
+				}
+			}
+		}
+		sb.WriteString(string(runes[from:to]))
+	}
+	return sb.String()
+}
+
+// selectionRange orders positions a and b and clamps them to textBoxes.
+// It returns false if they select no text.
+func selectionRange(textBoxes []*Box, a, b TextPosition) (start, end TextPosition, ok bool) {
+	if b.Before(a) {
+		a, b = b, a
+	}
+	clamp := func(p TextPosition) TextPosition {
+		p.Box = max(0, min(p.Box, len(textBoxes)-1))
+		p.Index = max(0, min(p.Index, len([]rune(textBoxes[p.Box].Node.Text))))
+		return p
+	}
+	if len(textBoxes) == 0 {
+		return a, b, false
+	}
+	a, b = clamp(a), clamp(b)
+	return a, b, a.Before(b)
+}
+
+// glyphOffsets returns the character boundary offsets of s in the font
+// selected by style, with its letter-spacing.
+func glyphOffsets(s string, style *css.Style) []float64 {
+	offsets := text.GlyphOffsets(style.Fonts, s, style.GetFontSize(), style.GetFontFamilies(),
+		style.GetFontWeight() == css.FontWeightBold, style.GetFontStyle() == css.FontStyleItalic,
+		style.IsMonospaceFamily(), style.IsAhemFamily())
+	if ls := style.GetLetterSpacing(); ls != 0 {
+		// Spacing follows every character but the last
+		for i := 1; i < len(offsets); i++ {
+			offsets[i] += ls * float64(min(i, len(offsets)-2))
+		}
+	}
+	return offsets
+}
+
+// nearestBoundary returns the index of the offset nearest x.
+func nearestBoundary(offsets []float64, x float64) int {
+	best := 0
+	for i, offset := range offsets {
+		if math.Abs(offset-x) < math.Abs(offsets[best]-x) {
+			best = i
+		}
+	}
+	return best
+}
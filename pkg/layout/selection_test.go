@@ -0,0 +1,80 @@
+package layout
+
+import (
+	"testing"
+
+	"louis14/pkg/html"
+)
+
+const selectionTestHTML = `<html><body style="margin:0;font-family:Ahem;font-size:10px;line-height:10px">
+	<p style="margin:0;width:100px">find me and <b>find</b> me</p>
+	<p style="margin:0">two</p>
+</body></html>`
+
+func layoutSelectionTest(t *testing.T) []*Box {
+	doc, err := html.Parse(selectionTestHTML)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return TextBoxes(layoutDoc(t, NewLayoutEngine(400, 600), doc))
+}
+
+func TestHitTestText(t *testing.T) {
+	textBoxes := layoutSelectionTest(t)
+	tests := []struct {
+		name string
+		x, y float64
+		want TextPosition
+	}{
+		{"start of the first line", 1, 5, TextPosition{0, 0}},
+		{"nearest boundary", 26, 5, TextPosition{0, 3}},
+		{"past the end of a line", 300, 5, TextPosition{0, 7}},
+		{"second box on a line", 56, 15, TextPosition{2, 2}},
+		{"second paragraph", 12, 35, TextPosition{4, 1}},
+		{"below the text", 5, 500, TextPosition{4, 3}},
+	}
+	for _, tt := range tests {
+		got, ok := HitTestText(textBoxes, tt.x, tt.y)
+		if !ok || got != tt.want {
+			t.Errorf("%s: expected %+v, got %+v, %v", tt.name, tt.want, got, ok)
+		}
+	}
+	if _, ok := HitTestText(nil, 0, 0); ok {
+		t.Error("expected no position without text")
+	}
+}
+
+func TestSelectedText(t *testing.T) {
+	textBoxes := layoutSelectionTest(t)
+	tests := []struct {
+		a, b TextPosition
+		want string
+	}{
+		{TextPosition{0, 5}, TextPosition{0, 7}, "me"},
+		{TextPosition{0, 0}, TextPosition{3, 2}, "find me and find me"},
+		{TextPosition{4, 3}, TextPosition{3, 0}, "me\ntwo"}, // Reversed, across blocks
+		{TextPosition{1, 2}, TextPosition{1, 2}, ""},
+	}
+	for _, tt := range tests {
+		if got := SelectedText(textBoxes, tt.a, tt.b); got != tt.want {
+			t.Errorf("%+v to %+v: expected %q, got %q", tt.a, tt.b, tt.want, got)
+		}
+	}
+}
+
+func TestSelectionRects(t *testing.T) {
+	textBoxes := layoutSelectionTest(t)
+	rects := SelectionRects(textBoxes, TextPosition{0, 5}, TextPosition{1, 2})
+	want := []struct{ x, y, w float64 }{
+		{50, 0, 20}, // "me"
+		{0, 10, 20}, // "an"
+	}
+	if len(rects) != len(want) {
+		t.Fatalf("expected %d rects, got %+v", len(want), rects)
+	}
+	for i, w := range want {
+		if r := rects[i]; r.X != w.x || r.Y != w.y || r.Width != w.w || r.Height != 10 {
+			t.Errorf("rect %d: expected (%.0f,%.0f %.0fx10), got (%.1f,%.1f %.1fx%.1f)", i, w.x, w.y, w.w, r.X, r.Y, r.Width, r.Height)
+		}
+	}
+}
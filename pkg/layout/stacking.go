@@ -50,8 +50,21 @@ func BoxCreatesStackingContext(box *Box) bool {
 		}
 	}
 
+	// Sticky elements always create a stacking context (CSS Positioned Layout 3 §3.4)
+	if box.Position == css.PositionSticky {
+		return true
+	}
+
+	// Flex and grid items with z-index != auto create a stacking context even
+	// when static (CSS Flexbox 1 §4.3, CSS Grid 1 §9.5)
+	if isFlexOrGridItem(box) {
+		if zStr, ok := box.Style.Get("z-index"); ok && zStr != "auto" && zStr != "" {
+			return true
+		}
+	}
+
 	// Elements with opacity < 1 create a stacking context
-	if opacity, ok := box.Style.Get("opacity"); ok && opacity != "1" && opacity != "" {
+	if _, ok := box.Style.Get("opacity"); ok && box.Style.GetOpacity() < 1 {
 		return true
 	}
 
@@ -63,6 +76,18 @@ func BoxCreatesStackingContext(box *Box) bool {
 	return false
 }
 
+// isFlexOrGridItem returns true if the box's parent is a flex or grid container.
+func isFlexOrGridItem(box *Box) bool {
+	if box.Parent == nil || box.Parent.Style == nil {
+		return false
+	}
+	switch display, _ := box.Parent.Style.Get("display"); display {
+	case "flex", "inline-flex", "grid", "inline-grid":
+		return true
+	}
+	return false
+}
+
 // IsPositioned returns true if the box has position other than static.
 func IsPositioned(box *Box) bool {
 	if box == nil {
@@ -70,7 +95,8 @@ func IsPositioned(box *Box) bool {
 	}
 	return box.Position == css.PositionAbsolute ||
 		box.Position == css.PositionFixed ||
-		box.Position == css.PositionRelative
+		box.Position == css.PositionRelative ||
+		box.Position == css.PositionSticky
 }
 
 // IsFloat returns true if the box is floated.
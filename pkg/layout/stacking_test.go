@@ -0,0 +1,74 @@
+package layout
+
+import (
+	"testing"
+
+	"louis14/pkg/css"
+	"louis14/pkg/html"
+)
+
+func TestBoxCreatesStackingContext(t *testing.T) {
+	flex := &Box{Style: css.ParseInlineStyle("display: flex")}
+	tests := []struct {
+		name   string
+		box    *Box
+		expect bool
+	}{
+		{"static z-index", &Box{Style: css.ParseInlineStyle("z-index: 1")}, false},
+		{"relative z-index", &Box{Style: css.ParseInlineStyle("position: relative; z-index: 0"), Position: css.PositionRelative}, true},
+		{"relative z-index auto", &Box{Style: css.ParseInlineStyle("position: relative"), Position: css.PositionRelative}, false},
+		{"flex item z-index", &Box{Style: css.ParseInlineStyle("z-index: 1"), Parent: flex}, true},
+		{"opacity 0.5", &Box{Style: css.ParseInlineStyle("opacity: 0.5")}, true},
+		{"opacity 1.0", &Box{Style: css.ParseInlineStyle("opacity: 1.0")}, false},
+		{"transform", &Box{Style: css.ParseInlineStyle("transform: rotate(10deg)")}, true},
+	}
+
+	for _, tt := range tests {
+		if got := BoxCreatesStackingContext(tt.box); got != tt.expect {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expect, got)
+		}
+	}
+}
+
+func TestSplitInlineOpacityGroup(t *testing.T) {
+	doc, err := html.Parse(`<html><body style="margin:0">
+		<span id="span" style="opacity:0.5">a<div id="block" style="height:10px;opacity:0.5"></div>b</span>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes := layoutDoc(t, NewLayoutEngine(400, 600), doc)
+	block := boxFinder(t, boxes)("block")
+
+	// The block keeps its own opacity, and is composited with the span's
+	// continuations in the span's group, which has the span's opacity
+	if got := block.Style.GetOpacity(); got != 0.5 {
+		t.Errorf("block opacity = %v, want its own 0.5", got)
+	}
+	group := block.OpacityGroup
+	if group == nil || group.Style.GetOpacity() != 0.5 || group.Node != block.Node.Parent {
+		t.Fatalf("block group = %+v, want the span's, with opacity 0.5", group)
+	}
+	var spans []*Box
+	var walk func(boxes []*Box)
+	walk = func(boxes []*Box) {
+		for _, b := range boxes {
+			if b.Node != nil && b.Node.Attributes["id"] == "span" {
+				spans = append(spans, b)
+			}
+			walk(b.Children)
+		}
+	}
+	walk(boxes)
+	if len(spans) != 2 {
+		t.Fatalf("got %d span boxes, want a continuation on each side of the block", len(spans))
+	}
+	for _, span := range spans {
+		if span.OpacityGroup != group || span.Style.GetOpacity() != 1 {
+			t.Errorf("continuation group = %p, opacity %v; want group %p, opacity 1", span.OpacityGroup, span.Style.GetOpacity(), group)
+		}
+	}
+	if len(group.Children) != 3 || group.Children[1] != block {
+		t.Errorf("group has %d pieces, want the two continuations and the block between them", len(group.Children))
+	}
+}
@@ -0,0 +1,98 @@
+package layout
+
+import "louis14/pkg/css"
+
+// Sticky positioning (CSS Positioned Layout 3 §3.4)
+//
+// A sticky box is laid out in normal flow, then shifted so that it stays
+// within its inset rectangle of the scrollport while the page scrolls. The
+// shift never moves the box outside its containing block (the parent's
+// content box). The scrollport is the viewport scrolled by scrollY unless an
+// ancestor clips its overflow, in which case that ancestor's padding box is
+// used; a scroll container's content has already been moved by its offset.
+
+// applyStickyPositioning walks the box tree top-down and offsets every
+// position: sticky box for the engine's current scrollY.
+func (le *LayoutEngine) applyStickyPositioning(boxes []*Box) {
+	for _, box := range boxes {
+		le.applyStickyToBox(box)
+	}
+}
+
+func (le *LayoutEngine) applyStickyToBox(box *Box) {
+	if box.Position == css.PositionSticky && box.Style != nil && box.Parent != nil {
+		if dy := le.stickyOffset(box); dy != 0 {
+			box.Y += dy
+			le.shiftChildren(box, 0, dy)
+		}
+	}
+	for _, child := range box.Children {
+		le.applyStickyToBox(child)
+	}
+}
+
+// stickyOffset returns the vertical shift for a sticky box.
+func (le *LayoutEngine) stickyOffset(box *Box) float64 {
+	portTop, portBottom := le.stickyScrollport(box)
+
+	insetTop, hasTop := stickyInset(box.Style, "top", portBottom-portTop)
+	insetBottom, hasBottom := stickyInset(box.Style, "bottom", portBottom-portTop)
+	if !hasTop && !hasBottom {
+		return 0
+	}
+
+	// Containing block: the parent's content box
+	parent := box.Parent
+	cbTop := parent.Y + parent.Border.Top + parent.Padding.Top
+	cbBottom := parent.Y + parent.Height - parent.Border.Bottom - parent.Padding.Bottom
+
+	// Margin box of the sticky element in its normal-flow position
+	top := box.Y - box.Margin.Top
+	bottom := box.Y + box.Height + box.Margin.Bottom
+
+	dy := 0.0
+	if hasTop && box.Y < portTop+insetTop {
+		// Push down, but not past the bottom of the containing block
+		dy = portTop + insetTop - box.Y
+		if limit := cbBottom - bottom; dy > limit {
+			dy = limit
+		}
+		if dy < 0 {
+			dy = 0
+		}
+	}
+	if hasBottom && box.Y+box.Height+dy > portBottom-insetBottom {
+		// Pull up, but not past the top of the containing block
+		up := box.Y + box.Height + dy - (portBottom - insetBottom)
+		if limit := top + dy - cbTop; up > limit {
+			up = limit
+		}
+		if up > 0 {
+			dy -= up
+		}
+	}
+	return dy
+}
+
+// stickyScrollport returns the top and bottom of the nearest scrollport in
+// layout coordinates.
+func (le *LayoutEngine) stickyScrollport(box *Box) (top, bottom float64) {
+	for anc := box.Parent; anc != nil; anc = anc.Parent {
+		if anc.Style != nil && anc.Style.GetOverflow() != css.OverflowVisible {
+			return anc.Y + anc.Border.Top, anc.Y + anc.Height - anc.Border.Bottom
+		}
+	}
+	return le.scrollY, le.scrollY + le.viewport.height
+}
+
+// stickyInset resolves a top/bottom inset, treating percentages relative to
+// the scrollport height. Returns false for auto.
+func stickyInset(style *css.Style, property string, portHeight float64) (float64, bool) {
+	if v, ok := style.GetLength(property); ok {
+		return v, true
+	}
+	if pct, ok := style.GetPercentage(property); ok {
+		return portHeight * pct / 100, true
+	}
+	return 0, false
+}
@@ -0,0 +1,176 @@
+package layout
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Layout tracing
+//
+// Tracing is off by default. SetTracer installs a Tracer that the engine
+// reports its decisions to, tagged with the subsystem that made them and a
+// level: TraceInfo for one line per box, float, table or flex container,
+// or web font that failed to load, and TraceDebug for the inline item lists and line breaks of the
+// multi-pass inline layout. The engine asks Enabled before building a
+// message, so a disabled subsystem costs a single call.
+
+// TraceLevel is the verbosity of a trace message.
+type TraceLevel int
+
+const (
+	TraceInfo  TraceLevel = iota // One line per laid out box, float, table or flex container
+	TraceDebug                   // Inline item lists and line breaks
+)
+
+// String returns the name of the level.
+func (l TraceLevel) String() string {
+	switch l {
+	case TraceInfo:
+		return "info"
+	case TraceDebug:
+		return "debug"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// TraceSubsystem names the part of the engine a trace message comes from.
+type TraceSubsystem string
+
+const (
+	TraceLayout TraceSubsystem = "layout" // Block layout of each element
+	TraceInline TraceSubsystem = "inline" // Inline items and line breaking
+	TraceFloat  TraceSubsystem = "float"  // Float placement
+	TraceTable  TraceSubsystem = "table"  // Table layout
+	TraceFlex   TraceSubsystem = "flex"   // Flex layout
+	TraceFont   TraceSubsystem = "font"   // @font-face loading
+)
+
+// Tracer receives trace messages from a LayoutEngine.
+type Tracer interface {
+	// Enabled reports whether messages of the subsystem at the level are
+	// wanted; Trace is only called for those.
+	Enabled(subsystem TraceSubsystem, level TraceLevel) bool
+	// Trace records one message.
+	Trace(subsystem TraceSubsystem, level TraceLevel, msg string)
+}
+
+// writerTracer writes trace messages as lines of text.
+type writerTracer struct {
+	mu         sync.Mutex
+	w          io.Writer
+	level      TraceLevel
+	subsystems map[TraceSubsystem]bool // nil when every subsystem is traced
+}
+
+// NewWriterTracer returns a Tracer that writes each message up to the given
+// level to w as a line prefixed with its subsystem. With no subsystems,
+// every subsystem is traced.
+func NewWriterTracer(w io.Writer, level TraceLevel, subsystems ...TraceSubsystem) Tracer {
+	t := &writerTracer{w: w, level: level}
+	if len(subsystems) > 0 {
+		t.subsystems = make(map[TraceSubsystem]bool, len(subsystems))
+		for _, s := range subsystems {
+			t.subsystems[s] = true
+		}
+	}
+	return t
+}
+
+func (t *writerTracer) Enabled(subsystem TraceSubsystem, level TraceLevel) bool {
+	return level <= t.level && (t.subsystems == nil || t.subsystems[subsystem])
+}
+
+func (t *writerTracer) Trace(subsystem TraceSubsystem, level TraceLevel, msg string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.w, "[%s] %s\n", subsystem, msg)
+}
+
+// SetTracer installs the tracer that layout decisions are reported to, or
+// turns tracing off when t is nil.
+func (le *LayoutEngine) SetTracer(t Tracer) {
+	le.tracer = t
+}
+
+// tracing reports whether messages of the subsystem at the level are traced.
+func (le *LayoutEngine) tracing(subsystem TraceSubsystem, level TraceLevel) bool {
+	return le.tracer != nil && le.tracer.Enabled(subsystem, level)
+}
+
+// tracef formats and traces a message if the subsystem is traced at the level.
+func (le *LayoutEngine) tracef(subsystem TraceSubsystem, level TraceLevel, format string, args ...interface{}) {
+	if le.tracing(subsystem, level) {
+		le.tracer.Trace(subsystem, level, fmt.Sprintf(format, args...))
+	}
+}
+
+// traceBox traces the geometry layoutNode gave an element's box; reused is
+// true when incremental layout took it from the previous layout.
+func (le *LayoutEngine) traceBox(box *Box, availableWidth float64, reused bool) {
+	if box == nil || !le.tracing(TraceLayout, TraceInfo) {
+		return
+	}
+	suffix := ""
+	if reused {
+		suffix = " (reused)"
+	}
+	le.tracer.Trace(TraceLayout, TraceInfo, fmt.Sprintf("%s at (%.1f, %.1f) %.1fx%.1f in %.1f%s",
+		getNodeName(box.Node), box.X, box.Y, box.Width, box.Height, availableWidth, suffix))
+}
+
+// traceInlineItems traces the item list collected for inline content.
+func (le *LayoutEngine) traceInlineItems(items []*InlineItem) {
+	if !le.tracing(TraceInline, TraceDebug) {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d items", len(items))
+	for i, item := range items {
+		fmt.Fprintf(&b, "\n  %d: %s %s w=%.1f h=%.1f", i, item.Type, getNodeName(item.Node), item.Width, item.Height)
+		if item.Type == InlineItemText {
+			fmt.Fprintf(&b, " %q", truncateString(item.Text, 40))
+		}
+	}
+	le.tracer.Trace(TraceInline, TraceDebug, b.String())
+}
+
+// traceLineBreaks traces where inline content was broken into lines.
+func (le *LayoutEngine) traceLineBreaks(lines []*LineInfo) {
+	if !le.tracing(TraceInline, TraceDebug) {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d lines", len(lines))
+	for i, line := range lines {
+		fmt.Fprintf(&b, "\n  %d: y=%.1f h=%.1f items=%d", i, line.Y, line.Height, len(line.Items))
+		for _, item := range line.Items {
+			if item.Type == InlineItemText {
+				fmt.Fprintf(&b, " %q", truncateString(item.Text, 40))
+			}
+		}
+	}
+	le.tracer.Trace(TraceInline, TraceDebug, b.String())
+}
+
+// String returns the name of the item type.
+func (t InlineItemType) String() string {
+	switch t {
+	case InlineItemText:
+		return "text"
+	case InlineItemOpenTag:
+		return "open"
+	case InlineItemCloseTag:
+		return "close"
+	case InlineItemAtomic:
+		return "atomic"
+	case InlineItemFloat:
+		return "float"
+	case InlineItemControl:
+		return "control"
+	case InlineItemBlockChild:
+		return "block"
+	}
+	return fmt.Sprintf("item(%d)", int(t))
+}
@@ -0,0 +1,51 @@
+package layout
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"louis14/pkg/html"
+)
+
+func layoutWithTracer(t *testing.T, tracer Tracer) {
+	t.Helper()
+	doc, err := html.Parse(`<html><body style="margin:0;font:10px Ahem">
+		<div style="float:left;width:20px;height:20px"></div>
+		<p style="width:60px">aaaa bbbb</p>
+		<div style="display:flex"><span>a</span></div>
+		<table><tr><td>a</td></tr></table>
+	</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	le := NewLayoutEngine(400, 600)
+	le.SetTracer(tracer)
+	layoutDoc(t, le, doc)
+}
+
+func TestTracer_Subsystems(t *testing.T) {
+	var buf bytes.Buffer
+	layoutWithTracer(t, NewWriterTracer(&buf, TraceDebug))
+	out := buf.String()
+	for _, want := range []string{"[layout] <p>", "[float] left <div>", "[flex] <div>", "[table] <table>", "[inline] ", `"aaaa bbbb"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected trace to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestTracer_Filtering(t *testing.T) {
+	var buf bytes.Buffer
+	layoutWithTracer(t, NewWriterTracer(&buf, TraceInfo, TraceFloat, TraceInline))
+	out := buf.String()
+	if !strings.Contains(out, "[float] ") {
+		t.Errorf("expected float messages, got:\n%s", out)
+	}
+	// Other subsystems are filtered out, and inline only traces at the debug level
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if !strings.HasPrefix(line, "[float] ") {
+			t.Errorf("unexpected trace line %q", line)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package layout
+
+import (
+	"strings"
+	"time"
+
+	"louis14/pkg/css"
+	"louis14/pkg/html"
+)
+
+// CSS transitions (CSS Transitions 1)
+//
+// Like scroll offsets, running transitions are engine state kept per
+// element, so they survive re-layout. Each Layout compares the newly computed
+// style of every element with the one computed by the previous Layout; when
+// a property the element transitions changes, a transition starts from the
+// value shown last to the new value. While it runs, Layout replaces the
+// computed value with the value interpolated at the engine's clock, and
+// children that inherit the property inherit the interpolated value. The
+// clock only moves when Advance is called, so layouts of a page that is not
+// being animated show the values transitions start from.
+
+// runningTransition is a transition of one property of an element.
+type runningTransition struct {
+	from, to   string
+	start      time.Duration // Engine clock when it started, before its delay
+	transition css.Transition
+}
+
+// valueAt returns the value of the transition at the clock time now, and
+// whether the transition has ended.
+func (t *runningTransition) valueAt(now time.Duration) (string, bool) {
+	elapsed := now - t.start - t.transition.Delay
+	if elapsed >= t.transition.Duration {
+		return t.to, true
+	}
+	if elapsed < 0 {
+		return t.from, false
+	}
+	progress := t.transition.TimingFunction.Progress(float64(elapsed) / float64(t.transition.Duration))
+	if value, ok := css.InterpolateValue(t.from, t.to, progress); ok {
+		return value, false
+	}
+	return t.to, true
+}
+
+// transitionInitialValues holds the values that animatable properties
+// absent from a style have, so that, for example, opacity can transition
+// from an element that doesn't set it.
+var transitionInitialValues = map[string]string{
+	"opacity": "1", "background-color": "transparent", "transform": "none",
+	"margin-top": "0", "margin-right": "0", "margin-bottom": "0", "margin-left": "0",
+	"padding-top": "0", "padding-right": "0", "padding-bottom": "0", "padding-left": "0",
+}
+
+// Advance moves the engine's clock forward by dt. It returns true if
+// transitions are running, so the page must be laid out again to show
+// their new values.
+func (le *LayoutEngine) Advance(dt time.Duration) bool {
+	le.clock += dt
+	return le.Animating()
+}
+
+// Animating reports whether any transition is running.
+func (le *LayoutEngine) Animating() bool {
+	return len(le.transitions) > 0
+}
+
+// applyTransitions starts the transitions of the properties whose computed
+// values changed since the last Layout and replaces the values of running
+// transitions in computedStyles with their current values.
+func (le *LayoutEngine) applyTransitions(root *html.Node, computedStyles map[*html.Node]*css.Style) {
+	prev := le.transitionStyles
+	le.transitionStyles = &transitionStyles{styles: computedStyles, replaced: make(map[*html.Node]map[string]string)}
+	if prev == nil {
+		return
+	}
+	for node := range le.transitions {
+		if computedStyles[node] == nil {
+			delete(le.transitions, node)
+		}
+	}
+	le.transitionNode(root, prev, nil)
+}
+
+// transitionStyles holds the styles computed by a Layout and the computed
+// values of the properties whose values were replaced by transitions.
+type transitionStyles struct {
+	styles   map[*html.Node]*css.Style
+	replaced map[*html.Node]map[string]string
+}
+
+// set replaces the value of property on node's style with the value shown.
+func (ts *transitionStyles) set(node *html.Node, property, value string) {
+	style := ts.styles[node]
+	if _, ok := ts.replaced[node][property]; !ok {
+		if ts.replaced[node] == nil {
+			ts.replaced[node] = make(map[string]string)
+		}
+		ts.replaced[node][property], _ = style.Get(property)
+	}
+	style.Set(property, value)
+}
+
+// value returns the computed value of property on node, or the value it has
+// when absent if that is known.
+func (ts *transitionStyles) value(node *html.Node, property string) (string, bool) {
+	if value, ok := ts.replaced[node][property]; ok {
+		return value, true
+	}
+	style := ts.styles[node]
+	if style == nil {
+		return "", false
+	}
+	if value, ok := style.Get(property); ok {
+		return value, true
+	}
+	value, ok := transitionInitialValues[property]
+	return value, ok
+}
+
+// inheritedTransition is the value an inherited property is shown with
+// while it transitions on an ancestor.
+type inheritedTransition struct {
+	target, value string
+}
+
+// transitionNode applies transitions to node and its descendants. inherited
+// holds the inherited properties transitioning on node's ancestors.
+func (le *LayoutEngine) transitionNode(node *html.Node, prevStyles *transitionStyles, inherited map[string]inheritedTransition) {
+	cur := le.transitionStyles
+	style := cur.styles[node]
+	if style == nil {
+		for _, child := range node.Children {
+			le.transitionNode(child, prevStyles, inherited)
+		}
+		return
+	}
+
+	prev := prevStyles.styles[node]
+	running := le.transitions[node]
+	properties := make(map[string]bool)
+	for property := range running {
+		properties[property] = true
+	}
+	if prev != nil && len(style.GetTransitions()) > 0 {
+		for property := range style.Properties {
+			properties[property] = true
+		}
+		for property := range prev.Properties {
+			properties[property] = true
+		}
+	}
+
+	var shown map[string]inheritedTransition
+	for property := range properties {
+		if strings.HasPrefix(property, "transition") || strings.HasPrefix(property, "--") {
+			continue
+		}
+		t := running[property]
+		target, ok := cur.value(node, property)
+		if !ok {
+			delete(running, property)
+			continue
+		}
+		transition, ok := style.TransitionFor(property)
+		if !ok {
+			delete(running, property)
+			continue
+		}
+
+		before := ""
+		if t != nil {
+			before = t.to
+		} else if before, ok = prevStyles.value(node, property); !ok {
+			continue
+		}
+		if target != before {
+			from := before
+			if t != nil {
+				from, _ = t.valueAt(le.clock)
+			}
+			if _, ok := css.InterpolateValue(from, target, 0); !ok {
+				delete(running, property)
+				continue
+			}
+			t = &runningTransition{from: from, to: target, start: le.clock, transition: transition}
+			if running == nil {
+				running = make(map[string]*runningTransition)
+			}
+			running[property] = t
+		}
+		if t == nil {
+			continue
+		}
+
+		value, done := t.valueAt(le.clock)
+		if done {
+			delete(running, property)
+			continue
+		}
+		cur.set(node, property, value)
+		if css.IsInheritedProperty(property) {
+			if shown == nil {
+				shown = make(map[string]inheritedTransition)
+			}
+			shown[property] = inheritedTransition{target: target, value: value}
+		}
+	}
+	// Children inherit the value shown rather than the computed value,
+	// unless they transition the property themselves
+	for property, t := range inherited {
+		if value, _ := style.Get(property); value == t.target && running[property] == nil {
+			cur.set(node, property, t.value)
+		}
+	}
+
+	if len(running) > 0 {
+		if le.transitions == nil {
+			le.transitions = make(map[*html.Node]map[string]*runningTransition)
+		}
+		le.transitions[node] = running
+	} else {
+		delete(le.transitions, node)
+	}
+
+	if len(shown) > 0 {
+		merged := make(map[string]inheritedTransition, len(inherited)+len(shown))
+		for property, t := range inherited {
+			merged[property] = t
+		}
+		for property, t := range shown {
+			merged[property] = t
+		}
+		inherited = merged
+	}
+	for _, child := range node.Children {
+		le.transitionNode(child, prevStyles, inherited)
+	}
+}
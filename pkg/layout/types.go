@@ -1,9 +1,14 @@
 package layout
 
 import (
+	"context"
+	"sync"
+	"time"
+
 	"louis14/pkg/css"
 	"louis14/pkg/html"
 	"louis14/pkg/images"
+	"louis14/pkg/text"
 )
 
 type Box struct {
@@ -23,11 +28,6 @@ type Box struct {
 	ImagePath     string           // Phase 8: Image source path for img elements
 	PseudoContent string           // Phase 11: Content for pseudo-elements
 
-	// Block-in-inline fragment tracking (CSS 2.1 §9.2.1.1)
-	// When a block element breaks an inline element, the inline's border is split
-	IsFirstFragment bool // First part of split inline - has left border, no right border
-	IsLastFragment  bool // Last part of split inline - has right border, no left border
-
 	// New architecture: Fragments for split inline boxes
 	// When non-empty, this box renders as multiple visual regions
 	Fragments []BoxFragment
@@ -37,6 +37,28 @@ type Box struct {
 
 	// Line boxes for block containers with inline content
 	LineBoxes []*LineBox
+
+	// For scroll containers (see IsScrollContainer): the height of the
+	// padding box extended to hold the content, and how far the content is
+	// scrolled up
+	ScrollHeight float64
+	ScrollTop    float64
+
+	// Resolved borders of a table or cell in the collapsing border model
+	// (nil otherwise). Border then holds half of each collapsed width.
+	CollapsedBorder *CollapsedBorder
+
+	// For a piece of an inline split around blocks whose element has
+	// opacity (see block_in_inline.go): the box of the group the pieces
+	// are composited in, whose Children are the pieces. A group inside
+	// another split inline with opacity has that one's group as its own.
+	OpacityGroup *Box
+
+	// Set for boxes with clear (CSS 2.1 §9.5.2): the bottom outer edge of
+	// the floats the box must be placed below, found when it was laid out
+	// (-Inf if there were none), and the clearance that placed it there
+	clearFloor float64
+	clearance  float64
 }
 
 type LayoutEngine struct {
@@ -45,19 +67,51 @@ type LayoutEngine struct {
 		height float64
 	}
 	scrollY        float64             // Scroll offset for fixed positioning (viewport-relative)
+	documentHeight float64             // Height of the document laid out by the last Layout
+	colorScheme    string              // Preferred color scheme for @media (prefers-color-scheme)
+	mediaType      string              // @media type, "screen" (or "") or "print"
 	absoluteBoxes  []*Box              // Phase 4: Track absolutely positioned boxes
 	floats         []FloatInfo         // Phase 5: Track floated elements
 	floatBaseStack []int               // Stack of float base indices for BFC boundaries
 	floatBase      int                 // Current BFC float base index
 	stylesheets    []*css.Stylesheet   // Phase 11: Store stylesheets for pseudo-elements
 	imageFetcher   images.ImageFetcher // Optional fetcher for network images
+	baseURL        string              // Document URL or path that image URIs resolve against
+	canvases       map[string]bool     // canvas: URIs registered by the current layout
+	canvasMu       sync.Mutex          // Guards canvases, which ReleaseCanvases may release from another goroutine
+	fontFetcher    text.FontFetcher    // Optional fetcher for @font-face sources
+	loadedFonts    map[string]bool     // @font-face sources already fetched (family, style, URL)
+	fonts          *text.FontSet       // Fonts loaded from @font-face sources, which computed styles carry
 
 	// CSS Counters support
-	counters map[string][]int // Counter name -> stack of values (for nested scopes)
+	counters    map[string][]int // Counter name -> stack of values (for nested scopes)
+	counterUses int              // Bumped on every counter or list-number access
+
+	// Box tree built by the last Layout (nil before the first)
+	boxTree *BoxTree
+
+	// Incremental re-layout (nil when disabled)
+	incremental *incrementalState
 
-	// NEW ARCHITECTURE: Flag to enable clean multi-pass inline layout
-	// When true, uses LayoutInlineContentToBoxes instead of old single-pass
-	useMultiPass bool
+	// Interaction state for :hover, :active, and :focus (nil when none)
+	hovered *html.Node
+	active  *html.Node
+	focused *html.Node
+
+	// Scroll offsets of scroll containers, by element (see SetScrollOffset)
+	scrollOffsets map[*html.Node]float64
+
+	// Running transitions by element and property, the clock they run on
+	// (see Advance), and the styles computed by the last Layout
+	transitions      map[*html.Node]map[string]*runningTransition
+	clock            time.Duration
+	transitionStyles *transitionStyles
+
+	// Receives trace messages (nil when tracing is off)
+	tracer Tracer
+
+	// Context of the Layout in progress (nil between layouts)
+	ctx context.Context
 }
 
 // Phase 5: FloatInfo tracks information about floated elements
@@ -65,6 +119,10 @@ type FloatInfo struct {
 	Box  *Box
 	Side css.FloatType
 	Y    float64 // Y position where float starts
+
+	// The float's margin box in page coordinates, which content and later
+	// floats flow around
+	Exclusion Exclusion
 }
 
 // Phase 7: InlineContext tracks the current inline layout state
@@ -122,6 +180,7 @@ type ConstraintSpace struct {
 	ExclusionSpace *ExclusionSpace  // Floats affecting inline layout
 	TextAlign      css.TextAlign    // Text alignment for inline content
 	NoWrap         bool             // white-space: nowrap - prevent line breaking
+	TextIndent     float64          // text-indent - offset of the first line
 	// TODO: Add more constraints as needed:
 	// - WritingMode
 	// - IsNewFormattingContext
@@ -212,6 +271,9 @@ type InlineItem struct {
 	// Cached measurements (computed during collection)
 	Width  float64 // Intrinsic width (for atomic items, measured text width)
 	Height float64 // Intrinsic height
+
+	// Resolved bidi embedding level (UAX #9); odd levels are right-to-left
+	BidiLevel int
 }
 
 // LineInfo represents a single line in the new multi-pass architecture.
@@ -221,6 +283,7 @@ type LineInfo struct {
 	Items      []*InlineItem    // Items on this line
 	Constraint *ConstraintSpace // Constraint space for THIS line (includes floats)
 	Height     float64          // Computed line height
+	Indent     float64          // Offset of the line's start (text-indent on the first line)
 }
 
 // LineBreakResult represents the result of line breaking for a single line.
@@ -267,27 +330,36 @@ type InlineLayoutState struct {
 
 // Phase 9: TableCell tracks a cell in a table
 type TableCell struct {
-	Box     *Box
-	RowSpan int
-	ColSpan int
-	RowIdx  int
-	ColIdx  int
-}
-
-// Phase 9: TableRow tracks a row in a table
-type TableRow struct {
-	Box   *Box
-	Cells []*TableCell
+	Box           *Box
+	RowSpan       int
+	ColSpan       int
+	RowIdx        int
+	ColIdx        int
+	ContentHeight float64 // Height of the laid-out content
+	Baseline      float64 // Baseline of the first line, from the top of the content
 }
 
 // Phase 9: TableInfo tracks table layout information
 type TableInfo struct {
-	Rows           []*TableRow
 	NumCols        int
 	ColumnWidths   []float64
 	RowHeights     []float64
 	BorderSpacing  float64
 	BorderCollapse css.BorderCollapse
+	RowStyles      []*css.Style // Styles of the rows, by row index (nil for anonymous rows)
+	TableLayout    css.TableLayout
+	Columns        []*TableColumn // Columns from col and colgroup elements
+	Captions       []*html.Node   // Caption elements, in document order
+	RowBaselines   []float64      // Baselines of the rows, from their tops
+}
+
+// TableColumn tracks a column given by a col element, or by a colgroup
+// without col children (Node nil), and the column group it belongs to
+type TableColumn struct {
+	Node       *html.Node
+	Style      *css.Style
+	Group      *html.Node
+	GroupStyle *css.Style
 }
 
 // FlexItem tracks a flex item during flex layout
@@ -302,7 +374,9 @@ type FlexItem struct {
 	MainPos              float64 // Position along main axis
 	CrossPos             float64 // Position along cross axis
 	Order                int
-	AutoMinMain          float64 // min-width/min-height: auto value (content-based minimum)
+	DocumentIndex        int // Position among the container's items in document order
+	MinMain              float64 // min-width/min-height, or the content-based minimum for auto
+	MaxMain              float64 // max-width/max-height, or +Inf for none
 }
 
 // FlexLine tracks a line of flex items (for wrapping)
@@ -380,26 +454,29 @@ type LayoutMode interface {
 	// ComputeIntrinsicSizes calculates min-content and max-content widths
 	ComputeIntrinsicSizes(le *LayoutEngine, node *html.Node, style *css.Style, computedStyles map[*html.Node]*css.Style) IntrinsicSizes
 
-	// LayoutChildren positions child boxes within the container
-	LayoutChildren(le *LayoutEngine, container *Box, children []*html.Node, availableWidth float64, computedStyles map[*html.Node]*css.Style) []*Box
+	// LayoutChildren lays out the children of a box in the box tree inside
+	// container, the layout box of box (nil for the initial containing block)
+	LayoutChildren(le *LayoutEngine, container *Box, box *BoxTreeNode, availableWidth float64, computedStyles map[*html.Node]*css.Style) []*Box
 }
 
 // BlockLayoutMode implements block formatting context layout
-type BlockLayoutMode struct{}
+type BlockLayoutMode struct {
+	lines *InlineContext // Final state of the lines laid out, for the container's auto height
+}
 
 // InlineLayoutMode implements inline formatting context layout
 type InlineLayoutMode struct{}
 
-// FlexLayoutMode implements flexbox layout (to be implemented)
-type FlexLayoutMode struct{}
+// TableLayoutMode implements table layout
+type TableLayoutMode struct{}
 
-// InlineLayoutAlgorithm represents different inline layout implementations
-type InlineLayoutAlgorithm int
+// FlexLayoutMode implements flexbox layout
+type FlexLayoutMode struct {
+	definiteHeight bool // The container's height is specified, not fitted to the items
+}
 
-const (
-	InlineLayoutSinglePass InlineLayoutAlgorithm = iota
-	InlineLayoutMultiPass
-)
+// GridLayoutMode implements grid layout
+type GridLayoutMode struct{}
 
 // InlineLayoutResult holds the result of inline layout
 type InlineLayoutResult struct {
@@ -407,8 +484,6 @@ type InlineLayoutResult struct {
 	ChildBoxes []*Box
 	// FinalInlineCtx contains the final state of the inline context after layout
 	FinalInlineCtx *InlineContext
-	// UsedMultiPass indicates whether multi-pass mode was actually used
-	UsedMultiPass bool
 	// Legacy fields (may not be used in all paths)
 	Boxes         []*Box
 	Height        float64 // Total height of all lines
@@ -2,6 +2,7 @@ package layout
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"louis14/pkg/css"
@@ -56,46 +57,8 @@ func (b *Box) HasFragments() bool {
 	return len(b.Fragments) > 0
 }
 
-// GetBorderFlags returns which borders should be drawn based on fragment state
-func (b *Box) GetBorderFlags() BorderEdgeFlags {
-	// If we have explicit fragments, use the main box position only for the first
-	if b.HasFragments() {
-		return BorderEdgeFlags{} // Don't draw borders for main box, use fragments
-	}
-
-	// Legacy fragment flags for backward compatibility
-	flags := AllBorders()
-	if b.IsFirstFragment {
-		flags.Right = false
-	}
-	if b.IsLastFragment {
-		flags.Left = false
-	}
-	return flags
-}
-
 // LayoutEngine utility methods
 
-// repositionFloatRightChildren repositions float:right children to align with the right edge
-func (le *LayoutEngine) repositionFloatRightChildren(box *Box) {
-	contentLeft := box.X + box.Border.Left + box.Padding.Left
-	contentRight := contentLeft + box.Width
-	for _, child := range box.Children {
-		if child.Style != nil && child.Style.GetFloat() == css.FloatRight {
-			childTotalWidth := le.getTotalWidth(child)
-			// Float:right: right edge of child aligns with right edge of parent content
-			newX := contentRight - childTotalWidth
-			dx := newX - child.X
-			if dx != 0 {
-				child.X = newX
-				le.shiftChildren(child, dx, 0)
-				// After shifting, recursively fix any float:right grandchildren
-				le.repositionFloatRightChildren(child)
-			}
-		}
-	}
-}
-
 // getStyle returns the computed style for a node
 func (le *LayoutEngine) getStyle(node *html.Node) *css.Style {
 	if styleAttr, ok := node.GetAttribute("style"); ok {
@@ -118,41 +81,11 @@ func (le *LayoutEngine) getTotalWidth(box *Box) float64 {
 		box.Padding.Right + box.Border.Right + box.Margin.Right
 }
 
-// computeShrinkToFitChildWidth computes the intrinsic margin-box width of a child box
-// for use in shrink-to-fit calculations. For children with explicit width, uses their
-// border-box width + margins. For auto-width block children, recursively computes
-// the intrinsic width based on their content rather than their expanded width.
-func (le *LayoutEngine) computeShrinkToFitChildWidth(box *Box) float64 {
-	// Children with explicit width: use actual margin-box (box.Width is border-box)
-	if box.Style != nil {
-		if _, hasW := box.Style.GetLength("width"); hasW {
-			return box.Margin.Left + box.Width + box.Margin.Right
-		}
-		if _, hasPct := box.Style.GetPercentage("width"); hasPct {
-			return box.Margin.Left + box.Width + box.Margin.Right
-		}
-	}
-	// Floats and inline-blocks have their own shrink-to-fit: use actual width
-	if box.Style != nil && box.Style.GetFloat() != css.FloatNone {
-		return box.Margin.Left + box.Width + box.Margin.Right
-	}
-	// Auto-width block child: compute intrinsic width from children
-	if len(box.Children) == 0 {
-		return box.Margin.Left + box.Width + box.Margin.Right
-	}
-	maxChild := 0.0
-	for _, child := range box.Children {
-		childWidth := le.computeShrinkToFitChildWidth(child)
-		if childWidth > maxChild {
-			maxChild = childWidth
-		}
-	}
-	intrinsicWidth := maxChild + box.Padding.Left + box.Padding.Right + box.Border.Left + box.Border.Right
-	return box.Margin.Left + intrinsicWidth + box.Margin.Right
-}
-
 // adjustChildrenY recursively adjusts Y positions of all children by delta
 func (le *LayoutEngine) adjustChildrenY(box *Box, delta float64) {
+	for _, lb := range box.LineBoxes {
+		lb.Y += delta
+	}
 	for _, child := range box.Children {
 		child.Y += delta
 		le.adjustChildrenY(child, delta)
@@ -161,6 +94,11 @@ func (le *LayoutEngine) adjustChildrenY(box *Box, delta float64) {
 
 // shiftChildren recursively shifts all children by dx, dy
 func (le *LayoutEngine) shiftChildren(box *Box, dx, dy float64) {
+	for _, lb := range box.LineBoxes {
+		lb.Y += dy
+		lb.LeftEdge += dx
+		lb.RightEdge += dx
+	}
 	for _, child := range box.Children {
 		child.X += dx
 		child.Y += dy
@@ -168,27 +106,6 @@ func (le *LayoutEngine) shiftChildren(box *Box, dx, dy float64) {
 	}
 }
 
-// isFirstTextInBlock checks if this text node is the first text content
-// in its block-level ancestor (for ::first-letter styling)
-func (le *LayoutEngine) isFirstTextInBlock(node *html.Node, parent *Box) bool {
-	if parent == nil || parent.Node == nil {
-		return false
-	}
-	// Check if any text or element children came before this node
-	for _, sibling := range parent.Node.Children {
-		if sibling == node {
-			return true // We reached ourselves first
-		}
-		if sibling.Type == html.TextNode && strings.TrimSpace(sibling.Text) != "" {
-			return false // Another text node with content came first
-		}
-		if sibling.Type == html.ElementNode {
-			return false // An element came first
-		}
-	}
-	return false
-}
-
 // extractFirstLetter extracts the first letter from text (handling punctuation per CSS spec)
 func extractFirstLetter(text string) (string, string) {
 	text = strings.TrimLeft(text, " \t\n\r")
@@ -273,11 +190,8 @@ func unescapeUnicode(s string) string {
 // getColspan returns the colspan attribute value (default 1)
 func getColspan(node *html.Node) int {
 	if colspan, ok := node.GetAttribute("colspan"); ok {
-		if c, ok := css.ParseLength(colspan); ok {
-			col := int(c)
-			if col > 0 {
-				return col
-			}
+		if n, err := strconv.Atoi(strings.TrimSpace(colspan)); err == nil && n > 0 {
+			return min(n, 1000) // HTML caps colspan at 1000
 		}
 	}
 	return 1
@@ -286,12 +200,144 @@ func getColspan(node *html.Node) int {
 // getRowspan returns the rowspan attribute value (default 1)
 func getRowspan(node *html.Node) int {
 	if rowspan, ok := node.GetAttribute("rowspan"); ok {
-		if r, ok := css.ParseLength(rowspan); ok {
-			row := int(r)
-			if row > 0 {
-				return row
-			}
+		if n, err := strconv.Atoi(strings.TrimSpace(rowspan)); err == nil && n > 0 {
+			return min(n, 65534) // HTML caps rowspan at 65534
+		}
+	}
+	return 1
+}
+
+// getSpan returns the span attribute of a col or colgroup (default 1)
+func getSpan(node *html.Node) int {
+	if span, ok := node.GetAttribute("span"); ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(span)); err == nil && n > 0 {
+			return min(n, 1000) // HTML caps span at 1000
 		}
 	}
 	return 1
 }
+
+// ContentBounds returns the width and height of the area covered by the
+// laid-out boxes (their margin boxes), measured from the origin.
+// Fixed-position boxes are excluded since they do not scroll with the page.
+func ContentBounds(boxes []*Box) (width, height float64) {
+	var walk func(b *Box)
+	walk = func(b *Box) {
+		if b.Position == css.PositionFixed {
+			return
+		}
+		if right := b.X + b.Width + b.Margin.Right; right > width {
+			width = right
+		}
+		if bottom := b.Y + b.Height + b.Margin.Bottom; bottom > height {
+			height = bottom
+		}
+		for _, child := range b.Children {
+			walk(child)
+		}
+	}
+	for _, b := range boxes {
+		walk(b)
+	}
+	return width, height
+}
+
+// HasViewportAnchoredBoxes returns true if any box is position: fixed or
+// sticky, i.e. its placement depends on the scroll offset.
+func HasViewportAnchoredBoxes(boxes []*Box) bool {
+	for _, b := range boxes {
+		if b.Position == css.PositionFixed || b.Position == css.PositionSticky {
+			return true
+		}
+		if HasViewportAnchoredBoxes(b.Children) {
+			return true
+		}
+	}
+	return false
+}
+
+// NodeAt returns the element whose box is topmost at the document point
+// (x, y), or nil if no box contains it. Text boxes resolve to their parent
+// element. Boxes later in paint order win over earlier ones. Content
+// scrolled out of a scroll container can't be hit.
+func NodeAt(boxes []*Box, x, y float64) *html.Node {
+	for i := len(boxes) - 1; i >= 0; i-- {
+		b := boxes[i]
+		if IsScrollContainer(b) && !b.contains(x, y) {
+			continue
+		}
+		if node := NodeAt(b.Children, x, y); node != nil {
+			return node
+		}
+		if b.Node == nil || !b.contains(x, y) {
+			continue
+		}
+		node := b.Node
+		for node != nil && node.Type != html.ElementNode {
+			node = node.Parent
+		}
+		if node != nil && node.TagName != "document" {
+			return node
+		}
+	}
+	return nil
+}
+
+// ScrollContainersAt returns the scroll containers whose border box holds
+// the document point (x, y), innermost first.
+func ScrollContainersAt(boxes []*Box, x, y float64) []*Box {
+	for i := len(boxes) - 1; i >= 0; i-- {
+		b := boxes[i]
+		if !IsScrollContainer(b) {
+			if containers := ScrollContainersAt(b.Children, x, y); len(containers) > 0 {
+				return containers
+			}
+			continue
+		}
+		if b.contains(x, y) {
+			return append(ScrollContainersAt(b.Children, x, y), b)
+		}
+	}
+	return nil
+}
+
+// contains reports whether the point lies within the box's border box or,
+// for split inline boxes, within one of its fragments.
+func (b *Box) contains(x, y float64) bool {
+	if b.HasFragments() {
+		for _, f := range b.Fragments {
+			if x >= f.X && x < f.X+f.Width && y >= f.Y && y < f.Y+f.Height {
+				return true
+			}
+		}
+		return false
+	}
+	return x >= b.X && x < b.X+b.Width && y >= b.Y && y < b.Y+b.Height
+}
+
+// BoxForNode returns the first box generated for node, or nil if it has
+// none (e.g. display: none).
+func BoxForNode(boxes []*Box, node *html.Node) *Box {
+	for _, b := range boxes {
+		if b.Node == node {
+			return b
+		}
+		if found := BoxForNode(b.Children, node); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// isCollapsibleWhitespace reports whether r is the white space that is
+// collapsed and that lines break at (CSS Text 3 §4.1). A no-break space is
+// not: it keeps the words it joins together.
+func isCollapsibleWhitespace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f'
+}
+
+// isWhitespaceOnly reports whether text has only collapsible white space,
+// so generates no content of its own.
+func isWhitespaceOnly(text string) bool {
+	return strings.TrimFunc(text, isCollapsibleWhitespace) == ""
+}
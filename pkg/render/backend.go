@@ -0,0 +1,65 @@
+package render
+
+import (
+	"image"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
+
+	"louis14/pkg/text"
+)
+
+// Backend is the surface a Renderer paints onto. Its methods are those of
+// gg.Context, which is the raster backend; PDFBackend and SVGBackend record
+// the same drawing as vector documents, and DisplayList as paint commands. Coordinates are in CSS pixels, y down, under a
+// current transform that Translate, Scale, and Rotate modify and Push and
+// Pop save and restore along with the clip.
+type Backend interface {
+	Width() int
+	Height() int
+	Clear()
+
+	Push()
+	Pop()
+	Identity()
+	Translate(x, y float64)
+	Scale(x, y float64)
+	Rotate(angle float64)
+
+	SetRGB(r, g, b float64)
+	SetRGBA(r, g, b, a float64)
+	SetFillStyle(pattern gg.Pattern)
+	SetLineWidth(lineWidth float64)
+	SetFillRuleWinding()
+	SetFillRuleEvenOdd()
+
+	MoveTo(x, y float64)
+	LineTo(x, y float64)
+	ClosePath()
+	NewSubPath()
+	DrawRectangle(x, y, w, h float64)
+	DrawLine(x1, y1, x2, y2 float64)
+	DrawCircle(x, y, r float64)
+	DrawEllipticalArc(x, y, rx, ry, angle1, angle2 float64)
+	Fill()
+	Stroke()
+	Clip()
+
+	SetFontFace(fontFace font.Face)
+	LoadFontFace(path string, points float64) error
+	FontAscent() float64
+	DrawString(s string, x, y float64)
+
+	DrawImage(im image.Image, x, y int)
+}
+
+// The raster backend
+var _ Backend = (*gg.Context)(nil)
+
+// NewRendererForBackend creates a renderer that paints onto backend.
+func NewRendererForBackend(backend Backend) *Renderer {
+	return &Renderer{
+		backend: backend,
+		fonts:   text.DefaultFontConfig(),
+	}
+}
@@ -0,0 +1,243 @@
+package render
+
+import (
+	"math"
+
+	"github.com/fogleman/gg"
+
+	"louis14/pkg/css"
+	"louis14/pkg/layout"
+)
+
+// borderSide is one side of a box's border: the trapezoid between its
+// outer edge, from o1 to o2, and the inner corners i1 and i2 where it meets
+// the neighboring sides. Each side paints only inside its trapezoid, so
+// sides of different styles and colors join along the miter lines
+// (CSS 2.1 §8.5.3).
+type borderSide struct {
+	name   string // "top", "right", "bottom", or "left"
+	width  float64
+	style  css.BorderStyle
+	lit    bool // Top and left sides, lit in the 3D styles
+	o1, o2 gg.Point
+	i1, i2 gg.Point
+	normal gg.Point // Unit vector from the outer edge inward
+}
+
+// borderFrame is the border box (x, y, w, h) of a box with its corner radii
+// and border widths, which the bands of double, groove, and ridge borders
+// are inset from.
+type borderFrame struct {
+	x, y, w, h float64
+	radii      css.BorderRadii
+	widths     css.BoxEdge
+}
+
+// drawBorderSide paints one side of a border in its style and color.
+func (r *Renderer) drawBorderSide(side borderSide, color css.Color, frame borderFrame) {
+	dark := darkBorderColor(color)
+	switch side.style {
+	case css.BorderStyleDashed, css.BorderStyleDotted:
+		r.drawBorderDashes(side, color)
+	case css.BorderStyleDouble:
+		if side.width < 3 {
+			r.fillBorderSide(side, color)
+			return
+		}
+		// Two lines and the space between them, a third of the width each
+		third := func(w float64) float64 { return math.Max(math.Round(w/3), 1) }
+		r.fillBorderBand(side, color, frame, func(w float64) float64 { return 0 }, third)
+		r.fillBorderBand(side, color, frame, func(w float64) float64 { return w - third(w) }, func(w float64) float64 { return w })
+	case css.BorderStyleGroove, css.BorderStyleRidge:
+		// Two halves, as if carved into or raised from the canvas
+		outer, inner := dark, color
+		if side.style == css.BorderStyleRidge {
+			outer, inner = color, dark
+		}
+		if !side.lit {
+			outer, inner = inner, outer
+		}
+		half := func(w float64) float64 { return w / 2 }
+		r.fillBorderBand(side, outer, frame, func(w float64) float64 { return 0 }, half)
+		r.fillBorderBand(side, inner, frame, half, func(w float64) float64 { return w })
+	case css.BorderStyleInset:
+		if side.lit {
+			color = dark
+		}
+		r.fillBorderSide(side, color)
+	case css.BorderStyleOutset:
+		if !side.lit {
+			color = dark
+		}
+		r.fillBorderSide(side, color)
+	default:
+		r.fillBorderSide(side, color)
+	}
+}
+
+// borderSidePath adds the side's trapezoid to the current path.
+func (r *Renderer) borderSidePath(side borderSide) {
+	r.context.MoveTo(side.o1.X, side.o1.Y)
+	r.context.LineTo(side.i1.X, side.i1.Y)
+	r.context.LineTo(side.i2.X, side.i2.Y)
+	r.context.LineTo(side.o2.X, side.o2.Y)
+	r.context.ClosePath()
+}
+
+func (r *Renderer) fillBorderSide(side borderSide, color css.Color) {
+	r.setColor(color)
+	r.borderSidePath(side)
+	r.context.Fill()
+}
+
+// fillBorderBand fills the part of the side between two curves parallel to
+// the border edge, inset from it by from and to of each side's width.
+func (r *Renderer) fillBorderBand(side borderSide, color css.Color, frame borderFrame, from, to func(w float64) float64) {
+	inset := func(f func(float64) float64) (float64, float64, float64, float64) {
+		return f(frame.widths.Top), f(frame.widths.Right), f(frame.widths.Bottom), f(frame.widths.Left)
+	}
+	r.context.Push()
+	defer r.context.Pop()
+	for _, f := range []func(float64) float64{from, to} {
+		top, right, bottom, left := inset(f)
+		roundedRectPath(r.context, frame.x+left, frame.y+top, frame.w-left-right, frame.h-top-bottom,
+			frame.radii.Inset(top, right, bottom, left))
+	}
+	r.context.SetFillRuleEvenOdd()
+	r.context.Clip()
+	r.context.SetFillRuleWinding()
+	r.fillBorderSide(side, color)
+}
+
+// drawBorderDashes paints a dashed or dotted side. Dashes and dots are
+// spaced evenly, with one at each end, and clipped to the side's trapezoid
+// where they meet the neighboring sides. Dashes are twice the width long
+// and gaps one width (thin borders: three and two widths), as in browsers;
+// dots are round, one width across and one width apart.
+func (r *Renderer) drawBorderDashes(side borderSide, color css.Color) {
+	w := side.width
+	length := math.Hypot(side.o2.X-side.o1.X, side.o2.Y-side.o1.Y)
+	if length <= 0 {
+		return
+	}
+	dash, gap := 2*w, w
+	if w < 3 {
+		dash, gap = 3*w, 2*w
+	}
+	if side.style == css.BorderStyleDotted {
+		dash, gap = w, w
+	}
+	n := math.Floor((length + gap) / (dash + gap))
+	if n < 2 {
+		r.fillBorderSide(side, color)
+		return
+	}
+	step := (length - dash) / (n - 1)
+
+	r.context.Push()
+	defer r.context.Pop()
+	r.borderSidePath(side)
+	r.context.Clip()
+
+	ux, uy := (side.o2.X-side.o1.X)/length, (side.o2.Y-side.o1.Y)/length
+	nx, ny := side.normal.X, side.normal.Y
+	// How far the trapezoid reaches inward, past the border width where
+	// rounded corners extend the inner corners
+	depth := math.Max(w, math.Max((side.i1.X-side.o1.X)*nx+(side.i1.Y-side.o1.Y)*ny,
+		(side.i2.X-side.o1.X)*nx+(side.i2.Y-side.o1.Y)*ny))
+	r.setColor(color)
+	for i := 0.0; i < n; i++ {
+		s := i * step
+		x, y := side.o1.X+ux*s, side.o1.Y+uy*s
+		if side.style == css.BorderStyleDotted && w > 2 {
+			r.context.DrawCircle(x+ux*w/2+nx*w/2, y+uy*w/2+ny*w/2, w/2)
+			continue
+		}
+		r.context.MoveTo(x, y)
+		r.context.LineTo(x+ux*dash, y+uy*dash)
+		r.context.LineTo(x+ux*dash+nx*depth, y+uy*dash+ny*depth)
+		r.context.LineTo(x+nx*depth, y+ny*depth)
+		r.context.ClosePath()
+	}
+	r.context.Fill()
+}
+
+func (r *Renderer) setColor(color css.Color) {
+	r.context.SetRGBA(float64(color.R)/255.0, float64(color.G)/255.0, float64(color.B)/255.0, color.A)
+}
+
+// darkBorderColor returns the shaded color of the 3D border styles, as
+// browsers darken it. Black shades to dark gray, so the shading still shows.
+func darkBorderColor(c css.Color) css.Color {
+	if c.R == 0 && c.G == 0 && c.B == 0 {
+		return css.Color{R: 0x54, G: 0x54, B: 0x54, A: c.A}
+	}
+	v := float64(max(c.R, c.G, c.B)) / 255
+	m := math.Max(0, (v-0.33)/v)
+	return css.Color{
+		R: uint8(math.Round(float64(c.R) * m)),
+		G: uint8(math.Round(float64(c.G) * m)),
+		B: uint8(math.Round(float64(c.B) * m)),
+		A: c.A,
+	}
+}
+
+// borderSides returns the sides of a border of the given widths with outer
+// edges on the border box (outerLeft, outerTop)-(outerRight, outerBottom)
+// and inner corners tl, tr, br, and bl, in paint order: bottom, left,
+// right, top. Later sides overwrite the pixels they share along a miter,
+// which gives the priority top > right > left > bottom at corners.
+func borderSides(widths css.BoxEdge, styles css.BorderStyleEdge, outerLeft, outerTop, outerRight, outerBottom float64, tl, tr, br, bl gg.Point) []borderSide {
+	return []borderSide{
+		{
+			name: "bottom", width: widths.Bottom, style: styles.Bottom,
+			o1: gg.Point{X: outerLeft, Y: outerBottom}, o2: gg.Point{X: outerRight, Y: outerBottom},
+			i1: bl, i2: br, normal: gg.Point{X: 0, Y: -1},
+		},
+		{
+			name: "left", width: widths.Left, style: styles.Left, lit: true,
+			o1: gg.Point{X: outerLeft, Y: outerTop}, o2: gg.Point{X: outerLeft, Y: outerBottom},
+			i1: tl, i2: bl, normal: gg.Point{X: 1, Y: 0},
+		},
+		{
+			name: "right", width: widths.Right, style: styles.Right,
+			o1: gg.Point{X: outerRight, Y: outerTop}, o2: gg.Point{X: outerRight, Y: outerBottom},
+			i1: tr, i2: br, normal: gg.Point{X: -1, Y: 0},
+		},
+		{
+			name: "top", width: widths.Top, style: styles.Top, lit: true,
+			o1: gg.Point{X: outerLeft, Y: outerTop}, o2: gg.Point{X: outerRight, Y: outerTop},
+			i1: tl, i2: tr, normal: gg.Point{X: 0, Y: 1},
+		},
+	}
+}
+
+// drawCollapsedBorder paints the sides of a table cell's collapsed border
+// that the cell owns (CSS 2.1 §17.6.2). Each is centered on the cell's
+// border box edge, half inside the cell and half in its neighbor, and
+// meets the neighboring sides along the miters of the full-width border.
+func (r *Renderer) drawCollapsedBorder(box *layout.Box) {
+	cb := box.CollapsedBorder
+	y := r.getEffectiveY(box)
+	widths := css.BoxEdge{Top: cb.Top.Width, Right: cb.Right.Width, Bottom: cb.Bottom.Width, Left: cb.Left.Width}
+	outerLeft, outerTop := box.X-widths.Left/2, y-widths.Top/2
+	outerRight, outerBottom := box.X+box.Width+widths.Right/2, y+box.Height+widths.Bottom/2
+	innerLeft, innerTop := outerLeft+widths.Left, outerTop+widths.Top
+	innerRight, innerBottom := outerRight-widths.Right, outerBottom-widths.Bottom
+
+	edges := map[string]layout.CollapsedBorderEdge{"top": cb.Top, "right": cb.Right, "bottom": cb.Bottom, "left": cb.Left}
+	styles := css.BorderStyleEdge{Top: cb.Top.Style, Right: cb.Right.Style, Bottom: cb.Bottom.Style, Left: cb.Left.Style}
+	frame := borderFrame{x: outerLeft, y: outerTop, w: outerRight - outerLeft, h: outerBottom - outerTop, widths: widths}
+	sides := borderSides(widths, styles, outerLeft, outerTop, outerRight, outerBottom,
+		gg.Point{X: innerLeft, Y: innerTop}, gg.Point{X: innerRight, Y: innerTop},
+		gg.Point{X: innerRight, Y: innerBottom}, gg.Point{X: innerLeft, Y: innerBottom})
+	for _, side := range sides {
+		edge := edges[side.name]
+		if !edge.Paint || side.width <= 0 || side.style.IsNone() {
+			continue
+		}
+		if color, ok := r.getBorderSideColor(edge.Source, edge.Side); ok {
+			r.drawBorderSide(side, color, frame)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package render
+
+import (
+	"louis14/pkg/css"
+	"louis14/pkg/layout"
+)
+
+// The clip stack records which overflow clips are applied to the context, one
+// Push per entry, outermost first. Before a box paints, syncClips makes the
+// stack match the box's clipping ancestors, popping and pushing only where the
+// two differ, so consecutive boxes in the same container share one clip.
+
+// syncClips makes the applied clips match the overflow clips that apply to
+// box. A nil box removes all clips.
+func (r *Renderer) syncClips(box *layout.Box) {
+	var want []*layout.Box
+	if box != nil {
+		want = clippingAncestors(box)
+	}
+
+	// Keep the common prefix; clips below the layer base were applied when
+	// the enclosing layer composites and can't be removed here.
+	keep := 0
+	for keep < len(r.clipStack) && keep < len(want) && r.clipStack[keep] == want[keep] {
+		keep++
+	}
+	if keep < r.clipBase {
+		keep = r.clipBase
+	}
+	for len(r.clipStack) > keep {
+		r.context.Pop()
+		r.clipStack = r.clipStack[:len(r.clipStack)-1]
+	}
+	for _, clip := range want[min(keep, len(want)):] {
+		r.context.Push()
+		// CSS 2.1 §11.1.1: Clip to the padding box (inside border, outside padding),
+		// following the inner border edge when border-radius is set
+		x, y, w, h := r.paintedBorderBox(clip)
+		r.clipToPaddingBox(clip, x, y, w, h)
+		r.clipStack = append(r.clipStack, clip)
+	}
+}
+
+// clippingAncestors returns the ancestors of box whose overflow clips it,
+// outermost first. An ancestor's overflow clips its descendants except those
+// whose containing block lies outside it: absolutely positioned boxes escape
+// non-positioned ancestors, and fixed boxes escape all of them
+// (CSS 2.1 §11.1.1).
+func clippingAncestors(box *layout.Box) []*layout.Box {
+	var clips []*layout.Box
+	position := box.Position
+	for a := box.Parent; a != nil; a = a.Parent {
+		if position == css.PositionFixed {
+			break
+		}
+		if position == css.PositionAbsolute && !layout.IsPositioned(a) {
+			continue // a is not the containing block
+		}
+		if clipsOverflow(a) {
+			clips = append(clips, a)
+		}
+		position = a.Position
+	}
+	for i, j := 0, len(clips)-1; i < j; i, j = i+1, j-1 {
+		clips[i], clips[j] = clips[j], clips[i]
+	}
+	return clips
+}
+
+// clipsOverflow returns true if box clips its content to its padding box.
+// The root element's overflow, and body's when the root's is visible, apply
+// to the viewport instead (CSS 2.1 §11.1.1).
+func clipsOverflow(box *layout.Box) bool {
+	if box.Style == nil || box.Style.GetOverflow() == css.OverflowVisible {
+		return false
+	}
+	return !layout.PropagatesOverflowToViewport(box)
+}
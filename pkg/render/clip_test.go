@@ -0,0 +1,45 @@
+package render
+
+import "testing"
+
+func TestClip_NestedClipsUnderTransforms(t *testing.T) {
+	// The inner clip is (10, 10)-(50, 40), inside the outer (0, 0)-(80, 60).
+	// Transformed boxes are clipped where they paint, not where they lay
+	// out, and a clip pushed inside a transform must not outlive it.
+	im := renderHTML(t, `<div style="width:80px;height:60px;overflow:hidden">
+		<div style="margin:10px;width:40px;height:30px;overflow:hidden">
+			<div style="width:20px;height:20px;background:#f00;transform:translate(30px, 20px)"></div>
+			<div style="width:10px;height:10px;background:#00f;transform:scale(3)"></div>
+		</div>
+		<div style="width:30px;height:30px;background:#0f0;transform:translate(60px, -10px)"></div>
+	</div>`)
+	checkPixels(t, im, []pixel{
+		{45, 35, 255, 0, 0},     // Red moved to (40, 30), inside both clips
+		{55, 35, 255, 255, 255}, // Red past the inner clip
+		{45, 45, 255, 255, 255}, // Red below the inner clip
+		{20, 25, 0, 0, 255},     // Blue scaled about its center to (0, 20)-(30, 50)
+		{5, 25, 255, 255, 255},  // Blue left of the inner clip
+		{20, 45, 255, 255, 255}, // Blue below the inner clip
+		{70, 50, 0, 255, 0},     // Green moved to (60, 40), inside the outer clip only
+		{85, 50, 255, 255, 255}, // Green past the outer clip
+		{70, 65, 255, 255, 255}, // Green below the outer clip
+	})
+}
+
+func TestClip_AbsoluteEscapesNonContainingClip(t *testing.T) {
+	// The positioned box's containing block is the outer div, so only the
+	// outer clip applies to it; its static sibling stays in the inner clip.
+	im := renderHTML(t, `<div style="position:relative;width:80px;height:60px;overflow:hidden">
+		<div style="width:20px;height:20px;overflow:hidden">
+			<div style="position:absolute;left:10px;top:10px;width:90px;height:30px;background:#00f;transform:translate(5px, 0)"></div>
+			<div style="width:40px;height:40px;background:#f00"></div>
+		</div>
+	</div>`)
+	checkPixels(t, im, []pixel{
+		{10, 10, 255, 0, 0},     // Red inside the inner clip
+		{30, 5, 255, 255, 255},  // Red past the inner clip
+		{50, 20, 0, 0, 255},     // Blue past the inner clip
+		{12, 20, 255, 255, 255}, // Left of the moved blue
+		{85, 20, 255, 255, 255}, // Blue past the outer clip
+	})
+}
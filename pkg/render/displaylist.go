@@ -0,0 +1,480 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"strings"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+
+	"louis14/pkg/text"
+)
+
+// Op is a paint command in a display list. Each op but the layer ops is a
+// Backend method of the same name.
+type Op int
+
+const (
+	OpClear Op = iota
+	OpPush
+	OpPop
+	OpIdentity
+	OpTranslate // Args: x, y
+	OpScale     // Args: x, y
+	OpRotate    // Args: angle
+	OpSetRGBA   // Args: r, g, b, a
+	OpSetFillStyle
+	OpSetLineWidth // Args: width
+	OpSetFillRuleWinding
+	OpSetFillRuleEvenOdd
+	OpMoveTo // Args: x, y
+	OpLineTo // Args: x, y
+	OpClosePath
+	OpNewSubPath
+	OpDrawRectangle     // Args: x, y, w, h
+	OpDrawLine          // Args: x1, y1, x2, y2
+	OpDrawCircle        // Args: x, y, r
+	OpDrawEllipticalArc // Args: x, y, rx, ry, angle1, angle2
+	OpFill
+	OpStroke
+	OpClip
+	OpSetFontFace
+	OpLoadFontFace // Text is the font file; Args: points
+	OpDrawString   // Args: x, y
+	OpDrawImage    // Args: x, y
+	OpBeginLayer
+	OpEndLayer // Args: opacity
+)
+
+var opNames = [...]string{
+	"Clear", "Push", "Pop", "Identity", "Translate", "Scale", "Rotate",
+	"SetRGBA", "SetFillStyle", "SetLineWidth", "SetFillRuleWinding", "SetFillRuleEvenOdd",
+	"MoveTo", "LineTo", "ClosePath", "NewSubPath",
+	"DrawRectangle", "DrawLine", "DrawCircle", "DrawEllipticalArc", "Fill", "Stroke", "Clip",
+	"SetFontFace", "LoadFontFace", "DrawString", "DrawImage",
+	"BeginLayer", "EndLayer",
+}
+
+func (op Op) String() string {
+	if op < 0 || int(op) >= len(opNames) {
+		return fmt.Sprintf("Op(%d)", int(op))
+	}
+	return opNames[op]
+}
+
+// Command is one paint command with its operands.
+type Command struct {
+	Op    Op
+	Args  []float64
+	Text  string      // The string drawn, or the font file loaded
+	Image image.Image // The image drawn
+	Fill  gg.Pattern  // The fill style set
+	Face  font.Face   // The font face set
+}
+
+// DisplayList is the paint commands for a render, in paint order, as built
+// by Renderer.Record. It is a Backend that records what is drawn on it;
+// Replay then paints the commands onto another backend, and String lists
+// them for tests and diffs.
+//
+// A layer (BeginLayer to EndLayer) groups commands that composite onto the
+// surface below as one image with an opacity. Its commands start from a
+// fresh graphics state, and the clips in effect at BeginLayer apply to the
+// composite rather than inside the layer.
+type DisplayList struct {
+	Commands []Command
+
+	width, height int
+
+	face     font.Face   // For FontAscent
+	faces    []font.Face // Saved by Push and BeginLayer
+	matrix   gg.Matrix   // Current transform, for visibleBounds
+	matrices []gg.Matrix // Saved alongside faces
+	layers   []int       // len(faces) at each open BeginLayer
+}
+
+// NewDisplayList creates an empty display list for a width x height surface.
+func NewDisplayList(width, height int) *DisplayList {
+	return &DisplayList{width: width, height: height, face: basicfont.Face7x13, matrix: gg.Identity()}
+}
+
+// LayerBackend is implemented by backends that composite layers themselves,
+// such as SVG groups. Replay paints layers for other backends onto raster
+// images that it composites.
+type LayerBackend interface {
+	BeginLayer()
+	EndLayer(opacity float64)
+}
+
+func (d *DisplayList) add(op Op, args ...float64) {
+	d.Commands = append(d.Commands, Command{Op: op, Args: args})
+}
+
+// Backend methods
+
+func (d *DisplayList) Width() int  { return d.width }
+func (d *DisplayList) Height() int { return d.height }
+
+func (d *DisplayList) Clear() { d.add(OpClear) }
+
+func (d *DisplayList) Push() {
+	d.faces = append(d.faces, d.face)
+	d.matrices = append(d.matrices, d.matrix)
+	d.add(OpPush)
+}
+
+func (d *DisplayList) Pop() {
+	if n := len(d.faces); n > 0 {
+		d.face, d.faces = d.faces[n-1], d.faces[:n-1]
+		d.matrix, d.matrices = d.matrices[n-1], d.matrices[:n-1]
+	}
+	d.add(OpPop)
+}
+
+func (d *DisplayList) Identity() {
+	d.matrix = gg.Identity()
+	d.add(OpIdentity)
+}
+
+func (d *DisplayList) Translate(x, y float64) {
+	d.matrix = d.matrix.Translate(x, y)
+	d.add(OpTranslate, x, y)
+}
+
+func (d *DisplayList) Scale(x, y float64) {
+	d.matrix = d.matrix.Scale(x, y)
+	d.add(OpScale, x, y)
+}
+
+func (d *DisplayList) Rotate(angle float64) {
+	d.matrix = d.matrix.Rotate(angle)
+	d.add(OpRotate, angle)
+}
+
+func (d *DisplayList) SetRGB(r, g, b float64)     { d.add(OpSetRGBA, r, g, b, 1) }
+func (d *DisplayList) SetRGBA(r, g, b, a float64) { d.add(OpSetRGBA, r, g, b, a) }
+
+func (d *DisplayList) SetFillStyle(pattern gg.Pattern) {
+	d.Commands = append(d.Commands, Command{Op: OpSetFillStyle, Fill: pattern})
+}
+
+func (d *DisplayList) SetLineWidth(lineWidth float64) { d.add(OpSetLineWidth, lineWidth) }
+func (d *DisplayList) SetFillRuleWinding()            { d.add(OpSetFillRuleWinding) }
+func (d *DisplayList) SetFillRuleEvenOdd()            { d.add(OpSetFillRuleEvenOdd) }
+
+func (d *DisplayList) MoveTo(x, y float64)              { d.add(OpMoveTo, x, y) }
+func (d *DisplayList) LineTo(x, y float64)              { d.add(OpLineTo, x, y) }
+func (d *DisplayList) ClosePath()                       { d.add(OpClosePath) }
+func (d *DisplayList) NewSubPath()                      { d.add(OpNewSubPath) }
+func (d *DisplayList) DrawRectangle(x, y, w, h float64) { d.add(OpDrawRectangle, x, y, w, h) }
+func (d *DisplayList) DrawLine(x1, y1, x2, y2 float64)  { d.add(OpDrawLine, x1, y1, x2, y2) }
+func (d *DisplayList) DrawCircle(x, y, r float64)       { d.add(OpDrawCircle, x, y, r) }
+
+func (d *DisplayList) DrawEllipticalArc(x, y, rx, ry, angle1, angle2 float64) {
+	d.add(OpDrawEllipticalArc, x, y, rx, ry, angle1, angle2)
+}
+
+func (d *DisplayList) Fill()   { d.add(OpFill) }
+func (d *DisplayList) Stroke() { d.add(OpStroke) }
+func (d *DisplayList) Clip()   { d.add(OpClip) }
+
+func (d *DisplayList) SetFontFace(fontFace font.Face) {
+	d.face = fontFace
+	d.Commands = append(d.Commands, Command{Op: OpSetFontFace, Face: fontFace})
+}
+
+// LoadFontFace records loading a font file, failing as the raster backend
+// would if the file can't be loaded.
+func (d *DisplayList) LoadFontFace(path string, points float64) error {
+	face := text.FileFontFace(path, points)
+	if face == nil {
+		return fmt.Errorf("render: cannot load font %s", path)
+	}
+	d.face = face
+	d.Commands = append(d.Commands, Command{Op: OpLoadFontFace, Text: path, Args: []float64{points}})
+	return nil
+}
+
+func (d *DisplayList) FontAscent() float64 {
+	return float64(d.face.Metrics().Ascent) / 64
+}
+
+func (d *DisplayList) DrawString(s string, x, y float64) {
+	d.Commands = append(d.Commands, Command{Op: OpDrawString, Text: s, Args: []float64{x, y}})
+}
+
+func (d *DisplayList) DrawImage(im image.Image, x, y int) {
+	d.Commands = append(d.Commands, Command{Op: OpDrawImage, Image: im, Args: []float64{float64(x), float64(y)}})
+}
+
+// BeginLayer starts a layer, which EndLayer composites.
+func (d *DisplayList) BeginLayer() {
+	d.layers = append(d.layers, len(d.faces))
+	d.faces = append(d.faces, d.face)
+	d.matrices = append(d.matrices, d.matrix)
+	d.face = basicfont.Face7x13
+	d.matrix = gg.Identity()
+	d.add(OpBeginLayer)
+}
+
+// EndLayer ends the innermost layer, compositing it with the given opacity.
+// Pushes left open in the layer end with it.
+func (d *DisplayList) EndLayer(opacity float64) {
+	if n := len(d.layers); n > 0 {
+		base := d.layers[n-1]
+		d.layers = d.layers[:n-1]
+		d.face, d.faces = d.faces[base], d.faces[:base]
+		d.matrix, d.matrices = d.matrices[base], d.matrices[:base]
+	}
+	d.add(OpEndLayer, opacity)
+}
+
+// visibleBounds returns the smallest rectangle, in the current user
+// coordinates, that covers the surface. It is empty when the transform
+// collapses the user space.
+func (d *DisplayList) visibleBounds() image.Rectangle {
+	m := d.matrix
+	det := m.XX*m.YY - m.XY*m.YX
+	if det == 0 {
+		return image.Rectangle{}
+	}
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range [4][2]float64{{0, 0}, {float64(d.width), 0}, {0, float64(d.height)}, {float64(d.width), float64(d.height)}} {
+		// Invert the affine transform
+		dx, dy := p[0]-m.X0, p[1]-m.Y0
+		x := (m.YY*dx - m.XY*dy) / det
+		y := (m.XX*dy - m.YX*dx) / det
+		minX, minY = math.Min(minX, x), math.Min(minY, y)
+		maxX, maxY = math.Max(maxX, x), math.Max(maxY, y)
+	}
+	return image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX)), int(math.Ceil(maxY)))
+}
+
+// Replay paints the commands onto b.
+func (d *DisplayList) Replay(b Backend) {
+	p := player{target: b}
+	p.replay(context.Background(), d)
+}
+
+// String lists the commands one per line, each as its op and operands.
+func (d *DisplayList) String() string {
+	var sb strings.Builder
+	depth := 0
+	var layers []int // depth at each open BeginLayer
+	for _, c := range d.Commands {
+		switch {
+		case c.Op == OpPop:
+			depth = max(depth-1, 0)
+		case c.Op == OpEndLayer && len(layers) > 0:
+			depth, layers = layers[len(layers)-1], layers[:len(layers)-1]
+		}
+		sb.WriteString(strings.Repeat("  ", depth))
+		sb.WriteString(c.Op.String())
+		switch c.Op {
+		case OpSetFillStyle:
+			fmt.Fprintf(&sb, " %T", c.Fill)
+		case OpSetFontFace:
+			m := c.Face.Metrics()
+			fmt.Fprintf(&sb, " ascent=%s height=%s", vectorNum(float64(m.Ascent)/64), vectorNum(float64(m.Height)/64))
+		case OpLoadFontFace:
+			fmt.Fprintf(&sb, " %q", c.Text)
+		case OpDrawString:
+			fmt.Fprintf(&sb, " %q", c.Text)
+		case OpDrawImage:
+			size := c.Image.Bounds().Size()
+			fmt.Fprintf(&sb, " %dx%d", size.X, size.Y)
+		}
+		for _, v := range c.Args {
+			sb.WriteByte(' ')
+			sb.WriteString(vectorNum(v))
+		}
+		sb.WriteByte('\n')
+		switch c.Op {
+		case OpPush:
+			depth++
+		case OpBeginLayer:
+			layers = append(layers, depth)
+			depth++
+		}
+	}
+	return sb.String()
+}
+
+// player replays commands onto a target, painting layers onto raster
+// images for targets that aren't LayerBackends.
+type player struct {
+	target Backend
+	layers []playerLayer
+
+	// For a tile, the canvas position of its top left corner, and the
+	// tile's copies of the faces drawn with (see rasterizeTiles)
+	origin image.Point
+	faces  map[font.Face]font.Face
+}
+
+type playerLayer struct {
+	parent Backend
+	image  *image.RGBA // nil if the parent composites the layer itself
+}
+
+// replay plays the commands of d, stopping with the context's error once
+// ctx is done.
+func (p *player) replay(ctx context.Context, d *DisplayList) error {
+	for i := range d.Commands {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		p.do(&d.Commands[i])
+	}
+	return nil
+}
+
+func (p *player) do(c *Command) {
+	t, a := p.target, c.Args
+	switch c.Op {
+	case OpClear:
+		t.Clear()
+	case OpPush:
+		t.Push()
+	case OpPop:
+		t.Pop()
+	case OpIdentity:
+		t.Identity()
+		p.toTile(t)
+	case OpTranslate:
+		t.Translate(a[0], a[1])
+	case OpScale:
+		t.Scale(a[0], a[1])
+	case OpRotate:
+		t.Rotate(a[0])
+	case OpSetRGBA:
+		t.SetRGBA(a[0], a[1], a[2], a[3])
+	case OpSetFillStyle:
+		if p.origin != (image.Point{}) {
+			t.SetFillStyle(offsetPattern{c.Fill, p.origin})
+		} else {
+			t.SetFillStyle(c.Fill)
+		}
+	case OpSetLineWidth:
+		t.SetLineWidth(a[0])
+	case OpSetFillRuleWinding:
+		t.SetFillRuleWinding()
+	case OpSetFillRuleEvenOdd:
+		t.SetFillRuleEvenOdd()
+	case OpMoveTo:
+		t.MoveTo(a[0], a[1])
+	case OpLineTo:
+		t.LineTo(a[0], a[1])
+	case OpClosePath:
+		t.ClosePath()
+	case OpNewSubPath:
+		t.NewSubPath()
+	case OpDrawRectangle:
+		t.DrawRectangle(a[0], a[1], a[2], a[3])
+	case OpDrawLine:
+		t.DrawLine(a[0], a[1], a[2], a[3])
+	case OpDrawCircle:
+		t.DrawCircle(a[0], a[1], a[2])
+	case OpDrawEllipticalArc:
+		t.DrawEllipticalArc(a[0], a[1], a[2], a[3], a[4], a[5])
+	case OpFill:
+		t.Fill()
+	case OpStroke:
+		t.Stroke()
+	case OpClip:
+		t.Clip()
+	case OpSetFontFace:
+		t.SetFontFace(p.face(c.Face))
+	case OpLoadFontFace:
+		if p.faces != nil {
+			if face := text.FileFontFace(c.Text, a[0]); face != nil {
+				t.SetFontFace(p.face(face))
+			}
+		} else {
+			t.LoadFontFace(c.Text, a[0])
+		}
+	case OpDrawString:
+		t.DrawString(c.Text, a[0], a[1])
+	case OpDrawImage:
+		t.DrawImage(c.Image, int(a[0]), int(a[1]))
+	case OpBeginLayer:
+		p.beginLayer()
+	case OpEndLayer:
+		p.endLayer(a[0])
+	}
+}
+
+// beginLayer redirects painting to a new transparent layer the size of the
+// target.
+func (p *player) beginLayer() {
+	if lb, ok := p.target.(LayerBackend); ok {
+		lb.BeginLayer()
+		p.layers = append(p.layers, playerLayer{parent: p.target})
+		return
+	}
+	l := playerLayer{
+		parent: p.target,
+		image:  image.NewRGBA(image.Rect(0, 0, p.target.Width(), p.target.Height())),
+	}
+	p.layers = append(p.layers, l)
+	p.target = gg.NewContextForRGBA(l.image)
+	p.toTile(p.target)
+}
+
+// endLayer restores the surface below the innermost layer and composites
+// the layer onto it with the given opacity, through the surface's clip.
+func (p *player) endLayer(opacity float64) {
+	if len(p.layers) == 0 {
+		return
+	}
+	l := p.layers[len(p.layers)-1]
+	p.layers = p.layers[:len(p.layers)-1]
+	p.target = l.parent
+	if l.image == nil {
+		p.target.(LayerBackend).EndLayer(opacity)
+		return
+	}
+
+	if opacity <= 0 {
+		return
+	}
+	if opacity < 1 {
+		// The layer is premultiplied, so every channel scales with alpha
+		scale := uint32(opacity*256 + 0.5)
+		for i, v := range l.image.Pix {
+			l.image.Pix[i] = uint8(uint32(v) * scale >> 8)
+		}
+	}
+
+	p.target.Push()
+	p.target.Identity()
+	p.target.DrawImage(l.image, 0, 0)
+	p.target.Pop()
+}
+
+// toTile translates canvas coordinates on t, a new surface or one with an
+// identity transform, to the tile's.
+func (p *player) toTile(t Backend) {
+	if p.origin != (image.Point{}) {
+		t.Translate(-float64(p.origin.X), -float64(p.origin.Y))
+	}
+}
+
+// face returns the face to draw with for f: f itself, or for a tile its own
+// copy.
+func (p *player) face(f font.Face) font.Face {
+	if p.faces == nil {
+		return f
+	}
+	c, ok := p.faces[f]
+	if !ok {
+		c = text.CopyFace(f)
+		p.faces[f] = c
+	}
+	return c
+}
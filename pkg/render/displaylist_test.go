@@ -0,0 +1,228 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fogleman/gg"
+
+	"louis14/pkg/html"
+	"louis14/pkg/layout"
+)
+
+var updateGoldens = os.Getenv("UPDATE_REFS") == "1"
+
+// displayListScenes are documents whose display lists are checked against
+// golden files in testdata/displaylist, each 100x80.
+var displayListScenes = []struct{ name, markup string }{
+	// Nested overflow clips, one following a rounded border, and an
+	// absolutely positioned box escaping the clip of a box that is not
+	// its containing block
+	{"clip", `<div style="position:relative;margin:5px;width:80px;height:60px;overflow:hidden;background:#ccc">
+		<div style="margin:10px;width:50px;height:30px;overflow:hidden;border-radius:6px">
+			<div style="width:100px;height:100px;background:#f00"></div>
+			<div style="position:absolute;left:0;top:0;width:20px;height:20px;background:#00f"></div>
+		</div>
+	</div>`},
+	// A translated and scaled box inside a clip, painted after its
+	// untransformed sibling
+	{"transform", `<div style="width:80px;height:60px;overflow:hidden">
+		<div style="width:20px;height:20px;background:#f00;transform:translate(10px, 5px) scale(2)"></div>
+		<div style="width:20px;height:20px;background:#0f0"></div>
+	</div>`},
+	// A layer nested in a layer, and a transformed layer inside a clip,
+	// which applies to the composite
+	{"layers", `<div style="opacity:0.5;background:#f00;width:60px;height:40px">
+		<div style="opacity:0.5;width:80px;height:20px;background:#00f"></div>
+	</div>
+	<div style="width:40px;height:30px;overflow:hidden">
+		<div style="opacity:0.5;width:80px;height:20px;background:#0f0;transform:translate(5px, 5px)"></div>
+	</div>`},
+}
+
+// layoutHTML lays out the body content markup in a width x height viewport.
+func layoutHTML(t *testing.T, markup string, width, height int) []*layout.Box {
+	t.Helper()
+	doc, err := html.Parse(`<html><body style="margin:0">` + markup + `</body></html>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	boxes, err := layout.NewLayoutEngine(float64(width), float64(height)).Layout(context.Background(), doc)
+	if err != nil {
+		t.Fatalf("layout: %v", err)
+	}
+	return boxes
+}
+
+func TestDisplayList_Golden(t *testing.T) {
+	for _, scene := range displayListScenes {
+		t.Run(scene.name, func(t *testing.T) {
+			list, err := NewRenderer(100, 80).Record(context.Background(), layoutHTML(t, scene.markup, 100, 80))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := list.String()
+			path := filepath.Join("testdata", "displaylist", scene.name+".golden")
+			if updateGoldens {
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%v\nRun with UPDATE_REFS=1 to generate it", err)
+			}
+			if got != string(want) {
+				t.Errorf("display list differs from %s; run with UPDATE_REFS=1 to update it\ngot:\n%s", path, got)
+			}
+		})
+	}
+}
+
+// rasterImage returns the pixels of a raster backend.
+func rasterImage(t *testing.T, dc *gg.Context) *image.RGBA {
+	t.Helper()
+	im, ok := dc.Image().(*image.RGBA)
+	if !ok {
+		t.Fatalf("raster backend has a %T", dc.Image())
+	}
+	return im
+}
+
+// paintScene paints shapes under nested transforms and clips, with the
+// graphics state saved and restored around them.
+func paintScene(b Backend) {
+	b.SetRGB(1, 1, 1)
+	b.Clear()
+	b.Push()
+	b.DrawRectangle(5, 5, 50, 30)
+	b.Clip()
+	b.Translate(30, 20)
+	b.Rotate(0.3)
+	b.Scale(1.5, 1)
+	b.SetRGBA(1, 0, 0, 0.8)
+	b.DrawRectangle(-15, -10, 30, 20)
+	b.Fill()
+	b.Push()
+	b.DrawCircle(0, 0, 8)
+	b.Clip()
+	b.SetRGB(0, 0, 1)
+	b.DrawRectangle(-20, -20, 40, 40)
+	b.Fill()
+	b.Pop()
+	b.SetLineWidth(2)
+	b.SetRGB(0, 0.5, 0)
+	b.DrawLine(-20, 0, 20, 0)
+	b.Stroke()
+	b.Pop()
+	b.SetFillStyle(gg.NewSolidPattern(color.RGBA{0, 0, 0, 255}))
+	b.DrawEllipticalArc(50, 30, 8, 5, 0, 3)
+	b.Fill()
+}
+
+func TestDisplayList_ReplayMatchesRaster(t *testing.T) {
+	direct := gg.NewContext(60, 40)
+	paintScene(direct)
+
+	list := NewDisplayList(60, 40)
+	paintScene(list)
+	replayed := gg.NewContext(60, 40)
+	list.Replay(replayed)
+
+	if !bytes.Equal(rasterImage(t, direct).Pix, rasterImage(t, replayed).Pix) {
+		t.Error("replaying the display list painted different pixels than painting directly")
+	}
+}
+
+func TestDisplayList_TilesMatchSerial(t *testing.T) {
+	for _, scene := range displayListScenes {
+		boxes := layoutHTML(t, scene.markup, 100, 80)
+		serial := NewRenderer(100, 80)
+		if err := serial.Render(context.Background(), boxes); err != nil {
+			t.Fatal(err)
+		}
+		tiled := NewRenderer(100, 80)
+		tiled.SetConcurrency(4)
+		if err := tiled.Render(context.Background(), boxes); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(rasterImage(t, serial.backend.(*gg.Context)).Pix, rasterImage(t, tiled.backend.(*gg.Context)).Pix) {
+			t.Errorf("%s: tiled rendering differs from serial", scene.name)
+		}
+	}
+}
+
+func TestRender_StopsWhenCanceled(t *testing.T) {
+	boxes := layoutHTML(t, displayListScenes[0].markup, 100, 80)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, workers := range []int{1, 4} {
+		r := NewRenderer(100, 80)
+		r.SetConcurrency(workers)
+		if err := r.Render(ctx, boxes); err != context.Canceled {
+			t.Errorf("%d workers: got %v, want context.Canceled", workers, err)
+		}
+		// Nothing was painted, not even the white canvas
+		if c := rasterImage(t, r.backend.(*gg.Context)).RGBAAt(50, 40); c.A != 0 {
+			t.Errorf("%d workers: painted %v", workers, c)
+		}
+	}
+}
+
+func TestDisplayList_LayersComposite(t *testing.T) {
+	im := renderHTML(t, displayListScenes[2].markup)
+
+	// Half red over white, then that with half blue over it at half again
+	checkPixels(t, im, []pixel{
+		{30, 30, 255, 128, 128}, // Red layer only
+		{30, 10, 191, 128, 191}, // Blue layer nested in it
+		{70, 10, 191, 191, 255}, // Blue past the red, still in the outer layer
+		{20, 50, 128, 255, 128}, // Green layer, moved by its transform
+		{20, 43, 255, 255, 255}, // Above the moved green
+		{45, 50, 255, 255, 255}, // Green clipped by the composite's clip
+	})
+}
+
+// pixel is an expected color at a point of a rendered image.
+type pixel struct {
+	x, y    int
+	r, g, b uint8
+}
+
+// checkPixels checks the colors of im at the points of want, allowing for
+// rounding in compositing.
+func checkPixels(t *testing.T, im *image.RGBA, want []pixel) {
+	t.Helper()
+	for _, p := range want {
+		c := im.RGBAAt(p.x, p.y)
+		if absDiff(c.R, p.r) > 2 || absDiff(c.G, p.g) > 2 || absDiff(c.B, p.b) > 2 {
+			t.Errorf("(%d, %d): got %v, want (%d, %d, %d)", p.x, p.y, c, p.r, p.g, p.b)
+		}
+	}
+}
+
+// renderHTML renders the body content markup at 100x80 and returns its
+// pixels.
+func renderHTML(t *testing.T, markup string) *image.RGBA {
+	t.Helper()
+	r := NewRenderer(100, 80)
+	if err := r.Render(context.Background(), layoutHTML(t, markup, 100, 80)); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	return rasterImage(t, r.backend.(*gg.Context))
+}
+
+func absDiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,229 @@
+package render
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"louis14/pkg/css"
+	"louis14/pkg/html"
+	"louis14/pkg/layout"
+	"louis14/pkg/text"
+)
+
+// placeholderColor is the color of placeholder text in empty text fields.
+var placeholderColor = css.Color{R: 0x75, G: 0x75, B: 0x75, A: 1}
+
+// drawFormControl paints the widget parts of a form control that are not
+// document content: the value or placeholder of a text input, the label of
+// a button-type input, the mark of a checked checkbox or radio, and the
+// selected option and arrow of a select box. Borders and backgrounds come
+// from the UA stylesheet and are painted like any other box's.
+func (r *Renderer) drawFormControl(box *layout.Box) {
+	node := box.Node
+	if node == nil || node.Type != html.ElementNode {
+		return
+	}
+	switch node.TagName {
+	case "input":
+		switch node.InputType() {
+		case "checkbox":
+			if _, checked := node.GetAttribute("checked"); checked {
+				r.drawCheckMark(box)
+			}
+		case "radio":
+			if _, checked := node.GetAttribute("checked"); checked {
+				r.drawRadioDot(box)
+			}
+		case "button", "submit", "reset":
+			r.drawControlText(box, node.ButtonLabel(), textColor(box.Style), true, 0)
+		case "hidden", "image", "file", "range", "color":
+		default:
+			if value := displayValue(node); value != "" {
+				r.drawControlText(box, value, textColor(box.Style), false, 0)
+			} else if placeholder, ok := node.GetAttribute("placeholder"); ok {
+				r.drawControlText(box, placeholder, placeholderColor, false, 0)
+			}
+		}
+	case "textarea":
+		if placeholder, ok := node.GetAttribute("placeholder"); ok && node.TextContent() == "" {
+			r.drawControlText(box, placeholder, placeholderColor, false, 0)
+		}
+	case "select":
+		if node.IsListBox() {
+			r.drawListBox(box)
+			return
+		}
+		if opt := node.SelectedOption(); opt != nil {
+			r.drawControlText(box, opt.OptionLabel(), textColor(box.Style), false, layout.SelectArrowWidth)
+		}
+		r.drawSelectArrow(box)
+	}
+}
+
+// displayValue returns the text shown in a text input: its value, masked
+// for password fields.
+func displayValue(node *html.Node) string {
+	value := node.Value()
+	if node.InputType() == "password" {
+		return strings.Repeat("•", utf8.RuneCountInString(value))
+	}
+	return value
+}
+
+// CaretRect returns the position and height, in document coordinates, of
+// a text caret before the index'th character of a text field's value. The
+// caret of a textarea is always placed after its text.
+func CaretRect(box *layout.Box, index int) (x, y, height float64) {
+	style := box.Style
+	fontSize := style.GetFontSize()
+	families := style.GetFontFamilies()
+	bold := style.GetFontWeight() == css.FontWeightBold
+	italic := style.GetFontStyle() == css.FontStyleItalic
+	mono, ahem := style.IsMonospaceFamily(), style.IsAhemFamily()
+	m := text.MetricsWithFamilies(style.Fonts, fontSize, families, bold, italic, mono, ahem)
+
+	cx, cy, cw, ch := contentRect(box)
+
+	if box.Node.TagName == "textarea" {
+		if last := lastTextBox(box); last != nil {
+			return last.X + last.Width, last.Y, last.Height
+		}
+		return cx, cy, m.Ascent + m.Descent
+	}
+
+	runes := []rune(displayValue(box.Node))
+	index = max(0, min(index, len(runes)))
+	w, _ := text.MeasureTextWithFamilies(style.Fonts, string(runes[:index]), fontSize, families, bold, italic, mono, ahem)
+	return cx + min(w, cw), cy + (ch-m.Ascent-m.Descent)/2, m.Ascent + m.Descent
+}
+
+// lastTextBox returns the last box in the subtree that draws text.
+func lastTextBox(box *layout.Box) *layout.Box {
+	for i := len(box.Children) - 1; i >= 0; i-- {
+		if last := lastTextBox(box.Children[i]); last != nil {
+			return last
+		}
+	}
+	if box.Node != nil && box.Node.Type == html.TextNode && len(box.Children) == 0 {
+		return box
+	}
+	return nil
+}
+
+// textColor returns the box's color property, defaulting to black.
+func textColor(style *css.Style) css.Color {
+	if colorStr, ok := style.Get("color"); ok {
+		if c, ok := css.ParseColor(colorStr); ok {
+			return c
+		}
+	}
+	return css.Color{A: 1}
+}
+
+// contentBox returns the content box of a box in canvas coordinates.
+func (r *Renderer) contentBox(box *layout.Box) (x, y, w, h float64) {
+	x, y, w, h = contentRect(box)
+	return x, y - box.Y + r.getEffectiveY(box), w, h
+}
+
+// contentRect returns the content box of a box in document coordinates.
+func contentRect(box *layout.Box) (x, y, w, h float64) {
+	x = box.X + box.Border.Left + box.Padding.Left
+	y = box.Y + box.Border.Top + box.Padding.Top
+	w = box.Width - box.Border.Left - box.Padding.Left - box.Padding.Right - box.Border.Right
+	h = box.Height - box.Border.Top - box.Padding.Top - box.Padding.Bottom - box.Border.Bottom
+	return x, y, w, h
+}
+
+// drawControlText draws a single line of text vertically centered in the
+// content box, leaving reserve pixels free at the right.
+func (r *Renderer) drawControlText(box *layout.Box, s string, c css.Color, center bool, reserve float64) {
+	x, y, w, h := r.contentBox(box)
+	r.drawTextInRect(box.Style, s, c, x, y, w-reserve, h, center)
+}
+
+// drawTextInRect draws a single line of text vertically centered in the
+// rectangle, left-aligned or centered. Text that does not fit is cut off
+// at a character boundary.
+func (r *Renderer) drawTextInRect(style *css.Style, s string, c css.Color, x, y, w, h float64, center bool) {
+	if s == "" {
+		return
+	}
+	fontSize := style.GetFontSize()
+	families := style.GetFontFamilies()
+	bold := style.GetFontWeight() == css.FontWeightBold
+	italic := style.GetFontStyle() == css.FontStyleItalic
+	mono, ahem := style.IsMonospaceFamily(), style.IsAhemFamily()
+
+	measure := func(s string) float64 {
+		width, _ := text.MeasureTextWithFamilies(style.Fonts, s, fontSize, families, bold, italic, mono, ahem)
+		return width
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && measure(string(runes)) > w {
+		runes = runes[:len(runes)-1]
+	}
+	s = string(runes)
+	if center {
+		x += math.Max(0, (w-measure(s))/2)
+	}
+
+	r.loadFont(style.Fonts, fontSize, families, bold, italic, mono, ahem)
+	r.context.SetRGBA(float64(c.R)/255.0, float64(c.G)/255.0, float64(c.B)/255.0, c.A)
+	m := text.MetricsWithFamilies(style.Fonts, fontSize, families, bold, italic, mono, ahem)
+	r.context.DrawString(s, x, y+(h-m.Ascent-m.Descent)/2+m.Ascent)
+}
+
+// drawCheckMark draws the tick of a checked checkbox.
+func (r *Renderer) drawCheckMark(box *layout.Box) {
+	x, y, w, h := r.contentBox(box)
+	r.context.SetRGB(0.1, 0.1, 0.1)
+	r.context.SetLineWidth(math.Max(1.5, w/7))
+	r.context.MoveTo(x+w*0.2, y+h*0.5)
+	r.context.LineTo(x+w*0.42, y+h*0.75)
+	r.context.LineTo(x+w*0.8, y+h*0.25)
+	r.context.Stroke()
+}
+
+// drawRadioDot draws the dot of a checked radio button.
+func (r *Renderer) drawRadioDot(box *layout.Box) {
+	x, y, w, h := r.contentBox(box)
+	r.context.SetRGB(0.1, 0.1, 0.1)
+	r.context.DrawCircle(x+w/2, y+h/2, math.Min(w, h)*0.3)
+	r.context.Fill()
+}
+
+// drawSelectArrow draws the drop-down arrow at the right of a select box.
+func (r *Renderer) drawSelectArrow(box *layout.Box) {
+	x, y, w, h := r.contentBox(box)
+	cx, cy := x+w-layout.SelectArrowWidth/2, y+h/2
+	r.context.SetRGB(0.2, 0.2, 0.2)
+	r.context.MoveTo(cx-4, cy-2)
+	r.context.LineTo(cx+4, cy-2)
+	r.context.LineTo(cx, cy+3)
+	r.context.ClosePath()
+	r.context.Fill()
+}
+
+// drawListBox draws the options of a list box select one per row,
+// highlighting the selected ones.
+func (r *Renderer) drawListBox(box *layout.Box) {
+	x, y, w, h := r.contentBox(box)
+	style := box.Style
+	rowHeight := text.MetricsWithFamilies(style.Fonts, style.GetFontSize(), style.GetFontFamilies(),
+		style.GetFontWeight() == css.FontWeightBold, style.GetFontStyle() == css.FontStyleItalic,
+		style.IsMonospaceFamily(), style.IsAhemFamily()).NormalLineHeight()
+	for i, opt := range box.Node.Options() {
+		rowY := y + float64(i)*rowHeight
+		if rowY+rowHeight > y+h+0.5 {
+			break
+		}
+		if _, selected := opt.GetAttribute("selected"); selected {
+			r.context.SetRGB(0.8, 0.8, 0.8)
+			r.context.DrawRectangle(x, rowY, w, rowHeight)
+			r.context.Fill()
+		}
+		r.drawTextInRect(style, opt.OptionLabel(), textColor(style), x, rowY, w, rowHeight, false)
+	}
+}
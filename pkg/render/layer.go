@@ -0,0 +1,41 @@
+package render
+
+import (
+	"louis14/pkg/layout"
+)
+
+// layer is an offscreen surface that a group of boxes is painted into before
+// being composited onto the surface below it as a single image. Opacity is
+// applied to the group as a whole (CSS Color 3 §3.2), so overlapping
+// descendants don't show through each other. The display list records the
+// layer, and Replay paints and composites it.
+type layer struct {
+	fontKey   string
+	clipStack []*layout.Box
+	clipBase  int
+}
+
+// pushLayer redirects painting to a new transparent layer the size of the
+// canvas. Every pushLayer must be paired with a popLayer.
+func (r *Renderer) pushLayer() *layer {
+	l := &layer{
+		fontKey:   r.lastFontKey,
+		clipStack: r.clipStack,
+		clipBase:  r.clipBase,
+	}
+	r.context.BeginLayer()
+	r.lastFontKey = "" // Force font reload on the new layer
+	// The parent's clips apply when the layer composites
+	r.clipStack = append([]*layout.Box(nil), r.clipStack...)
+	r.clipBase = len(r.clipStack)
+	return l
+}
+
+// popLayer restores the surface below l and composites l onto it with the
+// given opacity. The parent's clip applies to the composite, so a layer
+// painted inside an overflow clip stays clipped.
+func (r *Renderer) popLayer(l *layer, opacity float64) {
+	r.context.EndLayer(opacity)
+	r.lastFontKey = l.fontKey
+	r.clipStack, r.clipBase = l.clipStack, l.clipBase
+}
@@ -0,0 +1,77 @@
+package render
+
+import "testing"
+
+func TestLayer_OverlappingChildrenCompositeAsGroup(t *testing.T) {
+	// Blue overlaps red by 20px. In the group, blue hides red before the
+	// group is faded; with their own opacity, red shows through blue.
+	im := renderHTML(t, `<div style="opacity:0.5;height:30px">
+		<div style="width:40px;height:10px;background:#f00"></div>
+		<div style="margin:-10px 0 0 20px;width:40px;height:20px;background:#00f"></div>
+	</div>
+	<div style="height:30px">
+		<div style="opacity:0.5;width:40px;height:10px;background:#f00"></div>
+		<div style="opacity:0.5;margin:-10px 0 0 20px;width:40px;height:20px;background:#00f"></div>
+	</div>`)
+	checkPixels(t, im, []pixel{
+		{10, 5, 255, 128, 128}, // Red only
+		{30, 5, 128, 128, 255}, // Overlap: blue only, at half
+		{50, 5, 128, 128, 255}, // Blue only
+		{10, 35, 255, 128, 128},
+		{30, 35, 128, 64, 191}, // Overlap: half blue over half red
+		{50, 35, 128, 128, 255},
+	})
+}
+
+func TestLayer_SplitInlineCompositesAsGroup(t *testing.T) {
+	// The blocks are lifted out of the span when it is split around them,
+	// but are still composited with its opacity as one group: where they
+	// overlap, blue hides red before the group is faded.
+	im := renderHTML(t, `<span style="opacity:0.5">
+		<div style="width:40px;height:10px;background:#f00"></div>
+		<div style="margin:-10px 0 0 20px;width:40px;height:20px;background:#00f"></div>
+	</span>`)
+	checkPixels(t, im, []pixel{
+		{10, 5, 255, 128, 128}, // Red only
+		{30, 5, 128, 128, 255}, // Overlap: blue only, at half
+		{50, 5, 128, 128, 255}, // Blue only
+	})
+}
+
+func TestLayer_ClipsInsideAndAroundGroup(t *testing.T) {
+	// A clip inside the layer applies to its content and ends with it; the
+	// clip around the layer applies to the composite.
+	im := renderHTML(t, `<div style="width:60px;height:40px;overflow:hidden">
+		<div style="opacity:0.5">
+			<div style="width:30px;height:20px;overflow:hidden">
+				<div style="width:80px;height:10px;background:#f00"></div>
+			</div>
+			<div style="width:80px;height:10px;background:#00f"></div>
+		</div>
+	</div>`)
+	checkPixels(t, im, []pixel{
+		{10, 5, 255, 128, 128},  // Red inside its clip
+		{45, 5, 255, 255, 255},  // Red past its clip
+		{45, 25, 128, 128, 255}, // Blue after the inner clip ended
+		{65, 25, 255, 255, 255}, // Blue past the outer clip
+	})
+}
+
+func TestLayer_EscapingChildKeepsCompositeClip(t *testing.T) {
+	// The absolute child escapes the clip of its grandparent, but that clip
+	// was applied before the layer began, so it still bounds the composite;
+	// the clip ends with the layer.
+	im := renderHTML(t, `<div style="width:40px;height:40px;overflow:hidden">
+		<div style="opacity:0.5">
+			<div style="position:absolute;left:20px;top:50px;width:60px;height:20px;background:#00f"></div>
+			<div style="width:80px;height:10px;background:#f00"></div>
+		</div>
+	</div>
+	<div style="width:80px;height:10px;background:#0f0"></div>`)
+	checkPixels(t, im, []pixel{
+		{10, 5, 255, 128, 128},  // Red inside the clip
+		{50, 5, 255, 255, 255},  // Red past the clip
+		{30, 60, 255, 255, 255}, // Blue outside the composite's clip
+		{60, 45, 0, 255, 0},     // Green after the layer, unclipped
+	})
+}
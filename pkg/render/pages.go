@@ -0,0 +1,28 @@
+package render
+
+import (
+	"context"
+	"fmt"
+
+	"louis14/pkg/layout"
+)
+
+// SavePagesPNG renders each page of a paged layout (see
+// layout.LayoutEngine.LayoutPaged) and saves it as a PNG. The renderer's
+// size is the page size. pattern names the files with a verb for the page
+// number, counted from 1, as in "page-%d.png". It returns the files saved,
+// stopping with the context's error once ctx is done.
+func (r *Renderer) SavePagesPNG(ctx context.Context, pages [][]*layout.Box, pattern string) ([]string, error) {
+	files := make([]string, 0, len(pages))
+	for i, page := range pages {
+		if err := r.Render(ctx, page); err != nil {
+			return files, err
+		}
+		name := fmt.Sprintf(pattern, i+1)
+		if err := r.SavePNG(name); err != nil {
+			return files, err
+		}
+		files = append(files, name)
+	}
+	return files, nil
+}
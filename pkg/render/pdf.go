@@ -0,0 +1,534 @@
+package render
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/math/fixed"
+)
+
+// pdfPointsPerPixel converts CSS pixels (96 per inch) to PDF points (72
+// per inch).
+const pdfPointsPerPixel = 0.75
+
+// PDFBackend is a Backend that records drawing as a PDF document (PDF 1.4).
+// Paths, text, and images stay vector: text is set in the TrueType fonts
+// the renderer loads, embedded whole, and falls back to Helvetica for faces
+// whose font file is unknown. Gradient fills are embedded as images. Layers
+// are transparency group XObjects, painted with their opacity.
+type PDFBackend struct {
+	vectorCanvas
+	pages   []*bytes.Buffer // Content stream of each page
+	content *bytes.Buffer   // Content stream of the current page or layer
+
+	alpha      float64            // Opacity of the ExtGState in effect
+	alphaStack []float64          // Saved by Push
+	alphas     map[string]float64 // ExtGState name -> opacity
+
+	images    map[image.Image]*pdfImage
+	imageList []*pdfImage
+
+	layers []pdfLayer // Open layers, innermost last
+	forms  [][]byte   // Content streams of the ended layers; form i is named Fm<i+1>
+}
+
+// pdfLayer is the state of the content a layer is painted into, saved by
+// BeginLayer.
+type pdfLayer struct {
+	content    *bytes.Buffer
+	state      vectorState
+	stack      []vectorState
+	alpha      float64
+	alphaStack []float64
+}
+
+// pdfImage is an image XObject.
+type pdfImage struct {
+	name string
+	img  image.Image
+}
+
+// NewPDFBackend creates a PDF document with one page of width x height CSS
+// pixels.
+func NewPDFBackend(width, height int) *PDFBackend {
+	b := &PDFBackend{
+		vectorCanvas: newVectorCanvas(width, height),
+		images:       make(map[image.Image]*pdfImage),
+		alphas:       make(map[string]float64),
+	}
+	b.NewPage()
+	return b
+}
+
+// NewPage starts a new, blank page, resetting the graphics state.
+func (b *PDFBackend) NewPage() {
+	b.content = &bytes.Buffer{}
+	b.pages = append(b.pages, b.content)
+	b.reset()
+	b.alpha, b.alphaStack = 1, nil
+	// Map CSS pixels, y down, onto the page; gg's strokes have round caps
+	// and joins
+	fmt.Fprintf(b.content, "%s 0 0 %s 0 %s cm 1 J 1 j\n",
+		vectorNum(pdfPointsPerPixel), vectorNum(-pdfPointsPerPixel), vectorNum(float64(b.height)*pdfPointsPerPixel))
+}
+
+// PageCount returns the number of pages.
+func (b *PDFBackend) PageCount() int {
+	return len(b.pages)
+}
+
+// Clear fills the page with the current color.
+func (b *PDFBackend) Clear() {
+	b.setAlpha(float64(b.state.color.A) / 255)
+	fmt.Fprintf(b.content, "%s 0 0 %d %d re f\n", b.colorOp("rg"), b.width, b.height)
+}
+
+// Transform and state
+
+func (b *PDFBackend) Push() {
+	b.push()
+	b.alphaStack = append(b.alphaStack, b.alpha)
+	b.content.WriteString("q\n")
+}
+
+func (b *PDFBackend) Pop() {
+	if !b.pop() {
+		return
+	}
+	b.alpha = b.alphaStack[len(b.alphaStack)-1]
+	b.alphaStack = b.alphaStack[:len(b.alphaStack)-1]
+	b.content.WriteString("Q\n")
+}
+
+// BeginLayer starts a transparency group that EndLayer paints. It starts
+// from the initial graphics state.
+func (b *PDFBackend) BeginLayer() {
+	b.layers = append(b.layers, pdfLayer{
+		content:    b.content,
+		state:      b.state,
+		stack:      b.stack,
+		alpha:      b.alpha,
+		alphaStack: b.alphaStack,
+	})
+	b.content = &bytes.Buffer{}
+	b.reset()
+	// A group starts with an opacity of 1 (PDF 1.4 §7.5.5)
+	b.alpha, b.alphaStack = 1, nil
+}
+
+// EndLayer ends the innermost layer, painting it as a form XObject with
+// the given opacity. Its content is in the same coordinates as the page's,
+// which the form is painted in.
+func (b *PDFBackend) EndLayer(opacity float64) {
+	if len(b.layers) == 0 {
+		return
+	}
+	for range b.stack {
+		b.content.WriteString("Q\n") // Pushes left open in the layer
+	}
+	form := b.content.Bytes()
+	l := b.layers[len(b.layers)-1]
+	b.layers = b.layers[:len(b.layers)-1]
+	b.content, b.state, b.stack = l.content, l.state, l.stack
+	b.alpha, b.alphaStack = l.alpha, l.alphaStack
+	if opacity <= 0 || len(form) == 0 {
+		return
+	}
+
+	b.forms = append(b.forms, form)
+	b.content.WriteString("q\n")
+	saved := b.alpha
+	b.setAlpha(min(opacity, 1))
+	fmt.Fprintf(b.content, "/Fm%d Do\nQ\n", len(b.forms))
+	b.alpha = saved
+}
+
+// Painting
+
+func (b *PDFBackend) Fill() {
+	if b.state.fill != nil {
+		if img, at, ok := b.rasterizeFill(); ok {
+			b.drawImage(img, gg.Translate(float64(at.X), float64(at.Y)))
+		}
+	} else if len(b.path) > 0 {
+		b.setAlpha(float64(b.state.color.A) / 255)
+		b.content.WriteString(b.colorOp("rg") + "\n")
+		b.writePath()
+		if b.state.evenOdd {
+			b.content.WriteString("f*\n")
+		} else {
+			b.content.WriteString("f\n")
+		}
+	}
+	b.clearPath()
+}
+
+func (b *PDFBackend) Stroke() {
+	if len(b.path) > 0 {
+		b.setAlpha(float64(b.state.color.A) / 255)
+		fmt.Fprintf(b.content, "%s %s w\n", b.colorOp("RG"), vectorNum(b.state.lineWidth))
+		b.writePath()
+		b.content.WriteString("S\n")
+	}
+	b.clearPath()
+}
+
+// Clip intersects the clip with the current path until the next Pop.
+func (b *PDFBackend) Clip() {
+	b.writePath()
+	if len(b.path) == 0 {
+		// An empty path clips everything away
+		b.content.WriteString("0 0 0 0 re ")
+	}
+	if b.state.evenOdd {
+		b.content.WriteString("W* n\n")
+	} else {
+		b.content.WriteString("W n\n")
+	}
+	b.clearPath()
+}
+
+func (b *PDFBackend) writePath() {
+	for _, seg := range b.path {
+		p := seg.pts
+		switch seg.op {
+		case 'm', 'l':
+			fmt.Fprintf(b.content, "%s %s %c\n", vectorNum(p[0].X), vectorNum(p[0].Y), seg.op)
+		case 'c':
+			fmt.Fprintf(b.content, "%s %s %s %s %s %s c\n", vectorNum(p[0].X), vectorNum(p[0].Y),
+				vectorNum(p[1].X), vectorNum(p[1].Y), vectorNum(p[2].X), vectorNum(p[2].Y))
+		case 'h':
+			b.content.WriteString("h\n")
+		}
+	}
+}
+
+// colorOp returns the operator setting the current color as the fill
+// ("rg") or stroke ("RG") color.
+func (b *PDFBackend) colorOp(op string) string {
+	c := b.state.color
+	return fmt.Sprintf("%s %s %s %s", vectorNum(float64(c.R)/255), vectorNum(float64(c.G)/255), vectorNum(float64(c.B)/255), op)
+}
+
+// setAlpha selects an ExtGState with the given fill and stroke opacity.
+func (b *PDFBackend) setAlpha(alpha float64) {
+	if alpha == b.alpha {
+		return
+	}
+	name := "GS" + strings.ReplaceAll(vectorNum(alpha), ".", "_")
+	b.alphas[name] = alpha
+	fmt.Fprintf(b.content, "/%s gs\n", name)
+	b.alpha = alpha
+}
+
+// Text
+
+// DrawString draws s with its baseline starting at (x, y).
+func (b *PDFBackend) DrawString(s string, x, y float64) {
+	f := b.state.font
+	if f == nil || s == "" {
+		return
+	}
+	// Glyph space is y up; flip it into the y-down current transform
+	m := b.state.matrix
+	ex, ey := m.TransformPoint(x, y)
+	b.setAlpha(float64(b.state.color.A) / 255)
+	fmt.Fprintf(b.content, "BT /%s %s Tf %s %s %s %s %s %s Tm %s ",
+		f.name, vectorNum(b.state.fontSize), vectorNum(m.XX), vectorNum(m.YX), vectorNum(-m.XY), vectorNum(-m.YY),
+		vectorNum(ex), vectorNum(ey), b.colorOp("rg"))
+
+	if f.ttf == nil {
+		var enc []byte
+		for _, r := range s {
+			if r > 0xff {
+				r = '?'
+			}
+			enc = append(enc, byte(r))
+		}
+		fmt.Fprintf(b.content, "<%X> Tj ET\n", enc)
+		return
+	}
+
+	// Glyph IDs with kerning adjustments, in thousandths of an em
+	scale := fixed.Int26_6(1000 << 6)
+	b.content.WriteString("[<")
+	prev, hasPrev := truetype.Index(0), false
+	for _, r := range s {
+		idx := f.ttf.Index(r)
+		if hasPrev {
+			if kern := f.ttf.Kern(scale, prev, idx); kern != 0 {
+				fmt.Fprintf(b.content, "> %s <", vectorNum(-float64(kern)/64))
+			}
+		}
+		fmt.Fprintf(b.content, "%04X", uint16(idx))
+		if _, ok := f.used[idx]; !ok {
+			f.used[idx] = r
+		}
+		prev, hasPrev = idx, true
+	}
+	b.content.WriteString(">] TJ ET\n")
+}
+
+// Images
+
+// DrawImage draws im with its top left corner at (x, y).
+func (b *PDFBackend) DrawImage(im image.Image, x, y int) {
+	b.drawImage(im, b.state.matrix.Translate(float64(x), float64(y)))
+}
+
+// drawImage draws im with its top left corner at the origin of m.
+func (b *PDFBackend) drawImage(im image.Image, m gg.Matrix) {
+	size := im.Bounds().Size()
+	if size.X <= 0 || size.Y <= 0 {
+		return
+	}
+	xo, ok := b.images[im]
+	if !ok {
+		xo = &pdfImage{name: fmt.Sprintf("Im%d", len(b.imageList)+1), img: im}
+		b.images[im] = xo
+		b.imageList = append(b.imageList, xo)
+	}
+	// Image space is the unit square with its first row at the top
+	w, h := float64(size.X), float64(size.Y)
+	ex, ey := m.TransformPoint(0, h)
+	b.setAlpha(1)
+	fmt.Fprintf(b.content, "q %s %s %s %s %s %s cm /%s Do Q\n",
+		vectorNum(m.XX*w), vectorNum(m.YX*w), vectorNum(-m.XY*h), vectorNum(-m.YY*h), vectorNum(ex), vectorNum(ey), xo.name)
+}
+
+// Output
+
+// Save writes the document to a file.
+func (b *PDFBackend) Save(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if _, err := b.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteTo writes the document.
+func (b *PDFBackend) WriteTo(w io.Writer) (int64, error) {
+	pw := &pdfWriter{}
+	pw.buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1 and 2 are the catalog and page tree, written last once
+	// the page objects are known
+	pw.reserve(2)
+	var resources strings.Builder
+	resources.WriteString("<< /ProcSet [/PDF /Text /ImageB /ImageC]")
+	if len(b.fontList) > 0 {
+		resources.WriteString(" /Font <<")
+		for _, f := range b.fontList {
+			fmt.Fprintf(&resources, " /%s %d 0 R", f.name, pw.writeFont(f))
+		}
+		resources.WriteString(" >>")
+	}
+	// The forms share the pages' resources, so are written once they are
+	formBase := len(pw.offsets) + 1
+	pw.reserve(len(b.forms))
+	if len(b.imageList) > 0 || len(b.forms) > 0 {
+		resources.WriteString(" /XObject <<")
+		for _, xo := range b.imageList {
+			fmt.Fprintf(&resources, " /%s %d 0 R", xo.name, pw.writeImage(xo.img))
+		}
+		for i := range b.forms {
+			fmt.Fprintf(&resources, " /Fm%d %d 0 R", i+1, formBase+i)
+		}
+		resources.WriteString(" >>")
+	}
+	if len(b.alphas) > 0 {
+		names := make([]string, 0, len(b.alphas))
+		for name := range b.alphas {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		resources.WriteString(" /ExtGState <<")
+		for _, name := range names {
+			a := vectorNum(b.alphas[name])
+			fmt.Fprintf(&resources, " /%s << /ca %s /CA %s >>", name, a, a)
+		}
+		resources.WriteString(" >>")
+	}
+	resources.WriteString(" >>")
+	resID := pw.object(resources.String())
+	for i, form := range b.forms {
+		pw.streamAt(formBase+i, fmt.Sprintf(" /Type /XObject /Subtype /Form /BBox [0 0 %d %d] "+
+			"/Group << /S /Transparency >> /Resources %d 0 R", b.width, b.height, resID), form)
+	}
+
+	var kids []string
+	mediaBox := fmt.Sprintf("[0 0 %s %s]", vectorNum(float64(b.width)*pdfPointsPerPixel), vectorNum(float64(b.height)*pdfPointsPerPixel))
+	for _, page := range b.pages {
+		contentID := pw.stream("", page.Bytes())
+		pageID := pw.object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox %s /Resources %d 0 R /Contents %d 0 R >>",
+			mediaBox, resID, contentID))
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageID))
+	}
+	pw.objectAt(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	pw.objectAt(2, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids)))
+
+	pw.finish()
+	n, err := w.Write(pw.buf.Bytes())
+	return int64(n), err
+}
+
+// pdfWriter lays out numbered objects and the cross-reference table.
+type pdfWriter struct {
+	buf     bytes.Buffer
+	offsets []int // Byte offset of each object, by number - 1
+}
+
+// reserve allocates object numbers to be written later with objectAt.
+func (pw *pdfWriter) reserve(n int) {
+	for i := 0; i < n; i++ {
+		pw.offsets = append(pw.offsets, -1)
+	}
+}
+
+func (pw *pdfWriter) object(body string) int {
+	pw.reserve(1)
+	id := len(pw.offsets)
+	pw.objectAt(id, body)
+	return id
+}
+
+func (pw *pdfWriter) objectAt(id int, body string) {
+	pw.offsets[id-1] = pw.buf.Len()
+	fmt.Fprintf(&pw.buf, "%d 0 obj\n%s\nendobj\n", id, body)
+}
+
+// stream writes a compressed stream object; dict holds entries besides
+// /Length and /Filter.
+func (pw *pdfWriter) stream(dict string, data []byte) int {
+	pw.reserve(1)
+	id := len(pw.offsets)
+	pw.streamAt(id, dict, data)
+	return id
+}
+
+// streamAt writes stream object id, reserved with reserve.
+func (pw *pdfWriter) streamAt(id int, dict string, data []byte) {
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(data)
+	zw.Close()
+	pw.offsets[id-1] = pw.buf.Len()
+	fmt.Fprintf(&pw.buf, "%d 0 obj\n<< /Length %d /Filter /FlateDecode%s >>\nstream\n", id, z.Len(), dict)
+	pw.buf.Write(z.Bytes())
+	pw.buf.WriteString("\nendstream\nendobj\n")
+}
+
+func (pw *pdfWriter) finish() {
+	xref := pw.buf.Len()
+	fmt.Fprintf(&pw.buf, "xref\n0 %d\n0000000000 65535 f \n", len(pw.offsets)+1)
+	for _, off := range pw.offsets {
+		fmt.Fprintf(&pw.buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&pw.buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(pw.offsets)+1, xref)
+}
+
+// writeFont writes a font and returns its object number. TrueType fonts
+// are embedded as CID fonts addressed by glyph ID (Identity-H), with the
+// widths and a ToUnicode map of the glyphs drawn.
+func (pw *pdfWriter) writeFont(f *vectorFont) int {
+	if f.ttf == nil {
+		return pw.object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	}
+	scale := fixed.Int26_6(1000 << 6)
+	units := func(v fixed.Int26_6) string { return vectorNum(math.Round(float64(v) / 64)) }
+	name := pdfFontName(f.ttf.Name(truetype.NameIDPostscriptName), f.name)
+
+	glyphs := make([]truetype.Index, 0, len(f.used))
+	for idx := range f.used {
+		glyphs = append(glyphs, idx)
+	}
+	sort.Slice(glyphs, func(i, j int) bool { return glyphs[i] < glyphs[j] })
+	var widths, toUnicode strings.Builder
+	for _, idx := range glyphs {
+		fmt.Fprintf(&widths, "%d [%s] ", idx, units(f.ttf.HMetric(scale, idx).AdvanceWidth))
+	}
+	toUnicode.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n" +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n" +
+		"/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n" +
+		"1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	for i := 0; i < len(glyphs); i += 100 {
+		chunk := glyphs[i:min(i+100, len(glyphs))]
+		fmt.Fprintf(&toUnicode, "%d beginbfchar\n", len(chunk))
+		for _, idx := range chunk {
+			fmt.Fprintf(&toUnicode, "<%04X> <", uint16(idx))
+			for _, u := range utf16.Encode([]rune{f.used[idx]}) {
+				fmt.Fprintf(&toUnicode, "%04X", u)
+			}
+			toUnicode.WriteString(">\n")
+		}
+		toUnicode.WriteString("endbfchar\n")
+	}
+	toUnicode.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+
+	bounds := f.ttf.Bounds(scale)
+	fileID := pw.stream(fmt.Sprintf(" /Length1 %d", len(f.data)), f.data)
+	descID := pw.object(fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 32 /FontBBox [%s %s %s %s] "+
+		"/ItalicAngle 0 /Ascent %s /Descent %s /CapHeight %s /StemV 80 /FontFile2 %d 0 R >>",
+		name, units(bounds.Min.X), units(bounds.Min.Y), units(bounds.Max.X), units(bounds.Max.Y),
+		units(bounds.Max.Y), units(bounds.Min.Y), units(bounds.Max.Y), fileID))
+	cidID := pw.object(fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s "+
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> "+
+		"/FontDescriptor %d 0 R /CIDToGIDMap /Identity /W [%s] >>", name, descID, widths.String()))
+	cmapID := pw.stream("", []byte(toUnicode.String()))
+	return pw.object(fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H "+
+		"/DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>", name, cidID, cmapID))
+}
+
+// writeImage writes an RGB image XObject, with a soft mask if the image
+// has transparency, and returns its object number.
+func (pw *pdfWriter) writeImage(im image.Image) int {
+	r := im.Bounds()
+	rgb := make([]byte, 0, r.Dx()*r.Dy()*3)
+	alpha := make([]byte, 0, r.Dx()*r.Dy())
+	opaque := true
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := color.NRGBAModel.Convert(im.At(x, y)).(color.NRGBA)
+			rgb = append(rgb, c.R, c.G, c.B)
+			alpha = append(alpha, c.A)
+			opaque = opaque && c.A == 255
+		}
+	}
+	dict := fmt.Sprintf(" /Type /XObject /Subtype /Image /Width %d /Height %d /BitsPerComponent 8", r.Dx(), r.Dy())
+	if !opaque {
+		maskID := pw.stream(dict+" /ColorSpace /DeviceGray", alpha)
+		dict += fmt.Sprintf(" /SMask %d 0 R", maskID)
+	}
+	return pw.stream(dict+" /ColorSpace /DeviceRGB", rgb)
+}
+
+// pdfFontName returns a PostScript font name usable as a PDF name, or
+// fallback if the font has none.
+func pdfFontName(name, fallback string) string {
+	clean := strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || strings.ContainsRune("()<>[]{}/%#", r) {
+			return -1
+		}
+		return r
+	}, name)
+	if clean == "" {
+		return fallback
+	}
+	return clean
+}
@@ -0,0 +1,275 @@
+package render
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"louis14/pkg/text"
+)
+
+// pdfObject is an object of a parsed PDF: its dictionary or other body,
+// and its decoded stream if it has one.
+type pdfObject struct {
+	dict   string
+	stream []byte
+}
+
+// parsePDF returns the objects of a PDF by number, checking that the
+// cross-reference table gives the offset of each.
+func parsePDF(t *testing.T, data []byte) map[int]pdfObject {
+	t.Helper()
+	m := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(data)
+	if m == nil {
+		t.Fatal("no startxref at the end of the file")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	lines := strings.Split(string(data[xref:]), "\n")
+	if lines[0] != "xref" {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+	var first, count int
+	if _, err := fmt.Sscanf(lines[1], "%d %d", &first, &count); err != nil || first != 0 {
+		t.Fatalf("bad xref subsection %q", lines[1])
+	}
+	if !strings.Contains(string(data[xref:]), fmt.Sprintf("/Size %d ", count)) {
+		t.Errorf("trailer /Size does not match the %d xref entries", count)
+	}
+
+	objects := make(map[int]pdfObject)
+	for id := 1; id < count; id++ {
+		var offset, gen int
+		var kind string
+		if _, err := fmt.Sscanf(lines[2+id], "%d %d %s", &offset, &gen, &kind); err != nil || kind != "n" {
+			t.Fatalf("bad xref entry %d: %q", id, lines[2+id])
+		}
+		header := fmt.Sprintf("%d 0 obj\n", id)
+		if !bytes.HasPrefix(data[offset:], []byte(header)) {
+			t.Fatalf("xref offset %d of object %d points at %q", offset, id, data[offset:min(offset+20, len(data))])
+		}
+		body := data[offset+len(header):]
+		body = body[:bytes.Index(body, []byte("\nendobj\n"))]
+		var obj pdfObject
+		if i := bytes.Index(body, []byte("\nstream\n")); i >= 0 {
+			obj.dict = string(body[:i])
+			zr, err := zlib.NewReader(bytes.NewReader(body[i+len("\nstream\n"):]))
+			if err != nil {
+				t.Fatalf("object %d: %v", id, err)
+			}
+			if obj.stream, err = io.ReadAll(zr); err != nil {
+				t.Fatalf("object %d: %v", id, err)
+			}
+		} else {
+			obj.dict = string(body)
+		}
+		objects[id] = obj
+	}
+	return objects
+}
+
+// pdfBytes returns the document b writes.
+func pdfBytes(t *testing.T, b *PDFBackend) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := b.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// findObjects returns the objects whose dictionaries contain all of parts.
+func findObjects(objects map[int]pdfObject, parts ...string) []pdfObject {
+	var found []pdfObject
+	for id := 1; id <= len(objects); id++ {
+		obj := objects[id]
+		matched := true
+		for _, part := range parts {
+			matched = matched && strings.Contains(obj.dict, part)
+		}
+		if matched {
+			found = append(found, obj)
+		}
+	}
+	return found
+}
+
+// pageContents returns the content streams of the pages, in order.
+func pageContents(t *testing.T, objects map[int]pdfObject) []string {
+	t.Helper()
+	var contents []string
+	for _, page := range findObjects(objects, "/Type /Page ") {
+		m := regexp.MustCompile(`/Contents (\d+) 0 R`).FindStringSubmatch(page.dict)
+		id, _ := strconv.Atoi(m[1])
+		contents = append(contents, string(objects[id].stream))
+	}
+	return contents
+}
+
+// checkBalanced checks that content saves and restores the graphics
+// state in pairs.
+func checkBalanced(t *testing.T, name, content string) {
+	t.Helper()
+	depth := 0
+	for _, op := range strings.Fields(content) {
+		switch op {
+		case "q":
+			depth++
+		case "Q":
+			depth--
+			if depth < 0 {
+				t.Errorf("%s: Q without q", name)
+				return
+			}
+		}
+	}
+	if depth != 0 {
+		t.Errorf("%s: %d q left open", name, depth)
+	}
+}
+
+func TestPDF_Structure(t *testing.T) {
+	ahem := text.DefaultFontConfig().Ahem
+	if _, err := os.Stat(ahem); err != nil {
+		t.Skipf("Ahem not available: %v", err)
+	}
+	b := NewPDFBackend(100, 80)
+	if err := b.LoadFontFace(ahem, 10); err != nil {
+		t.Fatal(err)
+	}
+	b.SetRGB(0, 0, 1)
+	b.DrawString("Hi", 10, 20)
+	im := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	im.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 255})
+	im.SetNRGBA(1, 0, color.NRGBA{0, 255, 0, 128})
+	b.DrawImage(im, 5, 5)
+	b.NewPage()
+	b.DrawRectangle(0, 0, 10, 10)
+	b.Fill()
+
+	objects := parsePDF(t, pdfBytes(t, b))
+	if pages := findObjects(objects, "/Type /Pages"); len(pages) != 1 || !strings.Contains(pages[0].dict, "/Count 2") {
+		t.Fatalf("expected a page tree of 2 pages, got %+v", pages)
+	}
+	contents := pageContents(t, objects)
+	for i, content := range contents {
+		checkBalanced(t, fmt.Sprintf("page %d", i+1), content)
+	}
+
+	// The text is set in the embedded font by glyph ID, in its color; the
+	// image is drawn 2x1 pixels at (5, 5), in points from the bottom
+	page := contents[0]
+	if !regexp.MustCompile(`BT /F\d+ 10 Tf 1 0 0 -1 10 20 Tm 0 0 1 rg \[<[0-9A-F]{8}>\] TJ ET`).MatchString(page) {
+		t.Errorf("expected the string at (10, 20) at 10pt, got:\n%s", page)
+	}
+	if !strings.Contains(page, "q 2 0 0 -1 5 6 cm /Im1 Do Q") {
+		t.Errorf("expected Im1 drawn at (5, 5), got:\n%s", page)
+	}
+	if strings.Contains(contents[1], "BT") || strings.Contains(contents[1], "Do") {
+		t.Errorf("expected only the rectangle on page 2, got:\n%s", contents[1])
+	}
+
+	font := findObjects(objects, "/Subtype /Type0")
+	if len(font) != 1 || !strings.Contains(font[0].dict, "/Encoding /Identity-H") {
+		t.Fatalf("expected one Type0 font, got %+v", font)
+	}
+	if files := findObjects(objects, "/Length1 "); len(files) != 1 {
+		t.Errorf("expected the font file embedded, got %d", len(files))
+	}
+	if cmaps := findObjects(objects, "/Length "); !containsStream(cmaps, "<0048>") || !containsStream(cmaps, "<0069>") {
+		t.Error("expected a ToUnicode map back to H and i")
+	}
+
+	// The image is RGB with its alpha as a soft mask
+	images := findObjects(objects, "/Subtype /Image", "/DeviceRGB")
+	if len(images) != 1 || !strings.Contains(images[0].dict, "/Width 2 /Height 1") || !strings.Contains(images[0].dict, "/SMask") {
+		t.Fatalf("expected one 2x1 image with a soft mask, got %+v", images)
+	}
+	if got := images[0].stream; !bytes.Equal(got, []byte{255, 0, 0, 0, 255, 0}) {
+		t.Errorf("image pixels: got %v", got)
+	}
+	if masks := findObjects(objects, "/Subtype /Image", "/DeviceGray"); len(masks) != 1 || !bytes.Equal(masks[0].stream, []byte{255, 128}) {
+		t.Errorf("expected the soft mask's alpha, got %+v", masks)
+	}
+}
+
+// containsStream reports whether any of the objects' streams contain s.
+func containsStream(objects []pdfObject, s string) bool {
+	for _, obj := range objects {
+		if bytes.Contains(obj.stream, []byte(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPDF_LayersAreTransparencyGroups(t *testing.T) {
+	b := NewPDFBackend(100, 80)
+	b.Push()
+	b.DrawRectangle(0, 0, 50, 50)
+	b.Clip()
+	b.BeginLayer()
+	b.SetRGB(1, 0, 0)
+	b.DrawRectangle(0, 0, 60, 40)
+	b.Fill()
+	b.BeginLayer()
+	b.Push() // Left open; the layer closes it
+	b.SetRGB(0, 0, 1)
+	b.DrawRectangle(0, 0, 80, 20)
+	b.Fill()
+	b.EndLayer(0.5)
+	b.EndLayer(0.25)
+	b.BeginLayer()
+	b.DrawRectangle(0, 0, 10, 10)
+	b.Fill()
+	b.EndLayer(0) // Invisible
+	b.Pop()
+
+	objects := parsePDF(t, pdfBytes(t, b))
+	if images := findObjects(objects, "/Subtype /Image"); len(images) != 0 {
+		t.Errorf("expected no images, got %d", len(images))
+	}
+	forms := findObjects(objects, "/Subtype /Form")
+	if len(forms) != 2 {
+		t.Fatalf("expected the two visible layers as forms, got %d", len(forms))
+	}
+	for i, form := range forms {
+		if !strings.Contains(form.dict, "/BBox [0 0 100 80]") || !strings.Contains(form.dict, "/Group << /S /Transparency >>") {
+			t.Errorf("form %d is not a transparency group: %s", i+1, form.dict)
+		}
+		checkBalanced(t, fmt.Sprintf("form %d", i+1), string(form.stream))
+	}
+
+	// The inner layer ends first, and is painted in the outer one; the
+	// outer one is painted on the page, inside the clip
+	inner, outer := string(forms[0].stream), string(forms[1].stream)
+	if !strings.Contains(inner, "0 0 1 rg") || strings.Contains(inner, "Do") {
+		t.Errorf("inner form: got\n%s", inner)
+	}
+	if !strings.Contains(outer, "1 0 0 rg") || !strings.Contains(outer, "q\n/GS0_5 gs\n/Fm1 Do\nQ\n") {
+		t.Errorf("outer form: got\n%s", outer)
+	}
+	page := pageContents(t, objects)[0]
+	checkBalanced(t, "page", page)
+	clip, paint := strings.Index(page, "W n"), strings.Index(page, "q\n/GS0_25 gs\n/Fm2 Do\nQ\n")
+	if clip < 0 || paint < clip || strings.Count(page, " Do") != 1 {
+		t.Errorf("expected Fm2 painted once at 0.25 inside the clip, got:\n%s", page)
+	}
+
+	resources := findObjects(objects, "/ExtGState")
+	if len(resources) != 1 {
+		t.Fatalf("expected shared resources, got %d", len(resources))
+	}
+	for _, gs := range []string{"/GS0_5 << /ca 0.5 /CA 0.5 >>", "/GS0_25 << /ca 0.25 /CA 0.25 >>", "/Fm1 ", "/Fm2 "} {
+		if !strings.Contains(resources[0].dict, gs) {
+			t.Errorf("resources lack %s: %s", gs, resources[0].dict)
+		}
+	}
+}
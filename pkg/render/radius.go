@@ -0,0 +1,115 @@
+package render
+
+import (
+	"math"
+
+	"louis14/pkg/css"
+	"louis14/pkg/layout"
+)
+
+// roundedRectPath adds a rectangle with elliptical corners to the current
+// path of dc as a closed subpath. Square corners (zero radius) are drawn sharp.
+func roundedRectPath(dc Backend, x, y, w, h float64, radii css.BorderRadii) {
+	tl, tr, br, bl := radii.TopLeft, radii.TopRight, radii.BottomRight, radii.BottomLeft
+	if tl.IsZero() {
+		tl = css.CornerRadius{}
+	}
+	if tr.IsZero() {
+		tr = css.CornerRadius{}
+	}
+	if br.IsZero() {
+		br = css.CornerRadius{}
+	}
+	if bl.IsZero() {
+		bl = css.CornerRadius{}
+	}
+
+	dc.NewSubPath()
+	dc.MoveTo(x+tl.X, y)
+	dc.LineTo(x+w-tr.X, y)
+	if !tr.IsZero() {
+		dc.DrawEllipticalArc(x+w-tr.X, y+tr.Y, tr.X, tr.Y, -math.Pi/2, 0)
+	}
+	dc.LineTo(x+w, y+h-br.Y)
+	if !br.IsZero() {
+		dc.DrawEllipticalArc(x+w-br.X, y+h-br.Y, br.X, br.Y, 0, math.Pi/2)
+	}
+	dc.LineTo(x+bl.X, y+h)
+	if !bl.IsZero() {
+		dc.DrawEllipticalArc(x+bl.X, y+h-bl.Y, bl.X, bl.Y, math.Pi/2, math.Pi)
+	}
+	dc.LineTo(x, y+tl.Y)
+	if !tl.IsZero() {
+		dc.DrawEllipticalArc(x+tl.X, y+tl.Y, tl.X, tl.Y, math.Pi, 3*math.Pi/2)
+	}
+	dc.ClosePath()
+}
+
+// drawBoxShape adds the border box (x, y, w, h) of box to the current path,
+// rounded by its border-radius if it has one.
+func (r *Renderer) drawBoxShape(box *layout.Box, x, y, w, h float64) {
+	if radii := box.Style.GetBorderRadii(w, h); !radii.IsZero() {
+		roundedRectPath(r.context, x, y, w, h, radii)
+	} else {
+		r.context.DrawRectangle(x, y, w, h)
+	}
+}
+
+// paintedBorderBox returns the painted border box of a box, extending inline
+// boxes by the borders and padding that bleed outside the line box.
+func (r *Renderer) paintedBorderBox(box *layout.Box) (x, y, w, h float64) {
+	x, y, w, h = box.X, r.getEffectiveY(box), box.Width, box.Height
+	if box.Style.GetDisplay() == css.DisplayInline {
+		h = box.Height + box.Border.Top + box.Padding.Top + box.Padding.Bottom + box.Border.Bottom
+		y -= box.Border.Top + box.Padding.Top
+	}
+	return x, y, w, h
+}
+
+// clipToPaddingBox intersects the clip with the padding box of the border
+// box (x, y, w, h), following the inner border edge's curvature.
+func (r *Renderer) clipToPaddingBox(box *layout.Box, x, y, w, h float64) {
+	px := x + box.Border.Left
+	py := y + box.Border.Top
+	pw := w - box.Border.Left - box.Border.Right
+	ph := h - box.Border.Top - box.Border.Bottom
+	radii := box.Style.GetBorderRadii(w, h)
+	if !radii.IsZero() {
+		inner := radii.Inset(box.Border.Top, box.Border.Right, box.Border.Bottom, box.Border.Left)
+		roundedRectPath(r.context, px, py, pw, ph, inner)
+	} else {
+		r.context.DrawRectangle(px, py, pw, ph)
+	}
+	r.context.Clip()
+}
+
+// clipToBorderRing intersects the clip with the area between the outer and
+// inner border edges of a rounded box.
+func (r *Renderer) clipToBorderRing(box *layout.Box, x, y, w, h float64, radii css.BorderRadii) {
+	inner := radii.Inset(box.Border.Top, box.Border.Right, box.Border.Bottom, box.Border.Left)
+	roundedRectPath(r.context, x, y, w, h, radii)
+	roundedRectPath(r.context, x+box.Border.Left, y+box.Border.Top,
+		w-box.Border.Left-box.Border.Right, h-box.Border.Top-box.Border.Bottom, inner)
+	r.context.SetFillRuleEvenOdd()
+	r.context.Clip()
+	r.context.SetFillRuleWinding()
+}
+
+// extendMiter extends the miter line from an outer border corner (ox, oy)
+// through the inner corner (ix, iy) until it reaches the box's center lines,
+// so side polygons still cover the border ring where it curves inside the
+// inner rectangle.
+func extendMiter(ox, oy, ix, iy, midX, midY float64) (float64, float64) {
+	dx, dy := ix-ox, iy-oy
+	t := math.Inf(1)
+	if dx != 0 {
+		t = math.Min(t, (midX-ox)/dx)
+	}
+	if dy != 0 {
+		t = math.Min(t, (midY-oy)/dy)
+	}
+	if math.IsInf(t, 1) || t < 1 {
+		return ix, iy
+	}
+	return ox + dx*t, oy + dy*t
+}
@@ -1,10 +1,10 @@
 package render
 
 import (
+	"context"
 	"fmt"
 	"image"
-	"image/color"
-	"image/draw"
+	"math"
 	"sort"
 	"strings"
 
@@ -17,16 +17,24 @@ import (
 )
 
 type Renderer struct {
-	context      *gg.Context
-	scrollY      float64              // Viewport scroll offset - non-fixed content is shifted by -scrollY
+	backend      Backend              // Output surface; a gg.Context unless set by NewRendererForBackend
+	context      *DisplayList         // Paint commands being recorded (see Record)
+	scrollY      float64              // Viewport offset - non-fixed content is shifted by -scrollY
 	imageFetcher images.ImageFetcher  // Optional fetcher for network images
+	baseURL      string               // Document URL or path that background image URIs resolve against
 	fonts        text.FontConfig      // Font configuration for text rendering
 	lastFontKey  string               // Tracks loaded font to avoid redundant loads
+	fontRegistry *text.FontRegistry   // Resolves font-family stacks; built lazily from fonts
+	clipStack    []*layout.Box        // Boxes whose overflow clips are pushed on context (see syncClips)
+	clipBase     int                  // Entries of clipStack applied by enclosing layers, not context
+	canvasSource *layout.Box          // Box whose background was propagated to the canvas (nil if none)
+	concurrency  int                  // Goroutines rasterizing tiles (see SetConcurrency)
+	ctx          context.Context      // Context of the Record in progress (nil between renders)
 }
 
 func NewRenderer(width, height int) *Renderer {
 	return &Renderer{
-		context: gg.NewContext(width, height),
+		backend: gg.NewContext(width, height),
 		fonts:   text.DefaultFontConfig(),
 	}
 }
@@ -35,7 +43,7 @@ func NewRenderer(width, height int) *Renderer {
 // The viewport dimensions are derived from the image bounds.
 func NewRendererForImage(target *image.RGBA) *Renderer {
 	return &Renderer{
-		context: gg.NewContextForRGBA(target),
+		backend: gg.NewContextForRGBA(target),
 		fonts:   text.DefaultFontConfig(),
 	}
 }
@@ -43,6 +51,7 @@ func NewRendererForImage(target *image.RGBA) *Renderer {
 // SetFonts sets the font configuration used for text rendering.
 func (r *Renderer) SetFonts(fonts text.FontConfig) {
 	r.fonts = fonts
+	r.fontRegistry = nil
 }
 
 // SetImageFetcher sets the image fetcher used to load network images during rendering.
@@ -50,10 +59,32 @@ func (r *Renderer) SetImageFetcher(fetcher images.ImageFetcher) {
 	r.imageFetcher = fetcher
 }
 
+// SetBaseURL sets the URL or file path of the document, which relative
+// background image URIs resolve against. Image boxes carry paths already
+// resolved by layout.
+func (r *Renderer) SetBaseURL(baseURL string) {
+	r.baseURL = baseURL
+}
+
 // loadFont loads a font face on the gg context for the given size and style.
-// Skips reloading if the same font+size is already active.
-func (r *Renderer) loadFont(fontSize float64, bold, italic, mono, ahem bool) {
+// A web font in fonts for one of families takes precedence; otherwise the
+// family stack is resolved against the configured and system fonts. Skips reloading if the same font+size is already active.
+func (r *Renderer) loadFont(fonts *text.FontSet, fontSize float64, families []string, bold, italic, mono, ahem bool) {
+	if face := text.WebFontFace(fonts, families, fontSize, bold, italic); face != nil {
+		key := fmt.Sprintf("web:%p", face)
+		if key != r.lastFontKey {
+			r.context.SetFontFace(face)
+			r.lastFontKey = key
+		}
+		return
+	}
 	fontPath := r.fonts.FontPath(bold, italic, mono, ahem)
+	if len(families) > 0 {
+		if r.fontRegistry == nil {
+			r.fontRegistry = text.NewFontRegistry(r.fonts)
+		}
+		fontPath = r.fontRegistry.Resolve(families).Path(bold, italic)
+	}
 	key := fmt.Sprintf("%s@%.1f", fontPath, fontSize)
 	if key == r.lastFontKey {
 		return
@@ -63,104 +94,202 @@ func (r *Renderer) loadFont(fontSize float64, bold, italic, mono, ahem bool) {
 	}
 }
 
-// SetScrollY sets the viewport scroll offset for rendering.
-// Non-fixed content will be shifted up by this amount.
-// Fixed-positioned content remains at its absolute position.
-func (r *Renderer) SetScrollY(scrollY float64) {
-	r.scrollY = scrollY
+// SetConcurrency sets how many goroutines rasterize a render onto a raster
+// backend, each painting horizontal tiles of the canvas from the shared
+// display list. With n <= 1, the default, the calling goroutine paints.
+func (r *Renderer) SetConcurrency(n int) {
+	r.concurrency = n
+}
+
+// SetViewportOffset sets how far down the page the rendered window starts,
+// so any window of a long page can be rendered into a viewport-sized image.
+// Non-fixed content is shifted up by y; fixed-positioned content, laid out
+// in viewport coordinates, stays where it is. Lay the page out with the
+// same offset (LayoutEngine.SetScrollY) so sticky boxes track the window.
+func (r *Renderer) SetViewportOffset(y float64) {
+	r.scrollY = y
 }
 
 // Render renders boxes using tree-based paint order (CSS 2.1 Appendix E).
 // This maintains proper parent-child relationships while respecting z-index stacking.
 // Fixed elements are painted in their natural tree order (not extracted and painted last).
 // This matches modern browser behavior where position:fixed creates a stacking context.
-func (r *Renderer) Render(boxes []*layout.Box) {
-	r.context.SetRGB(1, 1, 1)
-	r.context.Clear()
+// Rendering stops between stacking contexts, boxes, and paint commands once
+// ctx is done, returning the context's error; images are fetched with ctx.
+func (r *Renderer) Render(ctx context.Context, boxes []*layout.Box) error {
+	list, err := r.Record(ctx, boxes)
+	if err != nil {
+		return err
+	}
+	return r.paint(ctx, list)
+}
 
-	// CSS 2.1 §14.2: Background propagation to canvas
-	// If html has no background, propagate body's background to fill viewport
-	r.drawCanvasBackground(boxes)
+// Record builds the display list that Render paints: the paint commands for
+// boxes in paint order, without painting them. It returns the context's
+// error if ctx is done before the list is complete.
+func (r *Renderer) Record(ctx context.Context, boxes []*layout.Box) (*DisplayList, error) {
+	r.ctx = ctx
+	defer func() { r.ctx = nil }()
+	list := r.record(func() {
+		// CSS 2.1 §14.2: Background propagation to canvas
+		// If html has no background, propagate body's background to fill viewport
+		r.drawCanvasBackground(boxes)
+
+		// Render each root box as a stacking context (the root always forms one)
+		// This ensures proper CSS 2.1 Appendix E paint order for the entire document
+		for _, box := range boxes {
+			r.paintStackingContext(box)
+		}
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
 
-	// Render each root box as a stacking context (the root always forms one)
-	// This ensures proper CSS 2.1 Appendix E paint order for the entire document
-	for _, box := range boxes {
-		r.paintStackingContext(box)
+// paint paints list onto the backend, in tiles if it is raster and the
+// renderer is concurrent, until ctx is done.
+func (r *Renderer) paint(ctx context.Context, list *DisplayList) error {
+	if dc, ok := r.backend.(*gg.Context); ok && r.concurrency > 1 {
+		if im, ok := dc.Image().(*image.RGBA); ok {
+			return rasterizeTiles(ctx, list, im, r.concurrency)
+		}
+	}
+	p := player{target: r.backend}
+	return p.replay(ctx, list)
+}
+
+// canceled reports whether the context of the Record in progress is done,
+// so painting should stop.
+func (r *Renderer) canceled() bool {
+	return r.ctx != nil && r.ctx.Err() != nil
+}
+
+// fetchContext returns the context images are fetched with: that of the
+// Record in progress, or the background context outside one.
+func (r *Renderer) fetchContext() context.Context {
+	if r.ctx == nil {
+		return context.Background()
 	}
+	return r.ctx
+}
+
+// record returns the display list of paint, which paints onto a cleared
+// white canvas.
+func (r *Renderer) record(paint func()) *DisplayList {
+	r.context = NewDisplayList(r.backend.Width(), r.backend.Height())
+	r.lastFontKey = ""
+	r.clipStack, r.clipBase = nil, 0
+	r.canvasSource = nil
+	r.context.SetRGB(1, 1, 1)
+	r.context.Clear()
+	paint()
+	r.syncClips(nil)
+	list := r.context
+	r.context = nil
+	return list
 }
 
 // drawCanvasBackground implements CSS 2.1 §14.2 background propagation.
-// If html has no background, body's background propagates to fill the viewport canvas.
+// The root element's background paints the whole canvas; if html has no
+// background, body's is used instead. Images are positioned as for the
+// root element but tile across the canvas. The element whose background
+// the canvas took doesn't paint it again (see canvasSource).
 func (r *Renderer) drawCanvasBackground(boxes []*layout.Box) {
-	if len(boxes) == 0 {
+	root, source := canvasBackgroundSource(boxes)
+	if source == nil {
+		return
+	}
+	r.canvasSource = source
+	width := float64(r.context.Width())
+	height := float64(r.context.Height())
+
+	if bgColor, ok := source.Style.Get("background-color"); ok {
+		if color, ok := css.ParseColor(bgColor); ok && color.A > 0 {
+			r.context.SetRGBA(
+				float64(color.R)/255.0,
+				float64(color.G)/255.0,
+				float64(color.B)/255.0,
+				color.A)
+			r.context.DrawRectangle(0, 0, width, height)
+			r.context.Fill()
+		}
+	}
+
+	// The image's positioning area is the root element's, with the
+	// propagated style
+	area := *root
+	area.Style = source.Style
+	if grad, ok := source.Style.GetBackgroundGradient(); ok {
+		if tiles := r.backgroundTiles(&area, 0, 0); tiles != nil {
+			r.context.SetFillStyle(newGradientPattern(grad, tiles.x, tiles.y, tiles.w, tiles.h, tiles.repeatX, tiles.repeatY))
+			r.context.DrawRectangle(0, 0, width, height)
+			r.context.Fill()
+		}
+		return
+	}
+	img, ok := r.loadBackgroundImage(source.Style)
+	if !ok {
 		return
 	}
+	bounds := img.Bounds()
+	tiles := r.backgroundTiles(&area, float64(bounds.Dx()), float64(bounds.Dy()))
+	if tiles == nil {
+		return
+	}
+	tiles.clipX, tiles.clipY, tiles.clipW, tiles.clipH = 0, 0, width, height
+	r.drawImageTiles(img, tiles)
+}
 
-	// Find the html box (root element)
-	var htmlBox *layout.Box
+// canvasBackgroundSource returns the root (html) box and the box whose
+// background paints the canvas: the root if it has a background, else its
+// body child if that has one, else nil.
+func canvasBackgroundSource(boxes []*layout.Box) (root, source *layout.Box) {
 	for _, box := range boxes {
 		if box.Node != nil && box.Node.TagName == "html" {
-			htmlBox = box
+			root = box
 			break
 		}
 	}
-	if htmlBox == nil {
-		return
+	if root == nil {
+		return nil, nil
 	}
-
-	// Check if html has a background color
-	htmlHasBg := false
-	if htmlBox.Style != nil {
-		if bgColor, ok := htmlBox.Style.Get("background-color"); ok {
-			if color, ok := css.ParseColor(bgColor); ok && color.A > 0 {
-				// Html has background - use it for canvas
-				htmlHasBg = true
-				width := float64(r.context.Width())
-				height := float64(r.context.Height())
-				r.context.SetRGBA(
-					float64(color.R)/255.0,
-					float64(color.G)/255.0,
-					float64(color.B)/255.0,
-					color.A)
-				r.context.DrawRectangle(0, 0, width, height)
-				r.context.Fill()
+	if hasBackground(root.Style) {
+		return root, root
+	}
+	for _, child := range root.Children {
+		if child.Node != nil && child.Node.TagName == "body" {
+			if hasBackground(child.Style) {
+				return root, child
 			}
+			break
 		}
 	}
+	return root, nil
+}
 
-	// If html has no background, propagate body's background to canvas
-	if !htmlHasBg {
-		// Find body element (first child of html with TagName == "body")
-		var bodyBox *layout.Box
-		for _, child := range htmlBox.Children {
-			if child.Node != nil && child.Node.TagName == "body" {
-				bodyBox = child
-				break
-			}
-		}
-		if bodyBox != nil && bodyBox.Style != nil {
-			if bgColor, ok := bodyBox.Style.Get("background-color"); ok {
-				if color, ok := css.ParseColor(bgColor); ok && color.A > 0 {
-					// Body has background - propagate to canvas (fill viewport)
-					width := float64(r.context.Width())
-					height := float64(r.context.Height())
-					r.context.SetRGBA(
-						float64(color.R)/255.0,
-						float64(color.G)/255.0,
-						float64(color.B)/255.0,
-						color.A)
-					r.context.DrawRectangle(0, 0, width, height)
-					r.context.Fill()
-				}
-			}
+// hasBackground reports whether style paints a background: a visible
+// color, an image, or a gradient.
+func hasBackground(style *css.Style) bool {
+	if style == nil {
+		return false
+	}
+	if bgColor, ok := style.Get("background-color"); ok {
+		if color, ok := css.ParseColor(bgColor); ok && color.A > 0 {
+			return true
 		}
 	}
+	if _, ok := style.GetBackgroundGradient(); ok {
+		return true
+	}
+	_, ok := style.GetBackgroundImage()
+	return ok
 }
 
 // paintStackingContext paints a box that creates a stacking context,
 // following CSS 2.1 Appendix E paint order for ALL descendants.
 func (r *Renderer) paintStackingContext(box *layout.Box) {
-	if box == nil {
+	if box == nil || r.canceled() {
 		return
 	}
 
@@ -176,218 +305,225 @@ func (r *Renderer) paintStackingContext(box *layout.Box) {
 	}
 
 	if opacity < 1.0 {
-		// Render to an offscreen buffer, then composite with reduced alpha
-		r.paintWithOpacity(box, opacity)
+		// Render to an offscreen layer, then composite with reduced alpha
+		// through the clips that apply to this box
+		r.syncClips(box)
+		l := r.pushLayer()
+		r.paintStackingContextContents(box)
+		r.popLayer(l, opacity)
 		return
 	}
 
+	r.paintStackingContextContents(box)
+}
+
+// paintStackingContextContents paints a stacking context's box and
+// descendants in CSS 2.1 Appendix E order onto the current surface.
+func (r *Renderer) paintStackingContextContents(box *layout.Box) {
+	// Collect ALL descendants, categorized by paint order. Descendants are
+	// clipped to this box's padding box if it clips overflow; each paint
+	// syncs the clip stack to its own clipping ancestors.
+	lists := paintLists{root: box}
+	r.collectDescendantsForPaintOrder(box, &lists, true, true)
+
+	// Sort z-index groups
+	sort.SliceStable(lists.negativeZ, func(i, j int) bool {
+		return lists.negativeZ[i].ZIndex < lists.negativeZ[j].ZIndex
+	})
+	sort.SliceStable(lists.positiveZ, func(i, j int) bool {
+		return lists.positiveZ[i].ZIndex < lists.positiveZ[j].ZIndex
+	})
+
 	// Step 1: Background and borders of this element
 	r.drawBoxBackgroundAndBorders(box)
 
-	// Check if we need to clip overflow
-	needsClip := false
-	if box.Style != nil {
-		if overflow, ok := box.Style.Get("overflow"); ok {
-			needsClip = (overflow == "hidden" || overflow == "scroll" || overflow == "auto")
-		}
+	// Step 2: Child stacking contexts with negative z-index
+	for _, child := range lists.negativeZ {
+		r.paintStackingContext(child)
 	}
 
-	// Apply clipping if overflow: hidden/scroll/auto
-	if needsClip {
-		r.context.Push()
-		// CSS 2.1 §11.1.1: Clip to the padding box (inside border, outside padding)
-		clipX := box.X + box.Border.Left
-		clipY := box.Y + box.Border.Top
-		clipW := box.Width - box.Border.Left - box.Border.Right
-		clipH := box.Height - box.Border.Top - box.Border.Bottom
-
-		// Use rounded clip path when border-radius is set
-		var corners css.BorderRadiusCorners
-		if box.Style != nil {
-			corners = box.Style.GetBorderRadiusCorners()
-		}
-		if corners.MaxRadius() > 0 {
-			// Reduce each corner radius by border width for inner (padding box) clipping
-			clampZero := func(v float64) float64 { if v < 0 { return 0 }; return v }
-			r.context.DrawRoundedRectangleCorners(clipX, clipY, clipW, clipH,
-				clampZero(corners.TopLeft-box.Border.Left),
-				clampZero(corners.TopRight-box.Border.Right),
-				clampZero(corners.BottomRight-box.Border.Right),
-				clampZero(corners.BottomLeft-box.Border.Left))
+	// Steps 3-5: block backgrounds, floats, and inline content
+	r.paintFlow(box, &lists)
+
+	// Step 6: Positioned descendants with z-index: auto or 0
+	// These are painted "as if they generated a new stacking context" (CSS 2.1 Appendix E)
+	for _, child := range lists.zeroAutoZ {
+		if child.Position == css.PositionFixed || layout.BoxCreatesStackingContext(child) {
+			r.paintStackingContext(child)
 		} else {
-			r.context.DrawRectangle(clipX, clipY, clipW, clipH)
+			r.paintPseudoStackingContext(child)
 		}
-		r.context.Clip()
 	}
 
-	// Collect ALL descendants, categorized by paint order
-	var negativeZ, zeroAutoZ, positiveZ []*layout.Box
-	var blocks, floats, inlines []*layout.Box
-
-	r.collectDescendantsForPaintOrder(box, &negativeZ, &blocks, &floats, &inlines, &zeroAutoZ, &positiveZ)
-
-	// Sort z-index groups
-	sort.SliceStable(negativeZ, func(i, j int) bool {
-		return negativeZ[i].ZIndex < negativeZ[j].ZIndex
-	})
-	sort.SliceStable(positiveZ, func(i, j int) bool {
-		return positiveZ[i].ZIndex < positiveZ[j].ZIndex
-	})
-
-	// Step 2: Child stacking contexts with negative z-index
-	for _, child := range negativeZ {
+	// Step 7: Child stacking contexts with positive z-index
+	for _, child := range lists.positiveZ {
 		r.paintStackingContext(child)
 	}
+}
 
+// paintPseudoStackingContext paints a box "as if it generated a new stacking
+// context": floats, inline-blocks, and positioned boxes with z-index: auto.
+// Its positioned descendants and descendant stacking contexts belong to the
+// enclosing stacking context, which collected and paints them (CSS 2.1
+// Appendix E).
+func (r *Renderer) paintPseudoStackingContext(box *layout.Box) {
+	lists := paintLists{root: box}
+	r.collectDescendantsForPaintOrder(box, &lists, true, false)
+	r.drawBoxBackgroundAndBorders(box)
+	r.paintFlow(box, &lists)
+}
+
+// paintFlow paints steps 3-5 of Appendix E for box: in-flow block
+// backgrounds, floats, then inline-level content and block content.
+func (r *Renderer) paintFlow(box *layout.Box, lists *paintLists) {
 	// Step 3: In-flow, non-positioned, block-level descendants (backgrounds/borders)
-	for _, child := range blocks {
-		if child.Style != nil && child.Style.GetOverflow() != css.OverflowVisible {
-			r.paintStackingContext(child) // Paint atomically with clipping
-		} else {
-			r.drawBoxBackgroundAndBorders(child)
-		}
+	for _, child := range lists.blocks {
+		r.drawBoxBackgroundAndBorders(child)
 	}
 
 	// Step 4: Non-positioned floats
 	// Floats are painted with their own internal paint order (like a mini stacking context)
-	for _, child := range floats {
-		r.paintStackingContext(child)
+	for _, child := range lists.floats {
+		r.paintPseudoStackingContext(child)
 	}
 
 	// Step 5: In-flow, inline-level descendants (content paints here)
 	// This includes inline elements AND content of block elements
-	for _, child := range inlines {
+	for _, child := range lists.inlines {
+		if r.canceled() {
+			return
+		}
+		if isAtomicInline(child) {
+			r.paintPseudoStackingContext(child)
+			continue
+		}
 		r.drawBoxBackgroundAndBorders(child)
 		r.drawBoxContent(child)
 	}
 
 	// Also paint content of blocks at step 5 (text/images inside blocks)
-	for _, child := range blocks {
-		if child.Style != nil && child.Style.GetOverflow() != css.OverflowVisible {
-			continue // Already painted atomically in step 3
+	for _, child := range lists.blocks {
+		if r.canceled() {
+			return
 		}
 		r.drawBoxContent(child)
 	}
 
 	// Paint this box's own content
 	r.drawBoxContent(box)
-
-	// Step 6: Positioned descendants with z-index: auto or 0
-	// These are painted "as if they generated a new stacking context" (CSS 2.1 Appendix E)
-	for _, child := range zeroAutoZ {
-		r.paintStackingContext(child)
-	}
-
-	// Step 7: Child stacking contexts with positive z-index
-	for _, child := range positiveZ {
-		r.paintStackingContext(child)
-	}
-
-	// Restore clipping state if we applied clipping
-	if needsClip {
-		r.context.Pop()
-	}
 }
 
-// paintWithOpacity renders a stacking context to an offscreen buffer, then
-// composites it onto the main canvas with the specified opacity.
-func (r *Renderer) paintWithOpacity(box *layout.Box, opacity float64) {
-	width := r.context.Width()
-	height := r.context.Height()
-
-	// Create offscreen buffer
-	offscreen := image.NewRGBA(image.Rect(0, 0, width, height))
-	offCtx := gg.NewContextForRGBA(offscreen)
-
-	// Swap to offscreen context
-	oldCtx := r.context
-	oldFontKey := r.lastFontKey
-	r.context = offCtx
-	r.lastFontKey = "" // Force font reload on new context
-
-	// Paint the full stacking context contents to the offscreen buffer.
-	// Temporarily set opacity to 1 so the recursive call doesn't re-enter this path.
-	origOpacity := box.Style.GetOpacity()
-	box.Style.Set("opacity", "1")
-	r.paintStackingContext(box)
-	box.Style.Set("opacity", fmt.Sprintf("%g", origOpacity))
-
-	// Restore original context
-	r.context = oldCtx
-	r.lastFontKey = oldFontKey
-
-	// Multiply each pixel's alpha by the opacity, then composite onto main canvas
-	bounds := offscreen.Bounds()
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		rowStart := offscreen.PixOffset(bounds.Min.X, y)
-		rowEnd := rowStart + (bounds.Max.X-bounds.Min.X)*4
-		for i := rowStart + 3; i < rowEnd; i += 4 {
-			a := offscreen.Pix[i]
-			if a > 0 {
-				offscreen.Pix[i] = uint8(float64(a) * opacity)
-			}
-		}
-	}
+// paintLists holds the descendants of a stacking context (or of a box
+// painted as if it were one) grouped by Appendix E paint step.
+type paintLists struct {
+	negativeZ, blocks, floats, inlines, zeroAutoZ, positiveZ []*layout.Box
 
-	// Composite offscreen buffer onto main canvas
-	mainImage := oldCtx.Image().(*image.RGBA)
-	draw.Over.Draw(mainImage, bounds, offscreen, bounds.Min)
+	root   *layout.Box          // The box being painted
+	groups map[*layout.Box]bool // Opacity groups collected, each painted once
 }
 
 // collectDescendantsForPaintOrder recursively collects all descendants,
 // categorizing them by paint order. Stops at child stacking contexts.
-func (r *Renderer) collectDescendantsForPaintOrder(box *layout.Box,
-	negativeZ, blocks, floats, inlines, zeroAutoZ, positiveZ *[]*layout.Box) {
-
+// With flow set, in-flow blocks, floats, and inline content are collected;
+// with hoist set, positioned descendants and child stacking contexts are,
+// including those inside floats, inline-blocks, and positioned boxes, whose
+// own content paints atomically.
+func (r *Renderer) collectDescendantsForPaintOrder(box *layout.Box, lists *paintLists, flow, hoist bool) {
+	if !flow && !hoist {
+		return
+	}
 	for _, child := range box.Children {
-		if child.Position == css.PositionFixed {
-			// Fixed elements create stacking contexts in modern browsers
-			*zeroAutoZ = append(*zeroAutoZ, child)
-		} else if layout.BoxCreatesStackingContext(child) {
+		if group := opacityGroup(child, lists.root); group != nil {
+			// A piece of an inline split around blocks paints with the
+			// other pieces, in one layer with the inline's opacity
+			if hoist && !lists.groups[group] {
+				if lists.groups == nil {
+					lists.groups = make(map[*layout.Box]bool)
+				}
+				lists.groups[group] = true
+				lists.zeroAutoZ = append(lists.zeroAutoZ, group)
+			}
+			continue
+		}
+		if child.Position == css.PositionFixed || layout.BoxCreatesStackingContext(child) {
 			// Child creates stacking context - categorize by z-index
-			if child.ZIndex < 0 {
-				*negativeZ = append(*negativeZ, child)
-			} else if child.ZIndex > 0 {
-				*positiveZ = append(*positiveZ, child)
-			} else {
-				*zeroAutoZ = append(*zeroAutoZ, child)
+			// (fixed elements create stacking contexts in modern browsers)
+			if hoist {
+				if child.ZIndex < 0 {
+					lists.negativeZ = append(lists.negativeZ, child)
+				} else if child.ZIndex > 0 {
+					lists.positiveZ = append(lists.positiveZ, child)
+				} else {
+					lists.zeroAutoZ = append(lists.zeroAutoZ, child)
+				}
 			}
 			// Don't recurse into stacking contexts - they paint atomically
 		} else if layout.IsPositioned(child) {
 			// Positioned but no stacking context - paint at step 6
 			// "as if it generated a new stacking context" per CSS 2.1 Appendix E
-			// Don't recurse - its children are painted within its own paint order
-			*zeroAutoZ = append(*zeroAutoZ, child)
-		} else if layout.IsFloat(child) {
-			*floats = append(*floats, child)
-			// Don't recurse into float children - floats paint atomically at step 4
+			if hoist {
+				lists.zeroAutoZ = append(lists.zeroAutoZ, child)
+				r.collectDescendantsForPaintOrder(child, lists, false, true)
+			}
+		} else if layout.IsFloat(child) || isAtomicInline(child) {
+			// Floats paint at step 4 and inline-blocks at step 5, each atomically
+			if flow {
+				if layout.IsFloat(child) {
+					lists.floats = append(lists.floats, child)
+				} else {
+					lists.inlines = append(lists.inlines, child)
+				}
+			}
+			r.collectDescendantsForPaintOrder(child, lists, false, hoist)
 		} else if layout.IsInline(child) {
-			*inlines = append(*inlines, child)
+			if flow {
+				lists.inlines = append(lists.inlines, child)
+			}
 			// Recurse into inline's descendants (inline content is part of step 5)
-			r.collectDescendantsForPaintOrder(child, negativeZ, blocks, floats, inlines, zeroAutoZ, positiveZ)
-		} else if child.Style != nil && child.Style.GetOverflow() != css.OverflowVisible {
-			// Block with overflow clipping — paint atomically (don't flatten children)
-			*blocks = append(*blocks, child)
+			r.collectDescendantsForPaintOrder(child, lists, flow, hoist)
 		} else {
 			// Block element
-			*blocks = append(*blocks, child)
+			if flow {
+				lists.blocks = append(lists.blocks, child)
+			}
 			// Recurse into block's descendants to find inline content for step 5
-			r.collectDescendantsForPaintOrder(child, negativeZ, blocks, floats, inlines, zeroAutoZ, positiveZ)
+			r.collectDescendantsForPaintOrder(child, lists, flow, hoist)
 		}
 	}
 }
 
+// opacityGroup returns the opacity group a box is painted in as part of
+// painting root, or nil if it is painted on its own: the outermost of the
+// box's groups that root isn't or isn't inside.
+func opacityGroup(box, root *layout.Box) *layout.Box {
+	var group *layout.Box
+	for g := box.OpacityGroup; g != nil && g != root; g = g.OpacityGroup {
+		group = g
+	}
+	return group
+}
+
+// isAtomicInline returns true for inline-level boxes that establish their
+// own formatting context, such as inline-blocks. Appendix E paints them
+// atomically at step 5.
+func isAtomicInline(box *layout.Box) bool {
+	if box.Style == nil || box.Node == nil || box.Node.Type == html.TextNode {
+		return false
+	}
+	display, _ := box.Style.Get("display")
+	return display == "inline-block" || display == "inline-flex" || display == "inline-grid" || display == "inline-table"
+}
+
 // RenderLegacy uses the old flat-list rendering approach (kept for comparison)
 func (r *Renderer) RenderLegacy(boxes []*layout.Box) {
-	r.context.SetRGB(1, 1, 1)
-	r.context.Clear()
-
-	allBoxes := r.collectAllBoxes(boxes)
-	r.sortByZIndex(allBoxes)
+	r.paint(context.Background(), r.record(func() {
+		allBoxes := r.collectAllBoxes(boxes)
+		r.sortByZIndex(allBoxes)
 
-	for _, box := range allBoxes {
-		r.drawBox(box)
-	}
+		for _, box := range allBoxes {
+			r.drawBox(box)
+		}
+	}))
 }
 
 // collectAllBoxes flattens the box tree into a single list
@@ -438,6 +574,7 @@ func (r *Renderer) drawBoxBackgroundAndBorders(box *layout.Box) {
 	if box == nil || box.Style == nil {
 		return
 	}
+	r.syncClips(box)
 
 	// CSS 2.1 §11.2: visibility:hidden elements are invisible but still occupy space
 	if v := box.Style.GetVisibility(); v == "hidden" || v == "collapse" {
@@ -458,130 +595,47 @@ func (r *Renderer) drawBoxBackgroundAndBorders(box *layout.Box) {
 	// Get effective Y position (adjusted for scroll offset)
 	effectiveY := r.getEffectiveY(box)
 
-	// Check for gradient background first
-	hasGradient := false
-	if bgValue, ok := box.Style.Get("background"); ok {
-		if grad, ok := css.GetGradient(bgValue); ok {
-			r.drawGradientBackground(box, grad, effectiveY)
-			hasGradient = true
-		}
-	}
+	// Draw background color, unless the canvas took the background
+	if bgColor, ok := box.Style.Get("background-color"); ok && box != r.canvasSource {
+		if color, ok := css.ParseColor(bgColor); ok && color.A > 0 {
+			r.context.SetRGBA(
+				float64(color.R)/255.0,
+				float64(color.G)/255.0,
+				float64(color.B)/255.0,
+				color.A)
 
-	// Draw background color (only if no gradient was drawn)
-	if !hasGradient {
-		if bgColor, ok := box.Style.Get("background-color"); ok {
-			if color, ok := css.ParseColor(bgColor); ok && color.A > 0 {
-				r.context.SetRGBA(
-					float64(color.R)/255.0,
-					float64(color.G)/255.0,
-					float64(color.B)/255.0,
-					color.A)
-
-				bgX := box.X
-				bgY := effectiveY
-				bgWidth := box.Width   // Border-box dimensions
-				bgHeight := box.Height // Border-box dimensions
-
-				// CRITICAL FIX: For inline elements, box.Height is the line box height
-				// but borders/padding "bleed" outside the line box (CSS 2.1 §10.8.1)
-				// We must extend the background to cover the full bleeding area
-				if box.Style.GetDisplay() == css.DisplayInline {
-					// Add vertical borders and padding to line box height for rendering
-					bgHeight = box.Height + box.Border.Top + box.Padding.Top + box.Padding.Bottom + box.Border.Bottom
-					// Adjust Y position to account for top border/padding
-					bgY -= box.Border.Top + box.Padding.Top
-				}
+			bgX := box.X
+			bgY := effectiveY
+			bgWidth := box.Width   // Border-box dimensions
+			bgHeight := box.Height // Border-box dimensions
 
-				if bgWidth > 0 && bgHeight > 0 {
-					corners := box.Style.GetBorderRadiusCorners()
-					if corners.MaxRadius() > 0 {
-						r.context.DrawRoundedRectangleCorners(bgX, bgY, bgWidth, bgHeight,
-							corners.TopLeft, corners.TopRight, corners.BottomRight, corners.BottomLeft)
-					} else {
-						r.context.DrawRectangle(bgX, bgY, bgWidth, bgHeight)
-					}
-					r.context.Fill()
-				}
+			// CRITICAL FIX: For inline elements, box.Height is the line box height
+			// but borders/padding "bleed" outside the line box (CSS 2.1 §10.8.1)
+			// We must extend the background to cover the full bleeding area
+			if box.Style.GetDisplay() == css.DisplayInline {
+				// Add vertical borders and padding to line box height for rendering
+				bgHeight = box.Height + box.Border.Top + box.Padding.Top + box.Padding.Bottom + box.Border.Bottom
+				// Adjust Y position to account for top border/padding
+				bgY -= box.Border.Top + box.Padding.Top
+			}
+
+			if bgWidth > 0 && bgHeight > 0 {
+				r.drawBoxShape(box, bgX, bgY, bgWidth, bgHeight)
+				r.context.Fill()
 			}
 		}
 	}
 
 	// Draw background image
-	r.drawBackgroundImage(box)
-
-	// Draw border
-	r.drawBorder(box)
-}
-
-// drawGradientBackground renders a CSS gradient as the box background
-func (r *Renderer) drawGradientBackground(box *layout.Box, grad *css.Gradient, effectiveY float64) {
-	if grad == nil || grad.Type != css.GradientLinear {
-		return
-	}
-
-	bgX := box.X
-	bgY := effectiveY
-	bgWidth := box.Width
-	bgHeight := box.Height
-
-	// Handle inline element bleeding (same as solid color backgrounds)
-	if box.Style.GetDisplay() == css.DisplayInline {
-		bgHeight = box.Height + box.Border.Top + box.Padding.Top + box.Padding.Bottom + box.Border.Bottom
-		bgY -= box.Border.Top + box.Padding.Top
+	if box != r.canvasSource {
+		r.drawBackgroundImage(box)
 	}
 
-	if bgWidth <= 0 || bgHeight <= 0 {
-		return
-	}
+	// Inset shadows sit above the background, below the border
+	r.drawInsetBoxShadow(box)
 
-	// Convert pixel offsets to percentages based on gradient direction
-	gradCopy := *grad // Make a copy to avoid modifying the original
-	gradCopy.ConvertPixelOffsetsToPercentages(bgWidth, bgHeight)
-
-	// Determine gradient start and end points based on direction
-	var x0, y0, x1, y1 float64
-	switch gradCopy.Direction {
-	case "to right":
-		x0, y0 = bgX, bgY
-		x1, y1 = bgX+bgWidth, bgY
-	case "to left":
-		x0, y0 = bgX+bgWidth, bgY
-		x1, y1 = bgX, bgY
-	case "to bottom", "": // Default is to bottom
-		x0, y0 = bgX, bgY
-		x1, y1 = bgX, bgY+bgHeight
-	case "to top":
-		x0, y0 = bgX, bgY+bgHeight
-		x1, y1 = bgX, bgY
-	default:
-		// Default to "to bottom" for unsupported directions
-		x0, y0 = bgX, bgY
-		x1, y1 = bgX, bgY+bgHeight
-	}
-
-	// Create the gg gradient
-	ggGrad := gg.NewLinearGradient(x0, y0, x1, y1)
-
-	// Add color stops
-	for _, stop := range gradCopy.ColorStops {
-		// Convert to color.RGBA (Go standard library type)
-		alpha := uint8(stop.Color.A * 255)
-		c := color.RGBA{R: stop.Color.R, G: stop.Color.G, B: stop.Color.B, A: alpha}
-		ggGrad.AddColorStop(stop.Offset, c)
-	}
-
-	// Set the gradient as the fill pattern
-	r.context.SetFillStyle(ggGrad)
-
-	// Draw the rectangle
-	corners := box.Style.GetBorderRadiusCorners()
-	if corners.MaxRadius() > 0 {
-		r.context.DrawRoundedRectangleCorners(bgX, bgY, bgWidth, bgHeight,
-			corners.TopLeft, corners.TopRight, corners.BottomRight, corners.BottomLeft)
-	} else {
-		r.context.DrawRectangle(bgX, bgY, bgWidth, bgHeight)
-	}
-	r.context.Fill()
+	// Draw border
+	r.drawBorder(box)
 }
 
 // drawBoxContent draws the content of a box (text, images, scrollbars).
@@ -589,6 +643,7 @@ func (r *Renderer) drawBoxContent(box *layout.Box) {
 	if box == nil || box.Style == nil {
 		return
 	}
+	r.syncClips(box)
 
 	// CSS 2.1 §11.2: visibility:hidden elements are invisible but still occupy space
 	if v := box.Style.GetVisibility(); v == "hidden" || v == "collapse" {
@@ -606,19 +661,29 @@ func (r *Renderer) drawBoxContent(box *layout.Box) {
 	// Draw image
 	r.drawImage(box)
 
+	// Draw form control widgets (values, check marks, select arrows)
+	r.drawFormControl(box)
+
 	// Draw text
 	r.drawText(box)
 
-	// Draw scrollbar indicators (only for overflow:scroll which always shows scrollbars;
-	// overflow:auto only shows when content overflows, which we don't detect yet)
-	overflow := box.Style.GetOverflow()
-	if overflow == css.OverflowScroll {
-		r.drawScrollbarIndicators(box)
-	}
+	// Draw the scrollbar of a scroll container
+	r.drawScrollbar(box)
 }
 
 // drawBox draws a complete box (used by legacy renderer)
 func (r *Renderer) drawBox(box *layout.Box) {
+	// Phase 21: Clip to overflow:hidden|scroll|auto ancestors
+	r.syncClips(box)
+
+	// Phase 19: Apply opacity (wraps all drawing for this box). The legacy
+	// path draws boxes one at a time, so the layer holds only this box.
+	opacity := box.Style.GetOpacity()
+	if opacity < 1.0 {
+		l := r.pushLayer()
+		defer r.popLayer(l, opacity)
+	}
+
 	// Phase 16: Apply CSS transforms
 	transforms := box.Style.GetTransforms()
 	if len(transforms) > 0 {
@@ -627,21 +692,15 @@ func (r *Renderer) drawBox(box *layout.Box) {
 		defer r.context.Pop() // Restore graphics state after drawing
 	}
 
-	// Phase 19: Apply opacity (wraps all drawing for this box)
-	opacity := box.Style.GetOpacity()
-	if opacity < 1.0 {
-		r.context.Push()
-		defer r.context.Pop()
-	}
-
 	// Phase 19: Draw box-shadow (drawn first, underneath the box)
 	r.drawBoxShadow(box)
 
 	// Get effective Y position (adjusted for scroll offset)
 	effectiveY := r.getEffectiveY(box)
 
-	// Phase 2: Draw background (content + padding area, not including margin)
-	if bgColor, ok := box.Style.Get("background-color"); ok {
+	// Phase 2: Draw background (content + padding area, not including margin),
+	// unless the canvas took the background
+	if bgColor, ok := box.Style.Get("background-color"); ok && box != r.canvasSource {
 		if color, ok := css.ParseColor(bgColor); ok && color.A > 0 {
 			r.context.SetRGBA(
 				float64(color.R)/255.0,
@@ -658,46 +717,40 @@ func (r *Renderer) drawBox(box *layout.Box) {
 			bgHeight := box.Height // Border-box dimensions
 
 			if bgWidth > 0 && bgHeight > 0 {
-				// Phase 12: Check for border-radius
-				borderRadius := box.Style.GetBorderRadius()
-				if borderRadius > 0 {
-					r.context.DrawRoundedRectangle(bgX, bgY, bgWidth, bgHeight, borderRadius)
-				} else {
-					r.context.DrawRectangle(bgX, bgY, bgWidth, bgHeight)
-				}
+				// Phase 12: Round the background to the border-radius
+				r.drawBoxShape(box, bgX, bgY, bgWidth, bgHeight)
 				r.context.Fill()
 			}
 		}
 	}
 
 	// Phase 24: Draw background image
-	r.drawBackgroundImage(box)
+	if box != r.canvasSource {
+		r.drawBackgroundImage(box)
+	}
+
+	// Phase 19: Inset shadows sit above the background, below the border
+	r.drawInsetBoxShadow(box)
 
 	// Phase 2: Draw border
 	r.drawBorder(box)
 
-	// Phase 21: overflow clipping
-	overflow := box.Style.GetOverflow()
-
 	// Phase 8: Draw image
 	r.drawImage(box)
 
 	// Draw text
 	r.drawText(box)
 
-	// Phase 21: Draw scrollbar indicators (only for overflow:scroll;
-	// overflow:auto only shows when content overflows)
-	if overflow == css.OverflowScroll {
-		r.drawScrollbarIndicators(box)
-	}
+	// Phase 21: Draw the scrollbar of a scroll container
+	r.drawScrollbar(box)
 }
 
-// getBorderSideColor returns the color for a specific border side
-func (r *Renderer) getBorderSideColor(box *layout.Box, side string) (css.Color, bool) {
+// getBorderSideColor returns the color for a specific border side of style
+func (r *Renderer) getBorderSideColor(style *css.Style, side string) (css.Color, bool) {
 	// resolveCurrentColor resolves "currentcolor" to the element's color property
 	resolveCurrentColor := func(colorStr string) (css.Color, bool) {
 		if strings.EqualFold(colorStr, "currentcolor") {
-			if c, ok := box.Style.Get("color"); ok {
+			if c, ok := style.Get("color"); ok {
 				if color, ok := css.ParseColor(c); ok {
 					return color, true
 				}
@@ -709,19 +762,19 @@ func (r *Renderer) getBorderSideColor(box *layout.Box, side string) (css.Color,
 	}
 
 	// Check per-side color first
-	if colorStr, ok := box.Style.Get("border-" + side + "-color"); ok {
+	if colorStr, ok := style.Get("border-" + side + "-color"); ok {
 		if color, ok := resolveCurrentColor(colorStr); ok {
 			return color, true
 		}
 	}
 	// Fall back to global border-color
-	if colorStr, ok := box.Style.Get("border-color"); ok {
+	if colorStr, ok := style.Get("border-color"); ok {
 		if color, ok := resolveCurrentColor(colorStr); ok {
 			return color, true
 		}
 	}
 	// Fall back to element's color property (CSS spec: border-color defaults to currentColor)
-	if colorStr, ok := box.Style.Get("color"); ok {
+	if colorStr, ok := style.Get("color"); ok {
 		if color, ok := css.ParseColor(colorStr); ok {
 			return color, true
 		}
@@ -730,6 +783,10 @@ func (r *Renderer) getBorderSideColor(box *layout.Box, side string) (css.Color,
 }
 
 func (r *Renderer) drawBorder(box *layout.Box) {
+	if box.CollapsedBorder != nil {
+		r.drawCollapsedBorder(box)
+		return
+	}
 	if box.Border.Top == 0 && box.Border.Right == 0 && box.Border.Bottom == 0 && box.Border.Left == 0 {
 		return
 	}
@@ -749,23 +806,14 @@ func (r *Renderer) drawBorder(box *layout.Box) {
 	// Phase 12: Get border styles for each side
 	borderStyles := box.Style.GetBorderStyle()
 
-	// Phase 12: Check for uniform rounded borders (with per-corner support)
-	corners := box.Style.GetBorderRadiusCorners()
-	if corners.MaxRadius() > 0 && box.Border.Top == box.Border.Right &&
-		box.Border.Right == box.Border.Bottom && box.Border.Bottom == box.Border.Left {
-		// Draw uniform-width rounded border with per-corner radii
-		if color, ok := r.getBorderSideColor(box, "top"); ok {
-			r.context.SetRGBA(float64(color.R)/255.0, float64(color.G)/255.0, float64(color.B)/255.0, color.A)
-			r.context.SetLineWidth(box.Border.Top)
-			borderX := box.X + box.Border.Left/2
-			borderY := renderY + box.Border.Top/2
-			borderWidth := box.Width - box.Border.Left // Border-box dimensions
-			borderHeight := renderHeight - box.Border.Top // Border-box dimensions
-			r.context.DrawRoundedRectangleCorners(borderX, borderY, borderWidth, borderHeight,
-				corners.TopLeft, corners.TopRight, corners.BottomRight, corners.BottomLeft)
-			r.context.Stroke()
-		}
-		return
+	// Phase 12: Rounded borders are drawn as the usual side polygons, clipped
+	// to the ring between the outer and inner (curved) border edges
+	radii := box.Style.GetBorderRadii(box.Width, renderHeight)
+	rounded := !radii.IsZero()
+	if rounded {
+		r.context.Push()
+		defer r.context.Pop()
+		r.clipToBorderRing(box, box.X, renderY, box.Width, renderHeight, radii)
 	}
 
 	// Calculate border box coordinates using effective Y
@@ -778,148 +826,31 @@ func (r *Renderer) drawBorder(box *layout.Box) {
 	innerRight := box.X + box.Width - box.Border.Right // Border-box dimensions
 	innerBottom := renderY + renderHeight - box.Border.Bottom // Border-box dimensions
 
-	// Draw each side as a trapezoid (CSS mitered border rendering).
-	// Drawing order: bottom → left → right → top. Later-drawn sides
-	// overwrite boundary pixels at diagonal miters, so this order gives
-	// CSS priority: top > right > left > bottom at shared corners.
-
-	// Bottom border
-	if box.Border.Bottom > 0 && borderStyles.Bottom != css.BorderStyleNone {
-		if color, ok := r.getBorderSideColor(box, "bottom"); ok {
-			r.context.SetRGBA(float64(color.R)/255.0, float64(color.G)/255.0, float64(color.B)/255.0, color.A)
-			r.context.MoveTo(outerLeft, outerBottom)
-			r.context.LineTo(innerLeft, innerBottom)
-			r.context.LineTo(innerRight, innerBottom)
-			r.context.LineTo(outerRight, outerBottom)
-			r.context.ClosePath()
-			r.context.Fill()
-		}
-	}
-
-	// Left border
-	// Skip left border for LastFragment of split inline (CSS 2.1 §9.2.1.1)
-	if box.Border.Left > 0 && borderStyles.Left != css.BorderStyleNone && !box.IsLastFragment {
-		if color, ok := r.getBorderSideColor(box, "left"); ok {
-			r.context.SetRGBA(float64(color.R)/255.0, float64(color.G)/255.0, float64(color.B)/255.0, color.A)
-			r.context.MoveTo(outerLeft, outerTop)
-			r.context.LineTo(innerLeft, innerTop)
-			r.context.LineTo(innerLeft, innerBottom)
-			r.context.LineTo(outerLeft, outerBottom)
-			r.context.ClosePath()
-			r.context.Fill()
-		}
-	}
-
-	// Right border
-	// Skip right border for FirstFragment of split inline (CSS 2.1 §9.2.1.1)
-	if box.Border.Right > 0 && borderStyles.Right != css.BorderStyleNone && !box.IsFirstFragment {
-		if color, ok := r.getBorderSideColor(box, "right"); ok {
-			r.context.SetRGBA(float64(color.R)/255.0, float64(color.G)/255.0, float64(color.B)/255.0, color.A)
-			r.context.MoveTo(outerRight, outerTop)
-			r.context.LineTo(outerRight, outerBottom)
-			r.context.LineTo(innerRight, innerBottom)
-			r.context.LineTo(innerRight, innerTop)
-			r.context.ClosePath()
-			r.context.Fill()
-		}
-	}
-
-	// Top border
-	if box.Border.Top > 0 && borderStyles.Top != css.BorderStyleNone {
-		if color, ok := r.getBorderSideColor(box, "top"); ok {
-			r.context.SetRGBA(float64(color.R)/255.0, float64(color.G)/255.0, float64(color.B)/255.0, color.A)
-			r.context.MoveTo(outerLeft, outerTop)
-			r.context.LineTo(outerRight, outerTop)
-			r.context.LineTo(innerRight, innerTop)
-			r.context.LineTo(innerLeft, innerTop)
-			r.context.ClosePath()
-			r.context.Fill()
-		}
-	}
-}
-
-func (r *Renderer) drawBoxShadow(box *layout.Box) {
-	shadows := box.Style.GetBoxShadow()
-	if len(shadows) == 0 {
-		return
-	}
-
-	// Get effective Y position (adjusted for scroll offset)
-	effectiveY := r.getEffectiveY(box)
-
-	// Box dimensions (content + padding)
-	boxX := box.X
-	boxY := effectiveY
-	boxWidth := box.Width - box.Border.Left - box.Border.Right // Padding box
-	boxHeight := box.Height - box.Border.Top - box.Border.Bottom // Padding box
-	borderRadius := box.Style.GetBorderRadius()
-
-	// Draw shadows in reverse order (first declared = topmost)
-	for i := len(shadows) - 1; i >= 0; i-- {
-		shadow := shadows[i]
-
-		// Skip inset shadows for now (they render inside the box)
-		if shadow.Inset {
+	// Side polygons meet at these inner corners. For rounded boxes they are
+	// pushed along the miter lines so the curved parts of the ring are covered.
+	tlX, tlY := innerLeft, innerTop
+	trX, trY := innerRight, innerTop
+	brX, brY := innerRight, innerBottom
+	blX, blY := innerLeft, innerBottom
+	if rounded {
+		midX, midY := (outerLeft+outerRight)/2, (outerTop+outerBottom)/2
+		tlX, tlY = extendMiter(outerLeft, outerTop, innerLeft, innerTop, midX, midY)
+		trX, trY = extendMiter(outerRight, outerTop, innerRight, innerTop, midX, midY)
+		brX, brY = extendMiter(outerRight, outerBottom, innerRight, innerBottom, midX, midY)
+		blX, blY = extendMiter(outerLeft, outerBottom, innerLeft, innerBottom, midX, midY)
+	}
+
+	// Draw each side as a trapezoid (CSS mitered border rendering), in its
+	// own style
+	frame := borderFrame{x: box.X, y: renderY, w: box.Width, h: renderHeight, radii: radii, widths: box.Border}
+	sides := borderSides(box.Border, borderStyles, outerLeft, outerTop, outerRight, outerBottom,
+		gg.Point{X: tlX, Y: tlY}, gg.Point{X: trX, Y: trY}, gg.Point{X: brX, Y: brY}, gg.Point{X: blX, Y: blY})
+	for _, side := range sides {
+		if side.width <= 0 || side.style.IsNone() {
 			continue
 		}
-
-		// Calculate shadow rectangle
-		shadowX := boxX + shadow.OffsetX - shadow.Spread
-		shadowY := boxY + shadow.OffsetY - shadow.Spread
-		shadowWidth := boxWidth + 2*shadow.Spread
-		shadowHeight := boxHeight + 2*shadow.Spread
-
-		// For blur, we'll draw multiple layers with decreasing opacity
-		// This is a simple approximation of Gaussian blur
-		if shadow.Blur > 0 {
-			layers := int(shadow.Blur / 2)
-			if layers < 3 {
-				layers = 3
-			}
-			if layers > 10 {
-				layers = 10
-			}
-
-			for layer := layers; layer >= 0; layer-- {
-				// Expand each layer slightly
-				expand := float64(layer) * (shadow.Blur / float64(layers))
-				layerX := shadowX - expand
-				layerY := shadowY - expand
-				layerWidth := shadowWidth + 2*expand
-				layerHeight := shadowHeight + 2*expand
-
-				// Decrease opacity for outer layers
-				layerAlpha := shadow.Color.A * (1.0 - float64(layer)/float64(layers+1)) * 0.3
-
-				r.context.SetRGBA(
-					float64(shadow.Color.R)/255.0,
-					float64(shadow.Color.G)/255.0,
-					float64(shadow.Color.B)/255.0,
-					layerAlpha,
-				)
-
-				if borderRadius > 0 {
-					r.context.DrawRoundedRectangle(layerX, layerY, layerWidth, layerHeight, borderRadius+expand)
-				} else {
-					r.context.DrawRectangle(layerX, layerY, layerWidth, layerHeight)
-				}
-				r.context.Fill()
-			}
-		} else {
-			// No blur - just draw a solid shadow
-			r.context.SetRGBA(
-				float64(shadow.Color.R)/255.0,
-				float64(shadow.Color.G)/255.0,
-				float64(shadow.Color.B)/255.0,
-				shadow.Color.A,
-			)
-
-			if borderRadius > 0 {
-				r.context.DrawRoundedRectangle(shadowX, shadowY, shadowWidth, shadowHeight, borderRadius)
-			} else {
-				r.context.DrawRectangle(shadowX, shadowY, shadowWidth, shadowHeight)
-			}
-			r.context.Fill()
+		if color, ok := r.getBorderSideColor(box.Style, side.name); ok {
+			r.drawBorderSide(side, color, frame)
 		}
 	}
 }
@@ -961,7 +892,7 @@ func (r *Renderer) drawText(box *layout.Box) {
 	ahem := box.Style.IsAhemFamily()
 
 	// Load the appropriate font face
-	r.loadFont(fontSize, bold, italic, mono, ahem)
+	r.loadFont(box.Style.Fonts, fontSize, box.Style.GetFontFamilies(), bold, italic, mono, ahem)
 
 	r.context.SetRGB(0, 0, 0)
 	if colorStr, ok := box.Style.Get("color"); ok {
@@ -985,7 +916,7 @@ func (r *Renderer) drawText(box *layout.Box) {
 		for _, ch := range textContent {
 			charStr := string(ch)
 			r.context.DrawString(charStr, drawX, textY)
-			charWidth, _ := text.MeasureTextWithStyle(charStr, fontSize, bold, italic, mono, ahem)
+			charWidth, _ := text.MeasureTextWithFamilies(box.Style.Fonts, charStr, fontSize, box.Style.GetFontFamilies(), bold, italic, mono, ahem)
 			drawX += charWidth + letterSpacing
 		}
 	} else {
@@ -995,7 +926,7 @@ func (r *Renderer) drawText(box *layout.Box) {
 	// Phase 17: Draw text decorations
 	decoration := box.Style.GetTextDecoration()
 	if decoration != css.TextDecorationNone {
-		textWidth, _ := text.MeasureTextWithWeight(textContent, fontSize, bold)
+		textWidth, _ := text.MeasureTextWithFamilies(box.Style.Fonts, textContent, fontSize, box.Style.GetFontFamilies(), bold, italic, mono, ahem)
 
 		r.context.SetLineWidth(1)
 		switch decoration {
@@ -1030,27 +961,22 @@ func (r *Renderer) drawImage(box *layout.Box) {
 	effectiveY := r.getEffectiveY(box)
 
 	// Load the image (use fetcher if available)
-	img, err := images.LoadImageWithFetcher(box.ImagePath, r.imageFetcher)
+	img, err := images.LoadImageWithFetcher(r.fetchContext(), box.ImagePath, r.imageFetcher)
 	if err != nil {
-		// Image failed to load, draw placeholder
-		r.context.SetRGB(0.9, 0.9, 0.9)
-		r.context.DrawRectangle(box.X, effectiveY, box.Width, box.Height)
-		r.context.Fill()
-
-		r.context.SetRGB(0.5, 0.5, 0.5)
-		r.context.SetLineWidth(2)
-		r.context.DrawLine(box.X, effectiveY, box.X+box.Width, effectiveY+box.Height)
-		r.context.DrawLine(box.X+box.Width, effectiveY, box.X, effectiveY+box.Height)
-		r.context.Stroke()
+		r.drawBrokenImage(box, effectiveY)
 		return
 	}
 
-	r.context.Push()
-	r.context.Translate(box.X+box.Border.Left+box.Padding.Left, effectiveY+box.Border.Top+box.Padding.Top)
-
 	bounds := img.Bounds()
 	imgW := float64(bounds.Dx())
 	imgH := float64(bounds.Dy())
+	if imgW == 0 || imgH == 0 {
+		// Nothing to draw, as for a canvas too large to have a bitmap
+		return
+	}
+
+	r.context.Push()
+	r.context.Translate(box.X+box.Border.Left+box.Padding.Left, effectiveY+box.Border.Top+box.Padding.Top)
 
 	scaleX := box.Width / imgW
 	scaleY := box.Height / imgH
@@ -1060,157 +986,260 @@ func (r *Renderer) drawImage(box *layout.Box) {
 	r.context.Pop()
 }
 
-// drawBackgroundImage renders a CSS background-image on a box
-func (r *Renderer) drawBackgroundImage(box *layout.Box) {
-	imgURL, ok := box.Style.GetBackgroundImage()
-	if !ok {
+// drawBrokenImage draws the placeholder for an image that failed to load
+// in the content box of box, whose top is at y: a thin frame, a broken
+// picture icon, and the image's alt text, clipped to the box.
+func (r *Renderer) drawBrokenImage(box *layout.Box, y float64) {
+	x := box.X + box.Border.Left + box.Padding.Left
+	y += box.Border.Top + box.Padding.Top
+	if box.Width <= 0 || box.Height <= 0 {
 		return
 	}
-
-	img, err := images.LoadImageWithFetcher(imgURL, r.imageFetcher)
-	if err != nil {
-		return
+	var alt string
+	if box.Node != nil {
+		alt, _ = box.Node.GetAttribute("alt")
 	}
 
-	effectiveY := r.getEffectiveY(box)
+	// Load the font first: Pop restores the face that was current at Push
+	fontSize := box.Style.GetFontSize()
+	if alt != "" {
+		bold := box.Style.GetFontWeight() == css.FontWeightBold
+		italic := box.Style.GetFontStyle() == css.FontStyleItalic
+		r.loadFont(box.Style.Fonts, fontSize, box.Style.GetFontFamilies(), bold, italic, box.Style.IsMonospaceFamily(), box.Style.IsAhemFamily())
+	}
 
-	bgX := box.X
-	bgY := effectiveY
-	bgWidth := box.Width // Border-box dimensions
-	bgHeight := box.Height // Border-box dimensions
+	r.context.Push()
+	r.context.DrawRectangle(x, y, box.Width, box.Height)
+	r.context.Clip()
 
-	bounds := img.Bounds()
-	imgW := float64(bounds.Dx())
-	imgH := float64(bounds.Dy())
+	// A frame shows the size of an image larger than its placeholder
+	size := layout.BrokenImageIconSize
+	if box.Width > size+layout.BrokenImageGap && box.Height > size {
+		r.context.SetRGB(0.75, 0.75, 0.75)
+		r.context.SetLineWidth(1)
+		r.context.DrawRectangle(x+0.5, y+0.5, box.Width-1, box.Height-1)
+		r.context.Stroke()
+	}
 
-	// Apply background-size
-	bgSize := box.Style.GetBackgroundSize()
-	scaleX, scaleY := 1.0, 1.0
-	if bgSize.Cover {
-		// Scale to cover the entire background area (may crop)
-		sx := bgWidth / imgW
-		sy := bgHeight / imgH
-		scale := sx
-		if sy > sx {
-			scale = sy
-		}
-		scaleX, scaleY = scale, scale
-		imgW *= scale
-		imgH *= scale
-	} else if bgSize.Contain {
-		// Scale to fit within the background area (may leave gaps)
-		sx := bgWidth / imgW
-		sy := bgHeight / imgH
-		scale := sx
-		if sy < sx {
-			scale = sy
-		}
-		scaleX, scaleY = scale, scale
-		imgW *= scale
-		imgH *= scale
-	} else {
-		// Explicit dimensions
-		targetW, targetH := bgSize.Width, bgSize.Height
-		// Resolve percentage values (stored as negative)
-		if targetW < 0 {
-			targetW = bgWidth * (-targetW) / 100
-		}
-		if targetH < 0 {
-			targetH = bgHeight * (-targetH) / 100
-		}
-		if targetW > 0 && targetH > 0 {
-			scaleX = targetW / float64(bounds.Dx())
-			scaleY = targetH / float64(bounds.Dy())
-			imgW = targetW
-			imgH = targetH
-		} else if targetW > 0 {
-			scaleX = targetW / float64(bounds.Dx())
-			scaleY = scaleX // Maintain aspect ratio
-			imgW = targetW
-			imgH = float64(bounds.Dy()) * scaleY
-		} else if targetH > 0 {
-			scaleY = targetH / float64(bounds.Dy())
-			scaleX = scaleY // Maintain aspect ratio
-			imgW = float64(bounds.Dx()) * scaleX
-			imgH = targetH
+	// The icon: a picture of a hill under the sky, torn across
+	r.context.SetRGB(0.88, 0.93, 0.98)
+	r.context.DrawRectangle(x+1, y+1, size-2, size-2)
+	r.context.Fill()
+	r.context.SetRGB(0.36, 0.66, 0.36)
+	r.context.MoveTo(x+1, y+size-1)
+	r.context.LineTo(x+size*0.45, y+size*0.5)
+	r.context.LineTo(x+size-1, y+size-1)
+	r.context.ClosePath()
+	r.context.Fill()
+	r.context.SetRGB(0.95, 0.75, 0.2)
+	r.context.DrawCircle(x+size*0.72, y+size*0.3, size*0.12)
+	r.context.Fill()
+	r.context.SetRGB(0.55, 0.55, 0.55)
+	r.context.SetLineWidth(1)
+	r.context.DrawRectangle(x+1.5, y+1.5, size-3, size-3)
+	r.context.Stroke()
+	r.context.SetRGB(1, 1, 1)
+	r.context.SetLineWidth(1.5)
+	r.context.MoveTo(x+size*0.55, y)
+	r.context.LineTo(x+size*0.4, y+size*0.45)
+	r.context.LineTo(x+size*0.6, y+size*0.6)
+	r.context.LineTo(x+size*0.45, y+size)
+	r.context.Stroke()
+
+	// The alt text beside it, in the element's font and color
+	if alt != "" {
+		r.context.SetRGB(0, 0, 0)
+		if colorStr, ok := box.Style.Get("color"); ok {
+			if color, ok := css.ParseColor(colorStr); ok {
+				r.context.SetRGBA(float64(color.R)/255.0, float64(color.G)/255.0, float64(color.B)/255.0, color.A)
+			}
 		}
+		r.context.DrawString(alt, x+size+layout.BrokenImageGap, y+r.context.FontAscent())
 	}
+	r.context.Pop()
+}
 
-	repeat := box.Style.GetBackgroundRepeat()
-	pos := box.Style.GetBackgroundPosition()
-	attachment := box.Style.GetBackgroundAttachment()
+// drawBackgroundImage renders a CSS background-image on a box. The image is
+// sized by background-size, placed by background-position within the
+// padding box (background-origin: padding-box), and tiled across the border
+// box according to background-repeat (CSS Backgrounds 3 §3).
+func (r *Renderer) drawBackgroundImage(box *layout.Box) {
+	if grad, ok := box.Style.GetBackgroundGradient(); ok {
+		r.drawGradientBackground(box, grad)
+		return
+	}
 
-	originX := bgX
-	originY := bgY
-	if attachment == "fixed" {
-		originX = 0
-		originY = 0
+	img, ok := r.loadBackgroundImage(box.Style)
+	if !ok {
+		return
+	}
+	bounds := img.Bounds()
+	tiles := r.backgroundTiles(box, float64(bounds.Dx()), float64(bounds.Dy()))
+	if tiles == nil {
+		return
 	}
 
+	// Clip to the border box, rounded by border-radius
 	r.context.Push()
-	r.context.DrawRectangle(bgX, bgY, bgWidth, bgHeight)
+	r.drawBoxShape(box, tiles.clipX, tiles.clipY, tiles.clipW, tiles.clipH)
 	r.context.Clip()
+	r.drawImageTiles(img, tiles)
+	r.context.Pop()
+}
+
+// loadBackgroundImage loads the background image of style. It returns false
+// if there is none or it can't be loaded or is empty.
+func (r *Renderer) loadBackgroundImage(style *css.Style) (image.Image, bool) {
+	imgURL, ok := style.GetBackgroundImage()
+	if !ok {
+		return nil, false
+	}
+	img, err := images.LoadImageWithFetcher(r.fetchContext(), images.ResolveURI(r.baseURL, imgURL), r.imageFetcher)
+	if err != nil {
+		return nil, false
+	}
+	bounds := img.Bounds()
+	return img, bounds.Dx() > 0 && bounds.Dy() > 0
+}
 
-	needsScale := scaleX != 1.0 || scaleY != 1.0
-	drawClipped := func(drawX, drawY int) {
+// drawImageTiles draws img at every tile of tiles, scaled to the tile size.
+// The caller clips to the painting area.
+func (r *Renderer) drawImageTiles(img image.Image, tiles *backgroundTiles) {
+	bounds := img.Bounds()
+	scaleX := tiles.w / float64(bounds.Dx())
+	scaleY := tiles.h / float64(bounds.Dy())
+	needsScale := math.Abs(scaleX-1) > 1e-9 || math.Abs(scaleY-1) > 1e-9
+
+	tiles.each(func(x, y float64) {
 		if needsScale {
 			r.context.Push()
-			r.context.Translate(float64(drawX), float64(drawY))
+			r.context.Translate(x, y)
 			r.context.Scale(scaleX, scaleY)
 			r.context.DrawImage(img, 0, 0)
 			r.context.Pop()
 		} else {
-			r.context.DrawImage(img, drawX, drawY)
+			r.context.DrawImage(img, int(math.Round(x)), int(math.Round(y)))
 		}
+	})
+}
+
+// backgroundTiles describes how a background image is laid out: the size
+// and origin of one tile, which axes repeat, and the painting area (the
+// border box) the tiles cover.
+type backgroundTiles struct {
+	x, y, w, h                 float64 // the positioned tile
+	repeatX, repeatY           bool
+	clipX, clipY, clipW, clipH float64 // painting area
+}
+
+// backgroundTiles computes the tile layout for a background image with the
+// given intrinsic size, or 0 for images without one (gradients). Returns
+// nil if there is nothing to paint.
+func (r *Renderer) backgroundTiles(box *layout.Box, imgW, imgH float64) *backgroundTiles {
+	x, y, w, h := r.paintedBorderBox(box)
+	if w <= 0 || h <= 0 {
+		return nil
 	}
 
-	switch repeat {
-	case css.BackgroundRepeatNoRepeat:
-		drawClipped(int(originX+pos.X), int(originY+pos.Y))
+	// Positioning area: the padding box, or the viewport for fixed backgrounds
+	areaX := x + box.Border.Left
+	areaY := y + box.Border.Top
+	areaW := w - box.Border.Left - box.Border.Right
+	areaH := h - box.Border.Top - box.Border.Bottom
+	if box.Style.GetBackgroundAttachment() == "fixed" {
+		areaX, areaY = 0, 0
+		areaW, areaH = float64(r.context.Width()), float64(r.context.Height())
+	}
+	if areaW <= 0 || areaH <= 0 {
+		return nil
+	}
 
-	case css.BackgroundRepeatRepeatX:
-		startX := pos.X
-		for startX > 0 {
-			startX -= imgW
-		}
-		tileEndX := bgX + bgWidth - originX
-		for x := startX; x < tileEndX; x += imgW {
-			drawClipped(int(originX+x), int(originY+pos.Y))
+	tileW, tileH := backgroundSize(box.Style.GetBackgroundSize(), areaW, areaH, imgW, imgH)
+	if tileW < 0.5 || tileH < 0.5 {
+		return nil
+	}
+	posX, posY := box.Style.GetBackgroundPosition().Resolve(areaW, areaH, tileW, tileH)
+
+	repeat := box.Style.GetBackgroundRepeat()
+	return &backgroundTiles{
+		x: areaX + posX, y: areaY + posY, w: tileW, h: tileH,
+		repeatX: repeat == css.BackgroundRepeatRepeat || repeat == css.BackgroundRepeatRepeatX,
+		repeatY: repeat == css.BackgroundRepeatRepeat || repeat == css.BackgroundRepeatRepeatY,
+		clipX:   x, clipY: y, clipW: w, clipH: h,
+	}
+}
+
+// each calls draw with the origin of every tile that intersects the
+// painting area.
+func (t *backgroundTiles) each(draw func(x, y float64)) {
+	startX, endX := t.x, t.x
+	if t.repeatX {
+		startX = t.x - math.Ceil((t.x-t.clipX)/t.w)*t.w
+		endX = t.clipX + t.clipW
+	}
+	startY, endY := t.y, t.y
+	if t.repeatY {
+		startY = t.y - math.Ceil((t.y-t.clipY)/t.h)*t.h
+		endY = t.clipY + t.clipH
+	}
+	for y := startY; y <= endY && y < t.clipY+t.clipH; y += t.h {
+		for x := startX; x <= endX && x < t.clipX+t.clipW; x += t.w {
+			draw(x, y)
 		}
+	}
+}
 
-	case css.BackgroundRepeatRepeatY:
-		startY := pos.Y
-		for startY > 0 {
-			startY -= imgH
+// backgroundSize resolves background-size to a tile size for an image with
+// the given intrinsic size within a positioning area. An intrinsic size of
+// 0 (gradients) means the image has no intrinsic dimensions or ratio.
+func backgroundSize(size css.BackgroundSize, areaW, areaH, imgW, imgH float64) (w, h float64) {
+	hasRatio := imgW > 0 && imgH > 0
+	if size.Cover || size.Contain {
+		if !hasRatio {
+			return areaW, areaH
 		}
-		tileEndY := bgY + bgHeight - originY
-		for y := startY; y < tileEndY; y += imgH {
-			drawClipped(int(originX+pos.X), int(originY+y))
+		scale := math.Max(areaW/imgW, areaH/imgH)
+		if size.Contain {
+			scale = math.Min(areaW/imgW, areaH/imgH)
 		}
+		return imgW * scale, imgH * scale
+	}
 
-	default: // repeat
-		startX := pos.X
-		for startX > 0 {
-			startX -= imgW
+	// Resolve percentage values (stored as negative)
+	w, h = size.Width, size.Height
+	if w < 0 {
+		w = areaW * (-w) / 100
+	}
+	if h < 0 {
+		h = areaH * (-h) / 100
+	}
+	switch {
+	case w > 0 && h > 0:
+		return w, h
+	case w > 0: // height auto
+		if hasRatio {
+			return w, w * imgH / imgW
 		}
-		startY := pos.Y
-		for startY > 0 {
-			startY -= imgH
-		}
-		tileEndX := bgX + bgWidth - originX
-		tileEndY := bgY + bgHeight - originY
-		for y := startY; y < tileEndY; y += imgH {
-			for x := startX; x < tileEndX; x += imgW {
-				drawClipped(int(originX+x), int(originY+y))
-			}
+		return w, areaH
+	case h > 0: // width auto
+		if hasRatio {
+			return h * imgW / imgH, h
 		}
+		return areaW, h
+	case hasRatio:
+		return imgW, imgH
 	}
-
-	r.context.Pop()
+	return areaW, areaH
 }
 
+// SavePNG saves the rendered image. It fails for renderers that do not
+// paint onto a raster backend.
 func (r *Renderer) SavePNG(filename string) error {
-	return r.context.SavePNG(filename)
+	dc, ok := r.backend.(*gg.Context)
+	if !ok {
+		return fmt.Errorf("render: SavePNG needs a raster backend")
+	}
+	return dc.SavePNG(filename)
 }
 
 func (r *Renderer) applyTransforms(box *layout.Box, transforms []css.Transform) {
@@ -1248,39 +1277,34 @@ func (r *Renderer) applyTransforms(box *layout.Box, transforms []css.Transform)
 	r.context.Translate(-originX, -originY)
 }
 
-func (r *Renderer) drawScrollbarIndicators(box *layout.Box) {
-	scrollbarWidth := 12.0
-	scrollbarColor := css.Color{R: 200, G: 200, B: 200, A: 1.0}
-
-	effectiveY := r.getEffectiveY(box)
+// drawScrollbar draws the vertical scrollbar of a scroll container at the
+// right of its padding box: a track, always shown for overflow: scroll and
+// for overflow: auto when the content overflows, and a thumb sized and
+// placed by the part of the content scrolled into view.
+func (r *Renderer) drawScrollbar(box *layout.Box) {
+	if !layout.IsScrollContainer(box) {
+		return
+	}
+	maxScroll := box.MaxScrollTop()
+	if maxScroll == 0 && box.Style.GetOverflow() != css.OverflowScroll {
+		return
+	}
 
-	contentX := box.X + box.Padding.Left
-	contentY := effectiveY + box.Padding.Top
-	contentWidth := box.Width
-	contentHeight := box.Height
-
-	r.context.SetRGBA(
-		float64(scrollbarColor.R)/255.0,
-		float64(scrollbarColor.G)/255.0,
-		float64(scrollbarColor.B)/255.0,
-		scrollbarColor.A,
-	)
-
-	// Vertical scrollbar
-	r.context.DrawRectangle(
-		contentX+contentWidth-scrollbarWidth,
-		contentY,
-		scrollbarWidth,
-		contentHeight,
-	)
+	trackX := box.X + box.Width - box.Border.Right - layout.ScrollbarWidth
+	trackY := r.getEffectiveY(box) + box.Border.Top
+	trackHeight := box.Height - box.Border.Top - box.Border.Bottom
+	if trackHeight <= 0 {
+		return
+	}
+	r.context.SetRGB(200.0/255, 200.0/255, 200.0/255)
+	r.context.DrawRectangle(trackX, trackY, layout.ScrollbarWidth, trackHeight)
 	r.context.Fill()
 
-	// Horizontal scrollbar
-	r.context.DrawRectangle(
-		contentX,
-		contentY+contentHeight-scrollbarWidth,
-		contentWidth-scrollbarWidth,
-		scrollbarWidth,
-	)
+	if maxScroll == 0 {
+		return
+	}
+	scale := trackHeight / box.ScrollHeight
+	r.context.SetRGB(140.0/255, 140.0/255, 140.0/255)
+	r.context.DrawRectangle(trackX+2, trackY+box.ScrollTop*scale, layout.ScrollbarWidth-4, trackHeight*scale)
 	r.context.Fill()
 }
@@ -0,0 +1,282 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/fogleman/gg"
+
+	"louis14/pkg/css"
+	"louis14/pkg/layout"
+)
+
+// drawBoxShadow paints the outer box-shadows of a box beneath its
+// background. Shadows are painted last-declared first, so the first shadow
+// ends up on top (CSS Backgrounds 3 §7.1). Each shadow is clipped out of the
+// border box, so it never shows through a translucent background.
+func (r *Renderer) drawBoxShadow(box *layout.Box) {
+	shadows := box.Style.GetBoxShadow()
+	if len(shadows) == 0 {
+		return
+	}
+	x, y, w, h := r.paintedBorderBox(box)
+	if w <= 0 || h <= 0 {
+		return
+	}
+	radii := box.Style.GetBorderRadii(w, h)
+
+	for i := len(shadows) - 1; i >= 0; i-- {
+		shadow := shadows[i]
+		if shadow.Inset || shadow.Color.A == 0 {
+			continue
+		}
+		sx := x + shadow.OffsetX - shadow.Spread
+		sy := y + shadow.OffsetY - shadow.Spread
+		sw := w + 2*shadow.Spread
+		sh := h + 2*shadow.Spread
+		if sw <= 0 || sh <= 0 {
+			continue
+		}
+		margin := math.Ceil(3 * shadow.Blur / 2)
+		region := r.shadowRegion(math.Min(sx, x), math.Min(sy, y), math.Max(sx+sw, x+w), math.Max(sy+sh, y+h), margin)
+		if region.Empty() {
+			continue
+		}
+
+		alpha := shapeMask(region, func(dc *gg.Context) {
+			pathShape(dc, sx, sy, sw, sh, growRadii(radii, shadow.Spread))
+		})
+		blurAlpha(alpha, region.Dx(), region.Dy(), shadow.Blur/2)
+		borderBox := shapeMask(region, func(dc *gg.Context) {
+			pathShape(dc, x, y, w, h, radii)
+		})
+		for j := range alpha {
+			alpha[j] *= 1 - borderBox[j]
+		}
+		r.drawShadowMask(alpha, region, shadow.Color)
+	}
+}
+
+// drawInsetBoxShadow paints the inset box-shadows of a box above its
+// background and below its border, clipped to the padding box.
+func (r *Renderer) drawInsetBoxShadow(box *layout.Box) {
+	shadows := box.Style.GetBoxShadow()
+	if len(shadows) == 0 {
+		return
+	}
+	x, y, w, h := r.paintedBorderBox(box)
+	px := x + box.Border.Left
+	py := y + box.Border.Top
+	pw := w - box.Border.Left - box.Border.Right
+	ph := h - box.Border.Top - box.Border.Bottom
+	if pw <= 0 || ph <= 0 {
+		return
+	}
+	paddingRadii := box.Style.GetBorderRadii(w, h).Inset(box.Border.Top, box.Border.Right, box.Border.Bottom, box.Border.Left)
+
+	for i := len(shadows) - 1; i >= 0; i-- {
+		shadow := shadows[i]
+		if !shadow.Inset || shadow.Color.A == 0 {
+			continue
+		}
+		margin := math.Ceil(3 * shadow.Blur / 2)
+		region := r.shadowRegion(px, py, px+pw, py+ph, margin)
+		if region.Empty() {
+			continue
+		}
+
+		// The shadow is everything outside the offset, spread-shrunk hole
+		hole := shapeMask(region, func(dc *gg.Context) {
+			hw := pw - 2*shadow.Spread
+			hh := ph - 2*shadow.Spread
+			if hw > 0 && hh > 0 {
+				pathShape(dc, px+shadow.OffsetX+shadow.Spread, py+shadow.OffsetY+shadow.Spread, hw, hh,
+					growRadii(paddingRadii, -shadow.Spread))
+			}
+		})
+		for j := range hole {
+			hole[j] = 1 - hole[j]
+		}
+		blurAlpha(hole, region.Dx(), region.Dy(), shadow.Blur/2)
+		padding := shapeMask(region, func(dc *gg.Context) {
+			pathShape(dc, px, py, pw, ph, paddingRadii)
+		})
+		for j := range hole {
+			hole[j] *= padding[j]
+		}
+		r.drawShadowMask(hole, region, shadow.Color)
+	}
+}
+
+// maxShadowOverscan bounds, in pixels, how far past the visible canvas a
+// shadow mask extends so that blur near the canvas edges still picks up the
+// shape beyond them. Without it a huge blur radius would allocate masks far
+// larger than the canvas.
+const maxShadowOverscan = 256
+
+// shadowRegion returns the pixel region a shadow mask covers: the bounds x0,
+// y0, x1, y1 grown by the blur margin, limited to the visible canvas plus
+// up to margin (at most maxShadowOverscan) around it. A shadow spread or
+// blurred far past the canvas then costs no more than one that fills it.
+func (r *Renderer) shadowRegion(x0, y0, x1, y1, margin float64) image.Rectangle {
+	visible := r.context.visibleBounds()
+	if visible.Empty() {
+		return image.Rectangle{}
+	}
+	overscan := math.Min(margin, maxShadowOverscan)
+	x0 = math.Max(math.Floor(x0-margin), float64(visible.Min.X)-overscan)
+	y0 = math.Max(math.Floor(y0-margin), float64(visible.Min.Y)-overscan)
+	x1 = math.Min(math.Ceil(x1+margin), float64(visible.Max.X)+overscan)
+	y1 = math.Min(math.Ceil(y1+margin), float64(visible.Max.Y)+overscan)
+	if !(x0 < x1 && y0 < y1) {
+		return image.Rectangle{}
+	}
+	return image.Rect(int(x0), int(y0), int(x1), int(y1))
+}
+
+// drawShadowMask composites a shadow color through an alpha mask covering
+// region onto the canvas. Only the part of region on the visible canvas is
+// drawn.
+func (r *Renderer) drawShadowMask(alpha []float64, region image.Rectangle, c css.Color) {
+	dst := region.Intersect(r.context.visibleBounds())
+	if dst.Empty() {
+		return
+	}
+	img := image.NewRGBA(image.Rect(0, 0, dst.Dx(), dst.Dy()))
+	for y := dst.Min.Y; y < dst.Max.Y; y++ {
+		row := (y - region.Min.Y) * region.Dx()
+		for x := dst.Min.X; x < dst.Max.X; x++ {
+			a := alpha[row+x-region.Min.X] * c.A
+			if a <= 0 {
+				continue
+			}
+			o := img.PixOffset(x-dst.Min.X, y-dst.Min.Y)
+			img.Pix[o+0] = uint8(float64(c.R)*a + 0.5)
+			img.Pix[o+1] = uint8(float64(c.G)*a + 0.5)
+			img.Pix[o+2] = uint8(float64(c.B)*a + 0.5)
+			img.Pix[o+3] = uint8(255*a + 0.5)
+		}
+	}
+	r.context.DrawImage(img, dst.Min.X, dst.Min.Y)
+}
+
+// pathShape adds a rectangle, rounded if radii are non-zero, to dc's path.
+func pathShape(dc *gg.Context, x, y, w, h float64, radii css.BorderRadii) {
+	if radii.IsZero() {
+		dc.DrawRectangle(x, y, w, h)
+	} else {
+		roundedRectPath(dc, x, y, w, h, radii)
+	}
+}
+
+// shapeMask rasterizes the path added by draw (in canvas coordinates) into
+// an anti-aliased coverage mask over region, one value in [0, 1] per pixel.
+func shapeMask(region image.Rectangle, draw func(dc *gg.Context)) []float64 {
+	dc := gg.NewContext(region.Dx(), region.Dy())
+	dc.Translate(-float64(region.Min.X), -float64(region.Min.Y))
+	draw(dc)
+	dc.SetColor(color.White)
+	dc.Fill()
+	pix := dc.Image().(*image.RGBA).Pix
+	mask := make([]float64, region.Dx()*region.Dy())
+	for i := range mask {
+		mask[i] = float64(pix[i*4+3]) / 255
+	}
+	return mask
+}
+
+// growRadii grows non-zero corner radii by spread (or shrinks them when
+// spread is negative), as for box-shadow spread (CSS Backgrounds 3 §7.1.1).
+func growRadii(radii css.BorderRadii, spread float64) css.BorderRadii {
+	grow := func(c css.CornerRadius) css.CornerRadius {
+		if c.IsZero() {
+			return c
+		}
+		return css.CornerRadius{X: math.Max(0, c.X+spread), Y: math.Max(0, c.Y+spread)}
+	}
+	return css.BorderRadii{
+		TopLeft:     grow(radii.TopLeft),
+		TopRight:    grow(radii.TopRight),
+		BottomRight: grow(radii.BottomRight),
+		BottomLeft:  grow(radii.BottomLeft),
+	}
+}
+
+// blurAlpha applies an approximate gaussian blur with standard deviation
+// sigma to a w×h mask, using three successive box blurs.
+func blurAlpha(mask []float64, w, h int, sigma float64) {
+	if sigma <= 0 {
+		return
+	}
+	tmp := make([]float64, len(mask))
+	for _, size := range boxSizesForGauss(sigma, 3) {
+		radius := (size - 1) / 2
+		boxBlurH(mask, tmp, w, h, radius)
+		boxBlurV(tmp, mask, w, h, radius)
+	}
+}
+
+// boxSizesForGauss returns n box widths whose successive application
+// approximates a gaussian of standard deviation sigma.
+func boxSizesForGauss(sigma float64, n int) []int {
+	ideal := math.Sqrt(12*sigma*sigma/float64(n) + 1)
+	wl := int(math.Floor(ideal))
+	if wl%2 == 0 {
+		wl--
+	}
+	wu := wl + 2
+	mIdeal := (12*sigma*sigma - float64(n*wl*wl) - float64(4*n*wl) - float64(3*n)) / float64(-4*wl-4)
+	m := int(math.Round(mIdeal))
+	sizes := make([]int, n)
+	for i := range sizes {
+		if i < m {
+			sizes[i] = wl
+		} else {
+			sizes[i] = wu
+		}
+	}
+	return sizes
+}
+
+// boxBlurH blurs each row of src into dst with a running sum. Pixels beyond
+// the edges count as transparent.
+func boxBlurH(src, dst []float64, w, h, radius int) {
+	scale := 1 / float64(2*radius+1)
+	for y := 0; y < h; y++ {
+		row := y * w
+		sum := 0.0
+		for x := 0; x <= radius && x < w; x++ {
+			sum += src[row+x]
+		}
+		for x := 0; x < w; x++ {
+			dst[row+x] = sum * scale
+			if add := x + radius + 1; add < w {
+				sum += src[row+add]
+			}
+			if sub := x - radius; sub >= 0 {
+				sum -= src[row+sub]
+			}
+		}
+	}
+}
+
+// boxBlurV blurs each column of src into dst, like boxBlurH.
+func boxBlurV(src, dst []float64, w, h, radius int) {
+	scale := 1 / float64(2*radius+1)
+	for x := 0; x < w; x++ {
+		sum := 0.0
+		for y := 0; y <= radius && y < h; y++ {
+			sum += src[y*w+x]
+		}
+		for y := 0; y < h; y++ {
+			dst[y*w+x] = sum * scale
+			if add := y + radius + 1; add < h {
+				sum += src[add*w+x]
+			}
+			if sub := y - radius; sub >= 0 {
+				sum -= src[sub*w+x]
+			}
+		}
+	}
+}
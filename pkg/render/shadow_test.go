@@ -0,0 +1,46 @@
+package render
+
+import "testing"
+
+func TestShadow_HugeSpreadCoversCanvas(t *testing.T) {
+	// The spread reaches far past the canvas; only the visible part of the
+	// shadow is rasterized.
+	im := renderHTML(t, `<div style="margin:20px;width:20px;height:20px;background:#fff;
+		box-shadow:0 0 0 9999px rgba(0,0,0,.5)"></div>`)
+	checkPixels(t, im, []pixel{
+		{0, 0, 128, 128, 128},
+		{99, 79, 128, 128, 128},
+		{30, 30, 255, 255, 255}, // The box itself
+	})
+}
+
+func TestShadow_HugeBlur(t *testing.T) {
+	// A blur this wide spreads the shadow so thin it barely shows.
+	im := renderHTML(t, `<div style="margin:20px;width:20px;height:20px;
+		box-shadow:0 0 99999px 0 #000"></div>`)
+	checkPixels(t, im, []pixel{
+		{0, 0, 255, 255, 255},
+		{30, 30, 255, 255, 255},
+	})
+}
+
+func TestShadow_HugeInsetSpread(t *testing.T) {
+	im := renderHTML(t, `<div style="margin:20px;width:40px;height:40px;
+		box-shadow:inset 0 0 0 9999px #00f"></div>`)
+	checkPixels(t, im, []pixel{
+		{10, 10, 255, 255, 255},
+		{40, 40, 0, 0, 255},
+	})
+}
+
+func TestShadow_TransformedBoxKeepsVisibleShadow(t *testing.T) {
+	// The box sits off the canvas until its transform moves it on; the
+	// shadow is clamped to the canvas in the box's own coordinates.
+	im := renderHTML(t, `<div style="margin-left:300px;width:20px;height:20px;background:#fff;
+		transform:translate(-280px, 20px);box-shadow:0 0 0 9999px #0f0"></div>`)
+	checkPixels(t, im, []pixel{
+		{5, 5, 0, 255, 0},
+		{95, 75, 0, 255, 0},
+		{30, 30, 255, 255, 255},
+	})
+}
@@ -0,0 +1,288 @@
+package render
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fogleman/gg"
+)
+
+// SVGBackend is a Backend that records drawing as an SVG document, one
+// element per fill, stroke, string, and image. It gives scalable output,
+// and a text form of a render that reads and diffs well. Fonts the
+// renderer loads are embedded as @font-face data URIs, and images and
+// gradient fills as PNG data URIs. Layers are groups with an opacity.
+type SVGBackend struct {
+	vectorCanvas
+	body   bytes.Buffer
+	clips  bytes.Buffer // clipPath definitions
+	nextID int
+
+	groups     int   // Open <g> elements, one per clip
+	groupStack []int // groups at each Push
+	layers     []svgLayer
+	images     map[image.Image]string
+}
+
+// svgLayer is an open layer and the state to restore when it ends.
+type svgLayer struct {
+	start      int // Offset in body of the layer's elements
+	groups     int
+	groupStack []int
+	state      vectorState
+	stack      []vectorState
+}
+
+// NewSVGBackend creates an SVG document of width x height CSS pixels.
+func NewSVGBackend(width, height int) *SVGBackend {
+	b := &SVGBackend{
+		vectorCanvas: newVectorCanvas(width, height),
+		images:       make(map[image.Image]string),
+	}
+	b.reset()
+	return b
+}
+
+// Clear fills the canvas with the current color. An opaque clear outside
+// any clip hides everything drawn so far, which is dropped.
+func (b *SVGBackend) Clear() {
+	if b.groups == 0 && len(b.layers) == 0 && b.state.color.A == 255 {
+		b.body.Reset()
+	}
+	fmt.Fprintf(&b.body, "<rect width=\"%d\" height=\"%d\"%s/>\n", b.width, b.height, b.paint("fill"))
+}
+
+func (b *SVGBackend) Push() {
+	b.push()
+	b.groupStack = append(b.groupStack, b.groups)
+}
+
+// Pop restores the state saved by Push, closing the clip groups opened
+// since.
+func (b *SVGBackend) Pop() {
+	if !b.pop() {
+		return
+	}
+	b.closeGroups(b.groupStack[len(b.groupStack)-1])
+	b.groupStack = b.groupStack[:len(b.groupStack)-1]
+}
+
+func (b *SVGBackend) closeGroups(n int) {
+	for ; b.groups > n; b.groups-- {
+		b.body.WriteString("</g>\n")
+	}
+}
+
+// BeginLayer starts a group that EndLayer composites. It starts from the
+// initial graphics state.
+func (b *SVGBackend) BeginLayer() {
+	b.layers = append(b.layers, svgLayer{
+		start:      b.body.Len(),
+		groups:     b.groups,
+		groupStack: b.groupStack,
+		state:      b.state,
+		stack:      b.stack,
+	})
+	b.groupStack = nil
+	b.reset()
+}
+
+// EndLayer ends the innermost layer, wrapping its elements in a group with
+// the given opacity.
+func (b *SVGBackend) EndLayer(opacity float64) {
+	if len(b.layers) == 0 {
+		return
+	}
+	l := b.layers[len(b.layers)-1]
+	b.layers = b.layers[:len(b.layers)-1]
+	b.closeGroups(l.groups)
+	b.groupStack, b.state, b.stack = l.groupStack, l.state, l.stack
+
+	switch {
+	case opacity <= 0:
+		b.body.Truncate(l.start)
+	case opacity < 1:
+		elements := append([]byte(nil), b.body.Bytes()[l.start:]...)
+		b.body.Truncate(l.start)
+		fmt.Fprintf(&b.body, "<g opacity=\"%s\">\n", vectorNum(opacity))
+		b.body.Write(elements)
+		b.body.WriteString("</g>\n")
+	}
+}
+
+// Painting
+
+func (b *SVGBackend) Fill() {
+	if b.state.fill != nil {
+		if img, at, ok := b.rasterizeFill(); ok {
+			b.drawImage(img, gg.Translate(float64(at.X), float64(at.Y)))
+		}
+	} else if len(b.path) > 0 {
+		fmt.Fprintf(&b.body, "<path d=\"%s\"%s%s/>\n", b.pathData(), b.paint("fill"), b.fillRule("fill-rule"))
+	}
+	b.clearPath()
+}
+
+func (b *SVGBackend) Stroke() {
+	if len(b.path) > 0 {
+		fmt.Fprintf(&b.body, "<path d=\"%s\" fill=\"none\"%s stroke-width=\"%s\" stroke-linecap=\"round\" stroke-linejoin=\"round\"/>\n",
+			b.pathData(), b.paint("stroke"), vectorNum(b.state.lineWidth))
+	}
+	b.clearPath()
+}
+
+// Clip intersects the clip with the current path until the next Pop.
+func (b *SVGBackend) Clip() {
+	b.nextID++
+	fmt.Fprintf(&b.clips, "<clipPath id=\"c%d\"><path d=\"%s\"%s/></clipPath>\n", b.nextID, b.pathData(), b.fillRule("clip-rule"))
+	fmt.Fprintf(&b.body, "<g clip-path=\"url(#c%d)\">\n", b.nextID)
+	b.groups++
+	b.clearPath()
+}
+
+// pathData returns the current path as SVG path data.
+func (b *SVGBackend) pathData() string {
+	var d strings.Builder
+	for i, seg := range b.path {
+		if i > 0 {
+			d.WriteByte(' ')
+		}
+		p := seg.pts
+		switch seg.op {
+		case 'm':
+			fmt.Fprintf(&d, "M%s %s", vectorNum(p[0].X), vectorNum(p[0].Y))
+		case 'l':
+			fmt.Fprintf(&d, "L%s %s", vectorNum(p[0].X), vectorNum(p[0].Y))
+		case 'c':
+			fmt.Fprintf(&d, "C%s %s %s %s %s %s", vectorNum(p[0].X), vectorNum(p[0].Y),
+				vectorNum(p[1].X), vectorNum(p[1].Y), vectorNum(p[2].X), vectorNum(p[2].Y))
+		case 'h':
+			d.WriteByte('Z')
+		}
+	}
+	return d.String()
+}
+
+// paint returns the attributes painting with the current color, as the
+// fill or stroke.
+func (b *SVGBackend) paint(property string) string {
+	c := b.state.color
+	attrs := fmt.Sprintf(" %s=\"#%02x%02x%02x\"", property, c.R, c.G, c.B)
+	if c.A != 255 {
+		attrs += fmt.Sprintf(" %s-opacity=\"%s\"", property, vectorNum(float64(c.A)/255))
+	}
+	return attrs
+}
+
+func (b *SVGBackend) fillRule(attr string) string {
+	if b.state.evenOdd {
+		return " " + attr + "=\"evenodd\""
+	}
+	return ""
+}
+
+// Text
+
+// DrawString draws s with its baseline starting at (x, y).
+func (b *SVGBackend) DrawString(s string, x, y float64) {
+	f := b.state.font
+	if f == nil || s == "" {
+		return
+	}
+	family := "Helvetica, Arial, sans-serif"
+	if f.ttf != nil {
+		family = f.name
+		for _, r := range s {
+			idx := f.ttf.Index(r)
+			if _, ok := f.used[idx]; !ok {
+				f.used[idx] = r
+			}
+		}
+	}
+	fmt.Fprintf(&b.body, "<text transform=\"%s\" font-family=\"%s\" font-size=\"%s\"%s xml:space=\"preserve\">",
+		svgMatrix(b.state.matrix.Translate(x, y)), family, vectorNum(b.state.fontSize), b.paint("fill"))
+	xml.EscapeText(&b.body, []byte(s))
+	b.body.WriteString("</text>\n")
+}
+
+// Images
+
+// DrawImage draws im with its top left corner at (x, y).
+func (b *SVGBackend) DrawImage(im image.Image, x, y int) {
+	b.drawImage(im, b.state.matrix.Translate(float64(x), float64(y)))
+}
+
+// drawImage draws im with its top left corner at the origin of m.
+func (b *SVGBackend) drawImage(im image.Image, m gg.Matrix) {
+	size := im.Bounds().Size()
+	if size.X <= 0 || size.Y <= 0 {
+		return
+	}
+	uri, ok := b.images[im]
+	if !ok {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, im); err != nil {
+			return
+		}
+		uri = "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+		b.images[im] = uri
+	}
+	fmt.Fprintf(&b.body, "<image transform=\"%s\" width=\"%d\" height=\"%d\" href=\"%s\"/>\n",
+		svgMatrix(m), size.X, size.Y, uri)
+}
+
+// Output
+
+// Save writes the document to a file.
+func (b *SVGBackend) Save(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if _, err := b.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteTo writes the document.
+func (b *SVGBackend) WriteTo(w io.Writer) (int64, error) {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n",
+		b.width, b.height, b.width, b.height)
+	out.WriteString("<defs>\n")
+	var faces strings.Builder
+	for _, f := range b.fontList {
+		if f.ttf != nil && len(f.used) > 0 {
+			fmt.Fprintf(&faces, "@font-face { font-family: %s; src: url(data:font/ttf;base64,%s); }\n",
+				f.name, base64.StdEncoding.EncodeToString(f.data))
+		}
+	}
+	if faces.Len() > 0 {
+		fmt.Fprintf(&out, "<style>\n%s</style>\n", faces.String())
+	}
+	out.Write(b.clips.Bytes())
+	out.WriteString("</defs>\n")
+	out.Write(b.body.Bytes())
+	for i := 0; i < b.groups; i++ {
+		out.WriteString("</g>\n")
+	}
+	out.WriteString("</svg>\n")
+	n, err := w.Write(out.Bytes())
+	return int64(n), err
+}
+
+func svgMatrix(m gg.Matrix) string {
+	if m.XX == 1 && m.YX == 0 && m.XY == 0 && m.YY == 1 {
+		return fmt.Sprintf("translate(%s %s)", vectorNum(m.X0), vectorNum(m.Y0))
+	}
+	return fmt.Sprintf("matrix(%s %s %s %s %s %s)", vectorNum(m.XX), vectorNum(m.YX), vectorNum(m.XY), vectorNum(m.YY), vectorNum(m.X0), vectorNum(m.Y0))
+}
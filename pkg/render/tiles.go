@@ -0,0 +1,87 @@
+package render
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"sync"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
+)
+
+// tilesPerWorker is how many tiles each goroutine paints on average, so
+// that workers finishing light tiles early pick up more.
+const tilesPerWorker = 2
+
+// minTileHeight keeps tiles tall enough that replaying the display list
+// for each isn't most of the work.
+const minTileHeight = 64
+
+// tileMargin is how many rows above a tile are painted with it, then
+// dropped. The rasterizer truncates negative coordinates toward zero, so
+// edges in the row above a surface smear into its first row.
+const tileMargin = 2
+
+// rasterizeTiles paints list onto im in horizontal tiles, with up to
+// workers goroutines replaying the list, each onto its own tiles. The list
+// is shared read-only; each tile has its own graphics state and copies of
+// the font faces, which aren't safe for concurrent use. Painting stops
+// with the context's error once ctx is done.
+func rasterizeTiles(ctx context.Context, list *DisplayList, im *image.RGBA, workers int) error {
+	bounds := im.Bounds()
+	height := bounds.Dy()
+	tileHeight := max((height+workers*tilesPerWorker-1)/(workers*tilesPerWorker), minTileHeight)
+
+	tiles := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for y := range tiles {
+				rasterizeTile(ctx, list, im, y, min(y+tileHeight, height))
+			}
+		}()
+	}
+	for y := 0; y < height && ctx.Err() == nil; y += tileHeight {
+		tiles <- y
+	}
+	close(tiles)
+	wg.Wait()
+	return ctx.Err()
+}
+
+// rasterizeTile paints the rows y0 to y1 of im. It paints onto its own
+// surface, which starts tileMargin rows higher, and copies the rows back.
+func rasterizeTile(ctx context.Context, list *DisplayList, im *image.RGBA, y0, y1 int) {
+	bounds := im.Bounds()
+	top := max(y0-tileMargin, 0)
+	tile := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), y1-top))
+
+	p := player{
+		target: gg.NewContextForRGBA(tile),
+		origin: image.Pt(0, top),
+		faces:  make(map[font.Face]font.Face),
+	}
+	p.toTile(p.target)
+	if p.replay(ctx, list) != nil {
+		return
+	}
+
+	rowBytes := 4 * bounds.Dx()
+	for y := y0; y < y1; y++ {
+		copy(im.Pix[im.PixOffset(bounds.Min.X, bounds.Min.Y+y):][:rowBytes], tile.Pix[tile.PixOffset(0, y-top):][:rowBytes])
+	}
+}
+
+// offsetPattern samples a pattern in canvas coordinates for a tile at
+// origin.
+type offsetPattern struct {
+	pattern gg.Pattern
+	origin  image.Point
+}
+
+func (p offsetPattern) ColorAt(x, y int) color.Color {
+	return p.pattern.ColorAt(x+p.origin.X, y+p.origin.Y)
+}
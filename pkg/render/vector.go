@@ -0,0 +1,333 @@
+package render
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+
+	"louis14/pkg/text"
+)
+
+// vectorCanvas is the state shared by the vector backends (PDF and SVG):
+// the transform, paint, and font that Push and Pop save, and the current
+// path, recorded in device coordinates. The backends embed it and write
+// each fill, stroke, clip, string, and image in their own format.
+type vectorCanvas struct {
+	width, height int
+	state         vectorState
+	stack         []vectorState
+
+	path       []vectorSegment
+	hasCurrent bool
+	start      gg.Point // Start of the current subpath
+	current    gg.Point
+
+	fonts    map[string]*vectorFont // By font file path or face
+	fontList []*vectorFont
+}
+
+// vectorState is the graphics state that Push and Pop save.
+type vectorState struct {
+	matrix    gg.Matrix
+	color     color.NRGBA
+	fill      gg.Pattern // Non-solid fill style, or nil
+	lineWidth float64
+	evenOdd   bool
+	face      font.Face
+	font      *vectorFont
+	fontSize  float64
+}
+
+// vectorSegment is a path operator: 'm', 'l', 'c' (with three points), or
+// 'h' to close the subpath.
+type vectorSegment struct {
+	op  byte
+	pts [3]gg.Point
+}
+
+// vectorFont is a font used in the document. A nil ttf is the backend's
+// fallback sans-serif font, for faces whose font file is unknown.
+type vectorFont struct {
+	name string // Resource name
+	ttf  *truetype.Font
+	data []byte
+	used map[truetype.Index]rune // Glyphs drawn, and the runes they show
+}
+
+func newVectorCanvas(width, height int) vectorCanvas {
+	return vectorCanvas{width: width, height: height, fonts: make(map[string]*vectorFont)}
+}
+
+// reset restores the initial graphics state, as for a new page.
+func (c *vectorCanvas) reset() {
+	c.state = vectorState{matrix: gg.Identity(), color: color.NRGBA{A: 255}, lineWidth: 1}
+	c.stack = nil
+	c.clearPath()
+	// gg's default face, for text drawn before a font is set
+	c.SetFontFace(basicfont.Face7x13)
+}
+
+func (c *vectorCanvas) push() {
+	c.stack = append(c.stack, c.state)
+}
+
+// pop restores the state saved by push, reporting false if none was.
+func (c *vectorCanvas) pop() bool {
+	if len(c.stack) == 0 {
+		return false
+	}
+	c.state = c.stack[len(c.stack)-1]
+	c.stack = c.stack[:len(c.stack)-1]
+	return true
+}
+
+func (c *vectorCanvas) Width() int  { return c.width }
+func (c *vectorCanvas) Height() int { return c.height }
+
+// Transform and paint
+
+func (c *vectorCanvas) Identity() {
+	c.state.matrix = gg.Identity()
+}
+
+func (c *vectorCanvas) Translate(x, y float64) {
+	c.state.matrix = gg.Translate(x, y).Multiply(c.state.matrix)
+}
+
+func (c *vectorCanvas) Scale(x, y float64) {
+	c.state.matrix = gg.Scale(x, y).Multiply(c.state.matrix)
+}
+
+func (c *vectorCanvas) Rotate(angle float64) {
+	c.state.matrix = gg.Rotate(angle).Multiply(c.state.matrix)
+}
+
+func (c *vectorCanvas) SetRGB(r, g, b float64) {
+	c.SetRGBA(r, g, b, 1)
+}
+
+func (c *vectorCanvas) SetRGBA(r, g, b, a float64) {
+	c.state.color = color.NRGBA{unitByte(r), unitByte(g), unitByte(b), unitByte(a)}
+	c.state.fill = nil
+}
+
+func (c *vectorCanvas) SetFillStyle(pattern gg.Pattern) {
+	c.state.fill = pattern
+}
+
+func (c *vectorCanvas) SetLineWidth(lineWidth float64) {
+	c.state.lineWidth = lineWidth
+}
+
+func (c *vectorCanvas) SetFillRuleWinding() { c.state.evenOdd = false }
+func (c *vectorCanvas) SetFillRuleEvenOdd() { c.state.evenOdd = true }
+
+// Paths
+
+func (c *vectorCanvas) MoveTo(x, y float64) {
+	p := c.devicePoint(x, y)
+	c.path = append(c.path, vectorSegment{op: 'm', pts: [3]gg.Point{p}})
+	c.start, c.current, c.hasCurrent = p, p, true
+}
+
+func (c *vectorCanvas) LineTo(x, y float64) {
+	if !c.hasCurrent {
+		c.MoveTo(x, y)
+		return
+	}
+	p := c.devicePoint(x, y)
+	c.path = append(c.path, vectorSegment{op: 'l', pts: [3]gg.Point{p}})
+	c.current = p
+}
+
+func (c *vectorCanvas) ClosePath() {
+	if c.hasCurrent {
+		c.path = append(c.path, vectorSegment{op: 'h'})
+		c.current = c.start
+	}
+}
+
+func (c *vectorCanvas) NewSubPath() {
+	c.hasCurrent = false
+}
+
+func (c *vectorCanvas) DrawRectangle(x, y, w, h float64) {
+	c.NewSubPath()
+	c.MoveTo(x, y)
+	c.LineTo(x+w, y)
+	c.LineTo(x+w, y+h)
+	c.LineTo(x, y+h)
+	c.ClosePath()
+}
+
+func (c *vectorCanvas) DrawLine(x1, y1, x2, y2 float64) {
+	c.MoveTo(x1, y1)
+	c.LineTo(x2, y2)
+}
+
+func (c *vectorCanvas) DrawCircle(x, y, r float64) {
+	c.NewSubPath()
+	c.DrawEllipticalArc(x, y, r, r, 0, 2*math.Pi)
+	c.ClosePath()
+}
+
+// DrawEllipticalArc adds an arc as cubic curves of at most a quarter turn
+// each, joined to the current point by a line as in gg.
+func (c *vectorCanvas) DrawEllipticalArc(x, y, rx, ry, angle1, angle2 float64) {
+	n := max(int(math.Ceil(math.Abs(angle2-angle1)/(math.Pi/2))), 1)
+	step := (angle2 - angle1) / float64(n)
+	k := 4.0 / 3 * math.Tan(step/4)
+	at := func(a float64) (float64, float64) { return x + rx*math.Cos(a), y + ry*math.Sin(a) }
+
+	x0, y0 := at(angle1)
+	if c.hasCurrent {
+		c.LineTo(x0, y0)
+	} else {
+		c.MoveTo(x0, y0)
+	}
+	for i := 0; i < n; i++ {
+		a1 := angle1 + step*float64(i)
+		a2 := a1 + step
+		x1, y1 := at(a1)
+		x2, y2 := at(a2)
+		c1 := c.devicePoint(x1-k*rx*math.Sin(a1), y1+k*ry*math.Cos(a1))
+		c2 := c.devicePoint(x2+k*rx*math.Sin(a2), y2-k*ry*math.Cos(a2))
+		p := c.devicePoint(x2, y2)
+		c.path = append(c.path, vectorSegment{op: 'c', pts: [3]gg.Point{c1, c2, p}})
+		c.current = p
+	}
+}
+
+func (c *vectorCanvas) clearPath() {
+	c.path = c.path[:0]
+	c.hasCurrent = false
+}
+
+func (c *vectorCanvas) devicePoint(x, y float64) gg.Point {
+	x, y = c.state.matrix.TransformPoint(x, y)
+	return gg.Point{X: x, Y: y}
+}
+
+// rasterizeFill fills the current path with the non-solid fill style, such
+// as a gradient, which the vector formats can't express, returning the
+// image of the path's device bounds and where it goes.
+func (c *vectorCanvas) rasterizeFill() (image.Image, image.Point, bool) {
+	bounds := image.Rectangle{}
+	for _, seg := range c.path {
+		n := map[byte]int{'m': 1, 'l': 1, 'c': 3}[seg.op]
+		for _, p := range seg.pts[:n] {
+			pt := image.Rect(int(math.Floor(p.X)), int(math.Floor(p.Y)), int(math.Ceil(p.X))+1, int(math.Ceil(p.Y))+1)
+			bounds = bounds.Union(pt)
+		}
+	}
+	bounds = bounds.Intersect(image.Rect(0, 0, c.width, c.height))
+	if bounds.Empty() {
+		return nil, image.Point{}, false
+	}
+	dc := gg.NewContext(c.width, c.height)
+	for _, seg := range c.path {
+		p := seg.pts
+		switch seg.op {
+		case 'm':
+			dc.MoveTo(p[0].X, p[0].Y)
+		case 'l':
+			dc.LineTo(p[0].X, p[0].Y)
+		case 'c':
+			dc.CubicTo(p[0].X, p[0].Y, p[1].X, p[1].Y, p[2].X, p[2].Y)
+		case 'h':
+			dc.ClosePath()
+		}
+	}
+	if c.state.evenOdd {
+		dc.SetFillRuleEvenOdd()
+	}
+	dc.SetFillStyle(c.state.fill)
+	dc.Fill()
+	return dc.Image().(*image.RGBA).SubImage(bounds), bounds.Min, true
+}
+
+// Fonts
+
+// SetFontFace sets the font for DrawString. Faces from text.WebFontFace
+// embed their font; others are drawn in the backend's fallback font.
+func (c *vectorCanvas) SetFontFace(fontFace font.Face) {
+	c.state.face = fontFace
+	if data, size, ok := text.FaceSource(fontFace); ok {
+		if f, err := c.font(fmt.Sprintf("face:%p", data), func() ([]byte, error) { return data, nil }); err == nil {
+			c.state.font, c.state.fontSize = f, size
+			return
+		}
+	}
+	f, ok := c.fonts["fallback"]
+	if !ok {
+		f = &vectorFont{name: fmt.Sprintf("F%d", len(c.fontList)+1)}
+		c.fonts["fallback"] = f
+		c.fontList = append(c.fontList, f)
+	}
+	c.state.font = f
+	// Sized so its ascent matches, for Helvetica's 0.718 em
+	c.state.fontSize = float64(fontFace.Metrics().Ascent) / 64 / 0.718
+}
+
+// LoadFontFace loads a TrueType font file for DrawString at the given size.
+func (c *vectorCanvas) LoadFontFace(path string, points float64) error {
+	f, err := c.font("file:"+path, func() ([]byte, error) { return os.ReadFile(path) })
+	if err != nil {
+		return err
+	}
+	c.state.font, c.state.fontSize = f, points
+	c.state.face = truetype.NewFace(f.ttf, &truetype.Options{Size: points})
+	return nil
+}
+
+// font returns the document font for key, loading it on first use.
+func (c *vectorCanvas) font(key string, load func() ([]byte, error)) (*vectorFont, error) {
+	if f, ok := c.fonts[key]; ok {
+		return f, nil
+	}
+	data, err := load()
+	if err != nil {
+		return nil, err
+	}
+	ttf, err := truetype.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	f := &vectorFont{name: fmt.Sprintf("F%d", len(c.fontList)+1), ttf: ttf, data: data, used: make(map[truetype.Index]rune)}
+	c.fonts[key] = f
+	c.fontList = append(c.fontList, f)
+	return f, nil
+}
+
+func (c *vectorCanvas) FontAscent() float64 {
+	if c.state.face == nil {
+		return 0
+	}
+	return float64(c.state.face.Metrics().Ascent) / 64
+}
+
+// vectorNum formats a number compactly, without exponent notation, which
+// PDF lacks.
+func vectorNum(v float64) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "0"
+	}
+	s := fmt.Sprintf("%.4f", v)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+func unitByte(v float64) uint8 {
+	return uint8(math.Round(min(max(v, 0), 1) * 255))
+}
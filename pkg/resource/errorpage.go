@@ -0,0 +1,63 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+
+	stdnet "louis14/std/net"
+)
+
+// errorPageStyle is the style sheet of the documents ErrorPage generates.
+const errorPageStyle = `
+body { margin: 0; padding: 48px; background-color: #f4f4f6; color: #202124; font-family: sans-serif; font-size: 15px; }
+.box { padding: 24px 32px; background-color: #ffffff; border: 1px solid #dadce0; border-left: 6px solid #d93025; }
+h1 { margin: 0 0 16px 0; font-size: 24px; color: #202124; }
+p { margin: 8px 0; line-height: 22px; }
+.label { color: #5f6368; }
+.url { font-family: monospace; color: #1a0dab; }
+.status { font-weight: bold; color: #d93025; }
+.error { margin-top: 16px; padding: 12px; background-color: #f8f9fa; border: 1px solid #e8eaed; font-family: monospace; font-size: 13px; color: #3c4043; }
+`
+
+// ErrorPage returns an HTML document describing why the page at url could
+// not be loaded, for rendering in place of it: the URL, the HTTP status if
+// the server answered with an error, and err.
+func ErrorPage(url string, err error) string {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\">")
+	fmt.Fprintf(&b, "<title>%s</title>", html.EscapeString(errorTitle(err)))
+	fmt.Fprintf(&b, "<style>%s</style></head>\n<body><div class=\"box\">\n", errorPageStyle)
+	fmt.Fprintf(&b, "<h1>%s</h1>\n", html.EscapeString(errorTitle(err)))
+	if url != "" {
+		fmt.Fprintf(&b, "<p><span class=\"label\">URL:</span> <span class=\"url\">%s</span></p>\n", html.EscapeString(url))
+	}
+	var status *stdnet.StatusError
+	if errors.As(err, &status) {
+		fmt.Fprintf(&b, "<p><span class=\"label\">Status:</span> <span class=\"status\">%d %s</span></p>\n",
+			status.StatusCode, html.EscapeString(http.StatusText(status.StatusCode)))
+	}
+	if err != nil {
+		fmt.Fprintf(&b, "<div class=\"error\">%s</div>\n", html.EscapeString(err.Error()))
+	}
+	b.WriteString("</div></body></html>\n")
+	return b.String()
+}
+
+// errorTitle returns the heading of the error page for err.
+func errorTitle(err error) string {
+	var status *stdnet.StatusError
+	switch {
+	case errors.As(err, &status) && status.StatusCode == http.StatusNotFound:
+		return "Page not found"
+	case errors.As(err, &status):
+		return "The server returned an error"
+	case errors.Is(err, ErrBlocked):
+		return "Blocked by the loading policy"
+	case errors.Is(err, stdnet.ErrTooLarge):
+		return "The page is too large"
+	}
+	return "This page could not be loaded"
+}
@@ -1,15 +1,17 @@
 package resource
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
 	stdnet "louis14/std/net"
 )
 
-// Fetcher retrieves resources by URI.
+// Fetcher retrieves resources by URI. A fetch stops with the context's
+// error when ctx is canceled.
 type Fetcher interface {
-	Fetch(uri string) (body []byte, contentType string, err error)
+	Fetch(ctx context.Context, uri string) (body []byte, contentType string, err error)
 }
 
 // DefaultFetcher fetches resources over HTTP/HTTPS, resolving relative URIs
@@ -25,8 +27,12 @@ func NewFetcher(baseURL string) *DefaultFetcher {
 }
 
 // Fetch retrieves the resource at the given URI.
-// Relative URIs are resolved against the fetcher's base URL.
-func (f *DefaultFetcher) Fetch(uri string) ([]byte, string, error) {
+// Relative URIs are resolved against the fetcher's base URL, and data:
+// URIs are decoded in place.
+func (f *DefaultFetcher) Fetch(ctx context.Context, uri string) ([]byte, string, error) {
+	if stdnet.IsDataURL(uri) {
+		return stdnet.DecodeDataURL(uri)
+	}
 	resolved := uri
 	if !stdnet.IsNetworkURL(uri) && f.baseURL != "" {
 		resolved = stdnet.ResolveURL(f.baseURL, uri)
@@ -34,16 +40,22 @@ func (f *DefaultFetcher) Fetch(uri string) ([]byte, string, error) {
 	if !stdnet.IsNetworkURL(resolved) {
 		return nil, "", fmt.Errorf("cannot fetch non-network URI: %s", resolved)
 	}
-	return stdnet.Fetch(resolved)
+	return stdnet.FetchContext(ctx, resolved)
 }
 
 // FetchCSS fetches a stylesheet URI and returns its text content.
 // Returns an error if the content type does not look like CSS or text.
-func (f *DefaultFetcher) FetchCSS(uri string) (string, error) {
-	body, contentType, err := f.Fetch(uri)
+func (f *DefaultFetcher) FetchCSS(ctx context.Context, uri string) (string, error) {
+	body, contentType, err := f.Fetch(ctx, uri)
 	if err != nil {
 		return "", err
 	}
+	return cssContent(body, contentType)
+}
+
+// cssContent returns the text of a fetched stylesheet, or an error if its
+// content type does not look like CSS or text.
+func cssContent(body []byte, contentType string) (string, error) {
 	// Accept text/css, text/plain, or any text/* content type
 	ct := strings.ToLower(contentType)
 	if ct != "" && !strings.HasPrefix(ct, "text/") && !strings.Contains(ct, "css") {
@@ -53,8 +65,8 @@ func (f *DefaultFetcher) FetchCSS(uri string) (string, error) {
 }
 
 // FetchImage fetches an image URI and returns its raw bytes.
-func (f *DefaultFetcher) FetchImage(uri string) ([]byte, error) {
-	body, _, err := f.Fetch(uri)
+func (f *DefaultFetcher) FetchImage(ctx context.Context, uri string) ([]byte, error) {
+	body, _, err := f.Fetch(ctx, uri)
 	if err != nil {
 		return nil, err
 	}
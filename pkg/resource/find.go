@@ -0,0 +1,105 @@
+package resource
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"louis14/pkg/css"
+	"louis14/pkg/layout"
+)
+
+// Colors of find-in-page highlights, drawn over the text they mark.
+var (
+	matchHighlight       = color.NRGBA{R: 0xff, G: 0xee, B: 0x00, A: 0x80}
+	activeMatchHighlight = color.NRGBA{R: 0xff, G: 0x96, B: 0x00, A: 0xa0}
+)
+
+// Find searches the page's text for query, ignoring case, and highlights
+// the matches. The first match becomes the active one. It returns the
+// number of matches; an empty query clears the search.
+func (p *Page) Find(query string) int {
+	p.findQuery = query
+	p.activeMatch = 0
+	p.refreshMatches()
+	return len(p.matches)
+}
+
+// FindStep makes the match delta matches after the active one (before it,
+// if negative) active, wrapping around the ends of the page. It returns
+// false if there are no matches.
+func (p *Page) FindStep(delta int) bool {
+	n := len(p.matches)
+	if n == 0 {
+		return false
+	}
+	p.activeMatch = ((p.activeMatch+delta)%n + n) % n
+	return true
+}
+
+// FindStatus returns the index of the active match and the number of
+// matches of the current search.
+func (p *Page) FindStatus() (active, count int) {
+	return p.activeMatch, len(p.matches)
+}
+
+// RevealMatch returns the scroll offset that brings the active match into
+// view from (scrollX, scrollY): unchanged if it is already in view, else
+// with the match centered in the viewport. The offset is clamped to the
+// scrollable range.
+func (p *Page) RevealMatch(scrollX, scrollY float64) (float64, float64) {
+	if len(p.matches) == 0 {
+		return scrollX, scrollY
+	}
+	m := p.matches[p.activeMatch]
+	if inFixedBox(m.Box) {
+		return scrollX, scrollY // Always in view
+	}
+	vw, vh := float64(p.viewportWidth), float64(p.viewportHeight)
+	if m.X < scrollX || m.X+m.Width > scrollX+vw {
+		scrollX = m.X + m.Width/2 - vw/2
+	}
+	if m.Y < scrollY || m.Y+m.Height > scrollY+vh {
+		scrollY = m.Y + m.Height/2 - vh/2
+	}
+	return p.ClampScroll(scrollX, scrollY)
+}
+
+// refreshMatches searches the current box tree again for the find query,
+// after the page was laid out. The active match keeps its index if it
+// still exists.
+func (p *Page) refreshMatches() {
+	p.matches = layout.FindText(p.boxes, p.findQuery)
+	if p.activeMatch >= len(p.matches) {
+		p.activeMatch = 0
+	}
+}
+
+// drawMatches highlights the find matches onto target, which shows the
+// page scrolled to (scrollX, scrollY).
+func (p *Page) drawMatches(target *image.RGBA, scrollX, scrollY float64) {
+	for i, m := range p.matches {
+		highlight := matchHighlight
+		if i == p.activeMatch {
+			highlight = activeMatchHighlight
+		}
+		x, y := scrollX, scrollY
+		if inFixedBox(m.Box) {
+			y = 0 // Fixed boxes are laid out in viewport coordinates
+		}
+		r := image.Rect(int(math.Floor(m.X-x)), int(math.Floor(m.Y-y)),
+			int(math.Ceil(m.X+m.Width-x)), int(math.Ceil(m.Y+m.Height-y)))
+		draw.Draw(target, r.Intersect(target.Bounds()), image.NewUniform(highlight), image.Point{}, draw.Over)
+	}
+}
+
+// inFixedBox reports whether box is, or is inside, a fixed-position box.
+func inFixedBox(box *layout.Box) bool {
+	for ; box != nil; box = box.Parent {
+		if box.Position == css.PositionFixed {
+			return true
+		}
+	}
+	return false
+}
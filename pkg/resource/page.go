@@ -0,0 +1,660 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"log"
+	"math"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"louis14/pkg/css"
+	"louis14/pkg/html"
+	"louis14/pkg/images"
+	"louis14/pkg/js"
+	"louis14/pkg/layout"
+	"louis14/pkg/render"
+	"louis14/pkg/text"
+	stdnet "louis14/std/net"
+)
+
+// maxOffscreenHeight caps the height of the full-page offscreen image.
+// Content below this point is not reachable by scrolling.
+const maxOffscreenHeight = 32768
+
+// Page is a parsed, scripted, and laid-out document that can be rendered
+// repeatedly at different scroll offsets without re-parsing.
+//
+// Pages without fixed or sticky boxes are rendered once into a tall
+// offscreen image and scrolled by copying a viewport-sized window out of it.
+// Pages with viewport-anchored boxes are re-laid out with the scroll offset
+// (incrementally) and rendered per scroll position so those boxes stay pinned.
+type Page struct {
+	ctx            context.Context // The page's lifetime (see Load)
+	doc            *html.Document
+	engine         *layout.LayoutEngine
+	boxes          []*layout.Box
+	fonts          text.FontConfig
+	imageFetcher   images.ImageFetcher
+	url            string // Document URL
+	baseURL        string // URL that relative URIs resolve against: the <base href>, or url
+	viewportWidth  int
+	viewportHeight int
+	contentWidth   int
+	contentHeight  int
+	anchored       bool                // Has fixed/sticky boxes that depend on scrollY
+	offscreen      *image.RGBA         // Full-page render at scroll 0 (non-anchored pages)
+	caret          int                 // Caret position, in characters, in the focused text field
+	caretVisible   bool                // Blink phase of the caret
+	script         *js.Engine          // Engine that ran the page's scripts; nil without JS
+	navigation     *js.Navigation      // Link followed by a click and not yet taken
+	findQuery      string              // Text searched for by Find; "" when not searching
+	matches        []layout.TextMatch  // Occurrences of findQuery, in document order
+	activeMatch    int                 // Index in matches of the match shown as current
+	textBoxes      []*layout.Box       // Boxes that draw text, which selections index
+	selectAnchor   layout.TextPosition // Where the text selection started
+	selectFocus    layout.TextPosition // Where it ends; equal to selectAnchor when empty
+	selecting      bool                // The pointer is pressed and extends the selection
+}
+
+// Load parses htmlContent, runs scripts if a JS engine is configured, and
+// lays the document out for a viewport of the given size. The stylesheets,
+// fonts, and images the document references are fetched concurrently. A
+// document that redirects at once with <meta http-equiv="refresh"> is
+// replaced by the one it leads to; the page's URL says which was loaded.
+//
+// ctx covers the page's lifetime: the fetches of its subresources,
+// including images that load after Load returns, and its scripts. Load
+// returns the context's error if ctx is canceled before the page is
+// loaded.
+func (r *Louis14Renderer) Load(ctx context.Context, htmlContent string, viewportWidth, viewportHeight int) (*Page, error) {
+	r.location = ""
+	if prefetch := r.startPrefetch(ctx); prefetch != nil {
+		prefetch.scanHTML(htmlContent)
+	}
+	doc, err := html.ParseWithOptions(htmlContent, html.ParseOptions{CSSFetcher: r.cssFetcher(ctx), Scripting: r.jsEngine != nil})
+	if err != nil {
+		return nil, fmt.Errorf("parsing HTML: %w", err)
+	}
+	if doc, err = r.followRefresh(ctx, doc); err != nil {
+		return nil, err
+	}
+	return r.loadDocument(ctx, doc, viewportWidth, viewportHeight)
+}
+
+// previewInterval is the least time between the previews LoadStream
+// shows of a document while it arrives.
+const previewInterval = 100 * time.Millisecond
+
+// LoadStream is Load for a document read from body as it arrives. Its
+// stylesheets are fetched as their links are parsed. If preview is not
+// nil, it is called with pages of the document parsed so far, laid out
+// without running scripts, so the top of the page can be shown, and its
+// images start loading, before the rest arrives; the first as soon as any
+// of the document is parsed, then at most every previewInterval. The page
+// returned is the whole document loaded as Load loads it.
+func (r *Louis14Renderer) LoadStream(ctx context.Context, body io.Reader, viewportWidth, viewportHeight int, preview func(*Page)) (*Page, error) {
+	r.location = ""
+	if prefetch := r.startPrefetch(ctx); prefetch != nil {
+		body = &scanningReader{r: body, p: prefetch}
+	}
+	var last time.Time
+	doc, err := html.ParseReader(body, html.ParseOptions{CSSFetcher: r.cssFetcher(ctx), Scripting: r.jsEngine != nil}, func(s *html.StreamParser) {
+		if preview == nil || time.Since(last) < previewInterval || ctx.Err() != nil {
+			return
+		}
+		preview(r.newPage(ctx, s.Snapshot(), viewportWidth, viewportHeight))
+		last = time.Now()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("parsing HTML: %w", err)
+	}
+	if doc, err = r.followRefresh(ctx, doc); err != nil {
+		return nil, err
+	}
+	return r.loadDocument(ctx, doc, viewportWidth, viewportHeight)
+}
+
+// loadDocument makes a page of doc, running its scripts if a JS engine is
+// configured, or returns the context's error if ctx is canceled first.
+func (r *Louis14Renderer) loadDocument(ctx context.Context, doc *html.Document, viewportWidth, viewportHeight int) (*Page, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p := r.newPage(ctx, doc, viewportWidth, viewportHeight)
+
+	// Run scripts even if the page has none, so inline on<type> handler
+	// attributes respond to events.
+	if r.jsEngine != nil {
+		p.script = r.jsEngine
+		p.script.SetContext(ctx)
+		if r.location != "" {
+			p.script.SetBaseURL(r.location)
+		}
+		if err := p.script.Execute(doc); err != nil {
+			log.Printf("js: %v", err)
+		}
+		p.layout()
+		if err := p.script.DispatchLoad(); err != nil {
+			log.Printf("js: %v", err)
+		}
+		p.layout()
+		p.measure()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// newPage lays doc out for a viewport of the given size, without running
+// its scripts. Its subresources are fetched with ctx.
+func (r *Louis14Renderer) newPage(ctx context.Context, doc *html.Document, viewportWidth, viewportHeight int) *Page {
+	p := &Page{
+		ctx:            ctx,
+		doc:            doc,
+		fonts:          r.fonts,
+		imageFetcher:   r.imageFetcher(),
+		url:            r.documentURL(),
+		baseURL:        r.baseURL(doc),
+		viewportWidth:  viewportWidth,
+		viewportHeight: viewportHeight,
+	}
+	p.engine = layout.NewLayoutEngine(float64(viewportWidth), float64(viewportHeight))
+	if p.imageFetcher != nil {
+		p.engine.SetImageFetcher(p.imageFetcher)
+	}
+	p.engine.SetBaseURL(p.baseURL)
+	p.engine.SetFontFetcher(r.fontFetcher())
+	p.engine.SetColorScheme(r.colorScheme)
+	p.engine.SetIncremental(true)
+	p.layout()
+	p.measure()
+	// The page's canvases are drawn until the page ends
+	context.AfterFunc(ctx, p.engine.ReleaseCanvases)
+	return p
+}
+
+// Document returns the page's DOM.
+func (p *Page) Document() *html.Document {
+	return p.doc
+}
+
+// ContentSize returns the scrollable size of the page in pixels. It is
+// never smaller than the viewport.
+func (p *Page) ContentSize() (width, height int) {
+	return p.contentWidth, p.contentHeight
+}
+
+// ViewportSize returns the viewport size the page was laid out for.
+func (p *Page) ViewportSize() (width, height int) {
+	return p.viewportWidth, p.viewportHeight
+}
+
+// ClampScroll limits a scroll offset to the scrollable range.
+func (p *Page) ClampScroll(scrollX, scrollY float64) (float64, float64) {
+	maxX := float64(p.contentWidth - p.viewportWidth)
+	maxY := float64(p.contentHeight - p.viewportHeight)
+	return math.Max(0, math.Min(scrollX, maxX)), math.Max(0, math.Min(scrollY, maxY))
+}
+
+// ScrollBoxAt scrolls the content of the innermost scroll container under
+// the document point (x, y) that can still move by dy, clamped to its
+// scrollable range, and re-lays out the page. It returns false, leaving the
+// page to be scrolled instead, if no container under the point can move.
+func (p *Page) ScrollBoxAt(x, y, dy float64) bool {
+	for _, box := range layout.ScrollContainersAt(p.boxes, x, y) {
+		offset := math.Max(0, math.Min(box.ScrollTop+dy, box.MaxScrollTop()))
+		if offset != box.ScrollTop {
+			p.engine.SetScrollOffset(box.Node, offset)
+			p.relayout()
+			return true
+		}
+	}
+	return false
+}
+
+// RenderAt draws the viewport window at the given scroll offset onto target.
+// The offset is clamped to the scrollable range.
+func (p *Page) RenderAt(target *image.RGBA, scrollX, scrollY float64) {
+	scrollX, scrollY = p.ClampScroll(scrollX, scrollY)
+
+	var src *image.RGBA
+	var srcOrigin image.Point
+	if p.anchored {
+		// Re-layout so fixed and sticky boxes track the scroll offset, then
+		// render a viewport-tall strip spanning the full content width.
+		p.engine.SetScrollY(scrollY)
+		p.layout()
+		p.textBoxes = layout.TextBoxes(p.boxes)
+		p.refreshMatches()
+		src = image.NewRGBA(image.Rect(0, 0, p.contentWidth, p.viewportHeight))
+		renderer := p.newRenderer(src)
+		renderer.SetViewportOffset(scrollY)
+		renderer.Render(p.ctx, p.boxes)
+		srcOrigin = image.Pt(int(scrollX), 0)
+	} else {
+		if p.offscreen == nil {
+			p.offscreen = image.NewRGBA(image.Rect(0, 0, p.contentWidth, p.contentHeight))
+			p.newRenderer(p.offscreen).Render(p.ctx, p.boxes)
+		}
+		src = p.offscreen
+		srcOrigin = image.Pt(int(scrollX), int(scrollY))
+	}
+
+	draw.Draw(target, target.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(target, target.Bounds(), src, srcOrigin, draw.Src)
+	p.drawMatches(target, scrollX, scrollY)
+	p.drawSelection(target, scrollX, scrollY)
+	p.drawCaret(target, scrollX, scrollY)
+}
+
+// RunTasks is the page's frame tick. It advances the page's script clock
+// and its CSS transitions by d, running the timers that come due and then
+// the requestAnimationFrame callbacks, and re-lays out the page if they
+// changed the document or transitions are running. It returns true if the
+// page needs to be redrawn.
+func (p *Page) RunTasks(d time.Duration) bool {
+	animating := p.engine.Advance(d)
+	if p.script != nil && !p.script.Idle() {
+		if err := p.script.RunTasks(d); err != nil {
+			log.Printf("js: %v", err)
+		}
+		if err := p.script.RunFrame(); err != nil {
+			log.Printf("js: %v", err)
+		}
+	}
+	if !animating && p.doc.Root.IsSubtreeClean() {
+		return false
+	}
+	p.relayout()
+	return true
+}
+
+// HoverAt moves the pointer to the document point (x, y), restyling the
+// page for :hover. It returns true if the hovered element changed and the
+// page needs to be redrawn.
+func (p *Page) HoverAt(x, y float64) bool {
+	node := layout.NodeAt(p.boxes, x, y)
+	if node == p.engine.HoveredNode() {
+		return false
+	}
+	p.engine.SetHoveredNode(node)
+	p.relayout()
+	return true
+}
+
+// PressAt presses the pointer at the document point (x, y): the element
+// under it becomes :active and its nearest focusable ancestor, if any,
+// takes focus. Unless that is a text field, the press also starts a text
+// selection, which DragTo extends. It returns true if the page needs to
+// be redrawn.
+func (p *Page) PressAt(x, y float64) bool {
+	node := layout.NodeAt(p.boxes, x, y)
+	focus := node
+	for focus != nil && !isFocusable(focus) {
+		focus = focus.Parent
+	}
+	p.engine.SetActiveNode(node)
+	if focus != p.engine.FocusedNode() {
+		p.engine.SetFocusedNode(focus)
+		if focus != nil && focus.IsTextField() {
+			p.caret = utf8.RuneCountInString(focus.Value())
+			p.caretVisible = true
+		}
+	}
+	p.relayout()
+	if focus != nil && focus.IsTextField() {
+		p.selectAnchor, p.selectFocus, p.selecting = layout.TextPosition{}, layout.TextPosition{}, false
+	} else {
+		p.startSelection(x, y)
+	}
+	return true
+}
+
+// Release releases the pointer at the document point (x, y), ending
+// :active. If the pointer was pressed and released over the same element,
+// or elements with a common ancestor, a click event is dispatched at the
+// innermost such element. It returns true if the page needs to be redrawn.
+func (p *Page) Release(x, y float64) bool {
+	p.selecting = false
+	pressed := p.engine.ActiveNode()
+	p.engine.SetActiveNode(nil)
+	if target := commonAncestor(pressed, layout.NodeAt(p.boxes, x, y)); target != nil {
+		follow := true
+		if p.script != nil {
+			ok, err := p.script.Click(target)
+			if err != nil {
+				log.Printf("js: %v", err)
+			}
+			follow = ok
+		}
+		if follow {
+			p.followLink(target)
+		}
+	}
+	p.relayout()
+	return true
+}
+
+// followLink requests a navigation to the href of the link containing
+// node, if any.
+func (p *Page) followLink(node *html.Node) {
+	for n := node; n != nil; n = n.Parent {
+		if n.TagName != "a" && n.TagName != "area" {
+			continue
+		}
+		if href, ok := n.GetAttribute("href"); ok {
+			p.navigation = &js.Navigation{URL: stdnet.ResolveURL(p.baseURL, strings.TrimSpace(href))}
+			return
+		}
+	}
+}
+
+// TakeNavigation returns the navigation requested since the last call, by
+// a click on a link or by the page's scripts, if any. The embedder carries
+// it out: a URL that differs from the page's only in its fragment is
+// shown with NavigateToFragment, other URLs are loaded as new pages.
+func (p *Page) TakeNavigation() (js.Navigation, bool) {
+	if nav := p.navigation; nav != nil {
+		p.navigation = nil
+		return *nav, true
+	}
+	if p.script != nil {
+		return p.script.TakeNavigation()
+	}
+	return js.Navigation{}, false
+}
+
+// URL returns the page's URL, which is where a refresh led when the page
+// loaded redirected with <meta http-equiv="refresh">.
+func (p *Page) URL() string {
+	return p.url
+}
+
+// NavigateToFragment moves the page to url, which differs from its URL
+// only in the fragment, without reloading it. It returns the document
+// offset to scroll to, which puts the top of the fragment's target at the
+// top of the viewport, or false if the fragment has no target.
+func (p *Page) NavigateToFragment(url string) (float64, bool) {
+	p.url = url
+	if p.doc.BaseURL == "" {
+		p.baseURL = url
+	}
+	if p.script != nil {
+		p.script.SetBaseURL(url)
+	}
+	fragment := ""
+	if i := strings.IndexByte(url, '#'); i >= 0 {
+		fragment = url[i+1:]
+	}
+	return p.FragmentOffset(fragment)
+}
+
+// FragmentOffset returns the document offset of the top of the target of
+// a URL fragment: the element with that id, else the <a> with that name.
+// An empty fragment or "top" targets the top of the page. It returns false
+// if there is no target or it has no box.
+func (p *Page) FragmentOffset(fragment string) (float64, bool) {
+	if decoded, err := neturl.PathUnescape(fragment); err == nil {
+		fragment = decoded
+	}
+	target := fragmentTarget(p.doc.Root, fragment)
+	if target == nil {
+		if fragment == "" || strings.EqualFold(fragment, "top") {
+			return 0, true
+		}
+		return 0, false
+	}
+	// Elements without a box of their own, like an empty inline anchor,
+	// are found by their first descendant that has one
+	var box *layout.Box
+	var find func(n *html.Node)
+	find = func(n *html.Node) {
+		if box = layout.BoxForNode(p.boxes, n); box != nil {
+			return
+		}
+		for _, child := range n.Children {
+			find(child)
+			if box != nil {
+				return
+			}
+		}
+	}
+	find(target)
+	if box == nil {
+		return 0, false
+	}
+	return box.Y, true
+}
+
+// fragmentTarget returns the element a fragment names: the first with
+// that id, else the first <a> with that name.
+func fragmentTarget(root *html.Node, fragment string) *html.Node {
+	if fragment == "" {
+		return nil
+	}
+	var byName *html.Node
+	var walk func(n *html.Node) *html.Node
+	walk = func(n *html.Node) *html.Node {
+		if n.Type != html.ElementNode {
+			return nil
+		}
+		if id, ok := n.GetAttribute("id"); ok && id == fragment {
+			return n
+		}
+		if name, ok := n.GetAttribute("name"); ok && name == fragment && n.TagName == "a" && byName == nil {
+			byName = n
+		}
+		for _, child := range n.Children {
+			if found := walk(child); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	if found := walk(root); found != nil {
+		return found
+	}
+	return byName
+}
+
+// commonAncestor returns the innermost element containing both a and b,
+// or nil if either is nil or they share none below the document root.
+func commonAncestor(a, b *html.Node) *html.Node {
+	if a == nil || b == nil {
+		return nil
+	}
+	for n := a; n != nil; n = n.Parent {
+		if n.Contains(b) {
+			if n.Parent == nil {
+				return nil
+			}
+			return n
+		}
+	}
+	return nil
+}
+
+// Editing reports whether a text field the user can type into has focus.
+func (p *Page) Editing() bool {
+	focused := p.engine.FocusedNode()
+	return focused != nil && focused.IsEditable()
+}
+
+// InsertText types s into the focused text field at the caret. Line breaks
+// are dropped from single-line inputs, and text beyond an input's maxlength
+// is discarded. A textarea's text is always edited at its end. It returns
+// true if the field changed.
+func (p *Page) InsertText(s string) bool {
+	if !p.Editing() {
+		return false
+	}
+	node := p.engine.FocusedNode()
+	value := []rune(node.Value())
+	insert := []rune(s)
+	if node.TagName == "textarea" {
+		p.caret = len(value)
+	} else {
+		insert = []rune(strings.NewReplacer("\r", "", "\n", "").Replace(s))
+		if maxLen, err := strconv.Atoi(node.Attributes["maxlength"]); err == nil && maxLen >= 0 {
+			insert = insert[:max(0, min(len(insert), maxLen-len(value)))]
+		}
+	}
+	if len(insert) == 0 {
+		return false
+	}
+	p.caret = max(0, min(p.caret, len(value)))
+	value = append(value[:p.caret], append(insert, value[p.caret:]...)...)
+	p.caret += len(insert)
+	return p.setFieldValue(node, string(value))
+}
+
+// DeleteBackward deletes the character before the caret in the focused
+// text field. It returns true if the field changed.
+func (p *Page) DeleteBackward() bool {
+	if !p.Editing() {
+		return false
+	}
+	node := p.engine.FocusedNode()
+	value := []rune(node.Value())
+	if node.TagName == "textarea" {
+		p.caret = len(value)
+	}
+	if p.caret <= 0 || p.caret > len(value) {
+		return false
+	}
+	value = append(value[:p.caret-1], value[p.caret:]...)
+	p.caret--
+	return p.setFieldValue(node, string(value))
+}
+
+// DeleteForward deletes the character after the caret in the focused text
+// field. It returns true if the field changed.
+func (p *Page) DeleteForward() bool {
+	if !p.Editing() {
+		return false
+	}
+	node := p.engine.FocusedNode()
+	value := []rune(node.Value())
+	if node.TagName == "textarea" || p.caret < 0 || p.caret >= len(value) {
+		return false
+	}
+	value = append(value[:p.caret], value[p.caret+1:]...)
+	return p.setFieldValue(node, string(value))
+}
+
+// MoveCaret moves the caret of the focused text input by delta characters,
+// clamped to its value. It returns true if the caret moved.
+func (p *Page) MoveCaret(delta int) bool {
+	if !p.Editing() || p.engine.FocusedNode().TagName == "textarea" {
+		return false
+	}
+	n := utf8.RuneCountInString(p.engine.FocusedNode().Value())
+	caret := max(0, min(p.caret+delta, n))
+	if caret == p.caret {
+		return false
+	}
+	p.caret = caret
+	p.caretVisible = true
+	return true
+}
+
+// SetCaretVisible sets the blink phase of the caret. It returns true if a
+// caret is shown or hidden as a result and the page needs to be redrawn.
+func (p *Page) SetCaretVisible(visible bool) bool {
+	if visible == p.caretVisible {
+		return false
+	}
+	p.caretVisible = visible
+	return p.Editing()
+}
+
+// setFieldValue stores an edited text field value and re-lays out the page.
+func (p *Page) setFieldValue(node *html.Node, value string) bool {
+	node.SetValue(value)
+	p.caretVisible = true
+	p.relayout()
+	return true
+}
+
+// drawCaret draws the focused text field's caret onto target, which shows
+// the page scrolled to (scrollX, scrollY).
+func (p *Page) drawCaret(target *image.RGBA, scrollX, scrollY float64) {
+	if !p.caretVisible || !p.Editing() {
+		return
+	}
+	box := layout.BoxForNode(p.boxes, p.engine.FocusedNode())
+	if box == nil {
+		return
+	}
+	x, y, h := render.CaretRect(box, p.caret)
+	if box.Position == css.PositionFixed {
+		scrollY = 0 // Fixed boxes are laid out in viewport coordinates
+	}
+	x0, y0 := int(math.Round(x-scrollX)), int(math.Round(y-scrollY))
+	caret := image.Rect(x0, y0, x0+1, y0+int(math.Ceil(h)))
+	draw.Draw(target, caret.Intersect(target.Bounds()), image.NewUniform(color.Black), image.Point{}, draw.Src)
+}
+
+// isFocusable reports whether clicking an element focuses it: links,
+// form controls, and elements with a tabindex.
+func isFocusable(node *html.Node) bool {
+	if _, ok := node.GetAttribute("tabindex"); ok {
+		return true
+	}
+	switch node.TagName {
+	case "a", "area":
+		_, ok := node.GetAttribute("href")
+		return ok
+	case "input", "button", "select", "textarea":
+		_, disabled := node.GetAttribute("disabled")
+		return !disabled
+	}
+	return false
+}
+
+// relayout lays the page out again after its DOM or interaction state
+// changed, discarding the cached offscreen image.
+func (p *Page) relayout() {
+	p.layout()
+	p.offscreen = nil
+	p.textBoxes = layout.TextBoxes(p.boxes)
+	p.refreshMatches()
+	p.measure()
+}
+
+// layout lays the page out with its context. Once the page's context is
+// done, layout stops and the page keeps the boxes of its last layout, and
+// rendering stops early too.
+func (p *Page) layout() {
+	if boxes, err := p.engine.Layout(p.ctx, p.doc); err == nil {
+		p.boxes = boxes
+	}
+}
+
+// measure finds the scrollable size of the laid out page and whether it
+// has boxes anchored to the viewport.
+func (p *Page) measure() {
+	p.anchored = layout.HasViewportAnchoredBoxes(p.boxes)
+	w, h := layout.ContentBounds(p.boxes)
+	p.contentWidth = max(p.viewportWidth, int(math.Ceil(w)))
+	p.contentHeight = min(max(p.viewportHeight, int(math.Ceil(h))), maxOffscreenHeight)
+}
+
+func (p *Page) newRenderer(target *image.RGBA) *render.Renderer {
+	renderer := render.NewRendererForImage(target)
+	renderer.SetFonts(p.fonts)
+	if p.imageFetcher != nil {
+		renderer.SetImageFetcher(p.imageFetcher)
+	}
+	renderer.SetBaseURL(p.baseURL)
+	return renderer
+}
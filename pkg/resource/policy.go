@@ -0,0 +1,176 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	stdnet "louis14/std/net"
+)
+
+// ErrBlocked is returned for a resource a Policy does not allow.
+var ErrBlocked = errors.New("blocked by policy")
+
+// Policy restricts what a page may load, for rendering pages that are not
+// trusted, as a screenshot service does. The zero Policy allows anything
+// except servers on loopback, private, and link-local addresses, and
+// local files for a network page, which no Policy allows.
+type Policy struct {
+	// Schemes lists the URL schemes that may be fetched, such as "https"
+	// or "data". File paths have the scheme "file". Nil allows any.
+	Schemes []string
+
+	// Hosts lists the hosts network resources may come from. An entry
+	// "*.example.com" matches the subdomains of example.com. Nil allows
+	// any.
+	Hosts []string
+
+	MaxResourceSize int64 // Most bytes of one resource; 0 = no limit
+	MaxTotalBytes   int64 // Most bytes of all the resources fetched; 0 = no limit
+
+	DisableScripts bool // Scripts are not run
+
+	// AllowPrivateNetworks lets pages load from servers on loopback,
+	// private, and link-local addresses, such as the machine rendering
+	// them and the services beside it. The addresses are checked once
+	// host names are resolved, on every connection and redirect.
+	AllowPrivateNetworks bool
+}
+
+// allow returns an error wrapping ErrBlocked unless the policy allows
+// fetching target, a resolved URL or file path, for the page at pageURL.
+func (p *Policy) allow(pageURL, target string) error {
+	scheme := "file"
+	var host string
+	if stdnet.IsDataURL(target) {
+		scheme = "data"
+	} else if u, err := url.Parse(target); err == nil && len(u.Scheme) > 1 {
+		// A one-letter scheme is a Windows drive
+		scheme, host = strings.ToLower(u.Scheme), u.Hostname()
+	}
+	switch {
+	case scheme == "file" && stdnet.IsNetworkURL(pageURL):
+		return fmt.Errorf("%w: local file %s for a network page", ErrBlocked, target)
+	case p.Schemes != nil && !slices.Contains(p.Schemes, scheme):
+		return fmt.Errorf("%w: %s URL %s", ErrBlocked, scheme, target)
+	case host != "" && p.Hosts != nil && !p.allowHost(host):
+		return fmt.Errorf("%w: host %s", ErrBlocked, host)
+	case host != "" && !p.AllowPrivateNetworks && isLocalHost(host):
+		return fmt.Errorf("%w: host %s on a private network", ErrBlocked, host)
+	}
+	return nil
+}
+
+// isLocalHost reports whether host names this machine or is an address
+// on a private network, without resolving it.
+func isLocalHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	addr, err := netip.ParseAddr(host)
+	return err == nil && checkPublicAddr(addr.Unmap()) != nil
+}
+
+// checkPublicAddr returns an error wrapping ErrBlocked if addr is not a
+// public address: one for this machine, a private network, or a link,
+// where metadata services live.
+func checkPublicAddr(addr netip.Addr) error {
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() {
+		return fmt.Errorf("%w: address %s on a private network", ErrBlocked, addr)
+	}
+	return nil
+}
+
+// allowHost reports whether host is in the policy's Hosts.
+func (p *Policy) allowHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, h := range p.Hosts {
+		h = strings.ToLower(h)
+		if h == host || (strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyFetcher is a Fetcher that fetches only what a Policy allows of the
+// resources of a page, following redirects only to URLs it allows and
+// connecting only to addresses it allows, and stops fetching once the
+// page's resources reach the policy's size limits.
+type PolicyFetcher struct {
+	fetcher Fetcher
+	baseURL string
+	policy  Policy
+	total   atomic.Int64 // Bytes fetched so far
+}
+
+// NewPolicyFetcher returns a PolicyFetcher fetching with fetcher for the
+// page at baseURL, which relative URIs resolve against.
+func NewPolicyFetcher(fetcher Fetcher, baseURL string, policy Policy) *PolicyFetcher {
+	return &PolicyFetcher{fetcher: fetcher, baseURL: baseURL, policy: policy}
+}
+
+// Fetch retrieves the resource at uri with the PolicyFetcher's fetcher,
+// or returns an error wrapping ErrBlocked if the policy does not allow it.
+func (f *PolicyFetcher) Fetch(ctx context.Context, uri string) ([]byte, string, error) {
+	target := uri
+	if !stdnet.IsDataURL(uri) && !stdnet.IsNetworkURL(uri) && stdnet.IsNetworkURL(f.baseURL) {
+		target = stdnet.ResolveURL(f.baseURL, uri)
+	}
+	if err := f.policy.allow(f.baseURL, target); err != nil {
+		return nil, "", err
+	}
+	ctx = stdnet.WithURLCheck(ctx, func(u *url.URL) error {
+		return f.policy.allow(f.baseURL, u.String())
+	})
+	if !f.policy.AllowPrivateNetworks {
+		ctx = stdnet.WithAddrCheck(ctx, checkPublicAddr)
+	}
+
+	// The body may be no larger than either limit leaves room for
+	limit := f.policy.MaxResourceSize
+	if f.policy.MaxTotalBytes > 0 {
+		left := f.policy.MaxTotalBytes - f.total.Load()
+		if left <= 0 {
+			return nil, "", fmt.Errorf("%w: page over %d bytes", ErrBlocked, f.policy.MaxTotalBytes)
+		}
+		if limit == 0 || left < limit {
+			limit = left
+		}
+	}
+	if limit > 0 {
+		ctx = stdnet.WithBodyLimit(ctx, limit)
+	}
+
+	body, contentType, err := f.fetcher.Fetch(ctx, uri)
+	if err != nil {
+		return nil, "", err
+	}
+	// Fetchers that don't use the network may not keep to the limit
+	if limit > 0 && int64(len(body)) > limit {
+		return nil, "", fmt.Errorf("%w: %s over %d bytes", ErrBlocked, uri, limit)
+	}
+	if total := f.total.Add(int64(len(body))); f.policy.MaxTotalBytes > 0 && total > f.policy.MaxTotalBytes {
+		return nil, "", fmt.Errorf("%w: page over %d bytes", ErrBlocked, f.policy.MaxTotalBytes)
+	}
+	return body, contentType, nil
+}
+
+// unwrapFetcher returns the fetcher f fetches with if it is a
+// PolicyFetcher, or f.
+func unwrapFetcher(f Fetcher) Fetcher {
+	for {
+		pf, ok := f.(*PolicyFetcher)
+		if !ok {
+			return f
+		}
+		f = pf.fetcher
+	}
+}
@@ -0,0 +1,333 @@
+package resource
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"louis14/pkg/css"
+	"louis14/pkg/html"
+	stdnet "louis14/std/net"
+)
+
+// prefetchWorkers is how many subresources a page fetches at once, as
+// browsers open up to six connections to a host.
+const prefetchWorkers = 6
+
+// fetchPriority orders prefetches: stylesheets block layout, fonts block
+// text measurement, and images only their own boxes.
+type fetchPriority int
+
+const (
+	priorityStylesheet fetchPriority = iota
+	priorityFont
+	priorityImage
+)
+
+// prefetcher fetches the subresources of a document concurrently, before
+// the parser, layout, and paint ask for them one at a time. It finds them
+// in the document's markup (<link> stylesheets and preloads, <img>
+// sources, and url() references in style attributes and <style>) and in
+// the stylesheets it fetches (@import, @font-face sources, and other
+// url()s), and fetches them with a bounded pool of workers, higher
+// priorities first.
+//
+// A prefetched response is handed over by Fetch once; a later request
+// for the same URL goes to the network, as without prefetching. Fetches
+// stop when the context of the document's load is canceled.
+type prefetcher struct {
+	ctx     context.Context
+	fetcher Fetcher
+	baseURL string // Document URL that relative references resolve against
+	baseRef string // The document's <base href>, which references resolve against first
+
+	mu      sync.Mutex
+	fetches map[string]*prefetch // By resolved URL
+	queue   prefetchQueue        // Fetches waiting for a worker
+	workers int                  // Running workers
+	seq     int                  // Number of fetches queued, for FIFO order
+	stopped bool
+}
+
+// prefetch is one subresource fetch. Its response is set before done is
+// closed.
+type prefetch struct {
+	url      string
+	priority fetchPriority
+	seq      int
+	started  bool // A worker or Fetch took it
+	consumed bool // Fetch handed its response over
+	done     chan struct{}
+
+	body        []byte
+	contentType string
+	err         error
+}
+
+func newPrefetcher(ctx context.Context, fetcher Fetcher, baseURL string) *prefetcher {
+	return &prefetcher{ctx: ctx, fetcher: fetcher, baseURL: baseURL, fetches: make(map[string]*prefetch)}
+}
+
+// resolve returns the URL a reference is fetched as, or "" for a data: URL,
+// which has nothing to fetch.
+func (p *prefetcher) resolve(uri string) string {
+	uri = strings.TrimSpace(uri)
+	if uri == "" || stdnet.IsDataURL(uri) {
+		return ""
+	}
+	if p.baseURL != "" && !stdnet.IsNetworkURL(uri) {
+		return stdnet.ResolveURL(p.baseURL, uri)
+	}
+	return uri
+}
+
+// add queues a fetch of uri unless it was already found.
+func (p *prefetcher) add(uri string, priority fetchPriority) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	url := p.resolve(html.ResolveBase(p.baseRef, uri))
+	if url == "" {
+		return
+	}
+	if _, found := p.fetches[url]; found || p.stopped {
+		return
+	}
+	f := &prefetch{url: url, priority: priority, seq: p.seq, done: make(chan struct{})}
+	p.seq++
+	p.fetches[url] = f
+	heap.Push(&p.queue, f)
+	if p.workers < prefetchWorkers {
+		p.workers++
+		go p.work()
+	}
+}
+
+// work fetches queued subresources until the queue is empty.
+func (p *prefetcher) work() {
+	for {
+		p.mu.Lock()
+		var f *prefetch
+		for p.queue.Len() > 0 && f == nil {
+			if next := heap.Pop(&p.queue).(*prefetch); !next.started {
+				f = next
+			}
+		}
+		if f == nil {
+			p.workers--
+			p.mu.Unlock()
+			return
+		}
+		f.started = true
+		p.mu.Unlock()
+
+		p.run(f)
+	}
+}
+
+// run fetches f, then queues what it references if it is a stylesheet.
+func (p *prefetcher) run(f *prefetch) {
+	f.body, f.contentType, f.err = p.fetcher.Fetch(p.ctx, f.url)
+	close(f.done)
+	if f.priority == priorityStylesheet && f.err == nil {
+		p.scanCSS(string(f.body), f.url)
+	}
+}
+
+// Fetch returns the prefetched response for uri, waiting for it if it is
+// being fetched, or fetches it now if it was not found or was handed over
+// already. It implements Fetcher.
+func (p *prefetcher) Fetch(ctx context.Context, uri string) ([]byte, string, error) {
+	url := p.resolve(uri)
+	p.mu.Lock()
+	f, found := p.fetches[url]
+	if !found || f.consumed {
+		p.mu.Unlock()
+		return p.fetcher.Fetch(ctx, uri)
+	}
+	p.fetches[url] = &prefetch{consumed: true}
+	started := f.started
+	f.started = true
+	p.mu.Unlock()
+
+	if !started {
+		p.run(f) // Needed before a worker got to it
+	}
+	select {
+	case <-f.done:
+		return f.body, f.contentType, f.err
+	case <-ctx.Done():
+		return nil, "", ctx.Err()
+	}
+}
+
+// stop drops the fetches that have not started, when the document no
+// longer needs them.
+func (p *prefetcher) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopped = true
+	p.queue = nil
+}
+
+// scanHTML queues the subresources referenced by markup, which may be the
+// start of a document. It returns how much of markup it scanned: where a
+// tag or raw text element cut off at its end starts, and the text that
+// ends it, "" if nothing was cut off.
+func (p *prefetcher) scanHTML(markup string) (int, string) {
+	t := html.NewTokenizer(markup)
+	for {
+		start := t.Pos()
+		token, err := t.NextToken()
+		if err != nil || token.Type == html.TokenEOF {
+			if start == len(markup) {
+				return start, ""
+			}
+			return start, ">"
+		}
+		if token.Type != html.TokenStartTag {
+			continue
+		}
+		switch token.TagName {
+		case "style", "script":
+			content := t.ReadRawUntil(token.TagName)
+			if token.TagName == "style" {
+				p.scanCSS(content, "")
+			}
+			end := "</" + token.TagName + ">"
+			if t.Pos() == len(markup) && !hasSuffixFold(markup, end) {
+				return start, end // Its end tag is still to come
+			}
+		case "base":
+			p.mu.Lock()
+			if href := strings.TrimSpace(token.Attributes["href"]); p.baseRef == "" && href != "" {
+				p.baseRef = href
+			}
+			p.mu.Unlock()
+		case "link":
+			p.scanLink(token.Attributes)
+		case "img":
+			p.add(token.Attributes["src"], priorityImage)
+		}
+		if style, ok := token.Attributes["style"]; ok {
+			p.scanCSS(style, "")
+		}
+	}
+}
+
+// scanLink queues the stylesheet or preload of a <link>.
+func (p *prefetcher) scanLink(attrs map[string]string) {
+	rel := strings.Fields(strings.ToLower(attrs["rel"]))
+	switch {
+	case slices.Contains(rel, "stylesheet"):
+		p.add(attrs["href"], priorityStylesheet)
+	case slices.Contains(rel, "preload"):
+		switch strings.ToLower(attrs["as"]) {
+		case "style":
+			p.add(attrs["href"], priorityStylesheet)
+		case "font":
+			p.add(attrs["href"], priorityFont)
+		case "image":
+			p.add(attrs["href"], priorityImage)
+		}
+	}
+}
+
+var (
+	importPattern = regexp.MustCompile(`(?i)@import\s+(?:url\(\s*)?["']?([^"'()\s;]+)`)
+	urlPattern    = regexp.MustCompile(`(?i)url\(\s*["']?([^"'()]+?)["']?\s*\)`)
+)
+
+// scanCSS queues the subresources a stylesheet references: the sheets it
+// imports, relative to sheetURL, the first source layout would load of
+// each @font-face, and the other url()s as images.
+func (p *prefetcher) scanCSS(cssText, sheetURL string) {
+	if !strings.Contains(cssText, "url(") && !strings.Contains(cssText, "@import") {
+		return
+	}
+	skip := make(map[string]bool)
+	for _, m := range importPattern.FindAllStringSubmatch(cssText, -1) {
+		skip[m[1]] = true
+		uri := m[1]
+		if sheetURL != "" && !stdnet.IsNetworkURL(uri) {
+			uri = stdnet.ResolveURL(sheetURL, uri)
+		}
+		p.add(uri, priorityStylesheet)
+	}
+	if strings.Contains(cssText, "@font-face") {
+		if sheet, err := css.ParseStylesheet(cssText); err == nil {
+			for _, face := range sheet.FontFaces {
+				for _, src := range face.Sources {
+					skip[src.URL] = true
+				}
+				for _, src := range face.Sources {
+					// local() fonts and WOFF2 are not loaded
+					if src.URL != "" && src.Format != "woff2" && !strings.HasSuffix(strings.ToLower(src.URL), ".woff2") {
+						p.add(src.URL, priorityFont)
+						break
+					}
+				}
+			}
+		}
+	}
+	for _, m := range urlPattern.FindAllStringSubmatch(cssText, -1) {
+		if uri := strings.TrimSpace(m[1]); !skip[uri] {
+			p.add(uri, priorityImage)
+		}
+	}
+}
+
+// prefetchQueue is a heap of fetches, by priority and then in the order
+// they were found.
+type prefetchQueue []*prefetch
+
+func (q prefetchQueue) Len() int { return len(q) }
+func (q prefetchQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority < q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+func (q prefetchQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *prefetchQueue) Push(x any)   { *q = append(*q, x.(*prefetch)) }
+func (q *prefetchQueue) Pop() any {
+	old := *q
+	f := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return f
+}
+
+// hasSuffixFold reports whether s ends with suffix, ignoring case.
+func hasSuffixFold(s, suffix string) bool {
+	return len(s) >= len(suffix) && strings.EqualFold(s[len(s)-len(suffix):], suffix)
+}
+
+// scanningReader passes a document through while the prefetcher scans it
+// as it arrives. It keeps only what is not yet scanned, a tag or raw text
+// element cut off where the document has arrived to, and scans it again
+// once the text that ends it arrives, so a long script is searched for
+// its end tag once rather than scanned again with every read.
+type scanningReader struct {
+	r       io.Reader
+	p       *prefetcher
+	pending []byte // The document from where scanning stopped
+	end     string // Text that ends the cut-off start of pending, lowercase
+}
+
+func (s *scanningReader) Read(b []byte) (int, error) {
+	n, err := s.r.Read(b)
+	if n > 0 {
+		from := max(len(s.pending)-len(s.end)+1, 0) // Where the end could first be found
+		s.pending = append(s.pending, b[:n]...)
+		if s.end == "" || bytes.Contains(bytes.ToLower(s.pending[from:]), []byte(s.end)) {
+			scanned, end := s.p.scanHTML(string(s.pending))
+			s.pending = s.pending[:copy(s.pending, s.pending[scanned:])]
+			s.end = end
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,77 @@
+package resource
+
+import (
+	"context"
+	"io"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// countingFetcher counts the fetches of each URL.
+type countingFetcher struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (f *countingFetcher) Fetch(ctx context.Context, uri string) ([]byte, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.counts[uri]++
+	return nil, "image/png", nil
+}
+
+// chunkReader returns its data at most size bytes a Read.
+type chunkReader struct {
+	data string
+	size int
+}
+
+func (r *chunkReader) Read(b []byte) (int, error) {
+	if r.data == "" {
+		return 0, io.EOF
+	}
+	n := copy(b[:min(len(b), r.size)], r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestScanningReader_SplitReads(t *testing.T) {
+	doc := `<html><head><script>document.write("<img src=script.png>")</script>
+<!-- <img src=comment.png> --></head>
+<body><img src="a.png"><p style="background: url(b.png)">x</p><img src="a.png"></body></html>`
+	want := []string{"http://example.com/a.png", "http://example.com/b.png"}
+
+	// Every size splits the document somewhere else, including inside
+	// </script> and -->
+	for size := 1; size <= len(doc); size++ {
+		fetcher := &countingFetcher{counts: make(map[string]int)}
+		p := newPrefetcher(context.Background(), fetcher, "http://example.com/")
+		got, err := io.ReadAll(&scanningReader{r: &chunkReader{data: doc, size: size}, p: p})
+		if err != nil || string(got) != doc {
+			t.Fatalf("reads of %d: expected the document passed through, got %q, %v", size, got, err)
+		}
+
+		p.mu.Lock()
+		var urls []string
+		var fetches []*prefetch
+		for url, f := range p.fetches {
+			urls = append(urls, url)
+			fetches = append(fetches, f)
+		}
+		p.mu.Unlock()
+		slices.Sort(urls)
+		if !slices.Equal(urls, want) {
+			t.Errorf("reads of %d: expected prefetches of %v, got %v", size, want, urls)
+			continue
+		}
+		for _, f := range fetches {
+			<-f.done
+		}
+		for _, url := range want {
+			if n := fetcher.counts[url]; n != 1 {
+				t.Errorf("reads of %d: expected %s fetched once, got %d", size, url, n)
+			}
+		}
+	}
+}
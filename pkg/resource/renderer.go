@@ -1,9 +1,14 @@
 package resource
 
 import (
+	"context"
 	"fmt"
 	"image"
+	"image/png"
+	"io"
 	"log"
+	"strings"
+	"time"
 
 	"louis14/pkg/html"
 	"louis14/pkg/images"
@@ -11,26 +16,88 @@ import (
 	"louis14/pkg/layout"
 	"louis14/pkg/render"
 	"louis14/pkg/text"
+	stdnet "louis14/std/net"
 )
 
-// Renderer renders HTML content onto an image.
+// Renderer renders HTML content onto an image. Rendering stops with the
+// context's error when ctx is canceled.
 type Renderer interface {
-	Render(htmlContent string, target *image.RGBA) error
+	Render(ctx context.Context, htmlContent string, target *image.RGBA) error
 }
 
 // Louis14Renderer renders HTML using the louis14 layout and rendering engine.
 type Louis14Renderer struct {
 	fetcher  Fetcher
 	fonts    text.FontConfig
-	jsEngine *js.Engine // nil = skip JS execution
+	jsEngine *js.Engine  // nil = skip JS execution
+	prefetch *prefetcher // Subresources of the document being loaded
+	location string      // URL of the document being loaded, when a refresh led away from the fetcher's base
+
+	scriptsDisabled bool // By the policy; SetJSEngine is ignored
+
+	colorScheme string // Preferred color scheme for @media queries ("" = light)
+
+	viewportOffset float64 // Top of the rendered window in the page
+	documentHeight float64 // Height of the document rendered by the last Render
 }
 
+// ScriptIdleDeadline is how far ahead Render runs timers set by scripts
+// before rendering, so deferred DOM changes appear in the output.
+const ScriptIdleDeadline = 5 * time.Second
+
 // SetJSEngine configures a JavaScript engine for DOM manipulation.
-// When set, the renderer performs a two-pass render: first pass renders
-// the initial state, then JS executes and mutates the DOM, then a
-// second layout+render pass produces the final output.
+// When set, scripts run after the first layout and may mutate the DOM;
+// the document is laid out again, with timers run until idle, before it
+// is rendered.
+//
+// Scripts' fetch() and XMLHttpRequest requests go through the renderer's
+// fetcher. The engine is not used if the renderer's policy disables
+// scripts.
 func (r *Louis14Renderer) SetJSEngine(engine *js.Engine) {
+	if r.scriptsDisabled {
+		engine = nil
+	}
 	r.jsEngine = engine
+	if engine != nil && r.fetcher != nil {
+		engine.SetFetcher(r.fetcher)
+	}
+}
+
+// SetPolicy restricts what the renderer loads to what policy allows: its
+// fetcher, which scripts' requests also go through, is wrapped in a
+// PolicyFetcher, and scripts are not run if the policy disables them. The
+// policy's size limits count the resources of all the pages the renderer
+// loads from then on.
+func (r *Louis14Renderer) SetPolicy(policy Policy) {
+	if r.fetcher != nil {
+		r.fetcher = NewPolicyFetcher(r.fetcher, r.documentURL(), policy)
+	}
+	r.scriptsDisabled = policy.DisableScripts
+	r.SetJSEngine(r.jsEngine)
+}
+
+// Fetcher returns the fetcher the renderer loads resources with, which
+// keeps to the renderer's policy.
+func (r *Louis14Renderer) Fetcher() Fetcher {
+	return r.fetcher
+}
+
+// SetColorScheme sets the preferred color scheme, "light" or "dark", that
+// @media (prefers-color-scheme) queries match.
+func (r *Louis14Renderer) SetColorScheme(scheme string) {
+	r.colorScheme = scheme
+}
+
+// SetViewportOffset sets how far down the page the window Render draws
+// starts, so the target image can show any part of a long page.
+func (r *Louis14Renderer) SetViewportOffset(y float64) {
+	r.viewportOffset = y
+}
+
+// DocumentHeight returns the height of the document laid out by the last
+// Render, which may be more than the target image shows.
+func (r *Louis14Renderer) DocumentHeight() float64 {
+	return r.documentHeight
 }
 
 // NewLouis14Renderer creates a new Louis14Renderer with the given fetcher and font paths.
@@ -44,84 +111,318 @@ func NewLouis14Renderer(fetcher Fetcher, fonts ...text.FontConfig) *Louis14Rende
 	return &Louis14Renderer{fetcher: fetcher, fonts: fc}
 }
 
-// Render parses the HTML content, performs layout, and renders onto the target image.
-// The viewport width and height are derived from the target image dimensions.
-func (r *Louis14Renderer) Render(htmlContent string, target *image.RGBA) error {
-	bounds := target.Bounds()
-	viewportWidth := float64(bounds.Dx())
-	viewportHeight := float64(bounds.Dy())
-
-	// Build a CSS fetcher function from our Fetcher interface
-	var cssFetcher html.CSSFetcher
+// startPrefetch starts fetching the subresources of a new document
+// concurrently, until ctx is canceled, dropping those of the last one
+// still waiting. The document's markup is then passed to the prefetcher's
+// scanHTML.
+func (r *Louis14Renderer) startPrefetch(ctx context.Context) *prefetcher {
+	if r.prefetch != nil {
+		r.prefetch.stop()
+		r.prefetch = nil
+	}
 	if r.fetcher != nil {
-		cssFetcher = func(uri string) (string, error) {
-			if df, ok := r.fetcher.(*DefaultFetcher); ok {
-				return df.FetchCSS(uri)
-			}
-			body, _, err := r.fetcher.Fetch(uri)
-			if err != nil {
-				return "", err
+		r.prefetch = newPrefetcher(ctx, r.fetcher, r.documentURL())
+	}
+	return r.prefetch
+}
+
+// fetch returns the function fetching a subresource for the document
+// being loaded: through its prefetcher, if there is one. Relative URIs
+// resolve against the document's URL.
+func (r *Louis14Renderer) fetch() func(ctx context.Context, uri string) ([]byte, string, error) {
+	fetcher := r.fetcher
+	if r.prefetch != nil {
+		fetcher = r.prefetch
+	}
+	location := r.location
+	return func(ctx context.Context, uri string) ([]byte, string, error) {
+		if location != "" && !stdnet.IsNetworkURL(uri) {
+			uri = html.ResolveBase(location, uri)
+		}
+		return fetcher.Fetch(ctx, uri)
+	}
+}
+
+// cssFetcher builds an html.CSSFetcher from the renderer's Fetcher,
+// fetching with ctx.
+func (r *Louis14Renderer) cssFetcher(ctx context.Context) html.CSSFetcher {
+	if r.fetcher == nil {
+		return nil
+	}
+	fetch := r.fetch()
+	_, checkType := unwrapFetcher(r.fetcher).(*DefaultFetcher)
+	return func(uri string) (string, error) {
+		body, contentType, err := fetch(ctx, uri)
+		if err != nil {
+			return "", err
+		}
+		if checkType {
+			return cssContent(body, contentType)
+		}
+		return string(body), nil
+	}
+}
+
+// imageFetcher builds an images.ImageFetcher from the renderer's Fetcher.
+func (r *Louis14Renderer) imageFetcher() images.ImageFetcher {
+	if r.fetcher == nil {
+		return nil
+	}
+	fetch := r.fetch()
+	return func(ctx context.Context, uri string) ([]byte, error) {
+		body, _, err := fetch(ctx, uri)
+		if err != nil {
+			return nil, err
+		}
+		return body, nil
+	}
+}
+
+// documentURL returns the URL of the document being loaded: where a
+// refresh led, or the base of a DefaultFetcher, or "" to leave relative
+// URIs for the fetcher.
+func (r *Louis14Renderer) documentURL() string {
+	if r.location != "" {
+		return r.location
+	}
+	if df, ok := unwrapFetcher(r.fetcher).(*DefaultFetcher); ok {
+		return df.baseURL
+	}
+	return ""
+}
+
+// baseURL returns the URL relative URIs in doc, such as those of images
+// and links, resolve against: its <base href>, if it has one, resolved
+// against the document's URL.
+func (r *Louis14Renderer) baseURL(doc *html.Document) string {
+	if doc.BaseURL == "" {
+		return r.documentURL()
+	}
+	return html.ResolveBase(r.documentURL(), doc.BaseURL)
+}
+
+// maxRefreshes is how many <meta http-equiv="refresh"> redirects a load
+// follows before it settles for the page it has, as a browser would loop.
+const maxRefreshes = 5
+
+// followRefresh returns doc, or the document its <meta http-equiv="refresh">
+// redirects to at once, fetched and parsed, following up to maxRefreshes
+// of them, so a page that only redirects is not rendered blank. A page
+// that refreshes after a delay, or whose target cannot be fetched, is
+// rendered as it is.
+func (r *Louis14Renderer) followRefresh(ctx context.Context, doc *html.Document) (*html.Document, error) {
+	for hops := 0; hops < maxRefreshes && r.fetcher != nil; hops++ {
+		delay, target, ok := doc.Refresh()
+		if !ok || delay > 0 || target == "" {
+			break
+		}
+		target = html.ResolveBase(r.documentURL(), target)
+		if sameDocument(target, r.documentURL()) {
+			break // Reloading itself
+		}
+		body, _, err := r.fetch()(ctx, target)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
 			}
-			return string(body), nil
+			log.Printf("refresh to %s: %v", target, err)
+			break
+		}
+		content := string(body) // Network pages arrive decoded to UTF-8
+		if !stdnet.IsNetworkURL(target) {
+			content = html.Decode(body)
+		}
+		r.location = target
+		if prefetch := r.startPrefetch(ctx); prefetch != nil {
+			prefetch.scanHTML(content)
+		}
+		doc, err = html.ParseWithOptions(content, html.ParseOptions{CSSFetcher: r.cssFetcher(ctx), Scripting: r.jsEngine != nil})
+		if err != nil {
+			return nil, fmt.Errorf("parsing HTML: %w", err)
 		}
 	}
+	return doc, nil
+}
 
-	// Parse HTML with CSS fetcher
-	doc, err := html.ParseWithFetcher(htmlContent, cssFetcher)
+// sameDocument reports whether two URLs differ at most in their fragments.
+func sameDocument(a, b string) bool {
+	a, _, _ = strings.Cut(a, "#")
+	b, _, _ = strings.Cut(b, "#")
+	return a == b
+}
+
+// fontFetcher builds a text.FontFetcher from the renderer's Fetcher.
+func (r *Louis14Renderer) fontFetcher() text.FontFetcher {
+	if r.fetcher == nil {
+		return nil
+	}
+	fetch := r.fetch()
+	return func(ctx context.Context, uri string) ([]byte, error) {
+		body, _, err := fetch(ctx, uri)
+		return body, err
+	}
+}
+
+// Render parses the HTML content, performs layout, and renders onto the target image.
+// The viewport width and height are derived from the target image dimensions,
+// and the image shows the window of the page at the viewport offset.
+func (r *Louis14Renderer) Render(ctx context.Context, htmlContent string, target *image.RGBA) error {
+	bounds := target.Bounds()
+	doc, layoutEngine, boxes, err := r.layoutDocument(ctx, htmlContent, float64(bounds.Dx()), float64(bounds.Dy()))
 	if err != nil {
-		return fmt.Errorf("parsing HTML: %w", err)
+		return err
 	}
+	defer layoutEngine.ReleaseCanvases()
 
-	// Build an image fetcher function from our Fetcher interface
-	var imageFetcher images.ImageFetcher
-	if r.fetcher != nil {
-		imageFetcher = func(uri string) ([]byte, error) {
-			if df, ok := r.fetcher.(*DefaultFetcher); ok {
-				return df.FetchImage(uri)
+	// Render onto target image
+	renderer := r.newRenderer(render.NewRendererForImage(target), r.baseURL(doc))
+	renderer.SetViewportOffset(r.viewportOffset)
+	if err := renderer.Render(ctx, boxes); err != nil {
+		return err
+	}
+
+	r.documentHeight = layoutEngine.DocumentHeight()
+	return nil
+}
+
+// Output formats of RenderTo.
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+	FormatPDF = "pdf"
+)
+
+// RenderTo parses the HTML content, lays it out for a viewport of width x
+// height, and writes it to w in the given format: a PNG or SVG image of
+// the window at the viewport offset, or a PDF with a page of the
+// viewport's size for each page of the document. It stops with the
+// context's error when ctx is canceled.
+func (r *Louis14Renderer) RenderTo(ctx context.Context, w io.Writer, htmlContent string, width, height int, format string) error {
+	switch format {
+	case FormatPNG, FormatSVG, FormatPDF:
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+	doc, layoutEngine, boxes, err := r.layoutDocument(ctx, htmlContent, float64(width), float64(height))
+	if err != nil {
+		return err
+	}
+	defer layoutEngine.ReleaseCanvases()
+	r.documentHeight = layoutEngine.DocumentHeight()
+
+	switch format {
+	case FormatSVG:
+		svg := render.NewSVGBackend(width, height)
+		renderer := r.newRenderer(render.NewRendererForBackend(svg), r.baseURL(doc))
+		renderer.SetViewportOffset(r.viewportOffset)
+		if err := renderer.Render(ctx, boxes); err != nil {
+			return err
+		}
+		_, err = svg.WriteTo(w)
+	case FormatPDF:
+		var pages [][]*layout.Box
+		if pages, err = layoutEngine.LayoutPaged(ctx, doc, float64(width), float64(height)); err != nil {
+			return err
+		}
+		pdf := render.NewPDFBackend(width, height)
+		renderer := r.newRenderer(render.NewRendererForBackend(pdf), r.baseURL(doc))
+		for i, page := range pages {
+			if i > 0 {
+				pdf.NewPage()
 			}
-			body, _, err := r.fetcher.Fetch(uri)
-			if err != nil {
-				return nil, err
+			if err := renderer.Render(ctx, page); err != nil {
+				return err
 			}
-			return body, nil
 		}
+		_, err = pdf.WriteTo(w)
+	default:
+		target := image.NewRGBA(image.Rect(0, 0, width, height))
+		renderer := r.newRenderer(render.NewRendererForImage(target), r.baseURL(doc))
+		renderer.SetViewportOffset(r.viewportOffset)
+		if err := renderer.Render(ctx, boxes); err != nil {
+			return err
+		}
+		err = png.Encode(w, target)
+	}
+	return err
+}
+
+// layoutDocument parses the HTML content and lays it out for a viewport of
+// the given size at the viewport offset. If a JS engine is configured,
+// the document's scripts are run, with their timers until idle, and it is
+// laid out again. It returns the context's error if ctx is canceled
+// before it is done.
+func (r *Louis14Renderer) layoutDocument(ctx context.Context, htmlContent string, viewportWidth, viewportHeight float64) (*html.Document, *layout.LayoutEngine, []*layout.Box, error) {
+	// Parse HTML with CSS fetcher, fetching subresources concurrently
+	r.location = ""
+	if prefetch := r.startPrefetch(ctx); prefetch != nil {
+		prefetch.scanHTML(htmlContent)
+	}
+	doc, err := html.ParseWithOptions(htmlContent, html.ParseOptions{CSSFetcher: r.cssFetcher(ctx), Scripting: r.jsEngine != nil})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("parsing HTML: %w", err)
+	}
+	if doc, err = r.followRefresh(ctx, doc); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, nil, err
 	}
 
 	// Layout
 	layoutEngine := layout.NewLayoutEngine(viewportWidth, viewportHeight)
-	if imageFetcher != nil {
+	if imageFetcher := r.imageFetcher(); imageFetcher != nil {
 		layoutEngine.SetImageFetcher(imageFetcher)
 	}
-	boxes := layoutEngine.Layout(doc)
-
-	// Render onto target image
-	renderer := render.NewRendererForImage(target)
-	renderer.SetFonts(r.fonts)
-	if imageFetcher != nil {
-		renderer.SetImageFetcher(imageFetcher)
+	layoutEngine.SetBaseURL(r.baseURL(doc))
+	layoutEngine.SetFontFetcher(r.fontFetcher())
+	layoutEngine.SetColorScheme(r.colorScheme)
+	layoutEngine.SetScrollY(r.viewportOffset)
+	runJS := r.jsEngine != nil && len(doc.Scripts) > 0
+	layoutEngine.SetIncremental(runJS)
+	boxes, err := layoutEngine.Layout(ctx, doc)
+	if err != nil {
+		layoutEngine.ReleaseCanvases()
+		return nil, nil, nil, err
 	}
-	renderer.Render(boxes)
 
 	// Execute JavaScript if engine is configured
-	if r.jsEngine != nil && len(doc.Scripts) > 0 {
+	if runJS {
+		r.jsEngine.SetContext(ctx)
+		if r.location != "" {
+			r.jsEngine.SetBaseURL(r.location)
+		}
 		if err := r.jsEngine.Execute(doc); err != nil {
 			log.Printf("js: %v", err)
 		}
 
-		// Second pass: re-layout and re-render with JS modifications
-		layoutEngine2 := layout.NewLayoutEngine(viewportWidth, viewportHeight)
-		if imageFetcher != nil {
-			layoutEngine2.SetImageFetcher(imageFetcher)
+		// Re-layout with JS modifications, then fire load. The
+		// incremental engine reuses geometry for untouched subtrees.
+		if _, err := layoutEngine.Layout(ctx, doc); err != nil {
+			layoutEngine.ReleaseCanvases()
+			return nil, nil, nil, err
 		}
-		boxes2 := layoutEngine2.Layout(doc)
-
-		renderer2 := render.NewRendererForImage(target)
-		renderer2.SetFonts(r.fonts)
-		if imageFetcher != nil {
-			renderer2.SetImageFetcher(imageFetcher)
+		if err := r.jsEngine.DispatchLoad(); err != nil {
+			log.Printf("js: %v", err)
+		}
+		if err := r.jsEngine.RunUntilIdle(ScriptIdleDeadline); err != nil {
+			log.Printf("js: %v", err)
+		}
+		if boxes, err = layoutEngine.Layout(ctx, doc); err != nil {
+			layoutEngine.ReleaseCanvases()
+			return nil, nil, nil, err
 		}
-		renderer2.Render(boxes2)
 	}
+	return doc, layoutEngine, boxes, nil
+}
 
-	return nil
+// newRenderer configures renderer with the renderer's fonts and fetcher,
+// for a document whose relative URIs resolve against baseURL.
+func (r *Louis14Renderer) newRenderer(renderer *render.Renderer, baseURL string) *render.Renderer {
+	renderer.SetFonts(r.fonts)
+	if imageFetcher := r.imageFetcher(); imageFetcher != nil {
+		renderer.SetImageFetcher(imageFetcher)
+	}
+	renderer.SetBaseURL(baseURL)
+	return renderer
 }
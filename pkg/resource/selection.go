@@ -0,0 +1,65 @@
+package resource
+
+import (
+	"image"
+	"math"
+
+	"louis14/pkg/layout"
+)
+
+// DragTo moves the pointer, pressed since PressAt, to the document point
+// (x, y), extending the text selection to the text nearest it. It returns
+// true if the selection changed and the page needs to be redrawn.
+func (p *Page) DragTo(x, y float64) bool {
+	if !p.selecting {
+		return false
+	}
+	pos, ok := layout.HitTestText(p.textBoxes, x, y)
+	if !ok || pos == p.selectFocus {
+		return false
+	}
+	p.selectFocus = pos
+	return true
+}
+
+// SelectedText returns the text selected by dragging over the page, or ""
+// if there is no selection.
+func (p *Page) SelectedText() string {
+	return layout.SelectedText(p.textBoxes, p.selectAnchor, p.selectFocus)
+}
+
+// ClearSelection deselects the selected text. It returns true if there was
+// a selection and the page needs to be redrawn.
+func (p *Page) ClearSelection() bool {
+	if p.selectAnchor == p.selectFocus {
+		return false
+	}
+	p.selectFocus = p.selectAnchor
+	return true
+}
+
+// startSelection starts selecting text at the document point (x, y), for
+// a press that does not focus a text field, clearing the last selection.
+func (p *Page) startSelection(x, y float64) {
+	pos, ok := layout.HitTestText(p.textBoxes, x, y)
+	p.selectAnchor, p.selectFocus, p.selecting = pos, pos, ok
+}
+
+// drawSelection draws the selected text onto target, which shows the page
+// scrolled to (scrollX, scrollY), with its colors inverted.
+func (p *Page) drawSelection(target *image.RGBA, scrollX, scrollY float64) {
+	for _, r := range layout.SelectionRects(p.textBoxes, p.selectAnchor, p.selectFocus) {
+		x, y := scrollX, scrollY
+		if inFixedBox(r.Box) {
+			y = 0 // Fixed boxes are laid out in viewport coordinates
+		}
+		rect := image.Rect(int(math.Floor(r.X-x)), int(math.Floor(r.Y-y)),
+			int(math.Ceil(r.X+r.Width-x)), int(math.Ceil(r.Y+r.Height-y))).Intersect(target.Bounds())
+		for py := rect.Min.Y; py < rect.Max.Y; py++ {
+			row := target.Pix[target.PixOffset(rect.Min.X, py):target.PixOffset(rect.Max.X, py)]
+			for i := 0; i < len(row); i += 4 {
+				row[i], row[i+1], row[i+2] = 255-row[i], 255-row[i+1], 255-row[i+2]
+			}
+		}
+	}
+}
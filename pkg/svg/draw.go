@@ -0,0 +1,301 @@
+package svg
+
+import (
+	"math"
+	"strings"
+
+	"louis14/pkg/css"
+
+	"github.com/fogleman/gg"
+)
+
+// paint holds the inherited presentation properties.
+type paint struct {
+	fill          css.Color
+	fillNone      bool
+	stroke        css.Color
+	strokeNone    bool
+	strokeWidth   float64
+	fillOpacity   float64
+	strokeOpacity float64
+	evenOdd       bool
+}
+
+// defaultPaint returns the initial values: a black fill and no stroke.
+func defaultPaint() paint {
+	return paint{
+		fill:          css.Color{A: 1},
+		strokeNone:    true,
+		strokeWidth:   1,
+		fillOpacity:   1,
+		strokeOpacity: 1,
+	}
+}
+
+// renderer draws elements into a gg context.
+type renderer struct {
+	dc *gg.Context
+}
+
+func (r *renderer) drawChildren(el *Element, p paint) {
+	for _, child := range el.Children {
+		r.draw(child, p)
+	}
+}
+
+// draw paints one element and its descendants. Elements outside the
+// supported subset, including defs and text, are skipped.
+func (r *renderer) draw(el *Element, p paint) {
+	props := properties(el)
+	if props["display"] == "none" || props["visibility"] == "hidden" {
+		return
+	}
+	p = p.inherit(props)
+
+	r.dc.Push()
+	defer r.dc.Pop()
+	applyTransform(r.dc, el.Attrs["transform"])
+
+	switch el.Name {
+	case "g", "svg", "a":
+		r.drawChildren(el, p)
+		return
+	case "rect":
+		x, y := num(el, "x"), num(el, "y")
+		w, h := num(el, "width"), num(el, "height")
+		if w <= 0 || h <= 0 {
+			return
+		}
+		rx, hasRx := parseLength(el.Attrs["rx"])
+		ry, hasRy := parseLength(el.Attrs["ry"])
+		if !hasRx {
+			rx = ry
+		}
+		if !hasRy {
+			ry = rx
+		}
+		rx, ry = min(max(rx, 0), w/2), min(max(ry, 0), h/2)
+		if rx > 0 && ry > 0 {
+			r.roundedRect(x, y, w, h, rx, ry)
+		} else {
+			r.dc.DrawRectangle(x, y, w, h)
+		}
+	case "circle":
+		radius := num(el, "r")
+		if radius <= 0 {
+			return
+		}
+		r.dc.DrawCircle(num(el, "cx"), num(el, "cy"), radius)
+	case "ellipse":
+		rx, ry := num(el, "rx"), num(el, "ry")
+		if rx <= 0 || ry <= 0 {
+			return
+		}
+		r.dc.DrawEllipse(num(el, "cx"), num(el, "cy"), rx, ry)
+	case "line":
+		r.dc.MoveTo(num(el, "x1"), num(el, "y1"))
+		r.dc.LineTo(num(el, "x2"), num(el, "y2"))
+		p.fillNone = true // Lines have no interior
+	case "polyline", "polygon":
+		pts := parseNumbers(el.Attrs["points"])
+		if len(pts) < 4 {
+			return
+		}
+		r.dc.MoveTo(pts[0], pts[1])
+		for i := 2; i+1 < len(pts); i += 2 {
+			r.dc.LineTo(pts[i], pts[i+1])
+		}
+		if el.Name == "polygon" {
+			r.dc.ClosePath()
+		}
+	case "path":
+		if !tracePath(r.dc, el.Attrs["d"]) {
+			return
+		}
+	default:
+		return
+	}
+	r.paint(p)
+}
+
+// paint fills and strokes the current path.
+func (r *renderer) paint(p paint) {
+	if !p.fillNone && p.fillOpacity > 0 {
+		if p.evenOdd {
+			r.dc.SetFillRuleEvenOdd()
+		} else {
+			r.dc.SetFillRuleWinding()
+		}
+		setColor(r.dc, p.fill, p.fillOpacity)
+		r.dc.FillPreserve()
+	}
+	if !p.strokeNone && p.strokeWidth > 0 && p.strokeOpacity > 0 {
+		setColor(r.dc, p.stroke, p.strokeOpacity)
+		r.dc.SetLineWidth(p.strokeWidth * transformScale(r.dc))
+		r.dc.StrokePreserve()
+	}
+	r.dc.ClearPath()
+}
+
+// roundedRect traces a rectangle with elliptical corners.
+func (r *renderer) roundedRect(x, y, w, h, rx, ry float64) {
+	dc := r.dc
+	dc.NewSubPath()
+	dc.MoveTo(x+rx, y)
+	dc.LineTo(x+w-rx, y)
+	dc.DrawEllipticalArc(x+w-rx, y+ry, rx, ry, -math.Pi/2, 0)
+	dc.LineTo(x+w, y+h-ry)
+	dc.DrawEllipticalArc(x+w-rx, y+h-ry, rx, ry, 0, math.Pi/2)
+	dc.LineTo(x+rx, y+h)
+	dc.DrawEllipticalArc(x+rx, y+h-ry, rx, ry, math.Pi/2, math.Pi)
+	dc.LineTo(x, y+ry)
+	dc.DrawEllipticalArc(x+rx, y+ry, rx, ry, math.Pi, 3*math.Pi/2)
+	dc.ClosePath()
+}
+
+// setColor sets dc's color, multiplying in an opacity.
+func setColor(dc *gg.Context, c css.Color, opacity float64) {
+	dc.SetRGBA(float64(c.R)/255, float64(c.G)/255, float64(c.B)/255, c.A*opacity)
+}
+
+// transformScale returns the average scale of dc's transform. gg strokes
+// in device space, so stroke widths in user units are scaled by it.
+func transformScale(dc *gg.Context) float64 {
+	x0, y0 := dc.TransformPoint(0, 0)
+	x1, y1 := dc.TransformPoint(1, 0)
+	x2, y2 := dc.TransformPoint(0, 1)
+	return math.Sqrt(math.Hypot(x1-x0, y1-y0) * math.Hypot(x2-x0, y2-y0))
+}
+
+// properties returns an element's presentation attributes with its style
+// attribute declarations applied over them.
+func properties(el *Element) map[string]string {
+	props := make(map[string]string)
+	for _, name := range []string{"fill", "stroke", "stroke-width", "fill-opacity",
+		"stroke-opacity", "opacity", "fill-rule", "display", "visibility", "color"} {
+		if v, ok := el.Attrs[name]; ok {
+			props[name] = strings.TrimSpace(v)
+		}
+	}
+	for _, decl := range strings.Split(el.Attrs["style"], ";") {
+		name, value, ok := strings.Cut(decl, ":")
+		if ok {
+			props[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+		}
+	}
+	return props
+}
+
+// inherit returns p with an element's properties applied.
+func (p paint) inherit(props map[string]string) paint {
+	if v, ok := props["fill"]; ok {
+		p.fill, p.fillNone = parsePaint(v, p.fill, p.fillNone)
+	}
+	if v, ok := props["stroke"]; ok {
+		p.stroke, p.strokeNone = parsePaint(v, p.stroke, p.strokeNone)
+	}
+	if v, ok := parseLength(props["stroke-width"]); ok && v >= 0 {
+		p.strokeWidth = v
+	}
+	if v, ok := parseLength(props["fill-opacity"]); ok {
+		p.fillOpacity *= clamp01(v)
+	}
+	if v, ok := parseLength(props["stroke-opacity"]); ok {
+		p.strokeOpacity *= clamp01(v)
+	}
+	// Group opacity is approximated per shape.
+	if v, ok := parseLength(props["opacity"]); ok {
+		p.fillOpacity *= clamp01(v)
+		p.strokeOpacity *= clamp01(v)
+	}
+	if v, ok := props["fill-rule"]; ok {
+		p.evenOdd = v == "evenodd"
+	}
+	return p
+}
+
+// parsePaint parses a fill or stroke value. Unparseable values (such as
+// url() references) leave the inherited paint unchanged.
+func parsePaint(v string, inherited css.Color, inheritedNone bool) (css.Color, bool) {
+	switch strings.ToLower(v) {
+	case "none", "transparent":
+		return inherited, true
+	case "currentcolor", "inherit":
+		return inherited, inheritedNone
+	}
+	if c, ok := css.ParseColor(v); ok {
+		return c, false
+	}
+	return inherited, inheritedNone
+}
+
+func clamp01(v float64) float64 {
+	return min(max(v, 0), 1)
+}
+
+// num returns a numeric attribute, or 0 if it is missing or invalid.
+func num(el *Element, name string) float64 {
+	v, _ := parseLength(el.Attrs[name])
+	return v
+}
+
+// applyTransform applies an SVG transform list to dc.
+func applyTransform(dc *gg.Context, transform string) {
+	rest := transform
+	for {
+		open := strings.IndexByte(rest, '(')
+		close := strings.IndexByte(rest, ')')
+		if open < 0 || close < open {
+			return
+		}
+		name := strings.ToLower(strings.Trim(rest[:open], " \t\r\n,"))
+		args := parseNumbers(rest[open+1 : close])
+		rest = rest[close+1:]
+
+		switch {
+		case name == "translate" && len(args) >= 1:
+			ty := 0.0
+			if len(args) > 1 {
+				ty = args[1]
+			}
+			dc.Translate(args[0], ty)
+		case name == "scale" && len(args) >= 1:
+			sy := args[0]
+			if len(args) > 1 {
+				sy = args[1]
+			}
+			dc.Scale(args[0], sy)
+		case name == "rotate" && len(args) >= 1:
+			if len(args) >= 3 {
+				dc.RotateAbout(gg.Radians(args[0]), args[1], args[2])
+			} else {
+				dc.Rotate(gg.Radians(args[0]))
+			}
+		case name == "skewx" && len(args) >= 1:
+			dc.Shear(math.Tan(gg.Radians(args[0])), 0)
+		case name == "skewy" && len(args) >= 1:
+			dc.Shear(0, math.Tan(gg.Radians(args[0])))
+		case name == "matrix" && len(args) >= 6:
+			applyMatrix(dc, args[0], args[1], args[2], args[3], args[4], args[5])
+		}
+	}
+}
+
+// applyMatrix applies matrix(a b c d e f). gg has no way to multiply in an
+// arbitrary matrix, so it is decomposed into translate, rotate, shear and
+// scale.
+func applyMatrix(dc *gg.Context, a, b, c, d, e, f float64) {
+	sx := math.Hypot(a, b)
+	if sx == 0 {
+		return
+	}
+	sy := (a*d - b*c) / sx
+	if sy == 0 {
+		return
+	}
+	shear := (a*c + b*d) / sx / sy
+	dc.Translate(e, f)
+	dc.Rotate(math.Atan2(b, a))
+	dc.Shear(shear, 0)
+	dc.Scale(sx, sy)
+}
@@ -0,0 +1,294 @@
+package svg
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/fogleman/gg"
+)
+
+// scanner reads numbers and command letters from path data and number
+// lists, skipping whitespace and comma separators.
+type scanner struct {
+	s   string
+	pos int
+}
+
+func (sc *scanner) skipSeparators() {
+	for sc.pos < len(sc.s) {
+		switch sc.s[sc.pos] {
+		case ' ', '\t', '\r', '\n', ',':
+			sc.pos++
+		default:
+			return
+		}
+	}
+}
+
+// command returns the next path command letter, if one is next.
+func (sc *scanner) command() (byte, bool) {
+	sc.skipSeparators()
+	if sc.pos >= len(sc.s) {
+		return 0, false
+	}
+	c := sc.s[sc.pos]
+	if (c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') && c != 'e' && c != 'E' {
+		sc.pos++
+		return c, true
+	}
+	return 0, false
+}
+
+// number returns the next number. Numbers may follow each other without
+// separators where unambiguous, as in "10-5" or "0.5.5".
+func (sc *scanner) number() (float64, bool) {
+	sc.skipSeparators()
+	start := sc.pos
+	i := sc.pos
+	if i < len(sc.s) && (sc.s[i] == '+' || sc.s[i] == '-') {
+		i++
+	}
+	digits, dot := false, false
+	for ; i < len(sc.s); i++ {
+		c := sc.s[i]
+		if c >= '0' && c <= '9' {
+			digits = true
+		} else if c == '.' && !dot {
+			dot = true
+		} else {
+			break
+		}
+	}
+	if !digits {
+		return 0, false
+	}
+	if i < len(sc.s) && (sc.s[i] == 'e' || sc.s[i] == 'E') {
+		j := i + 1
+		if j < len(sc.s) && (sc.s[j] == '+' || sc.s[j] == '-') {
+			j++
+		}
+		if j < len(sc.s) && sc.s[j] >= '0' && sc.s[j] <= '9' {
+			for j < len(sc.s) && sc.s[j] >= '0' && sc.s[j] <= '9' {
+				j++
+			}
+			i = j
+		}
+	}
+	v, err := strconv.ParseFloat(sc.s[start:i], 64)
+	if err != nil {
+		return 0, false
+	}
+	sc.pos = i
+	return v, true
+}
+
+// flag reads an arc flag, which may be written without a separator.
+func (sc *scanner) flag() (bool, bool) {
+	sc.skipSeparators()
+	if sc.pos < len(sc.s) && (sc.s[sc.pos] == '0' || sc.s[sc.pos] == '1') {
+		sc.pos++
+		return sc.s[sc.pos-1] == '1', true
+	}
+	return false, false
+}
+
+// numbers reads n numbers, reporting false if fewer are available.
+func (sc *scanner) numbers(n int) ([]float64, bool) {
+	out := make([]float64, n)
+	for i := range out {
+		v, ok := sc.number()
+		if !ok {
+			return nil, false
+		}
+		out[i] = v
+	}
+	return out, true
+}
+
+// tracePath adds the path data d to dc's current path. It supports the
+// M, L, H, V, C, S, Q, T, A and Z commands in absolute and relative form.
+// As in browsers, an error ends the path but keeps what was traced before
+// it. It reports whether anything was traced.
+func tracePath(dc *gg.Context, d string) bool {
+	sc := &scanner{s: d}
+	var x, y, startX, startY float64 // Current point and subpath start
+	var ctrlX, ctrlY float64         // Last control point, for S and T
+	var prev byte
+	traced := false
+
+	cmd, ok := sc.command()
+	if !ok || (cmd != 'M' && cmd != 'm') {
+		return false
+	}
+	for {
+		rel := cmd >= 'a'
+		ox, oy := 0.0, 0.0
+		if rel {
+			ox, oy = x, y
+		}
+		switch cmd {
+		case 'M', 'm':
+			p, ok := sc.numbers(2)
+			if !ok {
+				return traced
+			}
+			x, y = ox+p[0], oy+p[1]
+			startX, startY = x, y
+			dc.MoveTo(x, y)
+			// Further coordinate pairs are implicit lineto commands.
+			cmd = 'L'
+			if rel {
+				cmd = 'l'
+			}
+			prev = 'M'
+			if next, ok := sc.command(); ok {
+				cmd = next
+				continue
+			}
+			if sc.pos >= len(sc.s) {
+				return traced
+			}
+			continue
+		case 'L', 'l':
+			p, ok := sc.numbers(2)
+			if !ok {
+				return traced
+			}
+			x, y = ox+p[0], oy+p[1]
+			dc.LineTo(x, y)
+		case 'H', 'h':
+			v, ok := sc.number()
+			if !ok {
+				return traced
+			}
+			x = ox + v
+			dc.LineTo(x, y)
+		case 'V', 'v':
+			v, ok := sc.number()
+			if !ok {
+				return traced
+			}
+			y = oy + v
+			dc.LineTo(x, y)
+		case 'C', 'c':
+			p, ok := sc.numbers(6)
+			if !ok {
+				return traced
+			}
+			ctrlX, ctrlY = ox+p[2], oy+p[3]
+			dc.CubicTo(ox+p[0], oy+p[1], ctrlX, ctrlY, ox+p[4], oy+p[5])
+			x, y = ox+p[4], oy+p[5]
+		case 'S', 's':
+			p, ok := sc.numbers(4)
+			if !ok {
+				return traced
+			}
+			x1, y1 := x, y
+			if prev == 'C' || prev == 'S' {
+				x1, y1 = 2*x-ctrlX, 2*y-ctrlY
+			}
+			ctrlX, ctrlY = ox+p[0], oy+p[1]
+			dc.CubicTo(x1, y1, ctrlX, ctrlY, ox+p[2], oy+p[3])
+			x, y = ox+p[2], oy+p[3]
+		case 'Q', 'q':
+			p, ok := sc.numbers(4)
+			if !ok {
+				return traced
+			}
+			ctrlX, ctrlY = ox+p[0], oy+p[1]
+			dc.QuadraticTo(ctrlX, ctrlY, ox+p[2], oy+p[3])
+			x, y = ox+p[2], oy+p[3]
+		case 'T', 't':
+			p, ok := sc.numbers(2)
+			if !ok {
+				return traced
+			}
+			if prev == 'Q' || prev == 'T' {
+				ctrlX, ctrlY = 2*x-ctrlX, 2*y-ctrlY
+			} else {
+				ctrlX, ctrlY = x, y
+			}
+			dc.QuadraticTo(ctrlX, ctrlY, ox+p[0], oy+p[1])
+			x, y = ox+p[0], oy+p[1]
+		case 'A', 'a':
+			radii, ok := sc.numbers(3)
+			if !ok {
+				return traced
+			}
+			large, ok1 := sc.flag()
+			sweep, ok2 := sc.flag()
+			end, ok3 := sc.numbers(2)
+			if !ok1 || !ok2 || !ok3 {
+				return traced
+			}
+			ex, ey := ox+end[0], oy+end[1]
+			arcTo(dc, x, y, radii[0], radii[1], radii[2], large, sweep, ex, ey)
+			x, y = ex, ey
+		case 'Z', 'z':
+			dc.ClosePath()
+			x, y = startX, startY
+			dc.MoveTo(x, y)
+		default:
+			return traced
+		}
+		traced = true
+		prev = cmd &^ 0x20 // Uppercase
+
+		// A command's parameters may repeat without the letter.
+		if next, ok := sc.command(); ok {
+			cmd = next
+		} else if sc.pos >= len(sc.s) || cmd == 'Z' || cmd == 'z' {
+			return traced
+		}
+	}
+}
+
+// arcTo adds an elliptical arc from (x1, y1) to (x2, y2), converting the
+// endpoint parameterization to a center one (SVG 1.1 Appendix F.6.5).
+func arcTo(dc *gg.Context, x1, y1, rx, ry, rotation float64, large, sweep bool, x2, y2 float64) {
+	if x1 == x2 && y1 == y2 {
+		return
+	}
+	rx, ry = math.Abs(rx), math.Abs(ry)
+	if rx == 0 || ry == 0 {
+		dc.LineTo(x2, y2)
+		return
+	}
+	phi := gg.Radians(rotation)
+	cos, sin := math.Cos(phi), math.Sin(phi)
+	dx, dy := (x1-x2)/2, (y1-y2)/2
+	x1p := cos*dx + sin*dy
+	y1p := -sin*dx + cos*dy
+
+	// Scale up radii that are too small to reach the endpoint.
+	if l := x1p*x1p/(rx*rx) + y1p*y1p/(ry*ry); l > 1 {
+		s := math.Sqrt(l)
+		rx, ry = rx*s, ry*s
+	}
+	num := rx*rx*ry*ry - rx*rx*y1p*y1p - ry*ry*x1p*x1p
+	den := rx*rx*y1p*y1p + ry*ry*x1p*x1p
+	coef := math.Sqrt(max(num/den, 0))
+	if large == sweep {
+		coef = -coef
+	}
+	cxp := coef * rx * y1p / ry
+	cyp := -coef * ry * x1p / rx
+	cx := cos*cxp - sin*cyp + (x1+x2)/2
+	cy := sin*cxp + cos*cyp + (y1+y2)/2
+
+	angle := func(ux, uy float64) float64 { return math.Atan2(uy, ux) }
+	theta1 := angle((x1p-cxp)/rx, (y1p-cyp)/ry)
+	theta2 := angle((-x1p-cxp)/rx, (-y1p-cyp)/ry)
+	delta := theta2 - theta1
+	if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	} else if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	}
+
+	dc.Push()
+	dc.Translate(cx, cy)
+	dc.Rotate(phi)
+	dc.DrawEllipticalArc(0, 0, rx, ry, theta1, theta1+delta)
+	dc.Pop()
+}
@@ -0,0 +1,215 @@
+// Package svg parses and rasterizes a subset of SVG: the rect, circle,
+// ellipse, line, polyline, polygon and path shapes, grouping with g,
+// fill and stroke paint, transforms, and the root viewBox.
+package svg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"louis14/pkg/html"
+
+	"github.com/fogleman/gg"
+)
+
+// Default intrinsic size of an SVG image without width and height, as for
+// other replaced elements (CSS 2.1 §10.3.2).
+const (
+	defaultWidth  = 300
+	defaultHeight = 150
+)
+
+// Element is a node of an SVG document. Names and attribute names are
+// lowercased, so documents parsed from HTML (which lowercases them) and
+// from XML behave the same.
+type Element struct {
+	Name     string
+	Attrs    map[string]string
+	Children []*Element
+}
+
+// Image is a parsed SVG document.
+type Image struct {
+	Width, Height float64 // Intrinsic size in pixels
+	root          *Element
+	viewBox       [4]float64 // min-x, min-y, width, height
+	hasViewBox    bool
+}
+
+// IsSVG reports whether data looks like an SVG document: its first
+// element, after any XML declaration, doctype and comments, is <svg.
+func IsSVG(data []byte) bool {
+	s := bytes.TrimSpace(data)
+	for len(s) > 0 && s[0] == '<' {
+		switch {
+		case bytes.HasPrefix(s, []byte("<?")):
+			end := bytes.Index(s, []byte("?>"))
+			if end < 0 {
+				return false
+			}
+			s = bytes.TrimSpace(s[end+2:])
+		case bytes.HasPrefix(s, []byte("<!--")):
+			end := bytes.Index(s, []byte("-->"))
+			if end < 0 {
+				return false
+			}
+			s = bytes.TrimSpace(s[end+3:])
+		case bytes.HasPrefix(s, []byte("<!")):
+			end := bytes.IndexByte(s, '>')
+			if end < 0 {
+				return false
+			}
+			s = bytes.TrimSpace(s[end+1:])
+		default:
+			return len(s) > 4 && strings.EqualFold(string(s[1:4]), "svg") &&
+				strings.ContainsRune(" \t\r\n/>", rune(s[4]))
+		}
+	}
+	return false
+}
+
+// Parse parses an SVG document.
+func Parse(data []byte) (*Image, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+
+	var stack []*Element
+	var root *Element
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("svg: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			el := &Element{Name: strings.ToLower(t.Name.Local), Attrs: make(map[string]string)}
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" || a.Name.Local == "xmlns" {
+					continue
+				}
+				el.Attrs[strings.ToLower(a.Name.Local)] = a.Value
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, el)
+			} else if root == nil {
+				root = el
+			}
+			stack = append(stack, el)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	if root == nil || root.Name != "svg" {
+		return nil, fmt.Errorf("svg: no <svg> root element")
+	}
+	return New(root), nil
+}
+
+// New creates an Image from an already parsed <svg> element, such as one
+// converted from an inline <svg> in an HTML document.
+func New(root *Element) *Image {
+	img := &Image{root: root}
+	if vb, ok := root.Attrs["viewbox"]; ok {
+		if nums := parseNumbers(vb); len(nums) == 4 && nums[2] > 0 && nums[3] > 0 {
+			copy(img.viewBox[:], nums)
+			img.hasViewBox = true
+		}
+	}
+
+	// Missing dimensions come from the viewBox aspect ratio
+	w, hasW := parseLength(root.Attrs["width"])
+	h, hasH := parseLength(root.Attrs["height"])
+	ratio := float64(defaultHeight) / defaultWidth
+	if img.hasViewBox {
+		ratio = img.viewBox[3] / img.viewBox[2]
+	}
+	switch {
+	case hasW && hasH:
+	case hasW:
+		h = w * ratio
+	case hasH:
+		w = h / ratio
+	default:
+		w = defaultWidth
+		h = w * ratio
+		if !img.hasViewBox {
+			h = defaultHeight
+		}
+	}
+	img.Width, img.Height = w, h
+	return img
+}
+
+// Rasterize renders the image at the given pixel size. Like a canvas, the
+// bitmap is limited to html.MaxCanvasDimension on a side and
+// html.MaxCanvasArea in all; a larger size is an error.
+func (img *Image) Rasterize(width, height int) (image.Image, error) {
+	width, height = max(width, 1), max(height, 1)
+	if width > html.MaxCanvasDimension || height > html.MaxCanvasDimension || width*height > html.MaxCanvasArea {
+		return nil, fmt.Errorf("svg: %dx%d image is too large to rasterize", width, height)
+	}
+	dc := gg.NewContext(width, height)
+	img.Draw(dc, float64(width), float64(height))
+	return dc.Image(), nil
+}
+
+// Draw paints the image into dc, scaled to fill a width x height area at
+// the origin of dc's current transform. The viewBox is fitted into the
+// area as for preserveAspectRatio="xMidYMid meet".
+func (img *Image) Draw(dc *gg.Context, width, height float64) {
+	dc.Push()
+	defer dc.Pop()
+	if img.hasViewBox {
+		vx, vy, vw, vh := img.viewBox[0], img.viewBox[1], img.viewBox[2], img.viewBox[3]
+		scale := min(width/vw, height/vh)
+		dc.Translate((width-vw*scale)/2, (height-vh*scale)/2)
+		dc.Scale(scale, scale)
+		dc.Translate(-vx, -vy)
+	} else if img.Width > 0 && img.Height > 0 {
+		dc.Scale(width/img.Width, height/img.Height)
+	}
+	r := &renderer{dc: dc}
+	r.drawChildren(img.root, defaultPaint())
+}
+
+// parseLength parses an SVG length in user units. Only unitless and px
+// values are supported; percentages report false.
+func parseLength(s string) (float64, bool) {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "px")
+	if s == "" {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+// parseNumbers splits a list of numbers separated by whitespace and/or
+// commas, as used by viewBox and points.
+func parseNumbers(s string) []float64 {
+	sc := &scanner{s: s}
+	var nums []float64
+	for {
+		v, ok := sc.number()
+		if !ok {
+			return nums
+		}
+		nums = append(nums, v)
+	}
+}
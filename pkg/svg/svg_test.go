@@ -0,0 +1,117 @@
+package svg
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestIsSVG(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{`<svg xmlns="http://www.w3.org/2000/svg"></svg>`, true},
+		{"<?xml version=\"1.0\"?>\n<!-- logo -->\n<!DOCTYPE svg>\n<SVG width=\"1\"/>", true},
+		{`<html><svg></svg></html>`, false},
+		{`<svgfoo>`, false},
+		{"\x89PNG\r\n", false},
+	}
+	for _, tt := range tests {
+		if got := IsSVG([]byte(tt.data)); got != tt.want {
+			t.Errorf("IsSVG(%q) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestIntrinsicSize(t *testing.T) {
+	tests := []struct {
+		svg           string
+		width, height float64
+	}{
+		{`<svg width="40" height="20px"/>`, 40, 20},
+		{`<svg width="40" viewBox="0 0 10 5"/>`, 40, 20},
+		{`<svg height="30" viewBox="0 0 10 5"/>`, 60, 30},
+		{`<svg viewBox="0 0 10 10"/>`, 300, 300},
+		{`<svg/>`, 300, 150},
+	}
+	for _, tt := range tests {
+		img, err := Parse([]byte(tt.svg))
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.svg, err)
+		}
+		if img.Width != tt.width || img.Height != tt.height {
+			t.Errorf("%s: size %vx%v, want %vx%v", tt.svg, img.Width, img.Height, tt.width, tt.height)
+		}
+	}
+}
+
+func TestParseRejectsNonSVG(t *testing.T) {
+	if _, err := Parse([]byte(`<html></html>`)); err == nil {
+		t.Error("expected an error for a document without an <svg> root")
+	}
+}
+
+func TestRasterizeShapes(t *testing.T) {
+	img, err := Parse([]byte(`<svg xmlns="http://www.w3.org/2000/svg" width="40" height="20" viewBox="0 0 20 10">
+		<rect width="10" height="10" fill="#ff0000"/>
+		<g transform="translate(10,0)" style="fill: blue">
+			<circle cx="5" cy="5" r="4"/>
+		</g>
+		<path d="M0 0 h2 v2 h-2 z" fill="none" stroke="lime"/>
+	</svg>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := img.Rasterize(40, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{10, 10, color.RGBA{255, 0, 0, 255}}, // Inside the rect, scaled 2x by the viewBox
+		{30, 10, color.RGBA{0, 0, 255, 255}}, // Circle center, after the group's translate
+		{21, 1, color.RGBA{0, 0, 0, 0}},      // Outside the circle
+	}
+	for _, tt := range tests {
+		r, g, b, a := out.At(tt.x, tt.y).RGBA()
+		got := color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}
+		if got != tt.want {
+			t.Errorf("pixel (%d,%d) = %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestRasterizeRejectsHugeSizes(t *testing.T) {
+	img, err := Parse([]byte(`<svg width="1e9" height="1e9"><rect width="10" height="10"/></svg>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ width, height int }{
+		{1e9, 1e9},
+		{40000, 1}, // Too wide, though the area is small
+		{5000, 5000},
+	}
+	for _, tt := range tests {
+		if out, err := img.Rasterize(tt.width, tt.height); err == nil {
+			t.Errorf("Rasterize(%d, %d) = %v, want an error", tt.width, tt.height, out.Bounds())
+		}
+	}
+	if _, err := img.Rasterize(4096, 4096); err != nil {
+		t.Errorf("Rasterize(4096, 4096): %v", err)
+	}
+}
+
+func TestParseNumbers(t *testing.T) {
+	got := parseNumbers("10-5.5.5,1e2 -3")
+	want := []float64{10, -5.5, .5, 100, -3}
+	if len(got) != len(want) {
+		t.Fatalf("parseNumbers = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("parseNumbers[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,464 @@
+package text
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+)
+
+// FontFetcher downloads font files (TTF, OTF, WOFF) referenced by
+// @font-face rules. It mirrors images.ImageFetcher.
+type FontFetcher func(ctx context.Context, uri string) ([]byte, error)
+
+// webFontKey identifies a registered face by family and style.
+type webFontKey struct {
+	family string // lowercased family name
+	bold   bool
+	italic bool
+}
+
+// parsedFont is a parsed font file, with what truetype.Font doesn't expose.
+type parsedFont struct {
+	*truetype.Font
+	data    []byte // The sfnt file, for documents that embed the font
+	lineGap int16  // The hhea line gap, in font units
+}
+
+// faceKey identifies a sized face in a face cache.
+type faceKey struct {
+	font *parsedFont
+	size float64
+}
+
+// sizedFace is a face of a parsed font at a size, as WebFontFace and
+// FileFontFace return them, so CopyFace and FaceSource can tell what it
+// is a face of.
+type sizedFace struct {
+	font.Face
+	font *parsedFont
+	size float64
+	mu   sync.Mutex // Serializes measuring with the face, which caches glyphs
+}
+
+// maxCachedFaces bounds a face cache: a page animating its font size
+// would otherwise make a face for every size it passes through.
+const maxCachedFaces = 256
+
+// faceCache holds sized faces of fonts, up to maxCachedFaces.
+type faceCache struct {
+	sync.Mutex
+	faces map[faceKey]*sizedFace
+}
+
+// face returns a face for f at the given size, creating it on first use.
+func (c *faceCache) face(f *parsedFont, size float64) *sizedFace {
+	key := faceKey{f, size}
+	c.Lock()
+	defer c.Unlock()
+	face, ok := c.faces[key]
+	if !ok {
+		if c.faces == nil || len(c.faces) >= maxCachedFaces {
+			// Starting over keeps the faces in use, which are made again
+			c.faces = make(map[faceKey]*sizedFace)
+		}
+		face = &sizedFace{Face: truetype.NewFace(f.Font, faceOptions(size)), font: f, size: size}
+		c.faces[key] = face
+	}
+	return face
+}
+
+// FontSet holds the fonts a document's @font-face rules load, under the
+// family names and styles the rules give them. Each document has its own,
+// so one document's fonts never stand in for another's, and they are
+// freed with the document. A nil *FontSet has no fonts. A FontSet is safe
+// for concurrent use.
+type FontSet struct {
+	mu    sync.RWMutex
+	fonts map[webFontKey]*parsedFont
+	faces faceCache // Sized faces of the fonts
+}
+
+// NewFontSet creates an empty FontSet.
+func NewFontSet() *FontSet {
+	return &FontSet{fonts: make(map[webFontKey]*parsedFont)}
+}
+
+// Register parses a TTF, OTF (TrueType outlines), or WOFF file and makes
+// it available under the given family name and style.
+func (fs *FontSet) Register(family string, bold, italic bool, data []byte) error {
+	if bytes.HasPrefix(data, []byte("wOF2")) {
+		return errors.New("WOFF2 fonts are not supported")
+	}
+	if bytes.HasPrefix(data, []byte("wOFF")) {
+		sfnt, err := decodeWOFF(data)
+		if err != nil {
+			return fmt.Errorf("decoding WOFF: %w", err)
+		}
+		data = sfnt
+	}
+	f, err := parseFont(data)
+	if err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.fonts[webFontKey{strings.ToLower(family), bold, italic}] = f
+	return nil
+}
+
+// Has returns true if a font was registered for the family in any style.
+func (fs *FontSet) Has(family string) bool {
+	if fs == nil {
+		return false
+	}
+	family = strings.ToLower(family)
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	for key := range fs.fonts {
+		if key.family == family {
+			return true
+		}
+	}
+	return false
+}
+
+// Clear removes all registered fonts and their faces.
+func (fs *FontSet) Clear() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.fonts = make(map[webFontKey]*parsedFont)
+	fs.faces.Lock()
+	fs.faces.faces = nil
+	fs.faces.Unlock()
+}
+
+// lookup returns the first registered font matching one of the families.
+// Within a family the exact style is preferred, then the closest available
+// one (the regular face, then any other).
+func (fs *FontSet) lookup(families []string, bold, italic bool) *parsedFont {
+	if fs == nil {
+		return nil
+	}
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	if len(fs.fonts) == 0 {
+		return nil
+	}
+	for _, family := range families {
+		family = strings.ToLower(family)
+		for _, key := range []webFontKey{
+			{family, bold, italic},
+			{family, bold, false},
+			{family, false, italic},
+			{family, false, false},
+			{family, true, true},
+			{family, true, false},
+			{family, false, true},
+		} {
+			if f, ok := fs.fonts[key]; ok {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// WebFontFace returns a face for the first family in families that has a
+// font in fonts, at the given size, or nil if none of them has.
+func WebFontFace(fonts *FontSet, families []string, fontSize float64, bold, italic bool) font.Face {
+	f := fonts.lookup(families, bold, italic)
+	if f == nil {
+		return nil
+	}
+	return fonts.faces.face(f, fontSize)
+}
+
+// faceOptions returns the rasterizer settings of a face at the given size.
+// They are spelled out rather than left to the freetype package's
+// defaults, so glyphs rasterize the same after a dependency upgrade.
+func faceOptions(size float64) *truetype.Options {
+	return &truetype.Options{Size: size, DPI: 72, Hinting: font.HintingNone, SubPixelsX: 4, SubPixelsY: 1}
+}
+
+// CopyFace returns a face like face for use on another goroutine. Faces
+// from WebFontFace and FileFontFace cache glyphs, so they aren't safe for
+// concurrent use; other faces are returned as is.
+func CopyFace(face font.Face) font.Face {
+	if f, ok := face.(*sizedFace); ok {
+		return &sizedFace{Face: truetype.NewFace(f.font.Font, faceOptions(f.size)), font: f.font, size: f.size}
+	}
+	return face
+}
+
+// fontFiles caches parsed font files by path.
+var fontFiles = struct {
+	sync.Mutex
+	fonts map[string]*parsedFont
+}{
+	fonts: make(map[string]*parsedFont),
+}
+
+// fileFaces holds sized faces of font files.
+var fileFaces faceCache
+
+// FileFontFace returns a face for the font file at path, or nil if the file
+// cannot be loaded.
+func FileFontFace(path string, fontSize float64) font.Face {
+	f := fileFont(path)
+	if f == nil {
+		return nil
+	}
+	return fileFaces.face(f, fontSize)
+}
+
+// fileFont returns the font in the file at path, or nil if the file cannot
+// be loaded. Files are read and parsed once.
+func fileFont(path string) *parsedFont {
+	fontFiles.Lock()
+	defer fontFiles.Unlock()
+	f, ok := fontFiles.fonts[path]
+	if !ok {
+		if data, err := os.ReadFile(path); err == nil {
+			f, _ = parseFont(data)
+		}
+		fontFiles.fonts[path] = f // nil records a failed load
+	}
+	return f
+}
+
+// parseFont parses a TTF or OTF file.
+func parseFont(data []byte) (*parsedFont, error) {
+	f, err := truetype.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return &parsedFont{Font: f, data: data, lineGap: hheaLineGap(data)}, nil
+}
+
+// FaceSource returns the font file data and size of a face from
+// WebFontFace or FileFontFace, so documents such as PDF can embed the
+// font. ok is false for faces created elsewhere.
+func FaceSource(face font.Face) (data []byte, size float64, ok bool) {
+	f, ok := face.(*sizedFace)
+	if !ok {
+		return nil, 0, false
+	}
+	return f.font.data, f.size, true
+}
+
+// hheaLineGap returns the lineGap field of an sfnt's hhea table, or 0 if
+// the table is missing. See the OpenType spec, "hhea — Horizontal Header".
+func hheaLineGap(data []byte) int16 {
+	const dirSize, entrySize = 12, 16
+	if len(data) < dirSize {
+		return 0
+	}
+	be := binary.BigEndian
+	numTables := int(be.Uint16(data[4:]))
+	for i := 0; i < numTables; i++ {
+		entry := dirSize + i*entrySize
+		if len(data) < entry+entrySize {
+			return 0
+		}
+		if string(data[entry:entry+4]) != "hhea" {
+			continue
+		}
+		offset := int(be.Uint32(data[entry+8:]))
+		if len(data) < offset+10 {
+			return 0
+		}
+		return int16(be.Uint16(data[offset+8:]))
+	}
+	return 0
+}
+
+// measureWithFace measures text with a loaded face. Height matches gg's
+// LoadFontFace convention (points * 72 / 96).
+func measureWithFace(text string, fontSize float64, face font.Face) (width, height float64) {
+	if f, ok := face.(*sizedFace); ok {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	}
+	d := &font.Drawer{Face: face}
+	return float64(d.MeasureString(text) >> 6), fontSize * 72 / 96
+}
+
+// MeasureTextWithFamilies measures text in the first font of the family
+// stack that is available: a web font in fonts, a registry family, or a
+// generic family. With an empty stack the style flags select the font.
+func MeasureTextWithFamilies(fonts *FontSet, text string, fontSize float64, families []string, bold, italic, mono, ahem bool) (width, height float64) {
+	if face := WebFontFace(fonts, families, fontSize, bold, italic); face != nil {
+		return measureWithFace(text, fontSize, face)
+	}
+	if len(families) == 0 {
+		return MeasureTextWithStyle(text, fontSize, bold, italic, mono, ahem)
+	}
+	return MeasureTextInFamily(text, fontSize, DefaultRegistry().Resolve(families), bold, italic)
+}
+
+// GlyphOffsets returns the horizontal offset of each character boundary
+// in text, as MeasureTextWithFamilies measures it: offsets[i] is the width
+// of the text before the i'th rune, and the last offset is the width of
+// the whole text. Hit testing a point against a line of text finds the
+// boundary nearest it.
+func GlyphOffsets(fonts *FontSet, text string, fontSize float64, families []string, bold, italic, mono, ahem bool) []float64 {
+	offsets := make([]float64, 1, len(text)+1)
+	for i := range text {
+		if i > 0 {
+			w, _ := MeasureTextWithFamilies(fonts, text[:i], fontSize, families, bold, italic, mono, ahem)
+			offsets = append(offsets, w)
+		}
+	}
+	if text != "" {
+		w, _ := MeasureTextWithFamilies(fonts, text, fontSize, families, bold, italic, mono, ahem)
+		offsets = append(offsets, w)
+	}
+	return offsets
+}
+
+// FontMetrics holds the vertical metrics of a font at a given size, in
+// pixels. Ascent and Descent are both positive distances from the baseline.
+type FontMetrics struct {
+	Ascent  float64 // Height of the font above the baseline
+	Descent float64 // Depth of the font below the baseline
+	LineGap float64 // Extra spacing the font recommends between lines
+}
+
+// NormalLineHeight returns the spacing between lines the font recommends,
+// used for line-height: normal.
+func (m FontMetrics) NormalLineHeight() float64 {
+	return m.Ascent + m.Descent + m.LineGap
+}
+
+// MetricsWithFamilies returns the vertical metrics of the font that
+// MeasureTextWithFamilies measures with. If no font can be loaded, the
+// ascent, descent, and line gap are approximated as 0.8em, 0.2em, and 0.2em.
+func MetricsWithFamilies(fonts *FontSet, fontSize float64, families []string, bold, italic, mono, ahem bool) FontMetrics {
+	var face *sizedFace
+	if f := fonts.lookup(families, bold, italic); f != nil {
+		face = fonts.faces.face(f, fontSize)
+	} else {
+		family := DefaultRegistry().ResolveStyle(mono, ahem)
+		if len(families) > 0 {
+			family = DefaultRegistry().Resolve(families)
+		}
+		if f := fileFont(family.Path(bold, italic)); f != nil {
+			face = fileFaces.face(f, fontSize)
+		}
+	}
+	if face == nil {
+		return FontMetrics{Ascent: fontSize * 0.8, Descent: fontSize * 0.2, LineGap: fontSize * 0.2}
+	}
+	face.mu.Lock()
+	defer face.mu.Unlock()
+	m := face.Metrics()
+	return FontMetrics{
+		Ascent:  float64(m.Ascent) / 64,
+		Descent: float64(m.Descent) / 64,
+		LineGap: float64(face.font.lineGap) * fontSize / float64(face.font.FUnitsPerEm()),
+	}
+}
+
+// maxSfntSize is the largest font file a WOFF file may decode to. The
+// largest CJK fonts are around 20MB.
+const maxSfntSize = 64 << 20
+
+// decodeWOFF converts a WOFF 1.0 file to the sfnt (TTF/OTF) it wraps.
+// See https://www.w3.org/TR/WOFF/ §4–5.
+// The sfnt a WOFF file decodes to may be no larger than maxSfntSize.
+func decodeWOFF(data []byte) ([]byte, error) {
+	const headerSize, entrySize = 44, 20
+	if len(data) < headerSize {
+		return nil, errors.New("truncated header")
+	}
+	be := binary.BigEndian
+	flavor := be.Uint32(data[4:])
+	numTables := int(be.Uint16(data[12:]))
+	if len(data) < headerSize+numTables*entrySize {
+		return nil, errors.New("truncated table directory")
+	}
+	// The tables decompress to at most the sfnt size the header gives,
+	// which is checked before anything is decompressed
+	totalSfntSize := uint64(be.Uint32(data[16:]))
+	if totalSfntSize > maxSfntSize {
+		return nil, fmt.Errorf("font of %d bytes is too large", totalSfntSize)
+	}
+	sfntSize := uint64(12 + 16*numTables)
+	for i := 0; i < numTables; i++ {
+		sfntSize += (uint64(be.Uint32(data[headerSize+i*entrySize+12:])) + 3) &^ 3
+	}
+	if sfntSize > totalSfntSize {
+		return nil, errors.New("tables larger than the font")
+	}
+
+	type table struct {
+		tag, checksum uint32
+		data          []byte
+	}
+	tables := make([]table, numTables)
+	for i := range tables {
+		e := data[headerSize+i*entrySize:]
+		offset, compLen, origLen := be.Uint32(e[4:]), be.Uint32(e[8:]), be.Uint32(e[12:])
+		if uint64(offset)+uint64(compLen) > uint64(len(data)) {
+			return nil, errors.New("table extends past end of file")
+		}
+		if compLen > origLen {
+			return nil, errors.New("table larger compressed than decompressed")
+		}
+		raw := data[offset : offset+compLen]
+		if compLen < origLen {
+			zr, err := zlib.NewReader(bytes.NewReader(raw))
+			if err != nil {
+				return nil, err
+			}
+			raw, err = io.ReadAll(io.LimitReader(zr, int64(origLen)+1))
+			zr.Close()
+			if err != nil {
+				return nil, err
+			}
+			if len(raw) != int(origLen) {
+				return nil, errors.New("table decompresses to the wrong size")
+			}
+		}
+		tables[i] = table{tag: be.Uint32(e), checksum: be.Uint32(e[16:]), data: raw}
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].tag < tables[j].tag })
+
+	// sfnt offset table followed by the table records.
+	entrySelector := bits.Len(uint(numTables)) - 1
+	if entrySelector < 0 {
+		entrySelector = 0
+	}
+	searchRange := (1 << entrySelector) * 16
+	out := make([]byte, 12+16*numTables)
+	be.PutUint32(out, flavor)
+	be.PutUint16(out[4:], uint16(numTables))
+	be.PutUint16(out[6:], uint16(searchRange))
+	be.PutUint16(out[8:], uint16(entrySelector))
+	be.PutUint16(out[10:], uint16(numTables*16-searchRange))
+
+	for i, t := range tables {
+		rec := out[12+16*i:]
+		be.PutUint32(rec, t.tag)
+		be.PutUint32(rec[4:], t.checksum)
+		be.PutUint32(rec[8:], uint32(len(out)))
+		be.PutUint32(rec[12:], uint32(len(t.data)))
+		out = append(out, t.data...)
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,193 @@
+package text
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/image/font"
+)
+
+// ahemFont returns the bundled Ahem font file.
+func ahemFont(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile(DefaultFontConfig().Ahem)
+	if err != nil {
+		t.Skipf("Ahem not available: %v", err)
+	}
+	return data
+}
+
+// encodeWOFF wraps an sfnt in a WOFF file, compressing every table.
+// totalSfntSize overrides the header's sfnt size if not 0.
+func encodeWOFF(t *testing.T, sfnt []byte, totalSfntSize uint32) []byte {
+	t.Helper()
+	be := binary.BigEndian
+	numTables := int(be.Uint16(sfnt[4:]))
+	if totalSfntSize == 0 {
+		totalSfntSize = uint32(12 + 16*numTables)
+		for i := 0; i < numTables; i++ {
+			totalSfntSize += (be.Uint32(sfnt[12+16*i+12:]) + 3) &^ 3
+		}
+	}
+	header := make([]byte, 44+20*numTables)
+	copy(header, "wOFF")
+	copy(header[4:], sfnt[:4])
+	be.PutUint16(header[12:], uint16(numTables))
+	be.PutUint32(header[16:], totalSfntSize)
+	var body bytes.Buffer
+	for i := 0; i < numTables; i++ {
+		rec := sfnt[12+16*i:]
+		offset, length := be.Uint32(rec[8:]), be.Uint32(rec[12:])
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write(sfnt[offset : offset+length])
+		zw.Close()
+		comp := z.Bytes()
+		if len(comp) >= int(length) {
+			comp = sfnt[offset : offset+length]
+		}
+		e := header[44+20*i:]
+		copy(e, rec[:4])
+		be.PutUint32(e[4:], uint32(len(header)+body.Len()))
+		be.PutUint32(e[8:], uint32(len(comp)))
+		be.PutUint32(e[12:], length)
+		be.PutUint32(e[16:], be.Uint32(rec[4:]))
+		body.Write(comp)
+		for body.Len()%4 != 0 {
+			body.WriteByte(0)
+		}
+	}
+	return append(header, body.Bytes()...)
+}
+
+func TestFontSet_RegistersWOFF(t *testing.T) {
+	fonts := NewFontSet()
+	if err := fonts.Register("Web", false, false, encodeWOFF(t, ahemFont(t), 0)); err != nil {
+		t.Fatal(err)
+	}
+	// Every Ahem glyph is a 1em square
+	if w, _ := MeasureTextWithFamilies(fonts, "XXXX", 20, []string{"web"}, false, false, false, false); w != 80 {
+		t.Errorf("expected the WOFF font measured, got width %g", w)
+	}
+}
+
+func TestDecodeWOFF_RejectsOversizedTables(t *testing.T) {
+	sfnt := ahemFont(t)
+	tests := []struct {
+		name, want string
+		woff       []byte
+	}{
+		{"over the limit", "too large", encodeWOFF(t, sfnt, maxSfntSize+1)},
+		{"over the sfnt size", "larger than the font", encodeWOFF(t, sfnt, 64)},
+	}
+	for _, tt := range tests {
+		_, err := decodeWOFF(tt.woff)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	// A table claiming to decompress to more than it does
+	woff := encodeWOFF(t, sfnt, 0)
+	be := binary.BigEndian
+	for i := 0; i < int(be.Uint16(woff[12:])); i++ {
+		e := woff[44+20*i:]
+		if be.Uint32(e[8:]) < be.Uint32(e[12:]) {
+			be.PutUint32(e[12:], be.Uint32(e[12:])+4)
+			be.PutUint32(woff[16:], be.Uint32(woff[16:])+4)
+			break
+		}
+	}
+	if _, err := decodeWOFF(woff); err == nil {
+		t.Error("expected a table of the wrong size to be rejected")
+	}
+}
+
+func TestFontSet_ScopesFamilies(t *testing.T) {
+	a, b := NewFontSet(), NewFontSet()
+	if err := a.Register("Web", false, false, ahemFont(t)); err != nil {
+		t.Fatal(err)
+	}
+	if !a.Has("WEB") || b.Has("web") {
+		t.Error("expected the family registered in one set only")
+	}
+	if WebFontFace(a, []string{"Web"}, 16, true, false) == nil {
+		t.Error("expected another style of the family to stand in")
+	}
+	if WebFontFace(b, []string{"Web"}, 16, false, false) != nil || WebFontFace(nil, []string{"Web"}, 16, false, false) != nil {
+		t.Error("expected no face from a set without the family")
+	}
+
+	face := WebFontFace(a, []string{"Web"}, 16, false, false)
+	a.Clear()
+	if a.Has("Web") || WebFontFace(a, []string{"Web"}, 16, false, false) != nil {
+		t.Error("expected Clear to remove the fonts")
+	}
+	if a.Register("Web", false, false, ahemFont(t)) != nil || WebFontFace(a, []string{"Web"}, 16, false, false) == face {
+		t.Error("expected Clear to drop the cached faces")
+	}
+}
+
+func TestFaceCache_Bounded(t *testing.T) {
+	fonts := NewFontSet()
+	if err := fonts.Register("Web", false, false, ahemFont(t)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3*maxCachedFaces; i++ {
+		WebFontFace(fonts, []string{"Web"}, 1+float64(i)/8, false, false)
+	}
+	if n := len(fonts.faces.faces); n > maxCachedFaces {
+		t.Errorf("expected at most %d cached faces, got %d", maxCachedFaces, n)
+	}
+}
+
+func TestFaceSourceAndCopyFace(t *testing.T) {
+	sfnt := ahemFont(t)
+	fonts := NewFontSet()
+	if err := fonts.Register("Web", false, false, sfnt); err != nil {
+		t.Fatal(err)
+	}
+	face := WebFontFace(fonts, []string{"Web"}, 12, false, false)
+	data, size, ok := FaceSource(face)
+	if !ok || size != 12 || !bytes.Equal(data, sfnt) {
+		t.Errorf("expected the font's file and size, got %d bytes at %g, %v", len(data), size, ok)
+	}
+	c := CopyFace(face)
+	if c == face {
+		t.Error("expected a copy of the face")
+	}
+	if _, size, ok := FaceSource(c); !ok || size != 12 {
+		t.Error("expected the copy's source to be the font's")
+	}
+}
+
+func TestMeasure_Concurrent(t *testing.T) {
+	fonts := NewFontSet()
+	if err := fonts.Register("Web", false, false, ahemFont(t)); err != nil {
+		t.Fatal(err)
+	}
+	// Goroutines share faces, each measuring with one the others use
+	faces := []font.Face{
+		WebFontFace(fonts, []string{"Web"}, 10, false, false),
+		WebFontFace(fonts, []string{"Web"}, 20, false, false),
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(size float64, face font.Face) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if w, _ := measureWithFace("xxxx", size, face); w != 4*size {
+					t.Errorf("at %gpx: width %g", size, w)
+					return
+				}
+			}
+		}(float64(10+10*(i%2)), faces[i%2])
+	}
+	wg.Wait()
+}
@@ -0,0 +1,194 @@
+package text
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Line breaking (UAX #14). Characters are sorted into a reduced set of line
+// breaking classes, enough to wrap Latin text at spaces and hyphens, keep
+// no-break spaces and punctuation attached, and break CJK text between
+// ideographs.
+
+// breakClass is a UAX #14 line breaking class.
+type breakClass int
+
+const (
+	breakAL breakClass = iota // Alphabetic and other ordinary characters
+	breakNU                   // Numeric
+	breakSP                   // Space
+	breakGL                   // Non-breaking glue (NBSP, word joiner)
+	breakZW                   // Zero width space
+	breakBA                   // Break after (soft hyphen, dashes)
+	breakHY                   // Hyphen-minus
+	breakCL                   // Closing punctuation, exclamation, infix separators
+	breakOP                   // Opening punctuation
+	breakNS                   // Nonstarters (small kana, prolonged sound mark)
+	breakID                   // Ideographic
+	breakCM                   // Combining marks
+)
+
+const (
+	softHyphen     = '\u00AD'
+	zeroWidthSpace = '\u200B'
+)
+
+// lineBreakClass returns the line breaking class of r.
+func lineBreakClass(r rune) breakClass {
+	switch r {
+	case ' ', '\t', '\n', '\r', '\f':
+		return breakSP
+	case '\u00A0', '\u2007', '\u2011', '\u202F', '\u2060', '\uFEFF':
+		return breakGL
+	case zeroWidthSpace:
+		return breakZW
+	case '-':
+		return breakHY
+	case softHyphen, '\u058A', '\u2010', '\u2012', '\u2013', '\u2014', '\u3000':
+		return breakBA
+	case ')', ']', '}', '!', '?', ',', '.', ':', ';', '…',
+		'、', '。', '〉', '》', '」', '』', '】',
+		'〕', '〗', '〙', '〛', '〞', '〟',
+		'！', '）', '，', '．', '：', '；', '？',
+		'］', '｝', '｠', '｣':
+		return breakCL
+	case '(', '[', '{',
+		'〈', '《', '「', '『', '【', '〔', '〖',
+		'〘', '〚', '〝', '（', '［', '｛', '｟', '｢':
+		return breakOP
+	case '々', '〻', '゛', '゜', 'ゝ', 'ゞ',
+		'・', 'ー', 'ヽ', 'ヾ',
+		// Small hiragana and katakana
+		'ぁ', 'ぃ', 'ぅ', 'ぇ', 'ぉ', 'っ', 'ゃ',
+		'ゅ', 'ょ', 'ゎ', 'ゕ', 'ゖ',
+		'ァ', 'ィ', 'ゥ', 'ェ', 'ォ', 'ッ', 'ャ',
+		'ュ', 'ョ', 'ヮ', 'ヵ', 'ヶ':
+		return breakNS
+	}
+	switch {
+	case r >= '0' && r <= '9':
+		return breakNU
+	case unicode.In(r, unicode.Mn, unicode.Me):
+		return breakCM
+	case r >= 0x31F0 && r <= 0x31FF, r >= 0xFF67 && r <= 0xFF70:
+		return breakNS // Small katakana extensions and halfwidth forms
+	case r >= 0x2E80 && r <= 0x2FFF, // CJK radicals, Kangxi, description characters
+		r >= 0x3000 && r <= 0x33FF,   // CJK symbols, kana, bopomofo, compatibility
+		r >= 0x3400 && r <= 0x4DBF,   // CJK Extension A
+		r >= 0x4E00 && r <= 0x9FFF,   // CJK Unified Ideographs
+		r >= 0xA000 && r <= 0xA4CF,   // Yi
+		r >= 0xAC00 && r <= 0xD7AF,   // Hangul syllables
+		r >= 0xF900 && r <= 0xFAFF,   // CJK compatibility ideographs
+		r >= 0xFE30 && r <= 0xFE4F,   // CJK compatibility forms
+		r >= 0xFF01 && r <= 0xFF5A,   // Fullwidth forms
+		r >= 0x1F000 && r <= 0x1FAFF, // Emoji and pictographs
+		r >= 0x20000 && r <= 0x3FFFD: // Supplementary ideographic planes
+		return breakID
+	}
+	return breakAL
+}
+
+// lineBreakAllowed returns true if a line may break between a character of
+// class before and one of class after, with or without spaces between them.
+func lineBreakAllowed(before, after breakClass, spaces bool) bool {
+	switch {
+	case before == breakZW:
+		return true // LB8: ZW SP* ÷
+	case after == breakZW, after == breakCL:
+		return false // LB7, LB13: × ZW, × CL
+	case before == breakOP:
+		return false // LB14: OP SP* ×
+	case spaces:
+		return true // LB18: SP ÷
+	case before == breakGL, after == breakGL:
+		return false // LB12, LB12a
+	case after == breakNS, after == breakBA, after == breakHY:
+		return false // LB16, LB21: × NS, × BA, × HY
+	case before == breakHY && after == breakNU:
+		return false // LB25: HY × NU
+	case before == breakBA, before == breakHY:
+		return true // LB21: BA ÷, HY ÷
+	case before == breakID, after == breakID:
+		return true // LB31: ideographs break on either side
+	}
+	return false // LB23, LB28: letters and digits stay together
+}
+
+// SplitAtLineBreaks splits text at its line break opportunities. Each
+// segment keeps its trailing spaces, so the segments concatenate back to
+// text; leading spaces stay with the first segment.
+func SplitAtLineBreaks(text string) []string {
+	var segments []string
+	start := 0
+	prev := breakClass(-1) // Class of the last non-space character
+	spaces := false
+	for i, r := range text {
+		c := lineBreakClass(r)
+		if c == breakSP {
+			spaces = prev >= 0
+			continue
+		}
+		if c == breakCM {
+			if prev >= 0 && !spaces {
+				continue // LB9: Combining marks take the class of their base
+			}
+			c = breakAL // LB10
+		}
+		if prev >= 0 && lineBreakAllowed(prev, c, spaces) {
+			segments = append(segments, text[start:i])
+			start = i
+		}
+		prev, spaces = c, false
+	}
+	if start < len(text) {
+		segments = append(segments, text[start:])
+	}
+	return segments
+}
+
+// displayLine returns a line of text as drawn: trailing spaces are removed,
+// and soft hyphens and zero width spaces are invisible except for a soft
+// hyphen where the line broke, which shows as a hyphen.
+func displayLine(line string, broken bool) string {
+	line = strings.TrimRight(line, " \t\n\r\f")
+	hyphenate := broken && strings.HasSuffix(line, string(softHyphen))
+	line = strings.Map(func(r rune) rune {
+		if r == softHyphen || r == zeroWidthSpace {
+			return -1
+		}
+		return r
+	}, line)
+	if hyphenate {
+		line += "-"
+	}
+	return line
+}
+
+// WrapMode selects whether lines may break within words, beyond the break
+// opportunities of SplitAtLineBreaks.
+type WrapMode int
+
+const (
+	WrapNormal    WrapMode = iota // Lines break only at break opportunities; long words overflow
+	WrapBreakWord                 // A word too long for a line of its own breaks where the line fills (overflow-wrap: break-word)
+	WrapBreakAll                  // Lines break between any two letters (word-break: break-all)
+)
+
+// splitLetters splits segments between letters, for word-break: break-all.
+// Spaces stay with the letter before them and combining marks with their
+// base, so the pieces still concatenate back to the text.
+func splitLetters(segments []string) []string {
+	var letters []string
+	for _, segment := range segments {
+		start := 0
+		for i, r := range segment {
+			if i == start || lineBreakClass(r) == breakSP || unicode.Is(unicode.Mn, r) {
+				continue
+			}
+			letters = append(letters, segment[start:i])
+			start = i
+		}
+		letters = append(letters, segment[start:])
+	}
+	return letters
+}
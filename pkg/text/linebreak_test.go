@@ -0,0 +1,99 @@
+package text
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitAtLineBreaks(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"spaces", "hello big world", []string{"hello ", "big ", "world"}},
+		{"leading spaces", "  a b", []string{"  a ", "b"}},
+		{"trailing spaces", "a b  ", []string{"a ", "b  "}},
+		{"empty", "", nil},
+
+		// Hyphens break after, but not before a number (LB21, LB25)
+		{"hyphen", "well-known", []string{"well-", "known"}},
+		{"hyphen before number", "x-5", []string{"x-5"}},
+		{"minus after space", "a -5", []string{"a ", "-5"}},
+		{"soft hyphen", "co\u00ADop", []string{"co\u00AD", "op"}},
+		{"em dash", "a\u2014b", []string{"a\u2014", "b"}},
+		{"non-breaking hyphen", "a\u2011b", []string{"a\u2011b"}},
+
+		// Glue and zero width space (LB7, LB8, LB12)
+		{"nbsp", "10\u00A0km away", []string{"10\u00A0km ", "away"}},
+		{"narrow nbsp", "1\u202F000", []string{"1\u202F000"}},
+		{"word joiner", "a\u2060b", []string{"a\u2060b"}},
+		{"zero width space", "a\u200Bb", []string{"a\u200B", "b"}},
+
+		// Punctuation stays with its word, even across spaces (LB13, LB14)
+		{"closing", "(see) this", []string{"(see) ", "this"}},
+		{"space before closing", "wait !", []string{"wait !"}},
+		{"space after opening", "( a", []string{"( a"}},
+		{"quotes", `"hello" world`, []string{`"hello" `, "world"}},
+
+		// Numbers and their prefixes and separators stay together (LB23, LB25)
+		{"separators", "1,000.5 m", []string{"1,000.5 ", "m"}},
+		{"prefix", "$100 each", []string{"$100 ", "each"}},
+		{"letters and digits", "abc123", []string{"abc123"}},
+
+		// Ideographs break on either side (LB31), except before closing
+		// punctuation and nonstarters or after opening punctuation
+		{"ideographs", "日本語", []string{"日", "本", "語"}},
+		{"ideographic full stop", "日本。", []string{"日", "本。"}},
+		{"fullwidth exclamation", "日本！", []string{"日", "本！"}},
+		{"corner brackets", "「日本」", []string{"「日", "本」"}},
+		{"small kana", "チョコ", []string{"チョ", "コ"}},
+		{"prolonged sound mark", "ラーメン", []string{"ラー", "メ", "ン"}},
+		{"hangul", "한국어", []string{"한", "국", "어"}},
+		{"ideographs and letters", "日本abc", []string{"日", "本", "abc"}},
+		{"ideographic space", "日\u3000本", []string{"日\u3000", "本"}},
+
+		// Combining marks take the class of their base (LB9, LB10)
+		{"combining mark", "e\u0301 b", []string{"e\u0301 ", "b"}},
+		{"mark after ideograph", "日\u0301本", []string{"日\u0301", "本"}},
+		{"mark after space", "a \u0301b", []string{"a ", "\u0301b"}},
+	}
+	for _, tt := range tests {
+		got := SplitAtLineBreaks(tt.text)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: SplitAtLineBreaks(%q) = %q, want %q", tt.name, tt.text, got, tt.want)
+		}
+		if joined := strings.Join(got, ""); joined != tt.text {
+			t.Errorf("%s: segments join to %q, want %q", tt.name, joined, tt.text)
+		}
+	}
+}
+
+func TestDisplayLine(t *testing.T) {
+	tests := []struct {
+		line   string
+		broken bool
+		want   string
+	}{
+		{"hello  ", false, "hello"},
+		{"co\u00AD", true, "co-"},
+		{"co\u00AD", false, "co"},
+		{"co\u00ADop", true, "coop"},
+		{"a\u200B", true, "a"},
+		{"well-", true, "well-"},
+	}
+	for _, tt := range tests {
+		if got := displayLine(tt.line, tt.broken); got != tt.want {
+			t.Errorf("displayLine(%q, %v) = %q, want %q", tt.line, tt.broken, got, tt.want)
+		}
+	}
+}
+
+func TestSplitLetters(t *testing.T) {
+	got := splitLetters(SplitAtLineBreaks("ab e\u0301f"))
+	want := []string{"a", "b ", "e\u0301", "f"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("splitLetters = %q, want %q", got, want)
+	}
+}
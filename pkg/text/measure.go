@@ -4,8 +4,10 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"unicode/utf8"
 
-	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
 )
 
 // FontConfig holds paths to font files used for text measurement and rendering.
@@ -84,20 +86,24 @@ var BoldFontPath = DefaultFontConfig().Bold
 
 // MeasureText measures the width and height of text with the given font size
 func MeasureText(text string, fontSize float64, fontPath string) (width, height float64) {
-	// Use a temporary context for measurement
-	dc := gg.NewContext(1000, 1000)
-
-	// Load the font
-	if err := dc.LoadFontFace(fontPath, fontSize); err != nil {
+	face := FileFontFace(fontPath, fontSize)
+	if face == nil {
 		// If font loading fails, return rough estimate
 		return float64(len(text)) * fontSize * 0.6, fontSize * 1.2
 	}
+	return measureWithFace(text, fontSize, face)
+}
 
-	// Measure the text
-	w, h := dc.MeasureString(text)
-
-	// Add some padding to height for proper baseline alignment
-	return w, h
+// MeasureTextInFamily measures text in a resolved family. If the family's
+// font file cannot be loaded, the family's fallback metrics are used, so
+// monospace and proportional text still measure differently.
+func MeasureTextInFamily(text string, fontSize float64, family *FontFamily, bold, italic bool) (width, height float64) {
+	face := FileFontFace(family.Path(bold, italic), fontSize)
+	if face == nil {
+		m := family.Metrics
+		return float64(utf8.RuneCountInString(text)) * fontSize * m.AvgCharWidth, fontSize * m.LineHeight
+	}
+	return measureWithFace(text, fontSize, face)
 }
 
 // MeasureTextDefault measures text using the default font
@@ -117,90 +123,91 @@ func MeasureTextWithWeight(text string, fontSize float64, bold bool) (width, hei
 // MeasureTextWithStyle measures text using the specified font style (bold, italic, mono, ahem).
 // This is the comprehensive text measurement function that respects all font-family properties.
 func MeasureTextWithStyle(text string, fontSize float64, bold, italic, mono, ahem bool) (width, height float64) {
-	fontConfig := DefaultFontConfig()
-	fontPath := fontConfig.FontPath(bold, italic, mono, ahem)
-	return MeasureText(text, fontSize, fontPath)
+	family := DefaultRegistry().ResolveStyle(mono, ahem)
+	return MeasureTextInFamily(text, fontSize, family, bold, italic)
 }
 
 // Phase 6 Enhancement: BreakTextIntoLines breaks text into lines that fit within maxWidth
 func BreakTextIntoLines(text string, fontSize float64, bold bool, maxWidth float64) []string {
-	return BreakTextIntoLinesWithWrap(text, fontSize, bold, maxWidth, maxWidth)
+	return BreakTextIntoLinesWithWrap(text, fontSize, bold, maxWidth, maxWidth, WrapNormal)
 }
 
 // BreakTextIntoLinesWithWrap breaks text into lines where the first line fits
 // within firstLineMax and subsequent lines fit within remainingMax.
 // This handles the case where text starts partway through a line (e.g., after
 // an inline element) but subsequent lines use the full container width.
-func BreakTextIntoLinesWithWrap(text string, fontSize float64, bold bool, firstLineMax, remainingMax float64) []string {
+// wrap selects whether words may be split to fit.
+func BreakTextIntoLinesWithWrap(text string, fontSize float64, bold bool, firstLineMax, remainingMax float64, wrap WrapMode) []string {
 	fontPath := DefaultFontPath
 	if bold {
 		fontPath = BoldFontPath
 	}
+	return breakLines(text, fontSize, FileFontFace(fontPath, fontSize), firstLineMax, remainingMax, wrap)
+}
 
-	// Use a temporary context for measurement
-	dc := gg.NewContext(1000, 1000)
-	if err := dc.LoadFontFace(fontPath, fontSize); err != nil {
-		// If font loading fails, return text as single line
+// breakLines breaks text into lines measured with face. If the font could
+// not be loaded (face is nil) the text is returned as a single line.
+func breakLines(text string, fontSize float64, face font.Face, firstLineMax, remainingMax float64, wrap WrapMode) []string {
+	if face == nil {
 		return []string{text}
 	}
 
 	// Check if text fits on first line
-	textWidth, _ := dc.MeasureString(text)
+	textWidth, _ := measureWithFace(text, fontSize, face)
 	if textWidth <= firstLineMax {
 		return []string{text}
 	}
 
-	// Preserve leading whitespace — important for inline flow where
-	// a text node like " more text" follows an inline element.
-	leadingSpace := ""
-	if len(text) > 0 && (text[0] == ' ' || text[0] == '\t' || text[0] == '\n') {
-		leadingSpace = " "
-	}
-
-	// Split into words
-	words := splitIntoWords(text)
-	if len(words) == 0 {
+	// Collapse whitespace runs to single spaces. A leading space is kept —
+	// important for inline flow where a text node like " more text" follows
+	// an inline element.
+	segments := SplitAtLineBreaks(strings.Join(strings.FieldsFunc(text, isCollapsibleSpace), " "))
+	if len(segments) == 0 {
 		return []string{text}
 	}
+	if isCollapsibleSpace(rune(text[0])) {
+		segments[0] = " " + segments[0]
+	}
+	if wrap == WrapBreakAll {
+		segments = splitLetters(segments)
+	}
 
-	// Build lines
+	// Build lines, breaking before the first segment that doesn't fit
 	lines := make([]string, 0)
 	currentLine := ""
-	lineNum := 0
-
-	for i, word := range words {
-		// Prepend leading space to first word if original text had leading whitespace
-		if i == 0 && leadingSpace != "" {
-			word = leadingSpace + word
-		}
-
-		testLine := currentLine
-		if testLine != "" {
-			testLine += " "
-		}
-		testLine += word
-
+	for _, segment := range segments {
 		maxWidth := remainingMax
-		if lineNum == 0 {
+		if len(lines) == 0 {
 			maxWidth = firstLineMax
 		}
 
-		lineWidth, _ := dc.MeasureString(testLine)
-		if lineWidth <= maxWidth {
+		testLine := currentLine + segment
+		lineWidth, _ := measureWithFace(displayLine(testLine, true), fontSize, face)
+		if lineWidth <= maxWidth || currentLine == "" {
 			currentLine = testLine
 		} else {
-			// Word doesn't fit, start new line
-			if currentLine != "" {
-				lines = append(lines, currentLine)
-				lineNum++
+			lines = append(lines, displayLine(currentLine, true))
+			currentLine = segment
+		}
+
+		// A word too long for a line of its own breaks where the line fills
+		for wrap == WrapBreakWord {
+			maxWidth = remainingMax
+			if len(lines) == 0 {
+				maxWidth = firstLineMax
+			}
+			head, tail := fitPrefix(currentLine, maxWidth, fontSize, face)
+			if tail == "" {
+				break
 			}
-			currentLine = word
+			lines = append(lines, displayLine(head, true))
+			currentLine = tail
 		}
 	}
 
 	// Add last line
-	if currentLine != "" {
-		lines = append(lines, currentLine)
+	if last := displayLine(currentLine, false); last != "" {
+		lines = append(lines, last)
 	}
 
 	if len(lines) == 0 {
@@ -210,112 +217,52 @@ func BreakTextIntoLinesWithWrap(text string, fontSize float64, bold bool, firstL
 	return lines
 }
 
-// splitIntoWords splits text into words preserving spaces
-func splitIntoWords(text string) []string {
-	words := make([]string, 0)
-	currentWord := ""
-
-	for _, ch := range text {
-		if ch == ' ' || ch == '\t' || ch == '\n' {
-			if currentWord != "" {
-				words = append(words, currentWord)
-				currentWord = ""
-			}
-		} else {
-			currentWord += string(ch)
+// fitPrefix splits line after the longest prefix that fits within
+// maxWidth, keeping at least one letter on the line. tail is empty if the
+// whole line fits.
+func fitPrefix(line string, maxWidth, fontSize float64, face font.Face) (head, tail string) {
+	end := 0
+	for i, r := range line {
+		next := i + utf8.RuneLen(r)
+		if width, _ := measureWithFace(displayLine(line[:next], false), fontSize, face); width > maxWidth && end > 0 {
+			break
 		}
+		end = next
 	}
+	return line[:end], line[end:]
+}
 
-	if currentWord != "" {
-		words = append(words, currentWord)
-	}
-
-	return words
+// isCollapsibleSpace returns true for the whitespace collapsed between words.
+func isCollapsibleSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n'
 }
 
-// GetFirstWord returns the first word of the text (skipping leading whitespace)
+// GetFirstWord returns the text up to the first line break opportunity,
+// skipping leading whitespace. For CJK text this is a single character.
 func GetFirstWord(text string) string {
-	words := splitIntoWords(text)
-	if len(words) > 0 {
-		return words[0]
+	segments := SplitAtLineBreaks(strings.TrimLeft(text, " \t\n"))
+	if len(segments) > 0 {
+		return displayLine(segments[0], true)
 	}
 	return ""
 }
 
 // BreakTextIntoLinesWithStyle breaks text into lines using the specified font style.
 // This is the comprehensive line-breaking function that respects all font-family properties.
-func BreakTextIntoLinesWithStyle(text string, fontSize float64, bold, italic, mono, ahem bool, firstLineMax, remainingMax float64) []string {
-	fontConfig := DefaultFontConfig()
-	fontPath := fontConfig.FontPath(bold, italic, mono, ahem)
-
-	// Use a temporary context for measurement
-	dc := gg.NewContext(1000, 1000)
-	if err := dc.LoadFontFace(fontPath, fontSize); err != nil {
-		// If font loading fails, return text as single line
-		return []string{text}
-	}
-
-	// Check if text fits on first line
-	textWidth, _ := dc.MeasureString(text)
-	if textWidth <= firstLineMax {
-		return []string{text}
-	}
-
-	// Preserve leading whitespace
-	leadingSpace := ""
-	if len(text) > 0 && (text[0] == ' ' || text[0] == '\t' || text[0] == '\n') {
-		leadingSpace = " "
-	}
-
-	// Split into words
-	words := splitIntoWords(text)
-	if len(words) == 0 {
-		return []string{text}
-	}
-
-	// Build lines
-	lines := make([]string, 0)
-	currentLine := ""
-	lineNum := 0
-
-	for i, word := range words {
-		// Prepend leading space to first word if original text had leading whitespace
-		if i == 0 && leadingSpace != "" {
-			word = leadingSpace + word
-		}
-
-		testLine := currentLine
-		if testLine != "" {
-			testLine += " "
-		}
-		testLine += word
-
-		maxWidth := remainingMax
-		if lineNum == 0 {
-			maxWidth = firstLineMax
-		}
-
-		lineWidth, _ := dc.MeasureString(testLine)
-		if lineWidth <= maxWidth {
-			currentLine = testLine
-		} else {
-			// Word doesn't fit, start new line
-			if currentLine != "" {
-				lines = append(lines, currentLine)
-				lineNum++
-			}
-			currentLine = word
-		}
-	}
+func BreakTextIntoLinesWithStyle(text string, fontSize float64, bold, italic, mono, ahem bool, firstLineMax, remainingMax float64, wrap WrapMode) []string {
+	fontPath := DefaultRegistry().ResolveStyle(mono, ahem).Path(bold, italic)
+	return breakLines(text, fontSize, FileFontFace(fontPath, fontSize), firstLineMax, remainingMax, wrap)
+}
 
-	// Add last line
-	if currentLine != "" {
-		lines = append(lines, currentLine)
+// BreakTextIntoLinesWithFamilies breaks text into lines using the first
+// available font of the family stack, as selected by MeasureTextWithFamilies.
+func BreakTextIntoLinesWithFamilies(fonts *FontSet, text string, fontSize float64, families []string, bold, italic, mono, ahem bool, firstLineMax, remainingMax float64, wrap WrapMode) []string {
+	if face := WebFontFace(fonts, families, fontSize, bold, italic); face != nil {
+		return breakLines(text, fontSize, face, firstLineMax, remainingMax, wrap)
 	}
-
-	if len(lines) == 0 {
-		return []string{text}
+	if len(families) == 0 {
+		return BreakTextIntoLinesWithStyle(text, fontSize, bold, italic, mono, ahem, firstLineMax, remainingMax, wrap)
 	}
-
-	return lines
+	fontPath := DefaultRegistry().Resolve(families).Path(bold, italic)
+	return breakLines(text, fontSize, FileFontFace(fontPath, fontSize), firstLineMax, remainingMax, wrap)
 }
@@ -0,0 +1,326 @@
+package text
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"louis14/pkg/determinism"
+)
+
+// GenericFamily is a CSS generic font family (CSS Fonts 3 §3.1.1).
+type GenericFamily int
+
+const (
+	GenericSansSerif GenericFamily = iota
+	GenericSerif
+	GenericMonospace
+	GenericCursive
+	GenericFantasy
+)
+
+// genericNames maps generic family keywords to their GenericFamily.
+var genericNames = map[string]GenericFamily{
+	"sans-serif":   GenericSansSerif,
+	"system-ui":    GenericSansSerif,
+	"serif":        GenericSerif,
+	"monospace":    GenericMonospace,
+	"ui-monospace": GenericMonospace,
+	"cursive":      GenericCursive,
+	"fantasy":      GenericFantasy,
+}
+
+// familyClasses maps well-known family names to the generic family whose
+// fonts stand in for them when they are not installed.
+var familyClasses = map[string]GenericFamily{
+	"arial":              GenericSansSerif,
+	"helvetica":          GenericSansSerif,
+	"helvetica neue":     GenericSansSerif,
+	"verdana":            GenericSansSerif,
+	"tahoma":             GenericSansSerif,
+	"segoe ui":           GenericSansSerif,
+	"roboto":             GenericSansSerif,
+	"open sans":          GenericSansSerif,
+	"-apple-system":      GenericSansSerif,
+	"blinkmacsystemfont": GenericSansSerif,
+	"times":              GenericSerif,
+	"times new roman":    GenericSerif,
+	"georgia":            GenericSerif,
+	"garamond":           GenericSerif,
+	"palatino":           GenericSerif,
+	"courier":            GenericMonospace,
+	"courier new":        GenericMonospace,
+	"consolas":           GenericMonospace,
+	"menlo":              GenericMonospace,
+	"monaco":             GenericMonospace,
+	"lucida console":     GenericMonospace,
+	"comic sans ms":      GenericCursive,
+	"impact":             GenericFantasy,
+}
+
+// FamilyMetrics approximates a family's glyph metrics in em units. They are
+// used only when none of the family's font files can be loaded.
+type FamilyMetrics struct {
+	AvgCharWidth float64 // Average advance width of a character
+	LineHeight   float64 // Height of a line of text
+}
+
+// genericMetrics holds the fallback metrics for each generic family.
+var genericMetrics = map[GenericFamily]FamilyMetrics{
+	GenericSansSerif: {AvgCharWidth: 0.6, LineHeight: 1.2},
+	GenericSerif:     {AvgCharWidth: 0.5, LineHeight: 1.2},
+	GenericMonospace: {AvgCharWidth: 0.6, LineHeight: 1.2},
+	GenericCursive:   {AvgCharWidth: 0.5, LineHeight: 1.2},
+	GenericFantasy:   {AvgCharWidth: 0.55, LineHeight: 1.2},
+}
+
+// FontFamily is a named family with one font file per style.
+type FontFamily struct {
+	Name       string
+	Generic    GenericFamily
+	Metrics    FamilyMetrics
+	Regular    string
+	Bold       string
+	Italic     string
+	BoldItalic string
+}
+
+// Path returns the font file for the given style, falling back to the
+// closest style the family provides.
+func (f *FontFamily) Path(bold, italic bool) string {
+	if bold && italic && f.BoldItalic != "" {
+		return f.BoldItalic
+	}
+	if bold && f.Bold != "" {
+		return f.Bold
+	}
+	if italic && f.Italic != "" {
+		return f.Italic
+	}
+	return f.Regular
+}
+
+// FontRegistry resolves CSS font-family stacks to font files. Families are
+// keyed by lowercased name; each generic family maps to one family.
+type FontRegistry struct {
+	mu       sync.RWMutex
+	families map[string]*FontFamily
+	generics map[GenericFamily]*FontFamily
+}
+
+// NewFontRegistry creates a registry whose generic families use the fonts in
+// fc, with installed system fonts filling generics fc does not cover and
+// answering to their own family names. In deterministic mode system fonts
+// are left out, and fc's fonts stand in for every generic family.
+func NewFontRegistry(fc FontConfig) *FontRegistry {
+	r := &FontRegistry{
+		families: make(map[string]*FontFamily),
+		generics: make(map[GenericFamily]*FontFamily),
+	}
+	var system []*FontFamily
+	if !determinism.Enabled() {
+		system = systemFamilies()
+	}
+	for _, f := range system {
+		r.Register(f)
+		if _, ok := r.generics[f.Generic]; !ok {
+			r.SetGeneric(f.Generic, f)
+		}
+	}
+
+	sans := &FontFamily{
+		Name: "sans-serif", Generic: GenericSansSerif, Metrics: genericMetrics[GenericSansSerif],
+		Regular: fc.Regular, Bold: fc.Bold, Italic: fc.Italic, BoldItalic: fc.BoldItalic,
+	}
+	r.SetGeneric(GenericSansSerif, sans)
+	if fc.Monospace != "" {
+		r.SetGeneric(GenericMonospace, &FontFamily{
+			Name: "monospace", Generic: GenericMonospace, Metrics: genericMetrics[GenericMonospace],
+			Regular: fc.Monospace, Bold: fc.MonoBold,
+		})
+	}
+	for _, g := range []GenericFamily{GenericSerif, GenericCursive, GenericFantasy} {
+		if _, ok := r.generics[g]; !ok {
+			fallback := *sans
+			fallback.Generic = g
+			fallback.Metrics = genericMetrics[g]
+			r.SetGeneric(g, &fallback)
+		}
+	}
+	if fc.Ahem != "" {
+		// Every Ahem glyph is a 1em square
+		r.Register(&FontFamily{Name: "Ahem", Metrics: FamilyMetrics{AvgCharWidth: 1, LineHeight: 1}, Regular: fc.Ahem})
+	}
+	return r
+}
+
+// Register adds a family that font-family stacks can name directly.
+func (r *FontRegistry) Register(f *FontFamily) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families[strings.ToLower(f.Name)] = f
+}
+
+// SetGeneric makes f the family used for a generic family keyword.
+func (r *FontRegistry) SetGeneric(g GenericFamily, f *FontFamily) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.generics[g] = f
+}
+
+// Generic returns the family used for a generic family keyword.
+func (r *FontRegistry) Generic(g GenericFamily) *FontFamily {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.generics[g]
+}
+
+// Resolve walks a font-family stack and returns the first family the
+// registry can satisfy. Registered names match directly, generic keywords
+// match their generic family, and well-known names that are not installed
+// match the generic family of their class. An empty or unmatched stack
+// resolves to sans-serif.
+func (r *FontRegistry) Resolve(families []string) *FontFamily {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, name := range families {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if f, ok := r.families[name]; ok {
+			return f
+		}
+		if g, ok := genericNames[name]; ok {
+			return r.generics[g]
+		}
+		if g, ok := familyClasses[name]; ok {
+			return r.generics[g]
+		}
+	}
+	return r.generics[GenericSansSerif]
+}
+
+// ResolveStyle picks a family from the bold/mono/ahem flags used by callers
+// that have no font-family stack.
+func (r *FontRegistry) ResolveStyle(mono, ahem bool) *FontFamily {
+	if ahem {
+		if f := r.Resolve([]string{"ahem"}); f.Name == "Ahem" {
+			return f
+		}
+	}
+	if mono {
+		return r.Generic(GenericMonospace)
+	}
+	return r.Generic(GenericSansSerif)
+}
+
+// IsMonospace returns true if the family stack resolves to a monospace family.
+func (r *FontRegistry) IsMonospace(families []string) bool {
+	return r.Resolve(families).Generic == GenericMonospace
+}
+
+var (
+	defaultRegistry     *FontRegistry
+	defaultRegistryOnce sync.Once
+)
+
+// DefaultRegistry returns the registry built from DefaultFontConfig.
+func DefaultRegistry() *FontRegistry {
+	defaultRegistryOnce.Do(func() {
+		defaultRegistry = NewFontRegistry(DefaultFontConfig())
+	})
+	return defaultRegistry
+}
+
+// systemFontFiles lists font files searched for in the system font
+// directories, by family: regular, bold, italic, bold italic.
+var systemFontFiles = []struct {
+	name    string
+	generic GenericFamily
+	files   [4]string
+}{
+	{"Liberation Sans", GenericSansSerif, [4]string{"LiberationSans-Regular.ttf", "LiberationSans-Bold.ttf", "LiberationSans-Italic.ttf", "LiberationSans-BoldItalic.ttf"}},
+	{"DejaVu Sans", GenericSansSerif, [4]string{"DejaVuSans.ttf", "DejaVuSans-Bold.ttf", "DejaVuSans-Oblique.ttf", "DejaVuSans-BoldOblique.ttf"}},
+	{"Arial", GenericSansSerif, [4]string{"Arial.ttf", "Arial Bold.ttf", "Arial Italic.ttf", "Arial Bold Italic.ttf"}},
+	{"Liberation Serif", GenericSerif, [4]string{"LiberationSerif-Regular.ttf", "LiberationSerif-Bold.ttf", "LiberationSerif-Italic.ttf", "LiberationSerif-BoldItalic.ttf"}},
+	{"DejaVu Serif", GenericSerif, [4]string{"DejaVuSerif.ttf", "DejaVuSerif-Bold.ttf", "DejaVuSerif-Italic.ttf", "DejaVuSerif-BoldItalic.ttf"}},
+	{"Times New Roman", GenericSerif, [4]string{"Times New Roman.ttf", "Times New Roman Bold.ttf", "Times New Roman Italic.ttf", "Times New Roman Bold Italic.ttf"}},
+	{"Georgia", GenericSerif, [4]string{"Georgia.ttf", "Georgia Bold.ttf", "Georgia Italic.ttf", "Georgia Bold Italic.ttf"}},
+	{"Liberation Mono", GenericMonospace, [4]string{"LiberationMono-Regular.ttf", "LiberationMono-Bold.ttf", "LiberationMono-Italic.ttf", "LiberationMono-BoldItalic.ttf"}},
+	{"DejaVu Sans Mono", GenericMonospace, [4]string{"DejaVuSansMono.ttf", "DejaVuSansMono-Bold.ttf", "DejaVuSansMono-Oblique.ttf", "DejaVuSansMono-BoldOblique.ttf"}},
+	{"Courier New", GenericMonospace, [4]string{"Courier New.ttf", "Courier New Bold.ttf", "Courier New Italic.ttf", "Courier New Bold Italic.ttf"}},
+}
+
+// metricAliases maps common web families to metric-compatible system families.
+var metricAliases = map[string]string{
+	"Liberation Sans":  "Helvetica",
+	"Liberation Serif": "Times",
+	"Liberation Mono":  "Courier",
+}
+
+var (
+	systemFamilyList []*FontFamily
+	systemFamilyOnce sync.Once
+)
+
+// systemFamilies returns the families in systemFontFiles whose regular
+// face is installed. The font directories are scanned once per process.
+func systemFamilies() []*FontFamily {
+	systemFamilyOnce.Do(func() {
+		systemFamilyList = findSystemFamilies(systemFontIndex())
+	})
+	return systemFamilyList
+}
+
+func findSystemFamilies(installed map[string]string) []*FontFamily {
+	var families []*FontFamily
+	for _, sf := range systemFontFiles {
+		regular, ok := installed[strings.ToLower(sf.files[0])]
+		if !ok {
+			continue
+		}
+		f := &FontFamily{Name: sf.name, Generic: sf.generic, Metrics: genericMetrics[sf.generic], Regular: regular}
+		f.Bold = installed[strings.ToLower(sf.files[1])]
+		f.Italic = installed[strings.ToLower(sf.files[2])]
+		f.BoldItalic = installed[strings.ToLower(sf.files[3])]
+		families = append(families, f)
+		if alias, ok := metricAliases[sf.name]; ok {
+			aliased := *f
+			aliased.Name = alias
+			families = append(families, &aliased)
+		}
+	}
+	return families
+}
+
+// systemFontDirs returns the platform's font directories.
+func systemFontDirs() []string {
+	home, _ := os.UserHomeDir()
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"/System/Library/Fonts", "/Library/Fonts", filepath.Join(home, "Library", "Fonts")}
+	case "windows":
+		return []string{filepath.Join(os.Getenv("WINDIR"), "Fonts")}
+	default:
+		return []string{"/usr/share/fonts", "/usr/local/share/fonts", filepath.Join(home, ".fonts"), filepath.Join(home, ".local", "share", "fonts")}
+	}
+}
+
+// systemFontIndex maps lowercased font file names to their paths.
+func systemFontIndex() map[string]string {
+	index := make(map[string]string)
+	for _, dir := range systemFontDirs() {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			name := strings.ToLower(d.Name())
+			if _, ok := index[name]; !ok {
+				index[name] = path
+			}
+			return nil
+		})
+	}
+	return index
+}
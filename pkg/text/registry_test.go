@@ -0,0 +1,138 @@
+package text
+
+import "testing"
+
+// testFontConfig names font files that need not exist: the registry only
+// resolves paths.
+var testFontConfig = FontConfig{
+	Regular:    "/fonts/sans.ttf",
+	Bold:       "/fonts/sans-bold.ttf",
+	Italic:     "/fonts/sans-italic.ttf",
+	BoldItalic: "/fonts/sans-bold-italic.ttf",
+	Monospace:  "/fonts/mono.ttf",
+	MonoBold:   "/fonts/mono-bold.ttf",
+	Ahem:       "/fonts/ahem.ttf",
+}
+
+func TestFontRegistry_Resolve(t *testing.T) {
+	r := NewFontRegistry(testFontConfig)
+	r.Register(&FontFamily{Name: "Brand Sans", Regular: "/fonts/brand.ttf"})
+
+	tests := []struct {
+		families []string
+		want     string // Regular file of the resolved family
+	}{
+		{[]string{"Brand Sans", "serif"}, "/fonts/brand.ttf"},
+		{[]string{" BRAND sans "}, "/fonts/brand.ttf"},
+		{[]string{"Missing", "Brand Sans"}, "/fonts/brand.ttf"},
+		{[]string{"Missing", "monospace"}, "/fonts/mono.ttf"},
+		{[]string{"ui-monospace"}, "/fonts/mono.ttf"},
+		{[]string{"Ahem"}, "/fonts/ahem.ttf"},
+		{[]string{"system-ui"}, "/fonts/sans.ttf"},
+		{[]string{"Missing"}, "/fonts/sans.ttf"},
+		{nil, "/fonts/sans.ttf"},
+		// Cursive and fantasy have no fonts of their own
+		{[]string{"cursive"}, "/fonts/sans.ttf"},
+		{[]string{"fantasy"}, "/fonts/sans.ttf"},
+	}
+	for _, tt := range tests {
+		if got := r.Resolve(tt.families).Regular; got != tt.want {
+			t.Errorf("Resolve(%q) = %s, want %s", tt.families, got, tt.want)
+		}
+	}
+
+	// Well-known names resolve to their class's family when not installed
+	for name, g := range map[string]GenericFamily{
+		"Helvetica": GenericSansSerif, "Georgia": GenericSerif, "Consolas": GenericMonospace,
+		"Comic Sans MS": GenericCursive, "Impact": GenericFantasy,
+	} {
+		if got := r.Resolve([]string{name}).Generic; got != g {
+			t.Errorf("Resolve(%q) has generic %d, want %d", name, got, g)
+		}
+	}
+}
+
+func TestFontRegistry_Generics(t *testing.T) {
+	r := NewFontRegistry(testFontConfig)
+	for _, g := range []GenericFamily{GenericSansSerif, GenericSerif, GenericMonospace, GenericCursive, GenericFantasy} {
+		f := r.Generic(g)
+		if f == nil || f.Generic != g || f.Metrics != genericMetrics[g] {
+			t.Errorf("generic %d: got %+v", g, f)
+		}
+	}
+	if f := r.Generic(GenericCursive); f.Bold != testFontConfig.Bold {
+		t.Errorf("expected cursive to fall back to the sans-serif styles, got %+v", f)
+	}
+
+	// A later SetGeneric replaces the family
+	serif := &FontFamily{Name: "Book", Generic: GenericSerif, Regular: "/fonts/book.ttf"}
+	r.SetGeneric(GenericSerif, serif)
+	if got := r.Resolve([]string{"serif"}); got != serif {
+		t.Errorf("expected the family set for serif, got %+v", got)
+	}
+}
+
+func TestFontRegistry_ResolveStyle(t *testing.T) {
+	r := NewFontRegistry(testFontConfig)
+	if got := r.ResolveStyle(false, true).Name; got != "Ahem" {
+		t.Errorf("expected Ahem, got %s", got)
+	}
+	if got := r.ResolveStyle(true, false).Regular; got != "/fonts/mono.ttf" {
+		t.Errorf("expected monospace, got %s", got)
+	}
+	if got := r.ResolveStyle(false, false).Regular; got != "/fonts/sans.ttf" {
+		t.Errorf("expected sans-serif, got %s", got)
+	}
+	if !r.IsMonospace([]string{"Missing", "monospace"}) || r.IsMonospace([]string{"serif"}) {
+		t.Error("IsMonospace disagrees with the resolved family")
+	}
+
+	// Without the Ahem font, ahem text falls back to sans-serif
+	noAhem := testFontConfig
+	noAhem.Ahem = ""
+	if got := NewFontRegistry(noAhem).ResolveStyle(false, true).Regular; got != "/fonts/sans.ttf" {
+		t.Errorf("expected sans-serif without Ahem, got %s", got)
+	}
+}
+
+func TestFontFamily_Path(t *testing.T) {
+	f := &FontFamily{Regular: "r.ttf", Bold: "b.ttf"}
+	tests := []struct {
+		bold, italic bool
+		want         string
+	}{
+		{false, false, "r.ttf"},
+		{true, false, "b.ttf"},
+		{false, true, "r.ttf"},
+		{true, true, "b.ttf"},
+	}
+	for _, tt := range tests {
+		if got := f.Path(tt.bold, tt.italic); got != tt.want {
+			t.Errorf("Path(bold %v, italic %v) = %s, want %s", tt.bold, tt.italic, got, tt.want)
+		}
+	}
+	f.Italic, f.BoldItalic = "i.ttf", "bi.ttf"
+	if got := f.Path(true, true); got != "bi.ttf" {
+		t.Errorf("expected bold italic, got %s", got)
+	}
+	if got := f.Path(false, true); got != "i.ttf" {
+		t.Errorf("expected italic, got %s", got)
+	}
+}
+
+func TestFindSystemFamilies(t *testing.T) {
+	families := findSystemFamilies(map[string]string{
+		"liberationsans-regular.ttf": "/sys/LiberationSans-Regular.ttf",
+		"liberationsans-bold.ttf":    "/sys/LiberationSans-Bold.ttf",
+		"dejavuserif-bold.ttf":       "/sys/DejaVuSerif-Bold.ttf", // No regular face
+	})
+	if len(families) != 2 {
+		t.Fatalf("expected Liberation Sans and its alias, got %d families", len(families))
+	}
+	for i, name := range []string{"Liberation Sans", "Helvetica"} {
+		f := families[i]
+		if f.Name != name || f.Generic != GenericSansSerif || f.Bold != "/sys/LiberationSans-Bold.ttf" || f.Italic != "" {
+			t.Errorf("family %d: got %+v", i, f)
+		}
+	}
+}
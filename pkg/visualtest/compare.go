@@ -14,6 +14,10 @@ type CompareResult struct {
 	DifferentPixels int
 	TotalPixels     int
 	MaxDifference   int // Max color channel difference found
+
+	// SSIM is the mean structural similarity of the images' luminance, from
+	// 1 for identical images down towards 0 (or below) for unrelated ones
+	SSIM float64
 }
 
 // CompareOptions configures the image comparison
@@ -32,6 +36,12 @@ type CompareOptions struct {
 	// Recommended: 0.1-0.5 for small differences, 0 for exact match
 	MaxDifferentPercent float64
 
+	// MinSSIM: if > 0, pass if the structural similarity (SSIM) of the images is >= this value
+	// SSIM follows perceived differences rather than exact pixel values, so a
+	// slightly moved or anti-aliased edge scores close to 1
+	// Recommended: 0.98-0.99 for perceptual matching, 0 to compare pixels only
+	MinSSIM float64
+
 	// SaveDiffImage: if true, saves a diff image highlighting differences
 	SaveDiffImage bool
 	DiffImagePath string
@@ -145,6 +155,8 @@ func CompareImages(actualPath, expectedPath string, opts CompareOptions) (*Compa
 		}
 	}
 
+	result.SSIM = ssim(actualImg, expectedImg)
+
 	// Check if percentage of different pixels is acceptable
 	if !result.Match && opts.MaxDifferentPercent > 0 {
 		pct := float64(result.DifferentPixels) / float64(result.TotalPixels) * 100
@@ -153,6 +165,11 @@ func CompareImages(actualPath, expectedPath string, opts CompareOptions) (*Compa
 		}
 	}
 
+	// Check if the images are perceptually close enough
+	if !result.Match && opts.MinSSIM > 0 && result.SSIM >= opts.MinSSIM {
+		result.Match = true
+	}
+
 	// Save diff image if requested
 	if opts.SaveDiffImage && !result.Match && opts.DiffImagePath != "" {
 		if err := savePNG(diffImg, opts.DiffImagePath); err != nil {
@@ -193,6 +210,76 @@ func fuzzyMatch(actual, expected image.Image, x, y, radius, tolerance int, bound
 	return false
 }
 
+// ssimWindow is the side of the square windows SSIM is computed over, and
+// ssimStep how far apart they are
+const (
+	ssimWindow = 8
+	ssimStep   = 4
+)
+
+// ssim returns the mean structural similarity index (Wang et al. 2004) of
+// the luminance of two images with the same bounds, over ssimWindow square
+// windows ssimStep pixels apart.
+func ssim(a, b image.Image) float64 {
+	bounds := a.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return 1
+	}
+	la, lb := luminance(a), luminance(b)
+
+	const (
+		c1 = (0.01 * 255) * (0.01 * 255)
+		c2 = (0.03 * 255) * (0.03 * 255)
+	)
+	winW, winH := ssimWindow, ssimWindow
+	if w < winW {
+		winW = w
+	}
+	if h < winH {
+		winH = h
+	}
+
+	total, windows := 0.0, 0
+	for y0 := 0; y0+winH <= h; y0 += ssimStep {
+		for x0 := 0; x0+winW <= w; x0 += ssimStep {
+			var sumA, sumB, sumAA, sumBB, sumAB float64
+			for y := y0; y < y0+winH; y++ {
+				for x := x0; x < x0+winW; x++ {
+					va, vb := la[y*w+x], lb[y*w+x]
+					sumA += va
+					sumB += vb
+					sumAA += va * va
+					sumBB += vb * vb
+					sumAB += va * vb
+				}
+			}
+			n := float64(winW * winH)
+			meanA, meanB := sumA/n, sumB/n
+			varA := sumAA/n - meanA*meanA
+			varB := sumBB/n - meanB*meanB
+			cov := sumAB/n - meanA*meanB
+			total += ((2*meanA*meanB + c1) * (2*cov + c2)) /
+				((meanA*meanA + meanB*meanB + c1) * (varA + varB + c2))
+			windows++
+		}
+	}
+	return total / float64(windows)
+}
+
+// luminance returns the Rec. 601 luma (0-255) of each pixel of img, row by row
+func luminance(img image.Image) []float64 {
+	bounds := img.Bounds()
+	lum := make([]float64, 0, bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			lum = append(lum, (0.299*float64(r)+0.587*float64(g)+0.114*float64(b))/257)
+		}
+	}
+	return lum
+}
+
 // savePNG saves an image as PNG
 func savePNG(img image.Image, path string) error {
 	file, err := os.Create(path)
@@ -0,0 +1,79 @@
+package visualtest
+
+import (
+	"image/png"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ReferenceDir is the name of the directory beside test pages that holds
+// their reference images.
+const ReferenceDir = "reference"
+
+// Case is a test page and the reference image it is compared against.
+type Case struct {
+	Name          string // Path of the page below the discovery root, without .html
+	HTMLPath      string
+	ReferencePath string // May not exist yet
+}
+
+// DiscoverCases finds the visual test cases below root: every .html file in
+// a directory that has a reference subdirectory, whose reference image is
+// reference/<name>.png beside it. Cases are returned sorted by name.
+func DiscoverCases(root string) ([]Case, error) {
+	var cases []Case
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".html") {
+			return nil
+		}
+		dir := filepath.Dir(path)
+		if !isDir(filepath.Join(dir, ReferenceDir)) {
+			return nil
+		}
+
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		rel, err := filepath.Rel(root, filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		cases = append(cases, Case{
+			Name:          filepath.ToSlash(rel),
+			HTMLPath:      path,
+			ReferencePath: filepath.Join(dir, ReferenceDir, name+".png"),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(cases, func(i, j int) bool { return cases[i].Name < cases[j].Name })
+	return cases, nil
+}
+
+// ViewportSize returns the size of the case's existing reference image, so
+// it can be regenerated at the same size, or the given defaults if there
+// is none yet.
+func (c Case) ViewportSize(defaultWidth, defaultHeight int) (width, height int) {
+	file, err := os.Open(c.ReferencePath)
+	if err != nil {
+		return defaultWidth, defaultHeight
+	}
+	defer file.Close()
+	config, err := png.DecodeConfig(file)
+	if err != nil {
+		return defaultWidth, defaultHeight
+	}
+	return config.Width, config.Height
+}
+
+// isDir reports whether path is an existing directory
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
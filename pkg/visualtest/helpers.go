@@ -1,6 +1,7 @@
 package visualtest
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -12,12 +13,13 @@ import (
 	"louis14/pkg/render"
 )
 
-// RenderHTMLToFile renders HTML content to a PNG file
+// RenderHTMLToFile renders HTML content to a PNG file, or an SVG file if
+// outputPath ends in .svg
 func RenderHTMLToFile(htmlContent string, outputPath string, width, height int) error {
 	return RenderHTMLToFileWithBase(htmlContent, outputPath, width, height, "")
 }
 
-// RenderHTMLToFileWithBase renders HTML content to a PNG file with a base path for resolving relative image URLs
+// RenderHTMLToFileWithBase renders HTML content to a PNG or SVG file with a base path for resolving relative image URLs
 func RenderHTMLToFileWithBase(htmlContent string, outputPath string, width, height int, basePath string) error {
 	// Parse HTML
 	doc, err := html.Parse(htmlContent)
@@ -37,14 +39,26 @@ func RenderHTMLToFileWithBase(htmlContent string, outputPath string, width, heig
 		engine.SetImageFetcher(fetcher)
 	}
 
-	boxes := engine.Layout(doc)
+	boxes, err := engine.Layout(context.Background(), doc)
+	if err != nil {
+		return fmt.Errorf("layout error: %w", err)
+	}
 
-	// Render
-	renderer := render.NewRenderer(width, height)
+	// Render, to SVG for a readable, diffable form of the paint operations
+	var renderer *render.Renderer
+	var svg *render.SVGBackend
+	if strings.EqualFold(filepath.Ext(outputPath), ".svg") {
+		svg = render.NewSVGBackend(width, height)
+		renderer = render.NewRendererForBackend(svg)
+	} else {
+		renderer = render.NewRenderer(width, height)
+	}
 	if fetcher != nil {
 		renderer.SetImageFetcher(fetcher)
 	}
-	renderer.Render(boxes)
+	if err := renderer.Render(context.Background(), boxes); err != nil {
+		return fmt.Errorf("render error: %w", err)
+	}
 
 	// Ensure output directory exists
 	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
@@ -52,7 +66,11 @@ func RenderHTMLToFileWithBase(htmlContent string, outputPath string, width, heig
 	}
 
 	// Save
-	if err := renderer.SavePNG(outputPath); err != nil {
+	save := renderer.SavePNG
+	if svg != nil {
+		save = svg.Save
+	}
+	if err := save(outputPath); err != nil {
 		return fmt.Errorf("save error: %w", err)
 	}
 
@@ -62,7 +80,7 @@ func RenderHTMLToFileWithBase(htmlContent string, outputPath string, width, heig
 // createFileImageFetcher creates an ImageFetcher that loads images from the filesystem
 // relative to the given base path
 func createFileImageFetcher(basePath string) images.ImageFetcher {
-	return func(uri string) ([]byte, error) {
+	return func(ctx context.Context, uri string) ([]byte, error) {
 		// Skip data URIs and absolute URLs
 		if strings.HasPrefix(uri, "data:") || strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://") {
 			return nil, fmt.Errorf("unsupported URI scheme: %s", uri)
@@ -81,7 +99,7 @@ func RenderHTMLFile(htmlPath, outputPath string, width, height int) error {
 		return fmt.Errorf("failed to read HTML file: %w", err)
 	}
 
-	return RenderHTMLToFile(string(htmlContent), outputPath, width, height)
+	return RenderHTMLToFile(html.Decode(htmlContent), outputPath, width, height)
 }
 
 // UpdateReferenceImage generates a new reference image
@@ -0,0 +1,191 @@
+package visualtest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"louis14/pkg/html"
+)
+
+// Reftest is a Web Platform Tests style reftest: a test page that must
+// render the same as the reference page named by its <link rel="match">.
+type Reftest struct {
+	TestPath string
+	RefPath  string // May not exist
+}
+
+// reftestExtensions are the file extensions of reftest pages.
+var reftestExtensions = []string{".html", ".htm", ".xht", ".xhtml"}
+
+// FindReftests finds the reftests below root, or root itself if it is a
+// file: every page with a <link rel="match">, except reference pages
+// (named -ref, or in a reference directory). References with absolute
+// hrefs, as in the WPT repository, are resolved against root. Reftests are
+// returned sorted by test path.
+func FindReftests(root string) ([]Reftest, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	base := root
+	if !info.IsDir() {
+		base = filepath.Dir(root)
+	}
+
+	var reftests []Reftest
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !isReftestPage(path) {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		href := findRefLink(string(content))
+		if href == "" {
+			return nil
+		}
+		refPath := filepath.Join(filepath.Dir(path), filepath.FromSlash(href))
+		if strings.HasPrefix(href, "/") {
+			refPath = filepath.Join(base, filepath.FromSlash(href))
+		}
+		reftests = append(reftests, Reftest{TestPath: path, RefPath: refPath})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(reftests, func(i, j int) bool { return reftests[i].TestPath < reftests[j].TestPath })
+	return reftests, nil
+}
+
+// isReftestPage reports whether path is a page that may be a reftest, as
+// opposed to a reference or another file.
+func isReftestPage(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	isPage := false
+	for _, e := range reftestExtensions {
+		if ext == e {
+			isPage = true
+		}
+	}
+	if !isPage || strings.HasSuffix(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), "-ref") {
+		return false
+	}
+	return !strings.Contains(path, string(filepath.Separator)+ReferenceDir+string(filepath.Separator))
+}
+
+// ReftestResult is the outcome of running a reftest.
+type ReftestResult struct {
+	*CompareResult
+	TestImage string // Rendering of the test page
+	RefImage  string // Rendering of the reference page
+	DiffImage string // Differences, saved only if the renderings don't match
+}
+
+// RunReftest renders the test and reference pages of rt with a viewport
+// of width x height into PNGs in outDir, and compares them with opts.
+// Images found next to each page are loaded relative to it.
+func RunReftest(rt Reftest, width, height int, opts CompareOptions, outDir string) (*ReftestResult, error) {
+	content, err := os.ReadFile(rt.TestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read test: %w", err)
+	}
+	refContent, err := os.ReadFile(rt.RefPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reference: %w", err)
+	}
+
+	result := &ReftestResult{
+		TestImage: filepath.Join(outDir, "test.png"),
+		RefImage:  filepath.Join(outDir, "ref.png"),
+		DiffImage: filepath.Join(outDir, "diff.png"),
+	}
+	if err := RenderHTMLToFileWithBase(html.Decode(content), result.TestImage, width, height, filepath.Dir(rt.TestPath)); err != nil {
+		return nil, fmt.Errorf("failed to render test: %w", err)
+	}
+	if err := RenderHTMLToFileWithBase(html.Decode(refContent), result.RefImage, width, height, filepath.Dir(rt.RefPath)); err != nil {
+		return nil, fmt.Errorf("failed to render reference: %w", err)
+	}
+
+	opts.SaveDiffImage = true
+	opts.DiffImagePath = result.DiffImage
+	result.CompareResult, err = CompareImages(result.TestImage, result.RefImage, opts)
+	if err != nil {
+		return nil, fmt.Errorf("comparison failed: %w", err)
+	}
+	return result, nil
+}
+
+// findRefLink extracts the href from <link rel="match" href="..."> in HTML content.
+func findRefLink(content string) string {
+	// Try parsing with our HTML parser first
+	doc, err := html.Parse(content)
+	if err == nil {
+		if href := findRefLinkInDOM(doc.Root); href != "" {
+			return href
+		}
+	}
+
+	// Fallback: simple string search for <link rel="match" href="...">
+	lower := strings.ToLower(content)
+	idx := strings.Index(lower, `rel="match"`)
+	if idx == -1 {
+		idx = strings.Index(lower, `rel='match'`)
+	}
+	if idx == -1 {
+		return ""
+	}
+
+	// Find the enclosing tag
+	start := strings.LastIndex(lower[:idx], "<")
+	if start == -1 {
+		return ""
+	}
+	end := strings.Index(lower[idx:], ">")
+	if end == -1 {
+		return ""
+	}
+	tag := content[start : idx+end+1]
+
+	// Extract href value
+	for _, prefix := range []string{`href="`, `href='`} {
+		hrefIdx := strings.Index(strings.ToLower(tag), prefix)
+		if hrefIdx == -1 {
+			continue
+		}
+		quote := tag[hrefIdx+5]
+		rest := tag[hrefIdx+6:]
+		endQuote := strings.IndexByte(rest, quote)
+		if endQuote == -1 {
+			continue
+		}
+		return rest[:endQuote]
+	}
+	return ""
+}
+
+// findRefLinkInDOM walks the DOM tree looking for <link rel="match" href="...">.
+func findRefLinkInDOM(node *html.Node) string {
+	if node.Type == html.ElementNode && node.TagName == "link" {
+		if rel, ok := node.Attributes["rel"]; ok {
+			if strings.ToLower(rel) == "match" {
+				if href, ok := node.Attributes["href"]; ok {
+					return href
+				}
+			}
+		}
+	}
+	for _, child := range node.Children {
+		if href := findRefLinkInDOM(child); href != "" {
+			return href
+		}
+	}
+	return ""
+}
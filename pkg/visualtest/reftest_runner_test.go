@@ -8,9 +8,14 @@ import (
 	"strings"
 	"testing"
 
-	"louis14/pkg/html"
+	"louis14/pkg/determinism"
 )
 
+func TestMain(m *testing.M) {
+	determinism.Enable()
+	os.Exit(m.Run())
+}
+
 // TestWPTReftests runs WPT CSS 2.1 reftests by rendering both test and reference
 // HTML files and comparing the resulting images pixel-by-pixel.
 func TestWPTReftests(t *testing.T) {
@@ -221,7 +226,10 @@ func runReftest(t *testing.T, testPath string) bool {
 			copyFile(testPNG, filepath.Join(outputDir, baseName+"_test.png"))
 			copyFile(refPNG, filepath.Join(outputDir, baseName+"_ref.png"))
 			copyFile(opts.DiffImagePath, filepath.Join(outputDir, baseName+"_diff.png"))
-			t.Logf("  saved to output/reftests/%s_*.png", baseName)
+			// SVG renders show which paint operations differ
+			RenderHTMLToFileWithBase(string(content), filepath.Join(outputDir, baseName+"_test.svg"), width, height, testBasePath)
+			RenderHTMLToFileWithBase(string(refContent), filepath.Join(outputDir, baseName+"_ref.svg"), width, height, refBasePath)
+			t.Logf("  saved to output/reftests/%s_*.png and _*.svg", baseName)
 		}
 		return false
 	}
@@ -239,73 +247,6 @@ func copyFile(src, dst string) {
 	os.WriteFile(dst, data, 0644)
 }
 
-// findRefLink extracts the href from <link rel="match" href="..."> in HTML content.
-func findRefLink(content string) string {
-	// Try parsing with our HTML parser first
-	doc, err := html.Parse(content)
-	if err == nil {
-		if href := findRefLinkInDOM(doc.Root); href != "" {
-			return href
-		}
-	}
-
-	// Fallback: simple string search for <link rel="match" href="...">
-	lower := strings.ToLower(content)
-	idx := strings.Index(lower, `rel="match"`)
-	if idx == -1 {
-		idx = strings.Index(lower, `rel='match'`)
-	}
-	if idx == -1 {
-		return ""
-	}
-
-	// Find the enclosing tag
-	start := strings.LastIndex(lower[:idx], "<")
-	if start == -1 {
-		return ""
-	}
-	end := strings.Index(lower[idx:], ">")
-	if end == -1 {
-		return ""
-	}
-	tag := content[start : idx+end+1]
-
-	// Extract href value
-	for _, prefix := range []string{`href="`, `href='`} {
-		hrefIdx := strings.Index(strings.ToLower(tag), prefix)
-		if hrefIdx == -1 {
-			continue
-		}
-		quote := tag[hrefIdx+5]
-		rest := tag[hrefIdx+6:]
-		endQuote := strings.IndexByte(rest, quote)
-		if endQuote == -1 {
-			continue
-		}
-		return rest[:endQuote]
-	}
-	return ""
-}
-
-// findRefLinkInDOM walks the DOM tree looking for <link rel="match" href="...">.
-func findRefLinkInDOM(node *html.Node) string {
-	if node.Type == html.ElementNode && node.TagName == "link" {
-		if rel, ok := node.Attributes["rel"]; ok {
-			if strings.ToLower(rel) == "match" {
-				if href, ok := node.Attributes["href"]; ok {
-					return href
-				}
-			}
-		}
-	}
-	for _, child := range node.Children {
-		if href := findRefLinkInDOM(child); href != "" {
-			return href
-		}
-	}
-	return ""
-}
-
 // TestListReftestResults provides a quick summary of all reftest results
 // without failing. Useful for tracking progress.
 func TestListReftestResults(t *testing.T) {
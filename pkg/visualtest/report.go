@@ -0,0 +1,158 @@
+package visualtest
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// Report collects failing visual test cases and writes them as an HTML page
+// showing the reference, actual and diff images of each side by side.
+// The images are copied into the report's directory, so the report stays
+// viewable after the test's temporary files are removed.
+type Report struct {
+	mu    sync.Mutex
+	dir   string
+	cases []reportCase
+}
+
+// reportCase is a failing case in a Report, with image paths relative to
+// the report's directory.
+type reportCase struct {
+	Name            string
+	Expected        string
+	Actual          string
+	Diff            string // Empty if there is no diff image
+	DifferentPixels int
+	TotalPixels     int
+	MaxDifference   int
+	SSIM            float64
+}
+
+// DifferentPercent returns the percentage of pixels that differ.
+func (c reportCase) DifferentPercent() float64 {
+	if c.TotalPixels == 0 {
+		return 0
+	}
+	return 100 * float64(c.DifferentPixels) / float64(c.TotalPixels)
+}
+
+// NewReport returns an empty report that is written to dir.
+func NewReport(dir string) *Report {
+	return &Report{dir: dir}
+}
+
+// Len returns the number of cases in the report.
+func (r *Report) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.cases)
+}
+
+// unsafeFileChars are replaced in case names to form image file names.
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Add adds a failing case to the report, copying its reference, actual and
+// diff images into the report's directory. diffPath may be empty or name a
+// file that doesn't exist when no diff image was saved.
+func (r *Report) Add(name, expectedPath, actualPath, diffPath string, result *CompareResult) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create report directory: %w", err)
+	}
+	base := fmt.Sprintf("%03d-%s", len(r.cases), unsafeFileChars.ReplaceAllString(name, "_"))
+
+	c := reportCase{Name: name}
+	if result != nil {
+		c.DifferentPixels = result.DifferentPixels
+		c.TotalPixels = result.TotalPixels
+		c.MaxDifference = result.MaxDifference
+		c.SSIM = result.SSIM
+	}
+	for _, img := range []struct {
+		src    string
+		suffix string
+		dst    *string
+	}{
+		{expectedPath, "expected", &c.Expected},
+		{actualPath, "actual", &c.Actual},
+		{diffPath, "diff", &c.Diff},
+	} {
+		if img.src == "" {
+			continue
+		}
+		data, err := os.ReadFile(img.src)
+		if os.IsNotExist(err) && img.suffix == "diff" {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s image: %w", img.suffix, err)
+		}
+		file := base + "-" + img.suffix + filepath.Ext(img.src)
+		if err := os.WriteFile(filepath.Join(r.dir, file), data, 0644); err != nil {
+			return fmt.Errorf("failed to copy %s image: %w", img.suffix, err)
+		}
+		*img.dst = file
+	}
+
+	r.cases = append(r.cases, c)
+	return nil
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Visual regression report</title>
+<style>
+body { font-family: sans-serif; margin: 20px; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 6px; vertical-align: top; text-align: left; }
+img { max-width: 400px; border: 1px solid #eee; }
+</style>
+</head>
+<body>
+<h1>Visual regression report</h1>
+<p>{{len .}} failing case(s)</p>
+{{range .}}
+<h2>{{.Name}}</h2>
+<p>Different pixels: {{.DifferentPixels}} / {{.TotalPixels}} ({{printf "%.2f" .DifferentPercent}}%),
+max difference: {{.MaxDifference}}, SSIM: {{printf "%.4f" .SSIM}}</p>
+<table>
+<tr><th>Reference</th><th>Actual</th><th>Diff</th></tr>
+<tr>
+<td>{{if .Expected}}<a href="{{.Expected}}"><img src="{{.Expected}}"></a>{{end}}</td>
+<td>{{if .Actual}}<a href="{{.Actual}}"><img src="{{.Actual}}"></a>{{end}}</td>
+<td>{{if .Diff}}<a href="{{.Diff}}"><img src="{{.Diff}}"></a>{{end}}</td>
+</tr>
+</table>
+{{end}}
+</body>
+</html>
+`))
+
+// WriteHTML writes the report to index.html in its directory and returns
+// the path of that file.
+func (r *Report) WriteHTML() (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create report directory: %w", err)
+	}
+	path := filepath.Join(r.dir, "index.html")
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := reportTemplate.Execute(file, r.cases); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write report: %w", err)
+	}
+	return path, file.Close()
+}
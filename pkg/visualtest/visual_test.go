@@ -6,6 +6,7 @@ import (
 	"image/png"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -154,6 +155,182 @@ func TestCompareImages_DifferentDimensions(t *testing.T) {
 	}
 }
 
+func TestCompareImages_SSIM(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// A black square on white, and the same square moved one pixel right
+	square := func(offset int) image.Image {
+		img := image.NewRGBA(image.Rect(0, 0, 40, 40))
+		for y := 0; y < 40; y++ {
+			for x := 0; x < 40; x++ {
+				c := color.RGBA{255, 255, 255, 255}
+				if x >= 10+offset && x < 30+offset && y >= 10 && y < 30 {
+					c = color.RGBA{0, 0, 0, 255}
+				}
+				img.Set(x, y, c)
+			}
+		}
+		return img
+	}
+	path1 := filepath.Join(tmpDir, "img1.png")
+	path2 := filepath.Join(tmpDir, "img2.png")
+	saveTestImage(t, square(0), path1)
+	saveTestImage(t, square(1), path2)
+
+	result, err := CompareImages(path1, path1, DefaultOptions())
+	if err != nil {
+		t.Fatalf("comparison failed: %v", err)
+	}
+	if result.SSIM < 0.9999 {
+		t.Errorf("expected SSIM of identical images to be 1, got %f", result.SSIM)
+	}
+
+	opts := DefaultOptions()
+	result, err = CompareImages(path1, path2, opts)
+	if err != nil {
+		t.Fatalf("comparison failed: %v", err)
+	}
+	if result.Match {
+		t.Errorf("expected shifted images to not match pixel by pixel")
+	}
+	if result.SSIM <= 0 || result.SSIM >= 1 {
+		t.Errorf("expected SSIM between 0 and 1, got %f", result.SSIM)
+	}
+
+	// The same comparison passes once a lower SSIM is accepted
+	opts.MinSSIM = result.SSIM - 0.01
+	result, err = CompareImages(path1, path2, opts)
+	if err != nil {
+		t.Fatalf("comparison failed: %v", err)
+	}
+	if !result.Match {
+		t.Errorf("expected images to match with MinSSIM=%f", opts.MinSSIM)
+	}
+}
+
+func TestReport_WriteHTML(t *testing.T) {
+	tmpDir := t.TempDir()
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	expected := filepath.Join(tmpDir, "expected.png")
+	actual := filepath.Join(tmpDir, "actual.png")
+	saveTestImage(t, img, expected)
+	saveTestImage(t, img, actual)
+
+	report := NewReport(filepath.Join(tmpDir, "report"))
+	result := &CompareResult{DifferentPixels: 4, TotalPixels: 16, MaxDifference: 255, SSIM: 0.5}
+	if err := report.Add("float left/right", expected, actual, filepath.Join(tmpDir, "missing-diff.png"), result); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	path, err := report.WriteHTML()
+	if err != nil {
+		t.Fatalf("WriteHTML: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read report: %v", err)
+	}
+	page := string(data)
+	for _, want := range []string{"float left/right", "25.00%", `src="000-float_left_right-expected.png"`, `src="000-float_left_right-actual.png"`} {
+		if !strings.Contains(page, want) {
+			t.Errorf("expected report to contain %q", want)
+		}
+	}
+	if strings.Contains(page, "-diff.png") {
+		t.Errorf("expected no diff image for a missing diff")
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "report", "000-float_left_right-actual.png")); err != nil {
+		t.Errorf("expected the actual image to be copied: %v", err)
+	}
+}
+
+func TestDiscoverCases(t *testing.T) {
+	root := t.TempDir()
+	for _, file := range []string{
+		"phase1/a.html",
+		"phase1/b.html",
+		"phase1/reference/a.png",
+		"phase2/sub/c.html",
+		"phase2/sub/reference/.keep",
+		"noref/d.html", // No reference directory: not a test case
+	} {
+		path := filepath.Join(root, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases, err := DiscoverCases(root)
+	if err != nil {
+		t.Fatalf("DiscoverCases: %v", err)
+	}
+	var names []string
+	for _, c := range cases {
+		names = append(names, c.Name)
+	}
+	if got, want := strings.Join(names, ","), "phase1/a,phase1/b,phase2/sub/c"; got != want {
+		t.Fatalf("expected cases %s, got %s", want, got)
+	}
+	if want := filepath.Join(root, "phase2", "sub", "reference", "c.png"); cases[2].ReferencePath != want {
+		t.Errorf("expected reference %s, got %s", want, cases[2].ReferencePath)
+	}
+}
+
+func TestFindAndRunReftests(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"a.html":           `<link rel="match" href="a-ref.html"><div style="width:50px;height:50px;background:green"></div>`,
+		"a-ref.html":       `<div style="width:50px;height:50px;background-color:green"></div>`,
+		"sub/b.xht":        `<link rel="match" href="/reference/b.html"><div style="width:50px;height:50px;background:green"></div>`,
+		"reference/b.html": `<link rel="match" href="x.html"><div style="width:50px;height:50px;background:red"></div>`,
+		"plain.html":       `<p>no reference</p>`,
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reftests, err := FindReftests(root)
+	if err != nil {
+		t.Fatalf("FindReftests: %v", err)
+	}
+	if len(reftests) != 2 {
+		t.Fatalf("expected 2 reftests, got %+v", reftests)
+	}
+	if want := filepath.Join(root, "a-ref.html"); reftests[0].RefPath != want {
+		t.Errorf("expected reference %s, got %s", want, reftests[0].RefPath)
+	}
+	if want := filepath.Join(root, "reference", "b.html"); reftests[1].RefPath != want {
+		t.Errorf("expected absolute href resolved to %s, got %s", want, reftests[1].RefPath)
+	}
+
+	opts := DefaultOptions()
+	result, err := RunReftest(reftests[0], 100, 100, opts, t.TempDir())
+	if err != nil {
+		t.Fatalf("RunReftest: %v", err)
+	}
+	if !result.Match {
+		t.Errorf("expected a.html to match its reference")
+	}
+	result, err = RunReftest(reftests[1], 100, 100, opts, t.TempDir())
+	if err != nil {
+		t.Fatalf("RunReftest: %v", err)
+	}
+	if result.Match || result.DifferentPixels != 2500 {
+		t.Errorf("expected 2500 different pixels, got match=%v different=%d", result.Match, result.DifferentPixels)
+	}
+	if _, err := os.Stat(result.DiffImage); err != nil {
+		t.Errorf("expected a diff image: %v", err)
+	}
+}
+
 // Helper function to save test images
 func saveTestImage(t *testing.T, img image.Image, path string) {
 	t.Helper()
@@ -0,0 +1,148 @@
+package net
+
+import (
+	"container/list"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache is an in-memory LRU cache of HTTP responses keyed by URL.
+// It is safe for concurrent use.
+type Cache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List               // Front = most recently used
+	entries  map[string]*list.Element // URL -> element holding *cacheEntry
+}
+
+type cacheEntry struct {
+	url     string
+	resp    Response
+	expires time.Time // Zero means the entry must be revalidated before use
+}
+
+// NewCache creates an LRU cache holding at most capacity responses.
+func NewCache(capacity int) *Cache {
+	return &Cache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Len returns the number of cached responses.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Clear removes all cached responses.
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+}
+
+// get returns a snapshot of the entry for url and marks it most recently used.
+func (c *Cache) get(url string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[url]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	entry := *el.Value.(*cacheEntry)
+	return &entry, true
+}
+
+// put stores resp under url, evicting the least recently used entry if full.
+func (c *Cache) put(url string, resp *Response, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &cacheEntry{url: url, resp: *resp, expires: expires}
+	if el, ok := c.entries[url]; ok {
+		el.Value = entry
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[url] = c.order.PushFront(entry)
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).url)
+	}
+}
+
+// refresh updates the expiry of a revalidated entry.
+func (c *Cache) refresh(url string, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[url]; ok {
+		el.Value.(*cacheEntry).expires = expires
+	}
+}
+
+// fresh reports whether the entry can be served without revalidation.
+func (e *cacheEntry) fresh(now time.Time) bool {
+	return !e.expires.IsZero() && now.Before(e.expires)
+}
+
+// response returns a copy of the cached response marked as served from cache.
+func (e *cacheEntry) response() *Response {
+	resp := e.resp
+	resp.FromCache = true
+	return &resp
+}
+
+// cacheable reports whether a response may be stored. The cache is shared
+// by every request the client makes, so responses meant for one user, those
+// that are private or set cookies, are not stored, nor are those that vary
+// with request headers, since entries are keyed by URL alone. The headers
+// every request sends alike, Accept-Encoding and User-Agent, are the
+// exception.
+func cacheable(h http.Header) bool {
+	cc := strings.ToLower(h.Get("Cache-Control"))
+	if strings.Contains(cc, "no-store") || strings.Contains(cc, "private") || len(h.Values("Set-Cookie")) > 0 {
+		return false
+	}
+	for _, vary := range h.Values("Vary") {
+		for _, name := range strings.Split(vary, ",") {
+			switch http.CanonicalHeaderKey(strings.TrimSpace(name)) {
+			case "Accept-Encoding", "User-Agent", "":
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// expiryFromHeaders computes when a response stops being fresh, using
+// Cache-Control max-age or Expires. A zero time means "always revalidate".
+func expiryFromHeaders(h http.Header, now time.Time) time.Time {
+	cc := strings.ToLower(h.Get("Cache-Control"))
+	if strings.Contains(cc, "no-cache") {
+		return time.Time{}
+	}
+	for _, directive := range strings.Split(cc, ",") {
+		directive = strings.TrimSpace(directive)
+		if v, ok := strings.CutPrefix(directive, "max-age="); ok {
+			if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+				return now.Add(time.Duration(secs) * time.Second)
+			}
+			return time.Time{}
+		}
+	}
+	if exp := h.Get("Expires"); exp != "" {
+		if t, err := http.ParseTime(exp); err == nil && t.After(now) {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,157 @@
+package net
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClient_SkipsCachingPerUserResponses(t *testing.T) {
+	headers := map[string]http.Header{
+		"/public":   {"Cache-Control": {"max-age=60"}, "Vary": {"Accept-Encoding"}},
+		"/private":  {"Cache-Control": {"private, max-age=60"}},
+		"/vary":     {"Cache-Control": {"max-age=60"}, "Vary": {"Accept-Encoding, Cookie"}},
+		"/cookie":   {"Cache-Control": {"max-age=60"}, "Set-Cookie": {"sid=1"}},
+		"/no-store": {"Cache-Control": {"no-store"}},
+	}
+	hits := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits[r.URL.Path]++
+		for k, v := range headers[r.URL.Path] {
+			w.Header()[k] = v
+		}
+		w.Write([]byte("body"))
+	}))
+	defer srv.Close()
+
+	c := NewClient(16)
+	for path := range headers {
+		for i := 0; i < 2; i++ {
+			if _, err := c.Get(srv.URL + path); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for path := range headers {
+		want := 2
+		if path == "/public" {
+			want = 1
+		}
+		if hits[path] != want {
+			t.Errorf("%s: expected %d requests, got %d", path, want, hits[path])
+		}
+	}
+}
+
+func TestCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewCache(2)
+	expires := time.Now().Add(time.Minute)
+	c.put("a", &Response{Body: []byte("a")}, expires)
+	c.put("b", &Response{Body: []byte("b")}, expires)
+	c.get("a") // b is now the least recently used
+	c.put("c", &Response{Body: []byte("c")}, expires)
+	if _, ok := c.get("b"); ok {
+		t.Error("expected b evicted")
+	}
+	for _, url := range []string{"a", "c"} {
+		if e, ok := c.get(url); !ok || string(e.resp.Body) != url {
+			t.Errorf("expected %s cached, got %v", url, e)
+		}
+	}
+
+	// Replacing an entry does not grow the cache
+	c.put("a", &Response{Body: []byte("a2")}, expires)
+	if e, _ := c.get("a"); c.Len() != 2 || string(e.resp.Body) != "a2" {
+		t.Errorf("expected a replaced in place, got %d entries", c.Len())
+	}
+	c.Clear()
+	if c.Len() != 0 {
+		t.Errorf("expected an empty cache, got %d", c.Len())
+	}
+}
+
+func TestExpiryFromHeaders(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header http.Header
+		want   time.Time
+	}{
+		{http.Header{"Cache-Control": {"max-age=60"}}, now.Add(time.Minute)},
+		{http.Header{"Cache-Control": {"public, MAX-AGE=5"}}, now.Add(5 * time.Second)},
+		{http.Header{"Cache-Control": {"max-age=0"}}, time.Time{}},
+		{http.Header{"Cache-Control": {"max-age=soon"}}, time.Time{}},
+		{http.Header{"Cache-Control": {"no-cache, max-age=60"}}, time.Time{}},
+		// max-age takes precedence over Expires
+		{http.Header{"Cache-Control": {"max-age=60"}, "Expires": {now.Add(time.Hour).Format(http.TimeFormat)}}, now.Add(time.Minute)},
+		{http.Header{"Expires": {now.Add(time.Hour).Format(http.TimeFormat)}}, now.Add(time.Hour)},
+		{http.Header{"Expires": {now.Add(-time.Hour).Format(http.TimeFormat)}}, time.Time{}},
+		{http.Header{"Expires": {"0"}}, time.Time{}},
+		{http.Header{}, time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := expiryFromHeaders(tt.header, now); !got.Equal(tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestClient_FreshnessAndRevalidation(t *testing.T) {
+	const lastModified = "Mon, 01 Jan 2024 12:00:00 GMT"
+	headers := map[string]http.Header{
+		"/max-age":  {"Cache-Control": {"max-age=60"}},
+		"/expires":  {"Expires": {time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)}},
+		"/no-cache": {"Cache-Control": {"no-cache"}, "Etag": {`"v1"`}},
+		"/expired":  {"Expires": {"Mon, 01 Jan 2024 12:00:00 GMT"}, "Last-Modified": {lastModified}},
+		"/changed":  {"Cache-Control": {"no-cache"}, "Etag": {`"v2"`}},
+	}
+	hits := map[string]int{}
+	notModified := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits[r.URL.Path]++
+		for k, v := range headers[r.URL.Path] {
+			w.Header()[k] = v
+		}
+		if r.URL.Path != "/changed" {
+			if etag := r.Header.Get("If-None-Match"); etag != "" && etag == headers[r.URL.Path].Get("Etag") ||
+				r.Header.Get("If-Modified-Since") == lastModified {
+				notModified[r.URL.Path]++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		fmt.Fprintf(w, "body %d", hits[r.URL.Path])
+	}))
+	defer srv.Close()
+
+	c := NewClient(16)
+	tests := []struct {
+		path              string
+		hits, notModified int
+		body              string
+		fromCache         bool
+	}{
+		{"/max-age", 1, 0, "body 1", true},
+		{"/expires", 1, 0, "body 1", true},
+		{"/no-cache", 2, 1, "body 1", true}, // Revalidated by ETag
+		{"/expired", 2, 1, "body 1", true},  // Revalidated by Last-Modified
+		{"/changed", 2, 0, "body 2", false}, // Revalidated and replaced
+	}
+	for _, tt := range tests {
+		first, err := c.Get(srv.URL + tt.path)
+		if err != nil || first.FromCache {
+			t.Fatalf("%s: expected a network fetch, got %v", tt.path, err)
+		}
+		resp, err := c.Get(srv.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hits[tt.path] != tt.hits || notModified[tt.path] != tt.notModified {
+			t.Errorf("%s: expected %d requests and %d 304s, got %d and %d", tt.path, tt.hits, tt.notModified, hits[tt.path], notModified[tt.path])
+		}
+		if string(resp.Body) != tt.body || resp.FromCache != tt.fromCache {
+			t.Errorf("%s: got %q (from cache %v), want %q (from cache %v)", tt.path, resp.Body, resp.FromCache, tt.body, tt.fromCache)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package net
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// ParseCharset extracts the lowercased charset parameter from a Content-Type
+// header value. Returns "" if there is none.
+func ParseCharset(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(params["charset"]))
+}
+
+// DecodeToUTF8 converts body from the named charset to UTF-8. Labels are
+// resolved per the WHATWG Encoding Standard (so "latin1" means windows-1252).
+// An empty or UTF-8 charset returns body unchanged.
+func DecodeToUTF8(body []byte, charset string) ([]byte, error) {
+	if charset == "" || charset == "utf-8" || charset == "utf8" {
+		return body, nil
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unknown charset %q", charset)
+	}
+	return enc.NewDecoder().Bytes(body)
+}
+
+// isTextContentType reports whether a Content-Type denotes textual content
+// whose charset should be honored.
+func isTextContentType(contentType string) bool {
+	ct := strings.ToLower(contentType)
+	return strings.HasPrefix(ct, "text/") ||
+		strings.Contains(ct, "javascript") ||
+		strings.Contains(ct, "json") ||
+		strings.Contains(ct, "xml")
+}
+
+// metaPrescanLength is how much of an HTML document is searched for a
+// <meta> charset declaration (WHATWG HTML §13.2.3.2).
+const metaPrescanLength = 1024
+
+// isHTMLContentType reports whether a Content-Type denotes an HTML document,
+// whose charset may also be declared in the document itself.
+func isHTMLContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	}
+	mediaType = strings.ToLower(mediaType)
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// SniffHTMLCharset determines the character encoding of an HTML document
+// from, in order of precedence: a byte order mark, the charset of its
+// Content-Type (which may be ""), and a <meta charset> or <meta http-equiv>
+// declaration near its start. An undeclared document is taken as UTF-8 if it
+// is valid UTF-8 and windows-1252 otherwise. The result is the encoding's
+// canonical WHATWG name, such as "utf-8", "windows-1252" or "shift_jis".
+func SniffHTMLCharset(body []byte, contentType string) string {
+	if charset := bomCharset(body); charset != "" {
+		return charset
+	}
+	if charset := canonicalCharset(ParseCharset(contentType)); charset != "" {
+		return charset
+	}
+	if charset := prescanMetaCharset(body); charset != "" {
+		return charset
+	}
+	if utf8.Valid(body) {
+		return "utf-8"
+	}
+	return "windows-1252"
+}
+
+// DecodeHTML converts an HTML document to UTF-8 using the encoding found by
+// SniffHTMLCharset, which it returns. The byte order mark is removed.
+func DecodeHTML(body []byte, contentType string) ([]byte, string) {
+	charset := SniffHTMLCharset(body, contentType)
+	switch {
+	case charset == "utf-8":
+		return bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")), charset
+	case strings.HasPrefix(charset, "utf-16") && bomCharset(body) == charset:
+		body = body[2:]
+	}
+	decoded, err := DecodeToUTF8(body, charset)
+	if err != nil {
+		return body, "utf-8"
+	}
+	return decoded, charset
+}
+
+// bomCharset returns the encoding named by a byte order mark at the start
+// of body, or "".
+func bomCharset(body []byte) string {
+	switch {
+	case bytes.HasPrefix(body, []byte("\xef\xbb\xbf")):
+		return "utf-8"
+	case bytes.HasPrefix(body, []byte("\xfe\xff")):
+		return "utf-16be"
+	case bytes.HasPrefix(body, []byte("\xff\xfe")):
+		return "utf-16le"
+	}
+	return ""
+}
+
+// canonicalCharset resolves an encoding label to its canonical name, or ""
+// if the label is empty or unknown.
+func canonicalCharset(label string) string {
+	if label == "" {
+		return ""
+	}
+	enc, err := htmlindex.Get(label)
+	if err != nil {
+		return ""
+	}
+	name, err := htmlindex.Name(enc)
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// prescanMetaCharset looks for a charset declaration in the <meta> tags at
+// the start of an HTML document: <meta charset="..."> or
+// <meta http-equiv="Content-Type" content="...; charset=...">. A document
+// can't declare itself UTF-16, since it was read as ASCII to find the
+// declaration, so that is taken to mean UTF-8.
+func prescanMetaCharset(body []byte) string {
+	s := strings.ToLower(string(body[:min(len(body), metaPrescanLength)]))
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], "<!--"):
+			end := strings.Index(s[i+4:], "-->")
+			if end < 0 {
+				return ""
+			}
+			i += end + 7
+		case strings.HasPrefix(s[i:], "<meta") && i+5 < len(s) && isMetaAttrSpace(s[i+5]):
+			attrs, next := parseMetaAttributes(s, i+5)
+			i = next
+			charset := attrs["charset"]
+			if charset == "" && attrs["http-equiv"] == "content-type" {
+				charset = charsetFromContent(attrs["content"])
+			}
+			if charset = canonicalCharset(charset); charset != "" {
+				if strings.HasPrefix(charset, "utf-16") {
+					return "utf-8"
+				}
+				if charset == "x-user-defined" {
+					return "windows-1252"
+				}
+				return charset
+			}
+		default:
+			i++
+		}
+	}
+	return ""
+}
+
+// isMetaAttrSpace reports whether c separates a tag name from its
+// attributes.
+func isMetaAttrSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '/'
+}
+
+// parseMetaAttributes reads the attributes of a tag starting at s[i] up to
+// its closing '>', returning them and the index after the tag.
+func parseMetaAttributes(s string, i int) (map[string]string, int) {
+	attrs := make(map[string]string)
+	for i < len(s) {
+		for i < len(s) && isMetaAttrSpace(s[i]) {
+			i++
+		}
+		if i >= len(s) || s[i] == '>' {
+			return attrs, i + 1
+		}
+		start := i
+		for i < len(s) && s[i] != '=' && s[i] != '>' && !isMetaAttrSpace(s[i]) {
+			i++
+		}
+		name := s[start:i]
+		for i < len(s) && isMetaAttrSpace(s[i]) && s[i] != '/' {
+			i++
+		}
+		value := ""
+		if i < len(s) && s[i] == '=' {
+			i++
+			for i < len(s) && isMetaAttrSpace(s[i]) && s[i] != '/' {
+				i++
+			}
+			if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+				quote := s[i]
+				end := strings.IndexByte(s[i+1:], quote)
+				if end < 0 {
+					return attrs, len(s)
+				}
+				value = s[i+1 : i+1+end]
+				i += end + 2
+			} else {
+				start := i
+				for i < len(s) && s[i] != '>' && !isMetaAttrSpace(s[i]) {
+					i++
+				}
+				value = s[start:i]
+			}
+		}
+		if _, seen := attrs[name]; !seen && name != "" {
+			attrs[name] = strings.TrimSpace(value)
+		}
+	}
+	return attrs, i
+}
+
+// charsetFromContent extracts the charset from the content attribute of a
+// <meta http-equiv="Content-Type">, such as "text/html; charset=shift_jis".
+func charsetFromContent(content string) string {
+	i := strings.Index(content, "charset")
+	if i < 0 {
+		return ""
+	}
+	rest := strings.TrimLeft(content[i+len("charset"):], " \t\n\r\f")
+	if !strings.HasPrefix(rest, "=") {
+		return ""
+	}
+	rest = strings.TrimLeft(rest[1:], " \t\n\r\f")
+	if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+		if end := strings.IndexByte(rest[1:], rest[0]); end >= 0 {
+			return rest[1 : 1+end]
+		}
+		return ""
+	}
+	if end := strings.IndexAny(rest, "; \t\n\r\f"); end >= 0 {
+		rest = rest[:end]
+	}
+	return rest
+}
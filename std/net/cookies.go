@@ -0,0 +1,221 @@
+package net
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Jar is a cookie jar: it keeps the cookies responses set and returns
+// those a request should send, following RFC 6265 with the public suffix
+// list, so a cookie can't be set for a whole registry such as co.uk. A Jar
+// created with a file path also saves its persistent cookies, those with
+// an expiry, to the file, so they outlive the process; session cookies
+// are kept in memory only. It implements http.CookieJar and is safe for
+// concurrent use.
+type Jar struct {
+	jar *cookiejar.Jar
+
+	mu    sync.Mutex
+	path  string                  // File persistent cookies are saved in; "" = memory only
+	saved map[string]*savedCookie // Persistent cookies by domain, path, and name
+	seq   int                     // Order of the next cookie saved
+}
+
+// savedCookie is a persistent cookie as it is saved to a Jar's file: the
+// cookie and the URL it was set for, so loading sets it as it was set.
+type savedCookie struct {
+	URL      string
+	Name     string
+	Value    string
+	Domain   string `json:",omitempty"`
+	Path     string `json:",omitempty"`
+	Expires  time.Time
+	Secure   bool `json:",omitempty"`
+	HttpOnly bool `json:",omitempty"`
+	Seq      int  `json:"-"`
+}
+
+// NewJar creates a Jar that saves persistent cookies in the file at path,
+// loading those saved there before, or keeps cookies in memory if path is
+// empty.
+func NewJar(path string) *Jar {
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	j := &Jar{jar: jar, path: path, saved: make(map[string]*savedCookie)}
+	if path == "" {
+		return j
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return j
+	}
+	var saved []*savedCookie
+	if json.Unmarshal(data, &saved) != nil {
+		return j
+	}
+	now := time.Now()
+	for _, c := range saved {
+		u, err := url.Parse(c.URL)
+		if err != nil || !c.Expires.After(now) {
+			continue
+		}
+		j.jar.SetCookies(u, []*http.Cookie{c.cookie()})
+		j.record(u, c)
+	}
+	return j
+}
+
+// SetCookies stores the cookies of a response from u.
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+	if j.path == "" {
+		return
+	}
+
+	now := time.Now()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	changed := false
+	for _, hc := range cookies {
+		c := &savedCookie{
+			URL:      u.String(),
+			Name:     hc.Name,
+			Value:    hc.Value,
+			Domain:   hc.Domain,
+			Path:     hc.Path,
+			Expires:  hc.Expires,
+			Secure:   hc.Secure,
+			HttpOnly: hc.HttpOnly,
+		}
+		// Max-Age takes precedence over Expires
+		switch {
+		case hc.MaxAge < 0:
+			c.Expires = now.Add(-time.Second)
+		case hc.MaxAge > 0:
+			c.Expires = now.Add(time.Duration(hc.MaxAge) * time.Second)
+		}
+		if !c.Expires.After(now) {
+			// An expired cookie deletes a saved one, and a session cookie
+			// replaces it
+			changed = j.forget(u, c) || changed
+			continue
+		}
+		changed = j.record(u, c) || changed
+	}
+	if changed {
+		j.save(now)
+	}
+}
+
+// Cookies returns the cookies to send in a request to u.
+func (j *Jar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// record keeps c, set for u, to be saved, and reports whether it may be:
+// a cookie for a domain u's host is not in, or for a public suffix, is
+// rejected by the jar and not saved either. The caller holds j.mu, or
+// owns j.
+func (j *Jar) record(u *url.URL, c *savedCookie) bool {
+	key, ok := savedKey(u, c)
+	if !ok {
+		return false
+	}
+	if old, ok := j.saved[key]; ok {
+		c.Seq = old.Seq
+	} else {
+		c.Seq = j.seq
+		j.seq++
+	}
+	j.saved[key] = c
+	return true
+}
+
+// forget removes the saved cookie that c, set for u, replaces, and
+// reports whether there was one. The caller holds j.mu.
+func (j *Jar) forget(u *url.URL, c *savedCookie) bool {
+	key, ok := savedKey(u, c)
+	if !ok {
+		return false
+	}
+	if _, ok := j.saved[key]; !ok {
+		return false
+	}
+	delete(j.saved, key)
+	return true
+}
+
+// save writes the jar's unexpired persistent cookies to its file. Cookies
+// that can't be saved are kept in memory for the rest of the session. The
+// caller holds j.mu.
+func (j *Jar) save(now time.Time) {
+	saved := []*savedCookie{}
+	for key, c := range j.saved {
+		if !c.Expires.After(now) {
+			delete(j.saved, key)
+			continue
+		}
+		saved = append(saved, c)
+	}
+	sort.Slice(saved, func(a, b int) bool { return saved[a].Seq < saved[b].Seq })
+	data, err := json.Marshal(saved)
+	if err != nil || os.MkdirAll(filepath.Dir(j.path), 0o700) != nil {
+		return
+	}
+	// Write then rename, so a crash never leaves a truncated file
+	tmp := j.path + ".tmp"
+	if os.WriteFile(tmp, data, 0o600) == nil {
+		os.Rename(tmp, j.path)
+	}
+}
+
+// cookie returns the cookie to set for c.
+func (c *savedCookie) cookie() *http.Cookie {
+	return &http.Cookie{
+		Name:     c.Name,
+		Value:    c.Value,
+		Domain:   c.Domain,
+		Path:     c.Path,
+		Expires:  c.Expires,
+		Secure:   c.Secure,
+		HttpOnly: c.HttpOnly,
+	}
+}
+
+// savedKey returns the key identifying cookie c, set for u, among the
+// saved cookies: its domain, path, and name, as the jar identifies it. It
+// returns false if the jar would reject the cookie's domain.
+func savedKey(u *url.URL, c *savedCookie) (string, bool) {
+	if u.Scheme != "http" && u.Scheme != "https" || c.Name == "" {
+		return "", false
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	domain := "=" + host // Host-only
+	if d := strings.TrimSuffix(strings.ToLower(strings.TrimPrefix(c.Domain, ".")), "."); d != "" {
+		if d != host && !strings.HasSuffix(host, "."+d) {
+			return "", false
+		}
+		if suffix, _ := publicsuffix.PublicSuffix(d); suffix == d && d != host {
+			return "", false
+		}
+		domain = d
+	}
+	path := c.Path
+	if !strings.HasPrefix(path, "/") {
+		// The directory of the request path (RFC 6265 §5.1.4)
+		path = "/"
+		if i := strings.LastIndexByte(u.Path, '/'); i > 0 {
+			path = u.Path[:i]
+		}
+	}
+	return domain + ";" + path + ";" + c.Name, true
+}
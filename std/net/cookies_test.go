@@ -0,0 +1,146 @@
+package net
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cookieHeader returns the cookies jar sends to rawURL, as a Cookie header.
+func cookieHeader(t *testing.T, jar *Jar, rawURL string) string {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parts []string
+	for _, c := range jar.Cookies(u) {
+		parts = append(parts, c.Name+"="+c.Value)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func setCookies(t *testing.T, jar *Jar, rawURL string, cookies ...*http.Cookie) {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jar.SetCookies(u, cookies)
+}
+
+func TestJar_DomainAndPath(t *testing.T) {
+	jar := NewJar("")
+	setCookies(t, jar, "https://www.example.com/shop/cart",
+		&http.Cookie{Name: "host", Value: "1"},
+		&http.Cookie{Name: "wide", Value: "2", Domain: ".example.com", Path: "/"},
+		&http.Cookie{Name: "deep", Value: "3", Path: "/shop/cart/"},
+		&http.Cookie{Name: "secure", Value: "4", Path: "/", Secure: true},
+		&http.Cookie{Name: "other", Value: "5", Domain: "other.com"},
+		&http.Cookie{Name: "suffix", Value: "6", Domain: "com"},
+	)
+	setCookies(t, jar, "https://shop.example.co.uk/", &http.Cookie{Name: "super", Value: "7", Domain: "co.uk"})
+
+	tests := []struct{ url, want string }{
+		// Longer paths first; a cookie without a path gets the request's directory
+		{"https://www.example.com/shop/cart/items", "deep=3; host=1; wide=2; secure=4"},
+		{"https://www.example.com/shop", "host=1; wide=2; secure=4"},
+		{"https://www.example.com/shopping", "wide=2; secure=4"},
+		{"http://www.example.com/", "wide=2"},
+		// Host-only cookies stay on their host; domain cookies reach subdomains
+		{"https://api.example.com/shop", "wide=2"},
+		{"https://example.com/", "wide=2"},
+		{"https://other.com/", ""},
+		{"https://example.co.uk/", ""},
+		{"https://other.co.uk/", ""},
+	}
+	for _, tt := range tests {
+		if got := cookieHeader(t, jar, tt.url); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestJar_ExpiryAndDeletion(t *testing.T) {
+	jar := NewJar("")
+	const page = "https://example.com/"
+	setCookies(t, jar, page,
+		&http.Cookie{Name: "a", Value: "1", MaxAge: 60},
+		&http.Cookie{Name: "b", Value: "2", Expires: time.Now().Add(time.Hour)},
+		&http.Cookie{Name: "old", Value: "3", Expires: time.Now().Add(-time.Hour)},
+	)
+	if got := cookieHeader(t, jar, page); got != "a=1; b=2" {
+		t.Fatalf("expected the unexpired cookies, got %q", got)
+	}
+
+	// Max-Age <= 0 and a past Expires delete
+	setCookies(t, jar, page,
+		&http.Cookie{Name: "a", MaxAge: -1},
+		&http.Cookie{Name: "b", Expires: time.Unix(1, 0)},
+	)
+	if got := cookieHeader(t, jar, page); got != "" {
+		t.Errorf("expected the cookies deleted, got %q", got)
+	}
+}
+
+func TestJar_Persists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "louis14", "cookies.json")
+	jar := NewJar(path)
+	setCookies(t, jar, "https://www.example.com/account/login",
+		&http.Cookie{Name: "session", Value: "abc", Path: "/", MaxAge: 3600},
+		&http.Cookie{Name: "wide", Value: "1", Domain: "example.com", Path: "/", Expires: time.Now().Add(time.Hour)},
+		&http.Cookie{Name: "temp", Value: "x"},
+		&http.Cookie{Name: "gone", Value: "y", Path: "/", MaxAge: 3600},
+	)
+	setCookies(t, jar, "https://www.example.com/", &http.Cookie{Name: "gone", Path: "/", MaxAge: -1})
+
+	// A new jar reading the same file has the persistent cookies only
+	loaded := NewJar(path)
+	if got := cookieHeader(t, loaded, "https://www.example.com/account/"); got != "session=abc; wide=1" {
+		t.Errorf("expected the persistent cookies loaded, got %q", got)
+	}
+	if got := cookieHeader(t, loaded, "https://api.example.com/"); got != "wide=1" {
+		t.Errorf("expected the domain cookie to keep its domain, got %q", got)
+	}
+
+	// A session cookie replacing a persistent one is not saved
+	setCookies(t, loaded, "https://www.example.com/", &http.Cookie{Name: "session", Value: "new", Path: "/"})
+	if got := cookieHeader(t, NewJar(path), "https://www.example.com/"); got != "wide=1" {
+		t.Errorf("expected the replaced cookie dropped from the file, got %q", got)
+	}
+}
+
+func TestClient_CookiesOptIn(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("Cookie"))
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "1", Path: "/"})
+			http.Redirect(w, r, "/home", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	// Without a jar, cookies are neither kept nor sent
+	c := NewClient(0)
+	if _, err := c.Get(srv.URL + "/login"); err != nil {
+		t.Fatal(err)
+	}
+	if got[1] != "" {
+		t.Errorf("expected no cookies without a jar, got %q", got[1])
+	}
+
+	// With one, they are, following redirects
+	got = nil
+	c.SetJar(NewJar(""))
+	if _, err := c.Get(srv.URL + "/login"); err != nil {
+		t.Fatal(err)
+	}
+	if got[1] != "sid=1" {
+		t.Errorf("expected the cookie sent after the redirect, got %q", got[1])
+	}
+}
@@ -0,0 +1,67 @@
+package net
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// defaultDataMediaType is the media type of a data URL that names none.
+const defaultDataMediaType = "text/plain;charset=US-ASCII"
+
+// IsDataURL returns true if the string is a data: URL.
+func IsDataURL(s string) bool {
+	return len(s) >= 5 && strings.EqualFold(s[:5], "data:")
+}
+
+// DecodeDataURL decodes a data: URL (RFC 2397) of the form
+// data:[<mediatype>][;base64],<data>. It returns the body and media type;
+// text bodies with a charset are converted to UTF-8, as for HTTP responses.
+func DecodeDataURL(rawURL string) (body []byte, contentType string, err error) {
+	if !IsDataURL(rawURL) {
+		return nil, "", fmt.Errorf("not a data URL")
+	}
+	meta, encoded, ok := strings.Cut(rawURL[5:], ",")
+	if !ok {
+		return nil, "", fmt.Errorf("invalid data URL: no comma found")
+	}
+
+	meta = strings.TrimSpace(meta)
+	isBase64 := false
+	if i := strings.LastIndexByte(meta, ';'); i >= 0 && strings.EqualFold(strings.TrimSpace(meta[i+1:]), "base64") {
+		isBase64 = true
+		meta = meta[:i]
+	}
+	contentType = meta
+	if contentType == "" || strings.HasPrefix(contentType, ";") {
+		contentType = defaultDataMediaType
+	}
+
+	// The data is percent-encoded in both forms
+	if decoded, err := url.PathUnescape(encoded); err == nil {
+		encoded = decoded
+	}
+	if !isBase64 {
+		body = []byte(encoded)
+	} else {
+		// Whitespace and missing padding are tolerated, as in browsers
+		encoded = strings.Map(func(r rune) rune {
+			if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' {
+				return -1
+			}
+			return r
+		}, encoded)
+		body, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(encoded, "="))
+		if err != nil {
+			return nil, "", fmt.Errorf("base64 decode error: %w", err)
+		}
+	}
+
+	if isTextContentType(contentType) {
+		if decoded, err := DecodeToUTF8(body, ParseCharset(contentType)); err == nil {
+			body = decoded
+		}
+	}
+	return body, contentType, nil
+}
@@ -0,0 +1,104 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"net/url"
+)
+
+// ErrTooLarge is returned by a fetch whose response body is larger than the
+// limit set with WithBodyLimit.
+var ErrTooLarge = errors.New("response body too large")
+
+type bodyLimitKey struct{}
+
+type urlCheckKey struct{}
+
+type addrCheckKey struct{}
+
+// WithBodyLimit returns a copy of ctx under which a fetch fails with
+// ErrTooLarge if its response body is larger than n bytes, as sent or
+// once decoded. No more of the body than that is read.
+func WithBodyLimit(ctx context.Context, n int64) context.Context {
+	return context.WithValue(ctx, bodyLimitKey{}, n)
+}
+
+// WithURLCheck returns a copy of ctx under which a fetch follows a
+// redirect only if check returns nil for the URL it leads to, and fails
+// with check's error otherwise.
+func WithURLCheck(ctx context.Context, check func(*url.URL) error) context.Context {
+	return context.WithValue(ctx, urlCheckKey{}, check)
+}
+
+// WithAddrCheck returns a copy of ctx under which a fetch connects to a
+// server only if check returns nil for its IP address, the one its host
+// name resolves to, and fails with check's error otherwise. Each
+// connection is checked as it is made, redirects' included, so a name
+// cannot resolve to one address when checked and another when used.
+func WithAddrCheck(ctx context.Context, check func(netip.Addr) error) context.Context {
+	return context.WithValue(ctx, addrCheckKey{}, check)
+}
+
+// checkBodySize returns ErrTooLarge if a body of size bytes is over the
+// limit of ctx.
+func checkBodySize(ctx context.Context, size int) error {
+	if n, ok := ctx.Value(bodyLimitKey{}).(int64); ok && int64(size) > n {
+		return fmt.Errorf("%w: over %d bytes", ErrTooLarge, n)
+	}
+	return nil
+}
+
+// checkURL returns the error of the URL check of ctx for u, if any.
+func checkURL(ctx context.Context, u *url.URL) error {
+	if check, ok := ctx.Value(urlCheckKey{}).(func(*url.URL) error); ok {
+		return check(u)
+	}
+	return nil
+}
+
+// checkAddr returns the error of the address check of ctx for address,
+// the IP address and port of a connection, if any.
+func checkAddr(ctx context.Context, address string) error {
+	check, ok := ctx.Value(addrCheckKey{}).(func(netip.Addr) error)
+	if !ok {
+		return nil
+	}
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	return check(addrPort.Addr().Unmap())
+}
+
+// limitBody returns body, failing with ErrTooLarge once more than the
+// limit of ctx has been read from it.
+func limitBody(ctx context.Context, body io.Reader) io.Reader {
+	n, ok := ctx.Value(bodyLimitKey{}).(int64)
+	if !ok {
+		return body
+	}
+	return &limitedReader{r: body, n: n}
+}
+
+// limitedReader is io.LimitedReader that fails when the limit is passed
+// instead of ending the body.
+type limitedReader struct {
+	r    io.Reader
+	n    int64 // Most bytes the body may have
+	read int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.n-l.read+1 {
+		p = p[:l.n-l.read+1]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.n {
+		return n, fmt.Errorf("%w: over %d bytes", ErrTooLarge, l.n)
+	}
+	return n, err
+}
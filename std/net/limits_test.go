@@ -0,0 +1,107 @@
+package net
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestAddrCheck(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secret"))
+	}))
+	defer target.Close()
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL+"/", http.StatusFound)
+	}))
+	defer redirect.Close()
+
+	errDenied := errors.New("denied")
+	var checked []netip.Addr
+	check := func(allowed int) context.Context {
+		checked = nil
+		return WithAddrCheck(context.Background(), func(addr netip.Addr) error {
+			checked = append(checked, addr)
+			if len(checked) > allowed {
+				return errDenied
+			}
+			return nil
+		})
+	}
+
+	// A host name is checked at the address it resolves to
+	port := target.URL[strings.LastIndex(target.URL, ":"):]
+	_, err := NewClient(0).GetContext(check(0), "http://localhost"+port+"/")
+	if !errors.Is(err, errDenied) {
+		t.Errorf("expected the check's error for localhost, got %v", err)
+	}
+	if len(checked) == 0 || !checked[0].IsLoopback() {
+		t.Errorf("expected localhost checked at a loopback address, got %v", checked)
+	}
+
+	// A redirect is checked at the connection it makes
+	if _, err := NewClient(0).GetContext(check(1), redirect.URL+"/"); !errors.Is(err, errDenied) {
+		t.Errorf("expected the check's error for the redirect, got %v", err)
+	}
+	if resp, err := NewClient(0).GetContext(check(2), redirect.URL+"/"); err != nil || string(resp.Body) != "secret" {
+		t.Errorf("expected the allowed redirect followed, got %v", err)
+	}
+	if len(checked) != 2 {
+		t.Errorf("expected both connections checked, got %v", checked)
+	}
+
+	// Without a check, connections are not held to one
+	if resp, err := NewClient(0).GetContext(context.Background(), redirect.URL+"/"); err != nil || string(resp.Body) != "secret" {
+		t.Errorf("expected an unchecked fetch to succeed, got %v", err)
+	}
+}
+
+func TestBodyLimit_DecompressionBomb(t *testing.T) {
+	// 64MB of zeros gzips to about 64KB, well under the limit, but must
+	// fail as it inflates past it.
+	var bomb bytes.Buffer
+	w := gzip.NewWriter(&bomb)
+	zeros := make([]byte, 1<<20)
+	for i := 0; i < 64; i++ {
+		w.Write(zeros)
+	}
+	w.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(bomb.Bytes())
+	}))
+	defer srv.Close()
+
+	ctx := WithBodyLimit(context.Background(), 1<<20)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := NewClient(0).GetContext(ctx, srv.URL+"/"); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge fetching the bomb, got %v", err)
+	}
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 16<<20 {
+		t.Errorf("expected decoding to stop at the limit, but it allocated %d bytes", alloc)
+	}
+	stream, err := NewClient(0).OpenContext(ctx, srv.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+	if _, err := io.Copy(io.Discard, stream.Body); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge streaming the bomb, got %v", err)
+	}
+
+	// Under a limit it fits, it decodes in full
+	resp, err := NewClient(0).GetContext(WithBodyLimit(context.Background(), 64<<20), srv.URL+"/")
+	if err != nil || len(resp.Body) != 64<<20 {
+		t.Errorf("expected the body within the limit decoded, got %v", err)
+	}
+}
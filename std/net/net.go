@@ -1,47 +1,283 @@
 package net
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
+	gonet "net"
 	"net/http"
 	"net/url"
 	"strings"
+	"syscall"
 	"time"
 )
 
 const userAgent = "louis14/1.0 (compatible; Go)"
 
-// httpClient is a shared HTTP client with reasonable timeouts.
-var httpClient = &http.Client{
-	Timeout: 30 * time.Second,
+// maxRedirects is the number of 3xx hops followed before giving up.
+const maxRedirects = 10
+
+// defaultCacheEntries is the capacity of the shared response cache.
+const defaultCacheEntries = 256
+
+// Response is the result of a successful fetch.
+type Response struct {
+	URL          string // Final URL after following redirects
+	StatusCode   int
+	Body         []byte // Decoded body (content-encoding removed, text converted to UTF-8)
+	ContentType  string // Raw Content-Type header value
+	Charset      string // Charset from Content-Type, lowercased ("" if absent); sniffed for HTML
+	ETag         string
+	LastModified string
+	FromCache    bool // True if the body was served from the cache (fresh or revalidated)
+}
+
+// StatusError is returned by a fetch whose server answered with a status
+// other than 2xx.
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HTTP %d fetching %s", e.StatusCode, e.URL)
+}
+
+// Client fetches resources over HTTP/HTTPS. It follows redirects, decodes
+// gzip/deflate content encodings, converts text bodies to UTF-8 using the
+// Content-Type charset (for HTML, the one SniffHTMLCharset finds), and
+// keeps an LRU cache of responses that is revalidated with ETag /
+// Last-Modified. A client given a Jar keeps the cookies responses set and
+// sends them with later requests, including those redirects lead to;
+// without one, as for the shared DefaultClient of servers rendering
+// untrusted pages, cookies are neither kept nor sent.
+type Client struct {
+	http  *http.Client
+	cache *Cache // nil disables caching
+	jar   *Jar   // nil: no cookies
+}
+
+// NewClient creates a Client with an LRU cache holding up to cacheEntries
+// responses and no cookie jar. A cacheEntries of zero disables caching.
+func NewClient(cacheEntries int) *Client {
+	c := &Client{
+		http: &http.Client{
+			Transport: newTransport(),
+			Timeout:   30 * time.Second,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxRedirects {
+					return fmt.Errorf("stopped after %d redirects", maxRedirects)
+				}
+				req.Header.Set("User-Agent", userAgent)
+				return checkURL(req.Context(), req.URL)
+			},
+		},
+	}
+	if cacheEntries > 0 {
+		c.cache = NewCache(cacheEntries)
+	}
+	return c
+}
+
+// transport is the http.RoundTripper of a Client. Requests under an
+// address check keep to their own connections, so they never reuse one
+// made without the check.
+type transport struct {
+	plain, checked *http.Transport
+}
+
+func newTransport() *transport {
+	t := &transport{
+		plain:   http.DefaultTransport.(*http.Transport).Clone(),
+		checked: http.DefaultTransport.(*http.Transport).Clone(),
+	}
+	t.plain.DialContext = dial
+	t.checked.DialContext = dial
+	t.checked.Proxy = nil // A proxy's address is not the server's
+	return t
 }
 
-// Fetch retrieves the content at the given URL via HTTP/HTTPS.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Context().Value(addrCheckKey{}) != nil {
+		return t.checked.RoundTrip(req)
+	}
+	return t.plain.RoundTrip(req)
+}
+
+// dial connects to addr, once the address check of ctx allows the IP
+// address it resolves to.
+func dial(ctx context.Context, network, addr string) (gonet.Conn, error) {
+	dialer := &gonet.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			return checkAddr(ctx, address)
+		},
+	}
+	return dialer.DialContext(ctx, network, addr)
+}
+
+// DefaultClient is the shared client used by Fetch.
+var DefaultClient = NewClient(defaultCacheEntries)
+
+// Fetch retrieves the content at the given URL via HTTP/HTTPS using DefaultClient.
 // Returns the response body, content type, and any error.
 func Fetch(rawURL string) (body []byte, contentType string, err error) {
-	req, err := http.NewRequest("GET", rawURL, nil)
+	return FetchContext(context.Background(), rawURL)
+}
+
+// FetchContext is Fetch with a context that cancels the request.
+func FetchContext(ctx context.Context, rawURL string) (body []byte, contentType string, err error) {
+	resp, err := DefaultClient.GetContext(ctx, rawURL)
 	if err != nil {
-		return nil, "", fmt.Errorf("creating request: %w", err)
+		return nil, "", err
 	}
-	req.Header.Set("User-Agent", userAgent)
+	return resp.Body, resp.ContentType, nil
+}
+
+// Cache returns the client's response cache, or nil if caching is disabled.
+func (c *Client) Cache() *Cache {
+	return c.cache
+}
+
+// Jar returns the client's cookie jar, or nil if it has none.
+func (c *Client) Jar() *Jar {
+	return c.jar
+}
 
-	resp, err := httpClient.Do(req)
+// SetJar gives the client a cookie jar, such as a file-backed one so that
+// cookies persist across sessions, as a browser does. It must be called
+// before the client fetches.
+func (c *Client) SetJar(jar *Jar) {
+	c.jar = jar
+	c.http.Jar = jar
+}
+
+// Get fetches rawURL. A fresh cached response is returned without touching
+// the network; a stale one is revalidated with a conditional request and
+// reused on 304 Not Modified.
+func (c *Client) Get(rawURL string) (*Response, error) {
+	return c.GetContext(context.Background(), rawURL)
+}
+
+// GetContext is Get with a context that cancels the request, including
+// reading its body.
+func (c *Client) GetContext(ctx context.Context, rawURL string) (*Response, error) {
+	var cached *cacheEntry
+	if c.cache != nil {
+		if entry, ok := c.cache.get(rawURL); ok {
+			if entry.fresh(time.Now()) {
+				return cachedResponse(ctx, entry)
+			}
+			cached = entry
+		}
+	}
+
+	req, err := newRequest(ctx, rawURL, cached)
+	if err != nil {
+		return nil, err
+	}
+
+	httpResp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", rawURL, err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode == http.StatusNotModified && cached != nil {
+		c.cache.refresh(rawURL, expiryFromHeaders(httpResp.Header, time.Now()))
+		return cachedResponse(ctx, cached)
+	}
+
+	if httpResp.StatusCode < 200 || httpResp.StatusCode >= 300 {
+		return nil, &StatusError{URL: rawURL, StatusCode: httpResp.StatusCode}
+	}
+
+	raw, err := io.ReadAll(limitBody(ctx, httpResp.Body))
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %w", err)
+	}
+	body, err := decodeContentEncoding(ctx, raw, httpResp.Header.Get("Content-Encoding"))
 	if err != nil {
-		return nil, "", fmt.Errorf("fetching %s: %w", rawURL, err)
+		return nil, fmt.Errorf("decoding response body: %w", err)
+	}
+	if err := checkBodySize(ctx, len(body)); err != nil {
+		return nil, err
+	}
+
+	contentType := httpResp.Header.Get("Content-Type")
+	charset := ParseCharset(contentType)
+	if isHTMLContentType(contentType) {
+		// Pages may declare their encoding in the document instead
+		body, charset = DecodeHTML(body, contentType)
+	} else if isTextContentType(contentType) {
+		if utf8Body, err := DecodeToUTF8(body, charset); err == nil {
+			body = utf8Body
+		}
+	}
+
+	resp := &Response{
+		URL:          httpResp.Request.URL.String(),
+		StatusCode:   httpResp.StatusCode,
+		Body:         body,
+		ContentType:  contentType,
+		Charset:      charset,
+		ETag:         httpResp.Header.Get("ETag"),
+		LastModified: httpResp.Header.Get("Last-Modified"),
+	}
+
+	if c.cache != nil && cacheable(httpResp.Header) {
+		c.cache.put(rawURL, resp, expiryFromHeaders(httpResp.Header, time.Now()))
 	}
-	defer resp.Body.Close()
+	return resp, nil
+}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, "", fmt.Errorf("HTTP %d fetching %s", resp.StatusCode, rawURL)
+// cachedResponse returns the response of a cache entry, if it is within
+// the body limit of ctx.
+func cachedResponse(ctx context.Context, entry *cacheEntry) (*Response, error) {
+	resp := entry.response()
+	if err := checkBodySize(ctx, len(resp.Body)); err != nil {
+		return nil, err
 	}
+	return resp, nil
+}
 
-	body, err = io.ReadAll(resp.Body)
+// newRequest creates the GET request for rawURL, conditional on the
+// validators of cached if it is not nil.
+func newRequest(ctx context.Context, rawURL string, cached *cacheEntry) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
 	if err != nil {
-		return nil, "", fmt.Errorf("reading response body: %w", err)
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	// Setting Accept-Encoding ourselves disables the transport's transparent
+	// gzip handling, so decodeContentEncoding and contentDecoder must handle
+	// every listed coding.
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	if cached != nil {
+		if cached.resp.ETag != "" {
+			req.Header.Set("If-None-Match", cached.resp.ETag)
+		}
+		if cached.resp.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.resp.LastModified)
+		}
 	}
+	return req, nil
+}
 
-	contentType = resp.Header.Get("Content-Type")
-	return body, contentType, nil
+// decodeContentEncoding removes a gzip or deflate Content-Encoding. The
+// decoded body is held to the limit of ctx as it inflates, so a small
+// compressed body can't expand without bound.
+func decodeContentEncoding(ctx context.Context, body []byte, encoding string) ([]byte, error) {
+	r, err := contentDecoder(bytes.NewReader(body), encoding)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := r.(io.Closer); ok {
+		defer r.Close()
+	}
+	return io.ReadAll(limitBody(ctx, r))
 }
 
 // ResolveURL resolves a possibly-relative URI against a base URL.
@@ -0,0 +1,150 @@
+package net
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// compress returns s compressed by the writer newWriter makes.
+func compress(t *testing.T, s string, newWriter func(io.Writer) io.WriteCloser) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := newWriter(&buf)
+	if _, err := io.WriteString(w, s); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestClient_DecodesContentEncoding(t *testing.T) {
+	const page = "<p>compressed</p>"
+	bodies := map[string]struct {
+		encoding string
+		body     []byte
+	}{
+		"/gzip": {"gzip", compress(t, page, func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })},
+		"/zlib": {"deflate", compress(t, page, func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) })},
+		"/raw": {"deflate", compress(t, page, func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		})},
+		"/identity": {"", []byte(page)},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Accept-Encoding"); got != "gzip, deflate" {
+			t.Errorf("Accept-Encoding: got %q", got)
+		}
+		b := bodies[r.URL.Path]
+		if b.encoding != "" {
+			w.Header().Set("Content-Encoding", b.encoding)
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write(b.body)
+	}))
+	defer srv.Close()
+
+	for path := range bodies {
+		resp, err := NewClient(0).Get(srv.URL + path)
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		if string(resp.Body) != page {
+			t.Errorf("%s: got body %q", path, resp.Body)
+		}
+
+		stream, err := NewClient(0).Open(srv.URL + path)
+		if err != nil {
+			t.Errorf("%s: open: %v", path, err)
+			continue
+		}
+		body, err := io.ReadAll(stream.Body)
+		stream.Body.Close()
+		if err != nil || string(body) != page {
+			t.Errorf("%s: streamed %q, %v", path, body, err)
+		}
+	}
+}
+
+func TestClient_ConvertsCharset(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        string
+		want        string
+		charset     string
+	}{
+		{"text/plain; charset=ISO-8859-1", "caf\xe9", "café", "iso-8859-1"},
+		{"text/css; charset=windows-1251", "\xcf\xf0\xe8", "При", "windows-1251"},
+		{"application/json; charset=shift_jis", "\x93\xfa\x96\x7b", "日本", "shift_jis"},
+		{"text/plain", "café", "café", ""},
+		// Bytes that are not text are left alone
+		{"image/png; charset=latin1", "\xe9", "\xe9", "latin1"},
+		// HTML may declare its charset in the document
+		{"text/html", "<meta charset=latin1>caf\xe9", "<meta charset=latin1>café", "windows-1252"},
+		{"text/html; charset=utf-8", "\xef\xbb\xbfcafé", "café", "utf-8"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		tt := tests[i]
+		w.Header().Set("Content-Type", tt.contentType)
+		io.WriteString(w, tt.body)
+	}))
+	defer srv.Close()
+
+	for i, tt := range tests {
+		resp, err := NewClient(0).Get(fmt.Sprintf("%s/%d", srv.URL, i))
+		if err != nil {
+			t.Errorf("%s: %v", tt.contentType, err)
+			continue
+		}
+		if string(resp.Body) != tt.want || resp.Charset != tt.charset {
+			t.Errorf("%s: got %q in %q, want %q in %q", tt.contentType, resp.Body, resp.Charset, tt.want, tt.charset)
+		}
+	}
+}
+
+func TestClient_RedirectLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		if n > 0 {
+			http.Redirect(w, r, fmt.Sprintf("/%d", n-1), http.StatusFound)
+			return
+		}
+		w.Write([]byte("end"))
+	}))
+	defer srv.Close()
+
+	resp, err := NewClient(0).Get(srv.URL + fmt.Sprintf("/%d", maxRedirects-1))
+	if err != nil {
+		t.Fatalf("expected %d redirects followed, got %v", maxRedirects-1, err)
+	}
+	if string(resp.Body) != "end" || resp.URL != srv.URL+"/0" {
+		t.Errorf("expected the final URL's body, got %q from %s", resp.Body, resp.URL)
+	}
+
+	_, err = NewClient(0).Get(srv.URL + fmt.Sprintf("/%d", maxRedirects))
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("stopped after %d redirects", maxRedirects)) {
+		t.Errorf("expected the redirect limit, got %v", err)
+	}
+}
+
+func TestClient_StatusError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	_, err := NewClient(0).Get(srv.URL + "/missing")
+	if se, ok := err.(*StatusError); !ok || se.StatusCode != http.StatusNotFound {
+		t.Errorf("expected a 404 StatusError, got %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+package net
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+)
+
+// Stream is a response whose body is read as it arrives, so a page can be
+// parsed before all of it has downloaded.
+type Stream struct {
+	URL         string        // Final URL after following redirects
+	ContentType string        // Raw Content-Type header value
+	Charset     string        // As in Response
+	Body        io.ReadCloser // Decoded as in Response, as it is read
+}
+
+// Open starts fetching rawURL using DefaultClient and returns its body as
+// a stream.
+func Open(rawURL string) (*Stream, error) {
+	return DefaultClient.OpenContext(context.Background(), rawURL)
+}
+
+// OpenContext is Open with a context, using DefaultClient.
+func OpenContext(ctx context.Context, rawURL string) (*Stream, error) {
+	return DefaultClient.OpenContext(ctx, rawURL)
+}
+
+// Open is Get for a body read as it arrives. The body is decoded as Get
+// decodes it; an HTML document's encoding is sniffed from its first 1024
+// bytes. A response read to its end is cached as Get caches it.
+func (c *Client) Open(rawURL string) (*Stream, error) {
+	return c.OpenContext(context.Background(), rawURL)
+}
+
+// OpenContext is Open with a context that cancels the request, including
+// reading its body.
+func (c *Client) OpenContext(ctx context.Context, rawURL string) (*Stream, error) {
+	var cached *cacheEntry
+	if c.cache != nil {
+		if entry, ok := c.cache.get(rawURL); ok {
+			if entry.fresh(time.Now()) {
+				return cachedStream(cachedResponse(ctx, entry))
+			}
+			cached = entry
+		}
+	}
+
+	req, err := newRequest(ctx, rawURL, cached)
+	if err != nil {
+		return nil, err
+	}
+	httpResp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", rawURL, err)
+	}
+
+	if httpResp.StatusCode == http.StatusNotModified && cached != nil {
+		httpResp.Body.Close()
+		c.cache.refresh(rawURL, expiryFromHeaders(httpResp.Header, time.Now()))
+		return cachedStream(cachedResponse(ctx, cached))
+	}
+	if httpResp.StatusCode < 200 || httpResp.StatusCode >= 300 {
+		httpResp.Body.Close()
+		return nil, &StatusError{URL: rawURL, StatusCode: httpResp.StatusCode}
+	}
+
+	body, err := contentDecoder(httpResp.Body, httpResp.Header.Get("Content-Encoding"))
+	if err != nil {
+		httpResp.Body.Close()
+		return nil, fmt.Errorf("decoding response body: %w", err)
+	}
+	contentType := httpResp.Header.Get("Content-Type")
+	charset := ParseCharset(contentType)
+	if isHTMLContentType(contentType) {
+		// Pages may declare their encoding in the document instead
+		body, charset = htmlDecoder(body, contentType)
+	} else if isTextContentType(contentType) && charset != "" && charset != "utf-8" && charset != "utf8" {
+		if enc, err := htmlindex.Get(charset); err == nil {
+			body = transform.NewReader(body, enc.NewDecoder())
+		}
+	}
+
+	body = limitBody(ctx, body)
+	s := &Stream{
+		URL:         httpResp.Request.URL.String(),
+		ContentType: contentType,
+		Charset:     charset,
+	}
+	if c.cache != nil && cacheable(httpResp.Header) {
+		body = &cachingReader{r: body, done: func(data []byte) {
+			c.cache.put(rawURL, &Response{
+				URL:          s.URL,
+				StatusCode:   httpResp.StatusCode,
+				Body:         data,
+				ContentType:  contentType,
+				Charset:      charset,
+				ETag:         httpResp.Header.Get("ETag"),
+				LastModified: httpResp.Header.Get("Last-Modified"),
+			}, expiryFromHeaders(httpResp.Header, time.Now()))
+		}}
+	}
+	s.Body = struct {
+		io.Reader
+		io.Closer
+	}{body, httpResp.Body}
+	return s, nil
+}
+
+// cachedStream returns a stream of a cached response, or the error getting
+// it.
+func cachedStream(resp *Response, err error) (*Stream, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &Stream{
+		URL:         resp.URL,
+		ContentType: resp.ContentType,
+		Charset:     resp.Charset,
+		Body:        io.NopCloser(bytes.NewReader(resp.Body)),
+	}, nil
+}
+
+// contentDecoder returns a reader that removes a gzip or deflate
+// Content-Encoding from body as it arrives. "deflate" is nominally
+// zlib-wrapped, but some servers send raw DEFLATE, so both are accepted.
+func contentDecoder(body io.Reader, encoding string) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		// A zlib header is two bytes whose big-endian value is a multiple
+		// of 31, the first naming the deflate method
+		br := bufio.NewReader(body)
+		if header, err := br.Peek(2); err == nil && header[0]&0x0f == 8 && (int(header[0])<<8|int(header[1]))%31 == 0 {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
+
+// htmlDecoder is DecodeHTML for a document read as it arrives: it finds
+// the encoding from the first 1024 bytes.
+func htmlDecoder(body io.Reader, contentType string) (io.Reader, string) {
+	br := bufio.NewReaderSize(body, 1024)
+	prefix, _ := br.Peek(1024)
+	charset := SniffHTMLCharset(trimPartialRune(prefix), contentType)
+	switch {
+	case charset == "utf-8":
+		if bytes.HasPrefix(prefix, []byte("\xef\xbb\xbf")) {
+			br.Discard(3)
+		}
+		return br, charset
+	case strings.HasPrefix(charset, "utf-16") && bomCharset(prefix) == charset:
+		br.Discard(2)
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return br, "utf-8"
+	}
+	return transform.NewReader(br, enc.NewDecoder()), charset
+}
+
+// trimPartialRune removes a UTF-8 sequence cut off at the end of prefix,
+// so a prefix of a UTF-8 document is valid UTF-8.
+func trimPartialRune(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0 && i >= len(prefix)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(prefix[i]) {
+			if !utf8.FullRune(prefix[i:]) {
+				return prefix[:i]
+			}
+			break
+		}
+	}
+	return prefix
+}
+
+// cachingReader keeps what is read through it and passes all of it to
+// done when the end is reached.
+type cachingReader struct {
+	r    io.Reader
+	buf  bytes.Buffer
+	done func([]byte)
+}
+
+func (c *cachingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.buf.Write(p[:n])
+	if err == io.EOF && c.done != nil {
+		c.done(c.buf.Bytes())
+		c.done = nil
+	}
+	return n, err
+}